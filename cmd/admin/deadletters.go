@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/config"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/queue"
+	"github.com/spf13/cobra"
+)
+
+// dead-letters list flags
+var deadLettersLimit int
+
+var deadLettersCmd = &cobra.Command{
+	Use:   "dead-letters",
+	Short: "Inspect and replay dead-lettered work requests",
+	Long: `Inspect, replay, and discard work requests that were moved to the queue's
+dead-letter queue after exhausting CANOPY_QUEUE_MAX_DELIVERIES, or because they
+aren't valid work requests.
+
+The queue is configured with the same CANOPY_QUEUE_* variables the worker uses.
+Only the redis and pubsub queues have a dead-letter queue.
+
+Examples:
+  canopy-admin dead-letters list
+  canopy-admin dead-letters replay 1718000000000-0
+  canopy-admin dead-letters discard 1718000000000-0 1718000000001-0`,
+}
+
+var deadLettersListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List dead-lettered work requests, oldest first",
+	Args:  cobra.NoArgs,
+	RunE:  runDeadLettersList,
+}
+
+var deadLettersReplayCmd = &cobra.Command{
+	Use:   "replay <id>...",
+	Short: "Publish dead-lettered work requests to the queue again",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return eachDeadLetter(cmd.Context(), args, "replay", "Replayed", func(ctx context.Context, q queue.DeadLetterQueue, id string) error {
+			return q.ReplayDeadLetter(ctx, id)
+		})
+	},
+}
+
+var deadLettersDiscardCmd = &cobra.Command{
+	Use:   "discard <id>...",
+	Short: "Remove dead-lettered work requests without replaying them",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return eachDeadLetter(cmd.Context(), args, "discard", "Discarded", func(ctx context.Context, q queue.DeadLetterQueue, id string) error {
+			return q.DiscardDeadLetter(ctx, id)
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(deadLettersCmd)
+	deadLettersCmd.AddCommand(deadLettersListCmd, deadLettersReplayCmd, deadLettersDiscardCmd)
+
+	deadLettersListCmd.Flags().IntVar(&deadLettersLimit, "limit", 100, "Maximum number of dead letters to list")
+}
+
+func runDeadLettersList(cmd *cobra.Command, args []string) error {
+	if deadLettersLimit <= 0 {
+		return fmt.Errorf("--limit must be positive")
+	}
+	return withDeadLetterQueue(cmd.Context(), func(ctx context.Context, q queue.DeadLetterQueue) error {
+		letters, err := q.DeadLetters(ctx, deadLettersLimit)
+		if err != nil {
+			return fmt.Errorf("failed to list dead letters: %w", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tREPOSITORY\tRUN\tDELIVERIES\tDEAD-LETTERED\tREASON")
+		for _, l := range letters {
+			repo, run := "(malformed)", "-"
+			if l.Request != nil {
+				repo = l.Request.Org + "/" + l.Request.Repo
+				run = fmt.Sprintf("%d", l.Request.WorkflowRunID)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n",
+				l.ID, repo, run, l.Deliveries, l.DeadLetteredAt.UTC().Format(time.RFC3339), l.Reason)
+		}
+		return w.Flush()
+	})
+}
+
+// eachDeadLetter runs fn for every dead letter ID, reporting each result and
+// failing if any of them failed.
+func eachDeadLetter(ctx context.Context, ids []string, verb, done string, fn func(context.Context, queue.DeadLetterQueue, string) error) error {
+	return withDeadLetterQueue(ctx, func(ctx context.Context, q queue.DeadLetterQueue) error {
+		failed := 0
+		for _, id := range ids {
+			if err := fn(ctx, q, id); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to %s %s: %v\n", verb, id, err)
+				failed++
+				continue
+			}
+			fmt.Printf("%s %s\n", done, id)
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d dead letters failed to %s", failed, len(ids), verb)
+		}
+		return nil
+	})
+}
+
+// withDeadLetterQueue opens the queue configured by the CANOPY_QUEUE_*
+// environment variables, as the worker does, and runs fn with it.
+func withDeadLetterQueue(ctx context.Context, fn func(context.Context, queue.DeadLetterQueue) error) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	cfg, err := config.LoadQueue()
+	if err != nil {
+		return fmt.Errorf("failed to load queue configuration: %w", err)
+	}
+
+	var q interface {
+		queue.MessageQueue
+		queue.DeadLetterQueue
+	}
+	switch cfg.Type {
+	case config.QueueTypeRedis:
+		q, err = queue.NewRedisQueue(ctx, queue.RedisConfig{
+			Address:             cfg.RedisAddr,
+			Password:            cfg.RedisPassword,
+			DB:                  cfg.RedisDB,
+			StreamKey:           cfg.RedisStream,
+			ConsumerGroup:       cfg.RedisConsumerGroup,
+			ConsumerName:        "canopy-admin",
+			MaxDeliveries:       int64(cfg.MaxDeliveries),
+			DeadLetterStreamKey: cfg.RedisDeadLetterStream,
+		})
+	case config.QueueTypePubSub:
+		q, err = queue.NewPubSubQueue(ctx, queue.PubSubConfig{
+			ProjectID:                  cfg.PubSubProjectID,
+			TopicName:                  cfg.PubSubTopicID,
+			SubscriptionName:           cfg.PubSubSubscription,
+			MaxDeliveries:              cfg.MaxDeliveries,
+			DeadLetterTopicName:        cfg.PubSubDeadLetterTopicID,
+			DeadLetterSubscriptionName: cfg.PubSubDeadLetterSubscription,
+		})
+	default:
+		err = fmt.Errorf("the %s queue has no dead-letter queue", cfg.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open queue: %w", err)
+	}
+	defer q.Close()
+
+	return fn(ctx, q)
+}
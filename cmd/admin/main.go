@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/thresholds"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/token"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Version information (set via ldflags during build)
+	version = "dev"
+	commit  = "unknown"
+	date    = "unknown"
+
+	// Token store flags
+	redisAddr     string
+	redisPassword string
+	redisDB       int
+
+	// token create flags
+	tokenName   string
+	tokenOrg    string
+	tokenRepo   string
+	tokenScopes []string
+	tokenTTL    string
+
+	// token list flags
+	listOrg string
+
+	// onboard flags
+	onboardOrg             string
+	onboardGitHubToken     string
+	onboardGitHubAPI       string
+	onboardOpenPRs         bool
+	onboardSeedBaselines   bool
+	onboardIncludeArchived bool
+	onboardIncludeForks    bool
+
+	// suggest-thresholds flags
+	suggestRepo        string
+	suggestBranch      string
+	suggestCommits     int
+	suggestPercentile  float64
+	suggestOutput      string
+	suggestGitHubToken string
+	suggestGitHubAPI   string
+
+	// prune flags
+	pruneOlderThan  string
+	pruneKeepLatest int
+	pruneRepos      []string
+	pruneDryRun     bool
+)
+
+func main() {
+	if err := rootCmd.Execute(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+var rootCmd = &cobra.Command{
+	Use:   "canopy-admin",
+	Short: "Canopy Admin - Administrative tasks for a Canopy deployment",
+	Long: `Canopy Admin performs administrative tasks against a Canopy deployment,
+such as issuing and revoking API tokens for the upload and query APIs,
+onboarding the repositories of an org, suggesting coverage thresholds, and
+pruning old per-commit coverage.
+
+Tokens are stored in Redis, hashed at rest. Connection settings default to the
+same environment variables the services use (CANOPY_REDIS_ADDR,
+CANOPY_REDIS_PASSWORD, CANOPY_REDIS_DB).`,
+	SilenceUsage: true,
+}
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print version information",
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Printf("Canopy Admin %s\n", version)
+		fmt.Printf("  commit: %s\n", commit)
+		fmt.Printf("  built:  %s\n", date)
+	},
+}
+
+var tokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Manage API tokens",
+}
+
+var tokenCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Issue a new API token",
+	Long: `Issue a new API token scoped to an org, and optionally a single repository.
+
+The token is printed once and cannot be recovered later; store it as a secret.`,
+	Args: cobra.NoArgs,
+	RunE: runTokenCreate,
+}
+
+var tokenRevokeCmd = &cobra.Command{
+	Use:   "revoke <token-id>",
+	Short: "Revoke an API token",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runTokenRevoke,
+}
+
+var tokenListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List API tokens",
+	Args:  cobra.NoArgs,
+	RunE:  runTokenList,
+}
+
+func init() {
+	// Add subcommands
+	rootCmd.AddCommand(versionCmd)
+	rootCmd.AddCommand(tokenCmd)
+	rootCmd.AddCommand(onboardCmd)
+	rootCmd.AddCommand(suggestThresholdsCmd)
+	rootCmd.AddCommand(pruneCmd)
+	tokenCmd.AddCommand(tokenCreateCmd, tokenRevokeCmd, tokenListCmd)
+
+	defaultDB, _ := strconv.Atoi(getEnv("CANOPY_REDIS_DB", "0"))
+	tokenCmd.PersistentFlags().StringVar(&redisAddr, "redis-addr", getEnv("CANOPY_REDIS_ADDR", "localhost:6379"), "Redis address for the token store")
+	tokenCmd.PersistentFlags().StringVar(&redisPassword, "redis-password", os.Getenv("CANOPY_REDIS_PASSWORD"), "Redis password for the token store")
+	tokenCmd.PersistentFlags().IntVar(&redisDB, "redis-db", defaultDB, "Redis database number for the token store")
+
+	tokenCreateCmd.Flags().StringVar(&tokenName, "name", "", "Human-readable token name (e.g., \"mimir CI uploads\")")
+	tokenCreateCmd.Flags().StringVar(&tokenOrg, "org", "", "Organization the token is scoped to (required)")
+	tokenCreateCmd.Flags().StringVar(&tokenRepo, "repo", "", "Repository the token is scoped to (default: all repositories in the org)")
+	tokenCreateCmd.Flags().StringSliceVar(&tokenScopes, "scope", []string{string(token.ScopeUpload)}, "Token scopes (upload, query, admin)")
+	tokenCreateCmd.Flags().StringVar(&tokenTTL, "expires-in", "90d", "Token lifetime (e.g., 720h, 90d); 0 never expires")
+	_ = tokenCreateCmd.MarkFlagRequired("org")
+
+	tokenListCmd.Flags().StringVar(&listOrg, "org", "", "Only list tokens for this organization")
+
+	onboardCmd.Flags().StringVar(&onboardOrg, "org", "", "Organization to onboard (required)")
+	onboardCmd.Flags().StringVar(&onboardGitHubToken, "github-token", os.Getenv("GITHUB_TOKEN"), "GitHub token with read access to the org's repositories (write access for --open-prs)")
+	onboardCmd.Flags().StringVar(&onboardGitHubAPI, "github-api", github.DefaultBaseURL, "GitHub REST API endpoint")
+	onboardCmd.Flags().BoolVar(&onboardOpenPRs, "open-prs", false, "Open a pull request adding a coverage workflow to repositories without one")
+	onboardCmd.Flags().BoolVar(&onboardSeedBaselines, "seed-baselines", false, "Store an empty baseline for repositories without stored coverage (storage is configured with the CANOPY_STORAGE_* variables)")
+	onboardCmd.Flags().BoolVar(&onboardIncludeArchived, "include-archived", false, "Onboard archived repositories too")
+	onboardCmd.Flags().BoolVar(&onboardIncludeForks, "include-forks", false, "Onboard forked repositories too")
+	_ = onboardCmd.MarkFlagRequired("org")
+
+	suggestThresholdsCmd.Flags().StringVar(&suggestRepo, "repo", "", "Repository as org/repo (required)")
+	suggestThresholdsCmd.Flags().StringVar(&suggestBranch, "branch", "", "Branch whose history is used (default: the default branch)")
+	suggestThresholdsCmd.Flags().IntVar(&suggestCommits, "commits", thresholds.DefaultCommits, "Number of recent commits considered")
+	suggestThresholdsCmd.Flags().Float64Var(&suggestPercentile, "percentile", thresholds.DefaultPercentile, "Percentile of recent coverage each threshold is set at")
+	suggestThresholdsCmd.Flags().StringVarP(&suggestOutput, "output", "o", "", "Write the config to this file instead of stdout")
+	suggestThresholdsCmd.Flags().StringVar(&suggestGitHubToken, "github-token", os.Getenv("GITHUB_TOKEN"), "GitHub token with read access to the repository")
+	suggestThresholdsCmd.Flags().StringVar(&suggestGitHubAPI, "github-api", github.DefaultBaseURL, "GitHub REST API endpoint")
+	_ = suggestThresholdsCmd.MarkFlagRequired("repo")
+
+	pruneCmd.Flags().StringVar(&pruneOlderThan, "older-than", "", "Prune commits' coverage older than this (e.g., 90d, 2w, 36h) (required)")
+	pruneCmd.Flags().IntVar(&pruneKeepLatest, "keep-latest", 10, "Number of newest commits of each branch always kept")
+	pruneCmd.Flags().StringSliceVar(&pruneRepos, "repo", nil, "Only prune this org or org/repo (repeatable; default: all repositories)")
+	pruneCmd.Flags().BoolVar(&pruneDryRun, "dry-run", false, "List what would be pruned without deleting it")
+	_ = pruneCmd.MarkFlagRequired("older-than")
+}
+
+func runTokenCreate(cmd *cobra.Command, args []string) error {
+	ttl, err := parseTTL(tokenTTL)
+	if err != nil {
+		return err
+	}
+
+	var scopes []token.Scope
+	for _, name := range tokenScopes {
+		scope, err := token.ParseScope(name)
+		if err != nil {
+			return err
+		}
+		scopes = append(scopes, scope)
+	}
+
+	return withManager(cmd.Context(), func(ctx context.Context, m *token.Manager) error {
+		t, plaintext, err := m.Issue(ctx, token.IssueRequest{
+			Name:   tokenName,
+			Org:    tokenOrg,
+			Repo:   tokenRepo,
+			Scopes: scopes,
+			TTL:    ttl,
+		})
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "Created token %s (expires: %s)\n", t.ID, formatExpiry(t.ExpiresAt))
+		fmt.Fprintln(os.Stderr, "Store it now; it will not be shown again.")
+		fmt.Println(plaintext)
+		return nil
+	})
+}
+
+func runTokenRevoke(cmd *cobra.Command, args []string) error {
+	return withManager(cmd.Context(), func(ctx context.Context, m *token.Manager) error {
+		if err := m.Revoke(ctx, args[0]); err != nil {
+			return fmt.Errorf("failed to revoke token %s: %w", args[0], err)
+		}
+		fmt.Printf("Revoked token %s\n", args[0])
+		return nil
+	})
+}
+
+func runTokenList(cmd *cobra.Command, args []string) error {
+	return withManager(cmd.Context(), func(ctx context.Context, m *token.Manager) error {
+		tokens, err := m.List(ctx, listOrg)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tORG\tREPO\tSCOPES\tEXPIRES\tSTATUS")
+		for _, t := range tokens {
+			repo := t.Repo
+			if repo == "" {
+				repo = "*"
+			}
+			scopes := make([]string, len(t.Scopes))
+			for i, s := range t.Scopes {
+				scopes[i] = string(s)
+			}
+			status := "active"
+			switch {
+			case t.RevokedAt != nil:
+				status = "revoked"
+			case !t.ExpiresAt.IsZero() && !time.Now().Before(t.ExpiresAt):
+				status = "expired"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				t.ID, t.Name, t.Org, repo, strings.Join(scopes, ","), formatExpiry(t.ExpiresAt), status)
+		}
+		return w.Flush()
+	})
+}
+
+// withManager connects to the token store and runs fn with a Manager.
+func withManager(ctx context.Context, fn func(context.Context, *token.Manager) error) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	store, err := token.NewRedisStore(ctx, token.RedisConfig{
+		Address:  redisAddr,
+		Password: redisPassword,
+		DB:       redisDB,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to open token store: %w", err)
+	}
+	defer store.Close()
+
+	return fn(ctx, token.NewManager(store))
+}
+
+// parseTTL parses a Go duration, additionally accepting a "d" suffix for days.
+func parseTTL(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "0" {
+		return 0, nil
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid --expires-in: %s", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid --expires-in: %s", s)
+	}
+	return d, nil
+}
+
+// formatExpiry formats an expiration time, treating zero as never.
+func formatExpiry(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// getEnv gets an environment variable with a default value
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/config"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/onboard"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/services"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+var onboardCmd = &cobra.Command{
+	Use:   "onboard",
+	Short: "Onboard the repositories of an org",
+	Long: `Check every repository of an org for Canopy readiness: a go.mod at the
+root and a workflow that writes a coverage profile and uploads it as an
+artifact. Archived and forked repositories are skipped unless included.
+
+With --open-prs, repositories without a coverage workflow get a pull request
+adding one. With --seed-baselines, repositories without stored coverage get an
+empty baseline for their default branch, so their first PRs are compared
+against it.
+
+Progress is printed per repository, followed by a summary table.
+
+Examples:
+  canopy-admin onboard --org acme
+  canopy-admin onboard --org acme --open-prs --seed-baselines`,
+	Args: cobra.NoArgs,
+	RunE: runOnboard,
+}
+
+func runOnboard(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if onboardGitHubToken == "" {
+		return errors.New("a GitHub token is required (--github-token or GITHUB_TOKEN)")
+	}
+
+	client, err := github.NewClient(github.ClientConfig{
+		BaseURL: onboardGitHubAPI,
+		Tokens:  github.StaticToken(onboardGitHubToken),
+	})
+	if err != nil {
+		return err
+	}
+
+	o := &onboard.Onboarder{
+		GitHub:           client,
+		OpenPullRequests: onboardOpenPRs,
+		IncludeArchived:  onboardIncludeArchived,
+		IncludeForks:     onboardIncludeForks,
+		Progress:         os.Stderr,
+	}
+	if onboardSeedBaselines {
+		store, err := openStorage(ctx)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		o.Storage = store
+	}
+
+	results, err := o.Run(ctx, onboardOrg)
+	if err != nil {
+		return err
+	}
+
+	counts := make(map[onboard.Status]int)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "REPO\tSTATUS\tBASELINE\tDETAIL")
+	for _, r := range results {
+		counts[r.Status]++
+		baseline := "-"
+		if r.BaselineSeeded {
+			baseline = "seeded"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Repo, r.Status, baseline, r.Detail)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("\n%d repositories: %d ready, %d PRs opened, %d missing a workflow, %d skipped, %d failed\n",
+		len(results), counts[onboard.StatusReady], counts[onboard.StatusPullRequest],
+		counts[onboard.StatusMissingWorkflow], counts[onboard.StatusSkipped], counts[onboard.StatusFailed])
+
+	if counts[onboard.StatusFailed] > 0 {
+		return fmt.Errorf("%d repositories failed to onboard", counts[onboard.StatusFailed])
+	}
+	return nil
+}
+
+// openStorage opens the storage backend configured by the CANOPY_STORAGE_*
+// environment variables, as the worker does, without a cache.
+func openStorage(ctx context.Context) (storage.Storage, error) {
+	cfg, err := config.LoadStorage()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load storage configuration: %w", err)
+	}
+	return services.OpenStorage(ctx, cfg, nil)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/trend"
+	"github.com/spf13/cobra"
+)
+
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Prune old per-commit coverage",
+	Long: `Delete the per-commit coverage history kept with the commit storage layout
+(CANOPY_STORAGE_LAYOUT=commit) that is older than --older-than. The newest
+--keep-latest commits of each branch are always kept, as is each branch's
+latest coverage, however old. The coverage trends of branches with pruned
+commits are compacted to one point per day before --older-than.
+
+Storage is configured with the same CANOPY_STORAGE_* variables the worker uses.
+
+Examples:
+  canopy-admin prune --older-than 90d --dry-run
+  canopy-admin prune --older-than 30d --keep-latest 50 --repo acme/widgets`,
+	Args: cobra.NoArgs,
+	RunE: runPrune,
+}
+
+func runPrune(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	olderThan, err := storage.ParseRetentionAge(pruneOlderThan)
+	if err != nil {
+		return err
+	}
+	if olderThan == 0 {
+		return errors.New("--older-than must be positive")
+	}
+	if pruneKeepLatest < 0 {
+		return errors.New("--keep-latest must not be negative")
+	}
+
+	store, err := openStorage(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	pruner, ok := store.(storage.Pruner)
+	if !ok {
+		return errors.New("the configured storage does not support pruning")
+	}
+
+	now := time.Now()
+	policy := storage.RetentionPolicy{OlderThan: olderThan, KeepLatest: pruneKeepLatest, Repos: pruneRepos}
+	pruned, err := storage.Prune(ctx, pruner, policy, now, pruneDryRun)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PATH\tUPDATED")
+	for _, obj := range pruned {
+		fmt.Fprintf(w, "%s\t%s\n", obj.Path, obj.Updated.Format(time.RFC3339))
+	}
+	if flushErr := w.Flush(); flushErr != nil && err == nil {
+		err = flushErr
+	}
+	if err != nil {
+		return err
+	}
+
+	compacted, err := compactTrends(ctx, store, pruned, now.Add(-olderThan))
+	if err != nil {
+		return err
+	}
+
+	verb, compactVerb := "Pruned", "Compacted"
+	if pruneDryRun {
+		verb, compactVerb = "Would prune", "Would compact"
+	}
+	fmt.Printf("\n%s %d objects\n", verb, len(pruned))
+	fmt.Printf("%s %d trend points\n", compactVerb, compacted)
+	return nil
+}
+
+// compactTrends compacts the coverage trends of the branches with pruned
+// objects up to cutoff, and returns the number of points removed.
+func compactTrends(ctx context.Context, store storage.Storage, pruned []storage.StoredObject, cutoff time.Time) (int, error) {
+	seen := make(map[storage.CoverageKey]bool)
+	total := 0
+	for _, obj := range pruned {
+		key := trend.Key(obj.Key.Org, obj.Key.Repo, obj.Key.Branch)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		removed, err := trend.CompactStored(ctx, store, key.Org, key.Repo, key.Branch, cutoff, pruneDryRun)
+		if err != nil {
+			return total, fmt.Errorf("failed to compact %s/%s/%s: %w", key.Org, key.Repo, key.Branch, err)
+		}
+		total += removed
+	}
+	return total, nil
+}
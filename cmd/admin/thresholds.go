@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/config"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/thresholds"
+	"github.com/spf13/cobra"
+)
+
+var suggestThresholdsCmd = &cobra.Command{
+	Use:   "suggest-thresholds",
+	Short: "Suggest coverage thresholds from a repository's history",
+	Long: `Suggest per-package coverage thresholds from the stored coverage of a
+branch's recent commits, and print the repository config with them.
+
+Each threshold is a low percentile (by default the 25th) of the package's
+recent coverage, rounded down, so most recent commits would have met it. The
+project threshold is derived the same way from total coverage. Settings of an
+existing .canopy.yml are kept, so the output is ready to commit.
+
+Per-commit history is only kept with CANOPY_STORAGE_LAYOUT=commit; storage is
+configured with the CANOPY_STORAGE_* variables, as for the worker.
+
+Examples:
+  canopy-admin suggest-thresholds --repo acme/widgets
+  canopy-admin suggest-thresholds --repo acme/widgets --percentile 10 -o .canopy.yml`,
+	Args: cobra.NoArgs,
+	RunE: runSuggestThresholds,
+}
+
+func runSuggestThresholds(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	org, repo, ok := strings.Cut(suggestRepo, "/")
+	if !ok || org == "" || repo == "" || strings.Contains(repo, "/") {
+		return fmt.Errorf("invalid --repo %q (expected org/repo)", suggestRepo)
+	}
+	if suggestPercentile <= 0 || suggestPercentile > 100 {
+		return fmt.Errorf("invalid --percentile %g (expected a value in (0, 100])", suggestPercentile)
+	}
+	if suggestGitHubToken == "" {
+		return errors.New("a GitHub token is required (--github-token or GITHUB_TOKEN)")
+	}
+
+	storageCfg, err := config.LoadStorage()
+	if err != nil {
+		return fmt.Errorf("failed to load storage configuration: %w", err)
+	}
+	if storageCfg.Layout != storage.LayoutCommit {
+		return fmt.Errorf("suggesting thresholds needs per-commit history, which is only kept with CANOPY_STORAGE_LAYOUT=%s", storage.LayoutCommit)
+	}
+
+	client, err := github.NewClient(github.ClientConfig{
+		BaseURL: suggestGitHubAPI,
+		Tokens:  github.StaticToken(suggestGitHubToken),
+	})
+	if err != nil {
+		return err
+	}
+	store, err := openStorage(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	s := &thresholds.Suggester{
+		GitHub:     client,
+		Storage:    store,
+		Commits:    suggestCommits,
+		Percentile: suggestPercentile,
+	}
+	suggestion, err := s.Run(ctx, org, repo, suggestBranch)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Suggested %d package thresholds at p%g of %d commits of %s; commit as %s\n",
+		len(suggestion.Thresholds.Packages), suggestion.Percentile, suggestion.Commits, suggestion.Branch, suggestion.ConfigPath)
+	if suggestOutput != "" {
+		return os.WriteFile(suggestOutput, suggestion.Config, 0o644)
+	}
+	_, err = os.Stdout.Write(suggestion.Config)
+	return err
+}
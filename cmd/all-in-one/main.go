@@ -1,13 +1,30 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/buildinfo"
 	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/config"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/logging"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/metrics"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/server"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/services"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/tracing"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/webhook"
 	"github.com/spf13/cobra"
 )
 
+// shutdownTimeout bounds how long the HTTP server waits for in-flight requests.
+const shutdownTimeout = 30 * time.Second
+
 var (
 	// Version information (set via ldflags during build)
 	version = "dev"
@@ -15,8 +32,10 @@ var (
 	date    = "unknown"
 
 	// CLI flags
-	port        int
-	disableHMAC bool
+	port         int
+	listen       string
+	disableHMAC  bool
+	webhookProxy string
 )
 
 func main() {
@@ -35,6 +54,10 @@ This mode is designed for local development and testing. It runs the webhook han
 and coverage processor (worker) together, typically with an in-memory
 message queue.
 
+Use --webhook-proxy with a smee.io channel to receive real GitHub deliveries
+locally without exposing a port. The channel re-encodes payloads, so combine
+it with --disable-hmac.
+
 For production deployments, use separate webhook and worker executables.`,
 	RunE: run,
 }
@@ -55,7 +78,9 @@ func init() {
 
 	// Define flags
 	rootCmd.Flags().IntVar(&port, "port", 8080, "HTTP server port")
+	rootCmd.Flags().StringVar(&listen, "listen", "", "Listen address overriding --port, e.g. unix:///run/canopy.sock or tcp://127.0.0.1:8080")
 	rootCmd.Flags().BoolVar(&disableHMAC, "disable-hmac", false, "Disable HMAC signature validation (for local development only)")
+	rootCmd.Flags().StringVar(&webhookProxy, "webhook-proxy", "", "smee.io-style channel URL to relay webhook deliveries from (for local development only)")
 }
 
 func run(cmd *cobra.Command, args []string) error {
@@ -63,27 +88,239 @@ func run(cmd *cobra.Command, args []string) error {
 	if cmd.Flags().Changed("port") {
 		os.Setenv("CANOPY_PORT", fmt.Sprintf("%d", port))
 	}
+	if cmd.Flags().Changed("listen") {
+		os.Setenv("CANOPY_LISTEN", listen)
+	}
 	if cmd.Flags().Changed("disable-hmac") {
 		os.Setenv("CANOPY_DISABLE_HMAC", fmt.Sprintf("%t", disableHMAC))
 	}
+	if cmd.Flags().Changed("webhook-proxy") {
+		os.Setenv("CANOPY_WEBHOOK_PROXY_URL", webhookProxy)
+	}
 
 	// Load configuration
 	cfg, err := config.Load(config.ModeAllInOne)
 	if err != nil {
 		return fmt.Errorf("failed to load configuration: %w", err)
 	}
+	if err := buildinfo.CheckMinimum(version, cfg.Worker.MinVersion); err != nil {
+		return fmt.Errorf("refusing to start: %w (CANOPY_MIN_WORKER_VERSION)", err)
+	}
 
-	// Print startup information
-	fmt.Printf("Starting Canopy All-in-One on port %d\n", cfg.Port)
+	logger := logging.New(os.Stdout, cfg.LogLevel)
+	slog.SetDefault(logger)
+
+	// Log startup information
+	startup := []any{"version", version, "queue_type", cfg.Queue.Type, "storage_type", cfg.Storage.Type,
+		"github_app_id", cfg.GitHub.AppID, "allowed_orgs", cfg.Webhook.AllowedOrgs}
+	if cfg.Listen != "" {
+		startup = append(startup, "listen", cfg.Listen)
+	} else {
+		startup = append(startup, "port", cfg.Port)
+	}
+	if cfg.Webhook.ProxyURL != "" {
+		startup = append(startup, "webhook_proxy", cfg.Webhook.ProxyURL)
+	}
+	if cfg.Webhook.RepoSyncInterval > 0 {
+		startup = append(startup, "repo_sync_interval", cfg.Webhook.RepoSyncInterval.String())
+	}
+	if cfg.Worker.OrgConfigTTL > 0 {
+		startup = append(startup, "org_config_ttl", cfg.Worker.OrgConfigTTL.String())
+	}
+	if cfg.Webhook.PullRequestEvents {
+		startup = append(startup, "pull_request_events", true)
+	}
+	if cfg.GitLab.Token != "" {
+		startup = append(startup, "gitlab_url", cfg.GitLab.BaseURL, "gitlab_webhook", cfg.GitLab.WebhookSecret != "")
+	}
+	if cfg.Metrics.Port != 0 {
+		startup = append(startup, "metrics_port", cfg.Metrics.Port)
+	}
+	startup = append(startup, "query_api", cfg.API.Enabled, "upload", cfg.API.UploadEnabled, "badges", cfg.Badge.Enabled, "viewer", cfg.Viewer.PublicURL != "")
+	logger.Info("starting canopy all-in-one", startup...)
 	if cfg.DisableHMAC {
-		fmt.Println("WARNING: HMAC validation is disabled. This should only be used for local development.")
+		logger.Warn("HMAC validation is disabled; this should only be used for local development")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(ctx, "canopy")
+	if err != nil {
+		return fmt.Errorf("failed to set up tracing: %w", err)
 	}
-	fmt.Printf("Queue type: %s\n", cfg.Queue.Type)
-	fmt.Printf("Storage type: %s\n", cfg.Storage.Type)
-	fmt.Printf("GitHub App ID: %d\n", cfg.GitHub.AppID)
-	fmt.Printf("Allowed orgs: %v\n", cfg.Webhook.AllowedOrgs)
 
-	// TODO: Start the all-in-one service (both webhook and worker)
-	fmt.Println("All-in-one service not yet implemented")
-	return nil
+	mq, err := services.OpenQueue(ctx, &cfg.Queue, "all-in-one", logger)
+	if err != nil {
+		return fmt.Errorf("failed to open queue: %w", err)
+	}
+	defer mq.Close()
+
+	reads, err := services.OpenCache(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	if reads != nil {
+		defer reads.Close()
+	}
+	store, err := services.OpenStorage(ctx, &cfg.Storage, reads)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	gh, err := services.NewGitHubClient(&cfg.GitHub)
+	if err != nil {
+		return err
+	}
+	gl, err := services.NewGitLabClient(&cfg.GitLab)
+	if err != nil {
+		return err
+	}
+
+	deliveries, err := services.OpenIdempotency(ctx, &cfg.Queue, cfg.Worker.IdempotencyTTL)
+	if err != nil {
+		return err
+	}
+	if deliveries != nil {
+		defer deliveries.Close()
+	}
+
+	w, err := services.NewWorker(cfg, services.WorkerDeps{GitHub: gh, GitLab: gl, Storage: store, Idempotency: deliveries}, version, logger)
+	if err != nil {
+		return err
+	}
+
+	filter := webhook.Filter{
+		AllowedOrgs:      cfg.Webhook.AllowedOrgs,
+		AllowedWorkflows: cfg.Webhook.AllowedWorkflows,
+		AllowedRepos:     cfg.Webhook.AllowedRepos,
+		AllowedBranches:  cfg.Webhook.AllowedBranches,
+	}
+	if cfg.Webhook.RepoSyncInterval > 0 {
+		// Synced once before serving, so events aren't rejected while the
+		// list is empty
+		filter.Repos = webhook.NewInstallationRepos(gh, cfg.Webhook.RepoSyncInterval, logger)
+		if err := filter.Repos.Sync(ctx); err != nil {
+			return err
+		}
+	}
+
+	srv := server.New(server.Config{Port: cfg.Port, Listen: cfg.Listen, Logger: logger})
+	webhookHandler := webhook.NewHandler(webhook.HandlerConfig{
+		Queue:             mq,
+		Secret:            cfg.Webhook.WebhookSecret,
+		DisableHMAC:       cfg.DisableHMAC,
+		Filter:            filter,
+		PullRequestEvents: cfg.Webhook.PullRequestEvents,
+		GitLabSecret:      cfg.GitLab.WebhookSecret,
+		Logger:            logger,
+	})
+	webhookHandler.Register(srv.Mux())
+	metrics.Default.Add(webhookHandler)
+
+	// Metrics are served on the main server unless they have their own port
+	metricsSrv := srv
+	if cfg.Metrics.Port != 0 {
+		metricsSrv = server.New(server.Config{Port: cfg.Metrics.Port, Logger: logger})
+	}
+	metricsSrv.Mux().Handle(metrics.Route, metrics.Default)
+	tokens, err := services.RegisterAPI(ctx, srv.Mux(), cfg, services.APIDeps{Storage: store, GitHub: gh, Queue: mq, Cache: reads}, logger)
+	if err != nil {
+		return err
+	}
+	if tokens != nil {
+		defer tokens.Close()
+	}
+
+	var proxy *webhook.Proxy
+	if cfg.Webhook.ProxyURL != "" {
+		target, err := proxyTarget(cfg)
+		if err != nil {
+			return err
+		}
+		if proxy, err = webhook.NewProxy(cfg.Webhook.ProxyURL, target, logger); err != nil {
+			return err
+		}
+	}
+
+	errs := make(chan error, 5)
+	go func() {
+		errs <- srv.Start()
+	}()
+	if metricsSrv != srv {
+		go func() {
+			errs <- metricsSrv.Start()
+		}()
+	}
+	// The worker drains on shutdown: it stops taking work requests and
+	// finishes those in flight, for up to the drain timeout
+	workerDone := make(chan struct{})
+	go func() {
+		defer close(workerDone)
+		if err := w.Concurrency.SubscribeAndDrain(ctx, mq, cfg.Worker.DrainTimeout, w.ProcessWorkRequest); err != nil && !errors.Is(err, context.Canceled) {
+			errs <- fmt.Errorf("worker stopped: %w", err)
+			return
+		}
+		errs <- nil
+	}()
+	if proxy != nil {
+		go func() {
+			errs <- proxy.Run(ctx)
+		}()
+	}
+	if filter.Repos != nil {
+		go func() {
+			errs <- filter.Repos.Run(ctx)
+		}()
+	}
+
+	// Run until interrupted or a component fails, then stop the others
+	select {
+	case <-ctx.Done():
+	case err = <-errs:
+	}
+	stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if shutdownErr := srv.Shutdown(shutdownCtx); shutdownErr != nil && err == nil {
+		err = shutdownErr
+	}
+	if metricsSrv != srv {
+		if shutdownErr := metricsSrv.Shutdown(shutdownCtx); shutdownErr != nil && err == nil {
+			err = shutdownErr
+		}
+	}
+	// The queue and storage are closed once in-flight requests are done
+	logger.Info("draining work requests", "drain_timeout", cfg.Worker.DrainTimeout.String())
+	<-workerDone
+	// Spans of the requests just finished are flushed last
+	if shutdownErr := shutdownTracing(shutdownCtx); shutdownErr != nil && err == nil {
+		err = shutdownErr
+	}
+	return err
+}
+
+// proxyTarget returns the URL of this process's webhook endpoint, to which
+// the webhook proxy relays deliveries.
+func proxyTarget(cfg *config.Config) (string, error) {
+	if cfg.Listen == "" {
+		return fmt.Sprintf("http://127.0.0.1:%d/webhook", cfg.Port), nil
+	}
+	network, addr, err := server.ParseListen(cfg.Listen)
+	if err != nil {
+		return "", err
+	}
+	if network != "tcp" {
+		return "", fmt.Errorf("--webhook-proxy requires a TCP listen address, got %s", cfg.Listen)
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	return fmt.Sprintf("http://%s/webhook", net.JoinHostPort(host, port)), nil
 }
@@ -4,9 +4,16 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"syscall"
+	"time"
 
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/clock"
 	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/diff"
 	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/local"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/repoconfig"
 	"github.com/spf13/cobra"
 )
 
@@ -19,14 +26,56 @@ var (
 	// CLI flags
 	coveragePath string
 	format       string
+	outputPath   string
 	baseRef      string
 	commitSHA    string
+	fetchBase    bool
+	since        string
+	sinceRef     string
+	staged       bool
+	mergeBase    string
+	watch        bool
+
+	inputFormat      string
+	explainMatching  bool
+	includeGenerated bool
+	ignorePatterns   []string
+	includePatterns  []string
+
+	annotationLevels string
+
+	linkRepoURL string
+	linkRef     string
+
+	suppressionMaxAge int
+
+	deterministic bool
+
+	cacheDir string
+
+	failUnderPatch    float64
+	maxUncoveredLines int
+
+	stepSummary string
+
+	timeout time.Duration
+
+	releaseSince  string
+	releaseFormat string
+
+	teamFormat string
+
+	convertTo string
+
+	testPackages []string
+	changedOnly  bool
+	affected     bool
 )
 
 func main() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		os.Exit(local.ExitCode(err))
 	}
 }
 
@@ -46,7 +95,26 @@ Diff modes:
   - Default: Compares against current working directory changes (git diff)
   - --base <ref>: Compares base ref to HEAD (git diff <base>..HEAD)
   - --base <ref> --commit <ref>: Compares two refs (git diff <base>..<commit>)
-  - --commit <sha>: Shows changes for a specific commit (git diff-tree <sha>)`,
+  - --commit <sha>: Shows changes for a specific commit (git diff-tree <sha>)
+  - --staged: Compares only the changes staged for commit (git diff --cached)
+  - --merge-base <ref>: Compares HEAD (or --commit) to where it branched off the ref,
+    like a PR would (git diff $(git merge-base <ref> HEAD)..HEAD)
+  - --since <date>: Treats lines added on HEAD since the date as new code (e.g. "30 days ago")
+  - --since-ref <ref>: Treats lines added since the ref (e.g. a release tag) as new code
+
+In shallow clones, add --fetch-base to fetch missing refs from origin.
+
+With --watch, canopy keeps running and re-runs the analysis whenever coverage
+files or Go sources change, e.g. while rerunning go test -coverprofile; failed
+analyses are reported without ending the watch, and Ctrl-C exits with 0.
+
+Exit codes:
+  0  Analysis completed
+  1  Coverage threshold not met (--fail-under-patch, --max-uncovered-lines)
+  2  Usage error (invalid flags or arguments)
+  3  Environment error (git failure, missing or unreadable coverage files)
+  4  Coverage parse error (malformed or unmergeable coverage files)
+  5  Canceled (interrupted, terminated, or --timeout exceeded)`,
 	RunE: run,
 }
 
@@ -60,37 +128,528 @@ var versionCmd = &cobra.Command{
 	},
 }
 
+var diffResultsCmd = &cobra.Command{
+	Use:   "diff-results <old.json> <new.json>",
+	Short: "Compare two saved JSON analysis results",
+	Long: `Compare two analysis results saved with --format JSON and print what changed:
+files and lines that became uncovered, and lines that were resolved.
+
+Lines are compared by number, so edits that move code show up as resolved
+lines in the old positions and uncovered lines in the new ones.
+
+Examples:
+  canopy --format JSON > before.json
+  # add tests, re-run them with coverage
+  canopy --format JSON > after.json
+  canopy diff-results before.json after.json`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		return local.DiffResults(args[0], args[1], os.Stdout)
+	},
+}
+
+var releaseReportCmd = &cobra.Command{
+	Use:   "release-report --since <tag>",
+	Short: "Report code added since a release that remains uncovered",
+	Long: `Report all code added on HEAD since a release tag that the coverage files
+leave uncovered, grouped by owner (from CODEOWNERS, .github/CODEOWNERS, or
+docs/CODEOWNERS) and by package, for release-readiness reviews and QA sign-off.
+
+Examples:
+  go test ./... -coverprofile=.coverage/coverage.out
+  canopy release-report --since v1.4.0 > release.md
+  canopy release-report --since v1.4.0 --format HTML > release.html`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		ctx, cancel := analysisContext()
+		defer cancel()
+		runner := local.NewRunner(local.Config{
+			CoveragePath:          coveragePath,
+			Format:                releaseFormat,
+			Output:                outputPath,
+			InputFormat:           inputFormat,
+			IncludeGenerated:      includeGenerated,
+			Ignore:                ignorePatterns,
+			Include:               includePatterns,
+			LinkRepoURL:           linkRepoURL,
+			LinkRef:               linkRef,
+			SuppressionMaxAgeDays: suppressionMaxAge,
+			CacheDir:              cacheDir,
+			Version:               version,
+		}, local.WithDiffSource(windowDiffSource("", releaseSince)))
+		return runner.ReleaseReport(ctx, releaseSince)
+	},
+}
+
+var teamReportCmd = &cobra.Command{
+	Use:   "team-report --since <date> | --since-ref <ref>",
+	Short: "Report test coverage of added code by commit author",
+	Long: `Report the executable lines added on HEAD since a date or ref, aggregated by
+the author of the commit that last changed them (per git blame), for engineering
+managers following testing habits across a team over a quarter. The report holds
+counts per author only, never files or lines, and is meant for aggregate trends,
+not for reviewing individual changes.
+
+Examples:
+  go test ./... -coverprofile=.coverage/coverage.out
+  canopy team-report --since 2026-07-01 > team.md
+  canopy team-report --since-ref v1.4.0 --format JSON > team.json`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if (since == "") == (sinceRef == "") {
+			return fmt.Errorf("exactly one of --since or --since-ref is required")
+		}
+		cmd.SilenceUsage = true
+		ctx, cancel := analysisContext()
+		defer cancel()
+		runner := local.NewRunner(local.Config{
+			CoveragePath:          coveragePath,
+			Format:                teamFormat,
+			Output:                outputPath,
+			InputFormat:           inputFormat,
+			IncludeGenerated:      includeGenerated,
+			Ignore:                ignorePatterns,
+			Include:               includePatterns,
+			SuppressionMaxAgeDays: suppressionMaxAge,
+			CacheDir:              cacheDir,
+			Version:               version,
+		}, local.WithDiffSource(windowDiffSource(since, sinceRef)))
+		label := since
+		if label == "" {
+			label = sinceRef
+		}
+		return runner.TeamReport(ctx, label)
+	},
+}
+
+var convertCmd = &cobra.Command{
+	Use:   "convert --to <format>",
+	Short: "Convert coverage files to lcov or Cobertura",
+	Long: `Merge the coverage files and write them as an lcov tracefile, a Cobertura XML
+report, or a Go text profile, for tools that don't read Go profiles
+(Coveralls, Codecov, GitLab coverage visualization). lcov and Cobertura paths
+are relative to the repository root.
+
+Examples:
+  canopy convert --to lcov -o lcov.info
+  canopy convert --to cobertura --deterministic -o coverage.xml`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		var clk clock.Clock
+		if deterministic {
+			var err error
+			if clk, err = clock.Deterministic(); err != nil {
+				return err
+			}
+		}
+		ctx, cancel := analysisContext()
+		defer cancel()
+		runner := local.NewRunner(local.Config{
+			CoveragePath: coveragePath,
+			Output:       outputPath,
+			InputFormat:  inputFormat,
+			Clock:        clk,
+		})
+		return runner.Convert(ctx, convertTo)
+	},
+}
+
+var runCmd = &cobra.Command{
+	Use:   "run [--packages ./...] [-- go test flags]",
+	Short: "Run go test with coverage and analyze it",
+	Long: `Run go test -coverprofile into a temporary coverage directory, then analyze
+the coverage against the diff like canopy does, so there is no go test
+invocation or coverage directory to remember. Arguments after -- are passed
+to go test, and its output goes to stderr.
+
+With --changed-only, only the packages with Go files changed in the diff are
+tested; with --affected, also the packages whose tests depend on them (see
+canopy affected). Failing tests exit with code 3 before the analysis.
+
+Examples:
+  canopy run
+  canopy run --merge-base origin/main --changed-only
+  canopy run --merge-base origin/main --affected
+  canopy run --packages ./internal/... -- -race -count=1`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if changedOnly && affected {
+			return fmt.Errorf("--changed-only cannot be combined with --affected")
+		}
+		if (changedOnly || affected) && cmd.Flags().Changed("packages") {
+			return fmt.Errorf("--changed-only and --affected cannot be combined with --packages")
+		}
+		if err := applyRepoConfig(cmd); err != nil {
+			return err
+		}
+		runner, err := newRunner()
+		if err != nil {
+			return err
+		}
+		cmd.SilenceUsage = true
+		ctx, cancel := analysisContext()
+		defer cancel()
+		return runner.RunTests(ctx, local.TestRun{Packages: testPackages, ChangedOnly: changedOnly, Affected: affected, Args: args})
+	},
+}
+
+var affectedCmd = &cobra.Command{
+	Use:   "affected",
+	Short: "List the packages whose tests could cover the changed lines",
+	Long: `Map the Go files changed in the diff to their packages, and print those
+packages and the packages whose tests depend on them, directly or through
+other packages (from go list -test), one import path per line. A changed
+go.mod or go.sum affects every package. On large monorepos, testing only
+these packages keeps coverage of a change incremental.
+
+Examples:
+  go test -coverprofile=.coverage/coverage.out $(canopy affected --merge-base origin/main)
+  canopy run --merge-base origin/main --affected`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := applyRepoConfig(cmd); err != nil {
+			return err
+		}
+		runner, err := newRunner()
+		if err != nil {
+			return err
+		}
+		cmd.SilenceUsage = true
+		ctx, cancel := analysisContext()
+		defer cancel()
+		packages, err := runner.Affected(ctx)
+		if err != nil {
+			return err
+		}
+		for _, pkg := range packages {
+			fmt.Println(pkg)
+		}
+		return nil
+	},
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Work with the repository config (.canopy.yml)",
+}
+
+var configLintCmd = &cobra.Command{
+	Use:   "lint [file]",
+	Short: "Validate the repository config",
+	Long: `Validate the repository config and report each issue with its line and column.
+
+Without a file argument, .canopy.yml or .github/canopy.yml is used.
+Exits with code 2 if the config has issues and 3 if it cannot be read.
+The Canopy service falls back to defaults for invalid configs and reports
+the same issues as a check run warning.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := ""
+		if len(args) == 1 {
+			path = args[0]
+		}
+		// Issues are already printed; main reports the error once
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		return local.LintRepoConfig("", path, os.Stdout)
+	},
+}
+
+var configSchemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON schema for the repository config",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		os.Stdout.Write(repoconfig.Schema)
+	},
+}
+
 func init() {
 	// Add subcommands
 	rootCmd.AddCommand(versionCmd)
+	rootCmd.AddCommand(diffResultsCmd)
+	rootCmd.AddCommand(releaseReportCmd)
+	rootCmd.AddCommand(teamReportCmd)
+	rootCmd.AddCommand(convertCmd)
+	rootCmd.AddCommand(runCmd)
+	rootCmd.AddCommand(affectedCmd)
+	configCmd.AddCommand(configLintCmd, configSchemaCmd)
+	rootCmd.AddCommand(configCmd)
 
 	// Define flags
 	rootCmd.Flags().StringVar(&coveragePath, "coverage", ".coverage", "Directory containing coverage files")
-	rootCmd.Flags().StringVar(&format, "format", "Text", "Output format (Text, Markdown, GitHubAnnotations)")
+	rootCmd.Flags().StringVar(&format, "format", "Text", "Output format (Text, Markdown, JSON, HTML, GitHubAnnotations, Sonar, TeamCity, Jenkins)")
+	rootCmd.Flags().StringVarP(&outputPath, "output", "o", "", "Write the report to this file instead of stdout (e.g. report.html with --format HTML)")
 	rootCmd.Flags().StringVar(&baseRef, "base", "", "Base reference to compare from (can be combined with --commit)")
 	rootCmd.Flags().StringVar(&commitSHA, "commit", "", "Commit reference to compare to (defaults to HEAD when used with --base)")
+	rootCmd.Flags().BoolVar(&fetchBase, "fetch-base", false, "Fetch --base, --commit, and --since-ref from origin when they are missing from a shallow clone (e.g. actions/checkout with the default fetch-depth)")
+	rootCmd.Flags().StringVar(&since, "since", "", "Analyze lines added on HEAD since a date, for trunk-based workflows (e.g. \"30 days ago\", 2024-01-31)")
+	rootCmd.Flags().StringVar(&sinceRef, "since-ref", "", "Analyze lines added on HEAD since a ref, for trunk-based workflows (e.g. a release tag)")
+	rootCmd.Flags().BoolVar(&staged, "staged", false, "Analyze only the changes staged for commit (git diff --cached)")
+	rootCmd.Flags().BoolVar(&watch, "watch", false, "Keep running, and re-run the analysis whenever coverage files or Go sources change")
+	rootCmd.Flags().StringVar(&mergeBase, "merge-base", "", "Compare from the merge base of a ref and HEAD (or --commit), like a PR preview (e.g. origin/main)")
+	rootCmd.Flags().StringVar(&inputFormat, "input-format", "auto", "Coverage file format (auto, go, lcov, cobertura, jacoco, gocoverdir); auto detects it from file contents")
+	rootCmd.Flags().BoolVar(&explainMatching, "explain-matching", false, "Print diagnostics for diff files and coverage profiles that could not be matched")
+	rootCmd.Flags().BoolVar(&includeGenerated, "include-generated", false, "Analyze generated files (linguist-generated in .gitattributes, *.pb.go, \"Code generated\" headers) instead of skipping them")
+	rootCmd.Flags().StringArrayVar(&ignorePatterns, "ignore", nil, "Glob pattern of files to leave out of the analysis, matched like .gitattributes patterns (e.g. \"**/*_gen.go\"); repeatable")
+	rootCmd.Flags().StringArrayVar(&includePatterns, "include", nil, "Glob pattern of files to analyze, leaving out all others; repeatable")
+	rootCmd.Flags().StringVar(&annotationLevels, "annotation-levels", "", "Annotation levels by severity for annotation formats (GitHubAnnotations, Sonar, TeamCity, Jenkins), e.g. exported=warning,error-handling=notice,low-coverage=30")
+	rootCmd.Flags().StringVar(&linkRepoURL, "link-repo", "", "Repository web URL (GitHub or GitLab) to link files and lines to in Markdown output, e.g. https://github.com/org/repo")
+	rootCmd.Flags().StringVar(&linkRef, "link-ref", "", "Revision file links point at (defaults to the HEAD commit)")
+	rootCmd.Flags().BoolVar(&deterministic, "deterministic", false, "Fix the clock at $SOURCE_DATE_EPOCH (or the Unix epoch) so identical inputs produce byte-identical reports")
+	rootCmd.Flags().DurationVar(&timeout, "timeout", 0, "Abort the analysis after this long, e.g. 30s, with exit code 5 (0 = no timeout)")
+	rootCmd.Flags().StringVar(&cacheDir, "cache-dir", defaultCacheDir(), "Directory analyses are cached in, so re-runs over the same diff and coverage files (e.g. with another --format) reuse them (empty = no cache)")
+	rootCmd.Flags().IntVar(&suppressionMaxAge, "suppression-max-age", 0, "Days after which canopy:ignore suppressions expire and their lines are reported as uncovered again; undated suppressions expire immediately (0 = never expire)")
+	rootCmd.Flags().StringVar(&stepSummary, "step-summary", os.Getenv("GITHUB_STEP_SUMMARY"), "File a Markdown report is appended to with --format GitHubAnnotations (defaults to $GITHUB_STEP_SUMMARY in GitHub Actions; empty = none)")
+	rootCmd.Flags().Float64Var(&failUnderPatch, "fail-under-patch", 0, "Exit with code 1 when patch coverage of the added lines is below this percentage, e.g. 80 (0 = no threshold)")
+	rootCmd.Flags().IntVar(&maxUncoveredLines, "max-uncovered-lines", -1, "Exit with code 1 when more added lines than this are uncovered (-1 = no limit)")
+
+	releaseFlags := releaseReportCmd.Flags()
+	releaseFlags.StringVar(&releaseSince, "since", "", "Release tag (or any ref) to report added code since, e.g. v1.4.0")
+	releaseFlags.StringVar(&releaseFormat, "format", "Markdown", "Output format (Markdown, HTML)")
+	releaseFlags.StringVarP(&outputPath, "output", "o", "", "Write the report to this file instead of stdout")
+	releaseFlags.StringVar(&coveragePath, "coverage", ".coverage", "Directory containing coverage files")
+	releaseFlags.StringVar(&inputFormat, "input-format", "auto", "Coverage file format (auto, go, lcov, cobertura, jacoco, gocoverdir); auto detects it from file contents")
+	releaseFlags.BoolVar(&includeGenerated, "include-generated", false, "Report generated files instead of skipping them")
+	releaseFlags.StringArrayVar(&ignorePatterns, "ignore", nil, "Glob pattern of files to leave out of the report; repeatable")
+	releaseFlags.StringArrayVar(&includePatterns, "include", nil, "Glob pattern of files to report, leaving out all others; repeatable")
+	releaseFlags.StringVar(&linkRepoURL, "link-repo", "", "Repository web URL (GitHub or GitLab) to link files and lines to, e.g. https://github.com/org/repo")
+	releaseFlags.StringVar(&linkRef, "link-ref", "", "Revision file links point at (defaults to the HEAD commit)")
+	releaseFlags.IntVar(&suppressionMaxAge, "suppression-max-age", 0, "Days after which canopy:ignore suppressions expire (0 = never expire)")
+	releaseFlags.BoolVar(&fetchBase, "fetch-base", false, "Fetch the --since ref from origin when it is missing from a shallow clone")
+	releaseFlags.DurationVar(&timeout, "timeout", 0, "Abort the report after this long, e.g. 30s, with exit code 5 (0 = no timeout)")
+	releaseFlags.StringVar(&cacheDir, "cache-dir", defaultCacheDir(), "Directory analyses are cached in (empty = no cache)")
+	releaseReportCmd.MarkFlagRequired("since")
+
+	teamFlags := teamReportCmd.Flags()
+	teamFlags.StringVar(&since, "since", "", "Date to report added code since, e.g. 2026-07-01 or \"3 months ago\"")
+	teamFlags.StringVar(&sinceRef, "since-ref", "", "Ref to report added code since, e.g. a release tag")
+	teamFlags.StringVar(&teamFormat, "format", "Markdown", "Output format (Markdown, JSON)")
+	teamFlags.StringVarP(&outputPath, "output", "o", "", "Write the report to this file instead of stdout")
+	teamFlags.StringVar(&coveragePath, "coverage", ".coverage", "Directory containing coverage files")
+	teamFlags.StringVar(&inputFormat, "input-format", "auto", "Coverage file format (auto, go, lcov, cobertura, jacoco, gocoverdir); auto detects it from file contents")
+	teamFlags.BoolVar(&includeGenerated, "include-generated", false, "Count generated files instead of skipping them")
+	teamFlags.StringArrayVar(&ignorePatterns, "ignore", nil, "Glob pattern of files to leave out of the report; repeatable")
+	teamFlags.StringArrayVar(&includePatterns, "include", nil, "Glob pattern of files to report, leaving out all others; repeatable")
+	teamFlags.IntVar(&suppressionMaxAge, "suppression-max-age", 0, "Days after which canopy:ignore suppressions expire (0 = never expire)")
+	teamFlags.BoolVar(&fetchBase, "fetch-base", false, "Fetch the --since-ref ref from origin when it is missing from a shallow clone")
+	teamFlags.DurationVar(&timeout, "timeout", 0, "Abort the report after this long, e.g. 30s, with exit code 5 (0 = no timeout)")
+	teamFlags.StringVar(&cacheDir, "cache-dir", defaultCacheDir(), "Directory analyses are cached in (empty = no cache)")
+
+	convertFlags := convertCmd.Flags()
+	convertFlags.StringVar(&convertTo, "to", "", "Format to convert to (lcov, cobertura, go)")
+	convertFlags.StringVarP(&outputPath, "output", "o", "", "Write the converted coverage to this file instead of stdout")
+	convertFlags.StringVar(&coveragePath, "coverage", ".coverage", "Directory containing coverage files")
+	convertFlags.StringVar(&inputFormat, "input-format", "auto", "Coverage file format (auto, go, lcov, cobertura, jacoco, gocoverdir); auto detects it from file contents")
+	convertFlags.BoolVar(&deterministic, "deterministic", false, "Fix the Cobertura timestamp at $SOURCE_DATE_EPOCH (or the Unix epoch) so identical inputs produce byte-identical reports")
+	convertFlags.DurationVar(&timeout, "timeout", 0, "Abort the conversion after this long, e.g. 30s, with exit code 5 (0 = no timeout)")
+	convertCmd.MarkFlagRequired("to")
+
+	runFlags := runCmd.Flags()
+	runFlags.StringSliceVar(&testPackages, "packages", []string{"./..."}, "Packages to test, as go test package patterns; repeatable or comma-separated")
+	runFlags.BoolVar(&changedOnly, "changed-only", false, "Test only the packages with Go files changed in the diff")
+	runFlags.BoolVar(&affected, "affected", false, "Test only the packages with Go files changed in the diff and the packages whose tests depend on them")
+	runFlags.StringVar(&format, "format", "Text", "Output format (Text, Markdown, JSON, HTML, GitHubAnnotations, Sonar, TeamCity, Jenkins)")
+	runFlags.StringVarP(&outputPath, "output", "o", "", "Write the report to this file instead of stdout")
+	runFlags.StringVar(&baseRef, "base", "", "Base reference to compare from (can be combined with --commit)")
+	runFlags.StringVar(&commitSHA, "commit", "", "Commit reference to compare to (defaults to HEAD when used with --base)")
+	runFlags.StringVar(&mergeBase, "merge-base", "", "Compare from the merge base of a ref and HEAD (or --commit), like a PR preview (e.g. origin/main)")
+	runFlags.BoolVar(&staged, "staged", false, "Analyze only the changes staged for commit (git diff --cached)")
+	runFlags.BoolVar(&fetchBase, "fetch-base", false, "Fetch --base, --merge-base, and --commit from origin when they are missing from a shallow clone")
+	runFlags.BoolVar(&includeGenerated, "include-generated", false, "Analyze generated files instead of skipping them")
+	runFlags.StringArrayVar(&ignorePatterns, "ignore", nil, "Glob pattern of files to leave out of the analysis; repeatable")
+	runFlags.StringArrayVar(&includePatterns, "include", nil, "Glob pattern of files to analyze, leaving out all others; repeatable")
+	runFlags.StringVar(&annotationLevels, "annotation-levels", "", "Annotation levels by severity for annotation formats (GitHubAnnotations, Sonar, TeamCity, Jenkins)")
+	runFlags.IntVar(&suppressionMaxAge, "suppression-max-age", 0, "Days after which canopy:ignore suppressions expire (0 = never expire)")
+	runFlags.DurationVar(&timeout, "timeout", 0, "Abort the tests and analysis after this long, e.g. 10m, with exit code 5 (0 = no timeout)")
+	runFlags.StringVar(&cacheDir, "cache-dir", defaultCacheDir(), "Directory analyses are cached in (empty = no cache)")
+	runFlags.StringVar(&stepSummary, "step-summary", os.Getenv("GITHUB_STEP_SUMMARY"), "File a Markdown report is appended to with --format GitHubAnnotations (defaults to $GITHUB_STEP_SUMMARY in GitHub Actions; empty = none)")
+	runFlags.Float64Var(&failUnderPatch, "fail-under-patch", 0, "Exit with code 1 when patch coverage of the added lines is below this percentage, e.g. 80 (0 = no threshold)")
+	runFlags.IntVar(&maxUncoveredLines, "max-uncovered-lines", -1, "Exit with code 1 when more added lines than this are uncovered (-1 = no limit)")
+
+	affectedFlags := affectedCmd.Flags()
+	affectedFlags.StringVar(&baseRef, "base", "", "Base reference to compare from (can be combined with --commit)")
+	affectedFlags.StringVar(&commitSHA, "commit", "", "Commit reference to compare to (defaults to HEAD when used with --base)")
+	affectedFlags.StringVar(&mergeBase, "merge-base", "", "Compare from the merge base of a ref and HEAD (or --commit), like a PR preview (e.g. origin/main)")
+	affectedFlags.StringVar(&since, "since", "", "Take the lines added on HEAD since a date as changed (e.g. \"30 days ago\")")
+	affectedFlags.StringVar(&sinceRef, "since-ref", "", "Take the lines added on HEAD since a ref as changed (e.g. a release tag)")
+	affectedFlags.BoolVar(&staged, "staged", false, "Take only the changes staged for commit as changed")
+	affectedFlags.BoolVar(&fetchBase, "fetch-base", false, "Fetch --base, --merge-base, --commit, and --since-ref from origin when they are missing from a shallow clone")
+	affectedFlags.DurationVar(&timeout, "timeout", 0, "Abort after this long, e.g. 30s, with exit code 5 (0 = no timeout)")
+}
+
+// analysisContext returns the context an analysis runs in: canceled on
+// SIGINT or SIGTERM, so git is stopped and the exit code says why, and
+// after --timeout if set.
+func analysisContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	if timeout <= 0 {
+		return ctx, stop
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
+
+// diffModeFlags select the diff; the repository config's diff mode only
+// applies when none of them is given.
+var diffModeFlags = []string{"base", "commit", "merge-base", "since", "since-ref", "staged"}
+
+// applyRepoConfig sets the flags of cmd that weren't given on the command
+// line to the defaults of the repository config (see
+// local.RepoConfigFlags).
+func applyRepoConfig(cmd *cobra.Command) error {
+	defaults, err := local.RepoConfigFlags("")
+	if err != nil {
+		return err
+	}
+	flags := cmd.Flags()
+	diffModeGiven := slices.ContainsFunc(diffModeFlags, flags.Changed)
+	for name, values := range defaults {
+		flag := flags.Lookup(name)
+		if flag == nil || flag.Changed || (diffModeGiven && slices.Contains(diffModeFlags, name)) {
+			continue
+		}
+		for _, value := range values {
+			if err := flag.Value.Set(value); err != nil {
+				return fmt.Errorf("invalid --%s default in repository config: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// defaultCacheDir returns the directory analyses are cached in by default:
+// canopy in the user's cache directory, outside the repository, or none if
+// the system has no cache directory.
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "canopy")
+}
+
+// windowDiffSource returns the diff source of a --since or --since-ref window.
+func windowDiffSource(since, sinceRef string) diff.DiffSource {
+	source := diff.NewGitWindowDiffSource(since, sinceRef, "")
+	source.FetchMissing = fetchBase
+	return source
 }
 
 func run(cmd *cobra.Command, args []string) error {
+	if err := applyRepoConfig(cmd); err != nil {
+		return err
+	}
+	runner, err := newRunner()
+	if err != nil {
+		return err
+	}
+
+	if watch {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		watcher := &local.Watcher{CoveragePath: coveragePath, Exclude: []string{cacheDir, outputPath}}
+		return watcher.Watch(ctx, func(ctx context.Context) error {
+			// --timeout applies to each analysis rather than to the watch
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+			return runner.Run(ctx)
+		})
+	}
+
+	ctx, cancel := analysisContext()
+	defer cancel()
+
+	return runner.Run(ctx)
+}
+
+// newRunner returns the Runner of the analysis flags, with the diff source
+// their diff mode selects.
+func newRunner() (*local.Runner, error) {
 	// Create appropriate DiffSource based on flags
 	var diffSource diff.DiffSource
 
-	if baseRef != "" {
+	windowed := since != "" || sinceRef != ""
+	if windowed && (baseRef != "" || commitSHA != "" || mergeBase != "" || staged) {
+		return nil, fmt.Errorf("--since and --since-ref cannot be combined with --base, --commit, --merge-base, or --staged")
+	}
+	if staged && (baseRef != "" || commitSHA != "" || mergeBase != "") {
+		return nil, fmt.Errorf("--staged cannot be combined with --base, --commit, or --merge-base")
+	}
+	if mergeBase != "" && baseRef != "" {
+		return nil, fmt.Errorf("--merge-base cannot be combined with --base")
+	}
+
+	if windowed {
+		// --since/--since-ref: new code is everything added within the window
+		diffSource = windowDiffSource(since, sinceRef)
+	} else if baseRef != "" {
 		// --base flag: compare base to commit (defaults to HEAD if commit not specified)
 		// Supports both: --base <ref> and --base <ref> --commit <ref>
-		diffSource = diff.NewGitBaseDiffSource(baseRef, commitSHA, "")
+		baseSource := diff.NewGitBaseDiffSource(baseRef, commitSHA, "")
+		baseSource.FetchMissing = fetchBase
+		diffSource = baseSource
+	} else if mergeBase != "" {
+		// --merge-base flag: compare the merge base of the ref and commit to
+		// commit, so commits the ref gained since don't show up as removed
+		baseSource := diff.NewGitBaseDiffSource(mergeBase, commitSHA, "")
+		baseSource.FetchMissing = fetchBase
+		baseSource.MergeBase = true
+		diffSource = baseSource
 	} else if commitSHA != "" {
 		// --commit flag only: single commit analysis
-		diffSource = diff.NewGitCommitDiffSource(commitSHA, "")
+		commitSource := diff.NewGitCommitDiffSource(commitSHA, "")
+		commitSource.FetchMissing = fetchBase
+		diffSource = commitSource
+	} else if staged {
+		// --staged flag: only the changes staged for commit
+		diffSource = &diff.LocalDiffSource{Staged: true, Exclude: []string{cacheDir}}
 	} else {
-		// Default: use local git diff (working directory changes)
-		diffSource = diff.NewLocalDiffSource("")
+		// Default: use local git diff (working directory changes), without
+		// a cache directory inside the repository
+		diffSource = &diff.LocalDiffSource{Exclude: []string{cacheDir}}
 	}
 
-	runner := local.NewRunner(local.Config{
-		CoveragePath: coveragePath,
-		Format:       format,
-	}, local.WithDiffSource(diffSource))
+	var clk clock.Clock
+	if deterministic {
+		var err error
+		if clk, err = clock.Deterministic(); err != nil {
+			return nil, err
+		}
+	}
+
+	// --max-uncovered-lines is -1 unless set
+	var maxUncovered *int
+	if maxUncoveredLines >= 0 {
+		maxUncovered = &maxUncoveredLines
+	}
 
-	return runner.Run(context.Background())
+	return local.NewRunner(local.Config{
+		CoveragePath:          coveragePath,
+		Format:                format,
+		Output:                outputPath,
+		InputFormat:           inputFormat,
+		ExplainMatching:       explainMatching,
+		AnnotationLevels:      annotationLevels,
+		IncludeGenerated:      includeGenerated,
+		Ignore:                ignorePatterns,
+		Include:               includePatterns,
+		LinkRepoURL:           linkRepoURL,
+		LinkRef:               linkRef,
+		SuppressionMaxAgeDays: suppressionMaxAge,
+		CacheDir:              cacheDir,
+		Version:               version,
+		Clock:                 clk,
+		StepSummary:           stepSummary,
+		FailUnderPatch:        failUnderPatch,
+		MaxUncoveredLines:     maxUncovered,
+	}, local.WithDiffSource(diffSource)), nil
 }
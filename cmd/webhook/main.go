@@ -1,13 +1,28 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/config"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/logging"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/metrics"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/queue"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/server"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/services"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/tracing"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/webhook"
 	"github.com/spf13/cobra"
 )
 
+// shutdownTimeout bounds how long the HTTP server waits for in-flight requests.
+const shutdownTimeout = 30 * time.Second
+
 var (
 	// Version information (set via ldflags during build)
 	version = "dev"
@@ -16,6 +31,7 @@ var (
 
 	// CLI flags
 	port        int
+	listen      string
 	disableHMAC bool
 )
 
@@ -53,6 +69,7 @@ func init() {
 
 	// Define flags
 	rootCmd.Flags().IntVar(&port, "port", 8080, "HTTP server port")
+	rootCmd.Flags().StringVar(&listen, "listen", "", "Listen address overriding --port, e.g. unix:///run/canopy.sock or tcp://127.0.0.1:8080")
 	rootCmd.Flags().BoolVar(&disableHMAC, "disable-hmac", false, "Disable HMAC signature validation (for local development only)")
 }
 
@@ -61,6 +78,9 @@ func run(cmd *cobra.Command, args []string) error {
 	if cmd.Flags().Changed("port") {
 		os.Setenv("CANOPY_PORT", fmt.Sprintf("%d", port))
 	}
+	if cmd.Flags().Changed("listen") {
+		os.Setenv("CANOPY_LISTEN", listen)
+	}
 	if cmd.Flags().Changed("disable-hmac") {
 		os.Setenv("CANOPY_DISABLE_HMAC", fmt.Sprintf("%t", disableHMAC))
 	}
@@ -71,18 +91,104 @@ func run(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to load configuration: %w", err)
 	}
 
-	// Print startup information
-	fmt.Printf("Starting Canopy Webhook on port %d\n", cfg.Port)
-	if cfg.DisableHMAC {
-		fmt.Println("WARNING: HMAC validation is disabled. This should only be used for local development.")
+	logger := logging.New(os.Stdout, cfg.LogLevel)
+	slog.SetDefault(logger)
+
+	// Log startup information
+	startup := []any{"version", version, "queue_type", cfg.Queue.Type, "allowed_orgs", cfg.Webhook.AllowedOrgs}
+	if cfg.Listen != "" {
+		startup = append(startup, "listen", cfg.Listen)
+	} else {
+		startup = append(startup, "port", cfg.Port)
 	}
-	fmt.Printf("Queue type: %s\n", cfg.Queue.Type)
-	fmt.Printf("Allowed orgs: %v\n", cfg.Webhook.AllowedOrgs)
 	if len(cfg.Webhook.AllowedWorkflows) > 0 {
-		fmt.Printf("Allowed workflows: %v\n", cfg.Webhook.AllowedWorkflows)
+		startup = append(startup, "allowed_workflows", cfg.Webhook.AllowedWorkflows)
+	}
+	if len(cfg.Webhook.AllowedRepos) > 0 {
+		startup = append(startup, "allowed_repos", cfg.Webhook.AllowedRepos)
+	}
+	if len(cfg.Webhook.AllowedBranches) > 0 {
+		startup = append(startup, "allowed_branches", cfg.Webhook.AllowedBranches)
+	}
+	if cfg.Webhook.PullRequestEvents {
+		startup = append(startup, "pull_request_events", true)
+	}
+	logger.Info("starting canopy webhook", startup...)
+	if cfg.DisableHMAC {
+		logger.Warn("HMAC validation is disabled; this should only be used for local development")
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(ctx, "canopy-webhook")
+	if err != nil {
+		return fmt.Errorf("failed to set up tracing: %w", err)
+	}
+
+	mq, err := services.OpenQueue(ctx, &cfg.Queue, "webhook", logger)
+	if err != nil {
+		return fmt.Errorf("failed to open queue: %w", err)
+	}
+	defer mq.Close()
+
+	srv := server.New(server.Config{Port: cfg.Port, Listen: cfg.Listen, Logger: logger})
+	handler := webhook.NewHandler(webhook.HandlerConfig{
+		Queue:       mq,
+		Secret:      cfg.Webhook.WebhookSecret,
+		DisableHMAC: cfg.DisableHMAC,
+		Filter: webhook.Filter{
+			AllowedOrgs:      cfg.Webhook.AllowedOrgs,
+			AllowedWorkflows: cfg.Webhook.AllowedWorkflows,
+			AllowedRepos:     cfg.Webhook.AllowedRepos,
+			AllowedBranches:  cfg.Webhook.AllowedBranches,
+		},
+		PullRequestEvents: cfg.Webhook.PullRequestEvents,
+		GitLabSecret:      cfg.GitLab.WebhookSecret,
+		Logger:            logger,
+	})
+	handler.Register(srv.Mux())
+	metrics.Default.Add(handler)
+	if reporter, ok := mq.(queue.BacklogReporter); ok && cfg.Queue.Type == config.QueueTypeRedis {
+		// Autoscalers scale workers on the backlog
+		queue.NewBacklogHandler(reporter, cfg.Queue.Scaling, logger).Register(srv.Mux())
 	}
 
-	// TODO: Start the webhook service
-	fmt.Println("Webhook service not yet implemented")
-	return nil
+	// Metrics are served on the main server unless they have their own port
+	metricsSrv := srv
+	if cfg.Metrics.Port != 0 {
+		metricsSrv = server.New(server.Config{Port: cfg.Metrics.Port, Logger: logger})
+	}
+	metricsSrv.Mux().Handle(metrics.Route, metrics.Default)
+
+	errs := make(chan error, 2)
+	go func() {
+		errs <- srv.Start()
+	}()
+	if metricsSrv != srv {
+		go func() {
+			errs <- metricsSrv.Start()
+		}()
+	}
+
+	// Run until interrupted or a server fails
+	select {
+	case <-ctx.Done():
+	case err = <-errs:
+	}
+	stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if shutdownErr := srv.Shutdown(shutdownCtx); shutdownErr != nil && err == nil {
+		err = shutdownErr
+	}
+	if metricsSrv != srv {
+		if shutdownErr := metricsSrv.Shutdown(shutdownCtx); shutdownErr != nil && err == nil {
+			err = shutdownErr
+		}
+	}
+	if shutdownErr := shutdownTracing(shutdownCtx); shutdownErr != nil && err == nil {
+		err = shutdownErr
+	}
+	return err
 }
@@ -1,13 +1,30 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/buildinfo"
 	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/config"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/logging"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/metrics"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/server"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/services"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/tracing"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/worker"
 	"github.com/spf13/cobra"
 )
 
+// shutdownTimeout bounds how long the HTTP servers wait for in-flight
+// requests and traces are flushed.
+const shutdownTimeout = 30 * time.Second
+
 var (
 	// Version information (set via ldflags during build)
 	version = "dev"
@@ -45,12 +62,56 @@ var versionCmd = &cobra.Command{
 	},
 }
 
+var (
+	simulateFixture string
+	simulateOut     string
+)
+
+var simulateCmd = &cobra.Command{
+	Use:   "simulate",
+	Short: "Replay a recorded work request from disk",
+	Long: `Replay a recorded work request through coverage analysis and publishing,
+without GitHub, storage, or a queue. Results are written to files instead.
+
+The fixture directory contains:
+  request.json   the WorkRequest, as published to the queue
+  run.json       the workflow run: head_sha, head_branch, default_branch, pull_request
+  artifacts/     downloaded artifacts, as zip archives or coverage files
+  base.out       stored coverage of the default branch (optional)
+  pr.diff        the PR diff (PR runs only)
+  coverage.diff  the diff from the run's coverage commit to the PR head (optional)
+  .canopy.yml    the repository config (optional)
+  .gitattributes the root .gitattributes of the head commit (optional)
+  go.mod         the root go.mod of the head commit (optional)
+
+The output directory receives:
+  check_run.json                         the check run (PR runs)
+  comment.json                           the PR comment (PR runs)
+  coverage/{org}/{repo}/{branch}/coverage.out  the saved coverage (default branch runs)
+
+Examples:
+  canopy-worker simulate --fixture testdata/fixtures/pr --out /tmp/out`,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := worker.Simulate(cmd.Context(), simulateFixture, simulateOut); err != nil {
+			return err
+		}
+		fmt.Printf("Simulation results written to %s\n", simulateOut)
+		return nil
+	},
+}
+
 func init() {
 	// Add subcommands
 	rootCmd.AddCommand(versionCmd)
+	rootCmd.AddCommand(simulateCmd)
 
-	// Worker doesn't need any CLI flags
+	// The worker service doesn't need any CLI flags
 	// All configuration is loaded from environment variables
+	simulateCmd.Flags().StringVar(&simulateFixture, "fixture", "", "Directory containing the recorded work request")
+	simulateCmd.Flags().StringVar(&simulateOut, "out", "simulate-out", "Directory to write results to")
+	_ = simulateCmd.MarkFlagRequired("fixture")
 }
 
 func run(cmd *cobra.Command, args []string) error {
@@ -59,15 +120,146 @@ func run(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return fmt.Errorf("failed to load configuration: %w", err)
 	}
+	if err := buildinfo.CheckMinimum(version, cfg.Worker.MinVersion); err != nil {
+		return fmt.Errorf("refusing to start: %w (CANOPY_MIN_WORKER_VERSION)", err)
+	}
 
-	// Print startup information
-	fmt.Println("Starting Canopy Worker")
-	fmt.Printf("Queue type: %s\n", cfg.Queue.Type)
-	fmt.Printf("Storage type: %s\n", cfg.Storage.Type)
-	fmt.Printf("GitHub App ID: %d\n", cfg.GitHub.AppID)
-	fmt.Printf("GitHub Installation ID: %d\n", cfg.GitHub.InstallationID)
+	logger := logging.New(os.Stdout, cfg.LogLevel)
+	slog.SetDefault(logger)
 
-	// TODO: Start the worker service
-	fmt.Println("Worker service not yet implemented")
-	return nil
+	// Log startup information
+	startup := []any{"version", version, "queue_type", cfg.Queue.Type, "storage_type", cfg.Storage.Type,
+		"github_app_id", cfg.GitHub.AppID, "metrics_port", cfg.Metrics.Port, "drain_timeout", cfg.Worker.DrainTimeout.String()}
+	if cfg.GitHub.InstallationID > 0 {
+		startup = append(startup, "github_installation_id", cfg.GitHub.InstallationID)
+	}
+	if cfg.Worker.OrgConfigTTL > 0 {
+		startup = append(startup, "org_config_ttl", cfg.Worker.OrgConfigTTL.String())
+	}
+	if services.HasAPI(cfg) {
+		if cfg.Listen != "" {
+			startup = append(startup, "listen", cfg.Listen)
+		} else {
+			startup = append(startup, "port", cfg.Port)
+		}
+		startup = append(startup, "query_api", cfg.API.Enabled, "upload", cfg.API.UploadEnabled, "badges", cfg.Badge.Enabled, "viewer", cfg.Viewer.PublicURL != "")
+	}
+	logger.Info("starting canopy worker", startup...)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(ctx, "canopy-worker")
+	if err != nil {
+		return fmt.Errorf("failed to set up tracing: %w", err)
+	}
+
+	mq, err := services.OpenQueue(ctx, &cfg.Queue, "worker", logger)
+	if err != nil {
+		return fmt.Errorf("failed to open queue: %w", err)
+	}
+	defer mq.Close()
+
+	reads, err := services.OpenCache(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	if reads != nil {
+		defer reads.Close()
+	}
+	store, err := services.OpenStorage(ctx, &cfg.Storage, reads)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	gh, err := services.NewGitHubClient(&cfg.GitHub)
+	if err != nil {
+		return err
+	}
+	gl, err := services.NewGitLabClient(&cfg.GitLab)
+	if err != nil {
+		return err
+	}
+
+	deliveries, err := services.OpenIdempotency(ctx, &cfg.Queue, cfg.Worker.IdempotencyTTL)
+	if err != nil {
+		return err
+	}
+	if deliveries != nil {
+		defer deliveries.Close()
+	}
+
+	w, err := services.NewWorker(cfg, services.WorkerDeps{GitHub: gh, GitLab: gl, Storage: store, Idempotency: deliveries}, version, logger)
+	if err != nil {
+		return err
+	}
+
+	// The query API, uploads, badges, and the diff viewer, if enabled, are
+	// served on the main port; metrics are served on their own port unless
+	// it is set to 0
+	errs := make(chan error, 3)
+	var srv *server.Server
+	if services.HasAPI(cfg) {
+		srv = server.New(server.Config{Port: cfg.Port, Listen: cfg.Listen, Logger: logger})
+		tokens, err := services.RegisterAPI(ctx, srv.Mux(), cfg, services.APIDeps{Storage: store, GitHub: gh, Queue: mq, Cache: reads}, logger)
+		if err != nil {
+			return err
+		}
+		if tokens != nil {
+			defer tokens.Close()
+		}
+		go func() {
+			errs <- srv.Start()
+		}()
+	}
+	var metricsSrv *server.Server
+	if cfg.Metrics.Port != 0 {
+		metricsSrv = server.New(server.Config{Port: cfg.Metrics.Port, Logger: logger})
+		metricsSrv.Mux().Handle(metrics.Route, metrics.Default)
+		go func() {
+			errs <- metricsSrv.Start()
+		}()
+	}
+	// The worker drains on shutdown: it stops taking work requests and
+	// finishes those in flight, for up to the drain timeout
+	workerDone := make(chan struct{})
+	go func() {
+		defer close(workerDone)
+		if err := w.Concurrency.SubscribeAndDrain(ctx, mq, cfg.Worker.DrainTimeout, w.ProcessWorkRequest); err != nil && !errors.Is(err, context.Canceled) {
+			errs <- fmt.Errorf("worker stopped: %w", err)
+			return
+		}
+		errs <- nil
+	}()
+
+	// Run until interrupted or a component fails, then stop the others
+	select {
+	case <-ctx.Done():
+	case err = <-errs:
+	}
+	stop()
+
+	// The queue and storage are closed once in-flight requests are done;
+	// metrics are served until then
+	logger.Info("draining work requests", "drain_timeout", cfg.Worker.DrainTimeout.String())
+	<-workerDone
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if srv != nil {
+		if shutdownErr := srv.Shutdown(shutdownCtx); shutdownErr != nil && err == nil {
+			err = shutdownErr
+		}
+	}
+	if metricsSrv != nil {
+		if shutdownErr := metricsSrv.Shutdown(shutdownCtx); shutdownErr != nil && err == nil {
+			err = shutdownErr
+		}
+	}
+	// Spans of the requests just finished are flushed last
+	if shutdownErr := shutdownTracing(shutdownCtx); shutdownErr != nil && err == nil {
+		err = shutdownErr
+	}
+	return err
 }
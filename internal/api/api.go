@@ -0,0 +1,254 @@
+// Package api serves the read-only query API: the stored coverage of
+// branches, the analyses of PR runs, and the repositories with stored
+// coverage, so tooling can query Canopy without reading the bucket.
+//
+// Every route requires a token with the query scope, and answers only for
+// the org or repository the token is scoped to.
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/format"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/token"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/worker"
+)
+
+// Routes served by Handler.
+const (
+	RepositoriesRoute        = "GET /api/v1/repos"
+	CoverageRoute            = "GET /api/v1/repos/{org}/{repo}/coverage"
+	PullRequestAnalysisRoute = "GET /api/v1/repos/{org}/{repo}/pulls/{number}/analysis"
+	RunAnalysisRoute         = "GET /api/v1/repos/{org}/{repo}/runs/{run_id}/analysis"
+)
+
+// FormatProfile is the value of the coverage route's format parameter that
+// returns the stored coverage profile as is.
+const FormatProfile = "profile"
+
+// Repositories looks up a repository's default branch, the branch served
+// when a request names none. *github.Client implements it.
+type Repositories interface {
+	GetRepository(ctx context.Context, owner, repo string) (*github.RepositoryInfo, error)
+}
+
+// RepositoriesResponse is the body of the repositories route.
+type RepositoriesResponse struct {
+	Repositories []storage.Repository `json:"repositories"`
+}
+
+// CoverageResponse is the body of the coverage route.
+type CoverageResponse struct {
+	Org    string `json:"org"`
+	Repo   string `json:"repo"`
+	Branch string `json:"branch"`
+	// Commit and Updated say which commit the coverage is of and when it
+	// was saved, if the worker recorded it (see storage.LatestPointer)
+	Commit  string              `json:"commit,omitempty"`
+	Updated *time.Time          `json:"updated,omitempty"`
+	Project *format.JSONProject `json:"project"`
+}
+
+// Handler serves the query API.
+type Handler struct {
+	storage storage.Storage
+	layout  storage.Layout
+	repos   Repositories
+	logger  *slog.Logger
+}
+
+// NewHandler creates a query API Handler over storage, whose objects are
+// mapped by layout (nil is the default layout). If repos is nil, coverage
+// requests must name a branch.
+func NewHandler(storage storage.Storage, layout storage.Layout, repos Repositories, logger *slog.Logger) *Handler {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Handler{
+		storage: storage,
+		layout:  layout,
+		repos:   repos,
+		logger:  logger,
+	}
+}
+
+// Register adds the API routes to mux, requiring a query-scoped token.
+func (h *Handler) Register(mux *http.ServeMux, tokens *token.Manager) {
+	requireQuery := token.RequireScope(tokens, token.ScopeQuery)
+	mux.Handle(RepositoriesRoute, requireQuery(http.HandlerFunc(h.serveRepositories)))
+	mux.Handle(CoverageRoute, requireQuery(http.HandlerFunc(h.serveCoverage)))
+	mux.Handle(PullRequestAnalysisRoute, requireQuery(http.HandlerFunc(h.servePullRequestAnalysis)))
+	mux.Handle(RunAnalysisRoute, requireQuery(http.HandlerFunc(h.serveRunAnalysis)))
+}
+
+// serveRepositories lists the repositories with stored coverage the token
+// may read, optionally of one org (the org query parameter).
+func (h *Handler) serveRepositories(w http.ResponseWriter, r *http.Request) {
+	lister, ok := h.storage.(storage.Lister)
+	if !ok {
+		http.Error(w, "the configured storage can't list repositories", http.StatusNotImplemented)
+		return
+	}
+	repos, err := storage.ListRepositories(r.Context(), lister, h.layout)
+	if err != nil {
+		h.logger.Error("failed to list repositories", "error", err)
+		http.Error(w, "failed to list repositories", http.StatusInternalServerError)
+		return
+	}
+
+	org := r.URL.Query().Get("org")
+	t, _ := token.FromContext(r.Context())
+	allowed := []storage.Repository{}
+	for _, repo := range repos {
+		if (org == "" || repo.Org == org) && (t == nil || t.Allows(repo.Org, repo.Repo)) {
+			allowed = append(allowed, repo)
+		}
+	}
+	writeJSON(w, RepositoriesResponse{Repositories: allowed})
+}
+
+// serveCoverage returns the project coverage of a branch (the branch query
+// parameter, default: the repository's default branch), or its stored
+// profile with format=profile.
+func (h *Handler) serveCoverage(w http.ResponseWriter, r *http.Request) {
+	org, repo, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+	ctx := r.Context()
+	query := r.URL.Query()
+	if f := query.Get("format"); f != "" && f != FormatProfile {
+		http.Error(w, "invalid format: expected profile", http.StatusBadRequest)
+		return
+	}
+
+	branch := query.Get("branch")
+	if branch == "" {
+		if h.repos == nil {
+			http.Error(w, "branch is required", http.StatusBadRequest)
+			return
+		}
+		info, err := h.repos.GetRepository(ctx, org, repo)
+		if err != nil {
+			if github.IsNotFound(err) {
+				http.Error(w, "repository not found", http.StatusNotFound)
+				return
+			}
+			h.logger.Error("failed to get repository", "org", org, "repo", repo, "error", err)
+			http.Error(w, "failed to get repository", http.StatusBadGateway)
+			return
+		}
+		branch = info.DefaultBranch
+	}
+
+	key := storage.CoverageKey{Org: org, Repo: repo, Branch: branch}
+	data, err := h.storage.GetCoverage(ctx, key)
+	if err != nil {
+		h.logger.Error("failed to load coverage", "org", org, "repo", repo, "branch", branch, "error", err)
+		http.Error(w, "failed to load coverage", http.StatusInternalServerError)
+		return
+	}
+	if data == nil {
+		http.Error(w, "no coverage stored for branch "+branch, http.StatusNotFound)
+		return
+	}
+	if query.Get("format") == FormatProfile {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(data)
+		return
+	}
+
+	profiles, err := coverage.ParseProfiles(data)
+	if err != nil {
+		h.logger.Error("failed to parse stored coverage", "org", org, "repo", repo, "branch", branch, "error", err)
+		http.Error(w, "failed to parse stored coverage", http.StatusInternalServerError)
+		return
+	}
+	response := CoverageResponse{
+		Org:     org,
+		Repo:    repo,
+		Branch:  branch,
+		Project: format.NewJSONProject(coverage.CalculateCoverageStats(profiles)),
+	}
+	// Coverage saved before latest pointers were recorded has none
+	if pointer, err := h.storage.GetCoverage(ctx, storage.LatestKey(key)); err == nil && pointer != nil {
+		if latest, err := storage.ParseLatestPointer(pointer); err == nil {
+			response.Commit, response.Updated = latest.Commit, &latest.Updated
+		}
+	}
+	writeJSON(w, response)
+}
+
+// servePullRequestAnalysis returns the analysis of a PR's last analyzed run.
+func (h *Handler) servePullRequestAnalysis(w http.ResponseWriter, r *http.Request) {
+	org, repo, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+	number, err := strconv.Atoi(r.PathValue("number"))
+	if err != nil || number < 1 {
+		http.Error(w, "invalid pull request number", http.StatusBadRequest)
+		return
+	}
+	h.serveAnalysis(w, r, worker.PullRequestAnalysisKey(org, repo, number))
+}
+
+// serveRunAnalysis returns the analysis of a PR's workflow run.
+func (h *Handler) serveRunAnalysis(w http.ResponseWriter, r *http.Request) {
+	org, repo, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+	runID, err := strconv.ParseInt(r.PathValue("run_id"), 10, 64)
+	if err != nil || runID < 1 {
+		http.Error(w, "invalid workflow run ID", http.StatusBadRequest)
+		return
+	}
+	h.serveAnalysis(w, r, worker.AnalysisKey(org, repo, runID))
+}
+
+// serveAnalysis returns the worker.Analysis stored under key.
+func (h *Handler) serveAnalysis(w http.ResponseWriter, r *http.Request, key storage.CoverageKey) {
+	data, err := h.storage.GetCoverage(r.Context(), key)
+	if err != nil {
+		h.logger.Error("failed to load analysis", "org", key.Org, "repo", key.Repo, "key", key.Branch, "error", err)
+		http.Error(w, "failed to load analysis", http.StatusInternalServerError)
+		return
+	}
+	if data == nil {
+		http.Error(w, "no analysis stored", http.StatusNotFound)
+		return
+	}
+	if _, err := worker.ParseAnalysis(data); err != nil {
+		h.logger.Error("failed to parse stored analysis", "org", key.Org, "repo", key.Repo, "key", key.Branch, "error", err)
+		http.Error(w, "failed to parse stored analysis", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// authorize returns the org and repository of the request, or responds
+// with 403 if the token may not read them.
+func (h *Handler) authorize(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	org, repo := r.PathValue("org"), r.PathValue("repo")
+	if t, ok := token.FromContext(r.Context()); ok && !t.Allows(org, repo) {
+		http.Error(w, token.ErrForbidden.Error(), http.StatusForbidden)
+		return "", "", false
+	}
+	return org, repo, true
+}
+
+// writeJSON writes v as a JSON response.
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,319 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/token"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/worker"
+)
+
+const testCoverage = "mode: set\ngithub.com/grafana/mimir/pkg/main.go:2.17,2.30 3 1\ngithub.com/grafana/mimir/pkg/main.go:3.1,3.13 1 0\n"
+
+// memoryStorage is an in-memory storage.Storage that lists the paths of its
+// keys under the default layout.
+type memoryStorage struct {
+	data map[storage.CoverageKey][]byte
+	err  error
+}
+
+func (m *memoryStorage) SaveCoverage(ctx context.Context, key storage.CoverageKey, data []byte) error {
+	m.data[key] = data
+	return nil
+}
+
+func (m *memoryStorage) GetCoverage(ctx context.Context, key storage.CoverageKey) ([]byte, error) {
+	return m.data[key], m.err
+}
+
+func (m *memoryStorage) SaveCoverageReader(ctx context.Context, key storage.CoverageKey, reader io.Reader, size int64) error {
+	return errors.New("not implemented")
+}
+
+func (m *memoryStorage) ListObjects(ctx context.Context, prefix string) ([]storage.ObjectInfo, error) {
+	var objects []storage.ObjectInfo
+	for key := range m.data {
+		objectPath, err := storage.FormatObjectPath(key)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, storage.ObjectInfo{Path: objectPath})
+	}
+	return objects, m.err
+}
+
+func (m *memoryStorage) Close() error { return nil }
+
+// stubRepos serves a fixed default branch.
+type stubRepos struct {
+	defaultBranch string
+	err           error
+}
+
+func (s *stubRepos) GetRepository(ctx context.Context, owner, repo string) (*github.RepositoryInfo, error) {
+	return &github.RepositoryInfo{DefaultBranch: s.defaultBranch}, s.err
+}
+
+// testTokens returns a token manager and tokens with the query scope for the
+// grafana org and for grafana/mimir only, and with the upload scope.
+func testTokens(t *testing.T) (manager *token.Manager, orgToken, repoToken, uploadToken string) {
+	t.Helper()
+	ctx := context.Background()
+	manager = token.NewManager(token.NewInMemoryStore())
+	var err error
+	_, orgToken, err = manager.Issue(ctx, token.IssueRequest{Name: "dashboards", Org: "grafana", Scopes: []token.Scope{token.ScopeQuery}})
+	require.NoError(t, err)
+	_, repoToken, err = manager.Issue(ctx, token.IssueRequest{Name: "mimir tools", Org: "grafana", Repo: "mimir", Scopes: []token.Scope{token.ScopeQuery}})
+	require.NoError(t, err)
+	_, uploadToken, err = manager.Issue(ctx, token.IssueRequest{Name: "ci", Org: "grafana", Scopes: []token.Scope{token.ScopeUpload}})
+	require.NoError(t, err)
+	return manager, orgToken, repoToken, uploadToken
+}
+
+func serve(t *testing.T, h *Handler, tokens *token.Manager, plaintext, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	mux := http.NewServeMux()
+	h.Register(mux, tokens)
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	if plaintext != "" {
+		req.Header.Set("Authorization", "Bearer "+plaintext)
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandler_Repositories(t *testing.T) {
+	manager, orgToken, repoToken, uploadToken := testTokens(t)
+	store := &memoryStorage{data: map[storage.CoverageKey][]byte{
+		{Org: "grafana", Repo: "mimir", Branch: "main"}:    []byte(testCoverage),
+		{Org: "grafana", Repo: "loki", Branch: "pull/17"}:  []byte(testCoverage),
+		{Org: "acme", Repo: "widgets", Branch: "main"}:     []byte(testCoverage),
+		{Org: "grafana", Repo: "mimir", Branch: "feature"}: []byte(testCoverage),
+	}}
+
+	tests := []struct {
+		name           string
+		token          string
+		target         string
+		expectedStatus int
+		expected       []storage.Repository
+	}{
+		{
+			name:           "repositories of the token's org",
+			token:          orgToken,
+			target:         "/api/v1/repos",
+			expectedStatus: http.StatusOK,
+			expected:       []storage.Repository{{Org: "grafana", Repo: "loki"}, {Org: "grafana", Repo: "mimir"}},
+		},
+		{
+			name:           "repository of the token",
+			token:          repoToken,
+			target:         "/api/v1/repos",
+			expectedStatus: http.StatusOK,
+			expected:       []storage.Repository{{Org: "grafana", Repo: "mimir"}},
+		},
+		{
+			name:           "another org",
+			token:          orgToken,
+			target:         "/api/v1/repos?org=acme",
+			expectedStatus: http.StatusOK,
+			expected:       []storage.Repository{},
+		},
+		{
+			name:           "missing token",
+			target:         "/api/v1/repos",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "token without query scope",
+			token:          uploadToken,
+			target:         "/api/v1/repos",
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(t, NewHandler(store, nil, nil, nil), manager, tt.token, tt.target)
+
+			require.Equal(t, tt.expectedStatus, rec.Code, rec.Body.String())
+			if tt.expected == nil {
+				return
+			}
+			var got RepositoriesResponse
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+			assert.Equal(t, tt.expected, got.Repositories)
+		})
+	}
+}
+
+func TestHandler_Coverage(t *testing.T) {
+	manager, orgToken, repoToken, _ := testTokens(t)
+	updated := time.Date(2026, 1, 15, 10, 30, 0, 0, time.UTC)
+	pointer, err := storage.MarshalLatestPointer(storage.LatestPointer{Commit: "abc123", Updated: updated})
+	require.NoError(t, err)
+	mainKey := storage.CoverageKey{Org: "grafana", Repo: "mimir", Branch: "main"}
+	store := &memoryStorage{data: map[storage.CoverageKey][]byte{
+		mainKey:                    []byte(testCoverage),
+		storage.LatestKey(mainKey): pointer,
+		{Org: "grafana", Repo: "mimir", Branch: "release/1.0"}: []byte(testCoverage),
+	}}
+
+	tests := []struct {
+		name           string
+		token          string
+		target         string
+		repos          Repositories
+		storage        storage.Storage
+		expectedStatus int
+		expectedBody   string
+		check          func(t *testing.T, got CoverageResponse)
+	}{
+		{
+			name:           "default branch",
+			token:          orgToken,
+			target:         "/api/v1/repos/grafana/mimir/coverage",
+			repos:          &stubRepos{defaultBranch: "main"},
+			expectedStatus: http.StatusOK,
+			check: func(t *testing.T, got CoverageResponse) {
+				assert.Equal(t, "main", got.Branch)
+				assert.Equal(t, "abc123", got.Commit)
+				require.NotNil(t, got.Updated)
+				assert.True(t, updated.Equal(*got.Updated))
+				assert.Equal(t, 4, got.Project.Statements)
+				assert.Equal(t, 3, got.Project.CoveredStatements)
+				assert.Equal(t, 75.0, got.Project.Coverage)
+				require.Len(t, got.Project.Files, 1)
+			},
+		},
+		{
+			name:           "branch without a latest pointer",
+			token:          repoToken,
+			target:         "/api/v1/repos/grafana/mimir/coverage?branch=release/1.0",
+			expectedStatus: http.StatusOK,
+			check: func(t *testing.T, got CoverageResponse) {
+				assert.Equal(t, "release/1.0", got.Branch)
+				assert.Empty(t, got.Commit)
+				assert.Nil(t, got.Updated)
+				assert.Equal(t, 75.0, got.Project.Coverage)
+			},
+		},
+		{
+			name:           "profile",
+			token:          orgToken,
+			target:         "/api/v1/repos/grafana/mimir/coverage?branch=main&format=profile",
+			expectedStatus: http.StatusOK,
+			expectedBody:   testCoverage,
+		},
+		{
+			name:           "invalid format",
+			token:          orgToken,
+			target:         "/api/v1/repos/grafana/mimir/coverage?branch=main&format=xml",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "no coverage",
+			token:          orgToken,
+			target:         "/api/v1/repos/grafana/mimir/coverage?branch=missing",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "branch required without repositories",
+			token:          orgToken,
+			target:         "/api/v1/repos/grafana/mimir/coverage",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "repository not found",
+			token:          orgToken,
+			target:         "/api/v1/repos/grafana/mimir/coverage",
+			repos:          &stubRepos{err: &github.APIError{StatusCode: http.StatusNotFound}},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "storage failure",
+			token:          orgToken,
+			target:         "/api/v1/repos/grafana/mimir/coverage?branch=main",
+			storage:        &memoryStorage{err: errors.New("unavailable")},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "repository outside the token's scope",
+			token:          repoToken,
+			target:         "/api/v1/repos/grafana/loki/coverage?branch=main",
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.storage
+			if s == nil {
+				s = store
+			}
+			rec := serve(t, NewHandler(s, nil, tt.repos, nil), manager, tt.token, tt.target)
+
+			require.Equal(t, tt.expectedStatus, rec.Code, rec.Body.String())
+			if tt.expectedBody != "" {
+				assert.Equal(t, tt.expectedBody, rec.Body.String())
+			}
+			if tt.check != nil {
+				assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+				var got CoverageResponse
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+				tt.check(t, got)
+			}
+		})
+	}
+}
+
+func TestHandler_Analysis(t *testing.T) {
+	manager, orgToken, repoToken, _ := testTokens(t)
+	analysis, err := json.Marshal(&worker.Analysis{WorkflowRunID: 4242, PullRequest: 17, HeadSHA: "abc123", Conclusion: "success"})
+	require.NoError(t, err)
+	store := &memoryStorage{data: map[storage.CoverageKey][]byte{
+		worker.AnalysisKey("grafana", "mimir", 4242):          analysis,
+		worker.PullRequestAnalysisKey("grafana", "mimir", 17): analysis,
+		worker.PullRequestAnalysisKey("grafana", "mimir", 18): []byte("not json"),
+	}}
+
+	tests := []struct {
+		name           string
+		token          string
+		target         string
+		expectedStatus int
+	}{
+		{name: "pull request", token: orgToken, target: "/api/v1/repos/grafana/mimir/pulls/17/analysis", expectedStatus: http.StatusOK},
+		{name: "workflow run", token: repoToken, target: "/api/v1/repos/grafana/mimir/runs/4242/analysis", expectedStatus: http.StatusOK},
+		{name: "pull request not analyzed", token: orgToken, target: "/api/v1/repos/grafana/mimir/pulls/19/analysis", expectedStatus: http.StatusNotFound},
+		{name: "run not analyzed", token: orgToken, target: "/api/v1/repos/grafana/mimir/runs/1/analysis", expectedStatus: http.StatusNotFound},
+		{name: "corrupt analysis", token: orgToken, target: "/api/v1/repos/grafana/mimir/pulls/18/analysis", expectedStatus: http.StatusInternalServerError},
+		{name: "invalid number", token: orgToken, target: "/api/v1/repos/grafana/mimir/pulls/latest/analysis", expectedStatus: http.StatusBadRequest},
+		{name: "invalid run ID", token: orgToken, target: "/api/v1/repos/grafana/mimir/runs/0/analysis", expectedStatus: http.StatusBadRequest},
+		{name: "repository outside the token's scope", token: repoToken, target: "/api/v1/repos/grafana/loki/pulls/17/analysis", expectedStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(t, NewHandler(store, nil, nil, nil), manager, tt.token, tt.target)
+
+			require.Equal(t, tt.expectedStatus, rec.Code, rec.Body.String())
+			if tt.expectedStatus == http.StatusOK {
+				assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+				assert.JSONEq(t, string(analysis), rec.Body.String())
+			}
+		})
+	}
+}
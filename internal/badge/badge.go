@@ -0,0 +1,95 @@
+// Package badge renders coverage badges: flat SVG shields, like those of
+// shields.io, showing a branch's coverage and colored by thresholds, so
+// repositories can embed their coverage in a README without a third-party
+// service.
+package badge
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+)
+
+// Badge colors, as used by shields.io.
+const (
+	ColorGreen  = "#4c1"
+	ColorYellow = "#dfb317"
+	ColorRed    = "#e05d44"
+	ColorGray   = "#9f9f9f"
+)
+
+// Thresholds choose a badge's color from a coverage percentage.
+type Thresholds struct {
+	// Green is the lowest percentage shown in green
+	Green float64
+	// Yellow is the lowest percentage shown in yellow; lower is red
+	Yellow float64
+}
+
+// DefaultThresholds color coverage of 80% and up green and of 60% and up
+// yellow.
+var DefaultThresholds = Thresholds{Green: 80, Yellow: 60}
+
+// Color returns the color of a coverage percentage.
+func (t Thresholds) Color(percentage float64) string {
+	switch {
+	case percentage >= t.Green:
+		return ColorGreen
+	case percentage >= t.Yellow:
+		return ColorYellow
+	default:
+		return ColorRed
+	}
+}
+
+// Coverage renders the badge of a coverage percentage.
+func Coverage(percentage float64, thresholds Thresholds) []byte {
+	return Render("coverage", fmt.Sprintf("%.1f%%", percentage), thresholds.Color(percentage))
+}
+
+// Unknown renders the badge of a branch without stored coverage.
+func Unknown() []byte {
+	return Render("coverage", "unknown", ColorGray)
+}
+
+// Render renders a flat badge with label on the left, in gray, and message
+// on the right, in color.
+func Render(label, message, color string) []byte {
+	labelWidth, messageWidth := textWidth(label)+10, textWidth(message)+10
+	width := labelWidth + messageWidth
+	label, message = html.EscapeString(label), html.EscapeString(message)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="20" role="img" aria-label="%s: %s">`, width, label, message)
+	fmt.Fprintf(&b, `<title>%s: %s</title>`, label, message)
+	b.WriteString(`<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>`)
+	fmt.Fprintf(&b, `<clipPath id="r"><rect width="%d" height="20" rx="3" fill="#fff"/></clipPath>`, width)
+	fmt.Fprintf(&b, `<g clip-path="url(#r)"><rect width="%d" height="20" fill="#555"/><rect x="%d" width="%d" height="20" fill="%s"/><rect width="%d" height="20" fill="url(#s)"/></g>`,
+		labelWidth, labelWidth, messageWidth, html.EscapeString(color), width)
+	b.WriteString(`<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">`)
+	writeText(&b, label, labelWidth/2)
+	writeText(&b, message, labelWidth+messageWidth/2)
+	b.WriteString(`</g></svg>`)
+	return b.Bytes()
+}
+
+// writeText writes centered text with a shadow.
+func writeText(b *bytes.Buffer, text string, x int) {
+	fmt.Fprintf(b, `<text x="%d" y="15" fill="#010101" fill-opacity=".3">%s</text><text x="%d" y="14">%s</text>`, x, text, x, text)
+}
+
+// textWidth approximates the width in pixels of text in 11px Verdana.
+func textWidth(text string) int {
+	width := 0
+	for _, r := range text {
+		switch {
+		case r == ' ' || r == '.' || r == ',' || r == ':' || r == 'i' || r == 'l' || r == 'j' || r == 't' || r == 'f' || r == 'r':
+			width += 4
+		case r == '%' || r == 'm' || r == 'w' || r == 'M' || r == 'W':
+			width += 11
+		default:
+			width += 7
+		}
+	}
+	return width
+}
@@ -0,0 +1,67 @@
+package badge
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThresholds_Color(t *testing.T) {
+	tests := []struct {
+		name       string
+		percentage float64
+		expected   string
+	}{
+		{name: "full coverage", percentage: 100, expected: ColorGreen},
+		{name: "at green threshold", percentage: 80, expected: ColorGreen},
+		{name: "below green threshold", percentage: 79.9, expected: ColorYellow},
+		{name: "at yellow threshold", percentage: 60, expected: ColorYellow},
+		{name: "below yellow threshold", percentage: 59.9, expected: ColorRed},
+		{name: "no coverage", percentage: 0, expected: ColorRed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, DefaultThresholds.Color(tt.percentage))
+		})
+	}
+}
+
+func TestCoverage(t *testing.T) {
+	svg := string(Coverage(85.25, DefaultThresholds))
+
+	assert.Contains(t, svg, `aria-label="coverage: 85.2%"`)
+	assert.Contains(t, svg, `fill="`+ColorGreen+`"`)
+	assert.Contains(t, svg, `>85.2%</text>`)
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name    string
+		label   string
+		message string
+	}{
+		{name: "coverage", label: "coverage", message: "72.4%"},
+		{name: "unknown", label: "coverage", message: "unknown"},
+		{name: "escapes markup", label: "<script>", message: `"&'`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svg := Render(tt.label, tt.message, ColorRed)
+
+			var doc struct {
+				XMLName xml.Name `xml:"svg"`
+				Title   string   `xml:"title"`
+			}
+			require.NoError(t, xml.Unmarshal(svg, &doc))
+			assert.Equal(t, tt.label+": "+tt.message, doc.Title)
+		})
+	}
+}
+
+func TestRender_WidthGrowsWithText(t *testing.T) {
+	assert.Less(t, textWidth("9.5%"), textWidth("100.0%"))
+}
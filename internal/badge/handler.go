@@ -0,0 +1,82 @@
+package badge
+
+import (
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+)
+
+// Route is the pattern the badge handler is registered under. The branch
+// may contain slashes and must end in .svg.
+const Route = "GET /badge/{org}/{repo}/{branch...}"
+
+// Handler serves the coverage badge of a branch's stored coverage, e.g.
+// /badge/acme/widgets/main.svg. Badges are public, so image proxies like
+// GitHub's can fetch them: anyone may read the coverage of a repository in
+// the allowed orgs. A branch without coverage gets an "unknown" badge.
+type Handler struct {
+	storage     storage.Storage
+	allowedOrgs []string
+	thresholds  Thresholds
+	logger      *slog.Logger
+}
+
+// NewHandler creates a badge Handler serving the repositories of
+// allowedOrgs (empty allows every org), colored by thresholds.
+func NewHandler(storage storage.Storage, allowedOrgs []string, thresholds Thresholds, logger *slog.Logger) *Handler {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Handler{
+		storage:     storage,
+		allowedOrgs: allowedOrgs,
+		thresholds:  thresholds,
+		logger:      logger,
+	}
+}
+
+// Register adds the badge route to mux.
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.Handle(Route, h)
+}
+
+// ServeHTTP renders the badge of the requested branch.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	org, repo := r.PathValue("org"), r.PathValue("repo")
+	branch, ok := strings.CutSuffix(r.PathValue("branch"), ".svg")
+	if !ok || branch == "" {
+		http.Error(w, "badge path must be /badge/{org}/{repo}/{branch}.svg", http.StatusNotFound)
+		return
+	}
+	if len(h.allowedOrgs) > 0 && !slices.Contains(h.allowedOrgs, org) {
+		http.Error(w, "organization not allowed", http.StatusNotFound)
+		return
+	}
+
+	data, err := h.storage.GetCoverage(r.Context(), storage.CoverageKey{Org: org, Repo: repo, Branch: branch})
+	if err != nil {
+		h.logger.Error("failed to load coverage", "org", org, "repo", repo, "branch", branch, "error", err)
+		http.Error(w, "failed to load coverage", http.StatusInternalServerError)
+		return
+	}
+
+	svg := Unknown()
+	if data != nil {
+		profiles, err := coverage.ParseProfiles(data)
+		if err != nil {
+			h.logger.Error("failed to parse stored coverage", "org", org, "repo", repo, "branch", branch, "error", err)
+			http.Error(w, "failed to parse stored coverage", http.StatusInternalServerError)
+			return
+		}
+		svg = Coverage(coverage.CalculateCoverageStats(profiles).Percentage, h.thresholds)
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	// Image proxies must revalidate, so the badge follows new coverage
+	w.Header().Set("Cache-Control", "no-cache, max-age=0")
+	w.Write(svg)
+}
@@ -0,0 +1,114 @@
+package badge
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+)
+
+type memoryStorage struct {
+	data map[storage.CoverageKey][]byte
+	err  error
+}
+
+func (m *memoryStorage) SaveCoverage(ctx context.Context, key storage.CoverageKey, data []byte) error {
+	m.data[key] = data
+	return nil
+}
+
+func (m *memoryStorage) GetCoverage(ctx context.Context, key storage.CoverageKey) ([]byte, error) {
+	return m.data[key], m.err
+}
+
+func (m *memoryStorage) SaveCoverageReader(ctx context.Context, key storage.CoverageKey, reader io.Reader, size int64) error {
+	return errors.New("not implemented")
+}
+
+func (m *memoryStorage) Close() error { return nil }
+
+func TestHandler(t *testing.T) {
+	store := &memoryStorage{data: map[storage.CoverageKey][]byte{
+		{Org: "acme", Repo: "widgets", Branch: "main"}:        []byte("mode: set\na.go:1.1,2.2 3 1\na.go:3.1,4.2 1 0\n"),
+		{Org: "acme", Repo: "widgets", Branch: "release/1.0"}: []byte("mode: set\na.go:1.1,2.2 1 0\n"),
+		{Org: "acme", Repo: "widgets", Branch: "broken"}:      []byte("not a profile"),
+	}}
+
+	tests := []struct {
+		name             string
+		path             string
+		storage          storage.Storage
+		expectedStatus   int
+		expectedContains []string
+	}{
+		{
+			name:             "branch coverage",
+			path:             "/badge/acme/widgets/main.svg",
+			expectedStatus:   http.StatusOK,
+			expectedContains: []string{"coverage: 75.0%", ColorYellow},
+		},
+		{
+			name:             "branch with slashes",
+			path:             "/badge/acme/widgets/release/1.0.svg",
+			expectedStatus:   http.StatusOK,
+			expectedContains: []string{"coverage: 0.0%", ColorRed},
+		},
+		{
+			name:             "branch without coverage",
+			path:             "/badge/acme/widgets/feature.svg",
+			expectedStatus:   http.StatusOK,
+			expectedContains: []string{"coverage: unknown", ColorGray},
+		},
+		{
+			name:           "missing extension",
+			path:           "/badge/acme/widgets/main",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "org not allowed",
+			path:           "/badge/other/widgets/main.svg",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "corrupt coverage",
+			path:           "/badge/acme/widgets/broken.svg",
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "storage failure",
+			path:           "/badge/acme/widgets/main.svg",
+			storage:        &memoryStorage{err: errors.New("unavailable")},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.storage
+			if s == nil {
+				s = store
+			}
+			mux := http.NewServeMux()
+			NewHandler(s, []string{"acme"}, DefaultThresholds, nil).Register(mux)
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			require.Equal(t, tt.expectedStatus, rec.Code, rec.Body.String())
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			assert.Equal(t, "image/svg+xml", rec.Header().Get("Content-Type"))
+			assert.Contains(t, rec.Header().Get("Cache-Control"), "no-cache")
+			for _, s := range tt.expectedContains {
+				assert.Contains(t, rec.Body.String(), s)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package buildinfo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Ruleset is the version of Canopy's analysis rules: which lines count as
+// added, covered, suppressed, or generated. Bump it whenever a change can
+// produce different results for the same coverage, diff, and config, so
+// results can be traced to the rules that produced them.
+const Ruleset = 1
+
+// configHashLength is the number of hex characters of a config hash.
+const configHashLength = 12
+
+// Provenance identifies what produced an analysis result.
+type Provenance struct {
+	// Version is the Canopy release, e.g. "v1.4.0"
+	Version string `json:"version"`
+	// ConfigHash identifies the repository config (see ConfigHash); empty
+	// if there was none
+	ConfigHash string `json:"config_hash,omitempty"`
+	Ruleset    int    `json:"ruleset"`
+}
+
+// New returns the provenance of results produced by this build of Canopy
+// under the given repository config (nil if there is none).
+// An empty version is reported as "dev".
+func New(version string, config []byte) Provenance {
+	if version == "" {
+		version = "dev"
+	}
+	return Provenance{Version: version, ConfigHash: ConfigHash(config), Ruleset: Ruleset}
+}
+
+// Footer renders the provenance as a single line for reports, e.g.
+// "Canopy v1.4.0 · config 3f2a9c1b0d4e · ruleset 1".
+func (p Provenance) Footer() string {
+	config := p.ConfigHash
+	if config == "" {
+		config = "default"
+	}
+	return fmt.Sprintf("Canopy %s · config %s · ruleset %d", p.Version, config, p.Ruleset)
+}
+
+// ConfigHash returns a short SHA-256 hash of a repository config's contents,
+// or "" if there is no config.
+func ConfigHash(config []byte) string {
+	if config == nil {
+		return ""
+	}
+	sum := sha256.Sum256(config)
+	return hex.EncodeToString(sum[:])[:configHashLength]
+}
+
+// CheckMinimum returns an error if version is below minimum. Both are
+// semantic versions with an optional "v" prefix; pre-release and build
+// suffixes are ignored. An empty minimum accepts any version, and
+// development builds (versions that don't parse, like "dev") are rejected
+// when a minimum is set, since they can't be audited.
+func CheckMinimum(version, minimum string) error {
+	if minimum == "" {
+		return nil
+	}
+	least, err := ParseVersion(minimum)
+	if err != nil {
+		return fmt.Errorf("invalid minimum version: %w", err)
+	}
+	current, err := ParseVersion(version)
+	if err != nil {
+		return fmt.Errorf("version %q can't be compared with minimum %s: %w", version, minimum, err)
+	}
+	for i := range current {
+		if current[i] != least[i] {
+			if current[i] < least[i] {
+				return fmt.Errorf("version %s is below the minimum %s", version, minimum)
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// ParseVersion parses "v1.2.3", "1.2", or "1" into major, minor, and patch
+// numbers; missing parts are zero.
+func ParseVersion(s string) ([3]int, error) {
+	var parts [3]int
+	v := strings.TrimPrefix(s, "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	fields := strings.Split(v, ".")
+	if v == "" || len(fields) > 3 {
+		return parts, fmt.Errorf("invalid version %q", s)
+	}
+	for i, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 0 {
+			return parts, fmt.Errorf("invalid version %q", s)
+		}
+		parts[i] = n
+	}
+	return parts, nil
+}
@@ -0,0 +1,86 @@
+package buildinfo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	p := New("v1.4.0", []byte("annotations:\n  level: warning\n"))
+	assert.Equal(t, "v1.4.0", p.Version)
+	assert.Len(t, p.ConfigHash, 12)
+	assert.Equal(t, Ruleset, p.Ruleset)
+	assert.Equal(t, "Canopy v1.4.0 · config "+p.ConfigHash+" · ruleset 1", p.Footer())
+
+	p = New("", nil)
+	assert.Equal(t, "dev", p.Version)
+	assert.Empty(t, p.ConfigHash)
+	assert.Equal(t, "Canopy dev · config default · ruleset 1", p.Footer())
+}
+
+func TestConfigHash(t *testing.T) {
+	assert.Empty(t, ConfigHash(nil))
+	assert.Equal(t, ConfigHash([]byte("a: 1\n")), ConfigHash([]byte("a: 1\n")))
+	assert.NotEqual(t, ConfigHash([]byte("a: 1\n")), ConfigHash([]byte("a: 2\n")))
+	assert.Equal(t, "e3b0c44298fc", ConfigHash([]byte{}))
+}
+
+func TestCheckMinimum(t *testing.T) {
+	tests := []struct {
+		name     string
+		version  string
+		minimum  string
+		errorMsg string
+	}{
+		{name: "no minimum", version: "dev"},
+		{name: "equal", version: "v1.4.0", minimum: "v1.4.0"},
+		{name: "newer patch", version: "v1.4.2", minimum: "1.4"},
+		{name: "newer major", version: "v2.0.0", minimum: "v1.9.9"},
+		{name: "pre-release suffix ignored", version: "v1.4.0-rc.1", minimum: "v1.4.0"},
+		{name: "older minor", version: "v1.3.9", minimum: "v1.4.0", errorMsg: "version v1.3.9 is below the minimum v1.4.0"},
+		{name: "dev build", version: "dev", minimum: "v1.0.0", errorMsg: `version "dev" can't be compared with minimum v1.0.0`},
+		{name: "invalid minimum", version: "v1.0.0", minimum: "latest", errorMsg: "invalid minimum version"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckMinimum(tt.version, tt.minimum)
+			if tt.errorMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errorMsg)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected [3]int
+		wantErr  bool
+	}{
+		{input: "v1.2.3", expected: [3]int{1, 2, 3}},
+		{input: "1.2", expected: [3]int{1, 2, 0}},
+		{input: "2", expected: [3]int{2, 0, 0}},
+		{input: "v1.2.3+build.5", expected: [3]int{1, 2, 3}},
+		{input: "", wantErr: true},
+		{input: "v1.2.3.4", wantErr: true},
+		{input: "v1.x", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			v, err := ParseVersion(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, v)
+		})
+	}
+}
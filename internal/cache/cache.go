@@ -0,0 +1,163 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	storagepkg "github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+)
+
+// Kind identifies a category of cached value.
+type Kind string
+
+const (
+	// KindBaseline caches stored coverage profiles.
+	KindBaseline Kind = "baseline"
+	// KindSummary caches computed coverage summaries.
+	KindSummary Kind = "summary"
+	// KindBadge caches rendered badge values.
+	KindBadge Kind = "badge"
+)
+
+// Scope selects cached values to invalidate.
+// An empty Branch selects every branch of the repository.
+type Scope struct {
+	Org    string `json:"org"`
+	Repo   string `json:"repo"`
+	Branch string `json:"branch,omitempty"`
+}
+
+// Validate checks that the scope names a repository.
+func (s Scope) Validate() error {
+	if s.Org == "" {
+		return errors.New("org is required")
+	}
+	if s.Repo == "" {
+		return errors.New("repo is required")
+	}
+	return nil
+}
+
+// matches returns true if key falls within the scope.
+func (s Scope) matches(key storagepkg.CoverageKey) bool {
+	return key.Org == s.Org && key.Repo == s.Repo && (s.Branch == "" || key.Branch == s.Branch)
+}
+
+// Generation identifies the invalidation state of a branch.
+// Any invalidation covering the branch changes its Generation.
+type Generation struct {
+	Repo   int64
+	Branch int64
+}
+
+// Generations tracks invalidations shared between processes, so an
+// invalidation issued to one process reaches every worker's cache.
+// Implementations include an in-memory store and Redis.
+type Generations interface {
+	// Generation returns the current generation of a branch.
+	Generation(ctx context.Context, org, repo, branch string) (Generation, error)
+
+	// Invalidate advances the generation of every branch in scope.
+	Invalidate(ctx context.Context, scope Scope) error
+
+	// Close releases any resources held by the store.
+	Close() error
+}
+
+// Cache is a per-process cache of values derived from stored coverage.
+// Entries expire after a TTL and are dropped as soon as their branch is
+// invalidated through the shared Generations, so operators can force a
+// refresh after manual storage edits without restarting workers.
+type Cache struct {
+	generations Generations
+	ttl         time.Duration
+	now         func() time.Time
+
+	mu      sync.Mutex
+	entries map[entryKey]entry
+}
+
+type entryKey struct {
+	kind Kind
+	key  storagepkg.CoverageKey
+}
+
+type entry struct {
+	value      []byte
+	generation Generation
+	storedAt   time.Time
+}
+
+// New creates a Cache. A non-positive ttl keeps entries until invalidated.
+func New(generations Generations, ttl time.Duration) *Cache {
+	return &Cache{
+		generations: generations,
+		ttl:         ttl,
+		now:         time.Now,
+		entries:     make(map[entryKey]entry),
+	}
+}
+
+// GetOrLoad returns the cached value for kind and key, calling load on a miss.
+// Values (including nil) are cached against the branch generation read before
+// load runs, so an invalidation during the load is never masked.
+// If the generation cannot be read, the cache is bypassed.
+func (c *Cache) GetOrLoad(ctx context.Context, kind Kind, key storagepkg.CoverageKey, load func(context.Context) ([]byte, error)) ([]byte, error) {
+	gen, err := c.generations.Generation(ctx, key.Org, key.Repo, key.Branch)
+	if err != nil {
+		return load(ctx)
+	}
+
+	k := entryKey{kind: kind, key: key}
+	c.mu.Lock()
+	e, ok := c.entries[k]
+	if ok && e.generation == gen && !c.expired(e) {
+		c.mu.Unlock()
+		return e.value, nil
+	}
+	delete(c.entries, k)
+	c.mu.Unlock()
+
+	value, err := load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.entries[k] = entry{value: value, generation: gen, storedAt: c.now()}
+	c.mu.Unlock()
+
+	return value, nil
+}
+
+// Invalidate drops every cached value in scope, in this process and,
+// through the shared Generations, in every other process.
+func (c *Cache) Invalidate(ctx context.Context, scope Scope) error {
+	if err := scope.Validate(); err != nil {
+		return err
+	}
+	if err := c.generations.Invalidate(ctx, scope); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k := range c.entries {
+		if scope.matches(k.key) {
+			delete(c.entries, k)
+		}
+	}
+	return nil
+}
+
+// Close closes the shared Generations.
+func (c *Cache) Close() error {
+	return c.generations.Close()
+}
+
+// expired reports whether e is older than the TTL. Callers must hold c.mu.
+func (c *Cache) expired(e entry) bool {
+	return c.ttl > 0 && c.now().Sub(e.storedAt) > c.ttl
+}
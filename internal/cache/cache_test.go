@@ -0,0 +1,169 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	storagepkg "github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+)
+
+// failingGenerations cannot be read or updated.
+type failingGenerations struct{}
+
+func (failingGenerations) Generation(ctx context.Context, org, repo, branch string) (Generation, error) {
+	return Generation{}, errors.New("redis down")
+}
+
+func (failingGenerations) Invalidate(ctx context.Context, scope Scope) error {
+	return errors.New("redis down")
+}
+
+func (failingGenerations) Close() error { return nil }
+
+// countingLoader returns a loader that yields value and counts calls.
+func countingLoader(value string, calls *int) func(context.Context) ([]byte, error) {
+	return func(ctx context.Context) ([]byte, error) {
+		*calls++
+		return []byte(value), nil
+	}
+}
+
+var mainKey = storagepkg.CoverageKey{Org: "grafana", Repo: "mimir", Branch: "main"}
+
+func TestCache_GetOrLoad(t *testing.T) {
+	ctx := context.Background()
+	c := New(NewInMemoryGenerations(), time.Hour)
+
+	calls := 0
+	for i := 0; i < 3; i++ {
+		got, err := c.GetOrLoad(ctx, KindBaseline, mainKey, countingLoader("v1", &calls))
+		require.NoError(t, err)
+		assert.Equal(t, "v1", string(got))
+	}
+	assert.Equal(t, 1, calls)
+
+	// Kinds are cached independently
+	_, err := c.GetOrLoad(ctx, KindBadge, mainKey, countingLoader("badge", &calls))
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+}
+
+func TestCache_GetOrLoad_LoadError(t *testing.T) {
+	ctx := context.Background()
+	c := New(NewInMemoryGenerations(), time.Hour)
+
+	_, err := c.GetOrLoad(ctx, KindBaseline, mainKey, func(ctx context.Context) ([]byte, error) {
+		return nil, errors.New("bucket unavailable")
+	})
+	require.Error(t, err)
+
+	// Errors are not cached
+	calls := 0
+	_, err = c.GetOrLoad(ctx, KindBaseline, mainKey, countingLoader("v1", &calls))
+	require.NoError(t, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestCache_TTL(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	c := New(NewInMemoryGenerations(), time.Minute)
+	c.now = func() time.Time { return now }
+
+	calls := 0
+	_, err := c.GetOrLoad(ctx, KindSummary, mainKey, countingLoader("v1", &calls))
+	require.NoError(t, err)
+
+	now = now.Add(30 * time.Second)
+	_, err = c.GetOrLoad(ctx, KindSummary, mainKey, countingLoader("v1", &calls))
+	require.NoError(t, err)
+	assert.Equal(t, 1, calls)
+
+	now = now.Add(time.Minute)
+	_, err = c.GetOrLoad(ctx, KindSummary, mainKey, countingLoader("v2", &calls))
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+}
+
+func TestCache_Invalidate(t *testing.T) {
+	featureKey := storagepkg.CoverageKey{Org: "grafana", Repo: "mimir", Branch: "feature"}
+	otherRepoKey := storagepkg.CoverageKey{Org: "grafana", Repo: "loki", Branch: "main"}
+
+	tests := []struct {
+		name           string
+		scope          Scope
+		expectReloaded []storagepkg.CoverageKey
+		expectCached   []storagepkg.CoverageKey
+	}{
+		{
+			name:           "single branch",
+			scope:          Scope{Org: "grafana", Repo: "mimir", Branch: "main"},
+			expectReloaded: []storagepkg.CoverageKey{mainKey},
+			expectCached:   []storagepkg.CoverageKey{featureKey, otherRepoKey},
+		},
+		{
+			name:           "whole repository",
+			scope:          Scope{Org: "grafana", Repo: "mimir"},
+			expectReloaded: []storagepkg.CoverageKey{mainKey, featureKey},
+			expectCached:   []storagepkg.CoverageKey{otherRepoKey},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			generations := NewInMemoryGenerations()
+			// Two caches sharing generations model two workers
+			worker1 := New(generations, time.Hour)
+			worker2 := New(generations, time.Hour)
+
+			calls := 0
+			for _, key := range []storagepkg.CoverageKey{mainKey, featureKey, otherRepoKey} {
+				_, err := worker2.GetOrLoad(ctx, KindBaseline, key, countingLoader("v1", &calls))
+				require.NoError(t, err)
+			}
+
+			require.NoError(t, worker1.Invalidate(ctx, tt.scope))
+
+			for _, key := range tt.expectReloaded {
+				before := calls
+				_, err := worker2.GetOrLoad(ctx, KindBaseline, key, countingLoader("v2", &calls))
+				require.NoError(t, err)
+				assert.Equal(t, before+1, calls, "expected %v to be reloaded", key)
+			}
+			for _, key := range tt.expectCached {
+				before := calls
+				_, err := worker2.GetOrLoad(ctx, KindBaseline, key, countingLoader("v2", &calls))
+				require.NoError(t, err)
+				assert.Equal(t, before, calls, "expected %v to stay cached", key)
+			}
+		})
+	}
+}
+
+func TestCache_Invalidate_InvalidScope(t *testing.T) {
+	c := New(NewInMemoryGenerations(), time.Hour)
+	err := c.Invalidate(context.Background(), Scope{Org: "grafana"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "repo is required")
+}
+
+func TestCache_GenerationsUnavailable(t *testing.T) {
+	ctx := context.Background()
+	c := New(failingGenerations{}, time.Hour)
+
+	calls := 0
+	for i := 0; i < 2; i++ {
+		got, err := c.GetOrLoad(ctx, KindBaseline, mainKey, countingLoader("v1", &calls))
+		require.NoError(t, err)
+		assert.Equal(t, "v1", string(got))
+	}
+	assert.Equal(t, 2, calls, "cache should be bypassed")
+
+	require.Error(t, c.Invalidate(ctx, Scope{Org: "grafana", Repo: "mimir"}))
+}
@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/token"
+)
+
+// InvalidateRoute is the pattern the invalidation handler is registered under.
+const InvalidateRoute = "POST /admin/cache/invalidate"
+
+// Handler serves the admin cache invalidation endpoint.
+//
+// The request body is a JSON Scope, e.g. {"org":"grafana","repo":"mimir"}
+// to invalidate every branch or {"org":"grafana","repo":"mimir","branch":"main"}
+// for one branch. Baselines, summaries, and badge values in scope are dropped
+// from every worker's cache.
+type Handler struct {
+	cache  *Cache
+	logger *slog.Logger
+}
+
+// NewHandler creates an invalidation Handler.
+func NewHandler(cache *Cache, logger *slog.Logger) *Handler {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Handler{
+		cache:  cache,
+		logger: logger,
+	}
+}
+
+// Register adds the invalidation route to mux, requiring an admin-scoped token.
+func (h *Handler) Register(mux *http.ServeMux, tokens *token.Manager) {
+	mux.Handle(InvalidateRoute, token.RequireScope(tokens, token.ScopeAdmin)(h))
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var scope Scope
+	if err := json.NewDecoder(r.Body).Decode(&scope); err != nil {
+		http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := scope.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if t, ok := token.FromContext(r.Context()); ok && !t.Allows(scope.Org, scope.Repo) {
+		http.Error(w, token.ErrForbidden.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err := h.cache.Invalidate(r.Context(), scope); err != nil {
+		h.logger.Error("failed to invalidate cache", "org", scope.Org, "repo", scope.Repo, "branch", scope.Branch, "error", err)
+		http.Error(w, "failed to invalidate cache", http.StatusInternalServerError)
+		return
+	}
+	h.logger.Info("invalidated cache", "org", scope.Org, "repo", scope.Repo, "branch", scope.Branch)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]Scope{"invalidated": scope})
+}
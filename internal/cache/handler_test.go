@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/token"
+)
+
+func TestHandler_Invalidate(t *testing.T) {
+	ctx := context.Background()
+	manager := token.NewManager(token.NewInMemoryStore())
+	_, adminToken, err := manager.Issue(ctx, token.IssueRequest{Name: "ops", Org: "grafana", Scopes: []token.Scope{token.ScopeAdmin}})
+	require.NoError(t, err)
+	_, queryToken, err := manager.Issue(ctx, token.IssueRequest{Name: "ci", Org: "grafana", Scopes: []token.Scope{token.ScopeQuery}})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		token          string
+		body           string
+		expectedStatus int
+		expectReload   bool
+	}{
+		{
+			name:           "invalidates branch",
+			token:          adminToken,
+			body:           `{"org":"grafana","repo":"mimir","branch":"main"}`,
+			expectedStatus: http.StatusOK,
+			expectReload:   true,
+		},
+		{
+			name:           "invalidates repository",
+			token:          adminToken,
+			body:           `{"org":"grafana","repo":"mimir"}`,
+			expectedStatus: http.StatusOK,
+			expectReload:   true,
+		},
+		{
+			name:           "missing token",
+			body:           `{"org":"grafana","repo":"mimir"}`,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "token without admin scope",
+			token:          queryToken,
+			body:           `{"org":"grafana","repo":"mimir"}`,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "token for another org",
+			token:          adminToken,
+			body:           `{"org":"other","repo":"mimir"}`,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "missing repo",
+			token:          adminToken,
+			body:           `{"org":"grafana"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "malformed body",
+			token:          adminToken,
+			body:           `not json`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(NewInMemoryGenerations(), time.Hour)
+			calls := 0
+			_, err := c.GetOrLoad(ctx, KindBadge, mainKey, countingLoader("87%", &calls))
+			require.NoError(t, err)
+
+			mux := http.NewServeMux()
+			NewHandler(c, nil).Register(mux, manager)
+
+			req := httptest.NewRequest(http.MethodPost, "/admin/cache/invalidate", strings.NewReader(tt.body))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+
+			_, err = c.GetOrLoad(ctx, KindBadge, mainKey, countingLoader("90%", &calls))
+			require.NoError(t, err)
+			if tt.expectReload {
+				assert.Equal(t, 2, calls)
+				assert.Contains(t, rec.Body.String(), `"invalidated"`)
+			} else {
+				assert.Equal(t, 1, calls)
+			}
+		})
+	}
+}
+
+func TestHandler_InvalidateFailure(t *testing.T) {
+	h := NewHandler(New(failingGenerations{}, time.Hour), nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/cache/invalidate", strings.NewReader(`{"org":"grafana","repo":"mimir"}`))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
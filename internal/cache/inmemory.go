@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"context"
+	"sync"
+)
+
+// InMemoryGenerations implements Generations with a map.
+// It only coordinates a single process, which suits all-in-one mode and testing.
+type InMemoryGenerations struct {
+	mu       sync.RWMutex
+	counters map[string]int64
+}
+
+// NewInMemoryGenerations creates an empty InMemoryGenerations.
+func NewInMemoryGenerations() *InMemoryGenerations {
+	return &InMemoryGenerations{
+		counters: make(map[string]int64),
+	}
+}
+
+// Generation returns the current generation of a branch.
+func (g *InMemoryGenerations) Generation(ctx context.Context, org, repo, branch string) (Generation, error) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return Generation{
+		Repo:   g.counters[scopeKey(Scope{Org: org, Repo: repo})],
+		Branch: g.counters[scopeKey(Scope{Org: org, Repo: repo, Branch: branch})],
+	}, nil
+}
+
+// Invalidate advances the generation of every branch in scope.
+func (g *InMemoryGenerations) Invalidate(ctx context.Context, scope Scope) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.counters[scopeKey(scope)]++
+	return nil
+}
+
+// Close is a no-op.
+func (g *InMemoryGenerations) Close() error {
+	return nil
+}
+
+// scopeKey returns "{org}/{repo}" for repository scopes and
+// "{org}/{repo}/{branch}" for branch scopes.
+func scopeKey(scope Scope) string {
+	key := scope.Org + "/" + scope.Repo
+	if scope.Branch != "" {
+		key += "/" + scope.Branch
+	}
+	return key
+}
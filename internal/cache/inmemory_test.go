@@ -0,0 +1,34 @@
+package cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInMemoryGenerations(t *testing.T) {
+	ctx := context.Background()
+	g := NewInMemoryGenerations()
+	defer g.Close()
+
+	gen, err := g.Generation(ctx, "grafana", "mimir", "main")
+	require.NoError(t, err)
+	assert.Equal(t, Generation{}, gen)
+
+	require.NoError(t, g.Invalidate(ctx, Scope{Org: "grafana", Repo: "mimir", Branch: "main"}))
+	gen, err = g.Generation(ctx, "grafana", "mimir", "main")
+	require.NoError(t, err)
+	assert.Equal(t, Generation{Branch: 1}, gen)
+
+	require.NoError(t, g.Invalidate(ctx, Scope{Org: "grafana", Repo: "mimir"}))
+	gen, err = g.Generation(ctx, "grafana", "mimir", "feature")
+	require.NoError(t, err)
+	assert.Equal(t, Generation{Repo: 1}, gen)
+}
+
+func TestScopeKey(t *testing.T) {
+	assert.Equal(t, "grafana/mimir", scopeKey(Scope{Org: "grafana", Repo: "mimir"}))
+	assert.Equal(t, "grafana/mimir/release/2.0", scopeKey(Scope{Org: "grafana", Repo: "mimir", Branch: "release/2.0"}))
+}
@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisGenerations implements Generations using Redis counters, so every
+// worker sharing the Redis instance observes invalidations.
+// Counters are stored under <KeyPrefix>:{org}/{repo}[/{branch}].
+type RedisGenerations struct {
+	client    *redis.Client
+	keyPrefix string
+}
+
+// RedisConfig holds configuration for creating a RedisGenerations.
+type RedisConfig struct {
+	// Address is the Redis server address (host:port)
+	Address string
+
+	// Password is the Redis password (optional)
+	Password string
+
+	// DB is the Redis database number (default: 0)
+	DB int
+
+	// KeyPrefix namespaces generation keys (default: "canopy:cache")
+	KeyPrefix string
+}
+
+// NewRedisGenerations creates a new RedisGenerations instance.
+// The caller is responsible for calling Close() when done.
+func NewRedisGenerations(ctx context.Context, cfg RedisConfig) (*RedisGenerations, error) {
+	if cfg.Address == "" {
+		return nil, fmt.Errorf("redis address is required")
+	}
+	if cfg.KeyPrefix == "" {
+		cfg.KeyPrefix = "canopy:cache"
+	}
+
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Address,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+
+	// Test connection
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+
+	return &RedisGenerations{
+		client:    client,
+		keyPrefix: cfg.KeyPrefix,
+	}, nil
+}
+
+// Generation returns the current generation of a branch.
+func (g *RedisGenerations) Generation(ctx context.Context, org, repo, branch string) (Generation, error) {
+	values, err := g.client.MGet(ctx,
+		g.generationKey(Scope{Org: org, Repo: repo}),
+		g.generationKey(Scope{Org: org, Repo: repo, Branch: branch}),
+	).Result()
+	if err != nil {
+		return Generation{}, fmt.Errorf("failed to read cache generation from redis: %w", err)
+	}
+
+	counters := make([]int64, len(values))
+	for i, v := range values {
+		s, ok := v.(string)
+		if !ok {
+			continue // Never invalidated
+		}
+		if counters[i], err = strconv.ParseInt(s, 10, 64); err != nil {
+			return Generation{}, fmt.Errorf("invalid cache generation %q: %w", s, err)
+		}
+	}
+	return Generation{Repo: counters[0], Branch: counters[1]}, nil
+}
+
+// Invalidate advances the generation of every branch in scope.
+func (g *RedisGenerations) Invalidate(ctx context.Context, scope Scope) error {
+	if err := g.client.Incr(ctx, g.generationKey(scope)).Err(); err != nil {
+		return fmt.Errorf("failed to invalidate cache in redis: %w", err)
+	}
+	return nil
+}
+
+// Close closes the Redis client connection.
+func (g *RedisGenerations) Close() error {
+	if err := g.client.Close(); err != nil {
+		return fmt.Errorf("failed to close redis client: %w", err)
+	}
+	return nil
+}
+
+func (g *RedisGenerations) generationKey(scope Scope) string {
+	return g.keyPrefix + ":" + scopeKey(scope)
+}
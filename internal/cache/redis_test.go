@@ -0,0 +1,31 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRedisGenerations_Validation(t *testing.T) {
+	_, err := NewRedisGenerations(context.Background(), RedisConfig{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "redis address is required")
+}
+
+func TestNewRedisGenerations_ConnectionError(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	_, err := NewRedisGenerations(ctx, RedisConfig{Address: "localhost:1"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to connect to redis")
+}
+
+func TestRedisGenerations_Keys(t *testing.T) {
+	g := &RedisGenerations{keyPrefix: "canopy:cache"}
+	assert.Equal(t, "canopy:cache:grafana/mimir", g.generationKey(Scope{Org: "grafana", Repo: "mimir"}))
+	assert.Equal(t, "canopy:cache:grafana/mimir/main", g.generationKey(Scope{Org: "grafana", Repo: "mimir", Branch: "main"}))
+}
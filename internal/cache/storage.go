@@ -0,0 +1,98 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	storagepkg "github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+)
+
+// CachedStorage wraps a Storage and caches GetCoverage results as baselines.
+// Saving coverage for a branch invalidates that branch everywhere, so
+// summaries and badges derived from the old coverage are dropped as well.
+type CachedStorage struct {
+	inner storagepkg.Storage
+	cache *Cache
+}
+
+// NewCachedStorage creates a CachedStorage.
+func NewCachedStorage(inner storagepkg.Storage, cache *Cache) *CachedStorage {
+	return &CachedStorage{
+		inner: inner,
+		cache: cache,
+	}
+}
+
+// SaveCoverage stores coverage data and invalidates the branch.
+func (s *CachedStorage) SaveCoverage(ctx context.Context, key storagepkg.CoverageKey, data []byte) error {
+	if err := s.inner.SaveCoverage(ctx, key, data); err != nil {
+		return err
+	}
+	return s.invalidate(ctx, key)
+}
+
+// GetCoverage retrieves coverage data, serving repeated reads from the cache.
+func (s *CachedStorage) GetCoverage(ctx context.Context, key storagepkg.CoverageKey) ([]byte, error) {
+	return s.cache.GetOrLoad(ctx, KindBaseline, key, func(ctx context.Context) ([]byte, error) {
+		return s.inner.GetCoverage(ctx, key)
+	})
+}
+
+// SaveCoverageReader stores coverage data from a reader and invalidates the branch.
+func (s *CachedStorage) SaveCoverageReader(ctx context.Context, key storagepkg.CoverageKey, reader io.Reader, size int64) error {
+	if err := s.inner.SaveCoverageReader(ctx, key, reader, size); err != nil {
+		return err
+	}
+	return s.invalidate(ctx, key)
+}
+
+// ListObjects lists the objects of the underlying storage, uncached, if it
+// implements storagepkg.Lister.
+func (s *CachedStorage) ListObjects(ctx context.Context, prefix string) ([]storagepkg.ObjectInfo, error) {
+	lister, ok := s.inner.(storagepkg.Lister)
+	if !ok {
+		return nil, fmt.Errorf("%T can't list objects", s.inner)
+	}
+	return lister.ListObjects(ctx, prefix)
+}
+
+// DeleteObject deletes an object of the underlying storage, if it
+// implements storagepkg.Pruner, and invalidates the repository its path
+// starts with: an object path can't be mapped back to its branch under
+// every layout. Cached reads of objects whose path doesn't start with the
+// repository, as with storagepkg.HashedLayout, expire with the cache's TTL.
+func (s *CachedStorage) DeleteObject(ctx context.Context, path string) error {
+	pruner, ok := s.inner.(storagepkg.Pruner)
+	if !ok {
+		return fmt.Errorf("%T can't delete objects", s.inner)
+	}
+	if err := pruner.DeleteObject(ctx, path); err != nil {
+		return err
+	}
+	parts := strings.SplitN(path, "/", 3)
+	if len(parts) < 3 {
+		return nil
+	}
+	return s.cache.Invalidate(ctx, Scope{Org: parts[0], Repo: parts[1]})
+}
+
+// GetObject reads an object of the underlying storage, uncached, if it
+// implements storagepkg.ObjectReader.
+func (s *CachedStorage) GetObject(ctx context.Context, path string) ([]byte, error) {
+	reader, ok := s.inner.(storagepkg.ObjectReader)
+	if !ok {
+		return nil, fmt.Errorf("%T can't read objects", s.inner)
+	}
+	return reader.GetObject(ctx, path)
+}
+
+// Close closes the underlying storage.
+func (s *CachedStorage) Close() error {
+	return s.inner.Close()
+}
+
+func (s *CachedStorage) invalidate(ctx context.Context, key storagepkg.CoverageKey) error {
+	return s.cache.Invalidate(ctx, Scope{Org: key.Org, Repo: key.Repo, Branch: key.Branch})
+}
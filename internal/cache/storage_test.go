@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	storagepkg "github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+)
+
+// countingStorage is an in-memory Storage that counts reads.
+type countingStorage struct {
+	objects map[storagepkg.CoverageKey][]byte
+	reads   int
+}
+
+func (s *countingStorage) SaveCoverage(ctx context.Context, key storagepkg.CoverageKey, data []byte) error {
+	s.objects[key] = data
+	return nil
+}
+
+func (s *countingStorage) GetCoverage(ctx context.Context, key storagepkg.CoverageKey) ([]byte, error) {
+	s.reads++
+	return s.objects[key], nil
+}
+
+func (s *countingStorage) SaveCoverageReader(ctx context.Context, key storagepkg.CoverageKey, reader io.Reader, size int64) error {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	return s.SaveCoverage(ctx, key, data)
+}
+
+func (s *countingStorage) Close() error { return nil }
+
+func TestCachedStorage(t *testing.T) {
+	ctx := context.Background()
+	inner := &countingStorage{objects: map[storagepkg.CoverageKey][]byte{mainKey: []byte("mode: set\n")}}
+	generations := NewInMemoryGenerations()
+	s := NewCachedStorage(inner, New(generations, time.Hour))
+	other := NewCachedStorage(inner, New(generations, time.Hour))
+
+	t.Run("reads are cached", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			data, err := s.GetCoverage(ctx, mainKey)
+			require.NoError(t, err)
+			assert.Equal(t, "mode: set\n", string(data))
+		}
+		assert.Equal(t, 1, inner.reads)
+	})
+
+	t.Run("missing coverage is cached as nil", func(t *testing.T) {
+		missing := storagepkg.CoverageKey{Org: "grafana", Repo: "mimir", Branch: "missing"}
+		before := inner.reads
+		for i := 0; i < 2; i++ {
+			data, err := s.GetCoverage(ctx, missing)
+			require.NoError(t, err)
+			assert.Nil(t, data)
+		}
+		assert.Equal(t, before+1, inner.reads)
+	})
+
+	t.Run("saves invalidate other caches", func(t *testing.T) {
+		require.NoError(t, other.SaveCoverageReader(ctx, mainKey, strings.NewReader("mode: count\n"), 12))
+
+		data, err := s.GetCoverage(ctx, mainKey)
+		require.NoError(t, err)
+		assert.Equal(t, "mode: count\n", string(data))
+	})
+}
+
+// listingStorage is a countingStorage that can list objects.
+type listingStorage struct {
+	countingStorage
+	listed []storagepkg.ObjectInfo
+}
+
+func (s *listingStorage) ListObjects(ctx context.Context, prefix string) ([]storagepkg.ObjectInfo, error) {
+	return s.listed, nil
+}
+
+func TestCachedStorage_ListObjects(t *testing.T) {
+	ctx := context.Background()
+	objects := []storagepkg.ObjectInfo{{Path: "grafana/mimir/main/coverage.out"}}
+
+	s := NewCachedStorage(&listingStorage{listed: objects}, New(NewInMemoryGenerations(), time.Hour))
+	listed, err := s.ListObjects(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, objects, listed)
+
+	s = NewCachedStorage(&countingStorage{}, New(NewInMemoryGenerations(), time.Hour))
+	_, err = s.ListObjects(ctx, "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "can't list objects")
+}
+
+func TestCachedStorage_DeleteObject(t *testing.T) {
+	s := NewCachedStorage(&countingStorage{}, New(NewInMemoryGenerations(), time.Hour))
+	assert.ErrorContains(t, s.DeleteObject(context.Background(), "grafana/mimir/main/coverage.out"), "can't delete objects")
+}
@@ -0,0 +1,55 @@
+// Package clock abstracts the current time, so outputs that depend on it
+// (suppression expiry, stale run checks) can be made reproducible.
+package clock
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// SourceDateEpochEnv is the environment variable that sets the time of
+// the Deterministic clock, as defined by reproducible-builds.org.
+const SourceDateEpochEnv = "SOURCE_DATE_EPOCH"
+
+// Clock tells the current time.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// System is the Clock backed by the system time.
+var System Clock = systemClock{}
+
+// Fixed is a Clock that always reports the same time.
+type Fixed time.Time
+
+// Now implements Clock.
+func (f Fixed) Now() time.Time { return time.Time(f) }
+
+// Or returns c, or System if c is nil.
+func Or(c Clock) Clock {
+	if c == nil {
+		return System
+	}
+	return c
+}
+
+// Deterministic returns the Clock used in deterministic mode: fixed at
+// SOURCE_DATE_EPOCH (seconds since the Unix epoch) if it is set, or at the
+// Unix epoch otherwise, so identical inputs produce byte-identical outputs.
+func Deterministic() (Clock, error) {
+	value := os.Getenv(SourceDateEpochEnv)
+	if value == "" {
+		return Fixed(time.Unix(0, 0).UTC()), nil
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q: %w", SourceDateEpochEnv, value, err)
+	}
+	return Fixed(time.Unix(seconds, 0).UTC()), nil
+}
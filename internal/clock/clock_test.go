@@ -0,0 +1,42 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeterministic(t *testing.T) {
+	tests := []struct {
+		name    string
+		epoch   string
+		want    time.Time
+		wantErr bool
+	}{
+		{name: "unset uses the unix epoch", epoch: "", want: time.Unix(0, 0).UTC()},
+		{name: "source date epoch", epoch: "1700000000", want: time.Unix(1700000000, 0).UTC()},
+		{name: "invalid", epoch: "yesterday", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(SourceDateEpochEnv, tt.epoch)
+			c, err := Deterministic()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, c.Now())
+			assert.Equal(t, c.Now(), c.Now())
+		})
+	}
+}
+
+func TestOr(t *testing.T) {
+	fixed := Fixed(time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, System, Or(nil))
+	assert.Equal(t, fixed, Or(fixed))
+}
@@ -0,0 +1,139 @@
+// Package codeowners resolves the owners of files from a GitHub CODEOWNERS
+// file.
+package codeowners
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Paths are where GitHub looks for a CODEOWNERS file, in order.
+var Paths = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// Rule assigns owners to the files matching a pattern.
+type Rule struct {
+	Pattern string
+	// Owners are users (@user), teams (@org/team), or emails; empty if the
+	// files have no owners
+	Owners []string
+	// Line is the rule's line in the file
+	Line int
+
+	re *regexp.Regexp
+}
+
+// File is a parsed CODEOWNERS file. The last rule matching a file decides
+// its owners, as on GitHub.
+type File struct {
+	Rules []Rule
+}
+
+// Parse parses a CODEOWNERS file. Patterns follow the gitignore syntax
+// GitHub supports: "*" and "?" match within a path segment, "**" across
+// segments, patterns with a leading or inner "/" are relative to the
+// repository root, and patterns matching a directory match everything in
+// it. Negated patterns ("!") and character ranges ("[ ]") are rejected,
+// since GitHub doesn't support them either.
+func Parse(data []byte) (*File, error) {
+	f := &File{}
+	for i, line := range strings.Split(string(data), "\n") {
+		if j := strings.Index(line, " #"); j >= 0 {
+			line = line[:j]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		pattern := fields[0]
+		switch {
+		case strings.HasPrefix(pattern, "!"):
+			return nil, fmt.Errorf("line %d: negated pattern %q is not supported", i+1, pattern)
+		case strings.ContainsAny(pattern, "[]"):
+			return nil, fmt.Errorf("line %d: character range in pattern %q is not supported", i+1, pattern)
+		}
+		rule := Rule{Pattern: pattern, Line: i + 1, re: compile(pattern)}
+		if len(fields) > 1 {
+			rule.Owners = fields[1:]
+		}
+		f.Rules = append(f.Rules, rule)
+	}
+	return f, nil
+}
+
+// Load reads the CODEOWNERS file of the repository at root (empty for the
+// working directory) from the first of Paths that exists. It returns nil
+// and no error if the repository has none.
+func Load(root string) (*File, error) {
+	for _, path := range Paths {
+		data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(path)))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		f, err := Parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", path, err)
+		}
+		return f, nil
+	}
+	return nil, nil
+}
+
+// Owners returns the owners of a file, given by its path relative to the
+// repository root, or nil if it has none. It is safe to call on a nil File.
+func (f *File) Owners(path string) []string {
+	if f == nil {
+		return nil
+	}
+	path = strings.TrimPrefix(path, "/")
+	for i := len(f.Rules) - 1; i >= 0; i-- {
+		if f.Rules[i].re.MatchString(path) {
+			return f.Rules[i].Owners
+		}
+	}
+	return nil
+}
+
+// compile translates a CODEOWNERS pattern into a regular expression
+// matching the paths it applies to.
+func compile(pattern string) *regexp.Regexp {
+	anchored := strings.Contains(strings.TrimSuffix(pattern, "/"), "/")
+	p := strings.Trim(pattern, "/")
+
+	var b strings.Builder
+	b.WriteString("^")
+	if !anchored {
+		// Patterns without a slash match at any depth
+		b.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(p); i++ {
+		switch {
+		case strings.HasPrefix(p[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(p[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case p[i] == '*':
+			b.WriteString("[^/]*")
+		case p[i] == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(p[i : i+1]))
+		}
+	}
+	// A trailing "/*" matches only the files directly in a directory;
+	// otherwise a matched directory matches everything in it
+	if !strings.HasSuffix(p, "/*") {
+		b.WriteString("(?:/.*)?")
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
@@ -0,0 +1,74 @@
+package codeowners
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const example = `# Default owners
+*       @acme/core
+
+*.go    @acme/gophers # Go code
+/docs/  @acme/docs
+apps/   @acme/apps
+/build/logs/ @acme/ops
+internal/*  @acme/internal
+**/testdata @acme/qa
+/vendor/
+`
+
+func TestFile_Owners(t *testing.T) {
+	f, err := Parse([]byte(example))
+	require.NoError(t, err)
+
+	tests := []struct {
+		path     string
+		expected []string
+	}{
+		{path: "README.md", expected: []string{"@acme/core"}},
+		{path: "main.go", expected: []string{"@acme/gophers"}},
+		{path: "pkg/deep/file.go", expected: []string{"@acme/gophers"}},
+		{path: "docs/guide.md", expected: []string{"@acme/docs"}},
+		{path: "pkg/docs/guide.md", expected: []string{"@acme/core"}},
+		{path: "apps/web/main.go", expected: []string{"@acme/apps"}},
+		{path: "services/apps/main.go", expected: []string{"@acme/apps"}},
+		{path: "build/logs/out.txt", expected: []string{"@acme/ops"}},
+		{path: "internal/config.go", expected: []string{"@acme/internal"}},
+		{path: "internal/worker/worker.go", expected: []string{"@acme/gophers"}},
+		{path: "pkg/testdata/fixture.json", expected: []string{"@acme/qa"}},
+		{path: "vendor/lib/lib.go", expected: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			assert.Equal(t, tt.expected, f.Owners(tt.path))
+		})
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	_, err := Parse([]byte("*.go @acme/gophers\n!vendor/ @acme/core\n"))
+	assert.EqualError(t, err, `line 2: negated pattern "!vendor/" is not supported`)
+
+	_, err = Parse([]byte("*.[ch] @acme/c\n"))
+	assert.EqualError(t, err, `line 1: character range in pattern "*.[ch]" is not supported`)
+}
+
+func TestLoad(t *testing.T) {
+	root := t.TempDir()
+	f, err := Load(root)
+	require.NoError(t, err)
+	assert.Nil(t, f)
+	assert.Nil(t, f.Owners("main.go"))
+
+	require.NoError(t, os.WriteFile(filepath.Join(root, "CODEOWNERS"), []byte("* @acme/root\n"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, ".github"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, ".github", "CODEOWNERS"), []byte("* @acme/github\n"), 0644))
+
+	f, err = Load(root)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"@acme/github"}, f.Owners("main.go"))
+}
@@ -1,10 +1,27 @@
 package config
 
 import (
+	"encoding/base64"
 	"fmt"
-	"os"
+	"log/slog"
+	"math"
+	"net/url"
+	"path"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/badge"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/buildinfo"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github/artifacts"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/gitlab"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/logging"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/queue"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/repoconfig"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/server"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
 )
 
 // Mode represents the deployment mode of the service
@@ -24,6 +41,7 @@ const (
 	QueueTypeInMemory QueueType = "inmemory"
 	QueueTypeRedis    QueueType = "redis"
 	QueueTypePubSub   QueueType = "pubsub"
+	QueueTypeKafka    QueueType = "kafka"
 )
 
 // StorageType represents the type of storage backend to use
@@ -32,15 +50,24 @@ type StorageType string
 const (
 	StorageTypeGCS   StorageType = "gcs"
 	StorageTypeMinio StorageType = "minio"
+	StorageTypeS3    StorageType = "s3"
+	StorageTypeFS    StorageType = "fs"
 )
 
 // Config holds all configuration for the Canopy service
 type Config struct {
 	// Port for the HTTP server
-	Port int
+	Port int `env:"CANOPY_PORT" default:"8080"`
+
+	// Listen overrides Port with an address such as unix:///run/canopy.sock
+	// or tcp://127.0.0.1:8080 (see server.ParseListen); empty uses Port
+	Listen string `env:"CANOPY_LISTEN"`
 
 	// DisableHMAC disables webhook signature validation (dev only)
-	DisableHMAC bool
+	DisableHMAC bool `env:"CANOPY_DISABLE_HMAC"`
+
+	// LogLevel is the lowest level of the services' logs
+	LogLevel slog.Level
 
 	// Queue configuration
 	Queue QueueConfig
@@ -51,8 +78,77 @@ type Config struct {
 	// GitHub configuration
 	GitHub GitHubConfig
 
+	// GitLab configuration
+	GitLab GitLabConfig
+
 	// Webhook configuration
 	Webhook WebhookConfig
+
+	// Worker configuration
+	Worker WorkerConfig
+
+	// API configuration
+	API APIConfig
+
+	// Badge configuration
+	Badge BadgeConfig
+
+	// Viewer configuration
+	Viewer ViewerConfig
+
+	// Metrics configuration
+	Metrics MetricsConfig
+}
+
+// MetricsConfig holds Prometheus metrics settings
+type MetricsConfig struct {
+	// Port serves /metrics on its own port; zero serves it on the main HTTP
+	// server. Workers, which have no HTTP server, default to
+	// DefaultWorkerMetricsPort.
+	Port int
+}
+
+// DefaultWorkerMetricsPort is the port workers serve /metrics on by default.
+const DefaultWorkerMetricsPort = 9090
+
+// DefaultDrainTimeout is how long in-flight work requests may take to
+// finish when a worker shuts down, unless CANOPY_WORKER_DRAIN_TIMEOUT is set.
+// It fits within Kubernetes' default 30s termination grace period.
+const DefaultDrainTimeout = 25 * time.Second
+
+// BadgeConfig holds coverage badge settings
+type BadgeConfig struct {
+	// Enabled serves public coverage badges of the allowed orgs'
+	// repositories (see badge.Handler)
+	Enabled bool `env:"CANOPY_BADGE_ENABLED"`
+
+	// Thresholds color the badges
+	Thresholds badge.Thresholds
+}
+
+// ViewerConfig holds diff viewer settings
+type ViewerConfig struct {
+	// PublicURL is the URL the service is reachable at, e.g.
+	// https://canopy.example.com. If set, the diff viewer (see
+	// viewer.Handler) is served and check runs link to it; empty disables it.
+	PublicURL string `env:"CANOPY_PUBLIC_URL"`
+}
+
+// APIConfig holds query API settings
+type APIConfig struct {
+	// Enabled serves the read-only query API (see api.Handler), and the
+	// trend API, authenticated with tokens from the Redis token store
+	Enabled bool `env:"CANOPY_API_ENABLED"`
+
+	// UploadEnabled serves the coverage upload endpoint (see
+	// upload.Handler), authenticated with upload-scoped tokens from the
+	// same token store
+	UploadEnabled bool `env:"CANOPY_UPLOAD_ENABLED"`
+
+	// Redis configuration of the token store, shared with canopy-admin
+	RedisAddr     string `env:"CANOPY_REDIS_ADDR" default:"localhost:6379"`
+	RedisPassword string `env:"CANOPY_REDIS_PASSWORD" secret:"true"`
+	RedisDB       int    `env:"CANOPY_REDIS_DB" default:"0"`
 }
 
 // QueueConfig holds message queue configuration
@@ -60,15 +156,64 @@ type QueueConfig struct {
 	Type QueueType
 
 	// Redis configuration
-	RedisAddr     string
-	RedisPassword string
-	RedisDB       int
-	RedisStream   string
+	RedisAddr     string `env:"CANOPY_REDIS_ADDR" default:"localhost:6379"`
+	RedisPassword string `env:"CANOPY_REDIS_PASSWORD" secret:"true"`
+	RedisDB       int    `env:"CANOPY_REDIS_DB" default:"0"`
+	RedisStream   string `env:"CANOPY_REDIS_STREAM" default:"canopy-coverage-requests"`
+	// RedisConsumerGroup is the workers' consumer group, whose lag and
+	// pending entries are reported as the queue backlog
+	RedisConsumerGroup string `env:"CANOPY_REDIS_CONSUMER_GROUP" default:"canopy-workers"`
+	// Scaling turns the Redis backlog into a worker count for autoscalers
+	// (GET /queue/scaling on the webhook service)
+	Scaling queue.ScalingPolicy
+	// RedisDeadLetterStream receives messages that exhausted MaxDeliveries
+	RedisDeadLetterStream string `env:"CANOPY_REDIS_DEAD_LETTER_STREAM"`
+	// RedisRetryAfter is how long a message stays unacknowledged before it
+	// is delivered again
+	RedisRetryAfter time.Duration `env:"CANOPY_REDIS_RETRY_AFTER" default:"5m" validate:"positive"`
 
 	// Pub/Sub configuration
-	PubSubProjectID    string
-	PubSubTopicID      string
-	PubSubSubscription string
+	PubSubProjectID    string `env:"CANOPY_PUBSUB_PROJECT_ID"`
+	PubSubTopicID      string `env:"CANOPY_PUBSUB_TOPIC_ID" default:"canopy-coverage-requests"`
+	PubSubSubscription string `env:"CANOPY_PUBSUB_SUBSCRIPTION"`
+	// PubSubDeadLetterTopicID receives messages that exhausted MaxDeliveries;
+	// they are read back from PubSubDeadLetterSubscription
+	PubSubDeadLetterTopicID      string `env:"CANOPY_PUBSUB_DEAD_LETTER_TOPIC_ID"`
+	PubSubDeadLetterSubscription string `env:"CANOPY_PUBSUB_DEAD_LETTER_SUBSCRIPTION"`
+
+	// MaxDeliveries is how many times a Redis, Pub/Sub, or Kafka message is
+	// delivered before it is moved to the dead-letter queue; zero retries
+	// failed messages forever
+	MaxDeliveries int `env:"CANOPY_QUEUE_MAX_DELIVERIES" default:"5" validate:"nonnegative"`
+
+	// Kafka configuration
+	KafkaBrokers       []string `env:"CANOPY_KAFKA_BROKERS"`
+	KafkaTopic         string   `env:"CANOPY_KAFKA_TOPIC" default:"canopy-coverage-requests"`
+	KafkaConsumerGroup string   `env:"CANOPY_KAFKA_CONSUMER_GROUP" default:"canopy-workers"`
+	// KafkaDeadLetterTopic receives messages that exhausted MaxDeliveries
+	// (default: KafkaTopic + "-dead-letter")
+	KafkaDeadLetterTopic string `env:"CANOPY_KAFKA_DEAD_LETTER_TOPIC"`
+	// KafkaTLS connects to the brokers with TLS, verifying them with the
+	// system's CA certificates or those of KafkaTLSCAFile
+	KafkaTLS       bool   `env:"CANOPY_KAFKA_TLS"`
+	KafkaTLSCAFile string `env:"CANOPY_KAFKA_TLS_CA_FILE"`
+	// KafkaTLSCertFile and KafkaTLSKeyFile are the PEM client certificate
+	// and key of brokers that require mutual TLS
+	KafkaTLSCertFile string `env:"CANOPY_KAFKA_TLS_CERT_FILE"`
+	KafkaTLSKeyFile  string `env:"CANOPY_KAFKA_TLS_KEY_FILE"`
+	// KafkaSASLMechanism authenticates to the brokers with SASL: PLAIN,
+	// SCRAM-SHA-256, or SCRAM-SHA-512
+	KafkaSASLMechanism string `env:"CANOPY_KAFKA_SASL_MECHANISM"`
+	KafkaSASLUsername  string `env:"CANOPY_KAFKA_SASL_USERNAME"`
+	KafkaSASLPassword  string `env:"CANOPY_KAFKA_SASL_PASSWORD" secret:"true"`
+
+	// SigningKeys, when set, sign the work requests published to the queue,
+	// and workers drop requests not signed with one of them. The first key
+	// signs; list the new key first to rotate keys (see queue.SignedQueue).
+	SigningKeys []string `env:"CANOPY_QUEUE_SIGNING_KEY" secret:"true"`
+	// AllowUnsigned accepts unsigned requests while publishers are
+	// upgraded to sign them
+	AllowUnsigned bool `env:"CANOPY_QUEUE_ALLOW_UNSIGNED"`
 }
 
 // StorageConfig holds storage backend configuration
@@ -76,65 +221,230 @@ type StorageConfig struct {
 	Type StorageType
 
 	// GCS configuration
-	GCSBucket string
+	GCSBucket string `env:"CANOPY_GCS_BUCKET"`
 
 	// MinIO configuration
-	MinIOEndpoint  string
-	MinIOAccessKey string
-	MinIOSecretKey string
-	MinIOBucket    string
-	MinIOUseSSL    bool
+	MinIOEndpoint  string `env:"CANOPY_MINIO_ENDPOINT"`
+	MinIOAccessKey string `env:"CANOPY_MINIO_ACCESS_KEY" secret:"true"`
+	MinIOSecretKey string `env:"CANOPY_MINIO_SECRET_KEY" secret:"true"`
+	MinIOBucket    string `env:"CANOPY_MINIO_BUCKET" default:"canopy-coverage"`
+	MinIOUseSSL    bool   `env:"CANOPY_MINIO_USE_SSL"`
+
+	// S3 configuration; credentials come from the AWS default chain
+	S3Bucket   string `env:"CANOPY_S3_BUCKET"`
+	S3Region   string `env:"CANOPY_S3_REGION"`
+	S3Endpoint string `env:"CANOPY_S3_ENDPOINT"`
+
+	// Filesystem configuration
+	FSRoot string `env:"CANOPY_FS_ROOT"`
+
+	// Layout names the object path layout (see storage.ParseLayout).
+	// Empty uses the default {org}/{repo}/{branch}/coverage.out layout.
+	Layout string `env:"CANOPY_STORAGE_LAYOUT"`
+
+	// EncryptionKey is a base64-encoded AES key (16, 24, or 32 bytes).
+	// When set, coverage content is encrypted before it is written.
+	EncryptionKey string `env:"CANOPY_STORAGE_ENCRYPTION_KEY" secret:"true"`
+	// EncryptionAllowPlaintext reads objects that aren't encrypted as-is,
+	// while coverage written before encryption was enabled is migrated;
+	// otherwise reading them fails.
+	EncryptionAllowPlaintext bool `env:"CANOPY_STORAGE_ENCRYPTION_ALLOW_PLAINTEXT"`
 }
 
 // GitHubConfig holds GitHub API configuration
 type GitHubConfig struct {
 	// GitHub App credentials
-	AppID          int64
-	InstallationID int64
-	PrivateKey     string // PEM-encoded private key
+	AppID int64 `env:"CANOPY_GITHUB_APP_ID"`
+	// InstallationID is the installation used for work requests that don't
+	// name theirs; zero requires every request to name one
+	InstallationID int64  `env:"CANOPY_GITHUB_INSTALLATION_ID" validate:"nonnegative"`
+	PrivateKey     string `env:"CANOPY_GITHUB_PRIVATE_KEY" secret:"true"` // PEM-encoded private key
+
+	// CoverageLabels are applied to or removed from PRs based on patch coverage.
+	// Empty disables label automation.
+	CoverageLabels []github.LabelBand
+}
+
+// GitLabConfig holds GitLab API configuration
+type GitLabConfig struct {
+	// BaseURL is the GitLab API endpoint (default: gitlab.DefaultBaseURL)
+	BaseURL string `env:"CANOPY_GITLAB_URL"`
+	// Token is an access token with the api scope; empty leaves GitLab
+	// pipelines unprocessed by workers
+	Token string `env:"CANOPY_GITLAB_TOKEN" secret:"true"`
+	// WebhookSecret is the secret token of GitLab pipeline webhooks; empty
+	// doesn't serve webhook.GitLabRoute
+	WebhookSecret string `env:"CANOPY_GITLAB_WEBHOOK_SECRET" secret:"true"`
 }
 
 // WebhookConfig holds webhook-specific configuration
 type WebhookConfig struct {
-	// Webhook validation
-	WebhookSecret string
+	// Webhook validation; comma-separated secrets are all accepted, so
+	// the secret can be rotated (see webhook.ValidateHMAC)
+	WebhookSecret string `env:"CANOPY_WEBHOOK_SECRET" secret:"true"`
 
 	// Filtering
-	AllowedOrgs      []string
-	AllowedWorkflows []string
+	AllowedOrgs      []string `env:"CANOPY_ALLOWED_ORGS"`
+	AllowedWorkflows []string `env:"CANOPY_ALLOWED_WORKFLOWS"`
+	// AllowedRepos and AllowedBranches are path.Match patterns of accepted
+	// repository full names and branches; empty accepts all
+	AllowedRepos    []string `env:"CANOPY_ALLOWED_REPOS"`
+	AllowedBranches []string `env:"CANOPY_ALLOWED_BRANCHES"`
+
+	// ProxyURL is a smee.io-style channel to relay deliveries from
+	// (all-in-one mode only, for local development)
+	ProxyURL string `env:"CANOPY_WEBHOOK_PROXY_URL"`
+
+	// RepoSyncInterval, if set, accepts only the repositories the GitHub App
+	// installation grants access to, synced this often (all-in-one mode
+	// only, since it needs the App's credentials; see
+	// webhook.InstallationRepos). Zero disables it.
+	RepoSyncInterval time.Duration `env:"CANOPY_WEBHOOK_REPO_SYNC_INTERVAL" validate:"nonnegative"`
+
+	// PullRequestEvents accepts pull_request events, analyzing coverage a
+	// companion upload step stored for the PR's head commit (see
+	// webhook.HandlerConfig.PullRequestEvents)
+	PullRequestEvents bool `env:"CANOPY_WEBHOOK_PULL_REQUEST_EVENTS"`
+}
+
+// WorkerConfig holds worker processing settings
+type WorkerConfig struct {
+	// MaxRunAge drops work requests whose workflow run completed longer ago
+	// than this (e.g. a backlog after an outage). Zero disables the deadline.
+	MaxRunAge time.Duration `env:"CANOPY_WORKER_MAX_RUN_AGE" validate:"nonnegative"`
+
+	// CacheTTL bounds how long baselines, summaries, and badge values are
+	// cached in-process; entries are also dropped when invalidated
+	CacheTTL time.Duration `env:"CANOPY_CACHE_TTL" default:"5m"`
+
+	// DrainTimeout is how long work requests being processed at shutdown
+	// may take to finish before they are cancelled and left for redelivery
+	DrainTimeout time.Duration `env:"CANOPY_WORKER_DRAIN_TIMEOUT" default:"25s" validate:"nonnegative"`
+
+	// IdempotencyTTL is how long processed work requests are remembered,
+	// so their redeliveries are skipped; zero processes every delivery
+	IdempotencyTTL time.Duration `env:"CANOPY_IDEMPOTENCY_TTL" default:"72h" validate:"nonnegative"`
+
+	// ArtifactStorageFallback restores coverage from a copy in storage, written
+	// by a companion upload step, when a run's artifacts have expired
+	ArtifactStorageFallback bool `env:"CANOPY_ARTIFACT_STORAGE_FALLBACK"`
+
+	// ArtifactPatterns select a run's coverage artifacts by name (see
+	// artifacts.Match)
+	ArtifactPatterns []string
+
+	// ArtifactMaxSize bounds the size of downloaded artifact archives
+	ArtifactMaxSize int64 `env:"CANOPY_ARTIFACT_MAX_SIZE" default:"500MiB" format:"bytes" validate:"positive"`
+
+	// ArtifactSpoolThreshold is the size above which artifact archives are
+	// downloaded to a temporary file instead of memory
+	ArtifactSpoolThreshold int64 `env:"CANOPY_ARTIFACT_SPOOL_THRESHOLD" default:"64MiB" format:"bytes" validate:"positive"`
+
+	// ShardedBaselines saves default branch coverage split by package as
+	// well, so PRs fetch only the packages they change (see
+	// worker.Worker.ShardedBaselines)
+	ShardedBaselines bool `env:"CANOPY_WORKER_SHARDED_BASELINES"`
+
+	// RemapStaleCoverage remaps the coverage of PR runs of an older commit
+	// than the PR's head to the head's line numbers (see
+	// worker.Worker.RemapStaleCoverage)
+	RemapStaleCoverage bool `env:"CANOPY_WORKER_REMAP_STALE_COVERAGE"`
+
+	// CheckRunDetails adds the full Markdown report to check runs as their
+	// text (see worker.Worker.CheckRunDetails)
+	CheckRunDetails bool `env:"CANOPY_WORKER_CHECK_RUN_DETAILS"`
+
+	// ExportFormats are the formats default branch coverage is converted to
+	// and saved in next to coverage.out (see worker.Worker.ExportFormats)
+	ExportFormats []coverage.Format
+
+	// DefaultThresholds apply to repositories whose config sets no
+	// thresholds (see worker.Worker.DefaultThresholds); nil if unset
+	DefaultThresholds *repoconfig.ThresholdsConfig
+
+	// OrgConfigTTL, if set, reads org configs from storage (see
+	// worker.OrgConfigs) and caches them for this long; zero disables them
+	OrgConfigTTL time.Duration `env:"CANOPY_WORKER_ORG_CONFIG_TTL" validate:"nonnegative"`
+
+	// MinVersion is the lowest Canopy version allowed to run as a worker
+	// (see buildinfo.CheckMinimum); empty allows any version
+	MinVersion string `env:"CANOPY_MIN_WORKER_VERSION"`
+
+	// MemoryBudget is the number of bytes processing a single work request
+	// may hold (see worker.MemoryBudget). Zero disables the limit.
+	MemoryBudget int64 `env:"CANOPY_WORKER_MEMORY_BUDGET" format:"bytes"`
+
+	// GitHubRequestLimit is the number of GitHub API requests a single work
+	// request may make before optional ones, like the PR comment, are
+	// skipped (see worker.APIBudget). Zero disables the limit.
+	GitHubRequestLimit int `env:"CANOPY_WORKER_GITHUB_REQUEST_LIMIT" validate:"nonnegative"`
+
+	// GitHubQuotaReserve is the remaining rate limit quota of the GitHub App
+	// installation below which optional requests are skipped. Zero disables it.
+	GitHubQuotaReserve int `env:"CANOPY_WORKER_GITHUB_QUOTA_RESERVE" default:"100" validate:"nonnegative"`
+
+	// Concurrency is how many work requests are processed at once; requests
+	// for the same org, repository, and branch still run one at a time
+	Concurrency int `env:"CANOPY_WORKER_CONCURRENCY" default:"1"`
+}
+
+// loader loads a Config's sections from a source.
+type loader struct {
+	*Config
+	*source
 }
 
-// Load loads configuration from environment variables for the specified mode
+// Load loads configuration for the specified mode from environment
+// variables and the optional config file named by CANOPY_CONFIG_FILE
 func Load(mode Mode) (*Config, error) {
 	// Validate mode
 	if err := validateMode(mode); err != nil {
 		return nil, err
 	}
 
+	src, err := newSource()
+	if err != nil {
+		return nil, err
+	}
 	cfg := &Config{}
+	c := &loader{Config: cfg, source: src}
 
-	// Port (optional, default 8080)
-	port, err := strconv.Atoi(getEnv("CANOPY_PORT", "8080"))
+	// Port (default 8080), Listen (e.g. unix:///run/canopy.sock), and
+	// DisableHMAC
+	if err := c.load(cfg); err != nil {
+		return nil, err
+	}
+
+	// LogLevel (optional, default info)
+	logLevel, err := logging.ParseLevel(c.get("CANOPY_LOG_LEVEL", "info"))
 	if err != nil {
-		return nil, fmt.Errorf("invalid CANOPY_PORT: %w", err)
+		return nil, fmt.Errorf("invalid CANOPY_LOG_LEVEL: %w", err)
 	}
-	cfg.Port = port
+	cfg.LogLevel = logLevel
 
-	// DisableHMAC (optional, default false)
-	cfg.DisableHMAC = getEnv("CANOPY_DISABLE_HMAC", "false") == "true"
+	// Metrics port (optional, default: the main port, or 9090 for workers)
+	defaultMetricsPort := "0"
+	if mode == ModeWorker {
+		defaultMetricsPort = strconv.Itoa(DefaultWorkerMetricsPort)
+	}
+	metricsPort, err := strconv.Atoi(c.get("CANOPY_METRICS_PORT", defaultMetricsPort))
+	if err != nil || metricsPort < 0 || metricsPort > 65535 {
+		return nil, fmt.Errorf("invalid CANOPY_METRICS_PORT: must be a port number")
+	}
+	cfg.Metrics.Port = metricsPort
 
 	// Load mode-specific config
 	switch mode {
 	case ModeAllInOne:
-		if err := cfg.loadAllInOneConfig(mode); err != nil {
+		if err := c.loadAllInOneConfig(mode); err != nil {
 			return nil, err
 		}
 	case ModeWebhook:
-		if err := cfg.loadWebhookConfig(mode); err != nil {
+		if err := c.loadWebhookConfig(mode); err != nil {
 			return nil, err
 		}
 	case ModeWorker:
-		if err := cfg.loadWorkerConfig(mode); err != nil {
+		if err := c.loadWorkerConfig(mode); err != nil {
 			return nil, err
 		}
 	case ModeLocal:
@@ -151,9 +461,9 @@ func Load(mode Mode) (*Config, error) {
 }
 
 // loadAllInOneConfig loads config for all-in-one mode
-func (c *Config) loadAllInOneConfig(mode Mode) error {
-	// Queue: in-memory by default, but can use Redis/Pub/Sub
-	queueType := getEnv("CANOPY_QUEUE_TYPE", string(QueueTypeInMemory))
+func (c *loader) loadAllInOneConfig(mode Mode) error {
+	// Queue: in-memory by default, but can use Redis/Pub/Sub/Kafka
+	queueType := c.get("CANOPY_QUEUE_TYPE", string(QueueTypeInMemory))
 	c.Queue.Type = QueueType(queueType)
 
 	switch c.Queue.Type {
@@ -167,6 +477,10 @@ func (c *Config) loadAllInOneConfig(mode Mode) error {
 		if err := c.loadPubSubConfig(mode); err != nil {
 			return err
 		}
+	case QueueTypeKafka:
+		if err := c.loadKafkaConfig(); err != nil {
+			return err
+		}
 	default:
 		return fmt.Errorf("invalid queue type: %s", queueType)
 	}
@@ -181,18 +495,49 @@ func (c *Config) loadAllInOneConfig(mode Mode) error {
 		return err
 	}
 
-	// Webhook settings
+	// GitLab (optional)
+	if err := c.loadGitLabConfig(); err != nil {
+		return err
+	}
+	if c.GitLab.WebhookSecret != "" && c.GitLab.Token == "" {
+		return fmt.Errorf("CANOPY_GITLAB_WEBHOOK_SECRET requires CANOPY_GITLAB_TOKEN")
+	}
+
+	// Worker settings
+	if err := c.loadWorkerSettings(); err != nil {
+		return err
+	}
+
+	// Webhook settings, with the smee.io proxy and the repository sync
+	// (optional, default disabled)
 	if err := c.loadWebhookSettings(); err != nil {
 		return err
 	}
+	if err := c.load(&c.Webhook, "CANOPY_WEBHOOK_PROXY_URL", "CANOPY_WEBHOOK_REPO_SYNC_INTERVAL"); err != nil {
+		return err
+	}
+	if c.Webhook.RepoSyncInterval > 0 && c.GitHub.InstallationID == 0 {
+		return fmt.Errorf("CANOPY_WEBHOOK_REPO_SYNC_INTERVAL requires CANOPY_GITHUB_INSTALLATION_ID")
+	}
 
-	return nil
+	// Query API
+	if err := c.loadAPIConfig(); err != nil {
+		return err
+	}
+
+	// Badges
+	if err := c.loadBadgeConfig(); err != nil {
+		return err
+	}
+
+	// Diff viewer
+	return c.loadViewerConfig()
 }
 
 // loadWebhookConfig loads config for webhook mode
-func (c *Config) loadWebhookConfig(mode Mode) error {
+func (c *loader) loadWebhookConfig(mode Mode) error {
 	// Queue (required)
-	queueType := getEnv("CANOPY_QUEUE_TYPE", "")
+	queueType := c.get("CANOPY_QUEUE_TYPE", "")
 	if queueType == "" {
 		return fmt.Errorf("CANOPY_QUEUE_TYPE is required in webhook mode")
 	}
@@ -207,8 +552,12 @@ func (c *Config) loadWebhookConfig(mode Mode) error {
 		if err := c.loadPubSubConfig(mode); err != nil {
 			return err
 		}
+	case QueueTypeKafka:
+		if err := c.loadKafkaConfig(); err != nil {
+			return err
+		}
 	default:
-		return fmt.Errorf("invalid queue type for webhook: %s (must be redis or pubsub)", queueType)
+		return fmt.Errorf("invalid queue type for webhook: %s (must be redis, pubsub, or kafka)", queueType)
 	}
 
 	// Webhook settings
@@ -216,13 +565,14 @@ func (c *Config) loadWebhookConfig(mode Mode) error {
 		return err
 	}
 
-	return nil
+	// GitLab webhooks (optional)
+	return c.load(&c.GitLab, "CANOPY_GITLAB_WEBHOOK_SECRET")
 }
 
 // loadWorkerConfig loads config for worker mode
-func (c *Config) loadWorkerConfig(mode Mode) error {
+func (c *loader) loadWorkerConfig(mode Mode) error {
 	// Queue (required)
-	queueType := getEnv("CANOPY_QUEUE_TYPE", "")
+	queueType := c.get("CANOPY_QUEUE_TYPE", "")
 	if queueType == "" {
 		return fmt.Errorf("CANOPY_QUEUE_TYPE is required in worker mode")
 	}
@@ -237,8 +587,12 @@ func (c *Config) loadWorkerConfig(mode Mode) error {
 		if err := c.loadPubSubConfig(mode); err != nil {
 			return err
 		}
+	case QueueTypeKafka:
+		if err := c.loadKafkaConfig(); err != nil {
+			return err
+		}
 	default:
-		return fmt.Errorf("invalid queue type for worker: %s (must be redis or pubsub)", queueType)
+		return fmt.Errorf("invalid queue type for worker: %s (must be redis, pubsub, or kafka)", queueType)
 	}
 
 	// Storage (required)
@@ -251,47 +605,227 @@ func (c *Config) loadWorkerConfig(mode Mode) error {
 		return err
 	}
 
+	// GitLab (optional)
+	if err := c.loadGitLabConfig(); err != nil {
+		return err
+	}
+
+	// Worker settings
+	if err := c.loadWorkerSettings(); err != nil {
+		return err
+	}
+
+	// Query API, diff viewer, and badges, whose allowed orgs are those of
+	// the webhook
+	if err := c.loadAPIConfig(); err != nil {
+		return err
+	}
+	if err := c.loadViewerConfig(); err != nil {
+		return err
+	}
+	if err := c.loadBadgeConfig(); err != nil {
+		return err
+	}
+	if c.Badge.Enabled {
+		return c.load(&c.Webhook, "CANOPY_ALLOWED_ORGS")
+	}
+	return nil
+}
+
+// loadAPIConfig loads query API and upload endpoint configuration. The
+// token store uses the same Redis variables as canopy-admin, so tokens it
+// issues are accepted.
+func (c *loader) loadAPIConfig() error {
+	if err := c.load(&c.API, "CANOPY_API_", "CANOPY_UPLOAD_"); err != nil {
+		return err
+	}
+	if !c.API.Enabled && !c.API.UploadEnabled {
+		return nil
+	}
+	return c.load(&c.API, "CANOPY_REDIS_")
+}
+
+// loadBadgeConfig loads coverage badge configuration
+func (c *loader) loadBadgeConfig() error {
+	if err := c.load(&c.Badge); err != nil {
+		return err
+	}
+	c.Badge.Thresholds = badge.DefaultThresholds
+
+	for _, t := range []struct {
+		env   string
+		value *float64
+	}{
+		{"CANOPY_BADGE_GREEN_THRESHOLD", &c.Badge.Thresholds.Green},
+		{"CANOPY_BADGE_YELLOW_THRESHOLD", &c.Badge.Thresholds.Yellow},
+	} {
+		raw := c.get(t.env, "")
+		if raw == "" {
+			continue
+		}
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil || value < 0 || value > 100 {
+			return fmt.Errorf("invalid %s: must be a percentage between 0 and 100", t.env)
+		}
+		*t.value = value
+	}
+	if c.Badge.Thresholds.Yellow > c.Badge.Thresholds.Green {
+		return fmt.Errorf("invalid CANOPY_BADGE_YELLOW_THRESHOLD: must not exceed CANOPY_BADGE_GREEN_THRESHOLD")
+	}
+	return nil
+}
+
+// loadViewerConfig loads diff viewer configuration
+func (c *loader) loadViewerConfig() error {
+	if err := c.load(&c.Viewer); err != nil {
+		return err
+	}
+	if c.Viewer.PublicURL == "" {
+		return nil
+	}
+	if u, err := url.Parse(c.Viewer.PublicURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid CANOPY_PUBLIC_URL %q: expected e.g. https://canopy.example.com", c.Viewer.PublicURL)
+	}
 	return nil
 }
 
 // loadRedisConfig loads Redis queue configuration
-func (c *Config) loadRedisConfig() error {
-	c.Queue.RedisAddr = getEnv("CANOPY_REDIS_ADDR", "localhost:6379")
-	c.Queue.RedisPassword = getEnv("CANOPY_REDIS_PASSWORD", "")
+func (c *loader) loadRedisConfig() error {
+	if err := c.load(&c.Queue, "CANOPY_REDIS_", "CANOPY_QUEUE_MAX_DELIVERIES", "CANOPY_QUEUE_SIGNING_KEY", "CANOPY_QUEUE_ALLOW_UNSIGNED"); err != nil {
+		return err
+	}
+	if c.Queue.RedisDeadLetterStream == "" {
+		c.Queue.RedisDeadLetterStream = c.Queue.RedisStream + ":dead-letter"
+	}
 
-	redisDB, err := strconv.Atoi(getEnv("CANOPY_REDIS_DB", "0"))
+	target, err := strconv.ParseInt(c.get("CANOPY_SCALING_TARGET_PER_WORKER", "10"), 10, 64)
 	if err != nil {
-		return fmt.Errorf("invalid CANOPY_REDIS_DB: %w", err)
+		return fmt.Errorf("invalid CANOPY_SCALING_TARGET_PER_WORKER: %w", err)
+	}
+	minWorkers, err := strconv.Atoi(c.get("CANOPY_SCALING_MIN_WORKERS", "0"))
+	if err != nil {
+		return fmt.Errorf("invalid CANOPY_SCALING_MIN_WORKERS: %w", err)
+	}
+	maxWorkers, err := strconv.Atoi(c.get("CANOPY_SCALING_MAX_WORKERS", "10"))
+	if err != nil {
+		return fmt.Errorf("invalid CANOPY_SCALING_MAX_WORKERS: %w", err)
+	}
+	c.Queue.Scaling = queue.ScalingPolicy{TargetPerWorker: target, MinWorkers: minWorkers, MaxWorkers: maxWorkers}
+	if err := c.Queue.Scaling.Validate(); err != nil {
+		return fmt.Errorf("invalid CANOPY_SCALING_* settings: %w", err)
 	}
-	c.Queue.RedisDB = redisDB
-	c.Queue.RedisStream = getEnv("CANOPY_REDIS_STREAM", "canopy-coverage-requests")
 
 	return nil
 }
 
 // loadPubSubConfig loads Pub/Sub queue configuration
-func (c *Config) loadPubSubConfig(mode Mode) error {
-	c.Queue.PubSubProjectID = getEnv("CANOPY_PUBSUB_PROJECT_ID", "")
+func (c *loader) loadPubSubConfig(mode Mode) error {
+	if err := c.load(&c.Queue, "CANOPY_PUBSUB_PROJECT_ID", "CANOPY_PUBSUB_TOPIC_ID", "CANOPY_QUEUE_SIGNING_KEY", "CANOPY_QUEUE_ALLOW_UNSIGNED"); err != nil {
+		return err
+	}
 	if c.Queue.PubSubProjectID == "" {
 		return fmt.Errorf("CANOPY_PUBSUB_PROJECT_ID is required for pubsub queue")
 	}
 
-	c.Queue.PubSubTopicID = getEnv("CANOPY_PUBSUB_TOPIC_ID", "canopy-coverage-requests")
-
 	// Subscription is only needed for worker/all-in-one
 	if mode == ModeWorker || mode == ModeAllInOne {
-		c.Queue.PubSubSubscription = getEnv("CANOPY_PUBSUB_SUBSCRIPTION", "")
+		if err := c.load(&c.Queue, "CANOPY_PUBSUB_SUBSCRIPTION", "CANOPY_PUBSUB_DEAD_LETTER_", "CANOPY_QUEUE_MAX_DELIVERIES"); err != nil {
+			return err
+		}
 		if c.Queue.PubSubSubscription == "" {
 			return fmt.Errorf("CANOPY_PUBSUB_SUBSCRIPTION is required for worker/all-in-one mode")
 		}
+		if c.Queue.PubSubDeadLetterTopicID == "" {
+			c.Queue.PubSubDeadLetterTopicID = c.Queue.PubSubTopicID + "-dead-letter"
+		}
+		if c.Queue.PubSubDeadLetterSubscription == "" {
+			c.Queue.PubSubDeadLetterSubscription = c.Queue.PubSubSubscription + "-dead-letter"
+		}
+		if c.Queue.MaxDeliveries != 0 && (c.Queue.MaxDeliveries < 5 || c.Queue.MaxDeliveries > 100) {
+			return fmt.Errorf("invalid CANOPY_QUEUE_MAX_DELIVERIES: must be 0 or between 5 and 100 for pubsub queue")
+		}
 	}
 
 	return nil
 }
 
+// loadKafkaConfig loads Kafka queue configuration
+func (c *loader) loadKafkaConfig() error {
+	if err := c.load(&c.Queue, "CANOPY_KAFKA_", "CANOPY_QUEUE_MAX_DELIVERIES", "CANOPY_QUEUE_SIGNING_KEY", "CANOPY_QUEUE_ALLOW_UNSIGNED"); err != nil {
+		return err
+	}
+	if len(c.Queue.KafkaBrokers) == 0 {
+		return fmt.Errorf("CANOPY_KAFKA_BROKERS is required for kafka queue")
+	}
+	if c.Queue.KafkaDeadLetterTopic == "" {
+		c.Queue.KafkaDeadLetterTopic = c.Queue.KafkaTopic + "-dead-letter"
+	}
+	if !c.Queue.KafkaTLS && (c.Queue.KafkaTLSCAFile != "" || c.Queue.KafkaTLSCertFile != "" || c.Queue.KafkaTLSKeyFile != "") {
+		return fmt.Errorf("CANOPY_KAFKA_TLS_CA_FILE, CANOPY_KAFKA_TLS_CERT_FILE, and CANOPY_KAFKA_TLS_KEY_FILE require CANOPY_KAFKA_TLS=true")
+	}
+	if (c.Queue.KafkaTLSCertFile == "") != (c.Queue.KafkaTLSKeyFile == "") {
+		return fmt.Errorf("CANOPY_KAFKA_TLS_CERT_FILE and CANOPY_KAFKA_TLS_KEY_FILE must be set together")
+	}
+	switch c.Queue.KafkaSASLMechanism {
+	case "":
+	case queue.SASLPlain, queue.SASLScramSHA256, queue.SASLScramSHA512:
+		if c.Queue.KafkaSASLUsername == "" {
+			return fmt.Errorf("CANOPY_KAFKA_SASL_USERNAME is required for SASL authentication")
+		}
+	default:
+		return fmt.Errorf("invalid CANOPY_KAFKA_SASL_MECHANISM: %s (must be %s, %s, or %s)",
+			c.Queue.KafkaSASLMechanism, queue.SASLPlain, queue.SASLScramSHA256, queue.SASLScramSHA512)
+	}
+	return nil
+}
+
+// LoadQueue loads only the queue configuration, as workers see it, for
+// tools such as canopy-admin that manage the queue without running a service.
+func LoadQueue() (*QueueConfig, error) {
+	src, err := newSource()
+	if err != nil {
+		return nil, err
+	}
+	c := &loader{Config: &Config{}, source: src}
+	queueType := c.get("CANOPY_QUEUE_TYPE", "")
+	if queueType == "" {
+		return nil, fmt.Errorf("CANOPY_QUEUE_TYPE is required")
+	}
+	c.Queue.Type = QueueType(queueType)
+
+	switch c.Queue.Type {
+	case QueueTypeRedis:
+		err = c.loadRedisConfig()
+	case QueueTypePubSub:
+		err = c.loadPubSubConfig(ModeWorker)
+	case QueueTypeKafka:
+		err = c.loadKafkaConfig()
+	default:
+		err = fmt.Errorf("invalid queue type: %s (must be redis, pubsub, or kafka)", queueType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c.Queue, nil
+}
+
+// LoadStorage loads only the storage backend configuration, for tools
+// such as canopy-admin that use storage without running a service.
+func LoadStorage() (*StorageConfig, error) {
+	src, err := newSource()
+	if err != nil {
+		return nil, err
+	}
+	c := &loader{Config: &Config{}, source: src}
+	if err := c.loadStorageConfig(); err != nil {
+		return nil, err
+	}
+	return &c.Storage, nil
+}
+
 // loadStorageConfig loads storage backend configuration
-func (c *Config) loadStorageConfig() error {
-	storageType := getEnv("CANOPY_STORAGE_TYPE", "")
+func (c *loader) loadStorageConfig() error {
+	storageType := c.get("CANOPY_STORAGE_TYPE", "")
 	if storageType == "" {
 		return fmt.Errorf("CANOPY_STORAGE_TYPE is required")
 	}
@@ -299,87 +833,212 @@ func (c *Config) loadStorageConfig() error {
 
 	switch c.Storage.Type {
 	case StorageTypeGCS:
-		c.Storage.GCSBucket = getEnv("CANOPY_GCS_BUCKET", "")
+		if err := c.load(&c.Storage, "CANOPY_GCS_"); err != nil {
+			return err
+		}
 		if c.Storage.GCSBucket == "" {
 			return fmt.Errorf("CANOPY_GCS_BUCKET is required for gcs storage")
 		}
 	case StorageTypeMinio:
-		c.Storage.MinIOEndpoint = getEnv("CANOPY_MINIO_ENDPOINT", "")
+		if err := c.load(&c.Storage, "CANOPY_MINIO_"); err != nil {
+			return err
+		}
 		if c.Storage.MinIOEndpoint == "" {
 			return fmt.Errorf("CANOPY_MINIO_ENDPOINT is required for minio storage")
 		}
-		c.Storage.MinIOAccessKey = getEnv("CANOPY_MINIO_ACCESS_KEY", "")
 		if c.Storage.MinIOAccessKey == "" {
 			return fmt.Errorf("CANOPY_MINIO_ACCESS_KEY is required for minio storage")
 		}
-		c.Storage.MinIOSecretKey = getEnv("CANOPY_MINIO_SECRET_KEY", "")
 		if c.Storage.MinIOSecretKey == "" {
 			return fmt.Errorf("CANOPY_MINIO_SECRET_KEY is required for minio storage")
 		}
-		c.Storage.MinIOBucket = getEnv("CANOPY_MINIO_BUCKET", "canopy-coverage")
-		c.Storage.MinIOUseSSL = getEnv("CANOPY_MINIO_USE_SSL", "false") == "true"
+	case StorageTypeS3:
+		if err := c.load(&c.Storage, "CANOPY_S3_"); err != nil {
+			return err
+		}
+		if c.Storage.S3Bucket == "" {
+			return fmt.Errorf("CANOPY_S3_BUCKET is required for s3 storage")
+		}
+		if c.Storage.S3Region == "" {
+			c.Storage.S3Region = c.get("AWS_REGION", "")
+		}
+		if c.Storage.S3Region == "" {
+			return fmt.Errorf("CANOPY_S3_REGION (or AWS_REGION) is required for s3 storage")
+		}
+	case StorageTypeFS:
+		if err := c.load(&c.Storage, "CANOPY_FS_"); err != nil {
+			return err
+		}
+		if c.Storage.FSRoot == "" {
+			return fmt.Errorf("CANOPY_FS_ROOT is required for fs storage")
+		}
 	default:
 		return fmt.Errorf("invalid storage type: %s", storageType)
 	}
 
+	// Layout and EncryptionKey (optional)
+	if err := c.load(&c.Storage, "CANOPY_STORAGE_"); err != nil {
+		return err
+	}
+	if _, err := storage.ParseLayout(c.Storage.Layout); err != nil {
+		return fmt.Errorf("CANOPY_STORAGE_LAYOUT: %w", err)
+	}
+	if c.Storage.EncryptionKey != "" {
+		key, err := base64.StdEncoding.DecodeString(c.Storage.EncryptionKey)
+		if err != nil {
+			return fmt.Errorf("CANOPY_STORAGE_ENCRYPTION_KEY must be base64-encoded: %w", err)
+		}
+		if n := len(key); n != 16 && n != 24 && n != 32 {
+			return fmt.Errorf("CANOPY_STORAGE_ENCRYPTION_KEY must decode to 16, 24, or 32 bytes, got %d", n)
+		}
+	}
+
 	return nil
 }
 
-// loadGitHubConfig loads GitHub API configuration
-func (c *Config) loadGitHubConfig() error {
-	appIDStr := getEnv("CANOPY_GITHUB_APP_ID", "")
-	if appIDStr == "" {
+// loadGitHubConfig loads GitHub API configuration. InstallationID is
+// optional: work requests name the installation that delivered their event,
+// and this one serves requests queued without one.
+func (c *loader) loadGitHubConfig() error {
+	if err := c.load(&c.GitHub); err != nil {
+		return err
+	}
+	if c.get("CANOPY_GITHUB_APP_ID", "") == "" {
 		return fmt.Errorf("CANOPY_GITHUB_APP_ID is required")
 	}
-	appID, err := strconv.ParseInt(appIDStr, 10, 64)
+	if c.GitHub.PrivateKey == "" {
+		return fmt.Errorf("CANOPY_GITHUB_PRIVATE_KEY is required")
+	}
+
+	labels, err := github.ParseLabelBands(c.get("CANOPY_COVERAGE_LABELS", ""))
 	if err != nil {
-		return fmt.Errorf("invalid CANOPY_GITHUB_APP_ID: %w", err)
+		return fmt.Errorf("invalid CANOPY_COVERAGE_LABELS: %w", err)
 	}
-	c.GitHub.AppID = appID
+	c.GitHub.CoverageLabels = labels
 
-	installIDStr := getEnv("CANOPY_GITHUB_INSTALLATION_ID", "")
-	if installIDStr == "" {
-		return fmt.Errorf("CANOPY_GITHUB_INSTALLATION_ID is required")
+	return nil
+}
+
+// loadGitLabConfig loads GitLab API configuration
+func (c *loader) loadGitLabConfig() error {
+	if err := c.load(&c.GitLab); err != nil {
+		return err
+	}
+	if c.GitLab.BaseURL == "" {
+		c.GitLab.BaseURL = gitlab.DefaultBaseURL
+	}
+	if u, err := url.Parse(c.GitLab.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid CANOPY_GITLAB_URL %q: expected e.g. https://gitlab.example.com/api/v4", c.GitLab.BaseURL)
 	}
-	installID, err := strconv.ParseInt(installIDStr, 10, 64)
+	return nil
+}
+
+// loadWorkerSettings loads worker processing settings
+func (c *loader) loadWorkerSettings() error {
+	if err := c.load(&c.Worker); err != nil {
+		return err
+	}
+	if c.Worker.Concurrency < 1 {
+		return fmt.Errorf("invalid CANOPY_WORKER_CONCURRENCY: must be at least 1")
+	}
+
+	// ArtifactPatterns (optional, default "coverage*")
+	patterns, err := artifacts.ParsePatterns(c.get("CANOPY_ARTIFACT_PATTERNS", ""))
 	if err != nil {
-		return fmt.Errorf("invalid CANOPY_GITHUB_INSTALLATION_ID: %w", err)
+		return fmt.Errorf("invalid CANOPY_ARTIFACT_PATTERNS: %w", err)
+	}
+	c.Worker.ArtifactPatterns = patterns
+
+	// ExportFormats (optional), comma-separated (e.g. "lcov,cobertura")
+	if formats := c.get("CANOPY_WORKER_EXPORT_FORMATS", ""); formats != "" {
+		for _, name := range strings.Split(formats, ",") {
+			format, err := coverage.ParseExportFormat(strings.TrimSpace(name))
+			if err != nil {
+				return fmt.Errorf("invalid CANOPY_WORKER_EXPORT_FORMATS: %w", err)
+			}
+			if format == coverage.FormatGo {
+				return fmt.Errorf("invalid CANOPY_WORKER_EXPORT_FORMATS: coverage is always saved as %s", coverage.ExportNameGo)
+			}
+			c.Worker.ExportFormats = append(c.Worker.ExportFormats, format)
+		}
 	}
-	c.GitHub.InstallationID = installID
 
-	c.GitHub.PrivateKey = getEnv("CANOPY_GITHUB_PRIVATE_KEY", "")
-	if c.GitHub.PrivateKey == "" {
-		return fmt.Errorf("CANOPY_GITHUB_PRIVATE_KEY is required")
+	// DefaultThresholds (optional), YAML in the shape of the thresholds of
+	// .canopy.yml
+	if thresholds := c.get("CANOPY_WORKER_DEFAULT_THRESHOLDS", ""); thresholds != "" {
+		t, err := repoconfig.ParseThresholds([]byte(thresholds))
+		if err != nil {
+			return fmt.Errorf("invalid CANOPY_WORKER_DEFAULT_THRESHOLDS: %w", err)
+		}
+		c.Worker.DefaultThresholds = &t
+	}
+
+	// MinVersion (optional), checked against the build at startup
+	if c.Worker.MinVersion != "" {
+		if _, err := buildinfo.ParseVersion(c.Worker.MinVersion); err != nil {
+			return fmt.Errorf("invalid CANOPY_MIN_WORKER_VERSION: %w", err)
+		}
 	}
 
 	return nil
 }
 
+// byteUnits are the suffixes accepted by parseByteSize.
+var byteUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"GiB", 1 << 30},
+	{"MiB", 1 << 20},
+	{"KiB", 1 << 10},
+	{"B", 1},
+}
+
+// parseByteSize parses a byte count, optionally with a binary unit suffix
+// (e.g. "512MiB", "2GiB").
+func parseByteSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	unit := int64(1)
+	for _, u := range byteUnits {
+		if strings.HasSuffix(s, u.suffix) {
+			s, unit = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("must be a byte count such as 536870912 or 512MiB")
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("must not be negative")
+	}
+	if n > math.MaxInt64/unit {
+		return 0, fmt.Errorf("too large")
+	}
+	return n * unit, nil
+}
+
 // loadWebhookSettings loads webhook-specific settings
-func (c *Config) loadWebhookSettings() error {
+func (c *loader) loadWebhookSettings() error {
+	if err := c.load(&c.Webhook, "CANOPY_WEBHOOK_SECRET", "CANOPY_ALLOWED_", "CANOPY_WEBHOOK_PULL_REQUEST_EVENTS"); err != nil {
+		return err
+	}
+
 	// Webhook secret (optional if HMAC is disabled)
-	c.Webhook.WebhookSecret = getEnv("CANOPY_WEBHOOK_SECRET", "")
 	if !c.DisableHMAC && c.Webhook.WebhookSecret == "" {
 		return fmt.Errorf("CANOPY_WEBHOOK_SECRET is required when HMAC validation is enabled")
 	}
 
-	// Allowed orgs (required)
-	allowedOrgsStr := getEnv("CANOPY_ALLOWED_ORGS", "")
-	if allowedOrgsStr == "" {
+	// Allowed orgs (required); empty allowed workflows, repos, and branches
+	// allow all
+	if len(c.Webhook.AllowedOrgs) == 0 {
 		return fmt.Errorf("CANOPY_ALLOWED_ORGS is required")
 	}
-	c.Webhook.AllowedOrgs = strings.Split(allowedOrgsStr, ",")
-	for i := range c.Webhook.AllowedOrgs {
-		c.Webhook.AllowedOrgs[i] = strings.TrimSpace(c.Webhook.AllowedOrgs[i])
+	if err := validatePatterns("CANOPY_ALLOWED_REPOS", c.Webhook.AllowedRepos); err != nil {
+		return err
 	}
-
-	// Allowed workflows (optional, empty means all workflows allowed)
-	allowedWorkflowsStr := getEnv("CANOPY_ALLOWED_WORKFLOWS", "")
-	if allowedWorkflowsStr != "" {
-		c.Webhook.AllowedWorkflows = strings.Split(allowedWorkflowsStr, ",")
-		for i := range c.Webhook.AllowedWorkflows {
-			c.Webhook.AllowedWorkflows[i] = strings.TrimSpace(c.Webhook.AllowedWorkflows[i])
-		}
+	if err := validatePatterns("CANOPY_ALLOWED_BRANCHES", c.Webhook.AllowedBranches); err != nil {
+		return err
 	}
 
 	return nil
@@ -401,6 +1060,11 @@ func (c *Config) Validate(mode Mode) error {
 	if c.Port < 1 || c.Port > 65535 {
 		return fmt.Errorf("invalid port: %d (must be between 1 and 65535)", c.Port)
 	}
+	if c.Listen != "" {
+		if _, _, err := server.ParseListen(c.Listen); err != nil {
+			return fmt.Errorf("invalid CANOPY_LISTEN: %w", err)
+		}
+	}
 
 	// Mode-specific validation
 	switch mode {
@@ -454,10 +1118,13 @@ func (c *Config) Validate(mode Mode) error {
 	return nil
 }
 
-// getEnv gets an environment variable with a default value
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// validatePatterns checks that the patterns of a setting are valid
+// path.Match patterns.
+func validatePatterns(key string, patterns []string) error {
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid %s pattern %q: %w", key, p, err)
+		}
 	}
-	return defaultValue
+	return nil
 }
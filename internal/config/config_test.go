@@ -1,11 +1,18 @@
 package config
 
 import (
+	"log/slog"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/badge"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/queue"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/repoconfig"
 )
 
 // Helper function to set up environment variables for tests
@@ -83,6 +90,7 @@ func TestLoad_AllInOneMode_Success(t *testing.T) {
 		"CANOPY_WEBHOOK_SECRET":         "my-secret",
 		"CANOPY_ALLOWED_ORGS":           "my-org,another-org",
 		"CANOPY_ALLOWED_WORKFLOWS":      "CI,Build",
+		"CANOPY_WEBHOOK_PROXY_URL":      "https://smee.io/abc123",
 	})
 	defer cleanup()
 
@@ -101,6 +109,322 @@ func TestLoad_AllInOneMode_Success(t *testing.T) {
 	assert.Equal(t, "my-secret", cfg.Webhook.WebhookSecret)
 	assert.Equal(t, []string{"my-org", "another-org"}, cfg.Webhook.AllowedOrgs)
 	assert.Equal(t, []string{"CI", "Build"}, cfg.Webhook.AllowedWorkflows)
+	assert.Equal(t, "https://smee.io/abc123", cfg.Webhook.ProxyURL)
+}
+
+func TestLoad_AllInOneMode_RepoSyncInterval(t *testing.T) {
+	tests := []struct {
+		name           string
+		value          string
+		installationID string
+		expected       time.Duration
+		errorMsg       string
+	}{
+		{name: "default disabled", installationID: "789012"},
+		{name: "enabled", value: "10m", installationID: "789012", expected: 10 * time.Minute},
+		{name: "invalid", value: "often", installationID: "789012", errorMsg: "invalid CANOPY_WEBHOOK_REPO_SYNC_INTERVAL"},
+		{name: "negative", value: "-1m", installationID: "789012", errorMsg: "invalid CANOPY_WEBHOOK_REPO_SYNC_INTERVAL"},
+		{name: "requires installation", value: "10m", errorMsg: "CANOPY_WEBHOOK_REPO_SYNC_INTERVAL requires CANOPY_GITHUB_INSTALLATION_ID"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := setupEnv(t, map[string]string{
+				"CANOPY_QUEUE_TYPE":                 "inmemory",
+				"CANOPY_STORAGE_TYPE":               "minio",
+				"CANOPY_MINIO_ENDPOINT":             "localhost:9000",
+				"CANOPY_MINIO_ACCESS_KEY":           "minioadmin",
+				"CANOPY_MINIO_SECRET_KEY":           "minioadmin",
+				"CANOPY_GITHUB_APP_ID":              "123456",
+				"CANOPY_GITHUB_INSTALLATION_ID":     tt.installationID,
+				"CANOPY_GITHUB_PRIVATE_KEY":         "test-key",
+				"CANOPY_WEBHOOK_SECRET":             "my-secret",
+				"CANOPY_ALLOWED_ORGS":               "my-org",
+				"CANOPY_WEBHOOK_REPO_SYNC_INTERVAL": tt.value,
+			})
+			defer cleanup()
+
+			cfg, err := Load(ModeAllInOne)
+			if tt.errorMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, cfg.Webhook.RepoSyncInterval)
+		})
+	}
+}
+
+func TestLoad_AllInOneMode_GitLab(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		token    string
+		secret   string
+		expected GitLabConfig
+		errorMsg string
+	}{
+		{name: "default disabled", expected: GitLabConfig{BaseURL: "https://gitlab.com/api/v4"}},
+		{
+			name:     "enabled",
+			url:      "https://gitlab.example.com/api/v4",
+			token:    "glpat-token",
+			secret:   "hook-secret",
+			expected: GitLabConfig{BaseURL: "https://gitlab.example.com/api/v4", Token: "glpat-token", WebhookSecret: "hook-secret"},
+		},
+		{name: "invalid URL", url: "gitlab.example.com", token: "glpat-token", errorMsg: "invalid CANOPY_GITLAB_URL"},
+		{name: "webhook requires token", secret: "hook-secret", errorMsg: "CANOPY_GITLAB_WEBHOOK_SECRET requires CANOPY_GITLAB_TOKEN"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := setupEnv(t, map[string]string{
+				"CANOPY_QUEUE_TYPE":            "inmemory",
+				"CANOPY_STORAGE_TYPE":          "minio",
+				"CANOPY_MINIO_ENDPOINT":        "localhost:9000",
+				"CANOPY_MINIO_ACCESS_KEY":      "minioadmin",
+				"CANOPY_MINIO_SECRET_KEY":      "minioadmin",
+				"CANOPY_GITHUB_APP_ID":         "123456",
+				"CANOPY_GITHUB_PRIVATE_KEY":    "test-key",
+				"CANOPY_WEBHOOK_SECRET":        "my-secret",
+				"CANOPY_ALLOWED_ORGS":          "my-org",
+				"CANOPY_GITLAB_URL":            tt.url,
+				"CANOPY_GITLAB_TOKEN":          tt.token,
+				"CANOPY_GITLAB_WEBHOOK_SECRET": tt.secret,
+			})
+			defer cleanup()
+
+			cfg, err := Load(ModeAllInOne)
+			if tt.errorMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, cfg.GitLab)
+		})
+	}
+}
+
+func TestLoad_AllInOneMode_API(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		expected APIConfig
+		errorMsg string
+	}{
+		{name: "default disabled"},
+		{
+			name:     "enabled with default token store",
+			env:      map[string]string{"CANOPY_API_ENABLED": "true"},
+			expected: APIConfig{Enabled: true, RedisAddr: "localhost:6379"},
+		},
+		{
+			name: "enabled with token store",
+			env: map[string]string{
+				"CANOPY_API_ENABLED":    "true",
+				"CANOPY_REDIS_ADDR":     "redis:6379",
+				"CANOPY_REDIS_PASSWORD": "secret",
+				"CANOPY_REDIS_DB":       "2",
+			},
+			expected: APIConfig{Enabled: true, RedisAddr: "redis:6379", RedisPassword: "secret", RedisDB: 2},
+		},
+		{
+			name:     "upload endpoint only",
+			env:      map[string]string{"CANOPY_UPLOAD_ENABLED": "true"},
+			expected: APIConfig{UploadEnabled: true, RedisAddr: "localhost:6379"},
+		},
+		{
+			name:     "invalid database",
+			env:      map[string]string{"CANOPY_API_ENABLED": "true", "CANOPY_REDIS_DB": "first"},
+			errorMsg: "invalid CANOPY_REDIS_DB",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{
+				"CANOPY_QUEUE_TYPE":             "inmemory",
+				"CANOPY_STORAGE_TYPE":           "minio",
+				"CANOPY_MINIO_ENDPOINT":         "localhost:9000",
+				"CANOPY_MINIO_ACCESS_KEY":       "minioadmin",
+				"CANOPY_MINIO_SECRET_KEY":       "minioadmin",
+				"CANOPY_GITHUB_APP_ID":          "123456",
+				"CANOPY_GITHUB_INSTALLATION_ID": "789012",
+				"CANOPY_GITHUB_PRIVATE_KEY":     "test-key",
+				"CANOPY_WEBHOOK_SECRET":         "my-secret",
+				"CANOPY_ALLOWED_ORGS":           "my-org",
+			}
+			for k, v := range tt.env {
+				env[k] = v
+			}
+			cleanup := setupEnv(t, env)
+			defer cleanup()
+
+			cfg, err := Load(ModeAllInOne)
+			if tt.errorMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, cfg.API)
+		})
+	}
+}
+
+func TestLoad_AllInOneMode_Badge(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		expected BadgeConfig
+		errorMsg string
+	}{
+		{name: "default disabled", expected: BadgeConfig{Thresholds: badge.DefaultThresholds}},
+		{
+			name:     "enabled",
+			env:      map[string]string{"CANOPY_BADGE_ENABLED": "true"},
+			expected: BadgeConfig{Enabled: true, Thresholds: badge.DefaultThresholds},
+		},
+		{
+			name: "custom thresholds",
+			env: map[string]string{
+				"CANOPY_BADGE_ENABLED":          "true",
+				"CANOPY_BADGE_GREEN_THRESHOLD":  "90",
+				"CANOPY_BADGE_YELLOW_THRESHOLD": "75.5",
+			},
+			expected: BadgeConfig{Enabled: true, Thresholds: badge.Thresholds{Green: 90, Yellow: 75.5}},
+		},
+		{
+			name:     "invalid threshold",
+			env:      map[string]string{"CANOPY_BADGE_GREEN_THRESHOLD": "high"},
+			errorMsg: "invalid CANOPY_BADGE_GREEN_THRESHOLD",
+		},
+		{
+			name:     "threshold out of range",
+			env:      map[string]string{"CANOPY_BADGE_YELLOW_THRESHOLD": "120"},
+			errorMsg: "invalid CANOPY_BADGE_YELLOW_THRESHOLD",
+		},
+		{
+			name:     "yellow above green",
+			env:      map[string]string{"CANOPY_BADGE_GREEN_THRESHOLD": "50"},
+			errorMsg: "must not exceed CANOPY_BADGE_GREEN_THRESHOLD",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{
+				"CANOPY_QUEUE_TYPE":             "inmemory",
+				"CANOPY_STORAGE_TYPE":           "minio",
+				"CANOPY_MINIO_ENDPOINT":         "localhost:9000",
+				"CANOPY_MINIO_ACCESS_KEY":       "minioadmin",
+				"CANOPY_MINIO_SECRET_KEY":       "minioadmin",
+				"CANOPY_GITHUB_APP_ID":          "123456",
+				"CANOPY_GITHUB_INSTALLATION_ID": "789012",
+				"CANOPY_GITHUB_PRIVATE_KEY":     "test-key",
+				"CANOPY_WEBHOOK_SECRET":         "my-secret",
+				"CANOPY_ALLOWED_ORGS":           "my-org",
+			}
+			for k, v := range tt.env {
+				env[k] = v
+			}
+			cleanup := setupEnv(t, env)
+			defer cleanup()
+
+			cfg, err := Load(ModeAllInOne)
+			if tt.errorMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, cfg.Badge)
+		})
+	}
+}
+
+func TestLoad_LogLevel(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected slog.Level
+		errorMsg string
+	}{
+		{name: "default info", expected: slog.LevelInfo},
+		{name: "debug", value: "debug", expected: slog.LevelDebug},
+		{name: "error", value: "ERROR", expected: slog.LevelError},
+		{name: "invalid", value: "loud", errorMsg: "invalid CANOPY_LOG_LEVEL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := setupEnv(t, map[string]string{
+				"CANOPY_QUEUE_TYPE":     "redis",
+				"CANOPY_REDIS_ADDR":     "localhost:6379",
+				"CANOPY_WEBHOOK_SECRET": "my-secret",
+				"CANOPY_ALLOWED_ORGS":   "my-org",
+				"CANOPY_LOG_LEVEL":      tt.value,
+			})
+			defer cleanup()
+
+			cfg, err := Load(ModeWebhook)
+			if tt.errorMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, cfg.LogLevel)
+		})
+	}
+}
+
+func TestLoad_MetricsPort(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     Mode
+		value    string
+		expected int
+		errorMsg string
+	}{
+		{name: "all-in-one serves on the main port", mode: ModeAllInOne, expected: 0},
+		{name: "worker default", mode: ModeWorker, expected: DefaultWorkerMetricsPort},
+		{name: "separate port", mode: ModeAllInOne, value: "9102", expected: 9102},
+		{name: "worker on its own port", mode: ModeWorker, value: "9300", expected: 9300},
+		{name: "invalid", mode: ModeAllInOne, value: "metrics", errorMsg: "invalid CANOPY_METRICS_PORT"},
+		{name: "out of range", mode: ModeWorker, value: "70000", errorMsg: "invalid CANOPY_METRICS_PORT"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := setupEnv(t, map[string]string{
+				"CANOPY_QUEUE_TYPE":             "redis",
+				"CANOPY_REDIS_ADDR":             "localhost:6379",
+				"CANOPY_STORAGE_TYPE":           "minio",
+				"CANOPY_MINIO_ENDPOINT":         "localhost:9000",
+				"CANOPY_MINIO_ACCESS_KEY":       "minioadmin",
+				"CANOPY_MINIO_SECRET_KEY":       "minioadmin",
+				"CANOPY_GITHUB_APP_ID":          "123456",
+				"CANOPY_GITHUB_INSTALLATION_ID": "789012",
+				"CANOPY_GITHUB_PRIVATE_KEY":     "test-key",
+				"CANOPY_WEBHOOK_SECRET":         "my-secret",
+				"CANOPY_ALLOWED_ORGS":           "my-org",
+				"CANOPY_METRICS_PORT":           tt.value,
+			})
+			defer cleanup()
+
+			cfg, err := Load(tt.mode)
+			if tt.errorMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, cfg.Metrics.Port)
+		})
+	}
 }
 
 func TestLoad_AllInOneMode_WithRedis(t *testing.T) {
@@ -132,6 +456,61 @@ func TestLoad_AllInOneMode_WithRedis(t *testing.T) {
 	assert.Equal(t, "password", cfg.Queue.RedisPassword)
 	assert.Equal(t, 1, cfg.Queue.RedisDB)
 	assert.Equal(t, "my-stream", cfg.Queue.RedisStream)
+	assert.Equal(t, "canopy-workers", cfg.Queue.RedisConsumerGroup)
+	assert.Equal(t, queue.ScalingPolicy{TargetPerWorker: 10, MinWorkers: 0, MaxWorkers: 10}, cfg.Queue.Scaling)
+}
+
+func TestLoad_WebhookMode_RedisScaling(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		expected queue.ScalingPolicy
+		errorMsg string
+	}{
+		{
+			name: "custom policy",
+			env: map[string]string{
+				"CANOPY_SCALING_TARGET_PER_WORKER": "25",
+				"CANOPY_SCALING_MIN_WORKERS":       "1",
+				"CANOPY_SCALING_MAX_WORKERS":       "8",
+			},
+			expected: queue.ScalingPolicy{TargetPerWorker: 25, MinWorkers: 1, MaxWorkers: 8},
+		},
+		{
+			name:     "invalid number",
+			env:      map[string]string{"CANOPY_SCALING_MAX_WORKERS": "many"},
+			errorMsg: "invalid CANOPY_SCALING_MAX_WORKERS",
+		},
+		{
+			name:     "invalid policy",
+			env:      map[string]string{"CANOPY_SCALING_MIN_WORKERS": "5", "CANOPY_SCALING_MAX_WORKERS": "2"},
+			errorMsg: "max workers must be positive and at least min workers",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{
+				"CANOPY_QUEUE_TYPE":     "redis",
+				"CANOPY_WEBHOOK_SECRET": "my-secret",
+				"CANOPY_ALLOWED_ORGS":   "my-org",
+			}
+			for k, v := range tt.env {
+				env[k] = v
+			}
+			cleanup := setupEnv(t, env)
+			defer cleanup()
+
+			cfg, err := Load(ModeWebhook)
+			if tt.errorMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, cfg.Queue.Scaling)
+		})
+	}
 }
 
 func TestLoad_AllInOneMode_WithPubSub(t *testing.T) {
@@ -159,6 +538,8 @@ func TestLoad_AllInOneMode_WithPubSub(t *testing.T) {
 	assert.Equal(t, "my-project", cfg.Queue.PubSubProjectID)
 	assert.Equal(t, "my-topic", cfg.Queue.PubSubTopicID)
 	assert.Equal(t, "my-subscription", cfg.Queue.PubSubSubscription)
+	assert.Equal(t, "my-topic-dead-letter", cfg.Queue.PubSubDeadLetterTopicID)
+	assert.Equal(t, "my-subscription-dead-letter", cfg.Queue.PubSubDeadLetterSubscription)
 	assert.Equal(t, StorageTypeGCS, cfg.Storage.Type)
 	assert.Equal(t, "my-bucket", cfg.Storage.GCSBucket)
 }
@@ -184,6 +565,82 @@ func TestLoad_WebhookMode_Success(t *testing.T) {
 	assert.Equal(t, "my-org", cfg.Webhook.AllowedOrgs[0])
 }
 
+func TestLoad_WebhookMode_AllowedPatterns(t *testing.T) {
+	tests := []struct {
+		name             string
+		repos            string
+		branches         string
+		expectedRepos    []string
+		expectedBranches []string
+		errorMsg         string
+	}{
+		{name: "default all allowed"},
+		{
+			name:             "patterns",
+			repos:            "grafana/loki, grafana/*-operator",
+			branches:         "main,release-*",
+			expectedRepos:    []string{"grafana/loki", "grafana/*-operator"},
+			expectedBranches: []string{"main", "release-*"},
+		},
+		{name: "invalid repo pattern", repos: "grafana/[loki", errorMsg: `invalid CANOPY_ALLOWED_REPOS pattern "grafana/[loki"`},
+		{name: "invalid branch pattern", branches: `release-\`, errorMsg: "invalid CANOPY_ALLOWED_BRANCHES pattern"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := setupEnv(t, map[string]string{
+				"CANOPY_QUEUE_TYPE":        "pubsub",
+				"CANOPY_PUBSUB_PROJECT_ID": "my-project",
+				"CANOPY_PUBSUB_TOPIC_ID":   "my-topic",
+				"CANOPY_WEBHOOK_SECRET":    "my-secret",
+				"CANOPY_ALLOWED_ORGS":      "grafana",
+				"CANOPY_ALLOWED_REPOS":     tt.repos,
+				"CANOPY_ALLOWED_BRANCHES":  tt.branches,
+			})
+			defer cleanup()
+
+			cfg, err := Load(ModeWebhook)
+			if tt.errorMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedRepos, cfg.Webhook.AllowedRepos)
+			assert.Equal(t, tt.expectedBranches, cfg.Webhook.AllowedBranches)
+		})
+	}
+}
+
+func TestLoad_WebhookMode_PullRequestEvents(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected bool
+	}{
+		{name: "default disabled", expected: false},
+		{name: "enabled", value: "true", expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := setupEnv(t, map[string]string{
+				"CANOPY_QUEUE_TYPE":                  "pubsub",
+				"CANOPY_PUBSUB_PROJECT_ID":           "my-project",
+				"CANOPY_PUBSUB_TOPIC_ID":             "my-topic",
+				"CANOPY_WEBHOOK_SECRET":              "my-secret",
+				"CANOPY_ALLOWED_ORGS":                "my-org",
+				"CANOPY_WEBHOOK_PULL_REQUEST_EVENTS": tt.value,
+			})
+			defer cleanup()
+
+			cfg, err := Load(ModeWebhook)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, cfg.Webhook.PullRequestEvents)
+		})
+	}
+}
+
 func TestLoad_WebhookMode_MissingQueueType(t *testing.T) {
 	cleanup := setupEnv(t, map[string]string{
 
@@ -305,6 +762,46 @@ func TestLoad_WorkerMode_MissingGitHub(t *testing.T) {
 	assert.Contains(t, err.Error(), "CANOPY_GITHUB_APP_ID is required")
 }
 
+func TestLoad_WorkerMode_InstallationID(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected int64
+		errorMsg string
+	}{
+		{name: "no default installation", expected: 0},
+		{name: "default installation", value: "789012", expected: 789012},
+		{name: "invalid", value: "org", errorMsg: "invalid CANOPY_GITHUB_INSTALLATION_ID"},
+		{name: "negative", value: "-1", errorMsg: "must not be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := setupEnv(t, map[string]string{
+				"CANOPY_QUEUE_TYPE":             "redis",
+				"CANOPY_REDIS_ADDR":             "localhost:6379",
+				"CANOPY_STORAGE_TYPE":           "minio",
+				"CANOPY_MINIO_ENDPOINT":         "localhost:9000",
+				"CANOPY_MINIO_ACCESS_KEY":       "minioadmin",
+				"CANOPY_MINIO_SECRET_KEY":       "minioadmin",
+				"CANOPY_GITHUB_APP_ID":          "123456",
+				"CANOPY_GITHUB_INSTALLATION_ID": tt.value,
+				"CANOPY_GITHUB_PRIVATE_KEY":     "test-key",
+			})
+			defer cleanup()
+
+			cfg, err := Load(ModeWorker)
+			if tt.errorMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, cfg.GitHub.InstallationID)
+		})
+	}
+}
+
 func TestLoad_WorkerMode_InMemoryQueueNotAllowed(t *testing.T) {
 	cleanup := setupEnv(t, map[string]string{
 
@@ -389,6 +886,48 @@ func TestLoad_CustomPort(t *testing.T) {
 	assert.Equal(t, 9090, cfg.Port)
 }
 
+func TestLoad_Listen(t *testing.T) {
+	tests := []struct {
+		name        string
+		listen      string
+		expectError bool
+	}{
+		{name: "unset", listen: ""},
+		{name: "unix socket", listen: "unix:///run/canopy.sock"},
+		{name: "tcp address", listen: "tcp://127.0.0.1:8080"},
+		{name: "missing scheme", listen: "/run/canopy.sock", expectError: true},
+		{name: "unsupported scheme", listen: "udp://:8080", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := setupEnv(t, map[string]string{
+				"CANOPY_LISTEN":                 tt.listen,
+				"CANOPY_QUEUE_TYPE":             "inmemory",
+				"CANOPY_STORAGE_TYPE":           "minio",
+				"CANOPY_MINIO_ENDPOINT":         "localhost:9000",
+				"CANOPY_MINIO_ACCESS_KEY":       "minioadmin",
+				"CANOPY_MINIO_SECRET_KEY":       "minioadmin",
+				"CANOPY_GITHUB_APP_ID":          "123456",
+				"CANOPY_GITHUB_INSTALLATION_ID": "789012",
+				"CANOPY_GITHUB_PRIVATE_KEY":     "test-key",
+				"CANOPY_WEBHOOK_SECRET":         "my-secret",
+				"CANOPY_ALLOWED_ORGS":           "my-org",
+			})
+			defer cleanup()
+
+			cfg, err := Load(ModeAllInOne)
+			if tt.expectError {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "invalid CANOPY_LISTEN")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.listen, cfg.Listen)
+		})
+	}
+}
+
 func TestValidate_InvalidPort(t *testing.T) {
 	tests := []struct {
 		name string
@@ -518,6 +1057,100 @@ func TestLoad_PubSubMissingSubscriptionForWorker(t *testing.T) {
 	assert.Contains(t, err.Error(), "CANOPY_PUBSUB_SUBSCRIPTION is required")
 }
 
+func TestLoad_WorkerMode_WithKafka(t *testing.T) {
+	cleanup := setupEnv(t, map[string]string{
+
+		"CANOPY_QUEUE_TYPE":             "kafka",
+		"CANOPY_KAFKA_BROKERS":          "kafka-1:9092, kafka-2:9092",
+		"CANOPY_KAFKA_TLS":              "true",
+		"CANOPY_KAFKA_TLS_CA_FILE":      "/etc/kafka/ca.pem",
+		"CANOPY_KAFKA_SASL_MECHANISM":   "SCRAM-SHA-512",
+		"CANOPY_KAFKA_SASL_USERNAME":    "canopy",
+		"CANOPY_KAFKA_SASL_PASSWORD":    "secret",
+		"CANOPY_STORAGE_TYPE":           "gcs",
+		"CANOPY_GCS_BUCKET":             "my-bucket",
+		"CANOPY_GITHUB_APP_ID":          "123456",
+		"CANOPY_GITHUB_INSTALLATION_ID": "789012",
+		"CANOPY_GITHUB_PRIVATE_KEY":     "test-key",
+	})
+	defer cleanup()
+
+	cfg, err := Load(ModeWorker)
+	require.NoError(t, err)
+	require.NotNil(t, cfg)
+
+	assert.Equal(t, QueueTypeKafka, cfg.Queue.Type)
+	assert.Equal(t, []string{"kafka-1:9092", "kafka-2:9092"}, cfg.Queue.KafkaBrokers)
+	assert.Equal(t, "canopy-coverage-requests", cfg.Queue.KafkaTopic)
+	assert.Equal(t, "canopy-workers", cfg.Queue.KafkaConsumerGroup)
+	assert.Equal(t, "canopy-coverage-requests-dead-letter", cfg.Queue.KafkaDeadLetterTopic)
+	assert.Equal(t, 5, cfg.Queue.MaxDeliveries)
+	assert.True(t, cfg.Queue.KafkaTLS)
+	assert.Equal(t, "/etc/kafka/ca.pem", cfg.Queue.KafkaTLSCAFile)
+	assert.Equal(t, "SCRAM-SHA-512", cfg.Queue.KafkaSASLMechanism)
+	assert.Equal(t, "canopy", cfg.Queue.KafkaSASLUsername)
+	assert.Equal(t, "secret", cfg.Queue.KafkaSASLPassword)
+}
+
+func TestLoad_KafkaSecurityErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		errorMsg string
+	}{
+		{
+			name:     "CA file without TLS",
+			env:      map[string]string{"CANOPY_KAFKA_TLS_CA_FILE": "/etc/kafka/ca.pem"},
+			errorMsg: "require CANOPY_KAFKA_TLS=true",
+		},
+		{
+			name:     "certificate without key",
+			env:      map[string]string{"CANOPY_KAFKA_TLS": "true", "CANOPY_KAFKA_TLS_CERT_FILE": "/etc/kafka/client.pem"},
+			errorMsg: "CANOPY_KAFKA_TLS_CERT_FILE and CANOPY_KAFKA_TLS_KEY_FILE must be set together",
+		},
+		{
+			name:     "unsupported mechanism",
+			env:      map[string]string{"CANOPY_KAFKA_SASL_MECHANISM": "GSSAPI", "CANOPY_KAFKA_SASL_USERNAME": "canopy"},
+			errorMsg: "invalid CANOPY_KAFKA_SASL_MECHANISM: GSSAPI (must be PLAIN, SCRAM-SHA-256, or SCRAM-SHA-512)",
+		},
+		{
+			name:     "missing username",
+			env:      map[string]string{"CANOPY_KAFKA_SASL_MECHANISM": "PLAIN"},
+			errorMsg: "CANOPY_KAFKA_SASL_USERNAME is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CANOPY_QUEUE_TYPE", "kafka")
+			t.Setenv("CANOPY_KAFKA_BROKERS", "localhost:9092")
+			t.Setenv("CANOPY_WEBHOOK_SECRET", "my-secret")
+			t.Setenv("CANOPY_ALLOWED_ORGS", "my-org")
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			_, err := Load(ModeWebhook)
+			assert.ErrorContains(t, err, tt.errorMsg)
+		})
+	}
+}
+
+func TestLoad_KafkaMissingBrokers(t *testing.T) {
+	cleanup := setupEnv(t, map[string]string{
+
+		"CANOPY_QUEUE_TYPE":     "kafka",
+		"CANOPY_WEBHOOK_SECRET": "my-secret",
+		"CANOPY_ALLOWED_ORGS":   "my-org",
+	})
+	defer cleanup()
+
+	cfg, err := Load(ModeWebhook)
+	assert.Error(t, err)
+	assert.Nil(t, cfg)
+	assert.Contains(t, err.Error(), "CANOPY_KAFKA_BROKERS is required")
+}
+
 func TestLoad_MinIODefaultBucket(t *testing.T) {
 	cleanup := setupEnv(t, map[string]string{
 
@@ -597,11 +1230,70 @@ func TestLoad_RedisDefaults(t *testing.T) {
 	assert.Equal(t, "", cfg.Queue.RedisPassword)
 	assert.Equal(t, 0, cfg.Queue.RedisDB)
 	assert.Equal(t, "canopy-coverage-requests", cfg.Queue.RedisStream)
+	assert.Equal(t, "canopy-coverage-requests:dead-letter", cfg.Queue.RedisDeadLetterStream)
+	assert.Equal(t, 5*time.Minute, cfg.Queue.RedisRetryAfter)
+	assert.Equal(t, 5, cfg.Queue.MaxDeliveries)
 }
 
-func TestLoad_GCSMissingBucket(t *testing.T) {
-	cleanup := setupEnv(t, map[string]string{
-
+func TestLoad_QueueMaxDeliveries(t *testing.T) {
+	tests := []struct {
+		name      string
+		queueType string
+		value     string
+		expected  int
+		errorMsg  string
+	}{
+		{name: "redis default", queueType: "redis", expected: 5},
+		{name: "redis disabled", queueType: "redis", value: "0", expected: 0},
+		{name: "redis custom", queueType: "redis", value: "2", expected: 2},
+		{name: "redis negative", queueType: "redis", value: "-1", errorMsg: "must not be negative"},
+		{name: "invalid", queueType: "redis", value: "often", errorMsg: "invalid CANOPY_QUEUE_MAX_DELIVERIES"},
+		{name: "pubsub custom", queueType: "pubsub", value: "20", expected: 20},
+		{name: "pubsub disabled", queueType: "pubsub", value: "0", expected: 0},
+		{name: "pubsub too few", queueType: "pubsub", value: "2", errorMsg: "must be 0 or between 5 and 100"},
+		{name: "pubsub too many", queueType: "pubsub", value: "101", errorMsg: "must be 0 or between 5 and 100"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CANOPY_QUEUE_TYPE", tt.queueType)
+			t.Setenv("CANOPY_QUEUE_MAX_DELIVERIES", tt.value)
+			t.Setenv("CANOPY_PUBSUB_PROJECT_ID", "my-project")
+			t.Setenv("CANOPY_PUBSUB_TOPIC_ID", "my-topic")
+			t.Setenv("CANOPY_PUBSUB_SUBSCRIPTION", "my-subscription")
+
+			cfg, err := LoadQueue()
+			if tt.errorMsg != "" {
+				assert.ErrorContains(t, err, tt.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, cfg.MaxDeliveries)
+		})
+	}
+}
+
+func TestLoad_QueueSigningKeys(t *testing.T) {
+	for _, queueType := range []string{"redis", "pubsub", "kafka"} {
+		t.Run(queueType, func(t *testing.T) {
+			t.Setenv("CANOPY_QUEUE_TYPE", queueType)
+			t.Setenv("CANOPY_PUBSUB_PROJECT_ID", "my-project")
+			t.Setenv("CANOPY_PUBSUB_SUBSCRIPTION", "my-subscription")
+			t.Setenv("CANOPY_KAFKA_BROKERS", "localhost:9092")
+			t.Setenv("CANOPY_QUEUE_SIGNING_KEY", "new-key, old-key")
+			t.Setenv("CANOPY_QUEUE_ALLOW_UNSIGNED", "true")
+
+			cfg, err := LoadQueue()
+			require.NoError(t, err)
+			assert.Equal(t, []string{"new-key", "old-key"}, cfg.SigningKeys)
+			assert.True(t, cfg.AllowUnsigned)
+		})
+	}
+}
+
+func TestLoad_GCSMissingBucket(t *testing.T) {
+	cleanup := setupEnv(t, map[string]string{
+
 		"CANOPY_QUEUE_TYPE":             "redis",
 		"CANOPY_REDIS_ADDR":             "localhost:6379",
 		"CANOPY_STORAGE_TYPE":           "gcs",
@@ -740,3 +1432,983 @@ func TestFlagPrecedence_MultipleFlags(t *testing.T) {
 	assert.Equal(t, 3000, cfg.Port, "port flag should override env var")
 	assert.True(t, cfg.DisableHMAC, "disable-hmac flag should override env var")
 }
+
+func TestLoad_WorkerMode_StorageEncryptionKey(t *testing.T) {
+	tests := []struct {
+		name           string
+		key            string
+		allowPlaintext string
+		errorMsg       string
+	}{
+		{
+			name: "valid 256-bit key",
+			key:  "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=",
+		},
+		{
+			name:           "migrating plaintext coverage",
+			key:            "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=",
+			allowPlaintext: "true",
+		},
+		{
+			name:     "not base64",
+			key:      "not-base64!!",
+			errorMsg: "must be base64-encoded",
+		},
+		{
+			name:     "wrong length",
+			key:      "c2hvcnQ=",
+			errorMsg: "must decode to 16, 24, or 32 bytes",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := setupEnv(t, map[string]string{
+				"CANOPY_QUEUE_TYPE":                         "redis",
+				"CANOPY_REDIS_ADDR":                         "localhost:6379",
+				"CANOPY_STORAGE_TYPE":                       "minio",
+				"CANOPY_MINIO_ENDPOINT":                     "localhost:9000",
+				"CANOPY_MINIO_ACCESS_KEY":                   "minioadmin",
+				"CANOPY_MINIO_SECRET_KEY":                   "minioadmin",
+				"CANOPY_STORAGE_ENCRYPTION_KEY":             tt.key,
+				"CANOPY_GITHUB_APP_ID":                      "123456",
+				"CANOPY_GITHUB_INSTALLATION_ID":             "789012",
+				"CANOPY_GITHUB_PRIVATE_KEY":                 "test-key",
+				"CANOPY_STORAGE_ENCRYPTION_ALLOW_PLAINTEXT": tt.allowPlaintext,
+			})
+			defer cleanup()
+
+			cfg, err := Load(ModeWorker)
+			if tt.errorMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.key, cfg.Storage.EncryptionKey)
+			assert.Equal(t, tt.allowPlaintext == "true", cfg.Storage.EncryptionAllowPlaintext)
+		})
+	}
+}
+
+func TestLoad_WorkerMode_StorageLayout(t *testing.T) {
+	tests := []struct {
+		name     string
+		layout   string
+		errorMsg string
+	}{
+		{name: "default", layout: ""},
+		{name: "hashed", layout: "hashed"},
+		{name: "commit", layout: "commit"},
+		{name: "invalid", layout: "sharded", errorMsg: "invalid storage layout"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := setupEnv(t, map[string]string{
+				"CANOPY_QUEUE_TYPE":             "redis",
+				"CANOPY_REDIS_ADDR":             "localhost:6379",
+				"CANOPY_STORAGE_TYPE":           "minio",
+				"CANOPY_MINIO_ENDPOINT":         "localhost:9000",
+				"CANOPY_MINIO_ACCESS_KEY":       "minioadmin",
+				"CANOPY_MINIO_SECRET_KEY":       "minioadmin",
+				"CANOPY_STORAGE_LAYOUT":         tt.layout,
+				"CANOPY_GITHUB_APP_ID":          "123456",
+				"CANOPY_GITHUB_INSTALLATION_ID": "789012",
+				"CANOPY_GITHUB_PRIVATE_KEY":     "test-key",
+			})
+			defer cleanup()
+
+			cfg, err := Load(ModeWorker)
+			if tt.errorMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.layout, cfg.Storage.Layout)
+		})
+	}
+}
+
+func TestLoad_WorkerMode_CoverageLabels(t *testing.T) {
+	baseEnv := map[string]string{
+		"CANOPY_QUEUE_TYPE":             "redis",
+		"CANOPY_REDIS_ADDR":             "localhost:6379",
+		"CANOPY_STORAGE_TYPE":           "minio",
+		"CANOPY_MINIO_ENDPOINT":         "localhost:9000",
+		"CANOPY_MINIO_ACCESS_KEY":       "minioadmin",
+		"CANOPY_MINIO_SECRET_KEY":       "minioadmin",
+		"CANOPY_GITHUB_APP_ID":          "123456",
+		"CANOPY_GITHUB_INSTALLATION_ID": "789012",
+		"CANOPY_GITHUB_PRIVATE_KEY":     "test-key",
+	}
+
+	t.Run("valid bands", func(t *testing.T) {
+		baseEnv["CANOPY_COVERAGE_LABELS"] = "coverage: excellent=90,needs-tests=0-50"
+		cleanup := setupEnv(t, baseEnv)
+		defer cleanup()
+
+		cfg, err := Load(ModeWorker)
+		require.NoError(t, err)
+		require.Len(t, cfg.GitHub.CoverageLabels, 2)
+		assert.Equal(t, "coverage: excellent", cfg.GitHub.CoverageLabels[0].Label)
+		assert.Equal(t, float64(50), cfg.GitHub.CoverageLabels[1].Max)
+	})
+
+	t.Run("invalid bands", func(t *testing.T) {
+		baseEnv["CANOPY_COVERAGE_LABELS"] = "needs-tests"
+		cleanup := setupEnv(t, baseEnv)
+		defer cleanup()
+
+		cfg, err := Load(ModeWorker)
+		assert.Error(t, err)
+		assert.Nil(t, cfg)
+		assert.Contains(t, err.Error(), "invalid CANOPY_COVERAGE_LABELS")
+	})
+}
+
+func TestLoad_WorkerMode_MaxRunAge(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected time.Duration
+		errorMsg string
+	}{
+		{name: "default disabled", expected: 0},
+		{name: "custom deadline", value: "72h", expected: 72 * time.Hour},
+		{name: "invalid duration", value: "3 days", errorMsg: "invalid CANOPY_WORKER_MAX_RUN_AGE"},
+		{name: "negative duration", value: "-1h", errorMsg: "must not be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := setupEnv(t, map[string]string{
+				"CANOPY_QUEUE_TYPE":             "redis",
+				"CANOPY_REDIS_ADDR":             "localhost:6379",
+				"CANOPY_STORAGE_TYPE":           "minio",
+				"CANOPY_MINIO_ENDPOINT":         "localhost:9000",
+				"CANOPY_MINIO_ACCESS_KEY":       "minioadmin",
+				"CANOPY_MINIO_SECRET_KEY":       "minioadmin",
+				"CANOPY_GITHUB_APP_ID":          "123456",
+				"CANOPY_GITHUB_INSTALLATION_ID": "789012",
+				"CANOPY_GITHUB_PRIVATE_KEY":     "test-key",
+				"CANOPY_WORKER_MAX_RUN_AGE":     tt.value,
+			})
+			defer cleanup()
+
+			cfg, err := Load(ModeWorker)
+			if tt.errorMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, cfg.Worker.MaxRunAge)
+		})
+	}
+}
+
+func TestLoad_WorkerMode_DrainTimeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected time.Duration
+		errorMsg string
+	}{
+		{name: "default", expected: DefaultDrainTimeout},
+		{name: "custom timeout", value: "2m", expected: 2 * time.Minute},
+		{name: "no draining", value: "0s", expected: 0},
+		{name: "invalid duration", value: "soon", errorMsg: "invalid CANOPY_WORKER_DRAIN_TIMEOUT"},
+		{name: "negative duration", value: "-1s", errorMsg: "must not be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := setupEnv(t, map[string]string{
+				"CANOPY_QUEUE_TYPE":             "redis",
+				"CANOPY_REDIS_ADDR":             "localhost:6379",
+				"CANOPY_STORAGE_TYPE":           "minio",
+				"CANOPY_MINIO_ENDPOINT":         "localhost:9000",
+				"CANOPY_MINIO_ACCESS_KEY":       "minioadmin",
+				"CANOPY_MINIO_SECRET_KEY":       "minioadmin",
+				"CANOPY_GITHUB_APP_ID":          "123456",
+				"CANOPY_GITHUB_INSTALLATION_ID": "789012",
+				"CANOPY_GITHUB_PRIVATE_KEY":     "test-key",
+				"CANOPY_WORKER_DRAIN_TIMEOUT":   tt.value,
+			})
+			defer cleanup()
+
+			cfg, err := Load(ModeWorker)
+			if tt.errorMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, cfg.Worker.DrainTimeout)
+		})
+	}
+}
+
+func TestLoad_WorkerMode_IdempotencyTTL(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected time.Duration
+		errorMsg string
+	}{
+		{name: "default", expected: 72 * time.Hour},
+		{name: "custom ttl", value: "24h", expected: 24 * time.Hour},
+		{name: "disabled", value: "0s", expected: 0},
+		{name: "invalid duration", value: "soon", errorMsg: "invalid CANOPY_IDEMPOTENCY_TTL"},
+		{name: "negative duration", value: "-1s", errorMsg: "must not be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := setupEnv(t, map[string]string{
+				"CANOPY_QUEUE_TYPE":             "redis",
+				"CANOPY_REDIS_ADDR":             "localhost:6379",
+				"CANOPY_STORAGE_TYPE":           "minio",
+				"CANOPY_MINIO_ENDPOINT":         "localhost:9000",
+				"CANOPY_MINIO_ACCESS_KEY":       "minioadmin",
+				"CANOPY_MINIO_SECRET_KEY":       "minioadmin",
+				"CANOPY_GITHUB_APP_ID":          "123456",
+				"CANOPY_GITHUB_INSTALLATION_ID": "789012",
+				"CANOPY_GITHUB_PRIVATE_KEY":     "test-key",
+				"CANOPY_IDEMPOTENCY_TTL":        tt.value,
+			})
+			defer cleanup()
+
+			cfg, err := Load(ModeWorker)
+			if tt.errorMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, cfg.Worker.IdempotencyTTL)
+		})
+	}
+}
+
+func TestLoad_WorkerMode_MemoryBudget(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected int64
+		errorMsg string
+	}{
+		{name: "default disabled", expected: 0},
+		{name: "bytes", value: "1048576", expected: 1 << 20},
+		{name: "binary unit", value: "512MiB", expected: 512 << 20},
+		{name: "unit with space", value: "2 GiB", expected: 2 << 30},
+		{name: "invalid", value: "lots", errorMsg: "invalid CANOPY_WORKER_MEMORY_BUDGET"},
+		{name: "decimal unit", value: "512MB", errorMsg: "must be a byte count"},
+		{name: "negative", value: "-1MiB", errorMsg: "must not be negative"},
+		{name: "overflow", value: "9999999999GiB", errorMsg: "too large"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := setupEnv(t, map[string]string{
+				"CANOPY_QUEUE_TYPE":             "redis",
+				"CANOPY_REDIS_ADDR":             "localhost:6379",
+				"CANOPY_STORAGE_TYPE":           "minio",
+				"CANOPY_MINIO_ENDPOINT":         "localhost:9000",
+				"CANOPY_MINIO_ACCESS_KEY":       "minioadmin",
+				"CANOPY_MINIO_SECRET_KEY":       "minioadmin",
+				"CANOPY_GITHUB_APP_ID":          "123456",
+				"CANOPY_GITHUB_INSTALLATION_ID": "789012",
+				"CANOPY_GITHUB_PRIVATE_KEY":     "test-key",
+				"CANOPY_WORKER_MEMORY_BUDGET":   tt.value,
+			})
+			defer cleanup()
+
+			cfg, err := Load(ModeWorker)
+			if tt.errorMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, cfg.Worker.MemoryBudget)
+		})
+	}
+}
+
+func TestLoad_WorkerMode_Concurrency(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected int
+		errorMsg string
+	}{
+		{name: "default", expected: 1},
+		{name: "custom", value: "8", expected: 8},
+		{name: "invalid", value: "many", errorMsg: "invalid CANOPY_WORKER_CONCURRENCY"},
+		{name: "zero", value: "0", errorMsg: "must be at least 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := setupEnv(t, map[string]string{
+				"CANOPY_QUEUE_TYPE":             "redis",
+				"CANOPY_REDIS_ADDR":             "localhost:6379",
+				"CANOPY_STORAGE_TYPE":           "minio",
+				"CANOPY_MINIO_ENDPOINT":         "localhost:9000",
+				"CANOPY_MINIO_ACCESS_KEY":       "minioadmin",
+				"CANOPY_MINIO_SECRET_KEY":       "minioadmin",
+				"CANOPY_GITHUB_APP_ID":          "123456",
+				"CANOPY_GITHUB_INSTALLATION_ID": "789012",
+				"CANOPY_GITHUB_PRIVATE_KEY":     "test-key",
+				"CANOPY_WORKER_CONCURRENCY":     tt.value,
+			})
+			defer cleanup()
+
+			cfg, err := Load(ModeWorker)
+			if tt.errorMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, cfg.Worker.Concurrency)
+		})
+	}
+}
+
+func TestLoad_WorkerMode_GitHubAPIBudget(t *testing.T) {
+	tests := []struct {
+		name            string
+		limit           string
+		reserve         string
+		expectedLimit   int
+		expectedReserve int
+		errorMsg        string
+	}{
+		{name: "defaults", expectedReserve: 100},
+		{name: "custom", limit: "60", reserve: "0", expectedLimit: 60},
+		{name: "invalid limit", limit: "lots", errorMsg: "invalid CANOPY_WORKER_GITHUB_REQUEST_LIMIT"},
+		{name: "negative limit", limit: "-1", errorMsg: "must not be negative"},
+		{name: "invalid reserve", reserve: "some", errorMsg: "invalid CANOPY_WORKER_GITHUB_QUOTA_RESERVE"},
+		{name: "negative reserve", reserve: "-5", errorMsg: "must not be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := setupEnv(t, map[string]string{
+				"CANOPY_QUEUE_TYPE":                  "redis",
+				"CANOPY_REDIS_ADDR":                  "localhost:6379",
+				"CANOPY_STORAGE_TYPE":                "minio",
+				"CANOPY_MINIO_ENDPOINT":              "localhost:9000",
+				"CANOPY_MINIO_ACCESS_KEY":            "minioadmin",
+				"CANOPY_MINIO_SECRET_KEY":            "minioadmin",
+				"CANOPY_GITHUB_APP_ID":               "123456",
+				"CANOPY_GITHUB_INSTALLATION_ID":      "789012",
+				"CANOPY_GITHUB_PRIVATE_KEY":          "test-key",
+				"CANOPY_WORKER_GITHUB_REQUEST_LIMIT": tt.limit,
+				"CANOPY_WORKER_GITHUB_QUOTA_RESERVE": tt.reserve,
+			})
+			defer cleanup()
+
+			cfg, err := Load(ModeWorker)
+			if tt.errorMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedLimit, cfg.Worker.GitHubRequestLimit)
+			assert.Equal(t, tt.expectedReserve, cfg.Worker.GitHubQuotaReserve)
+		})
+	}
+}
+
+func TestLoad_WorkerMode_API(t *testing.T) {
+	tests := []struct {
+		name        string
+		env         map[string]string
+		api         APIConfig
+		badge       bool
+		allowedOrgs []string
+		publicURL   string
+		wantErr     string
+	}{
+		{name: "default disabled"},
+		{
+			name: "query API and uploads",
+			env:  map[string]string{"CANOPY_API_ENABLED": "true", "CANOPY_UPLOAD_ENABLED": "true"},
+			api:  APIConfig{Enabled: true, UploadEnabled: true, RedisAddr: "redis:6379"},
+		},
+		{
+			name:        "badges of the allowed orgs",
+			env:         map[string]string{"CANOPY_BADGE_ENABLED": "true", "CANOPY_ALLOWED_ORGS": "my-org"},
+			badge:       true,
+			allowedOrgs: []string{"my-org"},
+		},
+		{
+			name:      "diff viewer",
+			env:       map[string]string{"CANOPY_PUBLIC_URL": "https://canopy.example.com"},
+			publicURL: "https://canopy.example.com",
+		},
+		{
+			name:    "invalid public URL",
+			env:     map[string]string{"CANOPY_PUBLIC_URL": "canopy.example.com"},
+			wantErr: "invalid CANOPY_PUBLIC_URL",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{
+				"CANOPY_QUEUE_TYPE":             "redis",
+				"CANOPY_REDIS_ADDR":             "redis:6379",
+				"CANOPY_STORAGE_TYPE":           "fs",
+				"CANOPY_FS_ROOT":                "/var/lib/canopy",
+				"CANOPY_GITHUB_APP_ID":          "123456",
+				"CANOPY_GITHUB_INSTALLATION_ID": "789012",
+				"CANOPY_GITHUB_PRIVATE_KEY":     "test-key",
+			}
+			for k, v := range tt.env {
+				env[k] = v
+			}
+			cleanup := setupEnv(t, env)
+			defer cleanup()
+
+			cfg, err := Load(ModeWorker)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.api, cfg.API)
+			assert.Equal(t, tt.badge, cfg.Badge.Enabled)
+			assert.Equal(t, tt.allowedOrgs, cfg.Webhook.AllowedOrgs)
+			assert.Equal(t, tt.publicURL, cfg.Viewer.PublicURL)
+		})
+	}
+}
+
+func TestLoad_WorkerMode_CacheTTL(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected time.Duration
+		errorMsg string
+	}{
+		{name: "default", expected: 5 * time.Minute},
+		{name: "custom", value: "30s", expected: 30 * time.Second},
+		{name: "invalid", value: "soon", errorMsg: "invalid CANOPY_CACHE_TTL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := setupEnv(t, map[string]string{
+				"CANOPY_QUEUE_TYPE":             "redis",
+				"CANOPY_REDIS_ADDR":             "localhost:6379",
+				"CANOPY_STORAGE_TYPE":           "minio",
+				"CANOPY_MINIO_ENDPOINT":         "localhost:9000",
+				"CANOPY_MINIO_ACCESS_KEY":       "minioadmin",
+				"CANOPY_MINIO_SECRET_KEY":       "minioadmin",
+				"CANOPY_GITHUB_APP_ID":          "123456",
+				"CANOPY_GITHUB_INSTALLATION_ID": "789012",
+				"CANOPY_GITHUB_PRIVATE_KEY":     "test-key",
+				"CANOPY_CACHE_TTL":              tt.value,
+			})
+			defer cleanup()
+
+			cfg, err := Load(ModeWorker)
+			if tt.errorMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, cfg.Worker.CacheTTL)
+		})
+	}
+}
+
+func TestLoad_WorkerMode_ArtifactStorageFallback(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected bool
+	}{
+		{name: "default disabled", expected: false},
+		{name: "enabled", value: "true", expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := setupEnv(t, map[string]string{
+				"CANOPY_QUEUE_TYPE":                "redis",
+				"CANOPY_REDIS_ADDR":                "localhost:6379",
+				"CANOPY_STORAGE_TYPE":              "minio",
+				"CANOPY_MINIO_ENDPOINT":            "localhost:9000",
+				"CANOPY_MINIO_ACCESS_KEY":          "minioadmin",
+				"CANOPY_MINIO_SECRET_KEY":          "minioadmin",
+				"CANOPY_GITHUB_APP_ID":             "123456",
+				"CANOPY_GITHUB_INSTALLATION_ID":    "789012",
+				"CANOPY_GITHUB_PRIVATE_KEY":        "test-key",
+				"CANOPY_ARTIFACT_STORAGE_FALLBACK": tt.value,
+			})
+			defer cleanup()
+
+			cfg, err := Load(ModeWorker)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, cfg.Worker.ArtifactStorageFallback)
+		})
+	}
+}
+
+func TestLoad_WorkerMode_ShardedBaselines(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected bool
+	}{
+		{name: "default disabled", expected: false},
+		{name: "enabled", value: "true", expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := setupEnv(t, map[string]string{
+				"CANOPY_QUEUE_TYPE":               "redis",
+				"CANOPY_REDIS_ADDR":               "localhost:6379",
+				"CANOPY_STORAGE_TYPE":             "minio",
+				"CANOPY_MINIO_ENDPOINT":           "localhost:9000",
+				"CANOPY_MINIO_ACCESS_KEY":         "minioadmin",
+				"CANOPY_MINIO_SECRET_KEY":         "minioadmin",
+				"CANOPY_GITHUB_APP_ID":            "123456",
+				"CANOPY_GITHUB_INSTALLATION_ID":   "789012",
+				"CANOPY_GITHUB_PRIVATE_KEY":       "test-key",
+				"CANOPY_WORKER_SHARDED_BASELINES": tt.value,
+			})
+			defer cleanup()
+
+			cfg, err := Load(ModeWorker)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, cfg.Worker.ShardedBaselines)
+		})
+	}
+}
+
+func TestLoad_WorkerMode_RemapStaleCoverage(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected bool
+	}{
+		{name: "default disabled", expected: false},
+		{name: "enabled", value: "true", expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := setupEnv(t, map[string]string{
+				"CANOPY_QUEUE_TYPE":                  "redis",
+				"CANOPY_REDIS_ADDR":                  "localhost:6379",
+				"CANOPY_STORAGE_TYPE":                "minio",
+				"CANOPY_MINIO_ENDPOINT":              "localhost:9000",
+				"CANOPY_MINIO_ACCESS_KEY":            "minioadmin",
+				"CANOPY_MINIO_SECRET_KEY":            "minioadmin",
+				"CANOPY_GITHUB_APP_ID":               "123456",
+				"CANOPY_GITHUB_INSTALLATION_ID":      "789012",
+				"CANOPY_GITHUB_PRIVATE_KEY":          "test-key",
+				"CANOPY_WORKER_REMAP_STALE_COVERAGE": tt.value,
+			})
+			defer cleanup()
+
+			cfg, err := Load(ModeWorker)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, cfg.Worker.RemapStaleCoverage)
+		})
+	}
+}
+
+func TestLoad_WorkerMode_ExportFormats(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected []coverage.Format
+		wantErr  bool
+	}{
+		{name: "default none"},
+		{name: "lcov and cobertura", value: "lcov, cobertura", expected: []coverage.Format{coverage.FormatLCOV, coverage.FormatCobertura}},
+		{name: "go", value: "go", wantErr: true},
+		{name: "unknown", value: "clover", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := setupEnv(t, map[string]string{
+				"CANOPY_QUEUE_TYPE":             "redis",
+				"CANOPY_REDIS_ADDR":             "localhost:6379",
+				"CANOPY_STORAGE_TYPE":           "minio",
+				"CANOPY_MINIO_ENDPOINT":         "localhost:9000",
+				"CANOPY_MINIO_ACCESS_KEY":       "minioadmin",
+				"CANOPY_MINIO_SECRET_KEY":       "minioadmin",
+				"CANOPY_GITHUB_APP_ID":          "123456",
+				"CANOPY_GITHUB_INSTALLATION_ID": "789012",
+				"CANOPY_GITHUB_PRIVATE_KEY":     "test-key",
+				"CANOPY_WORKER_EXPORT_FORMATS":  tt.value,
+			})
+			defer cleanup()
+
+			cfg, err := Load(ModeWorker)
+			if tt.wantErr {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "CANOPY_WORKER_EXPORT_FORMATS")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, cfg.Worker.ExportFormats)
+		})
+	}
+}
+
+func TestLoad_WorkerMode_CheckRunDetails(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected bool
+	}{
+		{name: "default disabled", expected: false},
+		{name: "enabled", value: "true", expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := setupEnv(t, map[string]string{
+				"CANOPY_QUEUE_TYPE":               "redis",
+				"CANOPY_REDIS_ADDR":               "localhost:6379",
+				"CANOPY_STORAGE_TYPE":             "minio",
+				"CANOPY_MINIO_ENDPOINT":           "localhost:9000",
+				"CANOPY_MINIO_ACCESS_KEY":         "minioadmin",
+				"CANOPY_MINIO_SECRET_KEY":         "minioadmin",
+				"CANOPY_GITHUB_APP_ID":            "123456",
+				"CANOPY_GITHUB_INSTALLATION_ID":   "789012",
+				"CANOPY_GITHUB_PRIVATE_KEY":       "test-key",
+				"CANOPY_WORKER_CHECK_RUN_DETAILS": tt.value,
+			})
+			defer cleanup()
+
+			cfg, err := Load(ModeWorker)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, cfg.Worker.CheckRunDetails)
+		})
+	}
+}
+
+func TestLoad_WorkerMode_DefaultThresholds(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected *repoconfig.ThresholdsConfig
+		errorMsg string
+	}{
+		{name: "default unset"},
+		{
+			name:     "inline YAML",
+			value:    "{patch: 80, max_drop: 1, conclusion: neutral}",
+			expected: &repoconfig.ThresholdsConfig{Patch: 80, MaxDrop: 1, Conclusion: repoconfig.ConclusionNeutral},
+		},
+		{name: "invalid", value: "{patch: 180}", errorMsg: "invalid CANOPY_WORKER_DEFAULT_THRESHOLDS"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := setupEnv(t, map[string]string{
+				"CANOPY_QUEUE_TYPE":                "redis",
+				"CANOPY_REDIS_ADDR":                "localhost:6379",
+				"CANOPY_STORAGE_TYPE":              "minio",
+				"CANOPY_MINIO_ENDPOINT":            "localhost:9000",
+				"CANOPY_MINIO_ACCESS_KEY":          "minioadmin",
+				"CANOPY_MINIO_SECRET_KEY":          "minioadmin",
+				"CANOPY_GITHUB_APP_ID":             "123456",
+				"CANOPY_GITHUB_INSTALLATION_ID":    "789012",
+				"CANOPY_GITHUB_PRIVATE_KEY":        "test-key",
+				"CANOPY_WORKER_DEFAULT_THRESHOLDS": tt.value,
+			})
+			defer cleanup()
+
+			cfg, err := Load(ModeWorker)
+			if tt.errorMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, cfg.Worker.DefaultThresholds)
+		})
+	}
+}
+
+func TestLoad_WorkerMode_OrgConfigTTL(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected time.Duration
+		errorMsg string
+	}{
+		{name: "default disabled"},
+		{name: "enabled", value: "5m", expected: 5 * time.Minute},
+		{name: "invalid", value: "often", errorMsg: "invalid CANOPY_WORKER_ORG_CONFIG_TTL"},
+		{name: "negative", value: "-1m", errorMsg: "invalid CANOPY_WORKER_ORG_CONFIG_TTL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := setupEnv(t, map[string]string{
+				"CANOPY_QUEUE_TYPE":             "redis",
+				"CANOPY_REDIS_ADDR":             "localhost:6379",
+				"CANOPY_STORAGE_TYPE":           "minio",
+				"CANOPY_MINIO_ENDPOINT":         "localhost:9000",
+				"CANOPY_MINIO_ACCESS_KEY":       "minioadmin",
+				"CANOPY_MINIO_SECRET_KEY":       "minioadmin",
+				"CANOPY_GITHUB_APP_ID":          "123456",
+				"CANOPY_GITHUB_INSTALLATION_ID": "789012",
+				"CANOPY_GITHUB_PRIVATE_KEY":     "test-key",
+				"CANOPY_WORKER_ORG_CONFIG_TTL":  tt.value,
+			})
+			defer cleanup()
+
+			cfg, err := Load(ModeWorker)
+			if tt.errorMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, cfg.Worker.OrgConfigTTL)
+		})
+	}
+}
+
+func TestLoad_WorkerMode_Artifacts(t *testing.T) {
+	tests := []struct {
+		name                   string
+		env                    map[string]string
+		expectedPatterns       []string
+		expectedMaxSize        int64
+		expectedSpoolThreshold int64
+		errorMsg               string
+	}{
+		{
+			name:                   "defaults",
+			expectedPatterns:       []string{"coverage*"},
+			expectedMaxSize:        500 << 20,
+			expectedSpoolThreshold: 64 << 20,
+		},
+		{
+			name: "custom",
+			env: map[string]string{
+				"CANOPY_ARTIFACT_PATTERNS":        "coverage-*, *-cover",
+				"CANOPY_ARTIFACT_MAX_SIZE":        "2GiB",
+				"CANOPY_ARTIFACT_SPOOL_THRESHOLD": "16MiB",
+			},
+			expectedPatterns:       []string{"coverage-*", "*-cover"},
+			expectedMaxSize:        2 << 30,
+			expectedSpoolThreshold: 16 << 20,
+		},
+		{
+			name:     "invalid pattern",
+			env:      map[string]string{"CANOPY_ARTIFACT_PATTERNS": "coverage["},
+			errorMsg: "invalid CANOPY_ARTIFACT_PATTERNS",
+		},
+		{
+			name:     "zero max size",
+			env:      map[string]string{"CANOPY_ARTIFACT_MAX_SIZE": "0"},
+			errorMsg: "invalid CANOPY_ARTIFACT_MAX_SIZE: must be positive",
+		},
+		{
+			name:     "invalid spool threshold",
+			env:      map[string]string{"CANOPY_ARTIFACT_SPOOL_THRESHOLD": "lots"},
+			errorMsg: "invalid CANOPY_ARTIFACT_SPOOL_THRESHOLD",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{
+				"CANOPY_QUEUE_TYPE":             "redis",
+				"CANOPY_REDIS_ADDR":             "localhost:6379",
+				"CANOPY_STORAGE_TYPE":           "minio",
+				"CANOPY_MINIO_ENDPOINT":         "localhost:9000",
+				"CANOPY_MINIO_ACCESS_KEY":       "minioadmin",
+				"CANOPY_MINIO_SECRET_KEY":       "minioadmin",
+				"CANOPY_GITHUB_APP_ID":          "123456",
+				"CANOPY_GITHUB_INSTALLATION_ID": "789012",
+				"CANOPY_GITHUB_PRIVATE_KEY":     "test-key",
+			}
+			for k, v := range tt.env {
+				env[k] = v
+			}
+			cleanup := setupEnv(t, env)
+			defer cleanup()
+
+			cfg, err := Load(ModeWorker)
+			if tt.errorMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedPatterns, cfg.Worker.ArtifactPatterns)
+			assert.Equal(t, tt.expectedMaxSize, cfg.Worker.ArtifactMaxSize)
+			assert.Equal(t, tt.expectedSpoolThreshold, cfg.Worker.ArtifactSpoolThreshold)
+		})
+	}
+}
+
+func TestLoad_WorkerMode_MinVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		errorMsg string
+	}{
+		{name: "default unset", value: ""},
+		{name: "valid", value: "v1.4.0"},
+		{name: "invalid", value: "latest", errorMsg: "invalid CANOPY_MIN_WORKER_VERSION"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := setupEnv(t, map[string]string{
+				"CANOPY_QUEUE_TYPE":             "redis",
+				"CANOPY_REDIS_ADDR":             "localhost:6379",
+				"CANOPY_STORAGE_TYPE":           "minio",
+				"CANOPY_MINIO_ENDPOINT":         "localhost:9000",
+				"CANOPY_MINIO_ACCESS_KEY":       "minioadmin",
+				"CANOPY_MINIO_SECRET_KEY":       "minioadmin",
+				"CANOPY_GITHUB_APP_ID":          "123456",
+				"CANOPY_GITHUB_INSTALLATION_ID": "789012",
+				"CANOPY_GITHUB_PRIVATE_KEY":     "test-key",
+				"CANOPY_MIN_WORKER_VERSION":     tt.value,
+			})
+			defer cleanup()
+
+			cfg, err := Load(ModeWorker)
+			if tt.errorMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.value, cfg.Worker.MinVersion)
+		})
+	}
+}
+
+func TestLoadQueue(t *testing.T) {
+	t.Setenv("CANOPY_QUEUE_TYPE", "redis")
+	t.Setenv("CANOPY_REDIS_STREAM", "my-stream")
+	t.Setenv("CANOPY_REDIS_DEAD_LETTER_STREAM", "my-dead-letters")
+
+	cfg, err := LoadQueue()
+	require.NoError(t, err)
+	assert.Equal(t, QueueTypeRedis, cfg.Type)
+	assert.Equal(t, "my-stream", cfg.RedisStream)
+	assert.Equal(t, "my-dead-letters", cfg.RedisDeadLetterStream)
+
+	t.Setenv("CANOPY_REDIS_RETRY_AFTER", "soon")
+	_, err = LoadQueue()
+	assert.ErrorContains(t, err, "invalid CANOPY_REDIS_RETRY_AFTER")
+
+	t.Setenv("CANOPY_QUEUE_TYPE", "")
+	_, err = LoadQueue()
+	assert.ErrorContains(t, err, "CANOPY_QUEUE_TYPE is required")
+}
+
+func TestLoadStorage(t *testing.T) {
+	cleanup := setupEnv(t, map[string]string{
+		"CANOPY_STORAGE_TYPE": "gcs",
+		"CANOPY_GCS_BUCKET":   "canopy-coverage",
+	})
+	defer cleanup()
+
+	cfg, err := LoadStorage()
+	require.NoError(t, err)
+	assert.Equal(t, StorageTypeGCS, cfg.Type)
+	assert.Equal(t, "canopy-coverage", cfg.GCSBucket)
+
+	t.Setenv("CANOPY_STORAGE_TYPE", "")
+	_, err = LoadStorage()
+	assert.ErrorContains(t, err, "CANOPY_STORAGE_TYPE is required")
+}
+
+func TestLoadStorage_S3(t *testing.T) {
+	tests := []struct {
+		name         string
+		env          map[string]string
+		wantRegion   string
+		wantEndpoint string
+		errorMsg     string
+	}{
+		{
+			name:       "bucket and region",
+			env:        map[string]string{"CANOPY_S3_BUCKET": "canopy-coverage", "CANOPY_S3_REGION": "eu-west-1"},
+			wantRegion: "eu-west-1",
+		},
+		{
+			name:       "region from AWS_REGION",
+			env:        map[string]string{"CANOPY_S3_BUCKET": "canopy-coverage", "AWS_REGION": "us-east-2"},
+			wantRegion: "us-east-2",
+		},
+		{
+			name: "custom endpoint",
+			env: map[string]string{"CANOPY_S3_BUCKET": "canopy-coverage", "CANOPY_S3_REGION": "eu-west-1",
+				"CANOPY_S3_ENDPOINT": "https://bucket.vpce-123.s3.eu-west-1.vpce.amazonaws.com"},
+			wantRegion:   "eu-west-1",
+			wantEndpoint: "https://bucket.vpce-123.s3.eu-west-1.vpce.amazonaws.com",
+		},
+		{
+			name:     "missing bucket",
+			env:      map[string]string{"CANOPY_S3_REGION": "eu-west-1"},
+			errorMsg: "CANOPY_S3_BUCKET is required",
+		},
+		{
+			name:     "missing region",
+			env:      map[string]string{"CANOPY_S3_BUCKET": "canopy-coverage"},
+			errorMsg: "CANOPY_S3_REGION (or AWS_REGION) is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CANOPY_STORAGE_TYPE", "s3")
+			for _, key := range []string{"CANOPY_S3_BUCKET", "CANOPY_S3_REGION", "CANOPY_S3_ENDPOINT", "AWS_REGION"} {
+				t.Setenv(key, tt.env[key])
+			}
+
+			cfg, err := LoadStorage()
+			if tt.errorMsg != "" {
+				assert.ErrorContains(t, err, tt.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, StorageTypeS3, cfg.Type)
+			assert.Equal(t, "canopy-coverage", cfg.S3Bucket)
+			assert.Equal(t, tt.wantRegion, cfg.S3Region)
+			assert.Equal(t, tt.wantEndpoint, cfg.S3Endpoint)
+		})
+	}
+}
+
+func TestLoadStorage_FS(t *testing.T) {
+	t.Setenv("CANOPY_STORAGE_TYPE", "fs")
+	t.Setenv("CANOPY_FS_ROOT", "/var/lib/canopy")
+
+	cfg, err := LoadStorage()
+	require.NoError(t, err)
+	assert.Equal(t, StorageTypeFS, cfg.Type)
+	assert.Equal(t, "/var/lib/canopy", cfg.FSRoot)
+
+	t.Setenv("CANOPY_FS_ROOT", "")
+	_, err = LoadStorage()
+	assert.ErrorContains(t, err, "CANOPY_FS_ROOT is required for fs storage")
+}
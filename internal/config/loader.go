@@ -0,0 +1,261 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/secrets"
+)
+
+// ConfigFileEnv names the environment variable of the optional YAML config
+// file. Its settings are named like the environment variables, lowercased
+// and without the CANOPY_ prefix (e.g. queue_type for CANOPY_QUEUE_TYPE),
+// and environment variables override them.
+const ConfigFileEnv = "CANOPY_CONFIG_FILE"
+
+// source looks up settings in the environment, then in the config file.
+//
+// Config fields tagged with env are loaded declaratively by load:
+//
+//	RedisAddr string `env:"CANOPY_REDIS_ADDR" default:"localhost:6379"`
+//
+// Supported fields are strings, bools ("true" or not), ints, int64s (or
+// byte sizes with format:"bytes", see parseByteSize), durations, and string
+// slices (comma-separated, or a list in the config file). A validate tag of
+// nonnegative or positive checks the loaded number. Settings that need more
+// than that, such as requirements that depend on the mode, are checked by
+// the loaders of their section.
+//
+// Fields tagged secret:"true" are loaded by secret, which also reads them
+// from files and secret managers.
+type source struct {
+	file map[string]string
+
+	// resolve returns the secret an sm:// value references (see
+	// secrets.Resolver)
+	resolve func(ctx context.Context, value string) (string, error)
+}
+
+// secretTimeout bounds resolving a secret manager reference.
+const secretTimeout = 30 * time.Second
+
+// newSource reads the config file named by CANOPY_CONFIG_FILE, if set.
+func newSource() (*source, error) {
+	name := os.Getenv(ConfigFileEnv)
+	if name == "" {
+		return &source{resolve: (&secrets.Resolver{}).Resolve}, nil
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", ConfigFileEnv, err)
+	}
+	file, err := parseConfigFile(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %s: %w", ConfigFileEnv, name, err)
+	}
+	return &source{file: file, resolve: (&secrets.Resolver{}).Resolve}, nil
+}
+
+// parseConfigFile returns the settings of a config file by name. Lists are
+// joined with commas and mappings are kept as YAML, the way their
+// environment variables are written.
+func parseConfigFile(data []byte) (map[string]string, error) {
+	var doc map[string]yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	file := make(map[string]string, len(doc))
+	for name, node := range doc {
+		switch node.Kind {
+		case yaml.ScalarNode:
+			if node.Tag != "!!null" {
+				file[name] = node.Value
+			}
+		case yaml.SequenceNode:
+			values := make([]string, len(node.Content))
+			for i, item := range node.Content {
+				if item.Kind != yaml.ScalarNode {
+					return nil, fmt.Errorf("%s: line %d: list items must be scalars", name, item.Line)
+				}
+				values[i] = item.Value
+			}
+			file[name] = strings.Join(values, ",")
+		case yaml.MappingNode:
+			value, err := yaml.Marshal(&node)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			file[name] = string(value)
+		default:
+			return nil, fmt.Errorf("%s: line %d: unsupported value", name, node.Line)
+		}
+	}
+	return file, nil
+}
+
+// get returns the setting of an environment variable, the config file's
+// setting of the same name if the variable is unset or empty, or
+// defaultValue.
+func (s *source) get(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	if value := s.file[fileKey(key)]; value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// secret returns the setting of a secret: the environment variable, the
+// contents of the file named by the variable with a _FILE suffix (e.g. a
+// mounted Kubernetes secret, with trailing newlines removed), or either of
+// them from the config file, in that order. A value of the form sm://...
+// is replaced with the secret it references (see secrets.Prefix).
+func (s *source) secret(key string) (string, error) {
+	value := os.Getenv(key)
+	fileVar := key + "_FILE"
+	name := os.Getenv(fileVar)
+	if value == "" && name == "" {
+		value = s.file[fileKey(key)]
+		name = s.file[fileKey(fileVar)]
+	}
+	if value == "" && name != "" {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", fileVar, err)
+		}
+		value = strings.TrimRight(string(data), "\r\n")
+	}
+
+	if secrets.IsReference(value) {
+		ctx, cancel := context.WithTimeout(context.Background(), secretTimeout)
+		defer cancel()
+		resolved, err := s.resolve(ctx, value)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve %s: %w", key, err)
+		}
+		value = resolved
+	}
+	return value, nil
+}
+
+// fileKey returns the config file name of an environment variable.
+func fileKey(key string) string {
+	return strings.ToLower(strings.TrimPrefix(key, "CANOPY_"))
+}
+
+// load sets the env-tagged fields of the struct section points to whose
+// variable starts with one of prefixes, or all of them if there are none.
+// Fields whose setting and default are empty are left unchanged.
+func (s *source) load(section any, prefixes ...string) error {
+	v := reflect.ValueOf(section).Elem()
+	t := v.Type()
+	for i := range t.NumField() {
+		field := t.Field(i)
+		key, ok := field.Tag.Lookup("env")
+		if !ok || !hasAnyPrefix(key, prefixes) {
+			continue
+		}
+		raw := s.get(key, field.Tag.Get("default"))
+		if field.Tag.Get("secret") == "true" {
+			secret, err := s.secret(key)
+			if err != nil {
+				return err
+			}
+			raw = secret
+		}
+		if raw == "" {
+			continue
+		}
+		if err := setField(v.Field(i), field.Tag.Get("format"), raw); err != nil {
+			return fmt.Errorf("invalid %s: %w", key, err)
+		}
+		if err := validateField(v.Field(i), field.Tag.Get("validate")); err != nil {
+			return fmt.Errorf("invalid %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func hasAnyPrefix(key string, prefixes []string) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// setField parses raw into a field.
+func setField(field reflect.Value, format, raw string) error {
+	switch {
+	case field.Type() == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+	case field.Kind() == reflect.String:
+		field.SetString(raw)
+	case field.Kind() == reflect.Bool:
+		field.SetBool(raw == "true")
+	case field.Kind() == reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(n))
+	case field.Kind() == reflect.Int64 && format == "bytes":
+		n, err := parseByteSize(raw)
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case field.Kind() == reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String:
+		values := strings.Split(raw, ",")
+		for i := range values {
+			values[i] = strings.TrimSpace(values[i])
+		}
+		field.Set(reflect.ValueOf(values).Convert(field.Type()))
+	default:
+		panic(fmt.Sprintf("config: unsupported field type %s", field.Type()))
+	}
+	return nil
+}
+
+// validateField checks a loaded number against its validate tag.
+func validateField(field reflect.Value, rule string) error {
+	switch rule {
+	case "":
+		return nil
+	case "nonnegative":
+		if field.Int() < 0 {
+			return fmt.Errorf("must not be negative")
+		}
+	case "positive":
+		if field.Int() <= 0 {
+			return fmt.Errorf("must be positive")
+		}
+	default:
+		panic(fmt.Sprintf("config: unknown validate rule %q", rule))
+	}
+	return nil
+}
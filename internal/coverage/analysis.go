@@ -2,6 +2,7 @@ package coverage
 
 import (
 	"fmt"
+	"path"
 	"sort"
 	"strings"
 
@@ -20,6 +21,18 @@ type AnalysisResult struct {
 	DiffAddedLines int
 	// DiffAddedCovered is the total number of covered lines among added lines
 	DiffAddedCovered int
+	// ProductionAddedLines is the number of lines added to source files
+	// other than tests, including non-executable lines such as comments
+	ProductionAddedLines int
+	// TestAddedLines is the number of lines added to test files (see
+	// IsTestFile), which never have coverage of their own
+	TestAddedLines int
+	// Suppressed maps filenames to uncovered lines excluded by a
+	// SuppressDirective (see ApplySuppressions)
+	Suppressed map[string][]int
+	// ExpiredSuppressions maps filenames to uncovered lines whose
+	// SuppressDirective expired; they remain in UncoveredByFile
+	ExpiredSuppressions map[string][]int
 }
 
 // findMatchingDiffFile finds the diff file that matches a coverage profile.
@@ -43,6 +56,18 @@ func findMatchingDiffFile(profile *Profile, addedLinesByFile map[string][]int) (
 		}
 	}
 
+	// Cobertura and JaCoCo reports name files relative to a source
+	// directory (e.g. com/acme/Main.java for src/main/java/com/acme/Main.java),
+	// so try the diff file as the longer path. Go profiles always name files
+	// by import path, so they aren't matched this way.
+	if !strings.HasSuffix(profileFile, ".go") {
+		for diffFile, addedLines := range addedLinesByFile {
+			if strings.HasSuffix(diffFile, "/"+profileFile) {
+				return diffFile, addedLines, true
+			}
+		}
+	}
+
 	return "", nil, false
 }
 
@@ -72,6 +97,14 @@ func AnalyzeCoverage(profiles []*Profile, addedLinesByFile map[string][]int) *An
 		}
 	}
 
+	for file, lines := range addedLinesByFile {
+		if IsTestFile(file) {
+			result.TestAddedLines += len(lines)
+		} else {
+			result.ProductionAddedLines += len(lines)
+		}
+	}
+
 	// Second pass: Process files that have coverage data and are in the diff
 	// Files without coverage records are excluded from the output
 	for _, profile := range profiles {
@@ -106,6 +139,30 @@ func AnalyzeCoverage(profiles []*Profile, addedLinesByFile map[string][]int) *An
 	return result
 }
 
+// LineCoverageByFile reports the coverage status of each instrumented added line,
+// keyed by diff filename and then line number (true = covered).
+// Added lines that are not instrumented are omitted.
+func LineCoverageByFile(profiles []*Profile, addedLinesByFile map[string][]int) map[string]map[int]bool {
+	result := make(map[string]map[int]bool)
+
+	for _, profile := range profiles {
+		diffFile, addedLines, found := findMatchingDiffFile(profile, addedLinesByFile)
+		if !found {
+			continue
+		}
+
+		lines := make(map[int]bool)
+		for _, line := range addedLines {
+			if isLineInstrumented(profile, line) {
+				lines[line] = isLineCovered(profile, line)
+			}
+		}
+		result[diffFile] = lines
+	}
+
+	return result
+}
+
 // isLineInstrumented checks if a line falls within any coverage block.
 // Returns true if the line is in ANY block (regardless of count).
 // Lines not in any block are non-executable (comments, blank lines, etc.) and should be ignored.
@@ -149,6 +206,45 @@ func (r *AnalysisResult) HasUncoveredLines() bool {
 	return r.DiffAddedLines > r.DiffAddedCovered
 }
 
+// PatchCoverage returns the percentage of added lines that are covered, or
+// 100 if no lines were added.
+func (r *AnalysisResult) PatchCoverage() float64 {
+	if r.DiffAddedLines == 0 {
+		return 100
+	}
+	return float64(r.DiffAddedCovered) / float64(r.DiffAddedLines) * 100
+}
+
+// TestRatio returns the number of test lines added per production line
+// added, or 0 if no production lines were added.
+func (r *AnalysisResult) TestRatio() float64 {
+	if r.ProductionAddedLines == 0 {
+		return 0
+	}
+	return float64(r.TestAddedLines) / float64(r.ProductionAddedLines)
+}
+
+// IsTestFile reports whether file is a test file by the naming conventions
+// of its language: Go (*_test.go), JavaScript and TypeScript (*.test.ts,
+// *.spec.js, ...), JVM languages (*Test.java, *Tests.kt, ...), and Python
+// (test_*.py, *_test.py).
+func IsTestFile(file string) bool {
+	ext := path.Ext(file)
+	name := strings.TrimSuffix(path.Base(file), ext)
+	switch ext {
+	case ".go":
+		return strings.HasSuffix(name, "_test")
+	case ".js", ".jsx", ".mjs", ".cjs", ".ts", ".tsx", ".mts", ".cts":
+		return strings.HasSuffix(name, ".test") || strings.HasSuffix(name, ".spec")
+	case ".java", ".kt", ".scala", ".groovy":
+		return strings.HasSuffix(name, "Test") || strings.HasSuffix(name, "Tests")
+	case ".py":
+		return strings.HasPrefix(name, "test_") || strings.HasSuffix(name, "_test")
+	default:
+		return false
+	}
+}
+
 // GetSortedFiles returns a sorted list of files with uncovered lines.
 // Useful for consistent output ordering.
 func (r *AnalysisResult) GetSortedFiles() []string {
@@ -223,6 +319,36 @@ func CalculateCoverageStats(profiles []*Profile) *CoverageStats {
 	return stats
 }
 
+// PackageCoverage holds coverage statistics for a Go package: the files
+// sharing a directory of their import paths.
+type PackageCoverage struct {
+	Package           string
+	TotalStatements   int
+	CoveredStatements int
+	Percentage        float64
+}
+
+// ByPackage aggregates the per-file statistics by package.
+func (s *CoverageStats) ByPackage() map[string]*PackageCoverage {
+	packages := make(map[string]*PackageCoverage)
+	for file, fc := range s.ByFile {
+		pkg := path.Dir(file)
+		pc, ok := packages[pkg]
+		if !ok {
+			pc = &PackageCoverage{Package: pkg}
+			packages[pkg] = pc
+		}
+		pc.TotalStatements += fc.TotalStatements
+		pc.CoveredStatements += fc.CoveredStatements
+	}
+	for _, pc := range packages {
+		if pc.TotalStatements > 0 {
+			pc.Percentage = float64(pc.CoveredStatements) / float64(pc.TotalStatements) * 100
+		}
+	}
+	return packages
+}
+
 // CoverageComparison holds the result of comparing two coverage reports.
 type CoverageComparison struct {
 	BaseCoverage float64
@@ -252,6 +378,114 @@ func CompareCoverage(base, head *CoverageStats) *CoverageComparison {
 	return comparison
 }
 
+// FileDelta is the coverage change of a single file between base and head.
+type FileDelta struct {
+	// File is the diff (repository-relative) filename in head
+	File string
+	// RenamedFrom is the file's base filename if it was renamed in the diff
+	RenamedFrom  string
+	BaseCoverage float64
+	HeadCoverage float64
+	// HasBase is false if base coverage has no entry for the file
+	HasBase bool
+}
+
+// Delta returns the change in coverage; positive is an improvement.
+func (d FileDelta) Delta() float64 {
+	return d.HeadCoverage - d.BaseCoverage
+}
+
+// CompareFiles returns per-file coverage deltas for the given diff files,
+// in order, skipping files head has no coverage for. renames maps new to old
+// filenames (from GetRenamedFiles), so a renamed file is compared with the
+// base coverage of its old path instead of appearing as a new file.
+func CompareFiles(base, head *CoverageStats, files []string, renames map[string]string) []FileDelta {
+	var deltas []FileDelta
+	for _, file := range files {
+		headFile := findFileStats(head, file)
+		if headFile == nil {
+			continue
+		}
+		delta := FileDelta{File: file, HeadCoverage: headFile.Percentage}
+		baseName := file
+		if old, ok := renames[file]; ok {
+			baseName = old
+			delta.RenamedFrom = old
+		}
+		if baseFile := findFileStats(base, baseName); baseFile != nil {
+			delta.BaseCoverage = baseFile.Percentage
+			delta.HasBase = true
+		}
+		deltas = append(deltas, delta)
+	}
+	return deltas
+}
+
+// PackageDelta is the coverage change of a package between base and head.
+type PackageDelta struct {
+	// Package is the package's import path
+	Package      string
+	BaseCoverage float64
+	HeadCoverage float64
+	// HasBase is false if base coverage has no files of the package
+	HasBase bool
+}
+
+// Delta returns the change in coverage; positive is an improvement.
+func (d PackageDelta) Delta() float64 {
+	return d.HeadCoverage - d.BaseCoverage
+}
+
+// ComparePackages returns the coverage deltas of the packages of the given
+// diff files, sorted by import path, skipping files head has no coverage
+// for.
+func ComparePackages(base, head *CoverageStats, files []string) []PackageDelta {
+	headPackages := head.ByPackage()
+	var basePackages map[string]*PackageCoverage
+	if base != nil {
+		basePackages = base.ByPackage()
+	}
+
+	seen := make(map[string]bool)
+	var deltas []PackageDelta
+	for _, file := range files {
+		headFile := findFileStats(head, file)
+		if headFile == nil {
+			continue
+		}
+		pkg := path.Dir(headFile.FileName)
+		if seen[pkg] {
+			continue
+		}
+		seen[pkg] = true
+		delta := PackageDelta{Package: pkg, HeadCoverage: headPackages[pkg].Percentage}
+		if pc, ok := basePackages[pkg]; ok {
+			delta.BaseCoverage = pc.Percentage
+			delta.HasBase = true
+		}
+		deltas = append(deltas, delta)
+	}
+	sort.Slice(deltas, func(i, j int) bool { return deltas[i].Package < deltas[j].Package })
+	return deltas
+}
+
+// findFileStats returns the coverage of a diff file, matching profile
+// filenames (full module paths) by suffix. Returns nil if there is none.
+func findFileStats(stats *CoverageStats, file string) *FileCoverage {
+	if stats == nil {
+		return nil
+	}
+	if fc, ok := stats.ByFile[file]; ok {
+		return fc
+	}
+	for name, fc := range stats.ByFile {
+		if strings.HasSuffix(name, "/"+file) {
+			return fc
+		}
+	}
+	return nil
+}
+
 // GenerateAnnotations converts analysis result to GitHub Check Run annotations.
 // Uses github.GroupIntoRanges to merge consecutive lines into ranges.
 // Returns annotations with "notice" level as per GitHub Check Run API format.
@@ -428,6 +428,29 @@ func TestAnalysisResult_GetSortedFiles(t *testing.T) {
 	assert.Equal(t, expected, files)
 }
 
+func TestAnalyzeCoverage_TestAndProductionLines(t *testing.T) {
+	profiles := []*Profile{
+		{
+			FileName: "github.com/org/repo/calc.go",
+			Mode:     "set",
+			Blocks:   []ProfileBlock{{StartLine: 3, EndLine: 5, Count: 1}},
+		},
+	}
+	addedLinesByFile := map[string][]int{
+		"calc.go":      {1, 2, 3, 4, 5},
+		"util.go":      {1, 2, 3},
+		"calc_test.go": {1, 2},
+	}
+
+	result := AnalyzeCoverage(profiles, addedLinesByFile)
+
+	assert.Equal(t, 3, result.DiffAddedLines, "only instrumented lines count towards coverage")
+	assert.Equal(t, 8, result.ProductionAddedLines)
+	assert.Equal(t, 2, result.TestAddedLines)
+	assert.Equal(t, 0.25, result.TestRatio())
+	assert.Equal(t, 0.0, (&AnalysisResult{TestAddedLines: 4}).TestRatio())
+}
+
 func TestAnalyzeCoverage_EdgeCases(t *testing.T) {
 	t.Run("line at block boundary", func(t *testing.T) {
 		profiles := []*Profile{
@@ -718,6 +741,87 @@ func TestCompareCoverage(t *testing.T) {
 	}
 }
 
+func TestCompareFiles(t *testing.T) {
+	base := &CoverageStats{ByFile: map[string]*FileCoverage{
+		"github.com/acme/widgets/calc.go":     {Percentage: 100},
+		"github.com/acme/widgets/old/util.go": {Percentage: 50},
+	}}
+	head := &CoverageStats{ByFile: map[string]*FileCoverage{
+		"github.com/acme/widgets/calc.go":     {Percentage: 75},
+		"github.com/acme/widgets/new/util.go": {Percentage: 60},
+		"github.com/acme/widgets/fresh.go":    {Percentage: 40},
+	}}
+
+	tests := []struct {
+		name     string
+		base     *CoverageStats
+		files    []string
+		renames  map[string]string
+		expected []FileDelta
+	}{
+		{
+			name:  "renamed file is compared with its old path",
+			base:  base,
+			files: []string{"calc.go", "new/util.go", "fresh.go", "docs.go"},
+			renames: map[string]string{
+				"new/util.go": "old/util.go",
+			},
+			expected: []FileDelta{
+				{File: "calc.go", BaseCoverage: 100, HeadCoverage: 75, HasBase: true},
+				{File: "new/util.go", RenamedFrom: "old/util.go", BaseCoverage: 50, HeadCoverage: 60, HasBase: true},
+				{File: "fresh.go", HeadCoverage: 40},
+			},
+		},
+		{
+			name:  "without renames the new path has no base",
+			base:  base,
+			files: []string{"new/util.go"},
+			expected: []FileDelta{
+				{File: "new/util.go", HeadCoverage: 60},
+			},
+		},
+		{
+			name:  "nil base",
+			files: []string{"calc.go"},
+			expected: []FileDelta{
+				{File: "calc.go", HeadCoverage: 75},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, CompareFiles(tt.base, head, tt.files, tt.renames))
+		})
+	}
+
+	assert.InDelta(t, -25.0, FileDelta{BaseCoverage: 100, HeadCoverage: 75}.Delta(), 0.0001)
+}
+
+func TestComparePackages(t *testing.T) {
+	base := CalculateCoverageStats([]*Profile{
+		{FileName: "github.com/acme/widgets/calc.go", Blocks: []ProfileBlock{{NumStmt: 4, Count: 1}}},
+		{FileName: "github.com/acme/widgets/util.go", Blocks: []ProfileBlock{{NumStmt: 4, Count: 0}}},
+	})
+	head := CalculateCoverageStats([]*Profile{
+		{FileName: "github.com/acme/widgets/calc.go", Blocks: []ProfileBlock{{NumStmt: 4, Count: 1}, {NumStmt: 2, Count: 0}}},
+		{FileName: "github.com/acme/widgets/util.go", Blocks: []ProfileBlock{{NumStmt: 2, Count: 1}}},
+		{FileName: "github.com/acme/widgets/api/handler.go", Blocks: []ProfileBlock{{NumStmt: 2, Count: 1}, {NumStmt: 2, Count: 0}}},
+	})
+
+	files := []string{"util.go", "api/handler.go", "calc.go", "README.md"}
+	assert.Equal(t, []PackageDelta{
+		{Package: "github.com/acme/widgets", BaseCoverage: 50, HeadCoverage: 75, HasBase: true},
+		{Package: "github.com/acme/widgets/api", HeadCoverage: 50},
+	}, ComparePackages(base, head, files))
+
+	assert.Equal(t, []PackageDelta{
+		{Package: "github.com/acme/widgets", HeadCoverage: 75},
+	}, ComparePackages(nil, head, []string{"calc.go"}))
+
+	assert.InDelta(t, 25.0, PackageDelta{BaseCoverage: 50, HeadCoverage: 75}.Delta(), 0.0001)
+}
+
 func TestGenerateAnnotations(t *testing.T) {
 	tests := []struct {
 		name                string
@@ -895,3 +999,90 @@ func TestGenerateAnnotations(t *testing.T) {
 		})
 	}
 }
+
+func TestLineCoverageByFile(t *testing.T) {
+	profiles := []*Profile{
+		{
+			FileName: "github.com/org/repo/main.go",
+			Blocks: []ProfileBlock{
+				{StartLine: 1, EndLine: 2, NumStmt: 1, Count: 1},
+				{StartLine: 4, EndLine: 5, NumStmt: 1, Count: 0},
+			},
+		},
+		{
+			FileName: "github.com/org/repo/other.go",
+			Blocks:   []ProfileBlock{{StartLine: 1, EndLine: 1, NumStmt: 1, Count: 1}},
+		},
+	}
+	addedLinesByFile := map[string][]int{
+		"main.go": {2, 3, 4},
+	}
+
+	result := LineCoverageByFile(profiles, addedLinesByFile)
+
+	assert.Equal(t, map[string]map[int]bool{
+		"main.go": {2: true, 4: false},
+	}, result)
+}
+
+func TestCoverageStats_ByPackage(t *testing.T) {
+	stats := CalculateCoverageStats([]*Profile{
+		{FileName: "github.com/org/repo/main.go", Blocks: []ProfileBlock{{NumStmt: 3, Count: 1}, {NumStmt: 1, Count: 0}}},
+		{FileName: "github.com/org/repo/api/server.go", Blocks: []ProfileBlock{{NumStmt: 2, Count: 0}}},
+		{FileName: "github.com/org/repo/api/routes.go", Blocks: []ProfileBlock{{NumStmt: 2, Count: 4}}},
+		{FileName: "github.com/org/repo/gen/empty.go"},
+	})
+
+	assert.Equal(t, map[string]*PackageCoverage{
+		"github.com/org/repo":     {Package: "github.com/org/repo", TotalStatements: 4, CoveredStatements: 3, Percentage: 75},
+		"github.com/org/repo/api": {Package: "github.com/org/repo/api", TotalStatements: 4, CoveredStatements: 2, Percentage: 50},
+		"github.com/org/repo/gen": {Package: "github.com/org/repo/gen"},
+	}, stats.ByPackage())
+}
+
+func TestIsTestFile(t *testing.T) {
+	tests := []struct {
+		file string
+		want bool
+	}{
+		{"api/handler_test.go", true},
+		{"api/handler.go", false},
+		{"web/src/app.test.ts", true},
+		{"web/src/app.spec.jsx", true},
+		{"web/src/app.ts", false},
+		{"src/test/java/com/acme/BillingTest.java", true},
+		{"src/main/kotlin/com/acme/BillingTests.kt", true},
+		{"src/main/java/com/acme/Billing.java", false},
+		{"tools/test_render.py", true},
+		{"tools/render_test.py", true},
+		{"tools/render.py", false},
+		{"README.md", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			assert.Equal(t, tt.want, IsTestFile(tt.file))
+		})
+	}
+}
+
+func TestAnalyzeCoverage_RelativeReportPaths(t *testing.T) {
+	addedLinesByFile := map[string][]int{
+		"service/src/main/java/com/acme/Billing.java": {5, 6},
+		"cmd/app/main.go": {1},
+	}
+	profiles := []*Profile{
+		{FileName: "com/acme/Billing.java", Mode: "set", Blocks: []ProfileBlock{
+			{StartLine: 5, StartCol: 1, EndLine: 5, EndCol: 1, NumStmt: 1, Count: 1},
+			{StartLine: 6, StartCol: 1, EndLine: 6, EndCol: 1, NumStmt: 1, Count: 0},
+		}},
+		// Go profiles are never matched to longer diff paths
+		{FileName: "app/main.go", Mode: "set", Blocks: []ProfileBlock{
+			{StartLine: 1, StartCol: 1, EndLine: 1, EndCol: 10, NumStmt: 1, Count: 0},
+		}},
+	}
+
+	result := AnalyzeCoverage(profiles, addedLinesByFile)
+	assert.Equal(t, map[string][]int{"service/src/main/java/com/acme/Billing.java": {6}}, result.UncoveredByFile)
+	assert.Equal(t, 2, result.DiffAddedLines)
+}
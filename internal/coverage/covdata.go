@@ -0,0 +1,493 @@
+package coverage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// GOCOVERDIR file name prefixes: a meta-data file per instrumented binary,
+// and a counter data file per run of it.
+const (
+	covMetaPrefix    = "covmeta."
+	covCounterPrefix = "covcounters."
+)
+
+// Versions of the GOCOVERDIR file formats this decoder reads, and the sizes
+// of their fixed headers (see internal/coverage in the Go distribution).
+const (
+	covMetaFileVersion    = 1
+	covCounterFileVersion = 1
+
+	covMetaSymbolHeaderSize  = 44
+	covCounterFileHeaderSize = 32
+	covCounterFooterSize     = 16
+)
+
+// Counter modes and flavors of GOCOVERDIR files.
+const (
+	covModeSet    = 1
+	covModeCount  = 2
+	covModeAtomic = 3
+
+	covFlavorRaw     = 1
+	covFlavorULEB128 = 2
+)
+
+// IsGoCoverDataFile reports whether name is a GOCOVERDIR meta-data or
+// counter data file (covmeta.* or covcounters.*), whatever its directory.
+func IsGoCoverDataFile(name string) bool {
+	base := path.Base(filepath.ToSlash(name))
+	return strings.HasPrefix(base, covMetaPrefix) || strings.HasPrefix(base, covCounterPrefix)
+}
+
+// ReadGoCoverDir reads the GOCOVERDIR files in dir and decodes them (see
+// ParseGoCoverData).
+func ReadGoCoverDir(dir string) ([]*Profile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read coverage directory: %w", err)
+	}
+	var files [][]byte
+	for _, entry := range entries {
+		if entry.IsDir() || !IsGoCoverDataFile(entry.Name()) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read coverage file %s: %w", entry.Name(), err)
+		}
+		files = append(files, data)
+	}
+	return ParseGoCoverData(files)
+}
+
+// ParseGoCoverData decodes the binary coverage data Go 1.20+ binaries built
+// with -cover write to GOCOVERDIR: the contents of covmeta.* and
+// covcounters.* files, in any order. Counter files are matched to meta-data
+// files by hash, and their counts summed per block (or-ed in set mode), as
+// go tool covdata textfmt does. Blocks of binaries that never wrote counter
+// data are uncovered. It returns a profile per source file, sorted by
+// filename.
+func ParseGoCoverData(files [][]byte) ([]*Profile, error) {
+	var metas []*covMetaFile
+	var counters []*covCounterFile
+	for i, data := range files {
+		switch {
+		case bytes.HasPrefix(data, covMetaMagic):
+			meta, err := parseCovMetaFile(data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse meta-data file %d: %w", i, err)
+			}
+			metas = append(metas, meta)
+		case bytes.HasPrefix(data, covCounterMagic):
+			counter, err := parseCovCounterFile(data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse counter data file %d: %w", i, err)
+			}
+			counters = append(counters, counter)
+		default:
+			return nil, fmt.Errorf("file %d is not GOCOVERDIR data", i)
+		}
+	}
+	if len(metas) == 0 {
+		return nil, fmt.Errorf("no GOCOVERDIR meta-data files (%s*)", covMetaPrefix)
+	}
+
+	// Copies of a meta-data file, e.g. from merged directories, are read once
+	byHash := make(map[[16]byte]*covMetaFile, len(metas))
+	unique := metas[:0]
+	mode := metas[0].mode
+	for _, meta := range metas {
+		if meta.mode != mode {
+			return nil, fmt.Errorf("meta-data files mix counter modes %s and %s", covModeName(mode), covModeName(meta.mode))
+		}
+		if _, ok := byHash[meta.hash]; !ok {
+			byHash[meta.hash] = meta
+			unique = append(unique, meta)
+		}
+	}
+	metas = unique
+	for _, counter := range counters {
+		meta, ok := byHash[counter.metaHash]
+		if !ok {
+			return nil, fmt.Errorf("counter data for missing meta-data file %s%x", covMetaPrefix, counter.metaHash)
+		}
+		for key, values := range counter.funcs {
+			merged := meta.counters[key]
+			if len(merged) < len(values) {
+				merged = append(merged, make([]int, len(values)-len(merged))...)
+			}
+			for i, v := range values {
+				merged[i] = mergeCovCount(mode, merged[i], v)
+			}
+			meta.counters[key] = merged
+		}
+	}
+
+	type unitKey struct {
+		file  string
+		block ProfileBlock
+	}
+	counts := make(map[unitKey]int)
+	for _, meta := range metas {
+		for _, fn := range meta.funcs {
+			values := meta.counters[fn.key]
+			for i, unit := range fn.units {
+				count := 0
+				if i < len(values) {
+					count = values[i]
+				}
+				key := unitKey{file: fn.file, block: unit}
+				counts[key] = mergeCovCount(mode, counts[key], count)
+			}
+		}
+	}
+
+	byFile := make(map[string]*Profile)
+	for key, count := range counts {
+		p, ok := byFile[key.file]
+		if !ok {
+			p = &Profile{FileName: key.file, Mode: covModeName(mode)}
+			byFile[key.file] = p
+		}
+		block := key.block
+		block.Count = count
+		p.Blocks = append(p.Blocks, block)
+	}
+	profiles := make([]*Profile, 0, len(byFile))
+	for _, p := range byFile {
+		sort.Slice(p.Blocks, func(i, j int) bool {
+			a, b := p.Blocks[i], p.Blocks[j]
+			if a.StartLine != b.StartLine {
+				return a.StartLine < b.StartLine
+			}
+			if a.StartCol != b.StartCol {
+				return a.StartCol < b.StartCol
+			}
+			if a.EndLine != b.EndLine {
+				return a.EndLine < b.EndLine
+			}
+			return a.EndCol < b.EndCol
+		})
+		profiles = append(profiles, p)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].FileName < profiles[j].FileName })
+	return profiles, nil
+}
+
+// mergeCovCount combines two counts of a block in mode.
+func mergeCovCount(mode uint8, a, b int) int {
+	if mode == covModeSet {
+		if a != 0 || b != 0 {
+			return 1
+		}
+		return 0
+	}
+	return a + b
+}
+
+// covModeName returns the profile mode of a GOCOVERDIR counter mode.
+func covModeName(mode uint8) string {
+	switch mode {
+	case covModeSet:
+		return "set"
+	case covModeCount:
+		return "count"
+	case covModeAtomic:
+		return "atomic"
+	default:
+		return fmt.Sprintf("mode(%d)", mode)
+	}
+}
+
+// covFuncKey identifies a function by package and function index within
+// its meta-data file.
+type covFuncKey struct {
+	pkg, fn uint32
+}
+
+// covFunc is a function of a meta-data file and its coverable units, as
+// blocks without counts.
+type covFunc struct {
+	key   covFuncKey
+	file  string
+	units []ProfileBlock
+}
+
+// covMetaFile is a decoded GOCOVERDIR meta-data file, with the counts of
+// the counter data files matched to it.
+type covMetaFile struct {
+	hash     [16]byte
+	mode     uint8
+	funcs    []covFunc
+	counters map[covFuncKey][]int
+}
+
+// parseCovMetaFile decodes a meta-data file: a header, the offsets and
+// lengths of each package's meta-data, and each package's functions.
+func parseCovMetaFile(data []byte) (*covMetaFile, error) {
+	r := &covReader{data: data}
+	r.skip(4) // magic
+	if version := r.uint32(); version > covMetaFileVersion {
+		return nil, fmt.Errorf("%w: meta-data file version %d", ErrUnsupportedFormat, version)
+	}
+	r.skip(8) // total length
+	entries := r.uint64()
+	meta := &covMetaFile{counters: make(map[covFuncKey][]int)}
+	copy(meta.hash[:], r.bytes(16))
+	r.skip(8) // string table offset and length
+	meta.mode = r.uint8()
+	granularity := r.uint8()
+	r.skip(6)
+	if r.err != nil {
+		return nil, r.err
+	}
+	if meta.mode < covModeSet || meta.mode > covModeAtomic {
+		return nil, fmt.Errorf("%w: counter mode %d", ErrUnsupportedFormat, meta.mode)
+	}
+	if granularity != 1 {
+		return nil, fmt.Errorf("%w: counter granularity %d (only per-block counters are supported)", ErrUnsupportedFormat, granularity)
+	}
+	if entries > uint64(len(data))/16 {
+		return nil, fmt.Errorf("malformed meta-data file: %d packages", entries)
+	}
+
+	offsets := make([]uint64, entries)
+	for i := range offsets {
+		offsets[i] = r.uint64()
+	}
+	lengths := make([]uint64, entries)
+	for i := range lengths {
+		lengths[i] = r.uint64()
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	for i := range offsets {
+		if offsets[i] > uint64(len(data)) || lengths[i] > uint64(len(data))-offsets[i] {
+			return nil, fmt.Errorf("malformed meta-data file: package %d out of bounds", i)
+		}
+		payload := data[offsets[i] : offsets[i]+lengths[i]]
+		funcs, err := parseCovPackage(uint32(i), payload)
+		if err != nil {
+			return nil, fmt.Errorf("package %d: %w", i, err)
+		}
+		meta.funcs = append(meta.funcs, funcs...)
+	}
+	return meta, nil
+}
+
+// parseCovPackage decodes the meta-data of package pkg: a header, the
+// offsets of its functions, a string table, and the functions.
+func parseCovPackage(pkg uint32, payload []byte) ([]covFunc, error) {
+	r := &covReader{data: payload}
+	r.skip(covMetaSymbolHeaderSize - 4)
+	numFuncs := r.uint32()
+	if r.err != nil {
+		return nil, r.err
+	}
+	if uint64(numFuncs) > uint64(len(payload))/4 {
+		return nil, fmt.Errorf("malformed package meta-data: %d functions", numFuncs)
+	}
+	offsets := make([]uint32, numFuncs)
+	for i := range offsets {
+		offsets[i] = r.uint32()
+	}
+	strs := r.stringTable()
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	str := func(idx uint64) string {
+		if idx >= uint64(len(strs)) {
+			r.fail()
+			return ""
+		}
+		return strs[idx]
+	}
+	funcs := make([]covFunc, 0, numFuncs)
+	for i, off := range offsets {
+		r.seek(int(off))
+		numUnits := r.uleb128()
+		r.uleb128() // function name
+		fn := covFunc{key: covFuncKey{pkg: pkg, fn: uint32(i)}, file: str(r.uleb128())}
+		if numUnits > uint64(len(payload)) {
+			r.fail()
+		}
+		for u := uint64(0); u < numUnits && r.err == nil; u++ {
+			fn.units = append(fn.units, ProfileBlock{
+				StartLine: int(r.uleb128()),
+				StartCol:  int(r.uleb128()),
+				EndLine:   int(r.uleb128()),
+				EndCol:    int(r.uleb128()),
+				NumStmt:   int(r.uleb128()),
+			})
+		}
+		r.uleb128() // function literal flag
+		if r.err != nil {
+			return nil, fmt.Errorf("function %d: %w", i, r.err)
+		}
+		funcs = append(funcs, fn)
+	}
+	return funcs, nil
+}
+
+// covCounterFile is a decoded GOCOVERDIR counter data file.
+type covCounterFile struct {
+	metaHash [16]byte
+	funcs    map[covFuncKey][]int
+}
+
+// parseCovCounterFile decodes a counter data file: a header, then segments
+// of a header, string table, arguments, padding, function counters, and a
+// footer.
+func parseCovCounterFile(data []byte) (*covCounterFile, error) {
+	if len(data) < covCounterFileHeaderSize+covCounterFooterSize {
+		return nil, fmt.Errorf("malformed counter data file: %d bytes", len(data))
+	}
+	r := &covReader{data: data}
+	r.skip(4) // magic
+	if version := r.uint32(); version > covCounterFileVersion {
+		return nil, fmt.Errorf("%w: counter data file version %d", ErrUnsupportedFormat, version)
+	}
+	counter := &covCounterFile{funcs: make(map[covFuncKey][]int)}
+	copy(counter.metaHash[:], r.bytes(16))
+	flavor := r.uint8()
+	var order binary.ByteOrder = binary.LittleEndian
+	if r.uint8() != 0 {
+		order = binary.BigEndian
+	}
+	r.skip(6)
+	if flavor != covFlavorRaw && flavor != covFlavorULEB128 {
+		return nil, fmt.Errorf("%w: counter flavor %d", ErrUnsupportedFormat, flavor)
+	}
+
+	footer := &covReader{data: data[len(data)-covCounterFooterSize:]}
+	if !bytes.Equal(footer.bytes(4), covCounterMagic) {
+		return nil, errors.New("malformed counter data file: missing footer")
+	}
+	footer.skip(4)
+	segments := footer.uint32()
+
+	// Only raw counters follow the byte order of the writing platform
+	value := func() uint32 { return order.Uint32(r.bytes(4)) }
+	if flavor == covFlavorULEB128 {
+		value = func() uint32 { return uint32(r.uleb128()) }
+	}
+	for s := uint32(0); s < segments && r.err == nil; s++ {
+		start := r.off
+		entries := r.uint64()
+		strTabLen := r.uint32()
+		argsLen := r.uint32()
+		r.skip(int(strTabLen) + int(argsLen))
+		if pad := (r.off - start) % 4; pad != 0 {
+			r.skip(4 - pad)
+		}
+		if entries > uint64(len(data)) {
+			r.fail()
+		}
+		for e := uint64(0); e < entries && r.err == nil; e++ {
+			n := value()
+			key := covFuncKey{pkg: value(), fn: value()}
+			if uint64(n) > uint64(len(data)) {
+				r.fail()
+				break
+			}
+			values := make([]int, n)
+			for i := range values {
+				values[i] = int(value())
+			}
+			merged := counter.funcs[key]
+			if len(merged) < len(values) {
+				merged = append(merged, make([]int, len(values)-len(merged))...)
+			}
+			for i, v := range values {
+				merged[i] += v
+			}
+			counter.funcs[key] = merged
+		}
+		r.skip(covCounterFooterSize)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return counter, nil
+}
+
+// covReader reads little-endian GOCOVERDIR data, recording the first
+// out-of-bounds read in err; reads after it return zero values.
+type covReader struct {
+	data []byte
+	off  int
+	err  error
+}
+
+func (r *covReader) fail() {
+	if r.err == nil {
+		r.err = errors.New("malformed coverage data: unexpected end of data")
+	}
+}
+
+func (r *covReader) bytes(n int) []byte {
+	if r.err != nil || n < 0 || n > len(r.data)-r.off {
+		r.fail()
+		return make([]byte, max(n, 0))
+	}
+	b := r.data[r.off : r.off+n]
+	r.off += n
+	return b
+}
+
+func (r *covReader) skip(n int) { r.bytes(n) }
+
+func (r *covReader) seek(off int) {
+	if off < 0 || off > len(r.data) {
+		r.fail()
+		return
+	}
+	r.off = off
+}
+
+func (r *covReader) uint8() uint8   { return r.bytes(1)[0] }
+func (r *covReader) uint32() uint32 { return binary.LittleEndian.Uint32(r.bytes(4)) }
+func (r *covReader) uint64() uint64 { return binary.LittleEndian.Uint64(r.bytes(8)) }
+
+func (r *covReader) uleb128() uint64 {
+	var value uint64
+	for shift := uint(0); shift < 64; shift += 7 {
+		b := r.uint8()
+		value |= uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return value
+		}
+	}
+	r.fail()
+	return 0
+}
+
+// stringTable reads a string table: a count, then each string's length and
+// bytes.
+func (r *covReader) stringTable() []string {
+	n := r.uleb128()
+	if n > uint64(len(r.data)) {
+		r.fail()
+		return nil
+	}
+	strs := make([]string, 0, n)
+	for i := uint64(0); i < n && r.err == nil; i++ {
+		size := r.uleb128()
+		if size > uint64(len(r.data)) {
+			r.fail()
+			break
+		}
+		strs = append(strs, string(r.bytes(int(size))))
+	}
+	return strs
+}
@@ -0,0 +1,225 @@
+package coverage
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// goCoverDirFixture returns the path of a GOCOVERDIR fixture, written by two
+// runs of a binary built with go build -cover.
+func goCoverDirFixture(name string) string {
+	return filepath.Join("..", "..", "testdata", "coverage", name)
+}
+
+// loadGoCoverData reads the files of a GOCOVERDIR fixture by name.
+func loadGoCoverData(t *testing.T, name string) map[string][]byte {
+	t.Helper()
+	dir := goCoverDirFixture(name)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	files := make(map[string][]byte)
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		require.NoError(t, err)
+		files[entry.Name()] = data
+	}
+	return files
+}
+
+func TestReadGoCoverDir(t *testing.T) {
+	tests := []struct {
+		name     string
+		fixture  string
+		expected string
+	}{
+		{
+			name:    "set mode",
+			fixture: "gocoverdir",
+			// As printed by go tool covdata textfmt, sorted by file
+			expected: "mode: set\n" +
+				"example.com/app/calc/calc.go:5.2,6.1 1 1\n" +
+				"example.com/app/calc/calc.go:10.2,10.11 1 1\n" +
+				"example.com/app/calc/calc.go:11.3,12.1 1 0\n" +
+				"example.com/app/calc/calc.go:13.2,13.10 1 1\n" +
+				"example.com/app/calc/calc.go:18.2,19.1 1 0\n" +
+				"example.com/app/main.go:10.2,10.25 1 1\n" +
+				"example.com/app/main.go:11.3,12.1 1 1\n",
+		},
+		{
+			name:    "count mode sums runs",
+			fixture: "gocoverdir_count",
+			expected: "mode: count\n" +
+				"example.com/app/calc/calc.go:5.2,6.1 1 6\n" +
+				"example.com/app/calc/calc.go:10.2,10.11 1 6\n" +
+				"example.com/app/calc/calc.go:11.3,12.1 1 0\n" +
+				"example.com/app/calc/calc.go:13.2,13.10 1 6\n" +
+				"example.com/app/calc/calc.go:18.2,19.1 1 0\n" +
+				"example.com/app/main.go:10.2,10.25 1 2\n" +
+				"example.com/app/main.go:11.3,12.1 1 6\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profiles, err := ReadGoCoverDir(goCoverDirFixture(tt.fixture))
+			require.NoError(t, err)
+			data, err := SerializeProfiles(profiles)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, string(data))
+		})
+	}
+}
+
+func TestParseGoCoverData(t *testing.T) {
+	files := loadGoCoverData(t, "gocoverdir_count")
+	var meta []byte
+	var counters [][]byte
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if strings.HasPrefix(name, "covmeta.") {
+			meta = files[name]
+		} else {
+			counters = append(counters, files[name])
+		}
+	}
+	require.NotNil(t, meta)
+	require.Len(t, counters, 2)
+
+	blockCount := func(t *testing.T, profiles []*Profile, file string, line int) int {
+		t.Helper()
+		for _, p := range profiles {
+			if p.FileName != file {
+				continue
+			}
+			for _, b := range p.Blocks {
+				if b.StartLine == line {
+					return b.Count
+				}
+			}
+		}
+		t.Fatalf("no block at %s:%d", file, line)
+		return 0
+	}
+
+	t.Run("order doesn't matter", func(t *testing.T) {
+		profiles, err := ParseGoCoverData([][]byte{counters[1], meta, counters[0]})
+		require.NoError(t, err)
+		assert.Equal(t, 6, blockCount(t, profiles, "example.com/app/calc/calc.go", 5))
+	})
+
+	t.Run("meta-data without counters is uncovered", func(t *testing.T) {
+		profiles, err := ParseGoCoverData([][]byte{meta})
+		require.NoError(t, err)
+		assert.Equal(t, 0, blockCount(t, profiles, "example.com/app/calc/calc.go", 5))
+	})
+
+	t.Run("duplicate meta-data is read once", func(t *testing.T) {
+		profiles, err := ParseGoCoverData([][]byte{meta, meta, counters[0]})
+		require.NoError(t, err)
+		assert.Equal(t, 3, blockCount(t, profiles, "example.com/app/calc/calc.go", 5))
+	})
+
+	t.Run("counters without meta-data", func(t *testing.T) {
+		_, err := ParseGoCoverData(counters)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "no GOCOVERDIR meta-data files")
+	})
+
+	t.Run("counters of another binary", func(t *testing.T) {
+		other := loadGoCoverData(t, "gocoverdir")
+		var otherMeta []byte
+		for name, data := range other {
+			if strings.HasPrefix(name, "covmeta.") {
+				otherMeta = data
+			}
+		}
+		_, err := ParseGoCoverData([][]byte{otherMeta, counters[0]})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "counter data for missing meta-data file")
+	})
+
+	t.Run("truncated meta-data", func(t *testing.T) {
+		for _, n := range []int{8, 60, len(meta) / 2, len(meta) - 1} {
+			_, err := ParseGoCoverData([][]byte{meta[:n]})
+			assert.Error(t, err, "truncated at %d bytes", n)
+		}
+	})
+
+	t.Run("truncated counters", func(t *testing.T) {
+		for _, n := range []int{8, 40, len(counters[0]) / 2, len(counters[0]) - 1} {
+			_, err := ParseGoCoverData([][]byte{meta, counters[0][:n]})
+			assert.Error(t, err, "truncated at %d bytes", n)
+		}
+	})
+
+	t.Run("newer meta-data version", func(t *testing.T) {
+		newer := bytes.Clone(meta)
+		newer[4] = 2
+		_, err := ParseGoCoverData([][]byte{newer})
+		assert.ErrorIs(t, err, ErrUnsupportedFormat)
+	})
+
+	t.Run("not coverage data", func(t *testing.T) {
+		_, err := ParseGoCoverData([][]byte{[]byte("mode: set\n")})
+		require.Error(t, err)
+	})
+}
+
+func TestIsGoCoverDataFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected bool
+	}{
+		{"covmeta.f02ac46528a4f0bce018cf5cedf6c030", true},
+		{"integration/covcounters.f02ac46528a4f0bce018cf5cedf6c030.26565.1792144664605638183", true},
+		{"coverage.out", false},
+		{"covmeta/coverage.out", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, IsGoCoverDataFile(tt.name))
+		})
+	}
+}
+
+func TestParseProfilesFromZip_GoCoverDir(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range loadGoCoverData(t, "gocoverdir") {
+		w, err := zw.Create("integration/" + name)
+		require.NoError(t, err)
+		_, err = w.Write(data)
+		require.NoError(t, err)
+	}
+	w, err := zw.Create("unit/coverage.out")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("mode: set\nexample.com/app/calc/calc.go:18.2,19.1 1 1\n"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	profiles, err := ParseProfilesFromZip(buf.Bytes())
+	require.NoError(t, err)
+	merged, err := MergeProfiles(profiles)
+	require.NoError(t, err)
+	require.Len(t, merged, 2)
+	assert.Equal(t, "example.com/app/calc/calc.go", merged[0].FileName)
+	assert.Len(t, merged[0].Blocks, 5)
+	for _, b := range merged[0].Blocks {
+		if b.StartLine == 18 {
+			assert.Equal(t, 1, b.Count, "covered by the unit test profile")
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package coverage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Format identifies the format of coverage data.
+type Format string
+
+const (
+	// FormatAuto requests format detection from the data itself.
+	FormatAuto Format = "auto"
+	// FormatGo is the standard Go text profile ("mode: set" header).
+	FormatGo Format = "go"
+	// FormatLCOV is the lcov tracefile format (TN:/SF:/DA: records).
+	FormatLCOV Format = "lcov"
+	// FormatCobertura is the Cobertura XML report format.
+	FormatCobertura Format = "cobertura"
+	// FormatJaCoCo is the JaCoCo XML report format.
+	FormatJaCoCo Format = "jacoco"
+	// FormatGoCoverDir is the Go 1.20+ binary format written to GOCOVERDIR
+	// (covmeta.* and covcounters.* files).
+	FormatGoCoverDir Format = "gocoverdir"
+	// FormatUnknown is returned when the data matches no known format.
+	FormatUnknown Format = "unknown"
+)
+
+// ErrUnsupportedFormat is returned when coverage data is in a format
+// that can be detected but not parsed.
+var ErrUnsupportedFormat = errors.New("unsupported coverage format")
+
+// Magic bytes at the start of GOCOVERDIR meta-data and counter files.
+var (
+	covMetaMagic    = []byte{0x00, 'c', 'v', 'm'}
+	covCounterMagic = []byte{0x00, 'c', 'w', 'm'}
+)
+
+// sniffLimit bounds how much data is inspected when detecting XML formats.
+const sniffLimit = 4096
+
+// ParseFormat converts a user-supplied format name into a Format.
+// The empty string is treated as FormatAuto.
+func ParseFormat(name string) (Format, error) {
+	switch Format(strings.ToLower(strings.TrimSpace(name))) {
+	case "", FormatAuto:
+		return FormatAuto, nil
+	case FormatGo:
+		return FormatGo, nil
+	case FormatLCOV:
+		return FormatLCOV, nil
+	case FormatCobertura:
+		return FormatCobertura, nil
+	case FormatJaCoCo:
+		return FormatJaCoCo, nil
+	case FormatGoCoverDir:
+		return FormatGoCoverDir, nil
+	default:
+		return "", fmt.Errorf("unknown coverage format: %s (supported: auto, go, lcov, cobertura, jacoco, gocoverdir)", name)
+	}
+}
+
+// DetectFormat sniffs coverage data and returns its format.
+// Detection looks only at magic bytes and leading structure, never at the filename.
+func DetectFormat(data []byte) Format {
+	if bytes.HasPrefix(data, covMetaMagic) || bytes.HasPrefix(data, covCounterMagic) {
+		return FormatGoCoverDir
+	}
+
+	// Strip a UTF-8 byte order mark and leading whitespace
+	trimmed := bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	trimmed = bytes.TrimLeft(trimmed, " \t\r\n")
+	if len(trimmed) == 0 {
+		return FormatUnknown
+	}
+
+	if bytes.HasPrefix(trimmed, []byte("mode:")) {
+		return FormatGo
+	}
+
+	if bytes.HasPrefix(trimmed, []byte("TN:")) || bytes.HasPrefix(trimmed, []byte("SF:")) {
+		return FormatLCOV
+	}
+
+	if trimmed[0] == '<' {
+		head := trimmed
+		if len(head) > sniffLimit {
+			head = head[:sniffLimit]
+		}
+		if bytes.Contains(head, []byte("<coverage")) || bytes.Contains(head, []byte("cobertura")) {
+			return FormatCobertura
+		}
+		if bytes.Contains(head, []byte("<report")) || bytes.Contains(head, []byte("JACOCO")) {
+			return FormatJaCoCo
+		}
+	}
+
+	return FormatUnknown
+}
+
+// IsGoCoverDir reports whether dir looks like a GOCOVERDIR output directory,
+// i.e. it contains at least one covmeta.* file.
+func IsGoCoverDir(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasPrefix(entry.Name(), "covmeta.") {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseProfilesAs parses coverage data in the given format.
+// FormatAuto detects the format from the data first; data that matches no
+// known format is handed to the Go text parser so its error describes the problem.
+// GOCOVERDIR data can only be decoded with the rest of its directory (see
+// ParseGoCoverData), so it returns an error wrapping ErrUnsupportedFormat.
+func ParseProfilesAs(data []byte, format Format) ([]*Profile, error) {
+	if format == FormatAuto {
+		if len(data) == 0 {
+			return nil, fmt.Errorf("coverage data is empty")
+		}
+		format = DetectFormat(data)
+	}
+
+	switch format {
+	case FormatGo, FormatUnknown:
+		return ParseProfiles(data)
+	case FormatLCOV:
+		return ParseLCOV(data)
+	case FormatCobertura:
+		return ParseCobertura(data)
+	case FormatJaCoCo:
+		return ParseJaCoCo(data)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+	}
+}
@@ -0,0 +1,235 @@
+package coverage
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		expected Format
+	}{
+		{
+			name:     "go text profile",
+			data:     []byte("mode: set\ngithub.com/org/repo/main.go:1.1,2.2 1 1\n"),
+			expected: FormatGo,
+		},
+		{
+			name:     "go text profile with leading whitespace and BOM",
+			data:     []byte("\xef\xbb\xbf\n  mode: atomic\n"),
+			expected: FormatGo,
+		},
+		{
+			name:     "lcov with test name",
+			data:     []byte("TN:\nSF:src/app.ts\nDA:1,1\nend_of_record\n"),
+			expected: FormatLCOV,
+		},
+		{
+			name:     "lcov starting with source file",
+			data:     []byte("SF:src/app.ts\nDA:1,0\nend_of_record\n"),
+			expected: FormatLCOV,
+		},
+		{
+			name:     "cobertura xml with declaration",
+			data:     []byte(`<?xml version="1.0" ?><!DOCTYPE coverage SYSTEM "http://cobertura.sourceforge.net/xml/coverage-04.dtd"><coverage line-rate="0.5"></coverage>`),
+			expected: FormatCobertura,
+		},
+		{
+			name:     "cobertura xml without declaration",
+			data:     []byte(`<coverage line-rate="0.5" branch-rate="0"><packages/></coverage>`),
+			expected: FormatCobertura,
+		},
+		{
+			name:     "jacoco xml with doctype",
+			data:     []byte(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?><!DOCTYPE report PUBLIC "-//JACOCO//DTD Report 1.1//EN" "report.dtd"><report name="app"></report>`),
+			expected: FormatJaCoCo,
+		},
+		{
+			name:     "gocoverdir meta file",
+			data:     append([]byte{0x00, 'c', 'v', 'm'}, 0x01, 0x02),
+			expected: FormatGoCoverDir,
+		},
+		{
+			name:     "gocoverdir counter file",
+			data:     append([]byte{0x00, 'c', 'w', 'm'}, 0x01, 0x02),
+			expected: FormatGoCoverDir,
+		},
+		{
+			name:     "unrelated xml",
+			data:     []byte(`<?xml version="1.0"?><project></project>`),
+			expected: FormatUnknown,
+		},
+		{
+			name:     "plain text",
+			data:     []byte("hello world\n"),
+			expected: FormatUnknown,
+		},
+		{
+			name:     "empty data",
+			data:     nil,
+			expected: FormatUnknown,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, DetectFormat(tt.data))
+		})
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Format
+		wantErr  bool
+	}{
+		{"", FormatAuto, false},
+		{"auto", FormatAuto, false},
+		{"Go", FormatGo, false},
+		{"lcov", FormatLCOV, false},
+		{"cobertura", FormatCobertura, false},
+		{"JaCoCo", FormatJaCoCo, false},
+		{"gocoverdir", FormatGoCoverDir, false},
+		{"jacoco-csv", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseFormat(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestParseProfilesAs(t *testing.T) {
+	t.Run("auto detects go profile", func(t *testing.T) {
+		profiles, err := ParseProfilesAs(loadTestFixture(t, "valid_single.out"), FormatAuto)
+		require.NoError(t, err)
+		assert.Len(t, profiles, 2)
+	})
+
+	t.Run("auto with unknown data falls back to go parser error", func(t *testing.T) {
+		_, err := ParseProfilesAs([]byte("not coverage\n"), FormatAuto)
+		require.Error(t, err)
+		assert.NotErrorIs(t, err, ErrUnsupportedFormat)
+	})
+
+	t.Run("auto with empty data", func(t *testing.T) {
+		_, err := ParseProfilesAs(nil, FormatAuto)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "empty")
+	})
+
+	t.Run("auto detects lcov", func(t *testing.T) {
+		profiles, err := ParseProfilesAs([]byte("SF:a.ts\nDA:1,1\nend_of_record\n"), FormatAuto)
+		require.NoError(t, err)
+		require.Len(t, profiles, 1)
+		assert.Equal(t, "a.ts", profiles[0].FileName)
+	})
+
+	t.Run("auto detects jacoco", func(t *testing.T) {
+		data := `<report name="app"><package name="com/acme"><sourcefile name="Main.java"><line nr="3" mi="0" ci="2"/></sourcefile></package></report>`
+		profiles, err := ParseProfilesAs([]byte(data), FormatAuto)
+		require.NoError(t, err)
+		require.Len(t, profiles, 1)
+		assert.Equal(t, "com/acme/Main.java", profiles[0].FileName)
+	})
+
+	t.Run("explicit cobertura without classes", func(t *testing.T) {
+		_, err := ParseProfilesAs([]byte("<coverage/>"), FormatCobertura)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "no coverage profiles")
+	})
+
+	t.Run("gocoverdir data alone is unsupported", func(t *testing.T) {
+		_, err := ParseProfilesAs([]byte("\x00cvm binary"), FormatAuto)
+		assert.ErrorIs(t, err, ErrUnsupportedFormat)
+	})
+}
+
+func TestParseProfilesFromZip_MixedFormats(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	files := map[string]string{
+		"coverage.out":       "mode: set\ngithub.com/org/repo/main.go:1.1,2.2 1 1\n",
+		"lcov-coverage.txt":  "SF:src/app.ts\nDA:1,1\nend_of_record\n",
+		"cobertura.cov":      `<?xml version="1.0"?><coverage></coverage>`,
+		"covdata/covmeta.ab": "\x00cvm binary",
+	}
+	for name, content := range files {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+
+	profiles, err := ParseProfilesFromZip(buf.Bytes())
+	require.NoError(t, err)
+	require.Len(t, profiles, 2)
+	names := []string{profiles[0].FileName, profiles[1].FileName}
+	assert.ElementsMatch(t, []string{"github.com/org/repo/main.go", "src/app.ts"}, names)
+}
+
+func TestParseProfilesFromZip_SkippedFiles(t *testing.T) {
+	archive := func(files map[string]string) []byte {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		for name, content := range files {
+			w, err := zw.Create(name)
+			require.NoError(t, err)
+			_, err = w.Write([]byte(content))
+			require.NoError(t, err)
+		}
+		require.NoError(t, zw.Close())
+		return buf.Bytes()
+	}
+	empty := `<?xml version="1.0"?><coverage></coverage>`
+
+	profiles, skipped, err := ParseProfilesFromZipLimit(archive(map[string]string{
+		"coverage.out":  "mode: set\ngithub.com/org/repo/main.go:1.1,2.2 1 1\n",
+		"cobertura.xml": empty,
+	}), -1)
+	require.NoError(t, err)
+	assert.Len(t, profiles, 1)
+	require.Len(t, skipped, 1)
+	assert.Equal(t, "cobertura.xml", skipped[0].Name)
+	assert.ErrorContains(t, skipped[0].Err, "no coverage profiles")
+
+	_, err = ParseProfilesFromZip(archive(map[string]string{"cobertura.xml": empty}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no valid coverage files found in archive: ")
+	assert.Contains(t, err.Error(), "no coverage profiles")
+}
+
+func TestIsGoCoverDir(t *testing.T) {
+	t.Run("directory with covmeta file", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "covmeta.1234"), []byte{0x00, 'c', 'v', 'm'}, 0644))
+		assert.True(t, IsGoCoverDir(dir))
+	})
+
+	t.Run("directory with text profiles", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "coverage.out"), []byte("mode: set\n"), 0644))
+		assert.False(t, IsGoCoverDir(dir))
+	})
+
+	t.Run("missing directory", func(t *testing.T) {
+		assert.False(t, IsGoCoverDir(filepath.Join(t.TempDir(), "missing")))
+	})
+}
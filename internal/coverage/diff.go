@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"path"
 	"regexp"
 	"strconv"
 	"strings"
@@ -155,7 +156,8 @@ func ParseDiff(diffData []byte) ([]*FileDiff, error) {
 
 // GetAddedLinesByFile returns a map of filename to added line numbers.
 // The filename is normalized to use the new name (after any renames).
-// Binary files, deleted files, and non-Go files are excluded.
+// Binary files, deleted files, and files that aren't source code (see
+// IsSourceFile) are excluded.
 func GetAddedLinesByFile(fileDiffs []*FileDiff) map[string][]int {
 	result := make(map[string][]int)
 
@@ -168,8 +170,8 @@ func GetAddedLinesByFile(fileDiffs []*FileDiff) map[string][]int {
 		// Use the new filename (normalized without a/ or b/ prefix)
 		filename := diff.NewName
 
-		// Only include Go files
-		if !strings.HasSuffix(filename, ".go") {
+		// Only include source files coverage can be reported for
+		if !IsSourceFile(filename) {
 			continue
 		}
 
@@ -179,6 +181,41 @@ func GetAddedLinesByFile(fileDiffs []*FileDiff) map[string][]int {
 	return result
 }
 
+// sourceExtensions are the extensions of source files in languages whose
+// coverage can be read: Go, and the languages lcov, Cobertura, and JaCoCo
+// reports are commonly written for.
+var sourceExtensions = map[string]bool{
+	".go": true,
+	// JavaScript and TypeScript (Istanbul/nyc, c8, Jest)
+	".js": true, ".jsx": true, ".mjs": true, ".cjs": true,
+	".ts": true, ".tsx": true, ".mts": true, ".cts": true,
+	// JVM languages (JaCoCo)
+	".java": true, ".kt": true, ".scala": true, ".groovy": true,
+	// Python (coverage.py), Ruby (SimpleCov), PHP (PHPUnit), C# (coverlet)
+	".py": true, ".rb": true, ".php": true, ".cs": true,
+	// C, C++, Rust, and Swift (gcov, llvm-cov)
+	".c": true, ".h": true, ".cc": true, ".cpp": true, ".cxx": true, ".hpp": true,
+	".rs": true, ".swift": true,
+}
+
+// IsSourceFile reports whether file is source code in a language whose
+// coverage can be read, judging by its extension.
+func IsSourceFile(file string) bool {
+	return sourceExtensions[path.Ext(file)]
+}
+
+// GetRenamedFiles returns a map of new filename to the filename it was
+// renamed from, for files renamed (possibly with edits) in the diff.
+func GetRenamedFiles(fileDiffs []*FileDiff) map[string]string {
+	result := make(map[string]string)
+	for _, diff := range fileDiffs {
+		if diff.IsRenamed && !diff.IsDeleted && diff.OldName != diff.NewName {
+			result[diff.NewName] = diff.OldName
+		}
+	}
+	return result
+}
+
 // NormalizeFilename removes the a/ or b/ prefix from diff filenames.
 func NormalizeFilename(filename string) string {
 	if strings.HasPrefix(filename, "a/") || strings.HasPrefix(filename, "b/") {
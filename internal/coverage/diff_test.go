@@ -80,6 +80,16 @@ func TestParseDiff_FileRename(t *testing.T) {
 	assert.Equal(t, []int{4}, diff.AddedLines)
 }
 
+func TestGetRenamedFiles(t *testing.T) {
+	fileDiffs := []*FileDiff{
+		{OldName: "oldname.go", NewName: "newname.go", IsRenamed: true},
+		{OldName: "pkg/a.go", NewName: "pkg/a.go"},
+		{OldName: "gone.go", NewName: "gone.go", IsDeleted: true},
+	}
+
+	assert.Equal(t, map[string]string{"newname.go": "oldname.go"}, GetRenamedFiles(fileDiffs))
+}
+
 func TestParseDiff_FileDeletion(t *testing.T) {
 	diffData, err := os.ReadFile(filepath.Join("..", "..", "testdata", "diffs", "file_deletion.diff"))
 	require.NoError(t, err)
@@ -260,6 +270,27 @@ func TestGetAddedLinesByFile(t *testing.T) {
 				"test.go": {100},
 			},
 		},
+		{
+			name: "include source files of other languages",
+			fileDiffs: []*FileDiff{
+				{
+					NewName:    "web/src/app.ts",
+					AddedLines: []int{3},
+				},
+				{
+					NewName:    "src/main/java/com/acme/Billing.java",
+					AddedLines: []int{7, 8},
+				},
+				{
+					NewName:    "web/package.json",
+					AddedLines: []int{2},
+				},
+			},
+			expected: map[string][]int{
+				"web/src/app.ts":                      {3},
+				"src/main/java/com/acme/Billing.java": {7, 8},
+			},
+		},
 		{
 			name:      "empty input",
 			fileDiffs: []*FileDiff{},
@@ -0,0 +1,259 @@
+package coverage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Export file names: the names coverage exported in each format is
+// conventionally stored under.
+const (
+	ExportNameGo        = "coverage.out"
+	ExportNameLCOV      = "lcov.info"
+	ExportNameCobertura = "coverage.xml"
+)
+
+// ExportName returns the file name coverage exported in format is stored
+// under, or an empty string if format can't be exported.
+func ExportName(format Format) string {
+	switch format {
+	case FormatGo:
+		return ExportNameGo
+	case FormatLCOV:
+		return ExportNameLCOV
+	case FormatCobertura:
+		return ExportNameCobertura
+	default:
+		return ""
+	}
+}
+
+// ParseExportFormat converts a user-supplied name of a format coverage can
+// be exported to (go, lcov, or cobertura) into a Format.
+func ParseExportFormat(name string) (Format, error) {
+	format, err := ParseFormat(name)
+	if err != nil || ExportName(format) == "" {
+		return "", fmt.Errorf("unknown export format: %s (supported: go, lcov, cobertura)", name)
+	}
+	return format, nil
+}
+
+// Export serializes merged profiles in format: a Go text profile (see
+// SerializeProfiles), an lcov tracefile (see SerializeLCOV), or a Cobertura
+// XML report generated at the given time (see SerializeCobertura).
+func Export(profiles []*Profile, format Format, generated time.Time) ([]byte, error) {
+	switch format {
+	case FormatGo:
+		return SerializeProfiles(profiles)
+	case FormatLCOV:
+		return SerializeLCOV(profiles)
+	case FormatCobertura:
+		return SerializeCobertura(profiles, generated)
+	default:
+		return nil, fmt.Errorf("%w: cannot export %s", ErrUnsupportedFormat, format)
+	}
+}
+
+// ModulePath returns the module path declared by the contents of a go.mod
+// file, or an empty string if it declares none.
+func ModulePath(gomod []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(gomod))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "//")
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "module" {
+			return unquote(fields[1])
+		}
+	}
+	return ""
+}
+
+// TrimModule returns profiles with module, the repository's module path,
+// stripped from their filenames, leaving paths relative to the repository
+// root as tools such as Coveralls and GitLab expect. Profiles of other
+// modules are returned unchanged; an empty module returns profiles as-is.
+func TrimModule(profiles []*Profile, module string) []*Profile {
+	if module == "" {
+		return profiles
+	}
+	trimmed := make([]*Profile, len(profiles))
+	for i, p := range profiles {
+		trimmed[i] = p
+		if rest, ok := strings.CutPrefix(p.FileName, module+"/"); ok {
+			renamed := *p
+			renamed.FileName = rest
+			trimmed[i] = &renamed
+		}
+	}
+	return trimmed
+}
+
+// lineHits is the execution count of each instrumented line of a file.
+type lineHits struct {
+	fileName string
+	lines    []int
+	hits     map[int]int
+}
+
+// covered returns the number of lines executed at least once.
+func (h *lineHits) covered() int {
+	n := 0
+	for _, count := range h.hits {
+		if count > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// profileLineHits returns the line hits of each profile, sorted by
+// filename. A line's count is the highest of the blocks spanning it, so a
+// line is covered if any of its blocks was executed, as in the analysis.
+func profileLineHits(profiles []*Profile) []*lineHits {
+	files := make([]*lineHits, 0, len(profiles))
+	for _, p := range profiles {
+		h := &lineHits{fileName: p.FileName, hits: make(map[int]int)}
+		for _, b := range p.Blocks {
+			for line := b.StartLine; line <= b.EndLine; line++ {
+				count, ok := h.hits[line]
+				if !ok {
+					h.lines = append(h.lines, line)
+				}
+				h.hits[line] = max(count, b.Count)
+			}
+		}
+		sort.Ints(h.lines)
+		files = append(files, h)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].fileName < files[j].fileName })
+	return files
+}
+
+// SerializeLCOV writes merged profiles as an lcov tracefile, with a DA
+// record per instrumented line.
+func SerializeLCOV(profiles []*Profile) ([]byte, error) {
+	if len(profiles) == 0 {
+		return nil, fmt.Errorf("no profiles to serialize")
+	}
+
+	var buf bytes.Buffer
+	for _, file := range profileLineHits(profiles) {
+		fmt.Fprintf(&buf, "TN:\nSF:%s\n", file.fileName)
+		for _, line := range file.lines {
+			fmt.Fprintf(&buf, "DA:%d,%d\n", line, file.hits[line])
+		}
+		fmt.Fprintf(&buf, "LF:%d\nLH:%d\nend_of_record\n", len(file.lines), file.covered())
+	}
+	return buf.Bytes(), nil
+}
+
+// coberturaDoctype is the DOCTYPE Cobertura reports declare.
+const coberturaDoctype = `<!DOCTYPE coverage SYSTEM "http://cobertura.sourceforge.net/xml/coverage-04.dtd">`
+
+type coberturaReport struct {
+	XMLName         xml.Name           `xml:"coverage"`
+	LineRate        float64            `xml:"line-rate,attr"`
+	BranchRate      float64            `xml:"branch-rate,attr"`
+	LinesCovered    int                `xml:"lines-covered,attr"`
+	LinesValid      int                `xml:"lines-valid,attr"`
+	BranchesCovered int                `xml:"branches-covered,attr"`
+	BranchesValid   int                `xml:"branches-valid,attr"`
+	Complexity      float64            `xml:"complexity,attr"`
+	Version         string             `xml:"version,attr"`
+	Timestamp       int64              `xml:"timestamp,attr"`
+	Sources         []string           `xml:"sources>source"`
+	Packages        []coberturaPackage `xml:"packages>package"`
+}
+
+type coberturaPackage struct {
+	Name       string           `xml:"name,attr"`
+	LineRate   float64          `xml:"line-rate,attr"`
+	BranchRate float64          `xml:"branch-rate,attr"`
+	Complexity float64          `xml:"complexity,attr"`
+	Classes    []coberturaClass `xml:"classes>class"`
+}
+
+type coberturaClass struct {
+	Name       string          `xml:"name,attr"`
+	FileName   string          `xml:"filename,attr"`
+	LineRate   float64         `xml:"line-rate,attr"`
+	BranchRate float64         `xml:"branch-rate,attr"`
+	Complexity float64         `xml:"complexity,attr"`
+	Methods    struct{}        `xml:"methods"`
+	Lines      []coberturaLine `xml:"lines>line"`
+}
+
+type coberturaLine struct {
+	Number int `xml:"number,attr"`
+	Hits   int `xml:"hits,attr"`
+}
+
+// lineRate returns covered/valid, or 1 if there are no valid lines.
+func lineRate(covered, valid int) float64 {
+	if valid == 0 {
+		return 1
+	}
+	return float64(covered) / float64(valid)
+}
+
+// SerializeCobertura writes merged profiles as a Cobertura XML report, with
+// a package per directory and a class per file. Go profiles have no branch
+// or method data, so branch rates are 0 and classes list no methods.
+// generated is recorded as the report's timestamp.
+func SerializeCobertura(profiles []*Profile, generated time.Time) ([]byte, error) {
+	if len(profiles) == 0 {
+		return nil, fmt.Errorf("no profiles to serialize")
+	}
+
+	report := coberturaReport{Version: "canopy", Timestamp: generated.UnixMilli(), Sources: []string{"."}}
+	byDir := make(map[string]*coberturaPackage)
+	var dirs []string
+	counts := make(map[string][2]int) // covered and valid lines by directory
+	for _, file := range profileLineHits(profiles) {
+		dir := path.Dir(file.fileName)
+		pkg, ok := byDir[dir]
+		if !ok {
+			pkg = &coberturaPackage{Name: dir}
+			byDir[dir] = pkg
+			dirs = append(dirs, dir)
+		}
+
+		covered := file.covered()
+		class := coberturaClass{
+			Name:     path.Base(file.fileName),
+			FileName: file.fileName,
+			LineRate: lineRate(covered, len(file.lines)),
+		}
+		for _, line := range file.lines {
+			class.Lines = append(class.Lines, coberturaLine{Number: line, Hits: file.hits[line]})
+		}
+		pkg.Classes = append(pkg.Classes, class)
+		counts[dir] = [2]int{counts[dir][0] + covered, counts[dir][1] + len(file.lines)}
+		report.LinesCovered += covered
+		report.LinesValid += len(file.lines)
+	}
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		pkg := byDir[dir]
+		pkg.LineRate = lineRate(counts[dir][0], counts[dir][1])
+		report.Packages = append(report.Packages, *pkg)
+	}
+	report.LineRate = lineRate(report.LinesCovered, report.LinesValid)
+
+	data, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode Cobertura report: %w", err)
+	}
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	buf.WriteString(coberturaDoctype + "\n")
+	buf.Write(data)
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,161 @@
+package coverage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// exportProfiles covers pkg/b.go partly, with two blocks on line 4, and
+// pkg/sub/c.go and pkg/a.go so that directories interleave when sorted.
+func exportProfiles() []*Profile {
+	return []*Profile{
+		{FileName: "pkg/b.go", Mode: "count", Blocks: []ProfileBlock{
+			{StartLine: 3, StartCol: 1, EndLine: 4, EndCol: 10, NumStmt: 2, Count: 0},
+			{StartLine: 4, StartCol: 12, EndLine: 5, EndCol: 2, NumStmt: 1, Count: 3},
+			{StartLine: 7, StartCol: 1, EndLine: 7, EndCol: 9, NumStmt: 1, Count: 0},
+		}},
+		{FileName: "pkg/sub/c.go", Mode: "count", Blocks: []ProfileBlock{
+			{StartLine: 1, StartCol: 1, EndLine: 1, EndCol: 5, NumStmt: 1, Count: 1},
+		}},
+		{FileName: "pkg/a.go", Mode: "count", Blocks: []ProfileBlock{
+			{StartLine: 2, StartCol: 1, EndLine: 2, EndCol: 5, NumStmt: 1, Count: 2},
+		}},
+	}
+}
+
+func TestSerializeLCOV(t *testing.T) {
+	data, err := SerializeLCOV(exportProfiles())
+	require.NoError(t, err)
+	assert.Equal(t, `TN:
+SF:pkg/a.go
+DA:2,2
+LF:1
+LH:1
+end_of_record
+TN:
+SF:pkg/b.go
+DA:3,0
+DA:4,3
+DA:5,3
+DA:7,0
+LF:4
+LH:2
+end_of_record
+TN:
+SF:pkg/sub/c.go
+DA:1,1
+LF:1
+LH:1
+end_of_record
+`, string(data))
+	assert.Equal(t, FormatLCOV, DetectFormat(data))
+
+	_, err = SerializeLCOV(nil)
+	require.Error(t, err)
+}
+
+func TestSerializeCobertura(t *testing.T) {
+	data, err := SerializeCobertura(exportProfiles(), time.UnixMilli(1700000000000))
+	require.NoError(t, err)
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE coverage SYSTEM "http://cobertura.sourceforge.net/xml/coverage-04.dtd">
+<coverage line-rate="0.6666666666666666" branch-rate="0" lines-covered="4" lines-valid="6" branches-covered="0" branches-valid="0" complexity="0" version="canopy" timestamp="1700000000000">
+  <sources>
+    <source>.</source>
+  </sources>
+  <packages>
+    <package name="pkg" line-rate="0.6" branch-rate="0" complexity="0">
+      <classes>
+        <class name="a.go" filename="pkg/a.go" line-rate="1" branch-rate="0" complexity="0">
+          <methods></methods>
+          <lines>
+            <line number="2" hits="2"></line>
+          </lines>
+        </class>
+        <class name="b.go" filename="pkg/b.go" line-rate="0.5" branch-rate="0" complexity="0">
+          <methods></methods>
+          <lines>
+            <line number="3" hits="0"></line>
+            <line number="4" hits="3"></line>
+            <line number="5" hits="3"></line>
+            <line number="7" hits="0"></line>
+          </lines>
+        </class>
+      </classes>
+    </package>
+    <package name="pkg/sub" line-rate="1" branch-rate="0" complexity="0">
+      <classes>
+        <class name="c.go" filename="pkg/sub/c.go" line-rate="1" branch-rate="0" complexity="0">
+          <methods></methods>
+          <lines>
+            <line number="1" hits="1"></line>
+          </lines>
+        </class>
+      </classes>
+    </package>
+  </packages>
+</coverage>
+`, string(data))
+	assert.Equal(t, FormatCobertura, DetectFormat(data))
+
+	_, err = SerializeCobertura(nil, time.Time{})
+	require.Error(t, err)
+}
+
+func TestExport(t *testing.T) {
+	profiles := exportProfiles()
+	for _, format := range []Format{FormatGo, FormatLCOV, FormatCobertura} {
+		t.Run(string(format), func(t *testing.T) {
+			data, err := Export(profiles, format, time.Time{})
+			require.NoError(t, err)
+			assert.Equal(t, format, DetectFormat(data))
+		})
+	}
+
+	_, err := Export(profiles, FormatGoCoverDir, time.Time{})
+	require.ErrorIs(t, err, ErrUnsupportedFormat)
+}
+
+func TestParseExportFormat(t *testing.T) {
+	format, err := ParseExportFormat("LCOV")
+	require.NoError(t, err)
+	assert.Equal(t, FormatLCOV, format)
+	assert.Equal(t, "lcov.info", ExportName(format))
+
+	for _, name := range []string{"", "auto", "gocoverdir", "xml"} {
+		_, err := ParseExportFormat(name)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestModulePath(t *testing.T) {
+	tests := []struct {
+		name     string
+		gomod    string
+		expected string
+	}{
+		{name: "module", gomod: "module github.com/acme/app\n\ngo 1.25\n", expected: "github.com/acme/app"},
+		{name: "quoted with comment", gomod: "// app\nmodule \"github.com/acme/app\" // main\n", expected: "github.com/acme/app"},
+		{name: "no module", gomod: "go 1.25\n", expected: ""},
+		{name: "no go.mod", expected: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, ModulePath([]byte(tt.gomod)))
+		})
+	}
+}
+
+func TestTrimModule(t *testing.T) {
+	profiles := []*Profile{{FileName: "github.com/acme/app/pkg/a.go"}, {FileName: "github.com/acme/lib/b.go"}}
+
+	trimmed := TrimModule(profiles, "github.com/acme/app")
+	assert.Equal(t, "pkg/a.go", trimmed[0].FileName)
+	assert.Equal(t, "github.com/acme/lib/b.go", trimmed[1].FileName)
+	assert.Equal(t, "github.com/acme/app/pkg/a.go", profiles[0].FileName, "profiles are not modified")
+
+	assert.Equal(t, profiles, TrimModule(profiles, ""))
+}
@@ -0,0 +1,226 @@
+package coverage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Line-based formats (lcov, Cobertura, JaCoCo) record whether each line
+// ran rather than Go's statement blocks, so each line becomes a one-line
+// block at column 1. Their profiles are in set mode, with a count of 1 for
+// lines that ran, so they merge with Go profiles in the default set mode.
+
+// lineCoverage collects the lines of each file of a line-based report,
+// and whether each ran, merging repeated lines.
+type lineCoverage map[string]map[int]bool
+
+// add records a line of file as run if hits is positive. A line reported
+// more than once ran if any report of it ran.
+func (c lineCoverage) add(file string, line int, hits int64) {
+	lines, ok := c[file]
+	if !ok {
+		lines = make(map[int]bool)
+		c[file] = lines
+	}
+	lines[line] = lines[line] || hits > 0
+}
+
+// profiles returns the collected lines as set-mode profiles sorted by
+// filename, with blocks sorted by line.
+func (c lineCoverage) profiles() ([]*Profile, error) {
+	if len(c) == 0 {
+		return nil, fmt.Errorf("no coverage profiles found in data")
+	}
+
+	profiles := make([]*Profile, 0, len(c))
+	for file, lines := range c {
+		p := &Profile{FileName: file, Mode: "set", Blocks: make([]ProfileBlock, 0, len(lines))}
+		for line, ran := range lines {
+			count := 0
+			if ran {
+				count = 1
+			}
+			p.Blocks = append(p.Blocks, ProfileBlock{StartLine: line, StartCol: 1, EndLine: line, EndCol: 1, NumStmt: 1, Count: count})
+		}
+		sort.Slice(p.Blocks, func(i, j int) bool { return p.Blocks[i].StartLine < p.Blocks[j].StartLine })
+		profiles = append(profiles, p)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].FileName < profiles[j].FileName })
+	return profiles, nil
+}
+
+// cleanReportPath returns a source path from a coverage report with
+// forward slashes and without "./" or redundant elements, so it can be
+// suffix-matched against diff paths.
+func cleanReportPath(name string) string {
+	return path.Clean(strings.ReplaceAll(strings.TrimSpace(name), `\`, "/"))
+}
+
+// ParseLCOV parses an lcov tracefile (SF:, DA:, and end_of_record
+// records, as written by Istanbul/nyc, c8, and geninfo). Function and
+// branch records are ignored. Source paths are kept as written, so
+// absolute paths still match diff paths by suffix.
+func ParseLCOV(data []byte) ([]*Profile, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("coverage data is empty")
+	}
+
+	lines := make(lineCoverage)
+	file := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "SF:"):
+			file = cleanReportPath(strings.TrimPrefix(line, "SF:"))
+		case line == "end_of_record":
+			file = ""
+		case strings.HasPrefix(line, "DA:"):
+			if file == "" {
+				return nil, fmt.Errorf("failed to parse lcov data: line %d: DA record outside a SF record", n)
+			}
+			// DA:<line>,<hits>[,<checksum>]
+			fields := strings.Split(strings.TrimPrefix(line, "DA:"), ",")
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("failed to parse lcov data: line %d: malformed DA record %q", n, line)
+			}
+			lineNo, err := strconv.Atoi(fields[0])
+			if err != nil || lineNo <= 0 {
+				return nil, fmt.Errorf("failed to parse lcov data: line %d: invalid line number %q", n, fields[0])
+			}
+			hits, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse lcov data: line %d: invalid hit count %q", n, fields[1])
+			}
+			lines.add(file, lineNo, hits)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read lcov data: %w", err)
+	}
+	return lines.profiles()
+}
+
+// coberturaInput is the part of a Cobertura report ParseCobertura reads.
+type coberturaInput struct {
+	Sources  []string `xml:"sources>source"`
+	Packages []struct {
+		Classes []struct {
+			FileName string `xml:"filename,attr"`
+			Lines    []struct {
+				Number int   `xml:"number,attr"`
+				Hits   int64 `xml:"hits,attr"`
+			} `xml:"lines>line"`
+		} `xml:"classes>class"`
+	} `xml:"packages>package"`
+}
+
+// ParseCobertura parses a Cobertura XML report (as written by coverage.py,
+// coverlet, istanbul, and cobertura itself). Class filenames are relative
+// to the report's source directory; with a single source they are joined
+// with it, otherwise kept as written and matched to diff paths by suffix.
+func ParseCobertura(data []byte) ([]*Profile, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("coverage data is empty")
+	}
+
+	var report coberturaInput
+	if err := xml.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("failed to parse Cobertura report: %w", err)
+	}
+	source := ""
+	if len(report.Sources) == 1 {
+		source = cleanReportPath(report.Sources[0])
+	}
+
+	lines := make(lineCoverage)
+	for _, pkg := range report.Packages {
+		for _, class := range pkg.Classes {
+			if class.FileName == "" {
+				return nil, fmt.Errorf("failed to parse Cobertura report: class without a filename")
+			}
+			file := cleanReportPath(class.FileName)
+			if source != "" && !path.IsAbs(file) {
+				file = path.Join(source, file)
+			}
+			for _, line := range class.Lines {
+				if line.Number <= 0 {
+					return nil, fmt.Errorf("failed to parse Cobertura report: %s: invalid line number %d", file, line.Number)
+				}
+				lines.add(file, line.Number, line.Hits)
+			}
+		}
+	}
+	return lines.profiles()
+}
+
+// jacocoGroup is a JaCoCo report or group element, which hold packages
+// and, in reports of multi-module builds, nested groups.
+type jacocoGroup struct {
+	Groups   []jacocoGroup `xml:"group"`
+	Packages []struct {
+		// Name is the package directory, e.g. com/acme/app
+		Name        string `xml:"name,attr"`
+		SourceFiles []struct {
+			Name  string `xml:"name,attr"`
+			Lines []struct {
+				Number int `xml:"nr,attr"`
+				// MissedInstructions and CoveredInstructions count the
+				// bytecode instructions of the line
+				MissedInstructions  int64 `xml:"mi,attr"`
+				CoveredInstructions int64 `xml:"ci,attr"`
+			} `xml:"line"`
+		} `xml:"sourcefile"`
+	} `xml:"package"`
+}
+
+// ParseJaCoCo parses a JaCoCo XML report. Source files are named by their
+// package directory, e.g. com/acme/app/Main.java, which matches diff paths
+// such as src/main/java/com/acme/app/Main.java by suffix. A line ran if any
+// of its instructions did.
+func ParseJaCoCo(data []byte) ([]*Profile, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("coverage data is empty")
+	}
+
+	var report jacocoGroup
+	if err := xml.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("failed to parse JaCoCo report: %w", err)
+	}
+
+	lines := make(lineCoverage)
+	var collect func(group *jacocoGroup) error
+	collect = func(group *jacocoGroup) error {
+		for i := range group.Groups {
+			if err := collect(&group.Groups[i]); err != nil {
+				return err
+			}
+		}
+		for _, pkg := range group.Packages {
+			for _, source := range pkg.SourceFiles {
+				file := cleanReportPath(path.Join(pkg.Name, source.Name))
+				for _, line := range source.Lines {
+					if line.Number <= 0 {
+						return fmt.Errorf("failed to parse JaCoCo report: %s: invalid line number %d", file, line.Number)
+					}
+					if line.MissedInstructions+line.CoveredInstructions == 0 {
+						continue
+					}
+					lines.add(file, line.Number, line.CoveredInstructions)
+				}
+			}
+		}
+		return nil
+	}
+	if err := collect(&report); err != nil {
+		return nil, err
+	}
+	return lines.profiles()
+}
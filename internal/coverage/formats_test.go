@@ -0,0 +1,214 @@
+package coverage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lineBlock is the block a line-based format reports for a line.
+func lineBlock(line, count int) ProfileBlock {
+	return ProfileBlock{StartLine: line, StartCol: 1, EndLine: line, EndCol: 1, NumStmt: 1, Count: count}
+}
+
+func TestParseLCOV(t *testing.T) {
+	t.Run("fixture", func(t *testing.T) {
+		profiles, err := ParseLCOV(loadTestFixture(t, "lcov.info"))
+		require.NoError(t, err)
+		assert.Equal(t, []*Profile{
+			{FileName: "/home/runner/work/app/app/web/src/app.ts", Mode: "set", Blocks: []ProfileBlock{lineBlock(1, 1), lineBlock(2, 1), lineBlock(4, 0)}},
+			{FileName: "web/src/util.ts", Mode: "set", Blocks: []ProfileBlock{lineBlock(1, 1), lineBlock(2, 0)}},
+		}, profiles)
+	})
+
+	tests := []struct {
+		name        string
+		data        string
+		want        []*Profile
+		errContains string
+	}{
+		{
+			name: "repeated records of a file are merged",
+			data: "SF:./src/a.ts\nDA:1,0\nDA:2,0\nend_of_record\nSF:src/a.ts\nDA:1,5\nend_of_record\n",
+			want: []*Profile{{FileName: "src/a.ts", Mode: "set", Blocks: []ProfileBlock{lineBlock(1, 1), lineBlock(2, 0)}}},
+		},
+		{
+			name: "windows paths and checksums",
+			data: "SF:C:\\src\\a.ts\r\nDA:3,2,abc123\r\nend_of_record\r\n",
+			want: []*Profile{{FileName: "C:/src/a.ts", Mode: "set", Blocks: []ProfileBlock{lineBlock(3, 1)}}},
+		},
+		{
+			name:        "line record without a file",
+			data:        "DA:1,1\n",
+			errContains: "outside a SF record",
+		},
+		{
+			name:        "invalid hit count",
+			data:        "SF:a.ts\nDA:1,many\n",
+			errContains: `invalid hit count "many"`,
+		},
+		{
+			name:        "invalid line number",
+			data:        "SF:a.ts\nDA:0,1\n",
+			errContains: "invalid line number",
+		},
+		{
+			name:        "no files",
+			data:        "TN:\n",
+			errContains: "no coverage profiles",
+		},
+		{
+			name:        "empty data",
+			data:        "",
+			errContains: "empty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profiles, err := ParseLCOV([]byte(tt.data))
+			if tt.errContains != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errContains)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, profiles)
+		})
+	}
+}
+
+func TestParseCobertura(t *testing.T) {
+	t.Run("fixture", func(t *testing.T) {
+		profiles, err := ParseCobertura(loadTestFixture(t, "cobertura.xml"))
+		require.NoError(t, err)
+		assert.Equal(t, []*Profile{
+			{FileName: "/home/runner/work/app/app/tools/report/render.py", Mode: "set", Blocks: []ProfileBlock{
+				lineBlock(1, 1), lineBlock(2, 1), lineBlock(5, 0), lineBlock(6, 1), lineBlock(7, 0),
+			}},
+		}, profiles)
+	})
+
+	tests := []struct {
+		name        string
+		data        string
+		want        []*Profile
+		errContains string
+	}{
+		{
+			name: "several sources keep filenames as written",
+			data: `<coverage><sources><source>src</source><source>lib</source></sources><packages><package><classes>` +
+				`<class filename="app/Main.cs"><lines><line number="4" hits="0"/></lines></class>` +
+				`</classes></package></packages></coverage>`,
+			want: []*Profile{{FileName: "app/Main.cs", Mode: "set", Blocks: []ProfileBlock{lineBlock(4, 0)}}},
+		},
+		{
+			name: "classes of the same file are merged",
+			data: `<coverage><packages><package><classes>` +
+				`<class filename="a.js"><lines><line number="1" hits="0"/></lines></class>` +
+				`<class filename="a.js"><lines><line number="1" hits="3"/><line number="2" hits="0"/></lines></class>` +
+				`</classes></package></packages></coverage>`,
+			want: []*Profile{{FileName: "a.js", Mode: "set", Blocks: []ProfileBlock{lineBlock(1, 1), lineBlock(2, 0)}}},
+		},
+		{
+			name: "method lines are not counted twice",
+			data: `<coverage><packages><package><classes><class filename="a.py">` +
+				`<methods><method><lines><line number="9" hits="1"/></lines></method></methods>` +
+				`<lines><line number="2" hits="1"/></lines>` +
+				`</class></classes></package></packages></coverage>`,
+			want: []*Profile{{FileName: "a.py", Mode: "set", Blocks: []ProfileBlock{lineBlock(2, 1)}}},
+		},
+		{
+			name:        "class without a filename",
+			data:        `<coverage><packages><package><classes><class name="A"/></classes></package></packages></coverage>`,
+			errContains: "class without a filename",
+		},
+		{
+			name:        "malformed xml",
+			data:        `<coverage><packages>`,
+			errContains: "failed to parse Cobertura report",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profiles, err := ParseCobertura([]byte(tt.data))
+			if tt.errContains != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errContains)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, profiles)
+		})
+	}
+}
+
+func TestParseCobertura_RoundTrip(t *testing.T) {
+	profiles := []*Profile{{FileName: "api/handler.go", Mode: "set", Blocks: []ProfileBlock{
+		{StartLine: 2, StartCol: 5, EndLine: 3, EndCol: 2, NumStmt: 2, Count: 1},
+		{StartLine: 5, StartCol: 1, EndLine: 5, EndCol: 9, NumStmt: 1, Count: 0},
+	}}}
+	data, err := SerializeCobertura(profiles, time.UnixMilli(1700000000000))
+	require.NoError(t, err)
+
+	parsed, err := ParseCobertura(data)
+	require.NoError(t, err)
+	assert.Equal(t, []*Profile{{FileName: "api/handler.go", Mode: "set", Blocks: []ProfileBlock{
+		lineBlock(2, 1), lineBlock(3, 1), lineBlock(5, 0),
+	}}}, parsed)
+}
+
+func TestParseJaCoCo(t *testing.T) {
+	t.Run("fixture", func(t *testing.T) {
+		profiles, err := ParseJaCoCo(loadTestFixture(t, "jacoco.xml"))
+		require.NoError(t, err)
+		assert.Equal(t, []*Profile{
+			{FileName: "Main.java", Mode: "set", Blocks: []ProfileBlock{lineBlock(1, 0)}},
+			{FileName: "com/acme/service/Billing.java", Mode: "set", Blocks: []ProfileBlock{lineBlock(3, 1), lineBlock(5, 1), lineBlock(6, 0)}},
+		}, profiles)
+	})
+
+	tests := []struct {
+		name        string
+		data        string
+		want        []*Profile
+		errContains string
+	}{
+		{
+			name: "lines without instructions are skipped",
+			data: `<report><package name="a"><sourcefile name="B.kt"><line nr="1" mi="0" ci="0" mb="1" cb="0"/><line nr="2" mi="1" ci="0"/></sourcefile></package></report>`,
+			want: []*Profile{{FileName: "a/B.kt", Mode: "set", Blocks: []ProfileBlock{lineBlock(2, 0)}}},
+		},
+		{
+			name:        "invalid line number",
+			data:        `<report><package name="a"><sourcefile name="B.java"><line nr="0" mi="1" ci="0"/></sourcefile></package></report>`,
+			errContains: "invalid line number",
+		},
+		{
+			name:        "no source files",
+			data:        `<report name="empty"/>`,
+			errContains: "no coverage profiles",
+		},
+		{
+			name:        "malformed xml",
+			data:        `<report>`,
+			errContains: "failed to parse JaCoCo report",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profiles, err := ParseJaCoCo([]byte(tt.data))
+			if tt.errContains != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errContains)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, profiles)
+		})
+	}
+}
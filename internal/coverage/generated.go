@@ -0,0 +1,243 @@
+package coverage
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// FileFilter decides whether a file in the diff is excluded from analysis.
+type FileFilter interface {
+	Ignore(file string) bool
+}
+
+// FilterAddedLines returns addedLinesByFile without the files ignored by any filter.
+func FilterAddedLines(addedLinesByFile map[string][]int, filters ...FileFilter) map[string][]int {
+	result := make(map[string][]int, len(addedLinesByFile))
+	for file, lines := range addedLinesByFile {
+		ignored := false
+		for _, f := range filters {
+			if f != nil && f.Ignore(file) {
+				ignored = true
+				break
+			}
+		}
+		if !ignored {
+			result[file] = lines
+		}
+	}
+	return result
+}
+
+// PatternFilter ignores files matching any of its glob patterns, matched
+// like root .gitattributes patterns: patterns without a slash match the file
+// name at any depth, others are anchored at the repository root, and "**"
+// matches any number of directories.
+type PatternFilter []string
+
+// Ignore implements FileFilter.
+func (f PatternFilter) Ignore(file string) bool {
+	for _, pattern := range f {
+		if matchAttributePattern(pattern, file) {
+			return true
+		}
+	}
+	return false
+}
+
+// IncludeFilter ignores files matching none of its glob patterns, matched
+// like PatternFilter's. An empty IncludeFilter ignores no files.
+type IncludeFilter []string
+
+// Ignore implements FileFilter.
+func (f IncludeFilter) Ignore(file string) bool {
+	return len(f) > 0 && !PatternFilter(f).Ignore(file)
+}
+
+// generatedHeaderLines is how many leading lines are searched for a
+// generated-code header, matching GitHub Linguist.
+const generatedHeaderLines = 40
+
+// generatedHeaderRe matches the Go convention for generated files
+// (https://go.dev/s/generatedcode) and Linguist's "Code generated by" check.
+var generatedHeaderRe = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$|Code generated by`)
+
+// generatedSuffixes are file name suffixes Linguist treats as generated.
+var generatedSuffixes = []string{".pb.go", ".pb.gw.go"}
+
+// attributeState is the value of a gitattribute for a path.
+type attributeState int
+
+const (
+	attributeUnspecified attributeState = iota
+	attributeSet
+	attributeUnset
+)
+
+// gitAttributeRule is a .gitattributes line that mentions linguist-generated.
+type gitAttributeRule struct {
+	pattern string
+	state   attributeState
+}
+
+// GeneratedFileFilter ignores generated files, the way GitHub hides them in
+// PR diffs: files marked linguist-generated in .gitattributes, and otherwise
+// files Linguist's heuristics detect as generated (*.pb.go, or a
+// "Code generated ... DO NOT EDIT." header).
+// Marking a file -linguist-generated or linguist-generated=false keeps it
+// analyzed even if the heuristics match.
+type GeneratedFileFilter struct {
+	rules []gitAttributeRule
+	// read returns the contents of a file for header detection; nil skips it
+	read func(file string) ([]byte, error)
+}
+
+// NewGeneratedFileFilter creates a filter from a .gitattributes file's
+// contents (nil if the repository has none). read returns the contents of
+// a diff file for header detection; pass nil when sources are unavailable,
+// so only .gitattributes and file names are used.
+func NewGeneratedFileFilter(gitattributes []byte, read func(file string) ([]byte, error)) *GeneratedFileFilter {
+	return &GeneratedFileFilter{
+		rules: parseGitAttributes(gitattributes),
+		read:  read,
+	}
+}
+
+// LoadGeneratedFileFilter creates a filter for the repository checked out at
+// root, reading root/.gitattributes and source files under root.
+// Empty root uses the working directory.
+func LoadGeneratedFileFilter(root string) (*GeneratedFileFilter, error) {
+	data, err := os.ReadFile(filepath.Join(root, ".gitattributes"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return NewGeneratedFileFilter(data, func(file string) ([]byte, error) {
+		return os.ReadFile(filepath.Join(root, filepath.FromSlash(file)))
+	}), nil
+}
+
+// Ignore implements FileFilter.
+func (f *GeneratedFileFilter) Ignore(file string) bool {
+	switch f.attribute(file) {
+	case attributeSet:
+		return true
+	case attributeUnset:
+		return false
+	}
+
+	for _, suffix := range generatedSuffixes {
+		if strings.HasSuffix(file, suffix) {
+			return true
+		}
+	}
+	return f.hasGeneratedHeader(file)
+}
+
+// attribute returns the linguist-generated state of file. As in git, the
+// last matching line wins.
+func (f *GeneratedFileFilter) attribute(file string) attributeState {
+	state := attributeUnspecified
+	for _, rule := range f.rules {
+		if matchAttributePattern(rule.pattern, file) {
+			state = rule.state
+		}
+	}
+	return state
+}
+
+// hasGeneratedHeader reports whether the first lines of file carry a
+// generated-code header. Unreadable files are not generated.
+func (f *GeneratedFileFilter) hasGeneratedHeader(file string) bool {
+	if f.read == nil {
+		return false
+	}
+	data, err := f.read(file)
+	if err != nil {
+		return false
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for i := 0; i < generatedHeaderLines && scanner.Scan(); i++ {
+		if generatedHeaderRe.MatchString(strings.TrimRight(scanner.Text(), "\r")) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseGitAttributes extracts the linguist-generated rules from a
+// .gitattributes file. Other attributes, macros, and comments are skipped.
+func parseGitAttributes(data []byte) []gitAttributeRule {
+	var rules []gitAttributeRule
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// Negative patterns are not allowed in .gitattributes
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], "!") {
+			continue
+		}
+
+		for _, attr := range fields[1:] {
+			state, ok := parseLinguistGenerated(attr)
+			if ok {
+				rules = append(rules, gitAttributeRule{pattern: fields[0], state: state})
+			}
+		}
+	}
+	return rules
+}
+
+// parseLinguistGenerated parses a single attribute. ok is false if attr is
+// not linguist-generated.
+func parseLinguistGenerated(attr string) (state attributeState, ok bool) {
+	switch attr {
+	case "linguist-generated", "linguist-generated=true":
+		return attributeSet, true
+	case "-linguist-generated", "linguist-generated=false":
+		return attributeUnset, true
+	case "!linguist-generated":
+		return attributeUnspecified, true
+	}
+	return attributeUnspecified, false
+}
+
+// matchAttributePattern matches a root .gitattributes pattern against a
+// slash-separated path relative to the repository root. Patterns without a
+// slash match the file name at any depth; others are anchored at the root.
+// "**" matches any number of directories. Directory patterns ("dir/") never
+// match files, as in git.
+func matchAttributePattern(pattern, file string) bool {
+	if strings.HasSuffix(pattern, "/") {
+		return false
+	}
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(file))
+		return ok
+	}
+	return matchSegments(strings.Split(strings.TrimPrefix(pattern, "/"), "/"), strings.Split(file, "/"))
+}
+
+// matchSegments matches pattern segments against path segments.
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	ok, _ := path.Match(pattern[0], segments[0])
+	return ok && matchSegments(pattern[1:], segments[1:])
+}
@@ -0,0 +1,183 @@
+package coverage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchAttributePattern(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		file     string
+		expected bool
+	}{
+		{"*.gen.go", "api.gen.go", true},
+		{"*.gen.go", "internal/api/api.gen.go", true},
+		{"*.gen.go", "api.go", false},
+		{"mocks/*.go", "mocks/store.go", true},
+		{"mocks/*.go", "internal/mocks/store.go", false},
+		{"/mocks/*.go", "mocks/store.go", true},
+		{"**/mocks/*.go", "internal/mocks/store.go", true},
+		{"**/mocks/*.go", "mocks/store.go", true},
+		{"gen/**", "gen/a/b/c.go", true},
+		{"gen/**", "other/gen/c.go", false},
+		{"a/**/b.go", "a/b.go", true},
+		{"a/**/b.go", "a/x/y/b.go", true},
+		{"gen/", "gen/c.go", false},
+		{"zz_generated.*", "pkg/apis/zz_generated.deepcopy.go", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.file, func(t *testing.T) {
+			assert.Equal(t, tt.expected, matchAttributePattern(tt.pattern, tt.file))
+		})
+	}
+}
+
+func TestGeneratedFileFilter_Ignore(t *testing.T) {
+	gitattributes := []byte(`# Generated code
+*.gen.go linguist-generated=true
+/mocks/** linguist-generated
+api/*.pb.go -linguist-generated
+docs/** linguist-documentation
+legacy/** linguist-generated
+legacy/keep.go !linguist-generated
+*.txt text eol=lf
+`)
+	sources := map[string]string{
+		"server.go":        "package server\n",
+		"stringer.go":      "// Code generated by \"stringer -type=Kind\"; DO NOT EDIT.\n\npackage kinds\n",
+		"late_header.go":   "// Copyright 2024\n//\n// Code generated by sqlc. DO NOT EDIT.\npackage db\n",
+		"legacy/keep.go":   "package legacy\n",
+		"not_generated.go": "package x\n\n// This is not Code generated, it is handwritten.\n",
+	}
+	read := func(file string) ([]byte, error) {
+		data, ok := sources[file]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return []byte(data), nil
+	}
+
+	tests := []struct {
+		file     string
+		expected bool
+	}{
+		{"server.go", false},
+		{"internal/api/client.gen.go", true},
+		{"mocks/store.go", true},
+		{"internal/mocks/store.go", false},
+		{"proto/user.pb.go", true},
+		{"proto/user.pb.gw.go", true},
+		{"api/user.pb.go", false}, // Explicitly unset overrides the heuristic
+		{"docs/example.go", false},
+		{"legacy/old.go", true},
+		{"legacy/keep.go", false}, // Unspecified again, heuristics find nothing
+		{"stringer.go", true},
+		{"late_header.go", true},
+		{"not_generated.go", false},
+		{"missing.go", false},
+	}
+
+	filter := NewGeneratedFileFilter(gitattributes, read)
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			assert.Equal(t, tt.expected, filter.Ignore(tt.file))
+		})
+	}
+}
+
+func TestGeneratedFileFilter_NoReader(t *testing.T) {
+	filter := NewGeneratedFileFilter(nil, nil)
+
+	assert.True(t, filter.Ignore("user.pb.go"))
+	assert.False(t, filter.Ignore("stringer.go"))
+}
+
+func TestGeneratedFileFilter_ReadError(t *testing.T) {
+	filter := NewGeneratedFileFilter(nil, func(string) ([]byte, error) {
+		return nil, errors.New("permission denied")
+	})
+
+	assert.False(t, filter.Ignore("main.go"))
+}
+
+func TestLoadGeneratedFileFilter(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, ".gitattributes"), []byte("*.gen.go linguist-generated\n"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "pkg"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "pkg", "enum.go"), []byte("// Code generated by enumer. DO NOT EDIT.\npackage pkg\n"), 0644))
+
+	filter, err := LoadGeneratedFileFilter(root)
+	require.NoError(t, err)
+
+	assert.True(t, filter.Ignore("api.gen.go"))
+	assert.True(t, filter.Ignore("pkg/enum.go"))
+	assert.False(t, filter.Ignore("pkg/other.go"))
+
+	// A repository without .gitattributes still gets the heuristics
+	filter, err = LoadGeneratedFileFilter(t.TempDir())
+	require.NoError(t, err)
+	assert.True(t, filter.Ignore("user.pb.go"))
+}
+
+func TestFilterAddedLines(t *testing.T) {
+	added := map[string][]int{
+		"main.go":    {1, 2},
+		"user.pb.go": {3},
+		"api.gen.go": {4},
+	}
+	filter := NewGeneratedFileFilter([]byte("*.gen.go linguist-generated\n"), nil)
+
+	assert.Equal(t, map[string][]int{"main.go": {1, 2}}, FilterAddedLines(added, filter))
+	assert.Equal(t, added, FilterAddedLines(added))
+	assert.Len(t, added, 3, "input must not be modified")
+}
+
+func TestPatternFilter_Ignore(t *testing.T) {
+	filter := PatternFilter{"**/*_gen.go", "mocks/*", "doc.go"}
+
+	tests := []struct {
+		file     string
+		expected bool
+	}{
+		{"api/types_gen.go", true},
+		{"types_gen.go", true},
+		{"mocks/store.go", true},
+		{"internal/mocks/store.go", false},
+		{"internal/doc.go", true},
+		{"main.go", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			assert.Equal(t, tt.expected, filter.Ignore(tt.file))
+		})
+	}
+	assert.False(t, PatternFilter(nil).Ignore("main.go"))
+}
+
+func TestIncludeFilter_Ignore(t *testing.T) {
+	filter := IncludeFilter{"internal/**", "main.go"}
+
+	tests := []struct {
+		file     string
+		expected bool
+	}{
+		{"internal/api/handler.go", false},
+		{"main.go", false},
+		{"cmd/main.go", false},
+		{"cmd/server/server.go", true},
+		{"vendor/example.com/lib/lib.go", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			assert.Equal(t, tt.expected, filter.Ignore(tt.file))
+		})
+	}
+	assert.False(t, IncludeFilter(nil).Ignore("vendor/example.com/lib/lib.go"))
+}
@@ -0,0 +1,75 @@
+package coverage
+
+import (
+	"path"
+	"sort"
+)
+
+// MatchDiagnostics explains how coverage profiles were matched to diff files.
+// It answers "why didn't Canopy flag my file?" without reading the matcher source.
+type MatchDiagnostics struct {
+	// UnmatchedDiffFiles lists diff files that had no coverage profile
+	UnmatchedDiffFiles []UnmatchedDiffFile
+	// UnmatchedProfiles lists coverage profile filenames that matched no diff file
+	UnmatchedProfiles []string
+}
+
+// UnmatchedDiffFile describes a diff file for which no coverage profile was found.
+type UnmatchedDiffFile struct {
+	// File is the diff filename (relative to the repository root)
+	File string
+	// Candidates are profile filenames with the same base name that were
+	// considered for suffix matching but rejected
+	Candidates []string
+}
+
+// HasUnmatched returns true if any diff file or profile was left unmatched.
+func (d *MatchDiagnostics) HasUnmatched() bool {
+	return len(d.UnmatchedDiffFiles) > 0 || len(d.UnmatchedProfiles) > 0
+}
+
+// ExplainMatching reports which diff files and coverage profiles were left
+// unmatched by the same matcher AnalyzeCoverage uses (exact match, then suffix match).
+// Results are sorted by filename for consistent output.
+func ExplainMatching(profiles []*Profile, addedLinesByFile map[string][]int) *MatchDiagnostics {
+	diag := &MatchDiagnostics{}
+	matchedDiffFiles := make(map[string]bool)
+
+	for _, profile := range profiles {
+		diffFile, _, found := findMatchingDiffFile(profile, addedLinesByFile)
+		if !found {
+			diag.UnmatchedProfiles = append(diag.UnmatchedProfiles, profile.FileName)
+			continue
+		}
+		matchedDiffFiles[diffFile] = true
+	}
+
+	for diffFile := range addedLinesByFile {
+		if matchedDiffFiles[diffFile] {
+			continue
+		}
+
+		// Candidates are profiles that share the base name - the ones a reader
+		// would expect the suffix matcher to have picked up
+		var candidates []string
+		base := path.Base(diffFile)
+		for _, profile := range profiles {
+			if path.Base(profile.FileName) == base {
+				candidates = append(candidates, profile.FileName)
+			}
+		}
+		sort.Strings(candidates)
+
+		diag.UnmatchedDiffFiles = append(diag.UnmatchedDiffFiles, UnmatchedDiffFile{
+			File:       diffFile,
+			Candidates: candidates,
+		})
+	}
+
+	sort.Slice(diag.UnmatchedDiffFiles, func(i, j int) bool {
+		return diag.UnmatchedDiffFiles[i].File < diag.UnmatchedDiffFiles[j].File
+	})
+	sort.Strings(diag.UnmatchedProfiles)
+
+	return diag
+}
@@ -0,0 +1,101 @@
+package coverage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplainMatching(t *testing.T) {
+	tests := []struct {
+		name                 string
+		profiles             []*Profile
+		addedLinesByFile     map[string][]int
+		expectedDiffFiles    []UnmatchedDiffFile
+		expectedProfiles     []string
+		expectedHasUnmatched bool
+	}{
+		{
+			name: "all files matched",
+			profiles: []*Profile{
+				{FileName: "github.com/org/repo/main.go"},
+				{FileName: "github.com/org/repo/pkg/util.go"},
+			},
+			addedLinesByFile: map[string][]int{
+				"main.go":     {1},
+				"pkg/util.go": {2},
+			},
+			expectedHasUnmatched: false,
+		},
+		{
+			name: "diff file without profile and no candidates",
+			profiles: []*Profile{
+				{FileName: "github.com/org/repo/main.go"},
+			},
+			addedLinesByFile: map[string][]int{
+				"main.go":    {1},
+				"cmd/new.go": {1, 2},
+			},
+			expectedDiffFiles: []UnmatchedDiffFile{
+				{File: "cmd/new.go"},
+			},
+			expectedHasUnmatched: true,
+		},
+		{
+			name: "diff file with rejected suffix candidates",
+			profiles: []*Profile{
+				{FileName: "github.com/org/repo/internal/b/handler.go"},
+				{FileName: "github.com/org/repo/internal/a/handler.go"},
+			},
+			addedLinesByFile: map[string][]int{
+				"internal/c/handler.go": {5},
+			},
+			expectedDiffFiles: []UnmatchedDiffFile{
+				{
+					File: "internal/c/handler.go",
+					Candidates: []string{
+						"github.com/org/repo/internal/a/handler.go",
+						"github.com/org/repo/internal/b/handler.go",
+					},
+				},
+			},
+			expectedProfiles: []string{
+				"github.com/org/repo/internal/a/handler.go",
+				"github.com/org/repo/internal/b/handler.go",
+			},
+			expectedHasUnmatched: true,
+		},
+		{
+			name: "profiles outside the diff are reported sorted",
+			profiles: []*Profile{
+				{FileName: "github.com/org/repo/z.go"},
+				{FileName: "github.com/org/repo/main.go"},
+				{FileName: "github.com/org/repo/a.go"},
+			},
+			addedLinesByFile: map[string][]int{
+				"main.go": {1},
+			},
+			expectedProfiles: []string{
+				"github.com/org/repo/a.go",
+				"github.com/org/repo/z.go",
+			},
+			expectedHasUnmatched: true,
+		},
+		{
+			name:                 "no profiles and no diff files",
+			profiles:             nil,
+			addedLinesByFile:     map[string][]int{},
+			expectedHasUnmatched: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diag := ExplainMatching(tt.profiles, tt.addedLinesByFile)
+
+			assert.Equal(t, tt.expectedDiffFiles, diag.UnmatchedDiffFiles)
+			assert.Equal(t, tt.expectedProfiles, diag.UnmatchedProfiles)
+			assert.Equal(t, tt.expectedHasUnmatched, diag.HasUnmatched())
+		})
+	}
+}
@@ -12,8 +12,9 @@ import (
 // The algorithm:
 // 1. Groups profiles by file name
 // 2. For each file, merges all blocks using additive merging
-// 3. Uses the mode from the first profile (all profiles must use same mode)
-// 4. Returns merged profiles sorted by file name
+// 3. Splits and aligns blocks that overlap without matching exactly
+// 4. Uses the mode from the first profile (all profiles must use same mode)
+// 5. Returns merged profiles sorted by file name
 func MergeProfiles(profiles []*Profile) ([]*Profile, error) {
 	if len(profiles) == 0 {
 		return nil, fmt.Errorf("no profiles to merge")
@@ -111,10 +112,156 @@ func mergeFileProfiles(fileName, mode string, profiles []*Profile) *Profile {
 	return &Profile{
 		FileName: fileName,
 		Mode:     mode,
-		Blocks:   mergedBlocks,
+		Blocks:   alignOverlappingBlocks(mode, mergedBlocks),
 	}
 }
 
+// position is a line:column location in a source file.
+type position struct {
+	line int
+	col  int
+}
+
+func (p position) less(o position) bool {
+	if p.line != o.line {
+		return p.line < o.line
+	}
+	return p.col < o.col
+}
+
+func blockStart(b ProfileBlock) position { return position{b.StartLine, b.StartCol} }
+func blockEnd(b ProfileBlock) position   { return position{b.EndLine, b.EndCol} }
+
+// alignOverlappingBlocks resolves blocks that overlap without being identical,
+// which happens when profiles come from slightly different compilations
+// (e.g., inlining differences) and split the same code differently.
+// Blocks must be sorted by start position.
+//
+// Each cluster of overlapping blocks is cut at every block boundary into
+// non-overlapping segments. A segment's count merges the counts of all blocks
+// covering it, and each block's statements are spread over its segments in
+// proportion to the lines they span, so a segment reports the larger of the
+// estimates from the blocks covering it. Non-overlapping blocks are returned unchanged.
+func alignOverlappingBlocks(mode string, blocks []ProfileBlock) []ProfileBlock {
+	var result []ProfileBlock
+
+	for i := 0; i < len(blocks); {
+		// Grow the cluster while the next block starts before the cluster ends
+		clusterEnd := blockEnd(blocks[i])
+		j := i + 1
+		for j < len(blocks) && blockStart(blocks[j]).less(clusterEnd) {
+			if end := blockEnd(blocks[j]); clusterEnd.less(end) {
+				clusterEnd = end
+			}
+			j++
+		}
+
+		if j-i == 1 {
+			result = append(result, blocks[i])
+		} else {
+			result = append(result, splitCluster(mode, blocks[i:j])...)
+		}
+		i = j
+	}
+
+	return result
+}
+
+// splitCluster cuts a cluster of overlapping blocks into non-overlapping segments.
+func splitCluster(mode string, cluster []ProfileBlock) []ProfileBlock {
+	// Collect unique boundaries in order
+	var bounds []position
+	seen := make(map[position]bool)
+	for _, b := range cluster {
+		for _, p := range []position{blockStart(b), blockEnd(b)} {
+			if !seen[p] {
+				seen[p] = true
+				bounds = append(bounds, p)
+			}
+		}
+	}
+	sort.Slice(bounds, func(i, j int) bool { return bounds[i].less(bounds[j]) })
+
+	// Segment k spans bounds[k] to bounds[k+1]
+	segments := make([]ProfileBlock, len(bounds)-1)
+	covered := make([]bool, len(segments))
+	for k := range segments {
+		segments[k] = ProfileBlock{
+			StartLine: bounds[k].line,
+			StartCol:  bounds[k].col,
+			EndLine:   bounds[k+1].line,
+			EndCol:    bounds[k+1].col,
+		}
+	}
+
+	for _, b := range cluster {
+		// Find the segments this block covers
+		var idx []int
+		var weights []int
+		for k, seg := range segments {
+			if !blockStart(seg).less(blockStart(b)) && !blockEnd(b).less(blockEnd(seg)) {
+				idx = append(idx, k)
+				weights = append(weights, seg.EndLine-seg.StartLine+1)
+			}
+		}
+
+		stmts := distribute(b.NumStmt, weights)
+		for n, k := range idx {
+			if covered[k] {
+				segments[k].Count = mergeCount(mode, segments[k].Count, b.Count)
+			} else {
+				segments[k].Count = b.Count
+				covered[k] = true
+			}
+			if stmts[n] > segments[k].NumStmt {
+				segments[k].NumStmt = stmts[n]
+			}
+		}
+	}
+
+	// Drop gaps between blocks that no block covers
+	var result []ProfileBlock
+	for k, seg := range segments {
+		if covered[k] {
+			result = append(result, seg)
+		}
+	}
+	return result
+}
+
+// distribute splits total across weights using the largest remainder method,
+// so the parts always sum to total.
+func distribute(total int, weights []int) []int {
+	parts := make([]int, len(weights))
+	sum := 0
+	for _, w := range weights {
+		sum += w
+	}
+	if sum == 0 || total == 0 {
+		return parts
+	}
+
+	type remainder struct {
+		index int
+		value int
+	}
+	remainders := make([]remainder, len(weights))
+	assigned := 0
+	for i, w := range weights {
+		parts[i] = total * w / sum
+		assigned += parts[i]
+		remainders[i] = remainder{index: i, value: total * w % sum}
+	}
+
+	sort.SliceStable(remainders, func(i, j int) bool { return remainders[i].value > remainders[j].value })
+	for i := 0; assigned < total; i++ {
+		parts[remainders[i].index]++
+		assigned++
+	}
+
+	return parts
+}
+
 // blockKey uniquely identifies a coverage block by its position.
 type blockKey struct {
 	StartLine int
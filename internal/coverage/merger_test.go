@@ -542,3 +542,110 @@ func TestMergeEmptyCoverage(t *testing.T) {
 		assert.Empty(t, merged[0].Blocks)
 	})
 }
+
+func TestMergeProfiles_DifferentlySplitBlocks(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		blocksA  []ProfileBlock
+		blocksB  []ProfileBlock
+		expected []ProfileBlock
+	}{
+		{
+			name: "one block split in two by the other compilation",
+			mode: "count",
+			blocksA: []ProfileBlock{
+				{StartLine: 10, StartCol: 1, EndLine: 20, EndCol: 2, NumStmt: 4, Count: 3},
+			},
+			blocksB: []ProfileBlock{
+				{StartLine: 10, StartCol: 1, EndLine: 14, EndCol: 5, NumStmt: 2, Count: 1},
+				{StartLine: 14, StartCol: 5, EndLine: 20, EndCol: 2, NumStmt: 2, Count: 0},
+			},
+			expected: []ProfileBlock{
+				{StartLine: 10, StartCol: 1, EndLine: 14, EndCol: 5, NumStmt: 2, Count: 4},
+				{StartLine: 14, StartCol: 5, EndLine: 20, EndCol: 2, NumStmt: 2, Count: 3},
+			},
+		},
+		{
+			name: "partially overlapping blocks in set mode",
+			mode: "set",
+			blocksA: []ProfileBlock{
+				{StartLine: 1, StartCol: 1, EndLine: 5, EndCol: 1, NumStmt: 5, Count: 0},
+			},
+			blocksB: []ProfileBlock{
+				{StartLine: 3, StartCol: 1, EndLine: 7, EndCol: 1, NumStmt: 5, Count: 1},
+			},
+			expected: []ProfileBlock{
+				{StartLine: 1, StartCol: 1, EndLine: 3, EndCol: 1, NumStmt: 3, Count: 0},
+				{StartLine: 3, StartCol: 1, EndLine: 5, EndCol: 1, NumStmt: 3, Count: 1},
+				{StartLine: 5, StartCol: 1, EndLine: 7, EndCol: 1, NumStmt: 2, Count: 1},
+			},
+		},
+		{
+			name: "non-overlapping blocks are untouched",
+			mode: "set",
+			blocksA: []ProfileBlock{
+				{StartLine: 1, StartCol: 1, EndLine: 2, EndCol: 5, NumStmt: 1, Count: 1},
+			},
+			blocksB: []ProfileBlock{
+				{StartLine: 2, StartCol: 5, EndLine: 4, EndCol: 1, NumStmt: 2, Count: 0},
+			},
+			expected: []ProfileBlock{
+				{StartLine: 1, StartCol: 1, EndLine: 2, EndCol: 5, NumStmt: 1, Count: 1},
+				{StartLine: 2, StartCol: 5, EndLine: 4, EndCol: 1, NumStmt: 2, Count: 0},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, err := MergeProfiles([]*Profile{
+				{FileName: "main.go", Mode: tt.mode, Blocks: tt.blocksA},
+				{FileName: "main.go", Mode: tt.mode, Blocks: tt.blocksB},
+			})
+			require.NoError(t, err)
+			require.Len(t, merged, 1)
+			assert.Equal(t, tt.expected, merged[0].Blocks)
+		})
+	}
+}
+
+func TestAlignOverlappingBlocks_Nested(t *testing.T) {
+	// A long block overlaps two shorter blocks that leave gaps between them;
+	// the gaps are still covered by the long block.
+	aligned := alignOverlappingBlocks("set", []ProfileBlock{
+		{StartLine: 1, StartCol: 1, EndLine: 10, EndCol: 1, NumStmt: 4, Count: 1},
+		{StartLine: 2, StartCol: 1, EndLine: 3, EndCol: 1, NumStmt: 1, Count: 0},
+		{StartLine: 5, StartCol: 1, EndLine: 6, EndCol: 1, NumStmt: 1, Count: 0},
+	})
+
+	require.Len(t, aligned, 5)
+	for i, seg := range aligned {
+		assert.Equal(t, 1, seg.Count, "every segment is covered by the long block")
+		if i > 0 {
+			prevEnd := position{aligned[i-1].EndLine, aligned[i-1].EndCol}
+			assert.False(t, blockStart(seg).less(prevEnd), "segments must not overlap")
+		}
+	}
+}
+
+func TestDistribute(t *testing.T) {
+	tests := []struct {
+		name     string
+		total    int
+		weights  []int
+		expected []int
+	}{
+		{"even split", 4, []int{1, 1}, []int{2, 2}},
+		{"remainder goes to largest fraction", 5, []int{3, 2}, []int{3, 2}},
+		{"parts sum to total", 3, []int{1, 1, 1, 1}, []int{1, 1, 1, 0}},
+		{"zero total", 0, []int{1, 2}, []int{0, 0}},
+		{"zero weights", 3, []int{0, 0}, []int{0, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, distribute(tt.total, tt.weights))
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package coverage
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// vendorDir is the directory Go resolves vendored packages from.
+const vendorDir = "vendor/"
+
+// moduleReplace is a go.mod replace directive whose replacement is a
+// directory of the repository.
+type moduleReplace struct {
+	// module is the replaced module path
+	module string
+	// dir is the replacement directory, relative to the repository root
+	dir string
+}
+
+// PathNormalizer rewrites profile filenames that don't name a file by its
+// module path, so they still match files of the repository instead of
+// being dropped by the matcher:
+//   - filenames of vendored packages are stripped of everything up to and
+//     including "vendor/", leaving the package's import path
+//   - filenames in modules that go.mod replaces with a directory of the
+//     repository have the module path replaced with the directory
+//
+// A nil PathNormalizer only strips vendor prefixes.
+type PathNormalizer struct {
+	// replaces are sorted by module path length, longest first, so nested
+	// modules win over the modules containing them
+	replaces []moduleReplace
+}
+
+// NewPathNormalizer creates a normalizer from the contents of the
+// repository's root go.mod (nil if the repository has none). Replacements
+// with a module version or a directory outside the repository are ignored.
+func NewPathNormalizer(gomod []byte) *PathNormalizer {
+	n := &PathNormalizer{replaces: parseReplaces(gomod)}
+	sort.SliceStable(n.replaces, func(i, j int) bool {
+		return len(n.replaces[i].module) > len(n.replaces[j].module)
+	})
+	return n
+}
+
+// LoadPathNormalizer creates a normalizer for the repository checked out at
+// root, reading root/go.mod. Empty root uses the working directory.
+func LoadPathNormalizer(root string) (*PathNormalizer, error) {
+	data, err := os.ReadFile(filepath.Join(root, "go.mod"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return NewPathNormalizer(data), nil
+}
+
+// Normalize returns the filename profiles of fileName are matched by.
+func (n *PathNormalizer) Normalize(fileName string) string {
+	name := fileName
+	if strings.HasPrefix(name, vendorDir) {
+		name = name[len(vendorDir):]
+	}
+	if i := strings.LastIndex(name, "/"+vendorDir); i >= 0 {
+		name = name[i+len(vendorDir)+1:]
+	}
+	if n == nil {
+		return name
+	}
+
+	for _, r := range n.replaces {
+		if rest, ok := strings.CutPrefix(name, r.module+"/"); ok {
+			return path.Join(r.dir, rest)
+		}
+	}
+	return name
+}
+
+// NormalizeProfiles returns profiles with normalized filenames. Profiles
+// that end up with the same filename, e.g. a package covered both through
+// its module path and vendored, are merged.
+func (n *PathNormalizer) NormalizeProfiles(profiles []*Profile) ([]*Profile, error) {
+	changed := false
+	normalized := make([]*Profile, len(profiles))
+	for i, p := range profiles {
+		normalized[i] = p
+		if name := n.Normalize(p.FileName); name != p.FileName {
+			renamed := *p
+			renamed.FileName = name
+			normalized[i] = &renamed
+			changed = true
+		}
+	}
+	if !changed {
+		return profiles, nil
+	}
+	return MergeProfiles(normalized)
+}
+
+// parseReplaces returns the replace directives of a go.mod file that
+// replace a module, at any version, with a directory of the repository.
+func parseReplaces(gomod []byte) []moduleReplace {
+	var replaces []moduleReplace
+	inBlock := false
+	scanner := bufio.NewScanner(bytes.NewReader(gomod))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "//")
+		line = strings.TrimSpace(line)
+
+		switch {
+		case inBlock && line == ")":
+			inBlock = false
+			continue
+		case inBlock:
+		case line == "replace (" || line == "replace(":
+			inBlock = true
+			continue
+		case strings.HasPrefix(line, "replace "):
+			line = strings.TrimPrefix(line, "replace ")
+		default:
+			continue
+		}
+
+		if r, ok := parseReplace(line); ok {
+			replaces = append(replaces, r)
+		}
+	}
+	return replaces
+}
+
+// parseReplace parses the arguments of a replace directive, such as
+// "example.com/lib => ./lib". It reports false unless the replacement is
+// a directory of the repository.
+func parseReplace(line string) (moduleReplace, bool) {
+	old, replacement, ok := strings.Cut(line, "=>")
+	if !ok {
+		return moduleReplace{}, false
+	}
+	oldFields, newFields := strings.Fields(old), strings.Fields(replacement)
+	// A replacement with a version is a module, not a directory
+	if len(oldFields) == 0 || len(oldFields) > 2 || len(newFields) != 1 {
+		return moduleReplace{}, false
+	}
+
+	module, dir := unquote(oldFields[0]), unquote(newFields[0])
+	if !strings.HasPrefix(dir, "./") && !strings.HasPrefix(dir, "../") {
+		return moduleReplace{}, false
+	}
+	dir = path.Clean(dir)
+	if dir == ".." || strings.HasPrefix(dir, "../") {
+		return moduleReplace{}, false
+	}
+	return moduleReplace{module: module, dir: dir}, true
+}
+
+// unquote removes the quotes of a quoted go.mod token.
+func unquote(s string) string {
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		return unquoted
+	}
+	return s
+}
@@ -0,0 +1,96 @@
+package coverage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const normalizeGoMod = `module github.com/acme/widgets
+
+go 1.25
+
+require example.com/lib v1.2.0
+
+replace example.com/lib => ./third_party/lib // patched
+
+replace (
+	"example.com/lib/nested" v1.0.0 => ./nested
+	example.com/fork => example.com/upstream v1.0.0
+	example.com/outside => ../outside
+)
+`
+
+func TestPathNormalizer_Normalize(t *testing.T) {
+	n := NewPathNormalizer([]byte(normalizeGoMod))
+
+	tests := []struct {
+		name     string
+		file     string
+		expected string
+	}{
+		{"module path is unchanged", "github.com/acme/widgets/calc.go", "github.com/acme/widgets/calc.go"},
+		{"vendor prefix", "vendor/github.com/acme/widgets/calc.go", "github.com/acme/widgets/calc.go"},
+		{"vendor directory in path", "github.com/acme/app/vendor/github.com/acme/widgets/calc.go", "github.com/acme/widgets/calc.go"},
+		{"vendor-like name", "github.com/acme/widgets/vendors/calc.go", "github.com/acme/widgets/vendors/calc.go"},
+		{"replaced module", "example.com/lib/pkg/lib.go", "third_party/lib/pkg/lib.go"},
+		{"vendored replaced module", "vendor/example.com/lib/lib.go", "third_party/lib/lib.go"},
+		{"nested module wins", "example.com/lib/nested/n.go", "nested/n.go"},
+		{"module path prefix only", "example.com/library/lib.go", "example.com/library/lib.go"},
+		{"replacement with a version", "example.com/fork/f.go", "example.com/fork/f.go"},
+		{"replacement outside the repository", "example.com/outside/o.go", "example.com/outside/o.go"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, n.Normalize(tt.file))
+		})
+	}
+
+	t.Run("nil normalizer only strips vendor prefixes", func(t *testing.T) {
+		var n *PathNormalizer
+		assert.Equal(t, "example.com/lib/lib.go", n.Normalize("vendor/example.com/lib/lib.go"))
+	})
+}
+
+func TestPathNormalizer_NormalizeProfiles(t *testing.T) {
+	n := NewPathNormalizer([]byte(normalizeGoMod))
+
+	t.Run("unchanged profiles are returned as is", func(t *testing.T) {
+		profiles := []*Profile{{FileName: "github.com/acme/widgets/calc.go", Mode: "set"}}
+		got, err := n.NormalizeProfiles(profiles)
+		require.NoError(t, err)
+		assert.Same(t, profiles[0], got[0])
+	})
+
+	t.Run("profiles of the same file are merged", func(t *testing.T) {
+		profiles := []*Profile{
+			{FileName: "github.com/acme/widgets/calc.go", Mode: "set", Blocks: []ProfileBlock{{StartLine: 1, EndLine: 2, NumStmt: 1, Count: 0}}},
+			{FileName: "vendor/github.com/acme/widgets/calc.go", Mode: "set", Blocks: []ProfileBlock{{StartLine: 1, EndLine: 2, NumStmt: 1, Count: 1}}},
+			{FileName: "example.com/lib/lib.go", Mode: "set", Blocks: []ProfileBlock{{StartLine: 3, EndLine: 4, NumStmt: 1, Count: 1}}},
+		}
+		got, err := n.NormalizeProfiles(profiles)
+		require.NoError(t, err)
+		require.Len(t, got, 2)
+		assert.Equal(t, "github.com/acme/widgets/calc.go", got[0].FileName)
+		assert.Equal(t, 1, got[0].Blocks[0].Count)
+		assert.Equal(t, "third_party/lib/lib.go", got[1].FileName)
+		// Inputs are not modified
+		assert.Equal(t, "vendor/github.com/acme/widgets/calc.go", profiles[1].FileName)
+	})
+}
+
+func TestLoadPathNormalizer(t *testing.T) {
+	dir := t.TempDir()
+	n, err := LoadPathNormalizer(dir)
+	require.NoError(t, err)
+	assert.Equal(t, "example.com/lib/lib.go", n.Normalize("example.com/lib/lib.go"))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte(normalizeGoMod), 0o644))
+	n, err = LoadPathNormalizer(dir)
+	require.NoError(t, err)
+	assert.Equal(t, "third_party/lib/lib.go", n.Normalize("example.com/lib/lib.go"))
+}
@@ -4,6 +4,7 @@ import (
 	"archive/zip"
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
@@ -69,27 +70,68 @@ func ParseProfiles(data []byte) ([]*Profile, error) {
 	return result, nil
 }
 
-// ParseProfilesFromFile parses coverage data from a file path.
-// This is primarily used when reading coverage files directly.
+// ParseProfilesFromFile parses coverage data read from a file path.
+// The format is detected from the data, so callers don't need to know it upfront.
 func ParseProfilesFromFile(path string, data []byte) ([]*Profile, error) {
-	return ParseProfiles(data)
+	return ParseProfilesAs(data, FormatAuto)
+}
+
+// ErrSizeLimit is returned by ParseProfilesFromZipLimit when a coverage file
+// in the archive decompresses to more than the limit.
+var ErrSizeLimit = errors.New("coverage file exceeds size limit")
+
+// SkippedFile is a coverage file of an archive that couldn't be parsed.
+type SkippedFile struct {
+	// Name is the file's path in the archive, or "GOCOVERDIR" for
+	// GOCOVERDIR files, which are decoded together
+	Name string
+	Err  error
 }
 
 // ParseProfilesFromZip extracts and parses all coverage files from a zip archive.
-// It looks for files matching common coverage patterns (*.out, *.cov, coverage.txt).
-// Returns all parsed profiles from all coverage files found in the archive.
+// It looks for files matching common coverage patterns (*.out, *.cov,
+// coverage.txt, *.info, *.xml) and detects the format of each one (Go, lcov,
+// Cobertura, or JaCoCo), so archives mixing formats are handled: files that
+// can't be parsed are skipped rather than failing the archive, and listed
+// in the error if no file is left. GOCOVERDIR files (covmeta.*,
+// covcounters.*) anywhere in the archive are decoded together (see
+// ParseGoCoverData).
+// Returns the profiles of all coverage files found in the archive, merged.
 func ParseProfilesFromZip(zipData []byte) ([]*Profile, error) {
-	if len(zipData) == 0 {
-		return nil, fmt.Errorf("zip data is empty")
+	profiles, _, err := ParseProfilesFromZipLimit(zipData, -1)
+	return profiles, err
+}
+
+// ParseProfilesFromZipLimit is like ParseProfilesFromZip, but also returns
+// the files it skipped, and returns ErrSizeLimit (wrapped) if a coverage
+// file needs more than limit bytes.
+// Go text profiles are streamed into a Merger, so the limit applies to the
+// blocks they merge to; other files are read whole, and decompression stops
+// at the limit, so archives that expand to huge files (zip bombs) are
+// rejected without holding them in memory. A negative limit disables the
+// check.
+func ParseProfilesFromZipLimit(zipData []byte, limit int64) ([]*Profile, []SkippedFile, error) {
+	return ParseProfilesFromZipReader(bytes.NewReader(zipData), int64(len(zipData)), limit)
+}
+
+// ParseProfilesFromZipReader is like ParseProfilesFromZipLimit, but reads
+// the archive of the given size from r, such as a file too large to hold
+// in memory.
+func ParseProfilesFromZipReader(r io.ReaderAt, size, limit int64) ([]*Profile, []SkippedFile, error) {
+	if size == 0 {
+		return nil, nil, fmt.Errorf("zip data is empty")
 	}
 
 	// Create a reader for the zip data
-	reader, err := zip.NewReader(bytes.NewReader(zipData), int64(len(zipData)))
+	reader, err := zip.NewReader(r, size)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read zip archive: %w", err)
+		return nil, nil, fmt.Errorf("failed to read zip archive: %w", err)
 	}
 
-	var allProfiles []*Profile
+	merger := NewMerger()
+	merger.Limit = limit
+	var goCoverData [][]byte
+	var skipped []SkippedFile
 
 	// Iterate through files in the archive
 	for _, file := range reader.File {
@@ -100,52 +142,134 @@ func ParseProfilesFromZip(zipData []byte) ([]*Profile, error) {
 
 		// Check if this is a coverage file based on naming patterns
 		name := strings.ToLower(file.Name)
-		if !isCoverageFile(name) {
+		coverData := IsGoCoverDataFile(file.Name)
+		if !coverData && !isCoverageFile(name) {
 			continue
 		}
 
-		// Open the file
-		rc, err := file.Open()
-		if err != nil {
-			return nil, fmt.Errorf("failed to open file %s in archive: %w", file.Name, err)
+		profiles, data, err := readZipCoverageFile(file, coverData, limit)
+		if errors.Is(err, ErrSizeLimit) {
+			return nil, nil, err
 		}
-
-		// Read the contents
-		data, err := io.ReadAll(rc)
-		rc.Close()
 		if err != nil {
-			return nil, fmt.Errorf("failed to read file %s from archive: %w", file.Name, err)
+			// Skip malformed files, so the others still count
+			skipped = append(skipped, SkippedFile{Name: file.Name, Err: err})
+			continue
 		}
 
-		// Skip empty files
-		if len(data) == 0 {
+		// GOCOVERDIR files are only meaningful together
+		if coverData {
+			if len(data) > 0 {
+				goCoverData = append(goCoverData, data)
+			}
 			continue
 		}
 
-		// Parse the coverage data
-		profiles, err := ParseProfiles(data)
+		if profiles != nil {
+			if err := merger.Merge(profiles); err != nil {
+				return nil, nil, fmt.Errorf("failed to merge %s: %w", file.Name, err)
+			}
+		}
+	}
+
+	if len(goCoverData) > 0 {
+		// Like malformed text files, undecodable GOCOVERDIR data is skipped
+		profiles, err := ParseGoCoverData(goCoverData)
 		if err != nil {
-			// Log but don't fail on individual file parse errors
-			// This allows partial success if some files are malformed
-			continue
+			skipped = append(skipped, SkippedFile{Name: "GOCOVERDIR", Err: fmt.Errorf("failed to decode GOCOVERDIR data: %w", err)})
+		} else if err := merger.Add(profiles...); err != nil {
+			return nil, nil, fmt.Errorf("failed to merge GOCOVERDIR data: %w", err)
 		}
+	}
+
+	allProfiles, err := merger.Profiles()
+	if err != nil {
+		if len(skipped) > 0 {
+			errs := make([]error, len(skipped))
+			for i, s := range skipped {
+				errs[i] = s.Err
+			}
+			return nil, nil, fmt.Errorf("no valid coverage files found in archive: %w", errors.Join(errs...))
+		}
+		return nil, nil, fmt.Errorf("no valid coverage files found in archive")
+	}
+
+	return allProfiles, skipped, nil
+}
 
-		allProfiles = append(allProfiles, profiles...)
+// readZipCoverageFile reads a coverage file from an archive. Go text
+// profiles are streamed into a Merger of their own, so a malformed file
+// leaves nothing behind; GOCOVERDIR files and other formats are read whole,
+// GOCOVERDIR files returned as data. Empty files return neither.
+func readZipCoverageFile(file *zip.File, coverData bool, limit int64) (*Merger, []byte, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open file %s in archive: %w", file.Name, err)
+	}
+	defer rc.Close()
+
+	br := bufio.NewReaderSize(rc, sniffLimit)
+	head, err := br.Peek(sniffLimit)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return nil, nil, fmt.Errorf("failed to read file %s from archive: %w", file.Name, err)
+	}
+	if len(head) == 0 {
+		return nil, nil, nil
+	}
+
+	if format := DetectFormat(head); !coverData && (format == FormatGo || format == FormatUnknown) {
+		m := NewMerger()
+		m.Limit = limit
+		if err := m.AddFrom(br, FormatGo); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse %s: %w", file.Name, err)
+		}
+		return m, nil, nil
 	}
 
-	if len(allProfiles) == 0 {
-		return nil, fmt.Errorf("no valid coverage files found in archive")
+	// Reject files declared over the limit before decompressing them
+	if limit >= 0 && file.UncompressedSize64 > uint64(limit) {
+		return nil, nil, fmt.Errorf("%w: %s is %d bytes, limit is %d", ErrSizeLimit, file.Name, file.UncompressedSize64, limit)
 	}
 
-	return allProfiles, nil
+	// Read the contents, one byte past the limit to detect exceeding it
+	var r io.Reader = br
+	if limit >= 0 {
+		r = io.LimitReader(br, limit+1)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read file %s from archive: %w", file.Name, err)
+	}
+	if limit >= 0 && int64(len(data)) > limit {
+		return nil, nil, fmt.Errorf("%w: %s is more than %d bytes", ErrSizeLimit, file.Name, limit)
+	}
+	if coverData {
+		return nil, data, nil
+	}
+
+	// Parse the coverage data in whichever format it is
+	profiles, err := ParseProfilesAs(data, FormatAuto)
+	if err != nil {
+		return nil, nil, err
+	}
+	m := NewMerger()
+	if err := m.Add(profiles...); err != nil {
+		return nil, nil, err
+	}
+	return m, nil, nil
 }
 
-// isCoverageFile checks if a filename matches common coverage file patterns.
+// isCoverageFile checks if a filename matches common coverage file patterns:
+// Go profiles, lcov tracefiles (lcov.info), and Cobertura or JaCoCo XML
+// reports. Other XML files, such as JUnit reports, are picked up too, and
+// skipped once their format isn't recognized.
 func isCoverageFile(name string) bool {
 	return strings.HasSuffix(name, ".out") ||
 		strings.HasSuffix(name, ".cov") ||
 		strings.HasSuffix(name, "coverage.txt") ||
-		strings.Contains(name, "coverage") && strings.HasSuffix(name, ".txt")
+		strings.Contains(name, "coverage") && strings.HasSuffix(name, ".txt") ||
+		strings.HasSuffix(name, ".info") ||
+		strings.HasSuffix(name, ".xml")
 }
 
 // ValidateProfile checks if a coverage profile is well-formed.
@@ -204,19 +328,23 @@ func validateBlock(b ProfileBlock, index int) error {
 
 // SerializeProfiles converts profiles back to standard Go coverage format.
 // This is used when saving merged coverage data.
+// A coverage file has a single mode, so profiles of different modes are
+// rejected rather than labeled with the first one; see
+// SerializeProfilesByMode. Profiles without a mode are in "set" mode.
 func SerializeProfiles(profiles []*Profile) ([]byte, error) {
 	if len(profiles) == 0 {
 		return nil, fmt.Errorf("no profiles to serialize")
 	}
 
+	mode := serializedMode(profiles[0])
+	for i, p := range profiles {
+		if m := serializedMode(p); m != mode {
+			return nil, fmt.Errorf("cannot serialize mixed modes: profile %d (%s) has mode %q, expected %q", i, p.FileName, m, mode)
+		}
+	}
+
 	var buf bytes.Buffer
 	writer := bufio.NewWriter(&buf)
-
-	// Write header with mode from first profile
-	mode := profiles[0].Mode
-	if mode == "" {
-		mode = "set" // default mode
-	}
 	fmt.Fprintf(writer, "mode: %s\n", mode)
 
 	// Write each profile
@@ -236,3 +364,34 @@ func SerializeProfiles(profiles []*Profile) ([]byte, error) {
 
 	return buf.Bytes(), nil
 }
+
+// SerializeProfilesByMode serializes profiles of different modes into one
+// coverage file per mode, keyed by mode.
+func SerializeProfilesByMode(profiles []*Profile) (map[string][]byte, error) {
+	if len(profiles) == 0 {
+		return nil, fmt.Errorf("no profiles to serialize")
+	}
+
+	byMode := make(map[string][]*Profile)
+	for _, p := range profiles {
+		mode := serializedMode(p)
+		byMode[mode] = append(byMode[mode], p)
+	}
+	outputs := make(map[string][]byte, len(byMode))
+	for mode, group := range byMode {
+		data, err := SerializeProfiles(group)
+		if err != nil {
+			return nil, err
+		}
+		outputs[mode] = data
+	}
+	return outputs, nil
+}
+
+// serializedMode returns the mode a profile is serialized with.
+func serializedMode(p *Profile) string {
+	if p.Mode == "" {
+		return "set" // default mode
+	}
+	return p.Mode
+}
@@ -207,6 +207,34 @@ func TestParseProfilesFromZip(t *testing.T) {
 	}
 }
 
+func TestParseProfilesFromZipLimit(t *testing.T) {
+	data := loadTestFixture(t, "valid_archive.zip")
+
+	tests := []struct {
+		name    string
+		limit   int64
+		wantErr error
+	}{
+		{name: "no limit", limit: -1},
+		{name: "within limit", limit: 1 << 20},
+		{name: "file over limit", limit: 10, wantErr: ErrSizeLimit},
+		{name: "zero limit", limit: 0, wantErr: ErrSizeLimit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profiles, skipped, err := ParseProfilesFromZipLimit(data, tt.limit)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.NotEmpty(t, profiles)
+			assert.Empty(t, skipped)
+		})
+	}
+}
+
 func TestIsCoverageFile(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -221,6 +249,9 @@ func TestIsCoverageFile(t *testing.T) {
 		{"go source file", "main.go", false},
 		{"no extension", "coverage", false},
 		{"json file", "coverage.json", false},
+		{"lcov tracefile", "lcov.info", true},
+		{"cobertura report", "coverage.xml", true},
+		{"jacoco report", "jacoco/jacocoTestReport.xml", true},
 	}
 
 	for _, tt := range tests {
@@ -453,6 +484,25 @@ func TestSerializeProfiles(t *testing.T) {
 				assert.Equal(t, "set", profiles[0].Mode)
 			},
 		},
+		{
+			name: "mixed modes",
+			profiles: []*Profile{
+				{FileName: "file1.go", Mode: "set", Blocks: []ProfileBlock{{StartLine: 1, StartCol: 1, EndLine: 2, EndCol: 2, NumStmt: 1, Count: 1}}},
+				{FileName: "file2.go", Mode: "count", Blocks: []ProfileBlock{{StartLine: 1, StartCol: 1, EndLine: 2, EndCol: 2, NumStmt: 1, Count: 3}}},
+			},
+			wantErr:     true,
+			errContains: `cannot serialize mixed modes: profile 1 (file2.go) has mode "count", expected "set"`,
+		},
+		{
+			name: "empty mode matches set",
+			profiles: []*Profile{
+				{FileName: "file1.go", Mode: "", Blocks: []ProfileBlock{{StartLine: 1, StartCol: 1, EndLine: 2, EndCol: 2, NumStmt: 1, Count: 1}}},
+				{FileName: "file2.go", Mode: "set", Blocks: []ProfileBlock{{StartLine: 1, StartCol: 1, EndLine: 2, EndCol: 2, NumStmt: 1, Count: 0}}},
+			},
+			validate: func(t *testing.T, data []byte) {
+				assert.Equal(t, "mode: set\nfile1.go:1.1,2.2 1 1\nfile2.go:1.1,2.2 1 0\n", string(data))
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -477,6 +527,22 @@ func TestSerializeProfiles(t *testing.T) {
 	}
 }
 
+func TestSerializeProfilesByMode(t *testing.T) {
+	outputs, err := SerializeProfilesByMode([]*Profile{
+		{FileName: "file1.go", Mode: "atomic", Blocks: []ProfileBlock{{StartLine: 1, StartCol: 1, EndLine: 2, EndCol: 2, NumStmt: 1, Count: 4}}},
+		{FileName: "file2.go", Blocks: []ProfileBlock{{StartLine: 3, StartCol: 1, EndLine: 4, EndCol: 2, NumStmt: 2, Count: 1}}},
+		{FileName: "file3.go", Mode: "atomic", Blocks: []ProfileBlock{{StartLine: 5, StartCol: 1, EndLine: 6, EndCol: 2, NumStmt: 1, Count: 0}}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]byte{
+		"atomic": []byte("mode: atomic\nfile1.go:1.1,2.2 1 4\nfile3.go:5.1,6.2 1 0\n"),
+		"set":    []byte("mode: set\nfile2.go:3.1,4.2 2 1\n"),
+	}, outputs)
+
+	_, err = SerializeProfilesByMode(nil)
+	assert.EqualError(t, err, "no profiles to serialize")
+}
+
 func TestParseAndSerializeRoundTrip(t *testing.T) {
 	// Load a valid coverage file
 	data := loadTestFixture(t, "valid_single.out")
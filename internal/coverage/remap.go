@@ -0,0 +1,203 @@
+package coverage
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// LineMap maps the lines of the files changed by a diff to their numbers
+// after it. It remaps coverage generated at an older commit than the one
+// analyzed, such as coverage of a re-run of a workflow after the PR was
+// pushed to again.
+type LineMap struct {
+	// files are keyed by their path before the diff
+	files map[string]*fileLineMap
+}
+
+type fileLineMap struct {
+	newName string
+	deleted bool
+	hunks   []lineHunk
+}
+
+// lineHunk is a hunk of a diff, replacing the old lines [oldStart, oldEnd).
+type lineHunk struct {
+	oldStart, oldEnd int
+	// context maps the unchanged old lines of the hunk to their new lines
+	context map[int]int
+	// shift is added to the old lines following the hunk
+	shift int
+}
+
+var (
+	lineMapHeaderRe = regexp.MustCompile(`^diff --git a/(.+) b/(.+)$`)
+	lineMapHunkRe   = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+)
+
+// ParseLineMap parses a unified diff, as returned by the GitHub compare
+// API, into a LineMap.
+func ParseLineMap(diffData []byte) (*LineMap, error) {
+	m := &LineMap{files: make(map[string]*fileLineMap)}
+	scanner := bufio.NewScanner(bytes.NewReader(diffData))
+	scanner.Buffer(nil, 1<<20)
+
+	var file *fileLineMap
+	var hunk *lineHunk
+	var oldLine, newLine, oldLeft, newLeft int
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// Hunk content is consumed by count, so removed "---" lines and
+		// added "+++" lines aren't mistaken for file headers
+		if hunk != nil && (oldLeft > 0 || newLeft > 0) {
+			switch {
+			case line == "" || line[0] == ' ':
+				hunk.context[oldLine] = newLine
+				oldLine, newLine = oldLine+1, newLine+1
+				oldLeft, newLeft = oldLeft-1, newLeft-1
+			case line[0] == '-':
+				oldLine, oldLeft = oldLine+1, oldLeft-1
+			case line[0] == '+':
+				newLine, newLeft = newLine+1, newLeft-1
+			}
+			continue
+		}
+
+		if matches := lineMapHeaderRe.FindStringSubmatch(line); matches != nil {
+			file = &fileLineMap{newName: matches[2]}
+			hunk = nil
+			m.files[matches[1]] = file
+			continue
+		}
+		if file == nil {
+			continue
+		}
+		if strings.HasPrefix(line, "deleted file mode") {
+			file.deleted = true
+			continue
+		}
+
+		matches := lineMapHunkRe.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+		oldStart, oldCount, err := parseHunkRange(matches[1], matches[2])
+		if err != nil {
+			return nil, err
+		}
+		newStart, newCount, err := parseHunkRange(matches[3], matches[4])
+		if err != nil {
+			return nil, err
+		}
+		file.hunks = append(file.hunks, lineHunk{
+			oldStart: oldStart,
+			oldEnd:   oldStart + oldCount,
+			context:  make(map[int]int),
+			shift:    (newStart + newCount) - (oldStart + oldCount),
+		})
+		hunk = &file.hunks[len(file.hunks)-1]
+		oldLine, newLine, oldLeft, newLeft = oldStart, newStart, oldCount, newCount
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading diff: %w", err)
+	}
+	return m, nil
+}
+
+// parseHunkRange parses the start and line count of one side of a hunk
+// header. An empty range starts after the line it names, so the start
+// returned is the first line following the hunk either way.
+func parseHunkRange(start, count string) (int, int, error) {
+	s, err := strconv.Atoi(start)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid hunk header start: %s", start)
+	}
+	if count == "" {
+		return s, 1, nil
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid hunk header count: %s", count)
+	}
+	if n == 0 {
+		s++
+	}
+	return s, n, nil
+}
+
+// line returns the new number of an old line, or false if the diff removed
+// or replaced it.
+func (f *fileLineMap) line(old int) (int, bool) {
+	shift := 0
+	for _, h := range f.hunks {
+		if old < h.oldStart {
+			break
+		}
+		if old < h.oldEnd {
+			n, ok := h.context[old]
+			return n, ok
+		}
+		shift = h.shift
+	}
+	return old + shift, true
+}
+
+// RemapProfiles returns the profiles with their blocks moved to the lines
+// they occupy after the diff, and files renamed by the diff renamed.
+// Blocks overlapping lines the diff removed, replaced, or inserted lines
+// into are dropped, as are the profiles of deleted files, since their
+// coverage is unknown after the diff; the number of blocks dropped is
+// returned as well. Profiles of files the diff doesn't change are returned
+// as is, and the input profiles are not modified.
+func (m *LineMap) RemapProfiles(profiles []*Profile) ([]*Profile, int) {
+	remapped := make([]*Profile, 0, len(profiles))
+	dropped := 0
+	for _, p := range profiles {
+		oldName, file := m.find(p.FileName)
+		if file == nil {
+			remapped = append(remapped, p)
+			continue
+		}
+		if file.deleted {
+			dropped += len(p.Blocks)
+			continue
+		}
+
+		np := &Profile{
+			FileName: strings.TrimSuffix(p.FileName, oldName) + file.newName,
+			Mode:     p.Mode,
+			Blocks:   make([]ProfileBlock, 0, len(p.Blocks)),
+		}
+		for _, b := range p.Blocks {
+			start, okStart := file.line(b.StartLine)
+			end, okEnd := file.line(b.EndLine)
+			if !okStart || !okEnd || end-start != b.EndLine-b.StartLine {
+				dropped++
+				continue
+			}
+			b.StartLine, b.EndLine = start, end
+			np.Blocks = append(np.Blocks, b)
+		}
+		remapped = append(remapped, np)
+	}
+	return remapped, dropped
+}
+
+// find returns the file of the diff a coverage profile belongs to, matching
+// the diff's repository-relative paths against the end of the profile's
+// import path, and its path before the diff.
+func (m *LineMap) find(profileFile string) (string, *fileLineMap) {
+	if file, ok := m.files[profileFile]; ok {
+		return profileFile, file
+	}
+	for oldName, file := range m.files {
+		if strings.HasSuffix(profileFile, "/"+oldName) {
+			return oldName, file
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,117 @@
+package coverage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const remapDiff = `diff --git a/calc.go b/calc.go
+index 1111111..2222222 100644
+--- a/calc.go
++++ b/calc.go
+@@ -3,4 +3,6 @@ import "fmt"
+ line3
++new4
++new5
+ line4
+-line5
++line5b
+ line6
+@@ -20,2 +22 @@ func Add(a, b int) int {
+ line20
+-line21
+diff --git a/old.go b/renamed.go
+similarity index 90%
+rename from old.go
+rename to renamed.go
+index 3333333..4444444 100644
+--- a/old.go
++++ b/renamed.go
+@@ -0,0 +1 @@
++// Package x does things.
+diff --git a/gone.go b/gone.go
+deleted file mode 100644
+index 5555555..0000000
+--- a/gone.go
++++ /dev/null
+@@ -1,2 +0,0 @@
+-package x
+--- a removed line that looks like a header
+`
+
+func TestLineMap_RemapProfiles(t *testing.T) {
+	m, err := ParseLineMap([]byte(remapDiff))
+	require.NoError(t, err)
+
+	untouched := &Profile{FileName: "github.com/acme/widgets/util.go", Mode: "set", Blocks: []ProfileBlock{{StartLine: 5, EndLine: 6, NumStmt: 1, Count: 1}}}
+	profiles := []*Profile{
+		{FileName: "github.com/acme/widgets/calc.go", Mode: "set", Blocks: []ProfileBlock{
+			{StartLine: 1, StartCol: 5, EndLine: 2, EndCol: 10, NumStmt: 1, Count: 1},
+			{StartLine: 3, StartCol: 1, EndLine: 4, EndCol: 2, NumStmt: 2, Count: 1}, // lines inserted inside
+			{StartLine: 5, StartCol: 1, EndLine: 5, EndCol: 9, NumStmt: 1, Count: 0}, // replaced
+			{StartLine: 6, StartCol: 1, EndLine: 6, EndCol: 5, NumStmt: 1, Count: 1},
+			{StartLine: 8, StartCol: 1, EndLine: 10, EndCol: 2, NumStmt: 2, Count: 0},
+			{StartLine: 20, StartCol: 1, EndLine: 20, EndCol: 9, NumStmt: 1, Count: 1},
+			{StartLine: 21, StartCol: 1, EndLine: 22, EndCol: 2, NumStmt: 1, Count: 1}, // removed
+			{StartLine: 30, StartCol: 1, EndLine: 31, EndCol: 1, NumStmt: 1, Count: 3},
+		}},
+		{FileName: "github.com/acme/widgets/old.go", Mode: "set", Blocks: []ProfileBlock{{StartLine: 1, StartCol: 1, EndLine: 1, EndCol: 9, NumStmt: 1, Count: 1}}},
+		{FileName: "github.com/acme/widgets/gone.go", Mode: "set", Blocks: []ProfileBlock{{StartLine: 1, EndLine: 2, NumStmt: 1}}},
+		untouched,
+	}
+
+	remapped, dropped := m.RemapProfiles(profiles)
+	assert.Equal(t, 4, dropped)
+	require.Len(t, remapped, 3)
+	assert.Equal(t, &Profile{FileName: "github.com/acme/widgets/calc.go", Mode: "set", Blocks: []ProfileBlock{
+		{StartLine: 1, StartCol: 5, EndLine: 2, EndCol: 10, NumStmt: 1, Count: 1},
+		{StartLine: 8, StartCol: 1, EndLine: 8, EndCol: 5, NumStmt: 1, Count: 1},
+		{StartLine: 10, StartCol: 1, EndLine: 12, EndCol: 2, NumStmt: 2, Count: 0},
+		{StartLine: 22, StartCol: 1, EndLine: 22, EndCol: 9, NumStmt: 1, Count: 1},
+		{StartLine: 31, StartCol: 1, EndLine: 32, EndCol: 1, NumStmt: 1, Count: 3},
+	}}, remapped[0])
+	assert.Equal(t, &Profile{FileName: "github.com/acme/widgets/renamed.go", Mode: "set", Blocks: []ProfileBlock{
+		{StartLine: 2, StartCol: 1, EndLine: 2, EndCol: 9, NumStmt: 1, Count: 1},
+	}}, remapped[1])
+	assert.Same(t, untouched, remapped[2])
+
+	// The input is left as is
+	assert.Len(t, profiles[0].Blocks, 8)
+	assert.Equal(t, 3, profiles[0].Blocks[1].StartLine)
+}
+
+func TestParseLineMap(t *testing.T) {
+	tests := []struct {
+		name    string
+		diff    string
+		old     int
+		want    int
+		wantOK  bool
+		wantErr bool
+	}{
+		{name: "before hunks", diff: "diff --git a/a.go b/a.go\n@@ -10,1 +10,2 @@\n x\n+y\n", old: 9, want: 9, wantOK: true},
+		{name: "context in hunk", diff: "diff --git a/a.go b/a.go\n@@ -10,2 +10,3 @@\n x\n+y\n z\n", old: 11, want: 12, wantOK: true},
+		{name: "after hunks", diff: "diff --git a/a.go b/a.go\n@@ -10,2 +10,1 @@\n x\n-y\n", old: 40, want: 39, wantOK: true},
+		{name: "removed line", diff: "diff --git a/a.go b/a.go\n@@ -10,2 +10,1 @@\n x\n-y\n", old: 11},
+		{name: "blank context line", diff: "diff --git a/a.go b/a.go\n@@ -10,2 +11,2 @@\n\n x\n", old: 10, want: 11, wantOK: true},
+		{name: "pure insertion", diff: "diff --git a/a.go b/a.go\n@@ -5,0 +6,2 @@\n+x\n+y\n", old: 6, want: 8, wantOK: true},
+		{name: "invalid header", diff: "diff --git a/a.go b/a.go\n@@ -99999999999999999999 +1 @@\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := ParseLineMap([]byte(tt.diff))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			got, ok := m.files["a.go"].line(tt.old)
+			assert.Equal(t, tt.wantOK, ok)
+			if tt.wantOK {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,365 @@
+package coverage
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github"
+)
+
+// Annotation levels supported by the GitHub Check Run API, in increasing severity.
+const (
+	LevelNotice  = "notice"
+	LevelWarning = "warning"
+	LevelFailure = "failure"
+)
+
+// levelRank orders annotation levels by severity.
+var levelRank = map[string]int{
+	LevelNotice:  1,
+	LevelWarning: 2,
+	LevelFailure: 3,
+}
+
+// LineKind classifies an uncovered line by the code construct it belongs to.
+type LineKind int
+
+const (
+	// LineKindOther is any line not covered by a more specific kind.
+	LineKindOther LineKind = iota
+	// LineKindExportedFunc is a line inside an exported function or method.
+	LineKindExportedFunc
+	// LineKindErrorHandling is a line inside an `if err != nil` branch.
+	LineKindErrorHandling
+)
+
+// LineClassifier determines the LineKind of a line in a file.
+type LineClassifier interface {
+	Classify(file string, line int) LineKind
+}
+
+// SeverityPolicy maps coverage severity to annotation levels.
+// Empty level fields fall back to Default.
+type SeverityPolicy struct {
+	// Default is the level for uncovered lines that match no specific kind
+	Default string
+	// ExportedFunc is the level for uncovered lines in exported functions
+	ExportedFunc string
+	// ErrorHandling is the level for uncovered lines in error-handling branches
+	ErrorHandling string
+	// LowCoverageThreshold adds a failure annotation on line 1 of every file whose
+	// patch coverage percentage is below it. Zero disables the check.
+	LowCoverageThreshold float64
+}
+
+// DefaultSeverityPolicy returns the policy that reports every uncovered line as a notice.
+func DefaultSeverityPolicy() SeverityPolicy {
+	return SeverityPolicy{Default: LevelNotice}
+}
+
+// ParseSeverityPolicy parses a comma-separated list of key=value pairs.
+// Supported keys: default, exported, error-handling (annotation levels)
+// and low-coverage (a patch coverage percentage).
+// Example: "exported=warning,error-handling=notice,low-coverage=30"
+func ParseSeverityPolicy(spec string) (SeverityPolicy, error) {
+	policy := DefaultSeverityPolicy()
+
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return policy, nil
+	}
+
+	for _, pair := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return SeverityPolicy{}, fmt.Errorf("invalid annotation level setting %q (expected key=value)", pair)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.ToLower(strings.TrimSpace(value))
+
+		switch key {
+		case "default":
+			policy.Default = value
+		case "exported":
+			policy.ExportedFunc = value
+		case "error-handling":
+			policy.ErrorHandling = value
+		case "low-coverage":
+			threshold, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return SeverityPolicy{}, fmt.Errorf("invalid low-coverage threshold %q: %w", value, err)
+			}
+			policy.LowCoverageThreshold = threshold
+		default:
+			return SeverityPolicy{}, fmt.Errorf("unknown annotation level setting: %s (supported: default, exported, error-handling, low-coverage)", key)
+		}
+	}
+
+	if err := policy.Validate(); err != nil {
+		return SeverityPolicy{}, err
+	}
+	return policy, nil
+}
+
+// Validate checks that all configured levels are valid annotation levels
+// and the low coverage threshold is a percentage.
+func (p SeverityPolicy) Validate() error {
+	for _, level := range []string{p.Default, p.ExportedFunc, p.ErrorHandling} {
+		if level == "" {
+			continue
+		}
+		if _, ok := levelRank[level]; !ok {
+			return fmt.Errorf("invalid annotation level: %s (supported: notice, warning, failure)", level)
+		}
+	}
+	if p.LowCoverageThreshold < 0 || p.LowCoverageThreshold > 100 {
+		return fmt.Errorf("low-coverage threshold must be between 0 and 100, got %g", p.LowCoverageThreshold)
+	}
+	return nil
+}
+
+// IsDefault reports whether the policy produces the same output as GenerateAnnotations.
+func (p SeverityPolicy) IsDefault() bool {
+	return p.levelFor(LineKindExportedFunc) == LevelNotice &&
+		p.levelFor(LineKindErrorHandling) == LevelNotice &&
+		p.levelFor(LineKindOther) == LevelNotice &&
+		p.LowCoverageThreshold == 0
+}
+
+// levelFor returns the annotation level for a line kind.
+func (p SeverityPolicy) levelFor(kind LineKind) string {
+	level := ""
+	switch kind {
+	case LineKindExportedFunc:
+		level = p.ExportedFunc
+	case LineKindErrorHandling:
+		level = p.ErrorHandling
+	}
+	if level == "" {
+		level = p.Default
+	}
+	if level == "" {
+		level = LevelNotice
+	}
+	return level
+}
+
+// ApplySeverityPolicy assigns levels to annotations produced by GenerateAnnotations.
+// A range annotation gets the most severe level of any line it spans.
+// fileCoverage holds patch coverage percentages by diff file (see DiffCoverageByFile)
+// and is only consulted when the policy has a low coverage threshold.
+// A nil classifier treats every line as LineKindOther.
+func ApplySeverityPolicy(annotations []*github.Annotation, policy SeverityPolicy, classifier LineClassifier, fileCoverage map[string]float64) []*github.Annotation {
+	var result []*github.Annotation
+	flagged := make(map[string]bool)
+
+	for _, annotation := range annotations {
+		if policy.LowCoverageThreshold > 0 && !flagged[annotation.Path] {
+			if pct, ok := fileCoverage[annotation.Path]; ok && pct < policy.LowCoverageThreshold {
+				flagged[annotation.Path] = true
+				result = append(result, &github.Annotation{
+					Path:      annotation.Path,
+					StartLine: 1,
+					EndLine:   1,
+					Level:     LevelFailure,
+					Title:     "Low patch coverage",
+					Message:   fmt.Sprintf("Patch coverage for this file is %.1f%%, below the %.1f%% threshold", pct, policy.LowCoverageThreshold),
+				})
+			}
+		}
+
+		level := ""
+		for line := annotation.StartLine; line <= annotation.EndLine; line++ {
+			kind := LineKindOther
+			if classifier != nil {
+				kind = classifier.Classify(annotation.Path, line)
+			}
+			if candidate := policy.levelFor(kind); levelRank[candidate] > levelRank[level] {
+				level = candidate
+			}
+		}
+
+		leveled := *annotation
+		leveled.Level = level
+		result = append(result, &leveled)
+	}
+
+	return result
+}
+
+// DiffCoverageByFile calculates patch coverage percentage for each diff file
+// that has instrumented added lines, keyed by diff filename.
+func DiffCoverageByFile(profiles []*Profile, addedLinesByFile map[string][]int) map[string]float64 {
+	byFile := make(map[string]float64)
+
+	for _, profile := range profiles {
+		diffFile, addedLines, found := findMatchingDiffFile(profile, addedLinesByFile)
+		if !found {
+			continue
+		}
+
+		var added, covered int
+		for _, line := range addedLines {
+			if !isLineInstrumented(profile, line) {
+				continue
+			}
+			added++
+			if isLineCovered(profile, line) {
+				covered++
+			}
+		}
+
+		if added > 0 {
+			byFile[diffFile] = float64(covered) / float64(added) * 100
+		}
+	}
+
+	return byFile
+}
+
+// GoSourceClassifier classifies lines by parsing Go source files under Root,
+// or given in memory (see NewGoContentClassifier).
+// Files that are missing or fail to parse classify as LineKindOther.
+type GoSourceClassifier struct {
+	// Root is the directory diff paths are relative to (usually the repository root)
+	Root string
+
+	// contents, if set, holds the sources by diff path instead of Root
+	contents map[string][]byte
+	cache    map[string]*goFileRanges
+}
+
+// goFileRanges holds the line ranges of interesting constructs in a Go file.
+type goFileRanges struct {
+	exported      []github.LineRange
+	errorHandling []github.LineRange
+}
+
+// NewGoSourceClassifier creates a classifier reading sources relative to root.
+func NewGoSourceClassifier(root string) *GoSourceClassifier {
+	return &GoSourceClassifier{
+		Root:  root,
+		cache: make(map[string]*goFileRanges),
+	}
+}
+
+// NewGoContentClassifier creates a classifier parsing sources keyed by diff
+// path, such as files fetched from a code host without a checkout.
+func NewGoContentClassifier(contents map[string][]byte) *GoSourceClassifier {
+	return &GoSourceClassifier{
+		contents: contents,
+		cache:    make(map[string]*goFileRanges),
+	}
+}
+
+// Classify implements LineClassifier.
+// Error-handling branches take precedence over the enclosing exported function.
+func (c *GoSourceClassifier) Classify(file string, line int) LineKind {
+	if !strings.HasSuffix(file, ".go") {
+		return LineKindOther
+	}
+
+	ranges, ok := c.cache[file]
+	if !ok {
+		ranges = c.parse(file)
+		c.cache[file] = ranges
+	}
+	if ranges == nil {
+		return LineKindOther
+	}
+
+	if inRanges(ranges.errorHandling, line) {
+		return LineKindErrorHandling
+	}
+	if inRanges(ranges.exported, line) {
+		return LineKindExportedFunc
+	}
+	return LineKindOther
+}
+
+// parse reads and parses a file, returning nil if it is missing or fails to parse.
+func (c *GoSourceClassifier) parse(file string) *goFileRanges {
+	if c.contents != nil {
+		src, ok := c.contents[file]
+		if !ok {
+			return nil
+		}
+		return parseGoFileRanges(file, src)
+	}
+	path := filepath.Join(c.Root, filepath.FromSlash(file))
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	return parseGoFileRanges(path, src)
+}
+
+// parseGoFileRanges parses a Go file and collects exported function bodies
+// and `if err != nil` bodies. Returns nil if the file cannot be parsed.
+func parseGoFileRanges(path string, src []byte) *goFileRanges {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, src, parser.SkipObjectResolution)
+	if err != nil {
+		return nil
+	}
+
+	ranges := &goFileRanges{}
+	lineRange := func(node ast.Node) github.LineRange {
+		return github.LineRange{
+			Start: fset.Position(node.Pos()).Line,
+			End:   fset.Position(node.End()).Line,
+		}
+	}
+
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch node := n.(type) {
+		case *ast.FuncDecl:
+			if node.Name.IsExported() && node.Body != nil {
+				ranges.exported = append(ranges.exported, lineRange(node.Body))
+			}
+		case *ast.IfStmt:
+			if isErrNotNil(node.Cond) {
+				ranges.errorHandling = append(ranges.errorHandling, lineRange(node.Body))
+			}
+		}
+		return true
+	})
+
+	return ranges
+}
+
+// isErrNotNil reports whether expr is a comparison of the form `err != nil`
+// (or any identifier named like an error, such as saveErr).
+func isErrNotNil(expr ast.Expr) bool {
+	binary, ok := expr.(*ast.BinaryExpr)
+	if !ok || binary.Op != token.NEQ {
+		return false
+	}
+
+	ident, ok := binary.X.(*ast.Ident)
+	if !ok {
+		return false
+	}
+	nilIdent, ok := binary.Y.(*ast.Ident)
+	if !ok || nilIdent.Name != "nil" {
+		return false
+	}
+
+	return ident.Name == "err" || strings.HasSuffix(ident.Name, "Err")
+}
+
+// inRanges reports whether line falls within any of the ranges.
+func inRanges(ranges []github.LineRange, line int) bool {
+	for _, r := range ranges {
+		if line >= r.Start && line <= r.End {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,231 @@
+package coverage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github"
+)
+
+// stubClassifier classifies lines from a fixed map; unknown lines are LineKindOther.
+type stubClassifier map[int]LineKind
+
+func (s stubClassifier) Classify(file string, line int) LineKind {
+	return s[line]
+}
+
+func TestParseSeverityPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     string
+		expected SeverityPolicy
+		errorMsg string
+	}{
+		{
+			name:     "empty spec is default",
+			spec:     "",
+			expected: DefaultSeverityPolicy(),
+		},
+		{
+			name: "all settings",
+			spec: "default=notice, exported=Warning,error-handling=notice,low-coverage=30",
+			expected: SeverityPolicy{
+				Default:              LevelNotice,
+				ExportedFunc:         LevelWarning,
+				ErrorHandling:        LevelNotice,
+				LowCoverageThreshold: 30,
+			},
+		},
+		{
+			name:     "missing value",
+			spec:     "exported",
+			errorMsg: "expected key=value",
+		},
+		{
+			name:     "unknown key",
+			spec:     "private=warning",
+			errorMsg: "unknown annotation level setting",
+		},
+		{
+			name:     "invalid level",
+			spec:     "exported=error",
+			errorMsg: "invalid annotation level: error",
+		},
+		{
+			name:     "invalid threshold",
+			spec:     "low-coverage=lots",
+			errorMsg: "invalid low-coverage threshold",
+		},
+		{
+			name:     "threshold out of range",
+			spec:     "low-coverage=150",
+			errorMsg: "between 0 and 100",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := ParseSeverityPolicy(tt.spec)
+			if tt.errorMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, policy)
+		})
+	}
+}
+
+func TestSeverityPolicy_IsDefault(t *testing.T) {
+	assert.True(t, DefaultSeverityPolicy().IsDefault())
+	assert.True(t, SeverityPolicy{}.IsDefault())
+	assert.True(t, SeverityPolicy{ExportedFunc: LevelNotice}.IsDefault())
+	assert.False(t, SeverityPolicy{ExportedFunc: LevelWarning}.IsDefault())
+	assert.False(t, SeverityPolicy{LowCoverageThreshold: 30}.IsDefault())
+}
+
+func TestApplySeverityPolicy(t *testing.T) {
+	annotations := []*github.Annotation{
+		{Path: "a.go", StartLine: 5, EndLine: 5, Level: LevelNotice, Title: "Uncovered line"},
+		{Path: "a.go", StartLine: 10, EndLine: 12, Level: LevelNotice, Title: "Uncovered lines"},
+		{Path: "b.go", StartLine: 20, EndLine: 20, Level: LevelNotice, Title: "Uncovered line"},
+	}
+	classifier := stubClassifier{
+		5:  LineKindErrorHandling,
+		11: LineKindExportedFunc,
+		20: LineKindExportedFunc,
+	}
+
+	t.Run("levels by kind with most severe line winning", func(t *testing.T) {
+		policy := SeverityPolicy{Default: LevelNotice, ExportedFunc: LevelWarning, ErrorHandling: LevelNotice}
+		result := ApplySeverityPolicy(annotations, policy, classifier, nil)
+
+		require.Len(t, result, 3)
+		assert.Equal(t, LevelNotice, result[0].Level)
+		assert.Equal(t, LevelWarning, result[1].Level)
+		assert.Equal(t, LevelWarning, result[2].Level)
+
+		// Input annotations are not modified
+		assert.Equal(t, LevelNotice, annotations[1].Level)
+	})
+
+	t.Run("nil classifier uses default level", func(t *testing.T) {
+		policy := SeverityPolicy{Default: LevelWarning, ExportedFunc: LevelFailure}
+		result := ApplySeverityPolicy(annotations, policy, nil, nil)
+
+		require.Len(t, result, 3)
+		for _, a := range result {
+			assert.Equal(t, LevelWarning, a.Level)
+		}
+	})
+
+	t.Run("low coverage adds one failure annotation per file", func(t *testing.T) {
+		policy := SeverityPolicy{Default: LevelNotice, LowCoverageThreshold: 30}
+		fileCoverage := map[string]float64{"a.go": 20, "b.go": 80}
+		result := ApplySeverityPolicy(annotations, policy, nil, fileCoverage)
+
+		require.Len(t, result, 4)
+		assert.Equal(t, "a.go", result[0].Path)
+		assert.Equal(t, 1, result[0].StartLine)
+		assert.Equal(t, 1, result[0].EndLine)
+		assert.Equal(t, LevelFailure, result[0].Level)
+		assert.Equal(t, "Low patch coverage", result[0].Title)
+		assert.Contains(t, result[0].Message, "20.0%")
+		assert.Equal(t, 5, result[1].StartLine)
+		assert.Equal(t, "b.go", result[3].Path)
+	})
+}
+
+func TestDiffCoverageByFile(t *testing.T) {
+	profiles := []*Profile{
+		{
+			FileName: "github.com/org/repo/a.go",
+			Blocks: []ProfileBlock{
+				{StartLine: 1, EndLine: 2, NumStmt: 1, Count: 1},
+				{StartLine: 3, EndLine: 6, NumStmt: 1, Count: 0},
+			},
+		},
+		{
+			FileName: "github.com/org/repo/b.go",
+			Blocks: []ProfileBlock{
+				{StartLine: 1, EndLine: 1, NumStmt: 1, Count: 1},
+			},
+		},
+		{
+			FileName: "github.com/org/repo/unchanged.go",
+			Blocks: []ProfileBlock{
+				{StartLine: 1, EndLine: 1, NumStmt: 1, Count: 0},
+			},
+		},
+	}
+	addedLinesByFile := map[string][]int{
+		"a.go": {1, 3, 4, 5},
+		"b.go": {10}, // not instrumented
+	}
+
+	byFile := DiffCoverageByFile(profiles, addedLinesByFile)
+
+	assert.Equal(t, map[string]float64{"a.go": 25}, byFile)
+}
+
+func TestGoSourceClassifier_Classify(t *testing.T) {
+	dir := t.TempDir()
+	source := `package sample
+
+func Exported() error {
+	err := work()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func unexported() {
+	if saveErr := work(); saveErr != nil {
+		panic(saveErr)
+	}
+}
+
+func work() error { return nil }
+`
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "pkg"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "pkg", "sample.go"), []byte(source), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.go"), []byte("package"), 0644))
+
+	classifiers := map[string]*GoSourceClassifier{
+		"source root": NewGoSourceClassifier(dir),
+		"contents": NewGoContentClassifier(map[string][]byte{
+			"pkg/sample.go": []byte(source),
+			"broken.go":     []byte("package"),
+		}),
+	}
+
+	tests := []struct {
+		name     string
+		file     string
+		line     int
+		expected LineKind
+	}{
+		{"exported function body", "pkg/sample.go", 4, LineKindExportedFunc},
+		{"error branch in exported function", "pkg/sample.go", 6, LineKindErrorHandling},
+		{"unexported function body", "pkg/sample.go", 11, LineKindOther},
+		{"named error branch in unexported function", "pkg/sample.go", 13, LineKindErrorHandling},
+		{"package clause", "pkg/sample.go", 1, LineKindOther},
+		{"missing file", "missing.go", 4, LineKindOther},
+		{"unparseable file", "broken.go", 1, LineKindOther},
+		{"non-go file", "README.md", 1, LineKindOther},
+	}
+
+	for name, classifier := range classifiers {
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				assert.Equal(t, tt.expected, classifier.Classify(tt.file, tt.line))
+			})
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package coverage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// ShardManifestName is the shard name of the manifest of sharded coverage.
+const ShardManifestName = "index.json"
+
+// shardIDLength is the number of hex characters of a package directory's
+// hash naming its shard.
+const shardIDLength = 16
+
+// ShardManifest indexes coverage split into one shard per package
+// directory (see ShardProfiles), so analyses can fetch only the shards of
+// the files they look at. It keeps the totals of the whole coverage, which
+// the shards fetched can't add up to.
+type ShardManifest struct {
+	Mode              string `json:"mode"`
+	TotalStatements   int    `json:"total_statements"`
+	CoveredStatements int    `json:"covered_statements"`
+	// Shards are sorted by package directory
+	Shards []ShardEntry `json:"shards"`
+}
+
+// ShardEntry describes the shard of one package directory.
+type ShardEntry struct {
+	// Name is the shard's name in storage (see storage.CoverageKey.Shard)
+	Name string `json:"name"`
+	// Dir is the package directory, as in profile filenames
+	Dir string `json:"dir"`
+	// Files are the profile filenames in the shard
+	Files             []string `json:"files"`
+	TotalStatements   int      `json:"total_statements"`
+	CoveredStatements int      `json:"covered_statements"`
+}
+
+// ShardProfiles splits profiles by package directory, returning the
+// manifest and the profiles of each shard by name.
+func ShardProfiles(profiles []*Profile) (*ShardManifest, map[string][]*Profile) {
+	manifest := &ShardManifest{}
+	shards := make(map[string][]*Profile)
+	entries := make(map[string]*ShardEntry)
+	for _, p := range profiles {
+		if manifest.Mode == "" {
+			manifest.Mode = p.Mode
+		}
+		dir := path.Dir(p.FileName)
+		entry, ok := entries[dir]
+		if !ok {
+			entry = &ShardEntry{Name: shardName(dir), Dir: dir}
+			entries[dir] = entry
+		}
+		entry.Files = append(entry.Files, p.FileName)
+		for _, b := range p.Blocks {
+			entry.TotalStatements += b.NumStmt
+			if b.Count > 0 {
+				entry.CoveredStatements += b.NumStmt
+			}
+		}
+		shards[entry.Name] = append(shards[entry.Name], p)
+	}
+
+	for _, entry := range entries {
+		manifest.TotalStatements += entry.TotalStatements
+		manifest.CoveredStatements += entry.CoveredStatements
+		manifest.Shards = append(manifest.Shards, *entry)
+	}
+	sort.Slice(manifest.Shards, func(i, j int) bool {
+		return manifest.Shards[i].Dir < manifest.Shards[j].Dir
+	})
+	return manifest, shards
+}
+
+// shardName names the shard of a package directory by its hash, so
+// directories of any depth map to a single object name.
+func shardName(dir string) string {
+	sum := sha256.Sum256([]byte(dir))
+	return hex.EncodeToString(sum[:])[:shardIDLength] + ".out"
+}
+
+// ParseShardManifest parses a manifest written with json.Marshal.
+func ParseShardManifest(data []byte) (*ShardManifest, error) {
+	var m ShardManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid shard manifest: %w", err)
+	}
+	return &m, nil
+}
+
+// ShardsFor returns the names of the shards holding coverage of files,
+// which are matched against profile filenames by suffix as diff files are
+// (see CompareFiles).
+func (m *ShardManifest) ShardsFor(files []string) []string {
+	var names []string
+	for _, entry := range m.Shards {
+		if entry.holdsAny(files) {
+			names = append(names, entry.Name)
+		}
+	}
+	return names
+}
+
+// holdsAny returns true if the shard has coverage of any of files.
+func (e *ShardEntry) holdsAny(files []string) bool {
+	for _, name := range e.Files {
+		for _, file := range files {
+			if name == file || strings.HasSuffix(name, "/"+file) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Stats returns coverage statistics of profiles, which hold some of the
+// shards, with the totals of the whole coverage.
+func (m *ShardManifest) Stats(profiles []*Profile) *CoverageStats {
+	stats := CalculateCoverageStats(profiles)
+	stats.TotalStatements = m.TotalStatements
+	stats.CoveredStatements = m.CoveredStatements
+	stats.Percentage = 0
+	if m.TotalStatements > 0 {
+		stats.Percentage = float64(m.CoveredStatements) / float64(m.TotalStatements) * 100
+	}
+	return stats
+}
@@ -0,0 +1,89 @@
+package coverage
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShardProfiles(t *testing.T) {
+	profiles := []*Profile{
+		{FileName: "github.com/acme/widgets/calc.go", Mode: "set", Blocks: []ProfileBlock{{NumStmt: 3, Count: 1}, {NumStmt: 1, Count: 0}}},
+		{FileName: "github.com/acme/widgets/pkg/a.go", Mode: "set", Blocks: []ProfileBlock{{NumStmt: 2, Count: 0}}},
+		{FileName: "github.com/acme/widgets/util.go", Mode: "set", Blocks: []ProfileBlock{{NumStmt: 4, Count: 2}}},
+	}
+
+	manifest, shards := ShardProfiles(profiles)
+	assert.Equal(t, "set", manifest.Mode)
+	assert.Equal(t, 10, manifest.TotalStatements)
+	assert.Equal(t, 7, manifest.CoveredStatements)
+	require.Len(t, manifest.Shards, 2)
+
+	root, pkg := manifest.Shards[0], manifest.Shards[1]
+	assert.Equal(t, "github.com/acme/widgets", root.Dir)
+	assert.Equal(t, []string{"github.com/acme/widgets/calc.go", "github.com/acme/widgets/util.go"}, root.Files)
+	assert.Equal(t, 8, root.TotalStatements)
+	assert.Equal(t, 7, root.CoveredStatements)
+	assert.Equal(t, []*Profile{profiles[0], profiles[2]}, shards[root.Name])
+	assert.Equal(t, "github.com/acme/widgets/pkg", pkg.Dir)
+	assert.Equal(t, []*Profile{profiles[1]}, shards[pkg.Name])
+	assert.NotEqual(t, root.Name, pkg.Name)
+	assert.Regexp(t, `^[0-9a-f]{16}\.out$`, root.Name)
+
+	// The manifest survives being stored
+	data, err := json.Marshal(manifest)
+	require.NoError(t, err)
+	parsed, err := ParseShardManifest(data)
+	require.NoError(t, err)
+	assert.Equal(t, manifest, parsed)
+
+	_, err = ParseShardManifest([]byte("mode: set"))
+	assert.Error(t, err)
+}
+
+func TestShardManifest_ShardsFor(t *testing.T) {
+	manifest, _ := ShardProfiles([]*Profile{
+		{FileName: "github.com/acme/widgets/calc.go"},
+		{FileName: "github.com/acme/widgets/pkg/a.go"},
+		{FileName: "lib/b.go"}, // a replaced module, normalized to its directory
+	})
+	root, pkg, lib := manifest.Shards[0].Name, manifest.Shards[1].Name, manifest.Shards[2].Name
+
+	tests := []struct {
+		name     string
+		files    []string
+		expected []string
+	}{
+		{name: "root package", files: []string{"calc.go"}, expected: []string{root}},
+		{name: "nested package", files: []string{"pkg/a.go", "pkg/new.go"}, expected: []string{pkg}},
+		{name: "normalized filename", files: []string{"lib/b.go"}, expected: []string{lib}},
+		{name: "several packages", files: []string{"pkg/a.go", "calc.go"}, expected: []string{root, pkg}},
+		{name: "no coverage", files: []string{"docs/README.md"}},
+		{name: "partial name", files: []string{"alc.go"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ElementsMatch(t, tt.expected, manifest.ShardsFor(tt.files))
+		})
+	}
+}
+
+func TestShardManifest_Stats(t *testing.T) {
+	profiles := []*Profile{
+		{FileName: "github.com/acme/widgets/calc.go", Mode: "set", Blocks: []ProfileBlock{{NumStmt: 3, Count: 1}}},
+		{FileName: "github.com/acme/widgets/pkg/a.go", Mode: "set", Blocks: []ProfileBlock{{NumStmt: 1, Count: 0}}},
+	}
+	manifest, shards := ShardProfiles(profiles)
+
+	stats := manifest.Stats(shards[manifest.Shards[1].Name])
+	assert.Equal(t, 4, stats.TotalStatements)
+	assert.Equal(t, 3, stats.CoveredStatements)
+	assert.InDelta(t, 75.0, stats.Percentage, 0.001)
+	assert.Contains(t, stats.ByFile, "github.com/acme/widgets/pkg/a.go")
+	assert.NotContains(t, stats.ByFile, "github.com/acme/widgets/calc.go")
+
+	assert.InDelta(t, 75.0, manifest.Stats(nil).Percentage, 0.001)
+}
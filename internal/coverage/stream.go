@@ -0,0 +1,331 @@
+package coverage
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"unsafe"
+)
+
+// maxProfileLine bounds the length of a line of a Go text profile read by
+// Merger.AddFrom.
+const maxProfileLine = 1024 * 1024
+
+// mergedBlockSize approximates the memory a distinct block takes in a
+// Merger: its key and count, plus map overhead.
+const mergedBlockSize = int64(unsafe.Sizeof(blockKey{})+unsafe.Sizeof(0)) * 3 / 2
+
+// utf8BOM is the byte order mark some editors and tools prepend to files.
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+// Merger merges coverage profiles incrementally. Each distinct block is held
+// once with its merged count, however many profiles repeat it, so memory is
+// bounded by the size of the merged coverage rather than of the input: Go
+// text profiles added with AddFrom are parsed line by line and never held
+// in memory. Profiles returns the merge, as MergeProfiles would.
+type Merger struct {
+	// Limit is the most bytes (as estimated by Size) the Merger may hold;
+	// adding blocks past it fails with ErrSizeLimit. A negative Limit, the
+	// default, disables the check.
+	Limit int64
+
+	mode  string
+	files map[string]map[blockKey]int
+	size  int64
+}
+
+// NewMerger creates an empty Merger.
+func NewMerger() *Merger {
+	return &Merger{Limit: -1, files: make(map[string]map[blockKey]int)}
+}
+
+// Add merges profiles into m. All profiles must have the same mode.
+func (m *Merger) Add(profiles ...*Profile) error {
+	for _, p := range profiles {
+		blocks, err := m.file(p.FileName, p.Mode)
+		if err != nil {
+			return err
+		}
+		for _, b := range p.Blocks {
+			if err := m.addBlock(blocks, b); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Merge merges the blocks of other into m.
+func (m *Merger) Merge(other *Merger) error {
+	names := make([]string, 0, len(other.files))
+	for name := range other.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		blocks, err := m.file(name, other.mode)
+		if err != nil {
+			return err
+		}
+		for key, count := range other.files[name] {
+			if err := m.addBlock(blocks, ProfileBlock{
+				StartLine: key.StartLine, StartCol: key.StartCol,
+				EndLine: key.EndLine, EndCol: key.EndCol,
+				NumStmt: key.NumStmt, Count: count,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// AddFrom reads coverage data in format from r and merges it into m, like
+// ParseProfilesAs. FormatAuto detects the format from the start of the
+// data. Go text profiles are parsed as they are read; other formats are
+// read whole first. On error, m may hold part of the data.
+func (m *Merger) AddFrom(r io.Reader, format Format) error {
+	br := bufio.NewReaderSize(r, sniffLimit)
+	if format == FormatAuto {
+		head, err := br.Peek(sniffLimit)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+			return fmt.Errorf("failed to read coverage data: %w", err)
+		}
+		if len(head) == 0 {
+			return fmt.Errorf("coverage data is empty")
+		}
+		format = DetectFormat(head)
+	}
+
+	switch format {
+	case FormatGo, FormatUnknown:
+		return m.addText(br)
+	default:
+		data, err := io.ReadAll(br)
+		if err != nil {
+			return fmt.Errorf("failed to read coverage data: %w", err)
+		}
+		profiles, err := ParseProfilesAs(data, format)
+		if err != nil {
+			return err
+		}
+		return m.Add(profiles...)
+	}
+}
+
+// addText parses a Go text profile line by line. Like the go tool, it
+// requires a mode line first; repeated mode lines, as in concatenated
+// profiles, must name the same mode. Blank lines are skipped.
+func (m *Merger) addText(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxProfileLine)
+
+	mode := ""
+	empty := true
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Bytes()
+		if n == 1 {
+			line = bytes.TrimPrefix(line, utf8BOM)
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		empty = false
+
+		if rest, ok := bytes.CutPrefix(line, []byte("mode:")); ok {
+			lineMode := string(bytes.TrimSpace(rest))
+			if lineMode == "" {
+				return fmt.Errorf("failed to parse coverage profiles: bad mode line: %s", line)
+			}
+			if mode != "" && lineMode != mode {
+				return fmt.Errorf("failed to parse coverage profiles: line %d: mode %q after mode %q", n, lineMode, mode)
+			}
+			mode = lineMode
+			continue
+		}
+		if mode == "" {
+			return fmt.Errorf("failed to parse coverage profiles: bad mode line: %s", line)
+		}
+
+		name, block, err := parseProfileLine(line)
+		if err != nil {
+			return fmt.Errorf("failed to parse coverage profiles: line %d: %q doesn't match expected format: %w", n, line, err)
+		}
+		blocks, err := m.fileBytes(name, mode)
+		if err != nil {
+			return err
+		}
+		if err := m.addBlock(blocks, block); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read coverage data: %w", err)
+	}
+	if empty {
+		return fmt.Errorf("coverage data is empty")
+	}
+	return nil
+}
+
+// file returns the blocks of a file, checking that mode matches the mode
+// of the profiles merged so far.
+func (m *Merger) file(name, mode string) (map[blockKey]int, error) {
+	if err := m.checkMode(name, mode); err != nil {
+		return nil, err
+	}
+	blocks, ok := m.files[name]
+	if !ok {
+		blocks = make(map[blockKey]int)
+		m.files[name] = blocks
+		m.size += int64(len(name)) + mergedBlockSize
+	}
+	return blocks, nil
+}
+
+// fileBytes is file for a name read from a profile line; the name is only
+// copied the first time the file is seen.
+func (m *Merger) fileBytes(name []byte, mode string) (map[blockKey]int, error) {
+	if blocks, ok := m.files[string(name)]; ok && mode == m.mode {
+		return blocks, nil
+	}
+	return m.file(string(name), mode)
+}
+
+// checkMode records the mode of the first profile merged and rejects
+// profiles of other modes, as MergeProfiles does.
+func (m *Merger) checkMode(name, mode string) error {
+	if len(m.files) == 0 && m.mode == "" {
+		m.mode = mode
+		return nil
+	}
+	if mode != m.mode {
+		return fmt.Errorf("profile %s has mode %q, expected %q", name, mode, m.mode)
+	}
+	return nil
+}
+
+// addBlock merges a block into the blocks of a file.
+func (m *Merger) addBlock(blocks map[blockKey]int, b ProfileBlock) error {
+	key := makeBlockKey(b)
+	if count, ok := blocks[key]; ok {
+		blocks[key] = mergeCount(m.mode, count, b.Count)
+		return nil
+	}
+	if m.Limit >= 0 && m.size+mergedBlockSize > m.Limit {
+		return fmt.Errorf("%w: merged coverage needs more than %d bytes", ErrSizeLimit, m.Limit)
+	}
+	blocks[key] = b.Count
+	m.size += mergedBlockSize
+	return nil
+}
+
+// Size returns the approximate number of bytes the merged blocks take.
+func (m *Merger) Size() int64 {
+	return m.size
+}
+
+// Profiles returns the merged profiles sorted by filename, with blocks
+// sorted by position and overlapping blocks aligned as in MergeProfiles.
+func (m *Merger) Profiles() ([]*Profile, error) {
+	if len(m.files) == 0 {
+		return nil, fmt.Errorf("no coverage profiles found in data")
+	}
+
+	profiles := make([]*Profile, 0, len(m.files))
+	for name, blocks := range m.files {
+		merged := make([]ProfileBlock, 0, len(blocks))
+		for key, count := range blocks {
+			merged = append(merged, ProfileBlock{
+				StartLine: key.StartLine, StartCol: key.StartCol,
+				EndLine: key.EndLine, EndCol: key.EndCol,
+				NumStmt: key.NumStmt, Count: count,
+			})
+		}
+		sort.Slice(merged, func(i, j int) bool { return blockLess(merged[i], merged[j]) })
+		profiles = append(profiles, &Profile{FileName: name, Mode: m.mode, Blocks: alignOverlappingBlocks(m.mode, merged)})
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].FileName < profiles[j].FileName })
+	return profiles, nil
+}
+
+// blockLess orders blocks by start, then end, then statements, so blocks
+// from a map are always sorted the same way.
+func blockLess(a, b ProfileBlock) bool {
+	if blockStart(a) != blockStart(b) {
+		return blockStart(a).less(blockStart(b))
+	}
+	if blockEnd(a) != blockEnd(b) {
+		return blockEnd(a).less(blockEnd(b))
+	}
+	return a.NumStmt < b.NumStmt
+}
+
+// ReadProfiles is the streaming ParseProfilesAs: it reads coverage data in
+// format from r with a Merger, so a Go text profile is never held in memory
+// and blocks it repeats are merged as they are read.
+func ReadProfiles(r io.Reader, format Format) ([]*Profile, error) {
+	m := NewMerger()
+	if err := m.AddFrom(r, format); err != nil {
+		return nil, err
+	}
+	return m.Profiles()
+}
+
+// parseProfileLine parses a line of a Go text profile,
+// "name:startLine.startCol,endLine.endCol numStmt count", from the end, as
+// golang.org/x/tools/cover does, since names may contain colons.
+func parseProfileLine(line []byte) ([]byte, ProfileBlock, error) {
+	var b ProfileBlock
+	end := len(line)
+	var err error
+	fields := []struct {
+		sep   byte
+		value *int
+		what  string
+	}{
+		{' ', &b.Count, "Count"},
+		{' ', &b.NumStmt, "NumStmt"},
+		{'.', &b.EndCol, "EndCol"},
+		{',', &b.EndLine, "EndLine"},
+		{'.', &b.StartCol, "StartCol"},
+		{':', &b.StartLine, "StartLine"},
+	}
+	for _, f := range fields {
+		if *f.value, end, err = seekBack(line, f.sep, end, f.what); err != nil {
+			return nil, b, err
+		}
+	}
+	if end == 0 {
+		return nil, b, errors.New("a FileName cannot be blank")
+	}
+	return line[:end], b, nil
+}
+
+// seekBack finds the last sep in line before end and parses the
+// non-negative integer between them, returning it and the position of sep.
+func seekBack(line []byte, sep byte, end int, what string) (int, int, error) {
+	start := bytes.LastIndexByte(line[:end], sep)
+	if start < 0 {
+		return 0, 0, fmt.Errorf("couldn't find a %s before %s", string(sep), what)
+	}
+	digits := line[start+1 : end]
+	if len(digits) == 0 {
+		return 0, 0, fmt.Errorf("couldn't parse %q: no digits", what)
+	}
+	value := 0
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return 0, 0, fmt.Errorf("couldn't parse %q: invalid digit %q", what, c)
+		}
+		if value > (1<<62)/10 {
+			return 0, 0, fmt.Errorf("couldn't parse %q: value out of range", what)
+		}
+		value = value*10 + int(c-'0')
+	}
+	return value, start, nil
+}
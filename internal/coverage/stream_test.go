@@ -0,0 +1,171 @@
+package coverage
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadProfiles_MatchesParseProfiles(t *testing.T) {
+	fixtures := []string{"valid_single.out", "valid_count.out", "valid_atomic.out", "multiple_files_1.out", "lcov.info", "cobertura.xml", "jacoco.xml"}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture, func(t *testing.T) {
+			data := loadTestFixture(t, fixture)
+			parsed, err := ParseProfilesAs(data, FormatAuto)
+			require.NoError(t, err)
+			want, err := MergeProfiles(parsed)
+			require.NoError(t, err)
+
+			got, err := ReadProfiles(bytes.NewReader(data), FormatAuto)
+			require.NoError(t, err)
+			assert.Equal(t, want, got)
+		})
+	}
+}
+
+func TestReadProfiles(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		want        []*Profile
+		errContains string
+	}{
+		{
+			name: "repeated blocks are merged as they are read",
+			data: "mode: count\na.go:1.1,2.2 1 2\nb.go:3.1,4.2 2 0\na.go:1.1,2.2 1 3\n",
+			want: []*Profile{
+				{FileName: "a.go", Mode: "count", Blocks: []ProfileBlock{{StartLine: 1, StartCol: 1, EndLine: 2, EndCol: 2, NumStmt: 1, Count: 5}}},
+				{FileName: "b.go", Mode: "count", Blocks: []ProfileBlock{{StartLine: 3, StartCol: 1, EndLine: 4, EndCol: 2, NumStmt: 2, Count: 0}}},
+			},
+		},
+		{
+			name: "concatenated profiles with a byte order mark and CRLF",
+			data: "\xef\xbb\xbfmode: set\r\na.go:1.1,2.2 1 0\r\n\r\nmode: set\r\na.go:1.1,2.2 1 1\r\n",
+			want: []*Profile{
+				{FileName: "a.go", Mode: "set", Blocks: []ProfileBlock{{StartLine: 1, StartCol: 1, EndLine: 2, EndCol: 2, NumStmt: 1, Count: 1}}},
+			},
+		},
+		{
+			name: "file names may contain colons",
+			data: "mode: set\nC:/src/a.go:1.1,2.2 1 1\n",
+			want: []*Profile{
+				{FileName: "C:/src/a.go", Mode: "set", Blocks: []ProfileBlock{{StartLine: 1, StartCol: 1, EndLine: 2, EndCol: 2, NumStmt: 1, Count: 1}}},
+			},
+		},
+		{
+			name:        "mode lines must agree",
+			data:        "mode: set\na.go:1.1,2.2 1 1\nmode: count\n",
+			errContains: `line 3: mode "count" after mode "set"`,
+		},
+		{
+			name:        "missing mode line",
+			data:        "a.go:1.1,2.2 1 1\n",
+			errContains: "bad mode line",
+		},
+		{
+			name:        "malformed block",
+			data:        "mode: set\na.go:1.1,2.x 1 1\n",
+			errContains: "line 2",
+		},
+		{
+			name:        "blank file name",
+			data:        "mode: set\n:1.1,2.2 1 1\n",
+			errContains: "FileName cannot be blank",
+		},
+		{
+			name:        "mode line only",
+			data:        "mode: set\n",
+			errContains: "no coverage profiles",
+		},
+		{
+			name:        "empty data",
+			data:        "",
+			errContains: "empty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profiles, err := ReadProfiles(strings.NewReader(tt.data), FormatAuto)
+			if tt.errContains != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errContains)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, profiles)
+		})
+	}
+}
+
+func TestMerger(t *testing.T) {
+	t.Run("matches MergeProfiles across inputs", func(t *testing.T) {
+		first := loadTestFixture(t, "multiple_files_1.out")
+		second := loadTestFixture(t, "multiple_files_2.out")
+		parsed, err := ParseProfiles(first)
+		require.NoError(t, err)
+		parsedSecond, err := ParseProfiles(second)
+		require.NoError(t, err)
+		want, err := MergeProfiles(append(parsed, parsedSecond...))
+		require.NoError(t, err)
+
+		m := NewMerger()
+		require.NoError(t, m.AddFrom(bytes.NewReader(first), FormatGo))
+		require.NoError(t, m.Add(parsedSecond...))
+		got, err := m.Profiles()
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	})
+
+	t.Run("merges another merger", func(t *testing.T) {
+		a := NewMerger()
+		require.NoError(t, a.AddFrom(strings.NewReader("mode: count\na.go:1.1,2.2 1 2\n"), FormatGo))
+		b := NewMerger()
+		require.NoError(t, b.AddFrom(strings.NewReader("mode: count\na.go:1.1,2.2 1 3\nb.go:1.1,1.9 1 1\n"), FormatGo))
+		require.NoError(t, a.Merge(b))
+
+		got, err := a.Profiles()
+		require.NoError(t, err)
+		require.Len(t, got, 2)
+		assert.Equal(t, 5, got[0].Blocks[0].Count)
+		assert.Equal(t, "b.go", got[1].FileName)
+	})
+
+	t.Run("rejects mixed modes", func(t *testing.T) {
+		m := NewMerger()
+		require.NoError(t, m.AddFrom(strings.NewReader("mode: set\na.go:1.1,2.2 1 1\n"), FormatGo))
+		err := m.AddFrom(strings.NewReader("mode: count\nb.go:1.1,2.2 1 1\n"), FormatGo)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `has mode "count", expected "set"`)
+	})
+
+	t.Run("repeated blocks do not grow the merge", func(t *testing.T) {
+		m := NewMerger()
+		require.NoError(t, m.AddFrom(strings.NewReader("mode: set\na.go:1.1,2.2 1 0\n"), FormatGo))
+		size := m.Size()
+		assert.Positive(t, size)
+		require.NoError(t, m.AddFrom(strings.NewReader("mode: set\na.go:1.1,2.2 1 1\na.go:1.1,2.2 1 1\n"), FormatGo))
+		assert.Equal(t, size, m.Size())
+	})
+
+	t.Run("stops at the limit", func(t *testing.T) {
+		m := NewMerger()
+		m.Limit = 3 * mergedBlockSize
+		var profile strings.Builder
+		profile.WriteString("mode: set\n")
+		for line := 1; line <= 10; line++ {
+			profile.WriteString("a.go:" + strings.Repeat("1", line) + ".1,1.2 1 1\n")
+		}
+		err := m.AddFrom(strings.NewReader(profile.String()), FormatGo)
+		require.ErrorIs(t, err, ErrSizeLimit)
+	})
+
+	t.Run("no profiles", func(t *testing.T) {
+		_, err := NewMerger().Profiles()
+		require.Error(t, err)
+	})
+}
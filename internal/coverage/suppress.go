@@ -0,0 +1,196 @@
+package coverage
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SuppressDirective is the comment that excludes a line from diff coverage:
+//
+//	return nil // canopy:ignore 2024-05-01 unreachable after validation
+//
+//	// canopy:ignore 2024-05-01 covered by integration tests
+//	if err := conn.Close(); err != nil {
+//
+// A directive after code suppresses its own line; a directive on a line of
+// its own suppresses the next line. The optional date (YYYY-MM-DD) records
+// when the suppression was added, so it can expire (see ApplySuppressions);
+// the rest of the comment is a free-form reason.
+const SuppressDirective = "canopy:ignore"
+
+var suppressDirectiveRe = regexp.MustCompile(`//\s*` + regexp.QuoteMeta(SuppressDirective) + `(?:\s+(.*))?$`)
+
+// Suppression is a SuppressDirective applying to a line of a file.
+type Suppression struct {
+	// Line is the suppressed line in the new version of the file
+	Line int
+	// Since is the date the suppression was added; zero if the directive has none
+	Since  time.Time
+	Reason string
+}
+
+// ParseSuppressions finds SuppressDirective comments in the added and context
+// lines of a unified diff, keyed by the new file name.
+// Directives outside of hunks can't be seen, so a standalone directive only
+// applies if the diff includes the line above the suppressed one, which it
+// does with git's default of 3 context lines.
+func ParseSuppressions(diffData []byte) map[string][]Suppression {
+	suppressions := make(map[string][]Suppression)
+
+	var file string
+	var line int // next line number in the new file
+	inHunk := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(diffData))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		text := scanner.Text()
+
+		switch {
+		case strings.HasPrefix(text, "diff --git "):
+			file, inHunk = "", false
+			continue
+		case !inHunk && strings.HasPrefix(text, "+++ "):
+			file = strings.TrimPrefix(strings.TrimPrefix(text, "+++ "), "b/")
+			if file == "/dev/null" {
+				file = ""
+			}
+			continue
+		case strings.HasPrefix(text, "@@ "):
+			line, inHunk = hunkNewStart(text), true
+			continue
+		}
+		if !inHunk || file == "" || text == "" {
+			continue
+		}
+
+		switch text[0] {
+		case '+', ' ':
+			if s, ok := parseSuppression(text[1:], line); ok {
+				suppressions[file] = append(suppressions[file], s)
+			}
+			line++
+		case '-', '\\':
+			// Removed lines and "\ No newline at end of file" markers don't
+			// advance the new file
+		default:
+			inHunk = false
+		}
+	}
+
+	return suppressions
+}
+
+// hunkNewStart returns the first new-file line of a hunk header
+// ("@@ -1,3 +4,5 @@"), or 0 if the header is malformed.
+func hunkNewStart(header string) int {
+	fields := strings.Fields(header)
+	if len(fields) < 3 || !strings.HasPrefix(fields[2], "+") {
+		return 0
+	}
+	start, _, _ := strings.Cut(strings.TrimPrefix(fields[2], "+"), ",")
+	n, _ := strconv.Atoi(start)
+	return n
+}
+
+// parseSuppression parses a SuppressDirective in the source line at lineNum.
+func parseSuppression(source string, lineNum int) (Suppression, bool) {
+	loc := suppressDirectiveRe.FindStringSubmatchIndex(source)
+	if loc == nil {
+		return Suppression{}, false
+	}
+
+	s := Suppression{Line: lineNum}
+	if strings.TrimSpace(source[:loc[0]]) == "" {
+		s.Line++
+	}
+
+	var rest string
+	if loc[2] >= 0 {
+		rest = strings.TrimSpace(source[loc[2]:loc[3]])
+	}
+	date, reason, _ := strings.Cut(rest, " ")
+	if since, err := time.Parse(time.DateOnly, date); err == nil {
+		s.Since = since
+		rest = strings.TrimSpace(reason)
+	}
+	s.Reason = rest
+	return s, true
+}
+
+// ApplySuppressions removes uncovered lines suppressed by a SuppressDirective
+// from result, recording them in result.Suppressed so reports can show the
+// coverage debt they hide. Suppressed lines no longer count as added lines.
+//
+// If maxAge is positive, suppressions older than maxAge at now, or without a
+// date, have expired: their lines stay uncovered and are recorded in
+// result.ExpiredSuppressions as well.
+func ApplySuppressions(result *AnalysisResult, suppressions map[string][]Suppression, now time.Time, maxAge time.Duration) {
+	for file, lines := range result.UncoveredByFile {
+		fileSuppressions := suppressionsByLine(suppressions, file)
+		if len(fileSuppressions) == 0 {
+			continue
+		}
+
+		var uncovered []int
+		for _, line := range lines {
+			s, ok := fileSuppressions[line]
+			switch {
+			case !ok:
+				uncovered = append(uncovered, line)
+			case maxAge > 0 && (s.Since.IsZero() || now.Sub(s.Since) > maxAge):
+				uncovered = append(uncovered, line)
+				addLine(&result.ExpiredSuppressions, file, line)
+			default:
+				addLine(&result.Suppressed, file, line)
+				result.DiffAddedLines--
+			}
+		}
+
+		if len(uncovered) == 0 {
+			delete(result.UncoveredByFile, file)
+		} else {
+			result.UncoveredByFile[file] = uncovered
+		}
+	}
+}
+
+// suppressionsByLine indexes the suppressions of a file by line.
+func suppressionsByLine(suppressions map[string][]Suppression, file string) map[int]Suppression {
+	byLine := make(map[int]Suppression, len(suppressions[file]))
+	for _, s := range suppressions[file] {
+		byLine[s.Line] = s
+	}
+	return byLine
+}
+
+// addLine appends line to the lines of file in *m, creating the map if needed.
+func addLine(m *map[string][]int, file string, line int) {
+	if *m == nil {
+		*m = make(map[string][]int)
+	}
+	(*m)[file] = append((*m)[file], line)
+}
+
+// SuppressedFiles returns the files with suppressed or expired lines, sorted.
+func (r *AnalysisResult) SuppressedFiles() []string {
+	seen := make(map[string]bool)
+	for file := range r.Suppressed {
+		seen[file] = true
+	}
+	for file := range r.ExpiredSuppressions {
+		seen[file] = true
+	}
+
+	files := make([]string, 0, len(seen))
+	for file := range seen {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files
+}
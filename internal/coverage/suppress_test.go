@@ -0,0 +1,135 @@
+package coverage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSuppressions(t *testing.T) {
+	diff := `diff --git a/pkg/server.go b/pkg/server.go
+--- a/pkg/server.go
++++ b/pkg/server.go
+@@ -10,4 +10,7 @@ func Serve() error {
+ 	// canopy:ignore 2024-03-01 covered by e2e tests
+ 	if err := listen(); err != nil {
+-		return err
++		return fmt.Errorf("listen: %w", err)
++	}
++	close() //canopy:ignore
++	log.Print("canopy:ignore is not a directive outside comments")
+ 	return nil
+diff --git a/old.go b/old.go
+deleted file mode 100644
+--- a/old.go
++++ /dev/null
+@@ -1,1 +0,0 @@
+-x() // canopy:ignore
+`
+
+	since := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, map[string][]Suppression{
+		"pkg/server.go": {
+			{Line: 11, Since: since, Reason: "covered by e2e tests"},
+			{Line: 14},
+		},
+	}, ParseSuppressions([]byte(diff)))
+}
+
+func TestParseSuppression(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		expected Suppression
+		ok       bool
+	}{
+		{
+			name:     "trailing directive suppresses its line",
+			source:   "return nil // canopy:ignore unreachable",
+			expected: Suppression{Line: 5, Reason: "unreachable"},
+			ok:       true,
+		},
+		{
+			name:     "standalone directive suppresses the next line",
+			source:   "\t// canopy:ignore 2024-05-01",
+			expected: Suppression{Line: 6, Since: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)},
+			ok:       true,
+		},
+		{
+			name:     "invalid date is part of the reason",
+			source:   "f() // canopy:ignore 2024-13-01 soon",
+			expected: Suppression{Line: 5, Reason: "2024-13-01 soon"},
+			ok:       true,
+		},
+		{
+			name:   "longer directive name",
+			source: "f() // canopy:ignored",
+		},
+		{
+			name:   "no directive",
+			source: "f() // regular comment",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, ok := parseSuppression(tt.source, 5)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.expected, s)
+		})
+	}
+}
+
+func TestApplySuppressions(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	suppressions := map[string][]Suppression{
+		"a.go": {
+			{Line: 2, Since: now.AddDate(0, 0, -10)},
+			{Line: 3, Since: now.AddDate(0, 0, -100)},
+			{Line: 4},
+		},
+		"b.go": {{Line: 7, Since: now.AddDate(0, 0, -1)}},
+	}
+
+	tests := []struct {
+		name              string
+		maxAge            time.Duration
+		expectedUncovered map[string][]int
+		expectedSupp      map[string][]int
+		expectedExpired   map[string][]int
+		expectedAdded     int
+	}{
+		{
+			name:              "no expiry",
+			expectedUncovered: map[string][]int{"a.go": {1}},
+			expectedSupp:      map[string][]int{"a.go": {2, 3, 4}, "b.go": {7}},
+			expectedAdded:     6,
+		},
+		{
+			name:              "old and undated suppressions expire",
+			maxAge:            30 * 24 * time.Hour,
+			expectedUncovered: map[string][]int{"a.go": {1, 3, 4}},
+			expectedSupp:      map[string][]int{"a.go": {2}, "b.go": {7}},
+			expectedExpired:   map[string][]int{"a.go": {3, 4}},
+			expectedAdded:     8,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := &AnalysisResult{
+				UncoveredByFile: map[string][]int{"a.go": {1, 2, 3, 4}, "b.go": {7}},
+				DiffAddedLines:  10,
+			}
+
+			ApplySuppressions(result, suppressions, now, tt.maxAge)
+
+			assert.Equal(t, tt.expectedUncovered, result.UncoveredByFile)
+			assert.Equal(t, tt.expectedSupp, result.Suppressed)
+			assert.Equal(t, tt.expectedExpired, result.ExpiredSuppressions)
+			assert.Equal(t, tt.expectedAdded, result.DiffAddedLines)
+			assert.Equal(t, []string{"a.go", "b.go"}, result.SuppressedFiles())
+		})
+	}
+}
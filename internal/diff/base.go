@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os/exec"
+	"strings"
 )
 
 // GitBaseDiffSource implements DiffSource by running git diff to compare
@@ -17,6 +18,17 @@ type GitBaseDiffSource struct {
 	// WorkDir is the directory to run git commands in.
 	// If empty, uses the current working directory.
 	WorkDir string
+	// FetchMissing fetches BaseRef and CommitRef from Remote when they are
+	// missing from a shallow clone. Otherwise a missing ref in a shallow
+	// clone fails with ErrShallowClone.
+	FetchMissing bool
+	// Remote is the remote missing refs are fetched from.
+	// If empty, defaults to origin.
+	Remote string
+	// MergeBase compares the merge base of BaseRef and CommitRef instead of
+	// BaseRef, so commits BaseRef gained since CommitRef branched off (e.g.
+	// a main that moved ahead) don't show up as removed, as in a PR diff.
+	MergeBase bool
 }
 
 // NewGitBaseDiffSource creates a new GitBaseDiffSource for comparing against the specified base.
@@ -43,9 +55,22 @@ func (s *GitBaseDiffSource) GetDiff(ctx context.Context) ([]byte, error) {
 		commit = "HEAD"
 	}
 
+	base, err := s.resolve(ctx, s.BaseRef)
+	if err != nil {
+		return nil, err
+	}
+	if commit, err = s.resolve(ctx, commit); err != nil {
+		return nil, err
+	}
+	if s.MergeBase {
+		if base, err = s.mergeBase(ctx, base, commit); err != nil {
+			return nil, err
+		}
+	}
+
 	// git diff <base>..<commit> shows all changes between base and commit
 	// This captures all commits between the two references
-	cmd := exec.CommandContext(ctx, "git", "diff", s.BaseRef+".."+commit)
+	cmd := exec.CommandContext(ctx, "git", "diff", base+".."+commit)
 	if s.WorkDir != "" {
 		cmd.Dir = s.WorkDir
 	}
@@ -59,3 +84,40 @@ func (s *GitBaseDiffSource) GetDiff(ctx context.Context) ([]byte, error) {
 	}
 	return output, nil
 }
+
+// mergeBase returns the best common ancestor of base and commit. In a
+// shallow clone, the history connecting them may be missing.
+func (s *GitBaseDiffSource) mergeBase(ctx context.Context, base, commit string) (string, error) {
+	output, err := git(ctx, s.WorkDir, "merge-base", base, commit)
+	if err == nil {
+		return strings.TrimSpace(string(output)), nil
+	}
+	if shallow, shallowErr := isShallow(ctx, s.WorkDir); shallowErr == nil && shallow {
+		return "", fmt.Errorf("%w: the history of %s and %s doesn't reach their merge base; "+
+			"fetch the full history (fetch-depth: 0 with actions/checkout) or deepen it with git fetch --deepen", ErrShallowClone, s.BaseRef, s.CommitRef)
+	}
+	return "", fmt.Errorf("failed to find the merge base of %s and %s: %w", s.BaseRef, commit, err)
+}
+
+// resolve returns ref, or the SHA it was fetched as if it is missing from a
+// shallow clone and FetchMissing is set. Refs missing from a full clone are
+// returned as-is for git diff to report.
+func (s *GitBaseDiffSource) resolve(ctx context.Context, ref string) (string, error) {
+	if hasCommit(ctx, s.WorkDir, ref) {
+		return ref, nil
+	}
+	shallow, err := isShallow(ctx, s.WorkDir)
+	if err != nil || !shallow {
+		return ref, nil
+	}
+
+	remote := s.Remote
+	if remote == "" {
+		remote = defaultRemote
+	}
+	if !s.FetchMissing {
+		return "", fmt.Errorf("%w: %s is missing; fetch the full history (fetch-depth: 0 with actions/checkout), "+
+			"fetch it with git fetch --depth=1 %s %s, or enable fetching missing refs (--fetch-base)", ErrShallowClone, ref, remote, ref)
+	}
+	return fetchCommit(ctx, s.WorkDir, remote, ref, 1)
+}
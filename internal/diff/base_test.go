@@ -233,3 +233,75 @@ func TestGitBaseDiffSource_WithExplicitCommit_BranchNames(t *testing.T) {
 	assert.NotEmpty(t, output)
 	assert.Contains(t, string(output), "+func foo()")
 }
+
+func TestGitBaseDiffSource_MergeBase(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	exec.Command("git", "-C", tmpDir, "init").Run()
+	exec.Command("git", "-C", tmpDir, "config", "user.email", "test@test.com").Run()
+	exec.Command("git", "-C", tmpDir, "config", "user.name", "Test User").Run()
+
+	err := os.WriteFile(filepath.Join(tmpDir, "file.go"), []byte("package main\n"), 0644)
+	require.NoError(t, err)
+	exec.Command("git", "-C", tmpDir, "add", ".").Run()
+	exec.Command("git", "-C", tmpDir, "commit", "-m", "initial commit").Run()
+
+	out, err := exec.Command("git", "-C", tmpDir, "rev-parse", "--abbrev-ref", "HEAD").Output()
+	require.NoError(t, err)
+	mainBranch := strings.TrimSpace(string(out))
+
+	exec.Command("git", "-C", tmpDir, "checkout", "-b", "feature").Run()
+	err = os.WriteFile(filepath.Join(tmpDir, "feature.go"), []byte("package main\n\nfunc foo() {}\n"), 0644)
+	require.NoError(t, err)
+	exec.Command("git", "-C", tmpDir, "add", ".").Run()
+	exec.Command("git", "-C", tmpDir, "commit", "-m", "add foo").Run()
+
+	// Main moves ahead after the feature branched off
+	exec.Command("git", "-C", tmpDir, "checkout", mainBranch).Run()
+	err = os.WriteFile(filepath.Join(tmpDir, "main.go"), []byte("package main\n\nfunc bar() {}\n"), 0644)
+	require.NoError(t, err)
+	exec.Command("git", "-C", tmpDir, "add", ".").Run()
+	exec.Command("git", "-C", tmpDir, "commit", "-m", "add bar").Run()
+	exec.Command("git", "-C", tmpDir, "checkout", "feature").Run()
+
+	// Comparing the refs shows main's commit as removed
+	output, err := NewGitBaseDiffSource(mainBranch, "", tmpDir).GetDiff(context.Background())
+	require.NoError(t, err)
+	assert.Contains(t, string(output), "-func bar()")
+
+	source := &GitBaseDiffSource{BaseRef: mainBranch, WorkDir: tmpDir, MergeBase: true}
+	output, err = source.GetDiff(context.Background())
+	require.NoError(t, err)
+	assert.Contains(t, string(output), "+func foo()")
+	assert.NotContains(t, string(output), "func bar()")
+
+	source = &GitBaseDiffSource{BaseRef: "feature", CommitRef: mainBranch, WorkDir: tmpDir, MergeBase: true}
+	output, err = source.GetDiff(context.Background())
+	require.NoError(t, err)
+	assert.Contains(t, string(output), "+func bar()")
+	assert.NotContains(t, string(output), "func foo()")
+}
+
+func TestGitBaseDiffSource_MergeBase_UnrelatedHistories(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	exec.Command("git", "-C", tmpDir, "init").Run()
+	exec.Command("git", "-C", tmpDir, "config", "user.email", "test@test.com").Run()
+	exec.Command("git", "-C", tmpDir, "config", "user.name", "Test User").Run()
+
+	err := os.WriteFile(filepath.Join(tmpDir, "file.go"), []byte("package main\n"), 0644)
+	require.NoError(t, err)
+	exec.Command("git", "-C", tmpDir, "add", ".").Run()
+	exec.Command("git", "-C", tmpDir, "commit", "-m", "initial commit").Run()
+
+	out, err := exec.Command("git", "-C", tmpDir, "rev-parse", "--abbrev-ref", "HEAD").Output()
+	require.NoError(t, err)
+	mainBranch := strings.TrimSpace(string(out))
+
+	exec.Command("git", "-C", tmpDir, "checkout", "--orphan", "other").Run()
+	exec.Command("git", "-C", tmpDir, "commit", "-m", "unrelated").Run()
+
+	source := &GitBaseDiffSource{BaseRef: mainBranch, WorkDir: tmpDir, MergeBase: true}
+	_, err = source.GetDiff(context.Background())
+	assert.ErrorContains(t, err, "failed to find the merge base of "+mainBranch+" and HEAD")
+}
@@ -0,0 +1,100 @@
+package diff
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Author identifies the author of a commit as recorded by git, after
+// applying the repository's .mailmap.
+type Author struct {
+	Name  string
+	Email string
+}
+
+// Blame returns the author of the commit that last changed each of lines
+// (1-based) of file at HEAD, for the repository in workDir. If workDir is
+// empty, uses the current working directory.
+func Blame(ctx context.Context, workDir, file string, lines []int) (map[int]Author, error) {
+	authors := make(map[int]Author, len(lines))
+	if len(lines) == 0 {
+		return authors, nil
+	}
+
+	args := []string{"blame", "--line-porcelain"}
+	for _, r := range lineRanges(lines) {
+		args = append(args, "-L", fmt.Sprintf("%d,%d", r[0], r[1]))
+	}
+	args = append(args, "HEAD", "--", file)
+	output, err := git(ctx, workDir, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to blame %s: %w", file, err)
+	}
+
+	if err := parseBlame(output, authors); err != nil {
+		return nil, fmt.Errorf("failed to parse blame of %s: %w", file, err)
+	}
+	return authors, nil
+}
+
+// lineRanges collapses line numbers into inclusive ranges of consecutive
+// lines, sorted by line.
+func lineRanges(lines []int) [][2]int {
+	sorted := append([]int(nil), lines...)
+	sort.Ints(sorted)
+
+	var ranges [][2]int
+	for _, line := range sorted {
+		if n := len(ranges); n > 0 && line <= ranges[n-1][1]+1 {
+			if line > ranges[n-1][1] {
+				ranges[n-1][1] = line
+			}
+			continue
+		}
+		ranges = append(ranges, [2]int{line, line})
+	}
+	return ranges
+}
+
+// parseBlame reads git blame --line-porcelain output into authors, keyed
+// by final line number. Each line starts with a header of the commit, its
+// original line, and its final line, followed by the commit's fields and
+// the line's content prefixed with a tab.
+func parseBlame(output []byte, authors map[int]Author) error {
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	line := 0
+	var author Author
+	for scanner.Scan() {
+		text := scanner.Text()
+		switch {
+		case strings.HasPrefix(text, "\t"):
+			if line == 0 {
+				return fmt.Errorf("line content without header")
+			}
+			authors[line] = author
+			line, author = 0, Author{}
+		case line == 0:
+			fields := strings.Fields(text)
+			if len(fields) < 3 {
+				return fmt.Errorf("malformed header %q", text)
+			}
+			n, err := strconv.Atoi(fields[2])
+			if err != nil || n <= 0 {
+				return fmt.Errorf("malformed header %q", text)
+			}
+			line = n
+		case strings.HasPrefix(text, "author "):
+			author.Name = strings.TrimPrefix(text, "author ")
+		case strings.HasPrefix(text, "author-mail "):
+			author.Email = strings.Trim(strings.TrimPrefix(text, "author-mail "), "<>")
+		}
+	}
+	return scanner.Err()
+}
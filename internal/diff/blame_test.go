@@ -0,0 +1,77 @@
+package diff
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// commitAs writes content to file.go and commits it as the given author.
+func commitAs(t *testing.T, dir, content, name, email string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file.go"), []byte(content), 0644))
+	require.NoError(t, exec.Command("git", "-C", dir, "add", ".").Run())
+
+	cmd := exec.Command("git", "-C", dir, "commit", "-m", "change")
+	cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME="+name, "GIT_AUTHOR_EMAIL="+email)
+	require.NoError(t, cmd.Run())
+}
+
+func TestBlame(t *testing.T) {
+	tmpDir := t.TempDir()
+	exec.Command("git", "-C", tmpDir, "init").Run()
+	exec.Command("git", "-C", tmpDir, "config", "user.email", "test@test.com").Run()
+	exec.Command("git", "-C", tmpDir, "config", "user.name", "Test User").Run()
+
+	commitAs(t, tmpDir, "package main\n\nfunc a() {}\n", "Alice", "alice@example.com")
+	commitAs(t, tmpDir, "package main\n\nfunc a() {}\n\nfunc b() {}\n", "Bob", "bob@example.com")
+
+	alice := Author{Name: "Alice", Email: "alice@example.com"}
+	bob := Author{Name: "Bob", Email: "bob@example.com"}
+
+	tests := []struct {
+		name  string
+		lines []int
+		want  map[int]Author
+	}{
+		{
+			name:  "single lines",
+			lines: []int{3, 5},
+			want:  map[int]Author{3: alice, 5: bob},
+		},
+		{
+			name:  "consecutive lines",
+			lines: []int{5, 1, 2, 3},
+			want:  map[int]Author{1: alice, 2: alice, 3: alice, 5: bob},
+		},
+		{
+			name:  "no lines",
+			lines: nil,
+			want:  map[int]Author{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authors, err := Blame(context.Background(), tmpDir, "file.go", tt.lines)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, authors)
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := Blame(context.Background(), tmpDir, "missing.go", []int{1})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to blame missing.go")
+	})
+}
+
+func TestLineRanges(t *testing.T) {
+	assert.Equal(t, [][2]int{{1, 3}, {5, 5}, {7, 8}}, lineRanges([]int{8, 1, 2, 3, 5, 7, 2}))
+	assert.Nil(t, lineRanges(nil))
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os/exec"
+	"strings"
 )
 
 // GitCommitDiffSource implements DiffSource by running git diff-tree to get
@@ -14,6 +15,11 @@ type GitCommitDiffSource struct {
 	// WorkDir is the directory to run git commands in.
 	// If empty, uses the current working directory.
 	WorkDir string
+	// FetchMissing fetches CommitSHA and its parent from origin when a
+	// shallow clone is missing either. Otherwise that fails with
+	// ErrShallowClone, rather than diffing a commit cut off from its parent
+	// as a root commit that adds every file.
+	FetchMissing bool
 }
 
 // NewGitCommitDiffSource creates a new GitCommitDiffSource for the specified commit.
@@ -32,6 +38,10 @@ func (s *GitCommitDiffSource) GetDiff(ctx context.Context) ([]byte, error) {
 		return nil, fmt.Errorf("commit SHA is required")
 	}
 
+	if err := s.ensureParent(ctx); err != nil {
+		return nil, err
+	}
+
 	// git diff-tree -p --root <commit> shows the changes introduced by that commit
 	// -p generates patch output (unified diff)
 	// --root allows viewing root commits (first commit with no parent)
@@ -49,3 +59,31 @@ func (s *GitCommitDiffSource) GetDiff(ctx context.Context) ([]byte, error) {
 	}
 	return output, nil
 }
+
+// ensureParent checks that CommitSHA and its parent are present in a
+// shallow clone, fetching them if FetchMissing is set. Root commits and
+// commits missing from a full clone are left for git diff-tree to handle.
+func (s *GitCommitDiffSource) ensureParent(ctx context.Context) error {
+	if hasCommit(ctx, s.WorkDir, s.CommitSHA+"^") {
+		return nil
+	}
+	shallow, err := isShallow(ctx, s.WorkDir)
+	if err != nil || !shallow {
+		return nil
+	}
+	if hasCommit(ctx, s.WorkDir, s.CommitSHA) {
+		// The commit object lists its parents even when the clone is cut
+		// off at the commit
+		output, err := git(ctx, s.WorkDir, "cat-file", "-p", s.CommitSHA)
+		if err != nil || !strings.Contains(string(output), "\nparent ") {
+			return nil
+		}
+	}
+
+	if !s.FetchMissing {
+		return fmt.Errorf("%w: %s or its parent is missing; fetch the full history (fetch-depth: 0 with actions/checkout), "+
+			"fetch them with git fetch --depth=2 %s %s, or enable fetching missing refs (--fetch-base)", ErrShallowClone, s.CommitSHA, defaultRemote, s.CommitSHA)
+	}
+	_, err = fetchCommit(ctx, s.WorkDir, defaultRemote, s.CommitSHA, 2)
+	return err
+}
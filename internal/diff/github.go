@@ -5,13 +5,22 @@ import (
 	"fmt"
 )
 
+// DiffClient is the subset of a code host API a GitHubAPIDiffSource fetches
+// diffs with, as implemented by github.Client (which asks for the
+// application/vnd.github.diff media type) and the worker's providers.
+type DiffClient interface {
+	// PullRequestDiff returns the unified diff of a pull request
+	PullRequestDiff(ctx context.Context, owner, repo string, number int) ([]byte, error)
+	// CompareDiff returns the unified diff between two commits, branches,
+	// or tags
+	CompareDiff(ctx context.Context, owner, repo, base, head string) ([]byte, error)
+}
+
 // GitHubAPIDiffSource implements DiffSource by fetching diff data from the GitHub API.
 // This is used in the worker service to get PR diffs without needing a local checkout.
 type GitHubAPIDiffSource struct {
-	// Client is the GitHub API client.
-	// For now this is a placeholder - the actual type will be determined
-	// when implementing the worker service.
-	Client interface{}
+	// Client fetches the diff.
+	Client DiffClient
 
 	// Owner is the repository owner (org or user).
 	Owner string
@@ -25,10 +34,12 @@ type GitHubAPIDiffSource struct {
 	HeadSHA string
 }
 
-// NewGitHubAPIDiffSource creates a new GitHubAPIDiffSource.
-// This is a placeholder implementation for the worker service.
-func NewGitHubAPIDiffSource(owner, repo string, prNumber int, baseSHA, headSHA string) *GitHubAPIDiffSource {
+// NewGitHubAPIDiffSource creates a new GitHubAPIDiffSource. With a
+// prNumber, the PR's diff is fetched; otherwise the diff from baseSHA to
+// headSHA.
+func NewGitHubAPIDiffSource(client DiffClient, owner, repo string, prNumber int, baseSHA, headSHA string) *GitHubAPIDiffSource {
 	return &GitHubAPIDiffSource{
+		Client:   client,
 		Owner:    owner,
 		Repo:     repo,
 		PRNumber: prNumber,
@@ -37,15 +48,23 @@ func NewGitHubAPIDiffSource(owner, repo string, prNumber int, baseSHA, headSHA s
 	}
 }
 
-// GetDiff fetches the diff from the GitHub API.
-// This is a stub implementation - the actual implementation will use
-// the go-github client to fetch PR diffs or compare commits.
+// GetDiff fetches the diff of the pull request from the pulls API, or
+// without one the three-dot diff from BaseSHA to HeadSHA from the compare
+// API, as parsed by coverage.ParseDiff.
 func (s *GitHubAPIDiffSource) GetDiff(ctx context.Context) ([]byte, error) {
-	// TODO: Implement when building the worker service
-	// Options for implementation:
-	// 1. For PRs: client.PullRequests.GetRaw(ctx, owner, repo, prNumber, opts)
-	//    with MediaType set to "diff" to get unified diff format
-	// 2. For commits: client.Repositories.CompareCommits(ctx, owner, repo, base, head, opts)
-	//    and extract the diff data
-	return nil, fmt.Errorf("GitHubAPIDiffSource not yet implemented")
+	if s.PRNumber > 0 {
+		data, err := s.Client.PullRequestDiff(ctx, s.Owner, s.Repo, s.PRNumber)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get diff of pull request %d: %w", s.PRNumber, err)
+		}
+		return data, nil
+	}
+	if s.BaseSHA == "" || s.HeadSHA == "" {
+		return nil, fmt.Errorf("base and head SHAs are required without a pull request")
+	}
+	data, err := s.Client.CompareDiff(ctx, s.Owner, s.Repo, s.BaseSHA, s.HeadSHA)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare %s...%s: %w", s.BaseSHA, s.HeadSHA, err)
+	}
+	return data, nil
 }
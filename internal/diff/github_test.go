@@ -2,23 +2,85 @@ package diff
 
 import (
 	"context"
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-func TestGitHubAPIDiffSource_GetDiff_NotImplemented(t *testing.T) {
-	source := NewGitHubAPIDiffSource("owner", "repo", 123, "base", "head")
-	_, err := source.GetDiff(context.Background())
+// fakeDiffClient records the diffs asked for.
+type fakeDiffClient struct {
+	calls []string
+	err   error
+}
+
+func (c *fakeDiffClient) PullRequestDiff(ctx context.Context, owner, repo string, number int) ([]byte, error) {
+	c.calls = append(c.calls, "pulls")
+	return []byte("diff --git a/pr.go b/pr.go\n"), c.err
+}
+
+func (c *fakeDiffClient) CompareDiff(ctx context.Context, owner, repo, base, head string) ([]byte, error) {
+	c.calls = append(c.calls, "compare "+base+"..."+head)
+	return []byte("diff --git a/compare.go b/compare.go\n"), c.err
+}
+
+func TestGitHubAPIDiffSource_GetDiff(t *testing.T) {
+	tests := []struct {
+		name          string
+		prNumber      int
+		base, head    string
+		err           error
+		expected      string
+		expectedCalls []string
+		errorMsg      string
+	}{
+		{
+			name:          "pull request",
+			prNumber:      123,
+			base:          "abc123",
+			head:          "def456",
+			expected:      "diff --git a/pr.go b/pr.go\n",
+			expectedCalls: []string{"pulls"},
+		},
+		{
+			name:          "commits",
+			base:          "abc123",
+			head:          "def456",
+			expected:      "diff --git a/compare.go b/compare.go\n",
+			expectedCalls: []string{"compare abc123...def456"},
+		},
+		{name: "missing head", base: "abc123", errorMsg: "base and head SHAs are required without a pull request"},
+		{
+			name:          "API error",
+			prNumber:      123,
+			err:           errors.New("404 Not Found"),
+			expectedCalls: []string{"pulls"},
+			errorMsg:      "failed to get diff of pull request 123: 404 Not Found",
+		},
+	}
 
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "not yet implemented")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeDiffClient{err: tt.err}
+			data, err := NewGitHubAPIDiffSource(client, "owner", "repo", tt.prNumber, tt.base, tt.head).GetDiff(context.Background())
+			assert.Equal(t, tt.expectedCalls, client.calls)
+			if tt.errorMsg != "" {
+				assert.EqualError(t, err, tt.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, string(data))
+		})
+	}
 }
 
 func TestNewGitHubAPIDiffSource(t *testing.T) {
-	source := NewGitHubAPIDiffSource("owner", "repo", 456, "abc123", "def456")
+	client := &fakeDiffClient{}
+	source := NewGitHubAPIDiffSource(client, "owner", "repo", 456, "abc123", "def456")
 
 	assert.NotNil(t, source)
+	assert.Equal(t, client, source.Client)
 	assert.Equal(t, "owner", source.Owner)
 	assert.Equal(t, "repo", source.Repo)
 	assert.Equal(t, 456, source.PRNumber)
@@ -3,7 +3,10 @@ package diff
 import (
 	"context"
 	"fmt"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 )
 
 // LocalDiffSource implements DiffSource by running git diff against the working tree.
@@ -12,6 +15,12 @@ type LocalDiffSource struct {
 	// WorkDir is the directory to run git commands in.
 	// If empty, uses the current working directory.
 	WorkDir string
+	// Staged diffs only the changes staged for the next commit
+	// (git diff --cached), leaving the index untouched.
+	Staged bool
+	// Exclude are paths left out of the diff, such as a cache directory
+	// inside the working tree. Paths outside the working tree are ignored.
+	Exclude []string
 }
 
 // NewLocalDiffSource creates a new LocalDiffSource.
@@ -24,9 +33,27 @@ func NewLocalDiffSource(workDir string) *LocalDiffSource {
 // GetDiff executes `git add -N . && git diff` and returns the output.
 // It first runs `git add -N .` to mark new untracked files as intent-to-add,
 // which allows them to appear in the diff output.
+// With Staged, only `git diff --cached` runs.
+// Both commands skip the Exclude paths.
 func (s *LocalDiffSource) GetDiff(ctx context.Context) ([]byte, error) {
+	excludes, err := s.excludePathspecs()
+	if err != nil {
+		return nil, err
+	}
+	diffArgs := []string{"diff"}
+	if s.Staged {
+		diffArgs = append(diffArgs, "--cached")
+	}
+	if len(excludes) > 0 {
+		// Exclude-only pathspecs exclude from the whole repository
+		diffArgs = append(append(diffArgs, "--"), excludes...)
+	}
+	if s.Staged {
+		return git(ctx, s.WorkDir, diffArgs...)
+	}
+
 	// Add untracked files as intent-to-add so they show up in diff
-	addCmd := exec.CommandContext(ctx, "git", "add", "-N", ".")
+	addCmd := exec.CommandContext(ctx, "git", append([]string{"add", "-N", "--", "."}, excludes...)...)
 	if s.WorkDir != "" {
 		addCmd.Dir = s.WorkDir
 	}
@@ -38,7 +65,7 @@ func (s *LocalDiffSource) GetDiff(ctx context.Context) ([]byte, error) {
 	}
 
 	// Now run git diff to get all changes including new files
-	diffCmd := exec.CommandContext(ctx, "git", "diff")
+	diffCmd := exec.CommandContext(ctx, "git", diffArgs...)
 	if s.WorkDir != "" {
 		diffCmd.Dir = s.WorkDir
 	}
@@ -51,3 +78,30 @@ func (s *LocalDiffSource) GetDiff(ctx context.Context) ([]byte, error) {
 	}
 	return output, nil
 }
+
+// excludePathspecs returns the git pathspecs excluding the Exclude paths
+// inside the working tree.
+func (s *LocalDiffSource) excludePathspecs() ([]string, error) {
+	if len(s.Exclude) == 0 {
+		return nil, nil
+	}
+	workDir, err := filepath.Abs(s.WorkDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve working directory: %w", err)
+	}
+	var pathspecs []string
+	for _, path := range s.Exclude {
+		if path == "" {
+			continue
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(workDir, path)
+		}
+		rel, err := filepath.Rel(workDir, path)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+			continue
+		}
+		pathspecs = append(pathspecs, ":(exclude,literal)"+filepath.ToSlash(rel))
+	}
+	return pathspecs, nil
+}
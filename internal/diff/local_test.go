@@ -111,3 +111,77 @@ func TestLocalDiffSource_NotGitRepository(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "git")
 }
+
+func TestLocalDiffSource_Staged(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	exec.Command("git", "-C", tmpDir, "init").Run()
+	exec.Command("git", "-C", tmpDir, "config", "user.email", "test@test.com").Run()
+	exec.Command("git", "-C", tmpDir, "config", "user.name", "Test User").Run()
+
+	err := os.WriteFile(filepath.Join(tmpDir, "initial.txt"), []byte("initial\n"), 0644)
+	require.NoError(t, err)
+	exec.Command("git", "-C", tmpDir, "add", ".").Run()
+	exec.Command("git", "-C", tmpDir, "commit", "-m", "initial").Run()
+
+	// One staged change, one unstaged change, and one untracked file
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "staged.txt"), []byte("staged\n"), 0644))
+	exec.Command("git", "-C", tmpDir, "add", "staged.txt").Run()
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "initial.txt"), []byte("modified\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "untracked.txt"), []byte("untracked\n"), 0644))
+
+	source := &LocalDiffSource{WorkDir: tmpDir, Staged: true}
+	output, err := source.GetDiff(context.Background())
+	require.NoError(t, err)
+	assert.Contains(t, string(output), "+staged")
+	assert.NotContains(t, string(output), "modified")
+	assert.NotContains(t, string(output), "untracked")
+
+	// The untracked file isn't intent-added to the index
+	status, err := exec.Command("git", "-C", tmpDir, "status", "--porcelain", "untracked.txt").Output()
+	require.NoError(t, err)
+	assert.Equal(t, "?? untracked.txt\n", string(status))
+}
+
+func TestLocalDiffSource_Exclude(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	exec.Command("git", "-C", tmpDir, "init").Run()
+	exec.Command("git", "-C", tmpDir, "config", "user.email", "test@test.com").Run()
+	exec.Command("git", "-C", tmpDir, "config", "user.name", "Test User").Run()
+
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "initial.txt"), []byte("initial\n"), 0644))
+	exec.Command("git", "-C", tmpDir, "add", ".").Run()
+	exec.Command("git", "-C", tmpDir, "commit", "-m", "initial").Run()
+
+	// A changed file, and a cache directory written inside the working tree
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "initial.txt"), []byte("modified\n"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(tmpDir, ".canopy", "cache"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, ".canopy", "cache", "entry.json"), []byte("{}\n"), 0644))
+
+	tests := []struct {
+		name    string
+		exclude []string
+		cached  bool
+	}{
+		{name: "relative path", exclude: []string{".canopy/cache"}},
+		{name: "absolute path", exclude: []string{filepath.Join(tmpDir, ".canopy", "cache")}},
+		{name: "path outside the working tree", exclude: []string{t.TempDir(), "..", ""}, cached: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exec.Command("git", "-C", tmpDir, "reset").Run()
+
+			source := &LocalDiffSource{WorkDir: tmpDir, Exclude: tt.exclude}
+			output, err := source.GetDiff(context.Background())
+			require.NoError(t, err)
+			assert.Contains(t, string(output), "+modified")
+			if tt.cached {
+				assert.Contains(t, string(output), "entry.json")
+			} else {
+				assert.NotContains(t, string(output), "entry.json")
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package diff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// ErrShallowClone indicates that a ref or history needed for the diff is
+// missing because the repository is a shallow clone, e.g. an
+// actions/checkout checkout with the default fetch-depth of 1.
+var ErrShallowClone = errors.New("repository is a shallow clone")
+
+// defaultRemote is the remote missing refs are fetched from by default.
+const defaultRemote = "origin"
+
+// git runs a git command in workDir and returns its output.
+// If workDir is empty, uses the current working directory.
+func git(ctx context.Context, workDir string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	if workDir != "" {
+		cmd.Dir = workDir
+	}
+
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return nil, fmt.Errorf("git %s failed: %s", args[0], string(exitErr.Stderr))
+		}
+		return nil, err
+	}
+	return output, nil
+}
+
+// isShallow reports whether the repository in workDir is a shallow clone.
+func isShallow(ctx context.Context, workDir string) (bool, error) {
+	output, err := git(ctx, workDir, "rev-parse", "--is-shallow-repository")
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(string(output)) == "true", nil
+}
+
+// hasCommit reports whether ref resolves to a commit in the repository in workDir.
+func hasCommit(ctx context.Context, workDir, ref string) bool {
+	_, err := git(ctx, workDir, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	return err == nil
+}
+
+// fetchCommit fetches ref from remote with depth commits of history and
+// returns the SHA of the fetched commit.
+func fetchCommit(ctx context.Context, workDir, remote, ref string, depth int) (string, error) {
+	if _, err := git(ctx, workDir, "fetch", "--no-tags", fmt.Sprintf("--depth=%d", depth), remote, ref); err != nil {
+		return "", fmt.Errorf("failed to fetch %s from %s: %w", ref, remote, err)
+	}
+	output, err := git(ctx, workDir, "rev-parse", "FETCH_HEAD")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
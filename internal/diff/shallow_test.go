@@ -0,0 +1,99 @@
+package diff
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// shallowClone creates a repository with three dated commits and returns a
+// clone of it with only the last commit, along with the SHAs of the commits
+// from oldest to newest.
+func shallowClone(t *testing.T) (string, []string) {
+	t.Helper()
+	src := filepath.Join(t.TempDir(), "src")
+	require.NoError(t, exec.Command("git", "init", src).Run())
+	exec.Command("git", "-C", src, "config", "user.email", "test@test.com").Run()
+	exec.Command("git", "-C", src, "config", "user.name", "Test User").Run()
+
+	commitAt(t, src, "package main\n", "2024-01-01T12:00:00Z", "initial")
+	commitAt(t, src, "package main\n\nfunc foo() {}\n", "2024-02-01T12:00:00Z", "add foo")
+	commitAt(t, src, "package main\n\nfunc foo() {}\n\nfunc bar() {}\n", "2024-03-01T12:00:00Z", "add bar")
+
+	out, err := exec.Command("git", "-C", src, "rev-list", "--reverse", "HEAD").Output()
+	require.NoError(t, err)
+	shas := strings.Fields(string(out))
+
+	dst := filepath.Join(t.TempDir(), "dst")
+	require.NoError(t, exec.Command("git", "clone", "--quiet", "--depth=1", "file://"+src, dst).Run())
+	return dst, shas
+}
+
+func TestGitBaseDiffSource_ShallowClone(t *testing.T) {
+	t.Run("missing base fails with guidance", func(t *testing.T) {
+		dir, shas := shallowClone(t)
+		_, err := NewGitBaseDiffSource(shas[0], "", dir).GetDiff(context.Background())
+		require.ErrorIs(t, err, ErrShallowClone)
+		assert.Contains(t, err.Error(), "fetch-depth: 0")
+		assert.Contains(t, err.Error(), "git fetch --depth=1 origin "+shas[0])
+	})
+
+	t.Run("missing base is fetched", func(t *testing.T) {
+		dir, shas := shallowClone(t)
+		source := NewGitBaseDiffSource(shas[0], "", dir)
+		source.FetchMissing = true
+		output, err := source.GetDiff(context.Background())
+		require.NoError(t, err)
+		assert.Contains(t, string(output), "+func foo() {}")
+		assert.Contains(t, string(output), "+func bar() {}")
+		assert.NotContains(t, string(output), "+package main")
+	})
+
+	t.Run("fetching an unknown ref fails", func(t *testing.T) {
+		dir, _ := shallowClone(t)
+		source := NewGitBaseDiffSource("nonexistent", "", dir)
+		source.FetchMissing = true
+		_, err := source.GetDiff(context.Background())
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to fetch nonexistent from origin")
+	})
+
+	t.Run("present base needs no fetch", func(t *testing.T) {
+		dir, _ := shallowClone(t)
+		output, err := NewGitBaseDiffSource("HEAD", "", dir).GetDiff(context.Background())
+		require.NoError(t, err)
+		assert.Empty(t, output)
+	})
+}
+
+func TestGitCommitDiffSource_ShallowClone(t *testing.T) {
+	t.Run("commit cut off from its parent fails with guidance", func(t *testing.T) {
+		dir, shas := shallowClone(t)
+		_, err := NewGitCommitDiffSource(shas[2], dir).GetDiff(context.Background())
+		require.ErrorIs(t, err, ErrShallowClone)
+		assert.Contains(t, err.Error(), "git fetch --depth=2 origin "+shas[2])
+	})
+
+	t.Run("parent is fetched", func(t *testing.T) {
+		dir, shas := shallowClone(t)
+		source := NewGitCommitDiffSource(shas[2], dir)
+		source.FetchMissing = true
+		output, err := source.GetDiff(context.Background())
+		require.NoError(t, err)
+		assert.Contains(t, string(output), "+func bar() {}")
+		assert.NotContains(t, string(output), "+func foo() {}", "only the commit's own changes are reported")
+	})
+}
+
+func TestGitWindowDiffSource_ShallowClone(t *testing.T) {
+	dir, _ := shallowClone(t)
+
+	_, err := NewGitWindowDiffSource("2024-01-15", "", dir).GetDiff(context.Background())
+	require.ErrorIs(t, err, ErrShallowClone, "the window must not silently cover the whole tree")
+	assert.Contains(t, err.Error(), "history before 2024-01-15 is missing")
+}
@@ -0,0 +1,91 @@
+package diff
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// emptyTreeSHA is git's well-known hash of the empty tree, used as the base
+// when the whole history falls inside the window.
+const emptyTreeSHA = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+// GitWindowDiffSource implements DiffSource for trunk-based workflows, where
+// "new code" is every line added within a time window or since a ref (usually
+// a release tag) rather than in a PR.
+//
+// The window is resolved to a base commit and diffed against HEAD, so the result
+// aggregates every commit in the window and reports line numbers as they are at HEAD.
+// Lines added and later removed within the window are not reported.
+type GitWindowDiffSource struct {
+	// Since is a git date expression (e.g., "30 days ago", "2024-01-31").
+	// The base is the last first-parent commit on HEAD before this date.
+	Since string
+	// SinceRef is a reference (e.g., a release tag) marking the start of the window.
+	SinceRef string
+	// WorkDir is the directory to run git commands in.
+	// If empty, uses the current working directory.
+	WorkDir string
+	// FetchMissing fetches SinceRef from origin when it is missing from a
+	// shallow clone (see GitBaseDiffSource.FetchMissing).
+	FetchMissing bool
+}
+
+// NewGitWindowDiffSource creates a GitWindowDiffSource.
+// Exactly one of since and sinceRef must be set.
+func NewGitWindowDiffSource(since, sinceRef, workDir string) *GitWindowDiffSource {
+	return &GitWindowDiffSource{
+		Since:    since,
+		SinceRef: sinceRef,
+		WorkDir:  workDir,
+	}
+}
+
+// GetDiff resolves the start of the window and returns the diff from there to HEAD.
+func (s *GitWindowDiffSource) GetDiff(ctx context.Context) ([]byte, error) {
+	base, err := s.resolveBase(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	source := NewGitBaseDiffSource(base, "HEAD", s.WorkDir)
+	source.FetchMissing = s.FetchMissing
+	return source.GetDiff(ctx)
+}
+
+// resolveBase returns the commit the window starts from.
+func (s *GitWindowDiffSource) resolveBase(ctx context.Context) (string, error) {
+	switch {
+	case s.Since != "" && s.SinceRef != "":
+		return "", fmt.Errorf("only one of since and since ref can be set")
+	case s.SinceRef != "":
+		return s.SinceRef, nil
+	case s.Since != "":
+		// Follow first parents so merged branches' older commits don't move the base
+		output, err := s.git(ctx, "rev-list", "-1", "--first-parent", "--before="+s.Since, "HEAD")
+		if err != nil {
+			return "", err
+		}
+		base := strings.TrimSpace(string(output))
+		if base == "" {
+			// A shallow clone only looks like it starts inside the window
+			shallow, err := isShallow(ctx, s.WorkDir)
+			if err != nil {
+				return "", err
+			}
+			if shallow {
+				return "", fmt.Errorf("%w: history before %s is missing; fetch the full history (fetch-depth: 0 with actions/checkout)", ErrShallowClone, s.Since)
+			}
+			// Every commit is inside the window
+			return emptyTreeSHA, nil
+		}
+		return base, nil
+	default:
+		return "", fmt.Errorf("since or since ref is required")
+	}
+}
+
+// git runs a git command in WorkDir and returns its output.
+func (s *GitWindowDiffSource) git(ctx context.Context, args ...string) ([]byte, error) {
+	return git(ctx, s.WorkDir, args...)
+}
@@ -0,0 +1,114 @@
+package diff
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// commitAt writes content to file.go and commits it with the given date.
+func commitAt(t *testing.T, dir, content, date, message string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file.go"), []byte(content), 0644))
+	require.NoError(t, exec.Command("git", "-C", dir, "add", ".").Run())
+
+	cmd := exec.Command("git", "-C", dir, "commit", "-m", message)
+	cmd.Env = append(os.Environ(), "GIT_AUTHOR_DATE="+date, "GIT_COMMITTER_DATE="+date)
+	require.NoError(t, cmd.Run())
+}
+
+func TestGitWindowDiffSource_GetDiff(t *testing.T) {
+	tmpDir := t.TempDir()
+	exec.Command("git", "-C", tmpDir, "init").Run()
+	exec.Command("git", "-C", tmpDir, "config", "user.email", "test@test.com").Run()
+	exec.Command("git", "-C", tmpDir, "config", "user.name", "Test User").Run()
+
+	commitAt(t, tmpDir, "package main\n", "2024-01-01T12:00:00Z", "initial")
+	commitAt(t, tmpDir, "package main\n\nfunc old() {}\n", "2024-02-01T12:00:00Z", "add old")
+	exec.Command("git", "-C", tmpDir, "tag", "v1.0.0").Run()
+	commitAt(t, tmpDir, "package main\n\nfunc old() {}\n\nfunc recent() {}\n", "2024-03-01T12:00:00Z", "add recent")
+
+	tests := []struct {
+		name       string
+		since      string
+		sinceRef   string
+		contains   []string
+		excludes   []string
+		wantErr    string
+		expectNone bool
+	}{
+		{
+			name:     "since date includes only commits in window",
+			since:    "2024-02-15",
+			contains: []string{"+func recent() {}"},
+			excludes: []string{"+func old() {}"},
+		},
+		{
+			name:     "window spanning two commits aggregates them",
+			since:    "2024-01-15",
+			contains: []string{"+func recent() {}", "+func old() {}"},
+			excludes: []string{"+package main"},
+		},
+		{
+			name:     "window older than history diffs against empty tree",
+			since:    "2023-01-01",
+			contains: []string{"+package main", "+func old() {}", "+func recent() {}"},
+		},
+		{
+			name:     "since tag",
+			sinceRef: "v1.0.0",
+			contains: []string{"+func recent() {}"},
+			excludes: []string{"+func old() {}"},
+		},
+		{
+			name:       "window after last commit is empty",
+			since:      "2025-01-01",
+			expectNone: true,
+		},
+		{
+			name:     "both since and since ref",
+			since:    "2024-01-01",
+			sinceRef: "v1.0.0",
+			wantErr:  "only one of",
+		},
+		{
+			name:    "neither since nor since ref",
+			wantErr: "is required",
+		},
+		{
+			name:     "unknown ref",
+			sinceRef: "v9.9.9",
+			wantErr:  "git diff failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := NewGitWindowDiffSource(tt.since, tt.sinceRef, tmpDir)
+			output, err := source.GetDiff(context.Background())
+
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+
+			if tt.expectNone {
+				assert.Empty(t, output)
+				return
+			}
+			for _, s := range tt.contains {
+				assert.Contains(t, string(output), s)
+			}
+			for _, s := range tt.excludes {
+				assert.NotContains(t, string(output), s)
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package format
+
+import (
+	"fmt"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+)
+
+// formatAddedLines describes the production and test lines added by a
+// change, e.g. "500 production, 20 test (0.04 test lines per production line)".
+// Returns "" if no lines were added.
+func formatAddedLines(result *coverage.AnalysisResult) string {
+	if result.ProductionAddedLines == 0 && result.TestAddedLines == 0 {
+		return ""
+	}
+
+	s := fmt.Sprintf("%d production, %d test", result.ProductionAddedLines, result.TestAddedLines)
+	if result.ProductionAddedLines > 0 {
+		s += fmt.Sprintf(" (%.2f test lines per production line)", result.TestRatio())
+	}
+	return s
+}
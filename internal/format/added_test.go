@@ -0,0 +1,57 @@
+package format
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatAddedLines(t *testing.T) {
+	tests := []struct {
+		name     string
+		result   *coverage.AnalysisResult
+		expected string
+	}{
+		{
+			name:     "production and tests",
+			result:   &coverage.AnalysisResult{ProductionAddedLines: 500, TestAddedLines: 20},
+			expected: "500 production, 20 test (0.04 test lines per production line)",
+		},
+		{
+			name:     "tests only",
+			result:   &coverage.AnalysisResult{TestAddedLines: 20},
+			expected: "0 production, 20 test",
+		},
+		{
+			name:   "nothing added",
+			result: &coverage.AnalysisResult{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, formatAddedLines(tt.result))
+		})
+	}
+}
+
+func TestAddedLines_Output(t *testing.T) {
+	result := &coverage.AnalysisResult{
+		UncoveredByFile:      map[string][]int{"main.go": {4}},
+		DiffAddedLines:       4,
+		DiffAddedCovered:     3,
+		ProductionAddedLines: 10,
+		TestAddedLines:       5,
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, (&TextFormatter{}).Format(result, &buf))
+	assert.Contains(t, buf.String(), "(75.0% coverage)\nAdded lines: 10 production, 5 test (0.50 test lines per production line)\n")
+
+	buf.Reset()
+	require.NoError(t, (&MarkdownFormatter{}).Format(result, &buf))
+	assert.Contains(t, buf.String(), "(75.0% coverage)\n\n**Added lines:** 10 production, 5 test (0.50 test lines per production line)\n")
+}
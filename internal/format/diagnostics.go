@@ -0,0 +1,48 @@
+package format
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+)
+
+// FormatMatchDiagnostics writes a plain text diagnostics section describing
+// diff files that had no coverage profile and profiles that matched no diff file.
+func FormatMatchDiagnostics(diag *coverage.MatchDiagnostics, w io.Writer) error {
+	if diag == nil {
+		return fmt.Errorf("diagnostics is nil")
+	}
+
+	fmt.Fprintln(w, "Matching diagnostics:")
+	fmt.Fprintln(w)
+
+	if !diag.HasUnmatched() {
+		fmt.Fprintln(w, "All diff files matched a coverage profile")
+		return nil
+	}
+
+	if len(diag.UnmatchedDiffFiles) > 0 {
+		fmt.Fprintf(w, "Diff files with no coverage profile (%d):\n", len(diag.UnmatchedDiffFiles))
+		for _, file := range diag.UnmatchedDiffFiles {
+			fmt.Fprintf(w, "  %s\n", file.File)
+			if len(file.Candidates) == 0 {
+				fmt.Fprintln(w, "    candidates considered: none")
+			} else {
+				fmt.Fprintf(w, "    candidates considered: %s\n", strings.Join(file.Candidates, ", "))
+			}
+		}
+		fmt.Fprintln(w)
+	}
+
+	if len(diag.UnmatchedProfiles) > 0 {
+		fmt.Fprintf(w, "Coverage profiles matching no diff file (%d):\n", len(diag.UnmatchedProfiles))
+		for _, profile := range diag.UnmatchedProfiles {
+			fmt.Fprintf(w, "  %s\n", profile)
+		}
+		fmt.Fprintln(w)
+	}
+
+	return nil
+}
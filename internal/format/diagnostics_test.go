@@ -0,0 +1,73 @@
+package format
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatMatchDiagnostics(t *testing.T) {
+	tests := []struct {
+		name           string
+		diag           *coverage.MatchDiagnostics
+		expectedOutput string
+		expectError    bool
+	}{
+		{
+			name: "everything matched",
+			diag: &coverage.MatchDiagnostics{},
+			expectedOutput: `Matching diagnostics:
+
+All diff files matched a coverage profile
+`,
+		},
+		{
+			name: "unmatched diff files and profiles",
+			diag: &coverage.MatchDiagnostics{
+				UnmatchedDiffFiles: []coverage.UnmatchedDiffFile{
+					{File: "cmd/new.go"},
+					{
+						File:       "internal/c/handler.go",
+						Candidates: []string{"github.com/org/repo/internal/a/handler.go", "github.com/org/repo/internal/b/handler.go"},
+					},
+				},
+				UnmatchedProfiles: []string{"github.com/org/repo/a.go"},
+			},
+			expectedOutput: `Matching diagnostics:
+
+Diff files with no coverage profile (2):
+  cmd/new.go
+    candidates considered: none
+  internal/c/handler.go
+    candidates considered: github.com/org/repo/internal/a/handler.go, github.com/org/repo/internal/b/handler.go
+
+Coverage profiles matching no diff file (1):
+  github.com/org/repo/a.go
+
+`,
+		},
+		{
+			name:        "nil diagnostics",
+			diag:        nil,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := FormatMatchDiagnostics(tt.diag, &buf)
+
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedOutput, buf.String())
+		})
+	}
+}
@@ -3,8 +3,10 @@ package format
 import (
 	"fmt"
 	"io"
+	"strings"
 
 	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github"
 )
 
 // Formatter formats coverage analysis results for output.
@@ -12,17 +14,45 @@ type Formatter interface {
 	Format(result *coverage.AnalysisResult, w io.Writer) error
 }
 
+// AnnotationFormatter is a Formatter that reports uncovered ranges as
+// annotations, allowing callers to customize how they are generated
+// (e.g. to apply a coverage.SeverityPolicy).
+type AnnotationFormatter interface {
+	Formatter
+	SetAnnotate(annotate func(result *coverage.AnalysisResult) []*github.Annotation)
+}
+
+// annotationsFor generates annotations with annotate, defaulting to
+// coverage.GenerateAnnotations, which reports every range as a notice.
+func annotationsFor(annotate func(result *coverage.AnalysisResult) []*github.Annotation, result *coverage.AnalysisResult) []*github.Annotation {
+	if annotate == nil {
+		annotate = coverage.GenerateAnnotations
+	}
+	return annotate(result)
+}
+
 // New creates a formatter based on the specified format type.
-// Supported formats: "Text", "Markdown", "GitHubAnnotations"
+// Supported formats: "Text", "Markdown", "JSON", "HTML", "GitHubAnnotations", "Sonar", "TeamCity", "Jenkins".
+// Format names are case-insensitive.
 func New(format string) (Formatter, error) {
-	switch format {
-	case "Text":
+	switch strings.ToLower(format) {
+	case "text":
 		return &TextFormatter{}, nil
-	case "Markdown":
+	case "markdown":
 		return &MarkdownFormatter{}, nil
-	case "GitHubAnnotations":
+	case "json":
+		return &JSONFormatter{}, nil
+	case "html":
+		return &HTMLFormatter{}, nil
+	case "githubannotations":
 		return &GitHubAnnotationsFormatter{}, nil
+	case "sonar":
+		return &SonarFormatter{}, nil
+	case "teamcity":
+		return &TeamCityFormatter{}, nil
+	case "jenkins":
+		return &JenkinsFormatter{}, nil
 	default:
-		return nil, fmt.Errorf("unknown format: %s (supported: Text, Markdown, GitHubAnnotations)", format)
+		return nil, fmt.Errorf("unknown format: %s (supported: Text, Markdown, JSON, HTML, GitHubAnnotations, Sonar, TeamCity, Jenkins)", format)
 	}
 }
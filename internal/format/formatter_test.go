@@ -0,0 +1,33 @@
+package format
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		format   string
+		expected Formatter
+	}{
+		{format: "Text", expected: &TextFormatter{}},
+		{format: "JSON", expected: &JSONFormatter{}},
+		{format: "json", expected: &JSONFormatter{}},
+		{format: "HTML", expected: &HTMLFormatter{}},
+		{format: "githubannotations", expected: &GitHubAnnotationsFormatter{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			formatter, err := New(tt.format)
+			require.NoError(t, err)
+			assert.IsType(t, tt.expected, formatter)
+		})
+	}
+
+	_, err := New("XML")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown format: XML")
+}
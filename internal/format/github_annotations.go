@@ -3,13 +3,32 @@ package format
 import (
 	"fmt"
 	"io"
+	"strings"
 
 	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github"
 )
 
+// MaxWorkflowAnnotations is the number of annotations of each level GitHub
+// Actions shows per step; it drops the rest.
+const MaxWorkflowAnnotations = 10
+
 // GitHubAnnotationsFormatter formats analysis results as GitHub Actions workflow commands.
-// Outputs one ::notice annotation per block of consecutive uncovered lines.
-type GitHubAnnotationsFormatter struct{}
+// Outputs one annotation per block of consecutive uncovered lines.
+type GitHubAnnotationsFormatter struct {
+	// Annotate generates the annotations to output. Defaults to
+	// coverage.GenerateAnnotations, which reports every range as a notice.
+	Annotate func(result *coverage.AnalysisResult) []*github.Annotation
+	// MaxPerLevel is the number of annotations output per level. Beyond it,
+	// the last one lists the remaining ranges of the level instead, so none
+	// are silently dropped. 0 uses MaxWorkflowAnnotations.
+	MaxPerLevel int
+}
+
+// SetAnnotate implements AnnotationFormatter.
+func (f *GitHubAnnotationsFormatter) SetAnnotate(annotate func(result *coverage.AnalysisResult) []*github.Annotation) {
+	f.Annotate = annotate
+}
 
 // Format formats the analysis result as GitHub Actions annotations.
 func (f *GitHubAnnotationsFormatter) Format(result *coverage.AnalysisResult, w io.Writer) error {
@@ -28,20 +47,69 @@ func (f *GitHubAnnotationsFormatter) Format(result *coverage.AnalysisResult, w i
 	}
 
 	// Generate annotations using the coverage package
-	annotations := coverage.GenerateAnnotations(result)
+	annotations := annotationsFor(f.Annotate, result)
+
+	limit := f.MaxPerLevel
+	if limit <= 0 {
+		limit = MaxWorkflowAnnotations
+	}
+	byLevel := make(map[string][]*github.Annotation)
+	for _, annotation := range annotations {
+		command := workflowCommand(annotation.Level)
+		byLevel[command] = append(byLevel[command], annotation)
+	}
 
 	// Format each annotation as a GitHub Actions workflow command
+	written := make(map[string]int)
 	for _, annotation := range annotations {
+		command := workflowCommand(annotation.Level)
+		written[command]++
+		if ranges := byLevel[command]; len(ranges) > limit {
+			// Over the limit: one annotation lists the rest of the level
+			if rest := ranges[limit-1:]; written[command] == limit {
+				fmt.Fprintf(w, "::%s title=More uncovered lines::%d more uncovered ranges aren't annotated: %s\n",
+					command, len(rest), formatRanges(rest))
+			}
+			if written[command] >= limit {
+				continue
+			}
+		}
 		if annotation.StartLine == annotation.EndLine {
 			// Single line annotation
-			fmt.Fprintf(w, "::notice file=%s,line=%d,title=%s::%s\n",
-				annotation.Path, annotation.StartLine, annotation.Title, annotation.Message)
+			fmt.Fprintf(w, "::%s file=%s,line=%d,title=%s::%s\n",
+				workflowCommand(annotation.Level), annotation.Path, annotation.StartLine, annotation.Title, annotation.Message)
 		} else {
 			// Multi-line annotation
-			fmt.Fprintf(w, "::notice file=%s,line=%d,endLine=%d,title=%s::%s\n",
-				annotation.Path, annotation.StartLine, annotation.EndLine, annotation.Title, annotation.Message)
+			fmt.Fprintf(w, "::%s file=%s,line=%d,endLine=%d,title=%s::%s\n",
+				workflowCommand(annotation.Level), annotation.Path, annotation.StartLine, annotation.EndLine, annotation.Title, annotation.Message)
 		}
 	}
 
 	return nil
 }
+
+// formatRanges lists the files and lines of annotations, e.g.
+// "main.go:5, main.go:7-9".
+func formatRanges(annotations []*github.Annotation) string {
+	ranges := make([]string, len(annotations))
+	for i, annotation := range annotations {
+		ranges[i] = fmt.Sprintf("%s:%d", annotation.Path, annotation.StartLine)
+		if annotation.EndLine != annotation.StartLine {
+			ranges[i] += fmt.Sprintf("-%d", annotation.EndLine)
+		}
+	}
+	return strings.Join(ranges, ", ")
+}
+
+// workflowCommand maps a Check Run annotation level to the matching
+// GitHub Actions workflow command, which names the failure level "error".
+func workflowCommand(level string) string {
+	switch level {
+	case coverage.LevelWarning:
+		return "warning"
+	case coverage.LevelFailure:
+		return "error"
+	default:
+		return "notice"
+	}
+}
@@ -2,9 +2,11 @@ package format
 
 import (
 	"bytes"
+	"strings"
 	"testing"
 
 	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -115,3 +117,84 @@ func TestGitHubAnnotationsFormatter_Format(t *testing.T) {
 		})
 	}
 }
+
+func TestGitHubAnnotationsFormatter_Format_Levels(t *testing.T) {
+	result := &coverage.AnalysisResult{
+		UncoveredByFile: map[string][]int{
+			"main.go": {5, 10, 11},
+		},
+		DiffAddedLines:   10,
+		DiffAddedCovered: 7,
+	}
+
+	formatter := &GitHubAnnotationsFormatter{
+		Annotate: func(result *coverage.AnalysisResult) []*github.Annotation {
+			annotations := coverage.GenerateAnnotations(result)
+			annotations[0].Level = coverage.LevelWarning
+			annotations[1].Level = coverage.LevelFailure
+			return annotations
+		},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, formatter.Format(result, &buf))
+
+	expected := `::warning file=main.go,line=5,title=Uncovered line::Line 5 is not covered by tests
+::error file=main.go,line=10,endLine=11,title=Uncovered lines::Lines 10-11 are not covered by tests
+`
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestGitHubAnnotationsFormatter_Format_MaxPerLevel(t *testing.T) {
+	result := &coverage.AnalysisResult{
+		UncoveredByFile: map[string][]int{
+			"main.go": {1, 3, 5, 7, 8},
+			"util.go": {2},
+		},
+		DiffAddedLines:   20,
+		DiffAddedCovered: 14,
+	}
+
+	t.Run("remaining ranges of a level are listed", func(t *testing.T) {
+		formatter := &GitHubAnnotationsFormatter{
+			MaxPerLevel: 3,
+			Annotate: func(result *coverage.AnalysisResult) []*github.Annotation {
+				annotations := coverage.GenerateAnnotations(result)
+				annotations[1].Level = coverage.LevelWarning
+				return annotations
+			},
+		}
+
+		var buf bytes.Buffer
+		require.NoError(t, formatter.Format(result, &buf))
+
+		expected := `::notice file=main.go,line=1,title=Uncovered line::Line 1 is not covered by tests
+::warning file=main.go,line=3,title=Uncovered line::Line 3 is not covered by tests
+::notice file=main.go,line=5,title=Uncovered line::Line 5 is not covered by tests
+::notice title=More uncovered lines::2 more uncovered ranges aren't annotated: main.go:7-8, util.go:2
+`
+		assert.Equal(t, expected, buf.String())
+	})
+
+	t.Run("exactly the limit", func(t *testing.T) {
+		formatter := &GitHubAnnotationsFormatter{MaxPerLevel: 5}
+
+		var buf bytes.Buffer
+		require.NoError(t, formatter.Format(result, &buf))
+		assert.NotContains(t, buf.String(), "More uncovered lines")
+		assert.Contains(t, buf.String(), "file=util.go,line=2")
+	})
+
+	t.Run("defaults to the GitHub Actions limit", func(t *testing.T) {
+		lines := make([]int, 0, 30)
+		for line := 1; line <= 30; line += 2 {
+			lines = append(lines, line)
+		}
+		result := &coverage.AnalysisResult{UncoveredByFile: map[string][]int{"main.go": lines}, DiffAddedLines: 30}
+
+		var buf bytes.Buffer
+		require.NoError(t, (&GitHubAnnotationsFormatter{}).Format(result, &buf))
+		assert.Equal(t, MaxWorkflowAnnotations, strings.Count(buf.String(), "::notice "))
+		assert.Contains(t, buf.String(), "6 more uncovered ranges aren't annotated: main.go:19, main.go:21")
+	})
+}
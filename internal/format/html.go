@@ -0,0 +1,283 @@
+package format
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+)
+
+// HTMLFormatter formats analysis results as a standalone HTML page, similar
+// to go tool cover -html but restricted to the files of the diff: a file tree
+// and the source of each file with added lines highlighted as covered,
+// uncovered, suppressed, or not executable.
+type HTMLFormatter struct {
+	// SourceRoot is the directory diff paths are relative to, where the
+	// source of each file is read from. Empty uses the working directory.
+	SourceRoot string
+	// AddedLines maps diff files to their added lines. If nil, only files
+	// with uncovered or suppressed lines are shown.
+	AddedLines map[string][]int
+	// LineCoverage maps diff files to the coverage of their instrumented
+	// added lines (see coverage.LineCoverageByFile)
+	LineCoverage map[string]map[int]bool
+}
+
+// CSS classes of source lines in the HTML report.
+const (
+	htmlLineAdded      = "added"
+	htmlLineCovered    = "covered"
+	htmlLineUncovered  = "uncovered"
+	htmlLineSuppressed = "suppressed"
+)
+
+// Format writes the analysis result as an HTML page.
+func (f *HTMLFormatter) Format(result *coverage.AnalysisResult, w io.Writer) error {
+	if result == nil {
+		return fmt.Errorf("result is nil")
+	}
+
+	page := htmlPage{
+		AddedLines:     result.DiffAddedLines,
+		CoveredLines:   result.DiffAddedCovered,
+		UncoveredLines: result.DiffAddedLines - result.DiffAddedCovered,
+		Coverage:       100,
+		Tree:           &htmlDirView{},
+	}
+	if result.DiffAddedLines > 0 {
+		page.Coverage = float64(result.DiffAddedCovered) / float64(result.DiffAddedLines) * 100
+	}
+
+	for i, file := range f.files(result) {
+		view := f.fileView(result, file)
+		view.ID = fmt.Sprintf("file-%d", i)
+		page.Files = append(page.Files, view)
+		page.Tree.add(strings.Split(file, "/"), view)
+	}
+	page.Tree.compact()
+
+	if err := htmlTemplate.Execute(w, page); err != nil {
+		return fmt.Errorf("failed to render HTML report: %w", err)
+	}
+	return nil
+}
+
+// files returns the files shown in the report, sorted by path.
+func (f *HTMLFormatter) files(result *coverage.AnalysisResult) []string {
+	seen := make(map[string]bool)
+	for file := range f.AddedLines {
+		seen[file] = true
+	}
+	for file := range result.UncoveredByFile {
+		seen[file] = true
+	}
+	for file := range result.Suppressed {
+		seen[file] = true
+	}
+
+	files := make([]string, 0, len(seen))
+	for file := range seen {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// fileView classifies the added lines of file and reads its source.
+func (f *HTMLFormatter) fileView(result *coverage.AnalysisResult, file string) htmlFileView {
+	classes := make(map[int]string)
+	for _, line := range f.AddedLines[file] {
+		classes[line] = htmlLineAdded
+	}
+	for line, covered := range f.LineCoverage[file] {
+		if covered {
+			classes[line] = htmlLineCovered
+		}
+	}
+	for _, line := range result.UncoveredByFile[file] {
+		classes[line] = htmlLineUncovered
+	}
+	for _, line := range result.Suppressed[file] {
+		classes[line] = htmlLineSuppressed
+	}
+
+	view := htmlFileView{Path: file}
+	for _, class := range classes {
+		switch class {
+		case htmlLineCovered:
+			view.CoveredLines++
+		case htmlLineUncovered:
+			view.UncoveredLines++
+		}
+	}
+	view.Coverage = 100
+	if executable := view.CoveredLines + view.UncoveredLines; executable > 0 {
+		view.Coverage = float64(view.CoveredLines) / float64(executable) * 100
+	}
+
+	data, err := os.ReadFile(filepath.Join(f.SourceRoot, filepath.FromSlash(file)))
+	if err != nil {
+		view.Error = fmt.Sprintf("source not available: %v", err)
+		return view
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	for i, text := range lines {
+		view.Lines = append(view.Lines, htmlLineView{Number: i + 1, Text: text, Class: classes[i+1]})
+	}
+	return view
+}
+
+// htmlPage is the template input for HTMLFormatter.
+type htmlPage struct {
+	AddedLines     int
+	CoveredLines   int
+	UncoveredLines int
+	Coverage       float64
+	Tree           *htmlDirView
+	Files          []htmlFileView
+}
+
+// htmlDirView is a directory of the file tree.
+type htmlDirView struct {
+	Name  string
+	Dirs  []*htmlDirView
+	Files []htmlFileEntry
+}
+
+// htmlFileEntry is a file in the file tree.
+type htmlFileEntry struct {
+	ID             string
+	Name           string
+	UncoveredLines int
+	Coverage       float64
+}
+
+type htmlFileView struct {
+	ID             string
+	Path           string
+	CoveredLines   int
+	UncoveredLines int
+	Coverage       float64
+	// Error explains why Lines is empty
+	Error string
+	Lines []htmlLineView
+}
+
+type htmlLineView struct {
+	Number int
+	Text   string
+	// Class is empty for lines the diff doesn't add
+	Class string
+}
+
+// add adds a file, split into path segments, under d. Files are added in
+// sorted order, so directories and files stay sorted.
+func (d *htmlDirView) add(segments []string, file htmlFileView) {
+	if len(segments) == 1 {
+		d.Files = append(d.Files, htmlFileEntry{
+			ID:             file.ID,
+			Name:           segments[0],
+			UncoveredLines: file.UncoveredLines,
+			Coverage:       file.Coverage,
+		})
+		return
+	}
+	var dir *htmlDirView
+	if n := len(d.Dirs); n > 0 && d.Dirs[n-1].Name == segments[0] {
+		dir = d.Dirs[n-1]
+	} else {
+		dir = &htmlDirView{Name: segments[0]}
+		d.Dirs = append(d.Dirs, dir)
+	}
+	dir.add(segments[1:], file)
+}
+
+// compact merges directories whose only entry is a directory into it, so
+// deep package paths take a single row.
+func (d *htmlDirView) compact() {
+	for _, dir := range d.Dirs {
+		for len(dir.Files) == 0 && len(dir.Dirs) == 1 {
+			child := dir.Dirs[0]
+			dir.Name = path.Join(dir.Name, child.Name)
+			dir.Dirs, dir.Files = child.Dirs, child.Files
+		}
+		dir.compact()
+	}
+}
+
+var htmlTemplate = template.Must(template.New("report").Parse(`{{define "dir"}}<ul>
+{{range .Dirs}}<li><details open><summary>{{.Name}}/</summary>{{template "dir" .}}</details></li>
+{{end}}{{range .Files}}<li><a href="#{{.ID}}" data-file="{{.ID}}">{{.Name}}</a> <span class="{{if .UncoveredLines}}uncovered{{else}}covered{{end}}">{{printf "%.1f" .Coverage}}%</span></li>
+{{end}}</ul>{{end}}<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Diff coverage</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", sans-serif; margin: 0; display: flex; height: 100vh; }
+nav { width: 22em; overflow: auto; padding: 1em; border-right: 1px solid #d0d7de; flex-shrink: 0; }
+nav ul { list-style: none; padding-left: 1em; margin: 0; }
+nav > ul { padding-left: 0; }
+nav a.selected { font-weight: bold; }
+main { flex-grow: 1; overflow: auto; padding: 1em; }
+section { display: none; }
+section.selected { display: block; }
+table.source { border-collapse: collapse; font-family: ui-monospace, monospace; font-size: 0.85em; }
+table.source td { padding: 0 0.5em; white-space: pre; }
+table.source td.number { color: #6e7781; text-align: right; user-select: none; }
+tr.added { background: #f6f8fa; }
+tr.covered { background: #dafbe1; }
+tr.uncovered { background: #ffebe9; }
+tr.suppressed { background: #fff8c5; }
+span.covered { color: #1a7f37; }
+span.uncovered { color: #cf222e; }
+body.changed-only tr:not([class]) { display: none; }
+</style>
+</head>
+<body>
+<nav>
+<h1>Diff coverage</h1>
+<p>{{.AddedLines}} executable lines added, {{.CoveredLines}} covered ({{printf "%.1f" .Coverage}}%), {{.UncoveredLines}} uncovered.</p>
+<p><label><input type="checkbox" id="changed-only"> Changed lines only</label></p>
+{{if .Files}}{{template "dir" .Tree}}{{else}}<p>No files changed.</p>{{end}}
+</nav>
+<main>
+{{range .Files}}<section id="{{.ID}}">
+<h2>{{.Path}}</h2>
+<p>{{.CoveredLines}} covered, {{.UncoveredLines}} uncovered added lines ({{printf "%.1f" .Coverage}}% covered)</p>
+{{if .Error}}<p>{{.Error}}</p>
+{{else}}<table class="source">
+{{range .Lines}}<tr{{if .Class}} class="{{.Class}}"{{end}}><td class="number">{{.Number}}</td><td>{{.Text}}</td></tr>
+{{end}}</table>
+{{end}}</section>
+{{end}}</main>
+<script>
+function select(id) {
+  document.querySelectorAll("section, nav a").forEach(function (el) { el.classList.remove("selected"); });
+  var section = document.getElementById(id);
+  if (!section) { return; }
+  section.classList.add("selected");
+  document.querySelector('nav a[data-file="' + id + '"]').classList.add("selected");
+}
+document.querySelectorAll("nav a[data-file]").forEach(function (a) {
+  a.addEventListener("click", function (e) {
+    e.preventDefault();
+    history.replaceState(null, "", "#" + a.dataset.file);
+    select(a.dataset.file);
+  });
+});
+document.getElementById("changed-only").addEventListener("change", function (e) {
+  document.body.classList.toggle("changed-only", e.target.checked);
+});
+var first = document.querySelector("section");
+select(location.hash ? location.hash.slice(1) : first && first.id);
+</script>
+</body>
+</html>
+`))
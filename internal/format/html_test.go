@@ -0,0 +1,81 @@
+package format
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTMLFormatter_Format(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "internal", "server"), 0755))
+	source := "package server\n\n// Serve serves\nfunc Serve() {\n\tstart()\n\tif err != nil {\n\t\treturn\n\t}\n}\n"
+	require.NoError(t, os.WriteFile(filepath.Join(root, "internal", "server", "server.go"), []byte(source), 0644))
+
+	result := &coverage.AnalysisResult{
+		UncoveredByFile:  map[string][]int{"internal/server/server.go": {7}, "cmd/main.go": {3}},
+		Suppressed:       map[string][]int{"internal/server/server.go": {6}},
+		DiffAddedLines:   4,
+		DiffAddedCovered: 2,
+	}
+	formatter := &HTMLFormatter{
+		SourceRoot: root,
+		AddedLines: map[string][]int{
+			"internal/server/server.go": {3, 4, 5, 6, 7},
+			"cmd/main.go":               {3},
+		},
+		LineCoverage: map[string]map[int]bool{
+			"internal/server/server.go": {4: true, 5: true, 6: false, 7: false},
+			"cmd/main.go":               {3: false},
+		},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, formatter.Format(result, &buf))
+	html := buf.String()
+
+	assert.Contains(t, html, "4 executable lines added, 2 covered (50.0%), 2 uncovered.")
+
+	// File tree, with the single-child directory chain compacted
+	assert.Contains(t, html, `<summary>internal/server/</summary>`)
+	assert.Contains(t, html, `<a href="#file-0" data-file="file-0">main.go</a> <span class="uncovered">0.0%</span>`)
+	assert.Contains(t, html, `<a href="#file-1" data-file="file-1">server.go</a> <span class="uncovered">66.7%</span>`)
+
+	// Source view
+	assert.Contains(t, html, `<h2>internal/server/server.go</h2>`)
+	assert.Contains(t, html, `<p>2 covered, 1 uncovered added lines (66.7% covered)</p>`)
+	assert.Contains(t, html, `<tr><td class="number">1</td><td>package server</td></tr>`)
+	assert.Contains(t, html, `<tr class="added"><td class="number">3</td><td>// Serve serves</td></tr>`)
+	assert.Contains(t, html, `<tr class="covered"><td class="number">5</td><td>	start()</td></tr>`)
+	assert.Contains(t, html, `<tr class="suppressed"><td class="number">6</td><td>	if err != nil {</td></tr>`)
+	assert.Contains(t, html, `<tr class="uncovered"><td class="number">7</td><td>		return</td></tr>`)
+	assert.NotContains(t, html, `<td class="number">10</td>`, "the trailing newline adds no line")
+
+	// Missing source
+	assert.Contains(t, html, `<h2>cmd/main.go</h2>`)
+	assert.Contains(t, html, "source not available")
+}
+
+func TestHTMLFormatter_Escaping(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "main.go"), []byte("var s = \"<script>\"\n"), 0644))
+	result := &coverage.AnalysisResult{UncoveredByFile: map[string][]int{"main.go": {1}}, DiffAddedLines: 1}
+
+	var buf bytes.Buffer
+	require.NoError(t, (&HTMLFormatter{SourceRoot: root}).Format(result, &buf))
+	assert.Contains(t, buf.String(), `<tr class="uncovered"><td class="number">1</td><td>var s = &#34;&lt;script&gt;&#34;</td></tr>`)
+}
+
+func TestHTMLFormatter_NoFiles(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, (&HTMLFormatter{}).Format(&coverage.AnalysisResult{}, &buf))
+	assert.Contains(t, buf.String(), "0 executable lines added, 0 covered (100.0%), 0 uncovered.")
+	assert.Contains(t, buf.String(), "<p>No files changed.</p>")
+
+	require.Error(t, (&HTMLFormatter{}).Format(nil, &buf))
+}
@@ -0,0 +1,78 @@
+package format
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github"
+)
+
+// JenkinsFormatter formats analysis results in the Jenkins Warnings Next
+// Generation native JSON format (the "issues" tool), one issue per block of
+// consecutive uncovered lines.
+type JenkinsFormatter struct {
+	// Annotate generates the annotations to report. Defaults to
+	// coverage.GenerateAnnotations, which reports every range as a notice.
+	Annotate func(result *coverage.AnalysisResult) []*github.Annotation
+}
+
+// jenkinsReport is the warnings-ng native report document.
+type jenkinsReport struct {
+	Issues []jenkinsIssue `json:"issues"`
+}
+
+type jenkinsIssue struct {
+	FileName  string `json:"fileName"`
+	LineStart int    `json:"lineStart"`
+	LineEnd   int    `json:"lineEnd"`
+	Severity  string `json:"severity"`
+	Category  string `json:"category"`
+	Type      string `json:"type"`
+	Message   string `json:"message"`
+}
+
+// SetAnnotate implements AnnotationFormatter.
+func (f *JenkinsFormatter) SetAnnotate(annotate func(result *coverage.AnalysisResult) []*github.Annotation) {
+	f.Annotate = annotate
+}
+
+// Format formats the analysis result as a warnings-ng issues report.
+// A fully covered diff produces a report with no issues.
+func (f *JenkinsFormatter) Format(result *coverage.AnalysisResult, w io.Writer) error {
+	if result == nil {
+		return fmt.Errorf("result is nil")
+	}
+
+	report := jenkinsReport{Issues: []jenkinsIssue{}}
+	if result.HasUncoveredLines() {
+		for _, annotation := range annotationsFor(f.Annotate, result) {
+			report.Issues = append(report.Issues, jenkinsIssue{
+				FileName:  annotation.Path,
+				LineStart: annotation.StartLine,
+				LineEnd:   annotation.EndLine,
+				Severity:  jenkinsSeverity(annotation.Level),
+				Category:  "Coverage",
+				Type:      annotation.Title,
+				Message:   annotation.Message,
+			})
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// jenkinsSeverity maps a Check Run annotation level to a warnings-ng severity.
+func jenkinsSeverity(level string) string {
+	switch level {
+	case coverage.LevelWarning:
+		return "NORMAL"
+	case coverage.LevelFailure:
+		return "HIGH"
+	default:
+		return "LOW"
+	}
+}
@@ -0,0 +1,102 @@
+package format
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJenkinsFormatter_Format(t *testing.T) {
+	tests := []struct {
+		name           string
+		result         *coverage.AnalysisResult
+		expectedOutput string
+		expectError    bool
+	}{
+		{
+			name: "uncovered ranges become issues",
+			result: &coverage.AnalysisResult{
+				UncoveredByFile: map[string][]int{
+					"pkg/server.go": {5, 6, 7},
+				},
+				DiffAddedLines:   10,
+				DiffAddedCovered: 7,
+			},
+			expectedOutput: `{
+  "issues": [
+    {
+      "fileName": "pkg/server.go",
+      "lineStart": 5,
+      "lineEnd": 7,
+      "severity": "LOW",
+      "category": "Coverage",
+      "type": "Uncovered lines",
+      "message": "Lines 5-7 are not covered by tests"
+    }
+  ]
+}
+`,
+		},
+		{
+			name: "all lines covered",
+			result: &coverage.AnalysisResult{
+				UncoveredByFile:  map[string][]int{},
+				DiffAddedLines:   10,
+				DiffAddedCovered: 10,
+			},
+			expectedOutput: "{\n  \"issues\": []\n}\n",
+		},
+		{
+			name:        "nil result",
+			result:      nil,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			formatter := &JenkinsFormatter{}
+			var buf bytes.Buffer
+			err := formatter.Format(tt.result, &buf)
+
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedOutput, buf.String())
+		})
+	}
+}
+
+func TestJenkinsFormatter_Format_Levels(t *testing.T) {
+	result := &coverage.AnalysisResult{
+		UncoveredByFile: map[string][]int{
+			"main.go": {5, 10, 20},
+		},
+		DiffAddedLines:   10,
+		DiffAddedCovered: 7,
+	}
+
+	formatter := &JenkinsFormatter{
+		Annotate: func(result *coverage.AnalysisResult) []*github.Annotation {
+			annotations := coverage.GenerateAnnotations(result)
+			annotations[1].Level = coverage.LevelWarning
+			annotations[2].Level = coverage.LevelFailure
+			return annotations
+		},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, formatter.Format(result, &buf))
+
+	output := buf.String()
+	assert.Contains(t, output, `"severity": "LOW"`)
+	assert.Contains(t, output, `"severity": "NORMAL"`)
+	assert.Contains(t, output, `"severity": "HIGH"`)
+}
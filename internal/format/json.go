@@ -0,0 +1,187 @@
+package format
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/buildinfo"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+)
+
+// JSONSchemaVersion is the schema_version of reports written by
+// JSONFormatter. It is bumped when a field changes meaning; adding fields
+// keeps the version.
+const JSONSchemaVersion = 1
+
+// JSONFormatter formats analysis results as a JSONReport, for saving and
+// comparing results (see CompareReports) or consuming them from scripts.
+type JSONFormatter struct {
+	// Provenance, if set, is included in the report as "canopy"
+	Provenance *buildinfo.Provenance
+	// Stats, if set, is included in the report as "project"
+	Stats *coverage.CoverageStats
+}
+
+// JSONReport is the document written by JSONFormatter.
+// Fields may be added, but are never renamed or removed, so saved reports
+// stay comparable across versions.
+type JSONReport struct {
+	// SchemaVersion is JSONSchemaVersion; reports saved before it was
+	// introduced have 0
+	SchemaVersion int         `json:"schema_version"`
+	Summary       JSONSummary `json:"summary"`
+	// Files lists files with uncovered added lines, sorted by path
+	Files []JSONFile `json:"files"`
+	// Suppressed lists files with lines suppressed by canopy:ignore
+	// comments, sorted by path
+	Suppressed []JSONSuppressedFile `json:"suppressed,omitempty"`
+	// Project holds the statement coverage of the whole coverage profile
+	Project *JSONProject `json:"project,omitempty"`
+	// Canopy identifies the Canopy version, config, and ruleset that
+	// produced the report
+	Canopy *buildinfo.Provenance `json:"canopy,omitempty"`
+}
+
+// JSONSummary holds the patch coverage totals of a report.
+type JSONSummary struct {
+	AddedLines     int `json:"added_lines"`
+	CoveredLines   int `json:"covered_lines"`
+	UncoveredLines int `json:"uncovered_lines"`
+	// Coverage is the percentage of added lines covered; 100 if no lines were added
+	Coverage float64 `json:"coverage"`
+	// ProductionAddedLines and TestAddedLines count all lines added to
+	// production and test source files, executable or not
+	ProductionAddedLines int `json:"production_added_lines"`
+	TestAddedLines       int `json:"test_added_lines"`
+	// TestRatio is the number of test lines added per production line added
+	TestRatio float64 `json:"test_ratio"`
+}
+
+// JSONFile lists the uncovered added lines of a file.
+type JSONFile struct {
+	Path           string `json:"path"`
+	UncoveredLines []int  `json:"uncovered_lines"`
+	// UncoveredRanges groups UncoveredLines into ranges of consecutive lines
+	UncoveredRanges []JSONLineRange `json:"uncovered_ranges"`
+}
+
+// JSONLineRange is an inclusive range of line numbers.
+type JSONLineRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// JSONProject holds the statement coverage of a project.
+type JSONProject struct {
+	Statements        int     `json:"statements"`
+	CoveredStatements int     `json:"covered_statements"`
+	Coverage          float64 `json:"coverage"`
+	// Files lists the statement coverage of each profiled file, sorted by path
+	Files []JSONFileCoverage `json:"files"`
+}
+
+// JSONFileCoverage holds the statement coverage of a file.
+type JSONFileCoverage struct {
+	Path              string  `json:"path"`
+	Statements        int     `json:"statements"`
+	CoveredStatements int     `json:"covered_statements"`
+	Coverage          float64 `json:"coverage"`
+}
+
+// JSONSuppressedFile lists the suppressed uncovered lines of a file.
+// Lines with expired suppressions are also listed in the file's
+// uncovered_lines.
+type JSONSuppressedFile struct {
+	Path         string `json:"path"`
+	Lines        []int  `json:"lines,omitempty"`
+	ExpiredLines []int  `json:"expired_lines,omitempty"`
+}
+
+// NewJSONReport builds the JSONReport for an analysis result.
+func NewJSONReport(result *coverage.AnalysisResult) *JSONReport {
+	report := &JSONReport{
+		SchemaVersion: JSONSchemaVersion,
+		Summary: JSONSummary{
+			AddedLines:     result.DiffAddedLines,
+			CoveredLines:   result.DiffAddedCovered,
+			UncoveredLines: result.DiffAddedLines - result.DiffAddedCovered,
+			Coverage:       result.PatchCoverage(),
+
+			ProductionAddedLines: result.ProductionAddedLines,
+			TestAddedLines:       result.TestAddedLines,
+			TestRatio:            result.TestRatio(),
+		},
+		Files: []JSONFile{},
+	}
+
+	for _, file := range result.GetSortedFiles() {
+		lines := result.UncoveredByFile[file]
+		ranges := []JSONLineRange{}
+		for _, r := range lineRanges(lines) {
+			ranges = append(ranges, JSONLineRange{Start: r[0], End: r[1]})
+		}
+		report.Files = append(report.Files, JSONFile{Path: file, UncoveredLines: lines, UncoveredRanges: ranges})
+	}
+	for _, file := range result.SuppressedFiles() {
+		report.Suppressed = append(report.Suppressed, JSONSuppressedFile{
+			Path:         file,
+			Lines:        result.Suppressed[file],
+			ExpiredLines: result.ExpiredSuppressions[file],
+		})
+	}
+	return report
+}
+
+// NewJSONProject converts coverage statistics to a JSONProject.
+func NewJSONProject(stats *coverage.CoverageStats) *JSONProject {
+	project := &JSONProject{
+		Statements:        stats.TotalStatements,
+		CoveredStatements: stats.CoveredStatements,
+		Coverage:          stats.Percentage,
+		Files:             []JSONFileCoverage{},
+	}
+	for _, file := range stats.ByFile {
+		project.Files = append(project.Files, JSONFileCoverage{
+			Path:              file.FileName,
+			Statements:        file.TotalStatements,
+			CoveredStatements: file.CoveredStatements,
+			Coverage:          file.Percentage,
+		})
+	}
+	sort.Slice(project.Files, func(i, j int) bool {
+		return project.Files[i].Path < project.Files[j].Path
+	})
+	return project
+}
+
+// Format formats the analysis result as an indented JSONReport.
+func (f *JSONFormatter) Format(result *coverage.AnalysisResult, w io.Writer) error {
+	if result == nil {
+		return fmt.Errorf("result is nil")
+	}
+
+	report := NewJSONReport(result)
+	report.Canopy = f.Provenance
+	if f.Stats != nil {
+		report.Project = NewJSONProject(f.Stats)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// ReadJSONReport decodes a report written by JSONFormatter.
+// Reports with a newer schema version than JSONSchemaVersion are rejected.
+func ReadJSONReport(r io.Reader) (*JSONReport, error) {
+	var report JSONReport
+	if err := json.NewDecoder(r).Decode(&report); err != nil {
+		return nil, fmt.Errorf("invalid JSON report: %w", err)
+	}
+	if report.SchemaVersion > JSONSchemaVersion {
+		return nil, fmt.Errorf("unsupported JSON report schema version %d (supported: up to %d)", report.SchemaVersion, JSONSchemaVersion)
+	}
+	return &report, nil
+}
@@ -0,0 +1,181 @@
+package format
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/buildinfo"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONFormatter_Format(t *testing.T) {
+	tests := []struct {
+		name           string
+		result         *coverage.AnalysisResult
+		expectedOutput string
+		expectError    bool
+	}{
+		{
+			name: "uncovered lines sorted by file",
+			result: &coverage.AnalysisResult{
+				UncoveredByFile: map[string][]int{
+					"pkg/server.go": {12, 13, 14},
+					"cmd/main.go":   {3},
+				},
+				DiffAddedLines:       8,
+				DiffAddedCovered:     4,
+				ProductionAddedLines: 20,
+				TestAddedLines:       5,
+			},
+			expectedOutput: `{
+  "schema_version": 1,
+  "summary": {
+    "added_lines": 8,
+    "covered_lines": 4,
+    "uncovered_lines": 4,
+    "coverage": 50,
+    "production_added_lines": 20,
+    "test_added_lines": 5,
+    "test_ratio": 0.25
+  },
+  "files": [
+    {
+      "path": "cmd/main.go",
+      "uncovered_lines": [
+        3
+      ],
+      "uncovered_ranges": [
+        {
+          "start": 3,
+          "end": 3
+        }
+      ]
+    },
+    {
+      "path": "pkg/server.go",
+      "uncovered_lines": [
+        12,
+        13,
+        14
+      ],
+      "uncovered_ranges": [
+        {
+          "start": 12,
+          "end": 14
+        }
+      ]
+    }
+  ]
+}
+`,
+		},
+		{
+			name:   "no added lines",
+			result: &coverage.AnalysisResult{UncoveredByFile: map[string][]int{}},
+			expectedOutput: `{
+  "schema_version": 1,
+  "summary": {
+    "added_lines": 0,
+    "covered_lines": 0,
+    "uncovered_lines": 0,
+    "coverage": 100,
+    "production_added_lines": 0,
+    "test_added_lines": 0,
+    "test_ratio": 0
+  },
+  "files": []
+}
+`,
+		},
+		{
+			name:        "nil result",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := (&JSONFormatter{}).Format(tt.result, &buf)
+			if tt.expectError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedOutput, buf.String())
+		})
+	}
+}
+
+func TestJSONFormatter_Provenance(t *testing.T) {
+	result := &coverage.AnalysisResult{UncoveredByFile: map[string][]int{}}
+	provenance := buildinfo.New("v1.4.0", nil)
+
+	var buf bytes.Buffer
+	require.NoError(t, (&JSONFormatter{Provenance: &provenance}).Format(result, &buf))
+	assert.Contains(t, buf.String(), `"canopy": {
+    "version": "v1.4.0",
+    "ruleset": 1
+  }`)
+
+	report, err := ReadJSONReport(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, &provenance, report.Canopy)
+}
+
+func TestJSONFormatter_Stats(t *testing.T) {
+	result := &coverage.AnalysisResult{UncoveredByFile: map[string][]int{}}
+	stats := &coverage.CoverageStats{
+		TotalStatements:   4,
+		CoveredStatements: 3,
+		Percentage:        75,
+		ByFile: map[string]*coverage.FileCoverage{
+			"example.com/pkg/b.go": {FileName: "example.com/pkg/b.go", TotalStatements: 1, CoveredStatements: 0, Percentage: 0},
+			"example.com/pkg/a.go": {FileName: "example.com/pkg/a.go", TotalStatements: 3, CoveredStatements: 3, Percentage: 100},
+		},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, (&JSONFormatter{Stats: stats}).Format(result, &buf))
+
+	report, err := ReadJSONReport(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, &JSONProject{
+		Statements:        4,
+		CoveredStatements: 3,
+		Coverage:          75,
+		Files: []JSONFileCoverage{
+			{Path: "example.com/pkg/a.go", Statements: 3, CoveredStatements: 3, Coverage: 100},
+			{Path: "example.com/pkg/b.go", Statements: 1, CoveredStatements: 0, Coverage: 0},
+		},
+	}, report.Project)
+}
+
+func TestReadJSONReport(t *testing.T) {
+	result := &coverage.AnalysisResult{
+		UncoveredByFile:  map[string][]int{"main.go": {4, 5}},
+		DiffAddedLines:   4,
+		DiffAddedCovered: 2,
+	}
+	var buf bytes.Buffer
+	require.NoError(t, (&JSONFormatter{}).Format(result, &buf))
+
+	report, err := ReadJSONReport(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, NewJSONReport(result), report)
+
+	_, err = ReadJSONReport(strings.NewReader("Uncovered lines in diff:"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid JSON report")
+
+	report, err = ReadJSONReport(strings.NewReader(`{"summary": {"added_lines": 1}, "files": []}`))
+	require.NoError(t, err, "reports saved before schema_version are accepted")
+	assert.Equal(t, 0, report.SchemaVersion)
+
+	_, err = ReadJSONReport(strings.NewReader(`{"schema_version": 2, "files": []}`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unsupported JSON report schema version 2")
+}
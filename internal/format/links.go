@@ -0,0 +1,105 @@
+package format
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// LinkProvider identifies the hosting service a repository URL points to,
+// which determines the shape of blob URLs.
+type LinkProvider string
+
+const (
+	// LinkProviderGitHub builds links like {repo}/blob/{ref}/{path}#L10-L12
+	LinkProviderGitHub LinkProvider = "github"
+	// LinkProviderGitLab builds links like {repo}/-/blob/{ref}/{path}#L10-12
+	LinkProviderGitLab LinkProvider = "gitlab"
+)
+
+// FileLinker builds deep links to lines of files at a fixed revision.
+type FileLinker struct {
+	// Provider selects the URL layout
+	Provider LinkProvider
+	// RepoURL is the web URL of the repository, e.g. https://github.com/org/repo
+	RepoURL string
+	// Ref is the commit SHA (or other ref) links point at
+	Ref string
+}
+
+// NewFileLinker creates a FileLinker for a repository web URL, detecting the
+// provider from the host: hosts containing "gitlab" use GitLab links,
+// everything else (including GitHub Enterprise) uses GitHub links.
+// A trailing ".git" or slash is stripped from repoURL.
+func NewFileLinker(repoURL, ref string) (*FileLinker, error) {
+	repoURL = strings.TrimSuffix(strings.TrimSuffix(repoURL, "/"), ".git")
+	u, err := url.Parse(repoURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid repository URL %q: expected e.g. https://github.com/org/repo", repoURL)
+	}
+	if ref == "" {
+		return nil, fmt.Errorf("ref is required to link files")
+	}
+
+	provider := LinkProviderGitHub
+	if strings.Contains(u.Host, "gitlab") {
+		provider = LinkProviderGitLab
+	}
+	return &FileLinker{Provider: provider, RepoURL: repoURL, Ref: ref}, nil
+}
+
+// URL returns a link to lines start through end of path.
+// If end <= start, the link points at the single line start.
+func (l *FileLinker) URL(path string, start, end int) string {
+	var b strings.Builder
+	b.WriteString(l.RepoURL)
+	if l.Provider == LinkProviderGitLab {
+		b.WriteString("/-")
+	}
+	fmt.Fprintf(&b, "/blob/%s/%s#L%d", l.Ref, escapePath(path), start)
+	if end > start {
+		if l.Provider == LinkProviderGitLab {
+			fmt.Fprintf(&b, "-%d", end)
+		} else {
+			fmt.Fprintf(&b, "-L%d", end)
+		}
+	}
+	return b.String()
+}
+
+// escapePath escapes each segment of a slash-separated path for use in a URL.
+func escapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// lineRanges groups sorted line numbers into [start, end] ranges of
+// consecutive lines.
+func lineRanges(lines []int) [][2]int {
+	var ranges [][2]int
+	for _, line := range lines {
+		if n := len(ranges); n > 0 && line == ranges[n-1][1]+1 {
+			ranges[n-1][1] = line
+			continue
+		}
+		ranges = append(ranges, [2]int{line, line})
+	}
+	return ranges
+}
+
+// formatLinkedRanges formats lines like formatLineRanges, with each range
+// rendered as a Markdown link to the lines it covers.
+func formatLinkedRanges(l *FileLinker, path string, lines []int) string {
+	parts := make([]string, 0, len(lines))
+	for _, r := range lineRanges(lines) {
+		text := fmt.Sprintf("%d", r[0])
+		if r[1] != r[0] {
+			text = fmt.Sprintf("%d-%d", r[0], r[1])
+		}
+		parts = append(parts, fmt.Sprintf("[%s](%s)", text, l.URL(path, r[0], r[1])))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,85 @@
+package format
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileLinker_URL(t *testing.T) {
+	tests := []struct {
+		name        string
+		repoURL     string
+		path        string
+		start       int
+		end         int
+		expectedURL string
+	}{
+		{
+			name:        "github single line",
+			repoURL:     "https://github.com/org/repo",
+			path:        "pkg/server.go",
+			start:       12,
+			expectedURL: "https://github.com/org/repo/blob/abc123/pkg/server.go#L12",
+		},
+		{
+			name:        "github range",
+			repoURL:     "https://github.com/org/repo",
+			path:        "pkg/server.go",
+			start:       12,
+			end:         14,
+			expectedURL: "https://github.com/org/repo/blob/abc123/pkg/server.go#L12-L14",
+		},
+		{
+			name:        "github enterprise with .git suffix",
+			repoURL:     "https://git.example.com/org/repo.git",
+			path:        "main.go",
+			start:       3,
+			end:         3,
+			expectedURL: "https://git.example.com/org/repo/blob/abc123/main.go#L3",
+		},
+		{
+			name:        "gitlab range",
+			repoURL:     "https://gitlab.com/group/sub/project/",
+			path:        "pkg/server.go",
+			start:       12,
+			end:         14,
+			expectedURL: "https://gitlab.com/group/sub/project/-/blob/abc123/pkg/server.go#L12-14",
+		},
+		{
+			name:        "escaped path",
+			repoURL:     "https://github.com/org/repo",
+			path:        "docs/my file#1.go",
+			start:       1,
+			expectedURL: "https://github.com/org/repo/blob/abc123/docs/my%20file%231.go#L1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			links, err := NewFileLinker(tt.repoURL, "abc123")
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedURL, links.URL(tt.path, tt.start, tt.end))
+		})
+	}
+}
+
+func TestNewFileLinker_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		repoURL string
+		ref     string
+	}{
+		{name: "ssh remote", repoURL: "git@github.com:org/repo.git", ref: "abc123"},
+		{name: "missing host", repoURL: "https:///repo", ref: "abc123"},
+		{name: "empty ref", repoURL: "https://github.com/org/repo"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewFileLinker(tt.repoURL, tt.ref)
+			assert.Error(t, err)
+		})
+	}
+}
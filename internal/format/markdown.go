@@ -9,7 +9,11 @@ import (
 
 // MarkdownFormatter formats analysis results as Markdown.
 // Outputs a table with uncovered lines by file and a summary.
-type MarkdownFormatter struct{}
+type MarkdownFormatter struct {
+	// Links, if set, renders files and line ranges as links to the
+	// repository at a fixed revision
+	Links *FileLinker
+}
 
 // Format formats the analysis result as Markdown.
 func (f *MarkdownFormatter) Format(result *coverage.AnalysisResult, w io.Writer) error {
@@ -21,9 +25,13 @@ func (f *MarkdownFormatter) Format(result *coverage.AnalysisResult, w io.Writer)
 	if !result.HasUncoveredLines() {
 		if result.DiffAddedLines == 0 {
 			fmt.Fprintln(w, "No lines added in diff")
-			return nil
+		} else {
+			fmt.Fprintln(w, "All added lines are covered!")
+		}
+		if added := formatAddedLines(result); added != "" {
+			fmt.Fprintf(w, "\n**Added lines:** %s\n", added)
 		}
-		fmt.Fprintln(w, "All added lines are covered!")
+		writeMarkdownSuppressions(result, w)
 		return nil
 	}
 
@@ -39,6 +47,10 @@ func (f *MarkdownFormatter) Format(result *coverage.AnalysisResult, w io.Writer)
 	sortedFiles := result.GetSortedFiles()
 	for _, file := range sortedFiles {
 		lines := result.UncoveredByFile[file]
+		if f.Links != nil {
+			fmt.Fprintf(w, "| [%s](%s) | %s |\n", file, f.Links.URL(file, lines[0], 0), formatLinkedRanges(f.Links, file, lines))
+			continue
+		}
 		fmt.Fprintf(w, "| %s | %s |\n", file, formatLineRanges(lines))
 	}
 
@@ -54,5 +66,38 @@ func (f *MarkdownFormatter) Format(result *coverage.AnalysisResult, w io.Writer)
 	fmt.Fprintf(w, "**Summary:** %d uncovered lines out of %d added (%.1f%% coverage)\n",
 		uncoveredCount, result.DiffAddedLines, coveragePercent)
 
+	if added := formatAddedLines(result); added != "" {
+		fmt.Fprintf(w, "\n**Added lines:** %s\n", added)
+	}
+	writeMarkdownSuppressions(result, w)
+	return nil
+}
+
+// FormatUncoveredDetails writes the uncovered lines of an analysis as a
+// collapsed Markdown <details> block, for PR comments that summarize
+// coverage first. It writes nothing if all added lines are covered. links,
+// if set, links files and line ranges to the repository.
+func FormatUncoveredDetails(result *coverage.AnalysisResult, w io.Writer, links *FileLinker) error {
+	if result == nil {
+		return fmt.Errorf("result is nil")
+	}
+	if !result.HasUncoveredLines() {
+		return nil
+	}
+
+	fmt.Fprintln(w, "<details>")
+	fmt.Fprintf(w, "<summary>Uncovered added lines (%d)</summary>\n\n", result.DiffAddedLines-result.DiffAddedCovered)
+	fmt.Fprintln(w, "| File | Lines |")
+	fmt.Fprintln(w, "|------|-------|")
+	for _, file := range result.GetSortedFiles() {
+		lines := result.UncoveredByFile[file]
+		if links != nil {
+			fmt.Fprintf(w, "| [%s](%s) | %s |\n", file, links.URL(file, lines[0], 0), formatLinkedRanges(links, file, lines))
+			continue
+		}
+		fmt.Fprintf(w, "| %s | %s |\n", file, formatLineRanges(lines))
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "</details>")
 	return nil
 }
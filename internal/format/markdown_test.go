@@ -113,3 +113,61 @@ func TestMarkdownFormatter_Format(t *testing.T) {
 		})
 	}
 }
+
+func TestMarkdownFormatter_Links(t *testing.T) {
+	links, err := NewFileLinker("https://github.com/org/repo", "abc123")
+	require.NoError(t, err)
+
+	result := &coverage.AnalysisResult{
+		UncoveredByFile: map[string][]int{
+			"pkg/server.go": {5, 6, 7, 10},
+		},
+		DiffAddedLines:   10,
+		DiffAddedCovered: 6,
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, (&MarkdownFormatter{Links: links}).Format(result, &buf))
+	assert.Equal(t, `## Uncovered Lines in Diff
+
+| File | Lines |
+|------|-------|
+| [pkg/server.go](https://github.com/org/repo/blob/abc123/pkg/server.go#L5) | [5-7](https://github.com/org/repo/blob/abc123/pkg/server.go#L5-L7), [10](https://github.com/org/repo/blob/abc123/pkg/server.go#L10) |
+
+**Summary:** 4 uncovered lines out of 10 added (60.0% coverage)
+`, buf.String())
+}
+
+func TestFormatUncoveredDetails(t *testing.T) {
+	result := &coverage.AnalysisResult{
+		UncoveredByFile: map[string][]int{
+			"pkg/server.go": {5, 6, 7, 10},
+			"main.go":       {3},
+		},
+		DiffAddedLines:   10,
+		DiffAddedCovered: 5,
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, FormatUncoveredDetails(result, &buf, nil))
+	assert.Equal(t, `<details>
+<summary>Uncovered added lines (5)</summary>
+
+| File | Lines |
+|------|-------|
+| main.go | 3 |
+| pkg/server.go | 5-7, 10 |
+
+</details>
+`, buf.String())
+
+	links, err := NewFileLinker("https://github.com/org/repo", "abc123")
+	require.NoError(t, err)
+	buf.Reset()
+	require.NoError(t, FormatUncoveredDetails(result, &buf, links))
+	assert.Contains(t, buf.String(), "| [main.go](https://github.com/org/repo/blob/abc123/main.go#L3) | [3](https://github.com/org/repo/blob/abc123/main.go#L3) |")
+
+	buf.Reset()
+	require.NoError(t, FormatUncoveredDetails(&coverage.AnalysisResult{DiffAddedLines: 3, DiffAddedCovered: 3}, &buf, nil))
+	assert.Empty(t, buf.String())
+}
@@ -0,0 +1,262 @@
+package format
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+)
+
+// unownedLabel names the group of files without owners.
+const unownedLabel = "Unowned"
+
+// ReleaseReport lists the code added since a release that remains
+// uncovered, grouped by owner and package, for release-readiness reviews.
+type ReleaseReport struct {
+	// Since is the ref the report starts from, e.g. the last release tag
+	Since string
+	// AddedLines and CoveredLines count the executable lines added since
+	// the release, excluding suppressed lines
+	AddedLines   int
+	CoveredLines int
+	// Owners group the packages with uncovered lines by the owners of their
+	// files, sorted by owner with files without owners last
+	Owners []ReleaseOwner
+}
+
+// ReleaseOwner groups the files with the same owners.
+type ReleaseOwner struct {
+	// Owners are the CODEOWNERS owners of the files; empty if they have none
+	Owners         []string
+	UncoveredLines int
+	// Packages are sorted by directory
+	Packages []ReleasePackage
+}
+
+// ReleasePackage holds the files of an owner in a package directory.
+type ReleasePackage struct {
+	Dir string
+	// AddedLines counts the executable lines added to the owner's files in
+	// the package, covered or not
+	AddedLines     int
+	UncoveredLines int
+	// Files lists files with uncovered lines, sorted by path
+	Files []JSONFile
+}
+
+// Label returns the owners of the group as written in reports.
+func (o *ReleaseOwner) Label() string {
+	if len(o.Owners) == 0 {
+		return unownedLabel
+	}
+	return strings.Join(o.Owners, " ")
+}
+
+// Coverage returns the percentage of the package's added lines covered.
+func (p *ReleasePackage) Coverage() float64 {
+	if p.AddedLines == 0 {
+		return 100
+	}
+	return float64(p.AddedLines-p.UncoveredLines) / float64(p.AddedLines) * 100
+}
+
+// Coverage returns the percentage of added lines covered; 100 if no lines
+// were added.
+func (r *ReleaseReport) Coverage() float64 {
+	if r.AddedLines == 0 {
+		return 100
+	}
+	return float64(r.CoveredLines) / float64(r.AddedLines) * 100
+}
+
+// UncoveredLines returns the number of added lines left uncovered.
+func (r *ReleaseReport) UncoveredLines() int {
+	return r.AddedLines - r.CoveredLines
+}
+
+// NewReleaseReport builds the ReleaseReport of an analysis of the lines
+// added since a release. lineCoverage is the coverage of each executable
+// added line (see coverage.LineCoverageByFile), and owners returns the
+// owners of a file, or nil if it has none.
+func NewReleaseReport(since string, result *coverage.AnalysisResult, lineCoverage map[string]map[int]bool, owners func(file string) []string) *ReleaseReport {
+	report := &ReleaseReport{Since: since, AddedLines: result.DiffAddedLines, CoveredLines: result.DiffAddedCovered}
+
+	groups := make(map[string]*ReleaseOwner)
+	packages := make(map[string]map[string]*ReleasePackage)
+	for file, lines := range lineCoverage {
+		fileOwners := owners(file)
+		owner := &ReleaseOwner{Owners: fileOwners}
+		label := owner.Label()
+		if existing, ok := groups[label]; ok {
+			owner = existing
+		} else {
+			groups[label] = owner
+			packages[label] = make(map[string]*ReleasePackage)
+		}
+
+		dir := path.Dir(file)
+		pkg, ok := packages[label][dir]
+		if !ok {
+			pkg = &ReleasePackage{Dir: dir}
+			packages[label][dir] = pkg
+		}
+		pkg.AddedLines += len(lines) - len(result.Suppressed[file])
+		if uncovered := result.UncoveredByFile[file]; len(uncovered) > 0 {
+			pkg.UncoveredLines += len(uncovered)
+			owner.UncoveredLines += len(uncovered)
+			pkg.Files = append(pkg.Files, JSONFile{Path: file, UncoveredLines: sortedLines(uncovered)})
+		}
+	}
+
+	for label, owner := range groups {
+		if owner.UncoveredLines == 0 {
+			continue
+		}
+		for _, pkg := range packages[label] {
+			if pkg.UncoveredLines == 0 {
+				continue
+			}
+			sort.Slice(pkg.Files, func(i, j int) bool { return pkg.Files[i].Path < pkg.Files[j].Path })
+			owner.Packages = append(owner.Packages, *pkg)
+		}
+		sort.Slice(owner.Packages, func(i, j int) bool { return owner.Packages[i].Dir < owner.Packages[j].Dir })
+		report.Owners = append(report.Owners, *owner)
+	}
+	sort.Slice(report.Owners, func(i, j int) bool {
+		a, b := report.Owners[i], report.Owners[j]
+		if (len(a.Owners) == 0) != (len(b.Owners) == 0) {
+			return len(b.Owners) == 0
+		}
+		return a.Label() < b.Label()
+	})
+	return report
+}
+
+// FormatReleaseMarkdown writes a ReleaseReport as Markdown, with a section
+// per owner and a table of files per package. links, if set, links files
+// and line ranges to the repository.
+func FormatReleaseMarkdown(r *ReleaseReport, w io.Writer, links *FileLinker) error {
+	fmt.Fprintf(w, "## Uncovered code since %s\n\n", r.Since)
+	fmt.Fprintf(w, "%d executable lines added, %d covered (%.1f%%), %d uncovered.\n",
+		r.AddedLines, r.CoveredLines, r.Coverage(), r.UncoveredLines())
+	if len(r.Owners) == 0 {
+		fmt.Fprintf(w, "\nAll code added since %s is covered.\n", r.Since)
+		return nil
+	}
+
+	for _, owner := range r.Owners {
+		fmt.Fprintf(w, "\n### %s (%d uncovered lines)\n", owner.Label(), owner.UncoveredLines)
+		for _, pkg := range owner.Packages {
+			fmt.Fprintf(w, "\n**%s**: %d of %d added lines uncovered (%.1f%% covered)\n\n",
+				pkg.Dir, pkg.UncoveredLines, pkg.AddedLines, pkg.Coverage())
+			fmt.Fprintln(w, "| File | Uncovered lines |")
+			fmt.Fprintln(w, "|------|-----------------|")
+			for _, file := range pkg.Files {
+				if links != nil {
+					fmt.Fprintf(w, "| [%s](%s) | %s |\n", file.Path, links.URL(file.Path, file.UncoveredLines[0], 0),
+						formatLinkedRanges(links, file.Path, file.UncoveredLines))
+					continue
+				}
+				fmt.Fprintf(w, "| %s | %s |\n", file.Path, formatLineRanges(file.UncoveredLines))
+			}
+		}
+	}
+	return nil
+}
+
+// FormatReleaseHTML writes a ReleaseReport as a standalone HTML page with
+// the same sections as FormatReleaseMarkdown.
+func FormatReleaseHTML(r *ReleaseReport, w io.Writer, links *FileLinker) error {
+	page := releasePage{Report: r}
+	for _, owner := range r.Owners {
+		ov := releaseOwnerView{Label: owner.Label(), UncoveredLines: owner.UncoveredLines}
+		for _, pkg := range owner.Packages {
+			pv := releasePackageView{Dir: pkg.Dir, AddedLines: pkg.AddedLines, UncoveredLines: pkg.UncoveredLines, Coverage: pkg.Coverage()}
+			for _, file := range pkg.Files {
+				fv := releaseFileView{Path: file.Path}
+				if links != nil {
+					fv.URL = links.URL(file.Path, file.UncoveredLines[0], 0)
+				}
+				for _, lr := range lineRanges(file.UncoveredLines) {
+					rv := releaseRangeView{Text: fmt.Sprintf("%d", lr[0])}
+					if lr[1] != lr[0] {
+						rv.Text = fmt.Sprintf("%d-%d", lr[0], lr[1])
+					}
+					if links != nil {
+						rv.URL = links.URL(file.Path, lr[0], lr[1])
+					}
+					fv.Ranges = append(fv.Ranges, rv)
+				}
+				pv.Files = append(pv.Files, fv)
+			}
+			ov.Packages = append(ov.Packages, pv)
+		}
+		page.Owners = append(page.Owners, ov)
+	}
+	if err := releaseTemplate.Execute(w, page); err != nil {
+		return fmt.Errorf("failed to render release report: %w", err)
+	}
+	return nil
+}
+
+// releasePage is the template input for FormatReleaseHTML.
+type releasePage struct {
+	Report *ReleaseReport
+	Owners []releaseOwnerView
+}
+
+type releaseOwnerView struct {
+	Label          string
+	UncoveredLines int
+	Packages       []releasePackageView
+}
+
+type releasePackageView struct {
+	Dir            string
+	AddedLines     int
+	UncoveredLines int
+	Coverage       float64
+	Files          []releaseFileView
+}
+
+type releaseFileView struct {
+	Path string
+	// URL is empty if files aren't linked
+	URL    string
+	Ranges []releaseRangeView
+}
+
+type releaseRangeView struct {
+	Text string
+	URL  string
+}
+
+var releaseTemplate = template.Must(template.New("release").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Uncovered code since {{.Report.Since}}</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #d0d7de; padding: 0.25em 0.75em; text-align: left; }
+td.lines { font-family: ui-monospace, monospace; }
+</style>
+</head>
+<body>
+<h1>Uncovered code since {{.Report.Since}}</h1>
+<p>{{.Report.AddedLines}} executable lines added, {{.Report.CoveredLines}} covered ({{printf "%.1f" .Report.Coverage}}%), {{.Report.UncoveredLines}} uncovered.</p>
+{{if not .Owners}}<p>All code added since {{.Report.Since}} is covered.</p>
+{{end}}{{range .Owners}}<h2>{{.Label}} <small>({{.UncoveredLines}} uncovered lines)</small></h2>
+{{range .Packages}}<h3>{{.Dir}} <small>{{.UncoveredLines}} of {{.AddedLines}} added lines uncovered ({{printf "%.1f" .Coverage}}% covered)</small></h3>
+<table>
+<tr><th>File</th><th>Uncovered lines</th></tr>
+{{range .Files}}<tr><td>{{if .URL}}<a href="{{.URL}}">{{.Path}}</a>{{else}}{{.Path}}{{end}}</td><td class="lines">{{range $i, $r := .Ranges}}{{if $i}}, {{end}}{{if $r.URL}}<a href="{{$r.URL}}">{{$r.Text}}</a>{{else}}{{$r.Text}}{{end}}{{end}}</td></tr>
+{{end}}</table>
+{{end}}{{end}}</body>
+</html>
+`))
@@ -0,0 +1,135 @@
+package format
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func releaseFixture() *ReleaseReport {
+	result := &coverage.AnalysisResult{
+		UncoveredByFile: map[string][]int{
+			"api/handler.go":   {12, 10, 11},
+			"api/routes.go":    {5},
+			"store/db.go":      {40},
+			"scripts/setup.go": {3, 4},
+		},
+		Suppressed:       map[string][]int{"api/handler.go": {20}},
+		DiffAddedLines:   13,
+		DiffAddedCovered: 6,
+	}
+	lineCoverage := map[string]map[int]bool{
+		"api/handler.go":   {10: false, 11: false, 12: false, 13: true, 20: false},
+		"api/routes.go":    {5: false, 6: true},
+		"store/db.go":      {40: false, 41: true, 42: true},
+		"store/cache.go":   {7: true},
+		"scripts/setup.go": {3: false, 4: false, 5: true},
+	}
+	owners := map[string][]string{
+		"api/handler.go": {"@acme/web"},
+		"api/routes.go":  {"@acme/web"},
+		"store/db.go":    {"@acme/data", "@alice"},
+		"store/cache.go": {"@acme/data", "@alice"},
+	}
+	return NewReleaseReport("v1.4.0", result, lineCoverage, func(file string) []string { return owners[file] })
+}
+
+func TestNewReleaseReport(t *testing.T) {
+	report := releaseFixture()
+
+	assert.Equal(t, &ReleaseReport{
+		Since:        "v1.4.0",
+		AddedLines:   13,
+		CoveredLines: 6,
+		Owners: []ReleaseOwner{
+			{
+				Owners:         []string{"@acme/data", "@alice"},
+				UncoveredLines: 1,
+				Packages: []ReleasePackage{
+					{Dir: "store", AddedLines: 4, UncoveredLines: 1, Files: []JSONFile{{Path: "store/db.go", UncoveredLines: []int{40}}}},
+				},
+			},
+			{
+				Owners:         []string{"@acme/web"},
+				UncoveredLines: 4,
+				Packages: []ReleasePackage{
+					{Dir: "api", AddedLines: 6, UncoveredLines: 4, Files: []JSONFile{
+						{Path: "api/handler.go", UncoveredLines: []int{10, 11, 12}},
+						{Path: "api/routes.go", UncoveredLines: []int{5}},
+					}},
+				},
+			},
+			{
+				UncoveredLines: 2,
+				Packages: []ReleasePackage{
+					{Dir: "scripts", AddedLines: 3, UncoveredLines: 2, Files: []JSONFile{{Path: "scripts/setup.go", UncoveredLines: []int{3, 4}}}},
+				},
+			},
+		},
+	}, report)
+	assert.Equal(t, "Unowned", report.Owners[2].Label())
+}
+
+func TestFormatReleaseMarkdown(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, FormatReleaseMarkdown(releaseFixture(), &buf, nil))
+
+	assert.Equal(t, `## Uncovered code since v1.4.0
+
+13 executable lines added, 6 covered (46.2%), 7 uncovered.
+
+### @acme/data @alice (1 uncovered lines)
+
+**store**: 1 of 4 added lines uncovered (75.0% covered)
+
+| File | Uncovered lines |
+|------|-----------------|
+| store/db.go | 40 |
+
+### @acme/web (4 uncovered lines)
+
+**api**: 4 of 6 added lines uncovered (33.3% covered)
+
+| File | Uncovered lines |
+|------|-----------------|
+| api/handler.go | 10-12 |
+| api/routes.go | 5 |
+
+### Unowned (2 uncovered lines)
+
+**scripts**: 2 of 3 added lines uncovered (33.3% covered)
+
+| File | Uncovered lines |
+|------|-----------------|
+| scripts/setup.go | 3-4 |
+`, buf.String())
+
+	links, err := NewFileLinker("https://github.com/acme/app", "abc123")
+	require.NoError(t, err)
+	buf.Reset()
+	require.NoError(t, FormatReleaseMarkdown(releaseFixture(), &buf, links))
+	assert.Contains(t, buf.String(), "| [api/handler.go](https://github.com/acme/app/blob/abc123/api/handler.go#L10) | [10-12](https://github.com/acme/app/blob/abc123/api/handler.go#L10-L12) |")
+
+	buf.Reset()
+	require.NoError(t, FormatReleaseMarkdown(&ReleaseReport{Since: "v1.4.0", AddedLines: 3, CoveredLines: 3}, &buf, nil))
+	assert.Contains(t, buf.String(), "All code added since v1.4.0 is covered.")
+}
+
+func TestFormatReleaseHTML(t *testing.T) {
+	links, err := NewFileLinker("https://github.com/acme/app", "abc123")
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, FormatReleaseHTML(releaseFixture(), &buf, links))
+	html := buf.String()
+
+	assert.Contains(t, html, "<title>Uncovered code since v1.4.0</title>")
+	assert.Contains(t, html, "13 executable lines added, 6 covered (46.2%), 7 uncovered.")
+	assert.Contains(t, html, "<h2>@acme/web <small>(4 uncovered lines)</small></h2>")
+	assert.Contains(t, html, "<h2>Unowned <small>(2 uncovered lines)</small></h2>")
+	assert.Contains(t, html, `<td><a href="https://github.com/acme/app/blob/abc123/api/handler.go#L10">api/handler.go</a></td>`)
+	assert.Contains(t, html, `<td class="lines"><a href="https://github.com/acme/app/blob/abc123/scripts/setup.go#L3-L4">3-4</a></td>`)
+}
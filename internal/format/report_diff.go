@@ -0,0 +1,200 @@
+package format
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// ReportDiff is the difference between two JSON reports of the same change,
+// e.g. before and after adding tests.
+// Lines are compared by number, so edits that shift lines show up as
+// resolved lines in the old positions and uncovered lines in the new ones.
+type ReportDiff struct {
+	Old JSONSummary
+	New JSONSummary
+	// NewFiles maps files uncovered only in the new report to their uncovered lines
+	NewFiles map[string][]int
+	// NewLines maps files uncovered in both reports to lines uncovered only in the new one
+	NewLines map[string][]int
+	// Resolved maps files to lines uncovered only in the old report
+	Resolved map[string][]int
+	// FullyCovered lists files uncovered in the old report only, sorted
+	FullyCovered []string
+}
+
+// CompareReports compares an old and a new report.
+func CompareReports(oldReport, newReport *JSONReport) *ReportDiff {
+	diff := &ReportDiff{
+		Old:      oldReport.Summary,
+		New:      newReport.Summary,
+		NewFiles: make(map[string][]int),
+		NewLines: make(map[string][]int),
+		Resolved: make(map[string][]int),
+	}
+
+	oldFiles := linesByFile(oldReport)
+	newFiles := linesByFile(newReport)
+
+	for file, newLines := range newFiles {
+		oldLines, existed := oldFiles[file]
+		if !existed {
+			diff.NewFiles[file] = sortedLines(newLines)
+			continue
+		}
+		if added := subtractLines(newLines, oldLines); len(added) > 0 {
+			diff.NewLines[file] = added
+		}
+	}
+
+	for file, oldLines := range oldFiles {
+		newLines, stillUncovered := newFiles[file]
+		if !stillUncovered {
+			diff.FullyCovered = append(diff.FullyCovered, file)
+		}
+		if resolved := subtractLines(oldLines, newLines); len(resolved) > 0 {
+			diff.Resolved[file] = resolved
+		}
+	}
+	sort.Strings(diff.FullyCovered)
+
+	return diff
+}
+
+// HasChanges returns true if any uncovered line differs between the reports.
+func (d *ReportDiff) HasChanges() bool {
+	return len(d.NewFiles) > 0 || len(d.NewLines) > 0 || len(d.Resolved) > 0
+}
+
+// FormatReportDiff writes a ReportDiff as plain text for console output.
+func FormatReportDiff(d *ReportDiff, w io.Writer) error {
+	fmt.Fprintf(w, "Patch coverage: %.1f%% -> %.1f%% (%+.1f%%)\n", d.Old.Coverage, d.New.Coverage, d.New.Coverage-d.Old.Coverage)
+	fmt.Fprintf(w, "Uncovered lines: %d -> %d\n", d.Old.UncoveredLines, d.New.UncoveredLines)
+
+	if !d.HasChanges() {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "No changes in uncovered lines")
+		return nil
+	}
+
+	writeSection(w, "Newly uncovered files:", d.NewFiles, nil)
+	writeSection(w, "Newly uncovered lines:", d.NewLines, nil)
+
+	fullyCovered := make(map[string]bool, len(d.FullyCovered))
+	for _, file := range d.FullyCovered {
+		fullyCovered[file] = true
+	}
+	writeSection(w, "Resolved lines:", d.Resolved, fullyCovered)
+	return nil
+}
+
+// FormatReportDiffMarkdown writes a ReportDiff as Markdown, with a table of
+// files whose uncovered lines changed. links, if set, links newly uncovered
+// lines to the new report's revision; resolved lines are not linked, since
+// they may refer to positions in the old revision.
+func FormatReportDiffMarkdown(d *ReportDiff, w io.Writer, links *FileLinker) error {
+	fmt.Fprintln(w, "| | Last run | This run |")
+	fmt.Fprintln(w, "|---|---|---|")
+	fmt.Fprintf(w, "| Patch coverage | %.1f%% | %.1f%% (%+.1f%%) |\n", d.Old.Coverage, d.New.Coverage, d.New.Coverage-d.Old.Coverage)
+	fmt.Fprintf(w, "| Uncovered lines | %d | %d |\n", d.Old.UncoveredLines, d.New.UncoveredLines)
+	fmt.Fprintln(w)
+
+	if !d.HasChanges() {
+		fmt.Fprintln(w, "No changes in uncovered lines")
+		return nil
+	}
+
+	uncovered := make(map[string][]int, len(d.NewFiles)+len(d.NewLines))
+	for _, lines := range []map[string][]int{d.NewFiles, d.NewLines} {
+		for file, l := range lines {
+			uncovered[file] = l
+		}
+	}
+	fullyCovered := make(map[string]bool, len(d.FullyCovered))
+	for _, file := range d.FullyCovered {
+		fullyCovered[file] = true
+	}
+
+	files := make([]string, 0, len(uncovered)+len(d.Resolved))
+	for file := range uncovered {
+		files = append(files, file)
+	}
+	for file := range d.Resolved {
+		if _, ok := uncovered[file]; !ok {
+			files = append(files, file)
+		}
+	}
+	sort.Strings(files)
+
+	fmt.Fprintln(w, "| File | Newly uncovered | Resolved |")
+	fmt.Fprintln(w, "|------|-----------------|----------|")
+	for _, file := range files {
+		name, newLines := file, formatLineRanges(uncovered[file])
+		if lines := uncovered[file]; links != nil && len(lines) > 0 {
+			name = fmt.Sprintf("[%s](%s)", file, links.URL(file, lines[0], 0))
+			newLines = formatLinkedRanges(links, file, lines)
+		}
+		resolved := formatLineRanges(d.Resolved[file])
+		if fullyCovered[file] {
+			resolved += " (now fully covered)"
+		}
+		fmt.Fprintf(w, "| %s | %s | %s |\n", name, newLines, resolved)
+	}
+	return nil
+}
+
+// writeSection writes a titled list of files and line ranges, if any.
+// Files in fullyCovered are marked as such.
+func writeSection(w io.Writer, title string, lines map[string][]int, fullyCovered map[string]bool) {
+	if len(lines) == 0 {
+		return
+	}
+
+	files := make([]string, 0, len(lines))
+	for file := range lines {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, title)
+	for _, file := range files {
+		suffix := ""
+		if fullyCovered[file] {
+			suffix = " (now fully covered)"
+		}
+		fmt.Fprintf(w, "  %s: %s%s\n", file, formatLineRanges(lines[file]), suffix)
+	}
+}
+
+// linesByFile indexes a report's uncovered lines by file.
+func linesByFile(report *JSONReport) map[string][]int {
+	byFile := make(map[string][]int, len(report.Files))
+	for _, file := range report.Files {
+		byFile[file.Path] = append(byFile[file.Path], file.UncoveredLines...)
+	}
+	return byFile
+}
+
+// subtractLines returns the sorted lines in a that are not in b.
+func subtractLines(a, b []int) []int {
+	exclude := make(map[int]bool, len(b))
+	for _, line := range b {
+		exclude[line] = true
+	}
+
+	var result []int
+	for _, line := range a {
+		if !exclude[line] {
+			result = append(result, line)
+		}
+	}
+	return sortedLines(result)
+}
+
+func sortedLines(lines []int) []int {
+	sorted := make([]int, len(lines))
+	copy(sorted, lines)
+	sort.Ints(sorted)
+	return sorted
+}
@@ -0,0 +1,179 @@
+package format
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareReports(t *testing.T) {
+	oldReport := &JSONReport{
+		Summary: JSONSummary{AddedLines: 10, CoveredLines: 4, UncoveredLines: 6, Coverage: 40},
+		Files: []JSONFile{
+			{Path: "pkg/a.go", UncoveredLines: []int{1, 2, 3}},
+			{Path: "pkg/b.go", UncoveredLines: []int{7, 8}},
+			{Path: "pkg/c.go", UncoveredLines: []int{20}},
+		},
+	}
+	newReport := &JSONReport{
+		Summary: JSONSummary{AddedLines: 12, CoveredLines: 8, UncoveredLines: 4, Coverage: 66.7},
+		Files: []JSONFile{
+			{Path: "pkg/a.go", UncoveredLines: []int{3, 4}},
+			{Path: "pkg/c.go", UncoveredLines: []int{20}},
+			{Path: "pkg/d.go", UncoveredLines: []int{9}},
+		},
+	}
+
+	diff := CompareReports(oldReport, newReport)
+
+	assert.Equal(t, oldReport.Summary, diff.Old)
+	assert.Equal(t, newReport.Summary, diff.New)
+	assert.Equal(t, map[string][]int{"pkg/d.go": {9}}, diff.NewFiles)
+	assert.Equal(t, map[string][]int{"pkg/a.go": {4}}, diff.NewLines)
+	assert.Equal(t, map[string][]int{"pkg/a.go": {1, 2}, "pkg/b.go": {7, 8}}, diff.Resolved)
+	assert.Equal(t, []string{"pkg/b.go"}, diff.FullyCovered)
+	assert.True(t, diff.HasChanges())
+}
+
+func TestFormatReportDiff(t *testing.T) {
+	tests := []struct {
+		name           string
+		oldReport      *JSONReport
+		newReport      *JSONReport
+		expectedOutput string
+	}{
+		{
+			name: "changes",
+			oldReport: &JSONReport{
+				Summary: JSONSummary{UncoveredLines: 5, Coverage: 50},
+				Files: []JSONFile{
+					{Path: "pkg/a.go", UncoveredLines: []int{1, 2, 3}},
+					{Path: "pkg/b.go", UncoveredLines: []int{7, 8}},
+				},
+			},
+			newReport: &JSONReport{
+				Summary: JSONSummary{UncoveredLines: 3, Coverage: 70},
+				Files: []JSONFile{
+					{Path: "pkg/a.go", UncoveredLines: []int{3, 10}},
+					{Path: "pkg/new.go", UncoveredLines: []int{4}},
+				},
+			},
+			expectedOutput: `Patch coverage: 50.0% -> 70.0% (+20.0%)
+Uncovered lines: 5 -> 3
+
+Newly uncovered files:
+  pkg/new.go: 4
+
+Newly uncovered lines:
+  pkg/a.go: 10
+
+Resolved lines:
+  pkg/a.go: 1-2
+  pkg/b.go: 7-8 (now fully covered)
+`,
+		},
+		{
+			name: "no changes",
+			oldReport: &JSONReport{
+				Summary: JSONSummary{UncoveredLines: 1, Coverage: 90},
+				Files:   []JSONFile{{Path: "main.go", UncoveredLines: []int{5}}},
+			},
+			newReport: &JSONReport{
+				Summary: JSONSummary{UncoveredLines: 1, Coverage: 90},
+				Files:   []JSONFile{{Path: "main.go", UncoveredLines: []int{5}}},
+			},
+			expectedOutput: `Patch coverage: 90.0% -> 90.0% (+0.0%)
+Uncovered lines: 1 -> 1
+
+No changes in uncovered lines
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, FormatReportDiff(CompareReports(tt.oldReport, tt.newReport), &buf))
+			assert.Equal(t, tt.expectedOutput, buf.String())
+		})
+	}
+}
+
+func TestFormatReportDiffMarkdown(t *testing.T) {
+	oldReport := &JSONReport{
+		Summary: JSONSummary{UncoveredLines: 5, Coverage: 50},
+		Files: []JSONFile{
+			{Path: "pkg/a.go", UncoveredLines: []int{1, 2, 3}},
+			{Path: "pkg/b.go", UncoveredLines: []int{7, 8}},
+		},
+	}
+	newReport := &JSONReport{
+		Summary: JSONSummary{UncoveredLines: 3, Coverage: 70},
+		Files: []JSONFile{
+			{Path: "pkg/a.go", UncoveredLines: []int{3, 10}},
+			{Path: "pkg/new.go", UncoveredLines: []int{4}},
+		},
+	}
+	links, err := NewFileLinker("https://github.com/acme/widgets", "abc123")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		oldReport      *JSONReport
+		links          *FileLinker
+		expectedOutput string
+	}{
+		{
+			name:      "changes",
+			oldReport: oldReport,
+			expectedOutput: `| | Last run | This run |
+|---|---|---|
+| Patch coverage | 50.0% | 70.0% (+20.0%) |
+| Uncovered lines | 5 | 3 |
+
+| File | Newly uncovered | Resolved |
+|------|-----------------|----------|
+| pkg/a.go | 10 | 1-2 |
+| pkg/b.go |  | 7-8 (now fully covered) |
+| pkg/new.go | 4 |  |
+`,
+		},
+		{
+			name:      "links newly uncovered lines",
+			oldReport: oldReport,
+			links:     links,
+			expectedOutput: `| | Last run | This run |
+|---|---|---|
+| Patch coverage | 50.0% | 70.0% (+20.0%) |
+| Uncovered lines | 5 | 3 |
+
+| File | Newly uncovered | Resolved |
+|------|-----------------|----------|
+| [pkg/a.go](https://github.com/acme/widgets/blob/abc123/pkg/a.go#L10) | [10](https://github.com/acme/widgets/blob/abc123/pkg/a.go#L10) | 1-2 |
+| pkg/b.go |  | 7-8 (now fully covered) |
+| [pkg/new.go](https://github.com/acme/widgets/blob/abc123/pkg/new.go#L4) | [4](https://github.com/acme/widgets/blob/abc123/pkg/new.go#L4) |  |
+`,
+		},
+		{
+			name:      "no changes",
+			oldReport: newReport,
+			expectedOutput: `| | Last run | This run |
+|---|---|---|
+| Patch coverage | 70.0% | 70.0% (+0.0%) |
+| Uncovered lines | 3 | 3 |
+
+No changes in uncovered lines
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, FormatReportDiffMarkdown(CompareReports(tt.oldReport, newReport), &buf, tt.links))
+			assert.Equal(t, tt.expectedOutput, buf.String())
+		})
+	}
+}
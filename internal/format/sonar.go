@@ -0,0 +1,96 @@
+package format
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github"
+)
+
+const (
+	// sonarEngineID identifies Canopy as the issue source in SonarQube.
+	sonarEngineID = "canopy"
+	// sonarRuleID groups all uncovered-line issues under one external rule.
+	sonarRuleID = "uncovered-added-lines"
+)
+
+// SonarFormatter formats analysis results as SonarQube generic external issues
+// (sonar.externalIssuesReportPaths), one issue per block of consecutive
+// uncovered lines, so diff coverage shows up on SonarQube dashboards.
+type SonarFormatter struct {
+	// Annotate generates the annotations to export. Defaults to
+	// coverage.GenerateAnnotations, which reports every range as a notice.
+	Annotate func(result *coverage.AnalysisResult) []*github.Annotation
+}
+
+// sonarReport is the generic external issues document.
+type sonarReport struct {
+	Issues []sonarIssue `json:"issues"`
+}
+
+type sonarIssue struct {
+	EngineID        string        `json:"engineId"`
+	RuleID          string        `json:"ruleId"`
+	Severity        string        `json:"severity"`
+	Type            string        `json:"type"`
+	PrimaryLocation sonarLocation `json:"primaryLocation"`
+}
+
+type sonarLocation struct {
+	Message   string         `json:"message"`
+	FilePath  string         `json:"filePath"`
+	TextRange sonarTextRange `json:"textRange"`
+}
+
+type sonarTextRange struct {
+	StartLine int `json:"startLine"`
+	EndLine   int `json:"endLine,omitempty"`
+}
+
+// SetAnnotate implements AnnotationFormatter.
+func (f *SonarFormatter) SetAnnotate(annotate func(result *coverage.AnalysisResult) []*github.Annotation) {
+	f.Annotate = annotate
+}
+
+// Format formats the analysis result as a SonarQube generic issue report.
+// A fully covered diff produces a report with no issues.
+func (f *SonarFormatter) Format(result *coverage.AnalysisResult, w io.Writer) error {
+	if result == nil {
+		return fmt.Errorf("result is nil")
+	}
+
+	report := sonarReport{Issues: []sonarIssue{}}
+	if result.HasUncoveredLines() {
+		for _, annotation := range annotationsFor(f.Annotate, result) {
+			report.Issues = append(report.Issues, sonarIssue{
+				EngineID: sonarEngineID,
+				RuleID:   sonarRuleID,
+				Severity: sonarSeverity(annotation.Level),
+				Type:     "CODE_SMELL",
+				PrimaryLocation: sonarLocation{
+					Message:   annotation.Message,
+					FilePath:  annotation.Path,
+					TextRange: sonarTextRange{StartLine: annotation.StartLine, EndLine: annotation.EndLine},
+				},
+			})
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// sonarSeverity maps a Check Run annotation level to a SonarQube issue severity.
+func sonarSeverity(level string) string {
+	switch level {
+	case coverage.LevelWarning:
+		return "MAJOR"
+	case coverage.LevelFailure:
+		return "CRITICAL"
+	default:
+		return "MINOR"
+	}
+}
@@ -0,0 +1,122 @@
+package format
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSonarFormatter_Format(t *testing.T) {
+	tests := []struct {
+		name           string
+		result         *coverage.AnalysisResult
+		expectedOutput string
+		expectError    bool
+	}{
+		{
+			name: "uncovered ranges become issues",
+			result: &coverage.AnalysisResult{
+				UncoveredByFile: map[string][]int{
+					"pkg/server.go": {5, 6, 7},
+					"main.go":       {10},
+				},
+				DiffAddedLines:   10,
+				DiffAddedCovered: 6,
+			},
+			expectedOutput: `{
+  "issues": [
+    {
+      "engineId": "canopy",
+      "ruleId": "uncovered-added-lines",
+      "severity": "MINOR",
+      "type": "CODE_SMELL",
+      "primaryLocation": {
+        "message": "Line 10 is not covered by tests",
+        "filePath": "main.go",
+        "textRange": {
+          "startLine": 10,
+          "endLine": 10
+        }
+      }
+    },
+    {
+      "engineId": "canopy",
+      "ruleId": "uncovered-added-lines",
+      "severity": "MINOR",
+      "type": "CODE_SMELL",
+      "primaryLocation": {
+        "message": "Lines 5-7 are not covered by tests",
+        "filePath": "pkg/server.go",
+        "textRange": {
+          "startLine": 5,
+          "endLine": 7
+        }
+      }
+    }
+  ]
+}
+`,
+		},
+		{
+			name: "all lines covered",
+			result: &coverage.AnalysisResult{
+				UncoveredByFile:  map[string][]int{},
+				DiffAddedLines:   10,
+				DiffAddedCovered: 10,
+			},
+			expectedOutput: "{\n  \"issues\": []\n}\n",
+		},
+		{
+			name:        "nil result",
+			result:      nil,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			formatter := &SonarFormatter{}
+			var buf bytes.Buffer
+			err := formatter.Format(tt.result, &buf)
+
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedOutput, buf.String())
+		})
+	}
+}
+
+func TestSonarFormatter_Format_Levels(t *testing.T) {
+	result := &coverage.AnalysisResult{
+		UncoveredByFile: map[string][]int{
+			"main.go": {5, 10, 20},
+		},
+		DiffAddedLines:   10,
+		DiffAddedCovered: 7,
+	}
+
+	formatter := &SonarFormatter{
+		Annotate: func(result *coverage.AnalysisResult) []*github.Annotation {
+			annotations := coverage.GenerateAnnotations(result)
+			annotations[1].Level = coverage.LevelWarning
+			annotations[2].Level = coverage.LevelFailure
+			return annotations
+		},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, formatter.Format(result, &buf))
+
+	output := buf.String()
+	assert.Contains(t, output, `"severity": "MINOR"`)
+	assert.Contains(t, output, `"severity": "MAJOR"`)
+	assert.Contains(t, output, `"severity": "CRITICAL"`)
+}
@@ -0,0 +1,74 @@
+package format
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+)
+
+// MarkdownSummaryFormatter formats analysis results as aggregate Markdown:
+// the files with the most uncovered lines and their counts, without line
+// ranges. It keeps reports of very large changes short.
+type MarkdownSummaryFormatter struct {
+	// TopFiles is the number of files listed; zero or less lists all files
+	TopFiles int
+	// Links, if set, links files to their first uncovered line
+	Links *FileLinker
+}
+
+// Format formats the analysis result as aggregate Markdown.
+func (f *MarkdownSummaryFormatter) Format(result *coverage.AnalysisResult, w io.Writer) error {
+	if result == nil {
+		return fmt.Errorf("result is nil")
+	}
+
+	if !result.HasUncoveredLines() {
+		return (&MarkdownFormatter{Links: f.Links}).Format(result, w)
+	}
+
+	files := result.GetSortedFiles()
+	sort.SliceStable(files, func(i, j int) bool {
+		return len(result.UncoveredByFile[files[i]]) > len(result.UncoveredByFile[files[j]])
+	})
+	shown := files
+	if f.TopFiles > 0 && len(files) > f.TopFiles {
+		shown = files[:f.TopFiles]
+	}
+
+	fmt.Fprintln(w, "## Uncovered Lines in Diff")
+	fmt.Fprintln(w)
+	if len(shown) < len(files) {
+		fmt.Fprintf(w, "Top %d of %d files with uncovered lines:\n", len(shown), len(files))
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintln(w, "| File | Uncovered lines |")
+	fmt.Fprintln(w, "|------|-----------------|")
+	for _, file := range shown {
+		lines := result.UncoveredByFile[file]
+		name := file
+		if f.Links != nil {
+			name = fmt.Sprintf("[%s](%s)", file, f.Links.URL(file, lines[0], 0))
+		}
+		fmt.Fprintf(w, "| %s | %d |\n", name, len(lines))
+	}
+
+	fmt.Fprintln(w)
+
+	coveragePercent := 0.0
+	if result.DiffAddedLines > 0 {
+		coveragePercent = float64(result.DiffAddedCovered) / float64(result.DiffAddedLines) * 100
+	}
+
+	uncoveredCount := result.DiffAddedLines - result.DiffAddedCovered
+	fmt.Fprintf(w, "**Summary:** %d uncovered lines out of %d added (%.1f%% coverage)\n",
+		uncoveredCount, result.DiffAddedLines, coveragePercent)
+
+	if added := formatAddedLines(result); added != "" {
+		fmt.Fprintf(w, "\n**Added lines:** %s\n", added)
+	}
+	writeMarkdownSuppressions(result, w)
+	return nil
+}
@@ -0,0 +1,88 @@
+package format
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarkdownSummaryFormatter_Format(t *testing.T) {
+	result := &coverage.AnalysisResult{
+		UncoveredByFile: map[string][]int{
+			"a.go": {1},
+			"b.go": {1, 2, 3},
+			"c.go": {4, 5},
+			"d.go": {7, 9},
+		},
+		DiffAddedLines:   20,
+		DiffAddedCovered: 12,
+	}
+
+	tests := []struct {
+		name           string
+		formatter      *MarkdownSummaryFormatter
+		result         *coverage.AnalysisResult
+		expectedOutput string
+		expectError    bool
+	}{
+		{
+			name:      "top files by uncovered lines",
+			formatter: &MarkdownSummaryFormatter{TopFiles: 2},
+			result:    result,
+			expectedOutput: `## Uncovered Lines in Diff
+
+Top 2 of 4 files with uncovered lines:
+
+| File | Uncovered lines |
+|------|-----------------|
+| b.go | 3 |
+| c.go | 2 |
+
+**Summary:** 8 uncovered lines out of 20 added (60.0% coverage)
+`,
+		},
+		{
+			name:      "all files",
+			formatter: &MarkdownSummaryFormatter{},
+			result:    result,
+			expectedOutput: `## Uncovered Lines in Diff
+
+| File | Uncovered lines |
+|------|-----------------|
+| b.go | 3 |
+| c.go | 2 |
+| d.go | 2 |
+| a.go | 1 |
+
+**Summary:** 8 uncovered lines out of 20 added (60.0% coverage)
+`,
+		},
+		{
+			name:           "all lines covered",
+			formatter:      &MarkdownSummaryFormatter{TopFiles: 2},
+			result:         &coverage.AnalysisResult{UncoveredByFile: map[string][]int{}, DiffAddedLines: 3, DiffAddedCovered: 3},
+			expectedOutput: "All added lines are covered!\n",
+		},
+		{
+			name:        "nil result",
+			formatter:   &MarkdownSummaryFormatter{},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := tt.formatter.Format(tt.result, &buf)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedOutput, buf.String())
+		})
+	}
+}
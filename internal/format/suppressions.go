@@ -0,0 +1,63 @@
+package format
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+)
+
+// countLines returns the total number of lines in a file-to-lines map.
+func countLines(byFile map[string][]int) int {
+	n := 0
+	for _, lines := range byFile {
+		n += len(lines)
+	}
+	return n
+}
+
+// writeTextSuppressions writes the suppressed coverage debt section of the
+// Text format, if any lines are suppressed or have expired suppressions.
+func writeTextSuppressions(result *coverage.AnalysisResult, w io.Writer) {
+	files := result.SuppressedFiles()
+	if len(files) == 0 {
+		return
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Suppressed coverage debt: %d lines suppressed, %d expired\n",
+		countLines(result.Suppressed), countLines(result.ExpiredSuppressions))
+	fmt.Fprintln(w)
+	for _, file := range files {
+		fmt.Fprintf(w, "%s\n", file)
+		if lines := result.Suppressed[file]; len(lines) > 0 {
+			fmt.Fprintf(w, "  Suppressed: %s\n", formatLineRanges(lines))
+		}
+		if lines := result.ExpiredSuppressions[file]; len(lines) > 0 {
+			fmt.Fprintf(w, "  Expired: %s\n", formatLineRanges(lines))
+		}
+	}
+}
+
+// writeMarkdownSuppressions writes the suppressed coverage debt section of
+// the Markdown format, if any lines are suppressed or have expired
+// suppressions.
+func writeMarkdownSuppressions(result *coverage.AnalysisResult, w io.Writer) {
+	files := result.SuppressedFiles()
+	if len(files) == 0 {
+		return
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "### Suppressed Coverage Debt")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "| File | Suppressed | Expired |")
+	fmt.Fprintln(w, "|------|------------|---------|")
+	for _, file := range files {
+		fmt.Fprintf(w, "| %s | %d | %d |\n", file, len(result.Suppressed[file]), len(result.ExpiredSuppressions[file]))
+	}
+	if n := countLines(result.ExpiredSuppressions); n > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "%d lines with expired `%s` comments are reported as uncovered again.\n", n, coverage.SuppressDirective)
+	}
+}
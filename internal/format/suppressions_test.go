@@ -0,0 +1,71 @@
+package format
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func suppressedResult() *coverage.AnalysisResult {
+	return &coverage.AnalysisResult{
+		UncoveredByFile:     map[string][]int{"b.go": {4, 5}},
+		DiffAddedLines:      10,
+		DiffAddedCovered:    8,
+		Suppressed:          map[string][]int{"a.go": {1, 2, 3}},
+		ExpiredSuppressions: map[string][]int{"b.go": {4, 5}},
+	}
+}
+
+func TestSuppressions_Text(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, (&TextFormatter{}).Format(suppressedResult(), &buf))
+	assert.Equal(t, `Uncovered lines in diff:
+
+b.go
+  Lines: 4-5
+
+Summary: 2 uncovered lines out of 10 added lines (80.0% coverage)
+
+Suppressed coverage debt: 3 lines suppressed, 2 expired
+
+a.go
+  Suppressed: 1-3
+b.go
+  Expired: 4-5
+`, buf.String())
+}
+
+func TestSuppressions_Markdown(t *testing.T) {
+	result := &coverage.AnalysisResult{
+		UncoveredByFile:  map[string][]int{},
+		DiffAddedLines:   4,
+		DiffAddedCovered: 4,
+		Suppressed:       map[string][]int{"a.go": {1, 2}},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, (&MarkdownFormatter{}).Format(result, &buf))
+	assert.Equal(t, `All added lines are covered!
+
+### Suppressed Coverage Debt
+
+| File | Suppressed | Expired |
+|------|------------|---------|
+| a.go | 2 | 0 |
+`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, (&MarkdownFormatter{}).Format(suppressedResult(), &buf))
+	assert.Contains(t, buf.String(), "| a.go | 3 | 0 |\n| b.go | 0 | 2 |\n\n2 lines with expired `canopy:ignore` comments are reported as uncovered again.\n")
+}
+
+func TestSuppressions_JSON(t *testing.T) {
+	report := NewJSONReport(suppressedResult())
+	assert.Equal(t, []JSONSuppressedFile{
+		{Path: "a.go", Lines: []int{1, 2, 3}},
+		{Path: "b.go", ExpiredLines: []int{4, 5}},
+	}, report.Suppressed)
+}
@@ -0,0 +1,167 @@
+package format
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+)
+
+// TeamReport aggregates the executable lines added in a range by the
+// author of the commit that last changed them, for tracking testing
+// habits across a team over time. It holds counts only: no files, lines,
+// or commits, so it can't be used to point at individual changes.
+type TeamReport struct {
+	// Since is the start of the range, e.g. a date or a ref
+	Since string `json:"since"`
+	// AddedLines and CoveredLines count the executable lines added in the
+	// range, excluding suppressed lines
+	AddedLines   int `json:"added_lines"`
+	CoveredLines int `json:"covered_lines"`
+	// Authors are sorted by name, then email
+	Authors []TeamAuthor `json:"authors"`
+}
+
+// TeamAuthor holds the added-line counts of an author.
+type TeamAuthor struct {
+	Name  string `json:"name"`
+	Email string `json:"email,omitempty"`
+	// AddedLines counts the author's executable added lines, excluding
+	// suppressed lines
+	AddedLines     int `json:"added_lines"`
+	CoveredLines   int `json:"covered_lines"`
+	UncoveredLines int `json:"uncovered_lines"`
+	// SuppressedLines counts lines excluded with canopy:ignore
+	SuppressedLines int `json:"suppressed_lines"`
+}
+
+// Coverage returns the percentage of the author's added lines covered;
+// 100 if they added none.
+func (a *TeamAuthor) Coverage() float64 {
+	if a.AddedLines == 0 {
+		return 100
+	}
+	return float64(a.CoveredLines) / float64(a.AddedLines) * 100
+}
+
+// Coverage returns the percentage of added lines covered; 100 if no lines
+// were added.
+func (r *TeamReport) Coverage() float64 {
+	if r.AddedLines == 0 {
+		return 100
+	}
+	return float64(r.CoveredLines) / float64(r.AddedLines) * 100
+}
+
+// NewTeamReport builds the TeamReport of an analysis of the lines added in
+// a range. lineCoverage is the coverage of each executable added line (see
+// coverage.LineCoverageByFile), and authorOf returns the author of a line.
+// Authors are told apart by email, case-insensitively; an author with
+// several names is reported under the first one seen.
+func NewTeamReport(since string, result *coverage.AnalysisResult, lineCoverage map[string]map[int]bool, authorOf func(file string, line int) (name, email string)) *TeamReport {
+	report := &TeamReport{Since: since}
+
+	files := make([]string, 0, len(lineCoverage))
+	for file := range lineCoverage {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	authors := make(map[string]*TeamAuthor)
+	for _, file := range files {
+		suppressed := make(map[int]bool, len(result.Suppressed[file]))
+		for _, line := range result.Suppressed[file] {
+			suppressed[line] = true
+		}
+
+		lines := make([]int, 0, len(lineCoverage[file]))
+		for line := range lineCoverage[file] {
+			lines = append(lines, line)
+		}
+		sort.Ints(lines)
+
+		for _, line := range lines {
+			name, email := authorOf(file, line)
+			key := strings.ToLower(email)
+			if key == "" {
+				key = name
+			}
+			author, ok := authors[key]
+			if !ok {
+				author = &TeamAuthor{Name: name, Email: email}
+				authors[key] = author
+			}
+
+			switch {
+			case suppressed[line]:
+				author.SuppressedLines++
+				continue
+			case lineCoverage[file][line]:
+				author.CoveredLines++
+				report.CoveredLines++
+			default:
+				author.UncoveredLines++
+			}
+			author.AddedLines++
+			report.AddedLines++
+		}
+	}
+
+	for _, author := range authors {
+		report.Authors = append(report.Authors, *author)
+	}
+	sort.Slice(report.Authors, func(i, j int) bool {
+		a, b := report.Authors[i], report.Authors[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Email < b.Email
+	})
+	return report
+}
+
+// FormatTeamMarkdown writes a TeamReport as Markdown, with a table row per
+// author.
+func FormatTeamMarkdown(r *TeamReport, w io.Writer) error {
+	fmt.Fprintf(w, "## Test coverage by author since %s\n\n", r.Since)
+	fmt.Fprintf(w, "%d executable lines added by %d authors, %d covered (%.1f%%).\n",
+		r.AddedLines, len(r.Authors), r.CoveredLines, r.Coverage())
+	if len(r.Authors) == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "| Author | Added lines | Covered | Uncovered | Suppressed | Coverage |")
+	fmt.Fprintln(w, "|--------|-------------|---------|-----------|------------|----------|")
+	for _, author := range r.Authors {
+		fmt.Fprintf(w, "| %s | %d | %d | %d | %d | %.1f%% |\n",
+			escapeTableCell(author.Name), author.AddedLines, author.CoveredLines,
+			author.UncoveredLines, author.SuppressedLines, author.Coverage())
+	}
+	return nil
+}
+
+// FormatTeamJSON writes a TeamReport as indented JSON.
+func FormatTeamJSON(r *TeamReport, w io.Writer) error {
+	if r.Authors == nil {
+		// Encode an empty list rather than null
+		empty := *r
+		empty.Authors = []TeamAuthor{}
+		r = &empty
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(r); err != nil {
+		return fmt.Errorf("failed to encode team report: %w", err)
+	}
+	return nil
+}
+
+// escapeTableCell escapes the pipes in text, so it stays in one Markdown
+// table cell.
+func escapeTableCell(text string) string {
+	return strings.ReplaceAll(text, "|", `\|`)
+}
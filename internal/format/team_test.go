@@ -0,0 +1,104 @@
+package format
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+)
+
+func TestNewTeamReport(t *testing.T) {
+	result := &coverage.AnalysisResult{
+		Suppressed: map[string][]int{"api/handler.go": {6}},
+	}
+	lineCoverage := map[string]map[int]bool{
+		"api/handler.go": {2: true, 3: false, 4: false, 6: false},
+		"store/db.go":    {2: true, 3: true},
+	}
+	authors := map[string]map[int][2]string{
+		"api/handler.go": {2: {"Alice", "alice@example.com"}, 3: {"Alice", "alice@example.com"}, 4: {"Bob", "bob@example.com"}, 6: {"Bob", "bob@example.com"}},
+		"store/db.go":    {2: {"Alice Smith", "Alice@Example.com"}, 3: {"Carol", ""}},
+	}
+
+	report := NewTeamReport("2026-07-01", result, lineCoverage, func(file string, line int) (string, string) {
+		a := authors[file][line]
+		return a[0], a[1]
+	})
+
+	assert.Equal(t, "2026-07-01", report.Since)
+	assert.Equal(t, 5, report.AddedLines)
+	assert.Equal(t, 3, report.CoveredLines)
+	assert.Equal(t, []TeamAuthor{
+		{Name: "Alice", Email: "alice@example.com", AddedLines: 3, CoveredLines: 2, UncoveredLines: 1},
+		{Name: "Bob", Email: "bob@example.com", AddedLines: 1, UncoveredLines: 1, SuppressedLines: 1},
+		{Name: "Carol", AddedLines: 1, CoveredLines: 1},
+	}, report.Authors)
+}
+
+func TestFormatTeamMarkdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		report   *TeamReport
+		contains []string
+		excludes []string
+	}{
+		{
+			name: "authors",
+			report: &TeamReport{Since: "2026-07-01", AddedLines: 4, CoveredLines: 3, Authors: []TeamAuthor{
+				{Name: "Alice", Email: "alice@example.com", AddedLines: 3, CoveredLines: 3},
+				{Name: "B|ob", Email: "bob@example.com", AddedLines: 1, UncoveredLines: 1, SuppressedLines: 2},
+			}},
+			contains: []string{
+				"## Test coverage by author since 2026-07-01",
+				"4 executable lines added by 2 authors, 3 covered (75.0%).",
+				"| Alice | 3 | 3 | 0 | 0 | 100.0% |",
+				`| B\|ob | 1 | 0 | 1 | 2 | 0.0% |`,
+			},
+			excludes: []string{"alice@example.com"},
+		},
+		{
+			name:     "no lines added",
+			report:   &TeamReport{Since: "v1.4.0"},
+			contains: []string{"0 executable lines added by 0 authors, 0 covered (100.0%)."},
+			excludes: []string{"| Author |"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, FormatTeamMarkdown(tt.report, &buf))
+			for _, s := range tt.contains {
+				assert.Contains(t, buf.String(), s)
+			}
+			for _, s := range tt.excludes {
+				assert.NotContains(t, buf.String(), s)
+			}
+		})
+	}
+}
+
+func TestFormatTeamJSON(t *testing.T) {
+	t.Run("authors", func(t *testing.T) {
+		report := &TeamReport{Since: "2026-07-01", AddedLines: 1, Authors: []TeamAuthor{
+			{Name: "Bob", Email: "bob@example.com", AddedLines: 1, UncoveredLines: 1},
+		}}
+		var buf bytes.Buffer
+		require.NoError(t, FormatTeamJSON(report, &buf))
+
+		var decoded TeamReport
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+		assert.Equal(t, *report, decoded)
+		assert.Contains(t, buf.String(), `"uncovered_lines": 1`)
+	})
+
+	t.Run("no authors is an empty list", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, FormatTeamJSON(&TeamReport{Since: "v1.4.0"}, &buf))
+		assert.Contains(t, buf.String(), `"authors": []`)
+	})
+}
@@ -0,0 +1,99 @@
+package format
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github"
+)
+
+// teamCityInspectionType identifies uncovered-line inspections in TeamCity.
+const teamCityInspectionType = "canopy.uncovered"
+
+// teamCityEscaper escapes values in TeamCity service messages.
+var teamCityEscaper = strings.NewReplacer(
+	"|", "||",
+	"'", "|'",
+	"\n", "|n",
+	"\r", "|r",
+	"[", "|[",
+	"]", "|]",
+)
+
+// TeamCityFormatter formats analysis results as TeamCity service messages.
+// Diff coverage is reported as build statistics (for charts and build failure
+// conditions) and each block of consecutive uncovered lines as an inspection.
+type TeamCityFormatter struct {
+	// Annotate generates the annotations to report. Defaults to
+	// coverage.GenerateAnnotations, which reports every range as a notice.
+	Annotate func(result *coverage.AnalysisResult) []*github.Annotation
+}
+
+// SetAnnotate implements AnnotationFormatter.
+func (f *TeamCityFormatter) SetAnnotate(annotate func(result *coverage.AnalysisResult) []*github.Annotation) {
+	f.Annotate = annotate
+}
+
+// Format formats the analysis result as TeamCity service messages.
+func (f *TeamCityFormatter) Format(result *coverage.AnalysisResult, w io.Writer) error {
+	if result == nil {
+		return fmt.Errorf("result is nil")
+	}
+
+	coveragePercent := 100.0
+	if result.DiffAddedLines > 0 {
+		coveragePercent = float64(result.DiffAddedCovered) / float64(result.DiffAddedLines) * 100
+	}
+
+	teamCityMessage(w, "buildStatisticValue", "key", "canopy.diffAddedLines", "value", fmt.Sprint(result.DiffAddedLines))
+	teamCityMessage(w, "buildStatisticValue", "key", "canopy.diffCoveredLines", "value", fmt.Sprint(result.DiffAddedCovered))
+	teamCityMessage(w, "buildStatisticValue", "key", "canopy.diffCoverage", "value", fmt.Sprintf("%.2f", coveragePercent))
+
+	if !result.HasUncoveredLines() {
+		return nil
+	}
+
+	teamCityMessage(w, "inspectionType",
+		"id", teamCityInspectionType,
+		"name", "Uncovered added lines",
+		"category", "Coverage",
+		"description", "Lines added in the diff that are not covered by tests")
+
+	for _, annotation := range annotationsFor(f.Annotate, result) {
+		teamCityMessage(w, "inspection",
+			"typeId", teamCityInspectionType,
+			"message", annotation.Message,
+			"file", annotation.Path,
+			"line", fmt.Sprint(annotation.StartLine),
+			"SEVERITY", teamCitySeverity(annotation.Level))
+	}
+
+	return nil
+}
+
+// teamCityMessage writes a service message with escaped attribute values.
+// attrs alternates attribute names and values.
+func teamCityMessage(w io.Writer, name string, attrs ...string) {
+	var b strings.Builder
+	b.WriteString("##teamcity[")
+	b.WriteString(name)
+	for i := 0; i+1 < len(attrs); i += 2 {
+		fmt.Fprintf(&b, " %s='%s'", attrs[i], teamCityEscaper.Replace(attrs[i+1]))
+	}
+	b.WriteString("]")
+	fmt.Fprintln(w, b.String())
+}
+
+// teamCitySeverity maps a Check Run annotation level to a TeamCity inspection severity.
+func teamCitySeverity(level string) string {
+	switch level {
+	case coverage.LevelWarning:
+		return "WARNING"
+	case coverage.LevelFailure:
+		return "ERROR"
+	default:
+		return "INFO"
+	}
+}
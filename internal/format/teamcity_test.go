@@ -0,0 +1,107 @@
+package format
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTeamCityFormatter_Format(t *testing.T) {
+	tests := []struct {
+		name           string
+		result         *coverage.AnalysisResult
+		expectedOutput string
+		expectError    bool
+	}{
+		{
+			name: "uncovered ranges become inspections",
+			result: &coverage.AnalysisResult{
+				UncoveredByFile: map[string][]int{
+					"main.go": {5, 6, 7, 10},
+				},
+				DiffAddedLines:   8,
+				DiffAddedCovered: 4,
+			},
+			expectedOutput: `##teamcity[buildStatisticValue key='canopy.diffAddedLines' value='8']
+##teamcity[buildStatisticValue key='canopy.diffCoveredLines' value='4']
+##teamcity[buildStatisticValue key='canopy.diffCoverage' value='50.00']
+##teamcity[inspectionType id='canopy.uncovered' name='Uncovered added lines' category='Coverage' description='Lines added in the diff that are not covered by tests']
+##teamcity[inspection typeId='canopy.uncovered' message='Lines 5-7 are not covered by tests' file='main.go' line='5' SEVERITY='INFO']
+##teamcity[inspection typeId='canopy.uncovered' message='Line 10 is not covered by tests' file='main.go' line='10' SEVERITY='INFO']
+`,
+		},
+		{
+			name: "all lines covered",
+			result: &coverage.AnalysisResult{
+				UncoveredByFile:  map[string][]int{},
+				DiffAddedLines:   10,
+				DiffAddedCovered: 10,
+			},
+			expectedOutput: `##teamcity[buildStatisticValue key='canopy.diffAddedLines' value='10']
+##teamcity[buildStatisticValue key='canopy.diffCoveredLines' value='10']
+##teamcity[buildStatisticValue key='canopy.diffCoverage' value='100.00']
+`,
+		},
+		{
+			name: "no lines added",
+			result: &coverage.AnalysisResult{
+				UncoveredByFile: map[string][]int{},
+			},
+			expectedOutput: `##teamcity[buildStatisticValue key='canopy.diffAddedLines' value='0']
+##teamcity[buildStatisticValue key='canopy.diffCoveredLines' value='0']
+##teamcity[buildStatisticValue key='canopy.diffCoverage' value='100.00']
+`,
+		},
+		{
+			name:        "nil result",
+			result:      nil,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			formatter := &TeamCityFormatter{}
+			var buf bytes.Buffer
+			err := formatter.Format(tt.result, &buf)
+
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedOutput, buf.String())
+		})
+	}
+}
+
+func TestTeamCityFormatter_Format_LevelsAndEscaping(t *testing.T) {
+	result := &coverage.AnalysisResult{
+		UncoveredByFile: map[string][]int{
+			"it's [odd].go": {1, 5},
+		},
+		DiffAddedLines:   2,
+		DiffAddedCovered: 0,
+	}
+
+	formatter := &TeamCityFormatter{
+		Annotate: func(result *coverage.AnalysisResult) []*github.Annotation {
+			annotations := coverage.GenerateAnnotations(result)
+			annotations[0].Level = coverage.LevelWarning
+			annotations[1].Level = coverage.LevelFailure
+			return annotations
+		},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, formatter.Format(result, &buf))
+
+	output := buf.String()
+	assert.Contains(t, output, `file='it|'s |[odd|].go' line='1' SEVERITY='WARNING'`)
+	assert.Contains(t, output, `line='5' SEVERITY='ERROR'`)
+}
@@ -21,9 +21,13 @@ func (f *TextFormatter) Format(result *coverage.AnalysisResult, w io.Writer) err
 	if !result.HasUncoveredLines() {
 		if result.DiffAddedLines == 0 {
 			fmt.Fprintln(w, "No lines added in diff")
-			return nil
+		} else {
+			fmt.Fprintln(w, "All added lines are covered!")
+		}
+		if added := formatAddedLines(result); added != "" {
+			fmt.Fprintf(w, "Added lines: %s\n", added)
 		}
-		fmt.Fprintln(w, "All added lines are covered!")
+		writeTextSuppressions(result, w)
 		return nil
 	}
 
@@ -50,6 +54,10 @@ func (f *TextFormatter) Format(result *coverage.AnalysisResult, w io.Writer) err
 	fmt.Fprintf(w, "Summary: %d uncovered lines out of %d added lines (%.1f%% coverage)\n",
 		uncoveredCount, result.DiffAddedLines, coveragePercent)
 
+	if added := formatAddedLines(result); added != "" {
+		fmt.Fprintf(w, "Added lines: %s\n", added)
+	}
+	writeTextSuppressions(result, w)
 	return nil
 }
 
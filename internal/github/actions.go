@@ -0,0 +1,133 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// artifactsPerPage is the page size used when listing run artifacts.
+const artifactsPerPage = 100
+
+// maxArtifactSize bounds the size of artifact archives returned by
+// DownloadArtifact.
+const maxArtifactSize = 500 << 20
+
+// WorkflowRun is a GitHub Actions workflow run.
+type WorkflowRun struct {
+	ID         int64     `json:"id"`
+	Name       string    `json:"name"`
+	HeadSHA    string    `json:"head_sha"`
+	HeadBranch string    `json:"head_branch"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	// Path is the workflow file, e.g. .github/workflows/ci.yml
+	Path string `json:"path"`
+	// PullRequests lists the open PRs whose head is the run's commit; it is
+	// empty for runs from forks
+	PullRequests []PullRequestRef `json:"pull_requests"`
+}
+
+// PullRequestRef identifies a pull request associated with a workflow run.
+type PullRequestRef struct {
+	Number int `json:"number"`
+}
+
+// RunArtifact is an artifact uploaded by a workflow run.
+type RunArtifact struct {
+	ID      int64  `json:"id"`
+	Name    string `json:"name"`
+	Expired bool   `json:"expired"`
+	// SizeInBytes is the size of the artifact's zip archive
+	SizeInBytes int64 `json:"size_in_bytes"`
+}
+
+// RepositoryInfo holds the repository details the worker needs.
+type RepositoryInfo struct {
+	DefaultBranch string `json:"default_branch"`
+	HTMLURL       string `json:"html_url"`
+}
+
+// GetRepository returns a repository's default branch and web URL.
+func (c *Client) GetRepository(ctx context.Context, owner, repo string) (*RepositoryInfo, error) {
+	path := fmt.Sprintf("/repos/%s/%s", url.PathEscape(owner), url.PathEscape(repo))
+	var info RepositoryInfo
+	if err := c.doJSON(ctx, http.MethodGet, path, nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// PullRequest holds the pull request details the worker needs.
+type PullRequest struct {
+	Number int `json:"number"`
+	Head   struct {
+		// SHA is the commit the PR's branch currently points at
+		SHA string `json:"sha"`
+	} `json:"head"`
+}
+
+// GetPullRequest returns a pull request.
+func (c *Client) GetPullRequest(ctx context.Context, owner, repo string, number int) (*PullRequest, error) {
+	path := fmt.Sprintf("/repos/%s/%s/pulls/%d", url.PathEscape(owner), url.PathEscape(repo), number)
+	var pr PullRequest
+	if err := c.doJSON(ctx, http.MethodGet, path, nil, &pr); err != nil {
+		return nil, err
+	}
+	return &pr, nil
+}
+
+// GetWorkflowRun returns a workflow run.
+func (c *Client) GetWorkflowRun(ctx context.Context, owner, repo string, runID int64) (*WorkflowRun, error) {
+	path := fmt.Sprintf("/repos/%s/%s/actions/runs/%d", url.PathEscape(owner), url.PathEscape(repo), runID)
+	var run WorkflowRun
+	if err := c.doJSON(ctx, http.MethodGet, path, nil, &run); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// ListRunArtifacts returns all artifacts of a workflow run, including expired ones.
+func (c *Client) ListRunArtifacts(ctx context.Context, owner, repo string, runID int64) ([]RunArtifact, error) {
+	var all []RunArtifact
+	for page := 1; ; page++ {
+		path := fmt.Sprintf("/repos/%s/%s/actions/runs/%d/artifacts?per_page=%d&page=%d",
+			url.PathEscape(owner), url.PathEscape(repo), runID, artifactsPerPage, page)
+		var resp struct {
+			Artifacts []RunArtifact `json:"artifacts"`
+		}
+		if err := c.doJSON(ctx, http.MethodGet, path, nil, &resp); err != nil {
+			return nil, err
+		}
+		all = append(all, resp.Artifacts...)
+		if len(resp.Artifacts) < artifactsPerPage {
+			return all, nil
+		}
+	}
+}
+
+// DownloadArtifact returns the zip archive of an artifact.
+func (c *Client) DownloadArtifact(ctx context.Context, owner, repo string, artifactID int64) ([]byte, error) {
+	var archive bytes.Buffer
+	if _, err := c.DownloadArtifactTo(ctx, owner, repo, artifactID, &archive, maxArtifactSize); err != nil {
+		return nil, err
+	}
+	return archive.Bytes(), nil
+}
+
+// DownloadArtifactTo streams the zip archive of an artifact to w without
+// holding it in memory, and returns its size. Archives larger than limit
+// bytes fail with ErrResponseTooLarge (wrapped) once that much was written.
+func (c *Client) DownloadArtifactTo(ctx context.Context, owner, repo string, artifactID int64, w io.Writer, limit int64) (int64, error) {
+	path := fmt.Sprintf("/repos/%s/%s/actions/artifacts/%d/zip", url.PathEscape(owner), url.PathEscape(repo), artifactID)
+	req, err := c.newRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return 0, err
+	}
+	// The API redirects to blob storage; net/http drops the Authorization
+	// header when following a redirect to another host
+	return c.doTo(req, w, limit)
+}
@@ -0,0 +1,98 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_WorkflowRuns(t *testing.T) {
+	var blobAuth string
+	blob := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		blobAuth = r.Header.Get("Authorization")
+		w.Write([]byte("PK\x03\x04zip"))
+	}))
+	defer blob.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/acme/widgets":
+			w.Write([]byte(`{"default_branch":"main","html_url":"https://github.com/acme/widgets"}`))
+		case "/repos/acme/widgets/pulls/12":
+			w.Write([]byte(`{"number":12,"head":{"sha":"def","ref":"feature"}}`))
+		case "/repos/acme/widgets/actions/runs/7":
+			w.Write([]byte(`{"id":7,"name":"CI","path":".github/workflows/ci.yml","head_sha":"abc","head_branch":"feature","updated_at":"2026-01-02T03:04:05Z","pull_requests":[{"number":12}]}`))
+		case "/repos/acme/widgets/actions/runs/7/artifacts":
+			var artifacts []RunArtifact
+			if r.URL.Query().Get("page") == "1" {
+				for i := 0; i < artifactsPerPage; i++ {
+					artifacts = append(artifacts, RunArtifact{ID: int64(i), Name: fmt.Sprintf("a%d", i)})
+				}
+			} else {
+				artifacts = []RunArtifact{{ID: 500, Name: "coverage", Expired: true}}
+			}
+			json.NewEncoder(w).Encode(map[string]any{"artifacts": artifacts})
+		case "/repos/acme/widgets/actions/artifacts/500/zip":
+			// A different host, as blob storage is
+			http.Redirect(w, r, strings.Replace(blob.URL, "127.0.0.1", "localhost", 1)+"/download", http.StatusFound)
+		default:
+			http.Error(w, `{"message":"Not Found"}`, http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c, err := NewClient(ClientConfig{BaseURL: server.URL, Tokens: StaticToken("t")})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	repo, err := c.GetRepository(ctx, "acme", "widgets")
+	require.NoError(t, err)
+	assert.Equal(t, &RepositoryInfo{DefaultBranch: "main", HTMLURL: "https://github.com/acme/widgets"}, repo)
+
+	pr, err := c.GetPullRequest(ctx, "acme", "widgets", 12)
+	require.NoError(t, err)
+	assert.Equal(t, 12, pr.Number)
+	assert.Equal(t, "def", pr.Head.SHA)
+
+	run, err := c.GetWorkflowRun(ctx, "acme", "widgets", 7)
+	require.NoError(t, err)
+	assert.Equal(t, &WorkflowRun{
+		ID:           7,
+		Name:         "CI",
+		HeadSHA:      "abc",
+		HeadBranch:   "feature",
+		UpdatedAt:    time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Path:         ".github/workflows/ci.yml",
+		PullRequests: []PullRequestRef{{Number: 12}},
+	}, run)
+
+	artifacts, err := c.ListRunArtifacts(ctx, "acme", "widgets", 7)
+	require.NoError(t, err)
+	assert.Len(t, artifacts, artifactsPerPage+1)
+	assert.Equal(t, RunArtifact{ID: 500, Name: "coverage", Expired: true}, artifacts[artifactsPerPage])
+
+	data, err := c.DownloadArtifact(ctx, "acme", "widgets", 500)
+	require.NoError(t, err)
+	assert.Equal(t, "PK\x03\x04zip", string(data))
+	assert.Empty(t, blobAuth, "token must not be sent to blob storage")
+
+	var archive strings.Builder
+	n, err := c.DownloadArtifactTo(ctx, "acme", "widgets", 500, &archive, 7)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), n)
+	assert.Equal(t, "PK\x03\x04zip", archive.String())
+
+	_, err = c.DownloadArtifactTo(ctx, "acme", "widgets", 500, &archive, 6)
+	assert.ErrorIs(t, err, ErrResponseTooLarge)
+
+	_, err = c.GetWorkflowRun(ctx, "acme", "widgets", 8)
+	assert.True(t, IsNotFound(err))
+}
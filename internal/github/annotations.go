@@ -9,13 +9,14 @@ type LineRange struct {
 }
 
 // Annotation represents a GitHub Check Run annotation.
+// Fields are tagged with the Check Run API names.
 type Annotation struct {
-	Path      string
-	StartLine int
-	EndLine   int
-	Level     string // "notice", "warning", "failure"
-	Title     string
-	Message   string
+	Path      string `json:"path"`
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+	Level     string `json:"annotation_level"` // "notice", "warning", "failure"
+	Title     string `json:"title"`
+	Message   string `json:"message"`
 }
 
 // GroupIntoRanges groups consecutive line numbers into ranges.
@@ -0,0 +1,194 @@
+package github
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// appJWTLifetime is how long app JWTs are valid. GitHub allows at most 10 minutes.
+	appJWTLifetime = 9 * time.Minute
+	// appJWTClockSkew backdates the JWT issue time to tolerate clock drift.
+	appJWTClockSkew = time.Minute
+	// installationTokenRefresh is how long before expiry an installation
+	// token is replaced.
+	installationTokenRefresh = 5 * time.Minute
+)
+
+// AppConfig holds the GitHub App credentials used by AppTokenSource.
+type AppConfig struct {
+	// BaseURL is the API endpoint (default: DefaultBaseURL)
+	BaseURL string
+	// HTTPClient is the HTTP client to use (default: 30s timeout)
+	HTTPClient     *http.Client
+	AppID          int64
+	InstallationID int64
+	// PrivateKey is the app's PEM-encoded RSA private key (PKCS#1 or PKCS#8)
+	PrivateKey string
+}
+
+// AppTokenSource is a TokenSource that authenticates as a GitHub App
+// installation. It signs an app JWT with the private key, exchanges it for
+// an installation token, and reuses the token until shortly before it expires.
+type AppTokenSource struct {
+	baseURL        string
+	httpClient     *http.Client
+	appID          int64
+	installationID int64
+	key            *rsa.PrivateKey
+	now            func() time.Time
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// NewAppTokenSource creates an AppTokenSource.
+func NewAppTokenSource(cfg AppConfig) (*AppTokenSource, error) {
+	if cfg.AppID <= 0 {
+		return nil, fmt.Errorf("app ID is required")
+	}
+	if cfg.InstallationID <= 0 {
+		return nil, fmt.Errorf("installation ID is required")
+	}
+	key, err := ParsePrivateKey(cfg.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = DefaultBaseURL
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	return &AppTokenSource{
+		baseURL:        strings.TrimRight(cfg.BaseURL, "/"),
+		httpClient:     cfg.HTTPClient,
+		appID:          cfg.AppID,
+		installationID: cfg.InstallationID,
+		key:            key,
+		now:            time.Now,
+	}, nil
+}
+
+// ParsePrivateKey parses a PEM-encoded RSA private key in PKCS#1 or PKCS#8 form.
+func ParsePrivateKey(data string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("invalid private key: no PEM block found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("invalid private key: not an RSA key")
+	}
+	return key, nil
+}
+
+// Token implements TokenSource.
+func (s *AppTokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if s.token != "" && now.Add(installationTokenRefresh).Before(s.expires) {
+		return s.token, nil
+	}
+
+	token, expires, err := s.installationToken(ctx, now)
+	if err != nil {
+		return "", err
+	}
+	s.token, s.expires = token, expires
+	return token, nil
+}
+
+// installationToken exchanges a freshly signed app JWT for an installation token.
+func (s *AppTokenSource) installationToken(ctx context.Context, now time.Time) (string, time.Time, error) {
+	jwt, err := s.signJWT(now)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	path := fmt.Sprintf("/app/installations/%d/access_tokens", s.installationID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.baseURL+path, nil)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	req.Header.Set("Authorization", "Bearer "+jwt)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("installation token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxJSONSize))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to read installation token response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", time.Time{}, &APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+	}
+
+	var out struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to decode installation token: %w", err)
+	}
+	if out.Token == "" {
+		return "", time.Time{}, errors.New("installation token response has no token")
+	}
+	return out.Token, out.ExpiresAt, nil
+}
+
+// signJWT returns an RS256 JWT identifying the app, as required by the
+// installation token endpoint.
+func (s *AppTokenSource) signJWT(now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]int64{
+		"iat": now.Add(-appJWTClockSkew).Unix(),
+		"exp": now.Add(appJWTLifetime).Unix(),
+		"iss": s.appID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawURLEncoding
+	signingInput := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign app JWT: %w", err)
+	}
+	return signingInput + "." + enc.EncodeToString(sig), nil
+}
@@ -0,0 +1,125 @@
+package github
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func generateKey(t *testing.T) (*rsa.PrivateKey, string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+	return key, string(pem.EncodeToMemory(block))
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	key, pkcs1 := generateKey(t)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	pkcs8 := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+
+	for name, data := range map[string]string{"pkcs1": pkcs1, "pkcs8": pkcs8} {
+		t.Run(name, func(t *testing.T) {
+			parsed, err := ParsePrivateKey(data)
+			require.NoError(t, err)
+			assert.True(t, key.Equal(parsed))
+		})
+	}
+
+	_, err = ParsePrivateKey("not a key")
+	assert.ErrorContains(t, err, "no PEM block")
+}
+
+func TestAppTokenSource(t *testing.T) {
+	key, pemKey := generateKey(t)
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, "POST /app/installations/99/access_tokens", r.Method+" "+r.URL.Path)
+
+		// The JWT must be signed by the app key and identify the app
+		jwt, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		require.True(t, ok)
+		parts := strings.Split(jwt, ".")
+		require.Len(t, parts, 3)
+		sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+		require.NoError(t, err)
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		require.NoError(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], sig))
+		claims, err := base64.RawURLEncoding.DecodeString(parts[1])
+		require.NoError(t, err)
+		var c map[string]int64
+		require.NoError(t, json.Unmarshal(claims, &c))
+		assert.Equal(t, int64(42), c["iss"])
+		assert.Equal(t, now.Add(-time.Minute).Unix(), c["iat"])
+
+		json.NewEncoder(w).Encode(map[string]any{
+			"token":      fmt.Sprintf("ghs_%d", requests),
+			"expires_at": now.Add(time.Hour),
+		})
+	}))
+	defer server.Close()
+
+	s, err := NewAppTokenSource(AppConfig{BaseURL: server.URL, AppID: 42, InstallationID: 99, PrivateKey: pemKey})
+	require.NoError(t, err)
+	s.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	token, err := s.Token(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "ghs_1", token)
+
+	// Reused while valid
+	token, err = s.Token(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "ghs_1", token)
+	assert.Equal(t, 1, requests)
+
+	// Refreshed shortly before expiry
+	now = now.Add(56 * time.Minute)
+	token, err = s.Token(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "ghs_2", token)
+}
+
+func TestAppTokenSource_Errors(t *testing.T) {
+	_, pemKey := generateKey(t)
+
+	_, err := NewAppTokenSource(AppConfig{InstallationID: 1, PrivateKey: pemKey})
+	assert.ErrorContains(t, err, "app ID is required")
+	_, err = NewAppTokenSource(AppConfig{AppID: 1, PrivateKey: pemKey})
+	assert.ErrorContains(t, err, "installation ID is required")
+	_, err = NewAppTokenSource(AppConfig{AppID: 1, InstallationID: 1, PrivateKey: "bad"})
+	assert.ErrorContains(t, err, "invalid private key")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message":"Bad credentials"}`, http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	s, err := NewAppTokenSource(AppConfig{BaseURL: server.URL, AppID: 1, InstallationID: 1, PrivateKey: pemKey})
+	require.NoError(t, err)
+	_, err = s.Token(context.Background())
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+}
@@ -0,0 +1,249 @@
+// Package artifacts selects and downloads the coverage artifacts of GitHub
+// Actions workflow runs, spooling archives too large to hold in memory to
+// temporary files.
+package artifacts
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/metrics"
+)
+
+const (
+	// DefaultMaxSize bounds the size of artifact archives unless configured.
+	DefaultMaxSize = 500 << 20
+	// DefaultSpoolThreshold is the listed size above which archives are
+	// spooled to a temporary file unless configured.
+	DefaultSpoolThreshold = 64 << 20
+	// downloadAttempts is how often a download failing with a transient
+	// error is attempted.
+	downloadAttempts = 3
+)
+
+// DefaultPatterns match the coverage artifacts downloaded unless configured.
+var DefaultPatterns = []string{"coverage*"}
+
+// retryDelay is the first pause before retrying a failed download; it
+// doubles per attempt.
+var retryDelay = time.Second
+
+// downloadBytes counts the bytes of artifact archives downloaded, including
+// those of failed attempts.
+var downloadBytes = metrics.Default.NewCounter("canopy_artifact_download_bytes_total",
+	"Bytes of artifact archives downloaded.")
+
+// API is the subset of the GitHub API used to fetch artifacts.
+type API interface {
+	ListRunArtifacts(ctx context.Context, owner, repo string, runID int64) ([]github.RunArtifact, error)
+	DownloadArtifactTo(ctx context.Context, owner, repo string, artifactID int64, w io.Writer, limit int64) (int64, error)
+}
+
+// ParsePatterns parses comma-separated artifact name patterns in path.Match
+// syntax, such as "coverage*,*-cover". Empty returns DefaultPatterns.
+func ParsePatterns(s string) ([]string, error) {
+	var patterns []string
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid artifact pattern %q: %w", p, err)
+		}
+		patterns = append(patterns, p)
+	}
+	if len(patterns) == 0 {
+		return DefaultPatterns, nil
+	}
+	return patterns, nil
+}
+
+// Match returns true if name matches any of patterns, or DefaultPatterns if
+// patterns is empty.
+func Match(patterns []string, name string) bool {
+	if len(patterns) == 0 {
+		patterns = DefaultPatterns
+	}
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Select returns the listed artifacts matching patterns (see Match) that
+// haven't expired, and how many matching artifacts have.
+func Select(listed []github.RunArtifact, patterns []string) ([]github.RunArtifact, int) {
+	var selected []github.RunArtifact
+	expired := 0
+	for _, a := range listed {
+		switch {
+		case !Match(patterns, a.Name):
+		case a.Expired:
+			expired++
+		default:
+			selected = append(selected, a)
+		}
+	}
+	return selected, expired
+}
+
+// Downloader downloads artifact archives, retrying transient failures
+// (server errors and dropped connections). Archives listed larger than
+// SpoolThreshold are streamed to a temporary file instead of memory, so
+// artifacts larger than the memory available can still be parsed.
+type Downloader struct {
+	API API
+	// MaxSize bounds the size of archives; zero uses DefaultMaxSize
+	MaxSize int64
+	// SpoolThreshold is the listed size above which archives are spooled;
+	// zero uses DefaultSpoolThreshold, negative never spools
+	SpoolThreshold int64
+	// TempDir holds spooled archives; empty uses os.TempDir
+	TempDir string
+}
+
+// Spools returns true if the archive of a is spooled to a temporary file.
+func (d *Downloader) Spools(a github.RunArtifact) bool {
+	threshold := d.SpoolThreshold
+	if threshold == 0 {
+		threshold = DefaultSpoolThreshold
+	}
+	return threshold > 0 && a.SizeInBytes > threshold
+}
+
+// Download downloads the archive of an artifact. The caller must Close the
+// returned File.
+func (d *Downloader) Download(ctx context.Context, owner, repo string, a github.RunArtifact) (*File, error) {
+	limit := d.MaxSize
+	if limit <= 0 {
+		limit = DefaultMaxSize
+	}
+	if a.SizeInBytes > limit {
+		return nil, fmt.Errorf("%w: artifact %s is %d bytes, limit is %d", github.ErrResponseTooLarge, a.Name, a.SizeInBytes, limit)
+	}
+
+	f := &File{Name: a.Name}
+	if d.Spools(a) {
+		spool, err := os.CreateTemp(d.TempDir, "canopy-artifact-*.zip")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create spool file: %w", err)
+		}
+		f.file = spool
+	}
+
+	for attempt := 1; ; attempt++ {
+		var archive bytes.Buffer
+		w := io.Writer(&archive)
+		if f.file != nil {
+			if err := rewind(f.file); err != nil {
+				f.Close()
+				return nil, err
+			}
+			w = f.file
+		}
+
+		n, err := d.API.DownloadArtifactTo(ctx, owner, repo, a.ID, w, limit)
+		downloadBytes.Add(float64(n))
+		if err == nil {
+			f.Size = n
+			if f.file == nil {
+				f.data = archive.Bytes()
+			}
+			return f, nil
+		}
+		if !transient(err) || attempt == downloadAttempts {
+			f.Close()
+			return nil, err
+		}
+
+		select {
+		case <-time.After(retryDelay << (attempt - 1)):
+		case <-ctx.Done():
+			f.Close()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// rewind empties a spool file before a download is retried.
+func rewind(f *os.File) error {
+	if err := f.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate spool file: %w", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind spool file: %w", err)
+	}
+	return nil
+}
+
+// transient returns true if a download failing with err may succeed when
+// retried: server errors and network failures, but not client errors,
+// oversized archives, or cancellation. Rate limits are already retried by
+// the client.
+func transient(err error) bool {
+	var apiErr *github.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= 500
+	}
+	return !errors.Is(err, github.ErrResponseTooLarge) &&
+		!errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+// File is a downloaded artifact archive, held in memory or spooled to a
+// temporary file.
+type File struct {
+	Name string
+	// Size is the size of the archive in bytes
+	Size int64
+
+	data []byte
+	file *os.File
+}
+
+// Spooled returns true if the archive is held in a temporary file.
+func (f *File) Spooled() bool {
+	return f.file != nil
+}
+
+// Bytes returns the archive if it is held in memory, or nil if it is spooled.
+func (f *File) Bytes() []byte {
+	return f.data
+}
+
+// ReadAt implements io.ReaderAt.
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	if f.file != nil {
+		return f.file.ReadAt(p, off)
+	}
+	return bytes.NewReader(f.data).ReadAt(p, off)
+}
+
+// Profiles parses the coverage files of the archive, each of which may
+// decompress to at most limit bytes; negative is unlimited. It also returns
+// the files it skipped (see coverage.ParseProfilesFromZipReader).
+func (f *File) Profiles(limit int64) ([]*coverage.Profile, []coverage.SkippedFile, error) {
+	return coverage.ParseProfilesFromZipReader(f, f.Size, limit)
+}
+
+// Close removes a spooled archive; it is a no-op for archives in memory.
+func (f *File) Close() error {
+	if f == nil || f.file == nil {
+		return nil
+	}
+	name := f.file.Name()
+	f.file.Close()
+	f.file = nil
+	return os.Remove(name)
+}
@@ -0,0 +1,170 @@
+package artifacts
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	retryDelay = 0
+}
+
+// fakeAPI serves one archive, failing the first downloads with errs.
+type fakeAPI struct {
+	archive   []byte
+	errs      []error
+	downloads int
+}
+
+func (f *fakeAPI) ListRunArtifacts(ctx context.Context, owner, repo string, runID int64) ([]github.RunArtifact, error) {
+	return nil, nil
+}
+
+func (f *fakeAPI) DownloadArtifactTo(ctx context.Context, owner, repo string, artifactID int64, w io.Writer, limit int64) (int64, error) {
+	f.downloads++
+	if len(f.errs) > 0 {
+		err := f.errs[0]
+		f.errs = f.errs[1:]
+		// Failed downloads may have written part of the archive
+		w.Write(f.archive[:len(f.archive)/2])
+		return 0, err
+	}
+	if int64(len(f.archive)) > limit {
+		return 0, github.ErrResponseTooLarge
+	}
+	n, err := w.Write(f.archive)
+	return int64(n), err
+}
+
+func coverageArchive(t *testing.T) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("coverage.out")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("mode: set\nexample.com/pkg/a.go:1.1,2.2 1 1\n"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func TestParsePatterns(t *testing.T) {
+	tests := []struct {
+		name          string
+		input         string
+		expected      []string
+		expectedError string
+	}{
+		{name: "empty", input: "", expected: DefaultPatterns},
+		{name: "single", input: "cover-*", expected: []string{"cover-*"}},
+		{name: "list", input: " coverage*, *-cover ,", expected: []string{"coverage*", "*-cover"}},
+		{name: "invalid", input: "coverage[", expectedError: `invalid artifact pattern "coverage["`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patterns, err := ParsePatterns(tt.input)
+			if tt.expectedError != "" {
+				assert.ErrorContains(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, patterns)
+		})
+	}
+}
+
+func TestSelect(t *testing.T) {
+	listed := []github.RunArtifact{
+		{ID: 1, Name: "coverage-unit"},
+		{ID: 2, Name: "logs"},
+		{ID: 3, Name: "coverage-old", Expired: true},
+		{ID: 4, Name: "integration-cover"},
+	}
+
+	selected, expired := Select(listed, nil)
+	assert.Equal(t, []github.RunArtifact{listed[0]}, selected)
+	assert.Equal(t, 1, expired)
+
+	selected, expired = Select(listed, []string{"*-cover", "logs"})
+	assert.Equal(t, []github.RunArtifact{listed[1], listed[3]}, selected)
+	assert.Zero(t, expired)
+}
+
+func TestDownloader_Download(t *testing.T) {
+	archive := coverageArchive(t)
+	artifact := github.RunArtifact{ID: 1, Name: "coverage", SizeInBytes: int64(len(archive))}
+	serverError := &github.APIError{StatusCode: 502, Message: "Bad Gateway"}
+
+	tests := []struct {
+		name              string
+		errs              []error
+		spoolThreshold    int64
+		expectedSpooled   bool
+		expectedDownloads int
+		expectedError     error
+	}{
+		{name: "in memory", spoolThreshold: -1, expectedDownloads: 1},
+		{name: "spooled", spoolThreshold: 1, expectedSpooled: true, expectedDownloads: 1},
+		{name: "server errors are retried", errs: []error{serverError, errors.New("connection reset")}, expectedDownloads: 3},
+		{name: "spooled retries start over", errs: []error{serverError}, spoolThreshold: 1, expectedSpooled: true, expectedDownloads: 2},
+		{name: "retries give up", errs: []error{serverError, serverError, serverError}, expectedDownloads: 3, expectedError: serverError},
+		{name: "client errors are not retried", errs: []error{&github.APIError{StatusCode: 404}}, expectedDownloads: 1, expectedError: &github.APIError{StatusCode: 404}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &fakeAPI{archive: archive, errs: tt.errs}
+			d := &Downloader{API: api, SpoolThreshold: tt.spoolThreshold, TempDir: t.TempDir()}
+			f, err := d.Download(context.Background(), "acme", "widgets", artifact)
+			assert.Equal(t, tt.expectedDownloads, api.downloads)
+			if tt.expectedError != nil {
+				assert.Equal(t, tt.expectedError, err)
+				assertNoSpoolFiles(t, d.TempDir)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedSpooled, f.Spooled())
+			assert.Equal(t, int64(len(archive)), f.Size)
+
+			profiles, skipped, err := f.Profiles(-1)
+			require.NoError(t, err)
+			assert.Empty(t, skipped)
+			require.Len(t, profiles, 1)
+			assert.Equal(t, "example.com/pkg/a.go", profiles[0].FileName)
+
+			require.NoError(t, f.Close())
+			assertNoSpoolFiles(t, d.TempDir)
+		})
+	}
+}
+
+func TestDownloader_MaxSize(t *testing.T) {
+	archive := coverageArchive(t)
+	api := &fakeAPI{archive: archive}
+	d := &Downloader{API: api, MaxSize: int64(len(archive)) - 1, SpoolThreshold: 1, TempDir: t.TempDir()}
+
+	// Listed sizes over the limit aren't downloaded
+	_, err := d.Download(context.Background(), "acme", "widgets", github.RunArtifact{ID: 1, Name: "coverage", SizeInBytes: 1 << 30})
+	assert.ErrorIs(t, err, github.ErrResponseTooLarge)
+	assert.Zero(t, api.downloads)
+
+	// Nor are archives larger than listed retried
+	_, err = d.Download(context.Background(), "acme", "widgets", github.RunArtifact{ID: 1, Name: "coverage", SizeInBytes: 2})
+	assert.ErrorIs(t, err, github.ErrResponseTooLarge)
+	assert.Equal(t, 1, api.downloads)
+	assertNoSpoolFiles(t, d.TempDir)
+}
+
+func assertNoSpoolFiles(t *testing.T, dir string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
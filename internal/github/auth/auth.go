@@ -0,0 +1,99 @@
+// Package auth authenticates API requests as whichever installation of the
+// GitHub App they are made for, so a single client can serve every
+// organization the app is installed in.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github"
+)
+
+// ErrNoInstallation is returned when a request names no installation and
+// there is no default installation.
+var ErrNoInstallation = errors.New("no GitHub App installation for request")
+
+// installationKey is the context key of an installation ID.
+type installationKey struct{}
+
+// WithInstallation returns a context whose API requests authenticate as the
+// given installation. Zero leaves the Installations default in effect.
+func WithInstallation(ctx context.Context, installationID int64) context.Context {
+	if installationID <= 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, installationKey{}, installationID)
+}
+
+// InstallationID returns the installation of a context (see
+// WithInstallation), or zero if it has none.
+func InstallationID(ctx context.Context) int64 {
+	id, _ := ctx.Value(installationKey{}).(int64)
+	return id
+}
+
+// Installations is a github.TokenSource for every installation of a GitHub
+// App. Each request is authenticated as the installation of its context,
+// or the default installation if the context has none. Installations get
+// their own github.AppTokenSource on first use, which mints installation
+// tokens on demand and reuses them until shortly before they expire.
+type Installations struct {
+	cfg github.AppConfig
+
+	mu      sync.Mutex
+	sources map[int64]*github.AppTokenSource
+}
+
+// NewInstallations creates an Installations for the app in cfg. The private
+// key is checked up front; cfg.InstallationID is the default installation,
+// or zero if every request must name its installation.
+func NewInstallations(cfg github.AppConfig) (*Installations, error) {
+	if cfg.AppID <= 0 {
+		return nil, fmt.Errorf("app ID is required")
+	}
+	if cfg.InstallationID < 0 {
+		return nil, fmt.Errorf("invalid default installation ID %d", cfg.InstallationID)
+	}
+	if _, err := github.ParsePrivateKey(cfg.PrivateKey); err != nil {
+		return nil, err
+	}
+	return &Installations{cfg: cfg, sources: make(map[int64]*github.AppTokenSource)}, nil
+}
+
+// Token implements github.TokenSource.
+func (i *Installations) Token(ctx context.Context) (string, error) {
+	id := InstallationID(ctx)
+	if id == 0 {
+		id = i.cfg.InstallationID
+	}
+	if id == 0 {
+		return "", ErrNoInstallation
+	}
+	source, err := i.Source(id)
+	if err != nil {
+		return "", err
+	}
+	return source.Token(ctx)
+}
+
+// Source returns the token source of an installation, creating it on first
+// use.
+func (i *Installations) Source(installationID int64) (*github.AppTokenSource, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if source, ok := i.sources[installationID]; ok {
+		return source, nil
+	}
+
+	cfg := i.cfg
+	cfg.InstallationID = installationID
+	source, err := github.NewAppTokenSource(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to authenticate installation %d: %w", installationID, err)
+	}
+	i.sources[installationID] = source
+	return source, nil
+}
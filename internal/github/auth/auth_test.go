@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pemKey returns a PEM-encoded RSA key.
+func pemKey(t *testing.T) string {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+}
+
+// tokenServer mints tokens named after the installation they are for,
+// counting the tokens minted per installation.
+func tokenServer(t *testing.T) (*httptest.Server, map[string]int) {
+	t.Helper()
+	var mu sync.Mutex
+	minted := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/app/installations/"), "/access_tokens")
+		require.True(t, ok, r.URL.Path)
+		mu.Lock()
+		minted[id]++
+		mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]any{
+			"token":      "ghs_" + id,
+			"expires_at": time.Now().Add(time.Hour),
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server, minted
+}
+
+func TestInstallations(t *testing.T) {
+	server, minted := tokenServer(t)
+	key := pemKey(t)
+
+	tests := []struct {
+		name          string
+		defaultID     int64
+		installation  int64
+		expectedToken string
+		expectedErr   error
+	}{
+		{name: "installation of request", defaultID: 1, installation: 7, expectedToken: "ghs_7"},
+		{name: "default installation", defaultID: 1, expectedToken: "ghs_1"},
+		{name: "no default", installation: 7, expectedToken: "ghs_7"},
+		{name: "no installation", expectedErr: ErrNoInstallation},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i, err := NewInstallations(github.AppConfig{BaseURL: server.URL, AppID: 42, InstallationID: tt.defaultID, PrivateKey: key})
+			require.NoError(t, err)
+
+			token, err := i.Token(WithInstallation(context.Background(), tt.installation))
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedToken, token)
+		})
+	}
+
+	t.Run("tokens are cached per installation", func(t *testing.T) {
+		clear(minted)
+		i, err := NewInstallations(github.AppConfig{BaseURL: server.URL, AppID: 42, PrivateKey: key})
+		require.NoError(t, err)
+
+		var wg sync.WaitGroup
+		for n := range 20 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				id := int64(100 + n%2)
+				token, err := i.Token(WithInstallation(context.Background(), id))
+				assert.NoError(t, err)
+				assert.Equal(t, fmt.Sprintf("ghs_%d", id), token)
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, map[string]int{"100": 1, "101": 1}, minted)
+	})
+}
+
+func TestNewInstallations_Errors(t *testing.T) {
+	key := pemKey(t)
+
+	_, err := NewInstallations(github.AppConfig{PrivateKey: key})
+	assert.ErrorContains(t, err, "app ID is required")
+	_, err = NewInstallations(github.AppConfig{AppID: 1, InstallationID: -1, PrivateKey: key})
+	assert.ErrorContains(t, err, "invalid default installation ID")
+	_, err = NewInstallations(github.AppConfig{AppID: 1, PrivateKey: "bad"})
+	assert.ErrorContains(t, err, "invalid private key")
+}
+
+func TestWithInstallation(t *testing.T) {
+	ctx := context.Background()
+	assert.Zero(t, InstallationID(ctx))
+	assert.Equal(t, int64(7), InstallationID(WithInstallation(ctx, 7)))
+	// Zero keeps the installation of the parent context
+	assert.Equal(t, int64(7), InstallationID(WithInstallation(WithInstallation(ctx, 7), 0)))
+}
@@ -0,0 +1,254 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// MaxAnnotationsPerRequest is the most annotations the Check Runs API
+// accepts in a single create or update request.
+const MaxAnnotationsPerRequest = 50
+
+// MaxOutputLength is the most characters the Check Runs API accepts in the
+// summary or text of a check run's output.
+const MaxOutputLength = 65535
+
+// annotationBatchAttempts is how often an annotation batch is sent before
+// CreateCheckRun gives up on it.
+const annotationBatchAttempts = 3
+
+// annotationRetryDelay is the pause before failed batches are retried.
+var annotationRetryDelay = time.Second
+
+// commentsPerPage is the page size used when listing issue comments.
+const commentsPerPage = 100
+
+// Check run statuses.
+const (
+	CheckRunCompleted  = "completed"
+	CheckRunInProgress = "in_progress"
+)
+
+// CheckRunInfo is a published check run.
+type CheckRunInfo struct {
+	ID      int64  `json:"id"`
+	Name    string `json:"name"`
+	HeadSHA string `json:"head_sha"`
+	// ExternalID is the CheckRun.ExternalID it was published with
+	ExternalID string `json:"external_id"`
+}
+
+// CheckRun is a check run to publish on a commit.
+type CheckRun struct {
+	Name    string
+	HeadSHA string
+	// Status is CheckRunCompleted or CheckRunInProgress; empty is completed
+	Status string
+	// Conclusion is the result of a completed check run
+	Conclusion string
+	Title      string
+	Summary    string
+	// Text, if set, is shown below the summary, e.g. a detailed report
+	Text        string
+	Annotations []*Annotation
+	// ExternalID, if set, is stored with the check run for integrators, e.g.
+	// the correlation ID of the processing that published it
+	ExternalID string
+	// Progress, if set, is called after each annotation batch is uploaded
+	// with the number of annotations uploaded so far
+	Progress func(uploaded, total int)
+}
+
+// PartialUploadError is returned by CreateCheckRun when the check run was
+// created but some annotation batches still failed after retries. The
+// check run's summary then notes how many annotations were uploaded.
+type PartialUploadError struct {
+	Uploaded int
+	Total    int
+	// FailedBatches are the 1-based numbers of the batches that failed
+	FailedBatches []int
+	// Err is the error of the last failed attempt
+	Err error
+}
+
+func (e *PartialUploadError) Error() string {
+	return fmt.Sprintf("uploaded %d of %d annotations (batches %v failed): %v", e.Uploaded, e.Total, e.FailedBatches, e.Err)
+}
+
+func (e *PartialUploadError) Unwrap() error {
+	return e.Err
+}
+
+// IssueComment is a comment on an issue or pull request.
+type IssueComment struct {
+	ID   int64  `json:"id"`
+	Body string `json:"body"`
+}
+
+type checkRunOutput struct {
+	Title       string        `json:"title"`
+	Summary     string        `json:"summary"`
+	Text        string        `json:"text,omitempty"`
+	Annotations []*Annotation `json:"annotations,omitempty"`
+}
+
+// CreateCheckRun creates a check run, completed unless its Status says
+// otherwise, and returns its ID.
+// Annotations beyond MaxAnnotationsPerRequest are added by updating the
+// check run in batches, as the API requires. Batches that fail are retried
+// after the others; if some still fail, the summary is amended with how many
+// annotations were uploaded and a *PartialUploadError is returned along
+// with the ID.
+func (c *Client) CreateCheckRun(ctx context.Context, owner, repo string, run *CheckRun) (int64, error) {
+	batches := batchAnnotations(run.Annotations)
+	output := checkRunOutput{Title: run.Title, Summary: run.Summary, Text: run.Text}
+	if len(batches) > 0 {
+		output.Annotations = batches[0]
+	}
+
+	body := map[string]any{
+		"name":     run.Name,
+		"head_sha": run.HeadSHA,
+		"status":   CheckRunCompleted,
+		"output":   output,
+	}
+	if run.ExternalID != "" {
+		body["external_id"] = run.ExternalID
+	}
+	if run.Status != "" && run.Status != CheckRunCompleted {
+		body["status"] = run.Status
+	} else {
+		body["conclusion"] = run.Conclusion
+	}
+	path := fmt.Sprintf("/repos/%s/%s/check-runs", url.PathEscape(owner), url.PathEscape(repo))
+	var created struct {
+		ID int64 `json:"id"`
+	}
+	if err := c.doJSON(ctx, http.MethodPost, path, body, &created); err != nil {
+		return 0, err
+	}
+	if len(batches) <= 1 {
+		return created.ID, nil
+	}
+
+	total, uploaded := len(run.Annotations), len(batches[0])
+	progress := func() {
+		if run.Progress != nil {
+			run.Progress(uploaded, total)
+		}
+	}
+	progress()
+
+	path = fmt.Sprintf("/repos/%s/%s/check-runs/%d", url.PathEscape(owner), url.PathEscape(repo), created.ID)
+	pending := make([]int, 0, len(batches)-1)
+	for i := 1; i < len(batches); i++ {
+		pending = append(pending, i)
+	}
+	var lastErr error
+	for attempt := 1; attempt <= annotationBatchAttempts && len(pending) > 0; attempt++ {
+		if attempt > 1 {
+			if err := sleep(ctx, annotationRetryDelay); err != nil {
+				lastErr = err
+				break
+			}
+		}
+		var failed []int
+		for _, i := range pending {
+			output := checkRunOutput{Title: run.Title, Summary: run.Summary, Text: run.Text, Annotations: batches[i]}
+			if err := c.doJSON(ctx, http.MethodPatch, path, map[string]any{"output": output}, nil); err != nil {
+				failed, lastErr = append(failed, i), err
+				continue
+			}
+			uploaded += len(batches[i])
+			progress()
+		}
+		pending = failed
+	}
+	if len(pending) == 0 {
+		return created.ID, nil
+	}
+
+	partial := &PartialUploadError{Uploaded: uploaded, Total: total, Err: lastErr}
+	for _, i := range pending {
+		partial.FailedBatches = append(partial.FailedBatches, i+1)
+	}
+	// Omitting annotations keeps those already uploaded
+	note := checkRunOutput{
+		Title:   run.Title,
+		Summary: run.Summary + fmt.Sprintf("\n\n**Note:** %d of %d annotations uploaded; the rest failed to upload.\n", uploaded, total),
+		Text:    run.Text,
+	}
+	if err := c.doJSON(ctx, http.MethodPatch, path, map[string]any{"output": note}, nil); err != nil {
+		partial.Err = fmt.Errorf("%w (and failed to note the partial upload: %v)", lastErr, err)
+	}
+	return created.ID, partial
+}
+
+// ListCheckSuiteRuns returns the latest check runs named name in a check
+// suite, newest first.
+func (c *Client) ListCheckSuiteRuns(ctx context.Context, owner, repo string, suiteID int64, name string) ([]CheckRunInfo, error) {
+	path := fmt.Sprintf("/repos/%s/%s/check-suites/%d/check-runs?check_name=%s&filter=latest&per_page=%d",
+		url.PathEscape(owner), url.PathEscape(repo), suiteID, url.QueryEscape(name), commentsPerPage)
+	var list struct {
+		CheckRuns []CheckRunInfo `json:"check_runs"`
+	}
+	if err := c.doJSON(ctx, http.MethodGet, path, nil, &list); err != nil {
+		return nil, err
+	}
+	return list.CheckRuns, nil
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// batchAnnotations splits annotations into batches of MaxAnnotationsPerRequest.
+func batchAnnotations(annotations []*Annotation) [][]*Annotation {
+	var batches [][]*Annotation
+	for len(annotations) > 0 {
+		n := min(len(annotations), MaxAnnotationsPerRequest)
+		batches = append(batches, annotations[:n])
+		annotations = annotations[n:]
+	}
+	return batches
+}
+
+// ListIssueComments returns all comments on an issue or pull request.
+func (c *Client) ListIssueComments(ctx context.Context, owner, repo string, number int) ([]IssueComment, error) {
+	var all []IssueComment
+	for page := 1; ; page++ {
+		path := fmt.Sprintf("/repos/%s/%s/issues/%d/comments?per_page=%d&page=%d",
+			url.PathEscape(owner), url.PathEscape(repo), number, commentsPerPage, page)
+		var comments []IssueComment
+		if err := c.doJSON(ctx, http.MethodGet, path, nil, &comments); err != nil {
+			return nil, err
+		}
+		all = append(all, comments...)
+		if len(comments) < commentsPerPage {
+			return all, nil
+		}
+	}
+}
+
+// CreateIssueComment posts a comment on an issue or pull request.
+func (c *Client) CreateIssueComment(ctx context.Context, owner, repo string, number int, body string) error {
+	path := fmt.Sprintf("/repos/%s/%s/issues/%d/comments", url.PathEscape(owner), url.PathEscape(repo), number)
+	return c.doJSON(ctx, http.MethodPost, path, map[string]string{"body": body}, nil)
+}
+
+// UpdateIssueComment replaces the body of an existing comment.
+func (c *Client) UpdateIssueComment(ctx context.Context, owner, repo string, commentID int64, body string) error {
+	path := fmt.Sprintf("/repos/%s/%s/issues/comments/%d", url.PathEscape(owner), url.PathEscape(repo), commentID)
+	return c.doJSON(ctx, http.MethodPatch, path, map[string]string{"body": body}, nil)
+}
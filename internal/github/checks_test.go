@@ -0,0 +1,250 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_CreateCheckRun(t *testing.T) {
+	tests := []struct {
+		name            string
+		annotations     int
+		expectedBatches []int
+	}{
+		{name: "no annotations", annotations: 0, expectedBatches: []int{0}},
+		{name: "single batch", annotations: 50, expectedBatches: []int{50}},
+		{name: "multiple batches", annotations: 120, expectedBatches: []int{50, 50, 20}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []string
+			var batches []int
+			var created map[string]any
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests = append(requests, r.Method+" "+r.URL.Path)
+				var body map[string]any
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+				if created == nil {
+					created = body
+				}
+				output := body["output"].(map[string]any)
+				assert.Equal(t, "Coverage 80.00%", output["title"])
+				annotations, _ := output["annotations"].([]any)
+				batches = append(batches, len(annotations))
+				w.Write([]byte(`{"id":55}`))
+			}))
+			defer server.Close()
+
+			c, err := NewClient(ClientConfig{BaseURL: server.URL, Tokens: StaticToken("t")})
+			require.NoError(t, err)
+
+			run := &CheckRun{Name: "Canopy Coverage", HeadSHA: "abc", Conclusion: "success", Title: "Coverage 80.00%", Summary: "ok", ExternalID: "72d3162e"}
+			for i := 0; i < tt.annotations; i++ {
+				run.Annotations = append(run.Annotations, &Annotation{Path: "a.go", StartLine: i + 1, EndLine: i + 1, Level: "notice"})
+			}
+
+			id, err := c.CreateCheckRun(context.Background(), "acme", "widgets", run)
+			require.NoError(t, err)
+			assert.Equal(t, int64(55), id)
+			assert.Equal(t, tt.expectedBatches, batches)
+			assert.Equal(t, "POST /repos/acme/widgets/check-runs", requests[0])
+			for _, r := range requests[1:] {
+				assert.Equal(t, "PATCH /repos/acme/widgets/check-runs/55", r)
+			}
+			assert.Equal(t, "completed", created["status"])
+			assert.Equal(t, "success", created["conclusion"])
+			assert.Equal(t, "abc", created["head_sha"])
+			assert.Equal(t, "72d3162e", created["external_id"])
+		})
+	}
+}
+
+func TestClient_CreateCheckRun_InProgress(t *testing.T) {
+	var created map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&created))
+		w.Write([]byte(`{"id":56}`))
+	}))
+	defer server.Close()
+
+	c, err := NewClient(ClientConfig{BaseURL: server.URL, Tokens: StaticToken("t")})
+	require.NoError(t, err)
+
+	_, err = c.CreateCheckRun(context.Background(), "acme", "widgets", &CheckRun{Name: "Canopy Coverage", HeadSHA: "abc", Status: CheckRunInProgress, Title: "Waiting", Summary: "..."})
+	require.NoError(t, err)
+	assert.Equal(t, "in_progress", created["status"])
+	assert.NotContains(t, created, "conclusion")
+}
+
+func TestClient_CreateCheckRun_Text(t *testing.T) {
+	var created map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&created))
+		w.Write([]byte(`{"id":57}`))
+	}))
+	defer server.Close()
+
+	c, err := NewClient(ClientConfig{BaseURL: server.URL, Tokens: StaticToken("t")})
+	require.NoError(t, err)
+
+	_, err = c.CreateCheckRun(context.Background(), "acme", "widgets", &CheckRun{Name: "Canopy Coverage", HeadSHA: "abc", Title: "Coverage", Summary: "...", Text: "## Details"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"title": "Coverage", "summary": "...", "text": "## Details"}, created["output"])
+
+	_, err = c.CreateCheckRun(context.Background(), "acme", "widgets", &CheckRun{Name: "Canopy Coverage", HeadSHA: "abc", Title: "Coverage", Summary: "..."})
+	require.NoError(t, err)
+	assert.NotContains(t, created["output"], "text")
+}
+
+func TestClient_CreateCheckRun_FailedBatches(t *testing.T) {
+	defer func(d time.Duration) { annotationRetryDelay = d }(annotationRetryDelay)
+	annotationRetryDelay = 0
+
+	tests := []struct {
+		name             string
+		failures         int // Failed attempts of the second batch
+		expectedAttempts int
+		expectedProgress []int
+		expectedErr      *PartialUploadError
+		expectedNote     string
+	}{
+		{
+			name:             "retried batch lands",
+			failures:         1,
+			expectedAttempts: 2,
+			expectedProgress: []int{50, 70, 120},
+		},
+		{
+			name:             "batch keeps failing",
+			failures:         annotationBatchAttempts,
+			expectedAttempts: annotationBatchAttempts,
+			expectedProgress: []int{50, 70},
+			expectedErr:      &PartialUploadError{Uploaded: 70, Total: 120, FailedBatches: []int{2}},
+			expectedNote:     "ok\n\n**Note:** 70 of 120 annotations uploaded; the rest failed to upload.\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			var note string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body struct {
+					Output checkRunOutput `json:"output"`
+				}
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+				switch {
+				case r.Method == http.MethodPost:
+				case len(body.Output.Annotations) == 0:
+					note = body.Output.Summary
+				case body.Output.Annotations[0].StartLine == 51:
+					attempts++
+					if attempts <= tt.failures {
+						http.Error(w, `{"message":"Server Error"}`, http.StatusBadGateway)
+						return
+					}
+				}
+				w.Write([]byte(`{"id":55}`))
+			}))
+			defer server.Close()
+
+			c, err := NewClient(ClientConfig{BaseURL: server.URL, Tokens: StaticToken("t")})
+			require.NoError(t, err)
+
+			var progress []int
+			run := &CheckRun{Name: "Canopy Coverage", HeadSHA: "abc", Conclusion: "success", Title: "Coverage 80.00%", Summary: "ok",
+				Progress: func(uploaded, total int) {
+					assert.Equal(t, 120, total)
+					progress = append(progress, uploaded)
+				}}
+			for i := 0; i < 120; i++ {
+				run.Annotations = append(run.Annotations, &Annotation{Path: "a.go", StartLine: i + 1, EndLine: i + 1, Level: "notice"})
+			}
+
+			id, err := c.CreateCheckRun(context.Background(), "acme", "widgets", run)
+			assert.Equal(t, int64(55), id)
+			assert.Equal(t, tt.expectedAttempts, attempts)
+			assert.Equal(t, tt.expectedProgress, progress)
+			assert.Equal(t, tt.expectedNote, note)
+			if tt.expectedErr == nil {
+				require.NoError(t, err)
+				return
+			}
+			var partial *PartialUploadError
+			require.ErrorAs(t, err, &partial)
+			assert.Equal(t, tt.expectedErr.Uploaded, partial.Uploaded)
+			assert.Equal(t, tt.expectedErr.Total, partial.Total)
+			assert.Equal(t, tt.expectedErr.FailedBatches, partial.FailedBatches)
+			var apiErr *APIError
+			require.ErrorAs(t, err, &apiErr)
+			assert.Equal(t, http.StatusBadGateway, apiErr.StatusCode)
+		})
+	}
+}
+
+func TestClient_IssueComments(t *testing.T) {
+	var requests []string
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		if r.Method == http.MethodGet {
+			var comments []IssueComment
+			if r.URL.Query().Get("page") == "1" {
+				for i := 0; i < commentsPerPage; i++ {
+					comments = append(comments, IssueComment{ID: int64(i), Body: fmt.Sprintf("c%d", i)})
+				}
+			}
+			json.NewEncoder(w).Encode(comments)
+			return
+		}
+		var body map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		bodies = append(bodies, body["body"])
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	c, err := NewClient(ClientConfig{BaseURL: server.URL, Tokens: StaticToken("t")})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	comments, err := c.ListIssueComments(ctx, "acme", "widgets", 12)
+	require.NoError(t, err)
+	assert.Len(t, comments, commentsPerPage)
+
+	require.NoError(t, c.CreateIssueComment(ctx, "acme", "widgets", 12, "new"))
+	require.NoError(t, c.UpdateIssueComment(ctx, "acme", "widgets", 3, "updated"))
+	assert.Equal(t, []string{
+		"GET /repos/acme/widgets/issues/12/comments",
+		"GET /repos/acme/widgets/issues/12/comments",
+		"POST /repos/acme/widgets/issues/12/comments",
+		"PATCH /repos/acme/widgets/issues/comments/3",
+	}, requests)
+	assert.Equal(t, []string{"new", "updated"}, bodies)
+}
+
+func TestClient_ListCheckSuiteRuns(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/repos/acme/widgets/check-suites/77/check-runs", r.URL.Path)
+		assert.Equal(t, "Canopy Coverage", r.URL.Query().Get("check_name"))
+		assert.Equal(t, "latest", r.URL.Query().Get("filter"))
+		w.Write([]byte(`{"total_count":1,"check_runs":[{"id":55,"name":"Canopy Coverage","head_sha":"abc","external_id":"42/72d3162e"}]}`))
+	}))
+	defer server.Close()
+
+	c, err := NewClient(ClientConfig{BaseURL: server.URL, Tokens: StaticToken("t")})
+	require.NoError(t, err)
+
+	runs, err := c.ListCheckSuiteRuns(context.Background(), "acme", "widgets", 77, "Canopy Coverage")
+	require.NoError(t, err)
+	assert.Equal(t, []CheckRunInfo{{ID: 55, Name: "Canopy Coverage", HeadSHA: "abc", ExternalID: "42/72d3162e"}}, runs)
+}
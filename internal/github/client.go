@@ -0,0 +1,290 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/tracing"
+)
+
+// DefaultBaseURL is the GitHub REST API endpoint for github.com.
+const DefaultBaseURL = "https://api.github.com"
+
+// maxDiffSize bounds the size of diffs read from the API.
+const maxDiffSize = 50 << 20
+
+// ErrResponseTooLarge is returned (wrapped) when a response body is larger
+// than the size allowed for it.
+var ErrResponseTooLarge = errors.New("github response exceeds maximum size")
+
+// rateLimitAttempts is how often a rate-limited request is sent before the
+// rate limit error is returned.
+const rateLimitAttempts = 3
+
+var (
+	// rateLimitBackoff is the first pause before retrying a rate-limited
+	// request that doesn't say how long to wait; it doubles per attempt
+	rateLimitBackoff = time.Second
+	// maxRateLimitWait is the longest pause before retrying a rate-limited
+	// request; longer waits return the error, so callers can retry later
+	// without holding the request
+	maxRateLimitWait = time.Minute
+)
+
+// TokenSource supplies the token used to authenticate API requests.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// StaticToken is a TokenSource that returns a fixed token.
+type StaticToken string
+
+// Token implements TokenSource.
+func (t StaticToken) Token(ctx context.Context) (string, error) {
+	return string(t), nil
+}
+
+// APIError is returned when the GitHub API responds with a non-2xx status.
+type APIError struct {
+	StatusCode int
+	Message    string
+	// RateLimited is set when the request was rejected by a primary or
+	// secondary rate limit
+	RateLimited bool
+	// RetryAfter is how long GitHub asked to wait before retrying a
+	// rate-limited request; zero if it didn't say
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("github api returned %d: %s", e.StatusCode, e.Message)
+}
+
+// IsNotFound returns true if err is an APIError with status 404.
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// IsRateLimited returns true if err is an APIError for a rate-limited request.
+func IsRateLimited(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.RateLimited
+}
+
+// ClientConfig holds configuration for creating a Client.
+type ClientConfig struct {
+	// BaseURL is the API endpoint (default: DefaultBaseURL)
+	BaseURL string
+	// HTTPClient is the HTTP client to use (default: 30s timeout)
+	HTTPClient *http.Client
+	// Tokens supplies the auth token for each request (required)
+	Tokens TokenSource
+}
+
+// Client is a minimal GitHub REST API client built on net/http.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	tokens     TokenSource
+}
+
+// NewClient creates a new Client.
+func NewClient(cfg ClientConfig) (*Client, error) {
+	if cfg.Tokens == nil {
+		return nil, fmt.Errorf("token source is required")
+	}
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = DefaultBaseURL
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	return &Client{
+		baseURL:    strings.TrimRight(cfg.BaseURL, "/"),
+		httpClient: cfg.HTTPClient,
+		tokens:     cfg.Tokens,
+	}, nil
+}
+
+// CompareDiff returns the unified diff between two commits, branches, or tags.
+func (c *Client) CompareDiff(ctx context.Context, owner, repo, base, head string) ([]byte, error) {
+	path := fmt.Sprintf("/repos/%s/%s/compare/%s...%s",
+		url.PathEscape(owner), url.PathEscape(repo), url.PathEscape(base), url.PathEscape(head))
+	return c.getDiff(ctx, path)
+}
+
+// MergeBase returns the SHA of the best common ancestor of two commits,
+// branches, or tags: the commit the three-dot diffs of CompareDiff and
+// PullRequestDiff are taken from.
+func (c *Client) MergeBase(ctx context.Context, owner, repo, base, head string) (string, error) {
+	path := fmt.Sprintf("/repos/%s/%s/compare/%s...%s?per_page=1",
+		url.PathEscape(owner), url.PathEscape(repo), url.PathEscape(base), url.PathEscape(head))
+	var comparison struct {
+		MergeBaseCommit struct {
+			SHA string `json:"sha"`
+		} `json:"merge_base_commit"`
+	}
+	if err := c.doJSON(ctx, http.MethodGet, path, nil, &comparison); err != nil {
+		return "", err
+	}
+	if comparison.MergeBaseCommit.SHA == "" {
+		return "", fmt.Errorf("no merge base of %s and %s", base, head)
+	}
+	return comparison.MergeBaseCommit.SHA, nil
+}
+
+// PullRequestDiff returns the unified diff of a pull request.
+func (c *Client) PullRequestDiff(ctx context.Context, owner, repo string, number int) ([]byte, error) {
+	path := fmt.Sprintf("/repos/%s/%s/pulls/%d", url.PathEscape(owner), url.PathEscape(repo), number)
+	return c.getDiff(ctx, path)
+}
+
+// getDiff performs a GET request asking for the diff media type.
+func (c *Client) getDiff(ctx context.Context, path string) ([]byte, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github.diff")
+
+	return c.do(req, maxDiffSize)
+}
+
+// newRequest creates an authenticated API request.
+func (c *Client) newRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	token, err := c.tokens.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get github token: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
+
+// do sends a request and returns the response body, or an APIError for
+// non-2xx responses. Bodies larger than limit bytes are rejected.
+// Rate-limited requests are retried up to rateLimitAttempts times, waiting
+// as long as GitHub asks, or backing off exponentially if it doesn't say,
+// unless that is longer than maxRateLimitWait.
+func (c *Client) do(req *http.Request, limit int) ([]byte, error) {
+	var body bytes.Buffer
+	if _, err := c.doTo(req, &body, int64(limit)); err != nil {
+		return nil, err
+	}
+	return body.Bytes(), nil
+}
+
+// doTo is like do, but streams the response body to w and returns the
+// number of bytes written. A body larger than limit bytes fails with
+// ErrResponseTooLarge (wrapped) after limit+1 bytes were written.
+func (c *Client) doTo(req *http.Request, w io.Writer, limit int64) (int64, error) {
+	for attempt := 1; ; attempt++ {
+		n, err := c.send(req, w, limit)
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || !apiErr.RateLimited || attempt == rateLimitAttempts {
+			return n, err
+		}
+
+		wait := apiErr.RetryAfter
+		if wait == 0 {
+			wait = rateLimitBackoff << (attempt - 1)
+		}
+		if wait > maxRateLimitWait || (req.Body != nil && req.GetBody == nil) {
+			return 0, err
+		}
+		if err := sleep(req.Context(), wait); err != nil {
+			return 0, err
+		}
+
+		// Send the request again with a fresh body
+		retry := req.Clone(req.Context())
+		if req.GetBody != nil {
+			if retry.Body, err = req.GetBody(); err != nil {
+				return 0, fmt.Errorf("failed to rewind request body: %w", err)
+			}
+		}
+		req = retry
+	}
+}
+
+// send sends a request once (see doTo), counting it in the Usage of its
+// context. Bodies of non-2xx responses become the APIError's message
+// instead of being written to w.
+func (c *Client) send(req *http.Request, w io.Writer, limit int64) (n int64, err error) {
+	_, span := tracing.Start(req.Context(), "github "+req.Method, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("http.request.method", req.Method), attribute.String("url.path", req.URL.Path)))
+	defer func() { tracing.End(span, err) }()
+
+	usage := usageFrom(req.Context())
+	usage.sent()
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("github request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	usage.observe(resp.Header)
+	observeResponse(resp)
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, min(limit, maxJSONSize)))
+		if err != nil {
+			return 0, fmt.Errorf("failed to read github response: %w", err)
+		}
+		apiErr := &APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+		apiErr.RateLimited, apiErr.RetryAfter = rateLimit(resp, apiErr.Message)
+		return 0, apiErr
+	}
+
+	n, err = io.Copy(w, io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return n, fmt.Errorf("failed to read github response: %w", err)
+	}
+	if n > limit {
+		return n, fmt.Errorf("%w of %d bytes", ErrResponseTooLarge, limit)
+	}
+	return n, nil
+}
+
+// rateLimit reports whether a response rejected its request for exceeding
+// a rate limit, and how long GitHub asked to wait before retrying: the
+// Retry-After header for secondary rate limits, or until X-RateLimit-Reset
+// once the primary rate limit is used up.
+// See https://docs.github.com/en/rest/using-the-rest-api/rate-limits-for-the-rest-api
+func rateLimit(resp *http.Response, message string) (bool, time.Duration) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return false, 0
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+		return true, time.Duration(seconds) * time.Second
+	}
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			return true, max(time.Until(time.Unix(reset, 0)), 0)
+		}
+		return true, 0
+	}
+	// Secondary rate limits without Retry-After are only told apart from
+	// permission errors by their message
+	return resp.StatusCode == http.StatusTooManyRequests || strings.Contains(strings.ToLower(message), "rate limit"), 0
+}
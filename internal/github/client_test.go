@@ -0,0 +1,255 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingTokens always returns an error.
+type failingTokens struct{}
+
+func (failingTokens) Token(ctx context.Context) (string, error) {
+	return "", errors.New("token expired")
+}
+
+func TestNewClient(t *testing.T) {
+	_, err := NewClient(ClientConfig{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "token source is required")
+
+	c, err := NewClient(ClientConfig{Tokens: StaticToken("t")})
+	require.NoError(t, err)
+	assert.Equal(t, DefaultBaseURL, c.baseURL)
+	assert.NotNil(t, c.httpClient)
+}
+
+func TestClient_Diffs(t *testing.T) {
+	var gotPath, gotAccept, gotAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.EscapedPath()
+		gotAccept = r.Header.Get("Accept")
+		gotAuth = r.Header.Get("Authorization")
+		w.Write([]byte("diff --git a/main.go b/main.go\n"))
+	}))
+	defer server.Close()
+
+	c, err := NewClient(ClientConfig{BaseURL: server.URL + "/", Tokens: StaticToken("secret")})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	t.Run("compare", func(t *testing.T) {
+		data, err := c.CompareDiff(ctx, "grafana", "mimir", "main", "feature/x")
+		require.NoError(t, err)
+		assert.Equal(t, "diff --git a/main.go b/main.go\n", string(data))
+		assert.Equal(t, "/repos/grafana/mimir/compare/main...feature%2Fx", gotPath)
+		assert.Equal(t, "application/vnd.github.diff", gotAccept)
+		assert.Equal(t, "Bearer secret", gotAuth)
+	})
+
+	t.Run("pull request", func(t *testing.T) {
+		_, err := c.PullRequestDiff(ctx, "grafana", "mimir", 42)
+		require.NoError(t, err)
+		assert.Equal(t, "/repos/grafana/mimir/pulls/42", gotPath)
+	})
+}
+
+func TestClient_MergeBase(t *testing.T) {
+	var gotPath, gotAccept string
+	body := `{"merge_base_commit":{"sha":"abc123"},"files":[]}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.EscapedPath()
+		gotAccept = r.Header.Get("Accept")
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	c, err := NewClient(ClientConfig{BaseURL: server.URL, Tokens: StaticToken("t")})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	sha, err := c.MergeBase(ctx, "grafana", "mimir", "main", "feature/x")
+	require.NoError(t, err)
+	assert.Equal(t, "abc123", sha)
+	assert.Equal(t, "/repos/grafana/mimir/compare/main...feature%2Fx", gotPath)
+	assert.Equal(t, "application/vnd.github+json", gotAccept)
+
+	body = `{"files":[]}`
+	_, err = c.MergeBase(ctx, "grafana", "mimir", "main", "orphan")
+	assert.ErrorContains(t, err, "no merge base of main and orphan")
+}
+
+func TestClient_Errors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message":"Not Found"}`, http.StatusNotFound)
+	}))
+	defer server.Close()
+	ctx := context.Background()
+
+	t.Run("api error", func(t *testing.T) {
+		c, err := NewClient(ClientConfig{BaseURL: server.URL, Tokens: StaticToken("t")})
+		require.NoError(t, err)
+
+		_, err = c.CompareDiff(ctx, "grafana", "mimir", "a", "b")
+		require.Error(t, err)
+		assert.True(t, IsNotFound(err))
+		assert.Contains(t, err.Error(), "Not Found")
+	})
+
+	t.Run("token error", func(t *testing.T) {
+		c, err := NewClient(ClientConfig{BaseURL: server.URL, Tokens: failingTokens{}})
+		require.NoError(t, err)
+
+		_, err = c.CompareDiff(ctx, "grafana", "mimir", "a", "b")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "token expired")
+		assert.False(t, IsNotFound(err))
+	})
+}
+
+func TestClient_RateLimit(t *testing.T) {
+	defer func(d, m time.Duration) { rateLimitBackoff, maxRateLimitWait = d, m }(rateLimitBackoff, maxRateLimitWait)
+	rateLimitBackoff, maxRateLimitWait = time.Millisecond, time.Second
+
+	tests := []struct {
+		name             string
+		status           int
+		headers          map[string]string
+		message          string
+		failures         int // Rate-limited responses before the request succeeds
+		expectedAttempts int
+		expectedLimited  bool
+	}{
+		{
+			name:             "primary rate limit",
+			status:           http.StatusForbidden,
+			headers:          map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": strconv.FormatInt(time.Now().Unix(), 10)},
+			message:          "API rate limit exceeded",
+			failures:         1,
+			expectedAttempts: 2,
+		},
+		{
+			name:             "secondary rate limit with retry-after",
+			status:           http.StatusForbidden,
+			headers:          map[string]string{"Retry-After": "0"},
+			message:          "You have exceeded a secondary rate limit",
+			failures:         2,
+			expectedAttempts: 3,
+		},
+		{
+			name:             "too many requests",
+			status:           http.StatusTooManyRequests,
+			failures:         1,
+			expectedAttempts: 2,
+		},
+		{
+			name:             "attempts exhausted",
+			status:           http.StatusTooManyRequests,
+			failures:         rateLimitAttempts,
+			expectedAttempts: rateLimitAttempts,
+			expectedLimited:  true,
+		},
+		{
+			name:             "wait too long",
+			status:           http.StatusForbidden,
+			headers:          map[string]string{"Retry-After": "3600"},
+			failures:         1,
+			expectedAttempts: 1,
+			expectedLimited:  true,
+		},
+		{
+			name:             "permission error",
+			status:           http.StatusForbidden,
+			message:          "Resource not accessible by integration",
+			failures:         1,
+			expectedAttempts: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			var bodies []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts++
+				body, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+				bodies = append(bodies, string(body))
+				if attempts <= tt.failures {
+					for k, v := range tt.headers {
+						w.Header().Set(k, v)
+					}
+					http.Error(w, `{"message":"`+tt.message+`"}`, tt.status)
+					return
+				}
+				w.Write([]byte(`{"id":7}`))
+			}))
+			defer server.Close()
+
+			c, err := NewClient(ClientConfig{BaseURL: server.URL, Tokens: StaticToken("t")})
+			require.NoError(t, err)
+
+			err = c.CreateIssueComment(context.Background(), "acme", "widgets", 1, "hello")
+			assert.Equal(t, tt.expectedAttempts, attempts)
+			if tt.failures >= tt.expectedAttempts {
+				require.Error(t, err)
+				assert.Equal(t, tt.expectedLimited, IsRateLimited(err))
+			} else {
+				require.NoError(t, err)
+			}
+			// Retries send the whole body again
+			for _, body := range bodies {
+				assert.JSONEq(t, `{"body":"hello"}`, body)
+			}
+		})
+	}
+}
+
+func TestClient_Usage(t *testing.T) {
+	defer func(d time.Duration) { rateLimitBackoff = d }(rateLimitBackoff)
+	rateLimitBackoff = time.Millisecond
+
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.Header().Set("X-RateLimit-Limit", "5000")
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(5000-attempts))
+		if attempts == 1 {
+			http.Error(w, `{"message":"slow down"}`, http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{"default_branch":"main"}`))
+	}))
+	defer server.Close()
+
+	c, err := NewClient(ClientConfig{BaseURL: server.URL, Tokens: StaticToken("t")})
+	require.NoError(t, err)
+
+	var usage Usage
+	_, _, ok := usage.RateLimit()
+	assert.False(t, ok)
+
+	ctx := WithUsage(context.Background(), &usage)
+	_, err = c.GetRepository(ctx, "acme", "widgets")
+	require.NoError(t, err)
+	_, err = c.GetRepository(ctx, "acme", "widgets")
+	require.NoError(t, err)
+	// Requests without the usage context aren't counted
+	_, err = c.GetRepository(context.Background(), "acme", "widgets")
+	require.NoError(t, err)
+
+	// The rate-limited attempt counts as a request
+	assert.Equal(t, 3, usage.Requests())
+	remaining, limit, ok := usage.RateLimit()
+	assert.True(t, ok)
+	assert.Equal(t, 4997, remaining)
+	assert.Equal(t, 5000, limit)
+}
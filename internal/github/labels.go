@@ -0,0 +1,164 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// labelsPerPage is the page size used when listing issue labels.
+const labelsPerPage = 100
+
+// LabelBand assigns a PR label to a range of patch coverage percentages.
+// A band matches coverage in [Min, Max), except that a Max of 100 includes 100.
+type LabelBand struct {
+	Label string
+	Min   float64
+	Max   float64
+}
+
+// LabelChanges lists the labels to add to and remove from a PR.
+type LabelChanges struct {
+	Add    []string
+	Remove []string
+}
+
+// IsEmpty returns true if no labels need to change.
+func (c LabelChanges) IsEmpty() bool {
+	return len(c.Add) == 0 && len(c.Remove) == 0
+}
+
+// ParseLabelBands parses a comma-separated list of label=min or label=min-max entries.
+// Omitting max means the band extends to 100%.
+// Example: "coverage: excellent=90,needs-tests=0-50"
+func ParseLabelBands(spec string) ([]LabelBand, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+
+	var bands []LabelBand
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		sep := strings.LastIndex(entry, "=")
+		if sep <= 0 {
+			return nil, fmt.Errorf("invalid label band %q (expected label=min or label=min-max)", entry)
+		}
+
+		band := LabelBand{
+			Label: strings.TrimSpace(entry[:sep]),
+			Max:   100,
+		}
+
+		minStr, maxStr, hasMax := strings.Cut(strings.TrimSpace(entry[sep+1:]), "-")
+		var err error
+		if band.Min, err = strconv.ParseFloat(strings.TrimSpace(minStr), 64); err != nil {
+			return nil, fmt.Errorf("invalid minimum coverage in label band %q: %w", entry, err)
+		}
+		if hasMax {
+			if band.Max, err = strconv.ParseFloat(strings.TrimSpace(maxStr), 64); err != nil {
+				return nil, fmt.Errorf("invalid maximum coverage in label band %q: %w", entry, err)
+			}
+		}
+
+		if band.Min < 0 || band.Max > 100 || band.Min >= band.Max {
+			return nil, fmt.Errorf("invalid coverage range in label band %q (must satisfy 0 <= min < max <= 100)", entry)
+		}
+
+		bands = append(bands, band)
+	}
+
+	return bands, nil
+}
+
+// matches returns true if coverage falls within the band.
+func (b LabelBand) matches(coverage float64) bool {
+	if coverage < b.Min {
+		return false
+	}
+	if b.Max >= 100 {
+		return coverage <= 100
+	}
+	return coverage < b.Max
+}
+
+// PlanLabelChanges determines which band labels to add and remove for a PR
+// with the given patch coverage. Only labels named in bands are ever removed,
+// so labels managed by people or other automation are left alone.
+// Labels are compared case-insensitively, as GitHub does.
+func PlanLabelChanges(bands []LabelBand, patchCoverage float64, current []string) LabelChanges {
+	present := make(map[string]bool, len(current))
+	for _, label := range current {
+		present[strings.ToLower(label)] = true
+	}
+
+	want := make(map[string]bool)
+	for _, band := range bands {
+		if band.matches(patchCoverage) {
+			want[strings.ToLower(band.Label)] = true
+		}
+	}
+
+	var changes LabelChanges
+	seen := make(map[string]bool)
+	for _, band := range bands {
+		key := strings.ToLower(band.Label)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		switch {
+		case want[key] && !present[key]:
+			changes.Add = append(changes.Add, band.Label)
+		case !want[key] && present[key]:
+			changes.Remove = append(changes.Remove, band.Label)
+		}
+	}
+
+	sort.Strings(changes.Add)
+	sort.Strings(changes.Remove)
+	return changes
+}
+
+// ListIssueLabels returns the names of the labels of an issue or pull request.
+func (c *Client) ListIssueLabels(ctx context.Context, owner, repo string, number int) ([]string, error) {
+	var names []string
+	for page := 1; ; page++ {
+		path := fmt.Sprintf("/repos/%s/%s/issues/%d/labels?per_page=%d&page=%d",
+			url.PathEscape(owner), url.PathEscape(repo), number, labelsPerPage, page)
+		var labels []struct {
+			Name string `json:"name"`
+		}
+		if err := c.doJSON(ctx, http.MethodGet, path, nil, &labels); err != nil {
+			return nil, err
+		}
+		for _, label := range labels {
+			names = append(names, label.Name)
+		}
+		if len(labels) < labelsPerPage {
+			return names, nil
+		}
+	}
+}
+
+// AddIssueLabels adds labels to an issue or pull request. Labels missing
+// from the repository are created by GitHub.
+func (c *Client) AddIssueLabels(ctx context.Context, owner, repo string, number int, labels []string) error {
+	path := fmt.Sprintf("/repos/%s/%s/issues/%d/labels", url.PathEscape(owner), url.PathEscape(repo), number)
+	return c.doJSON(ctx, http.MethodPost, path, map[string][]string{"labels": labels}, nil)
+}
+
+// RemoveIssueLabel removes a label from an issue or pull request. Removing
+// a label the issue doesn't have is not an error.
+func (c *Client) RemoveIssueLabel(ctx context.Context, owner, repo string, number int, label string) error {
+	path := fmt.Sprintf("/repos/%s/%s/issues/%d/labels/%s", url.PathEscape(owner), url.PathEscape(repo), number, url.PathEscape(label))
+	if err := c.doJSON(ctx, http.MethodDelete, path, nil, nil); err != nil && !IsNotFound(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLabelBands(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     string
+		expected []LabelBand
+		errorMsg string
+	}{
+		{
+			name:     "empty spec",
+			spec:     "",
+			expected: nil,
+		},
+		{
+			name: "open-ended and bounded bands",
+			spec: "coverage: excellent=90, needs-tests=0-50",
+			expected: []LabelBand{
+				{Label: "coverage: excellent", Min: 90, Max: 100},
+				{Label: "needs-tests", Min: 0, Max: 50},
+			},
+		},
+		{
+			name:     "missing range",
+			spec:     "needs-tests",
+			errorMsg: "expected label=min",
+		},
+		{
+			name:     "missing label",
+			spec:     "=50",
+			errorMsg: "expected label=min",
+		},
+		{
+			name:     "invalid minimum",
+			spec:     "needs-tests=low",
+			errorMsg: "invalid minimum coverage",
+		},
+		{
+			name:     "invalid maximum",
+			spec:     "needs-tests=0-high",
+			errorMsg: "invalid maximum coverage",
+		},
+		{
+			name:     "inverted range",
+			spec:     "needs-tests=50-10",
+			errorMsg: "must satisfy",
+		},
+		{
+			name:     "out of range",
+			spec:     "great=90-120",
+			errorMsg: "must satisfy",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bands, err := ParseLabelBands(tt.spec)
+			if tt.errorMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, bands)
+		})
+	}
+}
+
+func TestPlanLabelChanges(t *testing.T) {
+	bands := []LabelBand{
+		{Label: "coverage: excellent", Min: 90, Max: 100},
+		{Label: "needs-tests", Min: 0, Max: 50},
+	}
+
+	tests := []struct {
+		name     string
+		coverage float64
+		current  []string
+		expected LabelChanges
+	}{
+		{
+			name:     "full coverage adds excellent",
+			coverage: 100,
+			current:  []string{"bug"},
+			expected: LabelChanges{Add: []string{"coverage: excellent"}},
+		},
+		{
+			name:     "low coverage swaps labels",
+			coverage: 20,
+			current:  []string{"coverage: excellent", "bug"},
+			expected: LabelChanges{Add: []string{"needs-tests"}, Remove: []string{"coverage: excellent"}},
+		},
+		{
+			name:     "coverage between bands removes managed labels only",
+			coverage: 70,
+			current:  []string{"Needs-Tests", "bug"},
+			expected: LabelChanges{Remove: []string{"needs-tests"}},
+		},
+		{
+			name:     "max is exclusive below 100",
+			coverage: 50,
+			current:  nil,
+			expected: LabelChanges{},
+		},
+		{
+			name:     "label already present",
+			coverage: 95,
+			current:  []string{"Coverage: Excellent"},
+			expected: LabelChanges{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes := PlanLabelChanges(bands, tt.coverage, tt.current)
+			assert.Equal(t, tt.expected, changes)
+			assert.Equal(t, len(tt.expected.Add)+len(tt.expected.Remove) == 0, changes.IsEmpty())
+		})
+	}
+}
+
+func TestPlanLabelChanges_OverlappingBands(t *testing.T) {
+	bands := []LabelBand{
+		{Label: "tested", Min: 50, Max: 100},
+		{Label: "tested", Min: 0, Max: 10},
+		{Label: "coverage: excellent", Min: 90, Max: 100},
+	}
+
+	changes := PlanLabelChanges(bands, 95, []string{"tested"})
+	assert.Equal(t, LabelChanges{Add: []string{"coverage: excellent"}}, changes)
+}
+
+func TestClient_IssueLabels(t *testing.T) {
+	var requests []string
+	var added []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.EscapedPath())
+		switch r.Method {
+		case http.MethodGet:
+			var labels []map[string]string
+			if r.URL.Query().Get("page") == "1" {
+				for i := 0; i < labelsPerPage; i++ {
+					labels = append(labels, map[string]string{"name": fmt.Sprintf("l%d", i)})
+				}
+			}
+			json.NewEncoder(w).Encode(labels)
+		case http.MethodPost:
+			var body map[string][]string
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			added = append(added, body["labels"]...)
+			w.Write([]byte(`[]`))
+		case http.MethodDelete:
+			if r.URL.Path == "/repos/acme/widgets/issues/12/labels/gone" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write([]byte(`[]`))
+		}
+	}))
+	defer server.Close()
+
+	c, err := NewClient(ClientConfig{BaseURL: server.URL, Tokens: StaticToken("t")})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	labels, err := c.ListIssueLabels(ctx, "acme", "widgets", 12)
+	require.NoError(t, err)
+	assert.Len(t, labels, labelsPerPage)
+	assert.Equal(t, "l0", labels[0])
+
+	require.NoError(t, c.AddIssueLabels(ctx, "acme", "widgets", 12, []string{"coverage: excellent"}))
+	require.NoError(t, c.RemoveIssueLabel(ctx, "acme", "widgets", 12, "needs tests"))
+	require.NoError(t, c.RemoveIssueLabel(ctx, "acme", "widgets", 12, "gone"), "a missing label is already removed")
+	assert.Equal(t, []string{
+		"GET /repos/acme/widgets/issues/12/labels",
+		"GET /repos/acme/widgets/issues/12/labels",
+		"POST /repos/acme/widgets/issues/12/labels",
+		"DELETE /repos/acme/widgets/issues/12/labels/needs%20tests",
+		"DELETE /repos/acme/widgets/issues/12/labels/gone",
+	}, requests)
+	assert.Equal(t, []string{"coverage: excellent"}, added)
+}
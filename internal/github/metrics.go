@@ -0,0 +1,30 @@
+package github
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/metrics"
+)
+
+// GitHub API metrics, declared on metrics.Default.
+var (
+	requestsTotal = metrics.Default.NewCounter("canopy_github_requests_total",
+		"GitHub API responses, by status code.", "code")
+	rateLimitRemaining = metrics.Default.NewGauge("canopy_github_rate_limit_remaining",
+		"Requests left in the rate limit window, as last reported by GitHub, by resource.", "resource")
+)
+
+// observeResponse records a response and the rate limit it reports.
+func observeResponse(resp *http.Response) {
+	requestsTotal.Inc(strconv.Itoa(resp.StatusCode))
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	resource := resp.Header.Get("X-RateLimit-Resource")
+	if resource == "" {
+		resource = "core"
+	}
+	rateLimitRemaining.Set(float64(remaining), resource)
+}
@@ -0,0 +1,58 @@
+package github
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObserveResponse(t *testing.T) {
+	tests := []struct {
+		name              string
+		code              int
+		header            http.Header
+		resource          string
+		expectedRemaining float64
+	}{
+		{
+			name:              "core rate limit",
+			code:              http.StatusOK,
+			header:            http.Header{"X-Ratelimit-Remaining": {"4321"}, "X-Ratelimit-Resource": {"core"}},
+			resource:          "core",
+			expectedRemaining: 4321,
+		},
+		{
+			name:              "resource defaults to core",
+			code:              http.StatusOK,
+			header:            http.Header{"X-Ratelimit-Remaining": {"4320"}},
+			resource:          "core",
+			expectedRemaining: 4320,
+		},
+		{
+			name:              "other resource",
+			code:              http.StatusForbidden,
+			header:            http.Header{"X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Resource": {"search"}},
+			resource:          "search",
+			expectedRemaining: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := requestsTotal.Value(strconv.Itoa(tt.code))
+
+			observeResponse(&http.Response{StatusCode: tt.code, Header: tt.header})
+			assert.Equal(t, requests+1, requestsTotal.Value(strconv.Itoa(tt.code)))
+			assert.Equal(t, tt.expectedRemaining, rateLimitRemaining.Value(tt.resource))
+		})
+	}
+}
+
+func TestObserveResponse_WithoutRateLimit(t *testing.T) {
+	rateLimitRemaining.Set(100, "graphql")
+
+	observeResponse(&http.Response{StatusCode: http.StatusNotFound, Header: http.Header{"X-Ratelimit-Resource": {"graphql"}}})
+	assert.Equal(t, 100.0, rateLimitRemaining.Value("graphql"))
+}
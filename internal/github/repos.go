@@ -0,0 +1,226 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// reposPerPage is the page size used when listing repositories.
+const reposPerPage = 100
+
+// commitsPerPage is the page size used when listing commits.
+const commitsPerPage = 100
+
+// maxJSONSize bounds the size of JSON and file responses read from the API.
+const maxJSONSize = 10 * 1024 * 1024
+
+// Repository is a repository as listed by the GitHub API.
+type Repository struct {
+	Name          string `json:"name"`
+	FullName      string `json:"full_name"`
+	DefaultBranch string `json:"default_branch"`
+	Archived      bool   `json:"archived"`
+	Fork          bool   `json:"fork"`
+}
+
+// FilePullRequest describes a pull request adding a single file.
+type FilePullRequest struct {
+	Owner string
+	Repo  string
+	// Base is the branch the pull request targets
+	Base string
+	// Branch is the new branch created from Base for the change
+	Branch  string
+	Path    string
+	Content []byte
+	// Message is the commit message
+	Message string
+	Title   string
+	Body    string
+}
+
+// ListOrgRepos returns all repositories of an organization.
+func (c *Client) ListOrgRepos(ctx context.Context, org string) ([]Repository, error) {
+	var all []Repository
+	for page := 1; ; page++ {
+		path := fmt.Sprintf("/orgs/%s/repos?per_page=%d&page=%d", url.PathEscape(org), reposPerPage, page)
+		var repos []Repository
+		if err := c.doJSON(ctx, http.MethodGet, path, nil, &repos); err != nil {
+			return nil, err
+		}
+		all = append(all, repos...)
+		if len(repos) < reposPerPage {
+			return all, nil
+		}
+	}
+}
+
+// ListInstallationRepos returns all repositories the GitHub App
+// installation authenticating the request can access.
+func (c *Client) ListInstallationRepos(ctx context.Context) ([]Repository, error) {
+	var all []Repository
+	for page := 1; ; page++ {
+		path := fmt.Sprintf("/installation/repositories?per_page=%d&page=%d", reposPerPage, page)
+		var resp struct {
+			Repositories []Repository `json:"repositories"`
+		}
+		if err := c.doJSON(ctx, http.MethodGet, path, nil, &resp); err != nil {
+			return nil, err
+		}
+		all = append(all, resp.Repositories...)
+		if len(resp.Repositories) < reposPerPage {
+			return all, nil
+		}
+	}
+}
+
+// ListCommits returns the SHAs of up to limit commits reachable from ref,
+// newest first.
+func (c *Client) ListCommits(ctx context.Context, owner, repo, ref string, limit int) ([]string, error) {
+	var all []string
+	for page := 1; len(all) < limit; page++ {
+		perPage := min(limit-len(all), commitsPerPage)
+		path := fmt.Sprintf("/repos/%s/%s/commits?sha=%s&per_page=%d&page=%d",
+			url.PathEscape(owner), url.PathEscape(repo), url.QueryEscape(ref), commitsPerPage, page)
+		var commits []struct {
+			SHA string `json:"sha"`
+		}
+		if err := c.doJSON(ctx, http.MethodGet, path, nil, &commits); err != nil {
+			return nil, err
+		}
+		for _, commit := range commits[:min(len(commits), perPage)] {
+			all = append(all, commit.SHA)
+		}
+		if len(commits) < commitsPerPage {
+			break
+		}
+	}
+	return all, nil
+}
+
+// GetFile returns the contents of a file at ref (empty for the default
+// branch). A missing file returns an APIError for which IsNotFound is true.
+func (c *Client) GetFile(ctx context.Context, owner, repo, path, ref string) ([]byte, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, contentsPath(owner, repo, path, ref), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github.raw")
+	return c.do(req, maxJSONSize)
+}
+
+// ListDirectory returns the paths of the files (not subdirectories) in a
+// directory at ref (empty for the default branch).
+func (c *Client) ListDirectory(ctx context.Context, owner, repo, path, ref string) ([]string, error) {
+	var entries []struct {
+		Path string `json:"path"`
+		Type string `json:"type"`
+	}
+	if err := c.doJSON(ctx, http.MethodGet, contentsPath(owner, repo, path, ref), nil, &entries); err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		if e.Type == "file" {
+			files = append(files, e.Path)
+		}
+	}
+	return files, nil
+}
+
+// CreateFilePullRequest creates a branch from pr.Base, commits pr.Content to
+// pr.Path on it, and opens a pull request. It returns the pull request's URL.
+func (c *Client) CreateFilePullRequest(ctx context.Context, pr FilePullRequest) (string, error) {
+	repoPath := fmt.Sprintf("/repos/%s/%s", url.PathEscape(pr.Owner), url.PathEscape(pr.Repo))
+
+	var ref struct {
+		Object struct {
+			SHA string `json:"sha"`
+		} `json:"object"`
+	}
+	if err := c.doJSON(ctx, http.MethodGet, repoPath+"/git/ref/heads/"+escapePath(pr.Base), nil, &ref); err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", pr.Base, err)
+	}
+
+	createRef := map[string]string{"ref": "refs/heads/" + pr.Branch, "sha": ref.Object.SHA}
+	if err := c.doJSON(ctx, http.MethodPost, repoPath+"/git/refs", createRef, nil); err != nil {
+		return "", fmt.Errorf("failed to create branch %s: %w", pr.Branch, err)
+	}
+
+	putFile := map[string]string{
+		"message": pr.Message,
+		"content": base64.StdEncoding.EncodeToString(pr.Content),
+		"branch":  pr.Branch,
+	}
+	if err := c.doJSON(ctx, http.MethodPut, contentsPath(pr.Owner, pr.Repo, pr.Path, ""), putFile, nil); err != nil {
+		return "", fmt.Errorf("failed to commit %s: %w", pr.Path, err)
+	}
+
+	createPR := map[string]string{"title": pr.Title, "head": pr.Branch, "base": pr.Base, "body": pr.Body}
+	var created struct {
+		HTMLURL string `json:"html_url"`
+	}
+	if err := c.doJSON(ctx, http.MethodPost, repoPath+"/pulls", createPR, &created); err != nil {
+		return "", fmt.Errorf("failed to open pull request: %w", err)
+	}
+	return created.HTMLURL, nil
+}
+
+// contentsPath returns the contents API path of a file or directory.
+func contentsPath(owner, repo, path, ref string) string {
+	p := fmt.Sprintf("/repos/%s/%s/contents/%s", url.PathEscape(owner), url.PathEscape(repo), escapePath(path))
+	if ref != "" {
+		p += "?ref=" + url.QueryEscape(ref)
+	}
+	return p
+}
+
+// escapePath escapes each segment of a slash-separated path.
+func escapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// doJSON sends a request with an optional JSON body and decodes the JSON
+// response into out, unless out is nil.
+func (c *Client) doJSON(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := c.newRequest(ctx, method, path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	data, err := c.do(req, maxJSONSize)
+	if err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to decode github response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_ListOrgRepos(t *testing.T) {
+	var pages []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/orgs/acme/repos", r.URL.Path)
+		page := r.URL.Query().Get("page")
+		pages = append(pages, page)
+		var repos []Repository
+		if page == "1" {
+			for i := 0; i < reposPerPage; i++ {
+				repos = append(repos, Repository{Name: fmt.Sprintf("repo%d", i)})
+			}
+		} else {
+			repos = []Repository{{Name: "last", FullName: "acme/last", DefaultBranch: "main", Archived: true}}
+		}
+		json.NewEncoder(w).Encode(repos)
+	}))
+	defer server.Close()
+
+	c, err := NewClient(ClientConfig{BaseURL: server.URL, Tokens: StaticToken("t")})
+	require.NoError(t, err)
+
+	repos, err := c.ListOrgRepos(context.Background(), "acme")
+	require.NoError(t, err)
+	assert.Len(t, repos, reposPerPage+1)
+	assert.Equal(t, Repository{Name: "last", FullName: "acme/last", DefaultBranch: "main", Archived: true}, repos[reposPerPage])
+	assert.Equal(t, []string{"1", "2"}, pages)
+}
+
+func TestClient_ListInstallationRepos(t *testing.T) {
+	var pages []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/installation/repositories", r.URL.Path)
+		assert.Equal(t, "Bearer t", r.Header.Get("Authorization"))
+		page := r.URL.Query().Get("page")
+		pages = append(pages, page)
+		var repos []Repository
+		if page == "1" {
+			for i := 0; i < reposPerPage; i++ {
+				repos = append(repos, Repository{FullName: fmt.Sprintf("acme/repo%d", i)})
+			}
+		} else {
+			repos = []Repository{{Name: "last", FullName: "acme/last"}}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"total_count": reposPerPage + 1, "repositories": repos})
+	}))
+	defer server.Close()
+
+	c, err := NewClient(ClientConfig{BaseURL: server.URL, Tokens: StaticToken("t")})
+	require.NoError(t, err)
+
+	repos, err := c.ListInstallationRepos(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, repos, reposPerPage+1)
+	assert.Equal(t, Repository{Name: "last", FullName: "acme/last"}, repos[reposPerPage])
+	assert.Equal(t, []string{"1", "2"}, pages)
+}
+
+func TestClient_ListCommits(t *testing.T) {
+	var pages []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/repos/acme/widgets/commits", r.URL.Path)
+		assert.Equal(t, "release/1.x", r.URL.Query().Get("sha"))
+		page := r.URL.Query().Get("page")
+		pages = append(pages, page)
+		n := commitsPerPage
+		if page == "3" {
+			n = 2
+		}
+		var commits []map[string]string
+		for i := 0; i < n; i++ {
+			commits = append(commits, map[string]string{"sha": fmt.Sprintf("p%s-%d", page, i)})
+		}
+		json.NewEncoder(w).Encode(commits)
+	}))
+	defer server.Close()
+
+	c, err := NewClient(ClientConfig{BaseURL: server.URL, Tokens: StaticToken("t")})
+	require.NoError(t, err)
+
+	t.Run("stops at the limit", func(t *testing.T) {
+		pages = nil
+		shas, err := c.ListCommits(context.Background(), "acme", "widgets", "release/1.x", 150)
+		require.NoError(t, err)
+		assert.Len(t, shas, 150)
+		assert.Equal(t, "p1-0", shas[0])
+		assert.Equal(t, "p2-49", shas[149])
+		assert.Equal(t, []string{"1", "2"}, pages)
+	})
+
+	t.Run("stops at the last page", func(t *testing.T) {
+		pages = nil
+		shas, err := c.ListCommits(context.Background(), "acme", "widgets", "release/1.x", 1000)
+		require.NoError(t, err)
+		assert.Len(t, shas, 2*commitsPerPage+2)
+		assert.Equal(t, []string{"1", "2", "3"}, pages)
+	})
+}
+
+func TestClient_Contents(t *testing.T) {
+	var gotPath, gotQuery, gotAccept string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.EscapedPath()
+		gotQuery = r.URL.RawQuery
+		gotAccept = r.Header.Get("Accept")
+		switch r.URL.Path {
+		case "/repos/acme/widgets/contents/go.mod":
+			w.Write([]byte("module github.com/acme/widgets\n"))
+		case "/repos/acme/widgets/contents/.github/workflows":
+			w.Write([]byte(`[{"path":".github/workflows/ci.yml","type":"file"},{"path":".github/workflows/shared","type":"dir"}]`))
+		default:
+			http.Error(w, `{"message":"Not Found"}`, http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c, err := NewClient(ClientConfig{BaseURL: server.URL, Tokens: StaticToken("t")})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	data, err := c.GetFile(ctx, "acme", "widgets", "go.mod", "main")
+	require.NoError(t, err)
+	assert.Equal(t, "module github.com/acme/widgets\n", string(data))
+	assert.Equal(t, "ref=main", gotQuery)
+	assert.Equal(t, "application/vnd.github.raw", gotAccept)
+
+	_, err = c.GetFile(ctx, "acme", "widgets", "missing.txt", "")
+	assert.True(t, IsNotFound(err))
+
+	files, err := c.ListDirectory(ctx, "acme", "widgets", ".github/workflows", "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{".github/workflows/ci.yml"}, files)
+	assert.Equal(t, "/repos/acme/widgets/contents/.github/workflows", gotPath)
+	assert.Equal(t, "application/vnd.github+json", gotAccept)
+}
+
+func TestClient_CreateFilePullRequest(t *testing.T) {
+	var requests []string
+	var bodies []map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		if r.Body != nil && r.Method != http.MethodGet {
+			var body map[string]string
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			bodies = append(bodies, body)
+		}
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/git/ref/heads/main"):
+			w.Write([]byte(`{"object":{"sha":"abc123"}}`))
+		case strings.HasSuffix(r.URL.Path, "/pulls"):
+			w.Write([]byte(`{"html_url":"https://github.com/acme/widgets/pull/7"}`))
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer server.Close()
+
+	c, err := NewClient(ClientConfig{BaseURL: server.URL, Tokens: StaticToken("t")})
+	require.NoError(t, err)
+
+	url, err := c.CreateFilePullRequest(context.Background(), FilePullRequest{
+		Owner:   "acme",
+		Repo:    "widgets",
+		Base:    "main",
+		Branch:  "canopy/onboard",
+		Path:    ".github/workflows/coverage.yml",
+		Content: []byte("name: coverage\n"),
+		Message: "Add coverage workflow",
+		Title:   "Add Canopy coverage",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "https://github.com/acme/widgets/pull/7", url)
+	assert.Equal(t, []string{
+		"GET /repos/acme/widgets/git/ref/heads/main",
+		"POST /repos/acme/widgets/git/refs",
+		"PUT /repos/acme/widgets/contents/.github/workflows/coverage.yml",
+		"POST /repos/acme/widgets/pulls",
+	}, requests)
+	require.Len(t, bodies, 3)
+	assert.Equal(t, map[string]string{"ref": "refs/heads/canopy/onboard", "sha": "abc123"}, bodies[0])
+	assert.Equal(t, "bmFtZTogY292ZXJhZ2UK", bodies[1]["content"])
+	assert.Equal(t, "canopy/onboard", bodies[1]["branch"])
+	assert.Equal(t, "canopy/onboard", bodies[2]["head"])
+}
@@ -0,0 +1,83 @@
+package github
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// usageKey is the context key of a Usage.
+type usageKey struct{}
+
+// Usage counts the API requests made for a unit of work, such as a work
+// request, and records the rate limit quota GitHub last reported. Requests
+// are counted when their context carries it (see WithUsage), including
+// retries of rate-limited requests. The zero value is ready to use, and it
+// is safe for concurrent use.
+type Usage struct {
+	mu        sync.Mutex
+	requests  int
+	remaining int
+	limit     int
+	known     bool
+}
+
+// WithUsage returns a context counting the API requests made with it in u.
+func WithUsage(ctx context.Context, u *Usage) context.Context {
+	return context.WithValue(ctx, usageKey{}, u)
+}
+
+// usageFrom returns the Usage of ctx, or nil if it has none.
+func usageFrom(ctx context.Context) *Usage {
+	u, _ := ctx.Value(usageKey{}).(*Usage)
+	return u
+}
+
+// Requests returns the number of API requests sent.
+func (u *Usage) Requests() int {
+	if u == nil {
+		return 0
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.requests
+}
+
+// RateLimit returns the requests left in the current rate limit window and
+// the window's limit, as reported by the last response. ok is false if no
+// response reported them.
+func (u *Usage) RateLimit() (remaining, limit int, ok bool) {
+	if u == nil {
+		return 0, 0, false
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.remaining, u.limit, u.known
+}
+
+// sent counts a request being sent.
+func (u *Usage) sent() {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.requests++
+}
+
+// observe records the rate limit headers of a response.
+func (u *Usage) observe(header http.Header) {
+	if u == nil {
+		return
+	}
+	remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	limit, _ := strconv.Atoi(header.Get("X-RateLimit-Limit"))
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.remaining, u.limit, u.known = remaining, limit, true
+}
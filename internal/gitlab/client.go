@@ -0,0 +1,352 @@
+// Package gitlab is a minimal GitLab REST API (v4) client for the worker's
+// GitLab mode: it downloads the coverage artifacts of pipeline jobs, reads
+// merge request diffs and repository files, and publishes commit statuses,
+// merge request notes, and inline discussions.
+//
+// Projects are named by owner, their full namespace path (e.g. "group" or
+// "group/subgroup"), and repo, their path within it.
+package gitlab
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/tracing"
+)
+
+// DefaultBaseURL is the GitLab REST API endpoint for gitlab.com.
+const DefaultBaseURL = "https://gitlab.com/api/v4"
+
+const (
+	// maxJSONSize bounds the size of JSON responses
+	maxJSONSize = 10 << 20
+	// maxFileSize bounds the size of repository files
+	maxFileSize = 10 << 20
+	// maxDiffSize bounds the size of diffs read from the API
+	maxDiffSize = 50 << 20
+	// perPage is the page size of listings
+	perPage = 100
+)
+
+// ErrResponseTooLarge is returned (wrapped) when a response body is larger
+// than the size allowed for it.
+var ErrResponseTooLarge = errors.New("gitlab response exceeds maximum size")
+
+// APIError is returned when the GitLab API responds with a non-2xx status.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("gitlab api returned %d: %s", e.StatusCode, e.Message)
+}
+
+// IsNotFound returns true if err is an APIError with status 404.
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// ClientConfig holds configuration for creating a Client.
+type ClientConfig struct {
+	// BaseURL is the API endpoint (default: DefaultBaseURL), e.g.
+	// https://gitlab.example.com/api/v4 for self-managed instances
+	BaseURL string
+	// HTTPClient is the HTTP client to use (default: 30s timeout)
+	HTTPClient *http.Client
+	// Token is a personal, group, or project access token with the api
+	// scope (required)
+	Token string
+}
+
+// Client is a minimal GitLab REST API client built on net/http.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	token      string
+}
+
+// NewClient creates a new Client.
+func NewClient(cfg ClientConfig) (*Client, error) {
+	if cfg.Token == "" {
+		return nil, fmt.Errorf("token is required")
+	}
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = DefaultBaseURL
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	return &Client{
+		baseURL:    strings.TrimRight(cfg.BaseURL, "/"),
+		httpClient: cfg.HTTPClient,
+		token:      cfg.Token,
+	}, nil
+}
+
+// Project holds the project details the worker needs.
+type Project struct {
+	PathWithNamespace string `json:"path_with_namespace"`
+	DefaultBranch     string `json:"default_branch"`
+	WebURL            string `json:"web_url"`
+}
+
+// GetProject returns a project's default branch and web URL.
+func (c *Client) GetProject(ctx context.Context, owner, repo string) (*Project, error) {
+	var project Project
+	if err := c.doJSON(ctx, http.MethodGet, projectPath(owner, repo), nil, &project); err != nil {
+		return nil, err
+	}
+	return &project, nil
+}
+
+// GetFile returns the raw content of a file at ref (a branch, tag, or SHA).
+// Missing files return an error satisfying IsNotFound.
+func (c *Client) GetFile(ctx context.Context, owner, repo, path, ref string) ([]byte, error) {
+	p := fmt.Sprintf("%s/repository/files/%s/raw?ref=%s", projectPath(owner, repo), escape(path), url.QueryEscape(ref))
+	req, err := c.newRequest(ctx, http.MethodGet, p, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(req, maxFileSize)
+}
+
+// MergeBase returns the SHA of the best common ancestor of two commits,
+// branches, or tags.
+func (c *Client) MergeBase(ctx context.Context, owner, repo, base, head string) (string, error) {
+	p := fmt.Sprintf("%s/repository/merge_base?refs[]=%s&refs[]=%s", projectPath(owner, repo), url.QueryEscape(base), url.QueryEscape(head))
+	var commit struct {
+		ID string `json:"id"`
+	}
+	if err := c.doJSON(ctx, http.MethodGet, p, nil, &commit); err != nil {
+		return "", err
+	}
+	if commit.ID == "" {
+		return "", fmt.Errorf("no merge base of %s and %s", base, head)
+	}
+	return commit.ID, nil
+}
+
+// CompareDiff returns the unified diff from the merge base of two commits,
+// branches, or tags to head, like git diff base...head.
+func (c *Client) CompareDiff(ctx context.Context, owner, repo, base, head string) ([]byte, error) {
+	p := fmt.Sprintf("%s/repository/compare?from=%s&to=%s&straight=false", projectPath(owner, repo), url.QueryEscape(base), url.QueryEscape(head))
+	var comparison struct {
+		Diffs []FileDiff `json:"diffs"`
+	}
+	if err := c.doJSONLimit(ctx, http.MethodGet, p, nil, &comparison, maxDiffSize); err != nil {
+		return nil, err
+	}
+	return UnifiedDiff(comparison.Diffs), nil
+}
+
+// Job is a job of a pipeline.
+type Job struct {
+	ID     int64  `json:"id"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	// ArtifactsFile is the job's artifacts archive; nil if it has none
+	ArtifactsFile *struct {
+		Filename string `json:"filename"`
+		Size     int64  `json:"size"`
+	} `json:"artifacts_file"`
+	// ArtifactsExpireAt is when the archive expires; nil if it is kept
+	ArtifactsExpireAt *time.Time `json:"artifacts_expire_at"`
+}
+
+// ListPipelineJobs returns the jobs of a pipeline.
+func (c *Client) ListPipelineJobs(ctx context.Context, owner, repo string, pipelineID int64) ([]Job, error) {
+	var jobs []Job
+	err := c.listPages(ctx, fmt.Sprintf("%s/pipelines/%d/jobs", projectPath(owner, repo), pipelineID), func(data []byte) (int, error) {
+		var page []Job
+		if err := json.Unmarshal(data, &page); err != nil {
+			return 0, err
+		}
+		jobs = append(jobs, page...)
+		return len(page), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// DownloadJobArtifactsTo streams the artifacts archive (a zip file) of a job
+// to w and returns its size. Archives larger than limit bytes fail with
+// ErrResponseTooLarge (wrapped).
+func (c *Client) DownloadJobArtifactsTo(ctx context.Context, owner, repo string, jobID int64, w io.Writer, limit int64) (int64, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, fmt.Sprintf("%s/jobs/%d/artifacts", projectPath(owner, repo), jobID), nil)
+	if err != nil {
+		return 0, err
+	}
+	return c.doTo(req, w, limit)
+}
+
+// Commit status states.
+const (
+	StatusRunning = "running"
+	StatusSuccess = "success"
+	StatusFailed  = "failed"
+)
+
+// CommitStatus is an external status of a commit, shown on its pipelines
+// and merge requests.
+type CommitStatus struct {
+	// State is one of the Status* constants
+	State       string `json:"state"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	TargetURL   string `json:"target_url,omitempty"`
+}
+
+// maxDescriptionLength is the longest commit status description GitLab
+// accepts.
+const maxDescriptionLength = 255
+
+// SetCommitStatus creates or updates the status of a commit with the
+// status's name. Longer descriptions are truncated.
+func (c *Client) SetCommitStatus(ctx context.Context, owner, repo, sha string, status *CommitStatus) error {
+	s := *status
+	if runes := []rune(s.Description); len(runes) > maxDescriptionLength {
+		s.Description = string(runes[:maxDescriptionLength-1]) + "…"
+	}
+	return c.doJSON(ctx, http.MethodPost, fmt.Sprintf("%s/statuses/%s", projectPath(owner, repo), url.PathEscape(sha)), &s, nil)
+}
+
+// projectPath returns the API path of a project, addressed by its
+// URL-encoded full path.
+func projectPath(owner, repo string) string {
+	return "/projects/" + escape(owner+"/"+repo)
+}
+
+// escape encodes a path as a single URL path segment, as GitLab expects
+// project and file paths.
+func escape(path string) string {
+	return strings.ReplaceAll(url.PathEscape(path), "/", "%2F")
+}
+
+// listPages GETs every page of a listing, handing each to add, which
+// returns the number of items on the page; a short page is the last.
+func (c *Client) listPages(ctx context.Context, path string, add func(data []byte) (int, error)) error {
+	for page := 1; ; page++ {
+		req, err := c.newRequest(ctx, http.MethodGet, fmt.Sprintf("%s?per_page=%d&page=%d", path, perPage, page), nil)
+		if err != nil {
+			return err
+		}
+		data, err := c.do(req, maxJSONSize)
+		if err != nil {
+			return err
+		}
+		n, err := add(data)
+		if err != nil {
+			return fmt.Errorf("failed to decode gitlab response: %w", err)
+		}
+		if n < perPage {
+			return nil
+		}
+	}
+}
+
+// doJSON performs an API request with an optional JSON body, decoding the
+// JSON response into out if it is not nil.
+func (c *Client) doJSON(ctx context.Context, method, path string, body, out any) error {
+	return c.doJSONLimit(ctx, method, path, body, out, maxJSONSize)
+}
+
+// doJSONLimit is like doJSON, with responses bounded to limit bytes.
+func (c *Client) doJSONLimit(ctx context.Context, method, path string, body, out any, limit int64) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := c.newRequest(ctx, method, path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	data, err := c.do(req, limit)
+	if err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to decode gitlab response: %w", err)
+	}
+	return nil
+}
+
+// newRequest creates an authenticated API request.
+func (c *Client) newRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("PRIVATE-TOKEN", c.token)
+	return req, nil
+}
+
+// do sends a request and returns the response body, or an APIError for
+// non-2xx responses. Bodies larger than limit bytes are rejected.
+func (c *Client) do(req *http.Request, limit int64) ([]byte, error) {
+	var body bytes.Buffer
+	if _, err := c.doTo(req, &body, limit); err != nil {
+		return nil, err
+	}
+	return body.Bytes(), nil
+}
+
+// doTo is like do, but streams the response body to w and returns the
+// number of bytes written. A body larger than limit bytes fails with
+// ErrResponseTooLarge (wrapped) after limit+1 bytes were written.
+func (c *Client) doTo(req *http.Request, w io.Writer, limit int64) (n int64, err error) {
+	_, span := tracing.Start(req.Context(), "gitlab "+req.Method, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("http.request.method", req.Method), attribute.String("url.path", req.URL.Path)))
+	defer func() { tracing.End(span, err) }()
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("gitlab request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, min(limit, maxJSONSize)))
+		if err != nil {
+			return 0, fmt.Errorf("failed to read gitlab response: %w", err)
+		}
+		return 0, &APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+	}
+
+	n, err = io.Copy(w, io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return n, fmt.Errorf("failed to read gitlab response: %w", err)
+	}
+	if n > limit {
+		return n, fmt.Errorf("%w of %d bytes", ErrResponseTooLarge, limit)
+	}
+	return n, nil
+}
@@ -0,0 +1,169 @@
+package gitlab
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestClient creates a Client for a test server serving handler.
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	c, err := NewClient(ClientConfig{BaseURL: server.URL + "/api/v4/", Token: "secret"})
+	require.NoError(t, err)
+	return c
+}
+
+func TestNewClient(t *testing.T) {
+	_, err := NewClient(ClientConfig{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "token is required")
+
+	c, err := NewClient(ClientConfig{Token: "t"})
+	require.NoError(t, err)
+	assert.Equal(t, DefaultBaseURL, c.baseURL)
+	assert.NotNil(t, c.httpClient)
+}
+
+func TestClient_GetProject(t *testing.T) {
+	var gotPath, gotToken string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.EscapedPath()
+		gotToken = r.Header.Get("PRIVATE-TOKEN")
+		w.Write([]byte(`{"path_with_namespace":"acme/tools/widgets","default_branch":"main","web_url":"https://gitlab.com/acme/tools/widgets"}`))
+	})
+
+	project, err := c.GetProject(context.Background(), "acme/tools", "widgets")
+	require.NoError(t, err)
+	assert.Equal(t, &Project{PathWithNamespace: "acme/tools/widgets", DefaultBranch: "main", WebURL: "https://gitlab.com/acme/tools/widgets"}, project)
+	assert.Equal(t, "/api/v4/projects/acme%2Ftools%2Fwidgets", gotPath)
+	assert.Equal(t, "secret", gotToken)
+}
+
+func TestClient_GetFile(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		expectedData string
+		notFound     bool
+	}{
+		{name: "found", status: http.StatusOK, expectedData: "module example.com/widgets\n"},
+		{name: "missing", status: http.StatusNotFound, notFound: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotPath, gotRef string
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				gotPath, gotRef = r.URL.EscapedPath(), r.URL.Query().Get("ref")
+				w.WriteHeader(tt.status)
+				if tt.status == http.StatusOK {
+					w.Write([]byte(tt.expectedData))
+				} else {
+					w.Write([]byte(`{"message":"404 File Not Found"}`))
+				}
+			})
+
+			data, err := c.GetFile(context.Background(), "acme", "widgets", "config/.canopy.yml", "feature/mul")
+			assert.Equal(t, "/api/v4/projects/acme%2Fwidgets/repository/files/config%2F.canopy.yml/raw", gotPath)
+			assert.Equal(t, "feature/mul", gotRef)
+			if tt.notFound {
+				require.Error(t, err)
+				assert.True(t, IsNotFound(err))
+				assert.Contains(t, err.Error(), "gitlab api returned 404")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedData, string(data))
+		})
+	}
+}
+
+func TestClient_ListPipelineJobs(t *testing.T) {
+	var pages []string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v4/projects/acme%2Fwidgets/pipelines/31/jobs", r.URL.EscapedPath())
+		page := r.URL.Query().Get("page")
+		pages = append(pages, page)
+		var jobs []map[string]any
+		switch page {
+		case "1":
+			for i := range perPage {
+				jobs = append(jobs, map[string]any{"id": i + 1, "name": fmt.Sprintf("job-%d", i+1)})
+			}
+		case "2":
+			jobs = append(jobs, map[string]any{"id": 500, "name": "coverage", "status": "success", "artifacts_file": map[string]any{"filename": "artifacts.zip", "size": 2048}})
+		}
+		json.NewEncoder(w).Encode(jobs)
+	})
+
+	jobs, err := c.ListPipelineJobs(context.Background(), "acme", "widgets", 31)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "2"}, pages)
+	require.Len(t, jobs, perPage+1)
+	last := jobs[perPage]
+	assert.Equal(t, int64(500), last.ID)
+	assert.Equal(t, "coverage", last.Name)
+	require.NotNil(t, last.ArtifactsFile)
+	assert.Equal(t, int64(2048), last.ArtifactsFile.Size)
+	assert.Nil(t, jobs[0].ArtifactsFile)
+}
+
+func TestClient_DownloadJobArtifactsTo(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v4/projects/acme%2Fwidgets/jobs/500/artifacts", r.URL.EscapedPath())
+		w.Write([]byte("PK\x03\x04archive"))
+	})
+
+	var buf bytes.Buffer
+	n, err := c.DownloadJobArtifactsTo(context.Background(), "acme", "widgets", 500, &buf, 1024)
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), n)
+	assert.Equal(t, "PK\x03\x04archive", buf.String())
+
+	_, err = c.DownloadJobArtifactsTo(context.Background(), "acme", "widgets", 500, &bytes.Buffer{}, 4)
+	require.ErrorIs(t, err, ErrResponseTooLarge)
+}
+
+func TestClient_SetCommitStatus(t *testing.T) {
+	var gotPath string
+	var got CommitStatus
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		gotPath = r.URL.EscapedPath()
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{}`))
+	})
+
+	status := &CommitStatus{State: StatusFailed, Name: "canopy/coverage", Description: strings.Repeat("x", 300)}
+	require.NoError(t, c.SetCommitStatus(context.Background(), "acme", "widgets", "3f2a9c1e", status))
+	assert.Equal(t, "/api/v4/projects/acme%2Fwidgets/statuses/3f2a9c1e", gotPath)
+	assert.Equal(t, StatusFailed, got.State)
+	assert.Equal(t, "canopy/coverage", got.Name)
+	assert.Len(t, []rune(got.Description), maxDescriptionLength)
+	assert.True(t, strings.HasSuffix(got.Description, "…"))
+	assert.Len(t, status.Description, 300, "the caller's status is not modified")
+}
+
+func TestClient_MergeBase(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v4/projects/acme%2Fwidgets/repository/merge_base", r.URL.EscapedPath())
+		assert.Equal(t, []string{"main", "feature/mul"}, r.URL.Query()["refs[]"])
+		w.Write([]byte(`{"id":"9e8d7c6b"}`))
+	})
+
+	sha, err := c.MergeBase(context.Background(), "acme", "widgets", "main", "feature/mul")
+	require.NoError(t, err)
+	assert.Equal(t, "9e8d7c6b", sha)
+}
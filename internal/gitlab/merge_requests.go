@@ -0,0 +1,192 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DiffRefs are the commits a merge request's diff is taken between, which
+// position inline discussions.
+type DiffRefs struct {
+	BaseSHA  string `json:"base_sha"`
+	StartSHA string `json:"start_sha"`
+	HeadSHA  string `json:"head_sha"`
+}
+
+// MergeRequest holds the merge request details the worker needs.
+type MergeRequest struct {
+	IID int `json:"iid"`
+	// SHA is the head commit of the source branch
+	SHA      string   `json:"sha"`
+	DiffRefs DiffRefs `json:"diff_refs"`
+	WebURL   string   `json:"web_url"`
+}
+
+// GetMergeRequest returns a merge request by its project-level ID.
+func (c *Client) GetMergeRequest(ctx context.Context, owner, repo string, iid int) (*MergeRequest, error) {
+	var mr MergeRequest
+	if err := c.doJSON(ctx, http.MethodGet, mergeRequestPath(owner, repo, iid), nil, &mr); err != nil {
+		return nil, err
+	}
+	return &mr, nil
+}
+
+// FileDiff is the diff of a file, as listed by GitLab; Diff holds its hunks.
+type FileDiff struct {
+	OldPath     string `json:"old_path"`
+	NewPath     string `json:"new_path"`
+	AMode       string `json:"a_mode"`
+	BMode       string `json:"b_mode"`
+	Diff        string `json:"diff"`
+	NewFile     bool   `json:"new_file"`
+	RenamedFile bool   `json:"renamed_file"`
+	DeletedFile bool   `json:"deleted_file"`
+}
+
+// UnifiedDiff renders file diffs as a git-style unified diff, as
+// coverage.ParseDiff reads it.
+func UnifiedDiff(files []FileDiff) []byte {
+	var b strings.Builder
+	for _, f := range files {
+		fmt.Fprintf(&b, "diff --git a/%s b/%s\n", f.OldPath, f.NewPath)
+		oldName, newName := "a/"+f.OldPath, "b/"+f.NewPath
+		switch {
+		case f.NewFile:
+			fmt.Fprintf(&b, "new file mode %s\n", f.BMode)
+			oldName = "/dev/null"
+		case f.DeletedFile:
+			fmt.Fprintf(&b, "deleted file mode %s\n", f.AMode)
+			newName = "/dev/null"
+		case f.RenamedFile:
+			fmt.Fprintf(&b, "rename from %s\nrename to %s\n", f.OldPath, f.NewPath)
+		}
+		if f.Diff == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+		b.WriteString(f.Diff)
+		if !strings.HasSuffix(f.Diff, "\n") {
+			b.WriteString("\n")
+		}
+	}
+	return []byte(b.String())
+}
+
+// MergeRequestDiff returns the unified diff of a merge request.
+func (c *Client) MergeRequestDiff(ctx context.Context, owner, repo string, iid int) ([]byte, error) {
+	var files []FileDiff
+	size := 0
+	err := c.listPages(ctx, mergeRequestPath(owner, repo, iid)+"/diffs", func(data []byte) (int, error) {
+		if size += len(data); size > maxDiffSize {
+			return 0, fmt.Errorf("%w of %d bytes", ErrResponseTooLarge, maxDiffSize)
+		}
+		var page []FileDiff
+		if err := json.Unmarshal(data, &page); err != nil {
+			return 0, err
+		}
+		files = append(files, page...)
+		return len(page), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return UnifiedDiff(files), nil
+}
+
+// Note is a comment on a merge request.
+type Note struct {
+	ID   int64  `json:"id"`
+	Body string `json:"body"`
+	// System notes are written by GitLab, e.g. for pushes
+	System bool `json:"system"`
+}
+
+// ListMergeRequestNotes returns the notes of a merge request.
+func (c *Client) ListMergeRequestNotes(ctx context.Context, owner, repo string, iid int) ([]Note, error) {
+	var notes []Note
+	err := c.listPages(ctx, mergeRequestPath(owner, repo, iid)+"/notes", func(data []byte) (int, error) {
+		var page []Note
+		if err := json.Unmarshal(data, &page); err != nil {
+			return 0, err
+		}
+		notes = append(notes, page...)
+		return len(page), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return notes, nil
+}
+
+// CreateMergeRequestNote adds a note to a merge request.
+func (c *Client) CreateMergeRequestNote(ctx context.Context, owner, repo string, iid int, body string) error {
+	return c.doJSON(ctx, http.MethodPost, mergeRequestPath(owner, repo, iid)+"/notes", map[string]string{"body": body}, nil)
+}
+
+// UpdateMergeRequestNote replaces the body of a merge request note.
+func (c *Client) UpdateMergeRequestNote(ctx context.Context, owner, repo string, iid int, noteID int64, body string) error {
+	path := fmt.Sprintf("%s/notes/%d", mergeRequestPath(owner, repo, iid), noteID)
+	return c.doJSON(ctx, http.MethodPut, path, map[string]string{"body": body}, nil)
+}
+
+// Position places a discussion on a line of a merge request's diff.
+type Position struct {
+	// PositionType is "text"; set by CreateMergeRequestDiscussion
+	PositionType string `json:"position_type"`
+	BaseSHA      string `json:"base_sha"`
+	StartSHA     string `json:"start_sha"`
+	HeadSHA      string `json:"head_sha"`
+	OldPath      string `json:"old_path,omitempty"`
+	NewPath      string `json:"new_path"`
+	// NewLine is the line of the new file, which must be in the diff
+	NewLine int `json:"new_line"`
+}
+
+// Discussion is a thread of notes on a merge request; inline discussions
+// have a position on their first note.
+type Discussion struct {
+	ID    string `json:"id"`
+	Notes []struct {
+		Body     string    `json:"body"`
+		Position *Position `json:"position"`
+	} `json:"notes"`
+}
+
+// ListMergeRequestDiscussions returns the discussions of a merge request.
+func (c *Client) ListMergeRequestDiscussions(ctx context.Context, owner, repo string, iid int) ([]Discussion, error) {
+	var discussions []Discussion
+	err := c.listPages(ctx, mergeRequestPath(owner, repo, iid)+"/discussions", func(data []byte) (int, error) {
+		var page []Discussion
+		if err := json.Unmarshal(data, &page); err != nil {
+			return 0, err
+		}
+		discussions = append(discussions, page...)
+		return len(page), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return discussions, nil
+}
+
+// CreateMergeRequestDiscussion starts a discussion on a line of a merge
+// request's diff.
+func (c *Client) CreateMergeRequestDiscussion(ctx context.Context, owner, repo string, iid int, body string, position Position) error {
+	position.PositionType = "text"
+	if position.OldPath == "" {
+		position.OldPath = position.NewPath
+	}
+	payload := struct {
+		Body     string   `json:"body"`
+		Position Position `json:"position"`
+	}{body, position}
+	return c.doJSON(ctx, http.MethodPost, mergeRequestPath(owner, repo, iid)+"/discussions", &payload, nil)
+}
+
+// mergeRequestPath returns the API path of a merge request.
+func mergeRequestPath(owner, repo string, iid int) string {
+	return fmt.Sprintf("%s/merge_requests/%d", projectPath(owner, repo), iid)
+}
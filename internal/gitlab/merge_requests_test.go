@@ -0,0 +1,109 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    []FileDiff
+		expected string
+	}{
+		{
+			name:     "modified file",
+			files:    []FileDiff{{OldPath: "calc.go", NewPath: "calc.go", Diff: "@@ -1,2 +1,3 @@\n a\n+b\n c"}},
+			expected: "diff --git a/calc.go b/calc.go\n--- a/calc.go\n+++ b/calc.go\n@@ -1,2 +1,3 @@\n a\n+b\n c\n",
+		},
+		{
+			name:     "new file",
+			files:    []FileDiff{{OldPath: "mul.go", NewPath: "mul.go", BMode: "100644", NewFile: true, Diff: "@@ -0,0 +1 @@\n+package calc\n"}},
+			expected: "diff --git a/mul.go b/mul.go\nnew file mode 100644\n--- /dev/null\n+++ b/mul.go\n@@ -0,0 +1 @@\n+package calc\n",
+		},
+		{
+			name:     "deleted file",
+			files:    []FileDiff{{OldPath: "div.go", NewPath: "div.go", AMode: "100644", DeletedFile: true, Diff: "@@ -1 +0,0 @@\n-package calc\n"}},
+			expected: "diff --git a/div.go b/div.go\ndeleted file mode 100644\n--- a/div.go\n+++ /dev/null\n@@ -1 +0,0 @@\n-package calc\n",
+		},
+		{
+			name:     "pure rename",
+			files:    []FileDiff{{OldPath: "old.go", NewPath: "new.go", RenamedFile: true}},
+			expected: "diff --git a/old.go b/new.go\nrename from old.go\nrename to new.go\n",
+		},
+		{name: "no files", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, string(UnifiedDiff(tt.files)))
+		})
+	}
+}
+
+func TestClient_MergeRequestDiff(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v4/projects/acme%2Fwidgets/merge_requests/17/diffs", r.URL.EscapedPath())
+		w.Write([]byte(`[{"old_path":"calc.go","new_path":"calc.go","diff":"@@ -1 +1,2 @@\n a\n+b\n"}]`))
+	})
+
+	diff, err := c.MergeRequestDiff(context.Background(), "acme", "widgets", 17)
+	require.NoError(t, err)
+	assert.Equal(t, "diff --git a/calc.go b/calc.go\n--- a/calc.go\n+++ b/calc.go\n@@ -1 +1,2 @@\n a\n+b\n", string(diff))
+}
+
+func TestClient_MergeRequestNotes(t *testing.T) {
+	type call struct{ method, path, body string }
+	var calls []call
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Body string `json:"body"`
+		}
+		if r.Method != http.MethodGet {
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		}
+		calls = append(calls, call{r.Method, r.URL.EscapedPath(), body.Body})
+		if r.Method == http.MethodGet {
+			w.Write([]byte(`[{"id":7,"body":"LGTM"},{"id":8,"body":"merged","system":true}]`))
+			return
+		}
+		w.Write([]byte(`{}`))
+	})
+	ctx := context.Background()
+
+	notes, err := c.ListMergeRequestNotes(ctx, "acme", "widgets", 17)
+	require.NoError(t, err)
+	assert.Equal(t, []Note{{ID: 7, Body: "LGTM"}, {ID: 8, Body: "merged", System: true}}, notes)
+	require.NoError(t, c.CreateMergeRequestNote(ctx, "acme", "widgets", 17, "coverage"))
+	require.NoError(t, c.UpdateMergeRequestNote(ctx, "acme", "widgets", 17, 7, "coverage v2"))
+
+	assert.Equal(t, []call{
+		{http.MethodGet, "/api/v4/projects/acme%2Fwidgets/merge_requests/17/notes", ""},
+		{http.MethodPost, "/api/v4/projects/acme%2Fwidgets/merge_requests/17/notes", "coverage"},
+		{http.MethodPut, "/api/v4/projects/acme%2Fwidgets/merge_requests/17/notes/7", "coverage v2"},
+	}, calls)
+}
+
+func TestClient_CreateMergeRequestDiscussion(t *testing.T) {
+	var got struct {
+		Body     string   `json:"body"`
+		Position Position `json:"position"`
+	}
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/api/v4/projects/acme%2Fwidgets/merge_requests/17/discussions", r.URL.EscapedPath())
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{}`))
+	})
+
+	position := Position{BaseSHA: "b", StartSHA: "s", HeadSHA: "h", NewPath: "mul.go", NewLine: 12}
+	require.NoError(t, c.CreateMergeRequestDiscussion(context.Background(), "acme", "widgets", 17, "Line 12 is not covered", position))
+	assert.Equal(t, "Line 12 is not covered", got.Body)
+	assert.Equal(t, Position{PositionType: "text", BaseSHA: "b", StartSHA: "s", HeadSHA: "h", OldPath: "mul.go", NewPath: "mul.go", NewLine: 12}, got.Position)
+}
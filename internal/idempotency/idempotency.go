@@ -0,0 +1,65 @@
+// Package idempotency detects work requests delivered more than once, by a
+// GitHub webhook redelivery or a queue redelivery, so their workflow runs
+// are processed, and their check runs posted, once.
+package idempotency
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/queue"
+)
+
+// Status is the state of a key when it is claimed.
+type Status int
+
+const (
+	// Claimed means the key was free and the caller now holds it.
+	Claimed Status = iota
+	// InProgress means another delivery holds the key.
+	InProgress
+	// Done means a delivery of the key was processed.
+	Done
+)
+
+// String returns the name of the status.
+func (s Status) String() string {
+	switch s {
+	case Claimed:
+		return "claimed"
+	case InProgress:
+		return "in_progress"
+	case Done:
+		return "done"
+	default:
+		return "unknown"
+	}
+}
+
+// Store records which work requests are being processed and which were.
+type Store interface {
+	// Claim holds key for up to lease, unless it is already held or done,
+	// and reports the key's status before the call.
+	Claim(ctx context.Context, key string, lease time.Duration) (Status, error)
+
+	// Complete marks a claimed key done for ttl, so later claims report Done.
+	Complete(ctx context.Context, key string, ttl time.Duration) error
+
+	// Release frees a claimed key, so a later delivery can claim it.
+	Release(ctx context.Context, key string) error
+
+	// Close releases any resources held by the store.
+	Close() error
+}
+
+// Key returns the key deliveries of a work request share: its repository,
+// workflow run, and correlation ID (the webhook delivery ID). A re-run of a
+// workflow is delivered with a new ID, so it is processed again. Requests
+// without a correlation ID have no key and can't be deduplicated.
+func Key(req *queue.WorkRequest) string {
+	if req.CorrelationID == "" {
+		return ""
+	}
+	return req.Org + "/" + req.Repo + "/" + strconv.FormatInt(req.WorkflowRunID, 10) + "/" + req.CorrelationID
+}
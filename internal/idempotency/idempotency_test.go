@@ -0,0 +1,39 @@
+package idempotency
+
+import (
+	"testing"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/queue"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		req      queue.WorkRequest
+		expected string
+	}{
+		{
+			name:     "delivery of a run",
+			req:      queue.WorkRequest{Org: "acme", Repo: "widgets", WorkflowRunID: 42, CorrelationID: "72d3162e"},
+			expected: "acme/widgets/42/72d3162e",
+		},
+		{
+			name: "no correlation ID",
+			req:  queue.WorkRequest{Org: "acme", Repo: "widgets", WorkflowRunID: 42},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Key(&tt.req))
+		})
+	}
+}
+
+func TestStatus_String(t *testing.T) {
+	assert.Equal(t, "claimed", Claimed.String())
+	assert.Equal(t, "in_progress", InProgress.String())
+	assert.Equal(t, "done", Done.String())
+	assert.Equal(t, "unknown", Status(7).String())
+}
@@ -0,0 +1,76 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/clock"
+)
+
+// InMemoryStore implements Store with a map.
+// It only detects duplicates delivered to a single process, which suits
+// all-in-one mode and testing.
+type InMemoryStore struct {
+	// Clock is the time source for expiry (nil uses the system clock)
+	Clock clock.Clock
+
+	mu   sync.Mutex
+	keys map[string]entry
+}
+
+// entry is the status of a key and when it expires.
+type entry struct {
+	status  Status
+	expires time.Time
+}
+
+// NewInMemoryStore creates an empty InMemoryStore.
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{
+		keys: make(map[string]entry),
+	}
+}
+
+// Claim holds key for up to lease, unless it is already held or done.
+func (s *InMemoryStore) Claim(ctx context.Context, key string, lease time.Duration) (Status, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := clock.Or(s.Clock).Now()
+	s.expire(now)
+	if e, ok := s.keys[key]; ok {
+		return e.status, nil
+	}
+	s.keys[key] = entry{status: InProgress, expires: now.Add(lease)}
+	return Claimed, nil
+}
+
+// Complete marks key done for ttl.
+func (s *InMemoryStore) Complete(ctx context.Context, key string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[key] = entry{status: Done, expires: clock.Or(s.Clock).Now().Add(ttl)}
+	return nil
+}
+
+// Release frees key.
+func (s *InMemoryStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, key)
+	return nil
+}
+
+// Close is a no-op.
+func (s *InMemoryStore) Close() error {
+	return nil
+}
+
+// expire forgets the keys that expired by now.
+func (s *InMemoryStore) expire(now time.Time) {
+	for key, e := range s.keys {
+		if !now.Before(e.expires) {
+			delete(s.keys, key)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package idempotency
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	s := NewInMemoryStore()
+	s.Clock = clock.Fixed(now)
+	defer s.Close()
+
+	claim := func(key string) Status {
+		t.Helper()
+		status, err := s.Claim(ctx, key, time.Minute)
+		require.NoError(t, err)
+		return status
+	}
+
+	// A claimed key is in progress until it is completed or released
+	assert.Equal(t, Claimed, claim("a"))
+	assert.Equal(t, InProgress, claim("a"))
+	require.NoError(t, s.Complete(ctx, "a", time.Hour))
+	assert.Equal(t, Done, claim("a"))
+
+	assert.Equal(t, Claimed, claim("b"))
+	require.NoError(t, s.Release(ctx, "b"))
+	assert.Equal(t, Claimed, claim("b"))
+
+	// Leases and completions expire
+	s.Clock = clock.Fixed(now.Add(2 * time.Minute))
+	assert.Equal(t, Claimed, claim("b"))
+	assert.Equal(t, Done, claim("a"))
+	s.Clock = clock.Fixed(now.Add(time.Hour))
+	assert.Equal(t, Claimed, claim("a"))
+}
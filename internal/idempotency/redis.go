@@ -0,0 +1,119 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Values of keys in Redis.
+const (
+	redisInProgress = "in_progress"
+	redisDone       = "done"
+)
+
+// RedisStore implements Store using Redis, so every worker sharing the
+// Redis instance detects duplicates. Keys are stored under
+// <KeyPrefix>:<key> and expire with their lease or TTL.
+type RedisStore struct {
+	client    *redis.Client
+	keyPrefix string
+}
+
+// RedisConfig holds configuration for creating a RedisStore.
+type RedisConfig struct {
+	// Address is the Redis server address (host:port)
+	Address string
+
+	// Password is the Redis password (optional)
+	Password string
+
+	// DB is the Redis database number (default: 0)
+	DB int
+
+	// KeyPrefix namespaces idempotency keys (default: "canopy:idempotency")
+	KeyPrefix string
+}
+
+// NewRedisStore creates a new RedisStore instance.
+// The caller is responsible for calling Close() when done.
+func NewRedisStore(ctx context.Context, cfg RedisConfig) (*RedisStore, error) {
+	if cfg.Address == "" {
+		return nil, fmt.Errorf("redis address is required")
+	}
+	if cfg.KeyPrefix == "" {
+		cfg.KeyPrefix = "canopy:idempotency"
+	}
+
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Address,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+
+	// Test connection
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+
+	return &RedisStore{
+		client:    client,
+		keyPrefix: cfg.KeyPrefix,
+	}, nil
+}
+
+// Claim holds key for up to lease, unless it is already held or done.
+func (s *RedisStore) Claim(ctx context.Context, key string, lease time.Duration) (Status, error) {
+	claimed, err := s.client.SetNX(ctx, s.redisKey(key), redisInProgress, lease).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim idempotency key in redis: %w", err)
+	}
+	if claimed {
+		return Claimed, nil
+	}
+
+	value, err := s.client.Get(ctx, s.redisKey(key)).Result()
+	if errors.Is(err, redis.Nil) {
+		// Released or expired since; the next delivery can claim it
+		return InProgress, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read idempotency key from redis: %w", err)
+	}
+	if value == redisDone {
+		return Done, nil
+	}
+	return InProgress, nil
+}
+
+// Complete marks key done for ttl.
+func (s *RedisStore) Complete(ctx context.Context, key string, ttl time.Duration) error {
+	if err := s.client.Set(ctx, s.redisKey(key), redisDone, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to complete idempotency key in redis: %w", err)
+	}
+	return nil
+}
+
+// Release frees key.
+func (s *RedisStore) Release(ctx context.Context, key string) error {
+	if err := s.client.Del(ctx, s.redisKey(key)).Err(); err != nil {
+		return fmt.Errorf("failed to release idempotency key in redis: %w", err)
+	}
+	return nil
+}
+
+// Close closes the Redis client connection.
+func (s *RedisStore) Close() error {
+	if err := s.client.Close(); err != nil {
+		return fmt.Errorf("failed to close redis client: %w", err)
+	}
+	return nil
+}
+
+func (s *RedisStore) redisKey(key string) string {
+	return s.keyPrefix + ":" + key
+}
@@ -0,0 +1,30 @@
+package idempotency
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRedisStore_Validation(t *testing.T) {
+	_, err := NewRedisStore(context.Background(), RedisConfig{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "redis address is required")
+}
+
+func TestNewRedisStore_ConnectionError(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	_, err := NewRedisStore(ctx, RedisConfig{Address: "localhost:1"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to connect to redis")
+}
+
+func TestRedisStore_Keys(t *testing.T) {
+	s := &RedisStore{keyPrefix: "canopy:idempotency"}
+	assert.Equal(t, "canopy:idempotency:acme/widgets/42/72d3162e", s.redisKey("acme/widgets/42/72d3162e"))
+}
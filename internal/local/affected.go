@@ -0,0 +1,157 @@
+package local
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+)
+
+// listedPackage is a package as listed by go list -test -json.
+type listedPackage struct {
+	ImportPath string
+	Name       string
+	Dir        string
+	ForTest    string
+	Deps       []string
+	Error      *struct {
+		Err string
+	}
+}
+
+// Affected returns the import paths of the packages affected by the diff
+// (see AffectedPackages).
+func (r *Runner) Affected(ctx context.Context) ([]string, error) {
+	diffData, err := r.readDiff(ctx)
+	if err != nil {
+		return nil, err
+	}
+	packages, err := AffectedPackages(ctx, diffData, r.config.SourceRoot)
+	if err != nil {
+		if err := canceled(ctx); err != nil {
+			return nil, err
+		}
+		return nil, newError(KindEnvironment, "failed to find affected packages: %w", err)
+	}
+	return packages, nil
+}
+
+// readDiff returns the diff of the Runner's diff source.
+func (r *Runner) readDiff(ctx context.Context) ([]byte, error) {
+	diffData, err := r.diffSource.GetDiff(ctx)
+	if err != nil {
+		if err := canceled(ctx); err != nil {
+			return nil, err
+		}
+		return nil, newError(KindEnvironment, "failed to get diff: %w", err)
+	}
+	return diffData, nil
+}
+
+// AffectedPackages returns the sorted import paths of the packages of the
+// module at root whose tests could cover the lines changed in a diff: the
+// packages with changed Go files, and the packages whose tests depend on
+// one of them, directly or through other packages, as listed by go list
+// -test. A changed go.mod or go.sum affects every package.
+func AffectedPackages(ctx context.Context, diffData []byte, root string) ([]string, error) {
+	if len(diffData) == 0 {
+		return nil, nil
+	}
+	fileDiffs, err := coverage.ParseDiff(diffData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse diff: %w", err)
+	}
+	packages, err := listPackages(ctx, root)
+	if err != nil {
+		return nil, err
+	}
+
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", root, err)
+	}
+	byDir := make(map[string]string)
+	for _, pkg := range packages {
+		if pkg.ForTest == "" && !isTestMain(pkg) {
+			byDir[pkg.Dir] = pkg.ImportPath
+		}
+	}
+
+	changed := make(map[string]bool)
+	for _, fd := range fileDiffs {
+		switch name := fd.NewName; {
+		case name == "go.mod" || name == "go.sum":
+			return slices.Sorted(maps.Values(byDir)), nil
+		case path.Ext(name) == ".go":
+			// Deleted files leave their package changed too
+			dir := filepath.Join(absRoot, filepath.FromSlash(path.Dir(name)))
+			if importPath, ok := byDir[dir]; ok {
+				changed[importPath] = true
+			}
+		}
+	}
+
+	affected := maps.Clone(changed)
+	for _, pkg := range packages {
+		if !isTestMain(pkg) {
+			continue
+		}
+		for _, dep := range pkg.Deps {
+			// Test variants are listed as "import/path [tested.test]"
+			dep, _, _ = strings.Cut(dep, " ")
+			if changed[dep] {
+				affected[strings.TrimSuffix(pkg.ImportPath, ".test")] = true
+				break
+			}
+		}
+	}
+
+	return slices.Sorted(maps.Keys(affected)), nil
+}
+
+// listPackages lists the packages of the module at root with their tests
+// and dependencies.
+func listPackages(ctx context.Context, root string) ([]listedPackage, error) {
+	cmd := exec.CommandContext(ctx, "go", "list", "-e", "-test", "-json=ImportPath,Name,Dir,ForTest,Deps,Error", "./...")
+	cmd.Dir = root
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list packages: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var packages []listedPackage
+	decoder := json.NewDecoder(bytes.NewReader(output))
+	for {
+		var pkg listedPackage
+		if err := decoder.Decode(&pkg); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to decode go list output: %w", err)
+		}
+		// With -e, packages that don't build are listed with their error,
+		// but a pattern matching nothing, e.g. outside a module, is too
+		if pkg.Error != nil && pkg.Dir == "" {
+			return nil, fmt.Errorf("failed to list packages: %s", pkg.Error.Err)
+		}
+		packages = append(packages, pkg)
+	}
+	return packages, nil
+}
+
+// isTestMain reports whether pkg is the generated main package of a test
+// binary, whose dependencies are everything the tests of a package import.
+func isTestMain(pkg listedPackage) bool {
+	return pkg.Name == "main" && strings.HasSuffix(pkg.ImportPath, ".test")
+}
@@ -0,0 +1,94 @@
+package local
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAffectedPackages(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/shop\n\ngo 1.21\n",
+		// price is used by cart, whose tests are affected by it, and by
+		// checkout only through cart
+		"price/price.go":          "package price\n\nfunc Total(a, b int) int { return a + b }\n",
+		"price/price_test.go":     "package price\n\nimport \"testing\"\n\nfunc TestTotal(t *testing.T) {}\n",
+		"cart/cart.go":            "package cart\n\nimport \"example.com/shop/price\"\n\nfunc Sum() int { return price.Total(1, 2) }\n",
+		"cart/cart_test.go":       "package cart_test\n\nimport \"testing\"\n\nfunc TestSum(t *testing.T) {}\n",
+		"checkout/checkout.go":    "package checkout\n",
+		"checkout/flow_test.go":   "package checkout\n\nimport (\n\t\"testing\"\n\n\t\"example.com/shop/cart\"\n)\n\nfunc TestFlow(t *testing.T) { cart.Sum() }\n",
+		"catalog/catalog.go":      "package catalog\n",
+		"catalog/catalog_test.go": "package catalog\n\nimport \"testing\"\n\nfunc TestCatalog(t *testing.T) {}\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	fileDiff := func(name string) string {
+		return "diff --git a/" + name + " b/" + name + "\n--- a/" + name + "\n+++ b/" + name + "\n@@ -0,0 +1 @@\n+x\n"
+	}
+
+	tests := []struct {
+		name     string
+		diff     string
+		expected []string
+	}{
+		{
+			name:     "reverse dependencies",
+			diff:     fileDiff("price/price.go"),
+			expected: []string{"example.com/shop/cart", "example.com/shop/checkout", "example.com/shop/price"},
+		},
+		{
+			name:     "imported only by tests",
+			diff:     fileDiff("cart/cart.go"),
+			expected: []string{"example.com/shop/cart", "example.com/shop/checkout"},
+		},
+		{
+			name:     "leaf package",
+			diff:     fileDiff("catalog/catalog_test.go") + fileDiff("README.md"),
+			expected: []string{"example.com/shop/catalog"},
+		},
+		{
+			name:     "go.mod affects every package",
+			diff:     fileDiff("go.mod"),
+			expected: []string{"example.com/shop/cart", "example.com/shop/catalog", "example.com/shop/checkout", "example.com/shop/price"},
+		},
+		{name: "no Go files", diff: fileDiff("README.md")},
+		{name: "empty diff"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packages, err := AffectedPackages(context.Background(), []byte(tt.diff), root)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, packages)
+		})
+	}
+}
+
+func TestAffectedPackages_NotAModule(t *testing.T) {
+	diffData := []byte("diff --git a/main.go b/main.go\n--- a/main.go\n+++ b/main.go\n@@ -0,0 +1 @@\n+x\n")
+	_, err := AffectedPackages(context.Background(), diffData, t.TempDir())
+	assert.ErrorContains(t, err, "failed to list packages")
+}
+
+func TestRunner_RunTests_Affected(t *testing.T) {
+	root := writeModule(t)
+	diffData := []byte("diff --git a/calc/calc.go b/calc/calc.go\n--- a/calc/calc.go\n+++ b/calc/calc.go\n@@ -5,0 +6,4 @@\n+\n+func Sub(a, b int) int {\n+\treturn a - b\n+}\n")
+
+	var testOutput bytes.Buffer
+	runner := NewRunner(Config{Format: "JSON", SourceRoot: root},
+		WithDiffSource(&stubDiffSource{diff: diffData}), WithOutput(io.Discard))
+	err := runner.RunTests(context.Background(), TestRun{Affected: true, Output: &testOutput})
+	require.NoError(t, err, testOutput.String())
+	assert.Contains(t, testOutput.String(), " example.com/calc/calc\n")
+	assert.NotContains(t, testOutput.String(), "broken")
+}
@@ -0,0 +1,183 @@
+package local
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+)
+
+// cacheVersion is bumped when cached analyses change shape or meaning,
+// so entries written by older versions are no longer used.
+const cacheVersion = 1
+
+// DefaultCacheMaxBytes is the size the analysis cache is bounded to unless
+// Config.CacheMaxBytes is set.
+const DefaultCacheMaxBytes = 256 << 20
+
+// analysisCache stores analyses of coverage as JSON files in a directory,
+// so repeated runs over the same diff and coverage files, e.g. with another
+// --format, skip parsing, merging, and analyzing the coverage. Suppressions
+// are applied after loading, since they depend on the time. Storing an
+// entry evicts the least recently used ones beyond maxBytes. A nil cache
+// stores nothing.
+type analysisCache struct {
+	dir      string
+	maxBytes int64
+}
+
+// cachedAnalysis is an entry of the analysis cache.
+type cachedAnalysis struct {
+	Profiles []*coverage.Profile      `json:"profiles"`
+	Result   *coverage.AnalysisResult `json:"result"`
+}
+
+// analysisCache returns the cache of Config.CacheDir, or nil if it is empty.
+func (r *Runner) analysisCache() *analysisCache {
+	if r.config.CacheDir == "" {
+		return nil
+	}
+	maxBytes := r.config.CacheMaxBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultCacheMaxBytes
+	}
+	return &analysisCache{dir: r.config.CacheDir, maxBytes: maxBytes}
+}
+
+// analysisCacheKey hashes everything an analysis depends on: the Canopy
+// version, the input format, the added lines of the diff (after filtering),
+// the go.mod coverage paths are normalized with, and the coverage files.
+func analysisCacheKey(version, inputFormat string, addedLinesByFile map[string][]int, gomod []byte, files []coverageFile) (string, error) {
+	// Map keys are sorted, so equal maps encode identically
+	added, err := json.Marshal(addedLinesByFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode added lines: %w", err)
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "canopy analysis v%d\n", cacheVersion)
+	writeCacheField(h, []byte(version))
+	writeCacheField(h, []byte(inputFormat))
+	writeCacheField(h, added)
+	writeCacheField(h, gomod)
+	for _, file := range files {
+		writeCacheField(h, []byte(filepath.Base(file.path)))
+		writeCacheField(h, file.digest)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeCacheField writes a length-prefixed field to h, so fields can't run
+// into each other.
+func writeCacheField(h hash.Hash, data []byte) {
+	fmt.Fprintf(h, "%d:", len(data))
+	h.Write(data)
+}
+
+// path returns the file the analysis of key is stored in.
+func (c *analysisCache) path(key string) string {
+	return filepath.Join(c.dir, key+".json")
+}
+
+// load returns the analysis stored under key. Missing and unreadable
+// entries are misses.
+func (c *analysisCache) load(key string) (*cachedAnalysis, bool) {
+	if c == nil {
+		return nil, false
+	}
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+	var entry cachedAnalysis
+	if err := json.Unmarshal(data, &entry); err != nil || entry.Result == nil {
+		return nil, false
+	}
+	// Entries are evicted by modification time, so a used entry is kept
+	now := time.Now()
+	_ = os.Chtimes(c.path(key), now, now)
+	return &entry, true
+}
+
+// store saves an analysis under key. The entry is written to a temporary
+// file and renamed, so concurrent runs never read a partial entry.
+func (c *analysisCache) store(key string, entry *cachedAnalysis) error {
+	if c == nil {
+		return nil
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode analysis: %w", err)
+	}
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(c.dir, key+"-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create cache entry: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.path(key)); err != nil {
+		return fmt.Errorf("failed to save cache entry: %w", err)
+	}
+	return c.evict(key)
+}
+
+// evict removes the least recently used entries, other than the one of
+// key, until the cache is at most maxBytes.
+func (c *analysisCache) evict(key string) error {
+	dirEntries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read cache directory: %w", err)
+	}
+
+	type cacheFile struct {
+		path string
+		size int64
+		used time.Time
+	}
+	var files []cacheFile
+	var total int64
+	for _, dirEntry := range dirEntries {
+		if dirEntry.IsDir() || filepath.Ext(dirEntry.Name()) != ".json" {
+			continue
+		}
+		info, err := dirEntry.Info()
+		if err != nil {
+			// Removed by a concurrent run
+			continue
+		}
+		total += info.Size()
+		if dirEntry.Name() != key+".json" {
+			files = append(files, cacheFile{path: filepath.Join(c.dir, dirEntry.Name()), size: info.Size(), used: info.ModTime()})
+		}
+	}
+
+	slices.SortFunc(files, func(a, b cacheFile) int { return a.used.Compare(b.used) })
+	for _, file := range files {
+		if total <= c.maxBytes {
+			break
+		}
+		if err := os.Remove(file.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to evict cache entry: %w", err)
+		}
+		total -= file.size
+	}
+	return nil
+}
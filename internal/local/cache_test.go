@@ -0,0 +1,141 @@
+package local
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+)
+
+func TestRunner_Run_Cache(t *testing.T) {
+	tmpDir := t.TempDir()
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+	coveragePath := filepath.Join(tmpDir, "coverage.out")
+	require.NoError(t, os.WriteFile(coveragePath, []byte("mode: set\ngithub.com/test/main.go:1.1,3.2 1 0\n"), 0644))
+	diffData := []byte("diff --git a/main.go b/main.go\n--- a/main.go\n+++ b/main.go\n@@ -0,0 +1,3 @@\n+package main\n+\n+func main() {}\n")
+
+	run := func(t *testing.T, format, cacheDir string) string {
+		var out bytes.Buffer
+		runner := NewRunner(Config{
+			CoveragePath: tmpDir,
+			Format:       format,
+			SourceRoot:   tmpDir,
+			CacheDir:     cacheDir,
+		}, WithDiffSource(&stubDiffSource{diff: diffData}), WithOutput(&out))
+		require.NoError(t, runner.Run(context.Background()))
+		return out.String()
+	}
+	entries := func(t *testing.T) []string {
+		matches, err := filepath.Glob(filepath.Join(cacheDir, "*.json"))
+		require.NoError(t, err)
+		return matches
+	}
+
+	t.Run("stores the analysis", func(t *testing.T) {
+		assert.Equal(t, run(t, "Text", ""), run(t, "Text", cacheDir))
+		assert.Len(t, entries(t), 1)
+	})
+
+	t.Run("reuses the analysis for other formats", func(t *testing.T) {
+		assert.Equal(t, run(t, "JSON", ""), run(t, "JSON", cacheDir))
+		assert.Len(t, entries(t), 1)
+	})
+
+	t.Run("loads the stored analysis", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(entries(t)[0], []byte(`{"result":{"DiffAddedLines":1,"DiffAddedCovered":1}}`), 0644))
+		assert.NotEqual(t, run(t, "Text", ""), run(t, "Text", cacheDir))
+	})
+
+	t.Run("ignores corrupt entries", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(entries(t)[0], []byte("{"), 0644))
+		assert.Equal(t, run(t, "Text", ""), run(t, "Text", cacheDir))
+	})
+
+	t.Run("changed coverage is a new entry", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(coveragePath, []byte("mode: set\ngithub.com/test/main.go:1.1,3.2 1 1\n"), 0644))
+		assert.Equal(t, run(t, "Text", ""), run(t, "Text", cacheDir))
+		assert.Len(t, entries(t), 2)
+	})
+}
+
+func TestAnalysisCacheKey(t *testing.T) {
+	added := map[string][]int{"main.go": {1, 2}}
+	files := []coverageFile{{path: "cov/a.out", digest: []byte("a")}}
+	key, err := analysisCacheKey("v1.0.0", "auto", added, nil, files)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		version string
+		added   map[string][]int
+		gomod   []byte
+		files   []coverageFile
+		same    bool
+	}{
+		{name: "same inputs", version: "v1.0.0", added: map[string][]int{"main.go": {1, 2}}, files: files, same: true},
+		{name: "other directory", version: "v1.0.0", added: added, files: []coverageFile{{path: "other/a.out", digest: []byte("a")}}, same: true},
+		{name: "other version", version: "v1.1.0", added: added, files: files},
+		{name: "other added lines", version: "v1.0.0", added: map[string][]int{"main.go": {1}}, files: files},
+		{name: "other go.mod", version: "v1.0.0", added: added, gomod: []byte("module x\n"), files: files},
+		{name: "other coverage", version: "v1.0.0", added: added, files: []coverageFile{{path: "cov/a.out", digest: []byte("b")}}},
+		{name: "fields don't run into each other", version: "v1.0.0a", added: added, files: files},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := analysisCacheKey(tt.version, "auto", tt.added, tt.gomod, tt.files)
+			require.NoError(t, err)
+			if tt.same {
+				assert.Equal(t, key, got)
+			} else {
+				assert.NotEqual(t, key, got)
+			}
+		})
+	}
+}
+
+func TestAnalysisCache_Evict(t *testing.T) {
+	entry := &cachedAnalysis{Result: &coverage.AnalysisResult{DiffAddedLines: 1}}
+	data, err := json.Marshal(entry)
+	require.NoError(t, err)
+
+	// The cache holds two entries
+	cache := &analysisCache{dir: t.TempDir(), maxBytes: int64(2 * len(data))}
+	stored := func(t *testing.T) []string {
+		matches, err := filepath.Glob(filepath.Join(cache.dir, "*.json"))
+		require.NoError(t, err)
+		var keys []string
+		for _, match := range matches {
+			keys = append(keys, strings.TrimSuffix(filepath.Base(match), ".json"))
+		}
+		return keys
+	}
+
+	// Entries are stored an hour apart, oldest first
+	for i, key := range []string{"a", "b"} {
+		require.NoError(t, cache.store(key, entry))
+		used := time.Now().Add(time.Duration(i-2) * time.Hour)
+		require.NoError(t, os.Chtimes(cache.path(key), used, used))
+	}
+	assert.Equal(t, []string{"a", "b"}, stored(t))
+
+	// Loading a marks it used, so b is the least recently used
+	_, ok := cache.load("a")
+	require.True(t, ok)
+	require.NoError(t, cache.store("c", entry))
+	assert.Equal(t, []string{"a", "c"}, stored(t))
+
+	// An entry larger than the cache is kept until the next one is stored
+	cache.maxBytes = 1
+	require.NoError(t, cache.store("d", entry))
+	assert.Equal(t, []string{"d"}, stored(t))
+}
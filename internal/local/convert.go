@@ -0,0 +1,51 @@
+package local
+
+import (
+	"context"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/clock"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+)
+
+// Convert merges the coverage files and writes them in another format: a
+// Go text profile, an lcov tracefile, or a Cobertura XML report (see
+// coverage.Export). lcov and Cobertura paths are made relative to the
+// repository root by trimming the module path of SourceRoot's go.mod.
+func (r *Runner) Convert(ctx context.Context, to string) error {
+	format, err := coverage.ParseExportFormat(to)
+	if err != nil {
+		return newError(KindUsage, "%w", err)
+	}
+
+	profiles, err := r.readAndMergeCoverageFiles(ctx)
+	if err != nil {
+		return err
+	}
+	gomod, err := readGoMod(r.config.SourceRoot)
+	if err != nil {
+		return err
+	}
+	if profiles, err = coverage.NewPathNormalizer(gomod).NormalizeProfiles(profiles); err != nil {
+		return newError(KindCoverageParse, "failed to normalize coverage paths: %w", err)
+	}
+	if format != coverage.FormatGo {
+		profiles = coverage.TrimModule(profiles, coverage.ModulePath(gomod))
+	}
+
+	data, err := coverage.Export(profiles, format, clock.Or(r.config.Clock).Now())
+	if err != nil {
+		return newError(KindCoverageParse, "failed to convert coverage: %w", err)
+	}
+	out, closeOutput, err := r.openOutput()
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(data)
+	if closeErr := closeOutput(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return newError(KindEnvironment, "failed to write converted coverage: %w", err)
+	}
+	return nil
+}
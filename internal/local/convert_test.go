@@ -0,0 +1,58 @@
+package local
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/clock"
+)
+
+func TestRunner_Convert(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "go.mod"), []byte("module github.com/test/app\n"), 0644))
+	coverageContent := "mode: set\ngithub.com/test/app/api/handler.go:2.1,3.2 1 1\ngithub.com/test/app/api/handler.go:4.1,5.2 1 0\n"
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "coverage.out"), []byte(coverageContent), 0644))
+
+	run := func(t *testing.T, to string) (string, error) {
+		var out bytes.Buffer
+		runner := NewRunner(Config{
+			CoveragePath: tmpDir,
+			SourceRoot:   tmpDir,
+			Clock:        clock.Fixed(time.Unix(1700000000, 0)),
+		}, WithOutput(&out))
+		err := runner.Convert(context.Background(), to)
+		return out.String(), err
+	}
+
+	t.Run("lcov", func(t *testing.T) {
+		out, err := run(t, "lcov")
+		require.NoError(t, err)
+		assert.Equal(t, "TN:\nSF:api/handler.go\nDA:2,1\nDA:3,1\nDA:4,0\nDA:5,0\nLF:4\nLH:2\nend_of_record\n", out)
+	})
+
+	t.Run("cobertura", func(t *testing.T) {
+		out, err := run(t, "cobertura")
+		require.NoError(t, err)
+		assert.Contains(t, out, `timestamp="1700000000000"`)
+		assert.Contains(t, out, `<class name="handler.go" filename="api/handler.go" line-rate="0.5"`)
+	})
+
+	t.Run("go keeps import paths", func(t *testing.T) {
+		out, err := run(t, "go")
+		require.NoError(t, err)
+		assert.Equal(t, coverageContent, out)
+	})
+
+	t.Run("unknown format is a usage error", func(t *testing.T) {
+		_, err := run(t, "clover")
+		require.Error(t, err)
+		assert.Equal(t, KindUsage, KindOf(err))
+	})
+}
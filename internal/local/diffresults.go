@@ -0,0 +1,47 @@
+package local
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/format"
+)
+
+// DiffResults compares two reports saved with --format JSON and writes the
+// uncovered lines that appeared or were resolved between them to w.
+//
+// Returns a KindEnvironment error if a report cannot be read, and a
+// KindUsage error if it is not a JSON report.
+func DiffResults(oldPath, newPath string, w io.Writer) error {
+	oldReport, err := readJSONReport(oldPath)
+	if err != nil {
+		return err
+	}
+	newReport, err := readJSONReport(newPath)
+	if err != nil {
+		return err
+	}
+
+	if err := format.FormatReportDiff(format.CompareReports(oldReport, newReport), w); err != nil {
+		return newError(KindEnvironment, "failed to write results: %w", err)
+	}
+	return nil
+}
+
+func readJSONReport(path string) (*format.JSONReport, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, newError(KindEnvironment, "report not found: %s", path)
+		}
+		return nil, newError(KindEnvironment, "failed to read report: %w", err)
+	}
+	defer f.Close()
+
+	report, err := format.ReadJSONReport(f)
+	if err != nil {
+		return nil, newError(KindUsage, "%s: %w (save reports with --format JSON)", path, err)
+	}
+	return report, nil
+}
@@ -0,0 +1,73 @@
+package local
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffResults(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		return path
+	}
+
+	before := write("before.json", `{"summary":{"added_lines":4,"covered_lines":2,"uncovered_lines":2,"coverage":50},
+"files":[{"path":"main.go","uncovered_lines":[3,4]}]}`)
+	after := write("after.json", `{"summary":{"added_lines":4,"covered_lines":3,"uncovered_lines":1,"coverage":75},
+"files":[{"path":"main.go","uncovered_lines":[4]}]}`)
+	text := write("report.txt", "Uncovered lines in diff:\n")
+
+	tests := []struct {
+		name         string
+		oldPath      string
+		newPath      string
+		expectedOut  string
+		expectedKind ErrorKind
+	}{
+		{
+			name:    "resolved lines",
+			oldPath: before,
+			newPath: after,
+			expectedOut: `Patch coverage: 50.0% -> 75.0% (+25.0%)
+Uncovered lines: 2 -> 1
+
+Resolved lines:
+  main.go: 3
+`,
+		},
+		{
+			name:         "missing report",
+			oldPath:      filepath.Join(dir, "missing.json"),
+			newPath:      after,
+			expectedKind: KindEnvironment,
+		},
+		{
+			name:         "not a JSON report",
+			oldPath:      before,
+			newPath:      text,
+			expectedKind: KindUsage,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := DiffResults(tt.oldPath, tt.newPath, &buf)
+
+			if tt.expectedKind != KindUnknown {
+				require.Error(t, err)
+				assert.Equal(t, tt.expectedKind, KindOf(err))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedOut, buf.String())
+		})
+	}
+}
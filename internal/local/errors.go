@@ -0,0 +1,120 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrorKind classifies a local analysis failure so callers (CI scripts,
+// wrappers) can branch on the class of failure rather than on error text.
+type ErrorKind int
+
+const (
+	// KindUnknown is used for errors that carry no classification.
+	KindUnknown ErrorKind = iota
+	// KindThreshold indicates patch coverage or uncovered lines miss the
+	// configured thresholds (Config.FailUnderPatch, Config.MaxUncoveredLines).
+	KindThreshold
+	// KindUsage indicates invalid flags or arguments.
+	KindUsage
+	// KindEnvironment indicates a problem with the environment:
+	// git failures, missing coverage directory, unreadable files.
+	KindEnvironment
+	// KindCoverageParse indicates coverage files could not be parsed or merged.
+	KindCoverageParse
+	// KindCanceled indicates the analysis was canceled or timed out.
+	KindCanceled
+)
+
+// Exit codes returned by the canopy CLI, one per ErrorKind.
+const (
+	ExitOK            = 0
+	ExitThreshold     = 1
+	ExitUsage         = 2
+	ExitEnvironment   = 3
+	ExitCoverageParse = 4
+	ExitCanceled      = 5
+)
+
+// String returns a short human-readable name for the kind.
+func (k ErrorKind) String() string {
+	switch k {
+	case KindThreshold:
+		return "threshold"
+	case KindUsage:
+		return "usage"
+	case KindEnvironment:
+		return "environment"
+	case KindCoverageParse:
+		return "coverage-parse"
+	case KindCanceled:
+		return "canceled"
+	default:
+		return "unknown"
+	}
+}
+
+// Error is a classified error returned by the Runner.
+// The message of the wrapped error is preserved as-is.
+type Error struct {
+	Kind ErrorKind
+	Err  error
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// newError creates a classified error with a formatted message.
+// Use %w in the format string to keep the cause in the error chain.
+func newError(kind ErrorKind, format string, args ...any) error {
+	return &Error{Kind: kind, Err: fmt.Errorf(format, args...)}
+}
+
+// canceled returns a KindCanceled error if ctx is done, or nil otherwise.
+// Callers check it between steps, and after a failure that may have been
+// caused by the cancellation, such as a killed git command.
+func canceled(ctx context.Context) error {
+	if ctx.Err() == nil {
+		return nil
+	}
+	return newError(KindCanceled, "analysis canceled: %w", context.Cause(ctx))
+}
+
+// KindOf returns the ErrorKind of err, or KindUnknown if err is not classified.
+func KindOf(err error) ErrorKind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return KindUnknown
+}
+
+// ExitCode maps an error returned by the Runner to a CLI exit code.
+// A nil error maps to ExitOK. Unclassified errors map to ExitUsage,
+// since the only unclassified errors reaching the CLI come from flag parsing.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+
+	switch KindOf(err) {
+	case KindThreshold:
+		return ExitThreshold
+	case KindEnvironment:
+		return ExitEnvironment
+	case KindCoverageParse:
+		return ExitCoverageParse
+	case KindCanceled:
+		return ExitCanceled
+	default:
+		return ExitUsage
+	}
+}
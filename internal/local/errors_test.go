@@ -0,0 +1,272 @@
+package local
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{
+			name:     "nil error",
+			err:      nil,
+			expected: ExitOK,
+		},
+		{
+			name:     "threshold error",
+			err:      newError(KindThreshold, "too many uncovered lines"),
+			expected: ExitThreshold,
+		},
+		{
+			name:     "usage error",
+			err:      newError(KindUsage, "unknown format"),
+			expected: ExitUsage,
+		},
+		{
+			name:     "environment error",
+			err:      newError(KindEnvironment, "git not found"),
+			expected: ExitEnvironment,
+		},
+		{
+			name:     "coverage parse error",
+			err:      newError(KindCoverageParse, "bad profile"),
+			expected: ExitCoverageParse,
+		},
+		{
+			name:     "canceled error",
+			err:      newError(KindCanceled, "analysis canceled: %w", context.Canceled),
+			expected: ExitCanceled,
+		},
+		{
+			name:     "wrapped classified error",
+			err:      fmt.Errorf("outer: %w", newError(KindEnvironment, "inner")),
+			expected: ExitEnvironment,
+		},
+		{
+			name:     "unclassified error",
+			err:      errors.New("unknown flag: --foo"),
+			expected: ExitUsage,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, ExitCode(tt.err))
+		})
+	}
+}
+
+func TestError_PreservesCause(t *testing.T) {
+	cause := errors.New("permission denied")
+	err := newError(KindEnvironment, "failed to read coverage file %s: %w", "a.out", cause)
+
+	assert.Equal(t, "failed to read coverage file a.out: permission denied", err.Error())
+	assert.ErrorIs(t, err, cause)
+	assert.Equal(t, KindEnvironment, KindOf(err))
+}
+
+func TestErrorKind_String(t *testing.T) {
+	assert.Equal(t, "threshold", KindThreshold.String())
+	assert.Equal(t, "usage", KindUsage.String())
+	assert.Equal(t, "environment", KindEnvironment.String())
+	assert.Equal(t, "coverage-parse", KindCoverageParse.String())
+	assert.Equal(t, "canceled", KindCanceled.String())
+	assert.Equal(t, "unknown", KindUnknown.String())
+}
+
+func TestRunner_readAndMergeCoverageFiles_ErrorKinds(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(t *testing.T) string
+		expected ErrorKind
+	}{
+		{
+			name: "missing directory is an environment error",
+			setup: func(t *testing.T) string {
+				return filepath.Join(t.TempDir(), "nonexistent")
+			},
+			expected: KindEnvironment,
+		},
+		{
+			name: "no coverage files is an environment error",
+			setup: func(t *testing.T) string {
+				return t.TempDir()
+			},
+			expected: KindEnvironment,
+		},
+		{
+			name: "malformed coverage file is a parse error",
+			setup: func(t *testing.T) string {
+				tmpDir := t.TempDir()
+				err := os.WriteFile(filepath.Join(tmpDir, "coverage.out"), []byte("mode: set\nnot a coverage line\n"), 0644)
+				require.NoError(t, err)
+				return tmpDir
+			},
+			expected: KindCoverageParse,
+		},
+		{
+			name: "mixed modes is a parse error",
+			setup: func(t *testing.T) string {
+				tmpDir := t.TempDir()
+				err := os.WriteFile(filepath.Join(tmpDir, "a.out"), []byte("mode: set\ngithub.com/test/a.go:1.1,2.2 1 1\n"), 0644)
+				require.NoError(t, err)
+				err = os.WriteFile(filepath.Join(tmpDir, "b.out"), []byte("mode: count\ngithub.com/test/b.go:1.1,2.2 1 1\n"), 0644)
+				require.NoError(t, err)
+				return tmpDir
+			},
+			expected: KindCoverageParse,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := NewRunner(Config{CoveragePath: tt.setup(t)})
+
+			_, err := runner.readAndMergeCoverageFiles(context.Background())
+			require.Error(t, err)
+			assert.Equal(t, tt.expected, KindOf(err))
+		})
+	}
+}
+
+// stubDiffSource returns a fixed diff or error.
+type stubDiffSource struct {
+	diff []byte
+	err  error
+}
+
+func (s *stubDiffSource) GetDiff(_ context.Context) ([]byte, error) {
+	return s.diff, s.err
+}
+
+func TestRunner_Run_ErrorKinds(t *testing.T) {
+	t.Run("diff failure is an environment error", func(t *testing.T) {
+		runner := NewRunner(Config{CoveragePath: t.TempDir(), Format: "Text"},
+			WithDiffSource(&stubDiffSource{err: errors.New("not a git repository")}))
+
+		err := runner.Run(context.Background())
+		require.Error(t, err)
+		assert.Equal(t, ExitEnvironment, ExitCode(err))
+	})
+
+	t.Run("unknown format is a usage error", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		err := os.WriteFile(filepath.Join(tmpDir, "coverage.out"), []byte("mode: set\ngithub.com/test/main.go:1.1,2.2 1 1\n"), 0644)
+		require.NoError(t, err)
+
+		diffData := []byte("diff --git a/main.go b/main.go\n--- a/main.go\n+++ b/main.go\n@@ -0,0 +1,2 @@\n+package main\n+func main() {}\n")
+		runner := NewRunner(Config{CoveragePath: tmpDir, Format: "Bogus"},
+			WithDiffSource(&stubDiffSource{diff: diffData}))
+
+		err = runner.Run(context.Background())
+		require.Error(t, err)
+		assert.Equal(t, ExitUsage, ExitCode(err))
+	})
+}
+
+// blockingDiffSource fails like a killed git command once ctx is done.
+type blockingDiffSource struct{}
+
+func (blockingDiffSource) GetDiff(ctx context.Context) ([]byte, error) {
+	<-ctx.Done()
+	return nil, errors.New("signal: killed")
+}
+
+func TestRunner_Run_Canceled(t *testing.T) {
+	diffData := []byte("diff --git a/main.go b/main.go\n--- a/main.go\n+++ b/main.go\n@@ -0,0 +1,2 @@\n+package main\n+func main() {}\n")
+
+	t.Run("timeout while getting the diff", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		runner := NewRunner(Config{CoveragePath: t.TempDir()}, WithDiffSource(blockingDiffSource{}))
+
+		err := runner.Run(ctx)
+		assert.EqualError(t, err, "analysis canceled: context deadline exceeded")
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Equal(t, ExitCanceled, ExitCode(err))
+	})
+
+	t.Run("canceled before reading coverage files", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "coverage.out"), []byte("mode: set\ngithub.com/test/main.go:1.1,2.2 1 1\n"), 0644))
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		var out bytes.Buffer
+		runner := NewRunner(Config{CoveragePath: tmpDir, Format: "Text", IncludeGenerated: true},
+			WithDiffSource(&stubDiffSource{diff: diffData}), WithOutput(&out))
+
+		err := runner.Run(ctx)
+		assert.EqualError(t, err, "analysis canceled: context canceled")
+		assert.Equal(t, KindCanceled, KindOf(err))
+		assert.Empty(t, out.String())
+	})
+}
+
+func TestRunner_readAndMergeCoverageFiles_InputFormat(t *testing.T) {
+	t.Run("invalid input format is a usage error", func(t *testing.T) {
+		runner := NewRunner(Config{CoveragePath: t.TempDir(), InputFormat: "bogus"})
+
+		_, err := runner.readAndMergeCoverageFiles(context.Background())
+		require.Error(t, err)
+		assert.Equal(t, KindUsage, KindOf(err))
+	})
+
+	t.Run("malformed GOCOVERDIR data is a parse error", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		err := os.WriteFile(filepath.Join(tmpDir, "covmeta.abc"), []byte{0x00, 'c', 'v', 'm'}, 0644)
+		require.NoError(t, err)
+
+		runner := NewRunner(Config{CoveragePath: tmpDir})
+
+		_, err = runner.readAndMergeCoverageFiles(context.Background())
+		require.Error(t, err)
+		assert.Equal(t, KindCoverageParse, KindOf(err))
+		assert.Contains(t, err.Error(), "GOCOVERDIR")
+	})
+
+	t.Run("every input format parses its files", func(t *testing.T) {
+		files := map[string]struct{ name, content string }{
+			"go":        {"coverage.out", "mode: set\nexample.com/app/main.go:1.1,2.2 1 1\n"},
+			"lcov":      {"lcov.info", "SF:src/app.ts\nDA:1,1\nend_of_record\n"},
+			"cobertura": {"coverage.xml", `<coverage><packages><package><classes><class filename="app.py"><lines><line number="1" hits="1"/></lines></class></classes></package></packages></coverage>`},
+			"jacoco":    {"jacoco.xml", `<report name="app"><package name="com/example"><sourcefile name="App.java"><line nr="1" mi="0" ci="1"/></sourcefile></package></report>`},
+		}
+		for format, file := range files {
+			t.Run(format, func(t *testing.T) {
+				tmpDir := t.TempDir()
+				require.NoError(t, os.WriteFile(filepath.Join(tmpDir, file.name), []byte(file.content), 0644))
+				runner := NewRunner(Config{CoveragePath: tmpDir, InputFormat: format})
+
+				profiles, err := runner.readAndMergeCoverageFiles(context.Background())
+				require.NoError(t, err)
+				assert.Len(t, profiles, 1)
+			})
+		}
+	})
+
+	t.Run("malformed lcov is a parse error", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		err := os.WriteFile(filepath.Join(tmpDir, "lcov.info"), []byte("SF:src/app.ts\nDA:one,1\nend_of_record\n"), 0644)
+		require.NoError(t, err)
+
+		runner := NewRunner(Config{CoveragePath: tmpDir})
+
+		_, err = runner.readAndMergeCoverageFiles(context.Background())
+		require.Error(t, err)
+		assert.Equal(t, KindCoverageParse, KindOf(err))
+		assert.Contains(t, err.Error(), "lcov")
+	})
+}
@@ -0,0 +1,109 @@
+package local
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/repoconfig"
+)
+
+// LintRepoConfig validates a repository config file and writes one line
+// per issue to w, as "<path>:<line>:<column>: <key>: <message>".
+// If path is empty, the config is looked up in root (see repoconfig.Paths).
+//
+// Returns a KindUsage error if the config has issues, and a KindEnvironment
+// error if it cannot be found or read.
+func LintRepoConfig(root, path string, w io.Writer) error {
+	var data []byte
+	var err error
+	if path == "" {
+		path, data, err = repoconfig.Find(root)
+	} else {
+		data, err = os.ReadFile(filepath.Join(root, path))
+	}
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && path != "" {
+			return newError(KindEnvironment, "config file not found: %s", path)
+		}
+		return newError(KindEnvironment, "%w", err)
+	}
+
+	issues := repoconfig.Lint(data)
+	for _, issue := range issues {
+		location := path
+		if issue.Line > 0 {
+			location += fmt.Sprintf(":%d", issue.Line)
+			if issue.Column > 0 {
+				location += fmt.Sprintf(":%d", issue.Column)
+			}
+		}
+		msg := issue.Message
+		if issue.Key != "" {
+			msg = issue.Key + ": " + msg
+		}
+		fmt.Fprintf(w, "%s: %s\n", location, msg)
+	}
+
+	if len(issues) > 0 {
+		return newError(KindUsage, "%s has %d issue(s)", path, len(issues))
+	}
+	fmt.Fprintf(w, "%s is valid\n", path)
+	return nil
+}
+
+// RepoConfigFlags reads the repository config under root (see
+// repoconfig.Find) and returns the defaults it sets for flags of the
+// canopy CLI, by flag name, as the flags parse them: cli.coverage,
+// cli.format, cli.base, cli.merge_base, cli.max_uncovered_lines, ignore,
+// include, suppressions.max_age_days, and thresholds.patch (as
+// --fail-under-patch). A repository without a config sets none.
+//
+// Returns a KindUsage error if the config has issues, since the defaults
+// meant can't be told, and a KindEnvironment error if it cannot be read.
+func RepoConfigFlags(root string) (map[string][]string, error) {
+	path, data, err := repoconfig.Find(root)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, newError(KindEnvironment, "%w", err)
+	}
+	cfg, issues := repoconfig.Parse(data)
+	if len(issues) > 0 {
+		return nil, newError(KindUsage, "%s is invalid (%s); run canopy config lint to list its issues", path, issues[0])
+	}
+	if cfg.CLI.Base != "" && cfg.CLI.MergeBase != "" {
+		return nil, newError(KindUsage, "%s sets both cli.base and cli.merge_base", path)
+	}
+
+	flags := make(map[string][]string)
+	set := func(name, value string) {
+		if value != "" {
+			flags[name] = []string{value}
+		}
+	}
+	set("coverage", cfg.CLI.Coverage)
+	set("format", cfg.CLI.Format)
+	set("base", cfg.CLI.Base)
+	set("merge-base", cfg.CLI.MergeBase)
+	if cfg.CLI.MaxUncoveredLines != nil {
+		set("max-uncovered-lines", strconv.Itoa(*cfg.CLI.MaxUncoveredLines))
+	}
+	if cfg.Thresholds.Patch > 0 {
+		set("fail-under-patch", strconv.FormatFloat(cfg.Thresholds.Patch, 'g', -1, 64))
+	}
+	if cfg.Suppressions.MaxAgeDays > 0 {
+		set("suppression-max-age", strconv.Itoa(cfg.Suppressions.MaxAgeDays))
+	}
+	if len(cfg.Ignore) > 0 {
+		flags["ignore"] = cfg.Ignore
+	}
+	if len(cfg.Include) > 0 {
+		flags["include"] = cfg.Include
+	}
+	return flags, nil
+}
@@ -0,0 +1,147 @@
+package local
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLintRepoConfig(t *testing.T) {
+	tests := []struct {
+		name         string
+		files        map[string]string
+		path         string
+		expectedOut  string
+		expectedKind ErrorKind
+	}{
+		{
+			name:        "valid config found automatically",
+			files:       map[string]string{".canopy.yml": "annotations:\n  level: warning\n"},
+			expectedOut: ".canopy.yml is valid\n",
+		},
+		{
+			name:  "issues are reported with positions",
+			files: map[string]string{".github/canopy.yml": "annotations:\n  level: loud\nignor: []\n"},
+			expectedOut: ".github/canopy.yml:2:10: annotations.level: invalid value \"loud\" (expected one of notice, warning, failure)\n" +
+				".github/canopy.yml:3:1: ignor: unknown key (did you mean \"ignore\"?)\n",
+			expectedKind: KindUsage,
+		},
+		{
+			name:         "explicit path",
+			files:        map[string]string{"ci/canopy.yml": "comment: [\n"},
+			path:         "ci/canopy.yml",
+			expectedOut:  "ci/canopy.yml:1: invalid YAML: did not find expected node content\n",
+			expectedKind: KindUsage,
+		},
+		{
+			name:         "explicit path missing",
+			path:         "missing.yml",
+			expectedKind: KindEnvironment,
+		},
+		{
+			name:         "no config in repository",
+			expectedKind: KindEnvironment,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			for name, content := range tt.files {
+				require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(root, name)), 0755))
+				require.NoError(t, os.WriteFile(filepath.Join(root, name), []byte(content), 0644))
+			}
+
+			var buf bytes.Buffer
+			err := LintRepoConfig(root, tt.path, &buf)
+
+			if tt.expectedKind != KindUnknown {
+				require.Error(t, err)
+				assert.Equal(t, tt.expectedKind, KindOf(err))
+			} else {
+				require.NoError(t, err)
+			}
+			if tt.expectedOut != "" {
+				assert.Equal(t, tt.expectedOut, buf.String())
+			}
+		})
+	}
+}
+
+func TestRepoConfigFlags(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       string
+		expected     map[string][]string
+		expectedKind ErrorKind
+		errorMsg     string
+	}{
+		{
+			name: "cli defaults and shared settings",
+			config: `ignore: ["**/*.pb.go", "mocks/*"]
+suppressions:
+  max_age_days: 90
+thresholds:
+  project: 70
+  patch: 82.5
+cli:
+  coverage: build/coverage
+  format: Markdown
+  merge_base: origin/main
+  max_uncovered_lines: 0
+`,
+			expected: map[string][]string{
+				"ignore":              {"**/*.pb.go", "mocks/*"},
+				"suppression-max-age": {"90"},
+				"fail-under-patch":    {"82.5"},
+				"coverage":            {"build/coverage"},
+				"format":              {"Markdown"},
+				"merge-base":          {"origin/main"},
+				"max-uncovered-lines": {"0"},
+			},
+		},
+		{
+			name:     "service settings only",
+			config:   "annotations:\n  level: warning\n",
+			expected: map[string][]string{},
+		},
+		{
+			name:         "invalid config",
+			config:       "cli:\n  format: pdf\n",
+			expectedKind: KindUsage,
+			errorMsg:     `.canopy.yml is invalid (line 2, column 11: cli.format: invalid value "pdf" (expected one of Text, Markdown, JSON, HTML, GitHubAnnotations, Sonar, TeamCity, Jenkins)); run canopy config lint to list its issues`,
+		},
+		{
+			name:         "base and merge base",
+			config:       "cli:\n  base: main\n  merge_base: origin/main\n",
+			expectedKind: KindUsage,
+			errorMsg:     ".canopy.yml sets both cli.base and cli.merge_base",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			require.NoError(t, os.WriteFile(filepath.Join(root, ".canopy.yml"), []byte(tt.config), 0644))
+
+			flags, err := RepoConfigFlags(root)
+			if tt.errorMsg != "" {
+				assert.EqualError(t, err, tt.errorMsg)
+				assert.Equal(t, tt.expectedKind, KindOf(err))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, flags)
+		})
+	}
+
+	t.Run("no config", func(t *testing.T) {
+		flags, err := RepoConfigFlags(t.TempDir())
+		require.NoError(t, err)
+		assert.Nil(t, flags)
+	})
+}
@@ -0,0 +1,62 @@
+package local
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/codeowners"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/format"
+)
+
+// ReleaseReport writes the code added since a release (the diff of the
+// Runner, e.g. a GitWindowDiffSource from the release tag) that the
+// coverage files leave uncovered, grouped by the owners in the
+// repository's CODEOWNERS file and by package. Config.Format selects
+// Markdown (the default) or HTML.
+func (r *Runner) ReleaseReport(ctx context.Context, since string) error {
+	var write func(*format.ReleaseReport, io.Writer, *format.FileLinker) error
+	switch strings.ToLower(r.config.Format) {
+	case "", "markdown":
+		write = format.FormatReleaseMarkdown
+	case "html":
+		write = format.FormatReleaseHTML
+	default:
+		return newError(KindUsage, "unsupported release report format %q (supported: Markdown, HTML)", r.config.Format)
+	}
+
+	owners, err := codeowners.Load(r.config.SourceRoot)
+	if err != nil {
+		return newError(KindEnvironment, "failed to read CODEOWNERS: %w", err)
+	}
+
+	a, err := r.analyze(ctx)
+	if err != nil || a == nil {
+		return err
+	}
+	if err := canceled(ctx); err != nil {
+		return err
+	}
+	lineCoverage := coverage.LineCoverageByFile(a.profiles, a.addedLinesByFile)
+	report := format.NewReleaseReport(since, a.result, lineCoverage, owners.Owners)
+
+	var links *format.FileLinker
+	if r.config.LinkRepoURL != "" {
+		if links, err = r.fileLinker(ctx); err != nil {
+			return err
+		}
+	}
+	out, closeOutput, err := r.openOutput()
+	if err != nil {
+		return err
+	}
+	err = write(report, out, links)
+	if closeErr := closeOutput(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return newError(KindEnvironment, "failed to write release report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package local
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunner_ReleaseReport(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "go.mod"), []byte("module github.com/test/app\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "CODEOWNERS"), []byte("/api/ @acme/web\n"), 0644))
+	coverageContent := "mode: set\n" +
+		"github.com/test/app/api/handler.go:2.1,3.2 1 1\ngithub.com/test/app/api/handler.go:4.1,5.2 1 0\n" +
+		"github.com/test/app/store/db.go:2.1,3.2 1 0\n"
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "coverage.out"), []byte(coverageContent), 0644))
+
+	diffData := []byte("diff --git a/api/handler.go b/api/handler.go\n--- a/api/handler.go\n+++ b/api/handler.go\n@@ -0,0 +1,5 @@\n+package api\n+func A() {\n+}\n+func B() {\n+}\n" +
+		"diff --git a/store/db.go b/store/db.go\n--- a/store/db.go\n+++ b/store/db.go\n@@ -0,0 +1,3 @@\n+package store\n+func Open() {\n+}\n")
+
+	run := func(t *testing.T, format string) (string, error) {
+		var out bytes.Buffer
+		runner := NewRunner(Config{
+			CoveragePath: tmpDir,
+			Format:       format,
+			SourceRoot:   tmpDir,
+		}, WithDiffSource(&stubDiffSource{diff: diffData}), WithOutput(&out))
+		err := runner.ReleaseReport(context.Background(), "v1.4.0")
+		return out.String(), err
+	}
+
+	t.Run("markdown", func(t *testing.T) {
+		out, err := run(t, "Markdown")
+		require.NoError(t, err)
+		assert.Contains(t, out, "## Uncovered code since v1.4.0")
+		assert.Contains(t, out, "6 executable lines added, 2 covered (33.3%), 4 uncovered.")
+		assert.Contains(t, out, "### @acme/web (2 uncovered lines)")
+		assert.Contains(t, out, "| api/handler.go | 4-5 |")
+		assert.Contains(t, out, "### Unowned (2 uncovered lines)")
+		assert.Contains(t, out, "| store/db.go | 2-3 |")
+	})
+
+	t.Run("html", func(t *testing.T) {
+		out, err := run(t, "HTML")
+		require.NoError(t, err)
+		assert.Contains(t, out, "<h2>@acme/web <small>(2 uncovered lines)</small></h2>")
+	})
+
+	t.Run("unsupported format is a usage error", func(t *testing.T) {
+		_, err := run(t, "JSON")
+		require.Error(t, err)
+		assert.Equal(t, KindUsage, KindOf(err))
+	})
+}
@@ -2,26 +2,99 @@ package local
 
 import (
 	"context"
+	"crypto/sha256"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/buildinfo"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/clock"
 	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
 	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/diff"
 	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/format"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github"
 )
 
 // Config holds configuration for local mode.
 type Config struct {
 	// CoveragePath is the directory containing coverage files (*.out)
 	CoveragePath string
-	// Format is the output format (Text, Markdown, GitHubAnnotations)
+	// Format is the output format (Text, Markdown, JSON, HTML, GitHubAnnotations, Sonar, TeamCity, Jenkins)
 	Format string
+	// InputFormat is the coverage file format (auto, go, lcov, cobertura, jacoco, gocoverdir).
+	// Empty or "auto" detects the format of each file from its contents.
+	InputFormat string
+	// ExplainMatching prints a diagnostics section listing diff files and
+	// coverage profiles that could not be matched to each other
+	ExplainMatching bool
+	// AnnotationLevels maps coverage severity to annotation levels for the
+	// annotation formats: GitHubAnnotations, Sonar, TeamCity, and Jenkins
+	// (see coverage.ParseSeverityPolicy).
+	// Empty reports every uncovered range as a notice.
+	AnnotationLevels string
+	// SourceRoot is the directory diff paths are relative to, used to classify
+	// uncovered lines by the Go construct they belong to and to detect generated
+	// files. Empty uses the working directory.
+	SourceRoot string
+	// IncludeGenerated analyzes generated files too. By default, files marked
+	// linguist-generated in .gitattributes or detected as generated the way
+	// GitHub does (see coverage.GeneratedFileFilter) are skipped.
+	IncludeGenerated bool
+	// Ignore lists glob patterns of files left out of the analysis, matched
+	// like the repository config's ignore (see coverage.PatternFilter)
+	Ignore []string
+	// Include, if set, limits the analysis to files matching one of its
+	// glob patterns (see coverage.IncludeFilter); Ignore still applies
+	Include []string
+	// LinkRepoURL is the web URL of the repository (GitHub or GitLab). If set,
+	// the Markdown format links files and line ranges to it.
+	LinkRepoURL string
+	// LinkRef is the revision links point at. Empty uses the HEAD commit.
+	LinkRef string
+	// SuppressionMaxAgeDays expires canopy:ignore suppressions older than this
+	// many days, or without a date, reporting their lines as uncovered again.
+	// Zero never expires suppressions.
+	SuppressionMaxAgeDays int
+	// Output is the file the report is written to. Empty writes it to the
+	// Runner's output (stdout by default), along with status messages.
+	Output string
+	// CacheDir is the directory analyses are cached in, keyed by the diff's
+	// added lines and the coverage files, so runs over the same inputs
+	// (e.g. with another Format) reuse them. Empty disables caching.
+	CacheDir string
+	// CacheMaxBytes bounds the size of CacheDir: the least recently used
+	// analyses beyond it are evicted. Zero uses DefaultCacheMaxBytes.
+	CacheMaxBytes int64
+	// Version is the Canopy version, recorded in JSON reports and cache keys
+	Version string
+	// Clock is the time suppressions expire against. Nil uses the system
+	// clock; clock.Deterministic makes reports reproducible.
+	Clock clock.Clock
+	// StepSummary is a file a Markdown report is appended to along with the
+	// GitHubAnnotations format, such as $GITHUB_STEP_SUMMARY in GitHub
+	// Actions, where annotations beyond the per-step limit aren't shown.
+	// Empty writes none.
+	StepSummary string
+	// FailUnderPatch fails the analysis with a KindThreshold error, after
+	// the report is written, when patch coverage (the share of added
+	// executable lines covered) is below this percentage. Zero disables it.
+	FailUnderPatch float64
+	// MaxUncoveredLines fails the analysis with a KindThreshold error, after
+	// the report is written, when more added lines than this are uncovered.
+	// Nil disables it.
+	MaxUncoveredLines *int
 }
 
 // Runner handles local coverage analysis.
 type Runner struct {
 	config     Config
 	diffSource diff.DiffSource
+	out        io.Writer
 }
 
 // Option is a functional option for configuring Runner.
@@ -34,11 +107,19 @@ func WithDiffSource(ds diff.DiffSource) Option {
 	}
 }
 
+// WithOutput sets where the Runner writes reports; the default is stdout.
+func WithOutput(w io.Writer) Option {
+	return func(r *Runner) {
+		r.out = w
+	}
+}
+
 // NewRunner creates a new Runner with the given configuration.
 func NewRunner(config Config, opts ...Option) *Runner {
 	r := &Runner{
 		config:     config,
-		diffSource: diff.NewLocalDiffSource(""), // Default to local diff
+		diffSource: &diff.LocalDiffSource{Exclude: []string{config.CacheDir}}, // Default to local diff
+		out:        os.Stdout,
 	}
 
 	for _, opt := range opts {
@@ -49,121 +130,417 @@ func NewRunner(config Config, opts ...Option) *Runner {
 }
 
 // Run executes the local coverage analysis workflow.
-// It returns an error if any step fails, but always exits with code 0 (as required).
+// Errors are classified with an ErrorKind (see errors.go) so the CLI can
+// map them to distinct exit codes. Canceling ctx stops git commands and the
+// reading of coverage files, and returns a KindCanceled error.
 func (r *Runner) Run(ctx context.Context) error {
+	if err := r.validateThresholds(); err != nil {
+		return err
+	}
+	a, err := r.analyze(ctx)
+	if err != nil || a == nil {
+		return err
+	}
+	profiles, addedLinesByFile, result := a.profiles, a.addedLinesByFile, a.result
+
+	if err := canceled(ctx); err != nil {
+		return err
+	}
+
+	// Step 5: Output results
+	formatter, err := format.New(r.config.Format)
+	if err != nil {
+		return newError(KindUsage, "failed to create formatter: %w", err)
+	}
+
+	policy, err := coverage.ParseSeverityPolicy(r.config.AnnotationLevels)
+	if err != nil {
+		return newError(KindUsage, "invalid annotation levels: %w", err)
+	}
+	if annotations, ok := formatter.(format.AnnotationFormatter); ok && !policy.IsDefault() {
+		classifier := coverage.NewGoSourceClassifier(r.config.SourceRoot)
+		fileCoverage := coverage.DiffCoverageByFile(profiles, addedLinesByFile)
+		annotations.SetAnnotate(func(result *coverage.AnalysisResult) []*github.Annotation {
+			return coverage.ApplySeverityPolicy(coverage.GenerateAnnotations(result), policy, classifier, fileCoverage)
+		})
+	}
+
+	if jsonFormatter, ok := formatter.(*format.JSONFormatter); ok {
+		provenance := buildinfo.New(r.config.Version, nil)
+		jsonFormatter.Provenance = &provenance
+		jsonFormatter.Stats = coverage.CalculateCoverageStats(profiles)
+	}
+
+	if html, ok := formatter.(*format.HTMLFormatter); ok {
+		html.SourceRoot = r.config.SourceRoot
+		html.AddedLines = addedLinesByFile
+		html.LineCoverage = coverage.LineCoverageByFile(profiles, addedLinesByFile)
+	}
+
+	if markdown, ok := formatter.(*format.MarkdownFormatter); ok && r.config.LinkRepoURL != "" {
+		links, err := r.fileLinker(ctx)
+		if err != nil {
+			return err
+		}
+		markdown.Links = links
+	}
+
+	out, closeOutput, err := r.openOutput()
+	if err != nil {
+		return err
+	}
+	err = formatter.Format(result, out)
+	if closeErr := closeOutput(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return newError(KindEnvironment, "failed to format results: %w", err)
+	}
+	if _, ok := formatter.(*format.GitHubAnnotationsFormatter); ok && r.config.StepSummary != "" {
+		if err := r.writeStepSummary(ctx, result); err != nil {
+			return err
+		}
+	}
+
+	// Step 6: Optionally explain how profiles were matched to diff files
+	if r.config.ExplainMatching {
+		fmt.Fprintln(r.out)
+		diag := coverage.ExplainMatching(profiles, addedLinesByFile)
+		if err := format.FormatMatchDiagnostics(diag, r.out); err != nil {
+			return newError(KindEnvironment, "failed to format matching diagnostics: %w", err)
+		}
+	}
+
+	return r.checkThresholds(result)
+}
+
+// writeStepSummary appends the Markdown report of result to
+// Config.StepSummary.
+func (r *Runner) writeStepSummary(ctx context.Context, result *coverage.AnalysisResult) error {
+	markdown := &format.MarkdownFormatter{}
+	if r.config.LinkRepoURL != "" {
+		links, err := r.fileLinker(ctx)
+		if err != nil {
+			return err
+		}
+		markdown.Links = links
+	}
+	f, err := os.OpenFile(r.config.StepSummary, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return newError(KindEnvironment, "failed to open step summary: %w", err)
+	}
+	err = markdown.Format(result, f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return newError(KindEnvironment, "failed to write step summary: %w", err)
+	}
+	return nil
+}
+
+// openOutput opens the writer reports are written to: Config.Output if
+// set, or the Runner's output. The returned function closes it.
+func (r *Runner) openOutput() (io.Writer, func() error, error) {
+	if r.config.Output == "" {
+		return r.out, func() error { return nil }, nil
+	}
+	f, err := os.Create(r.config.Output)
+	if err != nil {
+		return nil, nil, newError(KindEnvironment, "failed to create output file: %w", err)
+	}
+	return f, f.Close, nil
+}
+
+// analysis is the coverage of the lines added in a diff.
+type analysis struct {
+	addedLinesByFile map[string][]int
+	profiles         []*coverage.Profile
+	result           *coverage.AnalysisResult
+}
+
+// analyze gets the diff, reads and merges the coverage files, and analyzes
+// the coverage of the added lines, with suppressions applied. It returns
+// nil, after saying so, if the diff adds no source files to analyze.
+func (r *Runner) analyze(ctx context.Context) (*analysis, error) {
 	// Step 1: Get diff using the configured DiffSource
 	diffData, err := r.diffSource.GetDiff(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get diff: %w", err)
+		if err := canceled(ctx); err != nil {
+			return nil, err
+		}
+		return nil, newError(KindEnvironment, "failed to get diff: %w", err)
 	}
 
 	// Check if diff is empty
 	if len(diffData) == 0 {
-		fmt.Println("No changes detected in diff")
-		return nil
+		fmt.Fprintln(r.out, "No changes detected in diff")
+		return nil, nil
 	}
 
 	// Step 2: Parse the diff
 	fileDiffs, err := coverage.ParseDiff(diffData)
 	if err != nil {
-		return fmt.Errorf("failed to parse diff: %w", err)
+		return nil, newError(KindEnvironment, "failed to parse diff: %w", err)
 	}
 
 	// Get added lines by file
 	addedLinesByFile := coverage.GetAddedLinesByFile(fileDiffs)
+	if !r.config.IncludeGenerated {
+		generated, err := coverage.LoadGeneratedFileFilter(r.config.SourceRoot)
+		if err != nil {
+			return nil, newError(KindEnvironment, "failed to read .gitattributes: %w", err)
+		}
+		addedLinesByFile = coverage.FilterAddedLines(addedLinesByFile, generated)
+	}
+	addedLinesByFile = coverage.FilterAddedLines(addedLinesByFile, coverage.IncludeFilter(r.config.Include), coverage.PatternFilter(r.config.Ignore))
 
-	// Check if there are any Go files in the diff
+	// Check if there are any source files in the diff
 	if len(addedLinesByFile) == 0 {
-		fmt.Println("No Go files changed in diff")
-		return nil
+		fmt.Fprintln(r.out, "No source files changed in diff")
+		return nil, nil
 	}
 
-	// Step 3: Read and merge coverage files
-	profiles, err := r.readAndMergeCoverageFiles()
+	// Step 3: Read coverage files, reusing a cached analysis of them
+	files, err := r.readCoverageFiles(ctx)
+	if err != nil {
+		return nil, err // Error message already formatted
+	}
+	gomod, err := readGoMod(r.config.SourceRoot)
 	if err != nil {
-		return err // Error message already formatted
+		return nil, err
 	}
+	cache := r.analysisCache()
+	var key string
+	if cache != nil {
+		if key, err = analysisCacheKey(r.config.Version, r.config.InputFormat, addedLinesByFile, gomod, files); err != nil {
+			return nil, newError(KindEnvironment, "failed to key analysis cache: %w", err)
+		}
+	}
+	entry, ok := cache.load(key)
+	if ok {
+		fmt.Fprintf(os.Stderr, "Reusing cached analysis from %s\n", cache.path(key))
+	} else {
+		// Step 4: Merge coverage files and analyze coverage against diff
+		profiles, err := r.mergeCoverageFiles(ctx, files)
+		if err != nil {
+			return nil, err
+		}
+		if profiles, err = coverage.NewPathNormalizer(gomod).NormalizeProfiles(profiles); err != nil {
+			return nil, newError(KindCoverageParse, "failed to normalize coverage paths: %w", err)
+		}
+		if err := canceled(ctx); err != nil {
+			return nil, err
+		}
+		entry = &cachedAnalysis{Profiles: profiles, Result: coverage.AnalyzeCoverage(profiles, addedLinesByFile)}
+		if err := cache.store(key, entry); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to cache analysis: %v\n", err)
+		}
+	}
+	profiles, result := entry.Profiles, entry.Result
 
-	// Step 4: Analyze coverage against diff
-	result := coverage.AnalyzeCoverage(profiles, addedLinesByFile)
+	maxAge := time.Duration(r.config.SuppressionMaxAgeDays) * 24 * time.Hour
+	coverage.ApplySuppressions(result, coverage.ParseSuppressions(diffData), clock.Or(r.config.Clock).Now(), maxAge)
 
-	// Step 5: Output results
-	formatter, err := format.New(r.config.Format)
-	if err != nil {
-		return fmt.Errorf("failed to create formatter: %w", err)
+	return &analysis{addedLinesByFile: addedLinesByFile, profiles: profiles, result: result}, nil
+}
+
+// readGoMod reads the go.mod at root, or returns nil if there is none.
+func readGoMod(root string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(root, "go.mod"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, newError(KindEnvironment, "failed to read go.mod: %w", err)
 	}
+	return data, nil
+}
 
-	if err := formatter.Format(result, os.Stdout); err != nil {
-		return fmt.Errorf("failed to format results: %w", err)
+// fileLinker creates a FileLinker for the configured repository URL,
+// resolving the HEAD commit if no ref is configured.
+func (r *Runner) fileLinker(ctx context.Context) (*format.FileLinker, error) {
+	ref := r.config.LinkRef
+	if ref == "" {
+		out, err := exec.CommandContext(ctx, "git", "rev-parse", "HEAD").Output()
+		if err != nil {
+			if err := canceled(ctx); err != nil {
+				return nil, err
+			}
+			return nil, newError(KindEnvironment, "failed to resolve HEAD for file links: %w", err)
+		}
+		ref = strings.TrimSpace(string(out))
 	}
 
-	return nil
+	links, err := format.NewFileLinker(r.config.LinkRepoURL, ref)
+	if err != nil {
+		return nil, newError(KindUsage, "%w", err)
+	}
+	return links, nil
 }
 
 // readAndMergeCoverageFiles reads all *.out files from the coverage directory
 // and merges them into a single set of profiles.
 // Returns a user-friendly error if the directory doesn't exist or no files are found.
-func (r *Runner) readAndMergeCoverageFiles() ([]*coverage.Profile, error) {
+// Canceling ctx stops it before the next file.
+func (r *Runner) readAndMergeCoverageFiles(ctx context.Context) ([]*coverage.Profile, error) {
+	files, err := r.readCoverageFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r.mergeCoverageFiles(ctx, files)
+}
+
+// coverageFile is a coverage file found in the coverage directory.
+type coverageFile struct {
+	path string
+	// digest is the SHA-256 of the file's contents
+	digest []byte
+}
+
+// readCoverageFiles finds the coverage files in the coverage directory (see
+// isCoverageFile) and digests their contents, without parsing them or
+// holding them in memory.
+func (r *Runner) readCoverageFiles(ctx context.Context) ([]coverageFile, error) {
 	// Check if directory exists
 	dirInfo, err := os.Stat(r.config.CoveragePath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil, fmt.Errorf("coverage directory not found: %s\n\nRun tests with coverage first:\n  go test ./... -coverprofile=%s/coverage.out",
+			return nil, newError(KindEnvironment, "coverage directory not found: %s\n\nRun tests with coverage first:\n  go test ./... -coverprofile=%s/coverage.out",
 				r.config.CoveragePath, r.config.CoveragePath)
 		}
-		return nil, fmt.Errorf("failed to access coverage directory: %w", err)
+		return nil, newError(KindEnvironment, "failed to access coverage directory: %w", err)
 	}
 
 	if !dirInfo.IsDir() {
-		return nil, fmt.Errorf("coverage path is not a directory: %s", r.config.CoveragePath)
+		return nil, newError(KindEnvironment, "coverage path is not a directory: %s", r.config.CoveragePath)
+	}
+
+	if _, err := coverage.ParseFormat(r.config.InputFormat); err != nil {
+		return nil, newError(KindUsage, "invalid input format: %w", err)
 	}
 
 	// Read directory entries
 	entries, err := os.ReadDir(r.config.CoveragePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read coverage directory: %w", err)
+		return nil, newError(KindEnvironment, "failed to read coverage directory: %w", err)
 	}
 
-	// Find all *.out files
+	// Find all coverage files, and binary GOCOVERDIR files
 	var coverageFiles []string
 	for _, entry := range entries {
 		if entry.IsDir() {
 			continue
 		}
 		name := entry.Name()
-		if len(name) > 4 && name[len(name)-4:] == ".out" {
+		if isCoverageFile(name) || coverage.IsGoCoverDataFile(name) {
 			coverageFiles = append(coverageFiles, fmt.Sprintf("%s/%s", r.config.CoveragePath, name))
 		}
 	}
 
 	if len(coverageFiles) == 0 {
-		return nil, fmt.Errorf("no coverage files (*.out) found in directory: %s\n\nRun tests with coverage first:\n  go test ./... -coverprofile=%s/coverage.out",
+		return nil, newError(KindEnvironment, "no coverage files (*.out, *.info, *.xml, or GOCOVERDIR data) found in directory: %s\n\nRun tests with coverage first:\n  go test ./... -coverprofile=%s/coverage.out",
 			r.config.CoveragePath, r.config.CoveragePath)
 	}
 
-	fmt.Printf("Found %d coverage file(s) to merge\n", len(coverageFiles))
+	// Progress goes to stderr so machine-readable formats can be redirected to a file
+	fmt.Fprintf(os.Stderr, "Found %d coverage file(s) to merge\n", len(coverageFiles))
 
-	// Read and parse all coverage files
-	var allProfiles []*coverage.Profile
+	files := make([]coverageFile, 0, len(coverageFiles))
 	for _, file := range coverageFiles {
-		data, err := os.ReadFile(file)
+		if err := canceled(ctx); err != nil {
+			return nil, err
+		}
+		digest, err := digestFile(file)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read coverage file %s: %w", file, err)
+			return nil, newError(KindEnvironment, "failed to read coverage file %s: %w", file, err)
 		}
+		files = append(files, coverageFile{path: file, digest: digest})
+	}
+	return files, nil
+}
 
-		profiles, err := coverage.ParseProfiles(data)
+// digestFile returns the SHA-256 of a file's contents.
+func digestFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// isCoverageFile reports whether a file in the coverage directory holds
+// coverage, judging by its extension: Go profiles (*.out), lcov tracefiles
+// (*.info), and Cobertura or JaCoCo reports (*.xml). Their format is
+// detected from their contents unless Config.InputFormat sets it.
+func isCoverageFile(name string) bool {
+	switch filepath.Ext(name) {
+	case ".out", ".info", ".xml":
+		return true
+	default:
+		return false
+	}
+}
+
+// mergeCoverageFiles parses coverage files in the configured input format
+// and merges them into a single set of profiles. Files are streamed into a
+// coverage.Merger, so Go profiles are never held in memory whole, however
+// large the directory's shards.
+func (r *Runner) mergeCoverageFiles(ctx context.Context, files []coverageFile) ([]*coverage.Profile, error) {
+	inputFormat, err := coverage.ParseFormat(r.config.InputFormat)
+	if err != nil {
+		return nil, newError(KindUsage, "invalid input format: %w", err)
+	}
+
+	// Parse all coverage files; GOCOVERDIR files are decoded together
+	merger := coverage.NewMerger()
+	var goCoverData [][]byte
+	for _, file := range files {
+		if err := canceled(ctx); err != nil {
+			return nil, err
+		}
+		if coverage.IsGoCoverDataFile(file.path) {
+			data, err := os.ReadFile(file.path)
+			if err != nil {
+				return nil, newError(KindEnvironment, "failed to read coverage file %s: %w", file.path, err)
+			}
+			goCoverData = append(goCoverData, data)
+			continue
+		}
+		if err := addCoverageFile(merger, file.path, inputFormat); err != nil {
+			return nil, err
+		}
+	}
+	if len(goCoverData) > 0 {
+		profiles, err := coverage.ParseGoCoverData(goCoverData)
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse coverage file %s: %w", file, err)
+			return nil, newError(KindCoverageParse, "failed to decode GOCOVERDIR data in %s: %w", r.config.CoveragePath, err)
+		}
+		if err := merger.Add(profiles...); err != nil {
+			return nil, newError(KindCoverageParse, "failed to merge coverage profiles: %w", err)
 		}
-
-		allProfiles = append(allProfiles, profiles...)
 	}
 
-	// Merge all profiles
-	mergedProfiles, err := coverage.MergeProfiles(allProfiles)
+	// Collect the merged profiles
+	mergedProfiles, err := merger.Profiles()
 	if err != nil {
-		return nil, fmt.Errorf("failed to merge coverage profiles: %w", err)
+		return nil, newError(KindCoverageParse, "failed to merge coverage profiles: %w", err)
 	}
 
 	return mergedProfiles, nil
 }
+
+// addCoverageFile streams a coverage file into merger.
+func addCoverageFile(merger *coverage.Merger, path string, format coverage.Format) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return newError(KindEnvironment, "failed to read coverage file %s: %w", path, err)
+	}
+	defer f.Close()
+	if err := merger.AddFrom(f, format); err != nil {
+		return newError(KindCoverageParse, "failed to parse coverage file %s: %w", path, err)
+	}
+	return nil
+}
@@ -1,12 +1,15 @@
 package local
 
 import (
+	"bytes"
 	"context"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/clock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -46,6 +49,39 @@ func TestRunner_readAndMergeCoverageFiles(t *testing.T) {
 			},
 			expectError: false,
 		},
+		{
+			name: "GOCOVERDIR data next to a text profile",
+			setup: func(t *testing.T) string {
+				tmpDir := t.TempDir()
+				fixture := filepath.Join("..", "..", "testdata", "coverage", "gocoverdir")
+				entries, err := os.ReadDir(fixture)
+				require.NoError(t, err)
+				for _, entry := range entries {
+					data, err := os.ReadFile(filepath.Join(fixture, entry.Name()))
+					require.NoError(t, err)
+					require.NoError(t, os.WriteFile(filepath.Join(tmpDir, entry.Name()), data, 0644))
+				}
+				err = os.WriteFile(filepath.Join(tmpDir, "unit.out"), []byte("mode: set\nexample.com/app/calc/calc.go:18.2,19.1 1 1\n"), 0644)
+				require.NoError(t, err)
+				return tmpDir
+			},
+			expectError: false,
+		},
+		{
+			name: "lcov, Cobertura, and JaCoCo reports next to a text profile",
+			setup: func(t *testing.T) string {
+				tmpDir := t.TempDir()
+				for _, name := range []string{"lcov.info", "cobertura.xml", "jacoco.xml"} {
+					data, err := os.ReadFile(filepath.Join("..", "..", "testdata", "coverage", name))
+					require.NoError(t, err)
+					require.NoError(t, os.WriteFile(filepath.Join(tmpDir, name), data, 0644))
+				}
+				err := os.WriteFile(filepath.Join(tmpDir, "unit.out"), []byte("mode: set\ngithub.com/test/main.go:1.1,2.2 1 1\n"), 0644)
+				require.NoError(t, err)
+				return tmpDir
+			},
+			expectError: false,
+		},
 		{
 			name: "directory does not exist",
 			setup: func(t *testing.T) string {
@@ -88,7 +124,7 @@ func TestRunner_readAndMergeCoverageFiles(t *testing.T) {
 				CoveragePath: coverageDir,
 			})
 
-			profiles, err := runner.readAndMergeCoverageFiles()
+			profiles, err := runner.readAndMergeCoverageFiles(context.Background())
 
 			if tt.expectError {
 				assert.Error(t, err)
@@ -114,7 +150,7 @@ func TestRunner_readAndMergeCoverageFiles_ErrorMessage(t *testing.T) {
 		CoveragePath: nonexistentDir,
 	})
 
-	_, err := runner.readAndMergeCoverageFiles()
+	_, err := runner.readAndMergeCoverageFiles(context.Background())
 	require.Error(t, err)
 
 	errMsg := err.Error()
@@ -171,7 +207,7 @@ github.com/oleg-kozlyuk-grafana/go-canopy/internal/local/runner.go:14.1,16.2 1 0
 		errMsg := err.Error()
 		assert.True(t,
 			strings.Contains(errMsg, "No changes detected") ||
-				strings.Contains(errMsg, "No Go files changed") ||
+				strings.Contains(errMsg, "No source files changed") ||
 				strings.Contains(errMsg, "failed to parse"),
 			"Unexpected error: %v", err)
 	}
@@ -199,3 +235,278 @@ func TestRunner_Run_MissingCoverageDirectory(t *testing.T) {
 		assert.Contains(t, err.Error(), "go test")
 	}
 }
+
+func TestRunner_Run_ExplainMatching(t *testing.T) {
+	tmpDir := t.TempDir()
+	coverageContent := "mode: set\ngithub.com/test/main.go:1.1,2.2 1 1\ngithub.com/test/other.go:1.1,2.2 1 0\n"
+	err := os.WriteFile(filepath.Join(tmpDir, "coverage.out"), []byte(coverageContent), 0644)
+	require.NoError(t, err)
+
+	diffData := []byte("diff --git a/main.go b/main.go\n--- a/main.go\n+++ b/main.go\n@@ -0,0 +1,2 @@\n+package main\n+func main() {}\n" +
+		"diff --git a/cmd/new.go b/cmd/new.go\n--- a/cmd/new.go\n+++ b/cmd/new.go\n@@ -0,0 +1 @@\n+package cmd\n")
+
+	runner := NewRunner(Config{
+		CoveragePath:    tmpDir,
+		Format:          "Text",
+		ExplainMatching: true,
+	}, WithDiffSource(&stubDiffSource{diff: diffData}))
+
+	err = runner.Run(context.Background())
+	assert.NoError(t, err)
+}
+
+func TestRunner_Run_AnnotationLevels(t *testing.T) {
+	tmpDir := t.TempDir()
+	coverageContent := "mode: set\ngithub.com/test/main.go:1.1,2.2 1 0\n"
+	err := os.WriteFile(filepath.Join(tmpDir, "coverage.out"), []byte(coverageContent), 0644)
+	require.NoError(t, err)
+
+	diffData := []byte("diff --git a/main.go b/main.go\n--- a/main.go\n+++ b/main.go\n@@ -0,0 +1,2 @@\n+package main\n+func main() {}\n")
+
+	t.Run("valid levels", func(t *testing.T) {
+		runner := NewRunner(Config{
+			CoveragePath:     tmpDir,
+			Format:           "GitHubAnnotations",
+			AnnotationLevels: "exported=warning,low-coverage=30",
+			SourceRoot:       tmpDir,
+		}, WithDiffSource(&stubDiffSource{diff: diffData}))
+
+		assert.NoError(t, runner.Run(context.Background()))
+	})
+
+	t.Run("sonar format", func(t *testing.T) {
+		runner := NewRunner(Config{
+			CoveragePath:     tmpDir,
+			Format:           "Sonar",
+			AnnotationLevels: "default=warning",
+			SourceRoot:       tmpDir,
+		}, WithDiffSource(&stubDiffSource{diff: diffData}))
+
+		assert.NoError(t, runner.Run(context.Background()))
+	})
+
+	t.Run("invalid levels are a usage error", func(t *testing.T) {
+		runner := NewRunner(Config{
+			CoveragePath:     tmpDir,
+			Format:           "GitHubAnnotations",
+			AnnotationLevels: "exported=loud",
+		}, WithDiffSource(&stubDiffSource{diff: diffData}))
+
+		err := runner.Run(context.Background())
+		require.Error(t, err)
+		assert.Equal(t, KindUsage, KindOf(err))
+	})
+}
+
+func TestRunner_Run_SkipsGeneratedFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(tmpDir, ".gitattributes"), []byte("*.gen.go linguist-generated\n"), 0644)
+	require.NoError(t, err)
+
+	// Only generated files changed, so coverage is never read
+	diffData := []byte("diff --git a/api.gen.go b/api.gen.go\n--- a/api.gen.go\n+++ b/api.gen.go\n@@ -0,0 +1 @@\n+package api\n" +
+		"diff --git a/user.pb.go b/user.pb.go\n--- a/user.pb.go\n+++ b/user.pb.go\n@@ -0,0 +1 @@\n+package api\n")
+	missingCoverage := filepath.Join(tmpDir, "nonexistent")
+
+	runner := NewRunner(Config{
+		CoveragePath: missingCoverage,
+		SourceRoot:   tmpDir,
+	}, WithDiffSource(&stubDiffSource{diff: diffData}))
+	assert.NoError(t, runner.Run(context.Background()))
+
+	runner = NewRunner(Config{
+		CoveragePath:     missingCoverage,
+		SourceRoot:       tmpDir,
+		IncludeGenerated: true,
+	}, WithDiffSource(&stubDiffSource{diff: diffData}))
+	err = runner.Run(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "coverage directory not found")
+}
+
+func TestRunner_Run_PathFilters(t *testing.T) {
+	diffData := []byte("diff --git a/api/types_gen.go b/api/types_gen.go\n--- a/api/types_gen.go\n+++ b/api/types_gen.go\n@@ -0,0 +1 @@\n+package api\n" +
+		"diff --git a/mocks/store.go b/mocks/store.go\n--- a/mocks/store.go\n+++ b/mocks/store.go\n@@ -0,0 +1 @@\n+package mocks\n")
+	missingCoverage := filepath.Join(t.TempDir(), "nonexistent")
+
+	tests := []struct {
+		name        string
+		ignore      []string
+		include     []string
+		expectError bool
+	}{
+		{name: "no filters", expectError: true},
+		{name: "every file ignored", ignore: []string{"**/*_gen.go", "mocks/*"}},
+		{name: "no file included", include: []string{"internal/**"}},
+		{name: "included file ignored", ignore: []string{"*_gen.go"}, include: []string{"api/*"}},
+		{name: "some files left", ignore: []string{"mocks/*"}, expectError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			runner := NewRunner(Config{
+				CoveragePath: missingCoverage,
+				SourceRoot:   t.TempDir(),
+				Ignore:       tt.ignore,
+				Include:      tt.include,
+			}, WithDiffSource(&stubDiffSource{diff: diffData}), WithOutput(&out))
+
+			err := runner.Run(context.Background())
+			if tt.expectError {
+				// Coverage is only read if files are left to analyze
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "coverage directory not found")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "No source files changed in diff\n", out.String())
+		})
+	}
+}
+
+func TestRunner_Run_ReplacedModules(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "go.mod"), []byte("module github.com/test/app\n\nreplace example.com/lib => ./third_party/lib\n"), 0644))
+	coverageContent := "mode: set\nexample.com/lib/vendor.go:1.1,3.2 1 0\n"
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "coverage.out"), []byte(coverageContent), 0644))
+
+	// The profile names the replaced module, the diff its directory
+	diffData := []byte("diff --git a/third_party/lib/vendor.go b/third_party/lib/vendor.go\n--- a/third_party/lib/vendor.go\n+++ b/third_party/lib/vendor.go\n@@ -0,0 +1,3 @@\n+package lib\n+\n+func Lib() {}\n")
+
+	var out bytes.Buffer
+	runner := NewRunner(Config{
+		CoveragePath: tmpDir,
+		Format:       "JSON",
+		SourceRoot:   tmpDir,
+	}, WithDiffSource(&stubDiffSource{diff: diffData}), WithOutput(&out))
+	require.NoError(t, runner.Run(context.Background()))
+	assert.Contains(t, out.String(), `"third_party/lib/vendor.go"`)
+	assert.Contains(t, out.String(), `"path": "third_party/lib/vendor.go",
+        "statements": 1,
+        "covered_statements": 0`, "project coverage lists resolved paths")
+}
+
+func TestRunner_Run_Polyglot(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"lcov.info", "jacoco.xml"} {
+		data, err := os.ReadFile(filepath.Join("..", "..", "testdata", "coverage", name))
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, name), data, 0644))
+	}
+
+	// lcov names the file by its absolute CI path, JaCoCo by its package
+	diffData := []byte("diff --git a/web/src/app.ts b/web/src/app.ts\n--- a/web/src/app.ts\n+++ b/web/src/app.ts\n@@ -0,0 +1,4 @@\n+export function render() {\n+  draw();\n+\n+  fail();\n" +
+		"diff --git a/service/src/main/java/com/acme/service/Billing.java b/service/src/main/java/com/acme/service/Billing.java\n--- a/service/src/main/java/com/acme/service/Billing.java\n+++ b/service/src/main/java/com/acme/service/Billing.java\n@@ -5,0 +5,2 @@\n+    charge();\n+    refund();\n")
+
+	var out bytes.Buffer
+	runner := NewRunner(Config{
+		CoveragePath: tmpDir,
+		Format:       "JSON",
+		SourceRoot:   tmpDir,
+	}, WithDiffSource(&stubDiffSource{diff: diffData}), WithOutput(&out))
+	require.NoError(t, runner.Run(context.Background()))
+
+	assert.Contains(t, out.String(), `"added_lines": 5,
+    "covered_lines": 3,`)
+	assert.Contains(t, out.String(), `"path": "web/src/app.ts",
+      "uncovered_lines": [
+        4
+      ]`)
+	assert.Contains(t, out.String(), `"path": "service/src/main/java/com/acme/service/Billing.java",
+      "uncovered_lines": [
+        6
+      ]`)
+}
+
+func TestRunner_Run_Clock(t *testing.T) {
+	tmpDir := t.TempDir()
+	coverageContent := "mode: set\ngithub.com/test/main.go:1.1,3.2 1 0\n"
+	err := os.WriteFile(filepath.Join(tmpDir, "coverage.out"), []byte(coverageContent), 0644)
+	require.NoError(t, err)
+
+	diffData := []byte("diff --git a/main.go b/main.go\n--- a/main.go\n+++ b/main.go\n@@ -0,0 +1,3 @@\n+package main\n" +
+		"+// canopy:ignore 2024-01-01 flaky\n+func main() {}\n")
+
+	run := func(t *testing.T, c clock.Clock) string {
+		var out bytes.Buffer
+		runner := NewRunner(Config{
+			CoveragePath:          tmpDir,
+			Format:                "JSON",
+			SourceRoot:            tmpDir,
+			SuppressionMaxAgeDays: 30,
+			Clock:                 c,
+		}, WithDiffSource(&stubDiffSource{diff: diffData}), WithOutput(&out))
+		require.NoError(t, runner.Run(context.Background()))
+		return out.String()
+	}
+
+	fresh := clock.Fixed(time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC))
+	expired := clock.Fixed(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC))
+
+	assert.Equal(t, run(t, fresh), run(t, fresh), "identical inputs and time should produce identical output")
+	assert.NotEqual(t, run(t, fresh), run(t, expired), "suppression should expire at the later time")
+}
+
+func TestRunner_Run_HTMLOutput(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "coverage.out"), []byte("mode: set\ngithub.com/test/main.go:3.13,3.15 1 0\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644))
+	diffData := []byte("diff --git a/main.go b/main.go\n--- a/main.go\n+++ b/main.go\n@@ -0,0 +1,3 @@\n+package main\n+\n+func main() {}\n")
+
+	t.Run("written to the output file", func(t *testing.T) {
+		output := filepath.Join(t.TempDir(), "report.html")
+		var out bytes.Buffer
+		runner := NewRunner(Config{
+			CoveragePath: tmpDir,
+			Format:       "html",
+			SourceRoot:   tmpDir,
+			Output:       output,
+		}, WithDiffSource(&stubDiffSource{diff: diffData}), WithOutput(&out))
+		require.NoError(t, runner.Run(context.Background()))
+		assert.Empty(t, out.String())
+
+		html, err := os.ReadFile(output)
+		require.NoError(t, err)
+		assert.Contains(t, string(html), `<tr class="uncovered"><td class="number">3</td><td>func main() {}</td></tr>`)
+		assert.Contains(t, string(html), `<tr class="added"><td class="number">1</td><td>package main</td></tr>`)
+	})
+
+	t.Run("unwritable output file", func(t *testing.T) {
+		runner := NewRunner(Config{
+			CoveragePath: tmpDir,
+			Format:       "html",
+			SourceRoot:   tmpDir,
+			Output:       filepath.Join(tmpDir, "missing", "report.html"),
+		}, WithDiffSource(&stubDiffSource{diff: diffData}), WithOutput(&bytes.Buffer{}))
+		err := runner.Run(context.Background())
+		require.Error(t, err)
+		assert.Equal(t, KindEnvironment, KindOf(err))
+		assert.Contains(t, err.Error(), "failed to create output file")
+	})
+}
+
+func TestRunner_Run_StepSummary(t *testing.T) {
+	tmpDir := t.TempDir()
+	coverageContent := "mode: set\ngithub.com/test/main.go:1.1,2.2 1 0\n"
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "coverage.out"), []byte(coverageContent), 0644))
+	diffData := []byte("diff --git a/main.go b/main.go\n--- a/main.go\n+++ b/main.go\n@@ -0,0 +1,2 @@\n+package main\n+func main() {}\n")
+
+	summary := filepath.Join(t.TempDir(), "step_summary.md")
+	require.NoError(t, os.WriteFile(summary, []byte("# Build\n"), 0644))
+
+	for _, formatName := range []string{"GitHubAnnotations", "Text"} {
+		var out bytes.Buffer
+		runner := NewRunner(Config{
+			CoveragePath: tmpDir,
+			Format:       formatName,
+			StepSummary:  summary,
+		}, WithDiffSource(&stubDiffSource{diff: diffData}), WithOutput(&out))
+		require.NoError(t, runner.Run(context.Background()))
+	}
+
+	data, err := os.ReadFile(summary)
+	require.NoError(t, err)
+	// Appended once, for the GitHubAnnotations format only
+	assert.True(t, strings.HasPrefix(string(data), "# Build\n## Uncovered Lines in Diff\n"), string(data))
+	assert.Equal(t, 1, strings.Count(string(data), "## Uncovered Lines in Diff"))
+}
@@ -0,0 +1,68 @@
+package local
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/diff"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/format"
+)
+
+// TeamReport writes the executable lines added in a range (the diff of the
+// Runner, e.g. a GitWindowDiffSource from a date) aggregated by the author
+// of the commit that last changed them at HEAD, per git blame. Only counts
+// per author are written, never files or lines. Config.Format selects
+// Markdown (the default) or JSON.
+func (r *Runner) TeamReport(ctx context.Context, since string) error {
+	var write func(*format.TeamReport, io.Writer) error
+	switch strings.ToLower(r.config.Format) {
+	case "", "markdown":
+		write = format.FormatTeamMarkdown
+	case "json":
+		write = format.FormatTeamJSON
+	default:
+		return newError(KindUsage, "unsupported team report format %q (supported: Markdown, JSON)", r.config.Format)
+	}
+
+	a, err := r.analyze(ctx)
+	if err != nil || a == nil {
+		return err
+	}
+	lineCoverage := coverage.LineCoverageByFile(a.profiles, a.addedLinesByFile)
+
+	authors := make(map[string]map[int]diff.Author, len(lineCoverage))
+	for file, lines := range lineCoverage {
+		if err := canceled(ctx); err != nil {
+			return err
+		}
+		numbers := make([]int, 0, len(lines))
+		for line := range lines {
+			numbers = append(numbers, line)
+		}
+		if authors[file], err = diff.Blame(ctx, r.config.SourceRoot, file, numbers); err != nil {
+			if ctxErr := canceled(ctx); ctxErr != nil {
+				return ctxErr
+			}
+			return newError(KindEnvironment, "%w", err)
+		}
+	}
+	report := format.NewTeamReport(since, a.result, lineCoverage, func(file string, line int) (string, string) {
+		author := authors[file][line]
+		return author.Name, author.Email
+	})
+
+	out, closeOutput, err := r.openOutput()
+	if err != nil {
+		return err
+	}
+	err = write(report, out)
+	if closeErr := closeOutput(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return newError(KindEnvironment, "failed to write team report: %w", err)
+	}
+	return nil
+}
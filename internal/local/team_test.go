@@ -0,0 +1,87 @@
+package local
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunner_TeamReport(t *testing.T) {
+	tmpDir := t.TempDir()
+	gitRun := func(env []string, args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", tmpDir}, args...)...)
+		cmd.Env = append(os.Environ(), env...)
+		require.NoError(t, cmd.Run())
+	}
+	gitRun(nil, "init")
+	gitRun(nil, "config", "user.email", "test@test.com")
+	gitRun(nil, "config", "user.name", "Test User")
+
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "go.mod"), []byte("module github.com/test/app\n"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(tmpDir, "api"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "api", "handler.go"), []byte("package api\nfunc A() {\n}\n"), 0644))
+	gitRun(nil, "add", ".")
+	gitRun([]string{"GIT_AUTHOR_NAME=Alice", "GIT_AUTHOR_EMAIL=alice@example.com"}, "commit", "-m", "add A")
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "api", "handler.go"), []byte("package api\nfunc A() {\n}\nfunc B() {\n}\n"), 0644))
+	gitRun(nil, "add", ".")
+	gitRun([]string{"GIT_AUTHOR_NAME=Bob", "GIT_AUTHOR_EMAIL=bob@example.com"}, "commit", "-m", "add B")
+
+	coverageContent := "mode: set\n" +
+		"github.com/test/app/api/handler.go:2.1,3.2 1 1\ngithub.com/test/app/api/handler.go:4.1,5.2 1 0\n"
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "coverage.out"), []byte(coverageContent), 0644))
+
+	diffData := []byte("diff --git a/api/handler.go b/api/handler.go\n--- a/api/handler.go\n+++ b/api/handler.go\n@@ -0,0 +1,5 @@\n+package api\n+func A() {\n+}\n+func B() {\n+}\n")
+
+	run := func(t *testing.T, format string) (string, error) {
+		var out bytes.Buffer
+		runner := NewRunner(Config{
+			CoveragePath: tmpDir,
+			Format:       format,
+			SourceRoot:   tmpDir,
+		}, WithDiffSource(&stubDiffSource{diff: diffData}), WithOutput(&out))
+		err := runner.TeamReport(context.Background(), "2026-07-01")
+		return out.String(), err
+	}
+
+	t.Run("markdown", func(t *testing.T) {
+		out, err := run(t, "Markdown")
+		require.NoError(t, err)
+		assert.Contains(t, out, "## Test coverage by author since 2026-07-01")
+		assert.Contains(t, out, "4 executable lines added by 2 authors, 2 covered (50.0%).")
+		assert.Contains(t, out, "| Alice | 2 | 2 | 0 | 0 | 100.0% |")
+		assert.Contains(t, out, "| Bob | 2 | 0 | 2 | 0 | 0.0% |")
+		assert.NotContains(t, out, "handler.go")
+	})
+
+	t.Run("json", func(t *testing.T) {
+		out, err := run(t, "JSON")
+		require.NoError(t, err)
+		assert.Contains(t, out, `"email": "bob@example.com"`)
+	})
+
+	t.Run("unsupported format is a usage error", func(t *testing.T) {
+		_, err := run(t, "HTML")
+		require.Error(t, err)
+		assert.Equal(t, KindUsage, KindOf(err))
+	})
+
+	t.Run("blame outside a repository is an environment error", func(t *testing.T) {
+		outside := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(outside, "go.mod"), []byte("module github.com/test/app\n"), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(outside, "coverage.out"), []byte(coverageContent), 0644))
+		runner := NewRunner(Config{
+			CoveragePath: outside,
+			SourceRoot:   outside,
+		}, WithDiffSource(&stubDiffSource{diff: diffData}), WithOutput(&bytes.Buffer{}))
+		err := runner.TeamReport(context.Background(), "2026-07-01")
+		require.Error(t, err)
+		assert.Equal(t, KindEnvironment, KindOf(err))
+	})
+}
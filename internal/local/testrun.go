@@ -0,0 +1,152 @@
+package local
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+)
+
+// TestRun configures the go test run of RunTests.
+type TestRun struct {
+	// Packages are the package patterns to test; empty tests ./...
+	Packages []string
+	// ChangedOnly tests only the packages with Go files changed in the diff
+	// (see ChangedPackages) instead of Packages
+	ChangedOnly bool
+	// Affected tests only the packages whose tests could cover the changed
+	// lines (see AffectedPackages) instead of Packages
+	Affected bool
+	// Args are extra arguments to go test, e.g. -race or -run
+	Args []string
+	// Output receives go test's output; nil uses os.Stderr, so reports on
+	// stdout stay machine-readable
+	Output io.Writer
+}
+
+// coverageProfileName is the name of the profile RunTests has go test write.
+const coverageProfileName = "coverage.out"
+
+// RunTests runs go test with -coverprofile into a temporary coverage
+// directory, which replaces Config.CoveragePath, then runs the analysis of
+// Run on the profile. Failing tests are a KindEnvironment error, and stop
+// before the analysis.
+func (r *Runner) RunTests(ctx context.Context, run TestRun) error {
+	packages := run.Packages
+	if run.ChangedOnly || run.Affected {
+		var err error
+		if run.Affected {
+			packages, err = r.Affected(ctx)
+		} else {
+			packages, err = r.changedPackages(ctx)
+		}
+		if err != nil {
+			return err
+		}
+		if len(packages) == 0 {
+			fmt.Fprintln(r.out, "No Go packages changed in diff")
+			return nil
+		}
+	}
+	if len(packages) == 0 {
+		packages = []string{"./..."}
+	}
+
+	dir, err := os.MkdirTemp("", "canopy-run-")
+	if err != nil {
+		return newError(KindEnvironment, "failed to create coverage directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	args := append([]string{"test", "-coverprofile=" + filepath.Join(dir, coverageProfileName)}, run.Args...)
+	args = append(args, packages...)
+	output := run.Output
+	if output == nil {
+		output = os.Stderr
+	}
+	fmt.Fprintf(output, "Running go %s\n", strings.Join(args, " "))
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Dir = r.config.SourceRoot
+	cmd.Stdout = output
+	cmd.Stderr = output
+	if err := cmd.Run(); err != nil {
+		if err := canceled(ctx); err != nil {
+			return err
+		}
+		return newError(KindEnvironment, "go test failed: %w", err)
+	}
+
+	runner := *r
+	runner.config.CoveragePath = dir
+	return runner.Run(ctx)
+}
+
+// changedPackages returns the packages with Go files changed in the diff
+// (see ChangedPackages).
+func (r *Runner) changedPackages(ctx context.Context) ([]string, error) {
+	diffData, err := r.readDiff(ctx)
+	if err != nil {
+		return nil, err
+	}
+	packages, err := ChangedPackages(diffData, r.config.SourceRoot)
+	if err != nil {
+		return nil, newError(KindEnvironment, "failed to parse diff: %w", err)
+	}
+	return packages, nil
+}
+
+// ChangedPackages returns the directories of the Go files added or changed
+// in a diff as sorted go test package patterns (./dir). Directories the go
+// tool ignores (testdata, and names starting with . or _) are left out, as
+// are directories that no longer exist under root because the diff deleted
+// them.
+func ChangedPackages(diffData []byte, root string) ([]string, error) {
+	if len(diffData) == 0 {
+		return nil, nil
+	}
+	fileDiffs, err := coverage.ParseDiff(diffData)
+	if err != nil {
+		return nil, err
+	}
+
+	var packages []string
+	for _, fd := range fileDiffs {
+		if fd.IsDeleted || path.Ext(fd.NewName) != ".go" {
+			continue
+		}
+		dir := path.Dir(fd.NewName)
+		if ignoredByGo(dir) {
+			continue
+		}
+		if info, err := os.Stat(filepath.Join(root, filepath.FromSlash(dir))); err != nil || !info.IsDir() {
+			continue
+		}
+		pkg := "./" + dir
+		if dir == "." {
+			pkg = "."
+		}
+		if !slices.Contains(packages, pkg) {
+			packages = append(packages, pkg)
+		}
+	}
+	slices.Sort(packages)
+	return packages, nil
+}
+
+// ignoredByGo reports whether the go tool ignores a directory in package
+// patterns.
+func ignoredByGo(dir string) bool {
+	for _, elem := range strings.Split(dir, "/") {
+		if elem == "testdata" || (elem != "." && (strings.HasPrefix(elem, ".") || strings.HasPrefix(elem, "_"))) {
+			return true
+		}
+	}
+	return false
+}
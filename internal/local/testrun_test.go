@@ -0,0 +1,115 @@
+package local
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeModule writes a module with a tested calc package and a broken
+// package whose test fails.
+func writeModule(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	files := map[string]string{
+		"go.mod":                "module example.com/calc\n\ngo 1.21\n",
+		"calc/calc.go":          "package calc\n\nfunc Add(a, b int) int {\n\treturn a + b\n}\n\nfunc Sub(a, b int) int {\n\treturn a - b\n}\n",
+		"calc/calc_test.go":     "package calc\n\nimport \"testing\"\n\nfunc TestAdd(t *testing.T) {\n\tif Add(1, 2) != 3 {\n\t\tt.Fail()\n\t}\n}\n",
+		"broken/broken.go":      "package broken\n",
+		"broken/broken_test.go": "package broken\n\nimport \"testing\"\n\nfunc TestBroken(t *testing.T) {\n\tt.Fatal(\"broken\")\n}\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	return root
+}
+
+func TestRunner_RunTests(t *testing.T) {
+	root := writeModule(t)
+	diffData := []byte("diff --git a/calc/calc.go b/calc/calc.go\n--- a/calc/calc.go\n+++ b/calc/calc.go\n@@ -5,0 +6,4 @@\n+\n+func Sub(a, b int) int {\n+\treturn a - b\n+}\n")
+
+	t.Run("changed packages", func(t *testing.T) {
+		var out, testOutput bytes.Buffer
+		runner := NewRunner(Config{Format: "JSON", SourceRoot: root, CoveragePath: "unused"},
+			WithDiffSource(&stubDiffSource{diff: diffData}), WithOutput(&out))
+
+		err := runner.RunTests(context.Background(), TestRun{ChangedOnly: true, Output: &testOutput})
+		require.NoError(t, err, testOutput.String())
+		assert.Contains(t, testOutput.String(), "go test -coverprofile=")
+		assert.Contains(t, testOutput.String(), "./calc")
+		assert.NotContains(t, testOutput.String(), "broken")
+		assert.Contains(t, out.String(), `"calc/calc.go"`)
+		assert.Contains(t, out.String(), `"uncovered_lines"`)
+	})
+
+	t.Run("failing tests", func(t *testing.T) {
+		var out, testOutput bytes.Buffer
+		runner := NewRunner(Config{Format: "JSON", SourceRoot: root},
+			WithDiffSource(&stubDiffSource{diff: diffData}), WithOutput(&out))
+
+		err := runner.RunTests(context.Background(), TestRun{Packages: []string{"./..."}, Args: []string{"-count=1"}, Output: &testOutput})
+		require.Error(t, err)
+		assert.Equal(t, KindEnvironment, KindOf(err))
+		assert.Contains(t, err.Error(), "go test failed")
+		assert.Contains(t, testOutput.String(), "-count=1 ./...")
+		assert.Empty(t, out.String())
+	})
+
+	t.Run("no changed packages", func(t *testing.T) {
+		var out bytes.Buffer
+		readme := []byte("diff --git a/README.md b/README.md\n--- a/README.md\n+++ b/README.md\n@@ -0,0 +1 @@\n+# calc\n")
+		runner := NewRunner(Config{SourceRoot: root}, WithDiffSource(&stubDiffSource{diff: readme}), WithOutput(&out))
+
+		require.NoError(t, runner.RunTests(context.Background(), TestRun{ChangedOnly: true}))
+		assert.Equal(t, "No Go packages changed in diff\n", out.String())
+	})
+}
+
+func TestChangedPackages(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"cmd/app", "internal/calc", "internal/calc/testdata"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(root, dir), 0755))
+	}
+	fileDiff := func(name string) string {
+		return "diff --git a/" + name + " b/" + name + "\n--- a/" + name + "\n+++ b/" + name + "\n@@ -0,0 +1 @@\n+x\n"
+	}
+
+	tests := []struct {
+		name     string
+		diff     string
+		expected []string
+	}{
+		{
+			name:     "packages of Go files",
+			diff:     fileDiff("internal/calc/calc.go") + fileDiff("internal/calc/calc_test.go") + fileDiff("cmd/app/main.go"),
+			expected: []string{"./cmd/app", "./internal/calc"},
+		},
+		{
+			name:     "root package",
+			diff:     fileDiff("main.go"),
+			expected: []string{"."},
+		},
+		{
+			name: "non-Go, testdata, and removed directories",
+			diff: fileDiff("README.md") + fileDiff("internal/calc/testdata/fixture.go") + fileDiff("internal/gone/gone.go") +
+				"diff --git a/cmd/app/old.go b/cmd/app/old.go\ndeleted file mode 100644\n--- a/cmd/app/old.go\n+++ /dev/null\n@@ -1 +0,0 @@\n-x\n",
+			expected: nil,
+		},
+		{name: "empty diff", expected: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packages, err := ChangedPackages([]byte(tt.diff), root)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, packages)
+		})
+	}
+}
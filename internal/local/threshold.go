@@ -0,0 +1,42 @@
+package local
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+)
+
+// validateThresholds checks Config.FailUnderPatch and
+// Config.MaxUncoveredLines before the analysis runs.
+func (r *Runner) validateThresholds() error {
+	if r.config.FailUnderPatch < 0 || r.config.FailUnderPatch > 100 {
+		return newError(KindUsage, "patch coverage threshold must be between 0 and 100, got %g", r.config.FailUnderPatch)
+	}
+	if limit := r.config.MaxUncoveredLines; limit != nil && *limit < 0 {
+		return newError(KindUsage, "maximum uncovered lines must not be negative, got %d", *limit)
+	}
+	return nil
+}
+
+// checkThresholds returns a KindThreshold error listing the thresholds the
+// result doesn't meet, or nil if it meets them all. A diff without
+// executable added lines meets every threshold.
+func (r *Runner) checkThresholds(result *coverage.AnalysisResult) error {
+	if result.DiffAddedLines == 0 {
+		return nil
+	}
+	var failures []string
+	patch := float64(result.DiffAddedCovered) / float64(result.DiffAddedLines) * 100
+	if r.config.FailUnderPatch > 0 && patch < r.config.FailUnderPatch {
+		failures = append(failures, fmt.Sprintf("patch coverage %.2f%% is below %g%%", patch, r.config.FailUnderPatch))
+	}
+	uncovered := result.DiffAddedLines - result.DiffAddedCovered
+	if limit := r.config.MaxUncoveredLines; limit != nil && uncovered > *limit {
+		failures = append(failures, fmt.Sprintf("%d uncovered lines exceed the maximum of %d", uncovered, *limit))
+	}
+	if len(failures) == 0 {
+		return nil
+	}
+	return newError(KindThreshold, "coverage threshold not met: %s", strings.Join(failures, "; "))
+}
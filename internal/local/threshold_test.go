@@ -0,0 +1,96 @@
+package local
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunner_Run_Thresholds(t *testing.T) {
+	// Two of the four added lines are covered: 50% patch coverage
+	tmpDir := t.TempDir()
+	coverageContent := "mode: set\ngithub.com/test/main.go:1.1,2.2 1 1\ngithub.com/test/main.go:3.1,4.2 1 0\n"
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "coverage.out"), []byte(coverageContent), 0644))
+	diffData := []byte("diff --git a/main.go b/main.go\n--- a/main.go\n+++ b/main.go\n@@ -0,0 +1,4 @@\n+a\n+b\n+c\n+d\n")
+	noSources := []byte("diff --git a/README.md b/README.md\n--- a/README.md\n+++ b/README.md\n@@ -0,0 +1 @@\n+x\n")
+	lines := func(n int) *int { return &n }
+
+	tests := []struct {
+		name              string
+		diff              []byte
+		failUnderPatch    float64
+		maxUncoveredLines *int
+		kind              ErrorKind
+		errorMsg          string
+	}{
+		{name: "no thresholds"},
+		{name: "patch coverage met", failUnderPatch: 50},
+		{name: "maximum uncovered lines met", maxUncoveredLines: lines(2)},
+		{
+			name:           "patch coverage below threshold",
+			failUnderPatch: 80,
+			kind:           KindThreshold,
+			errorMsg:       "coverage threshold not met: patch coverage 50.00% is below 80%",
+		},
+		{
+			name:              "too many uncovered lines",
+			maxUncoveredLines: lines(0),
+			kind:              KindThreshold,
+			errorMsg:          "coverage threshold not met: 2 uncovered lines exceed the maximum of 0",
+		},
+		{
+			name:              "both thresholds",
+			failUnderPatch:    75.5,
+			maxUncoveredLines: lines(1),
+			kind:              KindThreshold,
+			errorMsg:          "coverage threshold not met: patch coverage 50.00% is below 75.5%; 2 uncovered lines exceed the maximum of 1",
+		},
+		{name: "no source changes", diff: noSources, failUnderPatch: 100, maxUncoveredLines: lines(0)},
+		{
+			name:           "invalid patch coverage",
+			failUnderPatch: 120,
+			kind:           KindUsage,
+			errorMsg:       "patch coverage threshold must be between 0 and 100, got 120",
+		},
+		{
+			name:              "invalid maximum uncovered lines",
+			maxUncoveredLines: lines(-1),
+			kind:              KindUsage,
+			errorMsg:          "maximum uncovered lines must not be negative, got -1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := diffData
+			if tt.diff != nil {
+				diff = tt.diff
+			}
+			var out bytes.Buffer
+			runner := NewRunner(Config{
+				CoveragePath:      tmpDir,
+				Format:            "Text",
+				FailUnderPatch:    tt.failUnderPatch,
+				MaxUncoveredLines: tt.maxUncoveredLines,
+			}, WithDiffSource(&stubDiffSource{diff: diff}), WithOutput(&out))
+
+			err := runner.Run(context.Background())
+			if tt.errorMsg == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.errorMsg)
+			assert.Equal(t, tt.kind, KindOf(err))
+			if tt.kind == KindThreshold {
+				// The report is written before failing
+				assert.Contains(t, out.String(), "main.go")
+				assert.Equal(t, ExitThreshold, ExitCode(err))
+			}
+		})
+	}
+}
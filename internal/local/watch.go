@@ -0,0 +1,186 @@
+package local
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+)
+
+// DefaultWatchInterval is how often a Watcher polls files by default.
+const DefaultWatchInterval = 500 * time.Millisecond
+
+// Watcher re-runs an analysis whenever coverage files or Go sources change,
+// for TDD loops that rerun go test -coverprofile. It polls file sizes and
+// modification times rather than subscribing to file system events, so it
+// behaves the same on every platform and with editors that replace files
+// instead of writing them.
+type Watcher struct {
+	// CoveragePath is the directory coverage files are watched in
+	CoveragePath string
+	// Root is the working tree Go sources are watched in; empty uses the
+	// current directory. Hidden directories, vendor, and node_modules are
+	// skipped.
+	Root string
+	// Exclude lists files and directories not to watch, such as the cache
+	// directory and the report file
+	Exclude []string
+	// Interval is how often files are polled; 0 uses DefaultWatchInterval
+	Interval time.Duration
+	// Log receives a line per re-run and failed analysis; nil uses os.Stderr
+	Log io.Writer
+}
+
+// fileState is what a Watcher compares to tell whether a file changed.
+type fileState struct {
+	size    int64
+	modTime int64
+}
+
+// Watch runs analyze, then again after every change to the watched files
+// until ctx is done. A change is acted on once the files have stopped
+// changing for an interval, so a coverage profile go test is still writing
+// isn't read half-done. Failed analyses are logged rather than ending the
+// watch, since the next test run may fix them.
+func (w *Watcher) Watch(ctx context.Context, analyze func(context.Context) error) error {
+	interval := w.Interval
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	last := w.snapshot()
+	w.run(ctx, analyze)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	pending := last
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		current := w.snapshot()
+		if !maps.Equal(current, pending) {
+			// Still changing; wait for the files to settle
+			pending = current
+			continue
+		}
+		if maps.Equal(current, last) {
+			continue
+		}
+		fmt.Fprintf(w.log(), "\n%s changed, re-running analysis\n", describeChanges(last, current))
+		last = current
+		w.run(ctx, analyze)
+	}
+}
+
+// run runs one analysis and logs its failure, unless the watch is over.
+func (w *Watcher) run(ctx context.Context, analyze func(context.Context) error) {
+	if err := analyze(ctx); err != nil && ctx.Err() == nil {
+		fmt.Fprintf(w.log(), "Analysis failed: %v\n", err)
+	}
+	if ctx.Err() == nil {
+		fmt.Fprintf(w.log(), "Watching %s and Go sources for changes (Ctrl-C to stop)\n", w.CoveragePath)
+	}
+}
+
+// snapshot returns the state of the watched files by path. Files that
+// can't be read, or disappear while being listed, are left out, and show
+// up as changed once they can be read again.
+func (w *Watcher) snapshot() map[string]fileState {
+	files := make(map[string]fileState)
+	add := func(path string, info fs.FileInfo) {
+		files[path] = fileState{size: info.Size(), modTime: info.ModTime().UnixNano()}
+	}
+
+	if entries, err := os.ReadDir(w.CoveragePath); err == nil {
+		for _, entry := range entries {
+			name := entry.Name()
+			path := filepath.Join(w.CoveragePath, name)
+			if entry.IsDir() || w.excluded(path) || !(isCoverageFile(name) || coverage.IsGoCoverDataFile(name)) {
+				continue
+			}
+			if info, err := entry.Info(); err == nil {
+				add(path, info)
+			}
+		}
+	}
+
+	root := w.Root
+	if root == "" {
+		root = "."
+	}
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if path != root && (strings.HasPrefix(name, ".") || name == "vendor" || name == "node_modules" || w.excluded(path)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if (filepath.Ext(path) != ".go" && d.Name() != "go.mod") || w.excluded(path) {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			add(path, info)
+		}
+		return nil
+	})
+	return files
+}
+
+// excluded reports whether path is, or is in, one of the excluded paths.
+func (w *Watcher) excluded(path string) bool {
+	path = filepath.Clean(path)
+	for _, exclude := range w.Exclude {
+		if exclude == "" {
+			continue
+		}
+		exclude = filepath.Clean(exclude)
+		if path == exclude || strings.HasPrefix(path, exclude+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// describeChanges names the files added, changed, or removed between two
+// snapshots, e.g. "calc.go, calc_test.go and 2 more files".
+func describeChanges(before, after map[string]fileState) string {
+	var changed []string
+	for path, state := range after {
+		if previous, ok := before[path]; !ok || previous != state {
+			changed = append(changed, path)
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	slices.Sort(changed)
+
+	const shown = 3
+	if len(changed) <= shown {
+		return strings.Join(changed, ", ")
+	}
+	return fmt.Sprintf("%s and %d more files", strings.Join(changed[:shown], ", "), len(changed)-shown)
+}
+
+func (w *Watcher) log() io.Writer {
+	if w.Log == nil {
+		return os.Stderr
+	}
+	return w.Log
+}
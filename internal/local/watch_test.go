@@ -0,0 +1,122 @@
+package local
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatcher_Watch(t *testing.T) {
+	root := t.TempDir()
+	coverageDir := filepath.Join(root, ".coverage")
+	require.NoError(t, os.Mkdir(coverageDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "calc.go"), []byte("package calc\n"), 0644))
+
+	var log bytes.Buffer
+	w := &Watcher{CoveragePath: coverageDir, Root: root, Interval: 10 * time.Millisecond, Log: &log}
+	runs := make(chan int, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		n := 0
+		done <- w.Watch(ctx, func(ctx context.Context) error {
+			n++
+			runs <- n
+			if n == 2 {
+				return errors.New("no coverage files")
+			}
+			return nil
+		})
+	}()
+
+	waitRun := func(expected int) {
+		t.Helper()
+		select {
+		case n := <-runs:
+			assert.Equal(t, expected, n)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("analysis %d didn't run", expected)
+		}
+	}
+	waitRun(1)
+
+	require.NoError(t, os.WriteFile(filepath.Join(coverageDir, "coverage.out"), []byte("mode: set\n"), 0644))
+	waitRun(2)
+
+	require.NoError(t, os.WriteFile(filepath.Join(root, "calc.go"), []byte("package calc\n\nfunc Add() {}\n"), 0644))
+	waitRun(3)
+
+	cancel()
+	require.NoError(t, <-done)
+	assert.Contains(t, log.String(), filepath.Join(coverageDir, "coverage.out")+" changed, re-running analysis")
+	assert.Contains(t, log.String(), "Analysis failed: no coverage files")
+	assert.Contains(t, log.String(), filepath.Join(root, "calc.go")+" changed, re-running analysis")
+}
+
+func TestWatcher_snapshot(t *testing.T) {
+	root := t.TempDir()
+	coverageDir := filepath.Join(root, ".coverage")
+	cacheDir := filepath.Join(root, "cache")
+	for _, dir := range []string{coverageDir, cacheDir, filepath.Join(root, ".git"), filepath.Join(root, "vendor"), filepath.Join(root, "pkg")} {
+		require.NoError(t, os.Mkdir(dir, 0755))
+	}
+	for _, file := range []string{
+		"go.mod", "main.go", "README.md", "pkg/calc.go", "vendor/dep.go", ".git/hook.go", "cache/entry.go",
+		".coverage/coverage.out", ".coverage/lcov.info", ".coverage/notes.txt", ".coverage/report.xml",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(root, file), []byte("x"), 0644))
+	}
+
+	w := &Watcher{
+		CoveragePath: coverageDir,
+		Root:         root,
+		Exclude:      []string{cacheDir, filepath.Join(coverageDir, "report.xml")},
+	}
+	var paths []string
+	for path := range w.snapshot() {
+		rel, err := filepath.Rel(root, path)
+		require.NoError(t, err)
+		paths = append(paths, filepath.ToSlash(rel))
+	}
+	slices.Sort(paths)
+	assert.Equal(t, []string{".coverage/coverage.out", ".coverage/lcov.info", "go.mod", "main.go", "pkg/calc.go"}, paths)
+}
+
+func TestDescribeChanges(t *testing.T) {
+	before := map[string]fileState{"a.go": {size: 1}, "b.go": {size: 1}, "c.go": {size: 1}}
+	tests := []struct {
+		name     string
+		after    map[string]fileState
+		expected string
+	}{
+		{
+			name:     "changed",
+			after:    map[string]fileState{"a.go": {size: 2}, "b.go": {size: 1}, "c.go": {size: 1}},
+			expected: "a.go",
+		},
+		{
+			name:     "added and removed",
+			after:    map[string]fileState{"a.go": {size: 1}, "b.go": {size: 1}, "d.go": {size: 1}},
+			expected: "c.go, d.go",
+		},
+		{
+			name:     "many",
+			after:    map[string]fileState{"a.go": {modTime: 1}, "b.go": {modTime: 1}, "c.go": {modTime: 1}, "d.go": {}, "e.go": {}},
+			expected: "a.go, b.go, c.go and 2 more files",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, describeChanges(before, tt.after))
+		})
+	}
+}
@@ -0,0 +1,78 @@
+// Package logging configures the services' structured logs: JSON lines on
+// a writer at a level set by CANOPY_LOG_LEVEL, and the correlation ID that
+// traces a workflow run's processing from the webhook delivery, through
+// the queue, to the worker and the check run it publishes.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// CorrelationIDKey is the log attribute of a correlation ID.
+const CorrelationIDKey = "correlation_id"
+
+// New creates a logger writing JSON lines to w at level and above. Records
+// logged with a context carrying a correlation ID (see WithCorrelationID)
+// include it.
+func New(w io.Writer, level slog.Level) *slog.Logger {
+	return slog.New(&contextHandler{Handler: slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})})
+}
+
+// ParseLevel parses a log level: debug, info, warn, or error, in any case.
+// Empty is info.
+func ParseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return 0, fmt.Errorf("unknown log level %q (expected debug, info, warn, or error)", s)
+	}
+}
+
+// correlationKey is the context key of a correlation ID.
+type correlationKey struct{}
+
+// WithCorrelationID returns a context carrying a correlation ID. An empty
+// ID returns ctx unchanged.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, correlationKey{}, id)
+}
+
+// CorrelationID returns the correlation ID of ctx, or empty if it has none.
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationKey{}).(string)
+	return id
+}
+
+// contextHandler adds the correlation ID of a record's context to it.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := CorrelationID(ctx); id != "" {
+		r.AddAttrs(slog.String(CorrelationIDKey, id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
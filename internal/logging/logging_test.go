@@ -0,0 +1,98 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected slog.Level
+		errorMsg string
+	}{
+		{value: "", expected: slog.LevelInfo},
+		{value: "debug", expected: slog.LevelDebug},
+		{value: "INFO", expected: slog.LevelInfo},
+		{value: "warn", expected: slog.LevelWarn},
+		{value: "warning", expected: slog.LevelWarn},
+		{value: " error ", expected: slog.LevelError},
+		{value: "verbose", errorMsg: `unknown log level "verbose"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			level, err := ParseLevel(tt.value)
+			if tt.errorMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, level)
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name     string
+		level    slog.Level
+		log      func(ctx context.Context, logger *slog.Logger)
+		expected []map[string]any
+	}{
+		{
+			name:  "correlation ID from the context",
+			level: slog.LevelInfo,
+			log: func(ctx context.Context, logger *slog.Logger) {
+				logger.With("org", "acme").InfoContext(WithCorrelationID(ctx, "72d3162e"), "queued work request")
+			},
+			expected: []map[string]any{{"level": "INFO", "msg": "queued work request", "org": "acme", "correlation_id": "72d3162e"}},
+		},
+		{
+			name:  "no correlation ID",
+			level: slog.LevelInfo,
+			log: func(ctx context.Context, logger *slog.Logger) {
+				logger.InfoContext(WithCorrelationID(ctx, ""), "started")
+			},
+			expected: []map[string]any{{"level": "INFO", "msg": "started"}},
+		},
+		{
+			name:  "records below the level are dropped",
+			level: slog.LevelWarn,
+			log: func(ctx context.Context, logger *slog.Logger) {
+				logger.Info("processed work request")
+				logger.Warn("skipping work request")
+			},
+			expected: []map[string]any{{"level": "WARN", "msg": "skipping work request"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tt.log(context.Background(), New(&buf, tt.level))
+
+			var got []map[string]any
+			for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+				var record map[string]any
+				require.NoError(t, json.Unmarshal(line, &record))
+				delete(record, "time")
+				got = append(got, record)
+			}
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestCorrelationID(t *testing.T) {
+	ctx := context.Background()
+	assert.Empty(t, CorrelationID(ctx))
+	assert.Equal(t, "72d3162e", CorrelationID(WithCorrelationID(ctx, "72d3162e")))
+}
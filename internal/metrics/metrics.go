@@ -0,0 +1,332 @@
+// Package metrics collects Prometheus metrics and serves them in the text
+// exposition format, without a client library: counters, gauges, and
+// histograms with labels, and collectors that write their own metrics,
+// like the webhook handler's delivery counts. The output is tested against
+// the Prometheus text parser.
+//
+// Packages declare their metrics on Default, which each binary serves on
+// Route.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Route is the pattern a Registry is served under.
+const Route = "GET /metrics"
+
+// DefaultBuckets are the histogram buckets, in seconds, of durations from
+// a few milliseconds, like a queue publish, to minutes, like analyzing a
+// large run.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// Default is the registry the services' metrics are declared on.
+var Default = NewRegistry()
+
+var (
+	metricNameRE = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNameRE  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+// EscapeLabelValue escapes a label value for the text exposition format,
+// for collectors that write their own metrics. Invalid UTF-8 is replaced.
+func EscapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(strings.ToValidUTF8(value, "\uFFFD"))
+}
+
+// Collector writes metrics in the Prometheus text exposition format.
+type Collector interface {
+	WriteMetrics(w io.Writer)
+}
+
+// Registry holds collectors and serves their metrics. It is safe for
+// concurrent use.
+type Registry struct {
+	mu         sync.Mutex
+	collectors []Collector
+	// names are the names of the metrics created on the registry
+	names map[string]bool
+}
+
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+// Add adds a collector, whose metrics are written after those added before.
+func (r *Registry) Add(c Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// NewCounter creates a counter with the given label names and adds it.
+// Like the other constructors, it panics if a name is invalid or the
+// registry already has a metric of the name, as that is a programming error.
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{family: r.newFamily(name, help, "counter", labels)}
+	r.Add(c)
+	return c
+}
+
+// NewGauge creates a gauge with the given label names and adds it.
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{family: r.newFamily(name, help, "gauge", labels)}
+	r.Add(g)
+	return g
+}
+
+// NewHistogram creates a histogram with the given upper bounds, in
+// increasing order, and label names, and adds it.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if slices.Contains(labels, "le") {
+		panic(fmt.Sprintf("metrics: histogram %s can't have an le label", name))
+	}
+	h := &Histogram{family: r.newFamily(name, help, "histogram", labels), buckets: buckets, series: make(map[string]*histogramSeries)}
+	r.Add(h)
+	return h
+}
+
+// WriteMetrics writes the metrics of every collector.
+func (r *Registry) WriteMetrics(w io.Writer) {
+	r.mu.Lock()
+	collectors := slices.Clone(r.collectors)
+	r.mu.Unlock()
+	for _, c := range collectors {
+		c.WriteMetrics(w)
+	}
+}
+
+// ServeHTTP serves the metrics in the Prometheus text exposition format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	r.WriteMetrics(w)
+}
+
+// family holds the values of a metric by label values.
+type family struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// newFamily validates the names of a metric and reserves its name.
+func (r *Registry) newFamily(name, help, kind string, labels []string) *family {
+	if !metricNameRE.MatchString(name) {
+		panic(fmt.Sprintf("metrics: invalid metric name %q", name))
+	}
+	for _, label := range labels {
+		if !labelNameRE.MatchString(label) || strings.HasPrefix(label, "__") {
+			panic(fmt.Sprintf("metrics: %s has invalid label name %q", name, label))
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[name] {
+		panic(fmt.Sprintf("metrics: %s is already registered", name))
+	}
+	r.names[name] = true
+	return &family{name: name, help: help, kind: kind, labels: labels, values: make(map[string]float64)}
+}
+
+// seriesKey joins label values into a map key. It panics if their number
+// doesn't match the label names, as that is a programming error.
+func (f *family) seriesKey(values []string) string {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s has %d labels, got %d values", f.name, len(f.labels), len(values)))
+	}
+	return strings.Join(values, "\x00")
+}
+
+// labelPairs formats the labels of a series, with extra appended, as
+// {name="value",...}; it is empty for a series without labels.
+func (f *family) labelPairs(key string, extra ...string) string {
+	var pairs []string
+	if len(f.labels) > 0 {
+		for i, value := range strings.Split(key, "\x00") {
+			pairs = append(pairs, fmt.Sprintf(`%s="%s"`, f.labels[i], EscapeLabelValue(value)))
+		}
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extra[i], EscapeLabelValue(extra[i+1])))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func (f *family) add(v float64, values []string) {
+	key := f.seriesKey(values)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.values[key] += v
+}
+
+func (f *family) set(v float64, values []string) {
+	key := f.seriesKey(values)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.values[key] = v
+}
+
+func (f *family) value(values []string) float64 {
+	key := f.seriesKey(values)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.values[key]
+}
+
+// WriteMetrics writes the family's series, sorted by label values.
+func (f *family) WriteMetrics(w io.Writer) {
+	f.mu.Lock()
+	keys := make([]string, 0, len(f.values))
+	for key := range f.values {
+		keys = append(keys, key)
+	}
+	values := make(map[string]float64, len(f.values))
+	for key, v := range f.values {
+		values[key] = v
+	}
+	f.mu.Unlock()
+	sort.Strings(keys)
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, helpEscaper.Replace(f.help), f.name, f.kind)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s%s %s\n", f.name, f.labelPairs(key), formatValue(values[key]))
+	}
+}
+
+// Counter is a metric that only goes up, such as a number of events.
+type Counter struct {
+	*family
+}
+
+// Inc adds one to the series of the given label values.
+func (c *Counter) Inc(labelValues ...string) {
+	c.add(1, labelValues)
+}
+
+// Add adds v, which must not be negative, to the series of the given label
+// values.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic(fmt.Sprintf("metrics: counter %s can't decrease", c.name))
+	}
+	c.add(v, labelValues)
+}
+
+// Value returns the value of the series of the given label values.
+func (c *Counter) Value(labelValues ...string) float64 {
+	return c.value(labelValues)
+}
+
+// Gauge is a metric that goes up and down, such as a remaining quota.
+type Gauge struct {
+	*family
+}
+
+// Set sets the series of the given label values to v.
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.set(v, labelValues)
+}
+
+// Value returns the value of the series of the given label values.
+func (g *Gauge) Value(labelValues ...string) float64 {
+	return g.value(labelValues)
+}
+
+// Histogram counts observations, such as durations, in buckets.
+type Histogram struct {
+	*family
+	buckets []float64
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Observe adds an observation to the series of the given label values.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	key := h.seriesKey(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, bound := range h.buckets {
+		if v <= bound {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += v
+}
+
+// Count returns the number of observations of the series of the given
+// label values.
+func (h *Histogram) Count(labelValues ...string) uint64 {
+	key := h.seriesKey(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s, ok := h.series[key]; ok {
+		return s.count
+	}
+	return 0
+}
+
+// WriteMetrics writes the cumulative buckets, sum, and count of each
+// series, sorted by label values.
+func (h *Histogram) WriteMetrics(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, helpEscaper.Replace(h.help), h.name)
+	for _, key := range keys {
+		s := h.series[key]
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(key, "le", formatValue(bound)), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(key, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labelPairs(key), formatValue(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labelPairs(key), s.count)
+	}
+}
+
+// formatValue formats a sample value as Prometheus expects.
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
@@ -0,0 +1,192 @@
+package metrics
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// parse parses metrics with the Prometheus text parser.
+func parse(t *testing.T, text string) map[string]*dto.MetricFamily {
+	t.Helper()
+	parser := expfmt.NewTextParser(model.LegacyValidation)
+	families, err := parser.TextToMetricFamilies(strings.NewReader(text))
+	require.NoError(t, err, text)
+	return families
+}
+
+func TestRegistry_WriteMetrics(t *testing.T) {
+	tests := []struct {
+		name     string
+		record   func(r *Registry)
+		expected string
+	}{
+		{
+			name: "counter with labels",
+			record: func(r *Registry) {
+				c := r.NewCounter("canopy_jobs_total", "Jobs by result.", "result")
+				c.Inc("processed")
+				c.Add(2, "failed")
+				c.Inc("processed")
+			},
+			expected: "# HELP canopy_jobs_total Jobs by result.\n" +
+				"# TYPE canopy_jobs_total counter\n" +
+				"canopy_jobs_total{result=\"failed\"} 2\n" +
+				"canopy_jobs_total{result=\"processed\"} 2\n",
+		},
+		{
+			name: "gauge without labels",
+			record: func(r *Registry) {
+				g := r.NewGauge("canopy_quota", "Remaining quota.")
+				g.Set(4999)
+				g.Set(4998)
+			},
+			expected: "# HELP canopy_quota Remaining quota.\n" +
+				"# TYPE canopy_quota gauge\n" +
+				"canopy_quota 4998\n",
+		},
+		{
+			name: "histogram",
+			record: func(r *Registry) {
+				h := r.NewHistogram("canopy_duration_seconds", "Durations.", []float64{0.1, 1}, "result")
+				h.Observe(0.05, "ok")
+				h.Observe(0.5, "ok")
+				h.Observe(3, "ok")
+			},
+			expected: "# HELP canopy_duration_seconds Durations.\n" +
+				"# TYPE canopy_duration_seconds histogram\n" +
+				"canopy_duration_seconds_bucket{result=\"ok\",le=\"0.1\"} 1\n" +
+				"canopy_duration_seconds_bucket{result=\"ok\",le=\"1\"} 2\n" +
+				"canopy_duration_seconds_bucket{result=\"ok\",le=\"+Inf\"} 3\n" +
+				"canopy_duration_seconds_sum{result=\"ok\"} 3.55\n" +
+				"canopy_duration_seconds_count{result=\"ok\"} 3\n",
+		},
+		{
+			name: "label values are escaped",
+			record: func(r *Registry) {
+				r.NewCounter("canopy_events_total", "Events.", "reason").Inc("bad \"quote\"\n")
+			},
+			expected: "# HELP canopy_events_total Events.\n" +
+				"# TYPE canopy_events_total counter\n" +
+				"canopy_events_total{reason=\"bad \\\"quote\\\"\\n\"} 1\n",
+		},
+		{
+			name: "help and label values are escaped like Prometheus does",
+			record: func(r *Registry) {
+				r.NewCounter("canopy_paths_total", "Paths like C:\\ci,\nby path.", "path").Inc("C:\\ci\tcafé\xff")
+			},
+			expected: "# HELP canopy_paths_total Paths like C:\\\\ci,\\nby path.\n" +
+				"# TYPE canopy_paths_total counter\n" +
+				"canopy_paths_total{path=\"C:\\\\ci\tcafé\uFFFD\"} 1\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRegistry()
+			tt.record(r)
+
+			var buf bytes.Buffer
+			r.WriteMetrics(&buf)
+			assert.Equal(t, tt.expected, buf.String())
+			parse(t, buf.String())
+		})
+	}
+}
+
+func TestRegistry_WriteMetrics_Parses(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("canopy_events_total", "Events by \"reason\".", "reason", "repo")
+	c.Inc("", "acme/widgets")
+	c.Inc("quote \" and backslash \\", "acme/gadgets")
+	r.NewGauge("canopy_level", "Level.").Set(-1.5)
+	h := r.NewHistogram("canopy_seconds", "Seconds.", DefaultBuckets, "result")
+	h.Observe(0.2, "ok")
+	h.Observe(400, "failed")
+	r.Add(staticCollector("# HELP canopy_custom_total Custom.\n# TYPE canopy_custom_total counter\n" +
+		"canopy_custom_total{path=\"" + EscapeLabelValue("a\\b\n\"c\"") + "\"} 1\n"))
+
+	var buf bytes.Buffer
+	r.WriteMetrics(&buf)
+	families := parse(t, buf.String())
+
+	require.Contains(t, families, "canopy_events_total")
+	assert.Equal(t, dto.MetricType_COUNTER, families["canopy_events_total"].GetType())
+	assert.Equal(t, `Events by "reason".`, families["canopy_events_total"].GetHelp())
+	assert.Len(t, families["canopy_events_total"].GetMetric(), 2)
+	assert.Equal(t, -1.5, families["canopy_level"].GetMetric()[0].GetGauge().GetValue())
+	histograms := families["canopy_seconds"].GetMetric()
+	require.Len(t, histograms, 2)
+	assert.Equal(t, uint64(1), histograms[0].GetHistogram().GetSampleCount())
+	assert.Len(t, histograms[0].GetHistogram().GetBucket(), len(DefaultBuckets)+1, "and +Inf")
+	assert.Equal(t, "a\\b\n\"c\"", families["canopy_custom_total"].GetMetric()[0].GetLabel()[0].GetValue())
+}
+
+func TestRegistry_InvalidMetrics(t *testing.T) {
+	tests := []struct {
+		name   string
+		create func(r *Registry)
+	}{
+		{name: "invalid metric name", create: func(r *Registry) { r.NewCounter("canopy-jobs", "Jobs.") }},
+		{name: "invalid label name", create: func(r *Registry) { r.NewGauge("canopy_level", "Level.", "repo.name") }},
+		{name: "reserved label name", create: func(r *Registry) { r.NewGauge("canopy_level", "Level.", "__name") }},
+		{name: "histogram with an le label", create: func(r *Registry) { r.NewHistogram("canopy_seconds", "Seconds.", DefaultBuckets, "le") }},
+		{name: "duplicate name", create: func(r *Registry) {
+			r.NewCounter("canopy_jobs_total", "Jobs.")
+			r.NewGauge("canopy_jobs_total", "Jobs.")
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Panics(t, func() { tt.create(NewRegistry()) })
+		})
+	}
+}
+
+type staticCollector string
+
+func (c staticCollector) WriteMetrics(w io.Writer) {
+	io.WriteString(w, string(c))
+}
+
+func TestRegistry_ServeHTTP(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("canopy_first_total", "First.").Inc()
+	r.Add(staticCollector("canopy_second 1\n"))
+
+	mux := http.NewServeMux()
+	mux.Handle(Route, r)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/plain; version=0.0.4", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "# HELP canopy_first_total First.\n# TYPE canopy_first_total counter\ncanopy_first_total 1\ncanopy_second 1\n", rec.Body.String())
+}
+
+func TestMetrics_Values(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("canopy_bytes_total", "Bytes.", "kind")
+	c.Add(512, "artifact")
+	h := r.NewHistogram("canopy_seconds", "Seconds.", DefaultBuckets)
+	h.Observe(1)
+	g := r.NewGauge("canopy_level", "Level.", "name")
+	g.Set(-3, "a")
+
+	assert.Equal(t, 512.0, c.Value("artifact"))
+	assert.Zero(t, c.Value("other"))
+	assert.Equal(t, uint64(1), h.Count())
+	assert.Equal(t, -3.0, g.Value("a"))
+	assert.Panics(t, func() { c.Inc() }, "label values must match label names")
+	assert.Panics(t, func() { c.Add(-1, "artifact") }, "counters can't decrease")
+}
@@ -0,0 +1,251 @@
+package onboard
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+)
+
+// WorkflowPath is where onboarding pull requests add the coverage workflow.
+const WorkflowPath = ".github/workflows/canopy-coverage.yml"
+
+// PullRequestBranch is the branch onboarding pull requests are opened from.
+const PullRequestBranch = "canopy/onboard"
+
+// emptyBaseline is the coverage seeded for repositories without any, so the
+// first PRs are compared with an empty baseline instead of reporting that
+// there is no base coverage.
+const emptyBaseline = "mode: set\n"
+
+// workflowTemplate is the coverage workflow added by onboarding pull
+// requests; %s is the default branch.
+const workflowTemplate = `name: Coverage
+
+on:
+  push:
+    branches: [%s]
+  pull_request:
+
+jobs:
+  coverage:
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/checkout@v4
+      - uses: actions/setup-go@v5
+        with:
+          go-version-file: go.mod
+      - run: go test -coverprofile=coverage.out ./...
+      - uses: actions/upload-artifact@v4
+        with:
+          name: coverage
+          path: coverage.out
+`
+
+// WorkflowSnippet returns the coverage workflow for a repository whose
+// default branch is defaultBranch.
+func WorkflowSnippet(defaultBranch string) string {
+	return fmt.Sprintf(workflowTemplate, defaultBranch)
+}
+
+// GitHub is the subset of the GitHub API used for onboarding.
+type GitHub interface {
+	ListOrgRepos(ctx context.Context, org string) ([]github.Repository, error)
+	GetFile(ctx context.Context, owner, repo, path, ref string) ([]byte, error)
+	ListDirectory(ctx context.Context, owner, repo, path, ref string) ([]string, error)
+	CreateFilePullRequest(ctx context.Context, pr github.FilePullRequest) (string, error)
+}
+
+// Status is the onboarding outcome of a repository.
+type Status string
+
+const (
+	// StatusReady means the repository already has a coverage workflow
+	StatusReady Status = "ready"
+	// StatusPullRequest means a pull request adding the workflow was opened
+	StatusPullRequest Status = "pr-opened"
+	// StatusMissingWorkflow means the repository has no coverage workflow
+	// and no pull request was opened
+	StatusMissingWorkflow Status = "missing-workflow"
+	// StatusSkipped means the repository isn't onboarded (see Detail)
+	StatusSkipped Status = "skipped"
+	// StatusFailed means onboarding failed (see Detail)
+	StatusFailed Status = "failed"
+)
+
+// RepoResult is the onboarding result of a single repository.
+type RepoResult struct {
+	Repo   string
+	Status Status
+	// Detail is the workflow found, the pull request URL, or why the
+	// repository was skipped or failed
+	Detail string
+	// BaselineSeeded is true if an empty baseline was stored
+	BaselineSeeded bool
+}
+
+// Onboarder rolls Canopy out to the repositories of an org.
+type Onboarder struct {
+	GitHub GitHub
+	// Storage, if set, receives an empty baseline for the default branch of
+	// each onboarded repository that has no stored coverage
+	Storage storage.Storage
+	// OpenPullRequests opens a pull request adding WorkflowSnippet to
+	// repositories without a coverage workflow
+	OpenPullRequests bool
+	// IncludeArchived and IncludeForks onboard archived and forked
+	// repositories, which are skipped by default
+	IncludeArchived bool
+	IncludeForks    bool
+	// Progress, if set, receives a line per repository as it is processed
+	Progress io.Writer
+}
+
+// Run onboards every repository of org and returns the results in the
+// order the API listed them. Failures of single repositories are recorded
+// in their result; only failing to list repositories returns an error.
+func (o *Onboarder) Run(ctx context.Context, org string) ([]RepoResult, error) {
+	repos, err := o.GitHub.ListOrgRepos(ctx, org)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list repositories of %s: %w", org, err)
+	}
+
+	results := make([]RepoResult, 0, len(repos))
+	for i, repo := range repos {
+		result := o.onboardRepo(ctx, org, repo)
+		results = append(results, result)
+		if o.Progress != nil {
+			fmt.Fprintf(o.Progress, "[%d/%d] %s: %s", i+1, len(repos), result.Repo, result.Status)
+			if result.Detail != "" {
+				fmt.Fprintf(o.Progress, " (%s)", result.Detail)
+			}
+			fmt.Fprintln(o.Progress)
+		}
+	}
+	return results, nil
+}
+
+// onboardRepo checks and onboards a single repository.
+func (o *Onboarder) onboardRepo(ctx context.Context, org string, repo github.Repository) RepoResult {
+	result := RepoResult{Repo: repo.Name}
+	switch {
+	case repo.Archived && !o.IncludeArchived:
+		return skipped(result, "archived")
+	case repo.Fork && !o.IncludeForks:
+		return skipped(result, "fork")
+	}
+
+	if _, err := o.GitHub.GetFile(ctx, org, repo.Name, "go.mod", ""); err != nil {
+		if github.IsNotFound(err) {
+			return skipped(result, "no go.mod")
+		}
+		return failed(result, fmt.Errorf("failed to check go.mod: %w", err))
+	}
+
+	workflow, err := o.findCoverageWorkflow(ctx, org, repo.Name)
+	if err != nil {
+		return failed(result, err)
+	}
+
+	switch {
+	case workflow != "":
+		result.Status = StatusReady
+		result.Detail = workflow
+	case o.OpenPullRequests:
+		url, err := o.GitHub.CreateFilePullRequest(ctx, github.FilePullRequest{
+			Owner:   org,
+			Repo:    repo.Name,
+			Base:    repo.DefaultBranch,
+			Branch:  PullRequestBranch,
+			Path:    WorkflowPath,
+			Content: []byte(WorkflowSnippet(repo.DefaultBranch)),
+			Message: "Add Canopy coverage workflow",
+			Title:   "Add Canopy coverage workflow",
+			Body:    "Runs the tests with coverage and uploads the profile as an artifact, so Canopy can report coverage of changes on pull requests.",
+		})
+		if err != nil {
+			return failed(result, err)
+		}
+		result.Status = StatusPullRequest
+		result.Detail = url
+	default:
+		result.Status = StatusMissingWorkflow
+	}
+
+	if o.Storage != nil {
+		seeded, err := o.seedBaseline(ctx, org, repo)
+		if err != nil {
+			return failed(result, err)
+		}
+		result.BaselineSeeded = seeded
+	}
+	return result
+}
+
+// findCoverageWorkflow returns the path of the first workflow that looks
+// like it produces a coverage artifact, or "" if there is none.
+func (o *Onboarder) findCoverageWorkflow(ctx context.Context, org, repo string) (string, error) {
+	files, err := o.GitHub.ListDirectory(ctx, org, repo, ".github/workflows", "")
+	if err != nil {
+		if github.IsNotFound(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to list workflows: %w", err)
+	}
+
+	for _, file := range files {
+		if ext := path.Ext(file); ext != ".yml" && ext != ".yaml" {
+			continue
+		}
+		data, err := o.GitHub.GetFile(ctx, org, repo, file, "")
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		if IsCoverageWorkflow(data) {
+			return file, nil
+		}
+	}
+	return "", nil
+}
+
+// seedBaseline stores an empty baseline for the default branch unless it
+// already has coverage. It returns true if a baseline was stored.
+func (o *Onboarder) seedBaseline(ctx context.Context, org string, repo github.Repository) (bool, error) {
+	key := storage.CoverageKey{Org: org, Repo: repo.Name, Branch: repo.DefaultBranch}
+	existing, err := o.Storage.GetCoverage(ctx, key)
+	if err != nil {
+		return false, fmt.Errorf("failed to read baseline: %w", err)
+	}
+	if existing != nil {
+		return false, nil
+	}
+	if err := o.Storage.SaveCoverage(ctx, key, []byte(emptyBaseline)); err != nil {
+		return false, fmt.Errorf("failed to seed baseline: %w", err)
+	}
+	return true, nil
+}
+
+// IsCoverageWorkflow reports whether a workflow file writes a Go coverage
+// profile and uploads an artifact.
+func IsCoverageWorkflow(data []byte) bool {
+	content := string(data)
+	return strings.Contains(content, "-coverprofile") && strings.Contains(content, "upload-artifact")
+}
+
+// skipped returns result marked as skipped for reason.
+func skipped(result RepoResult, reason string) RepoResult {
+	result.Status = StatusSkipped
+	result.Detail = reason
+	return result
+}
+
+// failed returns result marked as failed with err.
+func failed(result RepoResult, err error) RepoResult {
+	result.Status = StatusFailed
+	result.Detail = err.Error()
+	return result
+}
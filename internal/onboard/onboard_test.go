@@ -0,0 +1,165 @@
+package onboard
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeGitHub serves repositories and files from memory.
+type fakeGitHub struct {
+	repos []github.Repository
+	// files maps "repo/path" to contents
+	files map[string]string
+	prs   []github.FilePullRequest
+}
+
+func (f *fakeGitHub) ListOrgRepos(ctx context.Context, org string) ([]github.Repository, error) {
+	return f.repos, nil
+}
+
+func (f *fakeGitHub) GetFile(ctx context.Context, owner, repo, path, ref string) ([]byte, error) {
+	data, ok := f.files[repo+"/"+path]
+	if !ok {
+		return nil, &github.APIError{StatusCode: 404, Message: "Not Found"}
+	}
+	return []byte(data), nil
+}
+
+func (f *fakeGitHub) ListDirectory(ctx context.Context, owner, repo, path, ref string) ([]string, error) {
+	var files []string
+	for key := range f.files {
+		if name, ok := strings.CutPrefix(key, repo+"/"+path+"/"); ok {
+			files = append(files, path+"/"+name)
+		}
+	}
+	if len(files) == 0 {
+		return nil, &github.APIError{StatusCode: 404, Message: "Not Found"}
+	}
+	return files, nil
+}
+
+func (f *fakeGitHub) CreateFilePullRequest(ctx context.Context, pr github.FilePullRequest) (string, error) {
+	f.prs = append(f.prs, pr)
+	return "https://github.com/acme/" + pr.Repo + "/pull/1", nil
+}
+
+// memoryStorage is an in-memory storage.Storage.
+type memoryStorage struct {
+	data map[storage.CoverageKey][]byte
+}
+
+func (m *memoryStorage) SaveCoverage(ctx context.Context, key storage.CoverageKey, data []byte) error {
+	m.data[key] = data
+	return nil
+}
+
+func (m *memoryStorage) GetCoverage(ctx context.Context, key storage.CoverageKey) ([]byte, error) {
+	return m.data[key], nil
+}
+
+func (m *memoryStorage) SaveCoverageReader(ctx context.Context, key storage.CoverageKey, reader io.Reader, size int64) error {
+	return errors.New("not implemented")
+}
+
+func (m *memoryStorage) Close() error { return nil }
+
+func newFakeGitHub() *fakeGitHub {
+	return &fakeGitHub{
+		repos: []github.Repository{
+			{Name: "api", DefaultBranch: "main"},
+			{Name: "web", DefaultBranch: "main"},
+			{Name: "docs", DefaultBranch: "main"},
+			{Name: "legacy", DefaultBranch: "master", Archived: true},
+			{Name: "fork", DefaultBranch: "main", Fork: true},
+		},
+		files: map[string]string{
+			"api/go.mod":                     "module github.com/acme/api\n",
+			"api/.github/workflows/ci.yml":   "steps:\n  - run: go test -coverprofile=coverage.out ./...\n  - uses: actions/upload-artifact@v4\n",
+			"web/go.mod":                     "module github.com/acme/web\n",
+			"web/.github/workflows/lint.yml": "steps:\n  - run: golangci-lint run\n",
+			"legacy/go.mod":                  "module github.com/acme/legacy\n",
+		},
+	}
+}
+
+func TestOnboarder_Run(t *testing.T) {
+	tests := []struct {
+		name     string
+		openPRs  bool
+		expected []RepoResult
+	}{
+		{
+			name: "report only",
+			expected: []RepoResult{
+				{Repo: "api", Status: StatusReady, Detail: ".github/workflows/ci.yml", BaselineSeeded: true},
+				{Repo: "web", Status: StatusMissingWorkflow, BaselineSeeded: true},
+				{Repo: "docs", Status: StatusSkipped, Detail: "no go.mod"},
+				{Repo: "legacy", Status: StatusSkipped, Detail: "archived"},
+				{Repo: "fork", Status: StatusSkipped, Detail: "fork"},
+			},
+		},
+		{
+			name:    "open pull requests",
+			openPRs: true,
+			expected: []RepoResult{
+				{Repo: "api", Status: StatusReady, Detail: ".github/workflows/ci.yml", BaselineSeeded: true},
+				{Repo: "web", Status: StatusPullRequest, Detail: "https://github.com/acme/web/pull/1", BaselineSeeded: true},
+				{Repo: "docs", Status: StatusSkipped, Detail: "no go.mod"},
+				{Repo: "legacy", Status: StatusSkipped, Detail: "archived"},
+				{Repo: "fork", Status: StatusSkipped, Detail: "fork"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := newFakeGitHub()
+			store := &memoryStorage{data: map[storage.CoverageKey][]byte{}}
+			var progress bytes.Buffer
+			o := &Onboarder{GitHub: gh, Storage: store, OpenPullRequests: tt.openPRs, Progress: &progress}
+
+			results, err := o.Run(context.Background(), "acme")
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, results)
+			assert.Contains(t, progress.String(), "[3/5] docs: skipped (no go.mod)\n")
+			assert.Equal(t, []byte(emptyBaseline), store.data[storage.CoverageKey{Org: "acme", Repo: "web", Branch: "main"}])
+
+			if tt.openPRs {
+				require.Len(t, gh.prs, 1)
+				assert.Equal(t, WorkflowPath, gh.prs[0].Path)
+				assert.Equal(t, "main", gh.prs[0].Base)
+				assert.True(t, IsCoverageWorkflow(gh.prs[0].Content))
+			} else {
+				assert.Empty(t, gh.prs)
+			}
+		})
+	}
+}
+
+func TestOnboarder_KeepsExistingBaseline(t *testing.T) {
+	key := storage.CoverageKey{Org: "acme", Repo: "api", Branch: "main"}
+	store := &memoryStorage{data: map[storage.CoverageKey][]byte{key: []byte("mode: set\na.go:1.1,2.2 1 1\n")}}
+	gh := newFakeGitHub()
+	gh.repos = gh.repos[:1]
+
+	results, err := (&Onboarder{GitHub: gh, Storage: store}).Run(context.Background(), "acme")
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.False(t, results[0].BaselineSeeded)
+	assert.Equal(t, "mode: set\na.go:1.1,2.2 1 1\n", string(store.data[key]))
+}
+
+func TestIsCoverageWorkflow(t *testing.T) {
+	assert.True(t, IsCoverageWorkflow([]byte(WorkflowSnippet("main"))))
+	assert.False(t, IsCoverageWorkflow([]byte("run: go test ./...\nuses: actions/upload-artifact@v4\n")))
+	assert.False(t, IsCoverageWorkflow([]byte("run: go test -coverprofile=c.out ./...\n")))
+}
@@ -0,0 +1,107 @@
+// Package policy checks the coverage of a PR against the thresholds of the
+// repository config, deciding the conclusion of its check run.
+package policy
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/repoconfig"
+)
+
+// Input is the coverage of a PR.
+type Input struct {
+	// Result is the analysis of the lines the PR adds, with suppressions
+	// applied
+	Result *coverage.AnalysisResult
+	// LineCoverage is the coverage of each executable added line, by diff
+	// file (see coverage.LineCoverageByFile)
+	LineCoverage map[string]map[int]bool
+	// Head is the coverage of the PR's head
+	Head *coverage.CoverageStats
+	// Comparison compares Head with the base branch; nil if there is no
+	// base coverage
+	Comparison *coverage.CoverageComparison
+}
+
+// Evaluate describes each threshold the PR doesn't meet, in order: the
+// drop of total coverage, total coverage, patch coverage, patch coverage of
+// the Paths overrides, and packages by import path. It returns nil if the
+// PR meets them all.
+// Patch thresholds are checked only for added lines; packages without
+// coverage data are skipped.
+func Evaluate(t repoconfig.ThresholdsConfig, in *Input) []string {
+	var unmet []string
+	if in.Comparison != nil && -in.Comparison.Delta > t.MaxDrop {
+		if t.MaxDrop > 0 {
+			unmet = append(unmet, fmt.Sprintf("Project coverage dropped %.2f%%, more than the allowed %g%%", -in.Comparison.Delta, t.MaxDrop))
+		} else {
+			unmet = append(unmet, fmt.Sprintf("Project coverage dropped %.2f%%", -in.Comparison.Delta))
+		}
+	}
+	if t.Project > 0 && in.Head.Percentage < t.Project {
+		unmet = append(unmet, fmt.Sprintf("Project coverage %.2f%% is below the threshold of %g%%", in.Head.Percentage, t.Project))
+	}
+
+	patch, paths := patchCoverage(t.Paths, in)
+	if t.Patch > 0 && patch.added > 0 && patch.percentage() < t.Patch {
+		unmet = append(unmet, fmt.Sprintf("Patch coverage %.2f%% is below the threshold of %g%%", patch.percentage(), t.Patch))
+	}
+	for i, p := range t.Paths {
+		if p.Patch > 0 && paths[i].added > 0 && paths[i].percentage() < p.Patch {
+			unmet = append(unmet, fmt.Sprintf("Patch coverage of `%s` %.2f%% is below the threshold of %g%%", p.Path, paths[i].percentage(), p.Patch))
+		}
+	}
+
+	if len(t.Packages) == 0 {
+		return unmet
+	}
+	packages := in.Head.ByPackage()
+	names := make([]string, 0, len(t.Packages))
+	for name := range t.Packages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		pc, ok := packages[name]
+		if ok && pc.Percentage < t.Packages[name] {
+			unmet = append(unmet, fmt.Sprintf("`%s` coverage %.2f%% is below the threshold of %g%%", name, pc.Percentage, t.Packages[name]))
+		}
+	}
+	return unmet
+}
+
+// lineCount counts added lines and those left uncovered.
+type lineCount struct {
+	added, uncovered int
+}
+
+func (c lineCount) percentage() float64 {
+	return float64(c.added-c.uncovered) / float64(c.added) * 100
+}
+
+// patchCoverage counts the added lines of the files matched by each
+// override, by the first matching one, and of the remaining files.
+func patchCoverage(overrides []repoconfig.PathThreshold, in *Input) (lineCount, []lineCount) {
+	rest := lineCount{added: in.Result.DiffAddedLines, uncovered: in.Result.DiffAddedLines - in.Result.DiffAddedCovered}
+	paths := make([]lineCount, len(overrides))
+	if len(overrides) == 0 {
+		return rest, paths
+	}
+	for file, lines := range in.LineCoverage {
+		for i, p := range overrides {
+			if !p.Matches(file) {
+				continue
+			}
+			// Suppressed lines are neither added nor uncovered
+			c := lineCount{added: len(lines) - len(in.Result.Suppressed[file]), uncovered: len(in.Result.UncoveredByFile[file])}
+			paths[i].added += c.added
+			paths[i].uncovered += c.uncovered
+			rest.added -= c.added
+			rest.uncovered -= c.uncovered
+			break
+		}
+	}
+	return rest, paths
+}
@@ -0,0 +1,120 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/repoconfig"
+	"github.com/stretchr/testify/assert"
+)
+
+func testInput() *Input {
+	head := coverage.CalculateCoverageStats([]*coverage.Profile{
+		{FileName: "github.com/acme/widgets/calc.go", Blocks: []coverage.ProfileBlock{{NumStmt: 3, Count: 1}, {NumStmt: 1, Count: 0}}},
+		{FileName: "github.com/acme/widgets/api/handler.go", Blocks: []coverage.ProfileBlock{{NumStmt: 2, Count: 1}, {NumStmt: 2, Count: 0}}},
+	})
+	return &Input{
+		Result: &coverage.AnalysisResult{
+			UncoveredByFile: map[string][]int{
+				"calc.go":        {4},
+				"api/handler.go": {10, 11},
+			},
+			Suppressed:       map[string][]int{"api/handler.go": {12}},
+			DiffAddedLines:   8,
+			DiffAddedCovered: 5,
+		},
+		LineCoverage: map[string]map[int]bool{
+			"calc.go":        {1: true, 2: true, 3: true, 4: false},
+			"api/handler.go": {9: true, 10: false, 11: false, 12: false, 13: true},
+		},
+		Head:       head,
+		Comparison: &coverage.CoverageComparison{BaseCoverage: 70, HeadCoverage: head.Percentage, Delta: head.Percentage - 70},
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name       string
+		thresholds repoconfig.ThresholdsConfig
+		modify     func(in *Input)
+		expected   []string
+	}{
+		{
+			name:     "any drop fails by default",
+			expected: []string{"Project coverage dropped 7.50%"},
+		},
+		{
+			name:       "drop within the allowed maximum",
+			thresholds: repoconfig.ThresholdsConfig{MaxDrop: 10},
+		},
+		{
+			name:       "drop above the allowed maximum",
+			thresholds: repoconfig.ThresholdsConfig{MaxDrop: 5},
+			expected:   []string{"Project coverage dropped 7.50%, more than the allowed 5%"},
+		},
+		{
+			name:       "no base coverage",
+			thresholds: repoconfig.ThresholdsConfig{Project: 60},
+			modify:     func(in *Input) { in.Comparison = nil },
+		},
+		{
+			name: "project, patch, and packages",
+			thresholds: repoconfig.ThresholdsConfig{
+				MaxDrop: 10,
+				Project: 70,
+				Patch:   70,
+				Packages: map[string]float64{
+					"github.com/acme/widgets/api": 60,
+					"github.com/acme/widgets":     60,
+					"github.com/acme/widgets/db":  90,
+				},
+			},
+			expected: []string{
+				"Project coverage 62.50% is below the threshold of 70%",
+				"Patch coverage 62.50% is below the threshold of 70%",
+				"`github.com/acme/widgets/api` coverage 50.00% is below the threshold of 60%",
+			},
+		},
+		{
+			name: "paths override patch for their files",
+			thresholds: repoconfig.ThresholdsConfig{
+				MaxDrop: 10,
+				Patch:   70,
+				Paths: []repoconfig.PathThreshold{
+					{Path: "api", Patch: 60},
+					{Path: "*.go", Patch: 100},
+				},
+			},
+			expected: []string{
+				"Patch coverage of `api` 50.00% is below the threshold of 60%",
+				"Patch coverage of `*.go` 75.00% is below the threshold of 100%",
+			},
+		},
+		{
+			name: "exempt paths",
+			thresholds: repoconfig.ThresholdsConfig{
+				MaxDrop: 10,
+				Patch:   70,
+				Paths:   []repoconfig.PathThreshold{{Path: "api"}},
+			},
+		},
+		{
+			name:       "no added lines",
+			thresholds: repoconfig.ThresholdsConfig{MaxDrop: 10, Patch: 100, Paths: []repoconfig.PathThreshold{{Path: "db", Patch: 100}}},
+			modify: func(in *Input) {
+				in.Result = &coverage.AnalysisResult{}
+				in.LineCoverage = nil
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := testInput()
+			if tt.modify != nil {
+				tt.modify(in)
+			}
+			assert.Equal(t, tt.expected, Evaluate(tt.thresholds, in))
+		})
+	}
+}
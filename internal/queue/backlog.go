@@ -0,0 +1,109 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Backlog describes the work waiting in a queue.
+type Backlog struct {
+	// Length is the number of messages the queue holds, including processed
+	// messages the backend retains (Redis XLEN)
+	Length int64
+
+	// Undelivered is the number of messages not yet delivered to a worker,
+	// or -1 if the backend cannot determine it
+	Undelivered int64
+
+	// Pending is the number of messages delivered but not yet acknowledged
+	Pending int64
+
+	// OldestPendingAge is how long ago the oldest pending message was
+	// published; zero if nothing is pending or the age is unknown
+	OldestPendingAge time.Duration
+}
+
+// Waiting returns the number of messages that still need processing:
+// undelivered plus pending. If Undelivered is unknown, only pending
+// messages are counted.
+func (b *Backlog) Waiting() int64 {
+	return max(b.Undelivered, 0) + b.Pending
+}
+
+// BacklogReporter is implemented by queues that can report their backlog.
+//
+// PubSubQueue does not implement it: the subscription backlog is only
+// available from Cloud Monitoring (subscription/num_undelivered_messages and
+// subscription/oldest_unacked_message_age), which autoscalers such as KEDA's
+// gcp-pubsub scaler read directly.
+type BacklogReporter interface {
+	Backlog(ctx context.Context) (*Backlog, error)
+}
+
+// Backlog reports the stream length (XLEN), the consumer group's lag and
+// pending entries (XINFO GROUPS, XPENDING), and the age of the oldest pending
+// entry, derived from its stream ID.
+func (q *RedisQueue) Backlog(ctx context.Context) (*Backlog, error) {
+	length, err := q.client.XLen(ctx, q.streamKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stream length: %w", err)
+	}
+
+	groups, err := q.client.XInfoGroups(ctx, q.streamKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get consumer groups: %w", err)
+	}
+
+	pending, err := q.client.XPending(ctx, q.streamKey, q.consumerGroup).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending entries: %w", err)
+	}
+
+	return redisBacklog(length, groups, q.consumerGroup, pending, time.Now()), nil
+}
+
+// redisBacklog builds a Backlog from Redis stream metadata.
+func redisBacklog(length int64, groups []redis.XInfoGroup, group string, pending *redis.XPending, now time.Time) *Backlog {
+	backlog := &Backlog{Length: length, Undelivered: -1}
+	for _, g := range groups {
+		if g.Name == group {
+			// Lag is -1 when Redis cannot determine it (or before Redis 7)
+			backlog.Undelivered = g.Lag
+			break
+		}
+	}
+
+	if pending != nil && pending.Count > 0 {
+		backlog.Pending = pending.Count
+		if published, ok := streamIDTime(pending.Lower); ok && now.After(published) {
+			backlog.OldestPendingAge = now.Sub(published)
+		}
+	}
+	return backlog
+}
+
+// streamIDTime returns the time encoded in a Redis stream ID ("<ms>-<seq>").
+func streamIDTime(id string) (time.Time, bool) {
+	msPart, _, _ := strings.Cut(id, "-")
+	ms, err := strconv.ParseInt(msPart, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(ms), true
+}
+
+// Backlog reports the buffered messages as undelivered and the messages
+// being handled as pending. Message ages are not tracked.
+func (q *InMemoryQueue) Backlog(ctx context.Context) (*Backlog, error) {
+	buffered := int64(len(q.ch))
+	return &Backlog{
+		Length:      buffered,
+		Undelivered: buffered,
+		Pending:     q.inFlight.Load(),
+	}, nil
+}
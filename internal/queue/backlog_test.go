@@ -0,0 +1,108 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBacklog_Waiting(t *testing.T) {
+	assert.Equal(t, int64(7), (&Backlog{Undelivered: 5, Pending: 2}).Waiting())
+	assert.Equal(t, int64(2), (&Backlog{Undelivered: -1, Pending: 2}).Waiting())
+	assert.Equal(t, int64(0), (&Backlog{}).Waiting())
+}
+
+func TestRedisBacklog(t *testing.T) {
+	now := time.UnixMilli(1700000010000)
+	groups := []redis.XInfoGroup{
+		{Name: "other", Lag: 100},
+		{Name: "canopy-workers", Lag: 4},
+	}
+
+	tests := []struct {
+		name     string
+		groups   []redis.XInfoGroup
+		pending  *redis.XPending
+		expected *Backlog
+	}{
+		{
+			name:     "idle",
+			groups:   groups,
+			pending:  &redis.XPending{},
+			expected: &Backlog{Length: 50, Undelivered: 4},
+		},
+		{
+			name:     "pending entries",
+			groups:   groups,
+			pending:  &redis.XPending{Count: 3, Lower: "1700000002500-0", Higher: "1700000009000-1"},
+			expected: &Backlog{Length: 50, Undelivered: 4, Pending: 3, OldestPendingAge: 7500 * time.Millisecond},
+		},
+		{
+			name:     "lag unknown",
+			groups:   []redis.XInfoGroup{{Name: "canopy-workers", Lag: -1}},
+			pending:  &redis.XPending{Count: 1, Lower: "invalid"},
+			expected: &Backlog{Length: 50, Undelivered: -1, Pending: 1},
+		},
+		{
+			name:     "group missing",
+			expected: &Backlog{Length: 50, Undelivered: -1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, redisBacklog(50, tt.groups, "canopy-workers", tt.pending, now))
+		})
+	}
+}
+
+func TestStreamIDTime(t *testing.T) {
+	ts, ok := streamIDTime("1700000002500-3")
+	require.True(t, ok)
+	assert.Equal(t, time.UnixMilli(1700000002500), ts)
+
+	_, ok = streamIDTime("not-an-id")
+	assert.False(t, ok)
+}
+
+func TestInMemoryQueue_Backlog(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q := NewInMemoryQueue(InMemoryConfig{BufferSize: 10})
+	defer q.Close()
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, q.Publish(ctx, &WorkRequest{Org: "acme", Repo: "widgets", WorkflowRunID: int64(i)}))
+	}
+
+	backlog, err := q.Backlog(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, &Backlog{Length: 3, Undelivered: 3}, backlog)
+
+	// Block the handler on the first message to observe it as pending
+	started := make(chan struct{})
+	release := make(chan struct{})
+	go q.Subscribe(ctx, func(ctx context.Context, req *WorkRequest) error {
+		if req.WorkflowRunID == 0 {
+			close(started)
+			<-release
+		}
+		return nil
+	})
+	<-started
+
+	backlog, err = q.Backlog(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, &Backlog{Length: 2, Undelivered: 2, Pending: 1}, backlog)
+
+	close(release)
+	assert.Eventually(t, func() bool {
+		backlog, err := q.Backlog(ctx)
+		return err == nil && backlog.Waiting() == 0
+	}, time.Second, 10*time.Millisecond)
+}
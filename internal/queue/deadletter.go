@@ -0,0 +1,70 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrDeadLetterNotFound is returned when a dead-lettered message doesn't exist.
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// DeadLetter is a message moved to a dead-letter queue, either because its
+// handler failed on every delivery or because it isn't a valid WorkRequest.
+type DeadLetter struct {
+	// ID identifies the message in the dead-letter queue
+	ID string `json:"id"`
+
+	// Request is the parsed work request; nil if the message is malformed
+	Request *WorkRequest `json:"request,omitempty"`
+
+	// Data is the message as it was published
+	Data string `json:"data"`
+
+	// Reason is why the message was dead-lettered, e.g. the handler's last error
+	Reason string `json:"reason"`
+
+	// Deliveries is how many times the message was delivered; zero if unknown
+	Deliveries int64 `json:"deliveries"`
+
+	// DeadLetteredAt is when the message was moved to the dead-letter queue
+	DeadLetteredAt time.Time `json:"dead_lettered_at"`
+}
+
+// DeadLetterQueue is implemented by queues that move messages exhausting
+// their deliveries to a dead-letter queue, so they can be inspected and
+// replayed once the cause is fixed.
+type DeadLetterQueue interface {
+	// DeadLetters returns up to limit dead-lettered messages, oldest first.
+	DeadLetters(ctx context.Context, limit int) ([]DeadLetter, error)
+
+	// ReplayDeadLetter publishes the work request of a dead-lettered message
+	// to the queue again and removes it from the dead-letter queue. Malformed
+	// messages can't be replayed.
+	ReplayDeadLetter(ctx context.Context, id string) error
+
+	// DiscardDeadLetter removes a dead-lettered message without replaying it.
+	DiscardDeadLetter(ctx context.Context, id string) error
+}
+
+// newDeadLetter builds a DeadLetter from a dead-lettered message, parsing
+// its work request if it is valid.
+func newDeadLetter(id, data, reason string, deliveries int64, at time.Time) DeadLetter {
+	letter := DeadLetter{ID: id, Data: data, Reason: reason, Deliveries: deliveries, DeadLetteredAt: at}
+	var req WorkRequest
+	if err := json.Unmarshal([]byte(data), &req); err == nil {
+		letter.Request = &req
+	}
+	return letter
+}
+
+// replayable returns the work request of a dead letter, or an error if it
+// is malformed.
+func (l *DeadLetter) replayable() (*WorkRequest, error) {
+	if l.Request == nil {
+		return nil, fmt.Errorf("dead letter %s is not a valid work request and can't be replayed", l.ID)
+	}
+	return l.Request, nil
+}
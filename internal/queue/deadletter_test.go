@@ -0,0 +1,55 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewDeadLetter(t *testing.T) {
+	at := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("valid work request", func(t *testing.T) {
+		letter := newDeadLetter("1-0", `{"org":"acme","repo":"widgets","workflow_run_id":7}`, "GitHub is down", 5, at)
+		require.NotNil(t, letter.Request)
+		assert.Equal(t, WorkRequest{Version: 1, Org: "acme", Repo: "widgets", WorkflowRunID: 7}, *letter.Request)
+		assert.Equal(t, "GitHub is down", letter.Reason)
+		assert.Equal(t, int64(5), letter.Deliveries)
+		assert.Equal(t, at, letter.DeadLetteredAt)
+
+		req, err := letter.replayable()
+		require.NoError(t, err)
+		assert.Same(t, letter.Request, req)
+	})
+
+	t.Run("malformed message", func(t *testing.T) {
+		letter := newDeadLetter("1-0", `{"org": invalid}`, "failed to unmarshal work request", 1, at)
+		assert.Nil(t, letter.Request)
+		assert.Equal(t, `{"org": invalid}`, letter.Data)
+
+		_, err := letter.replayable()
+		assert.EqualError(t, err, "dead letter 1-0 is not a valid work request and can't be replayed")
+	})
+}
+
+func TestRedisDeadLetter(t *testing.T) {
+	letter := redisDeadLetter(redis.XMessage{
+		ID: "1717243200000-0",
+		Values: map[string]interface{}{
+			"data":       `{"org":"acme","repo":"widgets","workflow_run_id":7}`,
+			"message_id": "1717243100000-3",
+			"reason":     "handler failed",
+			"deliveries": "3",
+		},
+	})
+
+	assert.Equal(t, "1717243200000-0", letter.ID)
+	require.NotNil(t, letter.Request)
+	assert.Equal(t, int64(7), letter.Request.WorkflowRunID)
+	assert.Equal(t, "handler failed", letter.Reason)
+	assert.Equal(t, int64(3), letter.Deliveries)
+	assert.True(t, letter.DeadLetteredAt.Equal(time.UnixMilli(1717243200000)))
+}
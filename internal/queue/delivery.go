@@ -0,0 +1,34 @@
+package queue
+
+import "context"
+
+// Delivery describes the delivery of a message to a handler, for queues
+// that count deliveries.
+type Delivery struct {
+	// Attempt counts the deliveries of the message, starting at 1
+	Attempt int
+	// MaxAttempts is how many deliveries the message gets before it is
+	// moved to the dead-letter queue; zero retries it forever
+	MaxAttempts int
+}
+
+// Last reports whether the message is moved to the dead-letter queue if
+// its handler fails.
+func (d Delivery) Last() bool {
+	return d.MaxAttempts > 0 && d.Attempt >= d.MaxAttempts
+}
+
+type deliveryKey struct{}
+
+// WithDelivery returns a context carrying the delivery of the message it is
+// passed to the handler with.
+func WithDelivery(ctx context.Context, d Delivery) context.Context {
+	return context.WithValue(ctx, deliveryKey{}, d)
+}
+
+// DeliveryFrom returns the delivery carried by ctx, if the queue counts
+// deliveries.
+func DeliveryFrom(ctx context.Context) (Delivery, bool) {
+	d, ok := ctx.Value(deliveryKey{}).(Delivery)
+	return d, ok
+}
@@ -0,0 +1,34 @@
+package queue
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDelivery(t *testing.T) {
+	tests := []struct {
+		name     string
+		delivery Delivery
+		last     bool
+	}{
+		{name: "first", delivery: Delivery{Attempt: 1, MaxAttempts: 5}},
+		{name: "last", delivery: Delivery{Attempt: 5, MaxAttempts: 5}, last: true},
+		{name: "past the last", delivery: Delivery{Attempt: 6, MaxAttempts: 5}, last: true},
+		{name: "unlimited", delivery: Delivery{Attempt: 100}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.last, tt.delivery.Last())
+
+			d, ok := DeliveryFrom(WithDelivery(context.Background(), tt.delivery))
+			assert.True(t, ok)
+			assert.Equal(t, tt.delivery, d)
+		})
+	}
+
+	_, ok := DeliveryFrom(context.Background())
+	assert.False(t, ok)
+}
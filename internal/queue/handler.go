@@ -0,0 +1,109 @@
+package queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+)
+
+// Routes served by BacklogHandler.
+const (
+	MetricsRoute = "GET /queue/metrics"
+	ScalingRoute = "GET /queue/scaling"
+)
+
+// BacklogHandler serves queue backlog metrics and scaling recommendations
+// for autoscalers.
+//
+// GET /queue/metrics returns gauges in the Prometheus text format.
+// GET /queue/scaling returns JSON such as
+//
+//	{"length":120,"undelivered":14,"pending":2,"waiting":16,"oldest_pending_age_seconds":3.5,"desired_workers":2}
+//
+// for KEDA's metrics-api scaler (valueLocation: desired_workers) or an
+// HPA external metric.
+type BacklogHandler struct {
+	reporter BacklogReporter
+	policy   ScalingPolicy
+	logger   *slog.Logger
+}
+
+// scalingResponse is the body of GET /queue/scaling.
+type scalingResponse struct {
+	Length                  int64   `json:"length"`
+	Undelivered             int64   `json:"undelivered"`
+	Pending                 int64   `json:"pending"`
+	Waiting                 int64   `json:"waiting"`
+	OldestPendingAgeSeconds float64 `json:"oldest_pending_age_seconds"`
+	DesiredWorkers          int     `json:"desired_workers"`
+}
+
+// NewBacklogHandler creates a BacklogHandler. The policy must be valid
+// (see ScalingPolicy.Validate).
+func NewBacklogHandler(reporter BacklogReporter, policy ScalingPolicy, logger *slog.Logger) *BacklogHandler {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &BacklogHandler{
+		reporter: reporter,
+		policy:   policy,
+		logger:   logger,
+	}
+}
+
+// Register adds the metrics and scaling routes to mux.
+func (h *BacklogHandler) Register(mux *http.ServeMux) {
+	mux.HandleFunc(MetricsRoute, h.serveMetrics)
+	mux.HandleFunc(ScalingRoute, h.serveScaling)
+}
+
+// backlog reports the current backlog, writing an error response on failure.
+func (h *BacklogHandler) backlog(w http.ResponseWriter, r *http.Request) (*Backlog, bool) {
+	backlog, err := h.reporter.Backlog(r.Context())
+	if err != nil {
+		h.logger.Error("failed to get queue backlog", "error", err)
+		http.Error(w, "failed to get queue backlog", http.StatusServiceUnavailable)
+		return nil, false
+	}
+	return backlog, true
+}
+
+func (h *BacklogHandler) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	backlog, ok := h.backlog(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	writeGauge(w, "canopy_queue_length", "Messages held by the queue, including processed messages the backend retains.", float64(backlog.Length))
+	if backlog.Undelivered >= 0 {
+		writeGauge(w, "canopy_queue_undelivered", "Messages not yet delivered to a worker.", float64(backlog.Undelivered))
+	}
+	writeGauge(w, "canopy_queue_pending", "Messages delivered but not yet acknowledged.", float64(backlog.Pending))
+	writeGauge(w, "canopy_queue_oldest_pending_age_seconds", "Age of the oldest pending message.", backlog.OldestPendingAge.Seconds())
+	writeGauge(w, "canopy_queue_desired_workers", "Workers recommended for the current backlog.", float64(h.policy.DesiredWorkers(backlog)))
+}
+
+func (h *BacklogHandler) serveScaling(w http.ResponseWriter, r *http.Request) {
+	backlog, ok := h.backlog(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(scalingResponse{
+		Length:                  backlog.Length,
+		Undelivered:             backlog.Undelivered,
+		Pending:                 backlog.Pending,
+		Waiting:                 backlog.Waiting(),
+		OldestPendingAgeSeconds: backlog.OldestPendingAge.Seconds(),
+		DesiredWorkers:          h.policy.DesiredWorkers(backlog),
+	})
+}
+
+// writeGauge writes a gauge in the Prometheus text exposition format.
+func writeGauge(w io.Writer, name, help string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %g\n", name, help, name, name, value)
+}
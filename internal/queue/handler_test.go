@@ -0,0 +1,103 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubReporter returns a fixed backlog or error.
+type stubReporter struct {
+	backlog *Backlog
+	err     error
+}
+
+func (s *stubReporter) Backlog(ctx context.Context) (*Backlog, error) {
+	return s.backlog, s.err
+}
+
+func TestBacklogHandler(t *testing.T) {
+	policy := ScalingPolicy{TargetPerWorker: 10, MinWorkers: 0, MaxWorkers: 4}
+	backlog := &Backlog{Length: 120, Undelivered: 14, Pending: 2, OldestPendingAge: 3500 * time.Millisecond}
+
+	tests := []struct {
+		name           string
+		reporter       *stubReporter
+		path           string
+		expectedStatus int
+		expectedType   string
+		expectedBody   string
+	}{
+		{
+			name:           "scaling recommendation",
+			reporter:       &stubReporter{backlog: backlog},
+			path:           "/queue/scaling",
+			expectedStatus: http.StatusOK,
+			expectedType:   "application/json",
+			expectedBody:   `{"length":120,"undelivered":14,"pending":2,"waiting":16,"oldest_pending_age_seconds":3.5,"desired_workers":2}` + "\n",
+		},
+		{
+			name:           "prometheus metrics",
+			reporter:       &stubReporter{backlog: backlog},
+			path:           "/queue/metrics",
+			expectedStatus: http.StatusOK,
+			expectedType:   "text/plain; version=0.0.4",
+			expectedBody: `# HELP canopy_queue_length Messages held by the queue, including processed messages the backend retains.
+# TYPE canopy_queue_length gauge
+canopy_queue_length 120
+# HELP canopy_queue_undelivered Messages not yet delivered to a worker.
+# TYPE canopy_queue_undelivered gauge
+canopy_queue_undelivered 14
+# HELP canopy_queue_pending Messages delivered but not yet acknowledged.
+# TYPE canopy_queue_pending gauge
+canopy_queue_pending 2
+# HELP canopy_queue_oldest_pending_age_seconds Age of the oldest pending message.
+# TYPE canopy_queue_oldest_pending_age_seconds gauge
+canopy_queue_oldest_pending_age_seconds 3.5
+# HELP canopy_queue_desired_workers Workers recommended for the current backlog.
+# TYPE canopy_queue_desired_workers gauge
+canopy_queue_desired_workers 2
+`,
+		},
+		{
+			name:           "reporter failure",
+			reporter:       &stubReporter{err: errors.New("connection refused")},
+			path:           "/queue/scaling",
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   "failed to get queue backlog\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			NewBacklogHandler(tt.reporter, policy, nil).Register(mux)
+
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			require.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedType != "" {
+				assert.Equal(t, tt.expectedType, rec.Header().Get("Content-Type"))
+			}
+			assert.Equal(t, tt.expectedBody, rec.Body.String())
+		})
+	}
+}
+
+func TestBacklogHandler_UnknownUndelivered(t *testing.T) {
+	mux := http.NewServeMux()
+	NewBacklogHandler(&stubReporter{backlog: &Backlog{Undelivered: -1}}, ScalingPolicy{TargetPerWorker: 1, MaxWorkers: 1}, nil).Register(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/queue/metrics", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "canopy_queue_undelivered")
+}
@@ -3,7 +3,9 @@ package queue
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"sync"
+	"sync/atomic"
 )
 
 // InMemoryQueue implements MessageQueue using an in-memory channel.
@@ -14,12 +16,19 @@ type InMemoryQueue struct {
 	ch     chan *WorkRequest
 	closed bool
 	mu     sync.RWMutex
+
+	// inFlight counts messages being handled, reported as pending by Backlog
+	inFlight atomic.Int64
+	logger   *slog.Logger
 }
 
 // InMemoryConfig holds configuration for creating an InMemoryQueue.
 type InMemoryConfig struct {
 	// BufferSize is the channel buffer size (default: 100)
 	BufferSize int
+
+	// Logger logs failed messages, which are dropped (default: slog.Default())
+	Logger *slog.Logger
 }
 
 // NewInMemoryQueue creates a new InMemoryQueue instance.
@@ -29,10 +38,15 @@ func NewInMemoryQueue(cfg InMemoryConfig) *InMemoryQueue {
 	if bufferSize <= 0 {
 		bufferSize = 100 // Default buffer size
 	}
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
 
 	return &InMemoryQueue{
 		ch:     make(chan *WorkRequest, bufferSize),
 		closed: false,
+		logger: logger,
 	}
 }
 
@@ -67,6 +81,10 @@ func (q *InMemoryQueue) Subscribe(ctx context.Context, handler func(context.Cont
 	}
 
 	for {
+		// Stop before taking another message, even if one is ready
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		select {
 		case req, ok := <-q.ch:
 			if !ok {
@@ -77,9 +95,13 @@ func (q *InMemoryQueue) Subscribe(ctx context.Context, handler func(context.Cont
 			// Call the handler to process the message
 			// Note: In-memory queue doesn't support retries like Pub/Sub or Redis
 			// If the handler returns an error, we just continue to the next message
-			if err := handler(ctx, req); err != nil {
-				// In production, you'd want to log this error
+			q.inFlight.Add(1)
+			err := handler(ctx, req)
+			q.inFlight.Add(-1)
+			if err != nil {
 				// For in-memory queue, we don't retry failed messages
+				q.logger.WarnContext(ctx, "failed to process work request, dropping it",
+					"org", req.Org, "repo", req.Repo, "error", err)
 				continue
 			}
 
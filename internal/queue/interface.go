@@ -2,19 +2,165 @@ package queue
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// ErrDeclined is returned (wrapped) by handlers that decline a message
+// without processing it, such as a worker shutting down. The message is
+// delivered again, but queues that count deliveries don't count the
+// declined one, so it isn't moved to the dead-letter queue for it.
+var ErrDeclined = errors.New("work request declined")
+
+// Webhook events that queue work requests.
+const (
+	// EventWorkflowRun is a completed workflow run
+	EventWorkflowRun = "workflow_run"
+	// EventCheckRun is a re-run of a check run Canopy published
+	EventCheckRun = "check_run"
+	// EventCheckSuite is a re-run of every check in a check suite with a
+	// check run Canopy published
+	EventCheckSuite = "check_suite"
+	// EventPullRequest is a PR opened or pushed to, whose coverage was
+	// uploaded to storage rather than as workflow artifacts
+	EventPullRequest = "pull_request"
+	// EventUpload is coverage uploaded to Canopy's upload endpoint, e.g. by
+	// a CI system other than GitHub Actions
+	EventUpload = "upload"
+	// EventGitLabPipeline is a successful GitLab pipeline, whose job
+	// artifacts hold its coverage
+	EventGitLabPipeline = "gitlab_pipeline"
+)
+
+// SchemaVersion is the version of the WorkRequest messages published by
+// this version of Canopy:
+//
+//   - 1: messages published before the version was added, which have none
+//   - 2: adds BaseSHA and BaseBranch, and the head, PR, and base of
+//     workflow runs
+//
+// Versions only add fields, so workers read the messages of newer versions
+// as the fields they know, and initiators and workers can be upgraded in
+// any order.
+const SchemaVersion = 2
+
 // WorkRequest represents a message containing information about a workflow run
 // that needs coverage processing.
 type WorkRequest struct {
+	// Version is the SchemaVersion of the publisher; messages without one
+	// are read as version 1
+	Version int `json:"version"`
+
 	// Organization name (e.g., "myorg")
 	Org string `json:"org"`
 
 	// Repository name (e.g., "myrepo")
 	Repo string `json:"repo"`
 
-	// GitHub workflow run ID
+	// GitHub workflow run ID, or the GitLab pipeline ID of an
+	// EventGitLabPipeline request
 	WorkflowRunID int64 `json:"workflow_run_id"`
+
+	// RunCompletedAt is when the workflow run completed (zero if unknown)
+	RunCompletedAt time.Time `json:"run_completed_at,omitzero"`
+
+	// InstallationID is the GitHub App installation that delivered the
+	// event, which the worker authenticates as (zero uses the default)
+	InstallationID int64 `json:"installation_id,omitzero"`
+
+	// CorrelationID traces the run's processing across services in logs
+	// and on its check run: the ID of the webhook delivery that queued it
+	CorrelationID string `json:"correlation_id,omitempty"`
+
+	// TraceContext carries the trace of the delivery that queued the run to
+	// the worker (see tracing.Inject)
+	TraceContext map[string]string `json:"trace_context,omitempty"`
+
+	// EventType is the Event* constant of the webhook event that queued the
+	// request; empty is EventWorkflowRun
+	EventType string `json:"event_type,omitempty"`
+
+	// CheckSuiteID is the re-requested check suite of an EventCheckSuite
+	// request; its workflow run is unknown (zero) until the worker resolves
+	// it from the suite's Canopy check run
+	CheckSuiteID int64 `json:"check_suite_id,omitempty"`
+
+	// PullRequest, HeadSHA, and HeadBranch identify the PR and the commit
+	// of an EventPullRequest, EventUpload, or EventGitLabPipeline request,
+	// whose run isn't a GitHub workflow run; uploads and pipelines of
+	// branches have no PR (for GitLab, the merge request IID). Since
+	// version 2, they are also set for workflow runs, as the webhook
+	// delivered them; the worker still reads the run itself.
+	PullRequest int    `json:"pull_request,omitempty"`
+	HeadSHA     string `json:"head_sha,omitempty"`
+	HeadBranch  string `json:"head_branch,omitempty"`
+
+	// BaseSHA and BaseBranch are the base of the PR, when the webhook
+	// delivered them (version 2); GitLab events have no base SHA
+	BaseSHA    string `json:"base_sha,omitempty"`
+	BaseBranch string `json:"base_branch,omitempty"`
+
+	// Signature is the request's HMAC signature when the queue signs its
+	// requests (see SignedQueue)
+	Signature string `json:"signature,omitempty"`
+}
+
+// UnmarshalJSON reads a message of any schema version, setting the Version
+// of messages without one to 1.
+func (r *WorkRequest) UnmarshalJSON(data []byte) error {
+	type workRequest WorkRequest
+	req := workRequest{Version: 1}
+	if err := json.Unmarshal(data, &req); err != nil {
+		return err
+	}
+	*r = WorkRequest(req)
+	return nil
+}
+
+// Event returns the webhook event that queued the request.
+func (r *WorkRequest) Event() string {
+	if r.EventType == "" {
+		return EventWorkflowRun
+	}
+	return r.EventType
+}
+
+// Uploaded reports whether the request's coverage was uploaded to storage
+// (see EventPullRequest and EventUpload) rather than as artifacts of a
+// workflow run.
+func (r *WorkRequest) Uploaded() bool {
+	return r.EventType == EventPullRequest || r.EventType == EventUpload
+}
+
+// CheckRunExternalID returns the external ID of the check runs published
+// for the request, from which a re-requested check run is traced back to
+// its workflow run (see ParseCheckRunExternalID).
+func (r *WorkRequest) CheckRunExternalID() string {
+	return strconv.FormatInt(r.WorkflowRunID, 10) + "/" + r.CorrelationID
+}
+
+// ParseCheckRunExternalID returns the workflow run and correlation ID of a
+// check run external ID built by CheckRunExternalID.
+func ParseCheckRunExternalID(externalID string) (runID int64, correlationID string, err error) {
+	id, correlationID, _ := strings.Cut(externalID, "/")
+	runID, err = strconv.ParseInt(id, 10, 64)
+	if err != nil || runID <= 0 {
+		return 0, "", fmt.Errorf("invalid check run external ID %q: want <workflow run ID>/<correlation ID>", externalID)
+	}
+	return runID, correlationID, nil
+}
+
+// Stale reports whether the workflow run completed more than maxAge before now.
+// Requests without a completion time, or a non-positive maxAge, are never stale.
+func (r *WorkRequest) Stale(now time.Time, maxAge time.Duration) bool {
+	if maxAge <= 0 || r.RunCompletedAt.IsZero() {
+		return false
+	}
+	return now.Sub(r.RunCompletedAt) > maxAge
 }
 
 // MessageQueue defines the interface for queue operations.
@@ -36,3 +182,15 @@ type MessageQueue interface {
 	// After Close is called, the MessageQueue should not be used.
 	Close() error
 }
+
+// ConcurrentQueue is implemented by queues whose Subscribe calls the
+// handler for several messages at once. Subscribe can't be called again
+// while it runs, so callers set how many messages are handled at once
+// instead of subscribing several times.
+type ConcurrentQueue interface {
+	MessageQueue
+
+	// SetConcurrency sets how many messages Subscribe handles at once. It
+	// takes effect on the next call to Subscribe.
+	SetConcurrency(n int)
+}
@@ -0,0 +1,131 @@
+package queue
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkRequest_Stale(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		completedAt time.Time
+		maxAge      time.Duration
+		expected    bool
+	}{
+		{"recent run", now.Add(-time.Hour), 24 * time.Hour, false},
+		{"old run", now.Add(-48 * time.Hour), 24 * time.Hour, true},
+		{"exactly at deadline", now.Add(-24 * time.Hour), 24 * time.Hour, false},
+		{"deadline disabled", now.Add(-48 * time.Hour), 0, false},
+		{"unknown completion time", time.Time{}, 24 * time.Hour, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &WorkRequest{Org: "org", Repo: "repo", WorkflowRunID: 1, RunCompletedAt: tt.completedAt}
+			assert.Equal(t, tt.expected, req.Stale(now, tt.maxAge))
+		})
+	}
+}
+
+func TestWorkRequest_JSON(t *testing.T) {
+	t.Run("completion time round trips", func(t *testing.T) {
+		req := &WorkRequest{Org: "org", Repo: "repo", WorkflowRunID: 1,
+			RunCompletedAt: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}
+
+		data, err := json.Marshal(req)
+		require.NoError(t, err)
+
+		var decoded WorkRequest
+		require.NoError(t, json.Unmarshal(data, &decoded))
+		assert.True(t, req.RunCompletedAt.Equal(decoded.RunCompletedAt))
+	})
+
+	t.Run("schema versions", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			data     string
+			expected WorkRequest
+		}{
+			{
+				name:     "version 1 has no version",
+				data:     `{"org":"org","repo":"repo","workflow_run_id":1,"correlation_id":"delivery"}`,
+				expected: WorkRequest{Version: 1, Org: "org", Repo: "repo", WorkflowRunID: 1, CorrelationID: "delivery"},
+			},
+			{
+				name:     "version 2",
+				data:     `{"version":2,"org":"org","repo":"repo","workflow_run_id":1,"pull_request":7,"head_sha":"abc","base_sha":"def","base_branch":"main"}`,
+				expected: WorkRequest{Version: 2, Org: "org", Repo: "repo", WorkflowRunID: 1, PullRequest: 7, HeadSHA: "abc", BaseSHA: "def", BaseBranch: "main"},
+			},
+			{
+				name:     "newer versions add unknown fields",
+				data:     `{"version":9,"org":"org","repo":"repo","workflow_run_id":1,"merge_queue":{"id":3}}`,
+				expected: WorkRequest{Version: 9, Org: "org", Repo: "repo", WorkflowRunID: 1},
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				var decoded WorkRequest
+				require.NoError(t, json.Unmarshal([]byte(tt.data), &decoded))
+				assert.Equal(t, tt.expected, decoded)
+			})
+		}
+
+		data, err := json.Marshal(&WorkRequest{Version: SchemaVersion, Org: "org", Repo: "repo", WorkflowRunID: 1})
+		require.NoError(t, err)
+		assert.Contains(t, string(data), `"version":2`)
+	})
+
+	t.Run("zero completion time is omitted", func(t *testing.T) {
+		data, err := json.Marshal(&WorkRequest{Org: "org", Repo: "repo", WorkflowRunID: 1})
+		require.NoError(t, err)
+		assert.NotContains(t, string(data), "run_completed_at")
+	})
+}
+
+func TestCheckRunExternalID(t *testing.T) {
+	req := &WorkRequest{Org: "org", Repo: "repo", WorkflowRunID: 42, CorrelationID: "72d3162e-cc78-11e3-81ab-4c9367dc0958"}
+	assert.Equal(t, "42/72d3162e-cc78-11e3-81ab-4c9367dc0958", req.CheckRunExternalID())
+
+	tests := []struct {
+		name          string
+		externalID    string
+		runID         int64
+		correlationID string
+		wantErr       bool
+	}{
+		{name: "run and correlation ID", externalID: req.CheckRunExternalID(), runID: 42, correlationID: req.CorrelationID},
+		{name: "run without correlation ID", externalID: "42/", runID: 42},
+		{name: "run only", externalID: "42", runID: 42},
+		{name: "correlation ID only", externalID: "72d3162e-cc78-11e3-81ab-4c9367dc0958", wantErr: true},
+		{name: "empty", externalID: "", wantErr: true},
+		{name: "non-positive run", externalID: "0/abc", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runID, correlationID, err := ParseCheckRunExternalID(tt.externalID)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.runID, runID)
+			assert.Equal(t, tt.correlationID, correlationID)
+		})
+	}
+}
+
+func TestWorkRequest_Event(t *testing.T) {
+	assert.Equal(t, EventWorkflowRun, (&WorkRequest{}).Event())
+	assert.Equal(t, EventCheckSuite, (&WorkRequest{EventType: EventCheckSuite}).Event())
+	assert.False(t, (&WorkRequest{}).Uploaded())
+	assert.True(t, (&WorkRequest{EventType: EventPullRequest}).Uploaded())
+	assert.True(t, (&WorkRequest{EventType: EventUpload}).Uploaded())
+}
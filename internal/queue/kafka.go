@@ -0,0 +1,442 @@
+package queue
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+)
+
+// SASL mechanisms supported by KafkaQueue.
+const (
+	SASLPlain       = "PLAIN"
+	SASLScramSHA256 = "SCRAM-SHA-256"
+	SASLScramSHA512 = "SCRAM-SHA-512"
+)
+
+// KafkaQueue implements MessageQueue using a Kafka topic.
+// Workers consume it in a consumer group, which divides the topic's
+// partitions among them. Offsets are committed only after the handler
+// succeeds, so failed messages are delivered again, until they are moved
+// to the dead-letter topic after MaxDeliveries.
+type KafkaQueue struct {
+	producer      *kgo.Client
+	opts          []kgo.Opt
+	topic         string
+	consumerGroup string
+	logger        *slog.Logger
+
+	maxDeliveries int
+	// deadLetterTopic is empty to drop exhausted messages
+	deadLetterTopic string
+
+	// fetchWait is how long a fetch waits for new messages
+	fetchWait time.Duration
+	// heartbeatInterval is how often the consumer group is told the
+	// consumer is alive
+	heartbeatInterval time.Duration
+	// retryDelay is how long a partition pauses after a handler failure
+	// before its message is delivered again
+	retryDelay time.Duration
+}
+
+// KafkaConfig holds configuration for creating a KafkaQueue.
+type KafkaConfig struct {
+	// Brokers are the bootstrap broker addresses (host:port)
+	Brokers []string
+
+	// Topic is the Kafka topic name
+	Topic string
+
+	// ConsumerGroup is the consumer group name
+	ConsumerGroup string
+
+	// ClientID identifies the client in broker logs (default: canopy)
+	ClientID string
+
+	// TLS, if set, connects to brokers with TLS
+	TLS *tls.Config
+
+	// SASLMechanism, if set, authenticates to the brokers with SASLPlain,
+	// SASLScramSHA256, or SASLScramSHA512
+	SASLMechanism string
+
+	// SASLUsername and SASLPassword are the SASL credentials
+	SASLUsername string
+	SASLPassword string
+
+	// CreateIfNotExists creates the topic if it doesn't exist
+	CreateIfNotExists bool
+
+	// Partitions is the number of partitions of a created topic (default: 6)
+	Partitions int32
+
+	// ReplicationFactor is the replication factor of a created topic (default: 1)
+	ReplicationFactor int16
+
+	// MaxDeliveries is how many times a message is delivered before it is
+	// moved to DeadLetterTopic; zero retries failed messages forever.
+	// Kafka doesn't count deliveries, so each consumer counts those of the
+	// messages it handles, starting over after a rebalance.
+	MaxDeliveries int
+
+	// DeadLetterTopic is the topic exhausted and malformed messages are
+	// published to; empty drops them, logging them as errors
+	DeadLetterTopic string
+
+	// Logger logs messages that fail or are moved to the dead-letter topic
+	// (default: slog.Default())
+	Logger *slog.Logger
+}
+
+// NewKafkaQueue creates a new KafkaQueue instance.
+// The caller is responsible for calling Close() when done.
+func NewKafkaQueue(ctx context.Context, cfg KafkaConfig) (*KafkaQueue, error) {
+	if len(cfg.Brokers) == 0 {
+		return nil, fmt.Errorf("kafka brokers are required")
+	}
+	if cfg.Topic == "" {
+		return nil, fmt.Errorf("topic is required")
+	}
+	if cfg.ConsumerGroup == "" {
+		return nil, fmt.Errorf("consumer group is required")
+	}
+	if cfg.ClientID == "" {
+		cfg.ClientID = "canopy"
+	}
+	if cfg.Partitions <= 0 {
+		cfg.Partitions = 6
+	}
+	if cfg.ReplicationFactor <= 0 {
+		cfg.ReplicationFactor = 1
+	}
+	if cfg.MaxDeliveries < 0 {
+		return nil, fmt.Errorf("max deliveries must not be negative")
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+
+	opts := []kgo.Opt{kgo.SeedBrokers(cfg.Brokers...), kgo.ClientID(cfg.ClientID)}
+	if cfg.TLS != nil {
+		opts = append(opts, kgo.DialTLSConfig(cfg.TLS))
+	}
+	if cfg.SASLMechanism != "" {
+		mechanism, err := saslMechanism(cfg.SASLMechanism, cfg.SASLUsername, cfg.SASLPassword)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, kgo.SASL(mechanism))
+	}
+
+	// Messages are partitioned by key, so messages of a repository go to
+	// the same partition
+	producer, err := kgo.NewClient(slices.Concat(opts, []kgo.Opt{kgo.DefaultProduceTopic(cfg.Topic)})...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kafka client: %w", err)
+	}
+
+	admin := kadm.NewClient(producer)
+	if cfg.CreateIfNotExists {
+		topics := []string{cfg.Topic}
+		if cfg.DeadLetterTopic != "" {
+			topics = append(topics, cfg.DeadLetterTopic)
+		}
+		for _, topic := range topics {
+			_, err := admin.CreateTopic(ctx, cfg.Partitions, cfg.ReplicationFactor, nil, topic)
+			if err != nil && !errors.Is(err, kerr.TopicAlreadyExists) {
+				producer.Close()
+				return nil, fmt.Errorf("failed to create topic %s: %w", topic, err)
+			}
+		}
+	}
+
+	// Test connection
+	topics, err := admin.ListTopics(ctx, cfg.Topic)
+	if err != nil {
+		producer.Close()
+		return nil, fmt.Errorf("failed to connect to kafka: %w", err)
+	}
+	if err := topics[cfg.Topic].Err; err != nil {
+		producer.Close()
+		return nil, fmt.Errorf("kafka topic %s: %w", cfg.Topic, err)
+	}
+
+	return &KafkaQueue{
+		producer:          producer,
+		opts:              opts,
+		topic:             cfg.Topic,
+		consumerGroup:     cfg.ConsumerGroup,
+		logger:            cfg.Logger,
+		maxDeliveries:     cfg.MaxDeliveries,
+		deadLetterTopic:   cfg.DeadLetterTopic,
+		fetchWait:         5 * time.Second,
+		heartbeatInterval: 3 * time.Second,
+		retryDelay:        5 * time.Second,
+	}, nil
+}
+
+// saslMechanism returns the SASL mechanism of the given name.
+func saslMechanism(name, username, password string) (sasl.Mechanism, error) {
+	switch name {
+	case SASLPlain:
+		return plain.Auth{User: username, Pass: password}.AsMechanism(), nil
+	case SASLScramSHA256:
+		return scram.Auth{User: username, Pass: password}.AsSha256Mechanism(), nil
+	case SASLScramSHA512:
+		return scram.Auth{User: username, Pass: password}.AsSha512Mechanism(), nil
+	default:
+		return nil, fmt.Errorf("unsupported SASL mechanism %q (must be %s, %s, or %s)", name, SASLPlain, SASLScramSHA256, SASLScramSHA512)
+	}
+}
+
+// Publish sends a WorkRequest message to the Kafka topic. Messages of a
+// repository go to the same partition, so they are processed in order.
+func (q *KafkaQueue) Publish(ctx context.Context, req *WorkRequest) error {
+	if req == nil {
+		return fmt.Errorf("work request cannot be nil")
+	}
+
+	// Serialize the work request to JSON
+	data, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal work request: %w", err)
+	}
+
+	record := &kgo.Record{Key: []byte(req.Org + "/" + req.Repo), Value: data}
+	if err := q.producer.ProduceSync(ctx, record).FirstErr(); err != nil {
+		return fmt.Errorf("failed to publish message to kafka topic: %w", err)
+	}
+
+	return nil
+}
+
+// Subscribe joins the consumer group and consumes messages from the
+// partitions assigned to this consumer, calling the handler for each.
+// Messages of a partition are handled in order: when the handler fails,
+// the partition pauses and the message is delivered again, to this or,
+// after a rebalance, another consumer. A message whose handler fails on its
+// last allowed delivery is moved to the dead-letter topic, unblocking the
+// partition.
+// This method blocks until the context is cancelled or an error occurs.
+func (q *KafkaQueue) Subscribe(ctx context.Context, handler func(context.Context, *WorkRequest) error) error {
+	if handler == nil {
+		return fmt.Errorf("handler cannot be nil")
+	}
+
+	// Each subscription is a member of the group, so concurrent
+	// subscriptions share the partitions
+	consumer, err := kgo.NewClient(slices.Concat(q.opts, []kgo.Opt{
+		kgo.ConsumerGroup(q.consumerGroup),
+		kgo.ConsumeTopics(q.topic),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+		kgo.DisableAutoCommit(),
+		kgo.FetchMaxWait(q.fetchWait),
+		kgo.HeartbeatInterval(q.heartbeatInterval),
+	})...)
+	if err != nil {
+		return fmt.Errorf("failed to create kafka consumer: %w", err)
+	}
+	// Closing leaves the group, so partitions are reassigned without
+	// waiting for the session to expire
+	defer consumer.Close()
+
+	// Partitions paused after a failure, until they are resumed
+	pausedUntil := make(map[int32]time.Time)
+	// The failed deliveries of the message each partition is blocked on
+	failures := make(map[int32]failedDeliveries)
+
+	for {
+		q.resume(consumer, pausedUntil)
+
+		// Wake up to resume the next paused partition
+		pollCtx, cancel := ctx, context.CancelFunc(func() {})
+		if resume := nextResume(pausedUntil); !resume.IsZero() {
+			pollCtx, cancel = context.WithDeadline(ctx, resume)
+		}
+		fetches := consumer.PollFetches(pollCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := fatalFetchError(fetches); err != nil {
+			return err
+		}
+
+		for _, record := range fetches.Records() {
+			if _, paused := pausedUntil[record.Partition]; paused {
+				// A previous message of the partition failed
+				continue
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			failed := failures[record.Partition]
+			if failed.offset != record.Offset {
+				failed = failedDeliveries{offset: record.Offset}
+			}
+			delivery := Delivery{Attempt: failed.count + 1, MaxAttempts: q.maxDeliveries}
+			if err := q.processMessage(ctx, record, delivery, handler); err != nil {
+				// Processing failed - don't commit, the message will be
+				// retried; declined deliveries aren't counted
+				if !errors.Is(err, ErrDeclined) {
+					failed.count++
+				}
+				failures[record.Partition] = failed
+				q.logger.WarnContext(ctx, "failed to process kafka message, retrying",
+					"partition", record.Partition, "offset", record.Offset, "attempt", delivery.Attempt, "error", err)
+				q.pause(consumer, record, pausedUntil)
+				continue
+			}
+			delete(failures, record.Partition)
+			// A commit that fails because the partition was reassigned
+			// leaves the message to its new owner, which handles it again
+			_ = q.commit(ctx, consumer, record)
+		}
+	}
+}
+
+// failedDeliveries counts the failed deliveries of the message at offset.
+type failedDeliveries struct {
+	offset int64
+	count  int
+}
+
+// fatalFetchError returns the first error of fetches that the client
+// doesn't retry, such as a refused authentication or authorization.
+// Connection errors and retriable broker errors are retried by the client.
+func fatalFetchError(fetches kgo.Fetches) error {
+	var fatal error
+	fetches.EachError(func(_ string, _ int32, err error) {
+		var kafkaErr *kerr.Error
+		if fatal == nil && errors.As(err, &kafkaErr) && !kafkaErr.Retriable {
+			fatal = fmt.Errorf("failed to consume kafka topic: %w", err)
+		}
+	})
+	return fatal
+}
+
+// pause stops fetching the partition of a failed message and rewinds it
+// to the message, which is fetched again after retryDelay.
+func (q *KafkaQueue) pause(consumer *kgo.Client, record *kgo.Record, pausedUntil map[int32]time.Time) {
+	partitions := map[string][]int32{q.topic: {record.Partition}}
+	consumer.PauseFetchPartitions(partitions)
+	consumer.SetOffsets(map[string]map[int32]kgo.EpochOffset{
+		q.topic: {record.Partition: {Epoch: record.LeaderEpoch, Offset: record.Offset}},
+	})
+	pausedUntil[record.Partition] = time.Now().Add(q.retryDelay)
+}
+
+// resume resumes fetching the paused partitions whose delay has passed.
+func (q *KafkaQueue) resume(consumer *kgo.Client, pausedUntil map[int32]time.Time) {
+	now := time.Now()
+	for p, until := range pausedUntil {
+		if now.Before(until) {
+			continue
+		}
+		consumer.ResumeFetchPartitions(map[string][]int32{q.topic: {p}})
+		delete(pausedUntil, p)
+	}
+}
+
+// nextResume returns when the next paused partition is resumed, or zero if
+// none is paused.
+func nextResume(pausedUntil map[int32]time.Time) time.Time {
+	var next time.Time
+	for _, until := range pausedUntil {
+		if next.IsZero() || until.Before(next) {
+			next = until
+		}
+	}
+	return next
+}
+
+// commit commits the offset after a handled message. A message handled
+// while the consumer stops is still committed, so it isn't handled again.
+func (q *KafkaQueue) commit(ctx context.Context, consumer *kgo.Client, record *kgo.Record) error {
+	if ctx.Err() != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+	}
+	return consumer.CommitRecords(ctx, record)
+}
+
+// processMessage handles a single message from the topic. Malformed
+// messages, and messages whose handler failed on their last allowed
+// delivery, are moved to the dead-letter topic and committed.
+func (q *KafkaQueue) processMessage(ctx context.Context, record *kgo.Record, delivery Delivery, handler func(context.Context, *WorkRequest) error) error {
+	// Parse the work request
+	var req WorkRequest
+	if err := json.Unmarshal(record.Value, &req); err != nil {
+		// Invalid JSON - move it out of the way so it isn't retried
+		return q.deadLetter(ctx, record, fmt.Sprintf("failed to unmarshal work request: %v", err), delivery.Attempt)
+	}
+
+	// Call the handler to process the message
+	if err := handler(WithDelivery(ctx, delivery), &req); err != nil {
+		if errors.Is(err, ErrDeclined) {
+			return err
+		}
+		if delivery.Last() {
+			return q.deadLetter(ctx, record, err.Error(), delivery.Attempt)
+		}
+		return fmt.Errorf("handler failed to process message: %w", err)
+	}
+
+	return nil
+}
+
+// Headers of messages published to the dead-letter topic.
+const (
+	headerReason     = "canopy-reason"
+	headerDeliveries = "canopy-deliveries"
+	headerPartition  = "canopy-partition"
+	headerOffset     = "canopy-offset"
+)
+
+// deadLetter publishes a message to the dead-letter topic, with why and
+// where from in its headers, or logs and drops it without one. A message
+// that can't be published is not committed, so it is delivered again.
+func (q *KafkaQueue) deadLetter(ctx context.Context, record *kgo.Record, reason string, deliveries int) error {
+	attrs := []any{"partition", record.Partition, "offset", record.Offset, "deliveries", deliveries, "reason", reason}
+	if q.deadLetterTopic == "" {
+		q.logger.ErrorContext(ctx, "dropping kafka message", attrs...)
+		return nil
+	}
+
+	letter := &kgo.Record{
+		Topic: q.deadLetterTopic,
+		Key:   record.Key,
+		Value: record.Value,
+		Headers: []kgo.RecordHeader{
+			{Key: headerReason, Value: []byte(reason)},
+			{Key: headerDeliveries, Value: []byte(strconv.Itoa(deliveries))},
+			{Key: headerPartition, Value: []byte(strconv.Itoa(int(record.Partition)))},
+			{Key: headerOffset, Value: []byte(strconv.FormatInt(record.Offset, 10))},
+		},
+	}
+	if err := q.producer.ProduceSync(ctx, letter).FirstErr(); err != nil {
+		return fmt.Errorf("failed to move message to dead-letter topic: %w", err)
+	}
+	q.logger.WarnContext(ctx, "moved kafka message to dead-letter topic", append(attrs, "topic", q.deadLetterTopic)...)
+	return nil
+}
+
+// Close releases resources held by the KafkaQueue.
+func (q *KafkaQueue) Close() error {
+	q.producer.Close()
+	return nil
+}
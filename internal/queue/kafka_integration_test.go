@@ -0,0 +1,111 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/testutil"
+)
+
+// TestKafkaQueue_Integration runs the queue against a real Kafka broker.
+func TestKafkaQueue_Integration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	// Configure Ryuk for Podman compatibility
+	testutil.ConfigureRyuk()
+
+	ctx := context.Background()
+
+	// The broker advertises the address clients reach it at, so it's
+	// published on a host port chosen before it starts
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := listener.Addr().(*net.TCPAddr).Port
+	require.NoError(t, listener.Close())
+
+	// Start a single-node KRaft cluster
+	req := testcontainers.ContainerRequest{
+		Image:        "apache/kafka:3.9.1",
+		ExposedPorts: []string{fmt.Sprintf("%d:9092/tcp", port)},
+		Env: map[string]string{
+			"KAFKA_NODE_ID":                                  "1",
+			"KAFKA_PROCESS_ROLES":                            "broker,controller",
+			"KAFKA_LISTENERS":                                "PLAINTEXT://:9092,CONTROLLER://:9093",
+			"KAFKA_ADVERTISED_LISTENERS":                     fmt.Sprintf("PLAINTEXT://127.0.0.1:%d", port),
+			"KAFKA_LISTENER_SECURITY_PROTOCOL_MAP":           "PLAINTEXT:PLAINTEXT,CONTROLLER:PLAINTEXT",
+			"KAFKA_CONTROLLER_LISTENER_NAMES":                "CONTROLLER",
+			"KAFKA_CONTROLLER_QUORUM_VOTERS":                 "1@localhost:9093",
+			"KAFKA_OFFSETS_TOPIC_REPLICATION_FACTOR":         "1",
+			"KAFKA_TRANSACTION_STATE_LOG_REPLICATION_FACTOR": "1",
+			"KAFKA_TRANSACTION_STATE_LOG_MIN_ISR":            "1",
+			"KAFKA_GROUP_INITIAL_REBALANCE_DELAY_MS":         "0",
+		},
+		WaitingFor: wait.ForLog("Kafka Server started").WithStartupTimeout(120 * time.Second),
+	}
+
+	kafkaContainer, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: req,
+		Started:          true,
+		ProviderType:     testutil.DetectContainerProvider(),
+	})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, kafkaContainer.Terminate(ctx))
+	}()
+
+	brokers := []string{fmt.Sprintf("127.0.0.1:%d", port)}
+	q := newTestKafkaQueue(t, brokers, 2)
+	admin := newKafkaAdmin(t, brokers)
+
+	t.Run("publish, retry, and commit", func(t *testing.T) {
+		for i := int64(1); i <= 3; i++ {
+			require.NoError(t, q.Publish(ctx, &WorkRequest{Org: "acme", Repo: fmt.Sprintf("repo-%d", i), WorkflowRunID: i}))
+		}
+
+		// Two consumers share the partitions; the first delivery of a
+		// request fails and is retried
+		var rec recorder
+		var mu sync.Mutex
+		failed := make(map[int64]bool)
+		handler := func(ctx context.Context, req *WorkRequest) error {
+			mu.Lock()
+			first := !failed[req.WorkflowRunID]
+			failed[req.WorkflowRunID] = true
+			mu.Unlock()
+			if first {
+				return errors.New("GitHub is down")
+			}
+			return rec.handle(ctx, req)
+		}
+		subscribe(t, q, handler)
+		subscribe(t, newTestKafkaQueue(t, brokers, 2), handler)
+
+		require.Eventually(t, func() bool { return len(rec.runIDs()) >= 3 }, 60*time.Second, 100*time.Millisecond)
+		assert.Subset(t, rec.runIDs(), []int64{1, 2, 3})
+		require.Eventually(t, func() bool { return admin.committedAll(2) }, 30*time.Second, 100*time.Millisecond)
+	})
+
+	t.Run("skips invalid messages", func(t *testing.T) {
+		require.NoError(t, q.producer.ProduceSync(ctx, &kgo.Record{Value: []byte(`{"org": "test", invalid}`)}).FirstErr())
+		require.NoError(t, q.Publish(ctx, &WorkRequest{Org: "acme", Repo: "widgets", WorkflowRunID: 4}))
+
+		var rec recorder
+		subscribe(t, q, rec.handle)
+		require.Eventually(t, func() bool { return len(rec.runIDs()) == 1 }, 60*time.Second, 100*time.Millisecond)
+		assert.Equal(t, []int64{4}, rec.runIDs())
+		require.Eventually(t, func() bool { return admin.committedAll(2) }, 30*time.Second, 100*time.Millisecond)
+	})
+}
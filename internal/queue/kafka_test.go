@@ -0,0 +1,469 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func TestKafkaConfig_Validation(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		config  KafkaConfig
+		wantErr string
+	}{
+		{
+			name:    "missing brokers",
+			config:  KafkaConfig{Topic: "test-topic", ConsumerGroup: "test-group"},
+			wantErr: "kafka brokers are required",
+		},
+		{
+			name:    "missing topic",
+			config:  KafkaConfig{Brokers: []string{"localhost:9092"}, ConsumerGroup: "test-group"},
+			wantErr: "topic is required",
+		},
+		{
+			name:    "missing consumer group",
+			config:  KafkaConfig{Brokers: []string{"localhost:9092"}, Topic: "test-topic"},
+			wantErr: "consumer group is required",
+		},
+		{
+			name:    "unsupported SASL mechanism",
+			config:  KafkaConfig{Brokers: []string{"localhost:9092"}, Topic: "test-topic", ConsumerGroup: "test-group", SASLMechanism: "GSSAPI"},
+			wantErr: `unsupported SASL mechanism "GSSAPI" (must be PLAIN, SCRAM-SHA-256, or SCRAM-SHA-512)`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewKafkaQueue(ctx, tt.config)
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestKafkaQueue_ConnectionError(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("connection to invalid address fails", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+
+		_, err := NewKafkaQueue(ctx, KafkaConfig{Brokers: []string{"localhost:1"}, Topic: "test-topic", ConsumerGroup: "test-group"})
+		assert.ErrorContains(t, err, "failed to connect to kafka")
+	})
+
+	t.Run("missing topic", func(t *testing.T) {
+		brokers := newTestCluster(t)
+		_, err := NewKafkaQueue(ctx, KafkaConfig{Brokers: brokers, Topic: "test-topic", ConsumerGroup: "test-group"})
+		assert.ErrorContains(t, err, "UNKNOWN_TOPIC_OR_PARTITION")
+	})
+}
+
+func TestKafkaQueue_SASL(t *testing.T) {
+	tests := []struct {
+		name      string
+		mechanism string
+		password  string
+		wantErr   bool
+	}{
+		{name: "plain", mechanism: SASLPlain, password: "secret"},
+		{name: "scram-sha-256", mechanism: SASLScramSHA256, password: "secret"},
+		{name: "scram-sha-512", mechanism: SASLScramSHA512, password: "secret"},
+		{name: "wrong password", mechanism: SASLScramSHA256, password: "wrong", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			brokers := newTestCluster(t, kfake.EnableSASL(), kfake.Superuser(tt.mechanism, "canopy", "secret"))
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			q, err := NewKafkaQueue(ctx, KafkaConfig{
+				Brokers:           brokers,
+				Topic:             "test-topic",
+				ConsumerGroup:     "test-group",
+				SASLMechanism:     tt.mechanism,
+				SASLUsername:      "canopy",
+				SASLPassword:      tt.password,
+				CreateIfNotExists: true,
+			})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			defer q.Close()
+			assert.NoError(t, q.Publish(ctx, &WorkRequest{Org: "acme", Repo: "widgets", WorkflowRunID: 1}))
+		})
+	}
+}
+
+// newTestCluster starts an in-memory Kafka cluster for the test and
+// returns its broker addresses.
+func newTestCluster(t *testing.T, opts ...kfake.Opt) []string {
+	t.Helper()
+	cluster, err := kfake.NewCluster(append([]kfake.Opt{kfake.NumBrokers(1)}, opts...)...)
+	require.NoError(t, err)
+	t.Cleanup(cluster.Close)
+	return cluster.ListenAddrs()
+}
+
+// newTestKafkaQueue creates a queue on brokers with short timings, creating
+// the topic with the given number of partitions. configure, if set,
+// adjusts the queue's config.
+func newTestKafkaQueue(t *testing.T, brokers []string, partitions int32, configure ...func(*KafkaConfig)) *KafkaQueue {
+	t.Helper()
+	cfg := KafkaConfig{
+		Brokers:           brokers,
+		Topic:             "test-topic",
+		ConsumerGroup:     "test-group",
+		CreateIfNotExists: true,
+		Partitions:        partitions,
+	}
+	for _, c := range configure {
+		c(&cfg)
+	}
+	q, err := NewKafkaQueue(context.Background(), cfg)
+	require.NoError(t, err)
+	q.fetchWait = 20 * time.Millisecond
+	q.heartbeatInterval = 20 * time.Millisecond
+	q.retryDelay = 20 * time.Millisecond
+	t.Cleanup(func() { q.Close() })
+	return q
+}
+
+// kafkaAdmin inspects the topic and consumer group of test queues.
+type kafkaAdmin struct {
+	t      *testing.T
+	client *kadm.Client
+}
+
+func newKafkaAdmin(t *testing.T, brokers []string) *kafkaAdmin {
+	t.Helper()
+	client, err := kgo.NewClient(kgo.SeedBrokers(brokers...))
+	require.NoError(t, err)
+	t.Cleanup(client.Close)
+	return &kafkaAdmin{t: t, client: kadm.NewClient(client)}
+}
+
+// records returns the number of records of a partition of the test topic.
+func (a *kafkaAdmin) records(partition int32) int64 {
+	offsets, err := a.client.ListEndOffsets(context.Background(), "test-topic")
+	require.NoError(a.t, err)
+	offset, _ := offsets.Lookup("test-topic", partition)
+	return offset.Offset
+}
+
+// committed returns the committed offset of a partition of the test topic,
+// or 0, where the group starts, if none is.
+func (a *kafkaAdmin) committed(partition int32) int64 {
+	offsets, err := a.client.FetchOffsets(context.Background(), "test-group")
+	if errors.Is(err, kerr.GroupIDNotFound) {
+		return 0
+	}
+	require.NoError(a.t, err)
+	offset, ok := offsets.Lookup("test-topic", partition)
+	if !ok {
+		return 0
+	}
+	return offset.At
+}
+
+// committedAll reports whether the offsets of all records of the test
+// topic's partitions are committed.
+func (a *kafkaAdmin) committedAll(partitions int32) bool {
+	for p := range partitions {
+		if a.committed(p) != a.records(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// members returns the number of members of the test group.
+func (a *kafkaAdmin) members() int {
+	groups, err := a.client.DescribeGroups(context.Background(), "test-group")
+	require.NoError(a.t, err)
+	return len(groups["test-group"].Members)
+}
+
+// subscribe runs Subscribe until the test ends.
+func subscribe(t *testing.T, q *KafkaQueue, handler func(context.Context, *WorkRequest) error) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- q.Subscribe(ctx, handler) }()
+	t.Cleanup(func() {
+		cancel()
+		assert.ErrorIs(t, <-done, context.Canceled)
+	})
+}
+
+// recorder records handled work requests.
+type recorder struct {
+	mu   sync.Mutex
+	reqs []WorkRequest
+}
+
+func (r *recorder) handle(ctx context.Context, req *WorkRequest) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reqs = append(r.reqs, *req)
+	return nil
+}
+
+func (r *recorder) runIDs() []int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var ids []int64
+	for _, req := range r.reqs {
+		ids = append(ids, req.WorkflowRunID)
+	}
+	return ids
+}
+
+func TestKafkaQueue_PublishSubscribe(t *testing.T) {
+	ctx := context.Background()
+	brokers := newTestCluster(t)
+	q := newTestKafkaQueue(t, brokers, 3)
+	admin := newKafkaAdmin(t, brokers)
+
+	for i := int64(1); i <= 3; i++ {
+		require.NoError(t, q.Publish(ctx, &WorkRequest{Org: "acme", Repo: "widgets", WorkflowRunID: i}))
+	}
+
+	// Requests of a repository share a partition
+	var widgets []int64
+	for p := range int32(3) {
+		widgets = append(widgets, admin.records(p))
+	}
+	assert.ElementsMatch(t, []int64{0, 0, 3}, widgets)
+
+	require.NoError(t, q.Publish(ctx, &WorkRequest{Org: "acme", Repo: "gadgets", WorkflowRunID: 4}))
+
+	var rec recorder
+	subscribe(t, q, rec.handle)
+	require.Eventually(t, func() bool { return len(rec.runIDs()) == 4 }, 10*time.Second, 10*time.Millisecond)
+	assert.ElementsMatch(t, []int64{1, 2, 3, 4}, rec.runIDs())
+
+	// Offsets are committed after messages are handled
+	require.Eventually(t, func() bool { return admin.committedAll(3) }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestKafkaQueue_RetriesFailedMessages(t *testing.T) {
+	ctx := context.Background()
+	brokers := newTestCluster(t)
+	q := newTestKafkaQueue(t, brokers, 1)
+	admin := newKafkaAdmin(t, brokers)
+
+	for i := int64(1); i <= 2; i++ {
+		require.NoError(t, q.Publish(ctx, &WorkRequest{Org: "acme", Repo: "widgets", WorkflowRunID: i}))
+	}
+
+	var rec recorder
+	failures := 2
+	subscribe(t, q, func(ctx context.Context, req *WorkRequest) error {
+		rec.handle(ctx, req)
+		if req.WorkflowRunID == 1 && failures > 0 {
+			failures--
+			return errors.New("GitHub is down")
+		}
+		return nil
+	})
+
+	// The failed message is delivered again before the next one
+	require.Eventually(t, func() bool { return len(rec.runIDs()) == 4 }, 10*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []int64{1, 1, 1, 2}, rec.runIDs())
+	require.Eventually(t, func() bool { return admin.committed(0) == 2 }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestKafkaQueue_ResumesFromCommittedOffset(t *testing.T) {
+	ctx := context.Background()
+	brokers := newTestCluster(t)
+	q := newTestKafkaQueue(t, brokers, 1)
+	admin := newKafkaAdmin(t, brokers)
+	require.NoError(t, q.Publish(ctx, &WorkRequest{Org: "acme", Repo: "widgets", WorkflowRunID: 1}))
+
+	var first recorder
+	subCtx, cancel := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() { done <- q.Subscribe(subCtx, first.handle) }()
+	require.Eventually(t, func() bool { return admin.committed(0) == 1 }, 10*time.Second, 10*time.Millisecond)
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+	// The consumer left the group
+	assert.Zero(t, admin.members())
+
+	require.NoError(t, q.Publish(ctx, &WorkRequest{Org: "acme", Repo: "widgets", WorkflowRunID: 2}))
+	var second recorder
+	subscribe(t, newTestKafkaQueue(t, brokers, 1), second.handle)
+	require.Eventually(t, func() bool { return len(second.runIDs()) == 1 }, 10*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []int64{1}, first.runIDs())
+	assert.Equal(t, []int64{2}, second.runIDs())
+}
+
+func TestKafkaQueue_CommitsMessageHandledWhileStopping(t *testing.T) {
+	ctx := context.Background()
+	brokers := newTestCluster(t)
+	q := newTestKafkaQueue(t, brokers, 1)
+	admin := newKafkaAdmin(t, brokers)
+	require.NoError(t, q.Publish(ctx, &WorkRequest{Org: "acme", Repo: "widgets", WorkflowRunID: 1}))
+
+	subCtx, cancel := context.WithCancel(ctx)
+	started := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- q.Subscribe(subCtx, func(context.Context, *WorkRequest) error {
+			close(started)
+			// The consumer is stopped while the message is handled
+			cancel()
+			return nil
+		})
+	}()
+	<-started
+	require.ErrorIs(t, <-done, context.Canceled)
+
+	assert.Equal(t, int64(1), admin.committed(0))
+}
+
+func TestKafkaQueue_SkipsInvalidMessages(t *testing.T) {
+	ctx := context.Background()
+	brokers := newTestCluster(t)
+	q := newTestKafkaQueue(t, brokers, 1)
+	admin := newKafkaAdmin(t, brokers)
+
+	require.NoError(t, q.producer.ProduceSync(ctx, &kgo.Record{Value: []byte(`{"org": "test", invalid}`)}).FirstErr())
+	require.NoError(t, q.Publish(ctx, &WorkRequest{Org: "acme", Repo: "widgets", WorkflowRunID: 2}))
+
+	var rec recorder
+	subscribe(t, q, rec.handle)
+	require.Eventually(t, func() bool { return len(rec.runIDs()) == 1 }, 10*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []int64{2}, rec.runIDs())
+	require.Eventually(t, func() bool { return admin.committed(0) == 2 }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestKafkaQueue_DeadLetters(t *testing.T) {
+	tests := []struct {
+		name            string
+		deadLetterTopic string
+		expected        []map[string]string
+	}{
+		{
+			name:            "dead-letter topic",
+			deadLetterTopic: "test-topic-dead-letter",
+			expected: []map[string]string{
+				{headerReason: "failed to unmarshal work request: invalid character 'i' looking for beginning of object key string", headerDeliveries: "1", headerPartition: "0", headerOffset: "0"},
+				{headerReason: "GitHub is down", headerDeliveries: "3", headerPartition: "0", headerOffset: "1"},
+			},
+		},
+		{
+			name: "dropped without a dead-letter topic",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			brokers := newTestCluster(t)
+			q := newTestKafkaQueue(t, brokers, 1, func(cfg *KafkaConfig) {
+				cfg.MaxDeliveries = 3
+				cfg.DeadLetterTopic = tt.deadLetterTopic
+			})
+			admin := newKafkaAdmin(t, brokers)
+
+			require.NoError(t, q.producer.ProduceSync(ctx, &kgo.Record{Value: []byte(`{"org": "test", invalid}`)}).FirstErr())
+			for i := int64(1); i <= 2; i++ {
+				require.NoError(t, q.Publish(ctx, &WorkRequest{Org: "acme", Repo: "widgets", WorkflowRunID: i}))
+			}
+
+			var mu sync.Mutex
+			var deliveries []Delivery
+			declined := false
+			subscribe(t, q, func(ctx context.Context, req *WorkRequest) error {
+				mu.Lock()
+				defer mu.Unlock()
+				if req.WorkflowRunID != 1 {
+					return nil
+				}
+				delivery, ok := DeliveryFrom(ctx)
+				require.True(t, ok)
+				deliveries = append(deliveries, delivery)
+				if !declined {
+					// Declined deliveries aren't counted
+					declined = true
+					return ErrDeclined
+				}
+				return errors.New("GitHub is down")
+			})
+
+			// The exhausted message is committed, unblocking the next one
+			require.Eventually(t, func() bool { return admin.committed(0) == 3 }, 10*time.Second, 10*time.Millisecond)
+			mu.Lock()
+			assert.Equal(t, []Delivery{{1, 3}, {1, 3}, {2, 3}, {3, 3}}, deliveries)
+			mu.Unlock()
+
+			if tt.deadLetterTopic == "" {
+				return
+			}
+			consumer, err := kgo.NewClient(kgo.SeedBrokers(brokers...), kgo.ConsumeTopics(tt.deadLetterTopic), kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()))
+			require.NoError(t, err)
+			defer consumer.Close()
+			var letters []map[string]string
+			for len(letters) < len(tt.expected) {
+				pollCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+				fetches := consumer.PollFetches(pollCtx)
+				cancel()
+				require.NoError(t, fetches.Err())
+				for _, record := range fetches.Records() {
+					headers := make(map[string]string)
+					for _, h := range record.Headers {
+						headers[h.Key] = string(h.Value)
+					}
+					letters = append(letters, headers)
+				}
+			}
+			assert.Equal(t, tt.expected, letters)
+		})
+	}
+}
+
+func TestKafkaQueue_ConsumerGroup(t *testing.T) {
+	ctx := context.Background()
+	brokers := newTestCluster(t)
+	admin := newKafkaAdmin(t, brokers)
+
+	// Two consumers share the partitions. A message whose commit races a
+	// rebalance is handled again by the partition's next owner.
+	var rec recorder
+	subscribe(t, newTestKafkaQueue(t, brokers, 4), rec.handle)
+	subscribe(t, newTestKafkaQueue(t, brokers, 4), rec.handle)
+	require.Eventually(t, func() bool { return admin.members() == 2 }, 10*time.Second, 10*time.Millisecond)
+
+	q := newTestKafkaQueue(t, brokers, 4)
+	want := make(map[int64]bool)
+	for i := int64(1); i <= 20; i++ {
+		want[i] = true
+		require.NoError(t, q.Publish(ctx, &WorkRequest{Org: "acme", Repo: fmt.Sprintf("repo-%d", i), WorkflowRunID: i}))
+	}
+	require.Eventually(t, func() bool {
+		handled := make(map[int64]bool)
+		for _, id := range rec.runIDs() {
+			handled[id] = true
+		}
+		return assert.ObjectsAreEqual(want, handled)
+	}, 10*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool { return admin.committedAll(4) }, 5*time.Second, 10*time.Millisecond)
+}
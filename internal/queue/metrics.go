@@ -0,0 +1,37 @@
+package queue
+
+import (
+	"time"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/metrics"
+)
+
+// Queue metrics, declared on metrics.Default.
+var (
+	publishDuration = metrics.Default.NewHistogram("canopy_queue_publish_duration_seconds",
+		"Time taken to publish a work request, by result.", metrics.DefaultBuckets, "result")
+	consumeDelay = metrics.Default.NewHistogram("canopy_queue_consume_delay_seconds",
+		"Time from the completion of a workflow run to a worker receiving its work request.", metrics.DefaultBuckets)
+)
+
+// ObservePublish records a publish that started at start and returned err.
+func ObservePublish(start time.Time, err error) {
+	publishDuration.Observe(time.Since(start).Seconds(), result(err))
+}
+
+// ObserveConsume records a worker receiving req at now. Requests without a
+// completion time aren't recorded.
+func ObserveConsume(req *WorkRequest, now time.Time) {
+	if req.RunCompletedAt.IsZero() {
+		return
+	}
+	consumeDelay.Observe(max(now.Sub(req.RunCompletedAt).Seconds(), 0))
+}
+
+// result is the result label of an operation that returned err.
+func result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
@@ -0,0 +1,30 @@
+package queue
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObservePublish(t *testing.T) {
+	successes, failures := publishDuration.Count("success"), publishDuration.Count("error")
+
+	ObservePublish(time.Now(), nil)
+	ObservePublish(time.Now(), errors.New("unavailable"))
+	assert.Equal(t, successes+1, publishDuration.Count("success"))
+	assert.Equal(t, failures+1, publishDuration.Count("error"))
+}
+
+func TestObserveConsume(t *testing.T) {
+	now := time.Date(2026, 1, 15, 10, 30, 0, 0, time.UTC)
+	consumed := consumeDelay.Count()
+
+	ObserveConsume(&WorkRequest{Org: "acme", Repo: "widgets", WorkflowRunID: 1, RunCompletedAt: now.Add(-time.Minute)}, now)
+	assert.Equal(t, consumed+1, consumeDelay.Count())
+
+	// Requests without a completion time have no delay to record
+	ObserveConsume(&WorkRequest{Org: "acme", Repo: "widgets", WorkflowRunID: 2}, now)
+	assert.Equal(t, consumed+1, consumeDelay.Count())
+}
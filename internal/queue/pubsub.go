@@ -3,13 +3,22 @@ package queue
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"sync"
 	"time"
 
 	"cloud.google.com/go/pubsub"
 )
 
 // PubSubQueue implements MessageQueue using Google Cloud Pub/Sub.
+// With MaxDeliveries set, messages whose handler fails on their last
+// delivery, and malformed messages, are published to a dead-letter topic;
+// the subscription's dead-letter policy also forwards messages that are
+// never acknowledged, e.g. because the worker crashes handling them.
 type PubSubQueue struct {
 	client       *pubsub.Client
 	topic        *pubsub.Topic
@@ -17,6 +26,14 @@ type PubSubQueue struct {
 	projectID    string
 	topicName    string
 	subName      string
+	// concurrency is how many messages Subscribe handles at once
+	concurrency int
+
+	maxDeliveries int
+	// deadLetterTopic and deadLetterSub are nil without MaxDeliveries
+	deadLetterTopic *pubsub.Topic
+	deadLetterSub   *pubsub.Subscription
+	logger          *slog.Logger
 }
 
 // PubSubConfig holds configuration for creating a PubSubQueue.
@@ -32,8 +49,31 @@ type PubSubConfig struct {
 
 	// CreateIfNotExists creates the topic and subscription if they don't exist
 	CreateIfNotExists bool
+
+	// MaxDeliveries is how many times a message is delivered before it is
+	// moved to the dead-letter topic; Pub/Sub allows 5 to 100. Zero disables
+	// dead-lettering, retrying messages until they expire.
+	MaxDeliveries int
+
+	// DeadLetterTopicName is the topic exhausted and malformed messages are
+	// published to (default: TopicName + "-dead-letter")
+	DeadLetterTopicName string
+
+	// DeadLetterSubscriptionName is the subscription of the dead-letter topic
+	// dead letters are inspected and replayed from (default:
+	// SubscriptionName + "-dead-letter")
+	DeadLetterSubscriptionName string
+
+	// Logger logs failed and dead-lettered messages (default: slog.Default())
+	Logger *slog.Logger
 }
 
+// Limits Pub/Sub places on a dead-letter policy's maximum delivery attempts.
+const (
+	minPubSubDeliveries = 5
+	maxPubSubDeliveries = 100
+)
+
 // NewPubSubQueue creates a new PubSubQueue instance.
 // The caller is responsible for calling Close() when done.
 func NewPubSubQueue(ctx context.Context, cfg PubSubConfig) (*PubSubQueue, error) {
@@ -46,6 +86,18 @@ func NewPubSubQueue(ctx context.Context, cfg PubSubConfig) (*PubSubQueue, error)
 	if cfg.SubscriptionName == "" {
 		return nil, fmt.Errorf("subscription name is required")
 	}
+	if cfg.MaxDeliveries != 0 && (cfg.MaxDeliveries < minPubSubDeliveries || cfg.MaxDeliveries > maxPubSubDeliveries) {
+		return nil, fmt.Errorf("max deliveries must be between %d and %d", minPubSubDeliveries, maxPubSubDeliveries)
+	}
+	if cfg.DeadLetterTopicName == "" {
+		cfg.DeadLetterTopicName = cfg.TopicName + "-dead-letter"
+	}
+	if cfg.DeadLetterSubscriptionName == "" {
+		cfg.DeadLetterSubscriptionName = cfg.SubscriptionName + "-dead-letter"
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
 
 	client, err := pubsub.NewClient(ctx, cfg.ProjectID)
 	if err != nil {
@@ -54,6 +106,12 @@ func NewPubSubQueue(ctx context.Context, cfg PubSubConfig) (*PubSubQueue, error)
 
 	topic := client.Topic(cfg.TopicName)
 	sub := client.Subscription(cfg.SubscriptionName)
+	var deadLetterTopic *pubsub.Topic
+	var deadLetterSub *pubsub.Subscription
+	if cfg.MaxDeliveries > 0 {
+		deadLetterTopic = client.Topic(cfg.DeadLetterTopicName)
+		deadLetterSub = client.Subscription(cfg.DeadLetterSubscriptionName)
+	}
 
 	// Optionally create topic and subscription if they don't exist
 	if cfg.CreateIfNotExists {
@@ -77,28 +135,98 @@ func NewPubSubQueue(ctx context.Context, cfg PubSubConfig) (*PubSubQueue, error)
 			client.Close()
 			return nil, fmt.Errorf("failed to check subscription existence: %w", err)
 		}
+		// The dead-letter topic must exist before a policy can refer to it
+		var policy *pubsub.DeadLetterPolicy
+		if deadLetterTopic != nil {
+			deadLetterTopic, deadLetterSub, err = createDeadLetterTopic(ctx, client, deadLetterTopic, deadLetterSub)
+			if err != nil {
+				client.Close()
+				return nil, err
+			}
+			policy = &pubsub.DeadLetterPolicy{DeadLetterTopic: deadLetterTopic.String(), MaxDeliveryAttempts: cfg.MaxDeliveries}
+		}
+
 		if !exists {
 			sub, err = client.CreateSubscription(ctx, cfg.SubscriptionName, pubsub.SubscriptionConfig{
-				Topic:       topic,
-				AckDeadline: 60 * time.Second, // 60 seconds to process message
+				Topic:            topic,
+				AckDeadline:      60 * time.Second, // 60 seconds to process message
+				DeadLetterPolicy: policy,
 			})
 			if err != nil {
 				client.Close()
 				return nil, fmt.Errorf("failed to create subscription: %w", err)
 			}
+		} else if policy != nil {
+			if err := updateDeadLetterPolicy(ctx, sub, policy); err != nil {
+				client.Close()
+				return nil, err
+			}
 		}
 	}
 
 	return &PubSubQueue{
-		client:       client,
-		topic:        topic,
-		subscription: sub,
-		projectID:    cfg.ProjectID,
-		topicName:    cfg.TopicName,
-		subName:      cfg.SubscriptionName,
+		client:          client,
+		topic:           topic,
+		subscription:    sub,
+		projectID:       cfg.ProjectID,
+		topicName:       cfg.TopicName,
+		subName:         cfg.SubscriptionName,
+		concurrency:     10,
+		maxDeliveries:   cfg.MaxDeliveries,
+		deadLetterTopic: deadLetterTopic,
+		deadLetterSub:   deadLetterSub,
+		logger:          cfg.Logger,
 	}, nil
 }
 
+// createDeadLetterTopic creates the dead-letter topic and its subscription
+// if they don't exist. Without a subscription, Pub/Sub would drop the
+// messages forwarded to the topic.
+func createDeadLetterTopic(ctx context.Context, client *pubsub.Client, topic *pubsub.Topic, sub *pubsub.Subscription) (*pubsub.Topic, *pubsub.Subscription, error) {
+	exists, err := topic.Exists(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to check dead-letter topic existence: %w", err)
+	}
+	if !exists {
+		topic, err = client.CreateTopic(ctx, topic.ID())
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create dead-letter topic: %w", err)
+		}
+	}
+
+	exists, err = sub.Exists(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to check dead-letter subscription existence: %w", err)
+	}
+	if !exists {
+		sub, err = client.CreateSubscription(ctx, sub.ID(), pubsub.SubscriptionConfig{
+			Topic:             topic,
+			AckDeadline:       60 * time.Second,
+			RetentionDuration: 7 * 24 * time.Hour, // the longest Pub/Sub retains messages
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create dead-letter subscription: %w", err)
+		}
+	}
+	return topic, sub, nil
+}
+
+// updateDeadLetterPolicy sets the dead-letter policy of an existing
+// subscription, unless it already has it.
+func updateDeadLetterPolicy(ctx context.Context, sub *pubsub.Subscription, policy *pubsub.DeadLetterPolicy) error {
+	cfg, err := sub.Config(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get subscription config: %w", err)
+	}
+	if cfg.DeadLetterPolicy != nil && *cfg.DeadLetterPolicy == *policy {
+		return nil
+	}
+	if _, err := sub.Update(ctx, pubsub.SubscriptionConfigToUpdate{DeadLetterPolicy: policy}); err != nil {
+		return fmt.Errorf("failed to set dead-letter policy: %w", err)
+	}
+	return nil
+}
+
 // Publish sends a WorkRequest message to the Pub/Sub topic.
 func (q *PubSubQueue) Publish(ctx context.Context, req *WorkRequest) error {
 	if req == nil {
@@ -138,7 +266,7 @@ func (q *PubSubQueue) Subscribe(ctx context.Context, handler func(context.Contex
 	}
 
 	// Configure subscription receive settings
-	q.subscription.ReceiveSettings.MaxOutstandingMessages = 10
+	q.subscription.ReceiveSettings.MaxOutstandingMessages = q.concurrency
 	q.subscription.ReceiveSettings.NumGoroutines = 4
 
 	// Start receiving messages
@@ -146,17 +274,31 @@ func (q *PubSubQueue) Subscribe(ctx context.Context, handler func(context.Contex
 		// Parse the work request from message data
 		var req WorkRequest
 		if err := json.Unmarshal(msg.Data, &req); err != nil {
-			// Invalid message format - nack and log error
-			msg.Nack()
-			// In production, you'd want to log this error
+			// Invalid message format - dead-letter it, or nack it without a
+			// dead-letter topic
+			q.deadLetter(ctx, msg, fmt.Sprintf("failed to unmarshal work request: %v", err))
 			return
 		}
 
-		// Call the handler to process the message
-		if err := handler(ctx, &req); err != nil {
-			// Processing failed - nack the message for retry
+		// Call the handler to process the message; attempts are only
+		// counted with a dead-letter policy
+		handlerCtx := ctx
+		if q.maxDeliveries > 0 {
+			handlerCtx = WithDelivery(ctx, Delivery{Attempt: deliveryAttempt(msg), MaxAttempts: q.maxDeliveries})
+		}
+		if err := handler(handlerCtx, &req); err != nil {
+			// Processing failed - nack the message for retry, unless this
+			// was its last delivery. Pub/Sub counts declined deliveries
+			// too, but they aren't dead-lettered here
+			if q.maxDeliveries > 0 && deliveryAttempt(msg) >= q.maxDeliveries && !errors.Is(err, ErrDeclined) {
+				q.deadLetter(ctx, msg, err.Error())
+				return
+			}
 			msg.Nack()
-			// In production, you'd want to log this error
+			if !errors.Is(err, ErrDeclined) {
+				q.logger.WarnContext(ctx, "failed to process pub/sub message, retrying",
+					"message_id", msg.ID, "attempt", deliveryAttempt(msg), "error", err)
+			}
 			return
 		}
 
@@ -171,10 +313,198 @@ func (q *PubSubQueue) Subscribe(ctx context.Context, handler func(context.Contex
 	return nil
 }
 
+// Attributes of messages published to the dead-letter topic.
+const (
+	attrReason     = "canopy_dead_letter_reason"
+	attrDeliveries = "canopy_deliveries"
+	attrMessageID  = "canopy_message_id"
+	// attrSourceDeliveries is set by Pub/Sub on messages its dead-letter
+	// policy forwards
+	attrSourceDeliveries = "CloudPubSubDeadLetterSourceDeliveryCount"
+)
+
+// deliveryAttempt returns the delivery attempt of a message, or 0 if the
+// subscription has no dead-letter policy to count attempts.
+func deliveryAttempt(msg *pubsub.Message) int {
+	if msg.DeliveryAttempt == nil {
+		return 0
+	}
+	return *msg.DeliveryAttempt
+}
+
+// deadLetter publishes a message to the dead-letter topic with the reason,
+// then acknowledges it. Without a dead-letter topic, or if publishing fails,
+// the message is nacked.
+func (q *PubSubQueue) deadLetter(ctx context.Context, msg *pubsub.Message, reason string) {
+	attrs := []any{"message_id", msg.ID, "attempt", deliveryAttempt(msg), "reason", reason}
+	if q.deadLetterTopic == nil {
+		q.logger.WarnContext(ctx, "failed to process pub/sub message, retrying", attrs...)
+		msg.Nack()
+		return
+	}
+
+	attributes := make(map[string]string, len(msg.Attributes)+3)
+	for k, v := range msg.Attributes {
+		attributes[k] = v
+	}
+	attributes[attrReason] = reason
+	attributes[attrDeliveries] = strconv.Itoa(deliveryAttempt(msg))
+	attributes[attrMessageID] = msg.ID
+	if _, err := q.deadLetterTopic.Publish(ctx, &pubsub.Message{Data: msg.Data, Attributes: attributes}).Get(ctx); err != nil {
+		q.logger.ErrorContext(ctx, "failed to move pub/sub message to dead-letter topic", append(attrs, "error", err)...)
+		msg.Nack()
+		return
+	}
+	q.logger.WarnContext(ctx, "moved pub/sub message to dead-letter topic", attrs...)
+	msg.Ack()
+}
+
+// DeadLetters implements DeadLetterQueue by receiving messages of the
+// dead-letter subscription and nacking them, so they stay in it.
+func (q *PubSubQueue) DeadLetters(ctx context.Context, limit int) ([]DeadLetter, error) {
+	seen := make(map[string]bool)
+	var letters []DeadLetter
+	err := q.receiveDeadLetters(ctx, func(msg *pubsub.Message) bool {
+		msg.Nack()
+		if len(letters) < limit && !seen[msg.ID] {
+			// Nacked messages are redelivered while receiving
+			seen[msg.ID] = true
+			letters = append(letters, pubsubDeadLetter(msg))
+		}
+		return len(letters) >= limit
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(letters, func(i, j int) bool { return letters[i].DeadLetteredAt.Before(letters[j].DeadLetteredAt) })
+	return letters, nil
+}
+
+// ReplayDeadLetter implements DeadLetterQueue. The dead letter is
+// acknowledged once its work request was published to the topic.
+func (q *PubSubQueue) ReplayDeadLetter(ctx context.Context, id string) error {
+	return q.takeDeadLetter(ctx, id, func(letter *DeadLetter) error {
+		req, err := letter.replayable()
+		if err != nil {
+			return err
+		}
+		return q.Publish(ctx, req)
+	})
+}
+
+// DiscardDeadLetter implements DeadLetterQueue by acknowledging the dead letter.
+func (q *PubSubQueue) DiscardDeadLetter(ctx context.Context, id string) error {
+	return q.takeDeadLetter(ctx, id, func(*DeadLetter) error { return nil })
+}
+
+// takeDeadLetter receives dead letters until it finds the one with the
+// given ID, acknowledging it if fn succeeds. Other dead letters are nacked.
+func (q *PubSubQueue) takeDeadLetter(ctx context.Context, id string, fn func(*DeadLetter) error) error {
+	found := false
+	var fnErr error
+	err := q.receiveDeadLetters(ctx, func(msg *pubsub.Message) bool {
+		if msg.ID != id {
+			msg.Nack()
+			return false
+		}
+		letter := pubsubDeadLetter(msg)
+		if fnErr = fn(&letter); fnErr != nil {
+			msg.Nack()
+		} else {
+			msg.Ack()
+		}
+		found = true
+		return true
+	})
+	switch {
+	case err != nil:
+		return err
+	case !found:
+		return fmt.Errorf("%w: %s", ErrDeadLetterNotFound, id)
+	}
+	return fnErr
+}
+
+// deadLetterIdle is how long receiving dead letters waits for another one
+// before concluding it has seen them all.
+var deadLetterIdle = 5 * time.Second
+
+// receiveDeadLetters receives messages of the dead-letter subscription,
+// one at a time, until fn returns true or none arrives for deadLetterIdle.
+// fn must acknowledge or nack each message.
+func (q *PubSubQueue) receiveDeadLetters(ctx context.Context, fn func(*pubsub.Message) bool) error {
+	if q.deadLetterSub == nil {
+		return fmt.Errorf("dead-lettering is disabled; set max deliveries to enable it")
+	}
+
+	receiveCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	received := make(chan struct{}, 1)
+	go func() {
+		timer := time.NewTimer(deadLetterIdle)
+		defer timer.Stop()
+		for {
+			select {
+			case <-receiveCtx.Done():
+				return
+			case <-received:
+				timer.Reset(deadLetterIdle)
+			case <-timer.C:
+				cancel()
+				return
+			}
+		}
+	}()
+
+	q.deadLetterSub.ReceiveSettings.NumGoroutines = 1
+	q.deadLetterSub.ReceiveSettings.MaxOutstandingMessages = 1
+	var mu sync.Mutex
+	err := q.deadLetterSub.Receive(receiveCtx, func(_ context.Context, msg *pubsub.Message) {
+		select {
+		case received <- struct{}{}:
+		default:
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if receiveCtx.Err() != nil {
+			msg.Nack()
+			return
+		}
+		if fn(msg) {
+			cancel()
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to receive dead letters: %w", err)
+	}
+	return ctx.Err()
+}
+
+// pubsubDeadLetter builds a DeadLetter from a message of the dead-letter
+// topic, published by deadLetter or forwarded by the dead-letter policy.
+func pubsubDeadLetter(msg *pubsub.Message) DeadLetter {
+	reason := msg.Attributes[attrReason]
+	deliveries, _ := strconv.ParseInt(msg.Attributes[attrDeliveries], 10, 64)
+	if reason == "" {
+		reason = "not acknowledged within the maximum delivery attempts"
+		deliveries, _ = strconv.ParseInt(msg.Attributes[attrSourceDeliveries], 10, 64)
+	}
+	return newDeadLetter(msg.ID, string(msg.Data), reason, deliveries, msg.PublishTime)
+}
+
+// SetConcurrency sets how many messages Subscribe handles at once
+// (default: 10).
+func (q *PubSubQueue) SetConcurrency(n int) {
+	q.concurrency = max(n, 1)
+}
+
 // Close releases resources held by the PubSubQueue.
 func (q *PubSubQueue) Close() error {
 	// Stop the topic from accepting new messages
 	q.topic.Stop()
+	if q.deadLetterTopic != nil {
+		q.deadLetterTopic.Stop()
+	}
 
 	// Close the client
 	return q.client.Close()
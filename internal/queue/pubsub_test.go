@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"cloud.google.com/go/pubsub"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -42,6 +43,16 @@ func TestPubSubConfig_Validation(t *testing.T) {
 			},
 			wantErr: "subscription name is required",
 		},
+		{
+			name: "max deliveries below the Pub/Sub minimum",
+			config: PubSubConfig{
+				ProjectID:        "test-project",
+				TopicName:        "test-topic",
+				SubscriptionName: "test-sub",
+				MaxDeliveries:    3,
+			},
+			wantErr: "max deliveries must be between 5 and 100",
+		},
 	}
 
 	for _, tt := range tests {
@@ -80,6 +91,36 @@ func TestPubSubQueue_SubscribeValidation(t *testing.T) {
 	})
 }
 
+func TestPubSubDeadLetter(t *testing.T) {
+	publishTime := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	data := []byte(`{"org":"acme","repo":"widgets","workflow_run_id":7}`)
+
+	t.Run("dead-lettered by the queue", func(t *testing.T) {
+		letter := pubsubDeadLetter(&pubsub.Message{
+			ID:          "42",
+			Data:        data,
+			PublishTime: publishTime,
+			Attributes:  map[string]string{attrReason: "GitHub is down", attrDeliveries: "5", attrMessageID: "7"},
+		})
+		assert.Equal(t, "42", letter.ID)
+		assert.Equal(t, "GitHub is down", letter.Reason)
+		assert.Equal(t, int64(5), letter.Deliveries)
+		assert.Equal(t, publishTime, letter.DeadLetteredAt)
+		require.NotNil(t, letter.Request)
+		assert.Equal(t, int64(7), letter.Request.WorkflowRunID)
+	})
+
+	t.Run("forwarded by the dead-letter policy", func(t *testing.T) {
+		letter := pubsubDeadLetter(&pubsub.Message{
+			ID:         "43",
+			Data:       data,
+			Attributes: map[string]string{attrSourceDeliveries: "6"},
+		})
+		assert.Equal(t, "not acknowledged within the maximum delivery attempts", letter.Reason)
+		assert.Equal(t, int64(6), letter.Deliveries)
+	})
+}
+
 func TestWorkRequest_Serialization(t *testing.T) {
 	req := &WorkRequest{
 		Org:           "test-org",
@@ -3,7 +3,10 @@ package queue
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"strconv"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -11,11 +14,17 @@ import (
 
 // RedisQueue implements MessageQueue using Redis Streams.
 // It uses consumer groups for reliable message processing with acknowledgment.
+// Messages whose handler fails stay pending and are delivered again after
+// RetryAfter; after MaxDeliveries they are moved to a dead-letter stream.
 type RedisQueue struct {
-	client        *redis.Client
-	streamKey     string
-	consumerGroup string
-	consumerName  string
+	client           *redis.Client
+	streamKey        string
+	consumerGroup    string
+	consumerName     string
+	deadLetterStream string
+	maxDeliveries    int64
+	retryAfter       time.Duration
+	logger           *slog.Logger
 }
 
 // RedisConfig holds configuration for creating a RedisQueue.
@@ -40,6 +49,22 @@ type RedisConfig struct {
 
 	// CreateIfNotExists creates the stream and consumer group if they don't exist
 	CreateIfNotExists bool
+
+	// MaxDeliveries is how many times a message is delivered before it is
+	// moved to the dead-letter stream; zero retries it forever
+	MaxDeliveries int64
+
+	// DeadLetterStreamKey is the stream exhausted and malformed messages are
+	// moved to (default: StreamKey + ":dead-letter")
+	DeadLetterStreamKey string
+
+	// RetryAfter is how long a delivered message stays unacknowledged before
+	// it is delivered again, to any consumer of the group (default: 5m). It
+	// must exceed the time a handler takes, or messages are handled twice.
+	RetryAfter time.Duration
+
+	// Logger logs read errors and failed messages (default: slog.Default())
+	Logger *slog.Logger
 }
 
 // NewRedisQueue creates a new RedisQueue instance.
@@ -57,6 +82,18 @@ func NewRedisQueue(ctx context.Context, cfg RedisConfig) (*RedisQueue, error) {
 	if cfg.ConsumerName == "" {
 		return nil, fmt.Errorf("consumer name is required")
 	}
+	if cfg.MaxDeliveries < 0 {
+		return nil, fmt.Errorf("max deliveries must not be negative")
+	}
+	if cfg.DeadLetterStreamKey == "" {
+		cfg.DeadLetterStreamKey = cfg.StreamKey + ":dead-letter"
+	}
+	if cfg.RetryAfter <= 0 {
+		cfg.RetryAfter = 5 * time.Minute
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
 
 	client := redis.NewClient(&redis.Options{
 		Addr:     cfg.Address,
@@ -70,10 +107,14 @@ func NewRedisQueue(ctx context.Context, cfg RedisConfig) (*RedisQueue, error) {
 	}
 
 	q := &RedisQueue{
-		client:        client,
-		streamKey:     cfg.StreamKey,
-		consumerGroup: cfg.ConsumerGroup,
-		consumerName:  cfg.ConsumerName,
+		client:           client,
+		streamKey:        cfg.StreamKey,
+		consumerGroup:    cfg.ConsumerGroup,
+		consumerName:     cfg.ConsumerName,
+		deadLetterStream: cfg.DeadLetterStreamKey,
+		maxDeliveries:    cfg.MaxDeliveries,
+		retryAfter:       cfg.RetryAfter,
+		logger:           cfg.Logger,
 	}
 
 	// Optionally create consumer group if it doesn't exist
@@ -101,9 +142,18 @@ func (q *RedisQueue) Publish(ctx context.Context, req *WorkRequest) error {
 		return fmt.Errorf("failed to marshal work request: %w", err)
 	}
 
-	// Add message to the stream
-	// The "*" argument tells Redis to auto-generate a message ID
-	args := &redis.XAddArgs{
+	_, err = q.client.XAdd(ctx, q.publishArgs(req, data)).Result()
+	if err != nil {
+		return fmt.Errorf("failed to publish message to redis stream: %w", err)
+	}
+
+	return nil
+}
+
+// publishArgs returns the XADD arguments adding a serialized work request to
+// the stream. The "*" ID tells Redis to auto-generate a message ID.
+func (q *RedisQueue) publishArgs(req *WorkRequest, data []byte) *redis.XAddArgs {
+	return &redis.XAddArgs{
 		Stream: q.streamKey,
 		Values: map[string]interface{}{
 			"data": string(data),
@@ -111,17 +161,12 @@ func (q *RedisQueue) Publish(ctx context.Context, req *WorkRequest) error {
 			"repo": req.Repo,
 		},
 	}
-
-	_, err = q.client.XAdd(ctx, args).Result()
-	if err != nil {
-		return fmt.Errorf("failed to publish message to redis stream: %w", err)
-	}
-
-	return nil
 }
 
 // Subscribe starts consuming messages from the Redis stream using a consumer group.
-// It calls the handler function for each received message.
+// It calls the handler function for each received message. Messages left
+// unacknowledged for RetryAfter, because their handler failed or their
+// consumer stopped, are claimed and delivered again.
 // This method blocks until the context is cancelled or an error occurs.
 func (q *RedisQueue) Subscribe(ctx context.Context, handler func(context.Context, *WorkRequest) error) error {
 	if handler == nil {
@@ -137,6 +182,22 @@ func (q *RedisQueue) Subscribe(ctx context.Context, handler func(context.Context
 			// Continue processing
 		}
 
+		// Deliver failed messages again before reading new ones
+		claimed, err := q.claimPending(ctx)
+		if err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		for _, c := range claimed {
+			if ctx.Err() != nil {
+				// Messages not handled yet stay pending for another consumer
+				return ctx.Err()
+			}
+			// Errors leave the message pending
+			if err := q.processMessage(ctx, c.message, c.deliveries, handler); err != nil {
+				q.logFailure(ctx, c.message, c.deliveries, err)
+			}
+		}
+
 		// Read messages from the consumer group
 		// ">" means to receive only new messages that were never delivered to any other consumer
 		streams, err := q.client.XReadGroup(ctx, &redis.XReadGroupArgs{
@@ -156,16 +217,20 @@ func (q *RedisQueue) Subscribe(ctx context.Context, handler func(context.Context
 				return err
 			}
 			// For other errors, log and continue
-			// In production, you'd want to log this error
+			q.logger.ErrorContext(ctx, "failed to read redis stream", "stream", q.streamKey, "error", err)
 			continue
 		}
 
 		// Process each message
 		for _, stream := range streams {
 			for _, message := range stream.Messages {
-				if err := q.processMessage(ctx, message, handler); err != nil {
+				if ctx.Err() != nil {
+					// Messages not handled yet stay pending for another consumer
+					return ctx.Err()
+				}
+				if err := q.processMessage(ctx, message, 1, handler); err != nil {
 					// Error processing message, but continue with others
-					// In production, you'd want to log this error
+					q.logFailure(ctx, message, 1, err)
 					continue
 				}
 			}
@@ -173,38 +238,213 @@ func (q *RedisQueue) Subscribe(ctx context.Context, handler func(context.Context
 	}
 }
 
-// processMessage handles a single message from the stream.
-func (q *RedisQueue) processMessage(ctx context.Context, msg redis.XMessage, handler func(context.Context, *WorkRequest) error) error {
+// logFailure logs a message left pending because processing it failed.
+func (q *RedisQueue) logFailure(ctx context.Context, msg redis.XMessage, deliveries int64, err error) {
+	q.logger.WarnContext(ctx, "failed to process redis message, retrying",
+		"message_id", msg.ID, "attempt", deliveries, "retry_after", q.retryAfter.String(), "error", err)
+}
+
+// claimedMessage is a pending message claimed for another delivery.
+type claimedMessage struct {
+	message    redis.XMessage
+	deliveries int64
+}
+
+// claimPending claims messages pending for longer than RetryAfter
+// (XAUTOCLAIM) and looks up how many times each was delivered (XPENDING).
+func (q *RedisQueue) claimPending(ctx context.Context) ([]claimedMessage, error) {
+	messages, _, err := q.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   q.streamKey,
+		Group:    q.consumerGroup,
+		Consumer: q.consumerName,
+		MinIdle:  q.retryAfter,
+		Start:    "0-0",
+		Count:    10,
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim pending messages: %w", err)
+	}
+	if len(messages) == 0 {
+		return nil, nil
+	}
+
+	pending, err := q.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream:   q.streamKey,
+		Group:    q.consumerGroup,
+		Start:    messages[0].ID,
+		End:      messages[len(messages)-1].ID,
+		Count:    int64(len(messages)),
+		Consumer: q.consumerName,
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending messages: %w", err)
+	}
+	deliveries := make(map[string]int64, len(pending))
+	for _, p := range pending {
+		deliveries[p.ID] = p.RetryCount
+	}
+
+	claimed := make([]claimedMessage, len(messages))
+	for i, m := range messages {
+		claimed[i] = claimedMessage{message: m, deliveries: deliveries[m.ID]}
+	}
+	return claimed, nil
+}
+
+// processMessage handles a single message from the stream, delivered for
+// the given time. Malformed messages, and messages whose handler failed on
+// their last allowed delivery, are moved to the dead-letter stream.
+func (q *RedisQueue) processMessage(ctx context.Context, msg redis.XMessage, deliveries int64, handler func(context.Context, *WorkRequest) error) error {
 	// Extract the message data
 	dataStr, ok := msg.Values["data"].(string)
 	if !ok {
-		// Invalid message format - acknowledge it to remove from pending
-		_ = q.client.XAck(ctx, q.streamKey, q.consumerGroup, msg.ID)
-		return fmt.Errorf("message data field is not a string")
+		// Invalid message format - move it out of pending
+		return q.deadLetter(ctx, msg, "message data field is not a string", deliveries)
 	}
 
 	// Parse the work request
 	var req WorkRequest
 	if err := json.Unmarshal([]byte(dataStr), &req); err != nil {
-		// Invalid JSON - acknowledge it to remove from pending
-		_ = q.client.XAck(ctx, q.streamKey, q.consumerGroup, msg.ID)
-		return fmt.Errorf("failed to unmarshal work request: %w", err)
+		// Invalid JSON - move it out of pending
+		return q.deadLetter(ctx, msg, fmt.Sprintf("failed to unmarshal work request: %v", err), deliveries)
+	}
+
+	if q.maxDeliveries > 0 && deliveries > q.maxDeliveries {
+		// The handler never finished, e.g. the worker crashed processing it
+		return q.deadLetter(ctx, msg, fmt.Sprintf("not acknowledged after %d deliveries", q.maxDeliveries), deliveries)
 	}
 
 	// Call the handler to process the message
-	if err := handler(ctx, &req); err != nil {
+	delivery := Delivery{Attempt: int(deliveries), MaxAttempts: int(q.maxDeliveries)}
+	if err := handler(WithDelivery(ctx, delivery), &req); err != nil {
+		if errors.Is(err, ErrDeclined) {
+			return q.release(ctx, msg, deliveries)
+		}
+		if delivery.Last() {
+			return q.deadLetter(ctx, msg, err.Error(), deliveries)
+		}
 		// Processing failed - don't acknowledge, message will be retried
 		return fmt.Errorf("handler failed to process message: %w", err)
 	}
 
-	// Processing succeeded - acknowledge the message
-	if err := q.client.XAck(ctx, q.streamKey, q.consumerGroup, msg.ID).Err(); err != nil {
+	// Processing succeeded - acknowledge the message, even if the consumer
+	// is stopping, so it isn't processed again
+	if err := q.client.XAck(context.WithoutCancel(ctx), q.streamKey, q.consumerGroup, msg.ID).Err(); err != nil {
 		return fmt.Errorf("failed to acknowledge message: %w", err)
 	}
 
 	return nil
 }
 
+// release returns a declined message to the group without counting its
+// delivery: XCLAIM resets its delivery count and makes it idle for
+// RetryAfter, so any consumer claims it right away.
+func (q *RedisQueue) release(ctx context.Context, msg redis.XMessage, deliveries int64) error {
+	err := q.client.Do(context.WithoutCancel(ctx), "XCLAIM", q.streamKey, q.consumerGroup, q.consumerName, 0, msg.ID,
+		"IDLE", q.retryAfter.Milliseconds(), "RETRYCOUNT", max(deliveries-1, 0), "JUSTID").Err()
+	if err != nil {
+		return fmt.Errorf("failed to release declined message: %w", err)
+	}
+	return nil
+}
+
+// deadLetter moves a message to the dead-letter stream, acknowledging it in
+// the same transaction.
+func (q *RedisQueue) deadLetter(ctx context.Context, msg redis.XMessage, reason string, deliveries int64) error {
+	_, err := q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: q.deadLetterStream,
+			Values: map[string]interface{}{
+				"data":       fmt.Sprint(msg.Values["data"]),
+				"message_id": msg.ID,
+				"reason":     reason,
+				"deliveries": deliveries,
+			},
+		})
+		pipe.XAck(ctx, q.streamKey, q.consumerGroup, msg.ID)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to move message to dead-letter stream: %w", err)
+	}
+	return nil
+}
+
+// DeadLetters implements DeadLetterQueue with the entries of the
+// dead-letter stream (XRANGE).
+func (q *RedisQueue) DeadLetters(ctx context.Context, limit int) ([]DeadLetter, error) {
+	messages, err := q.client.XRangeN(ctx, q.deadLetterStream, "-", "+", int64(limit)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dead-letter stream: %w", err)
+	}
+	letters := make([]DeadLetter, len(messages))
+	for i, m := range messages {
+		letters[i] = redisDeadLetter(m)
+	}
+	return letters, nil
+}
+
+// ReplayDeadLetter implements DeadLetterQueue. The work request is added to
+// the stream and the entry deleted from the dead-letter stream in one
+// transaction.
+func (q *RedisQueue) ReplayDeadLetter(ctx context.Context, id string) error {
+	letter, err := q.deadLetterEntry(ctx, id)
+	if err != nil {
+		return err
+	}
+	req, err := letter.replayable()
+	if err != nil {
+		return err
+	}
+
+	_, err = q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAdd(ctx, q.publishArgs(req, []byte(letter.Data)))
+		pipe.XDel(ctx, q.deadLetterStream, id)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to replay dead letter %s: %w", id, err)
+	}
+	return nil
+}
+
+// DiscardDeadLetter implements DeadLetterQueue.
+func (q *RedisQueue) DiscardDeadLetter(ctx context.Context, id string) error {
+	deleted, err := q.client.XDel(ctx, q.deadLetterStream, id).Result()
+	if err != nil {
+		return fmt.Errorf("failed to discard dead letter %s: %w", id, err)
+	}
+	if deleted == 0 {
+		return fmt.Errorf("%w: %s", ErrDeadLetterNotFound, id)
+	}
+	return nil
+}
+
+// deadLetterEntry reads a single entry of the dead-letter stream.
+func (q *RedisQueue) deadLetterEntry(ctx context.Context, id string) (*DeadLetter, error) {
+	messages, err := q.client.XRange(ctx, q.deadLetterStream, id, id).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dead letter %s: %w", id, err)
+	}
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrDeadLetterNotFound, id)
+	}
+	letter := redisDeadLetter(messages[0])
+	return &letter, nil
+}
+
+// redisDeadLetter builds a DeadLetter from an entry of the dead-letter
+// stream; it was dead-lettered at the time encoded in its ID.
+func redisDeadLetter(msg redis.XMessage) DeadLetter {
+	field := func(name string) string {
+		s, _ := msg.Values[name].(string)
+		return s
+	}
+	deliveries, _ := strconv.ParseInt(field("deliveries"), 10, 64)
+	at, _ := streamIDTime(msg.ID)
+	return newDeadLetter(msg.ID, field("data"), field("reason"), deliveries, at)
+}
+
 // Close releases resources held by the RedisQueue.
 func (q *RedisQueue) Close() error {
 	return q.client.Close()
@@ -3,10 +3,13 @@ package queue
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/alicebob/miniredis/v2"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -55,6 +58,17 @@ func TestRedisConfig_Validation(t *testing.T) {
 			},
 			wantErr: "consumer name is required",
 		},
+		{
+			name: "negative max deliveries",
+			config: RedisConfig{
+				Address:       "localhost:6379",
+				StreamKey:     "test-stream",
+				ConsumerGroup: "test-group",
+				ConsumerName:  "test-consumer",
+				MaxDeliveries: -1,
+			},
+			wantErr: "max deliveries must not be negative",
+		},
 	}
 
 	for _, tt := range tests {
@@ -157,6 +171,56 @@ func TestRedisQueue_ConnectionError(t *testing.T) {
 	})
 }
 
+func TestRedisQueue_DeclinedDelivery(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	newQueue := func(consumer string) *RedisQueue {
+		q, err := NewRedisQueue(ctx, RedisConfig{
+			Address:           server.Addr(),
+			StreamKey:         "work",
+			ConsumerGroup:     "workers",
+			ConsumerName:      consumer,
+			CreateIfNotExists: true,
+			MaxDeliveries:     1,
+			RetryAfter:        time.Minute,
+		})
+		require.NoError(t, err)
+		t.Cleanup(func() { q.Close() })
+		return q
+	}
+
+	draining := newQueue("draining")
+	req := &WorkRequest{Org: "acme", Repo: "widgets", WorkflowRunID: 1}
+	require.NoError(t, draining.Publish(ctx, req))
+
+	// A worker shutting down declines the request on its only delivery
+	subCtx, cancel := context.WithCancel(ctx)
+	err := draining.Subscribe(subCtx, func(context.Context, *WorkRequest) error {
+		cancel()
+		return fmt.Errorf("%w: worker is draining", ErrDeclined)
+	})
+	require.ErrorIs(t, err, context.Canceled)
+
+	// Another worker claims it right away; had the declined delivery been
+	// counted, it would have been dead-lettered instead
+	var processed *WorkRequest
+	subCtx, cancel = context.WithTimeout(ctx, 10*time.Second)
+	err = newQueue("running").Subscribe(subCtx, func(_ context.Context, r *WorkRequest) error {
+		defer cancel()
+		processed = r
+		return nil
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, req, processed)
+
+	letters, err := draining.DeadLetters(ctx, 10)
+	require.NoError(t, err)
+	assert.Empty(t, letters)
+	pending, err := draining.client.XPending(ctx, "work", "workers").Result()
+	require.NoError(t, err)
+	assert.Zero(t, pending.Count)
+}
+
 // Integration test (requires actual Redis or Redis container)
 // This test is skipped by default but can be enabled with integration testing
 func TestRedisQueue_Integration(t *testing.T) {
@@ -334,6 +398,49 @@ func TestRedisQueue_Integration(t *testing.T) {
 		}
 	})
 
+	t.Run("exhausted message is dead-lettered and replayed", func(t *testing.T) {
+		t.Skip("requires Redis server or container")
+
+		dlCfg := cfg
+		dlCfg.MaxDeliveries = 2
+		dlCfg.RetryAfter = 100 * time.Millisecond
+		queue, err := NewRedisQueue(ctx, dlCfg)
+		require.NoError(t, err)
+		defer queue.Close()
+
+		req := &WorkRequest{Org: "test-org", Repo: "test-repo", WorkflowRunID: 12345}
+		require.NoError(t, queue.Publish(ctx, req))
+
+		// The handler fails on both deliveries
+		var attempts atomic.Int32
+		subCtx, subCancel := context.WithCancel(ctx)
+		defer subCancel()
+		go func() {
+			_ = queue.Subscribe(subCtx, func(ctx context.Context, r *WorkRequest) error {
+				attempts.Add(1)
+				return assert.AnError
+			})
+		}()
+
+		var letters []DeadLetter
+		require.Eventually(t, func() bool {
+			letters, err = queue.DeadLetters(ctx, 10)
+			return err == nil && len(letters) == 1
+		}, 10*time.Second, 100*time.Millisecond)
+		subCancel()
+		assert.Equal(t, int32(2), attempts.Load())
+		assert.Equal(t, assert.AnError.Error(), letters[0].Reason)
+		assert.Equal(t, int64(2), letters[0].Deliveries)
+		assert.Equal(t, req, letters[0].Request)
+
+		// Replaying moves it back to the stream
+		require.NoError(t, queue.ReplayDeadLetter(ctx, letters[0].ID))
+		letters, err = queue.DeadLetters(ctx, 10)
+		require.NoError(t, err)
+		assert.Empty(t, letters)
+		assert.ErrorIs(t, queue.ReplayDeadLetter(ctx, "0-1"), ErrDeadLetterNotFound)
+	})
+
 	t.Run("concurrent publishers", func(t *testing.T) {
 		t.Skip("requires Redis server or container")
 
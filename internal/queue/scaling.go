@@ -0,0 +1,34 @@
+package queue
+
+import "fmt"
+
+// ScalingPolicy turns a backlog into a desired number of workers.
+type ScalingPolicy struct {
+	// TargetPerWorker is the number of waiting messages one worker should handle
+	TargetPerWorker int64
+	// MinWorkers and MaxWorkers bound the recommendation
+	MinWorkers int
+	MaxWorkers int
+}
+
+// Validate checks that the policy can produce recommendations.
+func (p ScalingPolicy) Validate() error {
+	if p.TargetPerWorker <= 0 {
+		return fmt.Errorf("target per worker must be positive")
+	}
+	if p.MinWorkers < 0 {
+		return fmt.Errorf("min workers must not be negative")
+	}
+	if p.MaxWorkers < p.MinWorkers || p.MaxWorkers == 0 {
+		return fmt.Errorf("max workers must be positive and at least min workers")
+	}
+	return nil
+}
+
+// DesiredWorkers returns enough workers to give each at most TargetPerWorker
+// waiting messages, clamped to [MinWorkers, MaxWorkers].
+func (p ScalingPolicy) DesiredWorkers(b *Backlog) int {
+	waiting := b.Waiting()
+	desired := int((waiting + p.TargetPerWorker - 1) / p.TargetPerWorker)
+	return min(max(desired, p.MinWorkers), p.MaxWorkers)
+}
@@ -0,0 +1,57 @@
+package queue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScalingPolicy_Validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   ScalingPolicy
+		errorMsg string
+	}{
+		{name: "valid", policy: ScalingPolicy{TargetPerWorker: 10, MinWorkers: 0, MaxWorkers: 5}},
+		{name: "zero target", policy: ScalingPolicy{MaxWorkers: 5}, errorMsg: "target per worker must be positive"},
+		{name: "negative min", policy: ScalingPolicy{TargetPerWorker: 1, MinWorkers: -1, MaxWorkers: 5}, errorMsg: "min workers must not be negative"},
+		{name: "max below min", policy: ScalingPolicy{TargetPerWorker: 1, MinWorkers: 3, MaxWorkers: 2}, errorMsg: "max workers must be positive"},
+		{name: "zero max", policy: ScalingPolicy{TargetPerWorker: 1}, errorMsg: "max workers must be positive"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Validate()
+			if tt.errorMsg == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.errorMsg)
+		})
+	}
+}
+
+func TestScalingPolicy_DesiredWorkers(t *testing.T) {
+	policy := ScalingPolicy{TargetPerWorker: 10, MinWorkers: 1, MaxWorkers: 5}
+
+	tests := []struct {
+		name     string
+		backlog  Backlog
+		expected int
+	}{
+		{name: "empty uses min", backlog: Backlog{}, expected: 1},
+		{name: "partial worker rounds up", backlog: Backlog{Undelivered: 11}, expected: 2},
+		{name: "pending counts", backlog: Backlog{Undelivered: 15, Pending: 5}, expected: 2},
+		{name: "unknown lag counts pending only", backlog: Backlog{Undelivered: -1, Pending: 25}, expected: 3},
+		{name: "capped at max", backlog: Backlog{Undelivered: 1000}, expected: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, policy.DesiredWorkers(&tt.backlog))
+		})
+	}
+
+	scaleToZero := ScalingPolicy{TargetPerWorker: 10, MaxWorkers: 5}
+	assert.Equal(t, 0, scaleToZero.DesiredWorkers(&Backlog{}))
+}
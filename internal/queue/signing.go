@@ -0,0 +1,204 @@
+package queue
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/metrics"
+)
+
+// Errors returned by Signer.Verify.
+var (
+	ErrUnsigned         = errors.New("work request is not signed")
+	ErrInvalidSignature = errors.New("work request signature is invalid")
+)
+
+// signaturePrefix starts the signatures of Signer, like GitHub's webhook
+// signatures.
+const signaturePrefix = "sha256="
+
+var rejectedRequests = metrics.Default.NewCounter("canopy_queue_rejected_requests_total",
+	"Work requests dropped by the worker because their signature is missing or invalid, by reason.", "reason")
+
+// Signer signs work requests with HMAC-SHA256 and verifies their
+// signatures, so workers only act on requests published by a service
+// holding the key rather than on anything written to the queue.
+//
+// The signature covers the fields that select what the worker processes
+// and reports on; the trace context isn't signed.
+type Signer struct {
+	keys [][]byte
+}
+
+// NewSigner creates a Signer. The first key signs requests; signatures of
+// any key are accepted, so keys can be rotated by adding the new key
+// first, then removing the old one once no request signed with it is left.
+func NewSigner(keys ...string) *Signer {
+	s := &Signer{}
+	for _, key := range keys {
+		if key != "" {
+			s.keys = append(s.keys, []byte(key))
+		}
+	}
+	return s
+}
+
+// Sign sets the signature of req.
+func (s *Signer) Sign(req *WorkRequest) error {
+	if len(s.keys) == 0 {
+		return fmt.Errorf("no signing key")
+	}
+	payload, err := signedPayload(req)
+	if err != nil {
+		return err
+	}
+	req.Signature = signaturePrefix + hex.EncodeToString(sign(s.keys[0], payload))
+	return nil
+}
+
+// Verify returns ErrUnsigned if req has no signature, or
+// ErrInvalidSignature if it isn't signed with one of the Signer's keys.
+func (s *Signer) Verify(req *WorkRequest) error {
+	if req.Signature == "" {
+		return ErrUnsigned
+	}
+	provided, err := hex.DecodeString(strings.TrimPrefix(req.Signature, signaturePrefix))
+	if err != nil || !strings.HasPrefix(req.Signature, signaturePrefix) {
+		return ErrInvalidSignature
+	}
+	payload, err := signedPayload(req)
+	if err != nil {
+		return err
+	}
+	for _, key := range s.keys {
+		if hmac.Equal(sign(key, payload), provided) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+func sign(key, payload []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// signedPayload returns the bytes a request's signature covers. They are
+// built from a fixed set of fields rather than the published message, so
+// workers can verify requests of newer schema versions (see SchemaVersion);
+// the fields versions add, such as the base of a PR, are informational and
+// not signed.
+func signedPayload(req *WorkRequest) ([]byte, error) {
+	var completedAt int64
+	if !req.RunCompletedAt.IsZero() {
+		completedAt = req.RunCompletedAt.UnixNano()
+	}
+	payload, err := json.Marshal([]any{
+		req.Org, req.Repo, req.WorkflowRunID, completedAt, req.InstallationID, req.CorrelationID,
+		req.EventType, req.CheckSuiteID, req.PullRequest, req.HeadSHA, req.HeadBranch,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode work request: %w", err)
+	}
+	return payload, nil
+}
+
+// SigningConfig configures NewSignedQueue.
+type SigningConfig struct {
+	// Keys sign published requests and verify received ones (see NewSigner)
+	Keys []string
+	// AllowUnsigned accepts received requests without a signature, while
+	// the services publishing to the queue are upgraded to sign them;
+	// requests with an invalid signature are still dropped
+	AllowUnsigned bool
+	Logger        *slog.Logger
+}
+
+// SignedQueue signs the work requests it publishes and verifies the ones
+// it receives. Requests with a missing or invalid signature are logged and
+// acknowledged without calling the handler: retrying them can't make them
+// valid.
+type SignedQueue struct {
+	MessageQueue
+	signer        *Signer
+	allowUnsigned bool
+	logger        *slog.Logger
+}
+
+// signedConcurrentQueue is a SignedQueue of a ConcurrentQueue.
+type signedConcurrentQueue struct {
+	*SignedQueue
+}
+
+// SetConcurrency implements ConcurrentQueue.
+func (q signedConcurrentQueue) SetConcurrency(n int) {
+	q.MessageQueue.(ConcurrentQueue).SetConcurrency(n)
+}
+
+// NewSignedQueue wraps q in a SignedQueue. The result is a ConcurrentQueue
+// if q is one.
+func NewSignedQueue(q MessageQueue, cfg SigningConfig) MessageQueue {
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	sq := &SignedQueue{
+		MessageQueue:  q,
+		signer:        NewSigner(cfg.Keys...),
+		allowUnsigned: cfg.AllowUnsigned,
+		logger:        logger,
+	}
+	if _, ok := q.(ConcurrentQueue); ok {
+		return signedConcurrentQueue{sq}
+	}
+	return sq
+}
+
+// Publish signs a copy of req and publishes it.
+func (q *SignedQueue) Publish(ctx context.Context, req *WorkRequest) error {
+	signed := *req
+	if err := q.signer.Sign(&signed); err != nil {
+		return fmt.Errorf("failed to sign work request: %w", err)
+	}
+	return q.MessageQueue.Publish(ctx, &signed)
+}
+
+// Backlog reports the backlog of the wrapped queue, if it implements
+// BacklogReporter.
+func (q *SignedQueue) Backlog(ctx context.Context) (*Backlog, error) {
+	reporter, ok := q.MessageQueue.(BacklogReporter)
+	if !ok {
+		return nil, fmt.Errorf("%T can't report its backlog", q.MessageQueue)
+	}
+	return reporter.Backlog(ctx)
+}
+
+// Subscribe calls handler with the received requests whose signature is
+// valid.
+func (q *SignedQueue) Subscribe(ctx context.Context, handler func(context.Context, *WorkRequest) error) error {
+	return q.MessageQueue.Subscribe(ctx, func(ctx context.Context, req *WorkRequest) error {
+		err := q.signer.Verify(req)
+		if errors.Is(err, ErrUnsigned) && q.allowUnsigned {
+			err = nil
+		}
+		if err != nil {
+			reason := "invalid"
+			if errors.Is(err, ErrUnsigned) {
+				reason = "unsigned"
+			}
+			rejectedRequests.Inc(reason)
+			q.logger.ErrorContext(ctx, "dropping work request", "error", err,
+				"org", req.Org, "repo", req.Repo, "workflow_run_id", req.WorkflowRunID, "correlation_id", req.CorrelationID)
+			return nil
+		}
+		return handler(ctx, req)
+	})
+}
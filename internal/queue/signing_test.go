@@ -0,0 +1,163 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSigner(t *testing.T) {
+	newRequest := func() *WorkRequest {
+		return &WorkRequest{
+			Org:            "test-org",
+			Repo:           "test-repo",
+			WorkflowRunID:  12345,
+			RunCompletedAt: time.Date(2024, 1, 2, 3, 4, 5, 6, time.FixedZone("CET", 3600)),
+			InstallationID: 42,
+			CorrelationID:  "delivery-1",
+			TraceContext:   map[string]string{"traceparent": "00-abc-def-01"},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		signKeys []string
+		keys     []string
+		modify   func(*WorkRequest)
+		expected error
+	}{
+		{name: "valid", signKeys: []string{"key"}, keys: []string{"key"}},
+		{name: "rotated key", signKeys: []string{"old"}, keys: []string{"new", "old"}},
+		{name: "unsigned", keys: []string{"key"}, expected: ErrUnsigned},
+		{name: "wrong key", signKeys: []string{"other"}, keys: []string{"key"}, expected: ErrInvalidSignature},
+		{
+			name:     "changed repository",
+			signKeys: []string{"key"},
+			keys:     []string{"key"},
+			modify:   func(r *WorkRequest) { r.Repo = "other-repo" },
+			expected: ErrInvalidSignature,
+		},
+		{
+			name:     "malformed signature",
+			signKeys: []string{"key"},
+			keys:     []string{"key"},
+			modify:   func(r *WorkRequest) { r.Signature = "sha256=zz" },
+			expected: ErrInvalidSignature,
+		},
+		{
+			name:     "unsigned trace context",
+			signKeys: []string{"key"},
+			keys:     []string{"key"},
+			modify:   func(r *WorkRequest) { r.TraceContext = nil },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newRequest()
+			if tt.signKeys != nil {
+				require.NoError(t, NewSigner(tt.signKeys...).Sign(req))
+				assert.Regexp(t, `^sha256=[0-9a-f]{64}$`, req.Signature)
+			}
+
+			// Requests are verified as the worker receives them
+			data, err := json.Marshal(req)
+			require.NoError(t, err)
+			var received WorkRequest
+			require.NoError(t, json.Unmarshal(data, &received))
+			if tt.modify != nil {
+				tt.modify(&received)
+			}
+
+			assert.ErrorIs(t, NewSigner(tt.keys...).Verify(&received), tt.expected)
+		})
+	}
+
+	t.Run("no key", func(t *testing.T) {
+		assert.Error(t, NewSigner("").Sign(newRequest()))
+	})
+}
+
+// stubConcurrentQueue is an InMemoryQueue that records SetConcurrency.
+type stubConcurrentQueue struct {
+	*InMemoryQueue
+	concurrency int
+}
+
+func (q *stubConcurrentQueue) SetConcurrency(n int) {
+	q.concurrency = n
+}
+
+func TestSignedQueue(t *testing.T) {
+	receive := func(t *testing.T, q MessageQueue) []*WorkRequest {
+		t.Helper()
+		var received []*WorkRequest
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		err := q.Subscribe(ctx, func(_ context.Context, req *WorkRequest) error {
+			received = append(received, req)
+			return nil
+		})
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		return received
+	}
+
+	t.Run("signs published and verifies received requests", func(t *testing.T) {
+		inner := NewInMemoryQueue(InMemoryConfig{})
+		q := NewSignedQueue(inner, SigningConfig{Keys: []string{"key"}})
+		req := &WorkRequest{Org: "test-org", Repo: "test-repo", WorkflowRunID: 1}
+
+		require.NoError(t, q.Publish(context.Background(), req))
+		assert.Empty(t, req.Signature, "the published request is a copy")
+		require.NoError(t, inner.Publish(context.Background(), &WorkRequest{Org: "test-org", Repo: "other-repo", WorkflowRunID: 2}))
+		require.NoError(t, inner.Publish(context.Background(), &WorkRequest{Org: "test-org", Repo: "forged", WorkflowRunID: 3, Signature: "sha256=00"}))
+
+		before := rejectedRequests.Value("unsigned")
+		received := receive(t, q)
+		require.Len(t, received, 1)
+		assert.Equal(t, int64(1), received[0].WorkflowRunID)
+		assert.NotEmpty(t, received[0].Signature)
+		assert.Equal(t, before+1, rejectedRequests.Value("unsigned"))
+	})
+
+	t.Run("allows unsigned requests", func(t *testing.T) {
+		inner := NewInMemoryQueue(InMemoryConfig{})
+		q := NewSignedQueue(inner, SigningConfig{Keys: []string{"key"}, AllowUnsigned: true})
+		require.NoError(t, inner.Publish(context.Background(), &WorkRequest{Org: "test-org", Repo: "test-repo", WorkflowRunID: 1}))
+		require.NoError(t, inner.Publish(context.Background(), &WorkRequest{Org: "test-org", Repo: "forged", WorkflowRunID: 2, Signature: "sha256=00"}))
+
+		received := receive(t, q)
+		require.Len(t, received, 1)
+		assert.Equal(t, int64(1), received[0].WorkflowRunID)
+	})
+
+	t.Run("reports the backlog", func(t *testing.T) {
+		inner := NewInMemoryQueue(InMemoryConfig{})
+		q := NewSignedQueue(inner, SigningConfig{Keys: []string{"key"}})
+		require.NoError(t, q.Publish(context.Background(), &WorkRequest{Org: "test-org", Repo: "test-repo", WorkflowRunID: 1}))
+
+		backlog, err := q.(BacklogReporter).Backlog(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), backlog.Length)
+
+		q = NewSignedQueue(struct{ MessageQueue }{inner}, SigningConfig{Keys: []string{"key"}})
+		_, err = q.(BacklogReporter).Backlog(context.Background())
+		assert.ErrorContains(t, err, "can't report its backlog")
+	})
+
+	t.Run("keeps concurrency", func(t *testing.T) {
+		inner := &stubConcurrentQueue{InMemoryQueue: NewInMemoryQueue(InMemoryConfig{})}
+		q := NewSignedQueue(inner, SigningConfig{Keys: []string{"key"}})
+		cq, ok := q.(ConcurrentQueue)
+		require.True(t, ok)
+		cq.SetConcurrency(4)
+		assert.Equal(t, 4, inner.concurrency)
+
+		_, ok = NewSignedQueue(NewInMemoryQueue(InMemoryConfig{}), SigningConfig{}).(ConcurrentQueue)
+		assert.False(t, ok)
+	})
+}
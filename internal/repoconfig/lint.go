@@ -0,0 +1,367 @@
+package repoconfig
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Issue is a problem found in a repository config.
+type Issue struct {
+	// Line and Column locate the problem (1-based); zero if unknown.
+	// YAML syntax errors only carry a line.
+	Line   int
+	Column int
+	// Key is the dotted path of the offending key, e.g. "annotations.level"
+	Key     string
+	Message string
+}
+
+// String formats the issue as "line 3, column 10: annotations.level: <message>".
+func (i Issue) String() string {
+	var b strings.Builder
+	switch {
+	case i.Line > 0 && i.Column > 0:
+		fmt.Fprintf(&b, "line %d, column %d: ", i.Line, i.Column)
+	case i.Line > 0:
+		fmt.Fprintf(&b, "line %d: ", i.Line)
+	}
+	if i.Key != "" {
+		fmt.Fprintf(&b, "%s: ", i.Key)
+	}
+	b.WriteString(i.Message)
+	return b.String()
+}
+
+// fieldKind is the YAML shape a config key must have.
+type fieldKind int
+
+const (
+	kindMapping fieldKind = iota
+	kindGlobList
+	kindEnum
+	kindNonNegativeInt
+	kindBool
+	kindPercent
+	kindPercentMap
+	kindGlob
+	kindList
+	kindFileName
+	kindString
+)
+
+// field describes a config key. Lint walks the document against this tree;
+// schema.json describes the same tree for editors and must be kept in sync.
+type field struct {
+	kind     fieldKind
+	enum     []string          // kindEnum: allowed values
+	fields   map[string]*field // kindMapping: allowed keys
+	required []string          // kindMapping: keys that must be set
+	item     *field            // kindList: the shape of each item
+}
+
+// percentField is a coverage percentage; kindPercentMap maps arbitrary
+// keys to one.
+var percentField = &field{kind: kindPercent}
+
+var rootField = &field{kind: kindMapping, fields: map[string]*field{
+	"ignore":    {kind: kindGlobList},
+	"include":   {kind: kindGlobList},
+	"artifacts": {kind: kindGlobList},
+	"workflows": {kind: kindList, item: &field{kind: kindFileName}},
+	"annotations": {kind: kindMapping, fields: map[string]*field{
+		"level":              {kind: kindEnum, enum: []string{LevelNotice, LevelWarning, LevelFailure}},
+		"summary_only":       {kind: kindBool},
+		"summary_only_above": {kind: kindNonNegativeInt},
+		"top_files":          {kind: kindNonNegativeInt},
+		"severity": {kind: kindMapping, fields: map[string]*field{
+			"exported":       {kind: kindEnum, enum: []string{LevelNotice, LevelWarning, LevelFailure}},
+			"error_handling": {kind: kindEnum, enum: []string{LevelNotice, LevelWarning, LevelFailure}},
+			"low_coverage":   {kind: kindPercent},
+		}},
+	}},
+	"comment": {kind: kindMapping, fields: map[string]*field{
+		"behavior": {kind: kindEnum, enum: []string{CommentUpdate, CommentNew, CommentOff}},
+	}},
+	"suppressions": {kind: kindMapping, fields: map[string]*field{
+		"max_age_days": {kind: kindNonNegativeInt},
+	}},
+	"thresholds": thresholdsField,
+	"cli": {kind: kindMapping, fields: map[string]*field{
+		"coverage":            {kind: kindString},
+		"format":              {kind: kindEnum, enum: []string{"Text", "Markdown", "JSON", "HTML", "GitHubAnnotations", "Sonar", "TeamCity", "Jenkins"}},
+		"base":                {kind: kindString},
+		"merge_base":          {kind: kindString},
+		"max_uncovered_lines": {kind: kindNonNegativeInt},
+	}},
+}}
+
+// thresholdsField is the thresholds mapping, which is also the shape of
+// server-side default thresholds (see ParseThresholds).
+var thresholdsField = &field{kind: kindMapping, fields: map[string]*field{
+	"project":  {kind: kindPercent},
+	"patch":    {kind: kindPercent},
+	"max_drop": {kind: kindPercent},
+	"packages": {kind: kindPercentMap},
+	"paths": {kind: kindList, item: &field{kind: kindMapping, required: []string{"path"}, fields: map[string]*field{
+		"path":  {kind: kindGlob},
+		"patch": {kind: kindPercent},
+	}}},
+	"conclusion": {kind: kindEnum, enum: []string{ConclusionFailure, ConclusionNeutral}},
+}}
+
+// yamlLineRe extracts the line number from yaml.v3 syntax errors.
+var yamlLineRe = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+// Lint validates a repository config and returns every issue found,
+// sorted by position. An empty document is valid.
+func Lint(data []byte) []Issue {
+	return lintDocument(data, rootField, "")
+}
+
+// lintDocument validates a YAML document against f. key is the dotted path
+// of the document's root.
+func lintDocument(data []byte, f *field, key string) []Issue {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return []Issue{syntaxIssue(err)}
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+
+	issues := lintNode(doc.Content[0], f, key)
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].Line != issues[j].Line {
+			return issues[i].Line < issues[j].Line
+		}
+		return issues[i].Column < issues[j].Column
+	})
+	return issues
+}
+
+// syntaxIssue converts a YAML parse error into an Issue.
+func syntaxIssue(err error) Issue {
+	msg := err.Error()
+	if m := yamlLineRe.FindStringSubmatch(msg); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		return Issue{Line: line, Message: "invalid YAML: " + m[2]}
+	}
+	return Issue{Message: "invalid YAML: " + strings.TrimPrefix(msg, "yaml: ")}
+}
+
+// lintNode checks node against f. key is the dotted path of node.
+func lintNode(node *yaml.Node, f *field, key string) []Issue {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	issueAt := func(n *yaml.Node, format string, args ...any) Issue {
+		return Issue{Line: n.Line, Column: n.Column, Key: key, Message: fmt.Sprintf(format, args...)}
+	}
+
+	switch f.kind {
+	case kindMapping:
+		if node.Kind != yaml.MappingNode {
+			return []Issue{issueAt(node, "expected a mapping, got %s", describe(node))}
+		}
+		var issues []Issue
+		seen := make(map[string]bool)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			k, v := node.Content[i], node.Content[i+1]
+			childKey := joinKey(key, k.Value)
+
+			if seen[k.Value] {
+				issues = append(issues, Issue{Line: k.Line, Column: k.Column, Key: childKey, Message: "duplicate key"})
+				continue
+			}
+			seen[k.Value] = true
+
+			child, ok := f.fields[k.Value]
+			if !ok {
+				msg := "unknown key"
+				if s := suggest(k.Value, f.fields); s != "" {
+					msg += fmt.Sprintf(" (did you mean %q?)", s)
+				}
+				issues = append(issues, Issue{Line: k.Line, Column: k.Column, Key: childKey, Message: msg})
+				continue
+			}
+			issues = append(issues, lintNode(v, child, childKey)...)
+		}
+		for _, k := range f.required {
+			if !seen[k] {
+				issues = append(issues, issueAt(node, "missing required key %q", k))
+			}
+		}
+		return issues
+
+	case kindGlobList:
+		if node.Kind != yaml.SequenceNode {
+			return []Issue{issueAt(node, "expected a list of glob patterns, got %s", describe(node))}
+		}
+		var issues []Issue
+		for i, item := range node.Content {
+			itemKey := fmt.Sprintf("%s[%d]", key, i)
+			if item.Kind != yaml.ScalarNode || item.Tag != "!!str" {
+				issues = append(issues, Issue{Line: item.Line, Column: item.Column, Key: itemKey,
+					Message: fmt.Sprintf("expected a glob pattern string, got %s", describe(item))})
+				continue
+			}
+			if _, err := path.Match(item.Value, ""); err != nil {
+				issues = append(issues, Issue{Line: item.Line, Column: item.Column, Key: itemKey,
+					Message: fmt.Sprintf("invalid glob pattern %q", item.Value)})
+			}
+		}
+		return issues
+
+	case kindGlob:
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!str" {
+			return []Issue{issueAt(node, "expected a glob pattern string, got %s", describe(node))}
+		}
+		if _, err := path.Match(node.Value, ""); err != nil {
+			return []Issue{issueAt(node, "invalid glob pattern %q", node.Value)}
+		}
+
+	case kindFileName:
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!str" {
+			return []Issue{issueAt(node, "expected a file name, got %s", describe(node))}
+		}
+		if node.Value == "" || strings.Contains(node.Value, "/") {
+			return []Issue{issueAt(node, "invalid file name %q (expected a name without directories, e.g. unit.yml)", node.Value)}
+		}
+
+	case kindString:
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!str" || node.Value == "" {
+			return []Issue{issueAt(node, "expected a non-empty string, got %s", describe(node))}
+		}
+
+	case kindList:
+		if node.Kind != yaml.SequenceNode {
+			return []Issue{issueAt(node, "expected a list, got %s", describe(node))}
+		}
+		var issues []Issue
+		for i, item := range node.Content {
+			issues = append(issues, lintNode(item, f.item, fmt.Sprintf("%s[%d]", key, i))...)
+		}
+		return issues
+
+	case kindEnum:
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!str" {
+			return []Issue{issueAt(node, "expected one of %s, got %s", strings.Join(f.enum, ", "), describe(node))}
+		}
+		for _, allowed := range f.enum {
+			if node.Value == allowed {
+				return nil
+			}
+		}
+		return []Issue{issueAt(node, "invalid value %q (expected one of %s)", node.Value, strings.Join(f.enum, ", "))}
+
+	case kindNonNegativeInt:
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!int" {
+			return []Issue{issueAt(node, "expected a non-negative integer, got %s", describe(node))}
+		}
+		if n, err := strconv.ParseInt(node.Value, 0, 64); err != nil || n < 0 {
+			return []Issue{issueAt(node, "invalid value %s (expected a non-negative integer)", node.Value)}
+		}
+
+	case kindBool:
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!bool" {
+			return []Issue{issueAt(node, "expected true or false, got %s", describe(node))}
+		}
+
+	case kindPercent:
+		if node.Kind != yaml.ScalarNode || (node.Tag != "!!int" && node.Tag != "!!float") {
+			return []Issue{issueAt(node, "expected a percentage, got %s", describe(node))}
+		}
+		if n, err := strconv.ParseFloat(node.Value, 64); err != nil || n < 0 || n > 100 {
+			return []Issue{issueAt(node, "invalid value %s (expected a percentage between 0 and 100)", node.Value)}
+		}
+
+	case kindPercentMap:
+		if node.Kind != yaml.MappingNode {
+			return []Issue{issueAt(node, "expected a mapping, got %s", describe(node))}
+		}
+		var issues []Issue
+		seen := make(map[string]bool)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			k, v := node.Content[i], node.Content[i+1]
+			childKey := joinKey(key, k.Value)
+			if seen[k.Value] {
+				issues = append(issues, Issue{Line: k.Line, Column: k.Column, Key: childKey, Message: "duplicate key"})
+				continue
+			}
+			seen[k.Value] = true
+			issues = append(issues, lintNode(v, percentField, childKey)...)
+		}
+		return issues
+	}
+
+	return nil
+}
+
+// describe names the YAML type of node for error messages.
+func describe(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "a mapping"
+	case yaml.SequenceNode:
+		return "a list"
+	case yaml.ScalarNode:
+		switch node.Tag {
+		case "!!null":
+			return "null"
+		case "!!str":
+			return fmt.Sprintf("string %q", node.Value)
+		default:
+			return fmt.Sprintf("%s %s", strings.TrimPrefix(node.Tag, "!!"), node.Value)
+		}
+	default:
+		return "an unsupported value"
+	}
+}
+
+func joinKey(parent, key string) string {
+	if parent == "" {
+		return key
+	}
+	return parent + "." + key
+}
+
+// suggest returns the known key closest to key, if it is a likely typo.
+func suggest(key string, fields map[string]*field) string {
+	best, bestDistance := "", 3 // Suggest only within an edit distance of 2
+	for name := range fields {
+		if d := editDistance(strings.ToLower(key), name); d < bestDistance || (d == bestDistance && name < best) {
+			best, bestDistance = name, d
+		}
+	}
+	if bestDistance > 2 {
+		return ""
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
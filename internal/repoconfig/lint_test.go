@@ -0,0 +1,304 @@
+package repoconfig
+
+import (
+	"encoding/json"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{
+			name:  "empty document",
+			input: "",
+		},
+		{
+			name: "valid config",
+			input: `ignore:
+  - "**/*.pb.go"
+  - mocks/*
+artifacts: [coverage-*]
+workflows: [unit.yml, integration.yml]
+annotations:
+  level: warning
+  summary_only_above: 500
+  top_files: 5
+  severity:
+    exported: warning
+    error_handling: notice
+    low_coverage: 30
+comment:
+  behavior: off
+suppressions:
+  max_age_days: 90
+thresholds:
+  project: 72.5
+  patch: 80
+  max_drop: 0.5
+  packages:
+    github.com/acme/widgets/api: 80
+  paths:
+    - path: internal/api
+      patch: 90
+    - path: cmd/*
+  conclusion: neutral
+cli:
+  coverage: build/coverage
+  format: Markdown
+  merge_base: origin/main
+  max_uncovered_lines: 10
+`,
+		},
+		{
+			name: "unknown keys with suggestions",
+			input: `ignor:
+  - x
+annotations:
+  levle: warning
+  colour: red
+`,
+			expected: []string{
+				`line 1, column 1: ignor: unknown key (did you mean "ignore"?)`,
+				`line 4, column 3: annotations.levle: unknown key (did you mean "level"?)`,
+				`line 5, column 3: annotations.colour: unknown key`,
+			},
+		},
+		{
+			name: "invalid enum values",
+			input: `annotations:
+  level: error
+comment:
+  behavior: true
+`,
+			expected: []string{
+				`line 2, column 10: annotations.level: invalid value "error" (expected one of notice, warning, failure)`,
+				`line 4, column 13: comment.behavior: expected one of update, new, off, got bool true`,
+			},
+		},
+		{
+			name: "wrong shapes",
+			input: `ignore: "*.pb.go"
+artifacts:
+  - [nested]
+  - 42
+  - "bad[pattern"
+comment: off
+`,
+			expected: []string{
+				`line 1, column 9: ignore: expected a list of glob patterns, got string "*.pb.go"`,
+				`line 3, column 5: artifacts[0]: expected a glob pattern string, got a list`,
+				`line 4, column 5: artifacts[1]: expected a glob pattern string, got int 42`,
+				`line 5, column 5: artifacts[2]: invalid glob pattern "bad[pattern"`,
+				`line 6, column 10: comment: expected a mapping, got string "off"`,
+			},
+		},
+		{
+			name: "invalid workflows",
+			input: `workflows:
+  - unit.yml
+  - .github/workflows/integration.yml
+  - 3
+`,
+			expected: []string{
+				`line 3, column 5: workflows[1]: invalid file name ".github/workflows/integration.yml" (expected a name without directories, e.g. unit.yml)`,
+				`line 4, column 5: workflows[2]: expected a file name, got int 3`,
+			},
+		},
+		{
+			name: "invalid integers",
+			input: `suppressions:
+  max_age_days: -1
+`,
+			expected: []string{
+				`line 2, column 17: suppressions.max_age_days: invalid value -1 (expected a non-negative integer)`,
+			},
+		},
+		{
+			name: "invalid thresholds",
+			input: `thresholds:
+  project: 101
+  packages:
+    github.com/acme/widgets/api: high
+    github.com/acme/widgets/db: -5
+    github.com/acme/widgets/api: 10
+`,
+			expected: []string{
+				`line 2, column 12: thresholds.project: invalid value 101 (expected a percentage between 0 and 100)`,
+				`line 4, column 34: thresholds.packages.github.com/acme/widgets/api: expected a percentage, got string "high"`,
+				`line 5, column 33: thresholds.packages.github.com/acme/widgets/db: invalid value -5 (expected a percentage between 0 and 100)`,
+				`line 6, column 5: thresholds.packages.github.com/acme/widgets/api: duplicate key`,
+			},
+		},
+		{
+			name: "invalid threshold paths",
+			input: `thresholds:
+  paths:
+    - patch: 90
+    - path: "bad[pattern"
+      patch: 120
+    - internal/api
+  conclusion: skipped
+`,
+			expected: []string{
+				`line 3, column 7: thresholds.paths[0]: missing required key "path"`,
+				`line 4, column 13: thresholds.paths[1].path: invalid glob pattern "bad[pattern"`,
+				`line 5, column 14: thresholds.paths[1].patch: invalid value 120 (expected a percentage between 0 and 100)`,
+				`line 6, column 7: thresholds.paths[2]: expected a mapping, got string "internal/api"`,
+				`line 7, column 15: thresholds.conclusion: invalid value "skipped" (expected one of failure, neutral)`,
+			},
+		},
+		{
+			name: "invalid cli defaults",
+			input: `cli:
+  coverage: ""
+  format: markdown
+  base: 42
+  max_uncovered_lines: -1
+`,
+			expected: []string{
+				`line 2, column 13: cli.coverage: expected a non-empty string, got string ""`,
+				`line 3, column 11: cli.format: invalid value "markdown" (expected one of Text, Markdown, JSON, HTML, GitHubAnnotations, Sonar, TeamCity, Jenkins)`,
+				`line 4, column 9: cli.base: expected a non-empty string, got int 42`,
+				`line 5, column 24: cli.max_uncovered_lines: invalid value -1 (expected a non-negative integer)`,
+			},
+		},
+		{
+			name:  "invalid severity",
+			input: "annotations:\n  severity:\n    exported: error\n    low_coverage: 130\n",
+			expected: []string{
+				`line 3, column 15: annotations.severity.exported: invalid value "error" (expected one of notice, warning, failure)`,
+				`line 4, column 19: annotations.severity.low_coverage: invalid value 130 (expected a percentage between 0 and 100)`,
+			},
+		},
+		{
+			name:  "boolean of the wrong type",
+			input: "annotations:\n  summary_only: \"yes\"\n",
+			expected: []string{
+				`line 2, column 17: annotations.summary_only: expected true or false, got string "yes"`,
+			},
+		},
+		{
+			name:  "integer of the wrong type",
+			input: "suppressions:\n  max_age_days: \"90\"\n",
+			expected: []string{
+				`line 2, column 17: suppressions.max_age_days: expected a non-negative integer, got string "90"`,
+			},
+		},
+		{
+			name: "duplicate key",
+			input: `ignore: []
+ignore: []
+`,
+			expected: []string{
+				`line 2, column 1: ignore: duplicate key`,
+			},
+		},
+		{
+			name:  "top level is not a mapping",
+			input: "- ignore\n",
+			expected: []string{
+				`line 1, column 1: expected a mapping, got a list`,
+			},
+		},
+		{
+			name:  "syntax error",
+			input: "annotations:\n  level: notice\n bad: [\n",
+			expected: []string{
+				`line 2: invalid YAML: did not find expected key`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issues := Lint([]byte(tt.input))
+			got := make([]string, len(issues))
+			for i, issue := range issues {
+				got[i] = issue.String()
+			}
+			if len(tt.expected) == 0 {
+				assert.Empty(t, got)
+				return
+			}
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	assert.Equal(t, "artifacts", suggest("artifact", rootField.fields))
+	assert.Equal(t, "comment", suggest("Comment", rootField.fields))
+	assert.Equal(t, "", suggest("notifications", rootField.fields))
+}
+
+// schemaNode is the subset of JSON schema used by schema.json.
+type schemaNode struct {
+	Type                 string                 `json:"type"`
+	Enum                 []string               `json:"enum"`
+	AdditionalProperties json.RawMessage        `json:"additionalProperties"`
+	Properties           map[string]*schemaNode `json:"properties"`
+	Items                *schemaNode            `json:"items"`
+	Required             []string               `json:"required"`
+}
+
+// TestSchemaMatchesLint keeps schema.json and the lint rules in sync.
+func TestSchemaMatchesLint(t *testing.T) {
+	var root schemaNode
+	require.NoError(t, json.Unmarshal(Schema, &root))
+	assertSchemaMatches(t, "", &root, rootField)
+}
+
+func assertSchemaMatches(t *testing.T, key string, s *schemaNode, f *field) {
+	t.Helper()
+	switch f.kind {
+	case kindMapping:
+		require.Equal(t, "object", s.Type, key)
+		assert.JSONEq(t, "false", string(s.AdditionalProperties), key)
+
+		var schemaKeys, fieldKeys []string
+		for k := range s.Properties {
+			schemaKeys = append(schemaKeys, k)
+		}
+		for k := range f.fields {
+			fieldKeys = append(fieldKeys, k)
+		}
+		sort.Strings(schemaKeys)
+		sort.Strings(fieldKeys)
+		require.Equal(t, fieldKeys, schemaKeys, key)
+		assert.Equal(t, f.required, s.Required, key)
+
+		for k, child := range f.fields {
+			assertSchemaMatches(t, joinKey(key, k), s.Properties[k], child)
+		}
+	case kindGlobList:
+		assert.Equal(t, "array", s.Type, key)
+		require.NotNil(t, s.Items, key)
+		assert.Equal(t, "string", s.Items.Type, key)
+	case kindGlob, kindFileName, kindString:
+		assert.Equal(t, "string", s.Type, key)
+	case kindList:
+		assert.Equal(t, "array", s.Type, key)
+		require.NotNil(t, s.Items, key)
+		assertSchemaMatches(t, key+"[]", s.Items, f.item)
+	case kindEnum:
+		assert.Equal(t, f.enum, s.Enum, key)
+	case kindNonNegativeInt:
+		assert.Equal(t, "integer", s.Type, key)
+	case kindBool:
+		assert.Equal(t, "boolean", s.Type, key)
+	case kindPercent:
+		assert.Equal(t, "number", s.Type, key)
+	case kindPercentMap:
+		assert.Equal(t, "object", s.Type, key)
+		var values schemaNode
+		require.NoError(t, json.Unmarshal(s.AdditionalProperties, &values), key)
+		assertSchemaMatches(t, key+".*", &values, percentField)
+	}
+}
@@ -0,0 +1,321 @@
+package repoconfig
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Paths are the locations of the repository config, relative to the
+// repository root, in lookup order.
+var Paths = []string{".canopy.yml", ".github/canopy.yml"}
+
+// Schema is the JSON schema for the repository config, for editor
+// integration (e.g. yaml-language-server). Lint enforces the same rules.
+//
+//go:embed schema.json
+var Schema []byte
+
+// Annotation levels accepted by annotations.level.
+const (
+	LevelNotice  = "notice"
+	LevelWarning = "warning"
+	LevelFailure = "failure"
+)
+
+// Comment behaviors accepted by comment.behavior.
+const (
+	// CommentUpdate edits Canopy's existing PR comment, creating it if needed.
+	CommentUpdate = "update"
+	// CommentNew posts a new comment for every analysis.
+	CommentNew = "new"
+	// CommentOff disables PR comments.
+	CommentOff = "off"
+)
+
+// Check run conclusions accepted by thresholds.conclusion.
+const (
+	// ConclusionFailure fails the check run, blocking merges if it is required.
+	ConclusionFailure = "failure"
+	// ConclusionNeutral reports unmet thresholds without failing the check run.
+	ConclusionNeutral = "neutral"
+)
+
+// Config is the per-repository configuration committed as .canopy.yml.
+type Config struct {
+	// Ignore lists glob patterns of files left out of the analysis (see
+	// coverage.PatternFilter)
+	Ignore []string `yaml:"ignore"`
+	// Include, if set, limits the analysis to files matching one of its
+	// glob patterns (see coverage.IncludeFilter); Ignore still applies
+	Include []string `yaml:"include"`
+
+	// Artifacts lists glob patterns of workflow artifact names holding
+	// coverage; empty uses the patterns the service is configured with
+	Artifacts []string `yaml:"artifacts"`
+
+	// Workflows lists the workflow files (e.g. unit.yml) whose coverage of
+	// a commit is merged: the analysis is updated as each of them completes,
+	// and completed once all of them have. Empty analyzes every run on its
+	// own.
+	Workflows []string `yaml:"workflows"`
+
+	Annotations  AnnotationsConfig  `yaml:"annotations"`
+	Comment      CommentConfig      `yaml:"comment"`
+	Suppressions SuppressionsConfig `yaml:"suppressions"`
+	Thresholds   ThresholdsConfig   `yaml:"thresholds"`
+	CLI          CLIConfig          `yaml:"cli"`
+}
+
+// AnnotationsConfig controls check run annotations.
+type AnnotationsConfig struct {
+	// Level is the annotation level for uncovered lines: notice, warning, or failure
+	Level string `yaml:"level"`
+	// SummaryOnly omits annotations, reporting only totals and the TopFiles
+	// files with the most uncovered lines, for repositories where large
+	// numbers of annotations slow down the GitHub UI
+	SummaryOnly bool `yaml:"summary_only"`
+	// SummaryOnlyAbove switches to summary-only mode when a change has more
+	// uncovered lines than this; zero never switches automatically
+	SummaryOnlyAbove int `yaml:"summary_only_above"`
+	// TopFiles is the number of files listed in summary-only mode
+	TopFiles int `yaml:"top_files"`
+	// Severity raises the level of uncovered lines by the code they are in
+	Severity SeverityConfig `yaml:"severity"`
+}
+
+// SeverityConfig maps coverage severity to annotation levels, like the
+// canopy CLI's --annotation-levels (see coverage.SeverityPolicy). Empty
+// levels fall back to AnnotationsConfig.Level.
+type SeverityConfig struct {
+	// Exported is the level of uncovered lines in exported functions
+	Exported string `yaml:"exported"`
+	// ErrorHandling is the level of uncovered lines in `if err != nil` branches
+	ErrorHandling string `yaml:"error_handling"`
+	// LowCoverage adds a failure annotation on line 1 of each file whose
+	// patch coverage is below this percentage; zero disables it
+	LowCoverage float64 `yaml:"low_coverage"`
+}
+
+// Classifies reports whether the levels depend on the code lines are in,
+// which requires the sources of the changed files.
+func (s SeverityConfig) Classifies() bool {
+	return s.Exported != "" || s.ErrorHandling != ""
+}
+
+// CLIConfig sets defaults for the flags of the canopy CLI that have no
+// counterpart in the service; flags given on the command line override
+// them. The CLI also takes Ignore, Include, Suppressions, and
+// Thresholds.Patch from the config.
+type CLIConfig struct {
+	// Coverage is the directory coverage files are read from
+	Coverage string `yaml:"coverage"`
+	// Format is the report format, e.g. Markdown
+	Format string `yaml:"format"`
+	// Base is the ref diffs are compared from (--base)
+	Base string `yaml:"base"`
+	// MergeBase is the ref whose merge base with HEAD diffs are compared
+	// from (--merge-base); it can't be combined with Base
+	MergeBase string `yaml:"merge_base"`
+	// MaxUncoveredLines fails the analysis when more added lines than this
+	// are uncovered; nil sets no limit
+	MaxUncoveredLines *int `yaml:"max_uncovered_lines"`
+}
+
+// UseSummaryOnly reports whether a change with uncoveredLines uncovered
+// lines is reported in summary-only mode.
+func (c AnnotationsConfig) UseSummaryOnly(uncoveredLines int) bool {
+	return c.SummaryOnly || (c.SummaryOnlyAbove > 0 && uncoveredLines > c.SummaryOnlyAbove)
+}
+
+// CommentConfig controls the PR comment.
+type CommentConfig struct {
+	// Behavior is update, new, or off
+	Behavior string `yaml:"behavior"`
+}
+
+// SuppressionsConfig controls canopy:ignore comments.
+type SuppressionsConfig struct {
+	// MaxAgeDays expires suppressions older than this many days, or without
+	// a date; zero never expires them
+	MaxAgeDays int `yaml:"max_age_days"`
+}
+
+// ThresholdsConfig sets the coverage a PR must meet; a PR that doesn't
+// meet one concludes its check run with Conclusion (see policy.Evaluate).
+type ThresholdsConfig struct {
+	// Project is the minimum total coverage; zero disables the check
+	Project float64 `yaml:"project,omitempty"`
+	// Patch is the minimum coverage of the lines a PR adds, outside the
+	// files matched by Paths; zero disables the check
+	Patch float64 `yaml:"patch,omitempty"`
+	// MaxDrop is the largest decrease of total coverage compared with the
+	// base branch, in percentage points; zero fails any decrease
+	MaxDrop float64 `yaml:"max_drop,omitempty"`
+	// Packages maps Go import paths (e.g. github.com/acme/widgets/api) to
+	// their minimum coverage
+	Packages map[string]float64 `yaml:"packages,omitempty"`
+	// Paths override Patch for the files they match; the first matching
+	// override applies to a file
+	Paths []PathThreshold `yaml:"paths,omitempty"`
+	// Conclusion is the check run conclusion of a PR that doesn't meet a
+	// threshold: failure, or neutral to report without blocking merges.
+	// Empty is failure.
+	Conclusion string `yaml:"conclusion,omitempty"`
+}
+
+// PathThreshold is the minimum coverage of the lines a PR adds to the
+// files matching a glob pattern.
+type PathThreshold struct {
+	// Path is matched against repository-relative file paths and their
+	// parent directories with path.Match, so "internal/api" applies to the
+	// whole directory and "cmd/*" to each directory under cmd
+	Path  string  `yaml:"path"`
+	Patch float64 `yaml:"patch"`
+}
+
+// Matches reports whether the override applies to a file.
+func (p PathThreshold) Matches(file string) bool {
+	for f := file; f != "." && f != "/"; f = path.Dir(f) {
+		if ok, _ := path.Match(p.Path, f); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// IsZero reports whether no threshold is set.
+func (c ThresholdsConfig) IsZero() bool {
+	return c.Project == 0 && c.Patch == 0 && c.MaxDrop == 0 && len(c.Packages) == 0 && len(c.Paths) == 0
+}
+
+// FailureConclusion returns the check run conclusion of a PR that doesn't
+// meet a threshold.
+func (c ThresholdsConfig) FailureConclusion() string {
+	if c.Conclusion == "" {
+		return ConclusionFailure
+	}
+	return c.Conclusion
+}
+
+// Default returns the configuration used when a repository has no config
+// file, or an invalid one.
+func Default() *Config {
+	return &Config{
+		Annotations: AnnotationsConfig{Level: LevelNotice, TopFiles: 10},
+		Comment:     CommentConfig{Behavior: CommentUpdate},
+	}
+}
+
+// Parse parses a repository config. If the config has any issues, Parse
+// returns the default config along with the issues, so callers can keep
+// processing and surface the issues (e.g. as a check run warning) instead
+// of failing.
+func Parse(data []byte) (*Config, []Issue) {
+	return ParseOver(data, nil)
+}
+
+// ParseOver parses a repository config over base, such as the config of
+// the repository's org (see ParseOrg): keys the repository sets replace
+// base's, and others keep base's values. A nil base is Default(). Like
+// Parse, a config with issues returns base along with the issues.
+func ParseOver(data []byte, base *Config) (*Config, []Issue) {
+	if base == nil {
+		base = Default()
+	}
+	if issues := Lint(data); len(issues) > 0 {
+		return base.clone(), issues
+	}
+
+	cfg := base.clone()
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		// Lint accepted the document, so this should not happen
+		return base.clone(), []Issue{{Message: err.Error()}}
+	}
+	if cfg.Annotations.TopFiles == 0 {
+		cfg.Annotations.TopFiles = Default().Annotations.TopFiles
+	}
+	return cfg, nil
+}
+
+// ParseOrg parses the config of an org, which has the shape of a
+// repository config and applies to the org's repositories under their own
+// (see ParseOver). Unlike Parse, it fails on any issue.
+func ParseOrg(data []byte) (*Config, error) {
+	cfg, issues := Parse(data)
+	if len(issues) > 0 {
+		msgs := make([]string, len(issues))
+		for i, issue := range issues {
+			msgs[i] = issue.String()
+		}
+		return nil, errors.New(strings.Join(msgs, "; "))
+	}
+	return cfg, nil
+}
+
+// clone returns a copy of c that unmarshaling into doesn't modify c, whose
+// maps YAML would otherwise merge into.
+func (c *Config) clone() *Config {
+	cp := *c
+	cp.Ignore = slices.Clone(c.Ignore)
+	cp.Include = slices.Clone(c.Include)
+	cp.Artifacts = slices.Clone(c.Artifacts)
+	cp.Workflows = slices.Clone(c.Workflows)
+	cp.Thresholds.Packages = maps.Clone(c.Thresholds.Packages)
+	cp.Thresholds.Paths = slices.Clone(c.Thresholds.Paths)
+	return &cp
+}
+
+// ParseThresholds parses thresholds given on their own, in the shape of the
+// thresholds key of a repository config, such as the server-side defaults
+// of repositories that set none. Unlike Parse, it fails on any issue.
+func ParseThresholds(data []byte) (ThresholdsConfig, error) {
+	var t ThresholdsConfig
+	if issues := lintDocument(data, thresholdsField, ""); len(issues) > 0 {
+		msgs := make([]string, len(issues))
+		for i, issue := range issues {
+			msgs[i] = issue.String()
+		}
+		return t, errors.New(strings.Join(msgs, "; "))
+	}
+	if err := yaml.Unmarshal(data, &t); err != nil {
+		return t, err
+	}
+	return t, nil
+}
+
+// Find reads the first config file in Paths under root.
+// Returns an error wrapping os.ErrNotExist if the repository has no config.
+func Find(root string) (string, []byte, error) {
+	for _, p := range Paths {
+		data, err := os.ReadFile(filepath.Join(root, p))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return p, nil, fmt.Errorf("failed to read %s: %w", p, err)
+		}
+		return p, data, nil
+	}
+	return "", nil, fmt.Errorf("no repository config found (looked for %s): %w", strings.Join(Paths, ", "), os.ErrNotExist)
+}
+
+// FormatWarning renders config issues as Markdown for a check run summary,
+// explaining that defaults were used instead.
+func FormatWarning(path string, issues []Issue) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "**Warning:** `%s` is invalid, so default settings were used.\n\n", path)
+	for _, issue := range issues {
+		fmt.Fprintf(&b, "- %s\n", issue)
+	}
+	fmt.Fprintf(&b, "\nRun `canopy config lint` locally to check the file.\n")
+	return b.String()
+}
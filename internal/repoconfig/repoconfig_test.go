@@ -0,0 +1,218 @@
+package repoconfig
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	t.Run("empty config uses defaults", func(t *testing.T) {
+		cfg, issues := Parse(nil)
+		assert.Empty(t, issues)
+		assert.Equal(t, Default(), cfg)
+	})
+
+	t.Run("values override defaults", func(t *testing.T) {
+		cfg, issues := Parse([]byte(`ignore: ["**/*_gen.go"]
+include: ["internal/**"]
+annotations:
+  level: failure
+  summary_only: true
+  severity:
+    exported: warning
+    low_coverage: 30
+suppressions:
+  max_age_days: 30
+thresholds:
+  project: 70
+  packages:
+    github.com/acme/widgets/api: 82.5
+`))
+		assert.Empty(t, issues)
+		assert.Equal(t, []string{"**/*_gen.go"}, cfg.Ignore)
+		assert.Equal(t, []string{"internal/**"}, cfg.Include)
+		assert.Empty(t, cfg.Artifacts)
+		assert.Equal(t, LevelFailure, cfg.Annotations.Level)
+		assert.Equal(t, CommentUpdate, cfg.Comment.Behavior)
+		assert.Equal(t, 30, cfg.Suppressions.MaxAgeDays)
+		assert.True(t, cfg.Annotations.SummaryOnly)
+		assert.Equal(t, 10, cfg.Annotations.TopFiles)
+		assert.Equal(t, SeverityConfig{Exported: LevelWarning, LowCoverage: 30}, cfg.Annotations.Severity)
+		assert.True(t, cfg.Annotations.Severity.Classifies())
+		assert.Equal(t, ThresholdsConfig{Project: 70, Packages: map[string]float64{"github.com/acme/widgets/api": 82.5}}, cfg.Thresholds)
+	})
+
+	t.Run("artifact patterns", func(t *testing.T) {
+		cfg, issues := Parse([]byte("artifacts: [\"cover-*\", \"*-coverage\"]\n"))
+		assert.Empty(t, issues)
+		assert.Equal(t, []string{"cover-*", "*-coverage"}, cfg.Artifacts)
+	})
+
+	t.Run("workflows", func(t *testing.T) {
+		cfg, issues := Parse([]byte("workflows: [unit.yml, integration.yml]\n"))
+		assert.Empty(t, issues)
+		assert.Equal(t, []string{"unit.yml", "integration.yml"}, cfg.Workflows)
+	})
+
+	t.Run("invalid config degrades to defaults", func(t *testing.T) {
+		cfg, issues := Parse([]byte(`ignore: ["vendor/*"]
+annotations:
+  level: loud
+`))
+		require.Len(t, issues, 1)
+		assert.Equal(t, "annotations.level", issues[0].Key)
+		assert.Equal(t, Default(), cfg)
+	})
+}
+
+func TestFind(t *testing.T) {
+	t.Run("root config", func(t *testing.T) {
+		root := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(root, ".canopy.yml"), []byte("ignore: []\n"), 0644))
+		require.NoError(t, os.MkdirAll(filepath.Join(root, ".github"), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(root, ".github", "canopy.yml"), []byte("comment: {}\n"), 0644))
+
+		path, data, err := Find(root)
+		require.NoError(t, err)
+		assert.Equal(t, ".canopy.yml", path)
+		assert.Equal(t, "ignore: []\n", string(data))
+	})
+
+	t.Run("github directory config", func(t *testing.T) {
+		root := t.TempDir()
+		require.NoError(t, os.MkdirAll(filepath.Join(root, ".github"), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(root, ".github", "canopy.yml"), []byte("comment: {}\n"), 0644))
+
+		path, _, err := Find(root)
+		require.NoError(t, err)
+		assert.Equal(t, ".github/canopy.yml", path)
+	})
+
+	t.Run("no config", func(t *testing.T) {
+		_, _, err := Find(t.TempDir())
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, os.ErrNotExist))
+	})
+}
+
+func TestFormatWarning(t *testing.T) {
+	warning := FormatWarning(".canopy.yml", []Issue{
+		{Line: 2, Column: 10, Key: "annotations.level", Message: `invalid value "loud"`},
+		{Message: "invalid YAML: unexpected end of stream"},
+	})
+
+	assert.Equal(t, "**Warning:** `.canopy.yml` is invalid, so default settings were used.\n\n"+
+		"- line 2, column 10: annotations.level: invalid value \"loud\"\n"+
+		"- invalid YAML: unexpected end of stream\n"+
+		"\nRun `canopy config lint` locally to check the file.\n", warning)
+}
+
+func TestAnnotationsConfig_UseSummaryOnly(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       AnnotationsConfig
+		uncovered int
+		expected  bool
+	}{
+		{name: "disabled", cfg: AnnotationsConfig{}, uncovered: 100000, expected: false},
+		{name: "forced", cfg: AnnotationsConfig{SummaryOnly: true}, uncovered: 1, expected: true},
+		{name: "below threshold", cfg: AnnotationsConfig{SummaryOnlyAbove: 500}, uncovered: 500, expected: false},
+		{name: "above threshold", cfg: AnnotationsConfig{SummaryOnlyAbove: 500}, uncovered: 501, expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.cfg.UseSummaryOnly(tt.uncovered))
+		})
+	}
+}
+
+func TestParseThresholds(t *testing.T) {
+	thresholds, err := ParseThresholds([]byte("{patch: 80, max_drop: 1, paths: [{path: cmd, patch: 0}], conclusion: neutral}"))
+	require.NoError(t, err)
+	assert.Equal(t, ThresholdsConfig{
+		Patch:      80,
+		MaxDrop:    1,
+		Paths:      []PathThreshold{{Path: "cmd"}},
+		Conclusion: ConclusionNeutral,
+	}, thresholds)
+	assert.Equal(t, ConclusionNeutral, thresholds.FailureConclusion())
+	assert.Equal(t, ConclusionFailure, ThresholdsConfig{}.FailureConclusion())
+
+	_, err = ParseThresholds([]byte("patch: 180\nproject: high\n"))
+	assert.EqualError(t, err, `line 1, column 8: patch: invalid value 180 (expected a percentage between 0 and 100); line 2, column 10: project: expected a percentage, got string "high"`)
+}
+
+func TestParseOver(t *testing.T) {
+	org, err := ParseOrg([]byte(`artifacts: ["cover-*"]
+annotations:
+  level: warning
+thresholds:
+  patch: 80
+  packages:
+    github.com/acme/widgets/api: 90
+`))
+	require.NoError(t, err)
+
+	t.Run("repository keys replace the org's", func(t *testing.T) {
+		cfg, issues := ParseOver([]byte(`annotations:
+  level: failure
+thresholds:
+  packages:
+    github.com/acme/widgets/db: 70
+`), org)
+		assert.Empty(t, issues)
+		assert.Equal(t, []string{"cover-*"}, cfg.Artifacts)
+		assert.Equal(t, LevelFailure, cfg.Annotations.Level)
+		assert.Equal(t, ThresholdsConfig{Patch: 80, Packages: map[string]float64{
+			"github.com/acme/widgets/api": 90,
+			"github.com/acme/widgets/db":  70,
+		}}, cfg.Thresholds)
+		// The org's config is left as it was
+		assert.Len(t, org.Thresholds.Packages, 1)
+	})
+
+	t.Run("without a repository config", func(t *testing.T) {
+		cfg, issues := ParseOver(nil, org)
+		assert.Empty(t, issues)
+		assert.Equal(t, org, cfg)
+	})
+
+	t.Run("invalid repository config keeps the org's", func(t *testing.T) {
+		cfg, issues := ParseOver([]byte("annotations:\n  level: loud\n"), org)
+		assert.NotEmpty(t, issues)
+		assert.Equal(t, LevelWarning, cfg.Annotations.Level)
+	})
+
+	t.Run("invalid org config", func(t *testing.T) {
+		_, err := ParseOrg([]byte("annotations:\n  level: loud\n"))
+		assert.ErrorContains(t, err, "annotations.level")
+	})
+}
+
+func TestPathThreshold_Matches(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		file     string
+		expected bool
+	}{
+		{pattern: "internal/api", file: "internal/api/handler.go", expected: true},
+		{pattern: "internal/api", file: "internal/api/v2/handler.go", expected: true},
+		{pattern: "internal/api", file: "internal/apis/handler.go", expected: false},
+		{pattern: "cmd/*", file: "cmd/canopy/main.go", expected: true},
+		{pattern: "cmd/*", file: "main.go", expected: false},
+		{pattern: "*_gen.go", file: "models_gen.go", expected: true},
+		{pattern: "*_gen.go", file: "api/models_gen.go", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.file, func(t *testing.T) {
+			assert.Equal(t, tt.expected, PathThreshold{Path: tt.pattern}.Matches(tt.file))
+		})
+	}
+}
@@ -0,0 +1,133 @@
+// Package secrets resolves references to secrets held in Google Secret
+// Manager or AWS Secrets Manager, so configuration can name a secret instead
+// of holding it.
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	secretmanager "google.golang.org/api/secretmanager/v1"
+)
+
+// Prefix marks a value that references a secret rather than holding it:
+//
+//   - sm://projects/<project>/secrets/<secret>[/versions/<version>] reads a
+//     Google Secret Manager secret version, the latest by default
+//   - sm://arn:aws:secretsmanager:<region>:<account>:secret:<name> reads an
+//     AWS Secrets Manager secret, from the region in its ARN
+const Prefix = "sm://"
+
+// IsReference reports whether value references a secret.
+func IsReference(value string) bool {
+	return strings.HasPrefix(value, Prefix)
+}
+
+// Resolver reads referenced secrets. Its zero value uses the secret
+// managers' clients with their default credentials: Application Default
+// Credentials for Google, and the AWS default credential chain.
+type Resolver struct {
+	// AccessGoogle returns the payload of a Google Secret Manager secret
+	// version by resource name; nil uses the Secret Manager API
+	AccessGoogle func(ctx context.Context, name string) ([]byte, error)
+
+	// GetAWS returns the value of an AWS Secrets Manager secret by ARN in
+	// region; nil uses the Secrets Manager API
+	GetAWS func(ctx context.Context, region, arn string) (string, error)
+}
+
+// Resolve returns the secret value references, or value itself if it
+// isn't a reference.
+func (r *Resolver) Resolve(ctx context.Context, value string) (string, error) {
+	if !IsReference(value) {
+		return value, nil
+	}
+	ref := strings.TrimPrefix(value, Prefix)
+
+	switch {
+	case strings.HasPrefix(ref, "projects/"):
+		name, err := googleVersionName(ref)
+		if err != nil {
+			return "", err
+		}
+		access := r.AccessGoogle
+		if access == nil {
+			access = accessGoogle
+		}
+		payload, err := access(ctx, name)
+		if err != nil {
+			return "", fmt.Errorf("failed to access secret %s: %w", name, err)
+		}
+		return string(payload), nil
+
+	case strings.HasPrefix(ref, "arn:"):
+		// arn:partition:secretsmanager:region:account:secret:name
+		parts := strings.SplitN(ref, ":", 7)
+		if len(parts) != 7 || parts[2] != "secretsmanager" || parts[3] == "" || parts[5] != "secret" || parts[6] == "" {
+			return "", fmt.Errorf("invalid secret reference %q: expected an AWS Secrets Manager secret ARN", value)
+		}
+		get := r.GetAWS
+		if get == nil {
+			get = getAWS
+		}
+		secret, err := get(ctx, parts[3], ref)
+		if err != nil {
+			return "", fmt.Errorf("failed to get secret %s: %w", ref, err)
+		}
+		return secret, nil
+
+	default:
+		return "", fmt.Errorf("invalid secret reference %q: expected %sprojects/... or %sarn:aws:secretsmanager:...", value, Prefix, Prefix)
+	}
+}
+
+// googleVersionName returns the resource name of the secret version a
+// Google Secret Manager reference names, its latest version if it names
+// none.
+func googleVersionName(ref string) (string, error) {
+	parts := strings.Split(ref, "/")
+	switch {
+	case len(parts) == 4 && parts[2] == "secrets" && parts[1] != "" && parts[3] != "":
+		return ref + "/versions/latest", nil
+	case len(parts) == 6 && parts[2] == "secrets" && parts[4] == "versions" && parts[1] != "" && parts[3] != "" && parts[5] != "":
+		return ref, nil
+	default:
+		return "", fmt.Errorf("invalid secret reference %q: expected %sprojects/<project>/secrets/<secret>[/versions/<version>]", Prefix+ref, Prefix)
+	}
+}
+
+// accessGoogle reads a secret version with the Secret Manager API.
+func accessGoogle(ctx context.Context, name string) ([]byte, error) {
+	service, err := secretmanager.NewService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Secret Manager client: %w", err)
+	}
+	resp, err := service.Projects.Secrets.Versions.Access(name).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	if resp.Payload == nil {
+		return nil, fmt.Errorf("secret version has no payload")
+	}
+	return base64.StdEncoding.DecodeString(resp.Payload.Data)
+}
+
+// getAWS reads a secret with the Secrets Manager API.
+func getAWS(ctx context.Context, region, arn string) (string, error) {
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(region))
+	if err != nil {
+		return "", fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	out, err := secretsmanager.NewFromConfig(cfg).GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: &arn})
+	if err != nil {
+		return "", err
+	}
+	if out.SecretString != nil {
+		return *out.SecretString, nil
+	}
+	return string(out.SecretBinary), nil
+}
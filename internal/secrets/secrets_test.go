@@ -0,0 +1,70 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolver_Resolve(t *testing.T) {
+	const arn = "arn:aws:secretsmanager:eu-west-1:123456789012:secret:canopy/webhook-AbCdEf"
+
+	tests := []struct {
+		name      string
+		value     string
+		expected  string
+		requested string
+		errorMsg  string
+	}{
+		{name: "plain value", value: "not-a-reference", expected: "not-a-reference"},
+		{
+			name:      "google latest version",
+			value:     "sm://projects/my-project/secrets/github-key",
+			expected:  "google-secret",
+			requested: "projects/my-project/secrets/github-key/versions/latest",
+		},
+		{
+			name:      "google version",
+			value:     "sm://projects/my-project/secrets/github-key/versions/3",
+			expected:  "google-secret",
+			requested: "projects/my-project/secrets/github-key/versions/3",
+		},
+		{name: "aws", value: "sm://" + arn, expected: "aws-secret", requested: "eu-west-1 " + arn},
+		{name: "google without secret", value: "sm://projects/my-project", errorMsg: "expected sm://projects/<project>/secrets/<secret>"},
+		{name: "aws without name", value: "sm://arn:aws:secretsmanager:eu-west-1:123456789012:secret:", errorMsg: "expected an AWS Secrets Manager secret ARN"},
+		{name: "aws other service", value: "sm://arn:aws:ssm:eu-west-1:123456789012:parameter:key", errorMsg: "expected an AWS Secrets Manager secret ARN"},
+		{name: "unknown", value: "sm://vault/canopy", errorMsg: `invalid secret reference "sm://vault/canopy"`},
+		{name: "not found", value: "sm://projects/my-project/secrets/missing", errorMsg: "failed to access secret projects/my-project/secrets/missing/versions/latest: not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requested string
+			r := &Resolver{
+				AccessGoogle: func(_ context.Context, name string) ([]byte, error) {
+					requested = name
+					if name == "projects/my-project/secrets/missing/versions/latest" {
+						return nil, errors.New("not found")
+					}
+					return []byte("google-secret"), nil
+				},
+				GetAWS: func(_ context.Context, region, arn string) (string, error) {
+					requested = region + " " + arn
+					return "aws-secret", nil
+				},
+			}
+
+			value, err := r.Resolve(context.Background(), tt.value)
+			if tt.errorMsg != "" {
+				assert.ErrorContains(t, err, tt.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, value)
+			assert.Equal(t, tt.requested, requested)
+		})
+	}
+}
@@ -5,22 +5,52 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"strings"
 	"time"
 )
 
 // Server represents an HTTP server with graceful shutdown capabilities
 type Server struct {
 	httpServer *http.Server
+	network    string
+	listenErr  error
 	logger     *slog.Logger
 }
 
 // Config holds the configuration for the HTTP server
 type Config struct {
-	Port   int
+	Port int
+	// Listen is the address to listen on, overriding Port if set:
+	// unix:///run/canopy.sock for a Unix domain socket, or tcp://host:port
+	// (see ParseListen)
+	Listen string
 	Logger *slog.Logger
 }
 
+// ParseListen splits a listen address into a network and address for
+// net.Listen. Supported forms are unix:///path/to/socket and tcp://host:port.
+func ParseListen(listen string) (network, address string, err error) {
+	scheme, address, ok := strings.Cut(listen, "://")
+	if !ok || address == "" {
+		return "", "", fmt.Errorf("invalid listen address %q: expected unix:///path/to/socket or tcp://host:port", listen)
+	}
+
+	switch scheme {
+	case "unix":
+		return "unix", address, nil
+	case "tcp":
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return "", "", fmt.Errorf("invalid listen address %q: %w", listen, err)
+		}
+		return "tcp", address, nil
+	default:
+		return "", "", fmt.Errorf("invalid listen address %q: unsupported scheme %q (expected unix or tcp)", listen, scheme)
+	}
+}
+
 // New creates a new HTTP server with the given configuration
 func New(cfg Config) *Server {
 	if cfg.Logger == nil {
@@ -29,9 +59,18 @@ func New(cfg Config) *Server {
 
 	mux := http.NewServeMux()
 
+	network, addr := "tcp", fmt.Sprintf(":%d", cfg.Port)
+	var listenErr error
+	if cfg.Listen != "" {
+		// An invalid address is reported by Start
+		network, addr, listenErr = ParseListen(cfg.Listen)
+	}
+
 	s := &Server{
+		network:   network,
+		listenErr: listenErr,
 		httpServer: &http.Server{
-			Addr:              fmt.Sprintf(":%d", cfg.Port),
+			Addr:              addr,
 			Handler:           mux,
 			ReadTimeout:       10 * time.Second,
 			WriteTimeout:      10 * time.Second,
@@ -54,15 +93,38 @@ func (s *Server) Mux() *http.ServeMux {
 
 // Start begins listening for HTTP requests
 func (s *Server) Start() error {
-	s.logger.Info("starting HTTP server", "addr", s.httpServer.Addr)
+	listener, err := s.listen()
+	if err != nil {
+		return fmt.Errorf("failed to start server: %w", err)
+	}
+
+	s.logger.Info("starting HTTP server", "network", s.network, "addr", s.httpServer.Addr)
 
-	if err := s.httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+	if err := s.httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		return fmt.Errorf("failed to start server: %w", err)
 	}
 
 	return nil
 }
 
+// listen opens the server's listener. A socket file left behind by a
+// previous process that didn't shut down cleanly is removed first; the
+// listener removes its socket file when closed.
+func (s *Server) listen() (net.Listener, error) {
+	if s.listenErr != nil {
+		return nil, s.listenErr
+	}
+
+	if s.network == "unix" {
+		if info, err := os.Stat(s.httpServer.Addr); err == nil && info.Mode()&os.ModeSocket != 0 {
+			if err := os.Remove(s.httpServer.Addr); err != nil {
+				return nil, fmt.Errorf("failed to remove stale socket %s: %w", s.httpServer.Addr, err)
+			}
+		}
+	}
+	return net.Listen(s.network, s.httpServer.Addr)
+}
+
 // Shutdown gracefully shuts down the server with a timeout
 func (s *Server) Shutdown(ctx context.Context) error {
 	s.logger.Info("shutting down HTTP server")
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseListen(t *testing.T) {
+	tests := []struct {
+		listen          string
+		expectedNetwork string
+		expectedAddress string
+		expectError     bool
+	}{
+		{listen: "unix:///run/canopy.sock", expectedNetwork: "unix", expectedAddress: "/run/canopy.sock"},
+		{listen: "unix://canopy.sock", expectedNetwork: "unix", expectedAddress: "canopy.sock"},
+		{listen: "tcp://127.0.0.1:8080", expectedNetwork: "tcp", expectedAddress: "127.0.0.1:8080"},
+		{listen: "tcp://:8080", expectedNetwork: "tcp", expectedAddress: ":8080"},
+		{listen: "tcp://localhost", expectError: true},
+		{listen: "unix://", expectError: true},
+		{listen: ":8080", expectError: true},
+		{listen: "http://:8080", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.listen, func(t *testing.T) {
+			network, address, err := ParseListen(tt.listen)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedNetwork, network)
+			assert.Equal(t, tt.expectedAddress, address)
+		})
+	}
+}
+
+func TestServer_UnixSocket(t *testing.T) {
+	// Socket paths are limited to ~100 bytes, which t.TempDir can exceed
+	dir, err := os.MkdirTemp("", "canopy")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "canopy.sock")
+
+	// A socket left behind by a previous process is replaced
+	stale, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	require.NoError(t, stale.Close())
+
+	s := New(Config{Listen: "unix://" + socket})
+	errCh := make(chan error, 1)
+	go func() { errCh <- s.Start() }()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+	require.Eventually(t, func() bool {
+		resp, err := client.Get("http://canopy/health")
+		if err != nil {
+			return false
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode == http.StatusOK && string(body) == `{"status":"ok"}`
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, s.Shutdown(context.Background()))
+	require.NoError(t, <-errCh)
+	_, err = os.Stat(socket)
+	assert.True(t, os.IsNotExist(err), "socket should be removed on shutdown")
+}
+
+func TestServer_InvalidListen(t *testing.T) {
+	s := New(Config{Listen: "udp://:8080"})
+	err := s.Start()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unsupported scheme")
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/api"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/badge"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/cache"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/config"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/queue"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/token"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/trend"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/upload"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/viewer"
+)
+
+// OpenTokens connects to the token store that authenticates query API and
+// upload requests; tokens are issued with canopy-admin.
+func OpenTokens(ctx context.Context, cfg *config.APIConfig) (*token.RedisStore, error) {
+	store, err := token.NewRedisStore(ctx, token.RedisConfig{
+		Address:  cfg.RedisAddr,
+		Password: cfg.RedisPassword,
+		DB:       cfg.RedisDB,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open token store: %w", err)
+	}
+	return store, nil
+}
+
+// APIDeps are the clients and stores the HTTP endpoints of a service use.
+type APIDeps struct {
+	Storage storage.Storage
+	// GitHub resolves the default branch of coverage requests that don't
+	// name a branch, and fetches the diffs the diff viewer renders
+	GitHub *github.Client
+	// Queue receives the work requests of uploaded coverage
+	Queue queue.MessageQueue
+	// Cache is the cache of Storage's reads, invalidated through
+	// cache.InvalidateRoute; nil if reads aren't cached
+	Cache *cache.Cache
+}
+
+// HasAPI reports whether cfg enables any of the endpoints RegisterAPI
+// registers.
+func HasAPI(cfg *config.Config) bool {
+	return cfg.API.Enabled || cfg.API.UploadEnabled || cfg.Badge.Enabled || cfg.Viewer.PublicURL != ""
+}
+
+// RegisterAPI registers the endpoints cfg enables on mux: coverage badges,
+// the diff viewer, the query API with coverage trends, and the upload
+// endpoint. The query API and uploads authenticate with tokens from the
+// token store, which is returned for the caller to close; it is nil if
+// neither is enabled. With the token store, the cache invalidation endpoint
+// is registered too.
+func RegisterAPI(ctx context.Context, mux *http.ServeMux, cfg *config.Config, deps APIDeps, logger *slog.Logger) (io.Closer, error) {
+	if cfg.Badge.Enabled {
+		badge.NewHandler(deps.Storage, cfg.Webhook.AllowedOrgs, cfg.Badge.Thresholds, logger).Register(mux)
+	}
+	if cfg.Viewer.PublicURL != "" && deps.GitHub != nil {
+		viewer.NewHandler(deps.Storage, deps.GitHub, logger).Register(mux)
+	}
+	if !cfg.API.Enabled && !cfg.API.UploadEnabled {
+		return nil, nil
+	}
+
+	tokens, err := OpenTokens(ctx, &cfg.API)
+	if err != nil {
+		return nil, err
+	}
+	manager := token.NewManager(tokens)
+	if cfg.API.Enabled {
+		layout, err := storage.ParseLayout(cfg.Storage.Layout)
+		if err != nil {
+			tokens.Close()
+			return nil, err
+		}
+		api.NewHandler(deps.Storage, layout, deps.GitHub, logger).Register(mux, manager)
+		trend.NewHandler(deps.Storage, deps.GitHub, logger).Register(mux, manager)
+	}
+	if cfg.API.UploadEnabled {
+		upload.NewHandler(deps.Storage, deps.Queue, logger).Register(mux, manager)
+	}
+	if deps.Cache != nil {
+		cache.NewHandler(deps.Cache, logger).Register(mux, manager)
+	}
+	return tokens, nil
+}
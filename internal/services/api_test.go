@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/cache"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/config"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github"
+)
+
+func TestRegisterAPI(t *testing.T) {
+	ctx := context.Background()
+	store, err := OpenStorage(ctx, &config.StorageConfig{Type: config.StorageTypeFS, FSRoot: t.TempDir()}, nil)
+	require.NoError(t, err)
+	defer store.Close()
+
+	status := func(mux *http.ServeMux, method, target string) int {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		return rec.Code
+	}
+
+	t.Run("badges only", func(t *testing.T) {
+		cfg := &config.Config{Badge: config.BadgeConfig{Enabled: true}}
+		mux := http.NewServeMux()
+		tokens, err := RegisterAPI(ctx, mux, cfg, APIDeps{Storage: store}, nil)
+		require.NoError(t, err)
+		assert.Nil(t, tokens)
+		assert.True(t, HasAPI(cfg))
+		assert.Equal(t, http.StatusOK, status(mux, http.MethodGet, "/badge/acme/widgets/main.svg"))
+		assert.Equal(t, http.StatusNotFound, status(mux, http.MethodGet, "/api/v1/repos"))
+		assert.Equal(t, http.StatusNotFound, status(mux, http.MethodGet, "/view/acme/widgets/compare/main"))
+	})
+
+	t.Run("diff viewer", func(t *testing.T) {
+		gh, err := github.NewClient(github.ClientConfig{Tokens: github.StaticToken("t")})
+		require.NoError(t, err)
+		cfg := &config.Config{Viewer: config.ViewerConfig{PublicURL: "https://canopy.example.com"}}
+		mux := http.NewServeMux()
+		tokens, err := RegisterAPI(ctx, mux, cfg, APIDeps{Storage: store, GitHub: gh}, nil)
+		require.NoError(t, err)
+		assert.Nil(t, tokens)
+		assert.True(t, HasAPI(cfg))
+		// A malformed compare is rejected before GitHub is asked for the diff
+		assert.Equal(t, http.StatusBadRequest, status(mux, http.MethodGet, "/view/acme/widgets/compare/main"))
+	})
+
+	t.Run("query API and uploads", func(t *testing.T) {
+		server := miniredis.RunT(t)
+		cfg := &config.Config{API: config.APIConfig{Enabled: true, UploadEnabled: true, RedisAddr: server.Addr()}}
+		mux := http.NewServeMux()
+		tokens, err := RegisterAPI(ctx, mux, cfg, APIDeps{Storage: store, Cache: cache.New(cache.NewInMemoryGenerations(), 0)}, nil)
+		require.NoError(t, err)
+		require.NotNil(t, tokens)
+		defer tokens.Close()
+		assert.Equal(t, http.StatusUnauthorized, status(mux, http.MethodGet, "/api/v1/repos"))
+		assert.Equal(t, http.StatusUnauthorized, status(mux, http.MethodPost, "/admin/cache/invalidate"))
+		assert.Equal(t, http.StatusUnauthorized, status(mux, http.MethodGet, "/api/v1/repos/acme/widgets/trend"))
+		assert.Equal(t, http.StatusUnauthorized, status(mux, http.MethodPost, "/api/v1/upload"))
+	})
+
+	t.Run("token store unavailable", func(t *testing.T) {
+		server := miniredis.RunT(t)
+		addr := server.Addr()
+		server.Close()
+		_, err := RegisterAPI(ctx, http.NewServeMux(), &config.Config{API: config.APIConfig{Enabled: true, RedisAddr: addr}}, APIDeps{Storage: store}, nil)
+		assert.ErrorContains(t, err, "failed to open token store")
+	})
+
+	t.Run("nothing enabled", func(t *testing.T) {
+		assert.False(t, HasAPI(&config.Config{}))
+	})
+}
@@ -0,0 +1,113 @@
+// Package services opens the queue and storage backends the Canopy services
+// are configured with, so that every binary opens them the same way.
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/config"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/queue"
+)
+
+// OpenQueue opens the configured queue. The in-memory queue connects the
+// webhook handler and worker of an all-in-one process; Redis, Pub/Sub, and
+// Kafka are shared by separately deployed services. component names the
+// process to the queue, e.g. worker, in its Redis consumer name. With
+// signing keys, the queue signs and verifies work requests.
+func OpenQueue(ctx context.Context, cfg *config.QueueConfig, component string, logger *slog.Logger) (queue.MessageQueue, error) {
+	mq, err := openQueueBackend(ctx, cfg, component, logger)
+	if err != nil || len(cfg.SigningKeys) == 0 {
+		return mq, err
+	}
+	return queue.NewSignedQueue(mq, queue.SigningConfig{
+		Keys:          cfg.SigningKeys,
+		AllowUnsigned: cfg.AllowUnsigned,
+		Logger:        logger,
+	}), nil
+}
+
+// openQueueBackend opens the configured queue backend.
+func openQueueBackend(ctx context.Context, cfg *config.QueueConfig, component string, logger *slog.Logger) (queue.MessageQueue, error) {
+	switch cfg.Type {
+	case config.QueueTypeInMemory:
+		return queue.NewInMemoryQueue(queue.InMemoryConfig{Logger: logger}), nil
+	case config.QueueTypeRedis:
+		hostname, _ := os.Hostname()
+		return queue.NewRedisQueue(ctx, queue.RedisConfig{
+			Address:             cfg.RedisAddr,
+			Password:            cfg.RedisPassword,
+			DB:                  cfg.RedisDB,
+			StreamKey:           cfg.RedisStream,
+			ConsumerGroup:       cfg.RedisConsumerGroup,
+			ConsumerName:        fmt.Sprintf("%s-%s-%d", component, hostname, os.Getpid()),
+			CreateIfNotExists:   true,
+			MaxDeliveries:       int64(cfg.MaxDeliveries),
+			DeadLetterStreamKey: cfg.RedisDeadLetterStream,
+			RetryAfter:          cfg.RedisRetryAfter,
+			Logger:              logger,
+		})
+	case config.QueueTypePubSub:
+		return queue.NewPubSubQueue(ctx, queue.PubSubConfig{
+			ProjectID:                  cfg.PubSubProjectID,
+			TopicName:                  cfg.PubSubTopicID,
+			SubscriptionName:           cfg.PubSubSubscription,
+			CreateIfNotExists:          true,
+			MaxDeliveries:              cfg.MaxDeliveries,
+			DeadLetterTopicName:        cfg.PubSubDeadLetterTopicID,
+			DeadLetterSubscriptionName: cfg.PubSubDeadLetterSubscription,
+			Logger:                     logger,
+		})
+	case config.QueueTypeKafka:
+		tlsConfig, err := kafkaTLSConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return queue.NewKafkaQueue(ctx, queue.KafkaConfig{
+			Brokers:           cfg.KafkaBrokers,
+			Topic:             cfg.KafkaTopic,
+			ConsumerGroup:     cfg.KafkaConsumerGroup,
+			TLS:               tlsConfig,
+			SASLMechanism:     cfg.KafkaSASLMechanism,
+			SASLUsername:      cfg.KafkaSASLUsername,
+			SASLPassword:      cfg.KafkaSASLPassword,
+			CreateIfNotExists: true,
+			MaxDeliveries:     cfg.MaxDeliveries,
+			DeadLetterTopic:   cfg.KafkaDeadLetterTopic,
+			Logger:            logger,
+		})
+	default:
+		return nil, fmt.Errorf("unsupported queue type: %s", cfg.Type)
+	}
+}
+
+// kafkaTLSConfig returns the TLS configuration of the Kafka brokers, or nil
+// if they are reached without TLS.
+func kafkaTLSConfig(cfg *config.QueueConfig) (*tls.Config, error) {
+	if !cfg.KafkaTLS {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.KafkaTLSCAFile != "" {
+		pem, err := os.ReadFile(cfg.KafkaTLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CANOPY_KAFKA_TLS_CA_FILE: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("invalid CANOPY_KAFKA_TLS_CA_FILE: no PEM certificates")
+		}
+	}
+	if cfg.KafkaTLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.KafkaTLSCertFile, cfg.KafkaTLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load Kafka client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kfake"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/config"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/queue"
+)
+
+func TestOpenQueue(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("in-memory", func(t *testing.T) {
+		mq, err := OpenQueue(ctx, &config.QueueConfig{Type: config.QueueTypeInMemory}, "test", nil)
+		require.NoError(t, err)
+		defer mq.Close()
+		assert.IsType(t, &queue.InMemoryQueue{}, mq)
+	})
+
+	t.Run("kafka with TLS and SASL", func(t *testing.T) {
+		certFile, keyFile := writeTestCertificate(t)
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		require.NoError(t, err)
+		cluster, err := kfake.NewCluster(
+			kfake.NumBrokers(1),
+			kfake.TLS(&tls.Config{Certificates: []tls.Certificate{cert}}),
+			kfake.EnableSASL(),
+			kfake.Superuser("SCRAM-SHA-512", "canopy", "secret"),
+		)
+		require.NoError(t, err)
+		defer cluster.Close()
+
+		mq, err := OpenQueue(ctx, &config.QueueConfig{
+			Type:               config.QueueTypeKafka,
+			KafkaBrokers:       cluster.ListenAddrs(),
+			KafkaTopic:         "test-topic",
+			KafkaConsumerGroup: "test-group",
+			KafkaTLS:           true,
+			KafkaTLSCAFile:     certFile,
+			KafkaSASLMechanism: "SCRAM-SHA-512",
+			KafkaSASLUsername:  "canopy",
+			KafkaSASLPassword:  "secret",
+		}, "test", nil)
+		require.NoError(t, err)
+		defer mq.Close()
+		assert.NoError(t, mq.Publish(ctx, &queue.WorkRequest{Org: "acme", Repo: "widgets", WorkflowRunID: 1}))
+	})
+
+	t.Run("signed", func(t *testing.T) {
+		mq, err := OpenQueue(ctx, &config.QueueConfig{Type: config.QueueTypeInMemory, SigningKeys: []string{"key"}}, "test", nil)
+		require.NoError(t, err)
+		defer mq.Close()
+		assert.IsType(t, &queue.SignedQueue{}, mq)
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		_, err := OpenQueue(ctx, &config.QueueConfig{Type: "carrier-pigeon"}, "test", nil)
+		assert.ErrorContains(t, err, "unsupported queue type: carrier-pigeon")
+	})
+}
+
+func TestKafkaTLSConfig(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t)
+	invalidFile := filepath.Join(t.TempDir(), "invalid.pem")
+	require.NoError(t, os.WriteFile(invalidFile, []byte("not a certificate"), 0600))
+
+	tests := []struct {
+		name         string
+		cfg          config.QueueConfig
+		expectTLS    bool
+		expectRoots  bool
+		expectClient bool
+		errorMsg     string
+	}{
+		{name: "disabled"},
+		{name: "system roots", cfg: config.QueueConfig{KafkaTLS: true}, expectTLS: true},
+		{name: "CA file", cfg: config.QueueConfig{KafkaTLS: true, KafkaTLSCAFile: certFile}, expectTLS: true, expectRoots: true},
+		{
+			name:         "client certificate",
+			cfg:          config.QueueConfig{KafkaTLS: true, KafkaTLSCertFile: certFile, KafkaTLSKeyFile: keyFile},
+			expectTLS:    true,
+			expectClient: true,
+		},
+		{
+			name:     "missing CA file",
+			cfg:      config.QueueConfig{KafkaTLS: true, KafkaTLSCAFile: filepath.Join(t.TempDir(), "missing.pem")},
+			errorMsg: "failed to read CANOPY_KAFKA_TLS_CA_FILE",
+		},
+		{
+			name:     "invalid CA file",
+			cfg:      config.QueueConfig{KafkaTLS: true, KafkaTLSCAFile: invalidFile},
+			errorMsg: "invalid CANOPY_KAFKA_TLS_CA_FILE: no PEM certificates",
+		},
+		{
+			name:     "invalid key",
+			cfg:      config.QueueConfig{KafkaTLS: true, KafkaTLSCertFile: certFile, KafkaTLSKeyFile: invalidFile},
+			errorMsg: "failed to load Kafka client certificate",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tlsConfig, err := kafkaTLSConfig(&tt.cfg)
+			if tt.errorMsg != "" {
+				assert.ErrorContains(t, err, tt.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+			if !tt.expectTLS {
+				assert.Nil(t, tlsConfig)
+				return
+			}
+			require.NotNil(t, tlsConfig)
+			assert.Equal(t, tt.expectRoots, tlsConfig.RootCAs != nil)
+			assert.Equal(t, tt.expectClient, len(tlsConfig.Certificates) == 1)
+		})
+	}
+}
+
+// writeTestCertificate writes a self-signed certificate for 127.0.0.1 and
+// its key, and returns their files.
+func writeTestCertificate(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certFile, keyFile
+}
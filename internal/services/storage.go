@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/cache"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/config"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage/encrypted"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage/fs"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage/gcs"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage/minio"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage/s3"
+)
+
+// OpenCache creates the cache of a worker's storage reads, which expires
+// entries after cfg.Worker.CacheTTL; it returns nil if the TTL isn't
+// positive. With a Redis queue, invalidations are shared through the
+// queue's Redis with every worker; otherwise only writes and invalidations
+// through this process drop its entries, and other processes see them once
+// their entries expire. The caller must Close the cache.
+func OpenCache(ctx context.Context, cfg *config.Config) (*cache.Cache, error) {
+	if cfg.Worker.CacheTTL <= 0 {
+		return nil, nil
+	}
+	if cfg.Queue.Type != config.QueueTypeRedis {
+		return cache.New(cache.NewInMemoryGenerations(), cfg.Worker.CacheTTL), nil
+	}
+	generations, err := cache.NewRedisGenerations(ctx, cache.RedisConfig{
+		Address:  cfg.Queue.RedisAddr,
+		Password: cfg.Queue.RedisPassword,
+		DB:       cfg.Queue.RedisDB,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cache: %w", err)
+	}
+	return cache.New(generations, cfg.Worker.CacheTTL), nil
+}
+
+// OpenStorage opens the configured storage backend, instrumented with
+// storage metrics, encrypting content if a key is set and caching reads in
+// c if it isn't nil (see OpenCache).
+func OpenStorage(ctx context.Context, cfg *config.StorageConfig, c *cache.Cache) (storage.Storage, error) {
+	layout, err := storage.ParseLayout(cfg.Layout)
+	if err != nil {
+		return nil, err
+	}
+
+	var store storage.Storage
+	switch cfg.Type {
+	case config.StorageTypeGCS:
+		store, err = gcs.NewGCSStorage(ctx, cfg.GCSBucket, layout)
+	case config.StorageTypeMinio:
+		store, err = minio.NewMinIOStorage(ctx, minio.MinIOConfig{
+			Endpoint:        cfg.MinIOEndpoint,
+			AccessKeyID:     cfg.MinIOAccessKey,
+			SecretAccessKey: cfg.MinIOSecretKey,
+			UseSSL:          cfg.MinIOUseSSL,
+			Bucket:          cfg.MinIOBucket,
+			Layout:          layout,
+		})
+	case config.StorageTypeS3:
+		store, err = s3.NewS3Storage(ctx, s3.S3Config{
+			Bucket:   cfg.S3Bucket,
+			Region:   cfg.S3Region,
+			Endpoint: cfg.S3Endpoint,
+			Layout:   layout,
+		})
+	case config.StorageTypeFS:
+		store, err = fs.NewFSStorage(cfg.FSRoot, layout)
+	default:
+		err = fmt.Errorf("unsupported storage type: %s", cfg.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open storage: %w", err)
+	}
+	store = storage.NewInstrumentedStorage(store, string(cfg.Type))
+
+	if cfg.EncryptionKey != "" {
+		key, err := encrypted.ParseBase64Key(cfg.EncryptionKey)
+		if err != nil {
+			store.Close()
+			return nil, err
+		}
+		wrapped, err := encrypted.NewEncryptedStorage(ctx, store, key, encrypted.Options{
+			AllowPlaintext: cfg.EncryptionAllowPlaintext,
+		})
+		if err != nil {
+			store.Close()
+			return nil, err
+		}
+		store = wrapped
+	}
+
+	if c != nil {
+		store = cache.NewCachedStorage(store, c)
+	}
+	return store, nil
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/cache"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/config"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage/encrypted"
+)
+
+func TestOpenCache(t *testing.T) {
+	ctx := context.Background()
+	scope := cache.Scope{Org: "acme", Repo: "widgets"}
+
+	t.Run("disabled", func(t *testing.T) {
+		c, err := OpenCache(ctx, &config.Config{})
+		require.NoError(t, err)
+		assert.Nil(t, c)
+	})
+
+	t.Run("in memory without a Redis queue", func(t *testing.T) {
+		c, err := OpenCache(ctx, &config.Config{Queue: config.QueueConfig{Type: config.QueueTypePubSub}, Worker: config.WorkerConfig{CacheTTL: time.Minute}})
+		require.NoError(t, err)
+		require.NotNil(t, c)
+		defer c.Close()
+		assert.NoError(t, c.Invalidate(ctx, scope))
+	})
+
+	t.Run("shared through the queue's Redis", func(t *testing.T) {
+		server := miniredis.RunT(t)
+		cfg := &config.Config{
+			Queue:  config.QueueConfig{Type: config.QueueTypeRedis, RedisAddr: server.Addr()},
+			Worker: config.WorkerConfig{CacheTTL: time.Minute},
+		}
+		c, err := OpenCache(ctx, cfg)
+		require.NoError(t, err)
+		require.NotNil(t, c)
+		defer c.Close()
+		require.NoError(t, c.Invalidate(ctx, scope))
+		assert.NotEmpty(t, server.Keys(), "invalidations are recorded in Redis")
+	})
+}
+
+func TestOpenStorage(t *testing.T) {
+	ctx := context.Background()
+	key := base64.StdEncoding.EncodeToString(make([]byte, 32))
+
+	t.Run("unsupported", func(t *testing.T) {
+		_, err := OpenStorage(ctx, &config.StorageConfig{Type: "tape"}, nil)
+		assert.ErrorContains(t, err, "unsupported storage type: tape")
+	})
+
+	t.Run("invalid layout", func(t *testing.T) {
+		_, err := OpenStorage(ctx, &config.StorageConfig{Type: config.StorageTypeFS, FSRoot: t.TempDir(), Layout: "nested"}, nil)
+		assert.ErrorContains(t, err, `invalid storage layout "nested"`)
+	})
+
+	t.Run("encrypted", func(t *testing.T) {
+		root := t.TempDir()
+		store, err := OpenStorage(ctx, &config.StorageConfig{Type: config.StorageTypeFS, FSRoot: root, EncryptionKey: key}, nil)
+		require.NoError(t, err)
+		defer store.Close()
+		coverageKey := storage.CoverageKey{Org: "acme", Repo: "widgets", Branch: "main"}
+		require.NoError(t, store.SaveCoverage(ctx, coverageKey, []byte("mode: set\n")))
+
+		data, err := store.GetCoverage(ctx, coverageKey)
+		require.NoError(t, err)
+		assert.Equal(t, "mode: set\n", string(data))
+
+		// The backend only holds ciphertext
+		plain, err := OpenStorage(ctx, &config.StorageConfig{Type: config.StorageTypeFS, FSRoot: root}, nil)
+		require.NoError(t, err)
+		defer plain.Close()
+		data, err = plain.GetCoverage(ctx, coverageKey)
+		require.NoError(t, err)
+		assert.NotEqual(t, "mode: set\n", string(data))
+
+		// Coverage written without encryption isn't read back
+		plainKey := storage.CoverageKey{Org: "acme", Repo: "widgets", Branch: "plain"}
+		require.NoError(t, plain.SaveCoverage(ctx, plainKey, []byte("mode: set\n")))
+		_, err = store.GetCoverage(ctx, plainKey)
+		assert.ErrorIs(t, err, encrypted.ErrNotEncrypted)
+	})
+
+	// Pruning goes through every wrapper of the backend: the metrics,
+	// encryption, and cache
+	t.Run("prunes through every wrapper", func(t *testing.T) {
+		store, err := OpenStorage(ctx, &config.StorageConfig{
+			Type:          config.StorageTypeFS,
+			FSRoot:        t.TempDir(),
+			Layout:        storage.LayoutCommit,
+			EncryptionKey: key,
+		}, cache.New(cache.NewInMemoryGenerations(), time.Hour))
+		require.NoError(t, err)
+		defer store.Close()
+
+		branchKey := storage.CoverageKey{Org: "acme", Repo: "widgets", Branch: "main"}
+		commitKey := branchKey
+		commitKey.Commit = "abc123"
+		require.NoError(t, store.SaveCoverage(ctx, branchKey, []byte("mode: set\n")))
+		require.NoError(t, store.SaveCoverage(ctx, commitKey, []byte("mode: set\n")))
+		data, err := store.GetCoverage(ctx, commitKey)
+		require.NoError(t, err)
+		require.NotNil(t, data)
+
+		pruner, ok := store.(storage.Pruner)
+		require.True(t, ok, "the opened storage must support pruning")
+		pruned, err := storage.Prune(ctx, pruner, storage.RetentionPolicy{OlderThan: time.Hour}, time.Now().Add(2*time.Hour), false)
+		require.NoError(t, err)
+		require.Len(t, pruned, 1)
+		assert.Equal(t, "acme/widgets/main/commits/abc123/coverage.out", pruned[0].Path)
+
+		// The pruned commit isn't served from the cache, and the branch's
+		// latest coverage is kept
+		data, err = store.GetCoverage(ctx, commitKey)
+		require.NoError(t, err)
+		assert.Nil(t, data)
+		data, err = store.GetCoverage(ctx, branchKey)
+		require.NoError(t, err)
+		assert.Equal(t, "mode: set\n", string(data))
+	})
+}
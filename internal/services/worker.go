@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/config"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github/auth"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/gitlab"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/idempotency"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/worker"
+)
+
+// NewGitHubClient creates a GitHub client authenticated as the app
+// installation of each request (see auth.WithInstallation), or the
+// configured default installation.
+func NewGitHubClient(cfg *config.GitHubConfig) (*github.Client, error) {
+	tokens, err := auth.NewInstallations(github.AppConfig{
+		AppID:          cfg.AppID,
+		InstallationID: cfg.InstallationID,
+		PrivateKey:     cfg.PrivateKey,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitHub App credentials: %w", err)
+	}
+	return github.NewClient(github.ClientConfig{Tokens: tokens})
+}
+
+// NewGitLabClient creates the GitLab client of the worker, or returns nil if
+// no GitLab token is configured.
+func NewGitLabClient(cfg *config.GitLabConfig) (worker.GitLab, error) {
+	if cfg.Token == "" {
+		return nil, nil
+	}
+	client, err := gitlab.NewClient(gitlab.ClientConfig{BaseURL: cfg.BaseURL, Token: cfg.Token})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GitLab client: %w", err)
+	}
+	return client, nil
+}
+
+// OpenIdempotency opens the store that detects repeated deliveries of work
+// requests, or returns nil if ttl disables it. Workers sharing a Redis
+// queue share its Redis instance; with other queues only deliveries to this
+// process are detected.
+func OpenIdempotency(ctx context.Context, cfg *config.QueueConfig, ttl time.Duration) (idempotency.Store, error) {
+	if ttl == 0 {
+		return nil, nil
+	}
+	if cfg.Type != config.QueueTypeRedis {
+		return idempotency.NewInMemoryStore(), nil
+	}
+	store, err := idempotency.NewRedisStore(ctx, idempotency.RedisConfig{
+		Address:  cfg.RedisAddr,
+		Password: cfg.RedisPassword,
+		DB:       cfg.RedisDB,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open idempotency store: %w", err)
+	}
+	return store, nil
+}
+
+// WorkerDeps are the clients and stores a worker uses, opened by the
+// binary running it.
+type WorkerDeps struct {
+	GitHub *github.Client
+	// GitLab is nil without a GitLab token
+	GitLab  worker.GitLab
+	Storage storage.Storage
+	// Idempotency is nil if repeated deliveries aren't detected
+	Idempotency idempotency.Store
+}
+
+// NewWorker creates the worker of the configured settings, with its own
+// Concurrency to subscribe to the queue with.
+func NewWorker(cfg *config.Config, deps WorkerDeps, version string, logger *slog.Logger) (*worker.Worker, error) {
+	w := &worker.Worker{
+		GitHub:                  deps.GitHub,
+		GitLab:                  deps.GitLab,
+		Storage:                 deps.Storage,
+		MaxRunAge:               cfg.Worker.MaxRunAge,
+		ArtifactStorageFallback: cfg.Worker.ArtifactStorageFallback,
+		ArtifactPatterns:        cfg.Worker.ArtifactPatterns,
+		ArtifactMaxSize:         cfg.Worker.ArtifactMaxSize,
+		ArtifactSpoolThreshold:  cfg.Worker.ArtifactSpoolThreshold,
+		MemoryBudget:            cfg.Worker.MemoryBudget,
+		ShardedBaselines:        cfg.Worker.ShardedBaselines,
+		CommitBaselines:         cfg.Storage.Layout == storage.LayoutCommit,
+		RemapStaleCoverage:      cfg.Worker.RemapStaleCoverage,
+		CheckRunDetails:         cfg.Worker.CheckRunDetails,
+		ExportFormats:           cfg.Worker.ExportFormats,
+		CoverageLabels:          cfg.GitHub.CoverageLabels,
+		ViewerURL:               cfg.Viewer.PublicURL,
+		DefaultThresholds:       cfg.Worker.DefaultThresholds,
+		GitHubRequestLimit:      cfg.Worker.GitHubRequestLimit,
+		GitHubQuotaReserve:      cfg.Worker.GitHubQuotaReserve,
+		Concurrency:             worker.NewConcurrency(cfg.Worker.Concurrency),
+		Idempotency:             deps.Idempotency,
+		IdempotencyTTL:          cfg.Worker.IdempotencyTTL,
+		Version:                 version,
+		Logger:                  logger,
+	}
+	if cfg.Worker.OrgConfigTTL > 0 {
+		reader, ok := deps.Storage.(storage.ObjectReader)
+		if !ok {
+			return nil, fmt.Errorf("org configs need a storage that can read objects, got %T", deps.Storage)
+		}
+		w.OrgConfigs = &worker.OrgConfigs{Storage: reader, TTL: cfg.Worker.OrgConfigTTL, Logger: logger}
+	}
+	return w, nil
+}
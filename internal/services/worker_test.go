@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/config"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/idempotency"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+)
+
+func TestOpenIdempotency(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("disabled", func(t *testing.T) {
+		store, err := OpenIdempotency(ctx, &config.QueueConfig{Type: config.QueueTypeRedis}, 0)
+		require.NoError(t, err)
+		assert.Nil(t, store)
+	})
+
+	t.Run("in memory without a Redis queue", func(t *testing.T) {
+		store, err := OpenIdempotency(ctx, &config.QueueConfig{Type: config.QueueTypeInMemory}, time.Hour)
+		require.NoError(t, err)
+		defer store.Close()
+		assert.IsType(t, &idempotency.InMemoryStore{}, store)
+	})
+
+	t.Run("on the queue's Redis", func(t *testing.T) {
+		server := miniredis.RunT(t)
+		store, err := OpenIdempotency(ctx, &config.QueueConfig{Type: config.QueueTypeRedis, RedisAddr: server.Addr()}, time.Hour)
+		require.NoError(t, err)
+		defer store.Close()
+		assert.IsType(t, &idempotency.RedisStore{}, store)
+	})
+}
+
+func TestNewGitLabClient(t *testing.T) {
+	client, err := NewGitLabClient(&config.GitLabConfig{})
+	require.NoError(t, err)
+	assert.True(t, client == nil, "no token leaves the worker without GitLab")
+
+	client, err = NewGitLabClient(&config.GitLabConfig{BaseURL: "https://gitlab.example.com", Token: "token"})
+	require.NoError(t, err)
+	assert.NotNil(t, client)
+}
+
+func TestNewWorker(t *testing.T) {
+	store, err := OpenStorage(context.Background(), &config.StorageConfig{Type: config.StorageTypeFS, FSRoot: t.TempDir()}, nil)
+	require.NoError(t, err)
+	defer store.Close()
+
+	cfg := &config.Config{
+		Storage: config.StorageConfig{Layout: storage.LayoutCommit},
+		GitHub:  config.GitHubConfig{CoverageLabels: []github.LabelBand{{Label: "well-tested", Min: 90, Max: 100}}},
+		Viewer:  config.ViewerConfig{PublicURL: "https://canopy.example.com"},
+		Worker:  config.WorkerConfig{Concurrency: 3, MaxRunAge: time.Hour, ArtifactStorageFallback: true, OrgConfigTTL: time.Minute},
+	}
+
+	t.Run("applies the settings", func(t *testing.T) {
+		w, err := NewWorker(cfg, WorkerDeps{Storage: store}, "v1.2.3", nil)
+		require.NoError(t, err)
+		assert.Equal(t, 3, w.Concurrency.Limit())
+		assert.Equal(t, time.Hour, w.MaxRunAge)
+		assert.True(t, w.ArtifactStorageFallback)
+		assert.True(t, w.CommitBaselines)
+		assert.Equal(t, "v1.2.3", w.Version)
+		assert.Equal(t, cfg.GitHub.CoverageLabels, w.CoverageLabels)
+		assert.Equal(t, "https://canopy.example.com", w.ViewerURL)
+		require.NotNil(t, w.OrgConfigs)
+		assert.Equal(t, time.Minute, w.OrgConfigs.TTL)
+	})
+
+	t.Run("org configs need a readable storage", func(t *testing.T) {
+		_, err := NewWorker(cfg, WorkerDeps{Storage: struct{ storage.Storage }{store}}, "v1.2.3", nil)
+		assert.ErrorContains(t, err, "org configs need a storage that can read objects")
+	})
+}
@@ -0,0 +1,245 @@
+package encrypted
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+
+	storagepkg "github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+)
+
+// magic prefixes every encrypted object so reads can tell encrypted data
+// from plaintext objects written before encryption was enabled.
+var magic = []byte("CNPYENC1")
+
+// ErrNotEncrypted is returned when reading an object without the encryption
+// header, unless Options.AllowPlaintext is set.
+var ErrNotEncrypted = errors.New("coverage object is not encrypted")
+
+// KeyProvider supplies the data encryption key.
+// The env-based provider is the default; KMS-backed providers can implement
+// this interface to unwrap a data key at startup.
+type KeyProvider interface {
+	// Key returns an AES key of 16, 24, or 32 bytes.
+	Key(ctx context.Context) ([]byte, error)
+}
+
+// StaticKey is a KeyProvider that returns a fixed key.
+type StaticKey []byte
+
+// Key implements KeyProvider.
+func (k StaticKey) Key(ctx context.Context) ([]byte, error) {
+	return k, nil
+}
+
+// ParseBase64Key decodes a base64-encoded AES key and validates its length.
+func ParseBase64Key(encoded string) (StaticKey, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("encryption key is not valid base64: %w", err)
+	}
+	if err := validateKeyLength(key); err != nil {
+		return nil, err
+	}
+	return StaticKey(key), nil
+}
+
+// EncryptedStorage wraps a Storage and encrypts coverage payloads with AES-GCM
+// before they are written, decrypting them transparently on read.
+// Coverage leaks file paths and code structure, so this protects it
+// even where bucket-level encryption isn't considered sufficient.
+type EncryptedStorage struct {
+	inner          storagepkg.Storage
+	aead           cipher.AEAD
+	allowPlaintext bool
+}
+
+// Options configures an EncryptedStorage.
+type Options struct {
+	// AllowPlaintext returns objects without the encryption header as-is,
+	// so coverage written before encryption was enabled stays readable
+	// while it is migrated. Otherwise reading them fails with
+	// ErrNotEncrypted, so an object written to the bucket by anyone but
+	// Canopy isn't trusted as coverage.
+	AllowPlaintext bool
+}
+
+// NewEncryptedStorage creates an EncryptedStorage around inner using the key
+// from the given provider.
+func NewEncryptedStorage(ctx context.Context, inner storagepkg.Storage, keys KeyProvider, opts Options) (*EncryptedStorage, error) {
+	if inner == nil {
+		return nil, errors.New("inner storage is required")
+	}
+	if keys == nil {
+		return nil, errors.New("key provider is required")
+	}
+
+	key, err := keys.Key(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load encryption key: %w", err)
+	}
+	if err := validateKeyLength(key); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+
+	return &EncryptedStorage{
+		inner:          inner,
+		aead:           aead,
+		allowPlaintext: opts.AllowPlaintext,
+	}, nil
+}
+
+// SaveCoverage encrypts data and stores it for the given key.
+// The object path is bound as additional data so ciphertext can't be
+// moved between repositories or branches undetected.
+func (e *EncryptedStorage) SaveCoverage(ctx context.Context, key storagepkg.CoverageKey, data []byte) error {
+	objectPath, err := storagepkg.FormatObjectPath(key)
+	if err != nil {
+		return err
+	}
+
+	sealed, err := e.encrypt(data, []byte(objectPath))
+	if err != nil {
+		return err
+	}
+
+	return e.inner.SaveCoverage(ctx, key, sealed)
+}
+
+// GetCoverage retrieves and decrypts coverage data for the given key.
+// Returns nil if the coverage file does not exist.
+// Objects without the encryption header are returned as-is with
+// Options.AllowPlaintext, and fail with ErrNotEncrypted otherwise.
+func (e *EncryptedStorage) GetCoverage(ctx context.Context, key storagepkg.CoverageKey) ([]byte, error) {
+	objectPath, err := storagepkg.FormatObjectPath(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := e.inner.GetCoverage(ctx, key)
+	if err != nil || data == nil {
+		return data, err
+	}
+
+	if !bytes.HasPrefix(data, magic) {
+		if e.allowPlaintext {
+			return data, nil
+		}
+		return nil, fmt.Errorf("%w: %s", ErrNotEncrypted, objectPath)
+	}
+
+	return e.decrypt(data, []byte(objectPath))
+}
+
+// SaveCoverageReader encrypts data from a reader and stores it.
+// AES-GCM authenticates the whole payload, so the reader is buffered in memory.
+func (e *EncryptedStorage) SaveCoverageReader(ctx context.Context, key storagepkg.CoverageKey, reader io.Reader, size int64) error {
+	if reader == nil {
+		return errors.New("reader is nil")
+	}
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("failed to read coverage data: %w", err)
+	}
+
+	return e.SaveCoverage(ctx, key, data)
+}
+
+// Close releases resources held by the wrapped storage.
+func (e *EncryptedStorage) Close() error {
+	return e.inner.Close()
+}
+
+// ListObjects lists the objects of the wrapped storage, if it implements
+// storagepkg.Pruner. Paths and times aren't encrypted.
+func (e *EncryptedStorage) ListObjects(ctx context.Context, prefix string) ([]storagepkg.ObjectInfo, error) {
+	pruner, err := e.pruner()
+	if err != nil {
+		return nil, err
+	}
+	return pruner.ListObjects(ctx, prefix)
+}
+
+// DeleteObject deletes an object of the wrapped storage, if it implements
+// storagepkg.Pruner.
+func (e *EncryptedStorage) DeleteObject(ctx context.Context, objectPath string) error {
+	pruner, err := e.pruner()
+	if err != nil {
+		return err
+	}
+	return pruner.DeleteObject(ctx, objectPath)
+}
+
+// GetObject reads an object of the wrapped storage, if it implements
+// storagepkg.ObjectReader. Objects outside the coverage layout, such as
+// org configs, are written by operators and aren't encrypted.
+func (e *EncryptedStorage) GetObject(ctx context.Context, path string) ([]byte, error) {
+	reader, ok := e.inner.(storagepkg.ObjectReader)
+	if !ok {
+		return nil, fmt.Errorf("%T can't read objects", e.inner)
+	}
+	return reader.GetObject(ctx, path)
+}
+
+// pruner returns the wrapped storage as a storagepkg.Pruner.
+func (e *EncryptedStorage) pruner() (storagepkg.Pruner, error) {
+	pruner, ok := e.inner.(storagepkg.Pruner)
+	if !ok {
+		return nil, fmt.Errorf("%T can't list or delete objects", e.inner)
+	}
+	return pruner, nil
+}
+
+// encrypt seals plaintext as: magic | nonce | ciphertext+tag.
+func (e *EncryptedStorage) encrypt(plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, e.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	out := make([]byte, 0, len(magic)+len(nonce)+len(plaintext)+e.aead.Overhead())
+	out = append(out, magic...)
+	out = append(out, nonce...)
+	return e.aead.Seal(out, nonce, plaintext, additionalData), nil
+}
+
+// decrypt opens data produced by encrypt.
+func (e *EncryptedStorage) decrypt(data, additionalData []byte) ([]byte, error) {
+	payload := data[len(magic):]
+	nonceSize := e.aead.NonceSize()
+	if len(payload) < nonceSize+e.aead.Overhead() {
+		return nil, errors.New("encrypted coverage data is truncated")
+	}
+
+	plaintext, err := e.aead.Open(nil, payload[:nonceSize], payload[nonceSize:], additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt coverage data: %w", err)
+	}
+	return plaintext, nil
+}
+
+// validateKeyLength checks that key is a valid AES key size.
+func validateKeyLength(key []byte) error {
+	switch len(key) {
+	case 16, 24, 32:
+		return nil
+	default:
+		return fmt.Errorf("invalid encryption key length: %d bytes (must be 16, 24, or 32)", len(key))
+	}
+}
@@ -0,0 +1,267 @@
+package encrypted
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	storagepkg "github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+)
+
+// memoryStorage is a minimal in-memory Storage for testing the decorator.
+type memoryStorage struct {
+	data   map[string][]byte
+	closed bool
+}
+
+func newMemoryStorage() *memoryStorage {
+	return &memoryStorage{data: make(map[string][]byte)}
+}
+
+func (m *memoryStorage) SaveCoverage(ctx context.Context, key storagepkg.CoverageKey, data []byte) error {
+	objectPath, err := storagepkg.FormatObjectPath(key)
+	if err != nil {
+		return err
+	}
+	m.data[objectPath] = data
+	return nil
+}
+
+func (m *memoryStorage) GetCoverage(ctx context.Context, key storagepkg.CoverageKey) ([]byte, error) {
+	objectPath, err := storagepkg.FormatObjectPath(key)
+	if err != nil {
+		return nil, err
+	}
+	return m.data[objectPath], nil
+}
+
+// objectPath returns the object path of a valid key.
+func objectPath(t *testing.T, key storagepkg.CoverageKey) string {
+	path, err := storagepkg.FormatObjectPath(key)
+	require.NoError(t, err)
+	return path
+}
+
+func (m *memoryStorage) SaveCoverageReader(ctx context.Context, key storagepkg.CoverageKey, reader io.Reader, size int64) error {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	return m.SaveCoverage(ctx, key, data)
+}
+
+func (m *memoryStorage) Close() error {
+	m.closed = true
+	return nil
+}
+
+// failingKeyProvider always returns an error.
+type failingKeyProvider struct{}
+
+func (failingKeyProvider) Key(ctx context.Context) ([]byte, error) {
+	return nil, errors.New("kms unavailable")
+}
+
+var testKey = StaticKey(bytes.Repeat([]byte{0x42}, 32))
+
+var testCoverageKey = storagepkg.CoverageKey{Org: "grafana", Repo: "mimir", Branch: "main"}
+
+func newTestStorage(t *testing.T) (*EncryptedStorage, *memoryStorage) {
+	t.Helper()
+	inner := newMemoryStorage()
+	s, err := NewEncryptedStorage(context.Background(), inner, testKey, Options{})
+	require.NoError(t, err)
+	return s, inner
+}
+
+func TestNewEncryptedStorage(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		inner    storagepkg.Storage
+		keys     KeyProvider
+		errorMsg string
+	}{
+		{
+			name:     "nil inner storage",
+			inner:    nil,
+			keys:     testKey,
+			errorMsg: "inner storage is required",
+		},
+		{
+			name:     "nil key provider",
+			inner:    newMemoryStorage(),
+			keys:     nil,
+			errorMsg: "key provider is required",
+		},
+		{
+			name:     "key provider error",
+			inner:    newMemoryStorage(),
+			keys:     failingKeyProvider{},
+			errorMsg: "kms unavailable",
+		},
+		{
+			name:     "invalid key length",
+			inner:    newMemoryStorage(),
+			keys:     StaticKey([]byte("short")),
+			errorMsg: "invalid encryption key length",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewEncryptedStorage(ctx, tt.inner, tt.keys, Options{})
+			require.Error(t, err)
+			assert.Nil(t, s)
+			assert.Contains(t, err.Error(), tt.errorMsg)
+		})
+	}
+}
+
+func TestEncryptedStorage_RoundTrip(t *testing.T) {
+	ctx := context.Background()
+	s, inner := newTestStorage(t)
+	data := []byte("mode: set\ngithub.com/grafana/mimir/main.go:1.1,2.2 1 1\n")
+
+	require.NoError(t, s.SaveCoverage(ctx, testCoverageKey, data))
+
+	// Stored bytes must not contain the plaintext
+	stored := inner.data[objectPath(t, testCoverageKey)]
+	assert.True(t, bytes.HasPrefix(stored, magic))
+	assert.NotContains(t, string(stored), "github.com/grafana/mimir")
+
+	retrieved, err := s.GetCoverage(ctx, testCoverageKey)
+	require.NoError(t, err)
+	assert.Equal(t, data, retrieved)
+}
+
+func TestEncryptedStorage_SaveCoverageReader(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestStorage(t)
+	data := "mode: set\ngithub.com/grafana/mimir/main.go:1.1,2.2 1 1\n"
+
+	require.NoError(t, s.SaveCoverageReader(ctx, testCoverageKey, strings.NewReader(data), int64(len(data))))
+
+	retrieved, err := s.GetCoverage(ctx, testCoverageKey)
+	require.NoError(t, err)
+	assert.Equal(t, []byte(data), retrieved)
+
+	err = s.SaveCoverageReader(ctx, testCoverageKey, nil, 0)
+	assert.Error(t, err)
+}
+
+func TestEncryptedStorage_GetCoverage(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("missing object returns nil", func(t *testing.T) {
+		s, _ := newTestStorage(t)
+		data, err := s.GetCoverage(ctx, testCoverageKey)
+		require.NoError(t, err)
+		assert.Nil(t, data)
+	})
+
+	t.Run("plaintext object fails", func(t *testing.T) {
+		s, inner := newTestStorage(t)
+		inner.data[objectPath(t, testCoverageKey)] = []byte("mode: set\n")
+
+		_, err := s.GetCoverage(ctx, testCoverageKey)
+		assert.ErrorIs(t, err, ErrNotEncrypted)
+	})
+
+	t.Run("plaintext object passes through while migrating", func(t *testing.T) {
+		inner := newMemoryStorage()
+		s, err := NewEncryptedStorage(ctx, inner, testKey, Options{AllowPlaintext: true})
+		require.NoError(t, err)
+		plaintext := []byte("mode: set\n")
+		inner.data[objectPath(t, testCoverageKey)] = plaintext
+
+		data, err := s.GetCoverage(ctx, testCoverageKey)
+		require.NoError(t, err)
+		assert.Equal(t, plaintext, data)
+	})
+
+	t.Run("ciphertext moved to another key fails", func(t *testing.T) {
+		s, inner := newTestStorage(t)
+		require.NoError(t, s.SaveCoverage(ctx, testCoverageKey, []byte("mode: set\n")))
+
+		otherKey := storagepkg.CoverageKey{Org: "grafana", Repo: "loki", Branch: "main"}
+		inner.data[objectPath(t, otherKey)] = inner.data[objectPath(t, testCoverageKey)]
+
+		_, err := s.GetCoverage(ctx, otherKey)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to decrypt")
+	})
+
+	t.Run("wrong key fails", func(t *testing.T) {
+		s, inner := newTestStorage(t)
+		require.NoError(t, s.SaveCoverage(ctx, testCoverageKey, []byte("mode: set\n")))
+
+		other, err := NewEncryptedStorage(ctx, inner, StaticKey(bytes.Repeat([]byte{0x24}, 32)), Options{})
+		require.NoError(t, err)
+
+		_, err = other.GetCoverage(ctx, testCoverageKey)
+		assert.Error(t, err)
+	})
+
+	t.Run("truncated ciphertext fails", func(t *testing.T) {
+		s, inner := newTestStorage(t)
+		inner.data[objectPath(t, testCoverageKey)] = append([]byte{}, magic...)
+
+		_, err := s.GetCoverage(ctx, testCoverageKey)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "truncated")
+	})
+}
+
+func TestEncryptedStorage_SaveCoverage_InvalidKey(t *testing.T) {
+	s, _ := newTestStorage(t)
+	err := s.SaveCoverage(context.Background(), storagepkg.CoverageKey{Repo: "mimir", Branch: "main"}, []byte("mode: set\n"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "org is required")
+}
+
+func TestEncryptedStorage_Close(t *testing.T) {
+	s, inner := newTestStorage(t)
+	require.NoError(t, s.Close())
+	assert.True(t, inner.closed)
+}
+
+func TestParseBase64Key(t *testing.T) {
+	tests := []struct {
+		name    string
+		encoded string
+		wantErr bool
+	}{
+		{"aes-128", base64.StdEncoding.EncodeToString(make([]byte, 16)), false},
+		{"aes-256", base64.StdEncoding.EncodeToString(make([]byte, 32)), false},
+		{"wrong length", base64.StdEncoding.EncodeToString(make([]byte, 20)), true},
+		{"not base64", "not-base64!!", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := ParseBase64Key(tt.encoded)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.NotEmpty(t, key)
+		})
+	}
+}
+
+func TestEncryptedStorage_Pruner(t *testing.T) {
+	store, _ := newTestStorage(t)
+	_, err := store.ListObjects(context.Background(), "")
+	assert.ErrorContains(t, err, "can't list or delete objects")
+	assert.ErrorContains(t, store.DeleteObject(context.Background(), "a/b/c/coverage.out"), "can't list or delete objects")
+}
@@ -0,0 +1,210 @@
+// Package fs stores coverage as files under a local directory, for
+// self-hosted setups and development without an object store.
+package fs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	storagepkg "github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+)
+
+// FSStorage implements the Storage interface using the local filesystem.
+// Object paths (see storagepkg.Layout) are relative to the root directory.
+type FSStorage struct {
+	root   string
+	layout storagepkg.Layout
+}
+
+// NewFSStorage creates a filesystem storage rooted at root, creating the
+// directory if it doesn't exist. The layout parameter maps keys to object
+// paths; nil uses the default layout.
+func NewFSStorage(root string, layout storagepkg.Layout) (*FSStorage, error) {
+	if root == "" {
+		return nil, errors.New("root directory is required")
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create root directory %s: %w", root, err)
+	}
+	return &FSStorage{root: root, layout: layout}, nil
+}
+
+// SaveCoverage stores coverage data for the given key.
+// Path format: {root}/{org}/{repo}/{branch}/coverage.out, unless a layout is set.
+func (s *FSStorage) SaveCoverage(ctx context.Context, key storagepkg.CoverageKey, data []byte) error {
+	return s.SaveCoverageReader(ctx, key, bytes.NewReader(data), int64(len(data)))
+}
+
+// GetCoverage retrieves coverage data for the given key.
+// Returns nil if the coverage file does not exist.
+// Returns an error if the retrieval operation fails (excluding not-found).
+func (s *FSStorage) GetCoverage(ctx context.Context, key storagepkg.CoverageKey) ([]byte, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return readFile(path)
+}
+
+// GetObject returns the file at an object path, or nil if it doesn't exist.
+func (s *FSStorage) GetObject(ctx context.Context, objectPath string) ([]byte, error) {
+	rel := filepath.FromSlash(objectPath)
+	if !filepath.IsLocal(rel) {
+		return nil, fmt.Errorf("invalid object path %q", objectPath)
+	}
+	return readFile(filepath.Join(s.root, rel))
+}
+
+// readFile returns the content of a file, or nil if it doesn't exist.
+func readFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read coverage file %s: %w", path, err)
+	}
+	return data, nil
+}
+
+// SaveCoverageReader stores coverage data from a reader. The data is written
+// to a temporary file that replaces the coverage file once complete, so
+// readers never see a partial file. The size parameter is unused.
+func (s *FSStorage) SaveCoverageReader(ctx context.Context, key storagepkg.CoverageKey, reader io.Reader, size int64) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if reader == nil {
+		return errors.New("reader is nil")
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+	tmp, err := os.CreateTemp(dir, ".coverage-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file in %s: %w", dir, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, reader); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write coverage file %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close coverage file %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace coverage file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Close releases resources held by the storage.
+// The filesystem storage holds none, but we implement this for interface compliance.
+func (s *FSStorage) Close() error {
+	return nil
+}
+
+// ListCoverageFiles lists all coverage files under the root directory whose
+// object path starts with prefix.
+// This is primarily useful for debugging and testing.
+// Returns a slice of slash-separated object paths, sorted.
+func (s *FSStorage) ListCoverageFiles(ctx context.Context, prefix string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(s.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".coverage-") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, path)
+		if err != nil {
+			return err
+		}
+		if name := filepath.ToSlash(rel); strings.HasPrefix(name, prefix) {
+			files = append(files, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list coverage files: %w", err)
+	}
+	return files, nil
+}
+
+// ListObjects lists the files under the root directory whose object path
+// starts with prefix, with their modification times, sorted by path.
+func (s *FSStorage) ListObjects(ctx context.Context, prefix string) ([]storagepkg.ObjectInfo, error) {
+	var objects []storagepkg.ObjectInfo
+	err := filepath.WalkDir(s.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".coverage-") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, storagepkg.ObjectInfo{Path: name, Updated: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %w", err)
+	}
+	return objects, nil
+}
+
+// DeleteObject deletes the file at an object path, and the directories
+// left empty by it, up to the root directory.
+func (s *FSStorage) DeleteObject(ctx context.Context, objectPath string) error {
+	rel := filepath.FromSlash(objectPath)
+	if !filepath.IsLocal(rel) {
+		return fmt.Errorf("invalid object path %q", objectPath)
+	}
+	path := filepath.Join(s.root, rel)
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete %s: %w", path, err)
+	}
+	// Removing a directory fails once one isn't empty
+	root := filepath.Clean(s.root)
+	for dir := filepath.Dir(path); strings.HasPrefix(dir, root+string(filepath.Separator)); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// path returns the file a key is stored in. Keys whose object path would
+// escape the root directory (e.g. a ".." branch) are rejected.
+func (s *FSStorage) path(key storagepkg.CoverageKey) (string, error) {
+	objectPath, err := storagepkg.ObjectPath(s.layout, key)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsLocal(filepath.FromSlash(objectPath)) {
+		return "", fmt.Errorf("invalid object path %q", objectPath)
+	}
+	return filepath.Join(s.root, filepath.FromSlash(objectPath)), nil
+}
@@ -0,0 +1,160 @@
+package fs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	storagepkg "github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+)
+
+func TestNewFSStorage(t *testing.T) {
+	_, err := NewFSStorage("", nil)
+	assert.ErrorContains(t, err, "root directory is required")
+
+	root := filepath.Join(t.TempDir(), "coverage")
+	store, err := NewFSStorage(root, nil)
+	require.NoError(t, err)
+	assert.DirExists(t, root)
+	assert.NoError(t, store.Close())
+}
+
+func TestFSStorage_SaveAndGetCoverage(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	store, err := NewFSStorage(root, nil)
+	require.NoError(t, err)
+	key := storagepkg.CoverageKey{Org: "acme", Repo: "widgets", Branch: "feature/x"}
+
+	data, err := store.GetCoverage(ctx, key)
+	require.NoError(t, err)
+	assert.Nil(t, data, "missing coverage should return nil")
+
+	require.NoError(t, store.SaveCoverage(ctx, key, []byte("mode: set\n")))
+	data, err = store.GetCoverage(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, "mode: set\n", string(data))
+	assert.FileExists(t, filepath.Join(root, "acme", "widgets", "feature", "x", "coverage.out"))
+
+	require.NoError(t, store.SaveCoverageReader(ctx, key, strings.NewReader("mode: count\n"), -1))
+	data, err = store.GetCoverage(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, "mode: count\n", string(data))
+
+	entries, err := os.ReadDir(filepath.Join(root, "acme", "widgets", "feature", "x"))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "temporary files should be removed")
+}
+
+func TestFSStorage_Layout(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	store, err := NewFSStorage(root, storagepkg.CommitLayout{})
+	require.NoError(t, err)
+
+	key := storagepkg.CoverageKey{Org: "acme", Repo: "widgets", Branch: "main", Commit: "abc123"}
+	require.NoError(t, store.SaveCoverage(ctx, key, []byte("mode: set\n")))
+	assert.FileExists(t, filepath.Join(root, "acme", "widgets", "main", "commits", "abc123", "coverage.out"))
+}
+
+func TestFSStorage_InvalidKeys(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewFSStorage(t.TempDir(), nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		key      storagepkg.CoverageKey
+		errorMsg string
+	}{
+		{
+			name:     "missing branch",
+			key:      storagepkg.CoverageKey{Org: "acme", Repo: "widgets"},
+			errorMsg: "branch is required",
+		},
+		{
+			name:     "escapes root",
+			key:      storagepkg.CoverageKey{Org: "..", Repo: "..", Branch: ".."},
+			errorMsg: "invalid object path",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ErrorContains(t, store.SaveCoverage(ctx, tt.key, []byte("mode: set\n")), tt.errorMsg)
+			_, err := store.GetCoverage(ctx, tt.key)
+			assert.ErrorContains(t, err, tt.errorMsg)
+		})
+	}
+
+	key := storagepkg.CoverageKey{Org: "acme", Repo: "widgets", Branch: "main"}
+	assert.ErrorContains(t, store.SaveCoverageReader(ctx, key, nil, 0), "reader is nil")
+}
+
+func TestFSStorage_ListCoverageFiles(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewFSStorage(t.TempDir(), nil)
+	require.NoError(t, err)
+	for _, key := range []storagepkg.CoverageKey{
+		{Org: "acme", Repo: "widgets", Branch: "main"},
+		{Org: "acme", Repo: "gadgets", Branch: "main"},
+		{Org: "other", Repo: "tools", Branch: "main"},
+	} {
+		require.NoError(t, store.SaveCoverage(ctx, key, []byte("mode: set\n")))
+	}
+
+	files, err := store.ListCoverageFiles(ctx, "acme/")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"acme/gadgets/main/coverage.out", "acme/widgets/main/coverage.out"}, files)
+}
+
+func TestFSStorage_Prune(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	store, err := NewFSStorage(root, storagepkg.CommitLayout{})
+	require.NoError(t, err)
+	key := storagepkg.CoverageKey{Org: "acme", Repo: "widgets", Branch: "main"}
+	require.NoError(t, store.SaveCoverage(ctx, key, []byte("mode: set\n")))
+	key.Commit = "abc123"
+	require.NoError(t, store.SaveCoverage(ctx, key, []byte("mode: set\n")))
+
+	objects, err := store.ListObjects(ctx, "acme/")
+	require.NoError(t, err)
+	require.Len(t, objects, 2)
+	assert.Equal(t, "acme/widgets/main/commits/abc123/coverage.out", objects[0].Path)
+	assert.False(t, objects[0].Updated.IsZero())
+
+	require.NoError(t, store.DeleteObject(ctx, objects[0].Path))
+	require.NoError(t, store.DeleteObject(ctx, objects[0].Path), "deleting a missing object")
+	assert.NoDirExists(t, filepath.Join(root, "acme", "widgets", "main", "commits"))
+	data, err := store.GetCoverage(ctx, storagepkg.CoverageKey{Org: "acme", Repo: "widgets", Branch: "main"})
+	require.NoError(t, err)
+	assert.NotNil(t, data)
+
+	assert.ErrorContains(t, store.DeleteObject(ctx, "../outside"), "invalid object path")
+}
+
+func TestFSStorage_GetObject(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	store, err := NewFSStorage(root, nil)
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "config", "orgs"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "config", "orgs", "acme.yml"), []byte("ignore: []\n"), 0o644))
+
+	data, err := store.GetObject(ctx, storagepkg.OrgConfigPath("acme"))
+	require.NoError(t, err)
+	assert.Equal(t, "ignore: []\n", string(data))
+
+	data, err = store.GetObject(ctx, storagepkg.OrgConfigPath("other"))
+	require.NoError(t, err)
+	assert.Nil(t, data)
+
+	_, err = store.GetObject(ctx, "../outside")
+	assert.ErrorContains(t, err, "invalid object path")
+}
@@ -16,12 +16,14 @@ import (
 type GCSStorage struct {
 	client *storage.Client
 	bucket string
+	layout storagepkg.Layout
 }
 
 // NewGCSStorage creates a new GCS storage client.
 // The bucket parameter specifies the GCS bucket name.
+// The layout parameter maps keys to object paths; nil uses the default layout.
 // It uses Application Default Credentials (ADC) for authentication.
-func NewGCSStorage(ctx context.Context, bucket string) (*GCSStorage, error) {
+func NewGCSStorage(ctx context.Context, bucket string, layout storagepkg.Layout) (*GCSStorage, error) {
 	if bucket == "" {
 		return nil, errors.New("bucket name is required")
 	}
@@ -34,17 +36,17 @@ func NewGCSStorage(ctx context.Context, bucket string) (*GCSStorage, error) {
 	return &GCSStorage{
 		client: client,
 		bucket: bucket,
+		layout: layout,
 	}, nil
 }
 
 // SaveCoverage stores coverage data for the given key.
-// Path format: {org}/{repo}/{branch}/coverage.out
+// Path format: {org}/{repo}/{branch}/coverage.out, unless a layout is set.
 func (g *GCSStorage) SaveCoverage(ctx context.Context, key storagepkg.CoverageKey, data []byte) error {
-	if err := storagepkg.ValidateCoverageKey(key); err != nil {
+	objectPath, err := storagepkg.ObjectPath(g.layout, key)
+	if err != nil {
 		return err
 	}
-
-	objectPath := storagepkg.FormatObjectPath(key)
 	obj := g.client.Bucket(g.bucket).Object(objectPath)
 
 	w := obj.NewWriter(ctx)
@@ -64,14 +66,17 @@ func (g *GCSStorage) SaveCoverage(ctx context.Context, key storagepkg.CoverageKe
 // Returns nil if the coverage file does not exist.
 // Returns an error if the retrieval operation fails (excluding not-found).
 func (g *GCSStorage) GetCoverage(ctx context.Context, key storagepkg.CoverageKey) ([]byte, error) {
-	if err := storagepkg.ValidateCoverageKey(key); err != nil {
+	objectPath, err := storagepkg.ObjectPath(g.layout, key)
+	if err != nil {
 		return nil, err
 	}
 
-	objectPath := storagepkg.FormatObjectPath(key)
-	obj := g.client.Bucket(g.bucket).Object(objectPath)
+	return g.GetObject(ctx, objectPath)
+}
 
-	r, err := obj.NewReader(ctx)
+// GetObject returns the object at objectPath, or nil if it doesn't exist.
+func (g *GCSStorage) GetObject(ctx context.Context, objectPath string) ([]byte, error) {
+	r, err := g.client.Bucket(g.bucket).Object(objectPath).NewReader(ctx)
 	if err != nil {
 		// Return nil if object doesn't exist (not an error according to interface)
 		if errors.Is(err, storage.ErrObjectNotExist) {
@@ -93,15 +98,14 @@ func (g *GCSStorage) GetCoverage(ctx context.Context, key storagepkg.CoverageKey
 // This is useful for streaming large coverage files without loading them into memory.
 // The size parameter helps GCS optimize the upload.
 func (g *GCSStorage) SaveCoverageReader(ctx context.Context, key storagepkg.CoverageKey, reader io.Reader, size int64) error {
-	if err := storagepkg.ValidateCoverageKey(key); err != nil {
+	objectPath, err := storagepkg.ObjectPath(g.layout, key)
+	if err != nil {
 		return err
 	}
 
 	if reader == nil {
 		return errors.New("reader is nil")
 	}
-
-	objectPath := storagepkg.FormatObjectPath(key)
 	obj := g.client.Bucket(g.bucket).Object(objectPath)
 
 	w := obj.NewWriter(ctx)
@@ -153,3 +157,36 @@ func (g *GCSStorage) ListCoverageFiles(ctx context.Context, prefix string) ([]st
 
 	return files, nil
 }
+
+// ListObjects lists the objects whose path starts with prefix, with the
+// time each was last updated.
+func (g *GCSStorage) ListObjects(ctx context.Context, prefix string) ([]storagepkg.ObjectInfo, error) {
+	var objects []storagepkg.ObjectInfo
+
+	it := g.client.Bucket(g.bucket).Objects(ctx, &storage.Query{
+		Prefix: prefix,
+	})
+
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects: %w", err)
+		}
+		objects = append(objects, storagepkg.ObjectInfo{Path: attrs.Name, Updated: attrs.Updated})
+	}
+
+	return objects, nil
+}
+
+// DeleteObject deletes the object at objectPath. Deleting a missing object
+// is not an error.
+func (g *GCSStorage) DeleteObject(ctx context.Context, objectPath string) error {
+	err := g.client.Bucket(g.bucket).Object(objectPath).Delete(ctx)
+	if err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+		return fmt.Errorf("failed to delete GCS object %s: %w", objectPath, err)
+	}
+	return nil
+}
@@ -17,7 +17,7 @@ import (
 func TestNewGCSStorage(t *testing.T) {
 	t.Run("empty bucket name", func(t *testing.T) {
 		ctx := context.Background()
-		storage, err := NewGCSStorage(ctx, "")
+		storage, err := NewGCSStorage(ctx, "", nil)
 		assert.Error(t, err)
 		assert.Nil(t, storage)
 		assert.Contains(t, err.Error(), "bucket name is required")
@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/metrics"
+)
+
+// operationDuration times storage operations, declared on metrics.Default.
+var operationDuration = metrics.Default.NewHistogram("canopy_storage_operation_duration_seconds",
+	"Time taken by storage operations, by backend, operation, and result.", metrics.DefaultBuckets, "backend", "operation", "result")
+
+// InstrumentedStorage wraps a Storage and records the duration and result
+// of each operation in canopy_storage_operation_duration_seconds, labelled
+// with the name of its backend.
+type InstrumentedStorage struct {
+	inner   Storage
+	backend string
+}
+
+// NewInstrumentedStorage creates an InstrumentedStorage whose metrics are
+// labelled backend, e.g. gcs.
+func NewInstrumentedStorage(inner Storage, backend string) *InstrumentedStorage {
+	return &InstrumentedStorage{
+		inner:   inner,
+		backend: backend,
+	}
+}
+
+// SaveCoverage stores coverage data.
+func (s *InstrumentedStorage) SaveCoverage(ctx context.Context, key CoverageKey, data []byte) error {
+	start := time.Now()
+	err := s.inner.SaveCoverage(ctx, key, data)
+	s.observe("save", start, err)
+	return err
+}
+
+// GetCoverage retrieves coverage data; a missing object is a success.
+func (s *InstrumentedStorage) GetCoverage(ctx context.Context, key CoverageKey) ([]byte, error) {
+	start := time.Now()
+	data, err := s.inner.GetCoverage(ctx, key)
+	s.observe("get", start, err)
+	return data, err
+}
+
+// SaveCoverageReader stores coverage data from a reader.
+func (s *InstrumentedStorage) SaveCoverageReader(ctx context.Context, key CoverageKey, reader io.Reader, size int64) error {
+	start := time.Now()
+	err := s.inner.SaveCoverageReader(ctx, key, reader, size)
+	s.observe("save", start, err)
+	return err
+}
+
+// ListObjects lists the objects of the underlying storage if it implements
+// Lister.
+func (s *InstrumentedStorage) ListObjects(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	lister, ok := s.inner.(Lister)
+	if !ok {
+		return nil, fmt.Errorf("%T can't list objects", s.inner)
+	}
+	start := time.Now()
+	objects, err := lister.ListObjects(ctx, prefix)
+	s.observe("list", start, err)
+	return objects, err
+}
+
+// DeleteObject deletes an object of the underlying storage if it implements
+// Pruner.
+func (s *InstrumentedStorage) DeleteObject(ctx context.Context, path string) error {
+	pruner, ok := s.inner.(Pruner)
+	if !ok {
+		return fmt.Errorf("%T can't delete objects", s.inner)
+	}
+	start := time.Now()
+	err := pruner.DeleteObject(ctx, path)
+	s.observe("delete", start, err)
+	return err
+}
+
+// GetObject reads an object of the underlying storage if it implements
+// ObjectReader.
+func (s *InstrumentedStorage) GetObject(ctx context.Context, path string) ([]byte, error) {
+	reader, ok := s.inner.(ObjectReader)
+	if !ok {
+		return nil, fmt.Errorf("%T can't read objects", s.inner)
+	}
+	start := time.Now()
+	data, err := reader.GetObject(ctx, path)
+	s.observe("get", start, err)
+	return data, err
+}
+
+// Close closes the underlying storage.
+func (s *InstrumentedStorage) Close() error {
+	return s.inner.Close()
+}
+
+func (s *InstrumentedStorage) observe(operation string, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	operationDuration.Observe(time.Since(start).Seconds(), s.backend, operation, result)
+}
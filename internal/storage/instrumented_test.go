@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstrumentedStorage(t *testing.T) {
+	ctx := context.Background()
+	key := CoverageKey{Org: "acme", Repo: "widgets", Branch: "main"}
+
+	tests := []struct {
+		name      string
+		setup     func(m *MockStorage)
+		call      func(s *InstrumentedStorage) error
+		operation string
+		result    string
+	}{
+		{
+			name:      "save",
+			call:      func(s *InstrumentedStorage) error { return s.SaveCoverage(ctx, key, []byte("mode: set\n")) },
+			operation: "save",
+			result:    "success",
+		},
+		{
+			name: "save from reader",
+			call: func(s *InstrumentedStorage) error {
+				return s.SaveCoverageReader(ctx, key, strings.NewReader("mode: set\n"), 10)
+			},
+			operation: "save",
+			result:    "success",
+		},
+		{
+			name:      "failed save",
+			setup:     func(m *MockStorage) { m.SetSaveError(errors.New("unavailable")) },
+			call:      func(s *InstrumentedStorage) error { return s.SaveCoverage(ctx, key, []byte("mode: set\n")) },
+			operation: "save",
+			result:    "error",
+		},
+		{
+			name: "get of a missing object",
+			call: func(s *InstrumentedStorage) error {
+				_, err := s.GetCoverage(ctx, key)
+				return err
+			},
+			operation: "get",
+			result:    "success",
+		},
+		{
+			name:  "failed get",
+			setup: func(m *MockStorage) { m.SetGetError(errors.New("unavailable")) },
+			call: func(s *InstrumentedStorage) error {
+				_, err := s.GetCoverage(ctx, key)
+				return err
+			},
+			operation: "get",
+			result:    "error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner := NewMockStorage()
+			if tt.setup != nil {
+				tt.setup(inner)
+			}
+			backend := "test-" + tt.name
+			s := NewInstrumentedStorage(inner, backend)
+
+			err := tt.call(s)
+			assert.Equal(t, tt.result == "error", err != nil)
+			assert.Equal(t, uint64(1), operationDuration.Count(backend, tt.operation, tt.result))
+		})
+	}
+}
+
+func TestInstrumentedStorage_ListObjects(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("delegates to a lister", func(t *testing.T) {
+		inner := &listingMockStorage{MockStorage: NewMockStorage(), memoryPruner: &memoryPruner{}}
+		s := NewInstrumentedStorage(inner, "test-lister")
+
+		_, err := s.ListObjects(ctx, "acme/")
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1), operationDuration.Count("test-lister", "list", "success"))
+	})
+
+	t.Run("storage that can't list", func(t *testing.T) {
+		s := NewInstrumentedStorage(NewMockStorage(), "test-no-lister")
+
+		_, err := s.ListObjects(ctx, "acme/")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "can't list objects")
+	})
+}
+
+func TestInstrumentedStorage_DeleteObject(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("delegates to a pruner", func(t *testing.T) {
+		pruner := &memoryPruner{objects: map[string]time.Time{"acme/widgets/main/commits/c1/coverage.out": time.Now()}}
+		var s Pruner = NewInstrumentedStorage(&listingMockStorage{MockStorage: NewMockStorage(), memoryPruner: pruner}, "test-pruner")
+
+		require.NoError(t, s.DeleteObject(ctx, "acme/widgets/main/commits/c1/coverage.out"))
+		assert.Empty(t, pruner.objects)
+		assert.Equal(t, uint64(1), operationDuration.Count("test-pruner", "delete", "success"))
+	})
+
+	t.Run("storage that can't delete", func(t *testing.T) {
+		s := NewInstrumentedStorage(NewMockStorage(), "test-no-pruner")
+
+		assert.ErrorContains(t, s.DeleteObject(ctx, "acme/widgets/main/commits/c1/coverage.out"), "can't delete objects")
+	})
+}
+
+// listingMockStorage is a MockStorage that lists objects.
+type listingMockStorage struct {
+	*MockStorage
+	*memoryPruner
+}
@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// LatestName is the name of a branch's latest pointer, stored next to its
+// coverage (see CoverageKey.Latest).
+const LatestName = "latest.json"
+
+// LatestPointer names the commit whose coverage a branch's coverage.out
+// holds. With CommitLayout the commit's coverage is also kept under
+// commits/{commit}, so readers can tell whether the branch's coverage is
+// that of the commit they want, or fetch the commit's instead.
+type LatestPointer struct {
+	Commit  string    `json:"commit"`
+	Updated time.Time `json:"updated"`
+}
+
+// LatestKey returns the key of the latest pointer of key's branch.
+func LatestKey(key CoverageKey) CoverageKey {
+	return CoverageKey{Org: key.Org, Repo: key.Repo, Branch: key.Branch, Flag: key.Flag, Latest: true}
+}
+
+// MarshalLatestPointer encodes a latest pointer for storage.
+func MarshalLatestPointer(p LatestPointer) ([]byte, error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode latest pointer: %w", err)
+	}
+	return data, nil
+}
+
+// ParseLatestPointer decodes a stored latest pointer.
+func ParseLatestPointer(data []byte) (*LatestPointer, error) {
+	var p LatestPointer
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse latest pointer: %w", err)
+	}
+	if p.Commit == "" {
+		return nil, errors.New("failed to parse latest pointer: commit is required")
+	}
+	return &p, nil
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// Layout names accepted by ParseLayout.
+const (
+	LayoutDefault = "default"
+	LayoutHashed  = "hashed"
+	LayoutCommit  = "commit"
+	LayoutFlag    = "flag"
+)
+
+// hashPrefixLength is the number of hex characters of the hash prefix used
+// by HashedLayout, spreading repositories over 65536 prefixes.
+const hashPrefixLength = 4
+
+// Layout maps coverage keys to object paths in a bucket. Keys are
+// validated by the package's ObjectPath before they are mapped.
+type Layout interface {
+	ObjectPath(key CoverageKey) string
+}
+
+// DefaultLayout stores coverage under the repository and branch:
+// {org}/{repo}/{branch}/coverage.out
+type DefaultLayout struct{}
+
+// ObjectPath implements Layout.
+func (DefaultLayout) ObjectPath(key CoverageKey) string {
+	return formatObjectPath(key)
+}
+
+// HashedLayout prefixes the default path with a short hash of the
+// repository: {hash}/{org}/{repo}/{branch}/coverage.out
+// Object stores partition by key prefix, so with many repositories under a
+// few orgs the default layout concentrates load on a handful of partitions.
+// A repository's objects still share a prefix and can be listed together.
+type HashedLayout struct{}
+
+// ObjectPath implements Layout.
+func (HashedLayout) ObjectPath(key CoverageKey) string {
+	sum := sha256.Sum256([]byte(key.Org + "/" + key.Repo))
+	return hex.EncodeToString(sum[:])[:hashPrefixLength] + "/" + formatObjectPath(key)
+}
+
+// CommitLayout keeps the coverage of every commit instead of overwriting the
+// branch's latest: {org}/{repo}/{branch}/commits/{commit}/coverage.out
+// Keys without a Commit use the default path.
+type CommitLayout struct{}
+
+// ObjectPath implements Layout.
+func (CommitLayout) ObjectPath(key CoverageKey) string {
+	if key.Commit == "" {
+		return formatObjectPath(key)
+	}
+	return fmt.Sprintf("%s/%s/%s/commits/%s/coverage.out", key.Org, key.Repo, key.Branch, key.Commit)
+}
+
+// FlagLayout stores coverage of each flag (e.g. unit, integration)
+// separately: {org}/{repo}/{branch}/flags/{flag}/coverage.out
+// Keys without a Flag use the default path.
+type FlagLayout struct{}
+
+// ObjectPath implements Layout.
+func (FlagLayout) ObjectPath(key CoverageKey) string {
+	if key.Flag == "" {
+		return formatObjectPath(key)
+	}
+	return fmt.Sprintf("%s/%s/%s/flags/%s/coverage.out", key.Org, key.Repo, key.Branch, key.Flag)
+}
+
+// ParseLayout returns the layout with the given name. Empty selects
+// the default layout.
+func ParseLayout(name string) (Layout, error) {
+	switch name {
+	case "", LayoutDefault:
+		return DefaultLayout{}, nil
+	case LayoutHashed:
+		return HashedLayout{}, nil
+	case LayoutCommit:
+		return CommitLayout{}, nil
+	case LayoutFlag:
+		return FlagLayout{}, nil
+	}
+	return nil, fmt.Errorf("invalid storage layout %q (expected %s, %s, %s, or %s)",
+		name, LayoutDefault, LayoutHashed, LayoutCommit, LayoutFlag)
+}
+
+// ObjectPath returns the object path of key under layout, or under the
+// default layout if layout is nil. Shards and exports are stored next to
+// the coverage of the key without them, whatever the layout; latest
+// pointers and trends next to the coverage of the branch, without a Commit.
+// Invalid keys return the error of ValidateCoverageKey.
+func ObjectPath(layout Layout, key CoverageKey) (string, error) {
+	if err := ValidateCoverageKey(key); err != nil {
+		return "", err
+	}
+	if layout == nil {
+		return formatObjectPath(key), nil
+	}
+	coverageKey := key
+	coverageKey.Shard, coverageKey.Export, coverageKey.Latest, coverageKey.Trend = "", "", false, false
+	if key.Latest || key.Trend {
+		coverageKey.Commit = ""
+	}
+	return siblingPath(layout.ObjectPath(coverageKey), key), nil
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLayouts(t *testing.T) {
+	key := CoverageKey{Org: "grafana", Repo: "mimir", Branch: "main", Commit: "abc123", Flag: "unit"}
+	latest := CoverageKey{Org: "grafana", Repo: "mimir", Branch: "main"}
+
+	tests := []struct {
+		name     string
+		layout   Layout
+		key      CoverageKey
+		expected string
+	}{
+		{name: "default", layout: DefaultLayout{}, key: key, expected: "grafana/mimir/main/coverage.out"},
+		{name: "nil is default", layout: nil, key: key, expected: "grafana/mimir/main/coverage.out"},
+		{name: "hashed", layout: HashedLayout{}, key: key, expected: "8a1b/grafana/mimir/main/coverage.out"},
+		{name: "commit", layout: CommitLayout{}, key: key, expected: "grafana/mimir/main/commits/abc123/coverage.out"},
+		{name: "commit without sha", layout: CommitLayout{}, key: latest, expected: "grafana/mimir/main/coverage.out"},
+		{name: "flag", layout: FlagLayout{}, key: key, expected: "grafana/mimir/main/flags/unit/coverage.out"},
+		{name: "flag without name", layout: FlagLayout{}, key: latest, expected: "grafana/mimir/main/coverage.out"},
+		{name: "default shard", layout: DefaultLayout{}, key: withShard(latest, "index.json"), expected: "grafana/mimir/main/shards/index.json"},
+		{name: "hashed shard", layout: HashedLayout{}, key: withShard(latest, "index.json"), expected: "8a1b/grafana/mimir/main/shards/index.json"},
+		{name: "commit shard", layout: CommitLayout{}, key: withShard(key, "ab12.out"), expected: "grafana/mimir/main/commits/abc123/shards/ab12.out"},
+		{name: "flag shard", layout: FlagLayout{}, key: withShard(key, "ab12.out"), expected: "grafana/mimir/main/flags/unit/shards/ab12.out"},
+		{name: "default export", layout: DefaultLayout{}, key: withExport(latest, "lcov.info"), expected: "grafana/mimir/main/lcov.info"},
+		{name: "hashed export", layout: HashedLayout{}, key: withExport(latest, "lcov.info"), expected: "8a1b/grafana/mimir/main/lcov.info"},
+		{name: "commit export", layout: CommitLayout{}, key: withExport(key, "coverage.xml"), expected: "grafana/mimir/main/commits/abc123/coverage.xml"},
+		{name: "default latest", layout: DefaultLayout{}, key: withLatest(latest), expected: "grafana/mimir/main/latest.json"},
+		{name: "hashed latest", layout: HashedLayout{}, key: withLatest(latest), expected: "8a1b/grafana/mimir/main/latest.json"},
+		{name: "commit latest ignores the sha", layout: CommitLayout{}, key: withLatest(CoverageKey{Org: "grafana", Repo: "mimir", Branch: "main", Commit: "abc123"}), expected: "grafana/mimir/main/latest.json"},
+		{name: "default trend", layout: DefaultLayout{}, key: CoverageKey{Org: "grafana", Repo: "mimir", Branch: "main", Trend: true}, expected: "grafana/mimir/main/trend.json"},
+		{name: "commit trend ignores the sha", layout: CommitLayout{}, key: CoverageKey{Org: "grafana", Repo: "mimir", Branch: "main", Commit: "abc123", Trend: true}, expected: "grafana/mimir/main/trend.json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := ObjectPath(tt.layout, tt.key)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, path)
+		})
+	}
+
+	t.Run("invalid key", func(t *testing.T) {
+		_, err := ObjectPath(CommitLayout{}, CoverageKey{Org: "grafana", Repo: "mimir", Branch: "main", Shard: "ab12.out", Latest: true})
+		assert.EqualError(t, err, "latest pointer and shard or export are exclusive")
+	})
+}
+
+// withShard returns key with the given shard.
+func withShard(key CoverageKey, shard string) CoverageKey {
+	key.Shard = shard
+	return key
+}
+
+// withExport returns key with the given export.
+func withExport(key CoverageKey, export string) CoverageKey {
+	key.Export = export
+	return key
+}
+
+// withLatest returns the latest pointer key of key.
+func withLatest(key CoverageKey) CoverageKey {
+	key.Latest = true
+	return key
+}
+
+func TestHashedLayout_SharesPrefixPerRepo(t *testing.T) {
+	mainPath := HashedLayout{}.ObjectPath(CoverageKey{Org: "grafana", Repo: "mimir", Branch: "main"})
+	feature := HashedLayout{}.ObjectPath(CoverageKey{Org: "grafana", Repo: "mimir", Branch: "feature"})
+	other := HashedLayout{}.ObjectPath(CoverageKey{Org: "grafana", Repo: "loki", Branch: "main"})
+
+	assert.Equal(t, mainPath[:hashPrefixLength], feature[:hashPrefixLength])
+	assert.NotEqual(t, mainPath[:hashPrefixLength], other[:hashPrefixLength])
+}
+
+func TestParseLayout(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected Layout
+		errorMsg string
+	}{
+		{name: "", expected: DefaultLayout{}},
+		{name: "default", expected: DefaultLayout{}},
+		{name: "hashed", expected: HashedLayout{}},
+		{name: "commit", expected: CommitLayout{}},
+		{name: "flag", expected: FlagLayout{}},
+		{name: "sharded", errorMsg: `invalid storage layout "sharded"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			layout, err := ParseLayout(tt.name)
+			if tt.errorMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, layout)
+		})
+	}
+}
@@ -17,6 +17,7 @@ import (
 type MinIOStorage struct {
 	client *minio.Client
 	bucket string
+	layout storagepkg.Layout
 }
 
 // MinIOConfig holds the configuration for MinIO client initialization.
@@ -26,6 +27,8 @@ type MinIOConfig struct {
 	SecretAccessKey string
 	UseSSL          bool
 	Bucket          string
+	// Layout maps keys to object paths; nil uses storagepkg.DefaultLayout
+	Layout storagepkg.Layout
 }
 
 // NewMinIOStorage creates a new MinIO storage client.
@@ -69,20 +72,20 @@ func NewMinIOStorage(ctx context.Context, config MinIOConfig) (*MinIOStorage, er
 	return &MinIOStorage{
 		client: client,
 		bucket: config.Bucket,
+		layout: config.Layout,
 	}, nil
 }
 
 // SaveCoverage stores coverage data for the given key.
-// Path format: {org}/{repo}/{branch}/coverage.out
+// Path format: {org}/{repo}/{branch}/coverage.out, unless a layout is set.
 func (m *MinIOStorage) SaveCoverage(ctx context.Context, key storagepkg.CoverageKey, data []byte) error {
-	if err := storagepkg.ValidateCoverageKey(key); err != nil {
+	objectPath, err := storagepkg.ObjectPath(m.layout, key)
+	if err != nil {
 		return err
 	}
-
-	objectPath := storagepkg.FormatObjectPath(key)
 	reader := bytes.NewReader(data)
 
-	_, err := m.client.PutObject(ctx, m.bucket, objectPath, reader, int64(len(data)), minio.PutObjectOptions{
+	_, err = m.client.PutObject(ctx, m.bucket, objectPath, reader, int64(len(data)), minio.PutObjectOptions{
 		ContentType: "text/plain",
 	})
 	if err != nil {
@@ -96,12 +99,16 @@ func (m *MinIOStorage) SaveCoverage(ctx context.Context, key storagepkg.Coverage
 // Returns nil if the coverage file does not exist.
 // Returns an error if the retrieval operation fails (excluding not-found).
 func (m *MinIOStorage) GetCoverage(ctx context.Context, key storagepkg.CoverageKey) ([]byte, error) {
-	if err := storagepkg.ValidateCoverageKey(key); err != nil {
+	objectPath, err := storagepkg.ObjectPath(m.layout, key)
+	if err != nil {
 		return nil, err
 	}
 
-	objectPath := storagepkg.FormatObjectPath(key)
+	return m.GetObject(ctx, objectPath)
+}
 
+// GetObject returns the object at objectPath, or nil if it doesn't exist.
+func (m *MinIOStorage) GetObject(ctx context.Context, objectPath string) ([]byte, error) {
 	obj, err := m.client.GetObject(ctx, m.bucket, objectPath, minio.GetObjectOptions{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get MinIO object %s: %w", objectPath, err)
@@ -126,7 +133,8 @@ func (m *MinIOStorage) GetCoverage(ctx context.Context, key storagepkg.CoverageK
 // This is useful for streaming large coverage files without loading them into memory.
 // The size parameter helps MinIO optimize the upload.
 func (m *MinIOStorage) SaveCoverageReader(ctx context.Context, key storagepkg.CoverageKey, reader io.Reader, size int64) error {
-	if err := storagepkg.ValidateCoverageKey(key); err != nil {
+	objectPath, err := storagepkg.ObjectPath(m.layout, key)
+	if err != nil {
 		return err
 	}
 
@@ -134,15 +142,13 @@ func (m *MinIOStorage) SaveCoverageReader(ctx context.Context, key storagepkg.Co
 		return errors.New("reader is nil")
 	}
 
-	objectPath := storagepkg.FormatObjectPath(key)
-
 	// If size is not provided, MinIO will use chunked upload
 	uploadSize := size
 	if uploadSize < 0 {
 		uploadSize = -1 // MinIO uses -1 to indicate unknown size
 	}
 
-	_, err := m.client.PutObject(ctx, m.bucket, objectPath, reader, uploadSize, minio.PutObjectOptions{
+	_, err = m.client.PutObject(ctx, m.bucket, objectPath, reader, uploadSize, minio.PutObjectOptions{
 		ContentType: "text/plain",
 	})
 	if err != nil {
@@ -179,3 +185,32 @@ func (m *MinIOStorage) ListCoverageFiles(ctx context.Context, prefix string) ([]
 
 	return files, nil
 }
+
+// ListObjects lists the objects whose path starts with prefix, with the
+// time each was last modified.
+func (m *MinIOStorage) ListObjects(ctx context.Context, prefix string) ([]storagepkg.ObjectInfo, error) {
+	var objects []storagepkg.ObjectInfo
+
+	objectCh := m.client.ListObjects(ctx, m.bucket, minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: true,
+	})
+
+	for object := range objectCh {
+		if object.Err != nil {
+			return nil, fmt.Errorf("failed to list objects: %w", object.Err)
+		}
+		objects = append(objects, storagepkg.ObjectInfo{Path: object.Key, Updated: object.LastModified})
+	}
+
+	return objects, nil
+}
+
+// DeleteObject deletes the object at objectPath. Deleting a missing object
+// is not an error.
+func (m *MinIOStorage) DeleteObject(ctx context.Context, objectPath string) error {
+	if err := m.client.RemoveObject(ctx, m.bucket, objectPath, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to delete MinIO object %s: %w", objectPath, err)
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StoredObject describes a stored coverage object for retention decisions.
+// Objects with the same Key are versions of one series (e.g. per-commit
+// coverage of a branch); Path distinguishes them.
+type StoredObject struct {
+	Key     CoverageKey
+	Path    string
+	Updated time.Time
+}
+
+// ObjectInfo describes an object listed by a Pruner.
+type ObjectInfo struct {
+	// Path is the object path, as mapped by the storage's Layout
+	Path    string
+	Updated time.Time
+}
+
+// Lister is implemented by storages that can list objects.
+type Lister interface {
+	// ListObjects returns the objects whose path starts with prefix.
+	ListObjects(ctx context.Context, prefix string) ([]ObjectInfo, error)
+}
+
+// ObjectReader is implemented by storages that can read objects outside
+// the coverage layout, such as the org configs under OrgConfigPrefix.
+type ObjectReader interface {
+	// GetObject returns the object at path, or nil if it doesn't exist.
+	GetObject(ctx context.Context, path string) ([]byte, error)
+}
+
+// Pruner is implemented by storages that can list and delete objects, which
+// pruning stored history needs.
+type Pruner interface {
+	Lister
+	// DeleteObject deletes the object at path; deleting a missing object
+	// is not an error.
+	DeleteObject(ctx context.Context, path string) error
+}
+
+// CommitHistory returns the objects kept per commit by CommitLayout,
+// {org}/{repo}/{branch}/commits/{commit}/{name}, as StoredObjects. Each
+// branch and name (coverage.out, or an export such as lcov.info) is a
+// series. Other objects, such as branches' latest coverage, are skipped,
+// so they are never pruned.
+func CommitHistory(objects []ObjectInfo) []StoredObject {
+	var history []StoredObject
+	for _, obj := range objects {
+		i := strings.LastIndex(obj.Path, "/commits/")
+		if i < 0 {
+			continue
+		}
+		parts := strings.SplitN(obj.Path[:i], "/", 3)
+		commit, name, ok := strings.Cut(obj.Path[i+len("/commits/"):], "/")
+		if len(parts) != 3 || !ok || commit == "" || name == "" || strings.Contains(name, "/") {
+			continue
+		}
+		key := CoverageKey{Org: parts[0], Repo: parts[1], Branch: parts[2]}
+		if name != path.Base(formatObjectPath(key)) {
+			key.Export = name
+		}
+		history = append(history, StoredObject{Key: key, Path: obj.Path, Updated: obj.Updated})
+	}
+	return history
+}
+
+// Prune deletes the per-commit history (see CommitHistory) of storage that
+// policy selects at now, and returns what it deleted. Only the policy's
+// repositories are listed. With dryRun, nothing is deleted.
+func Prune(ctx context.Context, storage Pruner, policy RetentionPolicy, now time.Time, dryRun bool) ([]StoredObject, error) {
+	prefixes := []string{""}
+	if len(policy.Repos) > 0 {
+		prefixes = prefixes[:0]
+		for _, repo := range policy.Repos {
+			prefixes = append(prefixes, repo+"/")
+		}
+	}
+
+	// Prefixes may overlap, e.g. an org and one of its repositories
+	var objects []ObjectInfo
+	seen := make(map[string]bool)
+	for _, prefix := range prefixes {
+		listed, err := storage.ListObjects(ctx, prefix)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list stored coverage: %w", err)
+		}
+		for _, obj := range listed {
+			if !seen[obj.Path] {
+				seen[obj.Path] = true
+				objects = append(objects, obj)
+			}
+		}
+	}
+
+	selected := policy.Select(CommitHistory(objects), now)
+	if dryRun {
+		return selected, nil
+	}
+	for i, obj := range selected {
+		if err := storage.DeleteObject(ctx, obj.Path); err != nil {
+			return selected[:i], fmt.Errorf("failed to delete %s: %w", obj.Path, err)
+		}
+	}
+	return selected, nil
+}
+
+// RetentionPolicy selects stored coverage objects to prune.
+type RetentionPolicy struct {
+	// OlderThan prunes objects last updated more than this long ago;
+	// zero disables pruning
+	OlderThan time.Duration
+	// KeepLatest is the number of newest objects of each series that are
+	// never pruned, however old they are
+	KeepLatest int
+	// Repos limits pruning to repositories given as "org/repo", or to whole
+	// orgs given as "org"; empty prunes all repositories
+	Repos []string
+}
+
+// Select returns the objects to prune at now, sorted by path.
+func (p RetentionPolicy) Select(objects []StoredObject, now time.Time) []StoredObject {
+	if p.OlderThan <= 0 {
+		return nil
+	}
+
+	series := make(map[CoverageKey][]StoredObject)
+	for _, obj := range objects {
+		if p.matchesRepo(obj.Key) {
+			series[obj.Key] = append(series[obj.Key], obj)
+		}
+	}
+
+	cutoff := now.Add(-p.OlderThan)
+	var prune []StoredObject
+	for _, versions := range series {
+		sort.SliceStable(versions, func(i, j int) bool {
+			return versions[i].Updated.After(versions[j].Updated)
+		})
+		for i, obj := range versions {
+			if i >= p.KeepLatest && obj.Updated.Before(cutoff) {
+				prune = append(prune, obj)
+			}
+		}
+	}
+
+	sort.Slice(prune, func(i, j int) bool { return prune[i].Path < prune[j].Path })
+	return prune
+}
+
+// matchesRepo reports whether key is in one of the policy's repositories.
+func (p RetentionPolicy) matchesRepo(key CoverageKey) bool {
+	if len(p.Repos) == 0 {
+		return true
+	}
+	for _, repo := range p.Repos {
+		org, name, hasRepo := strings.Cut(repo, "/")
+		if org == key.Org && (!hasRepo || name == key.Repo) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseRetentionAge parses an age such as "90d", "2w", or any
+// time.ParseDuration value (e.g. "36h").
+func ParseRetentionAge(s string) (time.Duration, error) {
+	units := map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour}
+	for suffix, unit := range units {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			count, err := strconv.Atoi(n)
+			if err != nil || count < 0 {
+				return 0, fmt.Errorf("invalid age %q: expected e.g. 90d, 2w, or 36h", s)
+			}
+			return time.Duration(count) * unit, nil
+		}
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q: expected e.g. 90d, 2w, or 36h", s)
+	}
+	return d, nil
+}
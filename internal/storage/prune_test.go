@@ -0,0 +1,216 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetentionPolicy_Select(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	daysAgo := func(n int) time.Time { return now.AddDate(0, 0, -n) }
+
+	mainBranch := CoverageKey{Org: "acme", Repo: "widgets", Branch: "main"}
+	featureBranch := CoverageKey{Org: "acme", Repo: "widgets", Branch: "feature"}
+	otherRepo := CoverageKey{Org: "other", Repo: "tools", Branch: "main"}
+	objects := []StoredObject{
+		{Key: mainBranch, Path: "acme/widgets/main/c1", Updated: daysAgo(200)},
+		{Key: mainBranch, Path: "acme/widgets/main/c2", Updated: daysAgo(150)},
+		{Key: mainBranch, Path: "acme/widgets/main/c3", Updated: daysAgo(100)},
+		{Key: mainBranch, Path: "acme/widgets/main/c4", Updated: daysAgo(10)},
+		{Key: featureBranch, Path: "acme/widgets/feature/c1", Updated: daysAgo(120)},
+		{Key: otherRepo, Path: "other/tools/main/c1", Updated: daysAgo(300)},
+	}
+
+	tests := []struct {
+		name     string
+		policy   RetentionPolicy
+		expected []string
+	}{
+		{
+			name:   "zero age prunes nothing",
+			policy: RetentionPolicy{KeepLatest: 1},
+		},
+		{
+			name:     "older than",
+			policy:   RetentionPolicy{OlderThan: 90 * 24 * time.Hour},
+			expected: []string{"acme/widgets/feature/c1", "acme/widgets/main/c1", "acme/widgets/main/c2", "acme/widgets/main/c3", "other/tools/main/c1"},
+		},
+		{
+			name:     "keep latest per series",
+			policy:   RetentionPolicy{OlderThan: 90 * 24 * time.Hour, KeepLatest: 2},
+			expected: []string{"acme/widgets/main/c1", "acme/widgets/main/c2"},
+		},
+		{
+			name:     "repo filter",
+			policy:   RetentionPolicy{OlderThan: 90 * 24 * time.Hour, KeepLatest: 1, Repos: []string{"acme/widgets"}},
+			expected: []string{"acme/widgets/main/c1", "acme/widgets/main/c2", "acme/widgets/main/c3"},
+		},
+		{
+			name:     "org filter",
+			policy:   RetentionPolicy{OlderThan: 90 * 24 * time.Hour, Repos: []string{"other"}},
+			expected: []string{"other/tools/main/c1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var paths []string
+			for _, obj := range tt.policy.Select(objects, now) {
+				paths = append(paths, obj.Path)
+			}
+			assert.Equal(t, tt.expected, paths)
+		})
+	}
+}
+
+func TestParseRetentionAge(t *testing.T) {
+	tests := []struct {
+		input       string
+		expected    time.Duration
+		expectError bool
+	}{
+		{input: "90d", expected: 90 * 24 * time.Hour},
+		{input: "2w", expected: 14 * 24 * time.Hour},
+		{input: "36h", expected: 36 * time.Hour},
+		{input: "d", expectError: true},
+		{input: "-1d", expectError: true},
+		{input: "ninety days", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			age, err := ParseRetentionAge(tt.input)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, age)
+		})
+	}
+}
+
+func TestCommitHistory(t *testing.T) {
+	updated := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	objects := []ObjectInfo{
+		{Path: "acme/widgets/main/coverage.out", Updated: updated},
+		{Path: "acme/widgets/main/latest.json", Updated: updated},
+		{Path: "acme/widgets/main/commits/abc123/coverage.out", Updated: updated},
+		{Path: "acme/widgets/main/commits/abc123/lcov.info", Updated: updated},
+		{Path: "acme/widgets/release/v1/commits/def456/coverage.out", Updated: updated},
+		{Path: "acme/widgets/main/commits/abc123/shards/index.json", Updated: updated},
+		{Path: "acme/widgets/commits/abc123/coverage.out", Updated: updated},
+	}
+
+	assert.Equal(t, []StoredObject{
+		{Key: CoverageKey{Org: "acme", Repo: "widgets", Branch: "main"}, Path: "acme/widgets/main/commits/abc123/coverage.out", Updated: updated},
+		{Key: CoverageKey{Org: "acme", Repo: "widgets", Branch: "main", Export: "lcov.info"}, Path: "acme/widgets/main/commits/abc123/lcov.info", Updated: updated},
+		{Key: CoverageKey{Org: "acme", Repo: "widgets", Branch: "release/v1"}, Path: "acme/widgets/release/v1/commits/def456/coverage.out", Updated: updated},
+	}, CommitHistory(objects))
+}
+
+// memoryPruner is an in-memory Pruner.
+type memoryPruner struct {
+	objects   map[string]time.Time
+	listed    []string
+	deleteErr error
+}
+
+func (m *memoryPruner) ListObjects(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	m.listed = append(m.listed, prefix)
+	var objects []ObjectInfo
+	for p, updated := range m.objects {
+		if strings.HasPrefix(p, prefix) {
+			objects = append(objects, ObjectInfo{Path: p, Updated: updated})
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Path < objects[j].Path })
+	return objects, nil
+}
+
+func (m *memoryPruner) DeleteObject(ctx context.Context, path string) error {
+	if m.deleteErr != nil {
+		return m.deleteErr
+	}
+	delete(m.objects, path)
+	return nil
+}
+
+func TestPrune(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	newPruner := func() *memoryPruner {
+		return &memoryPruner{objects: map[string]time.Time{
+			"acme/widgets/main/coverage.out":               now.AddDate(-1, 0, 0),
+			"acme/widgets/main/commits/c1/coverage.out":    now.AddDate(0, 0, -200),
+			"acme/widgets/main/commits/c2/coverage.out":    now.AddDate(0, 0, -100),
+			"acme/widgets/main/commits/c3/coverage.out":    now.AddDate(0, 0, -1),
+			"other/tools/main/commits/c1/coverage.out":     now.AddDate(0, 0, -200),
+			"other/tools/main/commits/c2/coverage.out":     now.AddDate(0, 0, -150),
+			"acme/gadgets/main/commits/c1/coverage.out":    now.AddDate(0, 0, -200),
+			"acme/gadgets/main/commits/c2/coverage.out":    now.AddDate(0, 0, -199),
+			"acme/gadgets/main/commits/c2/coverage.xml":    now.AddDate(0, 0, -199),
+			"acme/gadgets/main/commits/c3/coverage.xml":    now.AddDate(0, 0, -5),
+			"acme/gadgets/feature/commits/c1/coverage.out": now.AddDate(0, 0, -200),
+		}}
+	}
+	policy := RetentionPolicy{OlderThan: 90 * 24 * time.Hour, KeepLatest: 1}
+	paths := func(objects []StoredObject) []string {
+		var paths []string
+		for _, obj := range objects {
+			paths = append(paths, obj.Path)
+		}
+		return paths
+	}
+
+	t.Run("deletes selected history", func(t *testing.T) {
+		p := newPruner()
+		pruned, err := Prune(context.Background(), p, policy, now, false)
+		require.NoError(t, err)
+		expected := []string{
+			"acme/gadgets/main/commits/c1/coverage.out",
+			"acme/gadgets/main/commits/c2/coverage.xml",
+			"acme/widgets/main/commits/c1/coverage.out",
+			"acme/widgets/main/commits/c2/coverage.out",
+			"other/tools/main/commits/c1/coverage.out",
+		}
+		assert.Equal(t, expected, paths(pruned))
+		for _, path := range expected {
+			assert.NotContains(t, p.objects, path)
+		}
+		assert.Contains(t, p.objects, "acme/widgets/main/coverage.out")
+		assert.Equal(t, []string{""}, p.listed)
+	})
+
+	t.Run("dry run deletes nothing", func(t *testing.T) {
+		p := newPruner()
+		pruned, err := Prune(context.Background(), p, policy, now, true)
+		require.NoError(t, err)
+		assert.Len(t, pruned, 5)
+		assert.Len(t, p.objects, 11)
+	})
+
+	t.Run("lists only the policy's repositories once", func(t *testing.T) {
+		p := newPruner()
+		repoPolicy := policy
+		repoPolicy.Repos = []string{"acme", "acme/widgets"}
+		pruned, err := Prune(context.Background(), p, repoPolicy, now, false)
+		require.NoError(t, err)
+		assert.Len(t, pruned, 4)
+		assert.Equal(t, []string{"acme/", "acme/widgets/"}, p.listed)
+	})
+
+	t.Run("delete error", func(t *testing.T) {
+		p := newPruner()
+		p.deleteErr = errors.New("forbidden")
+		_, err := Prune(context.Background(), p, policy, now, false)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to delete acme/gadgets/main/commits/c1/coverage.out")
+	})
+}
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Repository identifies a repository with stored objects.
+type Repository struct {
+	Org  string `json:"org"`
+	Repo string `json:"repo"`
+}
+
+// ListRepositories returns the repositories with objects in storage, whose
+// paths are mapped by layout, sorted by org and name. A nil layout is the
+// default layout.
+func ListRepositories(ctx context.Context, storage Lister, layout Layout) ([]Repository, error) {
+	objects, err := storage.ListObjects(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stored coverage: %w", err)
+	}
+
+	// Hashed paths start with the hash of the repository
+	skip := 0
+	if _, ok := layout.(HashedLayout); ok {
+		skip = 1
+	}
+	seen := make(map[Repository]bool)
+	repos := []Repository{}
+	for _, obj := range objects {
+		parts := strings.SplitN(obj.Path, "/", skip+3)
+		if len(parts) < skip+3 {
+			continue
+		}
+		repo := Repository{Org: parts[skip], Repo: parts[skip+1]}
+		if !seen[repo] {
+			seen[repo] = true
+			repos = append(repos, repo)
+		}
+	}
+	sort.Slice(repos, func(i, j int) bool {
+		if repos[i].Org != repos[j].Org {
+			return repos[i].Org < repos[j].Org
+		}
+		return repos[i].Repo < repos[j].Repo
+	})
+	return repos, nil
+}
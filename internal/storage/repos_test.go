@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListRepositories(t *testing.T) {
+	keys := []CoverageKey{
+		{Org: "grafana", Repo: "mimir", Branch: "main"},
+		{Org: "grafana", Repo: "mimir", Branch: "feature/x", Commit: "abc123"},
+		{Org: "grafana", Repo: "loki", Branch: "pull/17"},
+		{Org: "acme", Repo: "widgets", Branch: "main", Trend: true},
+	}
+	expected := []Repository{{Org: "acme", Repo: "widgets"}, {Org: "grafana", Repo: "loki"}, {Org: "grafana", Repo: "mimir"}}
+
+	tests := []struct {
+		name   string
+		layout Layout
+	}{
+		{name: "default", layout: DefaultLayout{}},
+		{name: "nil", layout: nil},
+		{name: "hashed", layout: HashedLayout{}},
+		{name: "commit", layout: CommitLayout{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &memoryPruner{objects: map[string]time.Time{}}
+			for _, key := range keys {
+				objectPath, err := ObjectPath(tt.layout, key)
+				require.NoError(t, err)
+				store.objects[objectPath] = time.Time{}
+			}
+
+			repos, err := ListRepositories(context.Background(), store, tt.layout)
+			require.NoError(t, err)
+			assert.Equal(t, expected, repos)
+		})
+	}
+
+	t.Run("empty storage", func(t *testing.T) {
+		repos, err := ListRepositories(context.Background(), &memoryPruner{}, nil)
+		require.NoError(t, err)
+		assert.Empty(t, repos)
+	})
+}
@@ -0,0 +1,243 @@
+// Package s3 stores coverage in Amazon S3.
+//
+// It talks to S3 with the AWS SDK for Go v2, which resolves credentials
+// the way the other AWS SDKs do: static keys from the AWS_* environment
+// variables, the shared config and credentials files, IAM roles for
+// service accounts (IRSA), EKS pod identity, ECS task roles, and EC2
+// instance profiles.
+package s3
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	storagepkg "github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+)
+
+// S3Storage implements the Storage interface using Amazon S3.
+type S3Storage struct {
+	client *s3.Client
+	bucket string
+	layout storagepkg.Layout
+}
+
+// S3Config holds the configuration for S3 client initialization.
+type S3Config struct {
+	Bucket string
+	Region string
+	// Endpoint is the S3 endpoint URL, e.g. a VPC endpoint, addressed with
+	// path-style requests; empty uses the regional endpoint
+	Endpoint string
+	// Layout maps keys to object paths; nil uses storagepkg.DefaultLayout
+	Layout storagepkg.Layout
+}
+
+// NewS3Storage creates a new S3 storage client. Unlike NewMinIOStorage, it
+// doesn't create the bucket: it must exist, and the credentials need
+// s3:ListBucket on it and s3:GetObject and s3:PutObject on its objects
+// (and s3:DeleteObject to prune history, see storagepkg.Prune).
+func NewS3Storage(ctx context.Context, config S3Config) (*S3Storage, error) {
+	if config.Bucket == "" {
+		return nil, errors.New("bucket name is required")
+	}
+	if config.Region == "" {
+		return nil, errors.New("region is required")
+	}
+	if config.Endpoint != "" {
+		u, err := url.Parse(config.Endpoint)
+		if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+			return nil, fmt.Errorf("invalid endpoint %q: must be an http(s) URL", config.Endpoint)
+		}
+	}
+
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(config.Region))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if config.Endpoint != "" {
+			o.BaseEndpoint = aws.String(config.Endpoint)
+			o.UsePathStyle = true
+		}
+	})
+
+	if _, err := client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(config.Bucket)}); err != nil {
+		if isNotFound(err) {
+			return nil, fmt.Errorf("bucket %s does not exist", config.Bucket)
+		}
+		return nil, fmt.Errorf("failed to check bucket existence: %w", err)
+	}
+
+	return &S3Storage{
+		client: client,
+		bucket: config.Bucket,
+		layout: config.Layout,
+	}, nil
+}
+
+// isNotFound reports whether err is a 404 response, which HEAD requests
+// return without an error code.
+func isNotFound(err error) bool {
+	var re *awshttp.ResponseError
+	return errors.As(err, &re) && re.HTTPStatusCode() == http.StatusNotFound
+}
+
+// SaveCoverage stores coverage data for the given key.
+// Path format: {org}/{repo}/{branch}/coverage.out, unless a layout is set.
+func (s *S3Storage) SaveCoverage(ctx context.Context, key storagepkg.CoverageKey, data []byte) error {
+	objectPath, err := storagepkg.ObjectPath(s.layout, key)
+	if err != nil {
+		return err
+	}
+	if err := s.putObject(ctx, objectPath, bytes.NewReader(data), int64(len(data))); err != nil {
+		return fmt.Errorf("failed to upload to S3 object %s: %w", objectPath, err)
+	}
+
+	return nil
+}
+
+// GetCoverage retrieves coverage data for the given key.
+// Returns nil if the coverage file does not exist.
+// Returns an error if the retrieval operation fails (excluding not-found).
+func (s *S3Storage) GetCoverage(ctx context.Context, key storagepkg.CoverageKey) ([]byte, error) {
+	objectPath, err := storagepkg.ObjectPath(s.layout, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetObject(ctx, objectPath)
+}
+
+// GetObject returns the object at objectPath, or nil if it doesn't exist.
+func (s *S3Storage) GetObject(ctx context.Context, objectPath string) ([]byte, error) {
+	obj, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(objectPath),
+	})
+	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get S3 object %s: %w", objectPath, err)
+	}
+	defer obj.Body.Close()
+
+	data, err := io.ReadAll(obj.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read S3 object %s: %w", objectPath, err)
+	}
+
+	return data, nil
+}
+
+// SaveCoverageReader stores coverage data from a reader.
+// This is useful for streaming large coverage files without loading them into memory.
+// A single upload needs the size up front, so a negative size reads the
+// data into memory first.
+func (s *S3Storage) SaveCoverageReader(ctx context.Context, key storagepkg.CoverageKey, reader io.Reader, size int64) error {
+	objectPath, err := storagepkg.ObjectPath(s.layout, key)
+	if err != nil {
+		return err
+	}
+
+	if reader == nil {
+		return errors.New("reader is nil")
+	}
+	if size < 0 {
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return fmt.Errorf("failed to read coverage data: %w", err)
+		}
+		reader, size = bytes.NewReader(data), int64(len(data))
+	}
+
+	if err := s.putObject(ctx, objectPath, reader, size); err != nil {
+		return fmt.Errorf("failed to upload stream to S3 object %s: %w", objectPath, err)
+	}
+
+	return nil
+}
+
+func (s *S3Storage) putObject(ctx context.Context, objectPath string, body io.Reader, size int64) error {
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(objectPath),
+		Body:          body,
+		ContentLength: aws.Int64(size),
+		ContentType:   aws.String("text/plain"),
+	})
+	return err
+}
+
+// Close releases resources held by the storage client.
+// The S3 client doesn't hold any, but we implement this for interface compliance.
+func (s *S3Storage) Close() error {
+	return nil
+}
+
+// ListCoverageFiles lists all coverage files in the bucket.
+// This is primarily useful for debugging and testing.
+// Returns a slice of object paths.
+func (s *S3Storage) ListCoverageFiles(ctx context.Context, prefix string) ([]string, error) {
+	objects, err := s.ListObjects(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, len(objects))
+	for i, object := range objects {
+		files[i] = object.Path
+	}
+
+	return files, nil
+}
+
+// ListObjects lists the objects whose path starts with prefix, with the
+// time each was last modified.
+func (s *S3Storage) ListObjects(ctx context.Context, prefix string) ([]storagepkg.ObjectInfo, error) {
+	var objects []storagepkg.ObjectInfo
+
+	pages := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects: %w", err)
+		}
+		for _, object := range page.Contents {
+			objects = append(objects, storagepkg.ObjectInfo{
+				Path:    aws.ToString(object.Key),
+				Updated: aws.ToTime(object.LastModified),
+			})
+		}
+	}
+
+	return objects, nil
+}
+
+// DeleteObject deletes the object at objectPath. Deleting a missing object
+// is not an error.
+func (s *S3Storage) DeleteObject(ctx context.Context, objectPath string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(objectPath),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete S3 object %s: %w", objectPath, err)
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+package s3
+
+import (
+	"bufio"
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	storagepkg "github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+)
+
+// fakeS3 serves a single bucket with the subset of the S3 API the storage uses.
+type fakeS3 struct {
+	bucket string
+
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != f.bucket {
+		writeS3Error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case key == "" && r.Method == http.MethodHead:
+		w.WriteHeader(http.StatusOK)
+	case key == "" && r.Method == http.MethodGet:
+		type object struct {
+			Key          string `xml:"Key"`
+			LastModified string `xml:"LastModified"`
+		}
+		result := struct {
+			XMLName  xml.Name `xml:"ListBucketResult"`
+			Name     string   `xml:"Name"`
+			Contents []object `xml:"Contents"`
+		}{Name: f.bucket}
+		for k := range f.objects {
+			if strings.HasPrefix(k, r.URL.Query().Get("prefix")) {
+				result.Contents = append(result.Contents, object{Key: k, LastModified: "2024-01-15T10:30:00.000Z"})
+			}
+		}
+		sort.Slice(result.Contents, func(i, j int) bool { return result.Contents[i].Key < result.Contents[j].Key })
+		w.Header().Set("Content-Type", "application/xml")
+		xml.NewEncoder(w).Encode(result)
+	case r.Method == http.MethodPut:
+		data, err := readBody(r)
+		if err != nil {
+			writeS3Error(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		f.objects[key] = data
+		w.Header().Set("ETag", `"etag"`)
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodGet:
+		data, ok := f.objects[key]
+		if !ok {
+			writeS3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Last-Modified", "Mon, 15 Jan 2024 10:30:00 GMT")
+		w.Header().Set("ETag", `"etag"`)
+		w.Write(data)
+	default:
+		writeS3Error(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+// readBody reads an upload, decoding the aws-chunked encoding of streaming
+// signed uploads.
+func readBody(r *http.Request) ([]byte, error) {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return io.ReadAll(r.Body)
+	}
+	var data []byte
+	br := bufio.NewReader(r.Body)
+	for {
+		header, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(header), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return data, nil
+		}
+		chunk := make([]byte, size+2) // data followed by CRLF
+		if _, err := io.ReadFull(br, chunk); err != nil {
+			return nil, err
+		}
+		data = append(data, chunk[:size]...)
+	}
+}
+
+func writeS3Error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string   `xml:"Code"`
+	}{Code: code})
+}
+
+func newTestStorage(t *testing.T) *S3Storage {
+	t.Helper()
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	server := httptest.NewServer(&fakeS3{bucket: "coverage", objects: map[string][]byte{}})
+	t.Cleanup(server.Close)
+
+	store, err := NewS3Storage(context.Background(), S3Config{Bucket: "coverage", Region: "us-east-1", Endpoint: server.URL})
+	require.NoError(t, err)
+	return store
+}
+
+func TestNewS3Storage(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	server := httptest.NewServer(&fakeS3{bucket: "coverage"})
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		config   S3Config
+		errorMsg string
+	}{
+		{
+			name:     "empty bucket name",
+			config:   S3Config{Region: "us-east-1"},
+			errorMsg: "bucket name is required",
+		},
+		{
+			name:     "empty region",
+			config:   S3Config{Bucket: "coverage"},
+			errorMsg: "region is required",
+		},
+		{
+			name:     "invalid endpoint",
+			config:   S3Config{Bucket: "coverage", Region: "us-east-1", Endpoint: "s3.example.com"},
+			errorMsg: "invalid endpoint",
+		},
+		{
+			name:     "missing bucket",
+			config:   S3Config{Bucket: "other", Region: "us-east-1", Endpoint: server.URL},
+			errorMsg: "bucket other does not exist",
+		},
+		{
+			name:   "existing bucket",
+			config: S3Config{Bucket: "coverage", Region: "us-east-1", Endpoint: server.URL},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := NewS3Storage(context.Background(), tt.config)
+			if tt.errorMsg != "" {
+				assert.ErrorContains(t, err, tt.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.NoError(t, store.Close())
+		})
+	}
+}
+
+func TestS3Storage_SaveAndGetCoverage(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStorage(t)
+	key := storagepkg.CoverageKey{Org: "acme", Repo: "widgets", Branch: "main"}
+
+	data, err := store.GetCoverage(ctx, key)
+	require.NoError(t, err)
+	assert.Nil(t, data, "missing coverage should return nil")
+
+	require.NoError(t, store.SaveCoverage(ctx, key, []byte("mode: set\n")))
+	data, err = store.GetCoverage(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, "mode: set\n", string(data))
+
+	require.NoError(t, store.SaveCoverageReader(ctx, key, strings.NewReader("mode: count\n"), int64(len("mode: count\n"))))
+	data, err = store.GetCoverage(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, "mode: count\n", string(data))
+
+	// Uploads of unknown size are buffered
+	require.NoError(t, store.SaveCoverageReader(ctx, key, io.NopCloser(strings.NewReader("mode: atomic\n")), -1))
+	data, err = store.GetCoverage(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, "mode: atomic\n", string(data))
+
+	assert.ErrorContains(t, store.SaveCoverage(ctx, storagepkg.CoverageKey{Org: "acme"}, nil), "repo is required")
+	assert.ErrorContains(t, store.SaveCoverageReader(ctx, key, nil, 0), "reader is nil")
+}
+
+func TestS3Storage_ListCoverageFiles(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStorage(t)
+	for _, key := range []storagepkg.CoverageKey{
+		{Org: "acme", Repo: "widgets", Branch: "main"},
+		{Org: "acme", Repo: "gadgets", Branch: "main"},
+		{Org: "other", Repo: "tools", Branch: "main"},
+	} {
+		require.NoError(t, store.SaveCoverage(ctx, key, []byte("mode: set\n")))
+	}
+
+	files, err := store.ListCoverageFiles(ctx, "acme/")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"acme/gadgets/main/coverage.out", "acme/widgets/main/coverage.out"}, files)
+}
+
+func TestS3Storage_Prune(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStorage(t)
+	store.layout = storagepkg.CommitLayout{}
+	key := storagepkg.CoverageKey{Org: "acme", Repo: "widgets", Branch: "main"}
+	require.NoError(t, store.SaveCoverage(ctx, key, []byte("mode: set\n")))
+	key.Commit = "abc123"
+	require.NoError(t, store.SaveCoverage(ctx, key, []byte("mode: set\n")))
+
+	objects, err := store.ListObjects(ctx, "acme/")
+	require.NoError(t, err)
+	assert.Equal(t, []storagepkg.ObjectInfo{
+		{Path: "acme/widgets/main/commits/abc123/coverage.out", Updated: time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)},
+		{Path: "acme/widgets/main/coverage.out", Updated: time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)},
+	}, objects)
+
+	require.NoError(t, store.DeleteObject(ctx, objects[0].Path))
+	data, err := store.GetCoverage(ctx, key)
+	require.NoError(t, err)
+	assert.Nil(t, data)
+}
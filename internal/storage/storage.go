@@ -5,16 +5,52 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"path"
+	"strings"
 )
 
 // CoverageKey uniquely identifies a coverage file in storage.
-// Storage path format: {org}/{repo}/{branch}/coverage.out
+// Storage path format: {org}/{repo}/{branch}/coverage.out, unless a
+// different Layout is configured.
 type CoverageKey struct {
 	Org    string
 	Repo   string
 	Branch string
+	// Commit is the head SHA, used by CommitLayout; optional
+	Commit string
+	// Flag names a subset of the coverage (e.g. "unit"), used by
+	// FlagLayout; optional
+	Flag string
+	// Shard names an object of coverage split by package, stored next to
+	// the key's coverage under shards/ (see coverage.ShardProfiles); optional
+	Shard string
+	// Export names coverage converted to another format (e.g. lcov.info),
+	// stored next to the key's coverage instead of it (see
+	// coverage.ExportName); optional, exclusive with Shard
+	Export string
+	// Latest selects the branch's latest pointer, naming the commit of its
+	// latest coverage (see LatestPointer), stored next to the branch's
+	// coverage whatever the Commit; exclusive with Shard and Export
+	Latest bool
+	// Trend selects the branch's coverage trend (see TrendName), stored
+	// next to the branch's coverage whatever the Commit; exclusive with
+	// Shard, Export, and Latest
+	Trend bool
 }
 
+// OrgConfigPrefix is the prefix of the org configs read by the worker,
+// stored as {prefix}{org}.yml (see OrgConfigPath).
+const OrgConfigPrefix = "config/orgs/"
+
+// OrgConfigPath returns the object path of an org's config.
+func OrgConfigPath(org string) string {
+	return OrgConfigPrefix + org + ".yml"
+}
+
+// TrendName is the name of a branch's coverage trend, stored next to its
+// coverage (see CoverageKey.Trend and package trend).
+const TrendName = "trend.json"
+
 // Storage defines the interface for coverage data persistence.
 // Implementations include GCS for production and MinIO for local development.
 type Storage interface {
@@ -38,13 +74,47 @@ type Storage interface {
 	Close() error
 }
 
-// FormatObjectPath creates the object path from a coverage key.
-// Format: {org}/{repo}/{branch}/coverage.out
-func FormatObjectPath(key CoverageKey) string {
-	return fmt.Sprintf("%s/%s/%s/coverage.out", key.Org, key.Repo, key.Branch)
+// FormatObjectPath creates the object path from a coverage key, or returns
+// the error of ValidateCoverageKey if the key is invalid, e.g. names both an
+// export and a trend.
+// Format: {org}/{repo}/{branch}/coverage.out,
+// {org}/{repo}/{branch}/shards/{shard} for keys with a Shard,
+// {org}/{repo}/{branch}/{export} for keys with an Export,
+// {org}/{repo}/{branch}/latest.json for Latest keys, or
+// {org}/{repo}/{branch}/trend.json for Trend keys
+func FormatObjectPath(key CoverageKey) (string, error) {
+	if err := ValidateCoverageKey(key); err != nil {
+		return "", err
+	}
+	return formatObjectPath(key), nil
+}
+
+// formatObjectPath is FormatObjectPath for keys known to be valid.
+func formatObjectPath(key CoverageKey) string {
+	return siblingPath(fmt.Sprintf("%s/%s/%s/coverage.out", key.Org, key.Repo, key.Branch), key)
 }
 
-// ValidateCoverageKey validates that the coverage key fields are not empty.
+// siblingPath returns the path of the shard, export, latest pointer, or
+// trend of key stored next to the coverage at objectPath, or objectPath if
+// key names none of them.
+func siblingPath(objectPath string, key CoverageKey) string {
+	switch {
+	case key.Shard != "":
+		return path.Join(path.Dir(objectPath), "shards", key.Shard)
+	case key.Export != "":
+		return path.Join(path.Dir(objectPath), key.Export)
+	case key.Latest:
+		return path.Join(path.Dir(objectPath), LatestName)
+	case key.Trend:
+		return path.Join(path.Dir(objectPath), TrendName)
+	default:
+		return objectPath
+	}
+}
+
+// ValidateCoverageKey validates that the required coverage key fields are
+// not empty and that the Shard or Export, if any, names a single object.
+// Shard, Export, Latest, and Trend are exclusive.
 func ValidateCoverageKey(key CoverageKey) error {
 	if key.Org == "" {
 		return errors.New("org is required")
@@ -55,5 +125,20 @@ func ValidateCoverageKey(key CoverageKey) error {
 	if key.Branch == "" {
 		return errors.New("branch is required")
 	}
+	if strings.Contains(key.Shard, "/") || key.Shard == "." || key.Shard == ".." {
+		return fmt.Errorf("invalid shard %q", key.Shard)
+	}
+	if strings.Contains(key.Export, "/") || key.Export == "." || key.Export == ".." || key.Export == "coverage.out" {
+		return fmt.Errorf("invalid export %q", key.Export)
+	}
+	if key.Shard != "" && key.Export != "" {
+		return errors.New("shard and export are exclusive")
+	}
+	if key.Latest && (key.Shard != "" || key.Export != "") {
+		return errors.New("latest pointer and shard or export are exclusive")
+	}
+	if key.Trend && (key.Shard != "" || key.Export != "" || key.Latest) {
+		return errors.New("trend and shard, export, or latest pointer are exclusive")
+	}
 	return nil
 }
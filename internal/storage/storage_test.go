@@ -35,7 +35,11 @@ func (m *MockStorage) SaveCoverage(ctx context.Context, key CoverageKey, data []
 	if m.saveErr != nil {
 		return m.saveErr
 	}
-	m.data[FormatObjectPath(key)] = data
+	objectPath, err := FormatObjectPath(key)
+	if err != nil {
+		return err
+	}
+	m.data[objectPath] = data
 	return nil
 }
 
@@ -45,7 +49,11 @@ func (m *MockStorage) GetCoverage(ctx context.Context, key CoverageKey) ([]byte,
 	if m.getErr != nil {
 		return nil, m.getErr
 	}
-	data, exists := m.data[FormatObjectPath(key)]
+	objectPath, err := FormatObjectPath(key)
+	if err != nil {
+		return nil, err
+	}
+	data, exists := m.data[objectPath]
 	if !exists {
 		return nil, nil
 	}
@@ -119,14 +127,60 @@ func TestFormatObjectPath(t *testing.T) {
 			},
 			expected: "grafana/tempo/release/v1.0.0/coverage.out",
 		},
+		{
+			name: "shard",
+			key: CoverageKey{
+				Org:    "grafana",
+				Repo:   "mimir",
+				Branch: "main",
+				Shard:  "index.json",
+			},
+			expected: "grafana/mimir/main/shards/index.json",
+		},
+		{
+			name: "export",
+			key: CoverageKey{
+				Org:    "grafana",
+				Repo:   "mimir",
+				Branch: "main",
+				Export: "lcov.info",
+			},
+			expected: "grafana/mimir/main/lcov.info",
+		},
+		{
+			name: "latest pointer",
+			key: CoverageKey{
+				Org:    "grafana",
+				Repo:   "mimir",
+				Branch: "main",
+				Latest: true,
+			},
+			expected: "grafana/mimir/main/latest.json",
+		},
+		{
+			name: "trend",
+			key: CoverageKey{
+				Org:    "grafana",
+				Repo:   "mimir",
+				Branch: "main",
+				Trend:  true,
+			},
+			expected: "grafana/mimir/main/trend.json",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			path := FormatObjectPath(tt.key)
+			path, err := FormatObjectPath(tt.key)
+			require.NoError(t, err)
 			assert.Equal(t, tt.expected, path)
 		})
 	}
+
+	t.Run("invalid key", func(t *testing.T) {
+		_, err := FormatObjectPath(CoverageKey{Org: "grafana", Repo: "mimir", Branch: "main", Export: "lcov.info", Trend: true})
+		assert.EqualError(t, err, "trend and shard, export, or latest pointer are exclusive")
+	})
 }
 
 // TestValidateCoverageKey tests the ValidateCoverageKey helper function.
@@ -176,6 +230,64 @@ func TestValidateCoverageKey(t *testing.T) {
 			wantErr: true,
 			errMsg:  "branch is required",
 		},
+		{
+			name: "shard with slash",
+			key: CoverageKey{
+				Org:    "grafana",
+				Repo:   "mimir",
+				Branch: "main",
+				Shard:  "../coverage.out",
+			},
+			wantErr: true,
+			errMsg:  "invalid shard",
+		},
+		{
+			name: "export replacing the coverage",
+			key: CoverageKey{
+				Org:    "grafana",
+				Repo:   "mimir",
+				Branch: "main",
+				Export: "coverage.out",
+			},
+			wantErr: true,
+			errMsg:  "invalid export",
+		},
+		{
+			name: "shard and export",
+			key: CoverageKey{
+				Org:    "grafana",
+				Repo:   "mimir",
+				Branch: "main",
+				Shard:  "index.json",
+				Export: "lcov.info",
+			},
+			wantErr: true,
+			errMsg:  "shard and export are exclusive",
+		},
+		{
+			name: "latest and export",
+			key: CoverageKey{
+				Org:    "grafana",
+				Repo:   "mimir",
+				Branch: "main",
+				Export: "lcov.info",
+				Latest: true,
+			},
+			wantErr: true,
+			errMsg:  "latest pointer and shard or export are exclusive",
+		},
+		{
+			name: "trend and latest",
+			key: CoverageKey{
+				Org:    "grafana",
+				Repo:   "mimir",
+				Branch: "main",
+				Latest: true,
+				Trend:  true,
+			},
+			wantErr: true,
+			errMsg:  "trend and shard, export, or latest pointer are exclusive",
+		},
 		{
 			name:    "all empty",
 			key:     CoverageKey{},
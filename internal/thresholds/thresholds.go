@@ -0,0 +1,228 @@
+// Package thresholds suggests coverage thresholds for the repository config
+// from the coverage history of a branch.
+package thresholds
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/repoconfig"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+	"gopkg.in/yaml.v3"
+)
+
+// Defaults of Suggester.
+const (
+	DefaultCommits    = 50
+	DefaultPercentile = 25
+)
+
+// ErrNoHistory is returned when none of the recent commits of a branch has
+// stored coverage.
+var ErrNoHistory = errors.New("no stored coverage for recent commits")
+
+// GitHub is the subset of the GitHub API used to suggest thresholds.
+type GitHub interface {
+	GetRepository(ctx context.Context, owner, repo string) (*github.RepositoryInfo, error)
+	ListCommits(ctx context.Context, owner, repo, ref string, limit int) ([]string, error)
+	GetFile(ctx context.Context, owner, repo, path, ref string) ([]byte, error)
+}
+
+// Suggestion is a set of thresholds derived from coverage history.
+type Suggestion struct {
+	Branch string
+	// Commits is the number of commits with stored coverage the suggestion
+	// is based on
+	Commits    int
+	Percentile float64
+	Thresholds repoconfig.ThresholdsConfig
+
+	// ConfigPath is where Config should be committed: the repository's
+	// existing config, or the first of repoconfig.Paths
+	ConfigPath string
+	// Config is the repository config with the suggested thresholds; other
+	// settings of an existing config are kept
+	Config []byte
+}
+
+// Suggester suggests thresholds from the per-commit coverage kept by
+// storage.CommitLayout.
+type Suggester struct {
+	GitHub  GitHub
+	Storage storage.Storage
+	// Commits is the number of recent commits considered; zero uses
+	// DefaultCommits
+	Commits int
+	// Percentile of the recent coverage each threshold is set at, so most
+	// recent commits would have met it; zero uses DefaultPercentile
+	Percentile float64
+}
+
+// Run suggests thresholds for a branch of a repository; an empty branch
+// selects the default branch.
+func (s *Suggester) Run(ctx context.Context, org, repo, branch string) (*Suggestion, error) {
+	if branch == "" {
+		info, err := s.GitHub.GetRepository(ctx, org, repo)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get repository: %w", err)
+		}
+		branch = info.DefaultBranch
+	}
+
+	limit := s.Commits
+	if limit <= 0 {
+		limit = DefaultCommits
+	}
+	shas, err := s.GitHub.ListCommits(ctx, org, repo, branch, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list commits of %s: %w", branch, err)
+	}
+
+	var history []*coverage.CoverageStats
+	for _, sha := range shas {
+		data, err := s.Storage.GetCoverage(ctx, storage.CoverageKey{Org: org, Repo: repo, Branch: branch, Commit: sha})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get coverage of %s: %w", sha, err)
+		}
+		if len(data) == 0 {
+			continue
+		}
+		profiles, err := coverage.ParseProfiles(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse coverage of %s: %w", sha, err)
+		}
+		history = append(history, coverage.CalculateCoverageStats(profiles))
+	}
+	if len(history) == 0 {
+		return nil, fmt.Errorf("%w of %s/%s@%s (checked %d commits)", ErrNoHistory, org, repo, branch, len(shas))
+	}
+
+	p := s.Percentile
+	if p <= 0 {
+		p = DefaultPercentile
+	}
+	suggestion := &Suggestion{
+		Branch:     branch,
+		Commits:    len(history),
+		Percentile: p,
+		Thresholds: Suggest(history, p),
+		ConfigPath: repoconfig.Paths[0],
+	}
+
+	var existing []byte
+	for _, path := range repoconfig.Paths {
+		data, err := s.GitHub.GetFile(ctx, org, repo, path, branch)
+		if github.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %s: %w", path, err)
+		}
+		suggestion.ConfigPath, existing = path, data
+		break
+	}
+	suggestion.Config, err = MergeConfig(existing, suggestion.Thresholds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update %s: %w", suggestion.ConfigPath, err)
+	}
+	return suggestion, nil
+}
+
+// Suggest returns thresholds at percentile p of the project and package
+// coverage in history. Thresholds are rounded down to whole percentages;
+// packages without statements or with a threshold of zero are left out.
+func Suggest(history []*coverage.CoverageStats, p float64) repoconfig.ThresholdsConfig {
+	var project []float64
+	packages := make(map[string][]float64)
+	for _, stats := range history {
+		if stats.TotalStatements > 0 {
+			project = append(project, stats.Percentage)
+		}
+		for name, pc := range stats.ByPackage() {
+			if pc.TotalStatements > 0 {
+				packages[name] = append(packages[name], pc.Percentage)
+			}
+		}
+	}
+
+	var t repoconfig.ThresholdsConfig
+	if len(project) > 0 {
+		t.Project = math.Floor(percentile(project, p))
+	}
+	for name, values := range packages {
+		if threshold := math.Floor(percentile(values, p)); threshold > 0 {
+			if t.Packages == nil {
+				t.Packages = make(map[string]float64)
+			}
+			t.Packages[name] = threshold
+		}
+	}
+	return t
+}
+
+// percentile returns the nearest-rank percentile p of values.
+func percentile(values []float64, p float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[min(max(rank-1, 0), len(sorted)-1)]
+}
+
+// MergeConfig sets the project and package thresholds of a repository
+// config, keeping its other thresholds, settings, and comments. An empty
+// config yields one with only the thresholds.
+func MergeConfig(config []byte, t repoconfig.ThresholdsConfig) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(config, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, errors.New("expected a mapping at the top level")
+	}
+
+	var value yaml.Node
+	if err := value.Encode(t); err != nil {
+		return nil, err
+	}
+	replaced := false
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != "thresholds" {
+			continue
+		}
+		if existing := root.Content[i+1]; existing.Kind == yaml.MappingNode {
+			// Policy settings like patch and paths aren't suggested, so
+			// they're kept after the suggested thresholds
+			for j := 0; j+1 < len(existing.Content); j += 2 {
+				if key := existing.Content[j].Value; key != "project" && key != "packages" {
+					value.Content = append(value.Content, existing.Content[j], existing.Content[j+1])
+				}
+			}
+		}
+		root.Content[i+1] = &value
+		replaced = true
+	}
+	if !replaced {
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "thresholds"}, &value)
+	}
+
+	var b bytes.Buffer
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
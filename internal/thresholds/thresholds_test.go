@@ -0,0 +1,217 @@
+package thresholds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/repoconfig"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeGitHub serves commits and files from memory.
+type fakeGitHub struct {
+	commits []string
+	// files maps paths to contents
+	files  map[string]string
+	limit  int
+	branch string
+}
+
+func (f *fakeGitHub) GetRepository(ctx context.Context, owner, repo string) (*github.RepositoryInfo, error) {
+	return &github.RepositoryInfo{DefaultBranch: "main"}, nil
+}
+
+func (f *fakeGitHub) ListCommits(ctx context.Context, owner, repo, ref string, limit int) ([]string, error) {
+	f.limit, f.branch = limit, ref
+	return f.commits[:min(limit, len(f.commits))], nil
+}
+
+func (f *fakeGitHub) GetFile(ctx context.Context, owner, repo, path, ref string) ([]byte, error) {
+	data, ok := f.files[path]
+	if !ok {
+		return nil, &github.APIError{StatusCode: 404, Message: "Not Found"}
+	}
+	return []byte(data), nil
+}
+
+// memoryStorage is an in-memory storage.Storage.
+type memoryStorage struct {
+	data map[storage.CoverageKey][]byte
+}
+
+func (m *memoryStorage) SaveCoverage(ctx context.Context, key storage.CoverageKey, data []byte) error {
+	m.data[key] = data
+	return nil
+}
+
+func (m *memoryStorage) GetCoverage(ctx context.Context, key storage.CoverageKey) ([]byte, error) {
+	return m.data[key], nil
+}
+
+func (m *memoryStorage) SaveCoverageReader(ctx context.Context, key storage.CoverageKey, reader io.Reader, size int64) error {
+	return errors.New("not implemented")
+}
+
+func (m *memoryStorage) Close() error { return nil }
+
+// commitCoverage returns a profile where the root package covers rootCovered
+// of 10 statements and the api package apiCovered of 4.
+func commitCoverage(rootCovered, apiCovered int) []byte {
+	data := "mode: set\n"
+	for i := 0; i < 10; i++ {
+		data += fmt.Sprintf("github.com/acme/widgets/main.go:%d.1,%d.2 1 %d\n", i+1, i+1, btoi(i < rootCovered))
+	}
+	for i := 0; i < 4; i++ {
+		data += fmt.Sprintf("github.com/acme/widgets/api/api.go:%d.1,%d.2 1 %d\n", i+1, i+1, btoi(i < apiCovered))
+	}
+	return []byte(data)
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func TestSuggester_Run(t *testing.T) {
+	gh := &fakeGitHub{
+		commits: []string{"c5", "c4", "c3", "c2", "c1"},
+		files:   map[string]string{".github/canopy.yml": "# Canopy settings\nannotations:\n  level: warning\nthresholds:\n  project: 99\n"},
+	}
+	store := &memoryStorage{data: map[storage.CoverageKey][]byte{}}
+	for sha, data := range map[string][]byte{
+		"c5": commitCoverage(9, 4),
+		"c4": commitCoverage(8, 3),
+		"c2": commitCoverage(6, 2),
+		"c1": commitCoverage(1, 0), // Outside the limit
+	} {
+		store.data[storage.CoverageKey{Org: "acme", Repo: "widgets", Branch: "main", Commit: sha}] = data
+	}
+
+	s := &Suggester{GitHub: gh, Storage: store, Commits: 4}
+	got, err := s.Run(context.Background(), "acme", "widgets", "")
+	require.NoError(t, err)
+
+	assert.Equal(t, 4, gh.limit)
+	assert.Equal(t, "main", gh.branch)
+	assert.Equal(t, "main", got.Branch)
+	assert.Equal(t, 3, got.Commits)
+	assert.Equal(t, float64(DefaultPercentile), got.Percentile)
+	// Project coverage was 8/14, 11/14 and 13/14
+	assert.Equal(t, repoconfig.ThresholdsConfig{
+		Project: 57,
+		Packages: map[string]float64{
+			"github.com/acme/widgets":     60,
+			"github.com/acme/widgets/api": 50,
+		},
+	}, got.Thresholds)
+	assert.Equal(t, ".github/canopy.yml", got.ConfigPath)
+	assert.Equal(t, `# Canopy settings
+annotations:
+  level: warning
+thresholds:
+  project: 57
+  packages:
+    github.com/acme/widgets: 60
+    github.com/acme/widgets/api: 50
+`, string(got.Config))
+
+	cfg, issues := repoconfig.Parse(got.Config)
+	assert.Empty(t, issues)
+	assert.Equal(t, got.Thresholds, cfg.Thresholds)
+}
+
+func TestSuggester_Run_NoHistory(t *testing.T) {
+	s := &Suggester{
+		GitHub:  &fakeGitHub{commits: []string{"c2", "c1"}},
+		Storage: &memoryStorage{data: map[storage.CoverageKey][]byte{}},
+	}
+	_, err := s.Run(context.Background(), "acme", "widgets", "release")
+	require.ErrorIs(t, err, ErrNoHistory)
+	assert.EqualError(t, err, "no stored coverage for recent commits of acme/widgets@release (checked 2 commits)")
+}
+
+func TestSuggest(t *testing.T) {
+	stats := func(data []byte) *coverage.CoverageStats {
+		profiles, err := coverage.ParseProfiles(data)
+		require.NoError(t, err)
+		return coverage.CalculateCoverageStats(profiles)
+	}
+
+	tests := []struct {
+		name       string
+		history    []*coverage.CoverageStats
+		percentile float64
+		expected   repoconfig.ThresholdsConfig
+	}{
+		{
+			name:       "single commit",
+			history:    []*coverage.CoverageStats{stats(commitCoverage(7, 3))},
+			percentile: 25,
+			expected: repoconfig.ThresholdsConfig{Project: 71, Packages: map[string]float64{
+				"github.com/acme/widgets": 70, "github.com/acme/widgets/api": 75,
+			}},
+		},
+		{
+			name: "median",
+			history: []*coverage.CoverageStats{
+				stats(commitCoverage(2, 4)), stats(commitCoverage(5, 2)), stats(commitCoverage(9, 0)),
+			},
+			percentile: 50,
+			expected: repoconfig.ThresholdsConfig{Project: 50, Packages: map[string]float64{
+				"github.com/acme/widgets": 50, "github.com/acme/widgets/api": 50,
+			}},
+		},
+		{
+			name:       "uncovered packages get no threshold",
+			history:    []*coverage.CoverageStats{stats(commitCoverage(5, 0))},
+			percentile: 25,
+			expected:   repoconfig.ThresholdsConfig{Project: 35, Packages: map[string]float64{"github.com/acme/widgets": 50}},
+		},
+		{
+			name:       "empty history",
+			percentile: 25,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Suggest(tt.history, tt.percentile))
+		})
+	}
+}
+
+func TestMergeConfig(t *testing.T) {
+	thresholds := repoconfig.ThresholdsConfig{Project: 70}
+
+	t.Run("empty config", func(t *testing.T) {
+		got, err := MergeConfig(nil, thresholds)
+		require.NoError(t, err)
+		assert.Equal(t, "thresholds:\n  project: 70\n", string(got))
+	})
+
+	t.Run("replaces existing thresholds", func(t *testing.T) {
+		got, err := MergeConfig([]byte("thresholds:\n  packages:\n    a: 10\nignore: [\"*.pb.go\"]\n"), thresholds)
+		require.NoError(t, err)
+		assert.Equal(t, "thresholds:\n  project: 70\nignore: [\"*.pb.go\"]\n", string(got))
+	})
+
+	t.Run("keeps other thresholds", func(t *testing.T) {
+		got, err := MergeConfig([]byte("thresholds:\n  patch: 80 # new code\n  project: 50\n  paths:\n    - path: internal/gen\n"), thresholds)
+		require.NoError(t, err)
+		assert.Equal(t, "thresholds:\n  project: 70\n  patch: 80 # new code\n  paths:\n    - path: internal/gen\n", string(got))
+	})
+
+	t.Run("not a mapping", func(t *testing.T) {
+		_, err := MergeConfig([]byte("- ignore\n"), thresholds)
+		assert.EqualError(t, err, "expected a mapping at the top level")
+	})
+}
@@ -0,0 +1,63 @@
+package token
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// InMemoryStore implements Store with a map.
+// It is intended for all-in-one mode and testing; tokens are lost on restart.
+type InMemoryStore struct {
+	mu     sync.RWMutex
+	tokens map[string]Token
+}
+
+// NewInMemoryStore creates an empty InMemoryStore.
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{
+		tokens: make(map[string]Token),
+	}
+}
+
+// Save creates or replaces a token.
+func (s *InMemoryStore) Save(ctx context.Context, token *Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[token.ID] = *token
+	return nil
+}
+
+// Get retrieves a token by ID.
+func (s *InMemoryStore) Get(ctx context.Context, id string) (*Token, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.tokens[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &t, nil
+}
+
+// List returns all tokens for an org, or all tokens if org is empty, sorted by ID.
+func (s *InMemoryStore) List(ctx context.Context, org string) ([]*Token, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var tokens []*Token
+	for _, t := range s.tokens {
+		if org != "" && !strings.EqualFold(t.Org, org) {
+			continue
+		}
+		t := t
+		tokens = append(tokens, &t)
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].ID < tokens[j].ID })
+	return tokens, nil
+}
+
+// Close is a no-op for InMemoryStore.
+func (s *InMemoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,39 @@
+package token
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	s := NewInMemoryStore()
+	defer s.Close()
+
+	_, err := s.Get(ctx, "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	tok := &Token{ID: "b", Org: "grafana", Scopes: []Scope{ScopeUpload}}
+	require.NoError(t, s.Save(ctx, tok))
+	require.NoError(t, s.Save(ctx, &Token{ID: "a", Org: "Grafana"}))
+	require.NoError(t, s.Save(ctx, &Token{ID: "c", Org: "other"}))
+
+	// Stored tokens are copies, not aliases of the caller's value
+	tok.Org = "changed"
+	got, err := s.Get(ctx, "b")
+	require.NoError(t, err)
+	assert.Equal(t, "grafana", got.Org)
+
+	tokens, err := s.List(ctx, "grafana")
+	require.NoError(t, err)
+	require.Len(t, tokens, 2)
+	assert.Equal(t, "a", tokens[0].ID)
+	assert.Equal(t, "b", tokens[1].ID)
+
+	tokens, err = s.List(ctx, "")
+	require.NoError(t, err)
+	assert.Len(t, tokens, 3)
+}
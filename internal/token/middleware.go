@@ -0,0 +1,64 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// contextKey is a custom type for context keys to avoid collisions
+type contextKey string
+
+const tokenKey contextKey = "token"
+
+// RequireScope returns middleware that authenticates requests with a bearer
+// token carrying scope. The verified token is available to handlers through
+// FromContext; handlers are responsible for checking Token.Allows against
+// the org/repo they operate on.
+func RequireScope(m *Manager, scope Scope) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			plaintext, ok := bearerToken(r)
+			if !ok {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="canopy"`)
+				http.Error(w, "missing bearer token", http.StatusUnauthorized)
+				return
+			}
+
+			t, err := m.Verify(r.Context(), plaintext)
+			switch {
+			case errors.Is(err, ErrInvalidToken), errors.Is(err, ErrExpired), errors.Is(err, ErrRevoked):
+				w.Header().Set("WWW-Authenticate", `Bearer realm="canopy", error="invalid_token"`)
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			case err != nil:
+				http.Error(w, "failed to verify token", http.StatusInternalServerError)
+				return
+			}
+
+			if !t.HasScope(scope) {
+				http.Error(w, ErrForbidden.Error(), http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tokenKey, t)))
+		})
+	}
+}
+
+// FromContext returns the token verified by RequireScope, if any.
+func FromContext(ctx context.Context) (*Token, bool) {
+	t, ok := ctx.Value(tokenKey).(*Token)
+	return t, ok
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer <token>" header.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, value, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	value = strings.TrimSpace(value)
+	return value, value != ""
+}
@@ -0,0 +1,87 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequireScope(t *testing.T) {
+	ctx := context.Background()
+	m := newTestManager(time.Now())
+
+	_, uploadToken, err := m.Issue(ctx, IssueRequest{Org: "grafana", Scopes: []Scope{ScopeUpload}})
+	require.NoError(t, err)
+	revoked, revokedToken, err := m.Issue(ctx, IssueRequest{Org: "grafana", Scopes: []Scope{ScopeUpload}})
+	require.NoError(t, err)
+	require.NoError(t, m.Revoke(ctx, revoked.ID))
+	_, queryToken, err := m.Issue(ctx, IssueRequest{Org: "grafana", Scopes: []Scope{ScopeQuery}})
+	require.NoError(t, err)
+
+	var seen *Token
+	handler := RequireScope(m, ScopeUpload)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = FromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name           string
+		authorization  string
+		expectedStatus int
+	}{
+		{"valid token", "Bearer " + uploadToken, http.StatusOK},
+		{"lowercase scheme", "bearer " + uploadToken, http.StatusOK},
+		{"missing header", "", http.StatusUnauthorized},
+		{"wrong scheme", "Basic " + uploadToken, http.StatusUnauthorized},
+		{"empty token", "Bearer ", http.StatusUnauthorized},
+		{"invalid token", "Bearer cnp_abc_def", http.StatusUnauthorized},
+		{"revoked token", "Bearer " + revokedToken, http.StatusUnauthorized},
+		{"missing scope", "Bearer " + queryToken, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen = nil
+			req := httptest.NewRequest(http.MethodPost, "/upload", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedStatus == http.StatusOK {
+				require.NotNil(t, seen)
+				assert.Equal(t, "grafana", seen.Org)
+			} else {
+				assert.Nil(t, seen)
+			}
+		})
+	}
+}
+
+func TestRequireScope_StoreError(t *testing.T) {
+	m := NewManager(&failingStore{err: errors.New("redis down")})
+	handler := RequireScope(m, ScopeUpload)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("handler must not be called")
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", nil)
+	req.Header.Set("Authorization", "Bearer cnp_abc_def")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
+
+func TestFromContext_Missing(t *testing.T) {
+	_, ok := FromContext(context.Background())
+	assert.False(t, ok)
+}
@@ -0,0 +1,137 @@
+package token
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore implements Store using Redis.
+// Each token is stored as a JSON string under <KeyPrefix>:<id>, and token IDs
+// are indexed in a set so they can be listed without scanning the keyspace.
+type RedisStore struct {
+	client    *redis.Client
+	keyPrefix string
+}
+
+// RedisConfig holds configuration for creating a RedisStore.
+type RedisConfig struct {
+	// Address is the Redis server address (host:port)
+	Address string
+
+	// Password is the Redis password (optional)
+	Password string
+
+	// DB is the Redis database number (default: 0)
+	DB int
+
+	// KeyPrefix namespaces token keys (default: "canopy:tokens")
+	KeyPrefix string
+}
+
+// NewRedisStore creates a new RedisStore instance.
+// The caller is responsible for calling Close() when done.
+func NewRedisStore(ctx context.Context, cfg RedisConfig) (*RedisStore, error) {
+	if cfg.Address == "" {
+		return nil, fmt.Errorf("redis address is required")
+	}
+	if cfg.KeyPrefix == "" {
+		cfg.KeyPrefix = "canopy:tokens"
+	}
+
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Address,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+
+	// Test connection
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+
+	return &RedisStore{
+		client:    client,
+		keyPrefix: cfg.KeyPrefix,
+	}, nil
+}
+
+// Save creates or replaces a token.
+func (s *RedisStore) Save(ctx context.Context, token *Token) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return fmt.Errorf("failed to marshal token: %w", err)
+	}
+
+	pipe := s.client.TxPipeline()
+	pipe.Set(ctx, s.tokenKey(token.ID), data, 0)
+	pipe.SAdd(ctx, s.indexKey(), token.ID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to save token to redis: %w", err)
+	}
+	return nil
+}
+
+// Get retrieves a token by ID.
+func (s *RedisStore) Get(ctx context.Context, id string) (*Token, error) {
+	data, err := s.client.Get(ctx, s.tokenKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token from redis: %w", err)
+	}
+
+	var t Token
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal token: %w", err)
+	}
+	return &t, nil
+}
+
+// List returns all tokens for an org, or all tokens if org is empty, sorted by ID.
+func (s *RedisStore) List(ctx context.Context, org string) ([]*Token, error) {
+	ids, err := s.client.SMembers(ctx, s.indexKey()).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tokens from redis: %w", err)
+	}
+	sort.Strings(ids)
+
+	var tokens []*Token
+	for _, id := range ids {
+		t, err := s.Get(ctx, id)
+		if errors.Is(err, ErrNotFound) {
+			continue // Index entry without a token; ignore
+		}
+		if err != nil {
+			return nil, err
+		}
+		if org != "" && !strings.EqualFold(t.Org, org) {
+			continue
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, nil
+}
+
+// Close closes the Redis client connection.
+func (s *RedisStore) Close() error {
+	if err := s.client.Close(); err != nil {
+		return fmt.Errorf("failed to close redis client: %w", err)
+	}
+	return nil
+}
+
+func (s *RedisStore) tokenKey(id string) string {
+	return s.keyPrefix + ":" + id
+}
+
+func (s *RedisStore) indexKey() string {
+	return s.keyPrefix + ":index"
+}
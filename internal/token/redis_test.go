@@ -0,0 +1,31 @@
+package token
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRedisStore_Validation(t *testing.T) {
+	_, err := NewRedisStore(context.Background(), RedisConfig{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "redis address is required")
+}
+
+func TestNewRedisStore_ConnectionError(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	_, err := NewRedisStore(ctx, RedisConfig{Address: "localhost:1"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to connect to redis")
+}
+
+func TestRedisStore_Keys(t *testing.T) {
+	s := &RedisStore{keyPrefix: "canopy:tokens"}
+	assert.Equal(t, "canopy:tokens:abc", s.tokenKey("abc"))
+	assert.Equal(t, "canopy:tokens:index", s.indexKey())
+}
@@ -0,0 +1,270 @@
+package token
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Scope is a permission granted to an API token.
+type Scope string
+
+const (
+	// ScopeUpload allows uploading coverage.
+	ScopeUpload Scope = "upload"
+	// ScopeQuery allows reading coverage and reports.
+	ScopeQuery Scope = "query"
+	// ScopeAdmin allows operator actions such as cache invalidation.
+	ScopeAdmin Scope = "admin"
+)
+
+// prefix marks Canopy API tokens so they are easy to spot in logs and secret scanners.
+const prefix = "cnp"
+
+var (
+	// ErrNotFound is returned when a token ID does not exist.
+	ErrNotFound = errors.New("token not found")
+	// ErrInvalidToken is returned when a token is malformed or its secret does not match.
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrExpired is returned when a token is past its expiration.
+	ErrExpired = errors.New("token expired")
+	// ErrRevoked is returned when a token has been revoked.
+	ErrRevoked = errors.New("token revoked")
+	// ErrForbidden is returned when a token lacks the scope or repository access for a request.
+	ErrForbidden = errors.New("token not authorized for this request")
+)
+
+// Token is the stored metadata for an API token.
+// The secret itself is never stored, only its SHA-256 hash.
+type Token struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Org the token is scoped to
+	Org string `json:"org"`
+	// Repo the token is scoped to; empty allows every repository in Org
+	Repo   string  `json:"repo,omitempty"`
+	Scopes []Scope `json:"scopes"`
+	// SecretHash is the hex-encoded SHA-256 hash of the token secret
+	SecretHash string    `json:"secret_hash"`
+	CreatedAt  time.Time `json:"created_at"`
+	// ExpiresAt is zero for tokens that never expire
+	ExpiresAt time.Time  `json:"expires_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// HasScope returns true if the token grants scope.
+func (t *Token) HasScope(scope Scope) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows returns true if the token may access the given repository.
+func (t *Token) Allows(org, repo string) bool {
+	if !strings.EqualFold(t.Org, org) {
+		return false
+	}
+	return t.Repo == "" || strings.EqualFold(t.Repo, repo)
+}
+
+// Store persists token metadata.
+// Implementations include an in-memory store and Redis.
+type Store interface {
+	// Save creates or replaces a token.
+	Save(ctx context.Context, token *Token) error
+
+	// Get retrieves a token by ID. Returns ErrNotFound if it does not exist.
+	Get(ctx context.Context, id string) (*Token, error)
+
+	// List returns all tokens for an org, or all tokens if org is empty.
+	List(ctx context.Context, org string) ([]*Token, error)
+
+	// Close releases any resources held by the store.
+	Close() error
+}
+
+// IssueRequest describes a token to issue.
+type IssueRequest struct {
+	Name   string
+	Org    string
+	Repo   string
+	Scopes []Scope
+	// TTL is how long the token is valid; zero means it never expires
+	TTL time.Duration
+}
+
+// Manager issues, verifies, and revokes API tokens.
+type Manager struct {
+	store Store
+	now   func() time.Time
+}
+
+// NewManager creates a Manager backed by store.
+func NewManager(store Store) *Manager {
+	return &Manager{
+		store: store,
+		now:   time.Now,
+	}
+}
+
+// Issue creates a new token and returns its metadata and the plaintext token.
+// The plaintext token is only available here; it cannot be recovered later.
+func (m *Manager) Issue(ctx context.Context, req IssueRequest) (*Token, string, error) {
+	if req.Org == "" {
+		return nil, "", fmt.Errorf("org is required")
+	}
+	if len(req.Scopes) == 0 {
+		return nil, "", fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range req.Scopes {
+		if _, err := ParseScope(string(scope)); err != nil {
+			return nil, "", err
+		}
+	}
+	if req.TTL < 0 {
+		return nil, "", fmt.Errorf("ttl must not be negative")
+	}
+
+	id, err := randomString(8, hex.EncodeToString)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := randomString(32, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := m.now().UTC()
+	t := &Token{
+		ID:         id,
+		Name:       req.Name,
+		Org:        req.Org,
+		Repo:       req.Repo,
+		Scopes:     req.Scopes,
+		SecretHash: hashSecret(secret),
+		CreatedAt:  now,
+	}
+	if req.TTL > 0 {
+		t.ExpiresAt = now.Add(req.TTL)
+	}
+
+	if err := m.store.Save(ctx, t); err != nil {
+		return nil, "", fmt.Errorf("failed to save token: %w", err)
+	}
+
+	return t, fmt.Sprintf("%s_%s_%s", prefix, id, secret), nil
+}
+
+// Verify checks a plaintext token and returns its metadata.
+// Returns ErrInvalidToken, ErrExpired, or ErrRevoked if the token cannot be used.
+func (m *Manager) Verify(ctx context.Context, plaintext string) (*Token, error) {
+	id, secret, err := parse(plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := m.store.Get(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load token: %w", err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(t.SecretHash)) != 1 {
+		return nil, ErrInvalidToken
+	}
+	if t.RevokedAt != nil {
+		return nil, ErrRevoked
+	}
+	if !t.ExpiresAt.IsZero() && !m.now().Before(t.ExpiresAt) {
+		return nil, ErrExpired
+	}
+
+	return t, nil
+}
+
+// Authorize verifies a plaintext token and checks that it grants scope on org/repo.
+// Returns ErrForbidden if the token is valid but not allowed.
+func (m *Manager) Authorize(ctx context.Context, plaintext string, scope Scope, org, repo string) (*Token, error) {
+	t, err := m.Verify(ctx, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	if !t.HasScope(scope) || !t.Allows(org, repo) {
+		return nil, ErrForbidden
+	}
+	return t, nil
+}
+
+// Revoke marks a token as revoked. Revoking an already revoked token is a no-op.
+func (m *Manager) Revoke(ctx context.Context, id string) error {
+	t, err := m.store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if t.RevokedAt != nil {
+		return nil
+	}
+
+	now := m.now().UTC()
+	t.RevokedAt = &now
+	if err := m.store.Save(ctx, t); err != nil {
+		return fmt.Errorf("failed to save token: %w", err)
+	}
+	return nil
+}
+
+// List returns tokens for an org, or all tokens if org is empty.
+func (m *Manager) List(ctx context.Context, org string) ([]*Token, error) {
+	return m.store.List(ctx, org)
+}
+
+// ParseScope converts a scope name into a Scope.
+func ParseScope(name string) (Scope, error) {
+	switch Scope(strings.ToLower(strings.TrimSpace(name))) {
+	case ScopeUpload:
+		return ScopeUpload, nil
+	case ScopeQuery:
+		return ScopeQuery, nil
+	case ScopeAdmin:
+		return ScopeAdmin, nil
+	default:
+		return "", fmt.Errorf("unknown token scope: %s (supported: upload, query, admin)", name)
+	}
+}
+
+// parse splits a plaintext token of the form cnp_<id>_<secret>.
+func parse(plaintext string) (string, string, error) {
+	parts := strings.SplitN(plaintext, "_", 3)
+	if len(parts) != 3 || parts[0] != prefix || parts[1] == "" || parts[2] == "" {
+		return "", "", ErrInvalidToken
+	}
+	return parts[1], parts[2], nil
+}
+
+// hashSecret returns the hex-encoded SHA-256 hash of secret.
+// Secrets are 256 bits of randomness, so a fast hash is sufficient.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomString returns n random bytes encoded with encode.
+func randomString(n int, encode func([]byte) string) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random bytes: %w", err)
+	}
+	return encode(b), nil
+}
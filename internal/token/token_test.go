@@ -0,0 +1,269 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingStore returns err from every operation.
+type failingStore struct {
+	err error
+}
+
+func (s *failingStore) Save(ctx context.Context, token *Token) error { return s.err }
+func (s *failingStore) Get(ctx context.Context, id string) (*Token, error) {
+	return nil, s.err
+}
+func (s *failingStore) List(ctx context.Context, org string) ([]*Token, error) {
+	return nil, s.err
+}
+func (s *failingStore) Close() error { return nil }
+
+func newTestManager(now time.Time) *Manager {
+	m := NewManager(NewInMemoryStore())
+	m.now = func() time.Time { return now }
+	return m
+}
+
+func TestManager_Issue(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	m := newTestManager(now)
+
+	tok, plaintext, err := m.Issue(ctx, IssueRequest{
+		Name:   "ci uploads",
+		Org:    "grafana",
+		Repo:   "mimir",
+		Scopes: []Scope{ScopeUpload},
+		TTL:    24 * time.Hour,
+	})
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(plaintext, "cnp_"+tok.ID+"_"))
+	assert.Equal(t, "grafana", tok.Org)
+	assert.Equal(t, "mimir", tok.Repo)
+	assert.Equal(t, now, tok.CreatedAt)
+	assert.Equal(t, now.Add(24*time.Hour), tok.ExpiresAt)
+	assert.NotContains(t, tok.SecretHash, strings.SplitN(plaintext, "_", 3)[2], "secret must not be stored")
+
+	stored, err := m.store.Get(ctx, tok.ID)
+	require.NoError(t, err)
+	assert.Equal(t, tok.SecretHash, stored.SecretHash)
+}
+
+func TestManager_Issue_Validation(t *testing.T) {
+	ctx := context.Background()
+	m := newTestManager(time.Now())
+
+	tests := []struct {
+		name    string
+		req     IssueRequest
+		wantErr string
+	}{
+		{
+			name:    "missing org",
+			req:     IssueRequest{Scopes: []Scope{ScopeUpload}},
+			wantErr: "org is required",
+		},
+		{
+			name:    "missing scopes",
+			req:     IssueRequest{Org: "grafana"},
+			wantErr: "at least one scope is required",
+		},
+		{
+			name:    "unknown scope",
+			req:     IssueRequest{Org: "grafana", Scopes: []Scope{"delete"}},
+			wantErr: "unknown token scope",
+		},
+		{
+			name:    "negative ttl",
+			req:     IssueRequest{Org: "grafana", Scopes: []Scope{ScopeQuery}, TTL: -time.Hour},
+			wantErr: "ttl must not be negative",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := m.Issue(ctx, tt.req)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestManager_Issue_StoreError(t *testing.T) {
+	m := NewManager(&failingStore{err: errors.New("redis down")})
+	_, _, err := m.Issue(context.Background(), IssueRequest{Org: "grafana", Scopes: []Scope{ScopeUpload}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "redis down")
+}
+
+func TestManager_Verify(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	m := newTestManager(now)
+
+	tok, plaintext, err := m.Issue(ctx, IssueRequest{Org: "grafana", Scopes: []Scope{ScopeUpload}, TTL: time.Hour})
+	require.NoError(t, err)
+
+	t.Run("valid token", func(t *testing.T) {
+		got, err := m.Verify(ctx, plaintext)
+		require.NoError(t, err)
+		assert.Equal(t, tok.ID, got.ID)
+	})
+
+	t.Run("malformed tokens", func(t *testing.T) {
+		for _, bad := range []string{"", "cnp", "cnp__secret", "xyz_" + tok.ID + "_secret", "cnp_" + tok.ID + "_"} {
+			_, err := m.Verify(ctx, bad)
+			assert.ErrorIs(t, err, ErrInvalidToken, "token %q", bad)
+		}
+	})
+
+	t.Run("wrong secret", func(t *testing.T) {
+		_, err := m.Verify(ctx, "cnp_"+tok.ID+"_wrongsecret")
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("unknown id", func(t *testing.T) {
+		_, err := m.Verify(ctx, "cnp_0000000000000000_secret")
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		m.now = func() time.Time { return now.Add(time.Hour) }
+		defer func() { m.now = func() time.Time { return now } }()
+
+		_, err := m.Verify(ctx, plaintext)
+		assert.ErrorIs(t, err, ErrExpired)
+	})
+
+	t.Run("store error", func(t *testing.T) {
+		failing := NewManager(&failingStore{err: errors.New("redis down")})
+		_, err := failing.Verify(ctx, plaintext)
+		require.Error(t, err)
+		assert.NotErrorIs(t, err, ErrInvalidToken)
+	})
+}
+
+func TestManager_Verify_NoExpiry(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	m := newTestManager(now)
+
+	tok, plaintext, err := m.Issue(ctx, IssueRequest{Org: "grafana", Scopes: []Scope{ScopeQuery}})
+	require.NoError(t, err)
+	assert.True(t, tok.ExpiresAt.IsZero())
+
+	m.now = func() time.Time { return now.Add(10 * 365 * 24 * time.Hour) }
+	_, err = m.Verify(ctx, plaintext)
+	assert.NoError(t, err)
+}
+
+func TestManager_Revoke(t *testing.T) {
+	ctx := context.Background()
+	m := newTestManager(time.Now())
+
+	tok, plaintext, err := m.Issue(ctx, IssueRequest{Org: "grafana", Scopes: []Scope{ScopeUpload}})
+	require.NoError(t, err)
+
+	require.NoError(t, m.Revoke(ctx, tok.ID))
+	_, err = m.Verify(ctx, plaintext)
+	assert.ErrorIs(t, err, ErrRevoked)
+
+	// Revoking twice keeps the original revocation time
+	first, err := m.store.Get(ctx, tok.ID)
+	require.NoError(t, err)
+	require.NoError(t, m.Revoke(ctx, tok.ID))
+	second, err := m.store.Get(ctx, tok.ID)
+	require.NoError(t, err)
+	assert.Equal(t, first.RevokedAt, second.RevokedAt)
+
+	assert.ErrorIs(t, m.Revoke(ctx, "missing"), ErrNotFound)
+}
+
+func TestManager_Authorize(t *testing.T) {
+	ctx := context.Background()
+	m := newTestManager(time.Now())
+
+	_, repoToken, err := m.Issue(ctx, IssueRequest{Org: "grafana", Repo: "mimir", Scopes: []Scope{ScopeUpload}})
+	require.NoError(t, err)
+	_, orgToken, err := m.Issue(ctx, IssueRequest{Org: "grafana", Scopes: []Scope{ScopeQuery}})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		token   string
+		scope   Scope
+		org     string
+		repo    string
+		wantErr error
+	}{
+		{"repo token on its repo", repoToken, ScopeUpload, "grafana", "mimir", nil},
+		{"repo token is case-insensitive", repoToken, ScopeUpload, "Grafana", "Mimir", nil},
+		{"repo token on other repo", repoToken, ScopeUpload, "grafana", "loki", ErrForbidden},
+		{"repo token without scope", repoToken, ScopeQuery, "grafana", "mimir", ErrForbidden},
+		{"org token on any repo", orgToken, ScopeQuery, "grafana", "loki", nil},
+		{"org token on other org", orgToken, ScopeQuery, "other", "loki", ErrForbidden},
+		{"invalid token", "cnp_x_y", ScopeQuery, "grafana", "loki", ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := m.Authorize(ctx, tt.token, tt.scope, tt.org, tt.repo)
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestManager_List(t *testing.T) {
+	ctx := context.Background()
+	m := newTestManager(time.Now())
+
+	for _, org := range []string{"grafana", "grafana", "other"} {
+		_, _, err := m.Issue(ctx, IssueRequest{Org: org, Scopes: []Scope{ScopeUpload}})
+		require.NoError(t, err)
+	}
+
+	all, err := m.List(ctx, "")
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	grafana, err := m.List(ctx, "grafana")
+	require.NoError(t, err)
+	assert.Len(t, grafana, 2)
+}
+
+func TestParseScope(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Scope
+		wantErr  bool
+	}{
+		{"upload", ScopeUpload, false},
+		{" Query ", ScopeQuery, false},
+		{"admin", ScopeAdmin, false},
+		{"delete", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseScope(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
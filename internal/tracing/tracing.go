@@ -0,0 +1,123 @@
+// Package tracing records OpenTelemetry spans of the processing pipeline,
+// from webhook delivery to check run, and carries their context across the
+// queue in work requests.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName names the tracer of the spans canopy records.
+const instrumentationName = "github.com/oleg-kozlyuk-grafana/go-canopy"
+
+// Setup installs the W3C trace context propagator and, if tracing is
+// enabled, a tracer provider exporting spans over OTLP/HTTP. Both the
+// exporter and the resource are configured by the standard OTEL_*
+// environment variables. Tracing is enabled by OTEL_TRACES_EXPORTER=otlp
+// or an OTLP endpoint (OTEL_EXPORTER_OTLP_ENDPOINT or
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT), and disabled by
+// OTEL_SDK_DISABLED=true or OTEL_TRACES_EXPORTER=none. Without it spans
+// aren't recorded, but trace context is still propagated.
+// The returned function flushes buffered spans and stops the exporter.
+func Setup(ctx context.Context, service string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	enabled, err := exportEnabled()
+	if err != nil || !enabled {
+		return func(context.Context) error { return nil }, err
+	}
+	if protocol := otlpProtocol(); protocol != "http/protobuf" {
+		return nil, fmt.Errorf("unsupported OTLP protocol %q: only http/protobuf is supported", protocol)
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP trace exporter: %w", err)
+	}
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the defaults
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(service)),
+		resource.WithTelemetrySDK(),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build trace resource: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// exportEnabled reports whether the environment enables exporting spans.
+func exportEnabled() (bool, error) {
+	if strings.EqualFold(strings.TrimSpace(os.Getenv("OTEL_SDK_DISABLED")), "true") {
+		return false, nil
+	}
+	switch exporter := strings.TrimSpace(os.Getenv("OTEL_TRACES_EXPORTER")); exporter {
+	case "otlp":
+		return true, nil
+	case "none":
+		return false, nil
+	case "":
+		return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "", nil
+	default:
+		return false, fmt.Errorf("unsupported OTEL_TRACES_EXPORTER %q: must be otlp or none", exporter)
+	}
+}
+
+// otlpProtocol returns the OTLP protocol spans are exported with.
+func otlpProtocol() string {
+	for _, name := range []string{"OTEL_EXPORTER_OTLP_TRACES_PROTOCOL", "OTEL_EXPORTER_OTLP_PROTOCOL"} {
+		if protocol := strings.TrimSpace(os.Getenv(name)); protocol != "" {
+			return protocol
+		}
+	}
+	return "http/protobuf"
+}
+
+// Start starts a span as a child of the span in ctx, returning a context
+// holding the new span. The span must be ended, usually with End.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, opts...)
+}
+
+// End ends span, recording err, if any, as the reason it failed.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Inject returns the trace context of ctx as a carrier for a message, or
+// nil if ctx has no span.
+func Inject(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return nil
+	}
+	return carrier
+}
+
+// Extract returns ctx with the remote span of a carrier built by Inject, so
+// spans started from it continue the trace of the message's producer.
+func Extract(ctx context.Context, carrier map[string]string) context.Context {
+	if len(carrier) == 0 {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(carrier))
+}
@@ -0,0 +1,133 @@
+package trend
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/token"
+)
+
+// Route is the pattern the trend handler is registered under.
+const Route = "GET /api/v1/repos/{org}/{repo}/trend"
+
+// Repositories looks up a repository's default branch, the branch served
+// when a request names none. *github.Client implements it.
+type Repositories interface {
+	GetRepository(ctx context.Context, owner, repo string) (*github.RepositoryInfo, error)
+}
+
+// Response is the body of a trend request.
+type Response struct {
+	Org    string  `json:"org"`
+	Repo   string  `json:"repo"`
+	Branch string  `json:"branch"`
+	Points []Point `json:"points"`
+}
+
+// Handler serves the coverage trend of a branch as JSON, oldest point
+// first. Query parameters:
+//
+//	branch  the branch (default: the repository's default branch)
+//	since   RFC 3339 time of the oldest point returned (optional)
+//	until   RFC 3339 time of the newest point returned (optional)
+//	limit   the number of newest points returned (optional)
+type Handler struct {
+	storage storage.Storage
+	repos   Repositories
+	logger  *slog.Logger
+}
+
+// NewHandler creates a trend Handler. If repos is nil, requests must name
+// a branch.
+func NewHandler(storage storage.Storage, repos Repositories, logger *slog.Logger) *Handler {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Handler{
+		storage: storage,
+		repos:   repos,
+		logger:  logger,
+	}
+}
+
+// Register adds the trend route to mux, requiring a query-scoped token.
+func (h *Handler) Register(mux *http.ServeMux, tokens *token.Manager) {
+	mux.Handle(Route, token.RequireScope(tokens, token.ScopeQuery)(h))
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	org := r.PathValue("org")
+	repo := r.PathValue("repo")
+	if t, ok := token.FromContext(r.Context()); ok && !t.Allows(org, repo) {
+		http.Error(w, token.ErrForbidden.Error(), http.StatusForbidden)
+		return
+	}
+
+	query := r.URL.Query()
+	since, err := parseTime(query.Get("since"))
+	if err != nil {
+		http.Error(w, "invalid since: expected an RFC 3339 time", http.StatusBadRequest)
+		return
+	}
+	until, err := parseTime(query.Get("until"))
+	if err != nil {
+		http.Error(w, "invalid until: expected an RFC 3339 time", http.StatusBadRequest)
+		return
+	}
+	limit := 0
+	if s := query.Get("limit"); s != "" {
+		if limit, err = strconv.Atoi(s); err != nil || limit < 1 {
+			http.Error(w, "invalid limit: expected a positive number", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx := r.Context()
+	branch := query.Get("branch")
+	if branch == "" {
+		if h.repos == nil {
+			http.Error(w, "branch is required", http.StatusBadRequest)
+			return
+		}
+		info, err := h.repos.GetRepository(ctx, org, repo)
+		if err != nil {
+			if github.IsNotFound(err) {
+				http.Error(w, "repository not found", http.StatusNotFound)
+				return
+			}
+			h.logger.Error("failed to get repository", "org", org, "repo", repo, "error", err)
+			http.Error(w, "failed to get repository", http.StatusBadGateway)
+			return
+		}
+		branch = info.DefaultBranch
+	}
+
+	series, err := Get(ctx, h.storage, org, repo, branch)
+	if err != nil {
+		h.logger.Error("failed to load coverage trend", "org", org, "repo", repo, "branch", branch, "error", err)
+		http.Error(w, "failed to load coverage trend", http.StatusInternalServerError)
+		return
+	}
+	points := series.Between(since, until)
+	if limit > 0 && len(points) > limit {
+		points = points[len(points)-limit:]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Response{Org: org, Repo: repo, Branch: branch, Points: points})
+}
+
+// parseTime parses an optional RFC 3339 time; empty is the zero time.
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
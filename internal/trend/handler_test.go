@@ -0,0 +1,194 @@
+package trend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/token"
+)
+
+// stubStorage serves series from a map keyed by branch.
+type stubStorage struct {
+	byBranch map[string][]byte
+	err      error
+}
+
+func (s *stubStorage) SaveCoverage(ctx context.Context, key storage.CoverageKey, data []byte) error {
+	s.byBranch[key.Branch] = data
+	return nil
+}
+
+func (s *stubStorage) GetCoverage(ctx context.Context, key storage.CoverageKey) ([]byte, error) {
+	if !key.Trend {
+		return nil, errors.New("not a trend key")
+	}
+	return s.byBranch[key.Branch], s.err
+}
+
+func (s *stubStorage) SaveCoverageReader(ctx context.Context, key storage.CoverageKey, reader io.Reader, size int64) error {
+	return nil
+}
+
+func (s *stubStorage) Close() error { return nil }
+
+// stubRepos serves a fixed default branch.
+type stubRepos struct {
+	defaultBranch string
+	err           error
+}
+
+func (s *stubRepos) GetRepository(ctx context.Context, owner, repo string) (*github.RepositoryInfo, error) {
+	return &github.RepositoryInfo{DefaultBranch: s.defaultBranch}, s.err
+}
+
+func TestHandler(t *testing.T) {
+	ctx := context.Background()
+	manager := token.NewManager(token.NewInMemoryStore())
+	_, queryToken, err := manager.Issue(ctx, token.IssueRequest{Name: "dashboards", Org: "grafana", Scopes: []token.Scope{token.ScopeQuery}})
+	require.NoError(t, err)
+	_, uploadToken, err := manager.Issue(ctx, token.IssueRequest{Name: "ci", Org: "grafana", Scopes: []token.Scope{token.ScopeUpload}})
+	require.NoError(t, err)
+
+	series := func(points ...Point) []byte {
+		data, err := (&Series{Points: points}).Marshal()
+		require.NoError(t, err)
+		return data
+	}
+	store := &stubStorage{byBranch: map[string][]byte{
+		"main":    series(point("a", 1), point("b", 2), point("c", 3)),
+		"release": series(point("r", 1)),
+	}}
+
+	tests := []struct {
+		name           string
+		token          string
+		target         string
+		repos          Repositories
+		storage        storage.Storage
+		expectedStatus int
+		expected       *Response
+	}{
+		{
+			name:           "default branch",
+			token:          queryToken,
+			target:         "/api/v1/repos/grafana/mimir/trend",
+			repos:          &stubRepos{defaultBranch: "main"},
+			expectedStatus: http.StatusOK,
+			expected:       &Response{Org: "grafana", Repo: "mimir", Branch: "main", Points: []Point{point("a", 1), point("b", 2), point("c", 3)}},
+		},
+		{
+			name:           "branch",
+			token:          queryToken,
+			target:         "/api/v1/repos/grafana/mimir/trend?branch=release",
+			expectedStatus: http.StatusOK,
+			expected:       &Response{Org: "grafana", Repo: "mimir", Branch: "release", Points: []Point{point("r", 1)}},
+		},
+		{
+			name:           "since and limit",
+			token:          queryToken,
+			target:         "/api/v1/repos/grafana/mimir/trend?branch=main&since=2026-01-17T00:00:00Z&limit=1",
+			expectedStatus: http.StatusOK,
+			expected:       &Response{Org: "grafana", Repo: "mimir", Branch: "main", Points: []Point{point("c", 3)}},
+		},
+		{
+			name:           "until",
+			token:          queryToken,
+			target:         "/api/v1/repos/grafana/mimir/trend?branch=main&until=2026-01-16T00:00:00Z",
+			expectedStatus: http.StatusOK,
+			expected:       &Response{Org: "grafana", Repo: "mimir", Branch: "main", Points: []Point{point("a", 1)}},
+		},
+		{
+			name:           "branch without a trend",
+			token:          queryToken,
+			target:         "/api/v1/repos/grafana/mimir/trend?branch=feature",
+			expectedStatus: http.StatusOK,
+			expected:       &Response{Org: "grafana", Repo: "mimir", Branch: "feature", Points: []Point{}},
+		},
+		{
+			name:           "branch required without repositories",
+			token:          queryToken,
+			target:         "/api/v1/repos/grafana/mimir/trend",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "repository not found",
+			token:          queryToken,
+			target:         "/api/v1/repos/grafana/mimir/trend",
+			repos:          &stubRepos{err: &github.APIError{StatusCode: http.StatusNotFound}},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "invalid since",
+			token:          queryToken,
+			target:         "/api/v1/repos/grafana/mimir/trend?branch=main&since=yesterday",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid limit",
+			token:          queryToken,
+			target:         "/api/v1/repos/grafana/mimir/trend?branch=main&limit=0",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "storage failure",
+			token:          queryToken,
+			target:         "/api/v1/repos/grafana/mimir/trend?branch=main",
+			storage:        &stubStorage{err: errors.New("unavailable")},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "missing token",
+			target:         "/api/v1/repos/grafana/mimir/trend?branch=main",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "token without query scope",
+			token:          uploadToken,
+			target:         "/api/v1/repos/grafana/mimir/trend?branch=main",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "token for another org",
+			token:          queryToken,
+			target:         "/api/v1/repos/other/mimir/trend?branch=main",
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.storage
+			if s == nil {
+				s = store
+			}
+			mux := http.NewServeMux()
+			NewHandler(s, tt.repos, nil).Register(mux, manager)
+
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			require.Equal(t, tt.expectedStatus, rec.Code, rec.Body.String())
+			if tt.expected == nil {
+				return
+			}
+			assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+			var got Response
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+			assert.Equal(t, *tt.expected, got)
+		})
+	}
+}
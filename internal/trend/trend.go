@@ -0,0 +1,167 @@
+// Package trend records the coverage of branches over time, one point per
+// commit, and serves the series for dashboards.
+//
+// A branch's series is stored as JSON next to its coverage (see
+// storage.CoverageKey.Trend). The worker appends a point each time it saves
+// a branch's coverage; runs of a branch are processed one at a time, so
+// appends don't race.
+package trend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+)
+
+// DefaultMaxPoints is the number of points a series keeps by default; older
+// points are dropped as new ones are added.
+const DefaultMaxPoints = 1000
+
+// Point is the coverage of a branch at a commit.
+type Point struct {
+	// Time is when the commit's run completed
+	Time              time.Time `json:"time"`
+	Commit            string    `json:"commit"`
+	TotalStatements   int       `json:"total_statements"`
+	CoveredStatements int       `json:"covered_statements"`
+	Percentage        float64   `json:"percentage"`
+}
+
+// NewPoint returns the point of a commit with the given coverage.
+func NewPoint(commit string, at time.Time, stats *coverage.CoverageStats) Point {
+	return Point{
+		Time:              at.UTC(),
+		Commit:            commit,
+		TotalStatements:   stats.TotalStatements,
+		CoveredStatements: stats.CoveredStatements,
+		Percentage:        stats.Percentage,
+	}
+}
+
+// Series is the coverage trend of a branch, oldest point first.
+type Series struct {
+	Points []Point `json:"points"`
+}
+
+// Key returns the storage key of a branch's series.
+func Key(org, repo, branch string) storage.CoverageKey {
+	return storage.CoverageKey{Org: org, Repo: repo, Branch: branch, Trend: true}
+}
+
+// Parse decodes a stored series; nil or empty data is an empty series.
+func Parse(data []byte) (*Series, error) {
+	s := &Series{}
+	if len(data) == 0 {
+		return s, nil
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("failed to parse coverage trend: %w", err)
+	}
+	return s, nil
+}
+
+// Marshal encodes the series for storage.
+func (s *Series) Marshal() ([]byte, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode coverage trend: %w", err)
+	}
+	return data, nil
+}
+
+// Add adds p to the series, replacing the point of the same commit if any,
+// so reprocessed runs aren't counted twice. Points are kept sorted by time;
+// past maxPoints (DefaultMaxPoints if not positive), the oldest are dropped.
+func (s *Series) Add(p Point, maxPoints int) {
+	if maxPoints <= 0 {
+		maxPoints = DefaultMaxPoints
+	}
+	points := s.Points[:0]
+	for _, existing := range s.Points {
+		if existing.Commit != p.Commit {
+			points = append(points, existing)
+		}
+	}
+	points = append(points, p)
+	sort.SliceStable(points, func(i, j int) bool { return points[i].Time.Before(points[j].Time) })
+	if len(points) > maxPoints {
+		points = points[len(points)-maxPoints:]
+	}
+	s.Points = points
+}
+
+// Between returns the points from since up to and including until; zero
+// times leave that end open.
+func (s *Series) Between(since, until time.Time) []Point {
+	points := []Point{}
+	for _, p := range s.Points {
+		if (!since.IsZero() && p.Time.Before(since)) || (!until.IsZero() && p.Time.After(until)) {
+			continue
+		}
+		points = append(points, p)
+	}
+	return points
+}
+
+// Compact folds the points before cutoff into one point per day, the last
+// of the day, so a series keeps its shape once old commits are pruned. It
+// returns the number of points removed.
+func (s *Series) Compact(cutoff time.Time) int {
+	points := s.Points[:0]
+	removed := 0
+	for i, p := range s.Points {
+		if p.Time.Before(cutoff) && i+1 < len(s.Points) && s.Points[i+1].Time.Before(cutoff) &&
+			sameDay(p.Time, s.Points[i+1].Time) {
+			removed++
+			continue
+		}
+		points = append(points, p)
+	}
+	s.Points = points
+	return removed
+}
+
+// sameDay reports whether a and b are on the same UTC day.
+func sameDay(a, b time.Time) bool {
+	ay, am, ad := a.UTC().Date()
+	by, bm, bd := b.UTC().Date()
+	return ay == by && am == bm && ad == bd
+}
+
+// CompactStored compacts the stored series of a branch (see Series.Compact)
+// and returns the number of points removed. With dryRun, the series is not
+// saved. A point the worker appends while the series is being compacted is
+// lost, so compact when the branch isn't being pushed to, e.g. with prune.
+func CompactStored(ctx context.Context, store storage.Storage, org, repo, branch string, cutoff time.Time, dryRun bool) (int, error) {
+	series, err := Get(ctx, store, org, repo, branch)
+	if err != nil {
+		return 0, err
+	}
+	removed := series.Compact(cutoff)
+	if removed == 0 || dryRun {
+		return removed, nil
+	}
+	data, err := series.Marshal()
+	if err != nil {
+		return 0, err
+	}
+	if err := store.SaveCoverage(ctx, Key(org, repo, branch), data); err != nil {
+		return 0, fmt.Errorf("failed to save coverage trend: %w", err)
+	}
+	return removed, nil
+}
+
+// Get returns the stored series of a branch; a branch without one has an
+// empty series.
+func Get(ctx context.Context, store storage.Storage, org, repo, branch string) (*Series, error) {
+	data, err := store.GetCoverage(ctx, Key(org, repo, branch))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get coverage trend: %w", err)
+	}
+	return Parse(data)
+}
@@ -0,0 +1,185 @@
+package trend
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+)
+
+var day = time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC)
+
+// point returns a point of commit sha, the given number of days after day.
+func point(sha string, days int) Point {
+	return Point{Time: day.AddDate(0, 0, days), Commit: sha, TotalStatements: 10, CoveredStatements: days, Percentage: float64(days * 10)}
+}
+
+func TestSeries_Add(t *testing.T) {
+	tests := []struct {
+		name      string
+		points    []Point
+		add       Point
+		maxPoints int
+		expected  []Point
+	}{
+		{
+			name:     "appends to an empty series",
+			add:      point("a", 1),
+			expected: []Point{point("a", 1)},
+		},
+		{
+			name:     "keeps points sorted by time",
+			points:   []Point{point("a", 1), point("c", 3)},
+			add:      point("b", 2),
+			expected: []Point{point("a", 1), point("b", 2), point("c", 3)},
+		},
+		{
+			name:     "replaces the point of the same commit",
+			points:   []Point{point("a", 1), point("b", 2)},
+			add:      Point{Time: day.AddDate(0, 0, 2), Commit: "a", Percentage: 99},
+			expected: []Point{point("b", 2), {Time: day.AddDate(0, 0, 2), Commit: "a", Percentage: 99}},
+		},
+		{
+			name:      "drops the oldest points past the limit",
+			points:    []Point{point("a", 1), point("b", 2), point("c", 3)},
+			add:       point("d", 4),
+			maxPoints: 2,
+			expected:  []Point{point("c", 3), point("d", 4)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Series{Points: tt.points}
+			s.Add(tt.add, tt.maxPoints)
+			assert.Equal(t, tt.expected, s.Points)
+		})
+	}
+}
+
+func TestSeries_Between(t *testing.T) {
+	s := &Series{Points: []Point{point("a", 1), point("b", 2), point("c", 3)}}
+
+	tests := []struct {
+		name     string
+		since    time.Time
+		until    time.Time
+		expected []Point
+	}{
+		{name: "open", expected: s.Points},
+		{name: "since", since: day.AddDate(0, 0, 2), expected: []Point{point("b", 2), point("c", 3)}},
+		{name: "until", until: day.AddDate(0, 0, 2), expected: []Point{point("a", 1), point("b", 2)}},
+		{name: "none in range", since: day.AddDate(0, 0, 4), expected: []Point{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, s.Between(tt.since, tt.until))
+		})
+	}
+}
+
+func TestSeries_Compact(t *testing.T) {
+	// at returns a point of commit sha at the given hour of day's date
+	at := func(sha string, days, hour int) Point {
+		p := point(sha, days)
+		p.Time = p.Time.Add(time.Duration(hour) * time.Hour)
+		return p
+	}
+
+	tests := []struct {
+		name     string
+		points   []Point
+		cutoff   time.Time
+		expected []Point
+		removed  int
+	}{
+		{
+			name:     "keeps the last point of each day before the cutoff",
+			points:   []Point{at("a", 1, 9), at("b", 1, 17), at("c", 2, 9), at("d", 3, 9), at("e", 3, 12)},
+			cutoff:   day.AddDate(0, 0, 3),
+			expected: []Point{at("b", 1, 17), at("c", 2, 9), at("d", 3, 9), at("e", 3, 12)},
+			removed:  1,
+		},
+		{
+			name:     "keeps points after the cutoff on a compacted day",
+			points:   []Point{at("a", 1, 9), at("b", 1, 12), at("c", 1, 17)},
+			cutoff:   day.AddDate(0, 0, 1).Add(15 * time.Hour),
+			expected: []Point{at("b", 1, 12), at("c", 1, 17)},
+			removed:  1,
+		},
+		{
+			name:     "nothing before the cutoff",
+			points:   []Point{at("a", 1, 9), at("b", 1, 12)},
+			cutoff:   day,
+			expected: []Point{at("a", 1, 9), at("b", 1, 12)},
+		},
+		{
+			name: "empty series",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Series{Points: tt.points}
+			assert.Equal(t, tt.removed, s.Compact(tt.cutoff))
+			assert.Equal(t, tt.expected, s.Points)
+		})
+	}
+}
+
+func TestCompactStored(t *testing.T) {
+	ctx := context.Background()
+	original := &Series{Points: []Point{point("a", 1), point("b", 1), point("c", 2)}}
+	data, err := original.Marshal()
+	require.NoError(t, err)
+
+	for _, dryRun := range []bool{true, false} {
+		store := &stubStorage{byBranch: map[string][]byte{"main": data}}
+		removed, err := CompactStored(ctx, store, "acme", "widgets", "main", day.AddDate(0, 0, 3), dryRun)
+		require.NoError(t, err)
+		assert.Equal(t, 1, removed)
+
+		s, err := Get(ctx, store, "acme", "widgets", "main")
+		require.NoError(t, err)
+		if dryRun {
+			assert.Equal(t, original.Points, s.Points)
+		} else {
+			assert.Equal(t, []Point{point("b", 1), point("c", 2)}, s.Points)
+		}
+	}
+
+	_, err = CompactStored(ctx, &stubStorage{err: errors.New("boom")}, "acme", "widgets", "main", day, false)
+	assert.ErrorContains(t, err, "failed to get coverage trend")
+}
+
+func TestParse(t *testing.T) {
+	s, err := Parse(nil)
+	require.NoError(t, err)
+	assert.Empty(t, s.Points)
+
+	_, err = Parse([]byte("not json"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to parse coverage trend")
+
+	original := &Series{Points: []Point{point("a", 1), point("b", 2)}}
+	data, err := original.Marshal()
+	require.NoError(t, err)
+	parsed, err := Parse(data)
+	require.NoError(t, err)
+	assert.Equal(t, original, parsed)
+}
+
+func TestNewPoint(t *testing.T) {
+	profiles, err := coverage.ParseProfiles([]byte("mode: set\na.go:1.1,2.2 3 1\na.go:3.1,4.2 1 0\n"))
+	require.NoError(t, err)
+
+	p := NewPoint("abc123", day.In(time.FixedZone("CET", 3600)), coverage.CalculateCoverageStats(profiles))
+
+	assert.Equal(t, Point{Time: day, Commit: "abc123", TotalStatements: 4, CoveredStatements: 3, Percentage: 75}, p)
+}
@@ -0,0 +1,191 @@
+// Package upload serves the coverage upload endpoint, through which CI jobs
+// outside GitHub Actions, e.g. GitLab CI or Drone, push the coverage of a
+// commit for Canopy to analyze instead of uploading workflow artifacts.
+//
+// The route requires a token with the upload scope, and accepts coverage
+// only for the org or repository the token is scoped to.
+package upload
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/logging"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/queue"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/token"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/tracing"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/worker"
+)
+
+// Route is the upload endpoint served by Handler.
+const Route = "POST /api/v1/upload"
+
+// maxUploadSize bounds uploaded coverage, like artifact archives.
+const maxUploadSize = 500 << 20
+
+var (
+	// namePattern matches GitHub org and repository names
+	namePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+	// shaPattern matches full SHA-1 and SHA-256 commit hashes
+	shaPattern = regexp.MustCompile(`^([0-9a-f]{40}|[0-9a-f]{64})$`)
+)
+
+// Publisher publishes work requests for workers; every queue.MessageQueue
+// implements it.
+type Publisher interface {
+	Publish(ctx context.Context, req *queue.WorkRequest) error
+}
+
+// Response is the JSON body of an accepted upload.
+type Response struct {
+	Status string `json:"status"`
+	// CorrelationID traces the analysis of the upload in logs and on its
+	// check run
+	CorrelationID string `json:"correlation_id"`
+}
+
+// Handler accepts coverage uploads. The coverage of a commit is stored
+// where worker.StorageArtifactSource reads it (see worker.ArtifactCopyKey),
+// replacing earlier uploads for the commit, and a queue.EventUpload
+// WorkRequest is published to analyze it.
+//
+// The org, repo, branch, and sha query parameters name the commit, and
+// pull_request, if set, the PR it is the head of; PR uploads are analyzed
+// like PR runs, others like branch runs. The body is a coverage file in any
+// format canopy reads, or a zip archive of them.
+type Handler struct {
+	storage storage.Storage
+	queue   Publisher
+	logger  *slog.Logger
+}
+
+// NewHandler creates an upload Handler storing coverage in storage and
+// publishing its analysis to queue.
+func NewHandler(storage storage.Storage, queue Publisher, logger *slog.Logger) *Handler {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Handler{storage: storage, queue: queue, logger: logger}
+}
+
+// Register adds the upload route to mux, requiring an upload-scoped token.
+func (h *Handler) Register(mux *http.ServeMux, tokens *token.Manager) {
+	mux.Handle(Route, token.RequireScope(tokens, token.ScopeUpload)(h))
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	req := &queue.WorkRequest{
+		Version:    queue.SchemaVersion,
+		Org:        query.Get("org"),
+		Repo:       query.Get("repo"),
+		EventType:  queue.EventUpload,
+		HeadSHA:    query.Get("sha"),
+		HeadBranch: query.Get("branch"),
+	}
+	if err := validate(req, query.Get("pull_request")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if t, ok := token.FromContext(r.Context()); ok && !t.Allows(req.Org, req.Repo) {
+		http.Error(w, token.ErrForbidden.Error(), http.StatusForbidden)
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxUploadSize))
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		http.Error(w, fmt.Sprintf("coverage exceeds %d bytes", maxUploadSize), http.StatusRequestEntityTooLarge)
+		return
+	case err != nil:
+		http.Error(w, "failed to read coverage: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := checkCoverage(data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req.CorrelationID = uuid.NewString()
+	ctx := r.Context()
+	logger := h.logger.With(logging.CorrelationIDKey, req.CorrelationID, "org", req.Org, "repo", req.Repo, "branch", req.HeadBranch, "sha", req.HeadSHA)
+	if err := h.storage.SaveCoverage(ctx, worker.ArtifactCopyKey(req.Org, req.Repo, req.HeadSHA), data); err != nil {
+		logger.Error("failed to store uploaded coverage", "error", err)
+		http.Error(w, "failed to store coverage", http.StatusInternalServerError)
+		return
+	}
+
+	publishCtx, publish := tracing.Start(ctx, "queue.publish", trace.WithSpanKind(trace.SpanKindProducer))
+	req.TraceContext = tracing.Inject(publishCtx)
+	start := time.Now()
+	err = h.queue.Publish(publishCtx, req)
+	queue.ObservePublish(start, err)
+	tracing.End(publish, err)
+	if err != nil {
+		logger.Error("failed to publish work request", "error", err)
+		http.Error(w, "failed to publish work request", http.StatusInternalServerError)
+		return
+	}
+	logger.Info("queued uploaded coverage", "bytes", len(data), "pull_request", req.PullRequest)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(Response{Status: "queued", CorrelationID: req.CorrelationID})
+}
+
+// validate checks the commit named by an upload, and sets its PR number.
+func validate(req *queue.WorkRequest, pullRequest string) error {
+	if req.Org == "" || req.Repo == "" || req.HeadBranch == "" || req.HeadSHA == "" {
+		return errors.New("org, repo, branch, and sha are required")
+	}
+	for _, name := range []string{req.Org, req.Repo} {
+		if !namePattern.MatchString(name) || name == "." || name == ".." {
+			return fmt.Errorf("invalid org or repo %q", name)
+		}
+	}
+	if err := worker.CheckBranch(req.HeadBranch); err != nil {
+		return fmt.Errorf("invalid branch: %w", err)
+	}
+	if !shaPattern.MatchString(req.HeadSHA) {
+		return fmt.Errorf("invalid sha %q: must be a full lowercase commit hash", req.HeadSHA)
+	}
+	if pullRequest != "" {
+		number, err := strconv.Atoi(pullRequest)
+		if err != nil || number < 1 {
+			return fmt.Errorf("invalid pull_request %q", pullRequest)
+		}
+		req.PullRequest = number
+	}
+	return nil
+}
+
+// checkCoverage rejects uploads the worker couldn't parse. Zip archives are
+// checked when they are analyzed.
+func checkCoverage(data []byte) error {
+	if len(data) == 0 {
+		return errors.New("coverage is empty")
+	}
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		return nil
+	}
+	if err := coverage.NewMerger().AddFrom(bytes.NewReader(data), coverage.FormatAuto); err != nil {
+		return fmt.Errorf("invalid coverage: %w", err)
+	}
+	return nil
+}
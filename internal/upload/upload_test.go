@@ -0,0 +1,163 @@
+package upload
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/queue"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/token"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/worker"
+)
+
+const (
+	testCoverage = "mode: set\ngithub.com/grafana/mimir/pkg/main.go:2.17,2.30 3 1\n"
+	testSHA      = "3f2a9c1e8b7d6a5f4e3d2c1b0a9f8e7d6c5b4a39"
+)
+
+// memoryStorage is an in-memory storage.Storage.
+type memoryStorage struct {
+	data map[storage.CoverageKey][]byte
+}
+
+func (m *memoryStorage) SaveCoverage(ctx context.Context, key storage.CoverageKey, data []byte) error {
+	m.data[key] = data
+	return nil
+}
+
+func (m *memoryStorage) GetCoverage(ctx context.Context, key storage.CoverageKey) ([]byte, error) {
+	return m.data[key], nil
+}
+
+func (m *memoryStorage) SaveCoverageReader(ctx context.Context, key storage.CoverageKey, reader io.Reader, size int64) error {
+	return errors.New("not implemented")
+}
+
+func (m *memoryStorage) Close() error { return nil }
+
+// recordingPublisher records published work requests.
+type recordingPublisher struct {
+	published []*queue.WorkRequest
+	err       error
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, req *queue.WorkRequest) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.published = append(p.published, req)
+	return nil
+}
+
+// testTokens returns a token manager and tokens with the upload scope for
+// the grafana org and with the query scope.
+func testTokens(t *testing.T) (manager *token.Manager, uploadToken, queryToken string) {
+	t.Helper()
+	ctx := context.Background()
+	manager = token.NewManager(token.NewInMemoryStore())
+	var err error
+	_, uploadToken, err = manager.Issue(ctx, token.IssueRequest{Name: "ci", Org: "grafana", Scopes: []token.Scope{token.ScopeUpload}})
+	require.NoError(t, err)
+	_, queryToken, err = manager.Issue(ctx, token.IssueRequest{Name: "dashboards", Org: "grafana", Scopes: []token.Scope{token.ScopeQuery}})
+	require.NoError(t, err)
+	return manager, uploadToken, queryToken
+}
+
+func TestHandler(t *testing.T) {
+	manager, uploadToken, queryToken := testTokens(t)
+	commit := "org=grafana&repo=mimir&branch=feature&sha=" + testSHA
+
+	tests := []struct {
+		name         string
+		token        string
+		query        string
+		body         string
+		publishErr   error
+		expectedCode int
+		expectedBody string
+		expectedReq  *queue.WorkRequest
+	}{
+		{
+			name:         "branch coverage",
+			token:        uploadToken,
+			query:        commit,
+			body:         testCoverage,
+			expectedCode: http.StatusAccepted,
+			expectedReq:  &queue.WorkRequest{Org: "grafana", Repo: "mimir", EventType: queue.EventUpload, HeadSHA: testSHA, HeadBranch: "feature"},
+		},
+		{
+			name:         "PR coverage",
+			token:        uploadToken,
+			query:        commit + "&pull_request=17",
+			body:         testCoverage,
+			expectedCode: http.StatusAccepted,
+			expectedReq:  &queue.WorkRequest{Org: "grafana", Repo: "mimir", EventType: queue.EventUpload, PullRequest: 17, HeadSHA: testSHA, HeadBranch: "feature"},
+		},
+		{name: "missing token", query: commit, body: testCoverage, expectedCode: http.StatusUnauthorized, expectedBody: "missing bearer token"},
+		{name: "query token", token: queryToken, query: commit, body: testCoverage, expectedCode: http.StatusForbidden},
+		{
+			name:         "other org",
+			token:        uploadToken,
+			query:        "org=acme&repo=widgets&branch=main&sha=" + testSHA,
+			body:         testCoverage,
+			expectedCode: http.StatusForbidden,
+		},
+		{name: "missing commit", token: uploadToken, query: "org=grafana&repo=mimir", body: testCoverage, expectedCode: http.StatusBadRequest, expectedBody: "org, repo, branch, and sha are required"},
+		{name: "path in repo", token: uploadToken, query: "org=grafana&repo=..&branch=main&sha=" + testSHA, body: testCoverage, expectedCode: http.StatusBadRequest, expectedBody: `invalid org or repo ".."`},
+		{name: "reserved branch", token: uploadToken, query: "org=grafana&repo=mimir&branch=pull/1&sha=" + testSHA, body: testCoverage, expectedCode: http.StatusBadRequest, expectedBody: `invalid branch: branch name is reserved: "pull/1" starts with "pull/"`},
+		{name: "short sha", token: uploadToken, query: "org=grafana&repo=mimir&branch=main&sha=3f2a9c1", body: testCoverage, expectedCode: http.StatusBadRequest, expectedBody: `invalid sha "3f2a9c1"`},
+		{name: "invalid PR", token: uploadToken, query: commit + "&pull_request=0", body: testCoverage, expectedCode: http.StatusBadRequest, expectedBody: `invalid pull_request "0"`},
+		{name: "empty coverage", token: uploadToken, query: commit, expectedCode: http.StatusBadRequest, expectedBody: "coverage is empty"},
+		{name: "invalid coverage", token: uploadToken, query: commit, body: "not coverage", expectedCode: http.StatusBadRequest, expectedBody: "invalid coverage"},
+		{
+			name:         "publish failure",
+			token:        uploadToken,
+			query:        commit,
+			body:         testCoverage,
+			publishErr:   errors.New("queue is closed"),
+			expectedCode: http.StatusInternalServerError,
+			expectedBody: "failed to publish work request",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &memoryStorage{data: map[storage.CoverageKey][]byte{}}
+			pub := &recordingPublisher{err: tt.publishErr}
+			mux := http.NewServeMux()
+			NewHandler(store, pub, nil).Register(mux, manager)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/upload?"+tt.query, strings.NewReader(tt.body))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedCode, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.expectedBody)
+			if tt.expectedReq == nil {
+				assert.Empty(t, pub.published)
+				return
+			}
+			assert.Equal(t, tt.body, string(store.data[worker.ArtifactCopyKey("grafana", "mimir", testSHA)]))
+			var resp Response
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			assert.Equal(t, "queued", resp.Status)
+			require.Len(t, pub.published, 1)
+			assert.Equal(t, resp.CorrelationID, pub.published[0].CorrelationID)
+			tt.expectedReq.Version = queue.SchemaVersion
+			tt.expectedReq.CorrelationID = resp.CorrelationID
+			assert.Equal(t, tt.expectedReq, pub.published[0])
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package viewer
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// fileView is one file of a rendered diff.
+type fileView struct {
+	Name      string
+	Anchor    string
+	Covered   int
+	Uncovered int
+	Lines     []lineView
+}
+
+// lineView is one rendered diff line.
+type lineView struct {
+	// Class is the CSS class: hunk, context, del, add, covered, or uncovered
+	Class   string
+	OldLine int
+	NewLine int
+	Text    string
+}
+
+var (
+	fileHeaderRe = regexp.MustCompile(`^diff --git a/(.+) b/(.+)$`)
+	hunkRe       = regexp.MustCompile(`^@@ -(\d+)(?:,\d+)? \+(\d+)(?:,\d+)? @@`)
+)
+
+// buildFiles splits a unified diff into files and classifies each line.
+// Added lines found in lineCoverage are marked covered or uncovered;
+// other added lines (files without coverage, non-executable lines) are plain additions.
+func buildFiles(diffData []byte, lineCoverage map[string]map[int]bool) []*fileView {
+	var files []*fileView
+	var current *fileView
+	var oldLine, newLine int
+	inHunk := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(diffData))
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if m := fileHeaderRe.FindStringSubmatch(line); m != nil {
+			current = &fileView{Name: m[2], Anchor: "file-" + strconv.Itoa(len(files))}
+			files = append(files, current)
+			inHunk = false
+			continue
+		}
+		if current == nil {
+			continue
+		}
+
+		if m := hunkRe.FindStringSubmatch(line); m != nil {
+			oldLine, _ = strconv.Atoi(m[1])
+			newLine, _ = strconv.Atoi(m[2])
+			inHunk = true
+			current.Lines = append(current.Lines, lineView{Class: "hunk", Text: line})
+			continue
+		}
+		if !inHunk {
+			continue // File header lines (index, ---, +++, mode changes)
+		}
+
+		switch {
+		case strings.HasPrefix(line, "+"):
+			view := lineView{Class: "add", NewLine: newLine, Text: line}
+			if covered, ok := lineCoverage[current.Name][newLine]; ok {
+				if covered {
+					view.Class = "covered"
+					current.Covered++
+				} else {
+					view.Class = "uncovered"
+					current.Uncovered++
+				}
+			}
+			current.Lines = append(current.Lines, view)
+			newLine++
+		case strings.HasPrefix(line, "-"):
+			current.Lines = append(current.Lines, lineView{Class: "del", OldLine: oldLine, Text: line})
+			oldLine++
+		case strings.HasPrefix(line, `\`):
+			// "\ No newline at end of file"
+			current.Lines = append(current.Lines, lineView{Class: "context", Text: line})
+		default:
+			current.Lines = append(current.Lines, lineView{Class: "context", OldLine: oldLine, NewLine: newLine, Text: line})
+			oldLine++
+			newLine++
+		}
+	}
+
+	return files
+}
@@ -0,0 +1,59 @@
+package viewer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildFiles(t *testing.T) {
+	diff := `diff --git a/main.go b/main.go
+index 1111111..2222222 100644
+--- a/main.go
++++ b/main.go
+@@ -10,3 +10,4 @@ func main() {
+ 	a()
+-	b()
++	c()
++	d()
+ }
+\ No newline at end of file
+diff --git a/README.md b/README.md
+--- a/README.md
++++ b/README.md
+@@ -0,0 +1 @@
++# Title
+`
+	lineCoverage := map[string]map[int]bool{
+		"main.go": {11: true, 12: false},
+	}
+
+	files := buildFiles([]byte(diff), lineCoverage)
+
+	require.Len(t, files, 2)
+
+	main := files[0]
+	assert.Equal(t, "main.go", main.Name)
+	assert.Equal(t, "file-0", main.Anchor)
+	assert.Equal(t, 1, main.Covered)
+	assert.Equal(t, 1, main.Uncovered)
+	assert.Equal(t, []lineView{
+		{Class: "hunk", Text: "@@ -10,3 +10,4 @@ func main() {"},
+		{Class: "context", OldLine: 10, NewLine: 10, Text: " \ta()"},
+		{Class: "del", OldLine: 11, Text: "-\tb()"},
+		{Class: "covered", NewLine: 11, Text: "+\tc()"},
+		{Class: "uncovered", NewLine: 12, Text: "+\td()"},
+		{Class: "context", OldLine: 12, NewLine: 13, Text: " }"},
+		{Class: "context", Text: `\ No newline at end of file`},
+	}, main.Lines)
+
+	readme := files[1]
+	assert.Equal(t, "README.md", readme.Name)
+	require.Len(t, readme.Lines, 2)
+	assert.Equal(t, lineView{Class: "add", NewLine: 1, Text: "+# Title"}, readme.Lines[1])
+}
+
+func TestBuildFiles_Empty(t *testing.T) {
+	assert.Empty(t, buildFiles(nil, nil))
+}
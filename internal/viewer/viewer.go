@@ -0,0 +1,178 @@
+package viewer
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github"
+	storagepkg "github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+)
+
+// Route is the pattern the viewer handler is registered under.
+// basehead is "<base>...<head>", matching GitHub's compare URLs.
+const Route = "GET /view/{org}/{repo}/compare/{basehead...}"
+
+// DiffFetcher fetches the unified diff between two refs.
+// *github.Client implements it.
+type DiffFetcher interface {
+	CompareDiff(ctx context.Context, owner, repo, base, head string) ([]byte, error)
+}
+
+// Handler renders a GitHub compare with stored head coverage overlaid,
+// highlighting covered and uncovered added lines. It is not bound by
+// GitHub's per-check-run annotation limits, so check runs can link to it
+// for the complete picture.
+type Handler struct {
+	storage storagepkg.Storage
+	diffs   DiffFetcher
+	logger  *slog.Logger
+}
+
+// NewHandler creates a viewer Handler.
+func NewHandler(storage storagepkg.Storage, diffs DiffFetcher, logger *slog.Logger) *Handler {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Handler{
+		storage: storage,
+		diffs:   diffs,
+		logger:  logger,
+	}
+}
+
+// Register adds the viewer route to mux.
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.Handle(Route, h)
+}
+
+// CompareURL builds the viewer URL for a compare, for linking from check run output.
+// coverageBranch selects the stored coverage to overlay; empty uses head.
+func CompareURL(baseURL, org, repo, base, head, coverageBranch string) string {
+	u := fmt.Sprintf("%s/view/%s/%s/compare/%s...%s", strings.TrimRight(baseURL, "/"),
+		url.PathEscape(org), url.PathEscape(repo), url.PathEscape(base), url.PathEscape(head))
+	if coverageBranch != "" && coverageBranch != head {
+		u += "?coverage=" + url.QueryEscape(coverageBranch)
+	}
+	return u
+}
+
+// ServeHTTP implements http.Handler.
+// The coverage query parameter selects the stored coverage branch (default: head).
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	org := r.PathValue("org")
+	repo := r.PathValue("repo")
+	base, head, ok := strings.Cut(r.PathValue("basehead"), "...")
+	if !ok || base == "" || head == "" {
+		http.Error(w, "expected compare in the form <base>...<head>", http.StatusBadRequest)
+		return
+	}
+
+	branch := r.URL.Query().Get("coverage")
+	if branch == "" {
+		branch = head
+	}
+
+	ctx := r.Context()
+	diffData, err := h.diffs.CompareDiff(ctx, org, repo, base, head)
+	if err != nil {
+		if github.IsNotFound(err) {
+			http.Error(w, "compare not found", http.StatusNotFound)
+			return
+		}
+		h.logger.Error("failed to fetch compare diff", "org", org, "repo", repo, "base", base, "head", head, "error", err)
+		http.Error(w, "failed to fetch diff", http.StatusBadGateway)
+		return
+	}
+
+	coverageData, err := h.storage.GetCoverage(ctx, storagepkg.CoverageKey{Org: org, Repo: repo, Branch: branch})
+	if err != nil {
+		h.logger.Error("failed to load coverage", "org", org, "repo", repo, "branch", branch, "error", err)
+		http.Error(w, "failed to load coverage", http.StatusInternalServerError)
+		return
+	}
+
+	page := &pageData{
+		Org:    org,
+		Repo:   repo,
+		Base:   base,
+		Head:   head,
+		Branch: branch,
+	}
+
+	var lineCoverage map[string]map[int]bool
+	if coverageData == nil {
+		page.Missing = true
+	} else {
+		profiles, err := coverage.ParseProfiles(coverageData)
+		if err != nil {
+			h.logger.Error("failed to parse stored coverage", "org", org, "repo", repo, "branch", branch, "error", err)
+			http.Error(w, "failed to parse stored coverage", http.StatusInternalServerError)
+			return
+		}
+
+		fileDiffs, err := coverage.ParseDiff(diffData)
+		if err == nil {
+			lineCoverage = coverage.LineCoverageByFile(profiles, coverage.GetAddedLinesByFile(fileDiffs))
+		}
+	}
+
+	page.Files = buildFiles(diffData, lineCoverage)
+	for _, f := range page.Files {
+		page.Covered += f.Covered
+		page.Uncovered += f.Uncovered
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := pageTemplate.Execute(w, page); err != nil {
+		h.logger.Error("failed to render viewer page", "error", err)
+	}
+}
+
+// pageData is the template input for the viewer page.
+type pageData struct {
+	Org       string
+	Repo      string
+	Base      string
+	Head      string
+	Branch    string
+	Missing   bool
+	Covered   int
+	Uncovered int
+	Files     []*fileView
+}
+
+var pageTemplate = template.Must(template.New("viewer").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Coverage: {{.Org}}/{{.Repo}} {{.Base}}...{{.Head}}</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", sans-serif; margin: 2em; }
+table.diff { border-collapse: collapse; width: 100%; font-family: ui-monospace, monospace; font-size: 12px; margin-bottom: 2em; }
+table.diff td { padding: 0 0.5em; white-space: pre; vertical-align: top; }
+td.num { color: #6e7781; text-align: right; user-select: none; width: 1%; }
+tr.hunk td { background: #ddf4ff; color: #57606a; }
+tr.del td { background: #ffebe9; }
+tr.add td { background: #f6f8fa; }
+tr.covered td { background: #dafbe1; }
+tr.uncovered td { background: #ffd7d5; }
+.summary span { margin-right: 1em; }
+</style>
+</head>
+<body>
+<h1>{{.Org}}/{{.Repo}}: {{.Base}}...{{.Head}}</h1>
+{{if .Missing}}<p>No coverage stored for branch <code>{{.Branch}}</code>; showing the diff only.</p>
+{{else}}<p class="summary"><span>Coverage from <code>{{.Branch}}</code></span><span>{{.Covered}} covered</span><span>{{.Uncovered}} uncovered</span></p>
+{{end}}{{range .Files}}<h2 id="{{.Anchor}}">{{.Name}}{{if or .Covered .Uncovered}} <small>({{.Covered}} covered, {{.Uncovered}} uncovered)</small>{{end}}</h2>
+<table class="diff">
+{{range .Lines}}<tr class="{{.Class}}"><td class="num">{{if .OldLine}}{{.OldLine}}{{end}}</td><td class="num">{{if .NewLine}}{{.NewLine}}{{end}}</td><td>{{.Text}}</td></tr>
+{{end}}</table>
+{{end}}</body>
+</html>
+`))
@@ -0,0 +1,200 @@
+package viewer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github"
+	storagepkg "github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+)
+
+const testDiff = `diff --git a/pkg/main.go b/pkg/main.go
+index 1111111..2222222 100644
+--- a/pkg/main.go
++++ b/pkg/main.go
+@@ -1,2 +1,4 @@
+ package main
+-func old() {}
++func covered() {
++	uncovered()
++}
+`
+
+const testCoverage = `mode: set
+github.com/grafana/mimir/pkg/main.go:2.17,2.30 1 1
+github.com/grafana/mimir/pkg/main.go:3.1,3.13 1 0
+`
+
+// stubStorage serves coverage from a map keyed by branch.
+type stubStorage struct {
+	byBranch map[string][]byte
+	err      error
+}
+
+func (s *stubStorage) SaveCoverage(ctx context.Context, key storagepkg.CoverageKey, data []byte) error {
+	return nil
+}
+
+func (s *stubStorage) GetCoverage(ctx context.Context, key storagepkg.CoverageKey) ([]byte, error) {
+	return s.byBranch[key.Branch], s.err
+}
+
+func (s *stubStorage) SaveCoverageReader(ctx context.Context, key storagepkg.CoverageKey, reader io.Reader, size int64) error {
+	return nil
+}
+
+func (s *stubStorage) Close() error { return nil }
+
+// stubDiffs returns a fixed diff and records the requested refs.
+type stubDiffs struct {
+	diff       []byte
+	err        error
+	base, head string
+}
+
+func (s *stubDiffs) CompareDiff(ctx context.Context, owner, repo, base, head string) ([]byte, error) {
+	s.base, s.head = base, head
+	return s.diff, s.err
+}
+
+func serve(t *testing.T, h *Handler, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	mux := http.NewServeMux()
+	h.Register(mux)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	return rec
+}
+
+func TestHandler_RendersCoverage(t *testing.T) {
+	diffs := &stubDiffs{diff: []byte(testDiff)}
+	store := &stubStorage{byBranch: map[string][]byte{"feature/x": []byte(testCoverage)}}
+	h := NewHandler(store, diffs, nil)
+
+	rec := serve(t, h, "/view/grafana/mimir/compare/main...feature/x")
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "main", diffs.base)
+	assert.Equal(t, "feature/x", diffs.head)
+	assert.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+
+	body := rec.Body.String()
+	assert.Contains(t, body, `<tr class="covered">`)
+	assert.Contains(t, body, `<tr class="uncovered">`)
+	assert.Contains(t, body, "1 covered")
+	assert.Contains(t, body, "1 uncovered")
+	assert.Contains(t, body, "pkg/main.go")
+}
+
+func TestHandler_CoverageBranchOverride(t *testing.T) {
+	store := &stubStorage{byBranch: map[string][]byte{"main": []byte(testCoverage)}}
+	h := NewHandler(store, &stubDiffs{diff: []byte(testDiff)}, nil)
+
+	rec := serve(t, h, "/view/grafana/mimir/compare/v1.0.0...abc123?coverage=main")
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Coverage from <code>main</code>")
+}
+
+func TestHandler_MissingCoverage(t *testing.T) {
+	h := NewHandler(&stubStorage{}, &stubDiffs{diff: []byte(testDiff)}, nil)
+
+	rec := serve(t, h, "/view/grafana/mimir/compare/main...feature")
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	body := rec.Body.String()
+	assert.Contains(t, body, "No coverage stored for branch")
+	assert.NotContains(t, body, `<tr class="covered">`)
+	assert.Contains(t, body, `<tr class="add">`)
+}
+
+func TestHandler_Errors(t *testing.T) {
+	tests := []struct {
+		name           string
+		target         string
+		diffs          *stubDiffs
+		store          *stubStorage
+		expectedStatus int
+	}{
+		{
+			name:           "malformed compare",
+			target:         "/view/grafana/mimir/compare/main",
+			diffs:          &stubDiffs{},
+			store:          &stubStorage{},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "compare not found",
+			target:         "/view/grafana/mimir/compare/main...nope",
+			diffs:          &stubDiffs{err: &github.APIError{StatusCode: http.StatusNotFound}},
+			store:          &stubStorage{},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "github failure",
+			target:         "/view/grafana/mimir/compare/main...feature",
+			diffs:          &stubDiffs{err: errors.New("timeout")},
+			store:          &stubStorage{},
+			expectedStatus: http.StatusBadGateway,
+		},
+		{
+			name:           "storage failure",
+			target:         "/view/grafana/mimir/compare/main...feature",
+			diffs:          &stubDiffs{diff: []byte(testDiff)},
+			store:          &stubStorage{err: errors.New("bucket unavailable")},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "corrupt stored coverage",
+			target:         "/view/grafana/mimir/compare/main...feature",
+			diffs:          &stubDiffs{diff: []byte(testDiff)},
+			store:          &stubStorage{byBranch: map[string][]byte{"feature": []byte("garbage")}},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(t, NewHandler(tt.store, tt.diffs, nil), tt.target)
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+		})
+	}
+}
+
+func TestHandler_EscapesContent(t *testing.T) {
+	diff := "diff --git a/x.go b/x.go\n--- a/x.go\n+++ b/x.go\n@@ -0,0 +1 @@\n+<script>alert(1)</script>\n"
+	h := NewHandler(&stubStorage{}, &stubDiffs{diff: []byte(diff)}, nil)
+
+	rec := serve(t, h, "/view/grafana/mimir/compare/main...feature")
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "<script>alert(1)</script>")
+	assert.Contains(t, rec.Body.String(), "&lt;script&gt;")
+}
+
+func TestCompareURL(t *testing.T) {
+	tests := []struct {
+		name           string
+		head           string
+		coverageBranch string
+		expected       string
+	}{
+		{"head coverage", "feature/x", "", "https://canopy.example.com/view/grafana/mimir/compare/main...feature%2Fx"},
+		{"same branch omitted", "feature", "feature", "https://canopy.example.com/view/grafana/mimir/compare/main...feature"},
+		{"explicit coverage branch", "abc123", "feature/x", "https://canopy.example.com/view/grafana/mimir/compare/main...abc123?coverage=feature%2Fx"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CompareURL("https://canopy.example.com/", "grafana", "mimir", "main", tt.head, tt.coverageBranch)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
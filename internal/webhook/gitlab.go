@@ -0,0 +1,164 @@
+package webhook
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/queue"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/tracing"
+)
+
+// gitLabPipelineHook is the X-Gitlab-Event header of pipeline events.
+const gitLabPipelineHook = "Pipeline Hook"
+
+// gitLabTimeLayout is the layout of times in GitLab webhook payloads.
+const gitLabTimeLayout = "2006-01-02 15:04:05 MST"
+
+var (
+	// ErrMissingGitLabToken is returned when the token header is missing
+	ErrMissingGitLabToken = errors.New("missing X-Gitlab-Token header")
+
+	// ErrInvalidGitLabToken is returned when the token doesn't match
+	ErrInvalidGitLabToken = errors.New("invalid X-Gitlab-Token header")
+
+	// ErrNotAnalyzedPipeline is returned when a pipeline didn't succeed or
+	// ran for a tag
+	ErrNotAnalyzedPipeline = errors.New("pipeline must be a successful branch or merge request pipeline")
+)
+
+// ValidateGitLabToken checks the X-Gitlab-Token header of a GitLab webhook
+// against the secret token configured for it, in constant time.
+func ValidateGitLabToken(token, secret string) error {
+	if token == "" {
+		return ErrMissingGitLabToken
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+		return ErrInvalidGitLabToken
+	}
+	return nil
+}
+
+// GitLabPipelineEvent represents the minimal structure of a GitLab pipeline
+// webhook event needed to analyze the coverage of its jobs.
+type GitLabPipelineEvent struct {
+	ObjectAttributes struct {
+		ID     int64  `json:"id"`
+		Ref    string `json:"ref"`
+		Tag    bool   `json:"tag"`
+		SHA    string `json:"sha"`
+		Status string `json:"status"`
+		// FinishedAt is when the pipeline finished, in gitLabTimeLayout
+		FinishedAt string `json:"finished_at"`
+	} `json:"object_attributes"`
+	// MergeRequest is the merge request of merge request pipelines; nil
+	// for branch pipelines
+	MergeRequest *struct {
+		IID          int    `json:"iid"`
+		SourceBranch string `json:"source_branch"`
+		TargetBranch string `json:"target_branch"`
+	} `json:"merge_request"`
+	Project struct {
+		PathWithNamespace string `json:"path_with_namespace"`
+	} `json:"project"`
+}
+
+// ValidatePipeline validates a GitLab pipeline event: the pipeline must have
+// succeeded for a branch or merge request, the top-level group of its
+// project must be an allowed organization, and the project's full path and
+// the branch (or the merge request's target branch) must match the allowed
+// patterns. Installation repositories and workflows only apply to GitHub
+// and aren't checked.
+func (f Filter) ValidatePipeline(event *GitLabPipelineEvent) error {
+	pipeline := event.ObjectAttributes
+	if pipeline.Status != "success" || pipeline.Tag {
+		return fmt.Errorf("%w: got %q pipeline for %q", ErrNotAnalyzedPipeline, pipeline.Status, pipeline.Ref)
+	}
+	group, _, _ := strings.Cut(event.Project.PathWithNamespace, "/")
+	if !contains(f.AllowedOrgs, group) {
+		return fmt.Errorf("%w: %q", ErrDisallowedOrg, group)
+	}
+	if len(f.AllowedRepos) > 0 && !matchAny(f.AllowedRepos, event.Project.PathWithNamespace) {
+		return fmt.Errorf("%w: %q", ErrDisallowedRepo, event.Project.PathWithNamespace)
+	}
+	if mr := event.MergeRequest; mr != nil {
+		return f.validateBranch(mr.SourceBranch, mr.TargetBranch)
+	}
+	return f.validateBranch(pipeline.Ref)
+}
+
+// ServeGitLab receives GitLab pipeline webhooks. Deliveries with a valid
+// X-Gitlab-Token for successful pipelines of projects in allowed groups are
+// published as queue.EventGitLabPipeline WorkRequests: their org is the
+// project's namespace, their repo its path, their workflow run the
+// pipeline, and their PR its merge request, if it is a merge request
+// pipeline. Responses are those of ServeHTTP; other GitLab events are
+// ignored.
+func (h *Handler) ServeGitLab(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.Start(r.Context(), "webhook.receive", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	payload, ok := h.readPayload(w, r)
+	if !ok {
+		return
+	}
+
+	delivery := r.Header.Get("X-Gitlab-Event-UUID")
+	event := r.Header.Get("X-Gitlab-Event")
+	span.SetAttributes(attribute.String("gitlab.delivery", delivery), attribute.String("gitlab.event", event))
+	if !h.disableHMAC {
+		_, validate := tracing.Start(ctx, "webhook.validate")
+		err := ValidateGitLabToken(r.Header.Get("X-Gitlab-Token"), h.gitLabSecret)
+		tracing.End(validate, err)
+		if err != nil {
+			h.logger.Warn("rejected webhook", "delivery", delivery, "reason", reasonFor(err), "error", err)
+			h.respond(w, http.StatusUnauthorized, Response{Status: StatusRejected, Reason: reasonFor(err), Message: err.Error()})
+			return
+		}
+	}
+
+	if event != gitLabPipelineHook {
+		h.respond(w, http.StatusOK, Response{Status: StatusIgnored, Reason: ReasonUnsupportedEvent, Message: fmt.Sprintf("event %q is not handled", event)})
+		return
+	}
+	req, err := h.gitLabWorkRequest(payload)
+	h.queueRequest(ctx, w, span, queue.EventGitLabPipeline, delivery, req, err)
+}
+
+// gitLabWorkRequest returns the WorkRequest of a GitLab pipeline event, and
+// the filter's verdict on it.
+func (h *Handler) gitLabWorkRequest(payload []byte) (*queue.WorkRequest, error) {
+	var event GitLabPipelineEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("%w: %v", errMalformedPayload, err)
+	}
+	pipeline := event.ObjectAttributes
+	path := event.Project.PathWithNamespace
+	slash := strings.LastIndex(path, "/")
+	if slash < 0 {
+		return nil, fmt.Errorf("%w: invalid project path %q", errMalformedPayload, path)
+	}
+	req := &queue.WorkRequest{
+		Org:           path[:slash],
+		Repo:          path[slash+1:],
+		EventType:     queue.EventGitLabPipeline,
+		WorkflowRunID: pipeline.ID,
+		HeadSHA:       pipeline.SHA,
+		HeadBranch:    pipeline.Ref,
+	}
+	// Pipelines without a parsable finish time are never stale
+	req.RunCompletedAt, _ = time.Parse(gitLabTimeLayout, pipeline.FinishedAt)
+	if mr := event.MergeRequest; mr != nil {
+		req.PullRequest = mr.IID
+		req.HeadBranch = mr.SourceBranch
+		req.BaseBranch = mr.TargetBranch
+	}
+	return req, h.filter.ValidatePipeline(&event)
+}
@@ -0,0 +1,152 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/queue"
+)
+
+const testGitLabSecret = "gitlab-token"
+
+// pipelineEventPayload returns a pipeline event of the acme/tools/widgets
+// project; mergeRequest is the JSON of its merge request, or "null".
+func pipelineEventPayload(status, mergeRequest string) string {
+	return fmt.Sprintf(`{"object_kind":"pipeline","object_attributes":{"id":31,"ref":"main","tag":false,"sha":"bcbb5ec3","status":%q,"finished_at":"2026-01-15 10:30:00 UTC"},"merge_request":%s,"project":{"path_with_namespace":"acme/tools/widgets"}}`,
+		status, mergeRequest)
+}
+
+func TestHandler_GitLab(t *testing.T) {
+	completedAt := time.Date(2026, 1, 15, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		event        string
+		token        string
+		payload      string
+		expectedCode int
+		expected     Response
+		expectedReq  *queue.WorkRequest
+	}{
+		{
+			name:         "branch pipeline",
+			event:        "Pipeline Hook",
+			token:        testGitLabSecret,
+			payload:      pipelineEventPayload("success", "null"),
+			expectedCode: http.StatusAccepted,
+			expected:     Response{Status: StatusQueued},
+			expectedReq: &queue.WorkRequest{Org: "acme/tools", Repo: "widgets", EventType: queue.EventGitLabPipeline, WorkflowRunID: 31,
+				RunCompletedAt: completedAt, HeadSHA: "bcbb5ec3", HeadBranch: "main"},
+		},
+		{
+			name:         "merge request pipeline",
+			event:        "Pipeline Hook",
+			token:        testGitLabSecret,
+			payload:      pipelineEventPayload("success", `{"iid":17,"source_branch":"feature/mul","target_branch":"main"}`),
+			expectedCode: http.StatusAccepted,
+			expected:     Response{Status: StatusQueued},
+			expectedReq: &queue.WorkRequest{Org: "acme/tools", Repo: "widgets", EventType: queue.EventGitLabPipeline, WorkflowRunID: 31,
+				RunCompletedAt: completedAt, PullRequest: 17, HeadSHA: "bcbb5ec3", HeadBranch: "feature/mul", BaseBranch: "main"},
+		},
+		{
+			name:         "failed pipeline",
+			event:        "Pipeline Hook",
+			token:        testGitLabSecret,
+			payload:      pipelineEventPayload("failed", "null"),
+			expectedCode: http.StatusOK,
+			expected:     Response{Status: StatusIgnored, Reason: ReasonInvalidAction, Message: `pipeline must be a successful branch or merge request pipeline: got "failed" pipeline for "main"`},
+		},
+		{
+			name:         "other events",
+			event:        "Push Hook",
+			token:        testGitLabSecret,
+			payload:      `{"object_kind":"push"}`,
+			expectedCode: http.StatusOK,
+			expected:     Response{Status: StatusIgnored, Reason: ReasonUnsupportedEvent, Message: `event "Push Hook" is not handled`},
+		},
+		{
+			name:         "disallowed group",
+			event:        "Pipeline Hook",
+			token:        testGitLabSecret,
+			payload:      strings.Replace(pipelineEventPayload("success", "null"), "acme/tools", "other", 1),
+			expectedCode: http.StatusForbidden,
+			expected:     Response{Status: StatusRejected, Reason: ReasonDisallowedOrg, Message: `organization not allowed: "other"`},
+		},
+		{
+			name:         "missing token",
+			event:        "Pipeline Hook",
+			payload:      pipelineEventPayload("success", "null"),
+			expectedCode: http.StatusUnauthorized,
+			expected:     Response{Status: StatusRejected, Reason: ReasonMissingSignature, Message: "missing X-Gitlab-Token header"},
+		},
+		{
+			name:         "invalid token",
+			event:        "Pipeline Hook",
+			token:        "guess",
+			payload:      pipelineEventPayload("success", "null"),
+			expectedCode: http.StatusUnauthorized,
+			expected:     Response{Status: StatusRejected, Reason: ReasonInvalidSignature, Message: "invalid X-Gitlab-Token header"},
+		},
+		{
+			name:         "malformed payload",
+			event:        "Pipeline Hook",
+			token:        testGitLabSecret,
+			payload:      `{"object_attributes":`,
+			expectedCode: http.StatusBadRequest,
+			expected:     Response{Status: StatusRejected, Reason: ReasonMalformedPayload, Message: "invalid payload: unexpected end of JSON input"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pub := &recordingPublisher{}
+			mux := http.NewServeMux()
+			NewHandler(HandlerConfig{
+				Queue:        pub,
+				Secret:       testSecret,
+				Filter:       Filter{AllowedOrgs: []string{"acme"}, AllowedWorkflows: []string{"ci.yml"}},
+				GitLabSecret: testGitLabSecret,
+			}).Register(mux)
+
+			req := httptest.NewRequest(http.MethodPost, "/gitlab/webhook", strings.NewReader(tt.payload))
+			req.Header.Set("X-Gitlab-Event", tt.event)
+			req.Header.Set("X-Gitlab-Event-UUID", "13792a34-cac6-4fda-95a8-c58e00a3954e")
+			if tt.token != "" {
+				req.Header.Set("X-Gitlab-Token", tt.token)
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedCode, rec.Code)
+			var resp Response
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			assert.Equal(t, tt.expected, resp)
+			if tt.expectedReq == nil {
+				assert.Empty(t, pub.published)
+				return
+			}
+			require.Len(t, pub.published, 1)
+			tt.expectedReq.Version = queue.SchemaVersion
+			tt.expectedReq.CorrelationID = "13792a34-cac6-4fda-95a8-c58e00a3954e"
+			assert.Equal(t, tt.expectedReq, pub.published[0])
+		})
+	}
+}
+
+func TestHandler_GitLabRouteRequiresSecret(t *testing.T) {
+	mux := http.NewServeMux()
+	NewHandler(HandlerConfig{Queue: &recordingPublisher{}, Secret: testSecret}).Register(mux)
+
+	req := httptest.NewRequest(http.MethodPost, "/gitlab/webhook", strings.NewReader(pipelineEventPayload("success", "null")))
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,451 @@
+package webhook
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/logging"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/metrics"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/queue"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/tracing"
+)
+
+// Routes served by Handler.
+const (
+	Route = "POST /webhook"
+	// GitLabRoute receives GitLab pipeline events (see Handler.ServeGitLab)
+	GitLabRoute = "POST /gitlab/webhook"
+)
+
+// maxPayloadSize bounds webhook payloads; GitHub caps them at 25MB.
+// Compressed payloads are bounded after decompression.
+const maxPayloadSize = 25 << 20
+
+// Errors reading a webhook payload.
+var (
+	ErrPayloadTooLarge     = fmt.Errorf("payload exceeds %d bytes", maxPayloadSize)
+	ErrUnsupportedEncoding = errors.New("unsupported Content-Encoding")
+)
+
+// Delivery statuses reported in responses and metrics.
+const (
+	StatusQueued   = "queued"
+	StatusIgnored  = "ignored"
+	StatusRejected = "rejected"
+	StatusFailed   = "failed"
+)
+
+// Reason codes explaining why a delivery was not queued. They are stable,
+// so they can be matched in GitHub's delivery log and alerted on.
+const (
+	ReasonMissingSignature    = "missing_signature"
+	ReasonMalformedSignature  = "malformed_signature"
+	ReasonInvalidSignature    = "invalid_signature"
+	ReasonUnsupportedEvent    = "unsupported_event"
+	ReasonMalformedPayload    = "malformed_payload"
+	ReasonPayloadTooLarge     = "payload_too_large"
+	ReasonUnsupportedEncoding = "unsupported_encoding"
+	ReasonInvalidAction       = "invalid_action"
+	ReasonDisallowedOrg       = "disallowed_org"
+	ReasonDisallowedRepo      = "disallowed_repo"
+	ReasonDisallowedWorkflow  = "disallowed_workflow"
+	ReasonDisallowedBranch    = "disallowed_branch"
+	ReasonUnknownCheckRun     = "unknown_check_run"
+	ReasonPublishFailed       = "publish_failed"
+)
+
+// reasonErrors maps validation errors to their reason codes.
+var reasonErrors = []struct {
+	err    error
+	reason string
+}{
+	{ErrMissingSignature, ReasonMissingSignature},
+	{ErrMalformedSignature, ReasonMalformedSignature},
+	{ErrInvalidSignature, ReasonInvalidSignature},
+	{ErrMissingGitLabToken, ReasonMissingSignature},
+	{ErrInvalidGitLabToken, ReasonInvalidSignature},
+	{ErrInvalidAction, ReasonInvalidAction},
+	{ErrNotRerequested, ReasonInvalidAction},
+	{ErrNotPullRequestPush, ReasonInvalidAction},
+	{ErrNotAnalyzedPipeline, ReasonInvalidAction},
+	{ErrUnknownCheckRun, ReasonUnknownCheckRun},
+	{ErrDisallowedOrg, ReasonDisallowedOrg},
+	{ErrDisallowedRepo, ReasonDisallowedRepo},
+	{ErrDisallowedWorkflow, ReasonDisallowedWorkflow},
+	{ErrDisallowedBranch, ReasonDisallowedBranch},
+}
+
+// reasonFor returns the reason code of a validation error.
+func reasonFor(err error) string {
+	for _, r := range reasonErrors {
+		if errors.Is(err, r.err) {
+			return r.reason
+		}
+	}
+	return ""
+}
+
+// Response is the JSON body of every webhook response, e.g.
+//
+//	{"status":"rejected","reason":"disallowed_org","message":"organization not allowed: \"acme\""}
+type Response struct {
+	Status string `json:"status"`
+	// Reason is one of the Reason* codes; empty for queued deliveries
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// Publisher publishes work requests for workers; every queue.MessageQueue
+// implements it.
+type Publisher interface {
+	Publish(ctx context.Context, req *queue.WorkRequest) error
+}
+
+// HandlerConfig holds configuration for creating a Handler.
+type HandlerConfig struct {
+	Queue Publisher
+	// Secret is the webhook secret the payload signature is checked
+	// against; while rotating it, several comma-separated secrets are all
+	// accepted (see ValidateHMAC)
+	Secret string
+	// DisableHMAC skips signature validation (local development only)
+	DisableHMAC bool
+	Filter      Filter
+	// PullRequestEvents accepts pull_request events of repositories that
+	// upload coverage to storage rather than as workflow artifacts
+	PullRequestEvents bool
+	// GitLabSecret is the secret token GitLab sends with pipeline events;
+	// empty doesn't serve GitLabRoute
+	GitLabSecret string
+	Logger       *slog.Logger
+}
+
+// Handler receives GitHub workflow_run webhooks. Deliveries with a valid
+// signature for completed runs of allowed orgs, repositories, and workflows
+// are published as WorkRequests; the handler itself has no GitHub
+// credentials. Re-runs of Canopy's check run or check suite (check_run and
+// check_suite events with the "rerequested" action) are published as
+// WorkRequests re-analyzing the workflow run the check run reported on.
+// With HandlerConfig.PullRequestEvents, opened and pushed to PRs
+// (pull_request events with the "opened" or "synchronize" action) are
+// published as WorkRequests analyzing the coverage uploaded for their head
+// commit.
+//
+// Every response has a JSON Response body, which GitHub shows in the
+// delivery log:
+//   - 202 queued when a WorkRequest was published
+//   - 200 ignored for other events and actions, incomplete runs, and check
+//     runs that don't name a workflow run
+//   - 400 rejected for malformed payloads, 401 for bad signatures, 403 for
+//     disallowed orgs, repositories, workflows, or branches, 413 for payloads over
+//     25MB, and 415 for Content-Encodings other than gzip
+//   - 500 failed if publishing fails
+//
+// The handler counts deliveries by status and reason (see WriteMetrics).
+// With HandlerConfig.GitLabSecret, GitLab pipeline
+// events are received on POST /gitlab/webhook (see ServeGitLab) and
+// counted with them.
+type Handler struct {
+	queue             Publisher
+	secrets           []string
+	disableHMAC       bool
+	filter            Filter
+	pullRequestEvents bool
+	gitLabSecret      string
+	logger            *slog.Logger
+
+	mu     sync.Mutex
+	counts map[Response]int64
+}
+
+// NewHandler creates a webhook Handler.
+func NewHandler(cfg HandlerConfig) *Handler {
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+	return &Handler{
+		queue:             cfg.Queue,
+		secrets:           SplitSecrets(cfg.Secret),
+		disableHMAC:       cfg.DisableHMAC,
+		filter:            cfg.Filter,
+		pullRequestEvents: cfg.PullRequestEvents,
+		gitLabSecret:      cfg.GitLabSecret,
+		logger:            cfg.Logger,
+		counts:            make(map[Response]int64),
+	}
+}
+
+// Register adds the webhook route to mux, and GitLabRoute if a GitLab
+// secret is configured.
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.Handle(Route, h)
+	if h.gitLabSecret != "" {
+		mux.HandleFunc(GitLabRoute, h.ServeGitLab)
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.Start(r.Context(), "webhook.receive", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	payload, ok := h.readPayload(w, r)
+	if !ok {
+		return
+	}
+
+	delivery := r.Header.Get("X-GitHub-Delivery")
+	span.SetAttributes(attribute.String("github.delivery", delivery), attribute.String("github.event", r.Header.Get("X-GitHub-Event")))
+	if !h.disableHMAC {
+		_, validate := tracing.Start(ctx, "webhook.validate")
+		err := ValidateHMAC(payload, r.Header.Get("X-Hub-Signature-256"), h.secrets...)
+		tracing.End(validate, err)
+		if err != nil {
+			h.logger.Warn("rejected webhook", "delivery", delivery, "reason", reasonFor(err), "error", err)
+			h.respond(w, http.StatusUnauthorized, Response{Status: StatusRejected, Reason: reasonFor(err), Message: err.Error()})
+			return
+		}
+	}
+
+	event := r.Header.Get("X-GitHub-Event")
+	switch {
+	case event == queue.EventWorkflowRun, event == queue.EventCheckRun, event == queue.EventCheckSuite:
+	case event == queue.EventPullRequest && h.pullRequestEvents:
+	default:
+		h.respond(w, http.StatusOK, Response{Status: StatusIgnored, Reason: ReasonUnsupportedEvent, Message: fmt.Sprintf("event %q is not handled", event)})
+		return
+	}
+
+	req, err := h.workRequest(event, payload)
+	h.queueRequest(ctx, w, span, event, delivery, req, err)
+}
+
+// queueRequest publishes the WorkRequest of a delivery, or responds with
+// why it isn't published: err is the validation error of the request, if
+// any.
+func (h *Handler) queueRequest(ctx context.Context, w http.ResponseWriter, span trace.Span, event, delivery string, req *queue.WorkRequest, err error) {
+	if errors.Is(err, errMalformedPayload) {
+		h.respond(w, http.StatusBadRequest, Response{Status: StatusRejected, Reason: ReasonMalformedPayload, Message: err.Error()})
+		return
+	}
+
+	// Deliveries without an ID, e.g. replayed by hand, get one so their
+	// processing can still be traced
+	req.CorrelationID = delivery
+	if req.CorrelationID == "" {
+		req.CorrelationID = uuid.NewString()
+	}
+	req.Version = queue.SchemaVersion
+	logger := h.logger.With(logging.CorrelationIDKey, req.CorrelationID, "org", req.Org, "repo", req.Repo)
+	span.SetAttributes(attribute.String("canopy.org", req.Org), attribute.String("canopy.repo", req.Repo))
+	if req.WorkflowRunID != 0 {
+		logger = logger.With("workflow_run_id", req.WorkflowRunID)
+		span.SetAttributes(attribute.Int64("canopy.workflow_run_id", req.WorkflowRunID))
+	}
+	if req.CheckSuiteID != 0 {
+		logger = logger.With("check_suite_id", req.CheckSuiteID)
+		span.SetAttributes(attribute.Int64("canopy.check_suite_id", req.CheckSuiteID))
+	}
+	if req.PullRequest != 0 {
+		logger = logger.With("pull_request", req.PullRequest)
+		span.SetAttributes(attribute.Int("canopy.pull_request", req.PullRequest))
+	}
+	if err != nil {
+		if reason := reasonFor(err); reason == ReasonInvalidAction || reason == ReasonUnknownCheckRun {
+			h.respond(w, http.StatusOK, Response{Status: StatusIgnored, Reason: reason, Message: err.Error()})
+			return
+		}
+		logger.Info("rejected "+strings.ReplaceAll(event, "_", " "), "reason", reasonFor(err), "error", err)
+		h.respond(w, http.StatusForbidden, Response{Status: StatusRejected, Reason: reasonFor(err), Message: err.Error()})
+		return
+	}
+
+	publishCtx, publish := tracing.Start(ctx, "queue.publish", trace.WithSpanKind(trace.SpanKindProducer))
+	req.TraceContext = tracing.Inject(publishCtx)
+	start := time.Now()
+	err = h.queue.Publish(publishCtx, req)
+	queue.ObservePublish(start, err)
+	tracing.End(publish, err)
+	if err != nil {
+		logger.Error("failed to publish work request", "error", err)
+		h.respond(w, http.StatusInternalServerError, Response{Status: StatusFailed, Reason: ReasonPublishFailed, Message: "failed to publish work request"})
+		return
+	}
+	logger.Info("queued work request", "event", event)
+	h.respond(w, http.StatusAccepted, Response{Status: StatusQueued})
+}
+
+// errMalformedPayload is returned (wrapped) by workRequest for payloads
+// that aren't valid JSON.
+var errMalformedPayload = errors.New("invalid payload")
+
+// workRequest returns the WorkRequest of a workflow_run, check_run,
+// check_suite, or pull_request event, and the filter's verdict on it. The
+// request names the event's org and repository even if it is rejected.
+func (h *Handler) workRequest(event string, payload []byte) (*queue.WorkRequest, error) {
+	switch event {
+	case queue.EventPullRequest:
+		var pr PullRequestEvent
+		if err := json.Unmarshal(payload, &pr); err != nil {
+			return nil, fmt.Errorf("%w: %v", errMalformedPayload, err)
+		}
+		return &queue.WorkRequest{
+			Org:            pr.Organization.Login,
+			Repo:           pr.Repository.Name,
+			InstallationID: pr.Installation.ID,
+			EventType:      event,
+			PullRequest:    pr.Number,
+			HeadSHA:        pr.PullRequest.Head.SHA,
+			HeadBranch:     pr.PullRequest.Head.Ref,
+			BaseSHA:        pr.PullRequest.Base.SHA,
+			BaseBranch:     pr.PullRequest.Base.Ref,
+		}, h.filter.ValidatePullRequest(&pr)
+	case queue.EventWorkflowRun:
+		var run WorkflowRunEvent
+		if err := json.Unmarshal(payload, &run); err != nil {
+			return nil, fmt.Errorf("%w: %v", errMalformedPayload, err)
+		}
+		req := &queue.WorkRequest{
+			Org:            run.Organization.Login,
+			Repo:           run.Repository.Name,
+			WorkflowRunID:  run.WorkflowRun.ID,
+			RunCompletedAt: run.WorkflowRun.UpdatedAt,
+			InstallationID: run.Installation.ID,
+			HeadSHA:        run.WorkflowRun.HeadSHA,
+			HeadBranch:     run.WorkflowRun.HeadBranch,
+		}
+		// Runs of a head shared by several PRs name the first
+		if prs := run.WorkflowRun.PullRequests; len(prs) > 0 {
+			req.PullRequest = prs[0].Number
+			req.BaseSHA = prs[0].Base.SHA
+			req.BaseBranch = prs[0].Base.Ref
+		}
+		return req, h.filter.Validate(&run)
+	}
+
+	var rerun RerequestEvent
+	if err := json.Unmarshal(payload, &rerun); err != nil {
+		return nil, fmt.Errorf("%w: %v", errMalformedPayload, err)
+	}
+	// Re-runs are never stale, so no completion time is set
+	req := &queue.WorkRequest{
+		Org:            rerun.Organization.Login,
+		Repo:           rerun.Repository.Name,
+		InstallationID: rerun.Installation.ID,
+		EventType:      event,
+	}
+	if err := h.filter.ValidateRerequest(&rerun); err != nil {
+		return req, err
+	}
+	if event == queue.EventCheckSuite {
+		// The worker finds the run from the suite's Canopy check run
+		req.CheckSuiteID = rerun.CheckSuite.ID
+		return req, nil
+	}
+	runID, _, err := queue.ParseCheckRunExternalID(rerun.CheckRun.ExternalID)
+	if err != nil {
+		return req, fmt.Errorf("%w: check run %d: %v", ErrUnknownCheckRun, rerun.CheckRun.ID, err)
+	}
+	req.WorkflowRunID = runID
+	return req, nil
+}
+
+// readPayload reads the payload of a delivery (see readPayload), or
+// responds with why it can't be read.
+func (h *Handler) readPayload(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	payload, err := readPayload(w, r)
+	switch {
+	case errors.Is(err, ErrPayloadTooLarge):
+		h.respond(w, http.StatusRequestEntityTooLarge, Response{Status: StatusRejected, Reason: ReasonPayloadTooLarge, Message: err.Error()})
+		return nil, false
+	case errors.Is(err, ErrUnsupportedEncoding):
+		h.respond(w, http.StatusUnsupportedMediaType, Response{Status: StatusRejected, Reason: ReasonUnsupportedEncoding, Message: err.Error()})
+		return nil, false
+	case err != nil:
+		h.respond(w, http.StatusBadRequest, Response{Status: StatusRejected, Reason: ReasonMalformedPayload, Message: "failed to read payload: " + err.Error()})
+		return nil, false
+	}
+	return payload, true
+}
+
+// readPayload reads the request body, decompressing it if its
+// Content-Encoding is gzip. The signature is computed over the decompressed
+// payload, and maxPayloadSize bounds it, so a compressed delivery can't
+// expand without limit.
+func readPayload(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	body := io.Reader(http.MaxBytesReader(w, r.Body, maxPayloadSize))
+	switch encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))); encoding {
+	case "", "identity":
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress payload: %w", err)
+		}
+		defer zr.Close()
+		body = zr
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedEncoding, encoding)
+	}
+
+	payload, err := io.ReadAll(io.LimitReader(body, maxPayloadSize+1))
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) || len(payload) > maxPayloadSize {
+		return nil, ErrPayloadTooLarge
+	}
+	if err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// respond counts the delivery outcome and writes it as the JSON body.
+func (h *Handler) respond(w http.ResponseWriter, code int, resp Response) {
+	h.mu.Lock()
+	h.counts[Response{Status: resp.Status, Reason: resp.Reason}]++
+	h.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// WriteMetrics writes the delivery counts in the Prometheus text format, so
+// the handler can be added to a metrics.Registry and served on
+// metrics.Route with the services' other metrics.
+func (h *Handler) WriteMetrics(w io.Writer) {
+	h.mu.Lock()
+	outcomes := make([]Response, 0, len(h.counts))
+	for outcome := range h.counts {
+		outcomes = append(outcomes, outcome)
+	}
+	counts := maps.Clone(h.counts)
+	h.mu.Unlock()
+	sort.Slice(outcomes, func(i, j int) bool {
+		if outcomes[i].Status != outcomes[j].Status {
+			return outcomes[i].Status < outcomes[j].Status
+		}
+		return outcomes[i].Reason < outcomes[j].Reason
+	})
+
+	fmt.Fprintln(w, "# HELP canopy_webhook_deliveries_total Webhook deliveries by outcome.")
+	fmt.Fprintln(w, "# TYPE canopy_webhook_deliveries_total counter")
+	for _, o := range outcomes {
+		fmt.Fprintf(w, "canopy_webhook_deliveries_total{status=\"%s\",reason=\"%s\"} %d\n",
+			metrics.EscapeLabelValue(o.Status), metrics.EscapeLabelValue(o.Reason), counts[o])
+	}
+}
@@ -0,0 +1,673 @@
+package webhook
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/queue"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// recordingPublisher records published work requests.
+type recordingPublisher struct {
+	published []*queue.WorkRequest
+	err       error
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, req *queue.WorkRequest) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.published = append(p.published, req)
+	return nil
+}
+
+const testSecret = "s3cret"
+
+func sign(payload string) string {
+	mac := hmac.New(sha256.New, []byte(testSecret))
+	mac.Write([]byte(payload))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func workflowRunPayload(action, org, workflow string) string {
+	return `{"action":"` + action + `","workflow_run":{"id":42,"name":"` + workflow + `","updated_at":"2026-01-02T03:04:05Z"},` +
+		`"repository":{"name":"widgets","full_name":"` + org + `/widgets"},"organization":{"login":"` + org + `"},"installation":{"id":314}}`
+}
+
+// gzipped compresses payload with gzip.
+func gzipped(t *testing.T, payload string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write([]byte(payload))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func TestHandler(t *testing.T) {
+	valid := workflowRunPayload("completed", "acme", "ci.yml")
+
+	tests := []struct {
+		name         string
+		event        string
+		payload      string
+		signature    string
+		encoding     string // sent as Content-Encoding; "gzip" compresses the payload
+		disableHMAC  bool
+		publishErr   error
+		expectedCode int
+		expected     Response
+		expectQueued bool
+	}{
+		{
+			name:         "valid delivery is queued",
+			event:        "workflow_run",
+			payload:      valid,
+			signature:    sign(valid),
+			expectedCode: http.StatusAccepted,
+			expected:     Response{Status: StatusQueued},
+			expectQueued: true,
+		},
+		{
+			name:         "missing signature",
+			event:        "workflow_run",
+			payload:      valid,
+			expectedCode: http.StatusUnauthorized,
+			expected:     Response{Status: StatusRejected, Reason: ReasonMissingSignature, Message: ErrMissingSignature.Error()},
+		},
+		{
+			name:         "invalid signature",
+			event:        "workflow_run",
+			payload:      valid,
+			signature:    sign(valid + " "),
+			expectedCode: http.StatusUnauthorized,
+			expected:     Response{Status: StatusRejected, Reason: ReasonInvalidSignature, Message: ErrInvalidSignature.Error()},
+		},
+		{
+			name:         "malformed signature",
+			event:        "workflow_run",
+			payload:      valid,
+			signature:    "sha1=abc",
+			expectedCode: http.StatusUnauthorized,
+			expected:     Response{Status: StatusRejected, Reason: ReasonMalformedSignature, Message: ErrMalformedSignature.Error()},
+		},
+		{
+			name:         "disabled HMAC accepts unsigned deliveries",
+			event:        "workflow_run",
+			payload:      valid,
+			disableHMAC:  true,
+			expectedCode: http.StatusAccepted,
+			expected:     Response{Status: StatusQueued},
+			expectQueued: true,
+		},
+		{
+			name:         "gzipped delivery is signed over the decompressed payload",
+			event:        "workflow_run",
+			payload:      valid,
+			signature:    sign(valid),
+			encoding:     "gzip",
+			expectedCode: http.StatusAccepted,
+			expected:     Response{Status: StatusQueued},
+			expectQueued: true,
+		},
+		{
+			name:         "corrupt gzip payload",
+			event:        "workflow_run",
+			payload:      valid,
+			signature:    sign(valid),
+			encoding:     "x-gzip",
+			expectedCode: http.StatusBadRequest,
+			expected:     Response{Status: StatusRejected, Reason: ReasonMalformedPayload, Message: "failed to read payload: failed to decompress payload: gzip: invalid header"},
+		},
+		{
+			name:         "unsupported encoding",
+			event:        "workflow_run",
+			payload:      valid,
+			signature:    sign(valid),
+			encoding:     "br",
+			expectedCode: http.StatusUnsupportedMediaType,
+			expected:     Response{Status: StatusRejected, Reason: ReasonUnsupportedEncoding, Message: `unsupported Content-Encoding: "br"`},
+		},
+		{
+			name:         "other events are ignored",
+			event:        "ping",
+			payload:      `{"zen":"hi"}`,
+			signature:    sign(`{"zen":"hi"}`),
+			expectedCode: http.StatusOK,
+			expected:     Response{Status: StatusIgnored, Reason: ReasonUnsupportedEvent, Message: `event "ping" is not handled`},
+		},
+		{
+			name:         "malformed payload",
+			event:        "workflow_run",
+			payload:      `{`,
+			signature:    sign(`{`),
+			expectedCode: http.StatusBadRequest,
+			expected:     Response{Status: StatusRejected, Reason: ReasonMalformedPayload, Message: "invalid payload: unexpected end of JSON input"},
+		},
+		{
+			name:         "incomplete run is ignored",
+			event:        "workflow_run",
+			payload:      workflowRunPayload("requested", "acme", "ci.yml"),
+			signature:    sign(workflowRunPayload("requested", "acme", "ci.yml")),
+			expectedCode: http.StatusOK,
+			expected:     Response{Status: StatusIgnored, Reason: ReasonInvalidAction, Message: `workflow run action must be 'completed': got "requested"`},
+		},
+		{
+			name:         "disallowed org",
+			event:        "workflow_run",
+			payload:      workflowRunPayload("completed", "evil", "ci.yml"),
+			signature:    sign(workflowRunPayload("completed", "evil", "ci.yml")),
+			expectedCode: http.StatusForbidden,
+			expected:     Response{Status: StatusRejected, Reason: ReasonDisallowedOrg, Message: `organization not allowed: "evil"`},
+		},
+		{
+			name:         "disallowed workflow",
+			event:        "workflow_run",
+			payload:      workflowRunPayload("completed", "acme", "release.yml"),
+			signature:    sign(workflowRunPayload("completed", "acme", "release.yml")),
+			expectedCode: http.StatusForbidden,
+			expected:     Response{Status: StatusRejected, Reason: ReasonDisallowedWorkflow, Message: `workflow not allowed: "release.yml"`},
+		},
+		{
+			name:         "publish failure",
+			event:        "workflow_run",
+			payload:      valid,
+			signature:    sign(valid),
+			publishErr:   errors.New("queue is closed"),
+			expectedCode: http.StatusInternalServerError,
+			expected:     Response{Status: StatusFailed, Reason: ReasonPublishFailed, Message: "failed to publish work request"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pub := &recordingPublisher{err: tt.publishErr}
+			h := NewHandler(HandlerConfig{
+				Queue:       pub,
+				Secret:      testSecret,
+				DisableHMAC: tt.disableHMAC,
+				Filter:      Filter{AllowedOrgs: []string{"acme"}, AllowedWorkflows: []string{"ci.yml"}},
+			})
+			mux := http.NewServeMux()
+			h.Register(mux)
+
+			body := []byte(tt.payload)
+			if tt.encoding == "gzip" {
+				body = gzipped(t, tt.payload)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(body))
+			req.Header.Set("X-GitHub-Event", tt.event)
+			req.Header.Set("X-GitHub-Delivery", "72d3162e-cc78-11e3-81ab-4c9367dc0958")
+			if tt.encoding != "" {
+				req.Header.Set("Content-Encoding", tt.encoding)
+			}
+			if tt.signature != "" {
+				req.Header.Set("X-Hub-Signature-256", tt.signature)
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedCode, rec.Code)
+			assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+			var resp Response
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			assert.Equal(t, tt.expected, resp)
+			if !tt.expectQueued {
+				assert.Empty(t, pub.published)
+				return
+			}
+			require.Len(t, pub.published, 1)
+			assert.Equal(t, &queue.WorkRequest{
+				Version:        queue.SchemaVersion,
+				Org:            "acme",
+				Repo:           "widgets",
+				WorkflowRunID:  42,
+				RunCompletedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+				InstallationID: 314,
+				CorrelationID:  "72d3162e-cc78-11e3-81ab-4c9367dc0958",
+			}, pub.published[0])
+		})
+	}
+}
+
+func rerequestPayload(action, org, checkRun string) string {
+	return `{"action":"` + action + `",` + checkRun + `"check_suite":{"id":77,"head_sha":"abc"},` +
+		`"repository":{"name":"widgets","full_name":"` + org + `/widgets"},"organization":{"login":"` + org + `"},"installation":{"id":314}}`
+}
+
+func TestHandler_Rerequested(t *testing.T) {
+	canopyCheckRun := `"check_run":{"id":55,"external_id":"42/0b4ad2c8-cc79-11e3-8f2e-4c9367dc0958"},`
+
+	tests := []struct {
+		name         string
+		event        string
+		payload      string
+		expectedCode int
+		expected     Response
+		expectedReq  *queue.WorkRequest
+	}{
+		{
+			name:         "check run re-analyzes its workflow run",
+			event:        "check_run",
+			payload:      rerequestPayload("rerequested", "acme", canopyCheckRun),
+			expectedCode: http.StatusAccepted,
+			expected:     Response{Status: StatusQueued},
+			expectedReq:  &queue.WorkRequest{Org: "acme", Repo: "widgets", WorkflowRunID: 42, EventType: queue.EventCheckRun},
+		},
+		{
+			name:         "check suite is resolved by the worker",
+			event:        "check_suite",
+			payload:      rerequestPayload("rerequested", "acme", ""),
+			expectedCode: http.StatusAccepted,
+			expected:     Response{Status: StatusQueued},
+			expectedReq:  &queue.WorkRequest{Org: "acme", Repo: "widgets", CheckSuiteID: 77, EventType: queue.EventCheckSuite},
+		},
+		{
+			name:         "other actions are ignored",
+			event:        "check_suite",
+			payload:      rerequestPayload("completed", "acme", ""),
+			expectedCode: http.StatusOK,
+			expected:     Response{Status: StatusIgnored, Reason: ReasonInvalidAction, Message: `check action must be 'rerequested': got "completed"`},
+		},
+		{
+			name:         "check run without a workflow run is ignored",
+			event:        "check_run",
+			payload:      rerequestPayload("rerequested", "acme", `"check_run":{"id":55,"external_id":"0b4ad2c8-cc79-11e3-8f2e-4c9367dc0958"},`),
+			expectedCode: http.StatusOK,
+			expected: Response{Status: StatusIgnored, Reason: ReasonUnknownCheckRun,
+				Message: `check run does not name a workflow run: check run 55: invalid check run external ID "0b4ad2c8-cc79-11e3-8f2e-4c9367dc0958": want <workflow run ID>/<correlation ID>`},
+		},
+		{
+			name:         "disallowed org",
+			event:        "check_run",
+			payload:      rerequestPayload("rerequested", "evil", canopyCheckRun),
+			expectedCode: http.StatusForbidden,
+			expected:     Response{Status: StatusRejected, Reason: ReasonDisallowedOrg, Message: `organization not allowed: "evil"`},
+		},
+		{
+			name:         "malformed payload",
+			event:        "check_suite",
+			payload:      `{`,
+			expectedCode: http.StatusBadRequest,
+			expected:     Response{Status: StatusRejected, Reason: ReasonMalformedPayload, Message: "invalid payload: unexpected end of JSON input"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pub := &recordingPublisher{}
+			h := NewHandler(HandlerConfig{
+				Queue:  pub,
+				Secret: testSecret,
+				Filter: Filter{AllowedOrgs: []string{"acme"}, AllowedWorkflows: []string{"ci.yml"}},
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(tt.payload))
+			req.Header.Set("X-GitHub-Event", tt.event)
+			req.Header.Set("X-GitHub-Delivery", "72d3162e-cc78-11e3-81ab-4c9367dc0958")
+			req.Header.Set("X-Hub-Signature-256", sign(tt.payload))
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedCode, rec.Code)
+			var resp Response
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			assert.Equal(t, tt.expected, resp)
+			if tt.expectedReq == nil {
+				assert.Empty(t, pub.published)
+				return
+			}
+			require.Len(t, pub.published, 1)
+			tt.expectedReq.Version = queue.SchemaVersion
+			tt.expectedReq.InstallationID = 314
+			tt.expectedReq.CorrelationID = "72d3162e-cc78-11e3-81ab-4c9367dc0958"
+			assert.Equal(t, tt.expectedReq, pub.published[0])
+		})
+	}
+}
+
+func pullRequestPayload(action string) string {
+	return `{"action":"` + action + `","number":7,"pull_request":{"head":{"sha":"abc","ref":"feature"},"base":{"sha":"def","ref":"main"}},` +
+		`"repository":{"name":"widgets","full_name":"acme/widgets"},"organization":{"login":"acme"},"installation":{"id":314}}`
+}
+
+func TestHandler_PullRequestEvents(t *testing.T) {
+	tests := []struct {
+		name              string
+		pullRequestEvents bool
+		action            string
+		expectedCode      int
+		expected          Response
+	}{
+		{
+			name:         "ignored unless enabled",
+			action:       "opened",
+			expectedCode: http.StatusOK,
+			expected:     Response{Status: StatusIgnored, Reason: ReasonUnsupportedEvent, Message: `event "pull_request" is not handled`},
+		},
+		{name: "opened", pullRequestEvents: true, action: "opened", expectedCode: http.StatusAccepted, expected: Response{Status: StatusQueued}},
+		{name: "pushed to", pullRequestEvents: true, action: "synchronize", expectedCode: http.StatusAccepted, expected: Response{Status: StatusQueued}},
+		{
+			name:              "other actions are ignored",
+			pullRequestEvents: true,
+			action:            "closed",
+			expectedCode:      http.StatusOK,
+			expected:          Response{Status: StatusIgnored, Reason: ReasonInvalidAction, Message: `pull request action must be 'opened' or 'synchronize': got "closed"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pub := &recordingPublisher{}
+			h := NewHandler(HandlerConfig{
+				Queue:             pub,
+				Secret:            testSecret,
+				Filter:            Filter{AllowedOrgs: []string{"acme"}, AllowedWorkflows: []string{"ci.yml"}},
+				PullRequestEvents: tt.pullRequestEvents,
+			})
+
+			payload := pullRequestPayload(tt.action)
+			req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(payload))
+			req.Header.Set("X-GitHub-Event", "pull_request")
+			req.Header.Set("X-GitHub-Delivery", "72d3162e-cc78-11e3-81ab-4c9367dc0958")
+			req.Header.Set("X-Hub-Signature-256", sign(payload))
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedCode, rec.Code)
+			var resp Response
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			assert.Equal(t, tt.expected, resp)
+			if tt.expectedCode != http.StatusAccepted {
+				assert.Empty(t, pub.published)
+				return
+			}
+			require.Len(t, pub.published, 1)
+			assert.Equal(t, &queue.WorkRequest{
+				Version:        queue.SchemaVersion,
+				Org:            "acme",
+				Repo:           "widgets",
+				InstallationID: 314,
+				CorrelationID:  "72d3162e-cc78-11e3-81ab-4c9367dc0958",
+				EventType:      queue.EventPullRequest,
+				PullRequest:    7,
+				HeadSHA:        "abc",
+				HeadBranch:     "feature",
+				BaseSHA:        "def",
+				BaseBranch:     "main",
+			}, pub.published[0])
+		})
+	}
+}
+
+func TestHandler_WorkflowRunOfPullRequest(t *testing.T) {
+	pub := &recordingPublisher{}
+	h := NewHandler(HandlerConfig{
+		Queue:  pub,
+		Secret: testSecret,
+		Filter: Filter{AllowedOrgs: []string{"acme"}, AllowedWorkflows: []string{"ci.yml"}},
+	})
+
+	payload := `{"action":"completed","workflow_run":{"id":42,"name":"ci.yml","head_sha":"abc","head_branch":"feature",` +
+		`"pull_requests":[{"number":7,"base":{"sha":"def","ref":"main"}},{"number":8,"base":{"sha":"123","ref":"release"}}],` +
+		`"updated_at":"2026-01-02T03:04:05Z"},` +
+		`"repository":{"name":"widgets","full_name":"acme/widgets"},"organization":{"login":"acme"},"installation":{"id":314}}`
+	req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(payload))
+	req.Header.Set("X-GitHub-Event", "workflow_run")
+	req.Header.Set("X-GitHub-Delivery", "72d3162e-cc78-11e3-81ab-4c9367dc0958")
+	req.Header.Set("X-Hub-Signature-256", sign(payload))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	require.Len(t, pub.published, 1)
+	assert.Equal(t, &queue.WorkRequest{
+		Version:        queue.SchemaVersion,
+		Org:            "acme",
+		Repo:           "widgets",
+		WorkflowRunID:  42,
+		RunCompletedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		InstallationID: 314,
+		CorrelationID:  "72d3162e-cc78-11e3-81ab-4c9367dc0958",
+		PullRequest:    7,
+		HeadSHA:        "abc",
+		HeadBranch:     "feature",
+		BaseSHA:        "def",
+		BaseBranch:     "main",
+	}, pub.published[0])
+}
+
+func TestHandler_PayloadSizeLimit(t *testing.T) {
+	// The limit applies to the decompressed payload: padding compresses far
+	// below it, but expands past it
+	large := workflowRunPayload("completed", "acme", "ci.yml") + strings.Repeat(" ", maxPayloadSize)
+
+	tests := []struct {
+		name     string
+		body     []byte
+		encoding string
+	}{
+		{name: "uncompressed", body: []byte(large)},
+		{name: "gzip", body: gzipped(t, large), encoding: "gzip"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(HandlerConfig{Queue: &recordingPublisher{}, DisableHMAC: true})
+			req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(tt.body))
+			req.Header.Set("X-GitHub-Event", "workflow_run")
+			req.Header.Set("Content-Encoding", tt.encoding)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+			var resp Response
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			assert.Equal(t, Response{Status: StatusRejected, Reason: ReasonPayloadTooLarge, Message: ErrPayloadTooLarge.Error()}, resp)
+		})
+	}
+}
+
+func TestFilter_AllowsAnyWorkflowWhenEmpty(t *testing.T) {
+	event := &WorkflowRunEvent{
+		Action:       "completed",
+		WorkflowRun:  WorkflowRun{ID: 1, Name: "anything"},
+		Organization: Organization{Login: "acme"},
+	}
+	assert.NoError(t, Filter{AllowedOrgs: []string{"acme"}}.Validate(event))
+	assert.ErrorIs(t, Filter{AllowedOrgs: []string{"other"}}.Validate(event), ErrDisallowedOrg)
+}
+
+func TestHandler_AllowedPatterns(t *testing.T) {
+	tests := []struct {
+		name         string
+		repo         string
+		branch       string
+		expectedCode int
+		expected     Response
+	}{
+		{
+			name:         "allowed",
+			repo:         "widgets",
+			branch:       "main",
+			expectedCode: http.StatusAccepted,
+			expected:     Response{Status: StatusQueued},
+		},
+		{
+			name:         "disallowed repo",
+			repo:         "gadgets",
+			branch:       "main",
+			expectedCode: http.StatusForbidden,
+			expected:     Response{Status: StatusRejected, Reason: ReasonDisallowedRepo, Message: `repository not allowed: "acme/gadgets"`},
+		},
+		{
+			name:         "disallowed branch",
+			repo:         "widgets",
+			branch:       "feature/mul",
+			expectedCode: http.StatusForbidden,
+			expected:     Response{Status: StatusRejected, Reason: ReasonDisallowedBranch, Message: `branch not allowed: "feature/mul"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pub := &recordingPublisher{}
+			mux := http.NewServeMux()
+			NewHandler(HandlerConfig{Queue: pub, Secret: testSecret, Filter: Filter{
+				AllowedOrgs:     []string{"acme"},
+				AllowedRepos:    []string{"acme/widget*"},
+				AllowedBranches: []string{"main"},
+			}}).Register(mux)
+
+			payload := `{"action":"completed","workflow_run":{"id":42,"name":"ci.yml","head_branch":"` + tt.branch + `"},` +
+				`"repository":{"name":"` + tt.repo + `","full_name":"acme/` + tt.repo + `"},"organization":{"login":"acme"}}`
+			req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(payload))
+			req.Header.Set("X-GitHub-Event", "workflow_run")
+			req.Header.Set("X-Hub-Signature-256", sign(payload))
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedCode, rec.Code)
+			var resp Response
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			assert.Equal(t, tt.expected, resp)
+			if tt.expectedCode == http.StatusAccepted {
+				assert.Len(t, pub.published, 1)
+			} else {
+				assert.Empty(t, pub.published)
+			}
+		})
+	}
+}
+
+func TestHandler_CorrelationIDWithoutDelivery(t *testing.T) {
+	pub := &recordingPublisher{}
+	mux := http.NewServeMux()
+	NewHandler(HandlerConfig{Queue: pub, Secret: testSecret, Filter: Filter{AllowedOrgs: []string{"acme"}}}).Register(mux)
+
+	payload := workflowRunPayload("completed", "acme", "ci.yml")
+	for range 2 {
+		req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(payload))
+		req.Header.Set("X-GitHub-Event", "workflow_run")
+		req.Header.Set("X-Hub-Signature-256", sign(payload))
+		mux.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// Each delivery gets its own ID
+	require.Len(t, pub.published, 2)
+	assert.NotEmpty(t, pub.published[0].CorrelationID)
+	assert.NotEqual(t, pub.published[0].CorrelationID, pub.published[1].CorrelationID)
+}
+
+func TestHandler_SecretRotation(t *testing.T) {
+	pub := &recordingPublisher{}
+	mux := http.NewServeMux()
+	NewHandler(HandlerConfig{Queue: pub, Secret: "n3w-secret, " + testSecret, Filter: Filter{AllowedOrgs: []string{"acme"}}}).Register(mux)
+
+	payload := workflowRunPayload("completed", "acme", "ci.yml")
+	for _, tt := range []struct {
+		signature    string
+		expectedCode int
+	}{
+		{signature: sign(payload), expectedCode: http.StatusAccepted},
+		{signature: "sha256=" + hex.EncodeToString(hmac.New(sha256.New, []byte("n3w-secret")).Sum(nil)), expectedCode: http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(payload))
+		req.Header.Set("X-GitHub-Event", "workflow_run")
+		req.Header.Set("X-Hub-Signature-256", tt.signature)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		assert.Equal(t, tt.expectedCode, rec.Code)
+	}
+	assert.Len(t, pub.published, 1)
+}
+
+func TestHandler_TraceContext(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	}()
+
+	pub := &recordingPublisher{}
+	mux := http.NewServeMux()
+	NewHandler(HandlerConfig{Queue: pub, Secret: testSecret, Filter: Filter{AllowedOrgs: []string{"acme"}}}).Register(mux)
+
+	payload := workflowRunPayload("completed", "acme", "ci.yml")
+	req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(payload))
+	req.Header.Set("X-GitHub-Event", "workflow_run")
+	req.Header.Set("X-Hub-Signature-256", sign(payload))
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+	names := []string{spans[0].Name(), spans[1].Name(), spans[2].Name()}
+	assert.Equal(t, []string{"webhook.validate", "queue.publish", "webhook.receive"}, names)
+	publish := spans[1]
+	assert.Equal(t, spans[2].SpanContext().SpanID(), publish.Parent().SpanID())
+
+	// The worker continues the trace from the publish span
+	require.Len(t, pub.published, 1)
+	assert.Contains(t, pub.published[0].TraceContext["traceparent"], publish.SpanContext().SpanID().String())
+}
+
+func TestHandler_Metrics(t *testing.T) {
+	h := NewHandler(HandlerConfig{
+		Queue:  &recordingPublisher{},
+		Secret: testSecret,
+		Filter: Filter{AllowedOrgs: []string{"acme"}},
+	})
+	mux := http.NewServeMux()
+	h.Register(mux)
+
+	deliver := func(payload, signature string) {
+		req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(payload))
+		req.Header.Set("X-GitHub-Event", "workflow_run")
+		req.Header.Set("X-Hub-Signature-256", signature)
+		mux.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	valid := workflowRunPayload("completed", "acme", "ci.yml")
+	evil := workflowRunPayload("completed", "evil", "ci.yml")
+	deliver(valid, sign(valid))
+	deliver(valid, sign(valid))
+	deliver(evil, sign(evil))
+	deliver(valid, "sha256=00")
+
+	var out strings.Builder
+	h.WriteMetrics(&out)
+
+	assert.Equal(t, `# HELP canopy_webhook_deliveries_total Webhook deliveries by outcome.
+# TYPE canopy_webhook_deliveries_total counter
+canopy_webhook_deliveries_total{status="queued",reason=""} 2
+canopy_webhook_deliveries_total{status="rejected",reason="disallowed_org"} 1
+canopy_webhook_deliveries_total{status="rejected",reason="invalid_signature"} 1
+`, out.String())
+
+	parser := expfmt.NewTextParser(model.LegacyValidation)
+	families, err := parser.TextToMetricFamilies(strings.NewReader(out.String()))
+	require.NoError(t, err)
+	assert.Len(t, families["canopy_webhook_deliveries_total"].GetMetric(), 3)
+}
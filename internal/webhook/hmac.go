@@ -26,8 +26,12 @@ var (
 //
 // The signature header format is: "sha256=<hex-encoded-signature>"
 //
+// A signature matching any of secrets is valid, so a secret can be rotated
+// by accepting the old and new secret until GitHub signs with the new one.
+// Every secret is compared, so the time taken doesn't tell which matched.
+//
 // Returns nil if the signature is valid, or an error otherwise.
-func ValidateHMAC(payload []byte, signature string, secret string) error {
+func ValidateHMAC(payload []byte, signature string, secrets ...string) error {
 	// Check for missing signature
 	if signature == "" {
 		return ErrMissingSignature
@@ -50,15 +54,31 @@ func ValidateHMAC(payload []byte, signature string, secret string) error {
 		return fmt.Errorf("%w: %v", ErrMalformedSignature, err)
 	}
 
-	// Compute expected signature
-	mac := hmac.New(sha256.New, []byte(secret))
-	mac.Write(payload)
-	expectedBytes := mac.Sum(nil)
-
-	// Constant-time comparison to prevent timing attacks
-	if !hmac.Equal(expectedBytes, providedBytes) {
+	// Compute the expected signatures and compare them in constant time to
+	// prevent timing attacks
+	valid := false
+	for _, secret := range secrets {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(payload)
+		if hmac.Equal(mac.Sum(nil), providedBytes) {
+			valid = true
+		}
+	}
+	if !valid {
 		return ErrInvalidSignature
 	}
 
 	return nil
 }
+
+// SplitSecrets returns the comma-separated secrets of a webhook secret
+// setting, e.g. "new-secret,old-secret" while rotating.
+func SplitSecrets(secret string) []string {
+	var secrets []string
+	for _, s := range strings.Split(secret, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			secrets = append(secrets, s)
+		}
+	}
+	return secrets
+}
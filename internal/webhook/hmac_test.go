@@ -5,6 +5,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"errors"
+	"slices"
 	"testing"
 )
 
@@ -215,3 +216,53 @@ func TestValidateHMAC_GitHubExample(t *testing.T) {
 		t.Errorf("expected ErrInvalidSignature for tampered payload, got %v", err)
 	}
 }
+
+func TestValidateHMAC_Rotation(t *testing.T) {
+	payload := []byte(`{"action":"completed"}`)
+	signature := func(secret string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(payload)
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	tests := []struct {
+		name          string
+		signature     string
+		secrets       []string
+		expectedError error
+	}{
+		{name: "new secret", signature: signature("new"), secrets: []string{"new", "old"}},
+		{name: "old secret", signature: signature("old"), secrets: []string{"new", "old"}},
+		{name: "retired secret", signature: signature("retired"), secrets: []string{"new", "old"}, expectedError: ErrInvalidSignature},
+		{name: "no secrets", signature: signature(""), expectedError: ErrInvalidSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateHMAC(payload, tt.signature, tt.secrets...)
+			if !errors.Is(err, tt.expectedError) {
+				t.Errorf("expected error %v, got %v", tt.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestSplitSecrets(t *testing.T) {
+	tests := []struct {
+		secret   string
+		expected []string
+	}{
+		{secret: "", expected: nil},
+		{secret: "s3cret", expected: []string{"s3cret"}},
+		{secret: "new, old", expected: []string{"new", "old"}},
+		{secret: "new,,old,", expected: []string{"new", "old"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.secret, func(t *testing.T) {
+			if got := SplitSecrets(tt.secret); !slices.Equal(got, tt.expected) {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package webhook
+
+import (
+	"fmt"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/worker"
+)
+
+// NoAnalyzableChangesTitle is the title of the check run published when a
+// PR's diff has nothing for the worker to analyze.
+const NoAnalyzableChangesTitle = "No analyzable changes"
+
+// HasAnalyzableChanges reports whether a PR's diff (as returned by the
+// GitHub compare API) adds lines to any source file (see
+// coverage.IsSourceFile) not excluded by filters. It lets the handler skip
+// enqueueing work for docs-only and other non-source changes, for which the
+// worker would only report that no lines were added.
+// An empty diff has no analyzable changes.
+func HasAnalyzableChanges(diff []byte, filters ...coverage.FileFilter) (bool, error) {
+	if len(diff) == 0 {
+		return false, nil
+	}
+	fileDiffs, err := coverage.ParseDiff(diff)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse diff: %w", err)
+	}
+	added := coverage.FilterAddedLines(coverage.GetAddedLinesByFile(fileDiffs), filters...)
+	return len(added) > 0, nil
+}
+
+// NoAnalyzableChangesCheckRun returns the successful check run published
+// in place of analysis when HasAnalyzableChanges is false.
+func NoAnalyzableChangesCheckRun(headSHA string) *worker.CheckRun {
+	return &worker.CheckRun{
+		Name:       worker.CheckRunName,
+		HeadSHA:    headSHA,
+		Conclusion: worker.ConclusionSuccess,
+		Title:      NoAnalyzableChangesTitle,
+		Summary:    "This change adds no source code, so coverage was not analyzed.",
+	}
+}
@@ -0,0 +1,93 @@
+package webhook
+
+import (
+	"testing"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/worker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const docsDiff = `diff --git a/README.md b/README.md
+index 1111111..2222222 100644
+--- a/README.md
++++ b/README.md
+@@ -1,2 +1,3 @@
+ # Widgets
++More docs.
+ Usage
+`
+
+const goDiff = `diff --git a/calc.go b/calc.go
+index 1111111..2222222 100644
+--- a/calc.go
++++ b/calc.go
+@@ -1,2 +1,3 @@
+ package calc
++func Add(a, b int) int { return a + b }
+
+`
+
+const generatedDiff = `diff --git a/api.pb.go b/api.pb.go
+index 1111111..2222222 100644
+--- a/api.pb.go
++++ b/api.pb.go
+@@ -1,2 +1,3 @@
+ package api
++var x = 1
+
+`
+
+const deletedGoDiff = `diff --git a/old.go b/old.go
+deleted file mode 100644
+index 1111111..0000000
+--- a/old.go
++++ /dev/null
+@@ -1,2 +0,0 @@
+-package old
+-var x = 1
+`
+
+func TestHasAnalyzableChanges(t *testing.T) {
+	tests := []struct {
+		name     string
+		diff     string
+		filters  []coverage.FileFilter
+		expected bool
+	}{
+		{name: "docs only", diff: docsDiff, expected: false},
+		{name: "empty diff", diff: "", expected: false},
+		{name: "go file", diff: goDiff, expected: true},
+		{name: "docs and go", diff: docsDiff + goDiff, expected: true},
+		{name: "deleted go file", diff: deletedGoDiff, expected: false},
+		{
+			name:     "generated go file is filtered",
+			diff:     generatedDiff,
+			filters:  []coverage.FileFilter{coverage.NewGeneratedFileFilter(nil, nil)},
+			expected: false,
+		},
+		{
+			name:     "generated go file without filters",
+			diff:     generatedDiff,
+			expected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, err := HasAnalyzableChanges([]byte(tt.diff), tt.filters...)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, ok)
+		})
+	}
+}
+
+func TestNoAnalyzableChangesCheckRun(t *testing.T) {
+	run := NoAnalyzableChangesCheckRun("abc123")
+	assert.Equal(t, worker.CheckRunName, run.Name)
+	assert.Equal(t, "abc123", run.HeadSHA)
+	assert.Equal(t, worker.ConclusionSuccess, run.Conclusion)
+	assert.Equal(t, NoAnalyzableChangesTitle, run.Title)
+	assert.Empty(t, run.Annotations)
+}
@@ -0,0 +1,186 @@
+package webhook
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	proxyMinRetryDelay = time.Second
+	proxyMaxRetryDelay = 30 * time.Second
+)
+
+// proxySkippedFields are smee event fields that are not replayed as headers.
+var proxySkippedFields = map[string]bool{
+	"body":             true,
+	"query":            true,
+	"timestamp":        true,
+	"host":             true,
+	"content-length":   true,
+	"content-encoding": true,
+	"connection":       true,
+}
+
+// Proxy relays webhook deliveries from a smee.io-style channel to a local
+// endpoint, so GitHub events can be tested without exposing a port.
+//
+// The channel is consumed as a server-sent event stream. Each message event
+// carries the original delivery headers as top-level fields and the payload
+// under "body"; it is replayed as a POST to the target URL.
+//
+// The channel re-serializes the payload, so GitHub's HMAC signature will
+// usually not match; run with HMAC validation disabled.
+type Proxy struct {
+	source     string
+	target     string
+	httpClient *http.Client
+	logger     *slog.Logger
+	retryDelay time.Duration
+}
+
+// NewProxy creates a Proxy that relays events from source to target.
+func NewProxy(source, target string, logger *slog.Logger) (*Proxy, error) {
+	for name, raw := range map[string]string{"source": source, "target": target} {
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid proxy %s URL %q: must be an http(s) URL", name, raw)
+		}
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &Proxy{
+		source:     source,
+		target:     target,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		logger:     logger,
+		retryDelay: proxyMinRetryDelay,
+	}, nil
+}
+
+// Run consumes the channel and relays events until ctx is cancelled,
+// reconnecting with exponential backoff when the stream drops.
+func (p *Proxy) Run(ctx context.Context) error {
+	delay := p.retryDelay
+	for {
+		connected, err := p.stream(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if connected {
+			delay = p.retryDelay
+		}
+		p.logger.Warn("webhook proxy disconnected, reconnecting", "source", p.source, "delay", delay, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, proxyMaxRetryDelay)
+	}
+}
+
+// stream reads one connection to the channel. connected reports whether
+// the channel accepted the connection, so backoff can be reset.
+func (p *Proxy) stream(ctx context.Context) (connected bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.source, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	// The stream is long-lived, so it must not use the relay client's timeout
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to connect: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("unexpected status %d from channel", resp.StatusCode)
+	}
+	p.logger.Info("webhook proxy connected", "source", p.source, "target", p.target)
+
+	var event string
+	var data bytes.Buffer
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 25*1024*1024) // GitHub payloads are capped at 25MB
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if data.Len() > 0 && (event == "" || event == "message") {
+				if err := p.forward(ctx, data.Bytes()); err != nil {
+					p.logger.Error("failed to relay webhook", "target", p.target, "error", err)
+				}
+			}
+			event = ""
+			data.Reset()
+		case strings.HasPrefix(line, ":"):
+			// Comment / keep-alive
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return true, err
+	}
+	return true, io.EOF
+}
+
+// forward replays a single channel event to the target.
+func (p *Proxy) forward(ctx context.Context, data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return fmt.Errorf("failed to decode event: %w", err)
+	}
+	body, ok := fields["body"]
+	if !ok {
+		return errors.New("event has no body")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, raw := range fields {
+		if proxySkippedFields[strings.ToLower(name)] {
+			continue
+		}
+		var value string
+		if json.Unmarshal(raw, &value) == nil {
+			req.Header.Set(name, value)
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	p.logger.Info("relayed webhook",
+		"event", req.Header.Get("X-GitHub-Event"),
+		"delivery", req.Header.Get("X-GitHub-Delivery"),
+		"status", resp.StatusCode)
+	return nil
+}
@@ -0,0 +1,134 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type relayed struct {
+	header http.Header
+	body   string
+}
+
+func newTargetServer(t *testing.T) (*httptest.Server, chan relayed) {
+	t.Helper()
+	received := make(chan relayed, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- relayed{header: r.Header.Clone(), body: string(body)}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(server.Close)
+	return server, received
+}
+
+func TestNewProxy(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		target  string
+		wantErr string
+	}{
+		{name: "valid", source: "https://smee.io/abc", target: "http://localhost:8080/webhook"},
+		{name: "missing source", source: "", target: "http://localhost:8080/webhook", wantErr: "invalid proxy source URL"},
+		{name: "non-http source", source: "ws://smee.io/abc", target: "http://localhost:8080/webhook", wantErr: "invalid proxy source URL"},
+		{name: "missing target host", source: "https://smee.io/abc", target: "/webhook", wantErr: "invalid proxy target URL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewProxy(tt.source, tt.target, nil)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.NotNil(t, p)
+		})
+	}
+}
+
+func TestProxy_Forward(t *testing.T) {
+	target, received := newTargetServer(t)
+	p, err := NewProxy("https://smee.io/abc", target.URL, nil)
+	require.NoError(t, err)
+
+	event := `{"x-github-event":"workflow_run","x-github-delivery":"d-1","x-hub-signature-256":"sha256=abc",` +
+		`"host":"smee.io","content-length":"999","timestamp":1700000000000,"query":{},` +
+		`"body":{"action":"completed"}}`
+	require.NoError(t, p.forward(context.Background(), []byte(event)))
+
+	got := <-received
+	assert.JSONEq(t, `{"action":"completed"}`, got.body)
+	assert.Equal(t, "workflow_run", got.header.Get("X-GitHub-Event"))
+	assert.Equal(t, "d-1", got.header.Get("X-GitHub-Delivery"))
+	assert.Equal(t, "sha256=abc", got.header.Get("X-Hub-Signature-256"))
+	assert.Equal(t, "application/json", got.header.Get("Content-Type"))
+	assert.Empty(t, got.header.Get("Timestamp"))
+	assert.Empty(t, got.header.Get("Query"))
+}
+
+func TestProxy_ForwardErrors(t *testing.T) {
+	p, err := NewProxy("https://smee.io/abc", "http://localhost:1/webhook", nil)
+	require.NoError(t, err)
+
+	err = p.forward(context.Background(), []byte("not json"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to decode event")
+
+	err = p.forward(context.Background(), []byte(`{"x-github-event":"ping"}`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "event has no body")
+}
+
+func TestProxy_Run(t *testing.T) {
+	target, received := newTargetServer(t)
+
+	var connections atomic.Int32
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := connections.Add(1)
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: ready\ndata: {}\n\n")
+		fmt.Fprint(w, ": keep-alive\n\n")
+		fmt.Fprint(w, "event: ping\ndata: {}\n\n")
+		fmt.Fprintf(w, "data: {\"x-github-event\":\"workflow_run\",\"x-github-delivery\":\"d-%d\",\"body\":{\"n\":%d}}\n\n", n, n)
+		// Returning closes the stream, exercising reconnection
+	}))
+	defer source.Close()
+
+	p, err := NewProxy(source.URL, target.URL, nil)
+	require.NoError(t, err)
+	p.retryDelay = time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- p.Run(ctx) }()
+
+	for i := 1; i <= 2; i++ {
+		select {
+		case got := <-received:
+			assert.Equal(t, fmt.Sprintf("d-%d", i), got.header.Get("X-GitHub-Delivery"))
+			assert.JSONEq(t, fmt.Sprintf(`{"n":%d}`, i), got.body)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for relayed event %d", i)
+		}
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancellation")
+	}
+}
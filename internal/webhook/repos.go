@@ -0,0 +1,89 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github"
+)
+
+// RepoLister lists the repositories the GitHub App installation can access;
+// *github.Client implements it.
+type RepoLister interface {
+	ListInstallationRepos(ctx context.Context) ([]github.Repository, error)
+}
+
+// InstallationRepos is the set of repositories the GitHub App installation
+// grants access to, kept in sync with GitHub by Run. Used as Filter.Repos,
+// it narrows processing to the repositories selected for the installation
+// even where the app is installed org-wide but only some are wanted.
+type InstallationRepos struct {
+	lister   RepoLister
+	interval time.Duration
+	logger   *slog.Logger
+
+	mu    sync.RWMutex
+	repos map[string]bool
+}
+
+// NewInstallationRepos creates an InstallationRepos synced from lister
+// every interval. It allows no repository until the first Sync.
+func NewInstallationRepos(lister RepoLister, interval time.Duration, logger *slog.Logger) *InstallationRepos {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &InstallationRepos{lister: lister, interval: interval, logger: logger}
+}
+
+// Sync replaces the set with the repositories currently listed. On error,
+// the previous set is kept.
+func (r *InstallationRepos) Sync(ctx context.Context) error {
+	list, err := r.lister.ListInstallationRepos(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list installation repositories: %w", err)
+	}
+	repos := make(map[string]bool, len(list))
+	for _, repo := range list {
+		repos[strings.ToLower(repo.FullName)] = true
+	}
+
+	r.mu.Lock()
+	r.repos = repos
+	r.mu.Unlock()
+	return nil
+}
+
+// Run syncs the set every interval until ctx is cancelled. Failed syncs are
+// logged and retried at the next interval, so a GitHub outage keeps the
+// last known repositories rather than rejecting every event.
+func (r *InstallationRepos) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		if err := r.Sync(ctx); err != nil && ctx.Err() == nil {
+			r.logger.Warn("failed to sync installation repositories", "error", err)
+			continue
+		}
+		r.mu.RLock()
+		n := len(r.repos)
+		r.mu.RUnlock()
+		r.logger.Debug("synced installation repositories", "repos", n)
+	}
+}
+
+// Allowed reports whether a repository, by its "owner/name" full name, was
+// listed by the last Sync. GitHub names are case-insensitive.
+func (r *InstallationRepos) Allowed(fullName string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.repos[strings.ToLower(fullName)]
+}
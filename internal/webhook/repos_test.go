@@ -0,0 +1,73 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRepoLister lists repos, or fails with err.
+type fakeRepoLister struct {
+	mu    sync.Mutex
+	repos []github.Repository
+	err   error
+	calls int
+}
+
+func (f *fakeRepoLister) ListInstallationRepos(ctx context.Context) ([]github.Repository, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	return f.repos, f.err
+}
+
+func TestInstallationRepos(t *testing.T) {
+	lister := &fakeRepoLister{repos: []github.Repository{{FullName: "acme/Widgets"}, {FullName: "acme/gadgets"}}}
+	repos := NewInstallationRepos(lister, time.Hour, nil)
+	filter := Filter{AllowedOrgs: []string{"acme"}, Repos: repos}
+	event := func(repo string) *WorkflowRunEvent {
+		return &WorkflowRunEvent{
+			Action:       "completed",
+			WorkflowRun:  WorkflowRun{ID: 1, Name: "ci.yml"},
+			Repository:   Repository{FullName: repo},
+			Organization: Organization{Login: "acme"},
+		}
+	}
+
+	// Nothing is allowed before the first sync
+	assert.ErrorIs(t, filter.Validate(event("acme/widgets")), ErrDisallowedRepo)
+
+	require.NoError(t, repos.Sync(context.Background()))
+	assert.NoError(t, filter.Validate(event("acme/widgets")))
+	assert.NoError(t, filter.Validate(event("acme/gadgets")))
+	assert.EqualError(t, filter.Validate(event("acme/secret")), `repository not allowed: "acme/secret"`)
+
+	// A failed sync keeps the last repositories
+	lister.err = errors.New("bad gateway")
+	assert.EqualError(t, repos.Sync(context.Background()), "failed to list installation repositories: bad gateway")
+	assert.True(t, repos.Allowed("acme/gadgets"))
+
+	lister.err = nil
+	lister.repos = []github.Repository{{FullName: "acme/secret"}}
+	require.NoError(t, repos.Sync(context.Background()))
+	assert.False(t, repos.Allowed("acme/gadgets"))
+	assert.True(t, repos.Allowed("acme/secret"))
+}
+
+func TestInstallationRepos_Run(t *testing.T) {
+	lister := &fakeRepoLister{repos: []github.Repository{{FullName: "acme/widgets"}}}
+	repos := NewInstallationRepos(lister, time.Millisecond, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- repos.Run(ctx) }()
+
+	assert.Eventually(t, func() bool { return repos.Allowed("acme/widgets") }, time.Second, time.Millisecond)
+	cancel()
+	assert.NoError(t, <-done)
+}
@@ -3,15 +3,38 @@ package webhook
 import (
 	"errors"
 	"fmt"
+	"path"
+	"time"
 )
 
 var (
 	// ErrInvalidAction is returned when the workflow run action is not "completed"
 	ErrInvalidAction = errors.New("workflow run action must be 'completed'")
 
+	// ErrNotRerequested is returned when a check run or check suite action
+	// is not "rerequested"
+	ErrNotRerequested = errors.New("check action must be 'rerequested'")
+
+	// ErrNotPullRequestPush is returned when a pull request action is not
+	// "opened" or "synchronize"
+	ErrNotPullRequestPush = errors.New("pull request action must be 'opened' or 'synchronize'")
+
+	// ErrUnknownCheckRun is returned when a re-requested check run's
+	// external ID doesn't name the workflow run it analyzed
+	ErrUnknownCheckRun = errors.New("check run does not name a workflow run")
+
 	// ErrDisallowedOrg is returned when the organization is not in the allowed list
 	ErrDisallowedOrg = errors.New("organization not allowed")
 
+	// ErrDisallowedRepo is returned when the repository doesn't match the
+	// allowed patterns, or is not one the GitHub App installation grants
+	// access to
+	ErrDisallowedRepo = errors.New("repository not allowed")
+
+	// ErrDisallowedBranch is returned when neither the run's branch nor the
+	// base branch of its PR matches the allowed patterns
+	ErrDisallowedBranch = errors.New("branch not allowed")
+
 	// ErrDisallowedWorkflow is returned when the workflow name is not in the allowed list
 	ErrDisallowedWorkflow = errors.New("workflow not allowed")
 )
@@ -25,16 +48,32 @@ var (
 // WorkflowRunEvent represents the minimal structure of a GitHub workflow_run webhook event
 // needed for validation. This matches the structure from GitHub's webhook payloads.
 type WorkflowRunEvent struct {
-	Action      string       `json:"action"`
-	WorkflowRun WorkflowRun  `json:"workflow_run"`
-	Repository  Repository   `json:"repository"`
+	Action       string       `json:"action"`
+	WorkflowRun  WorkflowRun  `json:"workflow_run"`
+	Repository   Repository   `json:"repository"`
 	Organization Organization `json:"organization"`
+	Installation Installation `json:"installation"`
 }
 
 // WorkflowRun contains workflow run details
 type WorkflowRun struct {
-	ID   int64  `json:"id"`
-	Name string `json:"name"`
+	ID         int64  `json:"id"`
+	Name       string `json:"name"`
+	HeadSHA    string `json:"head_sha"`
+	HeadBranch string `json:"head_branch"`
+	// PullRequests are the PRs the run's head is the head of
+	PullRequests []WorkflowRunPullRequest `json:"pull_requests"`
+	// UpdatedAt is when the run last changed; for completed runs, when it completed
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// WorkflowRunPullRequest is a PR of a workflow run
+type WorkflowRunPullRequest struct {
+	Number int `json:"number"`
+	Base   struct {
+		SHA string `json:"sha"`
+		Ref string `json:"ref"`
+	} `json:"base"`
 }
 
 // Repository contains repository information
@@ -48,6 +87,81 @@ type Organization struct {
 	Login string `json:"login"`
 }
 
+// Installation identifies the GitHub App installation that delivered the event
+type Installation struct {
+	ID int64 `json:"id"`
+}
+
+// RerequestEvent represents the minimal structure of the GitHub check_run
+// and check_suite webhook events sent when a user re-runs Canopy's check
+// run or its check suite.
+type RerequestEvent struct {
+	Action string `json:"action"`
+	// CheckRun is the re-requested check run of a check_run event
+	CheckRun     CheckRun     `json:"check_run"`
+	CheckSuite   CheckSuite   `json:"check_suite"`
+	Repository   Repository   `json:"repository"`
+	Organization Organization `json:"organization"`
+	Installation Installation `json:"installation"`
+}
+
+// CheckRun contains check run details
+type CheckRun struct {
+	ID int64 `json:"id"`
+	// ExternalID is the queue.WorkRequest.CheckRunExternalID the worker
+	// published the check run with
+	ExternalID string `json:"external_id"`
+}
+
+// CheckSuite contains check suite details
+type CheckSuite struct {
+	ID      int64  `json:"id"`
+	HeadSHA string `json:"head_sha"`
+}
+
+// PullRequestEvent represents the minimal structure of a GitHub
+// pull_request webhook event needed to analyze coverage uploaded for its
+// head commit.
+type PullRequestEvent struct {
+	Action       string       `json:"action"`
+	Number       int          `json:"number"`
+	PullRequest  PullRequest  `json:"pull_request"`
+	Repository   Repository   `json:"repository"`
+	Organization Organization `json:"organization"`
+	Installation Installation `json:"installation"`
+}
+
+// PullRequest contains pull request details
+type PullRequest struct {
+	Head struct {
+		SHA string `json:"sha"`
+		Ref string `json:"ref"`
+	} `json:"head"`
+	Base struct {
+		SHA string `json:"sha"`
+		Ref string `json:"ref"`
+	} `json:"base"`
+}
+
+// Filter holds the organizations, repositories, and workflows whose runs
+// are accepted.
+type Filter struct {
+	AllowedOrgs []string
+	// Repos, if set, accepts only the repositories of the GitHub App
+	// installation, within AllowedOrgs
+	Repos *InstallationRepos
+	// AllowedWorkflows lists accepted workflow names; empty accepts all workflows
+	AllowedWorkflows []string
+	// AllowedRepos are path.Match patterns of accepted repositories' full
+	// names, e.g. "grafana/loki" or "grafana/*-operator"; empty accepts all
+	// repositories of AllowedOrgs
+	AllowedRepos []string
+	// AllowedBranches are path.Match patterns of accepted branches, e.g.
+	// "main" or "release-*": runs of matching branches are accepted, and
+	// runs of PRs into them; empty accepts all branches
+	AllowedBranches []string
+}
+
 // ValidateEvent validates a GitHub workflow_run webhook event against the configured criteria.
 // It checks:
 // 1. Action is "completed"
@@ -56,28 +170,101 @@ type Organization struct {
 //
 // Returns nil if the event is valid, or a specific error otherwise.
 func ValidateEvent(event *WorkflowRunEvent) error {
+	return Filter{AllowedOrgs: allowedOrgs, AllowedWorkflows: allowedWorkflows}.Validate(event)
+}
+
+// Validate validates an event like ValidateEvent, using the filter's
+// allowed organizations, repositories, and workflows.
+func (f Filter) Validate(event *WorkflowRunEvent) error {
 	// Check action is "completed"
 	if event.Action != "completed" {
 		return fmt.Errorf("%w: got %q", ErrInvalidAction, event.Action)
 	}
 
-	// Check organization is allowed
-	org := event.Organization.Login
-	if !contains(allowedOrgs, org) {
-		return fmt.Errorf("%w: %q", ErrDisallowedOrg, org)
+	if err := f.validateRepository(event.Organization, event.Repository); err != nil {
+		return err
 	}
 
 	// Check workflow name is allowed
 	// The workflow name from the event is the workflow file path (e.g., ".github/workflows/ci.yml")
 	// We need to extract just the filename
 	workflowName := event.WorkflowRun.Name
-	if !contains(allowedWorkflows, workflowName) {
+	if len(f.AllowedWorkflows) > 0 && !contains(f.AllowedWorkflows, workflowName) {
 		return fmt.Errorf("%w: %q", ErrDisallowedWorkflow, workflowName)
 	}
 
+	bases := make([]string, 0, len(event.WorkflowRun.PullRequests))
+	for _, pr := range event.WorkflowRun.PullRequests {
+		bases = append(bases, pr.Base.Ref)
+	}
+	return f.validateBranch(event.WorkflowRun.HeadBranch, bases...)
+}
+
+// ValidateRerequest validates a check_run or check_suite event like
+// Validate, except that its action must be "rerequested". Workflows and
+// branches aren't checked: the re-run check was published for a run that
+// passed them.
+func (f Filter) ValidateRerequest(event *RerequestEvent) error {
+	if event.Action != "rerequested" {
+		return fmt.Errorf("%w: got %q", ErrNotRerequested, event.Action)
+	}
+	return f.validateRepository(event.Organization, event.Repository)
+}
+
+// ValidatePullRequest validates a pull_request event like Validate, except
+// that its action must be "opened" or "synchronize" (pushed to). Workflows
+// aren't checked, since the event has no workflow run.
+func (f Filter) ValidatePullRequest(event *PullRequestEvent) error {
+	if event.Action != "opened" && event.Action != "synchronize" {
+		return fmt.Errorf("%w: got %q", ErrNotPullRequestPush, event.Action)
+	}
+	if err := f.validateRepository(event.Organization, event.Repository); err != nil {
+		return err
+	}
+	return f.validateBranch(event.PullRequest.Head.Ref, event.PullRequest.Base.Ref)
+}
+
+// validateRepository checks that the organization is allowed, and the
+// repository matches the allowed patterns and is granted to the
+// installation.
+func (f Filter) validateRepository(org Organization, repo Repository) error {
+	if !contains(f.AllowedOrgs, org.Login) {
+		return fmt.Errorf("%w: %q", ErrDisallowedOrg, org.Login)
+	}
+	if len(f.AllowedRepos) > 0 && !matchAny(f.AllowedRepos, repo.FullName) {
+		return fmt.Errorf("%w: %q", ErrDisallowedRepo, repo.FullName)
+	}
+	if f.Repos != nil && !f.Repos.Allowed(repo.FullName) {
+		return fmt.Errorf("%w: %q", ErrDisallowedRepo, repo.FullName)
+	}
 	return nil
 }
 
+// validateBranch checks that a run's branch, or the base branch of one of
+// its PRs, matches the allowed patterns.
+func (f Filter) validateBranch(branch string, bases ...string) error {
+	if len(f.AllowedBranches) == 0 || matchAny(f.AllowedBranches, branch) {
+		return nil
+	}
+	for _, base := range bases {
+		if matchAny(f.AllowedBranches, base) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q", ErrDisallowedBranch, branch)
+}
+
+// matchAny reports whether name matches any of the path.Match patterns.
+// Malformed patterns match nothing; the config rejects them at startup.
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
 // contains checks if a string slice contains a given string
 func contains(slice []string, str string) bool {
 	for _, s := range slice {
@@ -282,6 +282,113 @@ func TestValidateEvent(t *testing.T) {
 	}
 }
 
+func TestFilter_ValidateRerequest(t *testing.T) {
+	filter := Filter{AllowedOrgs: []string{"grafana"}, AllowedWorkflows: []string{"ci.yml"}}
+
+	tests := []struct {
+		name        string
+		action      string
+		org         string
+		expectedErr error
+	}{
+		{name: "rerequested", action: "rerequested", org: "grafana"},
+		{name: "other action", action: "requested", org: "grafana", expectedErr: ErrNotRerequested},
+		{name: "disallowed org", action: "rerequested", org: "other", expectedErr: ErrDisallowedOrg},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := &RerequestEvent{
+				Action:       tt.action,
+				Repository:   Repository{Name: "repo", FullName: tt.org + "/repo"},
+				Organization: Organization{Login: tt.org},
+			}
+			err := filter.ValidateRerequest(event)
+			if tt.expectedErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tt.expectedErr)
+		})
+	}
+}
+
+func TestFilter_AllowedPatterns(t *testing.T) {
+	filter := Filter{
+		AllowedOrgs:     []string{"grafana"},
+		AllowedRepos:    []string{"grafana/loki", "grafana/*-operator"},
+		AllowedBranches: []string{"main", "release-*"},
+	}
+
+	tests := []struct {
+		name        string
+		repo        string
+		branch      string
+		base        string // base branch of the run's PR, if any
+		expectedErr error
+	}{
+		{name: "exact repo and branch", repo: "grafana/loki", branch: "main"},
+		{name: "repo and branch patterns", repo: "grafana/agent-operator", branch: "release-3.1"},
+		{name: "PR into allowed branch", repo: "grafana/loki", branch: "feature/mul", base: "main"},
+		{name: "disallowed repo", repo: "grafana/mimir", branch: "main", expectedErr: ErrDisallowedRepo},
+		{name: "pattern doesn't cross slash", repo: "grafana/x/y-operator", branch: "main", expectedErr: ErrDisallowedRepo},
+		{name: "disallowed branch", repo: "grafana/loki", branch: "feature/mul", expectedErr: ErrDisallowedBranch},
+		{name: "PR into disallowed branch", repo: "grafana/loki", branch: "feature/mul", base: "next", expectedErr: ErrDisallowedBranch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			org := Organization{Login: "grafana"}
+			repo := Repository{FullName: tt.repo}
+
+			run := &WorkflowRunEvent{Action: "completed", Repository: repo, Organization: org}
+			run.WorkflowRun.HeadBranch = tt.branch
+			if tt.base != "" {
+				run.WorkflowRun.PullRequests = make([]WorkflowRunPullRequest, 1)
+				run.WorkflowRun.PullRequests[0].Base.Ref = tt.base
+			}
+
+			pr := &PullRequestEvent{Action: "opened", Repository: repo, Organization: org}
+			pr.PullRequest.Head.Ref = tt.branch
+			pr.PullRequest.Base.Ref = tt.base
+
+			pipeline := &GitLabPipelineEvent{}
+			pipeline.ObjectAttributes.Status = "success"
+			pipeline.ObjectAttributes.Ref = tt.branch
+			pipeline.Project.PathWithNamespace = tt.repo
+			if tt.base != "" {
+				pipeline.MergeRequest = &struct {
+					IID          int    `json:"iid"`
+					SourceBranch string `json:"source_branch"`
+					TargetBranch string `json:"target_branch"`
+				}{IID: 1, SourceBranch: tt.branch, TargetBranch: tt.base}
+			}
+
+			for name, err := range map[string]error{
+				"workflow run": filter.Validate(run),
+				"pull request": filter.ValidatePullRequest(pr),
+				"pipeline":     filter.ValidatePipeline(pipeline),
+			} {
+				if tt.expectedErr == nil {
+					assert.NoError(t, err, name)
+					continue
+				}
+				assert.ErrorIs(t, err, tt.expectedErr, name)
+			}
+		})
+	}
+}
+
+func TestFilter_ValidateRerequestSkipsBranches(t *testing.T) {
+	filter := Filter{AllowedOrgs: []string{"grafana"}, AllowedRepos: []string{"grafana/loki"}, AllowedBranches: []string{"main"}}
+	event := &RerequestEvent{Action: "rerequested", Organization: Organization{Login: "grafana"}}
+
+	event.Repository = Repository{FullName: "grafana/loki"}
+	assert.NoError(t, filter.ValidateRerequest(event))
+	event.Repository = Repository{FullName: "grafana/mimir"}
+	assert.ErrorIs(t, filter.ValidateRerequest(event), ErrDisallowedRepo)
+}
+
 func TestContains(t *testing.T) {
 	tests := []struct {
 		name  string
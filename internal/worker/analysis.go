@@ -0,0 +1,95 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/buildinfo"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/format"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+)
+
+// AnalysisName is the name analyses are stored under, next to the
+// coverage of their run and PR (see AnalysisKey and PullRequestAnalysisKey).
+const AnalysisName = "analysis.json"
+
+// Analysis is the result of analyzing a PR run, saved for the query API.
+type Analysis struct {
+	WorkflowRunID int64  `json:"workflow_run_id"`
+	PullRequest   int    `json:"pull_request"`
+	HeadSHA       string `json:"head_sha"`
+	// BaseSHA is the merge base compared with, if known (see Run.BaseSHA)
+	BaseSHA    string    `json:"base_sha,omitempty"`
+	Conclusion string    `json:"conclusion"`
+	AnalyzedAt time.Time `json:"analyzed_at"`
+	// BaseCoverage and CoverageDelta compare project coverage with the
+	// base; nil without base coverage
+	BaseCoverage  *float64 `json:"base_coverage,omitempty"`
+	CoverageDelta *float64 `json:"coverage_delta,omitempty"`
+	// Report is the patch coverage of the run, as written by canopy's JSON
+	// output, with the head's project coverage
+	Report *format.JSONReport `json:"report"`
+}
+
+// AnalysisKey returns the key the analysis of a workflow run is stored
+// under: {org}/{repo}/runs/{id}/analysis.json.
+func AnalysisKey(org, repo string, runID int64) storage.CoverageKey {
+	return storage.CoverageKey{Org: org, Repo: repo, Branch: fmt.Sprintf("runs/%d", runID), Export: AnalysisName}
+}
+
+// PullRequestAnalysisKey returns the key the analysis of a PR's last
+// analyzed run is stored under, next to its coverage (see PullRequestKey).
+func PullRequestAnalysisKey(org, repo string, number int) storage.CoverageKey {
+	key := PullRequestKey(org, repo, number)
+	key.Export = AnalysisName
+	return key
+}
+
+// ParseAnalysis decodes a stored Analysis.
+func ParseAnalysis(data []byte) (*Analysis, error) {
+	var a Analysis
+	if err := json.Unmarshal(data, &a); err != nil {
+		return nil, fmt.Errorf("failed to parse analysis: %w", err)
+	}
+	return &a, nil
+}
+
+// saveAnalysis saves the analysis of a PR run under the keys of the run and
+// of the PR; analyses of pull request requests, which have no run, only
+// under the PR's.
+func saveAnalysis(ctx context.Context, in *Inputs, pub Publisher, checkRun *CheckRun, result *coverage.AnalysisResult, head *coverage.CoverageStats, comparison *coverage.CoverageComparison, hasBase bool, now time.Time) error {
+	provenance := buildinfo.New(in.Version, in.RepoConfig)
+	report := format.NewJSONReport(result)
+	report.Project = format.NewJSONProject(head)
+	report.Canopy = &provenance
+	analysis := &Analysis{
+		WorkflowRunID: in.Request.WorkflowRunID,
+		PullRequest:   in.Run.PullRequest,
+		HeadSHA:       in.Run.HeadSHA,
+		BaseSHA:       in.Run.BaseSHA,
+		Conclusion:    checkRun.Conclusion,
+		AnalyzedAt:    now.UTC(),
+		Report:        report,
+	}
+	if hasBase {
+		analysis.BaseCoverage, analysis.CoverageDelta = &comparison.BaseCoverage, &comparison.Delta
+	}
+
+	data, err := json.Marshal(analysis)
+	if err != nil {
+		return fmt.Errorf("failed to encode analysis: %w", err)
+	}
+	keys := []storage.CoverageKey{PullRequestAnalysisKey(in.Request.Org, in.Request.Repo, in.Run.PullRequest)}
+	if in.Request.WorkflowRunID != 0 {
+		keys = append(keys, AnalysisKey(in.Request.Org, in.Request.Repo, in.Request.WorkflowRunID))
+	}
+	for _, key := range keys {
+		if err := pub.SaveCoverage(ctx, key, data); err != nil {
+			return fmt.Errorf("failed to save analysis: %w", err)
+		}
+	}
+	return nil
+}
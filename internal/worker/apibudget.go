@@ -0,0 +1,51 @@
+package worker
+
+import (
+	"fmt"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github"
+)
+
+// APIBudget accounts for the GitHub API requests made while processing a
+// single work request. Requests the result can't do without (fetching
+// inputs, the check run) are always made; optional ones (the PR comment)
+// are skipped once the request has made Limit requests, or once the
+// installation has fewer than Reserve requests left in its rate limit
+// window, so one expensive request can't use up quota other repositories
+// need for their check runs.
+// A nil APIBudget, or one with zero Limit and Reserve, never skips requests.
+type APIBudget struct {
+	// Limit is the number of requests after which optional requests are
+	// skipped; zero is unlimited
+	Limit int
+	// Reserve is the installation's remaining quota below which optional
+	// requests are skipped; zero never skips them
+	Reserve int
+	// Usage counts the requests made with contexts carrying it (see
+	// github.WithUsage)
+	Usage github.Usage
+}
+
+// Exhausted returns why optional requests should be skipped, or "" if they
+// can be made.
+func (b *APIBudget) Exhausted() string {
+	if b == nil {
+		return ""
+	}
+	if requests := b.Usage.Requests(); b.Limit > 0 && requests >= b.Limit {
+		return fmt.Sprintf("%d GitHub API requests made, the limit per run is %d", requests, b.Limit)
+	}
+	if remaining, _, ok := b.Usage.RateLimit(); ok && b.Reserve > 0 && remaining < b.Reserve {
+		return fmt.Sprintf("%d GitHub API requests left in the rate limit, below the reserve of %d", remaining, b.Reserve)
+	}
+	return ""
+}
+
+// logAttrs returns the request count and last reported quota for logging.
+func (b *APIBudget) logAttrs() []any {
+	attrs := []any{"github_requests", b.Usage.Requests()}
+	if remaining, limit, ok := b.Usage.RateLimit(); ok {
+		attrs = append(attrs, "github_rate_remaining", remaining, "github_rate_limit", limit)
+	}
+	return attrs
+}
@@ -0,0 +1,98 @@
+package worker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// spend makes requests GitHub API requests counted by b, each reporting
+// remaining requests left in the rate limit.
+func spend(t *testing.T, b *APIBudget, requests, remaining int) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Limit", "5000")
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Write([]byte(`{"default_branch":"main"}`))
+	}))
+	defer server.Close()
+
+	c, err := github.NewClient(github.ClientConfig{BaseURL: server.URL, Tokens: github.StaticToken("t")})
+	require.NoError(t, err)
+	ctx := github.WithUsage(context.Background(), &b.Usage)
+	for range requests {
+		_, err := c.GetRepository(ctx, "acme", "widgets")
+		require.NoError(t, err)
+	}
+}
+
+func TestAPIBudget(t *testing.T) {
+	tests := []struct {
+		name      string
+		limit     int
+		reserve   int
+		requests  int
+		remaining int
+		expected  string
+	}{
+		{name: "unlimited", requests: 10, remaining: 0},
+		{name: "under limit", limit: 10, requests: 9, remaining: 4000},
+		{name: "limit reached", limit: 10, requests: 10, remaining: 4000, expected: "10 GitHub API requests made, the limit per run is 10"},
+		{name: "above reserve", reserve: 100, requests: 1, remaining: 100},
+		{name: "below reserve", reserve: 100, requests: 1, remaining: 99, expected: "99 GitHub API requests left in the rate limit, below the reserve of 100"},
+		{name: "no requests", limit: 10, reserve: 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &APIBudget{Limit: tt.limit, Reserve: tt.reserve}
+			spend(t, b, tt.requests, tt.remaining)
+			assert.Equal(t, tt.expected, b.Exhausted())
+		})
+	}
+
+	t.Run("nil budget", func(t *testing.T) {
+		var b *APIBudget
+		assert.Empty(t, b.Exhausted())
+	})
+}
+
+func TestGitHubPublisher_APIBudget(t *testing.T) {
+	tests := []struct {
+		name            string
+		remaining       int
+		expectedComment bool
+	}{
+		{name: "quota left", remaining: 1000, expectedComment: true},
+		{name: "quota below reserve", remaining: 10, expectedComment: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := newFakeGitHub(t, "testdata/fixtures/pr")
+			budget := &APIBudget{Reserve: 100}
+			spend(t, budget, 1, tt.remaining)
+			pub := &GitHubPublisher{GitHub: gh, Org: "acme", Repo: "widgets", APIBudget: budget}
+			ctx := context.Background()
+
+			require.NoError(t, pub.PublishCheckRun(ctx, gh.in.Request, &CheckRun{Name: CheckRunName, HeadSHA: "abc", Summary: "Coverage\n"}))
+			require.NoError(t, pub.PublishComment(ctx, gh.in.Request, &Comment{PullRequest: 7, Body: "report"}))
+
+			// The check run is always published, noting a skipped comment
+			require.Len(t, gh.checkRuns, 1)
+			if tt.expectedComment {
+				assert.Len(t, gh.created, 1)
+				assert.Equal(t, "Coverage\n", gh.checkRuns[0].Summary)
+			} else {
+				assert.Empty(t, gh.created)
+				assert.Contains(t, gh.checkRuns[0].Summary, "The coverage comment was skipped to save GitHub API quota: 10 GitHub API requests left")
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github/artifacts"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/queue"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+)
+
+// ErrArtifactsExpired is returned by an ArtifactSource when the workflow
+// run's artifacts existed but have passed their retention period.
+var ErrArtifactsExpired = errors.New("workflow artifacts expired")
+
+// ArtifactSource fetches the coverage artifacts of a workflow run.
+type ArtifactSource interface {
+	// FetchArtifacts returns the run's coverage artifacts. It returns
+	// ErrArtifactsExpired (possibly wrapped) if they have expired, and no
+	// artifacts and no error if the run has none.
+	FetchArtifacts(ctx context.Context, req *queue.WorkRequest, run Run) ([]Artifact, error)
+}
+
+// FetchArtifacts fetches artifacts from primary, the workflow run itself.
+// If they have expired (e.g. processing was delayed by an outage) or the run
+// has none, each fallback is tried in order until one returns artifacts.
+// If no source has any, the primary's ErrArtifactsExpired is returned, so
+// the request fails permanently instead of being retried.
+func FetchArtifacts(ctx context.Context, req *queue.WorkRequest, run Run, primary ArtifactSource, fallbacks ...ArtifactSource) ([]Artifact, error) {
+	artifacts, primaryErr := primary.FetchArtifacts(ctx, req, run)
+	if primaryErr != nil && !errors.Is(primaryErr, ErrArtifactsExpired) {
+		return nil, primaryErr
+	}
+	if len(artifacts) > 0 {
+		return artifacts, nil
+	}
+
+	for _, fallback := range fallbacks {
+		artifacts, err := fallback.FetchArtifacts(ctx, req, run)
+		if err != nil && !errors.Is(err, ErrArtifactsExpired) {
+			return nil, fmt.Errorf("artifact fallback failed: %w", err)
+		}
+		if len(artifacts) > 0 {
+			return artifacts, nil
+		}
+	}
+	return nil, primaryErr
+}
+
+// ArtifactCopyKey is the storage key of the copy of a commit's coverage
+// written by a companion upload step, for StorageArtifactSource:
+// {org}/{repo}/artifacts/{sha}/coverage.out
+func ArtifactCopyKey(org, repo, sha string) storage.CoverageKey {
+	return storage.CoverageKey{Org: org, Repo: repo, Branch: "artifacts/" + sha}
+}
+
+// StorageArtifactSource restores coverage from the copy a companion upload
+// step wrote to storage at ArtifactCopyKey, outliving the run's artifacts.
+type StorageArtifactSource struct {
+	Storage storage.Storage
+	// Budget, if set, is charged for the restored copy
+	Budget *MemoryBudget
+}
+
+// FetchArtifacts implements ArtifactSource.
+func (s *StorageArtifactSource) FetchArtifacts(ctx context.Context, req *queue.WorkRequest, run Run) ([]Artifact, error) {
+	data, err := s.Storage.GetCoverage(ctx, ArtifactCopyKey(req.Org, req.Repo, run.HeadSHA))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stored coverage copy: %w", err)
+	}
+	if data == nil {
+		return nil, nil
+	}
+	if err := s.Budget.Charge("stored coverage copy", int64(len(data))); err != nil {
+		return nil, err
+	}
+	return []Artifact{{Name: "coverage.out", Data: data}}, nil
+}
+
+// RunArtifacts is the subset of the GitHub API used by GitHubArtifactSource.
+type RunArtifacts = artifacts.API
+
+// GitHubArtifactSource downloads the coverage artifacts of the workflow run
+// itself, those with names matching Patterns (see artifacts.Match).
+type GitHubArtifactSource struct {
+	GitHub RunArtifacts
+	// Patterns select the coverage artifacts; empty uses
+	// artifacts.DefaultPatterns
+	Patterns []string
+	// MaxSize and SpoolThreshold configure downloads (see
+	// artifacts.Downloader)
+	MaxSize        int64
+	SpoolThreshold int64
+	// Budget, if set, is charged for artifacts downloaded to memory.
+	// Artifacts whose listed size doesn't fit are not downloaded; spooled
+	// artifacts aren't charged.
+	Budget *MemoryBudget
+}
+
+// FetchArtifacts implements ArtifactSource. It returns ErrArtifactsExpired
+// if the run has coverage artifacts but all of them have expired.
+func (s *GitHubArtifactSource) FetchArtifacts(ctx context.Context, req *queue.WorkRequest, run Run) ([]Artifact, error) {
+	listed, err := s.GitHub.ListRunArtifacts(ctx, req.Org, req.Repo, req.WorkflowRunID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list artifacts: %w", err)
+	}
+	selected, expired := artifacts.Select(listed, s.Patterns)
+	if len(selected) == 0 && expired > 0 {
+		return nil, fmt.Errorf("%w: %d coverage artifacts of run %d", ErrArtifactsExpired, expired, req.WorkflowRunID)
+	}
+
+	downloader := &artifacts.Downloader{API: s.GitHub, MaxSize: s.MaxSize, SpoolThreshold: s.SpoolThreshold}
+	var fetched []Artifact
+	for _, a := range selected {
+		what := "artifact " + a.Name
+		spooled := downloader.Spools(a)
+		if !spooled {
+			if err := s.Budget.Charge(what, a.SizeInBytes); err != nil {
+				closeArtifacts(fetched)
+				return nil, err
+			}
+		}
+		file, err := downloader.Download(ctx, req.Org, req.Repo, a)
+		if err != nil {
+			closeArtifacts(fetched)
+			return nil, fmt.Errorf("failed to download artifact %s: %w", a.Name, err)
+		}
+		if spooled {
+			fetched = append(fetched, Artifact{Name: a.Name, Archive: file})
+			continue
+		}
+		// The listed size is only checked upfront; charge what was downloaded
+		s.Budget.Release(a.SizeInBytes)
+		if err := s.Budget.Charge(what, file.Size); err != nil {
+			closeArtifacts(fetched)
+			return nil, err
+		}
+		fetched = append(fetched, Artifact{Name: a.Name, Data: file.Bytes()})
+	}
+	return fetched, nil
+}
+
+// closeArtifacts removes the spooled archives of artifacts.
+func closeArtifacts(fetched []Artifact) {
+	for _, a := range fetched {
+		a.Archive.Close()
+	}
+}
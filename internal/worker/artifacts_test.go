@@ -0,0 +1,210 @@
+package worker
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/queue"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubArtifactSource returns fixed artifacts and error.
+type stubArtifactSource struct {
+	artifacts []Artifact
+	err       error
+	calls     int
+}
+
+func (s *stubArtifactSource) FetchArtifacts(ctx context.Context, req *queue.WorkRequest, run Run) ([]Artifact, error) {
+	s.calls++
+	return s.artifacts, s.err
+}
+
+// memoryStorage is an in-memory storage.Storage.
+type memoryStorage struct {
+	data map[storage.CoverageKey][]byte
+	err  error
+}
+
+func (m *memoryStorage) SaveCoverage(ctx context.Context, key storage.CoverageKey, data []byte) error {
+	m.data[key] = data
+	return nil
+}
+
+func (m *memoryStorage) GetCoverage(ctx context.Context, key storage.CoverageKey) ([]byte, error) {
+	return m.data[key], m.err
+}
+
+func (m *memoryStorage) SaveCoverageReader(ctx context.Context, key storage.CoverageKey, reader io.Reader, size int64) error {
+	return errors.New("not implemented")
+}
+
+func (m *memoryStorage) Close() error { return nil }
+
+func TestFetchArtifacts(t *testing.T) {
+	fromRun := []Artifact{{Name: "coverage.zip", Data: []byte("run")}}
+	fromCopy := []Artifact{{Name: "coverage.out", Data: []byte("copy")}}
+	expired := fmt.Errorf("run 1: %w", ErrArtifactsExpired)
+
+	tests := []struct {
+		name              string
+		primary           *stubArtifactSource
+		fallback          *stubArtifactSource
+		expectedArtifacts []Artifact
+		expectedErr       error
+		expectFallback    bool
+	}{
+		{
+			name:              "run artifacts are used",
+			primary:           &stubArtifactSource{artifacts: fromRun},
+			fallback:          &stubArtifactSource{artifacts: fromCopy},
+			expectedArtifacts: fromRun,
+		},
+		{
+			name:              "expired artifacts fall back",
+			primary:           &stubArtifactSource{err: expired},
+			fallback:          &stubArtifactSource{artifacts: fromCopy},
+			expectedArtifacts: fromCopy,
+			expectFallback:    true,
+		},
+		{
+			name:              "missing artifacts fall back",
+			primary:           &stubArtifactSource{},
+			fallback:          &stubArtifactSource{artifacts: fromCopy},
+			expectedArtifacts: fromCopy,
+			expectFallback:    true,
+		},
+		{
+			name:           "expired everywhere",
+			primary:        &stubArtifactSource{err: expired},
+			fallback:       &stubArtifactSource{},
+			expectedErr:    ErrArtifactsExpired,
+			expectFallback: true,
+		},
+		{
+			name:        "other errors don't fall back",
+			primary:     &stubArtifactSource{err: errors.New("rate limited")},
+			fallback:    &stubArtifactSource{artifacts: fromCopy},
+			expectedErr: errors.New("rate limited"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &queue.WorkRequest{Org: "acme", Repo: "widgets", WorkflowRunID: 1}
+			artifacts, err := FetchArtifacts(context.Background(), req, Run{HeadSHA: "abc123"}, tt.primary, tt.fallback)
+
+			switch {
+			case errors.Is(tt.expectedErr, ErrArtifactsExpired):
+				assert.ErrorIs(t, err, ErrArtifactsExpired)
+			case tt.expectedErr != nil:
+				assert.EqualError(t, err, tt.expectedErr.Error())
+			default:
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tt.expectedArtifacts, artifacts)
+			assert.Equal(t, tt.expectFallback, tt.fallback.calls > 0)
+		})
+	}
+}
+
+func TestStorageArtifactSource(t *testing.T) {
+	req := &queue.WorkRequest{Org: "acme", Repo: "widgets", WorkflowRunID: 1}
+	store := &memoryStorage{data: map[storage.CoverageKey][]byte{
+		ArtifactCopyKey("acme", "widgets", "abc123"): []byte("mode: set\n"),
+	}}
+	source := &StorageArtifactSource{Storage: store}
+
+	artifacts, err := source.FetchArtifacts(context.Background(), req, Run{HeadSHA: "abc123"})
+	require.NoError(t, err)
+	assert.Equal(t, []Artifact{{Name: "coverage.out", Data: []byte("mode: set\n")}}, artifacts)
+	objectPath, err := storage.FormatObjectPath(ArtifactCopyKey("acme", "widgets", "abc123"))
+	require.NoError(t, err)
+	assert.Equal(t, "acme/widgets/artifacts/abc123/coverage.out", objectPath)
+
+	artifacts, err = source.FetchArtifacts(context.Background(), req, Run{HeadSHA: "def456"})
+	require.NoError(t, err)
+	assert.Empty(t, artifacts)
+
+	store.err = errors.New("bucket unavailable")
+	_, err = source.FetchArtifacts(context.Background(), req, Run{HeadSHA: "abc123"})
+	assert.ErrorContains(t, err, "bucket unavailable")
+}
+
+func TestGitHubArtifactSource_Budget(t *testing.T) {
+	gh := newFakeGitHub(t, "testdata/fixtures/pr")
+	var size int64
+	for _, a := range gh.in.Artifacts {
+		size += int64(len(a.Data))
+	}
+
+	t.Run("listed size over budget isn't downloaded", func(t *testing.T) {
+		gh.artifactSize, gh.downloads = 1<<30, 0
+		source := &GitHubArtifactSource{GitHub: gh, MaxSize: 2 << 30, SpoolThreshold: -1, Budget: &MemoryBudget{Limit: size}}
+		_, err := source.FetchArtifacts(context.Background(), gh.in.Request, gh.in.Run)
+		assert.ErrorIs(t, err, ErrMemoryBudgetExceeded)
+		assert.Zero(t, gh.downloads)
+	})
+
+	t.Run("downloaded size is charged", func(t *testing.T) {
+		gh.artifactSize, gh.downloads = 0, 0
+		budget := &MemoryBudget{Limit: size}
+		source := &GitHubArtifactSource{GitHub: gh, Budget: budget}
+		_, err := source.FetchArtifacts(context.Background(), gh.in.Request, gh.in.Run)
+		require.NoError(t, err)
+		assert.Equal(t, len(gh.in.Artifacts), gh.downloads)
+		assert.Zero(t, budget.Remaining())
+	})
+
+	t.Run("spooled artifacts aren't charged", func(t *testing.T) {
+		zipped := newFakeGitHub(t, "testdata/fixtures/pr")
+		zipped.artifactSize = 1 << 20
+		for i, a := range zipped.in.Artifacts {
+			zipped.in.Artifacts[i].Data = zipArchive(t, a.Name, a.Data)
+		}
+		budget := &MemoryBudget{Limit: size}
+		source := &GitHubArtifactSource{GitHub: zipped, SpoolThreshold: 1, Budget: budget}
+		artifacts, err := source.FetchArtifacts(context.Background(), zipped.in.Request, zipped.in.Run)
+		require.NoError(t, err)
+		require.Len(t, artifacts, len(zipped.in.Artifacts))
+		assert.Equal(t, size, budget.Remaining())
+
+		in := &Inputs{Artifacts: artifacts}
+		for _, a := range artifacts {
+			require.NotNil(t, a.Archive)
+			assert.True(t, a.Archive.Spooled())
+			assert.Nil(t, a.Data)
+		}
+		spooled, _, err := mergeArtifacts(artifacts, nil)
+		require.NoError(t, err)
+		want, _, err := mergeArtifacts(gh.in.Artifacts, nil)
+		require.NoError(t, err)
+		assert.Equal(t, want, spooled)
+
+		in.Close()
+		for _, a := range artifacts {
+			_, err := a.Archive.ReadAt(make([]byte, 1), 0)
+			assert.Error(t, err)
+		}
+	})
+}
+
+// zipArchive returns a zip archive holding data as name, as GitHub serves
+// artifacts.
+func zipArchive(t *testing.T, name string, data []byte) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create(name)
+	require.NoError(t, err)
+	_, err = w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
@@ -0,0 +1,123 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"runtime/metrics"
+	"sync"
+	"unsafe"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+)
+
+// ErrMemoryBudgetExceeded is returned when processing a work request would
+// hold more memory than its MemoryBudget allows, e.g. for pathologically
+// large coverage artifacts. Retrying can't succeed, so the request is
+// acknowledged after its PR is told why it wasn't analyzed.
+var ErrMemoryBudgetExceeded = errors.New("memory budget exceeded")
+
+// MemoryBudget accounts for the memory held while processing a single work
+// request: downloaded artifacts, decompressed coverage files, and parsed
+// profiles. The amounts are estimates of what the request keeps alive, not
+// measurements, so one oversized request fails on its own instead of
+// exhausting the memory shared with the worker's other requests.
+// A nil MemoryBudget, or one with a zero Limit, is unlimited.
+type MemoryBudget struct {
+	// Limit is the number of bytes a request may hold at once
+	Limit int64
+
+	mu   sync.Mutex
+	used int64
+	peak int64
+}
+
+// Charge accounts for n more bytes held for what. It returns
+// ErrMemoryBudgetExceeded (wrapped, naming what) and charges nothing if
+// they don't fit the budget.
+func (b *MemoryBudget) Charge(what string, n int64) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.Limit > 0 && b.used+n > b.Limit {
+		return fmt.Errorf("%w: %s needs %s, %s of %s left", ErrMemoryBudgetExceeded, what,
+			formatBytes(n), formatBytes(b.Limit-b.used), formatBytes(b.Limit))
+	}
+	b.used += n
+	b.peak = max(b.peak, b.used)
+	return nil
+}
+
+// Release returns n bytes charged earlier, once they are no longer held.
+func (b *MemoryBudget) Release(n int64) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used = max(b.used-n, 0)
+}
+
+// Remaining returns the number of bytes that can still be charged, or -1
+// if the budget is unlimited.
+func (b *MemoryBudget) Remaining() int64 {
+	if b == nil || b.Limit <= 0 {
+		return -1
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return max(b.Limit-b.used, 0)
+}
+
+// Peak returns the most bytes charged at once.
+func (b *MemoryBudget) Peak() int64 {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.peak
+}
+
+// formatBytes formats a byte count with a binary unit, e.g. "1.5 MiB".
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// profileBlockSize is the in-memory size of a coverage.ProfileBlock.
+const profileBlockSize = int64(unsafe.Sizeof(coverage.ProfileBlock{}))
+
+// profilesSize estimates the memory held by parsed profiles.
+func profilesSize(profiles []*coverage.Profile) int64 {
+	var n int64
+	for _, p := range profiles {
+		n += int64(unsafe.Sizeof(*p)) + int64(len(p.FileName)+len(p.Mode)) + int64(cap(p.Blocks))*profileBlockSize
+	}
+	return n
+}
+
+// heapAllocsMetric is the runtime metric of cumulative heap allocations.
+const heapAllocsMetric = "/gc/heap/allocs:bytes"
+
+// heapAllocs returns the bytes allocated on the heap since the process
+// started. The difference between two calls includes allocations of all
+// goroutines, so it only approximates a single request's when requests are
+// processed concurrently.
+func heapAllocs() int64 {
+	sample := []metrics.Sample{{Name: heapAllocsMetric}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return int64(sample[0].Value.Uint64())
+}
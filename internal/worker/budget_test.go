@@ -0,0 +1,68 @@
+package worker
+
+import (
+	"testing"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryBudget(t *testing.T) {
+	t.Run("charges up to the limit", func(t *testing.T) {
+		b := &MemoryBudget{Limit: 100}
+		require.NoError(t, b.Charge("artifact", 60))
+		assert.Equal(t, int64(40), b.Remaining())
+
+		err := b.Charge("coverage", 50)
+		assert.ErrorIs(t, err, ErrMemoryBudgetExceeded)
+		assert.EqualError(t, err, "memory budget exceeded: coverage needs 50 B, 40 B of 100 B left")
+		// A failed charge takes nothing
+		assert.Equal(t, int64(40), b.Remaining())
+
+		b.Release(60)
+		require.NoError(t, b.Charge("coverage", 50))
+		assert.Equal(t, int64(60), b.Peak())
+	})
+
+	t.Run("zero limit is unlimited", func(t *testing.T) {
+		b := &MemoryBudget{}
+		require.NoError(t, b.Charge("artifact", 1<<40))
+		assert.Equal(t, int64(-1), b.Remaining())
+		assert.Equal(t, int64(1<<40), b.Peak())
+	})
+
+	t.Run("nil budget is unlimited", func(t *testing.T) {
+		var b *MemoryBudget
+		require.NoError(t, b.Charge("artifact", 1<<40))
+		b.Release(1)
+		assert.Equal(t, int64(-1), b.Remaining())
+		assert.Zero(t, b.Peak())
+	})
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n        int64
+		expected string
+	}{
+		{n: 0, expected: "0 B"},
+		{n: 1023, expected: "1023 B"},
+		{n: 1536, expected: "1.5 KiB"},
+		{n: 512 << 20, expected: "512.0 MiB"},
+		{n: 3 << 30, expected: "3.0 GiB"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			assert.Equal(t, tt.expected, formatBytes(tt.n))
+		})
+	}
+}
+
+func TestProfilesSize(t *testing.T) {
+	small := []*coverage.Profile{{FileName: "a.go", Mode: "set", Blocks: make([]coverage.ProfileBlock, 1)}}
+	large := []*coverage.Profile{{FileName: "a.go", Mode: "set", Blocks: make([]coverage.ProfileBlock, 1000)}}
+	assert.Equal(t, 999*profileBlockSize, profilesSize(large)-profilesSize(small))
+	assert.Zero(t, profilesSize(nil))
+}
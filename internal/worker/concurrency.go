@@ -0,0 +1,125 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/queue"
+)
+
+// Concurrency controls how work requests are processed at once: up to
+// Limit requests run concurrently, but requests holding the same key (see
+// Lock) never do. The worker locks the org, repository, and branch of each
+// run, so two runs of a branch can't race to write its coverage.
+// A nil Concurrency processes one request at a time and never blocks in Lock.
+type Concurrency struct {
+	limit int
+
+	mu   sync.Mutex
+	keys map[string]*keyLock
+}
+
+// keyLock is the lock of a key, shared by the requests holding or waiting
+// for it.
+type keyLock struct {
+	// held has a token while the lock is held; sending blocks until it is free
+	held chan struct{}
+	// refs counts holders and waiters; the lock is dropped when it reaches zero
+	refs int
+}
+
+// NewConcurrency creates a Concurrency processing up to limit requests at
+// once; limits below 1 are treated as 1.
+func NewConcurrency(limit int) *Concurrency {
+	return &Concurrency{limit: max(limit, 1), keys: make(map[string]*keyLock)}
+}
+
+// Limit returns the number of requests processed at once.
+func (c *Concurrency) Limit() int {
+	if c == nil {
+		return 1
+	}
+	return c.limit
+}
+
+// Subscribe consumes mq until ctx is cancelled or a subscriber fails,
+// handling up to Limit requests at once. Queues that handle messages
+// concurrently themselves (queue.ConcurrentQueue) are subscribed once;
+// others once per request processed at once.
+func (c *Concurrency) Subscribe(ctx context.Context, mq queue.MessageQueue, handler func(context.Context, *queue.WorkRequest) error) error {
+	if cq, ok := mq.(queue.ConcurrentQueue); ok {
+		cq.SetConcurrency(c.Limit())
+		return mq.Subscribe(ctx, handler)
+	}
+	if c.Limit() == 1 {
+		return mq.Subscribe(ctx, handler)
+	}
+
+	// The first subscriber to stop stops the others
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errs := make(chan error, c.Limit())
+	for range c.Limit() {
+		go func() {
+			err := mq.Subscribe(ctx, handler)
+			cancel()
+			errs <- err
+		}()
+	}
+
+	// Report why the subscribers stopped rather than their cancellation
+	var stopErr error
+	for range c.Limit() {
+		if err := <-errs; err != nil && (stopErr == nil || errors.Is(stopErr, context.Canceled)) {
+			stopErr = err
+		}
+	}
+	return stopErr
+}
+
+// Lock waits until no other request holds key, then holds it until the
+// returned unlock function is called. It returns ctx's error if ctx is done
+// first.
+func (c *Concurrency) Lock(ctx context.Context, key string) (unlock func(), err error) {
+	if c == nil {
+		return func() {}, nil
+	}
+
+	c.mu.Lock()
+	l := c.keys[key]
+	if l == nil {
+		l = &keyLock{held: make(chan struct{}, 1)}
+		c.keys[key] = l
+	}
+	l.refs++
+	c.mu.Unlock()
+
+	select {
+	case l.held <- struct{}{}:
+		return sync.OnceFunc(func() {
+			<-l.held
+			c.release(key, l)
+		}), nil
+	case <-ctx.Done():
+		c.release(key, l)
+		return nil, ctx.Err()
+	}
+}
+
+// release drops a holder or waiter of a key's lock, forgetting the lock
+// once nobody needs it.
+func (c *Concurrency) release(key string, l *keyLock) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	l.refs--
+	if l.refs == 0 {
+		delete(c.keys, key)
+	}
+}
+
+// runKey returns the key a run is locked by: its org, repository, and head
+// branch.
+func runKey(req *queue.WorkRequest, run Run) string {
+	return req.Org + "/" + req.Repo + "/" + run.HeadBranch
+}
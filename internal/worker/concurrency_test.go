@@ -0,0 +1,149 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcurrency_Lock(t *testing.T) {
+	ctx := context.Background()
+	c := NewConcurrency(4)
+
+	unlock, err := c.Lock(ctx, "acme/widgets/main")
+	require.NoError(t, err)
+
+	t.Run("other keys don't wait", func(t *testing.T) {
+		unlockOther, err := c.Lock(ctx, "acme/widgets/feature")
+		require.NoError(t, err)
+		unlockOther()
+	})
+
+	t.Run("same key waits until unlocked", func(t *testing.T) {
+		waitCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		_, err := c.Lock(waitCtx, "acme/widgets/main")
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		locked := make(chan func())
+		go func() {
+			unlock, err := c.Lock(ctx, "acme/widgets/main")
+			assert.NoError(t, err)
+			locked <- unlock
+		}()
+		select {
+		case <-locked:
+			t.Fatal("lock was taken while held")
+		case <-time.After(20 * time.Millisecond):
+		}
+		unlock()
+		unlockNext := <-locked
+		unlockNext()
+		// Unlocking twice is harmless
+		unlockNext()
+	})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	assert.Empty(t, c.keys, "unused locks are forgotten")
+}
+
+func TestConcurrency_NilLocksNothing(t *testing.T) {
+	var c *Concurrency
+	unlock, err := c.Lock(context.Background(), "acme/widgets/main")
+	require.NoError(t, err)
+	unlock()
+	assert.Equal(t, 1, c.Limit())
+	assert.Equal(t, 1, NewConcurrency(0).Limit())
+}
+
+func TestConcurrency_Subscribe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mq := queue.NewInMemoryQueue(queue.InMemoryConfig{})
+	for i := int64(1); i <= 6; i++ {
+		require.NoError(t, mq.Publish(ctx, &queue.WorkRequest{Org: "acme", Repo: "widgets", WorkflowRunID: i}))
+	}
+
+	// Handlers wait until three requests are handled at once
+	var mu sync.Mutex
+	running, peak := 0, 0
+	var handled sync.WaitGroup
+	handled.Add(6)
+	release := make(chan struct{})
+	handler := func(ctx context.Context, req *queue.WorkRequest) error {
+		defer handled.Done()
+		mu.Lock()
+		running++
+		peak = max(peak, running)
+		mu.Unlock()
+		<-release
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil
+	}
+
+	c := NewConcurrency(3)
+	done := make(chan error, 1)
+	go func() { done <- c.Subscribe(ctx, mq, handler) }()
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return running == 3
+	}, 5*time.Second, time.Millisecond)
+	close(release)
+	handled.Wait()
+	assert.Equal(t, 3, peak)
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
+
+// concurrentQueue is a queue.ConcurrentQueue recording its subscriptions.
+type concurrentQueue struct {
+	queue.MessageQueue
+	concurrency   int
+	subscriptions atomic.Int32
+}
+
+func (q *concurrentQueue) SetConcurrency(n int) { q.concurrency = n }
+
+func (q *concurrentQueue) Subscribe(ctx context.Context, handler func(context.Context, *queue.WorkRequest) error) error {
+	q.subscriptions.Add(1)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestConcurrency_SubscribeConcurrentQueue(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	q := &concurrentQueue{}
+
+	err := NewConcurrency(8).Subscribe(ctx, q, nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 8, q.concurrency)
+	assert.Equal(t, int32(1), q.subscriptions.Load())
+}
+
+// failingQueue is a sequential queue whose subscriptions fail.
+type failingQueue struct {
+	queue.MessageQueue
+	err error
+}
+
+func (q *failingQueue) Subscribe(ctx context.Context, handler func(context.Context, *queue.WorkRequest) error) error {
+	return q.err
+}
+
+func TestConcurrency_SubscribeError(t *testing.T) {
+	err := NewConcurrency(3).Subscribe(context.Background(), &failingQueue{err: errors.New("connection refused")}, nil)
+	assert.EqualError(t, err, "connection refused")
+}
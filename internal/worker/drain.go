@@ -0,0 +1,79 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/queue"
+)
+
+// ErrDraining is returned (wrapped) for work requests handed to a worker
+// after it started draining. It wraps queue.ErrDeclined: the requests fail
+// unprocessed, so the queue delivers them again, to a worker that isn't
+// shutting down, without counting the delivery.
+var ErrDraining = fmt.Errorf("%w: worker is draining", queue.ErrDeclined)
+
+// SubscribeAndDrain consumes mq like Subscribe until ctx is cancelled, then
+// drains: no new requests are taken, and the requests being processed
+// finish with a context that ctx's cancellation doesn't reach. Requests
+// still running timeout after ctx is cancelled are cancelled, so they fail
+// and are left for the queue to deliver again. It returns once every
+// request has returned, so the queue and storage can then be closed.
+func (c *Concurrency) SubscribeAndDrain(ctx context.Context, mq queue.MessageQueue, timeout time.Duration, handler func(context.Context, *queue.WorkRequest) error) error {
+	jobs, cancelJobs := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelJobs()
+
+	var (
+		mu       sync.Mutex
+		draining bool
+		inFlight sync.WaitGroup
+	)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+			return
+		}
+		mu.Lock()
+		draining = true
+		mu.Unlock()
+
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			cancelJobs()
+		case <-done:
+		}
+	}()
+
+	err := c.Subscribe(ctx, mq, func(msgCtx context.Context, req *queue.WorkRequest) error {
+		mu.Lock()
+		if draining {
+			mu.Unlock()
+			return fmt.Errorf("%w: run %d of %s/%s not started", ErrDraining, req.WorkflowRunID, req.Org, req.Repo)
+		}
+		inFlight.Add(1)
+		mu.Unlock()
+		defer inFlight.Done()
+
+		// The request keeps the message's values, but is only cancelled
+		// once the drain times out
+		jobCtx, cancel := context.WithCancel(context.WithoutCancel(msgCtx))
+		defer cancel()
+		stop := context.AfterFunc(jobs, cancel)
+		defer stop()
+		return handler(jobCtx, req)
+	})
+
+	// Queues whose handlers outlive Subscribe are waited for too
+	mu.Lock()
+	draining = true
+	mu.Unlock()
+	inFlight.Wait()
+	return err
+}
@@ -0,0 +1,110 @@
+package worker
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcurrency_SubscribeAndDrain(t *testing.T) {
+	t.Run("in-flight requests finish after cancellation", func(t *testing.T) {
+		mq := queue.NewInMemoryQueue(queue.InMemoryConfig{})
+		require.NoError(t, mq.Publish(context.Background(), &queue.WorkRequest{WorkflowRunID: 1}))
+		require.NoError(t, mq.Publish(context.Background(), &queue.WorkRequest{WorkflowRunID: 2}))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		var handled atomic.Int64
+		var jobErr error
+		err := NewConcurrency(1).SubscribeAndDrain(ctx, mq, time.Minute, func(jobCtx context.Context, req *queue.WorkRequest) error {
+			// Shutdown starts while the first request is processed
+			cancel()
+			time.Sleep(10 * time.Millisecond)
+			jobErr = jobCtx.Err()
+			handled.Add(1)
+			return nil
+		})
+
+		require.ErrorIs(t, err, context.Canceled)
+		require.NoError(t, jobErr)
+		// The second request is left in the queue
+		assert.Equal(t, int64(1), handled.Load())
+		backlog, err := mq.Backlog(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), backlog.Undelivered)
+	})
+
+	t.Run("requests are cancelled after the timeout", func(t *testing.T) {
+		mq := queue.NewInMemoryQueue(queue.InMemoryConfig{})
+		require.NoError(t, mq.Publish(context.Background(), &queue.WorkRequest{WorkflowRunID: 1}))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		var jobErr error
+		err := NewConcurrency(1).SubscribeAndDrain(ctx, mq, 10*time.Millisecond, func(jobCtx context.Context, req *queue.WorkRequest) error {
+			cancel()
+			<-jobCtx.Done()
+			jobErr = jobCtx.Err()
+			return jobErr
+		})
+
+		require.ErrorIs(t, err, context.Canceled)
+		assert.ErrorIs(t, jobErr, context.Canceled)
+	})
+
+	t.Run("requests aren't started while draining", func(t *testing.T) {
+		mq := queue.NewInMemoryQueue(queue.InMemoryConfig{})
+		for id := int64(1); id <= 4; id++ {
+			require.NoError(t, mq.Publish(context.Background(), &queue.WorkRequest{WorkflowRunID: id}))
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		var handled atomic.Int64
+		err := NewConcurrency(2).SubscribeAndDrain(ctx, mq, time.Minute, func(jobCtx context.Context, req *queue.WorkRequest) error {
+			if handled.Add(1) == 2 {
+				cancel()
+			}
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		})
+
+		require.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, int64(2), handled.Load())
+		backlog, err := mq.Backlog(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), backlog.Undelivered)
+	})
+
+	t.Run("requests handed over while draining are declined", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		mq := &handOverQueue{MessageQueue: queue.NewInMemoryQueue(queue.InMemoryConfig{}), cancel: cancel}
+		err := NewConcurrency(1).SubscribeAndDrain(ctx, mq, time.Minute, func(context.Context, *queue.WorkRequest) error {
+			return nil
+		})
+
+		require.ErrorIs(t, err, context.Canceled)
+		assert.ErrorIs(t, mq.err, ErrDraining)
+		assert.ErrorIs(t, mq.err, queue.ErrDeclined, "the queue doesn't count the delivery")
+	})
+}
+
+// handOverQueue cancels the subscription, then hands a request to the
+// handler until it fails, like a queue that fetched it before shutdown.
+type handOverQueue struct {
+	queue.MessageQueue
+	cancel context.CancelFunc
+	err    error
+}
+
+func (q *handOverQueue) Subscribe(ctx context.Context, handler func(context.Context, *queue.WorkRequest) error) error {
+	q.cancel()
+	for {
+		if q.err = handler(ctx, &queue.WorkRequest{WorkflowRunID: 1}); q.err != nil {
+			return ctx.Err()
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,239 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/clock"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/gitlab"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/queue"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/repoconfig"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+)
+
+// DiscussionMarker is a hidden marker added to the inline discussions
+// started for uncovered lines, so re-runs don't start them again.
+const DiscussionMarker = "<!-- canopy-uncovered -->"
+
+// maxDiscussions bounds the inline discussions started per pipeline;
+// uncovered lines past it are only listed in the merge request note.
+const maxDiscussions = 20
+
+// GitLab is the subset of the GitLab API used by the worker.
+type GitLab interface {
+	GetProject(ctx context.Context, owner, repo string) (*gitlab.Project, error)
+	ListPipelineJobs(ctx context.Context, owner, repo string, pipelineID int64) ([]gitlab.Job, error)
+	DownloadJobArtifactsTo(ctx context.Context, owner, repo string, jobID int64, w io.Writer, limit int64) (int64, error)
+	GetFile(ctx context.Context, owner, repo, path, ref string) ([]byte, error)
+	GetMergeRequest(ctx context.Context, owner, repo string, iid int) (*gitlab.MergeRequest, error)
+	MergeRequestDiff(ctx context.Context, owner, repo string, iid int) ([]byte, error)
+	CompareDiff(ctx context.Context, owner, repo, base, head string) ([]byte, error)
+	MergeBase(ctx context.Context, owner, repo, base, head string) (string, error)
+	SetCommitStatus(ctx context.Context, owner, repo, sha string, status *gitlab.CommitStatus) error
+	ListMergeRequestNotes(ctx context.Context, owner, repo string, iid int) ([]gitlab.Note, error)
+	CreateMergeRequestNote(ctx context.Context, owner, repo string, iid int, body string) error
+	UpdateMergeRequestNote(ctx context.Context, owner, repo string, iid int, noteID int64, body string) error
+	ListMergeRequestDiscussions(ctx context.Context, owner, repo string, iid int) ([]gitlab.Discussion, error)
+	CreateMergeRequestDiscussion(ctx context.Context, owner, repo string, iid int, body string, position gitlab.Position) error
+}
+
+// GitLabProvider is the Provider of GitLab pipelines. The org and repo of
+// their requests are the project's namespace and path, the workflow run is
+// the pipeline, and the PR its merge request. The artifacts archives of the
+// pipeline's jobs are its run artifacts, named after their jobs, so
+// artifact patterns select coverage jobs.
+type GitLabProvider struct {
+	GitLab
+	Storage storage.Storage
+	// Clock is the time artifact expiry is checked against; nil uses the
+	// system clock
+	Clock clock.Clock
+}
+
+// FetchRun implements Provider. The pipeline's commit, branch, and merge
+// request were resolved by the webhook.
+func (p *GitLabProvider) FetchRun(ctx context.Context, req *queue.WorkRequest) (Run, error) {
+	project, err := p.GetProject(ctx, req.Org, req.Repo)
+	if err != nil {
+		return Run{}, fmt.Errorf("failed to get project: %w", err)
+	}
+	return Run{
+		HeadSHA:       req.HeadSHA,
+		HeadBranch:    req.HeadBranch,
+		DefaultBranch: project.DefaultBranch,
+		RepoURL:       project.WebURL,
+		PullRequest:   req.PullRequest,
+	}, nil
+}
+
+// ListRunArtifacts implements RunArtifacts with the artifacts archives of
+// a pipeline's jobs.
+func (p *GitLabProvider) ListRunArtifacts(ctx context.Context, owner, repo string, pipelineID int64) ([]github.RunArtifact, error) {
+	jobs, err := p.ListPipelineJobs(ctx, owner, repo, pipelineID)
+	if err != nil {
+		return nil, err
+	}
+	now := clock.Or(p.Clock).Now()
+	var listed []github.RunArtifact
+	for _, job := range jobs {
+		if job.ArtifactsFile == nil {
+			continue
+		}
+		listed = append(listed, github.RunArtifact{
+			ID:          job.ID,
+			Name:        job.Name,
+			Expired:     job.ArtifactsExpireAt != nil && job.ArtifactsExpireAt.Before(now),
+			SizeInBytes: job.ArtifactsFile.Size,
+		})
+	}
+	return listed, nil
+}
+
+// DownloadArtifactTo implements RunArtifacts; artifact IDs are job IDs.
+func (p *GitLabProvider) DownloadArtifactTo(ctx context.Context, owner, repo string, artifactID int64, w io.Writer, limit int64) (int64, error) {
+	return p.DownloadJobArtifactsTo(ctx, owner, repo, artifactID, w, limit)
+}
+
+// PullRequestDiff implements Provider with the merge request's diff.
+func (p *GitLabProvider) PullRequestDiff(ctx context.Context, owner, repo string, number int) ([]byte, error) {
+	return p.MergeRequestDiff(ctx, owner, repo, number)
+}
+
+// PullRequestHead implements Provider.
+func (p *GitLabProvider) PullRequestHead(ctx context.Context, owner, repo string, number int) (string, error) {
+	mr, err := p.GetMergeRequest(ctx, owner, repo, number)
+	if err != nil {
+		return "", err
+	}
+	return mr.SHA, nil
+}
+
+// Publisher implements Provider. GitLab requests aren't budgeted.
+func (p *GitLabProvider) Publisher(req *queue.WorkRequest, logger *slog.Logger, budget *APIBudget) Publisher {
+	return &GitLabPublisher{GitLab: p.GitLab, Storage: p.Storage, Org: req.Org, Repo: req.Repo, Logger: logger}
+}
+
+// GitLabPublisher is the Publisher of GitLab pipelines: coverage is saved
+// to storage, check runs become commit statuses and inline discussions on
+// the merge request's uncovered lines, and comments merge request notes.
+type GitLabPublisher struct {
+	GitLab  GitLab
+	Storage storage.Storage
+	Org     string
+	Repo    string
+	// Logger receives discussions that couldn't be started; nil uses
+	// slog.Default
+	Logger *slog.Logger
+}
+
+// SaveCoverage implements Publisher.
+func (p *GitLabPublisher) SaveCoverage(ctx context.Context, key storage.CoverageKey, data []byte) error {
+	return p.Storage.SaveCoverage(ctx, key, data)
+}
+
+// PublishCheckRun implements Publisher. The check run's title is the
+// commit status description; failing check runs fail the status, others
+// (including neutral ones, which GitLab has no state for) pass it.
+// For merge requests, annotations start inline discussions on their first
+// line, up to maxDiscussions, skipping lines a re-run already started one
+// on. Discussions that can't be started, e.g. because the merge request
+// moved on, are logged and skipped.
+func (p *GitLabPublisher) PublishCheckRun(ctx context.Context, req *queue.WorkRequest, run *CheckRun) error {
+	state := gitlab.StatusSuccess
+	switch {
+	case run.Status == StatusInProgress:
+		state = gitlab.StatusRunning
+	case run.Conclusion == ConclusionFailure:
+		state = gitlab.StatusFailed
+	}
+	if err := p.GitLab.SetCommitStatus(ctx, p.Org, p.Repo, run.HeadSHA, &gitlab.CommitStatus{
+		State:       state,
+		Name:        run.Name,
+		Description: run.Title,
+	}); err != nil {
+		return fmt.Errorf("failed to set commit status: %w", err)
+	}
+	if req.PullRequest == 0 || len(run.Annotations) == 0 {
+		return nil
+	}
+	return p.startDiscussions(ctx, req.PullRequest, run)
+}
+
+// startDiscussions starts the inline discussions of a check run's
+// annotations (see PublishCheckRun).
+func (p *GitLabPublisher) startDiscussions(ctx context.Context, iid int, run *CheckRun) error {
+	logger := p.logger()
+	mr, err := p.GitLab.GetMergeRequest(ctx, p.Org, p.Repo, iid)
+	if err != nil {
+		return fmt.Errorf("failed to get merge request: %w", err)
+	}
+	if mr.DiffRefs.HeadSHA != run.HeadSHA {
+		logger.Warn("skipping discussions of outdated commit", "merge_request", iid, "head_sha", mr.DiffRefs.HeadSHA)
+		return nil
+	}
+	discussions, err := p.GitLab.ListMergeRequestDiscussions(ctx, p.Org, p.Repo, iid)
+	if err != nil {
+		return fmt.Errorf("failed to list discussions: %w", err)
+	}
+	started := make(map[string]bool)
+	for _, d := range discussions {
+		if len(d.Notes) > 0 && d.Notes[0].Position != nil && strings.Contains(d.Notes[0].Body, DiscussionMarker) {
+			started[fmt.Sprintf("%s:%d", d.Notes[0].Position.NewPath, d.Notes[0].Position.NewLine)] = true
+		}
+	}
+
+	count, failed := 0, 0
+	for _, a := range run.Annotations {
+		if count == maxDiscussions {
+			break
+		}
+		if started[fmt.Sprintf("%s:%d", a.Path, a.StartLine)] {
+			continue
+		}
+		count++
+		body := fmt.Sprintf("%s\n**%s**\n\n%s", DiscussionMarker, a.Title, a.Message)
+		err := p.GitLab.CreateMergeRequestDiscussion(ctx, p.Org, p.Repo, iid, body, gitlab.Position{
+			BaseSHA:  mr.DiffRefs.BaseSHA,
+			StartSHA: mr.DiffRefs.StartSHA,
+			HeadSHA:  mr.DiffRefs.HeadSHA,
+			NewPath:  a.Path,
+			NewLine:  a.StartLine,
+		})
+		if err != nil {
+			failed++
+			logger.Warn("failed to start discussion", "path", a.Path, "line", a.StartLine, "error", err)
+		}
+	}
+	logger.Debug("started discussions", "started", count-failed, "failed", failed, "annotations", len(run.Annotations))
+	return nil
+}
+
+// PublishComment implements Publisher. With repoconfig.CommentUpdate, the
+// note carrying CommentMarker is edited if the merge request already has
+// one.
+func (p *GitLabPublisher) PublishComment(ctx context.Context, req *queue.WorkRequest, comment *Comment) error {
+	body := CommentMarker + "\n" + comment.Body
+	if comment.Behavior == repoconfig.CommentUpdate {
+		notes, err := p.GitLab.ListMergeRequestNotes(ctx, p.Org, p.Repo, comment.PullRequest)
+		if err != nil {
+			return fmt.Errorf("failed to list notes: %w", err)
+		}
+		for _, n := range notes {
+			if !n.System && strings.Contains(n.Body, CommentMarker) {
+				return p.GitLab.UpdateMergeRequestNote(ctx, p.Org, p.Repo, comment.PullRequest, n.ID, body)
+			}
+		}
+	}
+	return p.GitLab.CreateMergeRequestNote(ctx, p.Org, p.Repo, comment.PullRequest, body)
+}
+
+func (p *GitLabPublisher) logger() *slog.Logger {
+	if p.Logger == nil {
+		return slog.Default()
+	}
+	return p.Logger
+}
@@ -0,0 +1,201 @@
+package worker
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/gitlab"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/queue"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+)
+
+// fakeGitLab serves a recorded fixture as the GitLab API, with a job per
+// artifact whose archive holds it, and records what is published.
+type fakeGitLab struct {
+	in *Inputs
+	// mrHeadSHA is the merge request's head, if it moved on since the run
+	mrHeadSHA   string
+	notes       []gitlab.Note
+	discussions []gitlab.Discussion
+
+	statuses []gitlab.CommitStatus
+	started  []gitlab.Position
+	created  []string
+	updated  map[int64]string
+}
+
+func newFakeGitLab(t *testing.T, fixture string) *fakeGitLab {
+	t.Helper()
+	in, err := LoadFixture(fixture)
+	require.NoError(t, err)
+	return &fakeGitLab{in: in, updated: make(map[int64]string)}
+}
+
+func (f *fakeGitLab) GetProject(ctx context.Context, owner, repo string) (*gitlab.Project, error) {
+	return &gitlab.Project{PathWithNamespace: owner + "/" + repo, DefaultBranch: f.in.Run.DefaultBranch, WebURL: "https://gitlab.com/" + owner + "/" + repo}, nil
+}
+
+func (f *fakeGitLab) ListPipelineJobs(ctx context.Context, owner, repo string, pipelineID int64) ([]gitlab.Job, error) {
+	jobs := []gitlab.Job{{ID: 99, Name: "lint"}}
+	for i, a := range f.in.Artifacts {
+		job := gitlab.Job{ID: int64(i), Name: a.Name}
+		job.ArtifactsFile = &struct {
+			Filename string `json:"filename"`
+			Size     int64  `json:"size"`
+		}{Filename: "artifacts.zip", Size: int64(len(a.Data))}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+func (f *fakeGitLab) DownloadJobArtifactsTo(ctx context.Context, owner, repo string, jobID int64, w io.Writer, limit int64) (int64, error) {
+	if jobID == 99 {
+		return 0, fmt.Errorf("job without artifacts downloaded")
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	file, err := zw.Create("coverage.out")
+	if err != nil {
+		return 0, err
+	}
+	file.Write(f.in.Artifacts[jobID].Data)
+	if err := zw.Close(); err != nil {
+		return 0, err
+	}
+	return io.Copy(w, &buf)
+}
+
+func (f *fakeGitLab) GetFile(ctx context.Context, owner, repo, path, ref string) ([]byte, error) {
+	return nil, &gitlab.APIError{StatusCode: 404, Message: `{"message":"404 File Not Found"}`}
+}
+
+func (f *fakeGitLab) GetMergeRequest(ctx context.Context, owner, repo string, iid int) (*gitlab.MergeRequest, error) {
+	head := f.in.Run.HeadSHA
+	if f.mrHeadSHA != "" {
+		head = f.mrHeadSHA
+	}
+	return &gitlab.MergeRequest{IID: iid, SHA: head, DiffRefs: gitlab.DiffRefs{BaseSHA: "base", StartSHA: "start", HeadSHA: head}}, nil
+}
+
+func (f *fakeGitLab) MergeRequestDiff(ctx context.Context, owner, repo string, iid int) ([]byte, error) {
+	return f.in.Diff, nil
+}
+
+func (f *fakeGitLab) CompareDiff(ctx context.Context, owner, repo, base, head string) ([]byte, error) {
+	return nil, fmt.Errorf("unexpected compare")
+}
+
+func (f *fakeGitLab) MergeBase(ctx context.Context, owner, repo, base, head string) (string, error) {
+	return "", fmt.Errorf("unexpected merge base")
+}
+
+func (f *fakeGitLab) SetCommitStatus(ctx context.Context, owner, repo, sha string, status *gitlab.CommitStatus) error {
+	f.statuses = append(f.statuses, *status)
+	return nil
+}
+
+func (f *fakeGitLab) ListMergeRequestNotes(ctx context.Context, owner, repo string, iid int) ([]gitlab.Note, error) {
+	return f.notes, nil
+}
+
+func (f *fakeGitLab) CreateMergeRequestNote(ctx context.Context, owner, repo string, iid int, body string) error {
+	f.created = append(f.created, body)
+	return nil
+}
+
+func (f *fakeGitLab) UpdateMergeRequestNote(ctx context.Context, owner, repo string, iid int, noteID int64, body string) error {
+	f.updated[noteID] = body
+	return nil
+}
+
+func (f *fakeGitLab) ListMergeRequestDiscussions(ctx context.Context, owner, repo string, iid int) ([]gitlab.Discussion, error) {
+	return f.discussions, nil
+}
+
+func (f *fakeGitLab) CreateMergeRequestDiscussion(ctx context.Context, owner, repo string, iid int, body string, position gitlab.Position) error {
+	f.started = append(f.started, position)
+	return nil
+}
+
+// startedDiscussion returns a discussion Canopy started on a line.
+func startedDiscussion(path string, line int) gitlab.Discussion {
+	d := gitlab.Discussion{ID: "6a9c1750"}
+	d.Notes = append(d.Notes, struct {
+		Body     string           `json:"body"`
+		Position *gitlab.Position `json:"position"`
+	}{Body: DiscussionMarker + "\nUncovered", Position: &gitlab.Position{NewPath: path, NewLine: line}})
+	return d
+}
+
+func TestWorker_GitLabPipeline(t *testing.T) {
+	tests := []struct {
+		name        string
+		disabled    bool
+		mrHeadSHA   string
+		notes       []gitlab.Note
+		discussions []gitlab.Discussion
+		statuses    int
+		started     []gitlab.Position
+		created     int
+		updated     []int64
+	}{
+		{
+			name:     "merge request",
+			statuses: 1,
+			started:  []gitlab.Position{{BaseSHA: "base", StartSHA: "start", HeadSHA: "3f2a9c1e8b7d6a5f4e3d2c1b0a9f8e7d6c5b4a39", NewPath: "calc.go", NewLine: 7}},
+			created:  1,
+		},
+		{
+			name:        "re-run",
+			notes:       []gitlab.Note{{ID: 5, Body: "LGTM"}, {ID: 6, Body: CommentMarker + "\nold report"}},
+			discussions: []gitlab.Discussion{startedDiscussion("calc.go", 7)},
+			statuses:    1,
+			updated:     []int64{6},
+		},
+		{
+			name:      "merge request moved on",
+			mrHeadSHA: "9e8d7c6b5a4f3e2d1c0b9a8f7e6d5c4b3a291807",
+			statuses:  1,
+			created:   1,
+		},
+		{name: "GitLab not configured", disabled: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gl := newFakeGitLab(t, "testdata/fixtures/pr")
+			gl.mrHeadSHA, gl.notes, gl.discussions = tt.mrHeadSHA, tt.notes, tt.discussions
+			store := &memoryStorage{data: map[storage.CoverageKey][]byte{
+				{Org: "acme", Repo: "widgets", Branch: "main"}: gl.in.BaseCoverage,
+			}}
+			w := &Worker{GitHub: newFakeGitHub(t, "testdata/fixtures/pr"), GitLab: gl, Storage: store}
+			if tt.disabled {
+				w.GitLab = nil
+			}
+			req := &queue.WorkRequest{Org: "acme", Repo: "widgets", EventType: queue.EventGitLabPipeline, WorkflowRunID: 31,
+				PullRequest: gl.in.Run.PullRequest, HeadSHA: gl.in.Run.HeadSHA, HeadBranch: gl.in.Run.HeadBranch}
+
+			require.NoError(t, w.ProcessWorkRequest(context.Background(), req))
+			require.Len(t, gl.statuses, tt.statuses)
+			if tt.statuses > 0 {
+				assert.Equal(t, gitlab.CommitStatus{State: gitlab.StatusFailed, Name: CheckRunName, Description: "Coverage 80.00%"}, gl.statuses[0])
+			}
+			assert.Equal(t, tt.started, gl.started)
+			assert.Len(t, gl.created, tt.created)
+			for _, body := range gl.created {
+				assert.Contains(t, body, CommentMarker)
+			}
+			for _, id := range tt.updated {
+				assert.Contains(t, gl.updated[id], CommentMarker)
+			}
+			assert.Len(t, gl.updated, len(tt.updated))
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package worker
+
+import (
+	"time"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/metrics"
+)
+
+// Results of a work request, the result label of the job metrics.
+const (
+	jobProcessed  = "processed"
+	jobSkipped    = "skipped"
+	jobStale      = "stale"
+	jobOverBudget = "over_budget"
+	jobFailed     = "failed"
+	jobDuplicate  = "duplicate"
+)
+
+// Worker metrics, declared on metrics.Default.
+var (
+	jobsTotal = metrics.Default.NewCounter("canopy_worker_jobs_total",
+		"Work requests handled, by result.", "result")
+	analysisDuration = metrics.Default.NewHistogram("canopy_worker_analysis_duration_seconds",
+		"Time taken to handle a work request, by result.", metrics.DefaultBuckets, "result")
+)
+
+// observeJob records a work request handled with result in d.
+func observeJob(result string, d time.Duration) {
+	jobsTotal.Inc(result)
+	analysisDuration.Observe(d.Seconds(), result)
+}
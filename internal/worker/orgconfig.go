@@ -0,0 +1,85 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/clock"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/repoconfig"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+)
+
+// OrgConfigs reads the configs of orgs from storage (see
+// storage.OrgConfigPath) and caches them for TTL, so operators can change
+// an org's artifact patterns, thresholds, or annotation level without
+// redeploying. An org config has the shape of a repository config, which
+// applies over it (see repoconfig.ParseOver).
+type OrgConfigs struct {
+	Storage storage.ObjectReader
+	// TTL is how long a config, or its absence, is cached
+	TTL time.Duration
+	// Clock is the time cached configs expire against; nil uses the system
+	// clock
+	Clock  clock.Clock
+	Logger *slog.Logger
+
+	mu      sync.Mutex
+	entries map[string]orgConfigEntry
+}
+
+// orgConfigEntry is a cached org config; cfg is nil for orgs without one.
+type orgConfigEntry struct {
+	cfg     *repoconfig.Config
+	expires time.Time
+}
+
+// Get returns the config of an org, or nil if it has none. A nil
+// OrgConfigs has no configs. Invalid configs are logged and ignored, like
+// missing ones. If reading a config fails, the expired copy is returned if
+// there is one.
+func (c *OrgConfigs) Get(ctx context.Context, org string) (*repoconfig.Config, error) {
+	if c == nil {
+		return nil, nil
+	}
+	now := clock.Or(c.Clock).Now()
+	c.mu.Lock()
+	entry, cached := c.entries[org]
+	c.mu.Unlock()
+	if cached && now.Before(entry.expires) {
+		return entry.cfg, nil
+	}
+
+	path := storage.OrgConfigPath(org)
+	data, err := c.Storage.GetObject(ctx, path)
+	if err != nil {
+		if cached {
+			c.logger().Warn("failed to refresh org config", "org", org, "error", err)
+			return entry.cfg, nil
+		}
+		return nil, fmt.Errorf("failed to get org config %s: %w", path, err)
+	}
+	var cfg *repoconfig.Config
+	if data != nil {
+		if cfg, err = repoconfig.ParseOrg(data); err != nil {
+			c.logger().Warn("ignoring invalid org config", "org", org, "path", path, "error", err)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]orgConfigEntry)
+	}
+	c.entries[org] = orgConfigEntry{cfg: cfg, expires: now.Add(c.TTL)}
+	return cfg, nil
+}
+
+func (c *OrgConfigs) logger() *slog.Logger {
+	if c.Logger == nil {
+		return slog.Default()
+	}
+	return c.Logger
+}
@@ -0,0 +1,96 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/clock"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/repoconfig"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+)
+
+// objectStorage serves objects by path and counts reads.
+type objectStorage struct {
+	objects map[string][]byte
+	err     error
+	reads   int
+}
+
+func (s *objectStorage) GetObject(ctx context.Context, path string) ([]byte, error) {
+	s.reads++
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.objects[path], nil
+}
+
+func TestOrgConfigs_Get(t *testing.T) {
+	now := time.Date(2026, 1, 15, 10, 0, 0, 0, time.UTC)
+	store := &objectStorage{objects: map[string][]byte{
+		"config/orgs/acme.yml":   []byte("annotations: {level: warning}\n"),
+		"config/orgs/broken.yml": []byte("annotations: {level: loud}\n"),
+	}}
+	configs := &OrgConfigs{Storage: store, TTL: 5 * time.Minute, Clock: clock.Fixed(now)}
+	ctx := context.Background()
+
+	cfg, err := configs.Get(ctx, "acme")
+	require.NoError(t, err)
+	require.NotNil(t, cfg)
+	assert.Equal(t, repoconfig.LevelWarning, cfg.Annotations.Level)
+
+	// Cached until the TTL passes
+	store.objects["config/orgs/acme.yml"] = []byte("annotations: {level: failure}\n")
+	cfg, err = configs.Get(ctx, "acme")
+	require.NoError(t, err)
+	assert.Equal(t, repoconfig.LevelWarning, cfg.Annotations.Level)
+	assert.Equal(t, 1, store.reads)
+
+	configs.Clock = clock.Fixed(now.Add(5 * time.Minute))
+	cfg, err = configs.Get(ctx, "acme")
+	require.NoError(t, err)
+	assert.Equal(t, repoconfig.LevelFailure, cfg.Annotations.Level)
+
+	// A failed refresh keeps the expired config
+	store.err = errors.New("bucket unavailable")
+	configs.Clock = clock.Fixed(now.Add(10 * time.Minute))
+	cfg, err = configs.Get(ctx, "acme")
+	require.NoError(t, err)
+	assert.Equal(t, repoconfig.LevelFailure, cfg.Annotations.Level)
+	_, err = configs.Get(ctx, "other")
+	assert.ErrorContains(t, err, "failed to get org config config/orgs/other.yml")
+	store.err = nil
+
+	// Missing and invalid configs are none
+	cfg, err = configs.Get(ctx, "other")
+	require.NoError(t, err)
+	assert.Nil(t, cfg)
+	cfg, err = configs.Get(ctx, "broken")
+	require.NoError(t, err)
+	assert.Nil(t, cfg)
+
+	cfg, err = (*OrgConfigs)(nil).Get(ctx, "acme")
+	require.NoError(t, err)
+	assert.Nil(t, cfg)
+}
+
+func TestWorker_OrgConfig(t *testing.T) {
+	gh := newFakeGitHub(t, "testdata/fixtures/pr")
+	store := &memoryStorage{data: map[storage.CoverageKey][]byte{
+		{Org: "acme", Repo: "widgets", Branch: "main"}: gh.in.BaseCoverage,
+	}}
+	orgs := &objectStorage{objects: map[string][]byte{
+		"config/orgs/acme.yml": []byte("annotations: {level: warning}\ncomment: {behavior: \"off\"}\n"),
+	}}
+	w := &Worker{GitHub: gh, Storage: store, OrgConfigs: &OrgConfigs{Storage: orgs, TTL: time.Minute}}
+
+	require.NoError(t, w.ProcessWorkRequest(context.Background(), gh.in.Request))
+	require.Len(t, gh.checkRuns, 1)
+	require.Len(t, gh.checkRuns[0].Annotations, 1)
+	assert.Equal(t, repoconfig.LevelWarning, gh.checkRuns[0].Annotations[0].Level)
+	assert.Empty(t, gh.created)
+}
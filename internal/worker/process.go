@@ -0,0 +1,955 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/buildinfo"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/clock"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/format"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github/artifacts"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/policy"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/queue"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/repoconfig"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/tracing"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/trend"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/viewer"
+)
+
+// CheckRunName is the name of the check run Canopy publishes on PRs.
+const CheckRunName = "Canopy Coverage"
+
+// Check run conclusions set by the worker.
+const (
+	ConclusionSuccess = "success"
+	ConclusionFailure = "failure"
+	ConclusionNeutral = "neutral"
+	// ConclusionActionRequired reports a request that failed on its last
+	// delivery (see Worker.ProcessWorkRequest)
+	ConclusionActionRequired = "action_required"
+)
+
+// StatusInProgress is the status of a check run waiting for the coverage of
+// more workflows (see repoconfig.Config.Workflows); other check runs are
+// completed.
+const StatusInProgress = github.CheckRunInProgress
+
+var (
+	// ErrNoCoverage is returned when a workflow run has no coverage artifacts.
+	ErrNoCoverage = errors.New("no coverage files found in artifacts")
+
+	// ErrUnlistedWorkflow is returned for runs of workflows the repository
+	// config doesn't list, if it lists any.
+	ErrUnlistedWorkflow = errors.New("workflow not listed in the repository config")
+
+	// ErrReservedBranch is returned for branch runs of branches whose names
+	// start with the prefix of a pseudo-branch (see CheckBranch).
+	ErrReservedBranch = errors.New("branch name is reserved")
+)
+
+// Run describes the workflow run being processed, as resolved from the GitHub API.
+type Run struct {
+	HeadSHA       string `json:"head_sha"`
+	HeadBranch    string `json:"head_branch"`
+	DefaultBranch string `json:"default_branch"`
+	// PullRequest is the PR number, or 0 if the run is not for a PR
+	PullRequest int `json:"pull_request,omitzero"`
+	// RepoURL is the web URL of the repository (the workflow run's
+	// repository.html_url). Empty defaults to https://github.com/{org}/{repo}.
+	RepoURL string `json:"repo_url,omitzero"`
+	// CoverageSHA is the commit the run's coverage was generated at, if the
+	// PR was pushed to since and HeadSHA is the PR's head instead (see
+	// Inputs.CoverageDiff); empty if it is HeadSHA
+	CoverageSHA string `json:"coverage_sha,omitzero"`
+	// Workflow is the file name of the run's workflow, e.g. unit.yml
+	Workflow string `json:"workflow,omitzero"`
+	// BaseSHA is the merge base of a PR's head and the default branch,
+	// whose stored coverage the PR is compared with if there is any (see
+	// Worker.CommitBaselines); empty compares with the branch's latest
+	BaseSHA string `json:"base_sha,omitzero"`
+}
+
+// IsPullRequest returns true if the run should be analyzed against a PR diff.
+func (r Run) IsPullRequest() bool {
+	return r.PullRequest > 0 && r.HeadBranch != r.DefaultBranch
+}
+
+// coverageSHA returns the commit the run's coverage was generated at.
+func (r Run) coverageSHA() string {
+	if r.CoverageSHA != "" {
+		return r.CoverageSHA
+	}
+	return r.HeadSHA
+}
+
+// Artifact is a downloaded workflow artifact. Data is either a zip archive,
+// as served by the GitHub API, or a single coverage file.
+type Artifact struct {
+	Name string
+	Data []byte
+	// Archive, if set, is a zip archive spooled to a temporary file instead
+	// of Data; it is removed by Inputs.Close
+	Archive *artifacts.File
+}
+
+// Inputs holds everything fetched for a WorkRequest before it is analyzed.
+type Inputs struct {
+	Request   *queue.WorkRequest
+	Run       Run
+	Artifacts []Artifact
+	// BaseCoverage is the stored coverage of the default branch; nil if none was saved yet
+	BaseCoverage []byte
+	// BaseManifest is set if BaseCoverage holds only the shards of packages
+	// changed by the PR; its totals are those of the whole coverage
+	BaseManifest *coverage.ShardManifest
+	// PreviousCoverage is the stored coverage of the PR's last analyzed run
+	// (see PullRequestKey); nil on the first run
+	PreviousCoverage []byte
+	// Diff is the unified diff of the PR; unused for default branch runs
+	Diff []byte
+	// CoverageDiff is the unified diff from Run.CoverageSHA to the PR's
+	// head. If set, coverage line numbers are remapped through it before
+	// analysis, so coverage of an older commit isn't attributed to the
+	// lines that moved since (see coverage.LineMap).
+	CoverageDiff []byte
+	// RepoConfigPath and RepoConfig hold the repository config from the head
+	// commit; RepoConfig is nil if the repository has none
+	RepoConfigPath string
+	RepoConfig     []byte
+	// OrgConfig is the config of the request's org, which RepoConfig
+	// applies over (see repoconfig.ParseOver); nil if it has none
+	OrgConfig *repoconfig.Config
+	// GitAttributes is the root .gitattributes from the head commit; nil if
+	// absent. Files it marks linguist-generated are not analyzed.
+	GitAttributes []byte
+	// GoMod is the root go.mod from the head commit; nil if absent. Its
+	// replace directives map replaced modules to directories of the
+	// repository (see coverage.PathNormalizer).
+	GoMod []byte
+	// Sources are the changed Go files at the head commit by path, fetched
+	// if the repository config's annotation severity depends on the code
+	// uncovered lines are in (see repoconfig.SeverityConfig); lines of
+	// missing files get the annotation level
+	Sources map[string][]byte
+	// Version is the worker's Canopy version, shown with the config hash and
+	// ruleset in the check run footer; empty is reported as "dev"
+	Version string
+	// Clock is the time suppressions expire against for requests without a
+	// run completion time; nil uses the system clock
+	Clock clock.Clock
+	// Budget bounds the memory processing may hold, and is already charged
+	// for the fetched inputs; nil is unlimited
+	Budget *MemoryBudget
+	// ShardBaseline saves default branch coverage split by package as well
+	// (see coverage.ShardProfiles)
+	ShardBaseline bool
+	// DefaultThresholds, if set, apply to repositories whose config sets
+	// none; a conclusion set by the repository still applies
+	DefaultThresholds *repoconfig.ThresholdsConfig
+	// CheckRunDetails moves the full Markdown report from the check run's
+	// summary to its text, truncated to github.MaxOutputLength, leaving the
+	// summary with the files with the most uncovered lines
+	CheckRunDetails bool
+	// ExportFormats are the formats default branch coverage is converted to
+	// and saved in next to coverage.out, with paths relative to the
+	// repository root (see coverage.Export and storage.CoverageKey.Export)
+	ExportFormats []coverage.Format
+	// Trend is the stored coverage trend of the run's branch, to which the
+	// run's coverage is added; unused for PR runs
+	Trend []byte
+	// CoverageLabels label PRs by their patch coverage, if the Publisher is
+	// a LabelPublisher; empty labels none
+	CoverageLabels []github.LabelBand
+	// ViewerURL is the public base URL of the diff viewer; if set, the check
+	// run summary links to the PR's coverage overlaid on its diff, which
+	// isn't bound by the annotation limits (see viewer.CompareURL)
+	ViewerURL string
+	// WorkflowCoverage holds the coverage saved by runs of the other
+	// workflows the repository config lists for the run's commit, by
+	// workflow (see WorkflowKey); workflows that haven't completed yet are
+	// missing
+	WorkflowCoverage map[string][]byte
+}
+
+// Close removes the artifacts spooled to temporary files. It is safe to call
+// on nil Inputs.
+func (in *Inputs) Close() {
+	if in != nil {
+		closeArtifacts(in.Artifacts)
+	}
+}
+
+// CheckRun is the completed check run published for a PR.
+type CheckRun struct {
+	Name    string `json:"name"`
+	HeadSHA string `json:"head_sha"`
+	// Status is StatusInProgress while waiting for the coverage of more
+	// workflows; empty is completed
+	Status      string               `json:"status,omitempty"`
+	Conclusion  string               `json:"conclusion,omitempty"`
+	Title       string               `json:"title"`
+	Summary     string               `json:"summary"`
+	Text        string               `json:"text,omitempty"`
+	Annotations []*github.Annotation `json:"annotations"`
+}
+
+// Comment is the PR comment published after analysis.
+type Comment struct {
+	PullRequest int `json:"pull_request"`
+	// Behavior is repoconfig.CommentUpdate or repoconfig.CommentNew
+	Behavior string `json:"behavior"`
+	Body     string `json:"body"`
+}
+
+// Publisher receives the results of processing a WorkRequest.
+// The worker implements it with storage and the GitHub API; simulations
+// implement it with files.
+type Publisher interface {
+	// SaveCoverage stores merged coverage of a default branch run.
+	SaveCoverage(ctx context.Context, key storage.CoverageKey, data []byte) error
+
+	// PublishCheckRun creates or completes the check run for a PR run.
+	PublishCheckRun(ctx context.Context, req *queue.WorkRequest, run *CheckRun) error
+
+	// PublishComment posts or updates the coverage comment on a PR.
+	PublishComment(ctx context.Context, req *queue.WorkRequest, comment *Comment) error
+}
+
+// LabelPublisher is implemented by Publishers that can label PRs.
+type LabelPublisher interface {
+	// PublishLabels applies the labels of the bands patchCoverage falls in
+	// to a PR, and removes those of the other bands (see
+	// github.PlanLabelChanges).
+	PublishLabels(ctx context.Context, req *queue.WorkRequest, pullRequest int, bands []github.LabelBand, patchCoverage float64) error
+}
+
+// PullRequestKey returns the key the coverage of a PR's last analyzed run is
+// stored under: the pseudo-branch "pull/{number}".
+func PullRequestKey(org, repo string, number int) storage.CoverageKey {
+	return storage.CoverageKey{Org: org, Repo: repo, Branch: fmt.Sprintf("pull/%d", number)}
+}
+
+// WorkflowKey returns the key the coverage of a workflow's run of a commit
+// is stored under, to be merged with the coverage of the other workflows
+// the repository config lists: the pseudo-branch "workflows/{sha}/{workflow}".
+func WorkflowKey(org, repo, sha, workflow string) storage.CoverageKey {
+	return storage.CoverageKey{Org: org, Repo: repo, Branch: fmt.Sprintf("workflows/%s/%s", sha, workflow)}
+}
+
+// reservedBranchPrefixes are the prefixes of the pseudo-branches other
+// coverage is stored under: PullRequestKey, WorkflowKey, AnalysisKey, and
+// ArtifactCopyKey.
+var reservedBranchPrefixes = []string{"pull/", "workflows/", "runs/", "artifacts/"}
+
+// CheckBranch returns ErrReservedBranch (wrapped) if saving the coverage of
+// branch would overwrite a pseudo-branch, e.g. a branch named "pull/1" that
+// of PR #1.
+func CheckBranch(branch string) error {
+	for _, prefix := range reservedBranchPrefixes {
+		if strings.HasPrefix(branch, prefix) {
+			return fmt.Errorf("%w: %q starts with %q", ErrReservedBranch, branch, prefix)
+		}
+	}
+	return nil
+}
+
+// checkWorkflow returns ErrUnlistedWorkflow (wrapped) if the repository
+// config lists workflows to merge and the run's isn't one of them.
+func checkWorkflow(cfg *repoconfig.Config, run Run) error {
+	if len(cfg.Workflows) > 0 && !slices.Contains(cfg.Workflows, run.Workflow) {
+		return fmt.Errorf("%w: %q", ErrUnlistedWorkflow, run.Workflow)
+	}
+	return nil
+}
+
+// Process analyzes the coverage of a workflow run and publishes the results.
+// Default branch runs save their merged coverage, for the branch and for the
+// head commit; PR runs publish a check run with annotations for uncovered
+// added lines, failing it if the PR doesn't meet the repository's thresholds
+// (or DefaultThresholds), and, unless disabled by the repository config, a PR comment comparing
+// coverage with the base branch. With CoverageLabels, PRs are labeled by
+// their patch coverage.
+// PR runs also save their coverage under PullRequestKey, so the next run of
+// the PR can report what changed since this one.
+//
+// If the repository config lists workflows, the run's coverage is saved
+// under WorkflowKey and merged with Inputs.WorkflowCoverage. Until every
+// listed workflow has coverage, default branch coverage isn't saved, and PR
+// runs publish an in-progress check run without thresholds or a comment.
+func Process(ctx context.Context, in *Inputs, pub Publisher) error {
+	cfg, issues := repoconfig.ParseOver(in.RepoConfig, in.OrgConfig)
+	if err := checkWorkflow(cfg, in.Run); err != nil {
+		return err
+	}
+	if !in.Run.IsPullRequest() {
+		if err := CheckBranch(in.Run.HeadBranch); err != nil {
+			return err
+		}
+	}
+
+	_, merge := tracing.Start(ctx, "coverage.merge", trace.WithAttributes(attribute.Int("canopy.artifacts", len(in.Artifacts))))
+	profiles, skipped, err := mergeArtifacts(in.Artifacts, in.Budget)
+	tracing.End(merge, err)
+	if err != nil {
+		return err
+	}
+	normalizer := coverage.NewPathNormalizer(in.GoMod)
+	if profiles, err = normalizer.NormalizeProfiles(profiles); err != nil {
+		return fmt.Errorf("failed to normalize coverage paths: %w", err)
+	}
+	var pending []string
+	if len(cfg.Workflows) > 0 {
+		if profiles, pending, err = mergeWorkflows(ctx, in, cfg.Workflows, normalizer, profiles, pub); err != nil {
+			return err
+		}
+	}
+	remapped, dropped := false, 0
+	if in.CoverageDiff != nil && in.Run.IsPullRequest() {
+		lineMap, err := coverage.ParseLineMap(in.CoverageDiff)
+		if err != nil {
+			return fmt.Errorf("failed to parse coverage diff: %w", err)
+		}
+		profiles, dropped = lineMap.RemapProfiles(profiles)
+		remapped = true
+	}
+
+	// Suppressions expire relative to the run, so replays are deterministic
+	now := in.Request.RunCompletedAt
+	if now.IsZero() {
+		now = clock.Or(in.Clock).Now()
+	}
+
+	if !in.Run.IsPullRequest() {
+		if len(pending) > 0 {
+			// The branch keeps the coverage of the last complete commit
+			return nil
+		}
+		key := storage.CoverageKey{Org: in.Request.Org, Repo: in.Request.Repo, Branch: in.Run.HeadBranch}
+		if err := saveCoverage(ctx, pub, key, profiles); err != nil {
+			return err
+		}
+		if in.ShardBaseline {
+			if err := saveShards(ctx, pub, key, profiles); err != nil {
+				return err
+			}
+		}
+		// With storage.CommitLayout the commit's copy is kept as history (see
+		// canopy-admin suggest-thresholds); other layouts map both keys to
+		// the same object
+		key.Commit = in.Run.HeadSHA
+		if err := saveCoverage(ctx, pub, key, profiles); err != nil {
+			return err
+		}
+		if err := saveExports(ctx, in, pub, key, profiles); err != nil {
+			return err
+		}
+		if err := saveTrend(ctx, in, pub, key, profiles, now); err != nil {
+			return err
+		}
+		return saveLatest(ctx, pub, key, now)
+	}
+
+	_, analyze := tracing.Start(ctx, "coverage.analyze")
+	fileDiffs, err := coverage.ParseDiff(in.Diff)
+	if err != nil {
+		tracing.End(analyze, err)
+		return fmt.Errorf("failed to parse PR diff: %w", err)
+	}
+	// Sources aren't checked out, so generated files are detected from
+	// .gitattributes and file names only
+	generated := coverage.NewGeneratedFileFilter(in.GitAttributes, nil)
+	addedLinesByFile := coverage.FilterAddedLines(coverage.GetAddedLinesByFile(fileDiffs), generated, coverage.IncludeFilter(cfg.Include), coverage.PatternFilter(cfg.Ignore))
+	result := coverage.AnalyzeCoverage(profiles, addedLinesByFile)
+	maxAge := time.Duration(cfg.Suppressions.MaxAgeDays) * 24 * time.Hour
+	suppressions := coverage.ParseSuppressions(in.Diff)
+	coverage.ApplySuppressions(result, suppressions, now, maxAge)
+	tracing.End(analyze, nil)
+
+	var base *coverage.CoverageStats
+	if len(in.BaseCoverage) > 0 {
+		baseProfiles, err := coverage.ParseProfiles(in.BaseCoverage)
+		if err != nil {
+			return fmt.Errorf("failed to parse base coverage: %w", err)
+		}
+		if baseProfiles, err = normalizer.NormalizeProfiles(baseProfiles); err != nil {
+			return fmt.Errorf("failed to normalize base coverage paths: %w", err)
+		}
+		if err := in.Budget.Charge("base coverage", profilesSize(baseProfiles)); err != nil {
+			return err
+		}
+		base = coverage.CalculateCoverageStats(baseProfiles)
+		if in.BaseManifest != nil {
+			base = in.BaseManifest.Stats(baseProfiles)
+		}
+	} else if in.BaseManifest != nil {
+		// The PR changes no package with base coverage
+		base = in.BaseManifest.Stats(nil)
+	}
+	head := coverage.CalculateCoverageStats(profiles)
+	comparison := coverage.CompareCoverage(base, head)
+	renames := coverage.GetRenamedFiles(fileDiffs)
+	changed := changedFiles(addedLinesByFile, renames)
+	fileDeltas := coverage.CompareFiles(base, head, changed, renames)
+	packageDeltas := coverage.ComparePackages(base, head, changed)
+
+	links, err := fileLinker(in)
+	if err != nil {
+		return err
+	}
+
+	var sinceLastRun string
+	if len(in.PreviousCoverage) > 0 && len(pending) == 0 {
+		previousProfiles, err := coverage.ParseProfiles(in.PreviousCoverage)
+		if err != nil {
+			return fmt.Errorf("failed to parse previous coverage: %w", err)
+		}
+		if previousProfiles, err = normalizer.NormalizeProfiles(previousProfiles); err != nil {
+			return fmt.Errorf("failed to normalize previous coverage paths: %w", err)
+		}
+		if err := in.Budget.Charge("previous coverage", profilesSize(previousProfiles)); err != nil {
+			return err
+		}
+		// The previous run is analyzed against the current diff, so lines
+		// are compared by their current numbers
+		previous := coverage.AnalyzeCoverage(previousProfiles, addedLinesByFile)
+		coverage.ApplySuppressions(previous, suppressions, now, maxAge)
+		project := coverage.CompareCoverage(coverage.CalculateCoverageStats(previousProfiles), head)
+		sinceLastRun, err = formatSinceLastRun(previous, result, project, links)
+		if err != nil {
+			return err
+		}
+	}
+
+	thresholds := cfg.Thresholds
+	if thresholds.IsZero() && in.DefaultThresholds != nil {
+		thresholds = *in.DefaultThresholds
+		if cfg.Thresholds.Conclusion != "" {
+			thresholds.Conclusion = cfg.Thresholds.Conclusion
+		}
+	}
+	policyInput := &policy.Input{
+		Result:       result,
+		LineCoverage: coverage.LineCoverageByFile(profiles, addedLinesByFile),
+		Head:         head,
+	}
+	if base != nil {
+		policyInput.Comparison = comparison
+	}
+	var unmet []string
+	if len(pending) == 0 {
+		unmet = policy.Evaluate(thresholds, policyInput)
+	}
+
+	var fileCoverage map[string]float64
+	if cfg.Annotations.Severity.LowCoverage > 0 {
+		fileCoverage = coverage.DiffCoverageByFile(profiles, addedLinesByFile)
+	}
+	checkRun, err := buildCheckRun(in, cfg, result, fileCoverage, base != nil, comparison, links, sinceLastRun, unmet, thresholds.FailureConclusion())
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		checkRun.Status, checkRun.Conclusion = StatusInProgress, ""
+		checkRun.Title = "Waiting for " + strings.Join(pending, ", ")
+		checkRun.Summary = formatPendingNote(cfg.Workflows, pending) + "\n" + checkRun.Summary
+	}
+	if remapped {
+		checkRun.Summary = formatRemapNote(in.Run.CoverageSHA, dropped) + "\n" + checkRun.Summary
+	}
+	if len(skipped) > 0 {
+		checkRun.Summary = formatSkippedNote(skipped) + "\n" + checkRun.Summary
+	}
+	if len(issues) > 0 {
+		checkRun.Summary = repoconfig.FormatWarning(in.RepoConfigPath, issues) + "\n" + checkRun.Summary
+	}
+	if err := pub.PublishCheckRun(ctx, in.Request, checkRun); err != nil {
+		return fmt.Errorf("failed to publish check run: %w", err)
+	}
+	if len(pending) > 0 {
+		// The comment and the PR's coverage wait for the complete analysis
+		return nil
+	}
+
+	if cfg.Comment.Behavior != repoconfig.CommentOff {
+		body, err := formatComment(result, base != nil, comparison, packageDeltas, fileDeltas, links, sinceLastRun)
+		if err != nil {
+			return err
+		}
+		comment := &Comment{
+			PullRequest: in.Run.PullRequest,
+			Behavior:    cfg.Comment.Behavior,
+			Body:        body,
+		}
+		if err := pub.PublishComment(ctx, in.Request, comment); err != nil {
+			return fmt.Errorf("failed to publish comment: %w", err)
+		}
+	}
+	if labels, ok := pub.(LabelPublisher); ok && len(in.CoverageLabels) > 0 {
+		if err := labels.PublishLabels(ctx, in.Request, in.Run.PullRequest, in.CoverageLabels, result.PatchCoverage()); err != nil {
+			return fmt.Errorf("failed to publish labels: %w", err)
+		}
+	}
+
+	if err := saveAnalysis(ctx, in, pub, checkRun, result, head, comparison, base != nil, now); err != nil {
+		return err
+	}
+	// Saved last, so a retry after a failed publish still compares with the
+	// previous run rather than with itself
+	return saveCoverage(ctx, pub, PullRequestKey(in.Request.Org, in.Request.Repo, in.Run.PullRequest), profiles)
+}
+
+// saveCoverage serializes merged profiles and saves them under key.
+func saveCoverage(ctx context.Context, pub Publisher, key storage.CoverageKey, profiles []*coverage.Profile) error {
+	data, err := coverage.SerializeProfiles(profiles)
+	if err != nil {
+		return fmt.Errorf("failed to serialize coverage: %w", err)
+	}
+	if err := pub.SaveCoverage(ctx, key, data); err != nil {
+		return fmt.Errorf("failed to save coverage: %w", err)
+	}
+	return nil
+}
+
+// saveTrend adds the coverage of key's commit at now to the trend of key's
+// branch.
+func saveTrend(ctx context.Context, in *Inputs, pub Publisher, key storage.CoverageKey, profiles []*coverage.Profile, now time.Time) error {
+	series, err := trend.Parse(in.Trend)
+	if err != nil {
+		return err
+	}
+	series.Add(trend.NewPoint(key.Commit, now, coverage.CalculateCoverageStats(profiles)), trend.DefaultMaxPoints)
+	data, err := series.Marshal()
+	if err != nil {
+		return err
+	}
+	if err := pub.SaveCoverage(ctx, trend.Key(key.Org, key.Repo, key.Branch), data); err != nil {
+		return fmt.Errorf("failed to save coverage trend: %w", err)
+	}
+	return nil
+}
+
+// saveLatest points the latest pointer of key's branch at key's commit. It
+// is saved last, so it never names a commit whose coverage isn't written.
+func saveLatest(ctx context.Context, pub Publisher, key storage.CoverageKey, updated time.Time) error {
+	data, err := storage.MarshalLatestPointer(storage.LatestPointer{Commit: key.Commit, Updated: updated})
+	if err != nil {
+		return err
+	}
+	if err := pub.SaveCoverage(ctx, storage.LatestKey(key), data); err != nil {
+		return fmt.Errorf("failed to save latest pointer: %w", err)
+	}
+	return nil
+}
+
+// saveExports converts default branch profiles to each of the export
+// formats and saves them next to the coverage of key and of its branch.
+func saveExports(ctx context.Context, in *Inputs, pub Publisher, key storage.CoverageKey, profiles []*coverage.Profile) error {
+	if len(in.ExportFormats) == 0 {
+		return nil
+	}
+	profiles = coverage.TrimModule(profiles, coverage.ModulePath(in.GoMod))
+	// Exports record the run's time, so replays are deterministic
+	generated := in.Request.RunCompletedAt
+	if generated.IsZero() {
+		generated = clock.Or(in.Clock).Now()
+	}
+	branchKey := key
+	branchKey.Commit = ""
+	for _, format := range in.ExportFormats {
+		data, err := coverage.Export(profiles, format, generated)
+		if err != nil {
+			return fmt.Errorf("failed to export coverage as %s: %w", format, err)
+		}
+		for _, k := range []storage.CoverageKey{branchKey, key} {
+			k.Export = coverage.ExportName(format)
+			if err := pub.SaveCoverage(ctx, k, data); err != nil {
+				return fmt.Errorf("failed to save %s export: %w", format, err)
+			}
+		}
+	}
+	return nil
+}
+
+// fileLinker links files and lines to the head commit of the run.
+func fileLinker(in *Inputs) (*format.FileLinker, error) {
+	repoURL := in.Run.RepoURL
+	if repoURL == "" {
+		repoURL = fmt.Sprintf("https://github.com/%s/%s", in.Request.Org, in.Request.Repo)
+	}
+	links, err := format.NewFileLinker(repoURL, in.Run.HeadSHA)
+	if err != nil {
+		return nil, fmt.Errorf("failed to link files: %w", err)
+	}
+	return links, nil
+}
+
+// formatSinceLastRun renders the "Since last run" section comparing the
+// analysis of the previous run of a PR with the current one.
+func formatSinceLastRun(previous, current *coverage.AnalysisResult, project *coverage.CoverageComparison, links *format.FileLinker) (string, error) {
+	var b strings.Builder
+	fmt.Fprintln(&b, "### Since last run")
+	fmt.Fprintln(&b)
+	fmt.Fprintf(&b, "Project coverage %.2f%% → %.2f%% (%+.2f%%)\n\n", project.BaseCoverage, project.HeadCoverage, project.Delta)
+	diff := format.CompareReports(format.NewJSONReport(previous), format.NewJSONReport(current))
+	if err := format.FormatReportDiffMarkdown(diff, &b, links); err != nil {
+		return "", fmt.Errorf("failed to format changes since last run: %w", err)
+	}
+	return b.String(), nil
+}
+
+// mergeWorkflows saves the coverage of the run's workflow under WorkflowKey
+// and merges it with the coverage saved by the other listed workflows'
+// runs of the commit. It returns the merged profiles and the listed
+// workflows still without coverage, in the listed order.
+func mergeWorkflows(ctx context.Context, in *Inputs, workflows []string, normalizer *coverage.PathNormalizer, profiles []*coverage.Profile, pub Publisher) ([]*coverage.Profile, []string, error) {
+	key := WorkflowKey(in.Request.Org, in.Request.Repo, in.Run.coverageSHA(), in.Run.Workflow)
+	if err := saveCoverage(ctx, pub, key, profiles); err != nil {
+		return nil, nil, err
+	}
+
+	all := profiles
+	var pending []string
+	for _, workflow := range workflows {
+		if workflow == in.Run.Workflow {
+			continue
+		}
+		data, ok := in.WorkflowCoverage[workflow]
+		if !ok {
+			pending = append(pending, workflow)
+			continue
+		}
+		others, err := coverage.ParseProfiles(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse coverage of workflow %s: %w", workflow, err)
+		}
+		if others, err = normalizer.NormalizeProfiles(others); err != nil {
+			return nil, nil, fmt.Errorf("failed to normalize coverage paths of workflow %s: %w", workflow, err)
+		}
+		if err := in.Budget.Charge("coverage of workflow "+workflow, profilesSize(others)); err != nil {
+			return nil, nil, err
+		}
+		all = append(all, others...)
+	}
+	if len(all) == len(profiles) {
+		return profiles, pending, nil
+	}
+
+	merged, err := coverage.MergeProfiles(all)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to merge coverage of workflows: %w", err)
+	}
+	if err := in.Budget.Charge("merged coverage of workflows", profilesSize(merged)); err != nil {
+		return nil, nil, err
+	}
+	return merged, pending, nil
+}
+
+// formatPendingNote says which of the listed workflows the coverage of an
+// in-progress check run comes from.
+func formatPendingNote(workflows, pending []string) string {
+	var completed []string
+	for _, w := range workflows {
+		if !slices.Contains(pending, w) {
+			completed = append(completed, w)
+		}
+	}
+	return fmt.Sprintf("_Coverage of %s only, waiting for %s; thresholds are checked once every workflow has completed._\n",
+		formatWorkflows(completed), formatWorkflows(pending))
+}
+
+// formatWorkflows formats workflow names as a list of code spans.
+func formatWorkflows(workflows []string) string {
+	quoted := make([]string, len(workflows))
+	for i, w := range workflows {
+		quoted[i] = "`" + w + "`"
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// mergeArtifacts parses the coverage files of all artifacts, in name order,
+// and merges them into a single set of profiles with a coverage.Merger. The
+// blocks each artifact adds to the merge, and the merged profiles, are
+// charged to budget; files decompressed from zip archives must fit what
+// remains of it. Files of archives that couldn't be parsed are skipped and
+// returned, named {artifact}/{file}.
+func mergeArtifacts(artifacts []Artifact, budget *MemoryBudget) ([]*coverage.Profile, []coverage.SkippedFile, error) {
+	sorted := make([]Artifact, len(artifacts))
+	copy(sorted, artifacts)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	// Artifacts are merged as they are parsed, and Go text profiles line by
+	// line, so only the distinct blocks of the merge stay in memory
+	merger := coverage.NewMerger()
+	var skipped []coverage.SkippedFile
+	for _, a := range sorted {
+		before := merger.Size()
+		var err error
+		if a.Archive != nil || bytes.HasPrefix(a.Data, []byte("PK\x03\x04")) {
+			var profiles []*coverage.Profile
+			var archiveSkipped []coverage.SkippedFile
+			if a.Archive != nil {
+				profiles, archiveSkipped, err = a.Archive.Profiles(budget.Remaining())
+			} else {
+				profiles, archiveSkipped, err = coverage.ParseProfilesFromZipLimit(a.Data, budget.Remaining())
+			}
+			if errors.Is(err, coverage.ErrSizeLimit) {
+				return nil, nil, fmt.Errorf("%w: artifact %s: %w", ErrMemoryBudgetExceeded, a.Name, err)
+			}
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to parse artifact %s: %w", a.Name, err)
+			}
+			if err := merger.Add(profiles...); err != nil {
+				return nil, nil, fmt.Errorf("failed to merge coverage profiles: %w", err)
+			}
+			for _, s := range archiveSkipped {
+				skipped = append(skipped, coverage.SkippedFile{Name: a.Name + "/" + s.Name, Err: s.Err})
+			}
+		} else if err = merger.AddFrom(bytes.NewReader(a.Data), coverage.FormatAuto); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse artifact %s: %w", a.Name, err)
+		}
+		if err := budget.Charge("coverage of artifact "+a.Name, merger.Size()-before); err != nil {
+			return nil, nil, err
+		}
+	}
+	merged, err := merger.Profiles()
+	if err != nil {
+		// Only an empty merge has no profiles
+		return nil, nil, ErrNoCoverage
+	}
+	if err := budget.Charge("merged coverage", profilesSize(merged)); err != nil {
+		return nil, nil, err
+	}
+	// The merger's blocks are garbage once the profiles are built
+	budget.Release(merger.Size())
+	return merged, skipped, nil
+}
+
+// buildCheckRun builds the check run for a PR. If the PR doesn't meet the
+// thresholds described by unmet (see policy.Evaluate), the check concludes
+// with failureConclusion.
+// sinceLastRun, if not empty, is inserted before the uncovered lines.
+// Annotation levels follow the repository config's severity, with
+// fileCoverage holding the patch coverage of each file for its low
+// coverage threshold (see coverage.ApplySeverityPolicy).
+func buildCheckRun(in *Inputs, cfg *repoconfig.Config, result *coverage.AnalysisResult, fileCoverage map[string]float64, hasBase bool, comparison *coverage.CoverageComparison, links *format.FileLinker, sinceLastRun string, unmet []string, failureConclusion string) (*CheckRun, error) {
+	uncovered := result.DiffAddedLines - result.DiffAddedCovered
+	summaryOnly := cfg.Annotations.UseSummaryOnly(uncovered)
+
+	var annotations []*github.Annotation
+	if !summaryOnly {
+		policy := coverage.SeverityPolicy{
+			Default:              cfg.Annotations.Level,
+			ExportedFunc:         cfg.Annotations.Severity.Exported,
+			ErrorHandling:        cfg.Annotations.Severity.ErrorHandling,
+			LowCoverageThreshold: cfg.Annotations.Severity.LowCoverage,
+		}
+		var classifier coverage.LineClassifier
+		if len(in.Sources) > 0 {
+			classifier = coverage.NewGoContentClassifier(in.Sources)
+		}
+		annotations = coverage.ApplySeverityPolicy(coverage.GenerateAnnotations(result), policy, classifier, fileCoverage)
+	}
+
+	var formatter format.Formatter = &format.MarkdownFormatter{Links: links}
+	if summaryOnly || in.CheckRunDetails {
+		formatter = &format.MarkdownSummaryFormatter{TopFiles: cfg.Annotations.TopFiles, Links: links}
+	}
+	var details bytes.Buffer
+	if err := formatter.Format(result, &details); err != nil {
+		return nil, fmt.Errorf("failed to format summary: %w", err)
+	}
+	var text string
+	if in.CheckRunDetails {
+		var report bytes.Buffer
+		if err := (&format.MarkdownFormatter{Links: links}).Format(result, &report); err != nil {
+			return nil, fmt.Errorf("failed to format details: %w", err)
+		}
+		text = truncateText(report.String(), github.MaxOutputLength)
+	}
+
+	conclusion := ConclusionSuccess
+	if len(unmet) > 0 {
+		conclusion = failureConclusion
+	}
+
+	var summary strings.Builder
+	if hasBase {
+		fmt.Fprintf(&summary, "Project coverage %.2f%%, change %+.2f%%\n\n", comparison.HeadCoverage, comparison.Delta)
+	} else {
+		fmt.Fprintf(&summary, "Project coverage %.2f%% (no base coverage for %s)\n\n", comparison.HeadCoverage, in.Run.DefaultBranch)
+	}
+	if summaryOnly {
+		fmt.Fprintf(&summary, "Summary-only mode: annotations are omitted for %d uncovered lines.\n\n", uncovered)
+	}
+	if len(unmet) > 0 {
+		fmt.Fprintf(&summary, "### Coverage thresholds\n\n")
+		for _, line := range unmet {
+			fmt.Fprintf(&summary, "- %s\n", line)
+		}
+		summary.WriteString("\n")
+	}
+	if sinceLastRun != "" {
+		summary.WriteString(sinceLastRun)
+		summary.WriteString("\n")
+	}
+	summary.Write(details.Bytes())
+	if in.ViewerURL != "" {
+		// The PR's coverage is saved under PullRequestKey once the analysis completes
+		link := viewer.CompareURL(in.ViewerURL, in.Request.Org, in.Request.Repo, in.Run.DefaultBranch, in.Run.coverageSHA(),
+			PullRequestKey(in.Request.Org, in.Request.Repo, in.Run.PullRequest).Branch)
+		fmt.Fprintf(&summary, "\n[View coverage on the full diff](%s)\n", link)
+	}
+	fmt.Fprintf(&summary, "\n<sub>%s</sub>\n", buildinfo.New(in.Version, in.RepoConfig).Footer())
+
+	return &CheckRun{
+		Name:        CheckRunName,
+		HeadSHA:     in.Run.HeadSHA,
+		Conclusion:  conclusion,
+		Title:       fmt.Sprintf("Coverage %.2f%%", comparison.HeadCoverage),
+		Summary:     summary.String(),
+		Text:        text,
+		Annotations: annotations,
+	}, nil
+}
+
+// truncatedNoteLength is the room truncateText leaves for its note.
+const truncatedNoteLength = 100
+
+// truncateText cuts text at a line boundary to at most limit bytes, and
+// therefore characters, noting how many lines were left out.
+func truncateText(text string, limit int) string {
+	if len(text) <= limit {
+		return text
+	}
+	cut := strings.LastIndex(text[:limit-truncatedNoteLength], "\n") + 1
+	omitted := strings.Count(strings.TrimSuffix(text[cut:], "\n"), "\n") + 1
+	return text[:cut] + fmt.Sprintf("\n_%d more lines are left out to fit the check run's size limit._\n", omitted)
+}
+
+// formatRemapNote explains in a check run summary that coverage was
+// generated at an older commit and remapped to the PR's head, dropping
+// the blocks on lines changed since.
+func formatRemapNote(coverageSHA string, dropped int) string {
+	commit := "an older commit"
+	if coverageSHA != "" {
+		commit = fmt.Sprintf("`%.7s`", coverageSHA)
+	}
+	note := fmt.Sprintf("_Coverage was generated at %s, before the PR's head, and its line numbers were remapped to the head", commit)
+	if dropped > 0 {
+		note += fmt.Sprintf("; %d blocks on lines changed since have no coverage", dropped)
+	}
+	return note + "._\n"
+}
+
+// formatSkippedNote lists in a check run summary the coverage files of
+// artifacts that couldn't be parsed, so their lines aren't silently
+// reported as uncovered.
+func formatSkippedNote(skipped []coverage.SkippedFile) string {
+	var b strings.Builder
+	if len(skipped) == 1 {
+		b.WriteString("_1 coverage file couldn't be parsed and was skipped:_\n")
+	} else {
+		fmt.Fprintf(&b, "_%d coverage files couldn't be parsed and were skipped:_\n", len(skipped))
+	}
+	for _, s := range skipped {
+		fmt.Fprintf(&b, "- `%s`: %s\n", s.Name, s.Err)
+	}
+	return b.String()
+}
+
+// changedFiles returns the sorted files with added lines or renamed in the diff.
+func changedFiles(addedLinesByFile map[string][]int, renames map[string]string) []string {
+	files := make([]string, 0, len(addedLinesByFile)+len(renames))
+	for file := range addedLinesByFile {
+		files = append(files, file)
+	}
+	for file := range renames {
+		if _, ok := addedLinesByFile[file]; !ok {
+			files = append(files, file)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// formatComment renders the PR comment table comparing base and head coverage,
+// followed by per-package and per-file coverage of the changed code when
+// there is a base, a collapsed list of the uncovered added lines, and the
+// changes since the PR's last run, if any.
+func formatComment(result *coverage.AnalysisResult, hasBase bool, comparison *coverage.CoverageComparison, packages []coverage.PackageDelta, files []coverage.FileDelta, links *format.FileLinker, sinceLastRun string) (string, error) {
+	var b strings.Builder
+	fmt.Fprintln(&b, "## Canopy Coverage Report")
+	fmt.Fprintln(&b)
+	fmt.Fprintln(&b, "| | Coverage |")
+	fmt.Fprintln(&b, "|---|---|")
+	if hasBase {
+		fmt.Fprintf(&b, "| Base | %.2f%% |\n", comparison.BaseCoverage)
+		fmt.Fprintf(&b, "| PR | %.2f%% |\n", comparison.HeadCoverage)
+		fmt.Fprintf(&b, "| Change | %+.2f%% |\n", comparison.Delta)
+	} else {
+		fmt.Fprintln(&b, "| Base | n/a |")
+		fmt.Fprintf(&b, "| PR | %.2f%% |\n", comparison.HeadCoverage)
+	}
+	if result.DiffAddedLines > 0 {
+		fmt.Fprintf(&b, "| Added lines | %d of %d covered (%.1f%%) |\n", result.DiffAddedCovered, result.DiffAddedLines,
+			float64(result.DiffAddedCovered)/float64(result.DiffAddedLines)*100)
+	}
+	if result.ProductionAddedLines > 0 || result.TestAddedLines > 0 {
+		fmt.Fprintf(&b, "| Added code | %d production, %d test lines |\n", result.ProductionAddedLines, result.TestAddedLines)
+	}
+	if hasBase && len(packages) > 0 {
+		fmt.Fprintln(&b)
+		fmt.Fprintln(&b, "### Changed packages")
+		fmt.Fprintln(&b)
+		fmt.Fprintln(&b, "| Package | Base | PR | Change |")
+		fmt.Fprintln(&b, "|---|---|---|---|")
+		for _, p := range packages {
+			if !p.HasBase {
+				fmt.Fprintf(&b, "| %s | n/a | %.2f%% | |\n", p.Package, p.HeadCoverage)
+				continue
+			}
+			fmt.Fprintf(&b, "| %s | %.2f%% | %.2f%% | %+.2f%% |\n", p.Package, p.BaseCoverage, p.HeadCoverage, p.Delta())
+		}
+	}
+	if hasBase && len(files) > 0 {
+		fmt.Fprintln(&b)
+		fmt.Fprintln(&b, "### Changed files")
+		fmt.Fprintln(&b)
+		fmt.Fprintln(&b, "| File | Base | PR | Change |")
+		fmt.Fprintln(&b, "|---|---|---|---|")
+		for _, f := range files {
+			name := f.File
+			if f.RenamedFrom != "" {
+				name = fmt.Sprintf("%s (renamed from %s)", f.File, f.RenamedFrom)
+			}
+			if !f.HasBase {
+				fmt.Fprintf(&b, "| %s | n/a | %.2f%% | |\n", name, f.HeadCoverage)
+				continue
+			}
+			fmt.Fprintf(&b, "| %s | %.2f%% | %.2f%% | %+.2f%% |\n", name, f.BaseCoverage, f.HeadCoverage, f.Delta())
+		}
+	}
+	if result.HasUncoveredLines() {
+		fmt.Fprintln(&b)
+		if err := format.FormatUncoveredDetails(result, &b, links); err != nil {
+			return "", fmt.Errorf("failed to format uncovered lines: %w", err)
+		}
+	}
+	if sinceLastRun != "" {
+		fmt.Fprintln(&b)
+		b.WriteString(sinceLastRun)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,646 @@
+package worker
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/queue"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/repoconfig"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingPublisher records everything published to it.
+type recordingPublisher struct {
+	saved    map[storage.CoverageKey]string
+	checkRun *CheckRun
+	comment  *Comment
+	err      error
+}
+
+func (p *recordingPublisher) SaveCoverage(ctx context.Context, key storage.CoverageKey, data []byte) error {
+	if p.saved == nil {
+		p.saved = make(map[storage.CoverageKey]string)
+	}
+	p.saved[key] = string(data)
+	return p.err
+}
+
+func (p *recordingPublisher) PublishCheckRun(ctx context.Context, req *queue.WorkRequest, run *CheckRun) error {
+	p.checkRun = run
+	return p.err
+}
+
+func (p *recordingPublisher) PublishComment(ctx context.Context, req *queue.WorkRequest, comment *Comment) error {
+	p.comment = comment
+	return p.err
+}
+
+const suppressedDiff = `diff --git a/calc.go b/calc.go
+--- a/calc.go
++++ b/calc.go
+@@ -1,0 +1,2 @@
++// canopy:ignore 2024-01-01 trivial
++func Add(a, b int) int { return a + b }
+`
+
+const testDiff = `diff --git a/calc.go b/calc.go
+--- a/calc.go
++++ b/calc.go
+@@ -1,0 +1,3 @@
++func Add(a, b int) int {
++	return a + b
++}
+`
+
+func prInputs() *Inputs {
+	return &Inputs{
+		Request: &queue.WorkRequest{Org: "acme", Repo: "widgets", WorkflowRunID: 1},
+		Run:     Run{HeadSHA: "abc123", HeadBranch: "feature", DefaultBranch: "main", PullRequest: 7},
+		Artifacts: []Artifact{
+			{Name: "coverage.out", Data: []byte("mode: set\ngithub.com/acme/widgets/calc.go:1.24,3.2 1 1\n")},
+		},
+		Diff: []byte(testDiff),
+	}
+}
+
+func TestProcess_DefaultBranch(t *testing.T) {
+	in := prInputs()
+	in.Run = Run{HeadSHA: "abc123", HeadBranch: "main", DefaultBranch: "main"}
+	pub := &recordingPublisher{}
+
+	require.NoError(t, Process(context.Background(), in, pub))
+
+	key := storage.CoverageKey{Org: "acme", Repo: "widgets", Branch: "main"}
+	assert.Equal(t, "mode: set\ngithub.com/acme/widgets/calc.go:1.24,3.2 1 1\n", pub.saved[key])
+	key.Commit = "abc123"
+	assert.Equal(t, "mode: set\ngithub.com/acme/widgets/calc.go:1.24,3.2 1 1\n", pub.saved[key])
+	assert.Nil(t, pub.checkRun)
+	assert.Nil(t, pub.comment)
+}
+
+func TestProcess_ReservedBranch(t *testing.T) {
+	in := prInputs()
+	in.Run = Run{HeadSHA: "abc123", HeadBranch: "pull/1", DefaultBranch: "main"}
+	pub := &recordingPublisher{}
+
+	err := Process(context.Background(), in, pub)
+	assert.ErrorIs(t, err, ErrReservedBranch)
+	assert.Empty(t, pub.saved)
+	assert.Nil(t, pub.checkRun)
+}
+
+func TestProcess_ExportFormats(t *testing.T) {
+	in := prInputs()
+	in.Run = Run{HeadSHA: "abc123", HeadBranch: "main", DefaultBranch: "main"}
+	in.GoMod = []byte("module github.com/acme/widgets\n")
+	in.ExportFormats = []coverage.Format{coverage.FormatLCOV, coverage.FormatCobertura}
+	pub := &recordingPublisher{}
+
+	require.NoError(t, Process(context.Background(), in, pub))
+
+	lcov := "TN:\nSF:calc.go\nDA:1,1\nDA:2,1\nDA:3,1\nLF:3\nLH:3\nend_of_record\n"
+	for _, key := range []storage.CoverageKey{
+		{Org: "acme", Repo: "widgets", Branch: "main", Export: "lcov.info"},
+		{Org: "acme", Repo: "widgets", Branch: "main", Commit: "abc123", Export: "lcov.info"},
+	} {
+		assert.Equal(t, lcov, pub.saved[key])
+	}
+	cobertura := pub.saved[storage.CoverageKey{Org: "acme", Repo: "widgets", Branch: "main", Export: "coverage.xml"}]
+	assert.Contains(t, cobertura, `<class name="calc.go" filename="calc.go"`)
+	assert.Contains(t, pub.saved[storage.CoverageKey{Org: "acme", Repo: "widgets", Branch: "main"}], "github.com/acme/widgets/calc.go")
+}
+
+func TestProcess_Workflows(t *testing.T) {
+	unit := "mode: set\ngithub.com/acme/widgets/calc.go:1.24,3.2 1 0\n"
+	integration := "mode: set\ngithub.com/acme/widgets/calc.go:1.24,3.2 1 1\n"
+	workflowInputs := func(branch string, stored map[string][]byte) *Inputs {
+		in := prInputs()
+		in.Run.HeadBranch = branch
+		in.Run.Workflow = "unit.yml"
+		in.Artifacts[0].Data = []byte(unit)
+		in.RepoConfig = []byte("workflows: [unit.yml, integration.yml]\n")
+		in.WorkflowCoverage = stored
+		return in
+	}
+	branchKey := storage.CoverageKey{Org: "acme", Repo: "widgets", Branch: "main"}
+	unitKey := WorkflowKey("acme", "widgets", "abc123", "unit.yml")
+
+	t.Run("default branch waits for every workflow", func(t *testing.T) {
+		pub := &recordingPublisher{}
+		require.NoError(t, Process(context.Background(), workflowInputs("main", nil), pub))
+		assert.Equal(t, map[storage.CoverageKey]string{unitKey: unit}, pub.saved)
+	})
+
+	t.Run("default branch saves merged coverage", func(t *testing.T) {
+		pub := &recordingPublisher{}
+		in := workflowInputs("main", map[string][]byte{"integration.yml": []byte(integration)})
+		require.NoError(t, Process(context.Background(), in, pub))
+		assert.Equal(t, unit, pub.saved[unitKey])
+		assert.Equal(t, integration, pub.saved[branchKey])
+	})
+
+	t.Run("PR check run is in progress", func(t *testing.T) {
+		pub := &recordingPublisher{}
+		in := workflowInputs("feature", nil)
+		in.RepoConfig = []byte("workflows: [unit.yml, integration.yml]\nthresholds:\n  patch: 90\n")
+		require.NoError(t, Process(context.Background(), in, pub))
+		require.NotNil(t, pub.checkRun)
+		assert.Equal(t, StatusInProgress, pub.checkRun.Status)
+		assert.Empty(t, pub.checkRun.Conclusion)
+		assert.Equal(t, "Waiting for integration.yml", pub.checkRun.Title)
+		assert.True(t, strings.HasPrefix(pub.checkRun.Summary, "_Coverage of `unit.yml` only, waiting for `integration.yml`"))
+		assert.NotContains(t, pub.checkRun.Summary, "Unmet thresholds")
+		assert.Nil(t, pub.comment)
+	})
+
+	t.Run("PR check run completes", func(t *testing.T) {
+		pub := &recordingPublisher{}
+		in := workflowInputs("feature", map[string][]byte{"integration.yml": []byte(integration)})
+		require.NoError(t, Process(context.Background(), in, pub))
+		require.NotNil(t, pub.checkRun)
+		assert.Empty(t, pub.checkRun.Status)
+		assert.Equal(t, ConclusionSuccess, pub.checkRun.Conclusion)
+		assert.Empty(t, pub.checkRun.Annotations)
+		assert.NotNil(t, pub.comment)
+	})
+
+	t.Run("unlisted workflow", func(t *testing.T) {
+		in := workflowInputs("feature", nil)
+		in.Run.Workflow = "lint.yml"
+		err := Process(context.Background(), in, &recordingPublisher{})
+		assert.ErrorIs(t, err, ErrUnlistedWorkflow)
+		assert.EqualError(t, err, `workflow not listed in the repository config: "lint.yml"`)
+	})
+}
+
+func TestCheckBranch(t *testing.T) {
+	tests := []struct {
+		branch   string
+		reserved bool
+	}{
+		{branch: "main"},
+		{branch: "pull-requests"},
+		{branch: "feature/pull/1"},
+		{branch: "pull/1", reserved: true},
+		{branch: "workflows/abc/ci.yml", reserved: true},
+		{branch: "runs/42", reserved: true},
+		{branch: "artifacts/abc", reserved: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.branch, func(t *testing.T) {
+			err := CheckBranch(tt.branch)
+			if tt.reserved {
+				assert.ErrorIs(t, err, ErrReservedBranch)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestProcess_PullRequest(t *testing.T) {
+	tests := []struct {
+		name               string
+		modify             func(in *Inputs)
+		expectedConclusion string
+		expectedLevel      string
+		expectComment      bool
+		summaryContains    []string
+	}{
+		{
+			name:               "no base coverage",
+			expectedConclusion: ConclusionSuccess,
+			expectComment:      true,
+			summaryContains:    []string{"Project coverage 100.00% (no base coverage for main)", "All added lines are covered!", "<sub>Canopy dev · config default · ruleset 1</sub>"},
+		},
+		{
+			name: "coverage decreased",
+			modify: func(in *Inputs) {
+				in.Artifacts[0].Data = []byte("mode: set\ngithub.com/acme/widgets/calc.go:1.24,3.2 1 0\n")
+				in.BaseCoverage = []byte("mode: set\ngithub.com/acme/widgets/calc.go:1.24,3.2 1 1\n")
+			},
+			expectedConclusion: ConclusionFailure,
+			expectedLevel:      "notice",
+			expectComment:      true,
+			summaryContains:    []string{"Project coverage 0.00%, change -100.00%", "| [calc.go](https://github.com/acme/widgets/blob/abc123/calc.go#L1) | [1-3](https://github.com/acme/widgets/blob/abc123/calc.go#L1-L3) |"},
+		},
+		{
+			name: "repo config sets level and disables comment",
+			modify: func(in *Inputs) {
+				in.Artifacts[0].Data = []byte("mode: set\ngithub.com/acme/widgets/calc.go:1.24,3.2 1 0\n")
+				in.RepoConfigPath = ".canopy.yml"
+				in.RepoConfig = []byte("annotations:\n  level: failure\ncomment:\n  behavior: off\n")
+			},
+			expectedConclusion: ConclusionSuccess,
+			expectedLevel:      "failure",
+		},
+		{
+			name: "summary-only mode above the uncovered line threshold",
+			modify: func(in *Inputs) {
+				in.Artifacts[0].Data = []byte("mode: set\ngithub.com/acme/widgets/calc.go:1.24,3.2 1 0\n")
+				in.RepoConfigPath = ".canopy.yml"
+				in.RepoConfig = []byte("annotations:\n  summary_only_above: 2\n")
+			},
+			expectedConclusion: ConclusionSuccess,
+			expectComment:      true,
+			summaryContains: []string{
+				"Summary-only mode: annotations are omitted for 3 uncovered lines.",
+				"| [calc.go](https://github.com/acme/widgets/blob/abc123/calc.go#L1) | 3 |",
+			},
+		},
+		{
+			name: "generated files are not analyzed",
+			modify: func(in *Inputs) {
+				in.Artifacts[0].Data = []byte("mode: set\ngithub.com/acme/widgets/calc.go:1.24,3.2 1 0\n")
+				in.GitAttributes = []byte("calc.go linguist-generated\n")
+			},
+			expectedConclusion: ConclusionSuccess,
+			expectComment:      true,
+			summaryContains:    []string{"No lines added in diff"},
+		},
+		{
+			name: "repo config ignores files",
+			modify: func(in *Inputs) {
+				in.Artifacts[0].Data = []byte("mode: set\ngithub.com/acme/widgets/calc.go:1.24,3.2 1 0\n")
+				in.RepoConfigPath = ".canopy.yml"
+				in.RepoConfig = []byte("ignore: [\"calc.go\"]\n")
+			},
+			expectedConclusion: ConclusionSuccess,
+			expectComment:      true,
+			summaryContains:    []string{"No lines added in diff"},
+		},
+		{
+			name: "repo config includes other files only",
+			modify: func(in *Inputs) {
+				in.Artifacts[0].Data = []byte("mode: set\ngithub.com/acme/widgets/calc.go:1.24,3.2 1 0\n")
+				in.RepoConfigPath = ".canopy.yml"
+				in.RepoConfig = []byte("include: [\"internal/**\"]\n")
+			},
+			expectedConclusion: ConclusionSuccess,
+			expectComment:      true,
+			summaryContains:    []string{"No lines added in diff"},
+		},
+		{
+			name: "suppressed lines are reported as debt",
+			modify: func(in *Inputs) {
+				in.Artifacts[0].Data = []byte("mode: set\ngithub.com/acme/widgets/calc.go:2.24,2.40 1 0\n")
+				in.Diff = []byte(suppressedDiff)
+			},
+			expectedConclusion: ConclusionSuccess,
+			expectComment:      true,
+			summaryContains:    []string{"### Suppressed Coverage Debt", "| calc.go | 1 | 0 |"},
+		},
+		{
+			name: "expired suppressions are reported as uncovered",
+			modify: func(in *Inputs) {
+				in.Request.RunCompletedAt = time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+				in.Artifacts[0].Data = []byte("mode: set\ngithub.com/acme/widgets/calc.go:2.24,2.40 1 0\n")
+				in.Diff = []byte(suppressedDiff)
+				in.RepoConfigPath = ".canopy.yml"
+				in.RepoConfig = []byte("suppressions:\n  max_age_days: 30\n")
+			},
+			expectedConclusion: ConclusionSuccess,
+			expectedLevel:      "notice",
+			expectComment:      true,
+			summaryContains:    []string{"| calc.go | 0 | 1 |", "1 lines with expired `canopy:ignore` comments"},
+		},
+		{
+			name: "coverage below thresholds",
+			modify: func(in *Inputs) {
+				in.Artifacts[0].Data = []byte("mode: set\ngithub.com/acme/widgets/calc.go:1.24,3.2 1 0\ngithub.com/acme/widgets/api/api.go:1.1,2.2 3 1\n")
+				in.RepoConfigPath = ".canopy.yml"
+				in.RepoConfig = []byte("comment:\n  behavior: off\nthresholds:\n  project: 80\n  packages:\n    github.com/acme/widgets: 50\n    github.com/acme/widgets/api: 90\n    github.com/acme/widgets/gone: 90\n")
+			},
+			expectedConclusion: ConclusionFailure,
+			expectedLevel:      "notice",
+			summaryContains: []string{"### Coverage thresholds\n\n" +
+				"- Project coverage 75.00% is below the threshold of 80%\n" +
+				"- `github.com/acme/widgets` coverage 0.00% is below the threshold of 50%\n\n"},
+		},
+		{
+			name: "coverage meets thresholds",
+			modify: func(in *Inputs) {
+				in.RepoConfigPath = ".canopy.yml"
+				in.RepoConfig = []byte("thresholds:\n  project: 100\n  packages:\n    github.com/acme/widgets: 99.5\n")
+			},
+			expectedConclusion: ConclusionSuccess,
+			expectComment:      true,
+		},
+		{
+			name: "patch coverage below threshold concludes neutral",
+			modify: func(in *Inputs) {
+				in.Artifacts[0].Data = []byte("mode: set\ngithub.com/acme/widgets/calc.go:1.24,3.2 1 0\n")
+				in.RepoConfigPath = ".canopy.yml"
+				in.RepoConfig = []byte("comment:\n  behavior: off\nthresholds:\n  patch: 50\n  conclusion: neutral\n")
+			},
+			expectedConclusion: ConclusionNeutral,
+			expectedLevel:      "notice",
+			summaryContains:    []string{"### Coverage thresholds\n\n- Patch coverage 0.00% is below the threshold of 50%\n\n"},
+		},
+		{
+			name: "paths override patch threshold",
+			modify: func(in *Inputs) {
+				in.Artifacts[0].Data = []byte("mode: set\ngithub.com/acme/widgets/calc.go:1.24,3.2 1 0\n")
+				in.RepoConfigPath = ".canopy.yml"
+				in.RepoConfig = []byte("thresholds:\n  patch: 50\n  paths:\n    - path: \"*.go\"\n      patch: 0\n")
+			},
+			expectedConclusion: ConclusionSuccess,
+			expectedLevel:      "notice",
+			expectComment:      true,
+		},
+		{
+			name: "coverage drop within max_drop",
+			modify: func(in *Inputs) {
+				in.Artifacts[0].Data = []byte("mode: set\ngithub.com/acme/widgets/calc.go:1.24,3.2 1 1\ngithub.com/acme/widgets/util.go:1.1,2.2 1 0\n")
+				in.BaseCoverage = []byte("mode: set\ngithub.com/acme/widgets/calc.go:1.24,3.2 1 1\ngithub.com/acme/widgets/util.go:1.1,2.2 1 1\n")
+				in.RepoConfigPath = ".canopy.yml"
+				in.RepoConfig = []byte("thresholds:\n  max_drop: 60\n")
+			},
+			expectedConclusion: ConclusionSuccess,
+			expectComment:      true,
+			summaryContains:    []string{"Project coverage 50.00%, change -50.00%"},
+		},
+		{
+			name: "server default thresholds with the repository's conclusion",
+			modify: func(in *Inputs) {
+				in.Artifacts[0].Data = []byte("mode: set\ngithub.com/acme/widgets/calc.go:1.24,3.2 1 0\n")
+				in.DefaultThresholds = &repoconfig.ThresholdsConfig{Patch: 80}
+				in.RepoConfigPath = ".canopy.yml"
+				in.RepoConfig = []byte("thresholds:\n  conclusion: neutral\n")
+			},
+			expectedConclusion: ConclusionNeutral,
+			expectedLevel:      "notice",
+			expectComment:      true,
+			summaryContains:    []string{"- Patch coverage 0.00% is below the threshold of 80%"},
+		},
+		{
+			name: "repository thresholds replace server defaults",
+			modify: func(in *Inputs) {
+				in.Artifacts[0].Data = []byte("mode: set\ngithub.com/acme/widgets/calc.go:1.24,3.2 1 0\n")
+				in.DefaultThresholds = &repoconfig.ThresholdsConfig{Patch: 80}
+				in.RepoConfigPath = ".canopy.yml"
+				in.RepoConfig = []byte("thresholds:\n  project: 0.5\n")
+			},
+			expectedConclusion: ConclusionFailure,
+			expectedLevel:      "notice",
+			expectComment:      true,
+			summaryContains:    []string{"### Coverage thresholds\n\n- Project coverage 0.00% is below the threshold of 0.5%\n\n"},
+		},
+		{
+			name: "invalid repo config falls back to defaults with a warning",
+			modify: func(in *Inputs) {
+				in.RepoConfigPath = ".canopy.yml"
+				in.RepoConfig = []byte("comment:\n  behavior: never\n")
+			},
+			expectedConclusion: ConclusionSuccess,
+			expectComment:      true,
+			summaryContains:    []string{"**Warning:** `.canopy.yml` is invalid", "Project coverage 100.00%"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := prInputs()
+			if tt.modify != nil {
+				tt.modify(in)
+			}
+			pub := &recordingPublisher{}
+
+			require.NoError(t, Process(context.Background(), in, pub))
+
+			require.NotNil(t, pub.checkRun)
+			assert.Equal(t, CheckRunName, pub.checkRun.Name)
+			assert.Equal(t, "abc123", pub.checkRun.HeadSHA)
+			assert.Equal(t, tt.expectedConclusion, pub.checkRun.Conclusion)
+			for _, s := range tt.summaryContains {
+				assert.Contains(t, pub.checkRun.Summary, s)
+			}
+			if tt.expectedLevel != "" {
+				require.Len(t, pub.checkRun.Annotations, 1)
+				assert.Equal(t, tt.expectedLevel, pub.checkRun.Annotations[0].Level)
+			} else {
+				assert.Empty(t, pub.checkRun.Annotations)
+			}
+
+			if tt.expectComment {
+				require.NotNil(t, pub.comment)
+				assert.Equal(t, 7, pub.comment.PullRequest)
+				assert.Equal(t, "update", pub.comment.Behavior)
+			} else {
+				assert.Nil(t, pub.comment)
+			}
+			expectedKeys := []storage.CoverageKey{AnalysisKey("acme", "widgets", 1), PullRequestAnalysisKey("acme", "widgets", 7), PullRequestKey("acme", "widgets", 7)}
+			assert.ElementsMatch(t, expectedKeys, slices.Collect(maps.Keys(pub.saved)))
+		})
+	}
+}
+
+func TestProcess_SavesAnalysis(t *testing.T) {
+	in := prInputs()
+	in.BaseCoverage = []byte("mode: set\ngithub.com/acme/widgets/calc.go:1.24,3.2 1 0\n")
+	pub := &recordingPublisher{}
+
+	require.NoError(t, Process(context.Background(), in, pub))
+
+	data, ok := pub.saved[AnalysisKey("acme", "widgets", in.Request.WorkflowRunID)]
+	require.True(t, ok)
+	assert.Equal(t, data, pub.saved[PullRequestAnalysisKey("acme", "widgets", 7)])
+	analysis, err := ParseAnalysis([]byte(data))
+	require.NoError(t, err)
+	assert.Equal(t, 7, analysis.PullRequest)
+	assert.Equal(t, "abc123", analysis.HeadSHA)
+	assert.Equal(t, pub.checkRun.Conclusion, analysis.Conclusion)
+	require.NotNil(t, analysis.BaseCoverage)
+	assert.Equal(t, 0.0, *analysis.BaseCoverage)
+	require.NotNil(t, analysis.CoverageDelta)
+	assert.Equal(t, 100.0, *analysis.CoverageDelta)
+	require.NotNil(t, analysis.Report.Project)
+	assert.Equal(t, 100.0, analysis.Report.Project.Coverage)
+	require.NotNil(t, analysis.Report.Canopy)
+}
+
+func TestProcess_SinceLastRun(t *testing.T) {
+	in := prInputs()
+	in.PreviousCoverage = []byte("mode: set\ngithub.com/acme/widgets/calc.go:1.24,3.2 1 0\n")
+	pub := &recordingPublisher{}
+
+	require.NoError(t, Process(context.Background(), in, pub))
+
+	section := "### Since last run\n\n" +
+		"Project coverage 0.00% → 100.00% (+100.00%)\n\n" +
+		"| | Last run | This run |\n|---|---|---|\n" +
+		"| Patch coverage | 0.0% | 100.0% (+100.0%) |\n" +
+		"| Uncovered lines | 3 | 0 |\n\n" +
+		"| File | Newly uncovered | Resolved |\n|------|-----------------|----------|\n" +
+		"| calc.go |  | 1-3 (now fully covered) |\n"
+	require.NotNil(t, pub.checkRun)
+	assert.Contains(t, pub.checkRun.Summary, section)
+	require.NotNil(t, pub.comment)
+	assert.Contains(t, pub.comment.Body, section)
+	assert.Equal(t, "mode: set\ngithub.com/acme/widgets/calc.go:1.24,3.2 1 1\n", pub.saved[PullRequestKey("acme", "widgets", 7)])
+}
+
+func TestProcess_CheckRunDetails(t *testing.T) {
+	in := prInputs()
+	in.Artifacts[0].Data = []byte("mode: set\ngithub.com/acme/widgets/calc.go:1.24,3.2 1 0\n")
+	in.CheckRunDetails = true
+	pub := &recordingPublisher{}
+
+	require.NoError(t, Process(context.Background(), in, pub))
+
+	require.NotNil(t, pub.checkRun)
+	assert.Contains(t, pub.checkRun.Summary, "| [calc.go](https://github.com/acme/widgets/blob/abc123/calc.go#L1) | 3 |")
+	assert.NotContains(t, pub.checkRun.Summary, "[1-3]", "line ranges move to the text")
+	assert.Contains(t, pub.checkRun.Text, "| [calc.go](https://github.com/acme/widgets/blob/abc123/calc.go#L1) | [1-3](https://github.com/acme/widgets/blob/abc123/calc.go#L1-L3) |")
+	assert.Len(t, pub.checkRun.Annotations, 1)
+}
+
+func TestProcess_SkippedFiles(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range map[string]string{
+		"coverage.out":  "mode: set\ngithub.com/acme/widgets/calc.go:1.24,3.2 1 1\n",
+		"cobertura.xml": `<?xml version="1.0"?><coverage></coverage>`,
+	} {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(data))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+
+	in := prInputs()
+	in.Artifacts = []Artifact{{Name: "coverage", Data: buf.Bytes()}}
+	pub := &recordingPublisher{}
+
+	require.NoError(t, Process(context.Background(), in, pub))
+
+	require.NotNil(t, pub.checkRun)
+	assert.Equal(t, ConclusionSuccess, pub.checkRun.Conclusion)
+	assert.Contains(t, pub.checkRun.Summary, "_1 coverage file couldn't be parsed and was skipped:_\n- `coverage/cobertura.xml`: ")
+}
+
+func TestProcess_ViewerLink(t *testing.T) {
+	tests := []struct {
+		name      string
+		viewerURL string
+		expected  string
+	}{
+		{
+			name:      "public URL configured",
+			viewerURL: "https://canopy.example.com/",
+			expected:  "[View coverage on the full diff](https://canopy.example.com/view/acme/widgets/compare/main...abc123?coverage=pull%2F7)",
+		},
+		{
+			name: "no public URL",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := prInputs()
+			in.ViewerURL = tt.viewerURL
+			pub := &recordingPublisher{}
+
+			require.NoError(t, Process(context.Background(), in, pub))
+
+			require.NotNil(t, pub.checkRun)
+			if tt.expected == "" {
+				assert.NotContains(t, pub.checkRun.Summary, "/view/")
+				return
+			}
+			assert.Contains(t, pub.checkRun.Summary, tt.expected)
+		})
+	}
+}
+
+func TestTruncateText(t *testing.T) {
+	line := strings.Repeat("x", 99) + "\n"
+
+	assert.Equal(t, line+line, truncateText(line+line, 200))
+
+	text := strings.Repeat(line, 10)
+	truncated := truncateText(text, 450)
+	assert.LessOrEqual(t, len(truncated), 450)
+	assert.Equal(t, strings.Repeat(line, 3)+"\n_7 more lines are left out to fit the check run's size limit._\n", truncated)
+}
+
+func TestProcess_RenamedFile(t *testing.T) {
+	in := prInputs()
+	in.Diff = []byte(`diff --git a/calc.go b/math/calc.go
+similarity index 90%
+rename from calc.go
+rename to math/calc.go
+--- a/calc.go
++++ b/math/calc.go
+@@ -1,0 +1,1 @@
++func Add(a, b int) int {
+`)
+	in.Artifacts[0].Data = []byte("mode: set\ngithub.com/acme/widgets/math/calc.go:1.24,3.2 1 1\n")
+	in.BaseCoverage = []byte("mode: set\ngithub.com/acme/widgets/calc.go:1.24,3.2 2 0\n")
+	pub := &recordingPublisher{}
+
+	require.NoError(t, Process(context.Background(), in, pub))
+
+	require.NotNil(t, pub.comment)
+	assert.Contains(t, pub.comment.Body, "| math/calc.go (renamed from calc.go) | 0.00% | 100.00% | +100.00% |")
+}
+
+func TestProcess_Errors(t *testing.T) {
+	tests := []struct {
+		name          string
+		modify        func(in *Inputs)
+		publishErr    error
+		expectedError string
+	}{
+		{
+			name:          "no artifacts",
+			modify:        func(in *Inputs) { in.Artifacts = nil },
+			expectedError: ErrNoCoverage.Error(),
+		},
+		{
+			name:          "malformed artifact",
+			modify:        func(in *Inputs) { in.Artifacts[0].Data = []byte("mode: set\nnot a block\n") },
+			expectedError: "failed to parse artifact coverage.out",
+		},
+		{
+			name:          "malformed base coverage",
+			modify:        func(in *Inputs) { in.BaseCoverage = []byte("garbage") },
+			expectedError: "failed to parse base coverage",
+		},
+		{
+			name:          "malformed previous coverage",
+			modify:        func(in *Inputs) { in.PreviousCoverage = []byte("garbage") },
+			expectedError: "failed to parse previous coverage",
+		},
+		{
+			name:          "publish failure",
+			publishErr:    errors.New("boom"),
+			expectedError: "failed to publish check run: boom",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := prInputs()
+			if tt.modify != nil {
+				tt.modify(in)
+			}
+
+			err := Process(context.Background(), in, &recordingPublisher{err: tt.publishErr})
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.expectedError)
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/gitlab"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/queue"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+)
+
+// Provider is the code host a work request came from: the worker resolves
+// the request's run, fetches the files, diffs, and artifacts of its inputs,
+// and publishes its results through it. GitHubProvider serves GitHub
+// workflow runs and uploads, GitLabProvider GitLab pipelines.
+type Provider interface {
+	// RunArtifacts lists and downloads the artifacts of the request's run
+	RunArtifacts
+	// FetchRun resolves the run of a request and its repository
+	FetchRun(ctx context.Context, req *queue.WorkRequest) (Run, error)
+	// GetFile returns a file at ref; missing files return an error
+	// satisfying isNotFound
+	GetFile(ctx context.Context, owner, repo, path, ref string) ([]byte, error)
+	PullRequestDiff(ctx context.Context, owner, repo string, number int) ([]byte, error)
+	// PullRequestHead returns the SHA of a PR's head commit
+	PullRequestHead(ctx context.Context, owner, repo string, number int) (string, error)
+	CompareDiff(ctx context.Context, owner, repo, base, head string) ([]byte, error)
+	MergeBase(ctx context.Context, owner, repo, base, head string) (string, error)
+	// Publisher returns the Publisher of a request's results; budget, if
+	// the host accounts for API requests, decides whether optional ones
+	// are made
+	Publisher(req *queue.WorkRequest, logger *slog.Logger, budget *APIBudget) Publisher
+}
+
+// provider returns the Provider serving a request.
+func (w *Worker) provider(req *queue.WorkRequest) Provider {
+	if req.Event() == queue.EventGitLabPipeline {
+		return &GitLabProvider{GitLab: w.GitLab, Storage: w.Storage, Clock: w.Clock}
+	}
+	return &GitHubProvider{GitHub: w.GitHub, Storage: w.Storage}
+}
+
+// isNotFound reports whether err is a not found error of either code host.
+func isNotFound(err error) bool {
+	return github.IsNotFound(err) || gitlab.IsNotFound(err)
+}
+
+// GitHubProvider is the Provider of GitHub workflow runs, and of coverage
+// uploaded for GitHub repositories.
+type GitHubProvider struct {
+	GitHub
+	Storage storage.Storage
+}
+
+// FetchRun implements Provider. Requests for uploaded coverage have no
+// workflow run; their Run is the uploaded commit.
+func (p *GitHubProvider) FetchRun(ctx context.Context, req *queue.WorkRequest) (Run, error) {
+	if req.Uploaded() {
+		repo, err := p.GetRepository(ctx, req.Org, req.Repo)
+		if err != nil {
+			return Run{}, fmt.Errorf("failed to get repository: %w", err)
+		}
+		return Run{
+			HeadSHA:       req.HeadSHA,
+			HeadBranch:    req.HeadBranch,
+			DefaultBranch: repo.DefaultBranch,
+			RepoURL:       repo.HTMLURL,
+			PullRequest:   req.PullRequest,
+		}, nil
+	}
+
+	wr, err := p.GetWorkflowRun(ctx, req.Org, req.Repo, req.WorkflowRunID)
+	if err != nil {
+		return Run{}, fmt.Errorf("failed to get workflow run: %w", err)
+	}
+	repo, err := p.GetRepository(ctx, req.Org, req.Repo)
+	if err != nil {
+		return Run{}, fmt.Errorf("failed to get repository: %w", err)
+	}
+
+	run := Run{
+		HeadSHA:       wr.HeadSHA,
+		HeadBranch:    wr.HeadBranch,
+		DefaultBranch: repo.DefaultBranch,
+		RepoURL:       repo.HTMLURL,
+	}
+	if wr.Path != "" {
+		run.Workflow = path.Base(wr.Path)
+	}
+	if len(wr.PullRequests) > 0 {
+		run.PullRequest = wr.PullRequests[0].Number
+	}
+	return run, nil
+}
+
+// PullRequestHead implements Provider.
+func (p *GitHubProvider) PullRequestHead(ctx context.Context, owner, repo string, number int) (string, error) {
+	pr, err := p.GetPullRequest(ctx, owner, repo, number)
+	if err != nil {
+		return "", err
+	}
+	return pr.Head.SHA, nil
+}
+
+// Publisher implements Provider.
+func (p *GitHubProvider) Publisher(req *queue.WorkRequest, logger *slog.Logger, budget *APIBudget) Publisher {
+	return &GitHubPublisher{GitHub: p.GitHub, Storage: p.Storage, Org: req.Org, Repo: req.Repo, Logger: logger, APIBudget: budget}
+}
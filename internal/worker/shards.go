@@ -0,0 +1,144 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/queue"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+)
+
+// saveShards saves profiles split by package next to the coverage at key,
+// followed by the manifest indexing them, so readers never find a manifest
+// listing shards that weren't written yet.
+func saveShards(ctx context.Context, pub Publisher, key storage.CoverageKey, profiles []*coverage.Profile) error {
+	manifest, shards := coverage.ShardProfiles(profiles)
+	for _, entry := range manifest.Shards {
+		key.Shard = entry.Name
+		if err := saveCoverage(ctx, pub, key, shards[entry.Name]); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to serialize shard manifest: %w", err)
+	}
+	key.Shard = coverage.ShardManifestName
+	if err := pub.SaveCoverage(ctx, key, data); err != nil {
+		return fmt.Errorf("failed to save shard manifest: %w", err)
+	}
+	return nil
+}
+
+// getBaseCoverage returns the stored coverage of the default branch. With
+// ShardedBaselines, it returns only the shards of packages with files
+// changed in the PR diff, and the manifest holding the totals of the whole
+// coverage; coverage saved without shards, or missing a shard, is fetched
+// whole, with a nil manifest. With CommitBaselines, the coverage of the
+// run's BaseSHA is returned whole, unless the branch's latest coverage is
+// of that commit; without any, the branch's latest is compared with.
+func (w *Worker) getBaseCoverage(ctx context.Context, req *queue.WorkRequest, run Run, diff []byte) ([]byte, *coverage.ShardManifest, error) {
+	key := storage.CoverageKey{Org: req.Org, Repo: req.Repo, Branch: run.DefaultBranch}
+	if w.CommitBaselines && run.BaseSHA != "" {
+		data, err := w.getCommitCoverage(ctx, key, run.BaseSHA)
+		if err != nil || data != nil {
+			return data, nil, err
+		}
+	}
+	if !w.ShardedBaselines {
+		data, err := w.Storage.GetCoverage(ctx, key)
+		return data, nil, err
+	}
+
+	shardKey := key
+	shardKey.Shard = coverage.ShardManifestName
+	data, err := w.Storage.GetCoverage(ctx, shardKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	if data == nil {
+		data, err := w.Storage.GetCoverage(ctx, key)
+		return data, nil, err
+	}
+	manifest, err := coverage.ParseShardManifest(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	files, err := diffFiles(diff)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	names := manifest.ShardsFor(files)
+	if len(names) == 0 {
+		return nil, manifest, nil
+	}
+	var base bytes.Buffer
+	fmt.Fprintf(&base, "mode: %s\n", manifest.Mode)
+	for _, name := range names {
+		shardKey.Shard = name
+		shard, err := w.Storage.GetCoverage(ctx, shardKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		if shard == nil {
+			w.logger().Warn("base coverage shard missing, fetching whole coverage", "org", req.Org, "repo", req.Repo, "shard", name)
+			data, err := w.Storage.GetCoverage(ctx, key)
+			return data, nil, err
+		}
+		// Shards are serialized profiles; their mode lines are replaced
+		// by the manifest's
+		_, blocks, _ := bytes.Cut(shard, []byte("\n"))
+		base.Write(blocks)
+	}
+	return base.Bytes(), manifest, nil
+}
+
+// getCommitCoverage returns the coverage stored for a commit of key's
+// branch, or nil if the branch's latest coverage is of the commit, as the
+// latest pointer says, or there is none.
+func (w *Worker) getCommitCoverage(ctx context.Context, key storage.CoverageKey, commit string) ([]byte, error) {
+	data, err := w.Storage.GetCoverage(ctx, storage.LatestKey(key))
+	if err != nil {
+		return nil, err
+	}
+	if data != nil {
+		latest, err := storage.ParseLatestPointer(data)
+		if err != nil {
+			return nil, err
+		}
+		if latest.Commit == commit {
+			return nil, nil
+		}
+	}
+
+	key.Commit = commit
+	data, err = w.Storage.GetCoverage(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		w.logger().Warn("no coverage stored for the PR's merge base, comparing with the branch's latest", "org", key.Org, "repo", key.Repo, "branch", key.Branch, "base_sha", commit)
+	}
+	return data, nil
+}
+
+// diffFiles returns the files whose base coverage is compared for a PR
+// diff: the files with added lines or renamed, and the names renamed files
+// had in base.
+func diffFiles(diff []byte) ([]string, error) {
+	fileDiffs, err := coverage.ParseDiff(diff)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse PR diff: %w", err)
+	}
+	renames := coverage.GetRenamedFiles(fileDiffs)
+	files := changedFiles(coverage.GetAddedLinesByFile(fileDiffs), renames)
+	for _, old := range renames {
+		files = append(files, old)
+	}
+	return files, nil
+}
@@ -0,0 +1,182 @@
+package worker
+
+import (
+	"context"
+	"testing"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingStorage records the keys read from a memoryStorage.
+type recordingStorage struct {
+	*memoryStorage
+	reads []storage.CoverageKey
+}
+
+func (r *recordingStorage) GetCoverage(ctx context.Context, key storage.CoverageKey) ([]byte, error) {
+	r.reads = append(r.reads, key)
+	return r.memoryStorage.GetCoverage(ctx, key)
+}
+
+func TestWorker_ShardedBaselines_DefaultBranch(t *testing.T) {
+	gh := newFakeGitHub(t, "testdata/fixtures/push")
+	store := &memoryStorage{data: map[storage.CoverageKey][]byte{}}
+	w := &Worker{GitHub: gh, Storage: store, ShardedBaselines: true}
+
+	require.NoError(t, w.ProcessWorkRequest(context.Background(), gh.in.Request))
+
+	key := storage.CoverageKey{Org: "acme", Repo: "widgets", Branch: "main"}
+	require.Contains(t, store.data, key, "whole coverage is still saved")
+	key.Shard = coverage.ShardManifestName
+	require.Contains(t, store.data, key)
+	manifest, err := coverage.ParseShardManifest(store.data[key])
+	require.NoError(t, err)
+	require.NotEmpty(t, manifest.Shards)
+	for _, entry := range manifest.Shards {
+		key.Shard = entry.Name
+		assert.Contains(t, store.data, key)
+	}
+}
+
+func TestWorker_ShardedBaselines_PullRequest(t *testing.T) {
+	// A package the PR doesn't change, whose shard isn't needed
+	const other = "github.com/acme/widgets/other/other.go:1.1,5.2 4 0\n"
+
+	// The check run of the same base coverage stored whole
+	gh := newFakeGitHub(t, "testdata/fixtures/pr")
+	base := append(gh.in.BaseCoverage, other...)
+	key := storage.CoverageKey{Org: "acme", Repo: "widgets", Branch: "main"}
+	w := &Worker{GitHub: gh, Storage: &memoryStorage{data: map[storage.CoverageKey][]byte{key: base}}}
+	require.NoError(t, w.ProcessWorkRequest(context.Background(), gh.in.Request))
+	require.Len(t, gh.checkRuns, 1)
+	expected := gh.checkRuns[0]
+
+	profiles, err := coverage.ParseProfiles(base)
+	require.NoError(t, err)
+	manifest, _ := coverage.ShardProfiles(profiles)
+	unchanged := manifest.ShardsFor([]string{"other/other.go"})
+	require.Len(t, unchanged, 1)
+
+	tests := []struct {
+		name          string
+		sharded       bool
+		expectedReads int // Reads of base coverage, whole or sharded
+	}{
+		{name: "sharded", sharded: true, expectedReads: 2},
+		{name: "saved before sharding", sharded: false, expectedReads: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := newFakeGitHub(t, "testdata/fixtures/pr")
+			store := &recordingStorage{memoryStorage: &memoryStorage{data: map[storage.CoverageKey][]byte{}}}
+			if tt.sharded {
+				require.NoError(t, saveShards(context.Background(), &GitHubPublisher{Storage: store}, key, profiles))
+			} else {
+				store.data[key] = base
+			}
+			w := &Worker{GitHub: gh, Storage: store, ShardedBaselines: true}
+
+			require.NoError(t, w.ProcessWorkRequest(context.Background(), gh.in.Request))
+
+			require.Len(t, gh.checkRuns, 1)
+			assert.Equal(t, expected.Summary, gh.checkRuns[0].Summary)
+			assert.Equal(t, expected.Conclusion, gh.checkRuns[0].Conclusion)
+
+			var baseReads []storage.CoverageKey
+			for _, read := range store.reads {
+				if read.Branch == "main" {
+					baseReads = append(baseReads, read)
+					assert.NotEqual(t, unchanged[0], read.Shard, "shard of unchanged package read")
+				}
+			}
+			assert.Len(t, baseReads, tt.expectedReads)
+		})
+	}
+}
+
+func TestWorker_CommitBaselines_DefaultBranch(t *testing.T) {
+	gh := newFakeGitHub(t, "testdata/fixtures/push")
+	store := &memoryStorage{data: map[storage.CoverageKey][]byte{}}
+	w := &Worker{GitHub: gh, Storage: store, CommitBaselines: true}
+
+	require.NoError(t, w.ProcessWorkRequest(context.Background(), gh.in.Request))
+
+	key := storage.CoverageKey{Org: "acme", Repo: "widgets", Branch: "main", Commit: gh.in.Run.HeadSHA}
+	require.Contains(t, store.data, key)
+	require.Contains(t, store.data, storage.LatestKey(key))
+	latest, err := storage.ParseLatestPointer(store.data[storage.LatestKey(key)])
+	require.NoError(t, err)
+	assert.Equal(t, gh.in.Run.HeadSHA, latest.Commit)
+	assert.Equal(t, gh.in.Request.RunCompletedAt, latest.Updated)
+}
+
+func TestWorker_CommitBaselines_PullRequest(t *testing.T) {
+	const mergeBase = "1111111111111111111111111111111111111111"
+	branch := storage.CoverageKey{Org: "acme", Repo: "widgets", Branch: "main"}
+	commit := branch
+	commit.Commit = mergeBase
+	pointer := func(sha string) []byte {
+		data, err := storage.MarshalLatestPointer(storage.LatestPointer{Commit: sha})
+		require.NoError(t, err)
+		return data
+	}
+
+	tests := []struct {
+		name          string
+		latest        []byte
+		commitStored  bool
+		expectedReads []storage.CoverageKey
+	}{
+		{
+			name:          "latest is the merge base",
+			latest:        pointer(mergeBase),
+			expectedReads: []storage.CoverageKey{storage.LatestKey(branch), branch},
+		},
+		{
+			name:          "merge base is older than latest",
+			latest:        pointer("2222222222222222222222222222222222222222"),
+			commitStored:  true,
+			expectedReads: []storage.CoverageKey{storage.LatestKey(branch), commit},
+		},
+		{
+			name:          "no latest pointer",
+			commitStored:  true,
+			expectedReads: []storage.CoverageKey{storage.LatestKey(branch), commit},
+		},
+		{
+			name:          "merge base coverage missing falls back to latest",
+			latest:        pointer("2222222222222222222222222222222222222222"),
+			expectedReads: []storage.CoverageKey{storage.LatestKey(branch), commit, branch},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := newFakeGitHub(t, "testdata/fixtures/pr")
+			gh.mergeBase = mergeBase
+			store := &recordingStorage{memoryStorage: &memoryStorage{data: map[storage.CoverageKey][]byte{branch: gh.in.BaseCoverage}}}
+			if tt.latest != nil {
+				store.data[storage.LatestKey(branch)] = tt.latest
+			}
+			if tt.commitStored {
+				store.data[commit] = gh.in.BaseCoverage
+			}
+			w := &Worker{GitHub: gh, Storage: store, CommitBaselines: true}
+
+			require.NoError(t, w.ProcessWorkRequest(context.Background(), gh.in.Request))
+
+			require.Len(t, gh.checkRuns, 1)
+			var baseReads []storage.CoverageKey
+			for _, read := range store.reads {
+				if read.Branch == "main" {
+					baseReads = append(baseReads, read)
+				}
+			}
+			assert.Equal(t, tt.expectedReads, baseReads)
+		})
+	}
+}
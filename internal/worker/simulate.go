@@ -0,0 +1,213 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/queue"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/repoconfig"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+)
+
+// Fixture file names. A fixture directory records the inputs of one
+// WorkRequest so it can be replayed without GitHub, storage, or a queue:
+//
+//	request.json   the WorkRequest, as published to the queue
+//	run.json       the workflow run (see Run)
+//	artifacts/     downloaded artifacts, as zip archives or coverage files
+//	base.out       stored coverage of the default branch (optional)
+//	previous.out   stored coverage of the PR's last run (optional)
+//	pr.diff        the PR diff (PR runs only)
+//	coverage.diff  the diff from the run's coverage commit to the PR head (optional)
+//	.canopy.yml    the repository config (optional, any of repoconfig.Paths)
+//	.gitattributes the root .gitattributes of the head commit (optional)
+//	go.mod         the root go.mod of the head commit (optional)
+//	trend.json     stored coverage trend of the run's branch (optional)
+//	workflows/     coverage saved by other workflows' runs of the commit, as
+//	               {workflow}.out, e.g. integration.yml.out (optional)
+const (
+	FixtureRequest      = "request.json"
+	FixtureRun          = "run.json"
+	FixtureArtifactsDir = "artifacts"
+	FixtureBaseCoverage = "base.out"
+	FixturePrevious     = "previous.out"
+	FixtureDiff         = "pr.diff"
+	FixtureCoverageDiff = "coverage.diff"
+	FixtureAttributes   = ".gitattributes"
+	FixtureGoMod        = "go.mod"
+	FixtureTrend        = "trend.json"
+	FixtureWorkflowsDir = "workflows"
+)
+
+// Output file names written by FilePublisher.
+const (
+	OutputCheckRun    = "check_run.json"
+	OutputComment     = "comment.json"
+	OutputCoverageDir = "coverage"
+)
+
+// LoadFixture reads the inputs recorded in a fixture directory.
+func LoadFixture(dir string) (*Inputs, error) {
+	in := &Inputs{Request: &queue.WorkRequest{}}
+	if err := readJSON(filepath.Join(dir, FixtureRequest), in.Request); err != nil {
+		return nil, err
+	}
+	if err := readJSON(filepath.Join(dir, FixtureRun), &in.Run); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, FixtureArtifactsDir))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read artifacts: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, FixtureArtifactsDir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read artifact %s: %w", entry.Name(), err)
+		}
+		in.Artifacts = append(in.Artifacts, Artifact{Name: entry.Name(), Data: data})
+	}
+
+	if in.BaseCoverage, err = readOptional(filepath.Join(dir, FixtureBaseCoverage)); err != nil {
+		return nil, err
+	}
+	if in.PreviousCoverage, err = readOptional(filepath.Join(dir, FixturePrevious)); err != nil {
+		return nil, err
+	}
+	if in.Diff, err = readOptional(filepath.Join(dir, FixtureDiff)); err != nil {
+		return nil, err
+	}
+	if in.CoverageDiff, err = readOptional(filepath.Join(dir, FixtureCoverageDiff)); err != nil {
+		return nil, err
+	}
+	if in.GitAttributes, err = readOptional(filepath.Join(dir, FixtureAttributes)); err != nil {
+		return nil, err
+	}
+	if in.GoMod, err = readOptional(filepath.Join(dir, FixtureGoMod)); err != nil {
+		return nil, err
+	}
+	if in.Trend, err = readOptional(filepath.Join(dir, FixtureTrend)); err != nil {
+		return nil, err
+	}
+	if in.WorkflowCoverage, err = readWorkflowCoverage(filepath.Join(dir, FixtureWorkflowsDir)); err != nil {
+		return nil, err
+	}
+	if in.Run.IsPullRequest() && in.Diff == nil {
+		return nil, fmt.Errorf("%s is required for pull request runs", FixtureDiff)
+	}
+
+	in.RepoConfigPath, in.RepoConfig, err = repoconfig.Find(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return in, nil
+}
+
+// FilePublisher is a Publisher that writes results under Dir instead of
+// calling GitHub and storage. Outputs are stable across runs, so they can
+// be compared against expected files.
+type FilePublisher struct {
+	Dir string
+}
+
+// SaveCoverage writes coverage to coverage/{org}/{repo}/{branch}/coverage.out.
+func (p *FilePublisher) SaveCoverage(ctx context.Context, key storage.CoverageKey, data []byte) error {
+	objectPath, err := storage.FormatObjectPath(key)
+	if err != nil {
+		return err
+	}
+	return p.write(filepath.Join(OutputCoverageDir, filepath.FromSlash(objectPath)), data)
+}
+
+// PublishCheckRun writes the check run to check_run.json.
+func (p *FilePublisher) PublishCheckRun(ctx context.Context, req *queue.WorkRequest, run *CheckRun) error {
+	return p.writeJSON(OutputCheckRun, run)
+}
+
+// PublishComment writes the comment to comment.json.
+func (p *FilePublisher) PublishComment(ctx context.Context, req *queue.WorkRequest, comment *Comment) error {
+	return p.writeJSON(OutputComment, comment)
+}
+
+func (p *FilePublisher) writeJSON(name string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", name, err)
+	}
+	return p.write(name, append(data, '\n'))
+}
+
+func (p *FilePublisher) write(name string, data []byte) error {
+	path := filepath.Join(p.Dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// Simulate replays the fixture in fixtureDir through Process, writing the
+// results to outDir with a FilePublisher.
+func Simulate(ctx context.Context, fixtureDir, outDir string) error {
+	in, err := LoadFixture(fixtureDir)
+	if err != nil {
+		return fmt.Errorf("failed to load fixture: %w", err)
+	}
+	return Process(ctx, in, &FilePublisher{Dir: outDir})
+}
+
+func readJSON(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", filepath.Base(path), err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// readWorkflowCoverage reads the {workflow}.out files of a fixture's
+// workflows directory, returning nil if it does not exist.
+func readWorkflowCoverage(dir string) (map[string][]byte, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workflow coverage: %w", err)
+	}
+	coverage := make(map[string][]byte)
+	for _, entry := range entries {
+		workflow, ok := strings.CutSuffix(entry.Name(), ".out")
+		if entry.IsDir() || !ok {
+			continue
+		}
+		if coverage[workflow], err = os.ReadFile(filepath.Join(dir, entry.Name())); err != nil {
+			return nil, fmt.Errorf("failed to read coverage of workflow %s: %w", workflow, err)
+		}
+	}
+	return coverage, nil
+}
+
+// readOptional reads a file, returning nil data if it does not exist.
+func readOptional(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", filepath.Base(path), err)
+	}
+	return data, nil
+}
@@ -0,0 +1,116 @@
+package worker
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSimulate_Fixtures replays every fixture under testdata/fixtures and
+// compares the outputs with the files in its expected/ directory.
+func TestSimulate_Fixtures(t *testing.T) {
+	fixtures, err := os.ReadDir("testdata/fixtures")
+	require.NoError(t, err)
+	require.NotEmpty(t, fixtures)
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.Name(), func(t *testing.T) {
+			dir := filepath.Join("testdata/fixtures", fixture.Name())
+			expectedDir := filepath.Join(dir, "expected")
+			outDir := t.TempDir()
+
+			require.NoError(t, Simulate(context.Background(), dir, outDir))
+
+			expected := listFiles(t, expectedDir)
+			assert.Equal(t, expected, listFiles(t, outDir), "output files")
+			for _, name := range expected {
+				want, err := os.ReadFile(filepath.Join(expectedDir, name))
+				require.NoError(t, err)
+				got, err := os.ReadFile(filepath.Join(outDir, name))
+				require.NoError(t, err)
+				assert.Equal(t, string(want), string(got), name)
+			}
+		})
+	}
+}
+
+func TestLoadFixture(t *testing.T) {
+	in, err := LoadFixture("testdata/fixtures/pr")
+	require.NoError(t, err)
+
+	assert.Equal(t, "acme", in.Request.Org)
+	assert.Equal(t, int64(4242), in.Request.WorkflowRunID)
+	assert.Equal(t, 17, in.Run.PullRequest)
+	assert.Len(t, in.Artifacts, 2)
+	assert.NotEmpty(t, in.BaseCoverage)
+	assert.NotEmpty(t, in.Diff)
+	assert.Equal(t, ".canopy.yml", in.RepoConfigPath)
+}
+
+func TestLoadFixture_Errors(t *testing.T) {
+	tests := []struct {
+		name          string
+		files         map[string]string
+		expectedError string
+	}{
+		{
+			name:          "missing request",
+			files:         map[string]string{FixtureRun: `{}`},
+			expectedError: "failed to read request.json",
+		},
+		{
+			name:          "invalid run",
+			files:         map[string]string{FixtureRequest: `{}`, FixtureRun: `{`},
+			expectedError: "failed to parse run.json",
+		},
+		{
+			name:          "missing artifacts",
+			files:         map[string]string{FixtureRequest: `{}`, FixtureRun: `{}`},
+			expectedError: "failed to read artifacts",
+		},
+		{
+			name: "pull request without diff",
+			files: map[string]string{
+				FixtureRequest:           `{}`,
+				FixtureRun:               `{"head_branch":"feature","default_branch":"main","pull_request":1}`,
+				"artifacts/coverage.out": "mode: set\n",
+			},
+			expectedError: "pr.diff is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755))
+				require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+			}
+
+			_, err := LoadFixture(dir)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.expectedError)
+		})
+	}
+}
+
+// listFiles returns the slash-separated paths of all files under dir.
+func listFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		files = append(files, filepath.ToSlash(rel))
+		return err
+	})
+	require.NoError(t, err)
+	return files
+}
@@ -0,0 +1,709 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/clock"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/coverage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/diff"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github/auth"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/idempotency"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/logging"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/queue"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/repoconfig"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/tracing"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/trend"
+)
+
+// idempotencyLease is how long a delivery holds its request's idempotency
+// key; a worker that stops without settling it only delays redeliveries
+// until it expires.
+const idempotencyLease = 10 * time.Minute
+
+// ErrDuplicateInProgress is returned (wrapped) for a delivery of a request
+// another delivery is processing, so the queue delivers it again later in
+// case that processing fails.
+var ErrDuplicateInProgress = errors.New("work request is already being processed")
+
+// ErrUnknownCheckSuite is returned (wrapped) for a re-requested check suite
+// without a Canopy check run naming the workflow run it analyzed.
+var ErrUnknownCheckSuite = errors.New("check suite has no Canopy check run")
+
+// ErrGitLabDisabled is returned (wrapped) for GitLab pipelines handed to a
+// worker without a GitLab client.
+var ErrGitLabDisabled = errors.New("GitLab is not configured")
+
+// CommentMarker is a hidden marker added to PR comments so the worker can
+// find and update its own comment.
+const CommentMarker = "<!-- canopy-coverage -->"
+
+// GitHub is the subset of the GitHub API used by the worker.
+type GitHub interface {
+	RunArtifacts
+	GetRepository(ctx context.Context, owner, repo string) (*github.RepositoryInfo, error)
+	GetWorkflowRun(ctx context.Context, owner, repo string, runID int64) (*github.WorkflowRun, error)
+	GetPullRequest(ctx context.Context, owner, repo string, number int) (*github.PullRequest, error)
+	PullRequestDiff(ctx context.Context, owner, repo string, number int) ([]byte, error)
+	CompareDiff(ctx context.Context, owner, repo, base, head string) ([]byte, error)
+	MergeBase(ctx context.Context, owner, repo, base, head string) (string, error)
+	GetFile(ctx context.Context, owner, repo, path, ref string) ([]byte, error)
+	CreateCheckRun(ctx context.Context, owner, repo string, run *github.CheckRun) (int64, error)
+	ListCheckSuiteRuns(ctx context.Context, owner, repo string, suiteID int64, name string) ([]github.CheckRunInfo, error)
+	ListIssueComments(ctx context.Context, owner, repo string, number int) ([]github.IssueComment, error)
+	CreateIssueComment(ctx context.Context, owner, repo string, number int, body string) error
+	UpdateIssueComment(ctx context.Context, owner, repo string, commentID int64, body string) error
+	ListIssueLabels(ctx context.Context, owner, repo string, number int) ([]string, error)
+	AddIssueLabels(ctx context.Context, owner, repo string, number int, labels []string) error
+	RemoveIssueLabel(ctx context.Context, owner, repo string, number int, label string) error
+}
+
+// Worker processes work requests from the queue: it fetches a workflow
+// run's inputs from GitHub and storage, hands them to Process, and
+// publishes the results back to GitHub and storage. GitLab pipelines are
+// served the same way by GitLab (see Provider).
+type Worker struct {
+	GitHub GitHub
+	// GitLab serves queue.EventGitLabPipeline requests; nil skips them
+	GitLab  GitLab
+	Storage storage.Storage
+
+	// MaxRunAge drops requests for runs that completed longer ago (see
+	// queue.WorkRequest.Stale); zero disables the deadline
+	MaxRunAge time.Duration
+	// ArtifactStorageFallback restores coverage from StorageArtifactSource
+	// when the run's artifacts have expired
+	ArtifactStorageFallback bool
+	// ArtifactPatterns select the run's coverage artifacts by name (see
+	// artifacts.Match); empty uses artifacts.DefaultPatterns
+	ArtifactPatterns []string
+	// ArtifactMaxSize and ArtifactSpoolThreshold bound artifact downloads
+	// and select those spooled to temporary files (see artifacts.Downloader)
+	ArtifactMaxSize        int64
+	ArtifactSpoolThreshold int64
+	// RemapStaleCoverage analyzes PR runs of a commit older than the PR's
+	// head against the head, remapping coverage line numbers through the
+	// diff between them (see Inputs.CoverageDiff); otherwise coverage is
+	// analyzed as if it were generated at the head
+	RemapStaleCoverage bool
+	// DefaultThresholds apply to repositories whose config sets no
+	// thresholds (see Inputs.DefaultThresholds)
+	DefaultThresholds *repoconfig.ThresholdsConfig
+	// OrgConfigs are the configs repository configs apply over (see
+	// Inputs.OrgConfig); nil reads none
+	OrgConfigs *OrgConfigs
+	// MemoryBudget is the number of bytes processing a single request may
+	// hold (see MemoryBudget); zero disables the limit
+	MemoryBudget int64
+	// ShardedBaselines saves default branch coverage split by package as
+	// well, and analyzes PRs against the shards of the packages they change
+	// (see coverage.ShardProfiles)
+	ShardedBaselines bool
+	// CommitBaselines analyzes PRs against the coverage stored for the
+	// merge base of their head and the default branch, which is kept with
+	// storage.CommitLayout, rather than the branch's latest coverage
+	CommitBaselines bool
+	// CheckRunDetails adds the full Markdown report to check runs as their
+	// text (see Inputs.CheckRunDetails)
+	CheckRunDetails bool
+	// ExportFormats are the formats default branch coverage is converted to
+	// and saved in as well (see Inputs.ExportFormats)
+	ExportFormats []coverage.Format
+	// CoverageLabels label GitHub PRs by their patch coverage (see
+	// Inputs.CoverageLabels)
+	CoverageLabels []github.LabelBand
+	// ViewerURL is the public base URL of the diff viewer GitHub check runs
+	// link to (see Inputs.ViewerURL); empty links none
+	ViewerURL string
+	// GitHubRequestLimit and GitHubQuotaReserve bound the GitHub API
+	// requests of a single request before optional ones are skipped (see
+	// APIBudget); zero disables them
+	GitHubRequestLimit int
+	GitHubQuotaReserve int
+	// Concurrency serializes requests for the same org, repository, and
+	// branch when requests are processed concurrently; nil doesn't lock
+	Concurrency *Concurrency
+	// Idempotency detects repeated deliveries of a request (see
+	// idempotency.Key), which are skipped once it was processed and retried
+	// while it is being processed; nil processes every delivery
+	Idempotency idempotency.Store
+	// IdempotencyTTL is how long processed requests are remembered
+	IdempotencyTTL time.Duration
+	// Version is recorded in check runs (see Inputs.Version)
+	Version string
+	// Clock is the time stale requests are checked against; nil uses the
+	// system clock
+	Clock  clock.Clock
+	Logger *slog.Logger
+}
+
+// ProcessWorkRequest handles a single work request. Requests that can never
+// succeed (stale runs, runs without coverage, expired artifacts, coverage
+// over the memory budget, check suites Canopy didn't analyze, GitLab
+// pipelines without a GitLab client) are logged and acknowledged; other errors are returned so the queue can retry.
+// Re-requested check suites are resolved to the workflow run their Canopy
+// check run analyzed first. A request that fails on its last delivery (see
+// queue.Delivery) gets an action_required check run saying so, since no
+// other check run will arrive.
+// The memory the request held, the heap it allocated, and the GitHub API
+// requests it made are logged with the outcome.
+func (w *Worker) ProcessWorkRequest(ctx context.Context, req *queue.WorkRequest) (err error) {
+	logger := w.logger().With("org", req.Org, "repo", req.Repo)
+	if req.CheckSuiteID != 0 {
+		logger = logger.With("check_suite_id", req.CheckSuiteID)
+	}
+	if req.WorkflowRunID != 0 {
+		logger = logger.With("workflow_run_id", req.WorkflowRunID)
+	}
+	if req.CorrelationID != "" {
+		logger = logger.With(logging.CorrelationIDKey, req.CorrelationID)
+	}
+	ctx = logging.WithCorrelationID(ctx, req.CorrelationID)
+	// The span continues the trace of the delivery that queued the request
+	ctx, span := tracing.Start(tracing.Extract(ctx, req.TraceContext), "worker.process", trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attribute.String("canopy.org", req.Org), attribute.String("canopy.repo", req.Repo), attribute.Int64("canopy.workflow_run_id", req.WorkflowRunID)))
+	apiBudget := &APIBudget{Limit: w.GitHubRequestLimit, Reserve: w.GitHubQuotaReserve}
+	ctx = github.WithUsage(ctx, &apiBudget.Usage)
+	// GitHub is called as the installation of the org that sent the event
+	ctx = auth.WithInstallation(ctx, req.InstallationID)
+
+	start := clock.Or(w.Clock).Now()
+	queue.ObserveConsume(req, start)
+	result := jobFailed
+	defer func() {
+		observeJob(result, clock.Or(w.Clock).Now().Sub(start))
+		span.SetAttributes(attribute.String("canopy.result", result))
+		tracing.End(span, err)
+	}()
+
+	if key := idempotency.Key(req); w.Idempotency != nil && key != "" {
+		status, claimErr := w.Idempotency.Claim(ctx, key, idempotencyLease)
+		switch {
+		case claimErr != nil:
+			// Processing a request twice beats not processing it
+			logger.Warn("failed to check for duplicate work request", "error", claimErr)
+		case status == idempotency.Done:
+			logger.Info("skipping duplicate work request")
+			result = jobDuplicate
+			return nil
+		case status == idempotency.InProgress:
+			result = jobDuplicate
+			return fmt.Errorf("%w: %s", ErrDuplicateInProgress, key)
+		default:
+			defer func() { w.settle(ctx, logger, key, err) }()
+		}
+	}
+
+	if req.Event() == queue.EventGitLabPipeline && w.GitLab == nil {
+		logger.Warn("skipping work request", "reason", ErrGitLabDisabled)
+		result = jobSkipped
+		return nil
+	}
+
+	if req.WorkflowRunID == 0 && req.CheckSuiteID != 0 {
+		req, err = w.resolveCheckSuite(ctx, req)
+		if errors.Is(err, ErrUnknownCheckSuite) {
+			logger.Warn("skipping work request", "reason", err)
+			result = jobSkipped
+			return nil
+		}
+		if err != nil {
+			logger.Error("failed to process work request", "error", err)
+			return err
+		}
+		logger = logger.With("workflow_run_id", req.WorkflowRunID)
+		span.SetAttributes(attribute.Int64("canopy.workflow_run_id", req.WorkflowRunID))
+	}
+
+	if req.Stale(start, w.MaxRunAge) {
+		logger.Warn("dropping stale work request", "run_completed_at", req.RunCompletedAt, "max_run_age", w.MaxRunAge)
+		result = jobStale
+		return w.publishNeutral(ctx, req, "Run too old to analyze",
+			fmt.Sprintf("The workflow run completed more than %s before it was processed, so its coverage was not analyzed. Re-run the workflow to analyze it.",
+				w.MaxRunAge))
+	}
+
+	budget := &MemoryBudget{Limit: w.MemoryBudget}
+	allocs := heapAllocs()
+	var in *Inputs
+	run, err := w.fetchRun(ctx, req)
+	if err == nil {
+		// Runs of a branch write the same coverage, so they take turns
+		var unlock func()
+		if unlock, err = w.Concurrency.Lock(ctx, runKey(req, run)); err == nil {
+			defer unlock()
+			in, err = w.fetchInputs(ctx, req, run, budget)
+			defer in.Close()
+		}
+	}
+	if err == nil {
+		err = Process(ctx, in, w.provider(req).Publisher(req, logger, apiBudget))
+	}
+	logger = logger.With("budget_peak_bytes", budget.Peak(), "allocated_bytes", heapAllocs()-allocs).With(apiBudget.logAttrs()...)
+	switch {
+	case errors.Is(err, ErrNoCoverage), errors.Is(err, ErrArtifactsExpired), errors.Is(err, ErrUnlistedWorkflow), errors.Is(err, ErrReservedBranch):
+		logger.Warn("skipping work request", "reason", err)
+		result = jobSkipped
+		return nil
+	case errors.Is(err, ErrMemoryBudgetExceeded):
+		logger.Warn("aborting work request over memory budget", "reason", err, "memory_budget_bytes", w.MemoryBudget)
+		result = jobOverBudget
+		return w.publishNeutral(ctx, req, "Coverage too large to analyze",
+			fmt.Sprintf("Analyzing the coverage of this run needs more memory than a single run may use (%s), so it was stopped: %s. Split coverage into smaller artifacts, or ask the Canopy operator to raise CANOPY_WORKER_MEMORY_BUDGET.",
+				formatBytes(w.MemoryBudget), err))
+	case err != nil:
+		logger.Error("failed to process work request", "error", err)
+		if delivery, ok := queue.DeliveryFrom(ctx); ok && delivery.Last() && ctx.Err() == nil {
+			w.reportExhausted(ctx, logger, req, delivery, err)
+		}
+		return err
+	}
+	logger.Info("processed work request", "head_sha", in.Run.HeadSHA, "pull_request", in.Run.PullRequest)
+	result = jobProcessed
+	return nil
+}
+
+// resolveCheckSuite returns a copy of a re-requested check suite's request
+// for the workflow run named by the suite's latest Canopy check run.
+func (w *Worker) resolveCheckSuite(ctx context.Context, req *queue.WorkRequest) (*queue.WorkRequest, error) {
+	runs, err := w.GitHub.ListCheckSuiteRuns(ctx, req.Org, req.Repo, req.CheckSuiteID, CheckRunName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list check suite runs: %w", err)
+	}
+	for _, run := range runs {
+		// Check runs published before their external ID named the workflow
+		// run can't be traced back to it
+		runID, _, err := queue.ParseCheckRunExternalID(run.ExternalID)
+		if err != nil {
+			continue
+		}
+		resolved := *req
+		resolved.WorkflowRunID = runID
+		return &resolved, nil
+	}
+	return nil, fmt.Errorf("%w: suite %d", ErrUnknownCheckSuite, req.CheckSuiteID)
+}
+
+// settle completes the idempotency key of a request handled with err, or
+// releases it if err will have the request delivered again.
+func (w *Worker) settle(ctx context.Context, logger *slog.Logger, key string, err error) {
+	// The request may have been cancelled by a drain; the key must still be
+	// settled
+	ctx = context.WithoutCancel(ctx)
+	if err != nil {
+		err = w.Idempotency.Release(ctx, key)
+	} else {
+		err = w.Idempotency.Complete(ctx, key, w.IdempotencyTTL)
+	}
+	if err != nil {
+		logger.Warn("failed to record work request outcome", "error", err)
+	}
+}
+
+// FetchInputs resolves the workflow run of a request and fetches everything
+// Process needs: the org config and the repository config of the head
+// commit, artifacts
+// matching its patterns (or ArtifactPatterns), the coverage saved by the
+// other workflows it lists for the commit, the branch's coverage trend for
+// branch runs, and for PR runs the diff, base coverage, coverage of the
+// PR's last run, .gitattributes, and go.mod of the head commit.
+// The inputs are charged to budget, which Process keeps charging; it returns
+// ErrMemoryBudgetExceeded (wrapped) if they don't fit. The caller must Close
+// the inputs.
+func (w *Worker) FetchInputs(ctx context.Context, req *queue.WorkRequest, budget *MemoryBudget) (*Inputs, error) {
+	run, err := w.fetchRun(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return w.fetchInputs(ctx, req, run, budget)
+}
+
+// fetchInputs fetches the inputs of a resolved workflow run (see FetchInputs).
+func (w *Worker) fetchInputs(ctx context.Context, req *queue.WorkRequest, run Run, budget *MemoryBudget) (_ *Inputs, err error) {
+	p := w.provider(req)
+	in := &Inputs{Request: req, Run: run, Version: w.Version, Clock: w.Clock, Budget: budget, ShardBaseline: w.ShardedBaselines, DefaultThresholds: w.DefaultThresholds, CheckRunDetails: w.CheckRunDetails, ExportFormats: w.ExportFormats, CoverageLabels: w.CoverageLabels}
+	if req.Event() != queue.EventGitLabPipeline {
+		// The viewer renders GitHub compares only
+		in.ViewerURL = w.ViewerURL
+	}
+	defer func() {
+		if err != nil {
+			in.Close()
+		}
+	}()
+
+	if run.IsPullRequest() && w.RemapStaleCoverage {
+		if err := w.fetchCoverageDiff(ctx, req, in); err != nil {
+			return nil, err
+		}
+	}
+	// The org and repository configs are fetched first, since they may
+	// select the artifacts
+	if in.OrgConfig, err = w.OrgConfigs.Get(ctx, req.Org); err != nil {
+		return nil, err
+	}
+	for _, path := range repoconfig.Paths {
+		data, err := w.getOptionalFile(ctx, req, path, in.Run.HeadSHA)
+		if err != nil {
+			return nil, err
+		}
+		if data != nil {
+			in.RepoConfigPath, in.RepoConfig = path, data
+			break
+		}
+	}
+	cfg, _ := repoconfig.ParseOver(in.RepoConfig, in.OrgConfig)
+	if err := checkWorkflow(cfg, run); err != nil {
+		return nil, err
+	}
+	patterns := w.ArtifactPatterns
+	if len(cfg.Artifacts) > 0 {
+		patterns = cfg.Artifacts
+	}
+
+	var primary ArtifactSource = &GitHubArtifactSource{
+		GitHub:         p,
+		Patterns:       patterns,
+		MaxSize:        w.ArtifactMaxSize,
+		SpoolThreshold: w.ArtifactSpoolThreshold,
+		Budget:         budget,
+	}
+	var fallbacks []ArtifactSource
+	switch {
+	case req.Uploaded():
+		// Without a workflow run, only the uploaded copy has coverage
+		primary = &StorageArtifactSource{Storage: w.Storage, Budget: budget}
+	case w.ArtifactStorageFallback:
+		fallbacks = append(fallbacks, &StorageArtifactSource{Storage: w.Storage, Budget: budget})
+	}
+	downloadCtx, download := tracing.Start(ctx, "artifacts.download")
+	in.Artifacts, err = FetchArtifacts(downloadCtx, req, run, primary, fallbacks...)
+	download.SetAttributes(attribute.Int("canopy.artifacts", len(in.Artifacts)))
+	tracing.End(download, err)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.Workflows) > 0 {
+		if in.WorkflowCoverage, err = w.getWorkflowCoverage(ctx, req, in.Run, cfg.Workflows, budget); err != nil {
+			return nil, err
+		}
+	}
+	if !run.IsPullRequest() {
+		in.Trend, err = w.Storage.GetCoverage(ctx, trend.Key(req.Org, req.Repo, run.HeadBranch))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get coverage trend: %w", err)
+		}
+		if err := budget.Charge("coverage trend", int64(len(in.Trend))); err != nil {
+			return nil, err
+		}
+		return in, nil
+	}
+
+	// Diffs come from the code host's API, so the repository is never cloned
+	in.Diff, err = diff.NewGitHubAPIDiffSource(p, req.Org, req.Repo, run.PullRequest, "", "").GetDiff(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := budget.Charge("PR diff", int64(len(in.Diff))); err != nil {
+		return nil, err
+	}
+	if w.CommitBaselines {
+		in.Run.BaseSHA, err = p.MergeBase(ctx, req.Org, req.Repo, run.DefaultBranch, in.Run.HeadSHA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get PR merge base: %w", err)
+		}
+	}
+	in.BaseCoverage, in.BaseManifest, err = w.getBaseCoverage(ctx, req, in.Run, in.Diff)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get base coverage: %w", err)
+	}
+	if err := budget.Charge("base coverage", int64(len(in.BaseCoverage))); err != nil {
+		return nil, err
+	}
+	in.PreviousCoverage, err = w.Storage.GetCoverage(ctx, PullRequestKey(req.Org, req.Repo, run.PullRequest))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get previous coverage: %w", err)
+	}
+	if err := budget.Charge("previous coverage", int64(len(in.PreviousCoverage))); err != nil {
+		return nil, err
+	}
+	in.GitAttributes, err = w.getOptionalFile(ctx, req, ".gitattributes", in.Run.HeadSHA)
+	if err != nil {
+		return nil, err
+	}
+	in.GoMod, err = w.getOptionalFile(ctx, req, "go.mod", in.Run.HeadSHA)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Annotations.Severity.Classifies() {
+		if in.Sources, err = w.getSources(ctx, req, in.Run.HeadSHA, in.Diff, budget); err != nil {
+			return nil, err
+		}
+	}
+	return in, nil
+}
+
+// maxSourceFiles bounds the changed files fetched for classifying uncovered
+// lines (see Inputs.Sources); lines of the others get the annotation level.
+const maxSourceFiles = 50
+
+// getSources fetches the Go files with lines added by a PR diff at ref.
+func (w *Worker) getSources(ctx context.Context, req *queue.WorkRequest, ref string, diffData []byte, budget *MemoryBudget) (map[string][]byte, error) {
+	fileDiffs, err := coverage.ParseDiff(diffData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse PR diff: %w", err)
+	}
+	sources := make(map[string][]byte)
+	for _, fd := range fileDiffs {
+		if len(sources) == maxSourceFiles {
+			break
+		}
+		if fd.IsDeleted || len(fd.AddedLines) == 0 || !strings.HasSuffix(fd.NewName, ".go") || strings.HasSuffix(fd.NewName, "_test.go") {
+			continue
+		}
+		data, err := w.getOptionalFile(ctx, req, fd.NewName, ref)
+		if err != nil {
+			return nil, err
+		}
+		if data == nil {
+			continue
+		}
+		if err := budget.Charge("source "+fd.NewName, int64(len(data))); err != nil {
+			return nil, err
+		}
+		sources[fd.NewName] = data
+	}
+	return sources, nil
+}
+
+// getWorkflowCoverage returns the coverage saved by runs of the other
+// workflows of the commit the run's coverage was generated at, by workflow.
+func (w *Worker) getWorkflowCoverage(ctx context.Context, req *queue.WorkRequest, run Run, workflows []string, budget *MemoryBudget) (map[string][]byte, error) {
+	coverage := make(map[string][]byte)
+	for _, workflow := range workflows {
+		if workflow == run.Workflow {
+			continue
+		}
+		data, err := w.Storage.GetCoverage(ctx, WorkflowKey(req.Org, req.Repo, run.coverageSHA(), workflow))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get coverage of workflow %s: %w", workflow, err)
+		}
+		if data == nil {
+			continue
+		}
+		if err := budget.Charge("coverage of workflow "+workflow, int64(len(data))); err != nil {
+			return nil, err
+		}
+		coverage[workflow] = data
+	}
+	return coverage, nil
+}
+
+// fetchCoverageDiff checks whether the PR was pushed to since the run's
+// commit, and if so fetches the diff from the run's commit to the PR's
+// head and moves the run to the head, which the PR diff describes.
+func (w *Worker) fetchCoverageDiff(ctx context.Context, req *queue.WorkRequest, in *Inputs) error {
+	p := w.provider(req)
+	head, err := p.PullRequestHead(ctx, req.Org, req.Repo, in.Run.PullRequest)
+	if err != nil {
+		return fmt.Errorf("failed to get pull request: %w", err)
+	}
+	if head == "" || head == in.Run.HeadSHA {
+		return nil
+	}
+	in.CoverageDiff, err = diff.NewGitHubAPIDiffSource(p, req.Org, req.Repo, 0, in.Run.HeadSHA, head).GetDiff(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get diff since the run's commit: %w", err)
+	}
+	if err := in.Budget.Charge("coverage diff", int64(len(in.CoverageDiff))); err != nil {
+		return err
+	}
+	in.Run.CoverageSHA, in.Run.HeadSHA = in.Run.HeadSHA, head
+	return nil
+}
+
+// fetchRun resolves the workflow run and its repository (see
+// Provider.FetchRun).
+func (w *Worker) fetchRun(ctx context.Context, req *queue.WorkRequest) (Run, error) {
+	return w.provider(req).FetchRun(ctx, req)
+}
+
+// getOptionalFile returns a file of the head commit, or nil if it doesn't exist.
+func (w *Worker) getOptionalFile(ctx context.Context, req *queue.WorkRequest, path, ref string) ([]byte, error) {
+	data, err := w.provider(req).GetFile(ctx, req.Org, req.Repo, path, ref)
+	if isNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s: %w", path, err)
+	}
+	return data, nil
+}
+
+// publishNeutral completes the check run of a PR run that won't be analyzed
+// as neutral, so the PR isn't left waiting for analysis that will never
+// happen.
+func (w *Worker) publishNeutral(ctx context.Context, req *queue.WorkRequest, title, summary string) error {
+	return w.publishConclusion(ctx, req, ConclusionNeutral, title, summary)
+}
+
+// publishConclusion publishes a check run with only a conclusion and an
+// explanation for the PR of a request; runs of branches get none.
+func (w *Worker) publishConclusion(ctx context.Context, req *queue.WorkRequest, conclusion, title, summary string) error {
+	run, err := w.fetchRun(ctx, req)
+	if err != nil {
+		return err
+	}
+	if !run.IsPullRequest() {
+		return nil
+	}
+	return w.provider(req).Publisher(req, w.logger(), nil).PublishCheckRun(ctx, req, &CheckRun{
+		Name:       CheckRunName,
+		HeadSHA:    run.HeadSHA,
+		Conclusion: conclusion,
+		Title:      title,
+		Summary:    summary,
+	})
+}
+
+// reportExhausted publishes an action_required check run for a request that
+// failed on its last delivery with err. Failing to publish it is only
+// logged, so the request is still dead-lettered.
+func (w *Worker) reportExhausted(ctx context.Context, logger *slog.Logger, req *queue.WorkRequest, delivery queue.Delivery, err error) {
+	// The request may have been cancelled by a drain
+	ctx = context.WithoutCancel(ctx)
+	summary := fmt.Sprintf("Canopy could not analyze the coverage of this run after %d attempts: %s.\n\n"+
+		"Re-run this check, or the workflow, to try again once the cause is fixed.", delivery.Attempt, err)
+	if err := w.publishConclusion(ctx, req, ConclusionActionRequired, "Coverage analysis failed", summary); err != nil {
+		logger.Warn("failed to report exhausted work request", "error", err)
+	}
+}
+
+func (w *Worker) logger() *slog.Logger {
+	if w.Logger == nil {
+		return slog.Default()
+	}
+	return w.Logger
+}
+
+// GitHubPublisher is the Publisher used by the worker: coverage is saved to
+// storage, and check runs and comments are published with the GitHub API.
+type GitHubPublisher struct {
+	GitHub  GitHub
+	Storage storage.Storage
+	Org     string
+	Repo    string
+	// Logger receives annotation upload progress; nil uses slog.Default
+	Logger *slog.Logger
+	// APIBudget decides whether the PR comment is posted; nil always posts it
+	APIBudget *APIBudget
+
+	// skipComment is why the comment is skipped, decided with the check run
+	// so the check run can say so; empty posts it
+	skipComment string
+}
+
+// SaveCoverage implements Publisher.
+func (p *GitHubPublisher) SaveCoverage(ctx context.Context, key storage.CoverageKey, data []byte) error {
+	return p.Storage.SaveCoverage(ctx, key, data)
+}
+
+// PublishCheckRun implements Publisher. If only some annotation batches
+// could be uploaded, the check run notes it and publishing continues. If
+// the APIBudget is exhausted, the check run notes that the PR comment is
+// skipped.
+func (p *GitHubPublisher) PublishCheckRun(ctx context.Context, req *queue.WorkRequest, run *CheckRun) error {
+	logger := p.logger()
+	summary := run.Summary
+	if p.skipComment = p.APIBudget.Exhausted(); p.skipComment != "" {
+		summary += fmt.Sprintf("\n_The coverage comment was skipped to save GitHub API quota: %s._\n", p.skipComment)
+	}
+	_, err := p.GitHub.CreateCheckRun(ctx, p.Org, p.Repo, &github.CheckRun{
+		Name:        run.Name,
+		HeadSHA:     run.HeadSHA,
+		Status:      run.Status,
+		Conclusion:  run.Conclusion,
+		Title:       run.Title,
+		Summary:     summary,
+		Text:        run.Text,
+		Annotations: run.Annotations,
+		ExternalID:  req.CheckRunExternalID(),
+		Progress: func(uploaded, total int) {
+			logger.Debug("uploaded annotations", "uploaded", uploaded, "total", total)
+		},
+	})
+	var partial *github.PartialUploadError
+	if errors.As(err, &partial) {
+		logger.Warn("published check run with partial annotations", "uploaded", partial.Uploaded, "total", partial.Total,
+			"failed_batches", partial.FailedBatches, "error", partial.Err)
+		return nil
+	}
+	return err
+}
+
+// PublishComment implements Publisher. With repoconfig.CommentUpdate, the
+// comment carrying CommentMarker is edited if the PR already has one. The
+// comment isn't posted if PublishCheckRun found the APIBudget exhausted.
+func (p *GitHubPublisher) PublishComment(ctx context.Context, req *queue.WorkRequest, comment *Comment) error {
+	if p.skipComment != "" {
+		p.logger().Warn("skipping PR comment over GitHub API budget", "reason", p.skipComment, "pull_request", comment.PullRequest)
+		return nil
+	}
+	body := CommentMarker + "\n" + comment.Body
+	if comment.Behavior == repoconfig.CommentUpdate {
+		comments, err := p.GitHub.ListIssueComments(ctx, p.Org, p.Repo, comment.PullRequest)
+		if err != nil {
+			return fmt.Errorf("failed to list comments: %w", err)
+		}
+		for _, c := range comments {
+			if strings.Contains(c.Body, CommentMarker) {
+				return p.GitHub.UpdateIssueComment(ctx, p.Org, p.Repo, c.ID, body)
+			}
+		}
+	}
+	return p.GitHub.CreateIssueComment(ctx, p.Org, p.Repo, comment.PullRequest, body)
+}
+
+// PublishLabels implements LabelPublisher. Labels are optional, so failing
+// to read or change them is only logged, and they aren't changed if the
+// APIBudget is exhausted.
+func (p *GitHubPublisher) PublishLabels(ctx context.Context, req *queue.WorkRequest, pullRequest int, bands []github.LabelBand, patchCoverage float64) error {
+	logger := p.logger().With("pull_request", pullRequest)
+	if reason := p.APIBudget.Exhausted(); reason != "" {
+		logger.Warn("skipping PR labels over GitHub API budget", "reason", reason)
+		return nil
+	}
+	current, err := p.GitHub.ListIssueLabels(ctx, p.Org, p.Repo, pullRequest)
+	if err != nil {
+		logger.Warn("failed to list PR labels", "error", err)
+		return nil
+	}
+	changes := github.PlanLabelChanges(bands, patchCoverage, current)
+	if len(changes.Add) > 0 {
+		if err := p.GitHub.AddIssueLabels(ctx, p.Org, p.Repo, pullRequest, changes.Add); err != nil {
+			logger.Warn("failed to add PR labels", "labels", changes.Add, "error", err)
+		}
+	}
+	for _, label := range changes.Remove {
+		if err := p.GitHub.RemoveIssueLabel(ctx, p.Org, p.Repo, pullRequest, label); err != nil {
+			logger.Warn("failed to remove PR label", "label", label, "error", err)
+		}
+	}
+	return nil
+}
+
+func (p *GitHubPublisher) logger() *slog.Logger {
+	if p.Logger == nil {
+		return slog.Default()
+	}
+	return p.Logger
+}
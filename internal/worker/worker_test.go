@@ -0,0 +1,811 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/clock"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/github/auth"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/idempotency"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/logging"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/queue"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/repoconfig"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/storage"
+	"github.com/oleg-kozlyuk-grafana/go-canopy/internal/trend"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// fakeGitHub serves a recorded fixture as the GitHub API and records what
+// is published.
+type fakeGitHub struct {
+	in      *Inputs
+	expired bool
+	// artifactSize is the listed size of coverage artifacts
+	artifactSize int64
+	runErr       error
+	// checkRunErr is returned after recording a check run
+	checkRunErr error
+	comments    []github.IssueComment
+	// prHeadSHA is the PR's head, if the PR was pushed to since the run
+	prHeadSHA string
+	// coverageDiff is served as the diff between any two commits
+	coverageDiff []byte
+	// mergeBase is the merge base of any two commits
+	mergeBase string
+	// suiteRuns are the check runs of any check suite
+	suiteRuns []github.CheckRunInfo
+	// labels are the labels of any PR
+	labels []string
+	// labelErr is returned by the label API
+	labelErr error
+	// files are the repository's files other than its config, by path
+	files map[string][]byte
+
+	artifactListings int
+	downloads        int
+	// installations are the installations runs were fetched as
+	installations []int64
+	checkRuns     []*github.CheckRun
+	// compared are the commit ranges diffed, as "base...head"
+	compared []string
+	created  []string
+	updated  map[int64]string
+	// labelChanges are the labels added and removed, as "+label" and "-label"
+	labelChanges []string
+}
+
+func newFakeGitHub(t *testing.T, fixture string) *fakeGitHub {
+	t.Helper()
+	in, err := LoadFixture(fixture)
+	require.NoError(t, err)
+	return &fakeGitHub{in: in, updated: make(map[int64]string)}
+}
+
+func (f *fakeGitHub) GetRepository(ctx context.Context, owner, repo string) (*github.RepositoryInfo, error) {
+	return &github.RepositoryInfo{DefaultBranch: f.in.Run.DefaultBranch, HTMLURL: f.in.Run.RepoURL}, nil
+}
+
+func (f *fakeGitHub) GetWorkflowRun(ctx context.Context, owner, repo string, runID int64) (*github.WorkflowRun, error) {
+	f.installations = append(f.installations, auth.InstallationID(ctx))
+	if f.runErr != nil {
+		return nil, f.runErr
+	}
+	run := &github.WorkflowRun{ID: runID, HeadSHA: f.in.Run.HeadSHA, HeadBranch: f.in.Run.HeadBranch}
+	if f.in.Run.Workflow != "" {
+		run.Path = ".github/workflows/" + f.in.Run.Workflow
+	}
+	if f.in.Run.PullRequest > 0 {
+		run.PullRequests = []github.PullRequestRef{{Number: f.in.Run.PullRequest}}
+	}
+	return run, nil
+}
+
+func (f *fakeGitHub) ListRunArtifacts(ctx context.Context, owner, repo string, runID int64) ([]github.RunArtifact, error) {
+	f.artifactListings++
+	artifacts := []github.RunArtifact{{ID: 99, Name: "logs"}}
+	for i, a := range f.in.Artifacts {
+		artifacts = append(artifacts, github.RunArtifact{ID: int64(i), Name: a.Name, Expired: f.expired, SizeInBytes: f.artifactSize})
+	}
+	return artifacts, nil
+}
+
+func (f *fakeGitHub) DownloadArtifactTo(ctx context.Context, owner, repo string, artifactID int64, w io.Writer, limit int64) (int64, error) {
+	if artifactID == 99 {
+		return 0, errors.New("non-coverage artifact downloaded")
+	}
+	f.downloads++
+	n, err := w.Write(f.in.Artifacts[artifactID].Data)
+	return int64(n), err
+}
+
+func (f *fakeGitHub) GetPullRequest(ctx context.Context, owner, repo string, number int) (*github.PullRequest, error) {
+	pr := &github.PullRequest{Number: number}
+	pr.Head.SHA = f.in.Run.HeadSHA
+	if f.prHeadSHA != "" {
+		pr.Head.SHA = f.prHeadSHA
+	}
+	return pr, nil
+}
+
+func (f *fakeGitHub) CompareDiff(ctx context.Context, owner, repo, base, head string) ([]byte, error) {
+	f.compared = append(f.compared, base+"..."+head)
+	return f.coverageDiff, nil
+}
+
+func (f *fakeGitHub) MergeBase(ctx context.Context, owner, repo, base, head string) (string, error) {
+	if f.mergeBase == "" {
+		return "", errors.New("no merge base")
+	}
+	return f.mergeBase, nil
+}
+
+func (f *fakeGitHub) PullRequestDiff(ctx context.Context, owner, repo string, number int) ([]byte, error) {
+	return f.in.Diff, nil
+}
+
+func (f *fakeGitHub) GetFile(ctx context.Context, owner, repo, path, ref string) ([]byte, error) {
+	if path == f.in.RepoConfigPath && f.in.RepoConfig != nil {
+		return f.in.RepoConfig, nil
+	}
+	if data, ok := f.files[path]; ok {
+		return data, nil
+	}
+	return nil, &github.APIError{StatusCode: 404, Message: "Not Found"}
+}
+
+func (f *fakeGitHub) CreateCheckRun(ctx context.Context, owner, repo string, run *github.CheckRun) (int64, error) {
+	f.checkRuns = append(f.checkRuns, run)
+	return 1, f.checkRunErr
+}
+
+func (f *fakeGitHub) ListCheckSuiteRuns(ctx context.Context, owner, repo string, suiteID int64, name string) ([]github.CheckRunInfo, error) {
+	return f.suiteRuns, nil
+}
+
+func (f *fakeGitHub) ListIssueComments(ctx context.Context, owner, repo string, number int) ([]github.IssueComment, error) {
+	return f.comments, nil
+}
+
+func (f *fakeGitHub) CreateIssueComment(ctx context.Context, owner, repo string, number int, body string) error {
+	f.created = append(f.created, body)
+	return nil
+}
+
+func (f *fakeGitHub) UpdateIssueComment(ctx context.Context, owner, repo string, commentID int64, body string) error {
+	f.updated[commentID] = body
+	return nil
+}
+
+func (f *fakeGitHub) ListIssueLabels(ctx context.Context, owner, repo string, number int) ([]string, error) {
+	return f.labels, f.labelErr
+}
+
+func (f *fakeGitHub) AddIssueLabels(ctx context.Context, owner, repo string, number int, labels []string) error {
+	for _, label := range labels {
+		f.labelChanges = append(f.labelChanges, "+"+label)
+	}
+	return f.labelErr
+}
+
+func (f *fakeGitHub) RemoveIssueLabel(ctx context.Context, owner, repo string, number int, label string) error {
+	f.labelChanges = append(f.labelChanges, "-"+label)
+	return f.labelErr
+}
+
+func TestWorker_PullRequest(t *testing.T) {
+	gh := newFakeGitHub(t, "testdata/fixtures/pr")
+	store := &memoryStorage{data: map[storage.CoverageKey][]byte{
+		{Org: "acme", Repo: "widgets", Branch: "main"}: gh.in.BaseCoverage,
+	}}
+	w := &Worker{GitHub: gh, Storage: store}
+
+	require.NoError(t, w.ProcessWorkRequest(context.Background(), gh.in.Request))
+
+	// The published check run matches the simulation of the same fixture
+	data, err := os.ReadFile("testdata/fixtures/pr/expected/check_run.json")
+	require.NoError(t, err)
+	var expected CheckRun
+	require.NoError(t, json.Unmarshal(data, &expected))
+	require.Len(t, gh.checkRuns, 1)
+	got := gh.checkRuns[0]
+	assert.Equal(t, expected.HeadSHA, got.HeadSHA)
+	assert.Equal(t, expected.Conclusion, got.Conclusion)
+	assert.Equal(t, expected.Summary, got.Summary)
+	assert.Equal(t, expected.Annotations, got.Annotations)
+
+	require.Len(t, gh.created, 1)
+	assert.True(t, strings.HasPrefix(gh.created[0], CommentMarker+"\n## Canopy Coverage Report"))
+}
+
+func TestWorker_RemapStaleCoverage(t *testing.T) {
+	t.Run("pushed to since the run", func(t *testing.T) {
+		gh := newFakeGitHub(t, "testdata/fixtures/pr")
+		gh.prHeadSHA = "9e8d7c6b5a4f3e2d1c0b9a8f7e6d5c4b3a2f1e0d"
+		// Two lines were inserted above the coverage's blocks since
+		gh.coverageDiff = []byte("diff --git a/calc.go b/calc.go\n--- a/calc.go\n+++ b/calc.go\n@@ -2,0 +3,2 @@\n+// Add returns the sum of a and b.\n+//\n")
+		w := &Worker{GitHub: gh, Storage: &memoryStorage{data: map[storage.CoverageKey][]byte{}}, RemapStaleCoverage: true}
+
+		require.NoError(t, w.ProcessWorkRequest(context.Background(), gh.in.Request))
+
+		assert.Equal(t, []string{gh.in.Run.HeadSHA + "..." + gh.prHeadSHA}, gh.compared)
+		require.Len(t, gh.checkRuns, 1)
+		got := gh.checkRuns[0]
+		assert.Equal(t, gh.prHeadSHA, got.HeadSHA)
+		assert.True(t, strings.HasPrefix(got.Summary, "_Coverage was generated at `3f2a9c1`, before the PR's head"))
+		require.Len(t, got.Annotations, 1)
+		assert.Equal(t, 9, got.Annotations[0].StartLine)
+		assert.Equal(t, 11, got.Annotations[0].EndLine)
+	})
+
+	t.Run("run of the head", func(t *testing.T) {
+		gh := newFakeGitHub(t, "testdata/fixtures/pr")
+		w := &Worker{GitHub: gh, Storage: &memoryStorage{data: map[storage.CoverageKey][]byte{}}, RemapStaleCoverage: true}
+
+		require.NoError(t, w.ProcessWorkRequest(context.Background(), gh.in.Request))
+
+		assert.Empty(t, gh.compared)
+		require.Len(t, gh.checkRuns, 1)
+		assert.Equal(t, gh.in.Run.HeadSHA, gh.checkRuns[0].HeadSHA)
+		assert.NotContains(t, gh.checkRuns[0].Summary, "remapped")
+	})
+}
+
+func TestWorker_RepoConfigArtifacts(t *testing.T) {
+	gh := newFakeGitHub(t, "testdata/fixtures/push")
+	gh.in.RepoConfigPath = ".github/canopy.yml"
+	gh.in.RepoConfig = []byte("artifacts: [\"*-unit.out\"]\n")
+	w := &Worker{GitHub: gh, Storage: &memoryStorage{data: map[storage.CoverageKey][]byte{}}, ArtifactPatterns: []string{"coverage*"}}
+
+	require.NoError(t, w.ProcessWorkRequest(context.Background(), gh.in.Request))
+
+	// Only the unit coverage matches the repository's patterns
+	assert.Equal(t, 1, gh.downloads)
+}
+
+func TestWorker_Workflows(t *testing.T) {
+	store := &memoryStorage{data: map[storage.CoverageKey][]byte{}}
+	runWorkflow := func(t *testing.T, workflow, artifact string) *fakeGitHub {
+		t.Helper()
+		gh := newFakeGitHub(t, "testdata/fixtures/pr")
+		gh.in.RepoConfig = append(gh.in.RepoConfig, "workflows: [unit.yml, integration.yml]\n"...)
+		gh.in.Run.Workflow = workflow
+		var artifacts []Artifact
+		for _, a := range gh.in.Artifacts {
+			if a.Name == artifact {
+				artifacts = append(artifacts, a)
+			}
+		}
+		gh.in.Artifacts = artifacts
+		w := &Worker{GitHub: gh, Storage: store}
+		require.NoError(t, w.ProcessWorkRequest(context.Background(), gh.in.Request))
+		return gh
+	}
+
+	t.Run("unlisted workflow is skipped", func(t *testing.T) {
+		gh := runWorkflow(t, "lint.yml", "coverage-unit.out")
+		assert.Zero(t, gh.artifactListings)
+		assert.Empty(t, gh.checkRuns)
+	})
+
+	t.Run("first workflow leaves the check in progress", func(t *testing.T) {
+		gh := runWorkflow(t, "unit.yml", "coverage-unit.out")
+		require.Len(t, gh.checkRuns, 1)
+		assert.Equal(t, github.CheckRunInProgress, gh.checkRuns[0].Status)
+		assert.Equal(t, "Waiting for integration.yml", gh.checkRuns[0].Title)
+		assert.Empty(t, gh.created)
+		assert.Contains(t, store.data, WorkflowKey("acme", "widgets", gh.in.Run.HeadSHA, "unit.yml"))
+		assert.NotContains(t, store.data, PullRequestKey("acme", "widgets", gh.in.Run.PullRequest))
+	})
+
+	t.Run("last workflow completes the check", func(t *testing.T) {
+		gh := runWorkflow(t, "integration.yml", "coverage-integration.out")
+		require.Len(t, gh.checkRuns, 1)
+		got := gh.checkRuns[0]
+		assert.Empty(t, got.Status)
+		assert.NotEmpty(t, got.Conclusion)
+
+		// Merged, the coverage is that of both artifacts of the fixture
+		data, err := os.ReadFile("testdata/fixtures/pr/expected/check_run.json")
+		require.NoError(t, err)
+		var expected CheckRun
+		require.NoError(t, json.Unmarshal(data, &expected))
+		assert.Equal(t, expected.Annotations, got.Annotations)
+		assert.Len(t, gh.created, 1)
+		assert.Contains(t, store.data, PullRequestKey("acme", "widgets", gh.in.Run.PullRequest))
+	})
+}
+
+func TestWorker_AuthenticatesAsInstallation(t *testing.T) {
+	gh := newFakeGitHub(t, "testdata/fixtures/pr")
+	w := &Worker{GitHub: gh, Storage: &memoryStorage{data: map[storage.CoverageKey][]byte{}}}
+	req := *gh.in.Request
+	req.InstallationID = 314
+
+	require.NoError(t, w.ProcessWorkRequest(context.Background(), &req))
+
+	assert.Equal(t, []int64{314}, gh.installations)
+}
+
+func TestWorker_UpdatesExistingComment(t *testing.T) {
+	gh := newFakeGitHub(t, "testdata/fixtures/pr")
+	gh.in.RepoConfig = nil // default comment behavior is update
+	gh.comments = []github.IssueComment{{ID: 1, Body: "LGTM"}, {ID: 2, Body: CommentMarker + "\nold report"}}
+	w := &Worker{GitHub: gh, Storage: &memoryStorage{data: map[storage.CoverageKey][]byte{}}}
+
+	require.NoError(t, w.ProcessWorkRequest(context.Background(), gh.in.Request))
+
+	assert.Empty(t, gh.created)
+	require.Contains(t, gh.updated, int64(2))
+	assert.Contains(t, gh.updated[2], "## Canopy Coverage Report")
+}
+
+func TestWorker_PartialAnnotationUpload(t *testing.T) {
+	gh := newFakeGitHub(t, "testdata/fixtures/pr")
+	gh.checkRunErr = &github.PartialUploadError{Uploaded: 50, Total: 120, FailedBatches: []int{2, 3}, Err: errors.New("bad gateway")}
+	store := &memoryStorage{data: map[storage.CoverageKey][]byte{}}
+	w := &Worker{GitHub: gh, Storage: store}
+
+	require.NoError(t, w.ProcessWorkRequest(context.Background(), gh.in.Request))
+
+	// Publishing continues after the check run
+	assert.Len(t, gh.created, 1)
+	assert.Contains(t, store.data, PullRequestKey("acme", "widgets", gh.in.Run.PullRequest))
+}
+
+func TestWorker_CoverageLabels(t *testing.T) {
+	// The fixture's patch coverage is 50%
+	bands := []github.LabelBand{
+		{Label: "well-tested", Min: 90, Max: 100},
+		{Label: "partly-tested", Min: 50, Max: 90},
+		{Label: "needs-tests", Min: 0, Max: 50},
+	}
+	tests := []struct {
+		name     string
+		bands    []github.LabelBand
+		labels   []string
+		labelErr error
+		expected []string
+	}{
+		{
+			name:     "moves between bands",
+			bands:    bands,
+			labels:   []string{"Well-Tested", "bug"},
+			expected: []string{"+partly-tested", "-well-tested"},
+		},
+		{
+			name:   "already labeled",
+			bands:  bands,
+			labels: []string{"partly-tested", "bug"},
+		},
+		{
+			name:   "no bands",
+			labels: []string{"well-tested"},
+		},
+		{
+			name:     "label API failure",
+			bands:    bands,
+			labelErr: errors.New("forbidden"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := newFakeGitHub(t, "testdata/fixtures/pr")
+			gh.labels, gh.labelErr = tt.labels, tt.labelErr
+			w := &Worker{GitHub: gh, Storage: &memoryStorage{data: map[storage.CoverageKey][]byte{}}, CoverageLabels: tt.bands}
+
+			require.NoError(t, w.ProcessWorkRequest(context.Background(), gh.in.Request))
+
+			assert.Equal(t, tt.expected, gh.labelChanges)
+			assert.Len(t, gh.checkRuns, 1)
+		})
+	}
+}
+
+func TestWorker_AnnotationSeverity(t *testing.T) {
+	source := "package widgets\n\n" +
+		"func Add(a, b int) int {\n\treturn a + b\n}\n\n" +
+		"func Sub(a, b int) int {\n\treturn a - b\n}\n\n" +
+		"func Mul3(a, b, c int) int {\n\treturn a * b * c\n}\n"
+	// Sub, on lines 7-9, is the fixture's uncovered function
+	tests := []struct {
+		name     string
+		config   string
+		files    map[string][]byte
+		expected map[int]string
+	}{
+		{
+			name:     "exported functions",
+			config:   "annotations:\n  severity:\n    exported: warning\n",
+			files:    map[string][]byte{"calc.go": []byte(source)},
+			expected: map[int]string{7: "warning"},
+		},
+		{
+			name:     "no error handling",
+			config:   "annotations:\n  severity:\n    error_handling: failure\n",
+			files:    map[string][]byte{"calc.go": []byte(source)},
+			expected: map[int]string{7: "notice"},
+		},
+		{
+			name:     "source unavailable",
+			config:   "annotations:\n  level: warning\n  severity:\n    exported: failure\n",
+			expected: map[int]string{7: "warning"},
+		},
+		{
+			name:     "low patch coverage",
+			config:   "annotations:\n  severity:\n    low_coverage: 80\n",
+			expected: map[int]string{1: "failure", 7: "notice"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := newFakeGitHub(t, "testdata/fixtures/pr")
+			gh.in.RepoConfigPath, gh.in.RepoConfig = repoconfig.Paths[0], []byte(tt.config)
+			gh.files = tt.files
+			w := &Worker{GitHub: gh, Storage: &memoryStorage{data: map[storage.CoverageKey][]byte{}}}
+
+			require.NoError(t, w.ProcessWorkRequest(context.Background(), gh.in.Request))
+
+			require.Len(t, gh.checkRuns, 1)
+			levels := make(map[int]string)
+			for _, a := range gh.checkRuns[0].Annotations {
+				levels[a.StartLine] = a.Level
+			}
+			assert.Equal(t, tt.expected, levels)
+		})
+	}
+}
+
+func TestWorker_DefaultBranch(t *testing.T) {
+	gh := newFakeGitHub(t, "testdata/fixtures/push")
+	// The stored trend is read from storage, not the fixture
+	trendKey := trend.Key("acme", "widgets", "main")
+	store := &memoryStorage{data: map[storage.CoverageKey][]byte{trendKey: gh.in.Trend}}
+	w := &Worker{GitHub: gh, Storage: store}
+
+	require.NoError(t, w.ProcessWorkRequest(context.Background(), gh.in.Request))
+
+	expected, err := os.ReadFile("testdata/fixtures/push/expected/coverage/acme/widgets/main/coverage.out")
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), string(store.data[storage.CoverageKey{Org: "acme", Repo: "widgets", Branch: "main"}]))
+	expected, err = os.ReadFile("testdata/fixtures/push/expected/coverage/acme/widgets/main/trend.json")
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), string(store.data[trendKey]))
+	assert.Empty(t, gh.checkRuns)
+}
+
+func TestWorker_SkippedRequests(t *testing.T) {
+	t.Run("no coverage artifacts", func(t *testing.T) {
+		gh := newFakeGitHub(t, "testdata/fixtures/pr")
+		gh.in.Artifacts = nil
+		w := &Worker{GitHub: gh, Storage: &memoryStorage{data: map[storage.CoverageKey][]byte{}}}
+
+		require.NoError(t, w.ProcessWorkRequest(context.Background(), gh.in.Request))
+		assert.Empty(t, gh.checkRuns)
+	})
+
+	t.Run("expired artifacts", func(t *testing.T) {
+		gh := newFakeGitHub(t, "testdata/fixtures/pr")
+		gh.expired = true
+		w := &Worker{GitHub: gh, Storage: &memoryStorage{data: map[storage.CoverageKey][]byte{}}}
+
+		require.NoError(t, w.ProcessWorkRequest(context.Background(), gh.in.Request))
+		assert.Empty(t, gh.checkRuns)
+	})
+
+	t.Run("stale run", func(t *testing.T) {
+		gh := newFakeGitHub(t, "testdata/fixtures/pr")
+		w := &Worker{GitHub: gh, Storage: &memoryStorage{data: map[storage.CoverageKey][]byte{}}, MaxRunAge: time.Hour}
+
+		require.NoError(t, w.ProcessWorkRequest(context.Background(), gh.in.Request))
+		assert.Zero(t, gh.artifactListings)
+		require.Len(t, gh.checkRuns, 1)
+		assert.Equal(t, ConclusionNeutral, gh.checkRuns[0].Conclusion)
+		assert.Equal(t, gh.in.Run.HeadSHA, gh.checkRuns[0].HeadSHA)
+	})
+
+	t.Run("run within max age at the worker's clock", func(t *testing.T) {
+		gh := newFakeGitHub(t, "testdata/fixtures/pr")
+		w := &Worker{
+			GitHub:    gh,
+			Storage:   &memoryStorage{data: map[storage.CoverageKey][]byte{}},
+			MaxRunAge: time.Hour,
+			Clock:     clock.Fixed(gh.in.Request.RunCompletedAt.Add(time.Minute)),
+		}
+
+		require.NoError(t, w.ProcessWorkRequest(context.Background(), gh.in.Request))
+		require.Len(t, gh.checkRuns, 1)
+		assert.NotEqual(t, ConclusionNeutral, gh.checkRuns[0].Conclusion)
+	})
+}
+
+func TestWorker_MemoryBudget(t *testing.T) {
+	t.Run("PR run over budget", func(t *testing.T) {
+		gh := newFakeGitHub(t, "testdata/fixtures/pr")
+		store := &memoryStorage{data: map[storage.CoverageKey][]byte{}}
+		w := &Worker{GitHub: gh, Storage: store, MemoryBudget: 64}
+
+		// The request is acknowledged, and the PR is told why it wasn't analyzed
+		require.NoError(t, w.ProcessWorkRequest(context.Background(), gh.in.Request))
+		require.Len(t, gh.checkRuns, 1)
+		assert.Equal(t, ConclusionNeutral, gh.checkRuns[0].Conclusion)
+		assert.Equal(t, "Coverage too large to analyze", gh.checkRuns[0].Title)
+		assert.Contains(t, gh.checkRuns[0].Summary, "(64 B)")
+		assert.Contains(t, gh.checkRuns[0].Summary, "memory budget exceeded")
+		assert.Empty(t, gh.created)
+		assert.Empty(t, store.data)
+	})
+
+	t.Run("default branch run over budget", func(t *testing.T) {
+		gh := newFakeGitHub(t, "testdata/fixtures/push")
+		store := &memoryStorage{data: map[storage.CoverageKey][]byte{}}
+		w := &Worker{GitHub: gh, Storage: store, MemoryBudget: 64}
+
+		require.NoError(t, w.ProcessWorkRequest(context.Background(), gh.in.Request))
+		assert.Empty(t, gh.checkRuns)
+		assert.Empty(t, store.data)
+	})
+
+	t.Run("PR run within budget", func(t *testing.T) {
+		gh := newFakeGitHub(t, "testdata/fixtures/pr")
+		w := &Worker{GitHub: gh, Storage: &memoryStorage{data: map[storage.CoverageKey][]byte{}}, MemoryBudget: 64 << 20}
+
+		require.NoError(t, w.ProcessWorkRequest(context.Background(), gh.in.Request))
+		require.Len(t, gh.checkRuns, 1)
+		assert.NotEqual(t, ConclusionNeutral, gh.checkRuns[0].Conclusion)
+	})
+}
+
+func TestWorker_GitHubErrorIsRetried(t *testing.T) {
+	gh := newFakeGitHub(t, "testdata/fixtures/pr")
+	gh.runErr = &github.APIError{StatusCode: 502, Message: "Bad Gateway"}
+	w := &Worker{GitHub: gh, Storage: &memoryStorage{data: map[storage.CoverageKey][]byte{}}}
+
+	err := w.ProcessWorkRequest(context.Background(), &queue.WorkRequest{Org: "acme", Repo: "widgets", WorkflowRunID: 1})
+	assert.ErrorContains(t, err, "failed to get workflow run")
+}
+
+func TestWorker_ExhaustedDeliveries(t *testing.T) {
+	tests := []struct {
+		name      string
+		delivery  *queue.Delivery
+		checkRuns int
+	}{
+		{name: "no delivery", checkRuns: 1},
+		{name: "retried delivery", delivery: &queue.Delivery{Attempt: 2, MaxAttempts: 5}, checkRuns: 1},
+		{name: "unlimited deliveries", delivery: &queue.Delivery{Attempt: 9}, checkRuns: 1},
+		{name: "last delivery", delivery: &queue.Delivery{Attempt: 5, MaxAttempts: 5}, checkRuns: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := newFakeGitHub(t, "testdata/fixtures/pr")
+			gh.checkRunErr = &github.APIError{StatusCode: 502, Message: "Bad Gateway"}
+			w := &Worker{GitHub: gh, Storage: &memoryStorage{data: map[storage.CoverageKey][]byte{}}}
+			ctx := context.Background()
+			if tt.delivery != nil {
+				ctx = queue.WithDelivery(ctx, *tt.delivery)
+			}
+
+			// The request is still returned for the queue to dead-letter
+			require.Error(t, w.ProcessWorkRequest(ctx, gh.in.Request))
+			require.Len(t, gh.checkRuns, tt.checkRuns)
+			if tt.checkRuns > 1 {
+				last := gh.checkRuns[len(gh.checkRuns)-1]
+				assert.Equal(t, ConclusionActionRequired, last.Conclusion)
+				assert.Equal(t, "Coverage analysis failed", last.Title)
+				assert.Equal(t, gh.in.Run.HeadSHA, last.HeadSHA)
+				assert.Contains(t, last.Summary, "after 5 attempts")
+				assert.Contains(t, last.Summary, "Bad Gateway")
+			}
+		})
+	}
+}
+
+func TestWorker_CorrelationID(t *testing.T) {
+	gh := newFakeGitHub(t, "testdata/fixtures/pr")
+	var logs bytes.Buffer
+	w := &Worker{GitHub: gh, Storage: &memoryStorage{data: map[storage.CoverageKey][]byte{}}, Logger: logging.New(&logs, slog.LevelInfo)}
+	req := *gh.in.Request
+	req.CorrelationID = "72d3162e-cc78-11e3-81ab-4c9367dc0958"
+
+	require.NoError(t, w.ProcessWorkRequest(context.Background(), &req))
+
+	require.Len(t, gh.checkRuns, 1)
+	assert.Equal(t, "4242/72d3162e-cc78-11e3-81ab-4c9367dc0958", gh.checkRuns[0].ExternalID)
+	assert.Contains(t, logs.String(), `"msg":"processed work request"`)
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		assert.Contains(t, line, `"correlation_id":"72d3162e-cc78-11e3-81ab-4c9367dc0958"`)
+	}
+}
+
+func TestWorker_CheckSuiteRerequested(t *testing.T) {
+	tests := []struct {
+		name      string
+		suiteRuns []github.CheckRunInfo
+		checkRuns int
+	}{
+		{
+			name: "resolved to the analyzed run",
+			suiteRuns: []github.CheckRunInfo{
+				{ID: 5, Name: CheckRunName, ExternalID: "72d3162e-cc78-11e3-81ab-4c9367dc0958"},
+				{ID: 4, Name: CheckRunName, ExternalID: "4242/0b4ad2c8-cc79-11e3-8f2e-4c9367dc0958"},
+			},
+			checkRuns: 1,
+		},
+		{name: "no Canopy check run", checkRuns: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := newFakeGitHub(t, "testdata/fixtures/pr")
+			gh.suiteRuns = tt.suiteRuns
+			w := &Worker{GitHub: gh, Storage: &memoryStorage{data: map[storage.CoverageKey][]byte{}}}
+			req := &queue.WorkRequest{Org: "acme", Repo: "widgets", EventType: queue.EventCheckSuite, CheckSuiteID: 77, CorrelationID: "e3a1c9f0-cc79-11e3-9a5d-4c9367dc0958"}
+
+			require.NoError(t, w.ProcessWorkRequest(context.Background(), req))
+			require.Len(t, gh.checkRuns, tt.checkRuns)
+			if tt.checkRuns > 0 {
+				assert.Equal(t, "4242/e3a1c9f0-cc79-11e3-9a5d-4c9367dc0958", gh.checkRuns[0].ExternalID)
+			}
+			// The queued request is left as delivered
+			assert.Zero(t, req.WorkflowRunID)
+		})
+	}
+}
+
+func TestWorker_UploadedCoverage(t *testing.T) {
+	tests := []struct {
+		name      string
+		event     string
+		uploaded  bool
+		checkRuns int
+	}{
+		{name: "pull request event", event: queue.EventPullRequest, uploaded: true, checkRuns: 1},
+		{name: "upload", event: queue.EventUpload, uploaded: true, checkRuns: 1},
+		{name: "nothing uploaded", event: queue.EventPullRequest, checkRuns: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := newFakeGitHub(t, "testdata/fixtures/pr")
+			gh.runErr = errors.New("uploaded coverage has no workflow run")
+			store := &memoryStorage{data: map[storage.CoverageKey][]byte{
+				{Org: "acme", Repo: "widgets", Branch: "main"}: gh.in.BaseCoverage,
+			}}
+			if tt.uploaded {
+				store.data[ArtifactCopyKey("acme", "widgets", gh.in.Run.HeadSHA)] = gh.in.Artifacts[0].Data
+			}
+			w := &Worker{GitHub: gh, Storage: store}
+			req := &queue.WorkRequest{Org: "acme", Repo: "widgets", EventType: tt.event,
+				PullRequest: gh.in.Run.PullRequest, HeadSHA: gh.in.Run.HeadSHA, HeadBranch: gh.in.Run.HeadBranch}
+
+			require.NoError(t, w.ProcessWorkRequest(context.Background(), req))
+			assert.Zero(t, gh.artifactListings)
+			require.Len(t, gh.checkRuns, tt.checkRuns)
+			if tt.checkRuns > 0 {
+				assert.Equal(t, gh.in.Run.HeadSHA, gh.checkRuns[0].HeadSHA)
+				assert.Len(t, gh.created, 1)
+			}
+		})
+	}
+}
+
+func TestWorker_Idempotency(t *testing.T) {
+	ctx := context.Background()
+	gh := newFakeGitHub(t, "testdata/fixtures/pr")
+	store := idempotency.NewInMemoryStore()
+	w := &Worker{GitHub: gh, Storage: &memoryStorage{data: map[storage.CoverageKey][]byte{}}, Idempotency: store, IdempotencyTTL: time.Hour}
+	req := *gh.in.Request
+	req.CorrelationID = "72d3162e-cc78-11e3-81ab-4c9367dc0958"
+
+	// A failed delivery leaves the request for the next one
+	gh.runErr = &github.APIError{StatusCode: 502, Message: "Bad Gateway"}
+	require.Error(t, w.ProcessWorkRequest(ctx, &req))
+	gh.runErr = nil
+	require.NoError(t, w.ProcessWorkRequest(ctx, &req))
+	require.Len(t, gh.checkRuns, 1)
+
+	// Redeliveries are skipped
+	redelivered := req
+	require.NoError(t, w.ProcessWorkRequest(ctx, &redelivered))
+	assert.Len(t, gh.checkRuns, 1)
+
+	// A re-run is delivered with a new ID
+	rerun := req
+	rerun.CorrelationID = "0b4ad2c8-cc79-11e3-8f2e-4c9367dc0958"
+	require.NoError(t, w.ProcessWorkRequest(ctx, &rerun))
+	assert.Len(t, gh.checkRuns, 2)
+
+	// A delivery while another is processed is retried
+	concurrent := req
+	concurrent.CorrelationID = "e3a1c9f0-cc79-11e3-9a5d-4c9367dc0958"
+	status, err := store.Claim(ctx, idempotency.Key(&concurrent), time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, idempotency.Claimed, status)
+	assert.ErrorIs(t, w.ProcessWorkRequest(ctx, &concurrent), ErrDuplicateInProgress)
+	assert.Len(t, gh.checkRuns, 2)
+}
+
+func TestWorker_TraceContext(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	}()
+
+	gh := newFakeGitHub(t, "testdata/fixtures/pr")
+	w := &Worker{GitHub: gh, Storage: &memoryStorage{data: map[storage.CoverageKey][]byte{}}}
+	req := *gh.in.Request
+	req.TraceContext = map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}
+
+	require.NoError(t, w.ProcessWorkRequest(context.Background(), &req))
+
+	byName := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		byName[span.Name()] = span
+	}
+	require.Contains(t, byName, "worker.process")
+	process := byName["worker.process"]
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", process.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", process.Parent().SpanID().String())
+	for _, name := range []string{"artifacts.download", "coverage.merge", "coverage.analyze"} {
+		require.Contains(t, byName, name)
+		assert.Equal(t, process.SpanContext().SpanID(), byName[name].Parent().SpanID(), name)
+	}
+}
+
+func TestWorker_JobMetrics(t *testing.T) {
+	tests := []struct {
+		name     string
+		fixture  string
+		setup    func(gh *fakeGitHub, w *Worker)
+		expected string
+	}{
+		{name: "processed", fixture: "testdata/fixtures/pr", expected: jobProcessed},
+		{name: "skipped", fixture: "testdata/fixtures/pr", setup: func(gh *fakeGitHub, w *Worker) { gh.expired = true }, expected: jobSkipped},
+		{name: "stale", fixture: "testdata/fixtures/pr", setup: func(gh *fakeGitHub, w *Worker) { w.MaxRunAge = time.Hour }, expected: jobStale},
+		{name: "over budget", fixture: "testdata/fixtures/push", setup: func(gh *fakeGitHub, w *Worker) { w.MemoryBudget = 64 }, expected: jobOverBudget},
+		{
+			name:    "failed",
+			fixture: "testdata/fixtures/pr",
+			setup: func(gh *fakeGitHub, w *Worker) {
+				gh.runErr = &github.APIError{StatusCode: 502, Message: "Bad Gateway"}
+			},
+			expected: jobFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := newFakeGitHub(t, tt.fixture)
+			w := &Worker{GitHub: gh, Storage: &memoryStorage{data: map[storage.CoverageKey][]byte{}}}
+			if tt.setup != nil {
+				tt.setup(gh, w)
+			}
+			jobs, analyses := jobsTotal.Value(tt.expected), analysisDuration.Count(tt.expected)
+
+			_ = w.ProcessWorkRequest(context.Background(), gh.in.Request)
+			assert.Equal(t, jobs+1, jobsTotal.Value(tt.expected))
+			assert.Equal(t, analyses+1, analysisDuration.Count(tt.expected))
+		})
+	}
+}
+
+func TestWorker_LocksRunBranch(t *testing.T) {
+	gh := newFakeGitHub(t, "testdata/fixtures/pr")
+	store := &memoryStorage{data: map[storage.CoverageKey][]byte{}}
+	w := &Worker{GitHub: gh, Storage: store, Concurrency: NewConcurrency(2)}
+
+	// Another run of the branch is being processed
+	unlock, err := w.Concurrency.Lock(context.Background(), "acme/widgets/"+gh.in.Run.HeadBranch)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = w.ProcessWorkRequest(ctx, gh.in.Request)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Empty(t, gh.checkRuns)
+
+	unlock()
+	require.NoError(t, w.ProcessWorkRequest(context.Background(), gh.in.Request))
+	assert.Len(t, gh.checkRuns, 1)
+}